@@ -4,6 +4,7 @@ import (
 	"context"
 	"kori/docs/swagger"
 	"kori/internal/handlers"
+	"kori/internal/hooks"
 	"kori/internal/models/seeder/airley"
 	"kori/internal/utils/crypto"
 	"log"
@@ -84,11 +85,22 @@ func main() {
 		logger.Info("Discord webhook monitoring enabled")
 	}
 
+	// Register the hook URLs extensions are called at
+	hooks.RegisterWebhooks(cfg.Hooks)
+
 	// Start monitoring database connection pool
 	db.MonitorConnectionPool(10 * time.Hour)
 
 	db_instance := db.GetDB()
 
+	// Without Redis, tasks are queued in Postgres and run by this process
+	if cfg.Redis.UsesEmbeddedQueue() {
+		if err := tasks.OpenEmbeddedQueue(db_instance); err != nil {
+			log.Fatalf("Failed to open embedded task queue: %v", err)
+		}
+		logger.Warn("REDIS_HOST is empty, running tasks on the embedded queue; run a single instance only")
+	}
+
 	// Initialize task handlers
 	taskHandler := tasks.NewTaskHandler(db_instance)
 
@@ -133,23 +145,36 @@ func main() {
 	apiServer := api.NewServer(cfg, db_instance)
 	go func() {
 
-		// Initialize S3 service
-		s3Service, err := services.NewS3Service(
-			cfg.Storage.S3.BucketName,
-			cfg.Storage.S3.Endpoint,
-			cfg.Storage.S3.Region,
-			cfg.Storage.S3.AccessKey,
-			cfg.Storage.S3.SecretKey,
-		)
+		if cfg.Storage.UsesFilesystem() {
+			// Keep files on disk when no S3 bucket is configured
+			fsStorage, err := services.NewFilesystemStorage(cfg)
+			if err != nil {
+				log.Fatalf("Failed to initialize filesystem storage: %v", err)
+			}
+			models.RegisterFileURLGenerator(fsStorage)
+			handlers.RegisterStorageHandler(fsStorage)
+		} else {
+			if cfg.Storage.S3.BucketName == "" {
+				log.Fatalf("S3_BUCKET_NAME is required with STORAGE_PROVIDER=%s", cfg.Storage.Provider)
+			}
+			// Initialize S3 service
+			s3Service, err := services.NewS3Service(
+				cfg.Storage.S3.BucketName,
+				cfg.Storage.S3.Endpoint,
+				cfg.Storage.S3.Region,
+				cfg.Storage.S3.AccessKey,
+				cfg.Storage.S3.SecretKey,
+			)
+
+			if err != nil {
+				log.Fatalf("Failed to initialize S3 service: %v", err)
+			}
 
-		if err != nil {
-			log.Fatalf("Failed to initialize S3 service: %v", err)
+			// Register the URL generator
+			models.RegisterFileURLGenerator(s3Service)
+			handlers.RegisterStorageHandler(s3Service)
 		}
 
-		// Register the URL generator
-		models.RegisterFileURLGenerator(s3Service)
-		handlers.RegisterStorageHandler(s3Service)
-
 		if cfg.Airley.Enabled {
 			// Seed Airley templates
 			if err := airley.LoadAirleyTemplates(db_instance); err != nil {
@@ -1,35 +1,61 @@
 package controllers
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"reflect"
 	"strconv"
 	"strings"
 
+	"kori/internal/models"
 	"kori/internal/services"
 
 	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
 )
 
 // BaseController provides generic CRUD operations for any model
 type BaseController[T any] struct {
-	service services.BaseService[T]
+	service      services.BaseService[T]
+	sortFields   map[string]listField
+	filterFields map[string]listField
+	includes     map[string]bool
 }
 
-// NewBaseController creates a new base controller
-func NewBaseController[T any](service services.BaseService[T]) *BaseController[T] {
+// NewBaseController creates a new base controller. fields whitelists what List can sort and
+// filter by on top of the defaults, and the relationships requests may include.
+func NewBaseController[T any](service services.BaseService[T], fields ...ListFields) *BaseController[T] {
+	sort, filter, include := defaultSortFields, []string{}, []string{}
+	for _, f := range fields {
+		sort = append(sort, f.Sort...)
+		filter = append(filter, f.Filter...)
+		include = append(include, f.Include...)
+	}
+
+	modelType := reflect.TypeOf(*new(T))
 	return &BaseController[T]{
-		service: service,
+		service:      service,
+		sortFields:   resolveListFields(modelType, sort),
+		filterFields: resolveListFields(modelType, filter),
+		includes:     resolveIncludes(modelType, include),
 	}
 }
 
-// parseIncludes parses the include query parameter and returns a slice of relationships to preload
-func parseIncludes(ctx echo.Context) []string {
+// parseIncludes parses the include query parameter into the relationships to preload, only
+// accepting the whitelisted ones
+func (c *BaseController[T]) parseIncludes(ctx echo.Context) ([]string, error) {
 	include := ctx.QueryParam("include")
 	if include == "" {
-		return nil
+		return nil, nil
 	}
-	return strings.Split(include, ",")
+	includes := strings.Split(include, ",")
+	for _, name := range includes {
+		if !c.includes[name] {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, "can't include "+name)
+		}
+	}
+	return includes, nil
 }
 
 // parseExcludes parses the exclude query parameter and returns a slice of fields to exclude
@@ -41,6 +67,32 @@ func parseExcludes(ctx echo.Context) []string {
 	return strings.Split(exclude, ",")
 }
 
+// errorStatus maps service errors to an HTTP status. Errors raised by model hooks can
+// implement StatusCode() to surface as client errors instead of a 500.
+func errorStatus(err error) int {
+	var statusErr interface{ StatusCode() int }
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode()
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+// teamScope limits the service calls of a request to the signed in team. Super admins signed in
+// with their own account can pass allTeams=true to work across teams.
+func teamScope(ctx echo.Context) context.Context {
+	teamID, _ := ctx.Get("teamID").(string)
+	role, _ := ctx.Get("role").(string)
+	isAPIKey, _ := ctx.Get("isAPIKey").(bool)
+
+	return services.WithTeamScope(ctx.Request().Context(), services.TeamScope{
+		TeamID:   teamID,
+		Unscoped: !isAPIKey && role == string(models.UserRoleSuperAdmin) && ctx.QueryParam("allTeams") == "true",
+	})
+}
+
 // Create handles creation of new entities
 func (c *BaseController[T]) Create(ctx echo.Context) error {
 	var entity T
@@ -48,13 +100,19 @@ func (c *BaseController[T]) Create(ctx echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "invalid request body "+err.Error())
 	}
 
+	scoped := teamScope(ctx)
+	services.AssignTeam(scoped, &entity)
+
 	if err := ctx.Validate(&entity); err != nil {
 		return err
 	}
 
-	includes := parseIncludes(ctx)
-	if err := c.service.Create(ctx.Request().Context(), &entity, includes...); err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	includes, err := c.parseIncludes(ctx)
+	if err != nil {
+		return err
+	}
+	if err := c.service.Create(scoped, &entity, includes...); err != nil {
+		return echo.NewHTTPError(errorStatus(err), err.Error())
 	}
 
 	return ctx.JSON(http.StatusCreated, entity)
@@ -66,8 +124,11 @@ func (c *BaseController[T]) Get(ctx echo.Context) error {
 	if id == "" {
 		return echo.NewHTTPError(http.StatusBadRequest, "missing id parameter")
 	}
-	includes := parseIncludes(ctx)
-	entity, err := c.service.Get(ctx.Request().Context(), id, includes...)
+	includes, err := c.parseIncludes(ctx)
+	if err != nil {
+		return err
+	}
+	entity, err := c.service.Get(teamScope(ctx), id, includes...)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusNotFound, "entity not found")
 	}
@@ -76,15 +137,7 @@ func (c *BaseController[T]) Get(ctx echo.Context) error {
 }
 
 func (c *BaseController[T]) applyFilters(ctx echo.Context, filters map[string]interface{}) map[string]interface{} {
-	// add a teamID filter
-	teamID := ctx.Get("teamID")
-	if teamID != nil {
-		var entity T
-		entityType := reflect.TypeOf(entity)
-		if _, found := entityType.FieldByName("TeamID"); found {
-			filters["team_id"] = teamID
-		}
-	}
+	// the service limits rows to the signed in team
 	if userID := ctx.Get("userID"); userID != nil {
 		// Check if entity supports user_id field using reflection
 		var entity T
@@ -97,63 +150,82 @@ func (c *BaseController[T]) applyFilters(ctx echo.Context, filters map[string]in
 	return filters
 }
 
-// List handles retrieval of multiple entities with pagination and filtering
+// List handles retrieval of multiple entities with pagination and filtering. Pages continue
+// with cursor=nextCursor of the previous one; page=n still works for offset pagination.
 func (c *BaseController[T]) List(ctx echo.Context) error {
 	// Parse pagination parameters
 	page, _ := strconv.Atoi(ctx.QueryParam("page"))
 	limit, _ := strconv.Atoi(ctx.QueryParam("limit"))
-	exclude := parseExcludes(ctx)
 	if page < 1 {
 		page = 1
 	}
 	if limit < 1 {
-		limit = 10
+		limit = defaultListLimit
+	}
+	if limit > maxListLimit {
+		limit = maxListLimit
 	}
 
-	// Parse filters from query parameters
-	filters := make(map[string]interface{})
-	for key, values := range ctx.QueryParams() {
-		if key != "page" && key != "limit" && key != "include" && key != "exclude" && key != "sort" && key != "order" && len(values) > 0 {
-			filters[key] = values[0]
+	sort, desc, err := c.parseSort(ctx)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	var after *services.Cursor
+	if raw := ctx.QueryParam("cursor"); raw != "" {
+		if after, err = c.decodeCursor(raw, sort, desc); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 		}
 	}
 
+	filters, err := c.parseFilters(ctx)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
 	filters = c.applyFilters(ctx, filters)
 
-	includes := parseIncludes(ctx)
+	includes, err := c.parseIncludes(ctx)
+	if err != nil {
+		return err
+	}
 
 	excludeFields := make(map[string]bool)
-
-	for _, field := range exclude {
+	for _, field := range parseExcludes(ctx) {
 		excludeFields[field] = true
-
-	}
-	// we also need to sort the fields based on the fields in the entity and the order of the sort query parameter
-	sort := ctx.QueryParam("sort")
-	order := ctx.QueryParam("order")
-	var sortFields []string
-	if sort != "" {
-		sortFields = strings.Split(sort, ",")
-		var entity T
-		entityType := reflect.TypeOf(entity)
-		for _, field := range sortFields {
-			if _, found := entityType.FieldByName(field); found {
-				sortFields = append(sortFields, field)
-			}
-		}
 	}
 
-	entities, total, err := c.service.List(ctx.Request().Context(), page, limit, filters, excludeFields, sortFields, order, includes...)
-
+	// One row more than the page tells whether there is a next one
+	entities, total, err := c.service.List(teamScope(ctx), services.ListQuery{
+		Offset:   (page - 1) * limit,
+		Limit:    limit + 1,
+		Filters:  filters,
+		Excludes: excludeFields,
+		Sort:     c.sortFields[sort].column,
+		Desc:     desc,
+		Nullable: c.sortFields[sort].nullable,
+		After:    after,
+		Includes: includes,
+	})
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 	}
 
+	var nextCursor *string
+	if len(entities) > limit {
+		entities = entities[:limit]
+		cursor, err := c.encodeCursor(&entities[limit-1], sort, desc)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		nextCursor = &cursor
+	}
+
 	return ctx.JSON(http.StatusOK, map[string]interface{}{
-		"data":  entities,
-		"total": total,
-		"page":  page,
-		"limit": limit,
+		"data":       entities,
+		"total":      total,
+		"page":       page,
+		"limit":      limit,
+		"nextCursor": nextCursor,
 	})
 }
 
@@ -169,13 +241,19 @@ func (c *BaseController[T]) Update(ctx echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
 
+	scoped := teamScope(ctx)
+	services.AssignTeam(scoped, &entity)
+
 	if err := ctx.Validate(&entity); err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
 
-	includes := parseIncludes(ctx)
-	if err := c.service.Update(ctx.Request().Context(), id, &entity, includes...); err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	includes, err := c.parseIncludes(ctx)
+	if err != nil {
+		return err
+	}
+	if err := c.service.Update(scoped, id, &entity, includes...); err != nil {
+		return echo.NewHTTPError(errorStatus(err), err.Error())
 	}
 
 	return ctx.JSON(http.StatusOK, entity)
@@ -188,8 +266,8 @@ func (c *BaseController[T]) Delete(ctx echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "missing id parameter")
 	}
 
-	if err := c.service.Delete(ctx.Request().Context(), id); err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	if err := c.service.Delete(teamScope(ctx), id); err != nil {
+		return echo.NewHTTPError(errorStatus(err), err.Error())
 	}
 
 	return ctx.NoContent(http.StatusNoContent)
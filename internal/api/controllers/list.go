@@ -0,0 +1,238 @@
+package controllers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"kori/internal/services"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm/schema"
+)
+
+// Page sizes of List
+const (
+	defaultListLimit = 10
+	maxListLimit     = 100
+)
+
+// ListFields are the fields, by their JSON name, List can sort and filter a model by. Every
+// model can be sorted by id, createdAt and updatedAt. Include lists the relationships, by their
+// Go field name, e.g. HtmlFile, that requests may preload; there are none by default.
+type ListFields struct {
+	Sort    []string
+	Filter  []string
+	Include []string
+}
+
+var defaultSortFields = []string{"id", "createdAt", "updatedAt"}
+
+// listField is a model field List can use
+type listField struct {
+	index    []int
+	column   string
+	typ      reflect.Type
+	nullable bool // a pointer, or a column defaulting to NULL that reads as the zero value
+}
+
+// resolveListFields looks up the whitelisted fields on the model, panicking on names it
+// doesn't have so a typo fails at startup
+func resolveListFields(modelType reflect.Type, names []string) map[string]listField {
+	fields := make(map[string]listField, len(names))
+	for _, name := range names {
+		field, found := fieldByJSONName(modelType, name)
+		if !found {
+			panic(fmt.Sprintf("%s has no field %q to list by", modelType.Name(), name))
+		}
+		settings := schema.ParseTagSetting(field.Tag.Get("gorm"), ";")
+		column := settings["COLUMN"]
+		if column == "" {
+			column = schema.NamingStrategy{}.ColumnName("", field.Name)
+		}
+		fields[name] = listField{
+			index:    field.Index,
+			column:   column,
+			typ:      field.Type,
+			nullable: field.Type.Kind() == reflect.Pointer || strings.EqualFold(settings["DEFAULT"], "NULL"),
+		}
+	}
+	return fields
+}
+
+// resolveIncludes checks the whitelisted relationships are fields of the model, panicking on
+// names it doesn't have
+func resolveIncludes(modelType reflect.Type, names []string) map[string]bool {
+	includes := make(map[string]bool, len(names))
+	for _, name := range names {
+		if _, found := modelType.FieldByName(strings.Split(name, ".")[0]); !found {
+			panic(fmt.Sprintf("%s has no relationship %q to include", modelType.Name(), name))
+		}
+		includes[name] = true
+	}
+	return includes
+}
+
+func fieldByJSONName(modelType reflect.Type, name string) (reflect.StructField, bool) {
+	for _, field := range reflect.VisibleFields(modelType) {
+		if field.Anonymous || !field.IsExported() {
+			continue
+		}
+		if strings.Split(field.Tag.Get("json"), ",")[0] == name {
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// parseSort reads sort=field:dir, falling back to the older sort=field&order=dir
+func (c *BaseController[T]) parseSort(ctx echo.Context) (name string, desc bool, err error) {
+	sort := ctx.QueryParam("sort")
+	if sort == "" {
+		return "createdAt", false, nil
+	}
+	name, dir, found := strings.Cut(sort, ":")
+	if !found {
+		dir = ctx.QueryParam("order")
+	}
+	if _, ok := c.sortFields[name]; !ok {
+		return "", false, fmt.Errorf("can't sort by %s", name)
+	}
+	switch strings.ToLower(dir) {
+	case "", "asc":
+		return name, false, nil
+	case "desc":
+		return name, true, nil
+	}
+	return "", false, fmt.Errorf("sort direction must be asc or desc")
+}
+
+// parseFilters reads filter[field]=value for the whitelisted fields into column -> value. The
+// older field=value still filters when field is whitelisted, by its JSON or column name, and
+// filter[field] isn't given; other parameters are ignored as they always were.
+func (c *BaseController[T]) parseFilters(ctx echo.Context) (map[string]interface{}, error) {
+	filters := make(map[string]interface{})
+	legacy := make(map[string]string)
+	for key, values := range ctx.QueryParams() {
+		if len(values) == 0 {
+			continue
+		}
+		if !strings.HasPrefix(key, "filter[") || !strings.HasSuffix(key, "]") {
+			if field, ok := c.legacyFilterField(key); ok {
+				legacy[field] = values[0]
+			}
+			continue
+		}
+		name := key[len("filter[") : len(key)-1]
+		field, ok := c.filterFields[name]
+		if !ok {
+			return nil, fmt.Errorf("can't filter by %s", name)
+		}
+		value, err := parseListValue(field.typ, values[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for %s: %w", name, err)
+		}
+		filters[field.column] = value
+	}
+	for name, raw := range legacy {
+		field := c.filterFields[name]
+		if _, ok := filters[field.column]; ok {
+			continue
+		}
+		value, err := parseListValue(field.typ, raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for %s: %w", name, err)
+		}
+		filters[field.column] = value
+	}
+	return filters, nil
+}
+
+// legacyFilterField finds the whitelisted filter an older field=value parameter names
+func (c *BaseController[T]) legacyFilterField(key string) (string, bool) {
+	if _, ok := c.filterFields[key]; ok {
+		return key, true
+	}
+	for name, field := range c.filterFields {
+		if field.column == key {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// parseListValue converts a query parameter to the type of the field it filters
+func parseListValue(typ reflect.Type, raw string) (interface{}, error) {
+	if typ == reflect.TypeOf(time.Time{}) {
+		return time.Parse(time.RFC3339, raw)
+	}
+	switch typ.Kind() {
+	case reflect.Bool:
+		return strconv.ParseBool(raw)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.ParseInt(raw, 10, 64)
+	case reflect.Float32, reflect.Float64:
+		return strconv.ParseFloat(raw, 64)
+	case reflect.String:
+		return raw, nil
+	}
+	return nil, fmt.Errorf("unsupported type %s", typ)
+}
+
+// listCursor is the opaque nextCursor of a page. It names its sort so it isn't used with another.
+type listCursor struct {
+	Sort  string          `json:"s"`
+	Desc  bool            `json:"d,omitempty"`
+	Value json.RawMessage `json:"v"`
+	ID    string          `json:"id"`
+}
+
+func (c *BaseController[T]) encodeCursor(entity *T, sort string, desc bool) (string, error) {
+	row := reflect.ValueOf(entity).Elem()
+	value, err := json.Marshal(row.FieldByIndex(c.sortFields[sort].index).Interface())
+	if err != nil {
+		return "", err
+	}
+	cursor, err := json.Marshal(listCursor{
+		Sort:  sort,
+		Desc:  desc,
+		Value: value,
+		ID:    row.FieldByName("ID").String(),
+	})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(cursor), nil
+}
+
+func (c *BaseController[T]) decodeCursor(raw, sort string, desc bool) (*services.Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	cursor := listCursor{}
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.ID == "" {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	if cursor.Sort != sort || cursor.Desc != desc {
+		return nil, fmt.Errorf("cursor is for another sort")
+	}
+
+	field := c.sortFields[sort]
+	value := reflect.New(field.typ)
+	if err := json.Unmarshal(cursor.Value, value.Interface()); err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	// The row had no value: a nil pointer, or the zero value NULL reads as
+	if field.nullable && value.Elem().IsZero() {
+		return &services.Cursor{ID: cursor.ID}, nil
+	}
+	if value.Elem().Kind() == reflect.Pointer {
+		value = value.Elem()
+	}
+	return &services.Cursor{Value: value.Elem().Interface(), ID: cursor.ID}, nil
+}
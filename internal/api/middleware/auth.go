@@ -3,10 +3,12 @@ package middleware
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"kori/internal/db"
 	"kori/internal/models"
+	"kori/internal/utils"
 	"kori/internal/utils/logger"
 	"net/http"
 	"strings"
@@ -20,13 +22,6 @@ var log = logger.New("auth_middleware")
 
 type AuthMiddleware struct {
 	jwtSecret string
-	apiKeys   map[string]APIKeyInfo
-}
-
-type APIKeyInfo struct {
-	TeamID      string
-	Permissions []string
-	ExpiresAt   time.Time
 }
 
 type Claims struct {
@@ -39,14 +34,7 @@ type Claims struct {
 }
 
 func NewAuthMiddleware(jwtSecret string) *AuthMiddleware {
-	return &AuthMiddleware{
-		jwtSecret: jwtSecret,
-		apiKeys:   make(map[string]APIKeyInfo),
-	}
-}
-
-func (m *AuthMiddleware) RegisterAPIKey(key string, info APIKeyInfo) {
-	m.apiKeys[key] = info
+	return &AuthMiddleware{jwtSecret: jwtSecret}
 }
 
 func (m *AuthMiddleware) Middleware() echo.MiddlewareFunc {
@@ -58,6 +46,16 @@ func (m *AuthMiddleware) Middleware() echo.MiddlewareFunc {
 				return m.validateAPIKey(c, apiKey, next)
 			}
 
+			// Embedded widgets send their token as a header, or in the query where they can't
+			// set headers (event streams)
+			embedToken := c.Request().Header.Get("X-Embed-Token")
+			if embedToken == "" {
+				embedToken = c.QueryParam("embed_token")
+			}
+			if embedToken != "" {
+				return m.validateEmbedToken(c, embedToken, next)
+			}
+
 			// Check JWT Token
 			authHeader := c.Request().Header.Get("Authorization")
 			if authHeader == "" {
@@ -80,76 +78,143 @@ func (m *AuthMiddleware) Middleware() echo.MiddlewareFunc {
 
 func (m *AuthMiddleware) validateAPIKey(c echo.Context, key string, next echo.HandlerFunc) error {
 
-	apiKey := &models.APIKey{}
-	if err := db.DB.Where("key = ?", key).Preload("Permissions").First(apiKey).Error; err != nil {
+	apiKey, err := models.GetActiveAPIKey(key, db.DB)
+	if err != nil {
 		return echo.NewHTTPError(http.StatusUnauthorized, "Invalid API key")
 	}
 
-	// Check expiration
-	if !apiKey.ExpiresAt.IsZero() && time.Now().After(apiKey.ExpiresAt) {
-		return echo.NewHTTPError(http.StatusUnauthorized, "API key has expired")
+	// Every request made with the key is recorded with its outcome, refused ones included
+	started := time.Now()
+	err = m.authorizeAPIKey(c, apiKey, next)
+	recordAPIKeyUsage(c, apiKey.ID, started, err)
+	return err
+}
+
+// validateEmbedToken lets an embed token make the read requests its scopes cover, and when it's
+// for a campaign, only requests about that campaign
+func (m *AuthMiddleware) validateEmbedToken(c echo.Context, tokenString string, next echo.HandlerFunc) error {
+	claims, err := utils.ParseEmbedToken(tokenString)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, "Invalid embed token")
+	}
+
+	embed, err := models.GetActiveEmbedToken(claims.ID, db.DB)
+	if err != nil || embed.TeamID != claims.TeamID {
+		return echo.NewHTTPError(http.StatusUnauthorized, "Embed token has expired or was revoked")
+	}
+
+	if c.Request().Method != http.MethodGet {
+		return echo.NewHTTPError(http.StatusForbidden, "Embed tokens can only read")
+	}
+	reachable := false
+	for _, scope := range embed.Scopes {
+		if models.EmbedTokenScopes[scope][c.Path()] {
+			reachable = true
+			break
+		}
+	}
+	if !reachable {
+		return echo.NewHTTPError(http.StatusForbidden, "Insufficient permissions")
 	}
 
-	// check apikey permissions
-	if err := m.validateAPIKeyPermissions(c, apiKey); err != nil {
-		return err
+	// A campaign embed must name its campaign, and nothing that could reach past it
+	if embed.CampaignID != "" {
+		if !models.EmbedCampaignRoutes[c.Path()] {
+			return echo.NewHTTPError(http.StatusForbidden, "Embed token is restricted to campaign "+embed.CampaignID)
+		}
+		query := c.QueryParams()
+		if query.Get("campaignId") != embed.CampaignID || query.Has("campaignIds") || query.Has("emailId") {
+			return echo.NewHTTPError(http.StatusForbidden, "Embed token is restricted to campaign "+embed.CampaignID)
+		}
+	}
+
+	if models.IsTeamDeleted(embed.TeamID, db.DB) {
+		return echo.NewHTTPError(http.StatusForbidden, "Workspace is scheduled for deletion")
 	}
 
 	// Set context values
-	c.Set("teamID", apiKey.TeamID)
-	c.Set("isAPIKey", true)
-	c.Set("permissions", apiKey.Permissions)
+	c.Set("teamID", embed.TeamID)
+	c.Set("isAPIKey", false)
+	c.Set("isEmbed", true)
+	c.Set("embedTokenID", embed.ID)
+	c.Set("role", "embed")
+	c.Set("scopes", []string(embed.Scopes))
 
 	return next(c)
 }
 
-func (m *AuthMiddleware) validateAPIKeyPermissions(c echo.Context, apiKey *models.APIKey) error {
-	method := c.Request().Method
-	requiredScope := GetRequiredPermissionForMethod(method)
-	if requiredScope == "" {
-		return echo.NewHTTPError(http.StatusForbidden, "Invalid request method")
+// recordAPIKeyUsage records a request made with an API key once it's been handled
+func recordAPIKeyUsage(c echo.Context, apiKeyID string, started time.Time, err error) {
+	status := c.Response().Status
+	message := ""
+	if err != nil {
+		status = http.StatusInternalServerError
+		message = err.Error()
+		var httpErr *echo.HTTPError
+		if errors.As(err, &httpErr) {
+			status = httpErr.Code
+			message = fmt.Sprint(httpErr.Message)
+		}
+	}
+
+	usage := &models.APIKeyUsage{
+		APIKeyID:   apiKeyID,
+		Endpoint:   c.Request().URL.Path,
+		Route:      c.Path(),
+		Method:     c.Request().Method,
+		Timestamp:  started,
+		StatusCode: status,
+		Success:    status < http.StatusBadRequest,
+		Error:      message,
+		IPAddress:  c.RealIP(),
+		UserAgent:  c.Request().UserAgent(),
+	}
+	if err := db.DB.Create(usage).Error; err != nil {
+		log.Error("Failed to record api key usage", err)
+	}
+}
+
+// authorizeAPIKey checks an API key can make the request before handling it
+func (m *AuthMiddleware) authorizeAPIKey(c echo.Context, apiKey *models.APIKey, next echo.HandlerFunc) error {
+	if apiKey.RevokedAt != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, "API key has been revoked")
 	}
 
-	// Get the request path to determine the resource
-	path := c.Request().URL.Path
-	resource := m.getResourceFromPath(path)
-	requiredPermission := fmt.Sprintf("%s:%s", resource, requiredScope)
+	// Check expiration
+	if !apiKey.ExpiresAt.IsZero() && time.Now().After(apiKey.ExpiresAt) {
+		return echo.NewHTTPError(http.StatusUnauthorized, "API key has expired")
+	}
+
+	// Keys of a workspace scheduled for deletion stop working straight away
+	if models.IsTeamDeleted(apiKey.TeamID, db.DB) {
+		return echo.NewHTTPError(http.StatusForbidden, "Workspace is scheduled for deletion")
+	}
 
-	// Check permissions using the common validation function
-	if err := ValidateAPIKeyPermissions(c.Request().Context(), db.DB, apiKey.ID, []string{requiredPermission}); err != nil {
+	// Keys only make requests their permissions could allow; routes check the exact permission
+	scopes := apiKey.Scopes()
+	requiredScope := GetRequiredPermissionForMethod(c.Request().Method)
+	if requiredScope == "" {
+		return echo.NewHTTPError(http.StatusForbidden, "Invalid request method")
+	}
+	if !allowsMethod(scopes, requiredScope) {
 		return echo.NewHTTPError(http.StatusForbidden, "Insufficient permissions")
 	}
+	// Routes that don't declare a permission can't be checked against the key's, so keys are
+	// kept off them
+	if !isGuardedRoute(c) {
+		return echo.NewHTTPError(http.StatusForbidden, "API keys can't use this route")
+	}
 
 	// track api key usage
-	db.DB.Model(&models.APIKey{}).Where("id = ?", apiKey.ID).Update("last_used_at", time.Now())
-	db.DB.Model(&models.APIKeyUsage{}).Create(&models.APIKeyUsage{
-		APIKeyID:  apiKey.ID,
-		APIKey:    apiKey,
-		Endpoint:  path,
-		Method:    method,
-		Timestamp: time.Now(),
-		Success:   true,
-	})
+	db.DB.Model(&models.APIKey{}).Where("id = ?", apiKey.ID).UpdateColumn("last_used_at", time.Now())
 
 	// Set context values
 	c.Set("apiKeyID", apiKey.ID)
 	c.Set("teamID", apiKey.TeamID)
 	c.Set("isAPIKey", true)
-	c.Set("permissions", []string{requiredPermission})
-
-	return nil
-}
-
-func (m *AuthMiddleware) getResourceFromPath(path string) string {
-	// Remove API version prefix if exists
-	path = strings.TrimPrefix(path, "/api/v1")
+	c.Set("scopes", scopes)
 
-	// Split path and get the first segment
-	parts := strings.Split(strings.Trim(path, "/"), "/")
-	if len(parts) > 0 {
-		return parts[0]
-	}
-	return "unknown"
+	return next(c)
 }
 
 func (m *AuthMiddleware) validateJWT(c echo.Context, tokenString string, next echo.HandlerFunc) error {
@@ -195,6 +260,12 @@ func (m *AuthMiddleware) validateJWT(c echo.Context, tokenString string, next ec
 		return echo.NewHTTPError(http.StatusUnauthorized, "Team not found")
 	}
 
+	// A workspace scheduled for deletion can only be looked at or restored until it's purged.
+	// The route pattern is matched, so other paths merely containing it stay closed.
+	if team.IsDeleted && !strings.HasPrefix(c.Path(), "/api/v1/teams/:id/workspace") {
+		return echo.NewHTTPError(http.StatusForbidden, "Workspace is scheduled for deletion")
+	}
+
 	requestContentType := strings.Split(c.Request().Header.Get("Content-Type"), ";")[0]
 
 	log.Info("Request content type: %s", requestContentType)
@@ -229,30 +300,24 @@ func (m *AuthMiddleware) validateJWT(c echo.Context, tokenString string, next ec
 		return echo.NewHTTPError(http.StatusForbidden, "Invalid request method")
 	}
 
-	// Admin role has all permissions
+	// Admin role has all permissions; everyone else has those of their custom role or, without
+	// one, of their built-in role, resolved on every request so changes to roles apply at once
+	permissions, err := models.GetUserPermissions(user, db.DB)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get permissions")
+	}
 	if user.Role == models.UserRoleAdmin || user.Role == models.UserRoleSuperAdmin {
 		c.Set("hasAdminAccess", true)
-	} else {
-		// Check if user has the required scope
-		hasPermission := false
-		for _, scope := range claims.Scopes {
-			if ValidateMethodPermission(method, scope) {
-				hasPermission = true
-				break
-			}
-		}
-
-		if !hasPermission {
-			return echo.NewHTTPError(http.StatusForbidden, "Insufficient permissions")
-		}
+	} else if !allowsMethod(permissions, requiredScope) {
+		return echo.NewHTTPError(http.StatusForbidden, "Insufficient permissions")
 	}
 
 	// Set context values
 	c.Set("userID", claims.UserID)
 	c.Set("teamID", claims.TeamID)
 	c.Set("email", claims.Email)
-	c.Set("role", claims.Role)
-	c.Set("scopes", claims.Scopes)
+	c.Set("role", string(user.Role))
+	c.Set("scopes", permissions)
 	c.Set("isAPIKey", false)
 
 	return next(c)
@@ -294,29 +359,11 @@ func IsAPIKey(c echo.Context) bool {
 	return false
 }
 
-func HasPermission(c echo.Context, requiredScope string) bool {
-	if IsAPIKey(c) {
-		if permissions, ok := c.Get("permissions").([]string); ok {
-			for _, p := range permissions {
-				if p == "ADMIN" || p == requiredScope {
-					return true
-				}
-			}
-		}
-		return false
-	}
-
-	// For JWT tokens, check role and scopes
-	role := GetUserRole(c)
-	if role == "admin" {
+// HasPermission reports whether the caller has a permission, e.g. campaigns:read
+func HasPermission(c echo.Context, required string) bool {
+	if hasAdmin, _ := c.Get("hasAdminAccess").(bool); hasAdmin {
 		return true
 	}
-
-	scopes := GetScopes(c)
-	for _, scope := range scopes {
-		if scope == requiredScope {
-			return true
-		}
-	}
-	return false
+	resource, action, ok := strings.Cut(required, ":")
+	return ok && models.HasPermission(GetScopes(c), resource, action)
 }
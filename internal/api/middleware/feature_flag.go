@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"kori/internal/models"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// RequireFeatureFlag limits a route to the teams the feature flag is on for. Others get a 404,
+// as the feature doesn't exist for them yet.
+func RequireFeatureFlag(db *gorm.DB, key string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			teamID, _ := c.Get("teamID").(string)
+			enabled, err := models.IsFeatureEnabled(key, teamID, db)
+			if err != nil {
+				log.Error("Failed to evaluate feature flag %s: %v", err, key)
+				return echo.NewHTTPError(http.StatusInternalServerError, "failed to evaluate feature flag")
+			}
+			if !enabled {
+				return echo.NewHTTPError(http.StatusNotFound, "Not Found")
+			}
+			return next(c)
+		}
+	}
+}
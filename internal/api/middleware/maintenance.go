@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"kori/internal/utils"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/redis/go-redis/v9"
+)
+
+// maintenanceWritePaths keep accepting writes in maintenance mode: recipients unsubscribing and
+// the events providers report can't wait, and operators need to sign in to end it
+var maintenanceWritePaths = []string{
+	"/t/",
+	"/unsubscribe",
+	"/sequence-opt-out",
+	"/preferences",
+	"/webhooks/providers/",
+	"/tlsrpt",
+	"/api/v1/auth/login",
+	"/api/v1/auth/refresh",
+	"/api/v1/admin/maintenance",
+}
+
+// Maintenance makes the API read-only while maintenance mode is on. Writes get a 503 with a
+// Retry-After, reads and tracking keep working. Should the mode be unreadable, requests go through.
+func Maintenance(redisClient *redis.Client) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			switch c.Request().Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+				return next(c)
+			}
+			path := c.Request().URL.Path
+			for _, prefix := range maintenanceWritePaths {
+				if strings.HasPrefix(path, prefix) {
+					return next(c)
+				}
+			}
+
+			mode, err := utils.GetMaintenanceMode(c.Request().Context(), redisClient)
+			if err != nil {
+				log.Warn("Failed to get maintenance mode: %v", err)
+			}
+			if !mode.Enabled {
+				return next(c)
+			}
+
+			retryAfter := mode.RetryAfterDuration()
+			c.Response().Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())))
+			message := mode.Message
+			if message == "" {
+				message = "Posthoot is undergoing maintenance and is read-only. Try again later."
+			}
+			return echo.NewHTTPError(http.StatusServiceUnavailable, message)
+		}
+	}
+}
@@ -1,11 +1,13 @@
 package middleware
 
 import (
-	"context"
 	"fmt"
 	"kori/internal/models"
 	"net/http"
+	"reflect"
+	"slices"
 	"strings"
+	"sync"
 
 	"github.com/labstack/echo/v4"
 	"gorm.io/gorm"
@@ -13,93 +15,80 @@ import (
 
 // Permission scopes
 const (
-	ScopeAdmin = "admin"
 	ScopeRead  = "read"
 	ScopeWrite = "create"
 )
 
-// ValidateAPIKeyPermissions validates if an API key has the required permissions
-func ValidateAPIKeyPermissions(ctx context.Context, db *gorm.DB, apiKeyID string, requiredPermissions []string) error {
-	var permissions []models.APIKeyPermission
-
-	log.Info("Validating API key permissions for %s", apiKeyID)
-	log.Info("Required permissions %v", requiredPermissions)
+// GetRequiredPermissionForMethod returns the required permission scope for a given HTTP method
+func GetRequiredPermissionForMethod(method string) string {
+	switch method {
+	case http.MethodGet:
+		return ScopeRead
+	case http.MethodPost, http.MethodPut, http.MethodDelete, http.MethodPatch:
+		return ScopeWrite
+	default:
+		return ""
+	}
+}
 
-	// Get API key permissions with resource permission details
-	err := db.Where("key_id = ?", apiKeyID).
-		Preload("ResourcePermission.Resource").
-		Find(&permissions).Error
-	if err != nil {
-		return fmt.Errorf("failed to get permissions: %w", err)
+// methodAction returns the permission action an HTTP method performs
+func methodAction(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead:
+		return models.PermissionActionRead
+	case http.MethodPost:
+		return models.PermissionActionCreate
+	case http.MethodPut, http.MethodPatch:
+		return models.PermissionActionUpdate
+	case http.MethodDelete:
+		return models.PermissionActionDelete
+	default:
+		return models.PermissionActionWrite
 	}
+}
 
-	// Check each required permission
-	for _, required := range requiredPermissions {
-		hasPermission := false
-		requiredParts := strings.Split(required, ":")
-		if len(requiredParts) != 2 {
-			continue // Invalid permission format
+// allowsMethod reports whether a user's permissions allow any request of a scope: reading needs
+// some permission, writing some permission other than read. Routes check the exact permission.
+func allowsMethod(permissions []string, scope string) bool {
+	for _, permission := range permissions {
+		_, action, _ := strings.Cut(permission, ":")
+		if scope == ScopeRead || action != models.PermissionActionRead {
+			return true
 		}
+	}
+	return false
+}
 
-		requiredResource := requiredParts[0]
-		requiredScope := requiredParts[1]
-
-		for _, perm := range permissions {
-			if perm.ResourcePermission == nil || perm.ResourcePermission.Resource == nil {
-				continue
-			}
-
-			resource := perm.ResourcePermission.Resource
-
-			// Check if the permission matches
-			if resource.Name == requiredResource {
-				switch resource.Action {
-				case ScopeAdmin:
-					hasPermission = true
-				case ScopeWrite:
-					hasPermission = requiredScope == ScopeWrite || requiredScope == ScopeRead
-				case ScopeRead:
-					hasPermission = requiredScope == ScopeRead
-				}
-				if hasPermission {
-					break
-				}
-			}
-		}
+var (
+	// guardedRoutes are the routes, by method and path pattern, whose middleware checks the
+	// caller's permissions
+	guardedRoutes sync.Map
+	// guards are the code of the middlewares checking permissions. Every middleware a guard
+	// returns shares its code, so one instance of each tells them apart from other middleware.
+	guards = map[uintptr]bool{}
+)
 
-		if !hasPermission {
-			return echo.NewHTTPError(http.StatusForbidden, fmt.Sprintf("missing required permission: %s", required))
-		}
+func init() {
+	for _, guard := range []echo.MiddlewareFunc{RequirePermissions(nil), RequireSuperAdmin(), RequireTeamAdmin()} {
+		guards[reflect.ValueOf(guard).Pointer()] = true
 	}
-
-	return nil
 }
 
-// ValidateMethodPermission validates if a given scope allows a specific HTTP method
-func ValidateMethodPermission(method string, scope string) bool {
-	switch scope {
-	case ScopeAdmin:
-		return true
-	case ScopeWrite:
-		return method == http.MethodPost || method == http.MethodPut ||
-			method == http.MethodDelete || method == http.MethodPatch
-	case ScopeRead:
-		return method == http.MethodGet
-	default:
-		return false
+// TrackGuardedRoutes records the routes that check permissions as they're added, so API keys can
+// be kept off the rest. It's the server's OnAddRouteHandler.
+func TrackGuardedRoutes(host string, route echo.Route, handler echo.HandlerFunc, middleware []echo.MiddlewareFunc) {
+	for _, m := range middleware {
+		if guards[reflect.ValueOf(m).Pointer()] {
+			guardedRoutes.Store(route.Method+" "+route.Path, true)
+			return
+		}
 	}
 }
 
-// GetRequiredPermissionForMethod returns the required permission scope for a given HTTP method
-func GetRequiredPermissionForMethod(method string) string {
-	switch method {
-	case http.MethodGet:
-		return ScopeRead
-	case http.MethodPost, http.MethodPut, http.MethodDelete, http.MethodPatch:
-		return ScopeWrite
-	default:
-		return ""
-	}
+// isGuardedRoute reports whether the route of a request checks permissions
+func isGuardedRoute(c echo.Context) bool {
+	_, guarded := guardedRoutes.Load(c.Request().Method + " " + c.Path())
+	return guarded
 }
 
 // RequirePermissions middleware checks if the user/API key has the required permissions
@@ -111,38 +100,67 @@ func RequirePermissions(db *gorm.DB, requiredPermissions ...string) echo.Middlew
 				return next(c)
 			}
 
-			isAPIKey := c.Get("isAPIKey").(bool)
-			method := c.Request().Method
-
-			if isAPIKey {
-				apiKeyID := c.Get("apiKeyID").(string)
-				if err := ValidateAPIKeyPermissions(c.Request().Context(), db, apiKeyID, requiredPermissions); err != nil {
-					return err
-				}
-			} else {
-				// For JWT auth, check role-based permissions
-				role := c.Get("role").(string)
+			// Embed tokens hold exactly the permissions they were minted with
+			if isEmbed, _ := c.Get("isEmbed").(bool); isEmbed {
 				scopes := c.Get("scopes").([]string)
-
-				// Admin role has all permissions
-				if role == "admin" {
-					return next(c)
-				}
-
-				// Check if user has any of the required permissions
-				hasPermission := false
-				for _, scope := range scopes {
-					if ValidateMethodPermission(method, scope) {
-						hasPermission = true
-						break
+				for _, required := range requiredPermissions {
+					if !slices.Contains(scopes, required) {
+						return echo.NewHTTPError(http.StatusForbidden, "insufficient permissions")
 					}
 				}
+				return next(c)
+			}
 
-				if !hasPermission {
-					return echo.NewHTTPError(http.StatusForbidden, "insufficient permissions")
+			// Members and API keys have the permissions resolved by the auth middleware: those
+			// of the member's role, or those the key was granted
+			scopes, _ := c.Get("scopes").([]string)
+			method := c.Request().Method
+			for _, required := range requiredPermissions {
+				resource, action, ok := strings.Cut(required, ":")
+				if !ok {
+					continue // Invalid permission format
+				}
+				// Write routes take the action of their method, so roles and keys can grant e.g.
+				// campaigns:create without campaigns:delete
+				if action == models.PermissionActionWrite {
+					action = methodAction(method)
 				}
+				if !models.HasPermission(scopes, resource, action) {
+					return echo.NewHTTPError(http.StatusForbidden, fmt.Sprintf("missing required permission: %s", required))
+				}
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// RequireSuperAdmin restricts a route to platform super admins signed in with a JWT; API keys
+// and team admins are refused
+func RequireSuperAdmin() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if isAPIKey, _ := c.Get("isAPIKey").(bool); isAPIKey {
+				return echo.NewHTTPError(http.StatusForbidden, "insufficient permissions")
+			}
+			if role, _ := c.Get("role").(string); role != string(models.UserRoleSuperAdmin) {
+				return echo.NewHTTPError(http.StatusForbidden, "insufficient permissions")
 			}
+			return next(c)
+		}
+	}
+}
 
+// RequireTeamAdmin limits a route to admins of the team signed in with their own account
+func RequireTeamAdmin() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if isAPIKey, _ := c.Get("isAPIKey").(bool); isAPIKey {
+				return echo.NewHTTPError(http.StatusForbidden, "insufficient permissions")
+			}
+			if hasAdmin, _ := c.Get("hasAdminAccess").(bool); !hasAdmin {
+				return echo.NewHTTPError(http.StatusForbidden, "insufficient permissions")
+			}
 			return next(c)
 		}
 	}
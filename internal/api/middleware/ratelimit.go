@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -106,6 +107,13 @@ var defaultEndpointLimits = map[string]EndpointLimit{
 		Window: time.Minute,
 	},
 
+	// Public subscribe forms - strict limits against signup spam
+	"POST:/api/v1/forms/:id/submit": {
+		Limit:  10.0 / 60.0, // 10 requests per minute
+		Burst:  5,
+		Window: time.Minute,
+	},
+
 	// Tracking endpoints - high limits (used by email clients)
 	"GET:/api/v1/t/open": {
 		Limit:  1000.0 / 60.0, // 1000 requests per minute
@@ -220,6 +228,9 @@ func getEndpointKey(c echo.Context) string {
 	return fmt.Sprintf("%s:%s", method, path)
 }
 
+// formSubmitPath matches the submit endpoint of any subscribe form
+var formSubmitPath = regexp.MustCompile(`^/api/v1/forms/[^/]+/submit$`)
+
 // normalizePath removes dynamic parts from the path for better grouping
 func normalizePath(path string) string {
 	// Replace UUIDs with placeholder
@@ -230,6 +241,9 @@ func normalizePath(path string) string {
 	path = strings.ReplaceAll(path, "/api/v1/analytics/email", "/api/v1/analytics/email")
 	path = strings.ReplaceAll(path, "/auth/users/", "/auth/users/")
 
+	// Submissions of every form share one limit per client
+	path = formSubmitPath.ReplaceAllString(path, "/api/v1/forms/:id/submit")
+
 	return path
 }
 
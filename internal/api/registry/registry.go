@@ -19,7 +19,9 @@ import (
 func RegisterCRUDRoutes(g *echo.Group, db *gorm.DB) {
 	// Teams
 	teamService := services.NewBaseService(db, models.Team{})
-	teamController := controllers.NewBaseController(teamService)
+	teamController := controllers.NewBaseController(teamService, controllers.ListFields{
+		Sort: []string{"name"},
+	})
 	teamGroup := g.Group("/teams")
 	teamGroup.Use(middleware.RequirePermissions(db, "teams:read"))
 
@@ -27,6 +29,10 @@ func RegisterCRUDRoutes(g *echo.Group, db *gorm.DB) {
 	// @Description Get a list of all teams
 	// @Accept json
 	// @Produce json
+	// @Param limit query int false "Page size, at most 100"
+	// @Param cursor query string false "nextCursor of the previous page"
+	// @Param sort query string false "Field and direction, e.g. createdAt:desc"
+	// @Param filter[field] query string false "Only rows where the whitelisted field equals the value"
 	// @Success 200 {array} models.Team
 	// @Failure 401 {object} map[string]string "Unauthorized"
 	// @Failure 403 {object} map[string]string "Forbidden"
@@ -90,13 +96,20 @@ func RegisterCRUDRoutes(g *echo.Group, db *gorm.DB) {
 
 	// Team Invitations with team-specific permissions
 	invitationService := services.NewBaseService(db, models.TeamInvite{})
-	invitationController := controllers.NewBaseController(invitationService)
+	invitationController := controllers.NewBaseController(invitationService, controllers.ListFields{
+		Sort:   []string{"email", "expiresAt"},
+		Filter: []string{"email", "role", "status"},
+	})
 	invitationGroup := g.Group("/team-invitations")
 	invitationGroup.Use(middleware.RequirePermissions(db, "team_invites:read"))
 	// @Summary List team invitations
 	// @Description Get a list of all team invitations
 	// @Accept json
 	// @Produce json
+	// @Param limit query int false "Page size, at most 100"
+	// @Param cursor query string false "nextCursor of the previous page"
+	// @Param sort query string false "Field and direction, e.g. createdAt:desc"
+	// @Param filter[field] query string false "Only rows where the whitelisted field equals the value"
 	// @Success 200 {array} models.TeamInvite
 	// @Failure 401 {object} map[string]string "Unauthorized"
 	// @Failure 403 {object} map[string]string "Forbidden"
@@ -122,13 +135,20 @@ func RegisterCRUDRoutes(g *echo.Group, db *gorm.DB) {
 
 	// file routes
 	fileService := services.NewBaseService(db, models.File{})
-	fileController := controllers.NewBaseController(fileService)
+	fileController := controllers.NewBaseController(fileService, controllers.ListFields{
+		Sort:   []string{"name", "size"},
+		Filter: []string{"name", "type"},
+	})
 	fileGroup := g.Group("/files")
 	fileGroup.Use(middleware.RequirePermissions(db, "files:read"))
 	// @Summary List files
 	// @Description Get a list of all files
 	// @Accept json
 	// @Produce json
+	// @Param limit query int false "Page size, at most 100"
+	// @Param cursor query string false "nextCursor of the previous page"
+	// @Param sort query string false "Field and direction, e.g. createdAt:desc"
+	// @Param filter[field] query string false "Only rows where the whitelisted field equals the value"
 	// @Success 200 {array} models.File
 	// @Failure 401 {object} map[string]string "Unauthorized"
 	// @Failure 403 {object} map[string]string "Forbidden"
@@ -150,13 +170,21 @@ func RegisterCRUDRoutes(g *echo.Group, db *gorm.DB) {
 
 	// Contacts with team-specific permissions
 	contactService := services.NewBaseService(db, models.Contact{})
-	contactController := controllers.NewBaseController(contactService)
+	contactController := controllers.NewBaseController(contactService, controllers.ListFields{
+		Sort:    []string{"email", "firstName", "lastName", "company"},
+		Filter:  []string{"email", "listId", "status", "country", "city", "company", "locale", "timezone", "importId", "isSample"},
+		Include: []string{"List", "Tags"},
+	})
 	contactGroup := g.Group("/contacts")
 	contactGroup.Use(middleware.RequirePermissions(db, "contacts:read"))
 	// @Summary List contacts
 	// @Description Get a list of all contacts
 	// @Accept json
 	// @Produce json
+	// @Param limit query int false "Page size, at most 100"
+	// @Param cursor query string false "nextCursor of the previous page"
+	// @Param sort query string false "Field and direction, e.g. createdAt:desc"
+	// @Param filter[field] query string false "Only rows where the whitelisted field equals the value"
 	// @Success 200 {array} models.Contact
 	// @Failure 401 {object} map[string]string "Unauthorized"
 	// @Failure 403 {object} map[string]string "Forbidden"
@@ -220,13 +248,21 @@ func RegisterCRUDRoutes(g *echo.Group, db *gorm.DB) {
 
 	// Email Categories with team-specific permissions
 	categoryService := services.NewBaseService(db, models.EmailCategory{})
-	categoryController := controllers.NewBaseController(categoryService)
+	categoryController := controllers.NewBaseController(categoryService, controllers.ListFields{
+		Sort:    []string{"name"},
+		Filter:  []string{"name"},
+		Include: []string{"Templates"},
+	})
 	categoryGroup := g.Group("/categories")
 	categoryGroup.Use(middleware.RequirePermissions(db, "categories:read"))
 	// @Summary List categories
 	// @Description Get a list of all email categories
 	// @Accept json
 	// @Produce json
+	// @Param limit query int false "Page size, at most 100"
+	// @Param cursor query string false "nextCursor of the previous page"
+	// @Param sort query string false "Field and direction, e.g. createdAt:desc"
+	// @Param filter[field] query string false "Only rows where the whitelisted field equals the value"
 	// @Success 200 {array} models.EmailCategory
 	// @Failure 401 {object} map[string]string "Unauthorized"
 	// @Failure 403 {object} map[string]string "Forbidden"
@@ -290,13 +326,21 @@ func RegisterCRUDRoutes(g *echo.Group, db *gorm.DB) {
 
 	// Mailing Lists with team-specific permissions
 	mailingListService := services.NewBaseService(db, models.MailingList{})
-	mailingListController := controllers.NewBaseController(mailingListService)
+	mailingListController := controllers.NewBaseController(mailingListService, controllers.ListFields{
+		Sort:    []string{"name"},
+		Filter:  []string{"name", "isSample"},
+		Include: []string{"ConfirmationTemplate"},
+	})
 	listGroup := g.Group("/mailing-lists")
 	listGroup.Use(middleware.RequirePermissions(db, "lists:read"))
 	// @Summary List mailing lists
 	// @Description Get a list of all mailing lists
 	// @Accept json
 	// @Produce json
+	// @Param limit query int false "Page size, at most 100"
+	// @Param cursor query string false "nextCursor of the previous page"
+	// @Param sort query string false "Field and direction, e.g. createdAt:desc"
+	// @Param filter[field] query string false "Only rows where the whitelisted field equals the value"
 	// @Success 200 {array} models.MailingList
 	// @Failure 401 {object} map[string]string "Unauthorized"
 	// @Failure 403 {object} map[string]string "Forbidden"
@@ -360,13 +404,20 @@ func RegisterCRUDRoutes(g *echo.Group, db *gorm.DB) {
 
 	// SMTP Configs with team-specific permissions
 	smtpConfigService := services.NewBaseService(db, models.SMTPConfig{})
-	smtpConfigController := controllers.NewBaseController(smtpConfigService)
+	smtpConfigController := controllers.NewBaseController(smtpConfigService, controllers.ListFields{
+		Sort:   []string{"provider", "maxSendRate"},
+		Filter: []string{"provider", "isDefault", "isActive", "isHealthy"},
+	})
 	smtpGroup := g.Group("/smtp-configs")
 	smtpGroup.Use(middleware.RequirePermissions(db, "smtp_configs:read"))
 	// @Summary List SMTP configs
 	// @Description Get a list of all SMTP configurations
 	// @Accept json
 	// @Produce json
+	// @Param limit query int false "Page size, at most 100"
+	// @Param cursor query string false "nextCursor of the previous page"
+	// @Param sort query string false "Field and direction, e.g. createdAt:desc"
+	// @Param filter[field] query string false "Only rows where the whitelisted field equals the value"
 	// @Success 200 {array} models.SMTPConfig
 	// @Failure 401 {object} map[string]string "Unauthorized"
 	// @Failure 403 {object} map[string]string "Forbidden"
@@ -430,13 +481,20 @@ func RegisterCRUDRoutes(g *echo.Group, db *gorm.DB) {
 
 	// IMAP with team-specific permissions
 	imapService := services.NewBaseService(db, models.IMAPConfig{})
-	imapController := controllers.NewBaseController(imapService)
+	imapController := controllers.NewBaseController(imapService, controllers.ListFields{
+		Sort:   []string{"host"},
+		Filter: []string{"host", "isActive", "bounceProcessing"},
+	})
 	imapGroup := g.Group("/imap")
 	imapGroup.Use(middleware.RequirePermissions(db, "imap_configs:read"))
 	// @Summary List IMAP configs
 	// @Description Get a list of all IMAP configurations
 	// @Accept json
 	// @Produce json
+	// @Param limit query int false "Page size, at most 100"
+	// @Param cursor query string false "nextCursor of the previous page"
+	// @Param sort query string false "Field and direction, e.g. createdAt:desc"
+	// @Param filter[field] query string false "Only rows where the whitelisted field equals the value"
 	// @Success 200 {array} models.IMAPConfig
 	// @Failure 401 {object} map[string]string "Unauthorized"
 	// @Failure 403 {object} map[string]string "Forbidden"
@@ -500,13 +558,20 @@ func RegisterCRUDRoutes(g *echo.Group, db *gorm.DB) {
 
 	// Domains with team-specific permissions
 	domainService := services.NewBaseService(db, models.Domain{})
-	domainController := controllers.NewBaseController(domainService)
+	domainController := controllers.NewBaseController(domainService, controllers.ListFields{
+		Sort:   []string{"domain", "lastCheckedAt"},
+		Filter: []string{"domain", "isVerified"},
+	})
 	domainGroup := g.Group("/domains")
 	domainGroup.Use(middleware.RequirePermissions(db, "domains:read"))
 	// @Summary List domains
 	// @Description Get a list of all domains
 	// @Accept json
 	// @Produce json
+	// @Param limit query int false "Page size, at most 100"
+	// @Param cursor query string false "nextCursor of the previous page"
+	// @Param sort query string false "Field and direction, e.g. createdAt:desc"
+	// @Param filter[field] query string false "Only rows where the whitelisted field equals the value"
 	// @Success 200 {array} models.Domain
 	// @Failure 401 {object} map[string]string "Unauthorized"
 	// @Failure 403 {object} map[string]string "Forbidden"
@@ -570,13 +635,21 @@ func RegisterCRUDRoutes(g *echo.Group, db *gorm.DB) {
 
 	// Webhooks with team-specific permissions
 	webhookService := services.NewBaseService(db, models.Webhook{})
-	webhookController := controllers.NewBaseController(webhookService)
+	webhookController := controllers.NewBaseController(webhookService, controllers.ListFields{
+		Sort:    []string{"name"},
+		Filter:  []string{"name", "isActive"},
+		Include: []string{"Deliveries"},
+	})
 	webhookGroup := g.Group("/webhooks")
 	webhookGroup.Use(middleware.RequirePermissions(db, "webhooks:read"))
 	// @Summary List webhooks
 	// @Description Get a list of all webhooks
 	// @Accept json
 	// @Produce json
+	// @Param limit query int false "Page size, at most 100"
+	// @Param cursor query string false "nextCursor of the previous page"
+	// @Param sort query string false "Field and direction, e.g. createdAt:desc"
+	// @Param filter[field] query string false "Only rows where the whitelisted field equals the value"
 	// @Success 200 {array} models.Webhook
 	// @Failure 401 {object} map[string]string "Unauthorized"
 	// @Failure 403 {object} map[string]string "Forbidden"
@@ -632,13 +705,21 @@ func RegisterCRUDRoutes(g *echo.Group, db *gorm.DB) {
 
 	// Templates with team-specific permissions
 	templateService := services.NewBaseService(db, models.Template{})
-	templateController := controllers.NewBaseController(templateService)
+	templateController := controllers.NewBaseController(templateService, controllers.ListFields{
+		Sort:    []string{"name"},
+		Filter:  []string{"name", "categoryId", "isSample"},
+		Include: []string{"HtmlFile", "Category"},
+	})
 	templateGroup := g.Group("/templates")
 	templateGroup.Use(middleware.RequirePermissions(db, "templates:read"))
 	// @Summary List templates
 	// @Description Get a list of all templates
 	// @Accept json
 	// @Produce json
+	// @Param limit query int false "Page size, at most 100"
+	// @Param cursor query string false "nextCursor of the previous page"
+	// @Param sort query string false "Field and direction, e.g. createdAt:desc"
+	// @Param filter[field] query string false "Only rows where the whitelisted field equals the value"
 	// @Success 200 {array} models.Template
 	// @Failure 401 {object} map[string]string "Unauthorized"
 	// @Failure 403 {object} map[string]string "Forbidden"
@@ -674,63 +755,28 @@ func RegisterCRUDRoutes(g *echo.Group, db *gorm.DB) {
 	// @Router /api/v1/templates [post]
 	templateWriteGroup.POST("", templateController.Create)
 	templateWriteGroup.PUT("/:id", templateController.Update)
-	templateWriteGroup.DELETE("/:id", templateController.Delete)
+	// Deleting templates is in routes/template_routes.go so templates in use aren't removed
 
-	// API Keys with team-specific permissions
-	apiKeyService := services.NewBaseService(db, models.APIKey{})
-	apiKeyController := controllers.NewBaseController(apiKeyService)
-	apiKeyGroup := g.Group("/api-keys")
-	apiKeyGroup.Use(middleware.RequirePermissions(db, "api_keys:read"))
-	// @Summary List API keys
-	// @Description Get a list of all API keys
-	// @Accept json
-	// @Produce json
-	// @Success 200 {array} models.APIKey
-	// @Failure 401 {object} map[string]string "Unauthorized"
-	// @Failure 403 {object} map[string]string "Forbidden"
-	// @Failure 500 {object} map[string]string "Internal server error"
-	// @Router /api/v1/api-keys [get]
-	apiKeyGroup.GET("", apiKeyController.List)
-	// @Summary Get API key
-	// @Description Get an API key by ID
-	// @Accept json
-	// @Produce json
-	// @Param id path string true "API Key ID"
-	// @Success 200 {object} models.APIKey
-	// @Failure 401 {object} map[string]string "Unauthorized"
-	// @Failure 403 {object} map[string]string "Forbidden"
-	// @Failure 404 {object} map[string]string "Not found"
-	// @Failure 500 {object} map[string]string "Internal server error"
-	// @Router /api/v1/api-keys/{id} [get]
-	apiKeyGroup.GET("/:id", apiKeyController.Get)
-
-	// Protected API key routes
-	apiKeyWriteGroup := apiKeyGroup.Group("")
-	apiKeyWriteGroup.Use(middleware.RequirePermissions(db, "api_keys:write"))
-	// @Summary Create API key
-	// @Description Create a new API key
-	// @Accept json
-	// @Produce json
-	// @Param apiKey body models.APIKey true "API Key object"
-	// @Success 201 {object} models.APIKey
-	// @Failure 400 {object} map[string]string "Bad request"
-	// @Failure 401 {object} map[string]string "Unauthorized"
-	// @Failure 403 {object} map[string]string "Forbidden"
-	// @Failure 500 {object} map[string]string "Internal server error"
-	// @Router /api/v1/api-keys [post]
-	apiKeyWriteGroup.POST("", apiKeyController.Create)
-	apiKeyWriteGroup.PUT("/:id", apiKeyController.Update)
-	apiKeyWriteGroup.DELETE("/:id", apiKeyController.Delete)
+	// API keys are in routes/api_key_routes.go so their secrets are only returned once and keys
+	// are only granted permissions their creator holds
 
 	// API KEY USAGE with team-specific permissions
 	apiKeyUsageService := services.NewBaseService(db, models.APIKeyUsage{})
-	apiKeyUsageController := controllers.NewBaseController(apiKeyUsageService)
+	apiKeyUsageController := controllers.NewBaseController(apiKeyUsageService, controllers.ListFields{
+		Sort:    []string{"timestamp", "endpoint"},
+		Filter:  []string{"apiKeyId", "endpoint", "method", "success"},
+		Include: []string{"APIKey"},
+	})
 	apiKeyUsageGroup := g.Group("/api-key-usage")
 	apiKeyUsageGroup.Use(middleware.RequirePermissions(db, "api_key_usage:read"))
 	// @Summary List API key usage
 	// @Description Get a list of all API key usage
 	// @Accept json
 	// @Produce json
+	// @Param limit query int false "Page size, at most 100"
+	// @Param cursor query string false "nextCursor of the previous page"
+	// @Param sort query string false "Field and direction, e.g. createdAt:desc"
+	// @Param filter[field] query string false "Only rows where the whitelisted field equals the value"
 	// @Success 200 {array} models.APIKeyUsage
 	// @Failure 401 {object} map[string]string "Unauthorized"
 	// @Failure 403 {object} map[string]string "Forbidden"
@@ -752,13 +798,21 @@ func RegisterCRUDRoutes(g *echo.Group, db *gorm.DB) {
 
 	// Campaigns with team-specific permissions
 	campaignService := services.NewBaseService(db, models.Campaign{})
-	campaignController := controllers.NewBaseController(campaignService)
+	campaignController := controllers.NewBaseController(campaignService, controllers.ListFields{
+		Sort:    []string{"name", "scheduledFor", "status"},
+		Filter:  []string{"status", "listId", "segmentId", "templateId", "smtpConfigId", "schedule", "isSample"},
+		Include: []string{"Template", "List", "Segment", "Variants", "Languages"},
+	})
 	campaignGroup := g.Group("/campaigns")
 	campaignGroup.Use(middleware.RequirePermissions(db, "campaigns:read"))
 	// @Summary List campaigns
 	// @Description Get a list of all campaigns
 	// @Accept json
 	// @Produce json
+	// @Param limit query int false "Page size, at most 100"
+	// @Param cursor query string false "nextCursor of the previous page"
+	// @Param sort query string false "Field and direction, e.g. createdAt:desc"
+	// @Param filter[field] query string false "Only rows where the whitelisted field equals the value"
 	// @Success 200 {array} models.Campaign
 	// @Failure 401 {object} map[string]string "Unauthorized"
 	// @Failure 403 {object} map[string]string "Forbidden"
@@ -821,13 +875,21 @@ func RegisterCRUDRoutes(g *echo.Group, db *gorm.DB) {
 
 	// Automation routes with team-specific permissions
 	automationService := services.NewBaseService(db, models.Automation{})
-	automationController := controllers.NewBaseController(automationService)
+	automationController := controllers.NewBaseController(automationService, controllers.ListFields{
+		Sort:    []string{"name"},
+		Filter:  []string{"name", "isActive"},
+		Include: []string{"Nodes", "Edges"},
+	})
 	automationGroup := g.Group("/automations")
 	automationGroup.Use(middleware.RequirePermissions(db, "automations:read"))
 	// @Summary List automations
 	// @Description Get a list of all automations
 	// @Accept json
 	// @Produce json
+	// @Param limit query int false "Page size, at most 100"
+	// @Param cursor query string false "nextCursor of the previous page"
+	// @Param sort query string false "Field and direction, e.g. createdAt:desc"
+	// @Param filter[field] query string false "Only rows where the whitelisted field equals the value"
 	// @Success 200 {array} models.Automation
 	// @Failure 401 {object} map[string]string "Unauthorized"
 	// @Failure 403 {object} map[string]string "Forbidden"
@@ -879,13 +941,20 @@ func RegisterCRUDRoutes(g *echo.Group, db *gorm.DB) {
 
 	// Model routes with team-specific permissions
 	modelService := services.NewBaseService(db, models.Model{})
-	modelController := controllers.NewBaseController(modelService)
+	modelController := controllers.NewBaseController(modelService, controllers.ListFields{
+		Sort:   []string{"name"},
+		Filter: []string{"name", "provider"},
+	})
 	modelGroup := g.Group("/models")
 	modelGroup.Use(middleware.RequirePermissions(db, "models:read"))
 	// @Summary List models
 	// @Description Get a list of all models
 	// @Accept json
 	// @Produce json
+	// @Param limit query int false "Page size, at most 100"
+	// @Param cursor query string false "nextCursor of the previous page"
+	// @Param sort query string false "Field and direction, e.g. createdAt:desc"
+	// @Param filter[field] query string false "Only rows where the whitelisted field equals the value"
 	// @Success 200 {array} models.Model
 	// @Failure 401 {object} map[string]string "Unauthorized"
 	// @Failure 403 {object} map[string]string "Forbidden"
@@ -949,13 +1018,21 @@ func RegisterCRUDRoutes(g *echo.Group, db *gorm.DB) {
 
 	// Emails with team-specific permissions
 	emailService := services.NewBaseService(db, models.Email{})
-	emailController := controllers.NewBaseController(emailService)
+	emailController := controllers.NewBaseController(emailService, controllers.ListFields{
+		Sort:    []string{"sentAt", "sendAt", "status"},
+		Filter:  []string{"status", "to", "campaignId", "templateId", "contactId", "categoryId", "smtpConfigId", "automationId", "language", "test"},
+		Include: []string{"Template", "Contact", "Category", "Campaign", "Attachments"},
+	})
 	emailGroup := g.Group("/emails")
 	emailGroup.Use(middleware.RequirePermissions(db, "emails:read"))
 	// @Summary List emails
 	// @Description Get a list of all emails
 	// @Accept json
 	// @Produce json
+	// @Param limit query int false "Page size, at most 100"
+	// @Param cursor query string false "nextCursor of the previous page"
+	// @Param sort query string false "Field and direction, e.g. createdAt:desc"
+	// @Param filter[field] query string false "Only rows where the whitelisted field equals the value"
 	// @Success 200 {array} models.Email
 	// @Failure 401 {object} map[string]string "Unauthorized"
 	// @Failure 403 {object} map[string]string "Forbidden"
@@ -974,4 +1051,1500 @@ func RegisterCRUDRoutes(g *echo.Group, db *gorm.DB) {
 	// @Failure 500 {object} map[string]string "Internal server error"
 	// @Router /api/v1/emails/{id} [get]
 	emailGroup.GET("/:id", emailController.Get)
+
+	// Contact sync sources with team-specific permissions
+	contactSyncService := services.NewBaseService(db, models.ContactSyncSource{})
+	contactSyncController := controllers.NewBaseController(contactSyncService, controllers.ListFields{
+		Sort:    []string{"name", "lastSyncedAt"},
+		Filter:  []string{"listId", "lastStatus", "isActive", "format"},
+		Include: []string{"List"},
+	})
+	contactSyncGroup := g.Group("/contact-syncs")
+	contactSyncGroup.Use(middleware.RequirePermissions(db, "contact_syncs:read"))
+	// @Summary List contact syncs
+	// @Description Get a list of all contact syncs
+	// @Accept json
+	// @Produce json
+	// @Param limit query int false "Page size, at most 100"
+	// @Param cursor query string false "nextCursor of the previous page"
+	// @Param sort query string false "Field and direction, e.g. createdAt:desc"
+	// @Param filter[field] query string false "Only rows where the whitelisted field equals the value"
+	// @Success 200 {array} models.ContactSyncSource
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/contact-syncs [get]
+	contactSyncGroup.GET("", contactSyncController.List)
+	// @Summary Get contact sync
+	// @Description Get a contact sync by ID
+	// @Accept json
+	// @Produce json
+	// @Param id path string true "Contact sync ID"
+	// @Success 200 {object} models.ContactSyncSource
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 404 {object} map[string]string "Not found"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/contact-syncs/{id} [get]
+	contactSyncGroup.GET("/:id", contactSyncController.Get)
+
+	// Protected contact sync routes
+	contactSyncWriteGroup := contactSyncGroup.Group("")
+	contactSyncWriteGroup.Use(middleware.RequirePermissions(db, "contact_syncs:write"))
+	// @Summary Create contact sync
+	// @Description Create a new contact sync
+	// @Accept json
+	// @Produce json
+	// @Param contactSync body models.ContactSyncSource true "Contact sync object"
+	// @Success 201 {object} models.ContactSyncSource
+	// @Failure 400 {object} map[string]string "Bad request"
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/contact-syncs [post]
+	contactSyncWriteGroup.POST("", contactSyncController.Create)
+	// @Summary Update contact sync
+	// @Description Update an existing contact sync
+	// @Accept json
+	// @Produce json
+	// @Param id path string true "Contact sync ID"
+	// @Param contactSync body models.ContactSyncSource true "Contact sync object"
+	// @Success 200 {object} models.ContactSyncSource
+	// @Failure 400 {object} map[string]string "Bad request"
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 404 {object} map[string]string "Not found"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/contact-syncs/{id} [put]
+	contactSyncWriteGroup.PUT("/:id", contactSyncController.Update)
+	// @Summary Delete contact sync
+	// @Description Delete a contact sync
+	// @Accept json
+	// @Produce json
+	// @Param id path string true "Contact sync ID"
+	// @Success 204 "No content"
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 404 {object} map[string]string "Not found"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/contact-syncs/{id} [delete]
+	contactSyncWriteGroup.DELETE("/:id", contactSyncController.Delete)
+
+	// Segments with team-specific permissions
+	segmentService := services.NewBaseService(db, models.Segment{})
+	segmentController := controllers.NewBaseController(segmentService, controllers.ListFields{
+		Sort:    []string{"name"},
+		Filter:  []string{"name", "listId"},
+		Include: []string{"List"},
+	})
+	segmentGroup := g.Group("/segments")
+	segmentGroup.Use(middleware.RequirePermissions(db, "segments:read"))
+	// @Summary List segments
+	// @Description Get a list of all segments
+	// @Accept json
+	// @Produce json
+	// @Param limit query int false "Page size, at most 100"
+	// @Param cursor query string false "nextCursor of the previous page"
+	// @Param sort query string false "Field and direction, e.g. createdAt:desc"
+	// @Param filter[field] query string false "Only rows where the whitelisted field equals the value"
+	// @Success 200 {array} models.Segment
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/segments [get]
+	segmentGroup.GET("", segmentController.List)
+	// @Summary Get segment
+	// @Description Get a segment by ID
+	// @Accept json
+	// @Produce json
+	// @Param id path string true "Segment ID"
+	// @Success 200 {object} models.Segment
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 404 {object} map[string]string "Not found"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/segments/{id} [get]
+	segmentGroup.GET("/:id", segmentController.Get)
+
+	// Protected segment routes
+	segmentWriteGroup := segmentGroup.Group("")
+	segmentWriteGroup.Use(middleware.RequirePermissions(db, "segments:write"))
+	// @Summary Create segment
+	// @Description Create a new segment
+	// @Accept json
+	// @Produce json
+	// @Param segment body models.Segment true "Segment object"
+	// @Success 201 {object} models.Segment
+	// @Failure 400 {object} map[string]string "Bad request"
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/segments [post]
+	segmentWriteGroup.POST("", segmentController.Create)
+	// @Summary Update segment
+	// @Description Update an existing segment
+	// @Accept json
+	// @Produce json
+	// @Param id path string true "Segment ID"
+	// @Param segment body models.Segment true "Segment object"
+	// @Success 200 {object} models.Segment
+	// @Failure 400 {object} map[string]string "Bad request"
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 404 {object} map[string]string "Not found"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/segments/{id} [put]
+	segmentWriteGroup.PUT("/:id", segmentController.Update)
+	// @Summary Delete segment
+	// @Description Delete a segment
+	// @Accept json
+	// @Produce json
+	// @Param id path string true "Segment ID"
+	// @Success 204 "No content"
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 404 {object} map[string]string "Not found"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/segments/{id} [delete]
+	segmentWriteGroup.DELETE("/:id", segmentController.Delete)
+
+	// Blackout dates with team-specific permissions
+	blackoutDateService := services.NewBaseService(db, models.BlackoutDate{})
+	blackoutDateController := controllers.NewBaseController(blackoutDateService, controllers.ListFields{
+		Sort:   []string{"name", "startDate", "endDate"},
+		Filter: []string{"recurringYearly"},
+	})
+	blackoutDateGroup := g.Group("/blackout-dates")
+	blackoutDateGroup.Use(middleware.RequirePermissions(db, "blackout_dates:read"))
+	// @Summary List blackout dates
+	// @Description Get a list of all blackout dates
+	// @Accept json
+	// @Produce json
+	// @Param limit query int false "Page size, at most 100"
+	// @Param cursor query string false "nextCursor of the previous page"
+	// @Param sort query string false "Field and direction, e.g. createdAt:desc"
+	// @Param filter[field] query string false "Only rows where the whitelisted field equals the value"
+	// @Success 200 {array} models.BlackoutDate
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/blackout-dates [get]
+	blackoutDateGroup.GET("", blackoutDateController.List)
+	// @Summary Get blackout date
+	// @Description Get a blackout date by ID
+	// @Accept json
+	// @Produce json
+	// @Param id path string true "Blackout date ID"
+	// @Success 200 {object} models.BlackoutDate
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 404 {object} map[string]string "Not found"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/blackout-dates/{id} [get]
+	blackoutDateGroup.GET("/:id", blackoutDateController.Get)
+
+	// Protected blackout date routes
+	blackoutDateWriteGroup := blackoutDateGroup.Group("")
+	blackoutDateWriteGroup.Use(middleware.RequirePermissions(db, "blackout_dates:write"))
+	// @Summary Create blackout date
+	// @Description Create a new blackout date
+	// @Accept json
+	// @Produce json
+	// @Param blackoutDate body models.BlackoutDate true "Blackout date object"
+	// @Success 201 {object} models.BlackoutDate
+	// @Failure 400 {object} map[string]string "Bad request"
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/blackout-dates [post]
+	blackoutDateWriteGroup.POST("", blackoutDateController.Create)
+	// @Summary Update blackout date
+	// @Description Update an existing blackout date
+	// @Accept json
+	// @Produce json
+	// @Param id path string true "Blackout date ID"
+	// @Param blackoutDate body models.BlackoutDate true "Blackout date object"
+	// @Success 200 {object} models.BlackoutDate
+	// @Failure 400 {object} map[string]string "Bad request"
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 404 {object} map[string]string "Not found"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/blackout-dates/{id} [put]
+	blackoutDateWriteGroup.PUT("/:id", blackoutDateController.Update)
+	// @Summary Delete blackout date
+	// @Description Delete a blackout date
+	// @Accept json
+	// @Produce json
+	// @Param id path string true "Blackout date ID"
+	// @Success 204 "No content"
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 404 {object} map[string]string "Not found"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/blackout-dates/{id} [delete]
+	blackoutDateWriteGroup.DELETE("/:id", blackoutDateController.Delete)
+
+	// Campaign alert rules with team-specific permissions
+	alertRuleService := services.NewBaseService(db, models.AlertRule{})
+	alertRuleController := controllers.NewBaseController(alertRuleService, controllers.ListFields{
+		Sort:    []string{"name"},
+		Filter:  []string{"metric", "campaignId", "isActive"},
+		Include: []string{"Campaign"},
+	})
+	alertRuleGroup := g.Group("/alert-rules")
+	alertRuleGroup.Use(middleware.RequirePermissions(db, "alert_rules:read"))
+	// @Summary List alert rules
+	// @Description Get a list of all alert rules
+	// @Accept json
+	// @Produce json
+	// @Param limit query int false "Page size, at most 100"
+	// @Param cursor query string false "nextCursor of the previous page"
+	// @Param sort query string false "Field and direction, e.g. createdAt:desc"
+	// @Param filter[field] query string false "Only rows where the whitelisted field equals the value"
+	// @Success 200 {array} models.AlertRule
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/alert-rules [get]
+	alertRuleGroup.GET("", alertRuleController.List)
+	// @Summary Get alert rule
+	// @Description Get an alert rule by ID
+	// @Accept json
+	// @Produce json
+	// @Param id path string true "Alert rule ID"
+	// @Success 200 {object} models.AlertRule
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 404 {object} map[string]string "Not found"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/alert-rules/{id} [get]
+	alertRuleGroup.GET("/:id", alertRuleController.Get)
+
+	// Protected alert rule routes
+	alertRuleWriteGroup := alertRuleGroup.Group("")
+	alertRuleWriteGroup.Use(middleware.RequirePermissions(db, "alert_rules:write"))
+	// @Summary Create alert rule
+	// @Description Create a new alert rule
+	// @Accept json
+	// @Produce json
+	// @Param alertRule body models.AlertRule true "Alert rule object"
+	// @Success 201 {object} models.AlertRule
+	// @Failure 400 {object} map[string]string "Bad request"
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/alert-rules [post]
+	alertRuleWriteGroup.POST("", alertRuleController.Create)
+	// @Summary Update alert rule
+	// @Description Update an existing alert rule
+	// @Accept json
+	// @Produce json
+	// @Param id path string true "Alert rule ID"
+	// @Param alertRule body models.AlertRule true "Alert rule object"
+	// @Success 200 {object} models.AlertRule
+	// @Failure 400 {object} map[string]string "Bad request"
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 404 {object} map[string]string "Not found"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/alert-rules/{id} [put]
+	alertRuleWriteGroup.PUT("/:id", alertRuleController.Update)
+	// @Summary Delete alert rule
+	// @Description Delete an alert rule
+	// @Accept json
+	// @Produce json
+	// @Param id path string true "Alert rule ID"
+	// @Success 204 "No content"
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 404 {object} map[string]string "Not found"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/alert-rules/{id} [delete]
+	alertRuleWriteGroup.DELETE("/:id", alertRuleController.Delete)
+
+	// Campaign A/B test variants with team-specific permissions
+	campaignVariantService := services.NewBaseService(db, models.CampaignVariant{})
+	campaignVariantController := controllers.NewBaseController(campaignVariantService, controllers.ListFields{
+		Sort:    []string{"name", "percentage"},
+		Filter:  []string{"campaignId", "templateId", "isWinner"},
+		Include: []string{"Campaign", "Template"},
+	})
+	campaignVariantGroup := g.Group("/campaign-variants")
+	campaignVariantGroup.Use(middleware.RequirePermissions(db, "campaigns:read"))
+	// @Summary List campaign variants
+	// @Description Get a list of all campaign variants
+	// @Accept json
+	// @Produce json
+	// @Param limit query int false "Page size, at most 100"
+	// @Param cursor query string false "nextCursor of the previous page"
+	// @Param sort query string false "Field and direction, e.g. createdAt:desc"
+	// @Param filter[field] query string false "Only rows where the whitelisted field equals the value"
+	// @Success 200 {array} models.CampaignVariant
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/campaign-variants [get]
+	campaignVariantGroup.GET("", campaignVariantController.List)
+	// @Summary Get campaign variant
+	// @Description Get a campaign variant by ID
+	// @Accept json
+	// @Produce json
+	// @Param id path string true "Campaign variant ID"
+	// @Success 200 {object} models.CampaignVariant
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 404 {object} map[string]string "Not found"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/campaign-variants/{id} [get]
+	campaignVariantGroup.GET("/:id", campaignVariantController.Get)
+
+	// Protected campaign variant routes
+	campaignVariantWriteGroup := campaignVariantGroup.Group("")
+	campaignVariantWriteGroup.Use(middleware.RequirePermissions(db, "campaigns:write"))
+	// @Summary Create campaign variant
+	// @Description Create a new campaign variant
+	// @Accept json
+	// @Produce json
+	// @Param campaignVariant body models.CampaignVariant true "Campaign variant object"
+	// @Success 201 {object} models.CampaignVariant
+	// @Failure 400 {object} map[string]string "Bad request"
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/campaign-variants [post]
+	campaignVariantWriteGroup.POST("", campaignVariantController.Create)
+	// @Summary Update campaign variant
+	// @Description Update an existing campaign variant
+	// @Accept json
+	// @Produce json
+	// @Param id path string true "Campaign variant ID"
+	// @Param campaignVariant body models.CampaignVariant true "Campaign variant object"
+	// @Success 200 {object} models.CampaignVariant
+	// @Failure 400 {object} map[string]string "Bad request"
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 404 {object} map[string]string "Not found"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/campaign-variants/{id} [put]
+	campaignVariantWriteGroup.PUT("/:id", campaignVariantController.Update)
+	// @Summary Delete campaign variant
+	// @Description Delete a campaign variant
+	// @Accept json
+	// @Produce json
+	// @Param id path string true "Campaign variant ID"
+	// @Success 204 "No content"
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 404 {object} map[string]string "Not found"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/campaign-variants/{id} [delete]
+	campaignVariantWriteGroup.DELETE("/:id", campaignVariantController.Delete)
+
+	// Campaign language variants with team-specific permissions
+	campaignLanguageService := services.NewBaseService(db, models.CampaignLanguage{})
+	campaignLanguageController := controllers.NewBaseController(campaignLanguageService, controllers.ListFields{
+		Sort:    []string{"language"},
+		Filter:  []string{"campaignId", "templateId", "language"},
+		Include: []string{"Campaign", "Template"},
+	})
+	campaignLanguageGroup := g.Group("/campaign-languages")
+	campaignLanguageGroup.Use(middleware.RequirePermissions(db, "campaigns:read"))
+	// @Summary List campaign languages
+	// @Description Get a list of all campaign languages
+	// @Accept json
+	// @Produce json
+	// @Param limit query int false "Page size, at most 100"
+	// @Param cursor query string false "nextCursor of the previous page"
+	// @Param sort query string false "Field and direction, e.g. createdAt:desc"
+	// @Param filter[field] query string false "Only rows where the whitelisted field equals the value"
+	// @Success 200 {array} models.CampaignLanguage
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/campaign-languages [get]
+	campaignLanguageGroup.GET("", campaignLanguageController.List)
+	// @Summary Get campaign language
+	// @Description Get a campaign language by ID
+	// @Accept json
+	// @Produce json
+	// @Param id path string true "Campaign language ID"
+	// @Success 200 {object} models.CampaignLanguage
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 404 {object} map[string]string "Not found"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/campaign-languages/{id} [get]
+	campaignLanguageGroup.GET("/:id", campaignLanguageController.Get)
+
+	// Protected campaign language routes
+	campaignLanguageWriteGroup := campaignLanguageGroup.Group("")
+	campaignLanguageWriteGroup.Use(middleware.RequirePermissions(db, "campaigns:write"))
+	// @Summary Create campaign language
+	// @Description Create a new campaign language
+	// @Accept json
+	// @Produce json
+	// @Param campaignLanguage body models.CampaignLanguage true "Campaign language object"
+	// @Success 201 {object} models.CampaignLanguage
+	// @Failure 400 {object} map[string]string "Bad request"
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/campaign-languages [post]
+	campaignLanguageWriteGroup.POST("", campaignLanguageController.Create)
+	// @Summary Update campaign language
+	// @Description Update an existing campaign language
+	// @Accept json
+	// @Produce json
+	// @Param id path string true "Campaign language ID"
+	// @Param campaignLanguage body models.CampaignLanguage true "Campaign language object"
+	// @Success 200 {object} models.CampaignLanguage
+	// @Failure 400 {object} map[string]string "Bad request"
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 404 {object} map[string]string "Not found"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/campaign-languages/{id} [put]
+	campaignLanguageWriteGroup.PUT("/:id", campaignLanguageController.Update)
+	// @Summary Delete campaign language
+	// @Description Delete a campaign language
+	// @Accept json
+	// @Produce json
+	// @Param id path string true "Campaign language ID"
+	// @Success 204 "No content"
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 404 {object} map[string]string "Not found"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/campaign-languages/{id} [delete]
+	campaignLanguageWriteGroup.DELETE("/:id", campaignLanguageController.Delete)
+
+	// Lists, segments and campaigns whose recipients a campaign leaves out
+	campaignExclusionService := services.NewBaseService(db, models.CampaignExclusion{})
+	campaignExclusionController := controllers.NewBaseController(campaignExclusionService, controllers.ListFields{
+		Sort:    []string{"type"},
+		Filter:  []string{"campaignId", "type", "targetId"},
+		Include: []string{"Campaign"},
+	})
+	campaignExclusionGroup := g.Group("/campaign-exclusions")
+	campaignExclusionGroup.Use(middleware.RequirePermissions(db, "campaigns:read"))
+	// @Summary List campaign exclusions
+	// @Description Get a list of all campaign exclusions
+	// @Accept json
+	// @Produce json
+	// @Param limit query int false "Page size, at most 100"
+	// @Param cursor query string false "nextCursor of the previous page"
+	// @Param sort query string false "Field and direction, e.g. createdAt:desc"
+	// @Param filter[field] query string false "Only rows where the whitelisted field equals the value"
+	// @Success 200 {array} models.CampaignExclusion
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/campaign-exclusions [get]
+	campaignExclusionGroup.GET("", campaignExclusionController.List)
+	// @Summary Get campaign exclusion
+	// @Description Get a campaign exclusion by ID
+	// @Accept json
+	// @Produce json
+	// @Param id path string true "Campaign exclusion ID"
+	// @Success 200 {object} models.CampaignExclusion
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 404 {object} map[string]string "Not found"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/campaign-exclusions/{id} [get]
+	campaignExclusionGroup.GET("/:id", campaignExclusionController.Get)
+
+	// Protected campaign exclusion routes. Exclusions are replaced rather than edited, so the
+	// target is always checked against the campaign's team.
+	campaignExclusionWriteGroup := campaignExclusionGroup.Group("")
+	campaignExclusionWriteGroup.Use(middleware.RequirePermissions(db, "campaigns:write"))
+	// @Summary Create campaign exclusion
+	// @Description Leave the recipients of a list, segment or earlier campaign out of a campaign
+	// @Accept json
+	// @Produce json
+	// @Param campaignExclusion body models.CampaignExclusion true "Campaign exclusion object"
+	// @Success 201 {object} models.CampaignExclusion
+	// @Failure 400 {object} map[string]string "Bad request"
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 422 {object} map[string]string "Target not found, duplicate or the campaign itself"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/campaign-exclusions [post]
+	campaignExclusionWriteGroup.POST("", campaignExclusionController.Create)
+	// @Summary Delete campaign exclusion
+	// @Description Delete a campaign exclusion
+	// @Accept json
+	// @Produce json
+	// @Param id path string true "Campaign exclusion ID"
+	// @Success 204 "No content"
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 404 {object} map[string]string "Not found"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/campaign-exclusions/{id} [delete]
+	campaignExclusionWriteGroup.DELETE("/:id", campaignExclusionController.Delete)
+
+	// Dynamic content blocks with team-specific permissions
+	contentBlockService := services.NewBaseService(db, models.ContentBlock{})
+	contentBlockController := controllers.NewBaseController(contentBlockService, controllers.ListFields{
+		Sort:    []string{"name", "key"},
+		Filter:  []string{"name", "key"},
+		Include: []string{"Variants"},
+	})
+	contentBlockGroup := g.Group("/content-blocks")
+	contentBlockGroup.Use(middleware.RequirePermissions(db, "content_blocks:read"))
+	// @Summary List content blocks
+	// @Description Get a list of all content blocks
+	// @Accept json
+	// @Produce json
+	// @Param limit query int false "Page size, at most 100"
+	// @Param cursor query string false "nextCursor of the previous page"
+	// @Param sort query string false "Field and direction, e.g. createdAt:desc"
+	// @Param filter[field] query string false "Only rows where the whitelisted field equals the value"
+	// @Success 200 {array} models.ContentBlock
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/content-blocks [get]
+	contentBlockGroup.GET("", contentBlockController.List)
+	// @Summary Get content block
+	// @Description Get a content block by ID
+	// @Accept json
+	// @Produce json
+	// @Param id path string true "Content block ID"
+	// @Success 200 {object} models.ContentBlock
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 404 {object} map[string]string "Not found"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/content-blocks/{id} [get]
+	contentBlockGroup.GET("/:id", contentBlockController.Get)
+
+	// Protected content block routes
+	contentBlockWriteGroup := contentBlockGroup.Group("")
+	contentBlockWriteGroup.Use(middleware.RequirePermissions(db, "content_blocks:write"))
+	// @Summary Create content block
+	// @Description Create a new content block
+	// @Accept json
+	// @Produce json
+	// @Param contentBlock body models.ContentBlock true "Content block object"
+	// @Success 201 {object} models.ContentBlock
+	// @Failure 400 {object} map[string]string "Bad request"
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/content-blocks [post]
+	contentBlockWriteGroup.POST("", contentBlockController.Create)
+	// @Summary Update content block
+	// @Description Update an existing content block
+	// @Accept json
+	// @Produce json
+	// @Param id path string true "Content block ID"
+	// @Param contentBlock body models.ContentBlock true "Content block object"
+	// @Success 200 {object} models.ContentBlock
+	// @Failure 400 {object} map[string]string "Bad request"
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 404 {object} map[string]string "Not found"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/content-blocks/{id} [put]
+	contentBlockWriteGroup.PUT("/:id", contentBlockController.Update)
+	// @Summary Delete content block
+	// @Description Delete a content block
+	// @Accept json
+	// @Produce json
+	// @Param id path string true "Content block ID"
+	// @Success 204 "No content"
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 404 {object} map[string]string "Not found"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/content-blocks/{id} [delete]
+	contentBlockWriteGroup.DELETE("/:id", contentBlockController.Delete)
+
+	// Content block variants with team-specific permissions
+	contentBlockVariantService := services.NewBaseService(db, models.ContentBlockVariant{})
+	contentBlockVariantController := controllers.NewBaseController(contentBlockVariantService, controllers.ListFields{
+		Sort:    []string{"name", "position", "weight"},
+		Filter:  []string{"blockId"},
+		Include: []string{"Block"},
+	})
+	contentBlockVariantGroup := g.Group("/content-block-variants")
+	contentBlockVariantGroup.Use(middleware.RequirePermissions(db, "content_blocks:read"))
+	// @Summary List content block variants
+	// @Description Get a list of all content block variants
+	// @Accept json
+	// @Produce json
+	// @Param limit query int false "Page size, at most 100"
+	// @Param cursor query string false "nextCursor of the previous page"
+	// @Param sort query string false "Field and direction, e.g. createdAt:desc"
+	// @Param filter[field] query string false "Only rows where the whitelisted field equals the value"
+	// @Success 200 {array} models.ContentBlockVariant
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/content-block-variants [get]
+	contentBlockVariantGroup.GET("", contentBlockVariantController.List)
+	// @Summary Get content block variant
+	// @Description Get a content block variant by ID
+	// @Accept json
+	// @Produce json
+	// @Param id path string true "Content block variant ID"
+	// @Success 200 {object} models.ContentBlockVariant
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 404 {object} map[string]string "Not found"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/content-block-variants/{id} [get]
+	contentBlockVariantGroup.GET("/:id", contentBlockVariantController.Get)
+
+	// Protected content block variant routes
+	contentBlockVariantWriteGroup := contentBlockVariantGroup.Group("")
+	contentBlockVariantWriteGroup.Use(middleware.RequirePermissions(db, "content_blocks:write"))
+	// @Summary Create content block variant
+	// @Description Create a new content block variant
+	// @Accept json
+	// @Produce json
+	// @Param contentBlockVariant body models.ContentBlockVariant true "Content block variant object"
+	// @Success 201 {object} models.ContentBlockVariant
+	// @Failure 400 {object} map[string]string "Bad request"
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/content-block-variants [post]
+	contentBlockVariantWriteGroup.POST("", contentBlockVariantController.Create)
+	// @Summary Update content block variant
+	// @Description Update an existing content block variant
+	// @Accept json
+	// @Produce json
+	// @Param id path string true "Content block variant ID"
+	// @Param contentBlockVariant body models.ContentBlockVariant true "Content block variant object"
+	// @Success 200 {object} models.ContentBlockVariant
+	// @Failure 400 {object} map[string]string "Bad request"
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 404 {object} map[string]string "Not found"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/content-block-variants/{id} [put]
+	contentBlockVariantWriteGroup.PUT("/:id", contentBlockVariantController.Update)
+	// @Summary Delete content block variant
+	// @Description Delete a content block variant
+	// @Accept json
+	// @Produce json
+	// @Param id path string true "Content block variant ID"
+	// @Success 204 "No content"
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 404 {object} map[string]string "Not found"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/content-block-variants/{id} [delete]
+	contentBlockVariantWriteGroup.DELETE("/:id", contentBlockVariantController.Delete)
+
+	// Contact scoring endpoints with team-specific permissions
+	scoringEndpointService := services.NewBaseService(db, models.ScoringEndpoint{})
+	scoringEndpointController := controllers.NewBaseController(scoringEndpointService, controllers.ListFields{
+		Sort:   []string{"name", "lastCalledAt"},
+		Filter: []string{"isActive"},
+	})
+	scoringEndpointGroup := g.Group("/scoring-endpoints")
+	scoringEndpointGroup.Use(middleware.RequirePermissions(db, "scoring_endpoints:read"))
+	// @Summary List scoring endpoints
+	// @Description Get a list of all scoring endpoints
+	// @Accept json
+	// @Produce json
+	// @Param limit query int false "Page size, at most 100"
+	// @Param cursor query string false "nextCursor of the previous page"
+	// @Param sort query string false "Field and direction, e.g. createdAt:desc"
+	// @Param filter[field] query string false "Only rows where the whitelisted field equals the value"
+	// @Success 200 {array} models.ScoringEndpoint
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/scoring-endpoints [get]
+	scoringEndpointGroup.GET("", scoringEndpointController.List)
+	// @Summary Get scoring endpoint
+	// @Description Get a scoring endpoint by ID
+	// @Accept json
+	// @Produce json
+	// @Param id path string true "Scoring endpoint ID"
+	// @Success 200 {object} models.ScoringEndpoint
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 404 {object} map[string]string "Not found"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/scoring-endpoints/{id} [get]
+	scoringEndpointGroup.GET("/:id", scoringEndpointController.Get)
+
+	// Protected scoring endpoint routes
+	scoringEndpointWriteGroup := scoringEndpointGroup.Group("")
+	scoringEndpointWriteGroup.Use(middleware.RequirePermissions(db, "scoring_endpoints:write"))
+	// @Summary Create scoring endpoint
+	// @Description Create a new scoring endpoint
+	// @Accept json
+	// @Produce json
+	// @Param scoringEndpoint body models.ScoringEndpoint true "Scoring endpoint object"
+	// @Success 201 {object} models.ScoringEndpoint
+	// @Failure 400 {object} map[string]string "Bad request"
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/scoring-endpoints [post]
+	scoringEndpointWriteGroup.POST("", scoringEndpointController.Create)
+	// @Summary Update scoring endpoint
+	// @Description Update an existing scoring endpoint
+	// @Accept json
+	// @Produce json
+	// @Param id path string true "Scoring endpoint ID"
+	// @Param scoringEndpoint body models.ScoringEndpoint true "Scoring endpoint object"
+	// @Success 200 {object} models.ScoringEndpoint
+	// @Failure 400 {object} map[string]string "Bad request"
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 404 {object} map[string]string "Not found"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/scoring-endpoints/{id} [put]
+	scoringEndpointWriteGroup.PUT("/:id", scoringEndpointController.Update)
+	// @Summary Delete scoring endpoint
+	// @Description Delete a scoring endpoint
+	// @Accept json
+	// @Produce json
+	// @Param id path string true "Scoring endpoint ID"
+	// @Success 204 "No content"
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 404 {object} map[string]string "Not found"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/scoring-endpoints/{id} [delete]
+	scoringEndpointWriteGroup.DELETE("/:id", scoringEndpointController.Delete)
+
+	// Sender personas with team-specific permissions
+	senderPersonaService := services.NewBaseService(db, models.SenderPersona{})
+	senderPersonaController := controllers.NewBaseController(senderPersonaService, controllers.ListFields{
+		Sort:   []string{"name", "fromEmail"},
+		Filter: []string{"isActive", "fromEmail"},
+	})
+	senderPersonaGroup := g.Group("/sender-personas")
+	senderPersonaGroup.Use(middleware.RequirePermissions(db, "sender_personas:read"))
+	// @Summary List sender personas
+	// @Description Get a list of all sender personas
+	// @Accept json
+	// @Produce json
+	// @Param limit query int false "Page size, at most 100"
+	// @Param cursor query string false "nextCursor of the previous page"
+	// @Param sort query string false "Field and direction, e.g. createdAt:desc"
+	// @Param filter[field] query string false "Only rows where the whitelisted field equals the value"
+	// @Success 200 {array} models.SenderPersona
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/sender-personas [get]
+	senderPersonaGroup.GET("", senderPersonaController.List)
+	// @Summary Get sender persona
+	// @Description Get a sender persona by ID
+	// @Accept json
+	// @Produce json
+	// @Param id path string true "Sender persona ID"
+	// @Success 200 {object} models.SenderPersona
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 404 {object} map[string]string "Not found"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/sender-personas/{id} [get]
+	senderPersonaGroup.GET("/:id", senderPersonaController.Get)
+
+	// Protected sender persona routes
+	senderPersonaWriteGroup := senderPersonaGroup.Group("")
+	senderPersonaWriteGroup.Use(middleware.RequirePermissions(db, "sender_personas:write"))
+	// @Summary Create sender persona
+	// @Description Create a new sender persona
+	// @Accept json
+	// @Produce json
+	// @Param senderPersona body models.SenderPersona true "Sender persona object"
+	// @Success 201 {object} models.SenderPersona
+	// @Failure 400 {object} map[string]string "Bad request"
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/sender-personas [post]
+	senderPersonaWriteGroup.POST("", senderPersonaController.Create)
+	// @Summary Update sender persona
+	// @Description Update an existing sender persona
+	// @Accept json
+	// @Produce json
+	// @Param id path string true "Sender persona ID"
+	// @Param senderPersona body models.SenderPersona true "Sender persona object"
+	// @Success 200 {object} models.SenderPersona
+	// @Failure 400 {object} map[string]string "Bad request"
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 404 {object} map[string]string "Not found"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/sender-personas/{id} [put]
+	senderPersonaWriteGroup.PUT("/:id", senderPersonaController.Update)
+	// @Summary Delete sender persona
+	// @Description Delete a sender persona
+	// @Accept json
+	// @Produce json
+	// @Param id path string true "Sender persona ID"
+	// @Success 204 "No content"
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 404 {object} map[string]string "Not found"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/sender-personas/{id} [delete]
+	senderPersonaWriteGroup.DELETE("/:id", senderPersonaController.Delete)
+
+	// Reputation connectors with team-specific permissions
+	reputationConnectorService := services.NewBaseService(db, models.ReputationConnector{})
+	reputationConnectorController := controllers.NewBaseController(reputationConnectorService, controllers.ListFields{
+		Sort:   []string{"name", "lastSyncedAt"},
+		Filter: []string{"isActive", "provider"},
+	})
+	reputationConnectorGroup := g.Group("/reputation-connectors")
+	reputationConnectorGroup.Use(middleware.RequirePermissions(db, "reputation_connectors:read"))
+	// @Summary List reputation connectors
+	// @Description Get a list of all reputation connectors
+	// @Accept json
+	// @Produce json
+	// @Param limit query int false "Page size, at most 100"
+	// @Param cursor query string false "nextCursor of the previous page"
+	// @Param sort query string false "Field and direction, e.g. createdAt:desc"
+	// @Param filter[field] query string false "Only rows where the whitelisted field equals the value"
+	// @Success 200 {array} models.ReputationConnector
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/reputation-connectors [get]
+	reputationConnectorGroup.GET("", reputationConnectorController.List)
+	// @Summary Get reputation connector
+	// @Description Get a reputation connector by ID
+	// @Accept json
+	// @Produce json
+	// @Param id path string true "Reputation connector ID"
+	// @Success 200 {object} models.ReputationConnector
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 404 {object} map[string]string "Not found"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/reputation-connectors/{id} [get]
+	reputationConnectorGroup.GET("/:id", reputationConnectorController.Get)
+
+	// Protected reputation connector routes
+	reputationConnectorWriteGroup := reputationConnectorGroup.Group("")
+	reputationConnectorWriteGroup.Use(middleware.RequirePermissions(db, "reputation_connectors:write"))
+	// @Summary Create reputation connector
+	// @Description Create a new reputation connector
+	// @Accept json
+	// @Produce json
+	// @Param reputationConnector body models.ReputationConnector true "Reputation connector object"
+	// @Success 201 {object} models.ReputationConnector
+	// @Failure 400 {object} map[string]string "Bad request"
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/reputation-connectors [post]
+	reputationConnectorWriteGroup.POST("", reputationConnectorController.Create)
+	// @Summary Update reputation connector
+	// @Description Update an existing reputation connector
+	// @Accept json
+	// @Produce json
+	// @Param id path string true "Reputation connector ID"
+	// @Param reputationConnector body models.ReputationConnector true "Reputation connector object"
+	// @Success 200 {object} models.ReputationConnector
+	// @Failure 400 {object} map[string]string "Bad request"
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 404 {object} map[string]string "Not found"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/reputation-connectors/{id} [put]
+	reputationConnectorWriteGroup.PUT("/:id", reputationConnectorController.Update)
+	// @Summary Delete reputation connector
+	// @Description Delete a reputation connector
+	// @Accept json
+	// @Produce json
+	// @Param id path string true "Reputation connector ID"
+	// @Success 204 "No content"
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 404 {object} map[string]string "Not found"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/reputation-connectors/{id} [delete]
+	reputationConnectorWriteGroup.DELETE("/:id", reputationConnectorController.Delete)
+
+	// Frequency caps with team-specific permissions
+	frequencyCapService := services.NewBaseService(db, models.FrequencyCap{})
+	frequencyCapController := controllers.NewBaseController(frequencyCapService, controllers.ListFields{
+		Sort:   []string{"name", "periodDays"},
+		Filter: []string{"isActive", "scope", "action"},
+	})
+	frequencyCapGroup := g.Group("/frequency-caps")
+	frequencyCapGroup.Use(middleware.RequirePermissions(db, "frequency_caps:read"))
+	// @Summary List frequency caps
+	// @Description Get a list of all frequency caps
+	// @Accept json
+	// @Produce json
+	// @Param limit query int false "Page size, at most 100"
+	// @Param cursor query string false "nextCursor of the previous page"
+	// @Param sort query string false "Field and direction, e.g. createdAt:desc"
+	// @Param filter[field] query string false "Only rows where the whitelisted field equals the value"
+	// @Success 200 {array} models.FrequencyCap
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/frequency-caps [get]
+	frequencyCapGroup.GET("", frequencyCapController.List)
+	// @Summary Get frequency cap
+	// @Description Get a frequency cap by ID
+	// @Accept json
+	// @Produce json
+	// @Param id path string true "Frequency cap ID"
+	// @Success 200 {object} models.FrequencyCap
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 404 {object} map[string]string "Not found"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/frequency-caps/{id} [get]
+	frequencyCapGroup.GET("/:id", frequencyCapController.Get)
+
+	// Protected frequency cap routes
+	frequencyCapWriteGroup := frequencyCapGroup.Group("")
+	frequencyCapWriteGroup.Use(middleware.RequirePermissions(db, "frequency_caps:write"))
+	// @Summary Create frequency cap
+	// @Description Create a new frequency cap
+	// @Accept json
+	// @Produce json
+	// @Param frequencyCap body models.FrequencyCap true "Frequency cap object"
+	// @Success 201 {object} models.FrequencyCap
+	// @Failure 400 {object} map[string]string "Bad request"
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/frequency-caps [post]
+	frequencyCapWriteGroup.POST("", frequencyCapController.Create)
+	// @Summary Update frequency cap
+	// @Description Update an existing frequency cap
+	// @Accept json
+	// @Produce json
+	// @Param id path string true "Frequency cap ID"
+	// @Param frequencyCap body models.FrequencyCap true "Frequency cap object"
+	// @Success 200 {object} models.FrequencyCap
+	// @Failure 400 {object} map[string]string "Bad request"
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 404 {object} map[string]string "Not found"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/frequency-caps/{id} [put]
+	frequencyCapWriteGroup.PUT("/:id", frequencyCapController.Update)
+	// @Summary Delete frequency cap
+	// @Description Delete a frequency cap
+	// @Accept json
+	// @Produce json
+	// @Param id path string true "Frequency cap ID"
+	// @Success 204 "No content"
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 404 {object} map[string]string "Not found"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/frequency-caps/{id} [delete]
+	frequencyCapWriteGroup.DELETE("/:id", frequencyCapController.Delete)
+
+	// Computed fields with team-specific permissions
+	computedFieldService := services.NewBaseService(db, models.ComputedField{})
+	computedFieldController := controllers.NewBaseController(computedFieldService, controllers.ListFields{
+		Sort:   []string{"name"},
+		Filter: []string{"name"},
+	})
+	computedFieldGroup := g.Group("/computed-fields")
+	computedFieldGroup.Use(middleware.RequirePermissions(db, "computed_fields:read"))
+	// @Summary List computed fields
+	// @Description Get a list of all computed fields
+	// @Accept json
+	// @Produce json
+	// @Param limit query int false "Page size, at most 100"
+	// @Param cursor query string false "nextCursor of the previous page"
+	// @Param sort query string false "Field and direction, e.g. createdAt:desc"
+	// @Param filter[field] query string false "Only rows where the whitelisted field equals the value"
+	// @Success 200 {array} models.ComputedField
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/computed-fields [get]
+	computedFieldGroup.GET("", computedFieldController.List)
+	// @Summary Get computed field
+	// @Description Get a computed field by ID
+	// @Accept json
+	// @Produce json
+	// @Param id path string true "Computed field ID"
+	// @Success 200 {object} models.ComputedField
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 404 {object} map[string]string "Not found"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/computed-fields/{id} [get]
+	computedFieldGroup.GET("/:id", computedFieldController.Get)
+
+	// Protected computed field routes
+	computedFieldWriteGroup := computedFieldGroup.Group("")
+	computedFieldWriteGroup.Use(middleware.RequirePermissions(db, "computed_fields:write"))
+	// @Summary Create computed field
+	// @Description Create a new computed field
+	// @Accept json
+	// @Produce json
+	// @Param computedField body models.ComputedField true "Computed field object"
+	// @Success 201 {object} models.ComputedField
+	// @Failure 400 {object} map[string]string "Bad request"
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/computed-fields [post]
+	computedFieldWriteGroup.POST("", computedFieldController.Create)
+	// @Summary Update computed field
+	// @Description Update an existing computed field
+	// @Accept json
+	// @Produce json
+	// @Param id path string true "Computed field ID"
+	// @Param computedField body models.ComputedField true "Computed field object"
+	// @Success 200 {object} models.ComputedField
+	// @Failure 400 {object} map[string]string "Bad request"
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 404 {object} map[string]string "Not found"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/computed-fields/{id} [put]
+	computedFieldWriteGroup.PUT("/:id", computedFieldController.Update)
+	// @Summary Delete computed field
+	// @Description Delete a computed field
+	// @Accept json
+	// @Produce json
+	// @Param id path string true "Computed field ID"
+	// @Success 204 "No content"
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 404 {object} map[string]string "Not found"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/computed-fields/{id} [delete]
+	computedFieldWriteGroup.DELETE("/:id", computedFieldController.Delete)
+
+	// Subscribe forms with team-specific permissions
+	subscribeFormService := services.NewBaseService(db, models.SubscribeForm{})
+	subscribeFormController := controllers.NewBaseController(subscribeFormService, controllers.ListFields{
+		Sort:    []string{"name", "submissions", "lastSubmittedAt"},
+		Filter:  []string{"isActive", "listId"},
+		Include: []string{"List"},
+	})
+	subscribeFormGroup := g.Group("/subscribe-forms")
+	subscribeFormGroup.Use(middleware.RequirePermissions(db, "subscribe_forms:read"))
+	// @Summary List subscribe forms
+	// @Description Get a list of all subscribe forms
+	// @Accept json
+	// @Produce json
+	// @Param limit query int false "Page size, at most 100"
+	// @Param cursor query string false "nextCursor of the previous page"
+	// @Param sort query string false "Field and direction, e.g. createdAt:desc"
+	// @Param filter[field] query string false "Only rows where the whitelisted field equals the value"
+	// @Success 200 {array} models.SubscribeForm
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/subscribe-forms [get]
+	subscribeFormGroup.GET("", subscribeFormController.List)
+	// @Summary Get subscribe form
+	// @Description Get a subscribe form by ID
+	// @Accept json
+	// @Produce json
+	// @Param id path string true "Subscribe form ID"
+	// @Success 200 {object} models.SubscribeForm
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 404 {object} map[string]string "Not found"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/subscribe-forms/{id} [get]
+	subscribeFormGroup.GET("/:id", subscribeFormController.Get)
+
+	// Protected subscribe form routes
+	subscribeFormWriteGroup := subscribeFormGroup.Group("")
+	subscribeFormWriteGroup.Use(middleware.RequirePermissions(db, "subscribe_forms:write"))
+	// @Summary Create subscribe form
+	// @Description Create a new subscribe form
+	// @Accept json
+	// @Produce json
+	// @Param subscribeForm body models.SubscribeForm true "Subscribe form object"
+	// @Success 201 {object} models.SubscribeForm
+	// @Failure 400 {object} map[string]string "Bad request"
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/subscribe-forms [post]
+	subscribeFormWriteGroup.POST("", subscribeFormController.Create)
+	// @Summary Update subscribe form
+	// @Description Update an existing subscribe form
+	// @Accept json
+	// @Produce json
+	// @Param id path string true "Subscribe form ID"
+	// @Param subscribeForm body models.SubscribeForm true "Subscribe form object"
+	// @Success 200 {object} models.SubscribeForm
+	// @Failure 400 {object} map[string]string "Bad request"
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 404 {object} map[string]string "Not found"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/subscribe-forms/{id} [put]
+	subscribeFormWriteGroup.PUT("/:id", subscribeFormController.Update)
+	// @Summary Delete subscribe form
+	// @Description Delete a subscribe form
+	// @Accept json
+	// @Produce json
+	// @Param id path string true "Subscribe form ID"
+	// @Success 204 "No content"
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 404 {object} map[string]string "Not found"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/subscribe-forms/{id} [delete]
+	subscribeFormWriteGroup.DELETE("/:id", subscribeFormController.Delete)
+
+	// Lead scoring rules with team-specific permissions
+	leadScoringRuleService := services.NewBaseService(db, models.LeadScoringRule{})
+	leadScoringRuleController := controllers.NewBaseController(leadScoringRuleService, controllers.ListFields{
+		Sort:   []string{"name", "points"},
+		Filter: []string{"isActive", "event"},
+	})
+	leadScoringRuleGroup := g.Group("/lead-scoring-rules")
+	leadScoringRuleGroup.Use(middleware.RequirePermissions(db, "lead_scoring_rules:read"))
+	// @Summary List lead scoring rules
+	// @Description Get a list of all lead scoring rules
+	// @Accept json
+	// @Produce json
+	// @Param limit query int false "Page size, at most 100"
+	// @Param cursor query string false "nextCursor of the previous page"
+	// @Param sort query string false "Field and direction, e.g. createdAt:desc"
+	// @Param filter[field] query string false "Only rows where the whitelisted field equals the value"
+	// @Success 200 {array} models.LeadScoringRule
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/lead-scoring-rules [get]
+	leadScoringRuleGroup.GET("", leadScoringRuleController.List)
+	// @Summary Get lead scoring rule
+	// @Description Get a lead scoring rule by ID
+	// @Accept json
+	// @Produce json
+	// @Param id path string true "Lead scoring rule ID"
+	// @Success 200 {object} models.LeadScoringRule
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 404 {object} map[string]string "Not found"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/lead-scoring-rules/{id} [get]
+	leadScoringRuleGroup.GET("/:id", leadScoringRuleController.Get)
+
+	// Protected lead scoring rule routes
+	leadScoringRuleWriteGroup := leadScoringRuleGroup.Group("")
+	leadScoringRuleWriteGroup.Use(middleware.RequirePermissions(db, "lead_scoring_rules:write"))
+	// @Summary Create lead scoring rule
+	// @Description Create a new lead scoring rule
+	// @Accept json
+	// @Produce json
+	// @Param leadScoringRule body models.LeadScoringRule true "Lead scoring rule object"
+	// @Success 201 {object} models.LeadScoringRule
+	// @Failure 400 {object} map[string]string "Bad request"
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/lead-scoring-rules [post]
+	leadScoringRuleWriteGroup.POST("", leadScoringRuleController.Create)
+	// @Summary Update lead scoring rule
+	// @Description Update an existing lead scoring rule
+	// @Accept json
+	// @Produce json
+	// @Param id path string true "Lead scoring rule ID"
+	// @Param leadScoringRule body models.LeadScoringRule true "Lead scoring rule object"
+	// @Success 200 {object} models.LeadScoringRule
+	// @Failure 400 {object} map[string]string "Bad request"
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 404 {object} map[string]string "Not found"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/lead-scoring-rules/{id} [put]
+	leadScoringRuleWriteGroup.PUT("/:id", leadScoringRuleController.Update)
+	// @Summary Delete lead scoring rule
+	// @Description Delete a lead scoring rule
+	// @Accept json
+	// @Produce json
+	// @Param id path string true "Lead scoring rule ID"
+	// @Success 204 "No content"
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 404 {object} map[string]string "Not found"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/lead-scoring-rules/{id} [delete]
+	leadScoringRuleWriteGroup.DELETE("/:id", leadScoringRuleController.Delete)
+
+	// Snippets with team-specific permissions
+	snippetService := services.NewBaseService(db, models.Snippet{})
+	snippetController := controllers.NewBaseController(snippetService, controllers.ListFields{
+		Sort:   []string{"name"},
+		Filter: []string{"name"},
+	})
+	snippetGroup := g.Group("/snippets")
+	snippetGroup.Use(middleware.RequirePermissions(db, "snippets:read"))
+	// @Summary List snippets
+	// @Description Get a list of all snippets
+	// @Accept json
+	// @Produce json
+	// @Param limit query int false "Page size, at most 100"
+	// @Param cursor query string false "nextCursor of the previous page"
+	// @Param sort query string false "Field and direction, e.g. createdAt:desc"
+	// @Param filter[field] query string false "Only rows where the whitelisted field equals the value"
+	// @Success 200 {array} models.Snippet
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/snippets [get]
+	snippetGroup.GET("", snippetController.List)
+	// @Summary Get snippet
+	// @Description Get a snippet by ID
+	// @Accept json
+	// @Produce json
+	// @Param id path string true "Snippet ID"
+	// @Success 200 {object} models.Snippet
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 404 {object} map[string]string "Not found"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/snippets/{id} [get]
+	snippetGroup.GET("/:id", snippetController.Get)
+
+	// Protected snippet routes
+	snippetWriteGroup := snippetGroup.Group("")
+	snippetWriteGroup.Use(middleware.RequirePermissions(db, "snippets:write"))
+	// @Summary Create snippet
+	// @Description Create a new snippet, included in templates as {{> name}} and resolved whenever an email is rendered
+	// @Accept json
+	// @Produce json
+	// @Param snippet body models.Snippet true "Snippet object"
+	// @Success 201 {object} models.Snippet
+	// @Failure 400 {object} map[string]string "Bad request"
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/snippets [post]
+	snippetWriteGroup.POST("", snippetController.Create)
+	// @Summary Update snippet
+	// @Description Update an existing snippet
+	// @Accept json
+	// @Produce json
+	// @Param id path string true "Snippet ID"
+	// @Param snippet body models.Snippet true "Snippet object"
+	// @Success 200 {object} models.Snippet
+	// @Failure 400 {object} map[string]string "Bad request"
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 404 {object} map[string]string "Not found"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/snippets/{id} [put]
+	snippetWriteGroup.PUT("/:id", snippetController.Update)
+	// @Summary Delete snippet
+	// @Description Delete a snippet
+	// @Accept json
+	// @Produce json
+	// @Param id path string true "Snippet ID"
+	// @Success 204 "No content"
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 404 {object} map[string]string "Not found"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/snippets/{id} [delete]
+	snippetWriteGroup.DELETE("/:id", snippetController.Delete)
+
+	// SMS configs with team-specific permissions
+	smsConfigService := services.NewBaseService(db, models.SMSConfig{})
+	smsConfigController := controllers.NewBaseController(smsConfigService, controllers.ListFields{
+		Sort:   []string{"name"},
+		Filter: []string{"isActive", "isDefault", "provider"},
+	})
+	smsConfigGroup := g.Group("/sms-configs")
+	smsConfigGroup.Use(middleware.RequirePermissions(db, "sms_configs:read"))
+	// @Summary List SMS configs
+	// @Description Get a list of all SMS configs
+	// @Accept json
+	// @Produce json
+	// @Param limit query int false "Page size, at most 100"
+	// @Param cursor query string false "nextCursor of the previous page"
+	// @Param sort query string false "Field and direction, e.g. createdAt:desc"
+	// @Param filter[field] query string false "Only rows where the whitelisted field equals the value"
+	// @Success 200 {array} models.SMSConfig
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/sms-configs [get]
+	smsConfigGroup.GET("", smsConfigController.List)
+	// @Summary Get SMS config
+	// @Description Get an SMS config by ID
+	// @Accept json
+	// @Produce json
+	// @Param id path string true "SMS config ID"
+	// @Success 200 {object} models.SMSConfig
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 404 {object} map[string]string "Not found"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/sms-configs/{id} [get]
+	smsConfigGroup.GET("/:id", smsConfigController.Get)
+
+	// Protected SMS config routes
+	smsConfigWriteGroup := smsConfigGroup.Group("")
+	smsConfigWriteGroup.Use(middleware.RequirePermissions(db, "sms_configs:write"))
+	// @Summary Create SMS config
+	// @Description Create a new SMS channel, sending through Twilio or the team's own webhook gateway
+	// @Accept json
+	// @Produce json
+	// @Param smsConfig body models.SMSConfig true "SMS config object"
+	// @Success 201 {object} models.SMSConfig
+	// @Failure 400 {object} map[string]string "Bad request"
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/sms-configs [post]
+	smsConfigWriteGroup.POST("", smsConfigController.Create)
+	// @Summary Update SMS config
+	// @Description Update an existing SMS config
+	// @Accept json
+	// @Produce json
+	// @Param id path string true "SMS config ID"
+	// @Param smsConfig body models.SMSConfig true "SMS config object"
+	// @Success 200 {object} models.SMSConfig
+	// @Failure 400 {object} map[string]string "Bad request"
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 404 {object} map[string]string "Not found"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/sms-configs/{id} [put]
+	smsConfigWriteGroup.PUT("/:id", smsConfigController.Update)
+	// @Summary Delete SMS config
+	// @Description Delete an SMS config
+	// @Accept json
+	// @Produce json
+	// @Param id path string true "SMS config ID"
+	// @Success 204 "No content"
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 404 {object} map[string]string "Not found"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/sms-configs/{id} [delete]
+	smsConfigWriteGroup.DELETE("/:id", smsConfigController.Delete)
+
+	// SMS fallback rules with team-specific permissions
+	smsFallbackRuleService := services.NewBaseService(db, models.SMSFallbackRule{})
+	smsFallbackRuleController := controllers.NewBaseController(smsFallbackRuleService, controllers.ListFields{
+		Sort:    []string{"createdAt"},
+		Filter:  []string{"isActive", "categoryId", "smsConfigId"},
+		Include: []string{"Category"},
+	})
+	smsFallbackRuleGroup := g.Group("/sms-fallback-rules")
+	smsFallbackRuleGroup.Use(middleware.RequirePermissions(db, "sms_fallback_rules:read"))
+	// @Summary List SMS fallback rules
+	// @Description Get a list of all SMS fallback rules
+	// @Accept json
+	// @Produce json
+	// @Param limit query int false "Page size, at most 100"
+	// @Param cursor query string false "nextCursor of the previous page"
+	// @Param sort query string false "Field and direction, e.g. createdAt:desc"
+	// @Param filter[field] query string false "Only rows where the whitelisted field equals the value"
+	// @Success 200 {array} models.SMSFallbackRule
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/sms-fallback-rules [get]
+	smsFallbackRuleGroup.GET("", smsFallbackRuleController.List)
+	// @Summary Get SMS fallback rule
+	// @Description Get an SMS fallback rule by ID
+	// @Accept json
+	// @Produce json
+	// @Param id path string true "SMS fallback rule ID"
+	// @Success 200 {object} models.SMSFallbackRule
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 404 {object} map[string]string "Not found"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/sms-fallback-rules/{id} [get]
+	smsFallbackRuleGroup.GET("/:id", smsFallbackRuleController.Get)
+
+	// Protected SMS fallback rule routes
+	smsFallbackRuleWriteGroup := smsFallbackRuleGroup.Group("")
+	smsFallbackRuleWriteGroup.Use(middleware.RequirePermissions(db, "sms_fallback_rules:write"))
+	// @Summary Create SMS fallback rule
+	// @Description Create a rule texting contacts the transactional emails of a category that hard bounce
+	// @Accept json
+	// @Produce json
+	// @Param smsFallbackRule body models.SMSFallbackRule true "SMS fallback rule object"
+	// @Success 201 {object} models.SMSFallbackRule
+	// @Failure 400 {object} map[string]string "Bad request"
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/sms-fallback-rules [post]
+	smsFallbackRuleWriteGroup.POST("", smsFallbackRuleController.Create)
+	// @Summary Update SMS fallback rule
+	// @Description Update an existing SMS fallback rule
+	// @Accept json
+	// @Produce json
+	// @Param id path string true "SMS fallback rule ID"
+	// @Param smsFallbackRule body models.SMSFallbackRule true "SMS fallback rule object"
+	// @Success 200 {object} models.SMSFallbackRule
+	// @Failure 400 {object} map[string]string "Bad request"
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 404 {object} map[string]string "Not found"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/sms-fallback-rules/{id} [put]
+	smsFallbackRuleWriteGroup.PUT("/:id", smsFallbackRuleController.Update)
+	// @Summary Delete SMS fallback rule
+	// @Description Delete an SMS fallback rule
+	// @Accept json
+	// @Produce json
+	// @Param id path string true "SMS fallback rule ID"
+	// @Success 204 "No content"
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 404 {object} map[string]string "Not found"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/sms-fallback-rules/{id} [delete]
+	smsFallbackRuleWriteGroup.DELETE("/:id", smsFallbackRuleController.Delete)
+
+	// Fallback texts sent in place of bounced emails, read-only
+	smsMessageService := services.NewBaseService(db, models.SMSMessage{})
+	smsMessageController := controllers.NewBaseController(smsMessageService, controllers.ListFields{
+		Sort:   []string{"createdAt", "sentAt"},
+		Filter: []string{"emailId", "contactId", "status"},
+	})
+	smsMessageGroup := g.Group("/sms-messages")
+	smsMessageGroup.Use(middleware.RequirePermissions(db, "sms_messages:read"))
+	// @Summary List SMS messages
+	// @Description Get a list of the fallback texts sent in place of hard bounced emails
+	// @Accept json
+	// @Produce json
+	// @Param limit query int false "Page size, at most 100"
+	// @Param cursor query string false "nextCursor of the previous page"
+	// @Param sort query string false "Field and direction, e.g. createdAt:desc"
+	// @Param filter[field] query string false "Only rows where the whitelisted field equals the value"
+	// @Success 200 {array} models.SMSMessage
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/sms-messages [get]
+	smsMessageGroup.GET("", smsMessageController.List)
+	// @Summary Get SMS message
+	// @Description Get an SMS message by ID
+	// @Accept json
+	// @Produce json
+	// @Param id path string true "SMS message ID"
+	// @Success 200 {object} models.SMSMessage
+	// @Failure 401 {object} map[string]string "Unauthorized"
+	// @Failure 403 {object} map[string]string "Forbidden"
+	// @Failure 404 {object} map[string]string "Not found"
+	// @Failure 500 {object} map[string]string "Internal server error"
+	// @Router /api/v1/sms-messages/{id} [get]
+	smsMessageGroup.GET("/:id", smsMessageController.Get)
 }
@@ -34,6 +34,8 @@ func (s *Server) registerRoutes() {
 		return c.File("public/build-info.txt")
 	})
 
+	routes.SetupStoredFileRoutes(s.echo)
+
 	// API v1 group
 	api := s.echo.Group("/api/v1")
 	auth := middleware.NewAuthMiddleware(s.config.JWT.Secret)
@@ -44,5 +46,5 @@ func (s *Server) registerRoutes() {
 	// @Description Register CRUD routes for all models
 	registry.RegisterCRUDRoutes(api, s.db)
 
-	routes.SetupUploadRoutes(api, s.config)
+	routes.SetupUploadRoutes(api, s.config, s.db)
 }
@@ -45,24 +45,33 @@ func NewServer(cfg *config.Config, db *gorm.DB) *Server {
 	// Create custom validator
 	e.Validator = validator.NewValidator()
 
+	// API keys may only use routes that check their permissions
+	e.OnAddRouteHandler = middleware.TrackGuardedRoutes
+
 	// Configure middleware
 	e.Use(echomiddleware.Logger())
 	e.Use(echomiddleware.Recover())
 	e.Use(echomiddleware.CORSWithConfig(echomiddleware.CORSConfig{
 		AllowOrigins: []string{"*"},
 		AllowMethods: []string{http.MethodGet, http.MethodPut, http.MethodPost, http.MethodDelete, http.MethodOptions},
-		AllowHeaders: []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept, echo.HeaderAuthorization, echo.HeaderContentLength},
+		AllowHeaders: []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept, echo.HeaderAuthorization, echo.HeaderContentLength, "X-Embed-Token"},
 	}))
 	e.Use(echomiddleware.RequestID())
 	e.Use(echomiddleware.Secure())
+	// Streams stay open and flush as they go, so they're neither timed out nor buffered for gzip
 	e.Use(echomiddleware.TimeoutWithConfig(echomiddleware.TimeoutConfig{
+		Skipper: isStreamRequest,
 		Timeout: 30 * time.Second,
 	}))
 	e.Use(echomiddleware.GzipWithConfig(echomiddleware.GzipConfig{
-		Level: 5,
+		Skipper: isStreamRequest,
+		Level:   5,
 	}))
 	e.Use(echomiddleware.BodyLimit("10M"))
 
+	// Mutating calls of team members and API keys go to the audit log
+	e.Use(middleware.AuditLog(db))
+
 	// Custom error handler
 	e.HTTPErrorHandler = customHTTPErrorHandler
 
@@ -87,8 +96,11 @@ func NewServer(cfg *config.Config, db *gorm.DB) *Server {
 	}
 
 	// Initialize Redis client for rate limiting
-	redisClient, redisErr := utils.NewRedisClient(cfg)
-	if redisErr != nil {
+	if cfg.Redis.UsesEmbeddedQueue() {
+		// A single server without Redis limits and keeps maintenance mode in memory
+		e.Use(echomiddleware.RateLimiter(echomiddleware.NewRateLimiterMemoryStore(rate.Limit(20))))
+		e.Use(middleware.Maintenance(nil))
+	} else if redisClient, redisErr := utils.NewRedisClient(cfg); redisErr != nil {
 		log.Warn("Warning: Failed to initialize Redis client for rate limiting: %v", redisErr)
 		// Fall back to basic rate limiting without Redis
 		e.Use(echomiddleware.RateLimiter(echomiddleware.NewRateLimiterMemoryStore(rate.Limit(20))))
@@ -97,6 +109,9 @@ func NewServer(cfg *config.Config, db *gorm.DB) *Server {
 		rateLimitConfig := middleware.CreateDefaultRateLimitConfig(redisClient.Client)
 		e.Use(middleware.RateLimiter(rateLimitConfig))
 		log.Success("Successfully configured rate limiting with Redis")
+
+		// Writes are refused while platform operators run maintenance
+		e.Use(middleware.Maintenance(redisClient.Client))
 	}
 
 	// Create a new GORM integrator
@@ -143,9 +158,40 @@ func NewServer(cfg *config.Config, db *gorm.DB) *Server {
 	// Register routes
 	s.registerRoutes()
 	routes.SetupImportRoutes(s.echo, s.db, s.config)
+	routes.SetupContactRoutes(s.echo, s.config, s.db)
+	routes.SetupContactSyncRoutes(s.echo, s.config, s.db)
 	routes.SetupSMTPRoutes(s.echo, s.config, s.db)
+	routes.SetupListHeadersRoutes(s.echo, s.config, s.db)
+	routes.SetupRetentionRoutes(s.echo, s.config, s.db)
 	routes.SetupEMAILRoutes(s.echo, s.config, s.db)
+	routes.SetupMailMergeRoutes(s.echo, s.config, s.db)
+	routes.SetupCampaignRoutes(s.echo, s.config, s.db)
+	routes.SetupSegmentRoutes(s.echo, s.config, s.db)
+	routes.SetupBlackoutRoutes(s.echo, s.config, s.db)
+	routes.SetupDomainRoutes(s.echo, s.config, s.db)
+	routes.SetupAlertRoutes(s.echo, s.config, s.db)
+	routes.SetupContentBlockRoutes(s.echo, s.config, s.db)
+	routes.SetupScoringRoutes(s.echo, s.config, s.db)
+	routes.SetupSenderPersonaRoutes(s.echo, s.config, s.db)
+	routes.SetupConfigRoutes(s.echo, s.config, s.db)
+	routes.SetupTemplateRoutes(s.echo, s.config, s.db)
+	routes.SetupAutomationRoutes(s.echo, s.config, s.db)
+	routes.SetupQueueRoutes(s.echo, s.config, s.db)
+	routes.SetupWorkspaceRoutes(s.echo, s.config, s.db)
+	routes.SetupAPIKeyRoutes(s.echo, s.config, s.db)
+	routes.SetupUsageRoutes(s.echo, s.config, s.db)
+	routes.SetupEmbedTokenRoutes(s.echo, s.config, s.db)
+	routes.SetupReportShareRoutes(s.echo, s.config, s.db)
+	routes.SetupSubscribeFormRoutes(s.echo, s.config, s.db)
+	routes.SetupChangelogRoutes(s.echo, s.config, s.db)
+	routes.SetupFeatureFlagRoutes(s.echo, s.config, s.db)
+	routes.SetupOnboardingRoutes(s.echo, s.config, s.db)
 	routes.SetupIMAPRoutes(s.echo, s.config, s.db)
+	routes.SetupInboxRoutes(s.echo, s.config, s.db)
+	routes.SetupSignatureRoutes(s.echo, s.config, s.db)
+	routes.SetupAuditLogRoutes(s.echo, s.config, s.db)
+	routes.SetupRoleRoutes(s.echo, s.config, s.db)
+	routes.SetupOAuthRoutes(s.echo, s.config, s.db)
 	routes.RegisterTrackingRoutes(s.echo, trackingHandler, s.config, s.db)
 	return s
 }
@@ -158,6 +204,11 @@ func (s *Server) Shutdown(ctx context.Context) error {
 	return s.echo.Shutdown(ctx)
 }
 
+// isStreamRequest reports whether the request is for a server-sent event stream
+func isStreamRequest(c echo.Context) bool {
+	return c.Path() == "/api/v1/analytics/stream"
+}
+
 // Health check endpoint
 func (s *Server) healthCheck(c echo.Context) error {
 	return c.JSON(http.StatusOK, map[string]interface{}{
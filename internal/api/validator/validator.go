@@ -3,6 +3,7 @@ package validator
 import (
 	"errors"
 	"fmt"
+	"kori/internal/models"
 	"reflect"
 	"strings"
 	"time"
@@ -49,6 +50,10 @@ func NewValidator() echo.Validator {
 	if err != nil {
 		return nil
 	}
+	err = v.RegisterValidation("email_list", validateEmailList)
+	if err != nil {
+		return nil
+	}
 
 	return &CustomValidator{validator: v}
 }
@@ -81,6 +86,12 @@ func validateCampaignStatus(fl playgroundvalidator.FieldLevel) bool {
 	return status == "DRAFT" || status == "SCHEDULED" || status == "RUNNING" || status == "COMPLETED" || status == "FAILED"
 }
 
+// validateEmailList accepts a comma separated list of email addresses, as used for CC and BCC
+func validateEmailList(fl playgroundvalidator.FieldLevel) bool {
+	_, err := models.ParseRecipientList(fl.Field().String())
+	return err == nil
+}
+
 // Validate implements echo.Validator interface
 func (cv *CustomValidator) Validate(i interface{}) error {
 	if err := cv.validator.Struct(i); err != nil {
@@ -149,7 +160,7 @@ type MailingListRequest struct {
 }
 
 type SMTPConfigRequest struct {
-	Provider     string `json:"provider" validate:"required,oneof=CUSTOM GMAIL OUTLOOK AMAZON"`
+	Provider     string `json:"provider" validate:"required,oneof=CUSTOM GMAIL OUTLOOK AMAZON SENDGRID MAILGUN POSTMARK"`
 	Host         string `json:"host" validate:"required,hostname"`
 	Port         int    `json:"port" validate:"required,min=1,max=65535"`
 	Username     string `json:"username" validate:"required,email"`
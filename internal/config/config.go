@@ -6,6 +6,7 @@ import (
 	"os"
 	"strconv"
 	"sync"
+	"time"
 )
 
 // Config holds all configuration for the application
@@ -21,6 +22,46 @@ type Config struct {
 	SMTP     SMTPConfig
 	Monitor  MonitorConfig
 	Airley   AirleyConfig
+	Domain   DomainConfig
+	LLM      LLMConfig
+	SLA      SLAConfig
+	OAuth    OAuthConfig
+	Hooks    HooksConfig
+}
+
+// LLMConfig holds the provider credentials the email writer generates copy with
+type LLMConfig struct {
+	OpenAIAPIKey     string
+	OpenAIBaseURL    string
+	AnthropicAPIKey  string
+	AnthropicBaseURL string
+	MaxTokens        int
+}
+
+// DomainConfig holds the DNS values sending domains are verified against
+type DomainConfig struct {
+	SPFInclude    string
+	TrackingCNAME string // what custom tracking domains must point at, the public URL's host when empty
+}
+
+// OAuthConfig holds the OAuth2 clients mailboxes are connected to Gmail and Outlook with
+type OAuthConfig struct {
+	GoogleClientID        string
+	GoogleClientSecret    string
+	MicrosoftClientID     string
+	MicrosoftClientSecret string
+	MicrosoftTenant       string // common for any work, school or personal account
+}
+
+// HooksConfig holds the URLs called at lifecycle points so self-hosted servers can validate
+// or enrich emails, contacts and campaigns without changing the code
+type HooksConfig struct {
+	BeforeEmailSendURL        string
+	AfterContactCreateURL     string
+	BeforeCampaignScheduleURL string
+	Secret                    string        // signs the requests like webhook deliveries
+	Timeout                   time.Duration // per request
+	FailOpen                  bool          // go ahead when a hook URL can't be reached rather than fail
 }
 
 type CryptoConfig struct {
@@ -52,12 +93,19 @@ type StorageConfig struct {
 	S3       S3Config
 }
 
+// UsesFilesystem reports whether files are kept under BasePath and served by the API rather
+// than in S3: the provider is local or filesystem and no bucket is configured
+func (s StorageConfig) UsesFilesystem() bool {
+	return (s.Provider == "local" || s.Provider == "filesystem") && s.S3.BucketName == ""
+}
+
+// S3Config is only used when a bucket is configured; without one files are kept on disk
 type S3Config struct {
-	BucketName string `env:"S3_BUCKET_NAME" required:"true"`
+	BucketName string `env:"S3_BUCKET_NAME"`
 	Endpoint   string `env:"S3_ENDPOINT"`
-	Region     string `env:"S3_REGION" required:"true"`
-	AccessKey  string `env:"S3_ACCESS_KEY" required:"true"`
-	SecretKey  string `env:"S3_SECRET_KEY" required:"true"`
+	Region     string `env:"S3_REGION"`
+	AccessKey  string `env:"S3_ACCESS_KEY"`
+	SecretKey  string `env:"S3_SECRET_KEY"`
 }
 
 type SMTPConfig struct {
@@ -72,6 +120,9 @@ type SMTPConfig struct {
 type WorkerConfig struct {
 	Concurrency int
 	QueueSize   int
+	// Per-team in-flight caps so one team's sends can't take every worker
+	TeamEmailLimit    int
+	TeamCampaignLimit int
 }
 
 type RedisConfig struct {
@@ -81,14 +132,32 @@ type RedisConfig struct {
 	DB       int
 }
 
+// UsesEmbeddedQueue reports whether tasks are queued in Postgres and run in this process rather
+// than through Redis: REDIS_HOST is set and empty
+func (r RedisConfig) UsesEmbeddedQueue() bool {
+	return r.Addr == ""
+}
+
 type MonitorConfig struct {
 	DiscordWebhookURL string
 }
 
+// SLAConfig holds the email pipeline's delivery targets. A queue or SMTP config whose p95
+// enqueue to delivered latency goes over its queue's target raises an alert.
+type SLAConfig struct {
+	CriticalDeliveryP95 time.Duration // transactional mail, e.g. password resets
+	DefaultDeliveryP95  time.Duration // campaign mail
+	Window              time.Duration // how far back each check looks
+	MinEmails           int           // fewer deliveries in the window aren't judged
+}
+
 type AirleyConfig struct {
 	Enabled bool
 }
 
+// defaultSPFInclude is the SPF include sending domains must reference
+const defaultSPFInclude = "_spf.posthoot.com"
+
 var (
 	config *Config
 	once   sync.Once
@@ -100,6 +169,9 @@ func GetConfig() *Config {
 		config = &Config{}
 		config.JWT.Secret = os.Getenv("JWT_SECRET")
 		config.Server.PublicURL = os.Getenv("PUBLIC_URL")
+		config.Domain.SPFInclude = getEnv("DOMAIN_SPF_INCLUDE", defaultSPFInclude)
+		config.Domain.TrackingCNAME = os.Getenv("DOMAIN_TRACKING_CNAME")
+		config.OAuth = loadOAuthConfig()
 	})
 	return config
 }
@@ -136,9 +208,12 @@ func Load() (*Config, error) {
 		Worker: WorkerConfig{
 			Concurrency: getEnvAsInt("WORKER_CONCURRENCY", 5),
 			QueueSize:   getEnvAsInt("WORKER_QUEUE_SIZE", 100),
+			// Out of the 10 task workers
+			TeamEmailLimit:    getEnvAsInt("WORKER_TEAM_EMAIL_LIMIT", 4),
+			TeamCampaignLimit: getEnvAsInt("WORKER_TEAM_CAMPAIGN_LIMIT", 1),
 		},
 		Redis: RedisConfig{
-			Addr:     fmt.Sprintf("%s:%d", getEnv("REDIS_HOST", "localhost"), getEnvAsInt("REDIS_PORT", 6379)),
+			Addr:     redisAddr(),
 			Password: getEnv("REDIS_PASSWORD", ""),
 			Username: getEnv("REDIS_USERNAME", ""),
 			DB:       getEnvAsInt("REDIS_DB", 0),
@@ -160,11 +235,56 @@ func Load() (*Config, error) {
 		Airley: AirleyConfig{
 			Enabled: getEnvAsBool("AIRLEY_ENABLED", false),
 		},
+		Domain: DomainConfig{
+			SPFInclude:    getEnv("DOMAIN_SPF_INCLUDE", defaultSPFInclude),
+			TrackingCNAME: os.Getenv("DOMAIN_TRACKING_CNAME"),
+		},
+		SLA: SLAConfig{
+			CriticalDeliveryP95: time.Duration(getEnvAsInt("SLA_CRITICAL_P95_SECONDS", 10)) * time.Second,
+			DefaultDeliveryP95:  time.Duration(getEnvAsInt("SLA_DEFAULT_P95_SECONDS", 900)) * time.Second,
+			Window:              time.Duration(getEnvAsInt("SLA_WINDOW_MINUTES", 15)) * time.Minute,
+			MinEmails:           getEnvAsInt("SLA_MIN_EMAILS", 20),
+		},
+		LLM: LLMConfig{
+			OpenAIAPIKey:     getEnv("OPENAI_API_KEY", ""),
+			OpenAIBaseURL:    getEnv("OPENAI_BASE_URL", "https://api.openai.com/v1"),
+			AnthropicAPIKey:  getEnv("ANTHROPIC_API_KEY", ""),
+			AnthropicBaseURL: getEnv("ANTHROPIC_BASE_URL", "https://api.anthropic.com/v1"),
+			MaxTokens:        getEnvAsInt("LLM_MAX_TOKENS", 2048),
+		},
+		OAuth: loadOAuthConfig(),
+		Hooks: HooksConfig{
+			BeforeEmailSendURL:        getEnv("HOOK_BEFORE_EMAIL_SEND_URL", ""),
+			AfterContactCreateURL:     getEnv("HOOK_AFTER_CONTACT_CREATE_URL", ""),
+			BeforeCampaignScheduleURL: getEnv("HOOK_BEFORE_CAMPAIGN_SCHEDULE_URL", ""),
+			Secret:                    getEnv("HOOKS_SECRET", ""),
+			Timeout:                   time.Duration(getEnvAsInt("HOOKS_TIMEOUT_SECONDS", 5)) * time.Second,
+			FailOpen:                  getEnvAsBool("HOOKS_FAIL_OPEN", false),
+		},
 	}
 
 	return cfg, nil
 }
 
+func loadOAuthConfig() OAuthConfig {
+	return OAuthConfig{
+		GoogleClientID:        getEnv("GOOGLE_OAUTH_CLIENT_ID", ""),
+		GoogleClientSecret:    getEnv("GOOGLE_OAUTH_CLIENT_SECRET", ""),
+		MicrosoftClientID:     getEnv("MICROSOFT_OAUTH_CLIENT_ID", ""),
+		MicrosoftClientSecret: getEnv("MICROSOFT_OAUTH_CLIENT_SECRET", ""),
+		MicrosoftTenant:       getEnv("MICROSOFT_OAUTH_TENANT", "common"),
+	}
+}
+
+// redisAddr is where Redis listens, or empty when REDIS_HOST is set empty to run without it
+func redisAddr() string {
+	host := getEnv("REDIS_HOST", "localhost")
+	if host == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s:%d", host, getEnvAsInt("REDIS_PORT", 6379))
+}
+
 func getEnv(key, defaultValue string) string {
 	if value, exists := os.LookupEnv(key); exists {
 		return value
@@ -66,7 +66,7 @@ func sendToDiscord(stats sql.DBStats) error {
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("Discord API returned status code: %d for message: %s", resp.StatusCode)
+		return fmt.Errorf("Discord API returned status code: %d for message: %s", resp.StatusCode, message)
 	}
 
 	return nil
@@ -153,21 +153,64 @@ func runMigrations() error {
 		&models.MailingList{},
 		&models.SMTPConfig{},
 		&models.Domain{},
+		&models.TrackingDomain{},
 		&models.Webhook{},
 		&models.Template{},
+		&models.TemplateVersion{},
 		&models.APIKey{},
 		&models.TeamInvite{},
 		&models.RateLimit{},
 		&models.AuthTransaction{},
 		&models.Campaign{},
+		&models.BlackoutDate{},
+		&models.AlertRule{},
+		&models.AlertEvent{},
+		&models.CampaignVariant{},
+		&models.CampaignLanguage{},
+		&models.CampaignExclusion{},
+		&models.ContentBlock{},
+		&models.ContentBlockVariant{},
+		&models.ScoringEndpoint{},
+		&models.SenderPersona{},
+		&models.FrequencyCap{},
+		&models.ComputedField{},
+		&models.SubscribeForm{},
+		&models.ChangelogEntry{},
+		&models.ContactPreference{},
+		&models.FeatureFlag{},
+		&models.LeadScoringRule{},
+		&models.ReputationConnector{},
+		&models.ReputationMetric{},
+		&models.Snippet{},
+		&models.IdempotencyKey{},
+		&models.EmailAttachment{},
+		&models.AutomationRun{},
+		&models.AutomationRunStep{},
+		&models.CampaignSnapshot{},
+		&models.WorkspaceDeletion{},
+		&models.OnboardingState{},
+		&models.AnalyticsReport{},
+		&models.EmailStatsHourly{},
+		&models.CampaignStatsDaily{},
+		&models.AnalyticsRollup{},
 
 		// Subscriber models
 		&models.ContactImport{},
+		&models.ContactImportError{},
+		&models.ContactSyncSource{},
+		&models.ContactTimelineExport{},
+		&models.Segment{},
 
 		// Email-related models
 		&models.Email{},
+		&models.CampaignLink{},
 		&models.EmailTracking{},
 		&models.Delivery{},
+		&models.LinkCheck{},
+		&models.TLSReport{},
+		&models.InboxFolder{},
+		&models.InboxConversation{},
+		&models.InboxMessage{},
 
 		// Permission models
 		&models.UserPermission{},
@@ -176,6 +219,17 @@ func runMigrations() error {
 
 		// Usage and monitoring
 		&models.APIKeyUsage{},
+		&models.APIKeyUsageHourly{},
+		&models.IndexRecommendation{},
+		&models.DataSubjectRequest{},
+		&models.Signature{},
+		&models.AuditLog{},
+		&models.SMSConfig{},
+		&models.SMSFallbackRule{},
+		&models.SMSMessage{},
+		&models.Role{},
+		&models.EmbedToken{},
+		&models.ReportShare{},
 
 		// Automation models
 		&models.Automation{},
@@ -187,6 +241,8 @@ func runMigrations() error {
 		&models.Subscription{},
 		&models.Product{},
 		&models.ProductFeatureConfig{},
+		&models.QuotaNotification{},
+		&models.QuotaCounter{},
 
 		// IMAP models
 		&models.IMAPConfig{},
@@ -195,6 +251,11 @@ func runMigrations() error {
 		return err
 	}
 
+	if err := models.MigrateAPIKeySecrets(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
 	return tx.Commit().Error
 }
 
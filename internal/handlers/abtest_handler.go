@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"kori/internal/models"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+type ABTestHandler struct {
+	db *gorm.DB
+}
+
+// ABTestResult is the state of a campaign's A/B test and how each variant is performing
+type ABTestResult struct {
+	CampaignID      string                `json:"campaignId"`
+	Status          models.ABTestStatus   `json:"status"`
+	Metric          models.ABWinnerMetric `json:"metric"`
+	StartedAt       *time.Time            `json:"startedAt,omitempty"`
+	DecidesAt       *time.Time            `json:"decidesAt,omitempty"`
+	WinnerVariantID string                `json:"winnerVariantId,omitempty"`
+	Variants        []models.VariantStats `json:"variants"`
+}
+
+func NewABTestHandler(db *gorm.DB) *ABTestHandler {
+	return &ABTestHandler{db: db}
+}
+
+// GetABTestResults returns per-variant analytics for a campaign's A/B test
+// @Summary Get A/B test results
+// @Description Get the status of a campaign's A/B test and the sent, open and click counts of each variant
+// @Tags campaigns
+// @Produce json
+// @Param id path string true "Campaign ID"
+// @Success 200 {object} ABTestResult
+// @Failure 404 {object} map[string]string "Campaign not found"
+// @Router /api/v1/campaigns/{id}/ab-test [get]
+func (h *ABTestHandler) GetABTestResults(c echo.Context) error {
+	teamID := c.Get("teamID").(string)
+
+	campaign := &models.Campaign{}
+	if err := h.db.Where("id = ? AND team_id = ? AND is_deleted = false", c.Param("id"), teamID).First(campaign).Error; err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "campaign not found")
+	}
+
+	variants, err := models.GetVariantStats(campaign.ID, h.db)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get variant stats")
+	}
+
+	result := ABTestResult{
+		CampaignID:      campaign.ID,
+		Status:          campaign.ABTestStatus,
+		Metric:          campaign.ABWinnerMetric,
+		WinnerVariantID: campaign.ABWinnerVariantID,
+		Variants:        variants,
+	}
+	if !campaign.ABTestStartedAt.IsZero() {
+		decidesAt := campaign.ABTestDeadline()
+		result.StartedAt = &campaign.ABTestStartedAt
+		result.DecidesAt = &decidesAt
+	}
+
+	return c.JSON(http.StatusOK, result)
+}
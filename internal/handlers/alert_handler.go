@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"kori/internal/models"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+type AlertHandler struct {
+	db *gorm.DB
+}
+
+// CampaignAlertStatus is a campaign's current metrics and the alerts it has triggered
+type CampaignAlertStatus struct {
+	CampaignID string                `json:"campaignId"`
+	Status     models.CampaignStatus `json:"status"`
+	Stats      *models.CampaignStats `json:"stats"`
+	Alerts     []models.AlertEvent   `json:"alerts"`
+}
+
+func NewAlertHandler(db *gorm.DB) *AlertHandler {
+	return &AlertHandler{db: db}
+}
+
+// ListAlertEvents lists the alerts fired for the team
+// @Summary List alert events
+// @Description List campaign alerts fired for the team, newest first
+// @Tags alerts
+// @Produce json
+// @Param campaignId query string false "Filter by campaign"
+// @Param ruleId query string false "Filter by alert rule"
+// @Param days query int false "Number of days to include (default 30)"
+// @Success 200 {array} models.AlertEvent
+// @Failure 400 {object} map[string]string "Invalid days"
+// @Router /api/v1/alert-events [get]
+func (h *AlertHandler) ListAlertEvents(c echo.Context) error {
+	teamID := c.Get("teamID").(string)
+
+	days := 30
+	if value := c.QueryParam("days"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid days")
+		}
+		days = parsed
+	}
+
+	query := h.db.Preload("Rule").
+		Where("team_id = ? AND triggered_at >= ? AND is_deleted = false", teamID, time.Now().AddDate(0, 0, -days))
+	if campaignID := c.QueryParam("campaignId"); campaignID != "" {
+		query = query.Where("campaign_id = ?", campaignID)
+	}
+	if ruleID := c.QueryParam("ruleId"); ruleID != "" {
+		query = query.Where("rule_id = ?", ruleID)
+	}
+
+	var alerts []models.AlertEvent
+	if err := query.Order("triggered_at DESC").Find(&alerts).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get alert events")
+	}
+
+	return c.JSON(http.StatusOK, alerts)
+}
+
+// GetCampaignAlertStatus returns the metrics alert rules are evaluated against for a campaign
+// @Summary Get campaign alert status
+// @Description Get a campaign's current open, click, bounce, complaint and unsubscribe counts and its fired alerts
+// @Tags alerts
+// @Produce json
+// @Param id path string true "Campaign ID"
+// @Success 200 {object} CampaignAlertStatus
+// @Failure 404 {object} map[string]string "Campaign not found"
+// @Router /api/v1/campaigns/{id}/alerts [get]
+func (h *AlertHandler) GetCampaignAlertStatus(c echo.Context) error {
+	teamID := c.Get("teamID").(string)
+
+	campaign := &models.Campaign{}
+	if err := h.db.Where("id = ? AND team_id = ? AND is_deleted = false", c.Param("id"), teamID).First(campaign).Error; err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "campaign not found")
+	}
+
+	stats, err := models.GetCampaignStats(campaign.ID, h.db)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get campaign stats")
+	}
+
+	var alerts []models.AlertEvent
+	if err := h.db.Preload("Rule").Where("campaign_id = ? AND is_deleted = false", campaign.ID).
+		Order("triggered_at DESC").Find(&alerts).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get alert events")
+	}
+
+	return c.JSON(http.StatusOK, CampaignAlertStatus{
+		CampaignID: campaign.ID,
+		Status:     campaign.Status,
+		Stats:      stats,
+		Alerts:     alerts,
+	})
+}
@@ -0,0 +1,360 @@
+package handlers
+
+import (
+	"errors"
+	"kori/internal/models"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// maxUsageSummaryDays caps how far back an API key usage summary goes
+const maxUsageSummaryDays = 90
+
+type APIKeyHandler struct {
+	db *gorm.DB
+}
+
+func NewAPIKeyHandler(db *gorm.DB) *APIKeyHandler {
+	return &APIKeyHandler{db: db}
+}
+
+// APIKeyRequest is an API key to save. Permissions are resource:action, e.g. emails:send or
+// campaigns:read, where either side can be * and write stands for create, update and delete.
+type APIKeyRequest struct {
+	Name        string     `json:"name" validate:"required,min=2,max=100"`
+	Permissions []string   `json:"permissions" validate:"required,min=1"`
+	ExpiresAt   *time.Time `json:"expiresAt"` // 90 days from creation by default
+}
+
+// APIKeyResponse is a new API key with its secret, which is only ever returned here
+type APIKeyResponse struct {
+	models.APIKey
+	Key string `json:"key"`
+}
+
+// RotateAPIKeyRequest says how long a rotated key keeps working next to its replacement
+type RotateAPIKeyRequest struct {
+	OverlapHours *int `json:"overlapHours" validate:"omitempty,min=0,max=720"` // 24 by default
+}
+
+// ListAPIKeys lists the team's API keys, revoked ones included, by their prefix
+// @Summary List API keys
+// @Tags api-keys
+// @Produce json
+// @Success 200 {object} map[string]interface{} "data holds the keys, total their count"
+// @Router /api/v1/api-keys [get]
+func (h *APIKeyHandler) ListAPIKeys(c echo.Context) error {
+	apiKeys := []models.APIKey{}
+	if err := h.db.Where("team_id = ? AND is_deleted = false", c.Get("teamID").(string)).
+		Preload("Permissions.ResourcePermission").
+		Order("created_at DESC").
+		Find(&apiKeys).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get api keys")
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":  apiKeys,
+		"total": len(apiKeys),
+	})
+}
+
+// GetAPIKey returns one of the team's API keys, without its secret
+// @Summary Get API key
+// @Tags api-keys
+// @Produce json
+// @Param id path string true "API Key ID"
+// @Success 200 {object} models.APIKey
+// @Failure 404 {object} map[string]string "API key not found"
+// @Router /api/v1/api-keys/{id} [get]
+func (h *APIKeyHandler) GetAPIKey(c echo.Context) error {
+	apiKey, err := h.getAPIKey(c, c.Param("id"))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, apiKey)
+}
+
+// CreateAPIKey adds an API key with only the permissions it's given
+// @Summary Create API key
+// @Description Create an API key limited to the permissions given, e.g. only emails:send. Keys can't be given permissions their creator doesn't have. The key is only returned here; later it's known by its prefix.
+// @Tags api-keys
+// @Accept json
+// @Produce json
+// @Param request body APIKeyRequest true "API key"
+// @Success 201 {object} APIKeyResponse
+// @Failure 400 {object} map[string]string "Invalid API key"
+// @Failure 403 {object} map[string]string "Permissions the caller doesn't have"
+// @Router /api/v1/api-keys [post]
+func (h *APIKeyHandler) CreateAPIKey(c echo.Context) error {
+	req, scopes, err := h.bindAPIKey(c)
+	if err != nil {
+		return err
+	}
+
+	apiKey := &models.APIKey{Name: strings.TrimSpace(req.Name), TeamID: c.Get("teamID").(string)}
+	if req.ExpiresAt != nil {
+		apiKey.ExpiresAt = *req.ExpiresAt
+	}
+	secret := apiKey.NewSecret()
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(apiKey).Error; err != nil {
+			return err
+		}
+		return models.SetAPIKeyPermissions(apiKey.ID, scopes, tx)
+	})
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to create api key")
+	}
+
+	created, err := h.getAPIKey(c, apiKey.ID)
+	if err != nil {
+		return err
+	}
+	models.RecordAuditChange(c.Request().Context(), models.AuditActionCreate, "api_keys", created.ID, nil, created)
+
+	return c.JSON(http.StatusCreated, &APIKeyResponse{APIKey: *created, Key: secret})
+}
+
+// UpdateAPIKey renames a key or changes its permissions or expiry
+// @Summary Update API key
+// @Description Change an API key's name, permissions or expiry. The permissions given replace the key's.
+// @Tags api-keys
+// @Accept json
+// @Produce json
+// @Param id path string true "API Key ID"
+// @Param request body APIKeyRequest true "API key"
+// @Success 200 {object} models.APIKey
+// @Failure 400 {object} map[string]string "Invalid API key"
+// @Failure 403 {object} map[string]string "Permissions the caller doesn't have"
+// @Failure 404 {object} map[string]string "API key not found"
+// @Router /api/v1/api-keys/{id} [put]
+func (h *APIKeyHandler) UpdateAPIKey(c echo.Context) error {
+	req, scopes, err := h.bindAPIKey(c)
+	if err != nil {
+		return err
+	}
+	apiKey, err := h.getAPIKey(c, c.Param("id"))
+	if err != nil {
+		return err
+	}
+
+	before := *apiKey
+	updates := map[string]interface{}{"name": strings.TrimSpace(req.Name)}
+	if req.ExpiresAt != nil {
+		updates["expires_at"] = *req.ExpiresAt
+	}
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.APIKey{}).Where("id = ?", apiKey.ID).UpdateColumns(updates).Error; err != nil {
+			return err
+		}
+		return models.SetAPIKeyPermissions(apiKey.ID, scopes, tx)
+	})
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to update api key")
+	}
+
+	updated, err := h.getAPIKey(c, apiKey.ID)
+	if err != nil {
+		return err
+	}
+	models.RecordAuditChange(c.Request().Context(), models.AuditActionUpdate, "api_keys", updated.ID, &before, updated)
+
+	return c.JSON(http.StatusOK, updated)
+}
+
+// RotateAPIKey replaces a key with a new secret
+// @Summary Rotate API key
+// @Description Create a new secret with the key's name, permissions and lifetime, only returned here. The old key keeps working for the overlap, 24 hours by default, so clients can switch over.
+// @Tags api-keys
+// @Accept json
+// @Produce json
+// @Param id path string true "API Key ID"
+// @Param request body RotateAPIKeyRequest true "Overlap, {} for the default"
+// @Success 201 {object} APIKeyResponse
+// @Failure 400 {object} map[string]string "Invalid overlap"
+// @Failure 403 {object} map[string]string "Permissions the caller doesn't have"
+// @Failure 404 {object} map[string]string "API key not found"
+// @Failure 409 {object} map[string]string "API key rotated or revoked already"
+// @Router /api/v1/api-keys/{id}/rotate [post]
+func (h *APIKeyHandler) RotateAPIKey(c echo.Context) error {
+	var req RotateAPIKeyRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request body")
+	}
+	if err := c.Validate(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	overlap := models.DefaultAPIKeyRotationOverlap
+	if req.OverlapHours != nil {
+		overlap = time.Duration(*req.OverlapHours) * time.Hour
+	}
+
+	apiKey, err := h.getAPIKey(c, c.Param("id"))
+	if err != nil {
+		return err
+	}
+	// The new secret has the key's permissions, which the caller must have to hand them out
+	if !callerCovers(c, apiKey.Scopes()) {
+		return echo.NewHTTPError(http.StatusForbidden, "the api key has permissions you don't have")
+	}
+
+	next, secret, err := models.RotateAPIKey(apiKey, overlap, h.db)
+	if err != nil {
+		if errors.Is(err, models.ErrAPIKeyRotated) || errors.Is(err, models.ErrAPIKeyRevoked) {
+			return echo.NewHTTPError(http.StatusConflict, err.Error())
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to rotate api key")
+	}
+
+	rotated, err := h.getAPIKey(c, next.ID)
+	if err != nil {
+		return err
+	}
+	models.RecordAuditChange(c.Request().Context(), models.AuditActionCreate, "api_keys", rotated.ID, nil, rotated)
+
+	return c.JSON(http.StatusCreated, &APIKeyResponse{APIKey: *rotated, Key: secret})
+}
+
+// RevokeAPIKey stops a key working
+// @Summary Revoke API key
+// @Description Stop an API key working straight away, e.g. when it leaked. The key is kept, with its usage, for the record.
+// @Tags api-keys
+// @Produce json
+// @Param id path string true "API Key ID"
+// @Success 200 {object} models.APIKey
+// @Failure 404 {object} map[string]string "API key not found"
+// @Failure 409 {object} map[string]string "API key revoked already"
+// @Router /api/v1/api-keys/{id}/revoke [post]
+func (h *APIKeyHandler) RevokeAPIKey(c echo.Context) error {
+	apiKey, err := h.getAPIKey(c, c.Param("id"))
+	if err != nil {
+		return err
+	}
+
+	before := *apiKey
+	if err := models.RevokeAPIKey(apiKey, h.db); err != nil {
+		if errors.Is(err, models.ErrAPIKeyRevoked) {
+			return echo.NewHTTPError(http.StatusConflict, err.Error())
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to revoke api key")
+	}
+	models.RecordAuditChange(c.Request().Context(), models.AuditActionUpdate, "api_keys", apiKey.ID, &before, apiKey)
+
+	return c.JSON(http.StatusOK, apiKey)
+}
+
+// DeleteAPIKey revokes a key and removes it from the team's keys
+// @Summary Delete API key
+// @Tags api-keys
+// @Param id path string true "API Key ID"
+// @Success 204
+// @Failure 404 {object} map[string]string "API key not found"
+// @Router /api/v1/api-keys/{id} [delete]
+func (h *APIKeyHandler) DeleteAPIKey(c echo.Context) error {
+	apiKey, err := h.getAPIKey(c, c.Param("id"))
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if err := h.db.Model(&models.APIKey{}).Where("id = ?", apiKey.ID).UpdateColumns(map[string]interface{}{
+		"is_deleted": true,
+		"deleted_at": now,
+		"revoked_at": gorm.Expr("COALESCE(revoked_at, ?)", now),
+	}).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to delete api key")
+	}
+	models.RecordAuditChange(c.Request().Context(), models.AuditActionDelete, "api_keys", apiKey.ID, nil, nil)
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// GetUsageSummary summarizes what an API key was used for
+// @Summary Get API key usage summary
+// @Description Requests and errors of an API key per endpoint, per endpoint and UTC day, and for its busiest client addresses, over the last days including today
+// @Tags api-keys
+// @Produce json
+// @Param id path string true "API Key ID"
+// @Param days query int false "Days to cover, 30 by default and at most 90"
+// @Success 200 {object} models.APIKeyUsageSummary
+// @Failure 400 {object} map[string]string "Invalid days"
+// @Failure 404 {object} map[string]string "API key not found"
+// @Router /api/v1/api-keys/{id}/usage-summary [get]
+func (h *APIKeyHandler) GetUsageSummary(c echo.Context) error {
+	teamID := c.Get("teamID").(string)
+
+	days := 30
+	if param := c.QueryParam("days"); param != "" {
+		var err error
+		days, err = strconv.Atoi(param)
+		if err != nil || days < 1 || days > maxUsageSummaryDays {
+			return echo.NewHTTPError(http.StatusBadRequest, "days must be between 1 and 90")
+		}
+	}
+
+	apiKey := &models.APIKey{}
+	if err := h.db.Where("id = ? AND team_id = ? AND is_deleted = false", c.Param("id"), teamID).First(apiKey).Error; err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "api key not found")
+	}
+
+	start := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, 1-days)
+	summary, err := models.GetAPIKeyUsageSummary(apiKey.ID, start, h.db)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to summarize api key usage")
+	}
+
+	return c.JSON(http.StatusOK, summary)
+}
+
+func (h *APIKeyHandler) getAPIKey(c echo.Context, id string) (*models.APIKey, error) {
+	apiKey := &models.APIKey{}
+	if err := h.db.Where("id = ? AND team_id = ? AND is_deleted = false", id, c.Get("teamID").(string)).
+		Preload("Permissions.ResourcePermission").
+		First(apiKey).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, echo.NewHTTPError(http.StatusNotFound, "api key not found")
+		}
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, "failed to get api key")
+	}
+	return apiKey, nil
+}
+
+// bindAPIKey reads an API key request and returns the resource:action pairs it grants
+func (h *APIKeyHandler) bindAPIKey(c echo.Context) (*APIKeyRequest, []string, error) {
+	var req APIKeyRequest
+	if err := c.Bind(&req); err != nil {
+		return nil, nil, echo.NewHTTPError(http.StatusBadRequest, "invalid request body")
+	}
+	if err := c.Validate(&req); err != nil {
+		return nil, nil, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return nil, nil, echo.NewHTTPError(http.StatusBadRequest, "expiresAt must be in the future")
+	}
+	permissions, err := models.NormalizeRolePermissions(req.Permissions)
+	if err != nil {
+		return nil, nil, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	scopes := models.ExpandPermissions(permissions)
+	if len(scopes) == 0 {
+		return nil, nil, echo.NewHTTPError(http.StatusBadRequest, "the permissions grant nothing")
+	}
+	if !callerCovers(c, scopes) {
+		return nil, nil, echo.NewHTTPError(http.StatusForbidden, "api keys can't be given permissions you don't have")
+	}
+	return &req, scopes, nil
+}
+
+// callerCovers reports whether the caller, member or API key, has all the permissions: admins
+// have every one
+func callerCovers(c echo.Context, scopes []string) bool {
+	if hasAdmin, _ := c.Get("hasAdminAccess").(bool); hasAdmin {
+		return true
+	}
+	granted, _ := c.Get("scopes").([]string)
+	return models.PermissionsCover(granted, scopes)
+}
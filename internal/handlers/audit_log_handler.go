@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"kori/internal/models"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// AuditLogHandler lets team admins look through who changed what
+type AuditLogHandler struct {
+	db *gorm.DB
+}
+
+func NewAuditLogHandler(db *gorm.DB) *AuditLogHandler {
+	return &AuditLogHandler{db: db}
+}
+
+// ListAuditLogs lists the team's audit log, newest first
+// @Summary List audit logs
+// @Description The create, update and delete calls made by the team's members and API keys, with who made them, from which IP, and the fields they changed where the handler recorded them. Credentials only show that they changed.
+// @Tags audit-logs
+// @Produce json
+// @Param user_id query string false "Only calls of this user"
+// @Param api_key_id query string false "Only calls of this API key"
+// @Param resource query string false "Only changes to this resource, e.g. campaigns"
+// @Param resource_id query string false "Only changes to this row"
+// @Param action query string false "Only this action" Enums(create, update, delete)
+// @Param since query string false "Calls from this time (RFC3339)"
+// @Param before query string false "Calls before this time (RFC3339)"
+// @Param page query int false "Page (default 1)"
+// @Param limit query int false "Page size (default 50, max 200)"
+// @Success 200 {array} models.AuditLog
+// @Failure 400 {object} map[string]string "Invalid filter or pagination"
+// @Router /api/v1/audit-logs [get]
+func (h *AuditLogHandler) ListAuditLogs(c echo.Context) error {
+	teamID := c.Get("teamID").(string)
+	query := h.db.Model(&models.AuditLog{}).Where("team_id = ?", teamID)
+
+	for param, column := range map[string]string{"user_id": "user_id", "api_key_id": "api_key_id"} {
+		if value := c.QueryParam(param); value != "" {
+			if _, err := uuid.Parse(value); err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, "invalid "+param)
+			}
+			query = query.Where(column+" = ?", value)
+		}
+	}
+	if resource := c.QueryParam("resource"); resource != "" {
+		query = query.Where("resource = ?", resource)
+	}
+	if resourceID := c.QueryParam("resource_id"); resourceID != "" {
+		query = query.Where("resource_id = ?", resourceID)
+	}
+	switch action := models.AuditAction(c.QueryParam("action")); action {
+	case "":
+	case models.AuditActionCreate, models.AuditActionUpdate, models.AuditActionDelete:
+		query = query.Where("action = ?", action)
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, "action must be create, update or delete")
+	}
+	for param, condition := range map[string]string{"since": "created_at >= ?", "before": "created_at < ?"} {
+		if value := c.QueryParam(param); value != "" {
+			at, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, "invalid "+param)
+			}
+			query = query.Where(condition, at)
+		}
+	}
+
+	page, limit := 1, 50
+	if value := c.QueryParam("page"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid page")
+		}
+		page = parsed
+	}
+	if value := c.QueryParam("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > 200 {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid limit")
+		}
+		limit = parsed
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to count audit logs")
+	}
+	logs := []models.AuditLog{}
+	if err := query.Order("created_at DESC, id DESC").Offset((page - 1) * limit).Limit(limit).Find(&logs).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get audit logs")
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":  logs,
+		"total": total,
+		"page":  page,
+		"limit": limit,
+	})
+}
+
+// GetAuditLog returns an entry of the team's audit log
+// @Summary Get audit log
+// @Tags audit-logs
+// @Produce json
+// @Param id path string true "Audit log ID"
+// @Success 200 {object} models.AuditLog
+// @Failure 404 {object} map[string]string "Audit log not found"
+// @Router /api/v1/audit-logs/{id} [get]
+func (h *AuditLogHandler) GetAuditLog(c echo.Context) error {
+	if _, err := uuid.Parse(c.Param("id")); err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "audit log not found")
+	}
+	entry := &models.AuditLog{}
+	if err := h.db.Where("id = ? AND team_id = ?", c.Param("id"), c.Get("teamID").(string)).First(entry).Error; err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "audit log not found")
+	}
+	return c.JSON(http.StatusOK, entry)
+}
@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"kori/internal/events"
+	"kori/internal/models"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+type AutomationHandler struct {
+	db *gorm.DB
+}
+
+func NewAutomationHandler(db *gorm.DB) *AutomationHandler {
+	return &AutomationHandler{db: db}
+}
+
+// EnrollContactsRequest lists the contacts to start an automation for
+type EnrollContactsRequest struct {
+	ContactIDs []string `json:"contactIds" validate:"required,min=1,max=1000,dive,uuid"`
+}
+
+// EnrollContacts starts an automation run for each contact
+// @Summary Enroll contacts in an automation
+// @Description Start the automation for the given contacts. Contacts already enrolled are skipped.
+// @Tags automations
+// @Accept json
+// @Produce json
+// @Param id path string true "Automation ID"
+// @Param request body EnrollContactsRequest true "Contacts to enroll"
+// @Success 200 {object} map[string]interface{} "Enrolled and skipped counts"
+// @Failure 400 {object} map[string]string "Validation error"
+// @Failure 404 {object} map[string]string "Automation not found"
+// @Failure 409 {object} map[string]string "Automation is not active"
+// @Failure 422 {object} map[string]string "Automation graph is invalid"
+// @Router /api/v1/automations/{id}/enroll [post]
+func (h *AutomationHandler) EnrollContacts(c echo.Context) error {
+	teamID := c.Get("teamID").(string)
+
+	var req EnrollContactsRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+	if err := c.Validate(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	automation, err := models.GetAutomationWithGraph(c.Param("id"), h.db)
+	if err != nil || automation.TeamID != teamID {
+		return echo.NewHTTPError(http.StatusNotFound, "automation not found")
+	}
+	if !automation.IsActive {
+		return echo.NewHTTPError(http.StatusConflict, "automation is not active")
+	}
+	if _, err := models.NewAutomationGraph(automation); err != nil {
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, err.Error())
+	}
+
+	var contacts []models.Contact
+	if err := h.db.Where("id IN ? AND team_id = ? AND is_deleted = false", req.ContactIDs, teamID).Find(&contacts).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get contacts")
+	}
+
+	enrolled := 0
+	for i := range contacts {
+		run, err := models.EnrollContact(automation, &contacts[i], h.db)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to enroll contacts")
+		}
+		if run == nil {
+			continue
+		}
+		enrolled++
+		events.Emit("automation_run.created", run)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"enrolled": enrolled,
+		"skipped":  len(req.ContactIDs) - enrolled,
+	})
+}
+
+// GetAutomationRuns lists where each enrolled contact is in an automation
+// @Summary List automation runs
+// @Description Per-contact execution state of an automation
+// @Tags automations
+// @Produce json
+// @Param id path string true "Automation ID"
+// @Param status query string false "Filter by status" Enums(ACTIVE, WAITING, COMPLETED, EXITED, FAILED, OPTED_OUT)
+// @Param page query int false "Page (default 1)"
+// @Param limit query int false "Page size (default 50, max 500)"
+// @Success 200 {array} models.AutomationRun
+// @Failure 400 {object} map[string]string "Invalid pagination"
+// @Failure 404 {object} map[string]string "Automation not found"
+// @Router /api/v1/automations/{id}/runs [get]
+func (h *AutomationHandler) GetAutomationRuns(c echo.Context) error {
+	teamID := c.Get("teamID").(string)
+
+	automation := &models.Automation{}
+	if err := h.db.Where("id = ? AND team_id = ? AND is_deleted = false", c.Param("id"), teamID).First(automation).Error; err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "automation not found")
+	}
+
+	page, limit := 1, 50
+	if value := c.QueryParam("page"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid page")
+		}
+		page = parsed
+	}
+	if value := c.QueryParam("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > 500 {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid limit")
+		}
+		limit = parsed
+	}
+
+	query := h.db.Model(&models.AutomationRun{}).Where("automation_id = ? AND is_deleted = false", automation.ID)
+	if status := c.QueryParam("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to count runs")
+	}
+
+	var runs []models.AutomationRun
+	if err := query.Preload("Contact").
+		Order("created_at DESC").
+		Offset((page - 1) * limit).
+		Limit(limit).
+		Find(&runs).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get runs")
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":  runs,
+		"total": total,
+		"page":  page,
+		"limit": limit,
+	})
+}
+
+// GetOptOutRates reports how many contacts opted out of each automation alone
+// @Summary Automation opt-out rates
+// @Description Per automation, the contacts enrolled and emailed and how many of them opted out of the automation without unsubscribing
+// @Tags automations
+// @Produce json
+// @Param automationId query string false "Only this automation"
+// @Success 200 {array} models.AutomationOptOutRate
+// @Router /api/v1/automations/opt-out-rates [get]
+func (h *AutomationHandler) GetOptOutRates(c echo.Context) error {
+	teamID := c.Get("teamID").(string)
+
+	rates, err := models.GetAutomationOptOutRates(teamID, c.QueryParam("automationId"), h.db)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get opt-out rates")
+	}
+
+	return c.JSON(http.StatusOK, rates)
+}
@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"kori/internal/models"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+type BlackoutHandler struct {
+	db *gorm.DB
+}
+
+// BlackoutCheckResponse reports whether a date is blocked for sending
+type BlackoutCheckResponse struct {
+	Date     string           `json:"date"`
+	Blocked  bool             `json:"blocked"`
+	Blackout *models.Blackout `json:"blackout,omitempty"`
+	NextOpen string           `json:"nextOpen,omitempty"`
+}
+
+// HolidayCountriesRequest selects the built-in holiday sets a team observes
+type HolidayCountriesRequest struct {
+	Countries []string `json:"countries"`
+}
+
+// HolidayCountriesResponse lists the built-in holiday sets and the ones the team observes
+type HolidayCountriesResponse struct {
+	Available []string `json:"available"`
+	Selected  []string `json:"selected"`
+}
+
+func NewBlackoutHandler(db *gorm.DB) *BlackoutHandler {
+	return &BlackoutHandler{db: db}
+}
+
+// CheckDate checks whether a date falls on a team blackout date or observed holiday
+// @Summary Check blackout date
+// @Description Check whether campaigns can be sent on a date and return the next open date
+// @Tags blackout-dates
+// @Produce json
+// @Param date query string true "Date (YYYY-MM-DD)"
+// @Success 200 {object} BlackoutCheckResponse
+// @Failure 400 {object} map[string]string "Invalid date"
+// @Router /api/v1/blackout-dates/check [get]
+func (h *BlackoutHandler) CheckDate(c echo.Context) error {
+	teamID := c.Get("teamID").(string)
+
+	day, err := time.Parse("2006-01-02", c.QueryParam("date"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "date must be in YYYY-MM-DD format")
+	}
+
+	blackout, err := models.FindBlackout(teamID, day, h.db)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to check blackout dates")
+	}
+
+	response := BlackoutCheckResponse{Date: day.Format("2006-01-02"), Blocked: blackout != nil, Blackout: blackout}
+	if blackout != nil {
+		if next, err := models.NextAllowedSendTime(teamID, day, h.db); err == nil {
+			response.NextOpen = next.Format("2006-01-02")
+		}
+	}
+
+	return c.JSON(http.StatusOK, response)
+}
+
+// ListHolidays lists the built-in public holidays of a country
+// @Summary List public holidays
+// @Description List the built-in public holidays of a country for a year
+// @Tags blackout-dates
+// @Produce json
+// @Param country query string true "ISO country code"
+// @Param year query int false "Year (defaults to the current year)"
+// @Success 200 {array} models.Holiday
+// @Failure 400 {object} map[string]string "Unsupported country"
+// @Router /api/v1/blackout-dates/holidays [get]
+func (h *BlackoutHandler) ListHolidays(c echo.Context) error {
+	country := c.QueryParam("country")
+	if !models.IsSupportedHolidayCountry(country) {
+		return echo.NewHTTPError(http.StatusBadRequest, "unsupported country, available: "+strings.Join(models.HolidayCountries(), ", "))
+	}
+
+	year := time.Now().Year()
+	if value := c.QueryParam("year"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid year")
+		}
+		year = parsed
+	}
+
+	return c.JSON(http.StatusOK, models.HolidaysForCountry(country, year))
+}
+
+// GetHolidayCountries returns the holiday sets the team observes
+// @Summary Get observed holiday sets
+// @Description Get the built-in holiday sets available and the ones the team observes as blackout dates
+// @Tags blackout-dates
+// @Produce json
+// @Success 200 {object} HolidayCountriesResponse
+// @Router /api/v1/blackout-dates/holiday-countries [get]
+func (h *BlackoutHandler) GetHolidayCountries(c echo.Context) error {
+	teamID := c.Get("teamID").(string)
+
+	selected := []string{}
+	settings := &models.TeamSettings{}
+	if err := h.db.Where("team_id = ? AND is_deleted = false", teamID).First(settings).Error; err == nil {
+		selected = append(selected, settings.HolidayCountries...)
+	}
+
+	return c.JSON(http.StatusOK, HolidayCountriesResponse{Available: models.HolidayCountries(), Selected: selected})
+}
+
+// UpdateHolidayCountries sets the holiday sets the team observes
+// @Summary Update observed holiday sets
+// @Description Choose which built-in public holiday sets are treated as blackout dates
+// @Tags blackout-dates
+// @Accept json
+// @Produce json
+// @Param request body HolidayCountriesRequest true "Country codes"
+// @Success 200 {object} HolidayCountriesResponse
+// @Failure 400 {object} map[string]string "Unsupported country"
+// @Failure 404 {object} map[string]string "Team settings not found"
+// @Router /api/v1/blackout-dates/holiday-countries [put]
+func (h *BlackoutHandler) UpdateHolidayCountries(c echo.Context) error {
+	teamID := c.Get("teamID").(string)
+
+	var req HolidayCountriesRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request body")
+	}
+
+	countries := []string{}
+	for _, country := range req.Countries {
+		country = strings.ToUpper(strings.TrimSpace(country))
+		if !models.IsSupportedHolidayCountry(country) {
+			return echo.NewHTTPError(http.StatusBadRequest, "unsupported country: "+country)
+		}
+		countries = append(countries, country)
+	}
+
+	settings := &models.TeamSettings{}
+	if err := h.db.Where("team_id = ? AND is_deleted = false", teamID).First(settings).Error; err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "team settings not found")
+	}
+
+	settings.HolidayCountries = countries
+	if err := h.db.Model(settings).Update("holiday_countries", settings.HolidayCountries).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to update holiday countries")
+	}
+
+	return c.JSON(http.StatusOK, HolidayCountriesResponse{Available: models.HolidayCountries(), Selected: countries})
+}
@@ -0,0 +1,395 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"kori/internal/config"
+	"kori/internal/events"
+	"kori/internal/models"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+type CampaignHandler struct {
+	db *gorm.DB
+}
+
+func NewCampaignHandler(db *gorm.DB) *CampaignHandler {
+	return &CampaignHandler{db: db}
+}
+
+// transition moves a team's campaign from one of the given statuses to the new status. The
+// status check is part of the update so a campaign finishing at the same moment isn't overwritten.
+func (h *CampaignHandler) transition(c echo.Context, from []models.CampaignStatus, to models.CampaignStatus) (*models.Campaign, error) {
+	teamID := c.Get("teamID").(string)
+
+	campaign := &models.Campaign{}
+	if err := h.db.Where("id = ? AND team_id = ? AND is_deleted = false", c.Param("id"), teamID).First(campaign).Error; err != nil {
+		return nil, echo.NewHTTPError(http.StatusNotFound, "campaign not found")
+	}
+
+	// A change by hand replaces whatever the campaign paused on its own for
+	result := h.db.Model(&models.Campaign{}).
+		Where("id = ? AND status IN ?", campaign.ID, from).
+		Updates(map[string]interface{}{"status": to, "pause_reason": ""})
+	if result.Error != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, "failed to update campaign status")
+	}
+	if result.RowsAffected == 0 {
+		return nil, echo.NewHTTPError(http.StatusConflict, "campaign can't be changed from status "+string(campaign.Status))
+	}
+
+	campaign.Status = to
+	campaign.PauseReason = ""
+	return campaign, nil
+}
+
+// PauseCampaign pauses a sending or scheduled campaign
+// @Summary Pause campaign
+// @Description Pause a campaign. A campaign that is sending stops after its current batch; the contacts it hasn't reached are sent to on resume.
+// @Tags campaigns
+// @Produce json
+// @Param id path string true "Campaign ID"
+// @Success 200 {object} models.Campaign
+// @Failure 404 {object} map[string]string "Campaign not found"
+// @Failure 409 {object} map[string]string "Campaign is not sending or scheduled"
+// @Router /api/v1/campaigns/{id}/pause [post]
+func (h *CampaignHandler) PauseCampaign(c echo.Context) error {
+	campaign, err := h.transition(c, []models.CampaignStatus{models.CampaignStatusSending, models.CampaignStatusScheduled}, models.CampaignStatusPaused)
+	if err != nil {
+		return err
+	}
+
+	events.Emit("campaign.paused", campaign)
+
+	return c.JSON(http.StatusOK, campaign)
+}
+
+// ResumeCampaign resumes a paused campaign and sends to the contacts it hasn't reached yet
+// @Summary Resume campaign
+// @Description Resume a campaign that was paused by hand, by an alert rule, by a failing SMTP config or by the team's quota running out. A campaign still over quota pauses again.
+// @Tags campaigns
+// @Produce json
+// @Param id path string true "Campaign ID"
+// @Success 200 {object} models.Campaign
+// @Failure 404 {object} map[string]string "Campaign not found"
+// @Failure 409 {object} map[string]string "Campaign is not paused"
+// @Router /api/v1/campaigns/{id}/resume [post]
+func (h *CampaignHandler) ResumeCampaign(c echo.Context) error {
+	campaign, err := h.transition(c, []models.CampaignStatus{models.CampaignStatusPaused}, models.CampaignStatusSending)
+	if err != nil {
+		return err
+	}
+
+	events.Emit("campaign.resumed", campaign)
+
+	return c.JSON(http.StatusOK, campaign)
+}
+
+// CancelCampaign stops a campaign for good
+// @Summary Cancel campaign
+// @Description Cancel a scheduled, sending or paused campaign. A campaign that is sending stops after its current batch and the rest of the list is never sent. Its queued tasks are removed and emails not yet sent are marked CANCELLED.
+// @Tags campaigns
+// @Produce json
+// @Param id path string true "Campaign ID"
+// @Success 200 {object} models.Campaign
+// @Failure 404 {object} map[string]string "Campaign not found"
+// @Failure 409 {object} map[string]string "Campaign has already finished"
+// @Router /api/v1/campaigns/{id}/cancel [post]
+func (h *CampaignHandler) CancelCampaign(c echo.Context) error {
+	campaign, err := h.transition(c, []models.CampaignStatus{
+		models.CampaignStatusDraft,
+		models.CampaignStatusScheduled,
+		models.CampaignStatusSending,
+		models.CampaignStatusPaused,
+	}, models.CampaignStatusCancelled)
+	if err != nil {
+		return err
+	}
+
+	events.Emit("campaign.cancelled", campaign)
+
+	return c.JSON(http.StatusOK, campaign)
+}
+
+// GetCampaignAuthentication previews how a campaign's mail will authenticate
+// @Summary Preview campaign sender authentication
+// @Description Show the From domain, DKIM selector, SPF alignment and tracking domain a campaign will use given its SMTP config, flagging misalignments such as a From domain that isn't a verified domain
+// @Tags campaigns
+// @Produce json
+// @Param id path string true "Campaign ID"
+// @Success 200 {object} models.SenderAuthentication
+// @Failure 404 {object} map[string]string "Campaign or SMTP config not found"
+// @Router /api/v1/campaigns/{id}/authentication [get]
+func (h *CampaignHandler) GetCampaignAuthentication(c echo.Context) error {
+	teamID := c.Get("teamID").(string)
+
+	campaign := &models.Campaign{}
+	if err := h.db.Where("id = ? AND team_id = ? AND is_deleted = false", c.Param("id"), teamID).First(campaign).Error; err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "campaign not found")
+	}
+
+	auth, err := models.GetSenderAuthentication(campaign, config.GetConfig().Server.PublicURL, h.db)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, "smtp config not found")
+	}
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to check sender authentication")
+	}
+
+	return c.JSON(http.StatusOK, auth)
+}
+
+// GetCampaignLanguageStats breaks a campaign's performance down by the language variant sent
+// @Summary Get campaign language stats
+// @Description Get the sent, open and click counts of each language a campaign was sent in. The campaign's own template, sent to contacts no language variant fits, has an empty language.
+// @Tags campaigns
+// @Produce json
+// @Param id path string true "Campaign ID"
+// @Success 200 {array} models.LanguageStats
+// @Failure 404 {object} map[string]string "Campaign not found"
+// @Router /api/v1/campaigns/{id}/languages [get]
+func (h *CampaignHandler) GetCampaignLanguageStats(c echo.Context) error {
+	teamID := c.Get("teamID").(string)
+
+	campaign := &models.Campaign{}
+	if err := h.db.Where("id = ? AND team_id = ? AND is_deleted = false", c.Param("id"), teamID).First(campaign).Error; err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "campaign not found")
+	}
+
+	stats, err := models.GetLanguageStats(campaign.ID, h.db)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get language stats")
+	}
+
+	return c.JSON(http.StatusOK, stats)
+}
+
+// GetCampaignRecipients reports what happened to each contact a campaign was sent to
+// @Summary List campaign recipients
+// @Description Per-contact delivery status of a campaign (queued, sent, failed, opened, clicked, bounced, unsubscribed, cancelled), paginated or as a CSV export
+// @Tags campaigns
+// @Produce json,text/csv
+// @Param id path string true "Campaign ID"
+// @Param status query string false "Filter by status" Enums(queued, sent, failed, opened, clicked, bounced, unsubscribed, cancelled)
+// @Param page query int false "Page (default 1)"
+// @Param limit query int false "Page size (default 50, max 500)"
+// @Param format query string false "Set to csv to download every matching recipient"
+// @Success 200 {array} models.CampaignRecipient
+// @Failure 400 {object} map[string]string "Invalid status or pagination"
+// @Failure 404 {object} map[string]string "Campaign not found"
+// @Router /api/v1/campaigns/{id}/recipients [get]
+func (h *CampaignHandler) GetCampaignRecipients(c echo.Context) error {
+	teamID := c.Get("teamID").(string)
+
+	campaign := &models.Campaign{}
+	if err := h.db.Where("id = ? AND team_id = ? AND is_deleted = false", c.Param("id"), teamID).First(campaign).Error; err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "campaign not found")
+	}
+
+	status := models.RecipientStatus(c.QueryParam("status"))
+	if status != "" && !slices.Contains(models.RecipientStatuses, status) {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid status")
+	}
+
+	if c.QueryParam("format") == "csv" {
+		return h.exportCampaignRecipients(c, campaign, status)
+	}
+
+	page, limit := 1, 50
+	if value := c.QueryParam("page"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid page")
+		}
+		page = parsed
+	}
+	if value := c.QueryParam("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > 500 {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid limit")
+		}
+		limit = parsed
+	}
+
+	var total int64
+	if err := models.CampaignRecipientsQuery(campaign.ID, status, h.db).Count(&total).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to count recipients")
+	}
+
+	var recipients []models.CampaignRecipient
+	if err := models.CampaignRecipientsQuery(campaign.ID, status, h.db).
+		Order("email ASC, email_id ASC").
+		Offset((page - 1) * limit).
+		Limit(limit).
+		Scan(&recipients).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get recipients")
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":  recipients,
+		"total": total,
+		"page":  page,
+		"limit": limit,
+	})
+}
+
+// GetCampaignSnapshots lists who each run of a campaign was sent to
+// @Summary List campaign send snapshots
+// @Description The recipient count and membership hash recorded each time the campaign was sent. Recipient contact IDs are included with members=true for campaigns that keep them.
+// @Tags campaigns
+// @Produce json
+// @Param id path string true "Campaign ID"
+// @Param members query bool false "Include recipient contact IDs"
+// @Success 200 {array} models.CampaignSnapshot
+// @Failure 404 {object} map[string]string "Campaign not found"
+// @Router /api/v1/campaigns/{id}/snapshots [get]
+func (h *CampaignHandler) GetCampaignSnapshots(c echo.Context) error {
+	teamID := c.Get("teamID").(string)
+
+	campaign := &models.Campaign{}
+	if err := h.db.Where("id = ? AND team_id = ? AND is_deleted = false", c.Param("id"), teamID).First(campaign).Error; err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "campaign not found")
+	}
+
+	query := h.db.Where("campaign_id = ? AND is_deleted = false", campaign.ID).Order("taken_at ASC")
+	if c.QueryParam("members") != "true" {
+		query = query.Omit("members")
+	}
+
+	var snapshots []models.CampaignSnapshot
+	if err := query.Find(&snapshots).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get snapshots")
+	}
+
+	return c.JSON(http.StatusOK, snapshots)
+}
+
+// CampaignExclusionReport is how a campaign's exclusions narrow its audience as it stands now
+type CampaignExclusionReport struct {
+	AudienceCount  int64                           `json:"audienceCount"`  // contacts in the list or segment
+	ExcludedCount  int64                           `json:"excludedCount"`  // contacts left out by any exclusion
+	RemainingCount int64                           `json:"remainingCount"` // contacts that would be sent to
+	Exclusions     []models.CampaignExclusionCount `json:"exclusions"`
+}
+
+// GetCampaignExclusions reports how many contacts each of a campaign's exclusions leaves out
+// @Summary Campaign exclusion counts
+// @Description How many of the campaign's audience its exclusion lists, segments and campaigns leave out, overall and per exclusion. Counts are for the audience as it stands now; snapshots record what each send excluded.
+// @Tags campaigns
+// @Produce json
+// @Param id path string true "Campaign ID"
+// @Success 200 {object} CampaignExclusionReport
+// @Failure 404 {object} map[string]string "Campaign not found"
+// @Router /api/v1/campaigns/{id}/exclusions [get]
+func (h *CampaignHandler) GetCampaignExclusions(c echo.Context) error {
+	teamID := c.Get("teamID").(string)
+
+	campaign := &models.Campaign{}
+	if err := h.db.Where("id = ? AND team_id = ? AND is_deleted = false", c.Param("id"), teamID).First(campaign).Error; err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "campaign not found")
+	}
+
+	exclusions, err := models.GetCampaignExclusions(campaign.ID, h.db)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get exclusions")
+	}
+
+	audience, err := campaign.AudienceQuery(h.db)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	audience = audience.Where("contacts.status = ?", models.SubscriberStatusActive)
+
+	report := &CampaignExclusionReport{Exclusions: []models.CampaignExclusionCount{}}
+	if err := audience.Session(&gorm.Session{}).Count(&report.AudienceCount).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to count audience")
+	}
+	report.RemainingCount = report.AudienceCount
+
+	if len(exclusions) > 0 {
+		if report.Exclusions, err = campaign.CountExclusions(audience, exclusions, h.db); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to count exclusions")
+		}
+		remaining, err := campaign.ApplyExclusions(audience.Session(&gorm.Session{}), exclusions, h.db)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to apply exclusions")
+		}
+		if err := remaining.Count(&report.RemainingCount).Error; err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to count audience")
+		}
+	}
+	report.ExcludedCount = report.AudienceCount - report.RemainingCount
+
+	return c.JSON(http.StatusOK, report)
+}
+
+// exportCampaignRecipients streams every matching recipient as CSV
+func (h *CampaignHandler) exportCampaignRecipients(c echo.Context, campaign *models.Campaign, status models.RecipientStatus) error {
+	rows, err := models.CampaignRecipientsQuery(campaign.ID, status, h.db).Order("email ASC, email_id ASC").Rows()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get recipients")
+	}
+	defer rows.Close()
+
+	c.Response().Header().Set(echo.HeaderContentType, "text/csv")
+	c.Response().Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=campaign_recipients_%s.csv", campaign.ID))
+	c.Response().WriteHeader(http.StatusOK)
+
+	formatTime := func(t *time.Time) string {
+		if t == nil {
+			return ""
+		}
+		return t.Format(time.RFC3339)
+	}
+
+	writer := csv.NewWriter(c.Response())
+	writer.Write([]string{
+		"Email",
+		"First Name",
+		"Last Name",
+		"Status",
+		"Error",
+		"Sent At",
+		"Opens",
+		"Clicks",
+		"Opened At",
+		"Clicked At",
+		"Bounced At",
+		"Unsubscribed At",
+		"Contact ID",
+		"Email ID",
+	})
+
+	for rows.Next() {
+		var recipient models.CampaignRecipient
+		if err := h.db.ScanRows(rows, &recipient); err != nil {
+			break
+		}
+		writer.Write([]string{
+			recipient.Email,
+			recipient.FirstName,
+			recipient.LastName,
+			string(recipient.Status),
+			recipient.Error,
+			formatTime(recipient.SentAt),
+			strconv.FormatInt(recipient.Opens, 10),
+			strconv.FormatInt(recipient.Clicks, 10),
+			formatTime(recipient.OpenedAt),
+			formatTime(recipient.ClickedAt),
+			formatTime(recipient.BouncedAt),
+			formatTime(recipient.UnsubscribedAt),
+			recipient.ContactID,
+			recipient.EmailID,
+		})
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"errors"
+	"kori/internal/models"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultChangelogLimit = 20
+	maxChangelogLimit     = 100
+)
+
+type ChangelogHandler struct {
+	db *gorm.DB
+}
+
+func NewChangelogHandler(db *gorm.DB) *ChangelogHandler {
+	return &ChangelogHandler{db: db}
+}
+
+// ChangelogEntryRequest is a changelog entry as platform operators write it
+type ChangelogEntryRequest struct {
+	Title       string                   `json:"title" validate:"required,min=2"`
+	Body        string                   `json:"body"`
+	Category    models.ChangelogCategory `json:"category" validate:"omitempty,oneof=NEW IMPROVED FIXED"`
+	Feature     models.ProductFeature    `json:"feature" validate:"omitempty,max=64"` // the plan feature the entry is about
+	Link        string                   `json:"link" validate:"omitempty,url"`
+	PublishedAt *time.Time               `json:"publishedAt"` // now when empty, or later to publish it then
+	Draft       bool                     `json:"draft"`       // keep it unpublished
+}
+
+func (r *ChangelogEntryRequest) apply(entry *models.ChangelogEntry) {
+	entry.Title = r.Title
+	entry.Body = r.Body
+	entry.Category = r.Category
+	if entry.Category == "" {
+		entry.Category = models.ChangelogCategoryNew
+	}
+	entry.Feature = r.Feature
+	entry.Link = r.Link
+
+	switch {
+	case r.Draft:
+		entry.PublishedAt = nil
+	case r.PublishedAt != nil:
+		entry.PublishedAt = r.PublishedAt
+	case entry.PublishedAt == nil:
+		now := time.Now()
+		entry.PublishedAt = &now
+	}
+}
+
+// GetChangelog lists the changes published for every team
+// @Summary Get changelog
+// @Description Published backend changes, newest first. Entries about a plan feature say whether the team's plan includes it and which plans do.
+// @Tags changelog
+// @Produce json
+// @Param since query string false "Only entries published after this RFC 3339 time, e.g. when the dashboard last showed the changelog"
+// @Param limit query int false "At most this many entries, 20 by default and at most 100"
+// @Success 200 {array} models.ChangelogItem
+// @Failure 400 {object} map[string]string "Invalid since or limit"
+// @Router /api/v1/changelog [get]
+func (h *ChangelogHandler) GetChangelog(c echo.Context) error {
+	teamID := c.Get("teamID").(string)
+
+	var since time.Time
+	if raw := c.QueryParam("since"); raw != "" {
+		parsed, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "since must be an RFC 3339 time")
+		}
+		since = parsed
+	}
+
+	limit := defaultChangelogLimit
+	if raw := c.QueryParam("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 {
+			return echo.NewHTTPError(http.StatusBadRequest, "limit must be a positive number")
+		}
+		limit = min(parsed, maxChangelogLimit)
+	}
+
+	items, err := models.GetChangelog(teamID, since, limit, h.db)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get changelog")
+	}
+
+	return c.JSON(http.StatusOK, items)
+}
+
+// ListChangelogEntries lists every changelog entry, drafts included
+// @Summary List changelog entries
+// @Description Every changelog entry including drafts and those scheduled for later, for platform operators
+// @Tags changelog
+// @Produce json
+// @Success 200 {array} models.ChangelogEntry
+// @Router /api/v1/admin/changelog [get]
+func (h *ChangelogHandler) ListChangelogEntries(c echo.Context) error {
+	var entries []models.ChangelogEntry
+	if err := h.db.Where("is_deleted = false").
+		Order("published_at DESC NULLS FIRST, created_at DESC").
+		Find(&entries).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to list changelog entries")
+	}
+
+	return c.JSON(http.StatusOK, entries)
+}
+
+// CreateChangelogEntry publishes a changelog entry
+// @Summary Create changelog entry
+// @Description Publish a changelog entry to every team, now unless it's a draft or given a later publishedAt
+// @Tags changelog
+// @Accept json
+// @Produce json
+// @Param request body ChangelogEntryRequest true "Changelog entry"
+// @Success 201 {object} models.ChangelogEntry
+// @Failure 400 {object} map[string]string "Invalid entry"
+// @Router /api/v1/admin/changelog [post]
+func (h *ChangelogHandler) CreateChangelogEntry(c echo.Context) error {
+	req := new(ChangelogEntryRequest)
+	if err := c.Bind(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request body")
+	}
+	if err := c.Validate(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	entry := &models.ChangelogEntry{}
+	req.apply(entry)
+	if err := h.db.Create(entry).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to create changelog entry")
+	}
+
+	return c.JSON(http.StatusCreated, entry)
+}
+
+// UpdateChangelogEntry edits a changelog entry
+// @Summary Update changelog entry
+// @Description Edit a changelog entry. Published entries keep their publication time unless given another, and go back to being drafts with draft set.
+// @Tags changelog
+// @Accept json
+// @Produce json
+// @Param id path string true "Changelog entry ID"
+// @Param request body ChangelogEntryRequest true "Changelog entry"
+// @Success 200 {object} models.ChangelogEntry
+// @Failure 400 {object} map[string]string "Invalid entry"
+// @Failure 404 {object} map[string]string "Changelog entry not found"
+// @Router /api/v1/admin/changelog/{id} [put]
+func (h *ChangelogHandler) UpdateChangelogEntry(c echo.Context) error {
+	req := new(ChangelogEntryRequest)
+	if err := c.Bind(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request body")
+	}
+	if err := c.Validate(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	entry := &models.ChangelogEntry{}
+	if err := h.db.Where("id = ? AND is_deleted = false", c.Param("id")).First(entry).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "changelog entry not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get changelog entry")
+	}
+
+	req.apply(entry)
+	if err := h.db.Save(entry).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to update changelog entry")
+	}
+
+	return c.JSON(http.StatusOK, entry)
+}
+
+// DeleteChangelogEntry takes a changelog entry down
+// @Summary Delete changelog entry
+// @Description Remove a changelog entry from every team's changelog
+// @Tags changelog
+// @Param id path string true "Changelog entry ID"
+// @Success 204
+// @Failure 404 {object} map[string]string "Changelog entry not found"
+// @Router /api/v1/admin/changelog/{id} [delete]
+func (h *ChangelogHandler) DeleteChangelogEntry(c echo.Context) error {
+	result := h.db.Model(&models.ChangelogEntry{}).
+		Where("id = ? AND is_deleted = false", c.Param("id")).
+		Updates(map[string]interface{}{"is_deleted": true, "deleted_at": time.Now()})
+	if result.Error != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to delete changelog entry")
+	}
+	if result.RowsAffected == 0 {
+		return echo.NewHTTPError(http.StatusNotFound, "changelog entry not found")
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"kori/internal/models"
+	"kori/internal/utils"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// ConfigHandler manages a team's resources as code, from a declarative config
+type ConfigHandler struct {
+	db *gorm.DB
+}
+
+func NewConfigHandler(db *gorm.DB) *ConfigHandler {
+	return &ConfigHandler{db: db}
+}
+
+// templateHTMLStore keeps template html in the configured storage
+type templateHTMLStore struct {
+	ctx context.Context
+}
+
+func (s *templateHTMLStore) ReadHTML(template *models.Template) (string, error) {
+	return utils.GetHTMLFromURL(template.HtmlFile.SignedURL)
+}
+
+func (s *templateHTMLStore) StoreHTML(teamID string, name string, html string) (*models.File, error) {
+	storage := GetStorageHandler()
+	if storage == nil {
+		return nil, fmt.Errorf("storage handler not configured")
+	}
+	fileName := fmt.Sprintf("tmp/%s.html", uuid.New().String())
+	url, err := storage.UploadFile(s.ctx, []byte(html), fileName, types.ObjectCannedACLAuthenticatedRead, "text/html")
+	if err != nil {
+		return nil, fmt.Errorf("failed to upload html of %s: %w", name, err)
+	}
+	return &models.File{
+		TeamID: teamID,
+		Path:   url[strings.LastIndex(url, "/")+1:],
+		Name:   fileName,
+		Size:   int64(len(html)),
+		Type:   "text/html",
+	}, nil
+}
+
+// bindConfig reads and validates a declarative config from the request
+func bindConfig(c echo.Context) (*models.DeclarativeConfig, error) {
+	config := new(models.DeclarativeConfig)
+	if err := c.Bind(config); err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "invalid request body")
+	}
+	if err := c.Validate(config); err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return config, nil
+}
+
+// PlanConfig shows what applying a declarative config would change
+// @Summary Plan config
+// @Description Compare a declarative config of templates, webhooks, SMTP configs and domains with the team's resources and list the changes applying it would make, field by field, without making them. Resources are matched by template and webhook name, SMTP config provider and from address and domain name; secrets show as (sensitive) and html by size and hash. Kinds left out of the config aren't compared; with prune, resources of the kinds given that the config doesn't list are deleted. Changes that can't be applied carry an error.
+// @Tags config
+// @Accept json
+// @Produce json
+// @Param request body models.DeclarativeConfig true "Desired state"
+// @Success 200 {object} models.ConfigPlan
+// @Failure 400 {object} map[string]string "Invalid config"
+// @Router /api/v1/config/plan [post]
+func (h *ConfigHandler) PlanConfig(c echo.Context) error {
+	teamID := c.Get("teamID").(string)
+
+	config, err := bindConfig(c)
+	if err != nil {
+		return err
+	}
+
+	plan, err := models.PlanConfig(teamID, config, &templateHTMLStore{ctx: c.Request().Context()}, h.db.WithContext(c.Request().Context()))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to plan config")
+	}
+
+	return c.JSON(http.StatusOK, plan)
+}
+
+// ApplyConfig brings the team's resources to the state a declarative config declares
+// @Summary Apply config
+// @Description Create, update and, with prune, delete templates, webhooks, SMTP configs and domains so they match the declarative config, in one transaction, and return the changes made. Applying the same config again changes nothing, so it can run on every CI pipeline. Nothing is applied when any change has an error, e.g. pruning a template still in use.
+// @Tags config
+// @Accept json
+// @Produce json
+// @Param request body models.DeclarativeConfig true "Desired state"
+// @Success 200 {object} models.ConfigPlan
+// @Failure 400 {object} map[string]string "Invalid config"
+// @Failure 409 {object} models.ConfigPlan "Config has changes that can't be applied"
+// @Router /api/v1/config/apply [post]
+func (h *ConfigHandler) ApplyConfig(c echo.Context) error {
+	teamID := c.Get("teamID").(string)
+
+	config, err := bindConfig(c)
+	if err != nil {
+		return err
+	}
+
+	plan, err := models.ApplyConfig(teamID, config, &templateHTMLStore{ctx: c.Request().Context()}, h.db.WithContext(c.Request().Context()))
+	if errors.Is(err, models.ErrConfigNotApplicable) {
+		return c.JSON(http.StatusConflict, plan)
+	}
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to apply config: "+err.Error())
+	}
+
+	return c.JSON(http.StatusOK, plan)
+}
@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"errors"
+	"kori/internal/models"
+	"kori/internal/utils/crypto"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+type ContactHandler struct {
+	db *gorm.DB
+}
+
+// MergeContactsRequest names the contact to keep and the one folded into it
+type MergeContactsRequest struct {
+	TargetID string `json:"targetId" validate:"required,uuid"`
+	SourceID string `json:"sourceId" validate:"required,uuid"`
+}
+
+func NewContactHandler(db *gorm.DB) *ContactHandler {
+	return &ContactHandler{db: db}
+}
+
+// ListDuplicates returns the team's contacts grouped by the email address they share
+// @Summary List duplicate contacts
+// @Description Group the team's contacts that share an email address, across all lists, oldest first
+// @Tags contacts
+// @Produce json
+// @Success 200 {array} models.ContactDuplicates
+// @Router /api/v1/contacts/duplicates [get]
+func (h *ContactHandler) ListDuplicates(c echo.Context) error {
+	teamID := c.Get("teamID").(string)
+
+	duplicates, err := models.FindDuplicateContacts(teamID, h.db)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to find duplicate contacts")
+	}
+
+	return c.JSON(http.StatusOK, duplicates)
+}
+
+// MergeContacts folds one contact into another
+// @Summary Merge contacts
+// @Description Move the source contact's emails, tracking history, tags and automation runs to the target, add its metadata and blank fields to the target and delete it. The target keeps its list; an unsubscribed, bounced or complained source passes its status on.
+// @Tags contacts
+// @Accept json
+// @Produce json
+// @Param request body MergeContactsRequest true "Contacts to merge"
+// @Success 200 {object} models.Contact "The merged contact"
+// @Failure 400 {object} map[string]string "Invalid request"
+// @Failure 404 {object} map[string]string "Contact not found"
+// @Router /api/v1/contacts/merge [post]
+func (h *ContactHandler) MergeContacts(c echo.Context) error {
+	teamID := c.Get("teamID").(string)
+
+	request := MergeContactsRequest{}
+	if err := c.Bind(&request); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request body")
+	}
+	if err := c.Validate(&request); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	contact, err := models.MergeContacts(teamID, request.TargetID, request.SourceID, h.db)
+	switch {
+	case errors.Is(err, models.ErrMergeSameContact):
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, "contact not found")
+	case err != nil:
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to merge contacts")
+	}
+
+	return c.JSON(http.StatusOK, contact)
+}
+
+// TimelineExportRequest asks for a contact's timeline as a file
+type TimelineExportRequest struct {
+	Format string `json:"format" validate:"required,oneof=PDF CSV"`
+	Reason string `json:"reason" validate:"omitempty,max=500"` // e.g. the case or ticket reference, printed on the export
+}
+
+// TimelineExportResponse is a timeline export with a link to the file once it's ready
+type TimelineExportResponse struct {
+	*models.ContactTimelineExport
+	DownloadURL        string `json:"downloadUrl,omitempty"`
+	SignatureAlgorithm string `json:"signatureAlgorithm,omitempty"`
+	PublicKey          string `json:"publicKey,omitempty"` // verifies the signature
+}
+
+// timelineExportLinkExpiry is how long a download link to a timeline export works
+const timelineExportLinkExpiry = time.Hour
+
+// CreateTimelineExport starts exporting a contact's timeline
+// @Summary Export contact timeline
+// @Description Produce a signed PDF or CSV of every email, engagement and consent event with the contact's address across the team's lists, e.g. for legal discovery or a support escalation. The export runs in the background; poll it until it's completed.
+// @Tags contacts
+// @Accept json
+// @Produce json
+// @Param id path string true "Contact ID"
+// @Param request body TimelineExportRequest true "Export format"
+// @Success 202 {object} models.ContactTimelineExport
+// @Failure 400 {object} map[string]string "Invalid request"
+// @Failure 404 {object} map[string]string "Contact not found"
+// @Router /api/v1/contacts/{id}/timeline-export [post]
+func (h *ContactHandler) CreateTimelineExport(c echo.Context) error {
+	teamID := c.Get("teamID").(string)
+
+	request := TimelineExportRequest{}
+	if err := c.Bind(&request); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request body")
+	}
+	request.Format = strings.ToUpper(request.Format)
+	if err := c.Validate(&request); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	contact := &models.Contact{}
+	if err := h.db.Where("id = ? AND team_id = ? AND is_deleted = false", c.Param("id"), teamID).First(contact).Error; err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "contact not found")
+	}
+
+	export := &models.ContactTimelineExport{
+		ContactID: contact.ID,
+		Email:     strings.ToLower(contact.Email),
+		TeamID:    teamID,
+		Format:    models.ContactTimelineExportFormat(request.Format),
+		Reason:    request.Reason,
+		Status:    models.ContactTimelineExportStatusPending,
+	}
+	if userID, ok := c.Get("userID").(string); ok {
+		export.RequestedByID = userID
+	}
+	if err := h.db.Create(export).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to create timeline export")
+	}
+
+	return c.JSON(http.StatusAccepted, export)
+}
+
+// GetTimelineExport returns a contact timeline export
+// @Summary Get contact timeline export
+// @Description The status of a timeline export and, once it's completed, a short-lived download link with the file's SHA-256 checksum and its RSA signature over that digest
+// @Tags contacts
+// @Produce json
+// @Param id path string true "Contact ID"
+// @Param exportId path string true "Export ID"
+// @Success 200 {object} TimelineExportResponse
+// @Failure 404 {object} map[string]string "Export not found"
+// @Router /api/v1/contacts/{id}/timeline-export/{exportId} [get]
+func (h *ContactHandler) GetTimelineExport(c echo.Context) error {
+	teamID := c.Get("teamID").(string)
+
+	export := &models.ContactTimelineExport{}
+	if err := h.db.Where("id = ? AND contact_id = ? AND team_id = ? AND is_deleted = false", c.Param("exportId"), c.Param("id"), teamID).
+		First(export).Error; err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "timeline export not found")
+	}
+
+	response := TimelineExportResponse{ContactTimelineExport: export}
+	if export.Status == models.ContactTimelineExportStatusCompleted {
+		storage := GetStorageHandler()
+		if storage == nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "storage handler not configured")
+		}
+		url, err := storage.GetSignedURL(c.Request().Context(), export.Path, timelineExportLinkExpiry)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to sign download link")
+		}
+		response.DownloadURL = url
+		response.SignatureAlgorithm = "RSA-SHA256"
+		if key, err := crypto.PublicKeyPEM(); err == nil {
+			response.PublicKey = key
+		}
+	}
+
+	return c.JSON(http.StatusOK, response)
+}
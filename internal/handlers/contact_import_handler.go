@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"kori/internal/events"
+	"kori/internal/models"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+type ContactImportHandler struct {
+	db *gorm.DB
+}
+
+func NewContactImportHandler(db *gorm.DB) *ContactImportHandler {
+	return &ContactImportHandler{db: db}
+}
+
+func (h *ContactImportHandler) getImport(c echo.Context) (*models.ContactImport, error) {
+	contactImport := &models.ContactImport{}
+	if err := h.db.Where("id = ? AND team_id = ? AND is_deleted = false", c.Param("id"), c.Get("teamID").(string)).
+		First(contactImport).Error; err != nil {
+		return nil, echo.NewHTTPError(http.StatusNotFound, "contact import not found")
+	}
+	return contactImport, nil
+}
+
+// GetContactImport returns an import with how many of its rows were imported, skipped and failed
+// @Summary Get contact import
+// @Description Get a contact import's status and row counts. Failed rows are listed in its error report.
+// @Tags imports
+// @Produce json
+// @Param id path string true "Import ID"
+// @Success 200 {object} models.ContactImport
+// @Failure 404 {object} map[string]string "Contact import not found"
+// @Router /api/v1/imports/{id} [get]
+func (h *ContactImportHandler) GetContactImport(c echo.Context) error {
+	contactImport, err := h.getImport(c)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, contactImport)
+}
+
+// ConfirmContactImport imports the rows of a dry run after its counts were reviewed
+// @Summary Confirm contact import
+// @Description Import the rows of a validated dry run. Its counts and error report are replaced by the import's own.
+// @Tags imports
+// @Produce json
+// @Param id path string true "Import ID"
+// @Success 200 {object} models.ContactImport
+// @Failure 404 {object} map[string]string "Contact import not found"
+// @Failure 409 {object} map[string]string "The import isn't a validated dry run"
+// @Router /api/v1/imports/{id}/confirm [post]
+func (h *ContactImportHandler) ConfirmContactImport(c echo.Context) error {
+	contactImport, err := h.getImport(c)
+	if err != nil {
+		return err
+	}
+
+	if err := models.ConfirmContactImport(contactImport, h.db); err != nil {
+		if errors.Is(err, models.ErrContactImportNotValidated) {
+			return echo.NewHTTPError(http.StatusConflict, err.Error())
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to confirm contact import")
+	}
+	events.Emit("contact_import.confirmed", contactImport)
+
+	return c.JSON(http.StatusOK, contactImport)
+}
+
+// GetContactImportErrors downloads the rows an import couldn't turn into contacts
+// @Summary Download contact import error report
+// @Description Download the row number, email and reason of every row the import failed, as CSV
+// @Tags imports
+// @Produce text/csv
+// @Param id path string true "Import ID"
+// @Success 200 {string} string "CSV error report"
+// @Failure 404 {object} map[string]string "Contact import not found"
+// @Router /api/v1/imports/{id}/errors [get]
+func (h *ContactImportHandler) GetContactImportErrors(c echo.Context) error {
+	contactImport, err := h.getImport(c)
+	if err != nil {
+		return err
+	}
+
+	rows, err := models.GetContactImportErrors(contactImport.ID, h.db)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get the error report")
+	}
+
+	c.Response().Header().Set(echo.HeaderContentType, "text/csv")
+	c.Response().Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=contact_import_errors_%s.csv", contactImport.ID))
+	c.Response().WriteHeader(http.StatusOK)
+
+	writer := csv.NewWriter(c.Response())
+	writer.Write([]string{"Row", "Email", "Error"})
+	for _, row := range rows {
+		writer.Write([]string{strconv.Itoa(row.Row), row.Email, row.Message})
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"kori/internal/events"
+	"kori/internal/models"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+type ContactSyncHandler struct {
+	db *gorm.DB
+}
+
+func NewContactSyncHandler(db *gorm.DB) *ContactSyncHandler {
+	return &ContactSyncHandler{db: db}
+}
+
+// RunSync queues an immediate sync of a contact sync source
+// @Summary Run contact sync
+// @Description Queue an immediate sync of a remote contact feed into its mailing list
+// @Tags contact-syncs
+// @Produce json
+// @Param id path string true "Contact sync source ID"
+// @Success 202 {object} map[string]string "Contact sync queued"
+// @Failure 404 {object} map[string]string "Contact sync source not found"
+// @Router /api/v1/contact-syncs/{id}/run [post]
+func (h *ContactSyncHandler) RunSync(c echo.Context) error {
+	teamID := c.Get("teamID").(string)
+
+	source := &models.ContactSyncSource{}
+	if err := h.db.Where("id = ? AND team_id = ? AND is_deleted = false", c.Param("id"), teamID).First(source).Error; err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "contact sync source not found")
+	}
+
+	events.Emit("contact_sync.requested", source)
+
+	return c.JSON(http.StatusAccepted, map[string]string{"message": "Contact sync queued"})
+}
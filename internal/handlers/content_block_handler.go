@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"kori/internal/models"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+type ContentBlockHandler struct {
+	db *gorm.DB
+}
+
+// ContentBlockPreviewRequest renders html for a contact, or for no one in particular
+type ContentBlockPreviewRequest struct {
+	HTML      string `json:"html" validate:"required"`
+	ContactID string `json:"contactId" validate:"omitempty,uuid"`
+}
+
+// ContentBlockPreviewResponse is the rendered html and the variant chosen for each block
+type ContentBlockPreviewResponse struct {
+	HTML     string            `json:"html"`
+	Variants map[string]string `json:"variants"`
+}
+
+func NewContentBlockHandler(db *gorm.DB) *ContentBlockHandler {
+	return &ContentBlockHandler{db: db}
+}
+
+// GetContentBlockStats returns the engagement of each variant of a content block
+// @Summary Get content block stats
+// @Description Get sent, open and click counts for each variant of a content block
+// @Tags content-blocks
+// @Produce json
+// @Param id path string true "Content block ID"
+// @Success 200 {array} models.ContentVariantStats
+// @Failure 404 {object} map[string]string "Content block not found"
+// @Router /api/v1/content-blocks/{id}/stats [get]
+func (h *ContentBlockHandler) GetContentBlockStats(c echo.Context) error {
+	teamID := c.Get("teamID").(string)
+
+	block := &models.ContentBlock{}
+	if err := h.db.Where("id = ? AND team_id = ? AND is_deleted = false", c.Param("id"), teamID).First(block).Error; err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "content block not found")
+	}
+
+	stats, err := models.GetContentBlockStats(block, h.db)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get content block stats")
+	}
+
+	return c.JSON(http.StatusOK, stats)
+}
+
+// PreviewContentBlocks renders the content blocks in html as a contact would receive them
+// @Summary Preview content blocks
+// @Description Render the content blocks in html for a contact; without a contact only untargeted variants are used
+// @Tags content-blocks
+// @Accept json
+// @Produce json
+// @Param request body ContentBlockPreviewRequest true "Preview request"
+// @Success 200 {object} ContentBlockPreviewResponse
+// @Failure 400 {object} map[string]string "Invalid request"
+// @Failure 404 {object} map[string]string "Contact not found"
+// @Router /api/v1/content-blocks/preview [post]
+func (h *ContentBlockHandler) PreviewContentBlocks(c echo.Context) error {
+	teamID := c.Get("teamID").(string)
+
+	var req ContentBlockPreviewRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request")
+	}
+	if err := c.Validate(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	var contact *models.Contact
+	var contactIDs []string
+	if req.ContactID != "" {
+		contact = &models.Contact{}
+		if err := h.db.Where("id = ? AND team_id = ? AND is_deleted = false", req.ContactID, teamID).First(contact).Error; err != nil {
+			return echo.NewHTTPError(http.StatusNotFound, "contact not found")
+		}
+		contactIDs = []string{contact.ID}
+	}
+
+	renderer, err := models.NewContentBlockRenderer(teamID, []string{req.HTML}, contactIDs, h.db)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to load content blocks")
+	}
+
+	html, variants := renderer.Render(req.HTML, contact)
+	return c.JSON(http.StatusOK, ContentBlockPreviewResponse{HTML: html, Variants: variants})
+}
@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"kori/internal/models"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// DataSubjectHandler lets platform operators answer GDPR access and erasure requests, which
+// cover an address on every team
+type DataSubjectHandler struct {
+	db *gorm.DB
+}
+
+func NewDataSubjectHandler(db *gorm.DB) *DataSubjectHandler {
+	return &DataSubjectHandler{db: db}
+}
+
+// DataSubjectExportRequest asks for the data held about an address
+type DataSubjectExportRequest struct {
+	Email     string                         `json:"email" validate:"required,email"`
+	Format    models.DataSubjectExportFormat `json:"format" validate:"omitempty,oneof=json csv"` // json by default
+	Reference string                         `json:"reference"`
+}
+
+// DataSubjectErasureRequest asks for the data held about an address to be erased
+type DataSubjectErasureRequest struct {
+	Email        string `json:"email" validate:"required,email"`
+	Reference    string `json:"reference"`
+	Verification string `json:"verification" validate:"required"` // how the subject proved the address is theirs
+}
+
+// DataSubjectExecuteRequest confirms an erasure by repeating the address it is for
+type DataSubjectExecuteRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// ExportDataSubject downloads everything held about an address
+// @Summary Export a data subject's data
+// @Description The contacts, preferences, automation runs, emails and tracking events of an address on every team, as one JSON document or a zip archive of CSV files. The export is recorded, keeping only a hash of the address. Super admins only.
+// @Tags admin
+// @Accept json
+// @Produce application/json,application/zip
+// @Param request body DataSubjectExportRequest true "Address to export"
+// @Success 200 {file} binary
+// @Failure 400 {object} map[string]string "Invalid request"
+// @Router /api/v1/admin/privacy/exports [post]
+func (h *DataSubjectHandler) ExportDataSubject(c echo.Context) error {
+	var req DataSubjectExportRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request body")
+	}
+	if err := c.Validate(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if req.Format == "" {
+		req.Format = models.DataSubjectExportJSON
+	}
+
+	db := h.db.WithContext(c.Request().Context())
+	summary, err := models.GetDataSubjectSummary(req.Email, db)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to count data")
+	}
+	request, err := h.createRequest(c, models.DataSubjectRequestExport, req.Email, req.Reference, "", summary)
+	if err != nil {
+		return err
+	}
+
+	contentType, ext := echo.MIMEApplicationJSON, "json"
+	if req.Format == models.DataSubjectExportCSV {
+		contentType, ext = "application/zip", "zip"
+	}
+	c.Response().Header().Set(echo.HeaderContentType, contentType)
+	c.Response().Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=data_subject_%s.%s", request.ID, ext))
+	c.Response().WriteHeader(http.StatusOK)
+
+	// The status is out already, so a failure can only cut the download short
+	if err := models.ExportDataSubject(req.Email, req.Format, db, c.Response()); err != nil {
+		log.Error("failed to export data subject", err)
+	}
+	return nil
+}
+
+// CreateErasure records an erasure request and shows what executing it would erase
+// @Summary Request a data subject's erasure
+// @Description Records how the subject was verified and counts the contacts, emails and tracking events of the address on every team. Nothing is erased until the request is executed. Super admins only.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param request body DataSubjectErasureRequest true "Address to erase"
+// @Success 201 {object} models.DataSubjectRequest
+// @Failure 400 {object} map[string]string "Invalid request"
+// @Router /api/v1/admin/privacy/erasures [post]
+func (h *DataSubjectHandler) CreateErasure(c echo.Context) error {
+	var req DataSubjectErasureRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request body")
+	}
+	if err := c.Validate(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	summary, err := models.GetDataSubjectSummary(req.Email, h.db)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to count data")
+	}
+	request, err := h.createRequest(c, models.DataSubjectRequestErasure, req.Email, req.Reference, req.Verification, summary)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusCreated, request)
+}
+
+// ExecuteErasure erases the data held about the address of an erasure request
+// @Summary Execute a data subject's erasure
+// @Description Hard deletes the address's contacts on every team, with their tags, preferences and automation runs, and anonymizes its emails and tracking events. The address must be repeated and match the request. Super admins only.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path string true "Erasure request ID"
+// @Param request body DataSubjectExecuteRequest true "The address the request is for"
+// @Success 200 {object} models.DataSubjectRequest
+// @Failure 400 {object} map[string]string "The address doesn't match the request"
+// @Failure 404 {object} map[string]string "Erasure request not found"
+// @Failure 409 {object} map[string]string "Already executed"
+// @Router /api/v1/admin/privacy/erasures/{id}/execute [post]
+func (h *DataSubjectHandler) ExecuteErasure(c echo.Context) error {
+	var req DataSubjectExecuteRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request body")
+	}
+	if err := c.Validate(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	request := &models.DataSubjectRequest{}
+	if err := h.db.Where("id = ? AND type = ?", c.Param("id"), models.DataSubjectRequestErasure).First(request).Error; err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "erasure request not found")
+	}
+
+	userID, _ := c.Get("userID").(string)
+	if err := models.EraseDataSubject(request, req.Email, userID, h.db); err != nil {
+		switch {
+		case errors.Is(err, models.ErrDataSubjectMismatch):
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		case errors.Is(err, models.ErrDataSubjectRequestCompleted):
+			return echo.NewHTTPError(http.StatusConflict, err.Error())
+		}
+		log.Error("failed to erase data subject", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to erase data")
+	}
+
+	return c.JSON(http.StatusOK, request)
+}
+
+// ListDataSubjectRequests lists the exports and erasures done, newest first
+// @Summary List data subject requests
+// @Tags admin
+// @Produce json
+// @Param email query string false "Only the requests for this address"
+// @Param type query string false "Request type" Enums(EXPORT, ERASURE)
+// @Param page query int false "Page (default 1)"
+// @Param limit query int false "Page size (default 25, max 100)"
+// @Success 200 {array} models.DataSubjectRequest
+// @Router /api/v1/admin/privacy/requests [get]
+func (h *DataSubjectHandler) ListDataSubjectRequests(c echo.Context) error {
+	page, limit := 1, 25
+	if value := c.QueryParam("page"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid page")
+		}
+		page = parsed
+	}
+	if value := c.QueryParam("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > 100 {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid limit")
+		}
+		limit = parsed
+	}
+
+	query := h.db.Model(&models.DataSubjectRequest{})
+	if email := c.QueryParam("email"); email != "" {
+		query = query.Where("email_hash = ?", models.HashDataSubjectEmail(email))
+	}
+	if requestType := c.QueryParam("type"); requestType != "" {
+		query = query.Where("type = ?", requestType)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to count requests")
+	}
+	requests := []models.DataSubjectRequest{}
+	if err := query.Order("created_at DESC").Offset((page - 1) * limit).Limit(limit).Find(&requests).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get requests")
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":  requests,
+		"total": total,
+		"page":  page,
+		"limit": limit,
+	})
+}
+
+func (h *DataSubjectHandler) createRequest(c echo.Context, requestType models.DataSubjectRequestType, email, reference, verification string, summary *models.DataSubjectSummary) (*models.DataSubjectRequest, error) {
+	request := &models.DataSubjectRequest{
+		Type:           requestType,
+		EmailHash:      models.HashDataSubjectEmail(email),
+		Reference:      reference,
+		Verification:   verification,
+		Status:         models.DataSubjectRequestStatusPending,
+		Teams:          summary.Teams,
+		Contacts:       summary.Contacts,
+		Emails:         summary.Emails,
+		TrackingEvents: summary.TrackingEvents,
+	}
+	request.RequestedByID, _ = c.Get("userID").(string)
+	if requestType == models.DataSubjectRequestExport {
+		now := time.Now()
+		request.Status = models.DataSubjectRequestStatusCompleted
+		request.CompletedAt = &now
+	}
+	if err := h.db.Create(request).Error; err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, "failed to record request")
+	}
+	return request, nil
+}
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"kori/internal/config"
+	"kori/internal/models"
+	"kori/internal/utils"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+type DomainHandler struct {
+	db *gorm.DB
+}
+
+func NewDomainHandler(db *gorm.DB) *DomainHandler {
+	return &DomainHandler{db: db}
+}
+
+// VerifyDomain checks a domain's DNS records and stores the per-record results
+// @Summary Verify domain
+// @Description Check the ownership TXT record, SPF include, DKIM selector and DMARC policy of a domain
+// @Tags domains
+// @Produce json
+// @Param id path string true "Domain ID"
+// @Success 200 {object} models.Domain
+// @Failure 404 {object} map[string]string "Domain not found"
+// @Failure 500 {object} map[string]string "Verification failed"
+// @Router /api/v1/domains/{id}/verify [post]
+func (h *DomainHandler) VerifyDomain(c echo.Context) error {
+	teamID := c.Get("teamID").(string)
+
+	domain := &models.Domain{}
+	if err := h.db.Where("id = ? AND team_id = ? AND is_deleted = false", c.Param("id"), teamID).First(domain).Error; err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "domain not found")
+	}
+
+	if err := utils.RunDomainVerification(c.Request().Context(), h.db, domain, config.GetConfig().Domain.SPFInclude); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to verify domain")
+	}
+
+	return c.JSON(http.StatusOK, domain)
+}
@@ -1,12 +1,22 @@
 package handlers
 
 import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"kori/internal/db"
 	"kori/internal/events"
 	"kori/internal/models"
+	"kori/internal/utils"
 	"net/http"
+	"strings"
 	"time"
 
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 	"gorm.io/datatypes"
 )
@@ -15,9 +25,10 @@ type SendEmailRequest struct {
 	TemplateID         string         `json:"templateId"`
 	To                 string         `json:"to" validate:"required,email"`
 	Variables          datatypes.JSON `json:"data" validate:"required,json"`
-	SMTPConfigProvider string         `json:"provider" validate:"omitempty,oneof=CUSTOM GMAIL OUTLOOK AMAZON"`
+	SMTPConfigProvider string         `json:"provider" validate:"omitempty,oneof=CUSTOM GMAIL OUTLOOK AMAZON SENDGRID MAILGUN POSTMARK"`
 	Subject            string         `json:"subject"`
 	Body               string         `json:"html"`
+	Text               string         `json:"text"` // plain text alternative, generated from the html when blank
 	CC                 string         `json:"cc"`
 	BCC                string         `json:"bcc"`
 	ReplyTo            string         `json:"replyTo"`
@@ -61,12 +72,36 @@ func SendEmail(c echo.Context) error {
 		Subject:      req.Subject,
 		Data:         req.Variables,
 		Body:         req.Body,
+		PlainText:    req.Text,
 		CC:           req.CC,
 		BCC:          req.BCC,
 		ReplyTo:      req.ReplyTo,
 		Test:         req.Test,
 		SendAt:       req.SendAt,
 	}
+	if err := email.NormalizeRecipients(); err != nil {
+		tx.Rollback()
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	// Test emails are free, so like template tests they only go to members of the team, and
+	// everything else takes a credit of the team's monthly quota
+	if email.Test {
+		var members int64
+		if err := tx.Model(&models.User{}).
+			Where("team_id = ? AND LOWER(email) = ? AND is_deleted = false", teamID, strings.ToLower(email.To)).
+			Count(&members).Error; err != nil {
+			tx.Rollback()
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to check recipient")
+		}
+		if members == 0 || email.CC != "" || email.BCC != "" {
+			tx.Rollback()
+			return echo.NewHTTPError(http.StatusForbidden, "Test emails can only be sent to members of the team")
+		}
+	} else if err := models.ConsumeQuota(teamID, models.QuotaResourceEmails, 1, db.GetDB()); err != nil {
+		tx.Rollback()
+		return sendQuotaError(err)
+	}
 
 	events.Emit("email.send", &email)
 
@@ -74,3 +109,317 @@ func SendEmail(c echo.Context) error {
 		"status": "Email queued successfully",
 	})
 }
+
+// IdempotencyKeyHeader is the header API clients set to make retried sends safe
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+type SendTransactionalEmailRequest struct {
+	TemplateID  string                 `json:"templateId" validate:"required_without=HTML,omitempty,uuid"`
+	HTML        string                 `json:"html" validate:"required_without=TemplateID"`
+	Text        string                 `json:"text"` // plain text alternative, generated from the html when blank
+	Subject     string                 `json:"subject" validate:"required_without=TemplateID"`
+	To          string                 `json:"to" validate:"required,email"`
+	Variables   map[string]interface{} `json:"variables"` // strings, or arrays and objects for templates to loop over
+	Provider    string                 `json:"provider" validate:"omitempty,oneof=CUSTOM GMAIL OUTLOOK AMAZON SENDGRID MAILGUN POSTMARK"`
+	CC          string                 `json:"cc" validate:"omitempty,email_list"`  // comma separated
+	BCC         string                 `json:"bcc" validate:"omitempty,email_list"` // comma separated
+	ReplyTo     string                 `json:"replyTo" validate:"omitempty,email"`
+	SendAt      time.Time              `json:"scheduleAt"`
+	Attachments []AttachmentRequest    `json:"attachments" validate:"omitempty,dive"`
+	SignatureID string                 `json:"signatureId" validate:"omitempty,uuid"` // a team signature, or one of the caller's, to sign with
+}
+
+// AttachmentRequest is a file to attach: either one already uploaded through /api/v1/files/upload
+// or one uploaded with the send as base64 content
+type AttachmentRequest struct {
+	FileID      string `json:"fileId" validate:"required_without=Content,omitempty,uuid"`
+	Filename    string `json:"filename" validate:"required_with=Content"`
+	ContentType string `json:"contentType"`
+	Content     string `json:"content" validate:"omitempty,base64"`
+}
+
+// SendTransactionalEmail queues a single email and returns its ID. Requests carrying an
+// Idempotency-Key header that was already used in the last 24 hours return the original
+// email's ID instead of sending again.
+// @Summary Send a transactional email
+// @Description Send an email from a template or raw HTML, with optional attachments. Emails go out as multipart/alternative with a plain text part, the given text or one generated from the HTML. A preheader variable sets the inbox preview text, and a signatureId appends that signature. Retries with the same Idempotency-Key return the original email ID.
+// @Tags Email
+// @Accept json
+// @Produce json
+// @Param Idempotency-Key header string false "Unique key for this send, honoured for 24 hours"
+// @Param request body SendTransactionalEmailRequest true "Email request"
+// @Security BearerAuth
+// @Success 202 {object} map[string]string "Email queued"
+// @Success 200 {object} map[string]string "Email already queued for this key"
+// @Failure 400 {object} map[string]string "Validation error"
+// @Failure 402 {object} map[string]string "The team's monthly email quota is used up"
+// @Failure 422 {object} map[string]string "Idempotency key reused with a different request"
+// @Router /api/v1/emails/send [post]
+func SendTransactionalEmail(c echo.Context) error {
+	var req SendTransactionalEmailRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+	if err := c.Validate(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	key := strings.TrimSpace(c.Request().Header.Get(IdempotencyKeyHeader))
+	if len(key) > 255 {
+		return echo.NewHTTPError(http.StatusBadRequest, "Idempotency-Key must be at most 255 characters")
+	}
+
+	teamID := c.Get("teamID").(string)
+	database := db.GetDB()
+
+	smtpConfig, err := models.GetSMTPConfig(teamID, "", req.Provider, database)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "No SMTP config found for this team")
+	}
+
+	if req.TemplateID != "" {
+		var count int64
+		if err := database.Model(&models.Template{}).Where("id = ? AND team_id = ? AND is_deleted = false", req.TemplateID, teamID).Count(&count).Error; err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get template")
+		}
+		if count == 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "Template not found")
+		}
+	}
+
+	variables, err := json.Marshal(req.Variables)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid variables")
+	}
+
+	signature := ""
+	if req.SignatureID != "" {
+		userID, _ := c.Get("userID").(string)
+		found, err := models.GetSignature(teamID, userID, req.SignatureID, database)
+		if err != nil {
+			if errors.Is(err, models.ErrSignatureNotFound) {
+				return echo.NewHTTPError(http.StatusBadRequest, "Signature not found")
+			}
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get signature")
+		}
+		signatureVariables, err := models.GetSignatureVariables(found, userID, database)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get signature variables")
+		}
+		signature = utils.RenderSignature(found.HTML, signatureVariables)
+	}
+
+	// Check the attachments fit before anything is uploaded
+	var fileIDs []string
+	var inline []AttachmentRequest
+	var inlineContent [][]byte
+	var inlineSize int64
+	for _, attachment := range req.Attachments {
+		if attachment.FileID != "" {
+			fileIDs = append(fileIDs, attachment.FileID)
+			continue
+		}
+		content, err := base64.StdEncoding.DecodeString(attachment.Content)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid attachment content")
+		}
+		inline = append(inline, attachment)
+		inlineContent = append(inlineContent, content)
+		inlineSize += int64(len(content))
+	}
+	if len(req.Attachments) > models.MaxAttachmentsPerEmail {
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, fmt.Sprintf("At most %d attachments can be sent with an email", models.MaxAttachmentsPerEmail))
+	}
+	files, err := models.GetAttachmentFiles(teamID, fileIDs, database)
+	if err != nil {
+		var attachmentErr *models.ValidationError
+		if errors.As(err, &attachmentErr) {
+			return echo.NewHTTPError(attachmentErr.StatusCode(), attachmentErr.Error())
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get attachments")
+	}
+	total := inlineSize
+	for _, file := range files {
+		total += file.Size
+	}
+	if total > models.MaxAttachmentsSize {
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, fmt.Sprintf("Attachments are %d bytes, the limit is %d", total, models.MaxAttachmentsSize))
+	}
+
+	email := models.Email{
+		TeamID:         teamID,
+		TemplateID:     req.TemplateID,
+		To:             req.To,
+		SMTPConfigID:   smtpConfig.ID,
+		Subject:        req.Subject,
+		Data:           variables,
+		Body:           req.HTML,
+		PlainText:      req.Text,
+		CC:             req.CC,
+		BCC:            req.BCC,
+		ReplyTo:        req.ReplyTo,
+		SendAt:         req.SendAt,
+		IdempotencyKey: key,
+		Signature:      signature,
+	}
+	email.ID = uuid.New().String()
+	if err := email.NormalizeRecipients(); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if key != "" {
+		body, err := json.Marshal(req)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to hash request")
+		}
+		hash := sha256.Sum256(body)
+
+		existing, claimed, err := models.ClaimIdempotencyKey(teamID, key, hex.EncodeToString(hash[:]), email.ID, database)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to check idempotency key")
+		}
+		if !claimed {
+			if existing.RequestHash != hex.EncodeToString(hash[:]) {
+				return echo.NewHTTPError(http.StatusUnprocessableEntity, "Idempotency-Key was already used for a different request")
+			}
+			c.Response().Header().Set("Idempotent-Replayed", "true")
+			return c.JSON(http.StatusOK, map[string]string{
+				"id":     existing.EmailID,
+				"status": "Email already queued",
+			})
+		}
+	}
+
+	// Replays above don't count against the quota, only emails that are queued
+	if err := models.ConsumeQuota(teamID, models.QuotaResourceEmails, 1, database); err != nil {
+		if key != "" {
+			models.ReleaseIdempotencyKey(teamID, key, email.ID, database)
+		}
+		return sendQuotaError(err)
+	}
+
+	if len(inline) > 0 {
+		uploaded, err := uploadAttachments(c, teamID, inline, inlineContent)
+		if err != nil {
+			if key != "" {
+				models.ReleaseIdempotencyKey(teamID, key, email.ID, database)
+			}
+			models.RefundQuota(teamID, models.QuotaResourceEmails, 1, database)
+			return err
+		}
+		files = append(files, uploaded...)
+	}
+	for _, file := range files {
+		email.Attachments = append(email.Attachments, models.EmailAttachment{FileID: file.ID, TeamID: teamID})
+	}
+
+	events.Emit("email.send", &email)
+
+	return c.JSON(http.StatusAccepted, map[string]string{
+		"id":     email.ID,
+		"status": "Email queued successfully",
+	})
+}
+
+// sendQuotaError is the response to a send the team's quota couldn't take
+func sendQuotaError(err error) error {
+	var exceeded *models.QuotaExceededError
+	if errors.As(err, &exceeded) {
+		return echo.NewHTTPError(http.StatusPaymentRequired, exceeded.Error())
+	}
+	return echo.NewHTTPError(http.StatusInternalServerError, "Failed to check sending quota")
+}
+
+// EmailStatusesResponse is where each of the requested emails stands
+type EmailStatusesResponse struct {
+	Emails  []models.EmailStatusEntry `json:"emails"`
+	Missing []string                  `json:"missing"` // IDs that aren't emails of the team
+}
+
+// GetEmailStatuses returns the status of many emails at once
+// @Summary Get email statuses
+// @Description Look up the delivery status of up to 500 emails in one request, so high-volume senders can reconcile without polling each email. Webhooks subscribed to email.status get the same entries pushed as a digest every minute.
+// @Tags Email
+// @Produce json
+// @Param ids query string true "Comma-separated email IDs"
+// @Security BearerAuth
+// @Success 200 {object} EmailStatusesResponse
+// @Failure 400 {object} map[string]string "No IDs, too many IDs or an invalid ID"
+// @Router /api/v1/emails/status [get]
+func GetEmailStatuses(c echo.Context) error {
+	teamID := c.Get("teamID").(string)
+
+	var ids []string
+	seen := make(map[string]bool)
+	for _, id := range strings.Split(c.QueryParam("ids"), ",") {
+		id = strings.TrimSpace(id)
+		if id == "" || seen[id] {
+			continue
+		}
+		if _, err := uuid.Parse(id); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid email ID %q", id))
+		}
+		seen[id] = true
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "ids is required")
+	}
+	if len(ids) > models.MaxEmailStatusIDs {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("At most %d emails can be looked up at once", models.MaxEmailStatusIDs))
+	}
+
+	entries, err := models.GetEmailStatuses(teamID, ids, db.GetDB())
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get email statuses")
+	}
+
+	found := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		found[entry.ID] = true
+	}
+	missing := []string{}
+	for _, id := range ids {
+		if !found[id] {
+			missing = append(missing, id)
+		}
+	}
+
+	return c.JSON(http.StatusOK, EmailStatusesResponse{Emails: entries, Missing: missing})
+}
+
+// uploadAttachments stores attachments sent inline with an email and records them as team files
+func uploadAttachments(c echo.Context, teamID string, attachments []AttachmentRequest, contents [][]byte) ([]models.File, error) {
+	storage := GetStorageHandler()
+	if storage == nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, "Storage handler not configured")
+	}
+	userID, _ := c.Get("userID").(string)
+
+	files := make([]models.File, 0, len(attachments))
+	for i, attachment := range attachments {
+		contentType := attachment.ContentType
+		if contentType == "" {
+			contentType = http.DetectContentType(contents[i])
+		}
+
+		url, err := storage.UploadFile(c.Request().Context(), contents[i], attachment.Filename, types.ObjectCannedACLAuthenticatedRead, contentType)
+		if err != nil {
+			return nil, echo.NewHTTPError(http.StatusInternalServerError, "Failed to upload attachment")
+		}
+
+		file := models.File{
+			TeamID: teamID,
+			UserID: userID,
+			Path:   url[strings.LastIndex(url, "/")+1:],
+			Name:   attachment.Filename,
+			Size:   int64(len(contents[i])),
+			Type:   contentType,
+		}
+		if err := db.GetDB().Create(&file).Error; err != nil {
+			return nil, echo.NewHTTPError(http.StatusInternalServerError, "Failed to save attachment")
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"kori/internal/models"
+	"kori/internal/utils"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+type EmbedTokenHandler struct {
+	db *gorm.DB
+}
+
+func NewEmbedTokenHandler(db *gorm.DB) *EmbedTokenHandler {
+	return &EmbedTokenHandler{db: db}
+}
+
+// CreateEmbedTokenRequest is what an embed token grants and for how long
+type CreateEmbedTokenRequest struct {
+	Scopes     []string `json:"scopes"`                                          // defaults to analytics:read
+	CampaignID string   `json:"campaignId" validate:"omitempty,uuid"`            // restricts the token to one campaign
+	TTLSeconds int      `json:"ttlSeconds" validate:"omitempty,min=60,max=3600"` // defaults to 15 minutes
+}
+
+// EmbedTokenResponse is a minted embed token
+type EmbedTokenResponse struct {
+	models.EmbedToken
+	Token string `json:"token"` // sent by the widget as X-Embed-Token or the embed_token query parameter
+}
+
+// CreateEmbedToken mints a short-lived token for an embedded widget
+// @Summary Create embed token
+// @Description Mint a read-only token for analytics widgets embedded in the team's own dashboards, optionally restricted to one campaign. Tokens last 15 minutes by default and at most an hour.
+// @Tags embed-tokens
+// @Accept json
+// @Produce json
+// @Param request body CreateEmbedTokenRequest true "Scopes, campaign and lifetime"
+// @Success 201 {object} EmbedTokenResponse
+// @Failure 400 {object} map[string]string "Invalid scope, lifetime or campaign"
+// @Router /api/v1/embed-tokens [post]
+func (h *EmbedTokenHandler) CreateEmbedToken(c echo.Context) error {
+	teamID := c.Get("teamID").(string)
+
+	req := new(CreateEmbedTokenRequest)
+	if err := c.Bind(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request body")
+	}
+	if err := c.Validate(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if len(req.Scopes) == 0 {
+		req.Scopes = []string{"analytics:read"}
+	}
+	for _, scope := range req.Scopes {
+		if _, ok := models.EmbedTokenScopes[scope]; !ok {
+			return echo.NewHTTPError(http.StatusBadRequest, "scope "+scope+" can't be given to an embed token")
+		}
+	}
+	slices.Sort(req.Scopes)
+	req.Scopes = slices.Compact(req.Scopes)
+
+	if req.CampaignID != "" {
+		if err := h.db.Where("id = ? AND team_id = ? AND is_deleted = false", req.CampaignID, teamID).
+			First(&models.Campaign{}).Error; err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "campaign not found")
+		}
+	}
+
+	ttl := models.DefaultEmbedTokenTTL
+	if req.TTLSeconds > 0 {
+		ttl = time.Duration(req.TTLSeconds) * time.Second
+	}
+
+	embed := &models.EmbedToken{
+		TeamID:     teamID,
+		CampaignID: req.CampaignID,
+		Scopes:     req.Scopes,
+		ExpiresAt:  time.Now().Add(min(ttl, models.MaxEmbedTokenTTL)),
+	}
+	if userID, ok := c.Get("userID").(string); ok {
+		embed.CreatedByUserID = userID
+	}
+	if apiKeyID, ok := c.Get("apiKeyID").(string); ok {
+		embed.CreatedByAPIKeyID = apiKeyID
+	}
+
+	// Tokens are minted per page view, so the long expired ones are cleared as new ones come
+	if err := models.PruneEmbedTokens(teamID, h.db); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to clear expired embed tokens")
+	}
+	if err := h.db.Create(embed).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to create embed token")
+	}
+
+	token, err := utils.GenerateEmbedToken(*embed)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to sign embed token")
+	}
+
+	return c.JSON(http.StatusCreated, &EmbedTokenResponse{EmbedToken: *embed, Token: token})
+}
+
+// RevokeEmbedToken revokes an embed token before it expires
+// @Summary Revoke embed token
+// @Description Stop an embed token from working straight away
+// @Tags embed-tokens
+// @Param id path string true "Embed token ID"
+// @Success 204
+// @Failure 404 {object} map[string]string "Embed token not found"
+// @Router /api/v1/embed-tokens/{id} [delete]
+func (h *EmbedTokenHandler) RevokeEmbedToken(c echo.Context) error {
+	teamID := c.Get("teamID").(string)
+
+	result := h.db.Model(&models.EmbedToken{}).
+		Where("id = ? AND team_id = ? AND is_deleted = false", c.Param("id"), teamID).
+		Update("is_deleted", true)
+	if result.Error != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to revoke embed token")
+	}
+	if result.RowsAffected == 0 {
+		return echo.NewHTTPError(http.StatusNotFound, "embed token not found")
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"errors"
+	"kori/internal/models"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+var featureFlagKeyRe = regexp.MustCompile(`^[a-z][a-z0-9_.-]*$`)
+
+type FeatureFlagHandler struct {
+	db *gorm.DB
+}
+
+func NewFeatureFlagHandler(db *gorm.DB) *FeatureFlagHandler {
+	return &FeatureFlagHandler{db: db}
+}
+
+// FeatureFlagRequest is a feature flag as platform operators configure it
+type FeatureFlagRequest struct {
+	Key            string   `json:"key" validate:"required,min=2,max=64"` // lowercase letters, digits, _ . and -
+	Description    string   `json:"description"`
+	Enabled        bool     `json:"enabled"`
+	RolloutPercent int      `json:"rolloutPercent" validate:"min=0,max=100"`
+	TeamAllowlist  []string `json:"teamAllowlist" validate:"omitempty,dive,uuid"`
+}
+
+func (r *FeatureFlagRequest) apply(flag *models.FeatureFlag) {
+	flag.Key = r.Key
+	flag.Description = r.Description
+	flag.Enabled = r.Enabled
+	flag.RolloutPercent = r.RolloutPercent
+	flag.TeamAllowlist = r.TeamAllowlist
+	if flag.TeamAllowlist == nil {
+		flag.TeamAllowlist = []string{}
+	}
+}
+
+// bindFeatureFlag binds and validates a feature flag request
+func bindFeatureFlag(c echo.Context) (*FeatureFlagRequest, error) {
+	req := new(FeatureFlagRequest)
+	if err := c.Bind(req); err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "invalid request body")
+	}
+	if err := c.Validate(req); err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if !featureFlagKeyRe.MatchString(req.Key) {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "key must start with a lowercase letter and only have lowercase letters, digits, _ . and -")
+	}
+	return req, nil
+}
+
+// saveFeatureFlagError maps an error saving a feature flag to the response
+func saveFeatureFlagError(err error) error {
+	if errors.Is(err, models.ErrFeatureFlagKeyTaken) {
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	}
+	return echo.NewHTTPError(http.StatusInternalServerError, "failed to save feature flag")
+}
+
+// GetFeatureFlags returns whether each feature flag is on for the team
+// @Summary Get feature flags
+// @Description Whether each feature flag is on for the team, by key, so the frontend shows features as they're rolled out. Unknown keys are off.
+// @Tags feature-flags
+// @Produce json
+// @Success 200 {object} map[string]bool
+// @Router /api/v1/feature-flags [get]
+func (h *FeatureFlagHandler) GetFeatureFlags(c echo.Context) error {
+	teamID := c.Get("teamID").(string)
+
+	flags, err := models.EvaluateFeatureFlags(teamID, h.db)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get feature flags")
+	}
+
+	return c.JSON(http.StatusOK, flags)
+}
+
+// ListFeatureFlags lists every feature flag
+// @Summary List feature flags
+// @Description Every feature flag with its rollout, for platform operators
+// @Tags feature-flags
+// @Produce json
+// @Success 200 {array} models.FeatureFlag
+// @Router /api/v1/admin/feature-flags [get]
+func (h *FeatureFlagHandler) ListFeatureFlags(c echo.Context) error {
+	var flags []models.FeatureFlag
+	if err := h.db.Where("is_deleted = false").Order("key").Find(&flags).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to list feature flags")
+	}
+
+	return c.JSON(http.StatusOK, flags)
+}
+
+// CreateFeatureFlag adds a feature flag
+// @Summary Create feature flag
+// @Description Add a feature flag. It's on for the allowlisted teams and the rollout percentage of the others once enabled.
+// @Tags feature-flags
+// @Accept json
+// @Produce json
+// @Param request body FeatureFlagRequest true "Feature flag"
+// @Success 201 {object} models.FeatureFlag
+// @Failure 400 {object} map[string]string "Invalid feature flag"
+// @Failure 409 {object} map[string]string "Key already taken"
+// @Router /api/v1/admin/feature-flags [post]
+func (h *FeatureFlagHandler) CreateFeatureFlag(c echo.Context) error {
+	req, err := bindFeatureFlag(c)
+	if err != nil {
+		return err
+	}
+
+	flag := &models.FeatureFlag{}
+	req.apply(flag)
+	if err := h.db.Create(flag).Error; err != nil {
+		return saveFeatureFlagError(err)
+	}
+
+	return c.JSON(http.StatusCreated, flag)
+}
+
+// UpdateFeatureFlag changes a feature flag's rollout
+// @Summary Update feature flag
+// @Description Turn a feature flag on or off, or change its rollout percentage or allowlist. Teams keep their rollout bucket, so raising the percentage only adds teams.
+// @Tags feature-flags
+// @Accept json
+// @Produce json
+// @Param id path string true "Feature flag ID"
+// @Param request body FeatureFlagRequest true "Feature flag"
+// @Success 200 {object} models.FeatureFlag
+// @Failure 400 {object} map[string]string "Invalid feature flag"
+// @Failure 404 {object} map[string]string "Feature flag not found"
+// @Failure 409 {object} map[string]string "Key already taken"
+// @Router /api/v1/admin/feature-flags/{id} [put]
+func (h *FeatureFlagHandler) UpdateFeatureFlag(c echo.Context) error {
+	req, err := bindFeatureFlag(c)
+	if err != nil {
+		return err
+	}
+
+	flag := &models.FeatureFlag{}
+	if err := h.db.Where("id = ? AND is_deleted = false", c.Param("id")).First(flag).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "feature flag not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get feature flag")
+	}
+
+	req.apply(flag)
+	if err := h.db.Save(flag).Error; err != nil {
+		return saveFeatureFlagError(err)
+	}
+
+	return c.JSON(http.StatusOK, flag)
+}
+
+// DeleteFeatureFlag removes a feature flag
+// @Summary Delete feature flag
+// @Description Remove a feature flag, which turns it off for every team
+// @Tags feature-flags
+// @Param id path string true "Feature flag ID"
+// @Success 204
+// @Failure 404 {object} map[string]string "Feature flag not found"
+// @Router /api/v1/admin/feature-flags/{id} [delete]
+func (h *FeatureFlagHandler) DeleteFeatureFlag(c echo.Context) error {
+	result := h.db.Model(&models.FeatureFlag{}).
+		Where("id = ? AND is_deleted = false", c.Param("id")).
+		UpdateColumns(map[string]interface{}{"is_deleted": true, "deleted_at": time.Now()})
+	if result.Error != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to delete feature flag")
+	}
+	if result.RowsAffected == 0 {
+		return echo.NewHTTPError(http.StatusNotFound, "feature flag not found")
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
@@ -91,8 +91,12 @@ func (h *IMAPHandler) GetFolders(c echo.Context) error {
 	}
 	defer im.Close()
 
-	// login to the server
-	if err := im.Authenticate(sasl.NewPlainClient("", imapConfig.Username, imapConfig.Password)); err != nil {
+	// login to the server, with a password or an OAuth2 access token
+	auth, err := utils.IMAPAuthClient(imapConfig)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to get OAuth token: %v", err))
+	}
+	if err := im.Authenticate(auth); err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to authenticate: %v", err))
 	}
 
@@ -181,8 +185,12 @@ func (h *IMAPHandler) GetEmails(c echo.Context) error {
 	}
 	defer im.Close()
 
-	// login to the server
-	if err := im.Authenticate(sasl.NewPlainClient("", imapConfig.Username, imapConfig.Password)); err != nil {
+	// login to the server, with a password or an OAuth2 access token
+	auth, err := utils.IMAPAuthClient(imapConfig)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to get OAuth token: %v", err))
+	}
+	if err := im.Authenticate(auth); err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to authenticate: %v", err))
 	}
 
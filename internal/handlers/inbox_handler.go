@@ -0,0 +1,492 @@
+package handlers
+
+import (
+	"errors"
+	"kori/internal/models"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+type InboxHandler struct {
+	db *gorm.DB
+}
+
+func NewInboxHandler(db *gorm.DB) *InboxHandler {
+	return &InboxHandler{db: db}
+}
+
+// ListMessages searches the synced messages of the team's mailboxes
+// @Summary Search inbox
+// @Description Search and filter the messages synced from the team's mailboxes with inbox sync on, paginated
+// @Tags inbox
+// @Produce json
+// @Param q query string false "Full-text search across subject, sender and body, e.g. invoice -draft or \"order shipped\""
+// @Param config_id query string false "IMAP config ID"
+// @Param folder query string false "Folder, e.g. INBOX"
+// @Param label query string false "Keyword set on the message"
+// @Param from query string false "Part of the sender's address or name"
+// @Param unread query bool false "Only unread (true) or read (false) messages"
+// @Param since query string false "Messages from this time (RFC3339)"
+// @Param before query string false "Messages before this time (RFC3339)"
+// @Param sort query string false "Order" Enums(newest, oldest, sender, relevance)
+// @Param page query int false "Page (default 1)"
+// @Param limit query int false "Page size (default 25, max 100)"
+// @Success 200 {array} models.InboxMessage
+// @Failure 400 {object} map[string]string "Invalid filter or pagination"
+// @Router /api/v1/inbox [get]
+func (h *InboxHandler) ListMessages(c echo.Context) error {
+	teamID := c.Get("teamID").(string)
+
+	filter := models.InboxFilter{
+		Search:       c.QueryParam("q"),
+		IMAPConfigID: c.QueryParam("config_id"),
+		Folder:       c.QueryParam("folder"),
+		Label:        c.QueryParam("label"),
+		From:         c.QueryParam("from"),
+	}
+	if value := c.QueryParam("unread"); value != "" {
+		unread, err := strconv.ParseBool(value)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid unread")
+		}
+		filter.Unread = &unread
+	}
+	for param, at := range map[string]*time.Time{"since": &filter.Since, "before": &filter.Before} {
+		if value := c.QueryParam(param); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, "invalid "+param)
+			}
+			*at = parsed
+		}
+	}
+
+	page, limit := 1, 25
+	if value := c.QueryParam("page"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid page")
+		}
+		page = parsed
+	}
+	if value := c.QueryParam("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > 100 {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid limit")
+		}
+		limit = parsed
+	}
+
+	sort := models.InboxSort(c.QueryParam("sort"))
+	if sort == "" && filter.Search != "" {
+		sort = models.InboxSortRelevance
+	}
+	query, err := models.OrderInbox(models.InboxQuery(teamID, filter, h.db), sort, filter.Search)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	var total int64
+	if err := models.InboxQuery(teamID, filter, h.db).Count(&total).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to count messages")
+	}
+
+	messages := []models.InboxMessage{}
+	if err := query.Omit("body_text", "body_html", "search_vector").
+		Offset((page - 1) * limit).
+		Limit(limit).
+		Find(&messages).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get messages")
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":  messages,
+		"total": total,
+		"page":  page,
+		"limit": limit,
+	})
+}
+
+// GetMessage returns a synced message with its body
+// @Summary Get inbox message
+// @Tags inbox
+// @Produce json
+// @Param id path string true "Message ID"
+// @Success 200 {object} models.InboxMessage
+// @Failure 404 {object} map[string]string "Message not found"
+// @Router /api/v1/inbox/{id} [get]
+func (h *InboxHandler) GetMessage(c echo.Context) error {
+	message := &models.InboxMessage{}
+	if err := models.InboxQuery(c.Get("teamID").(string), models.InboxFilter{}, h.db).Omit("search_vector").
+		Where("id = ?", c.Param("id")).
+		First(message).Error; err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "message not found")
+	}
+	return c.JSON(http.StatusOK, message)
+}
+
+// ListFolders returns the synced folders with their message and unread counts
+// @Summary List inbox folders
+// @Tags inbox
+// @Produce json
+// @Success 200 {array} models.InboxFolderCount
+// @Router /api/v1/inbox/folders [get]
+func (h *InboxHandler) ListFolders(c echo.Context) error {
+	counts, err := models.GetInboxFolderCounts(c.Get("teamID").(string), h.db)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get folders")
+	}
+	return c.JSON(http.StatusOK, counts)
+}
+
+// InboxAssigneeRequest assigns a conversation
+type InboxAssigneeRequest struct {
+	AssigneeID string `json:"assigneeId" validate:"omitempty,uuid"` // empty to unassign
+}
+
+// InboxStatusRequest moves a conversation to a status
+type InboxStatusRequest struct {
+	Status models.InboxConversationStatus `json:"status" validate:"required,oneof=open pending closed"`
+}
+
+func (h *InboxHandler) getConversation(c echo.Context) (*models.InboxConversation, error) {
+	conversation := &models.InboxConversation{}
+	if err := models.InboxConversationQuery(c.Get("teamID").(string), models.InboxConversationFilter{}, h.db).
+		Where("id = ?", c.Param("id")).
+		First(conversation).Error; err != nil {
+		return nil, echo.NewHTTPError(http.StatusNotFound, "conversation not found")
+	}
+	return conversation, nil
+}
+
+// ListConversations lists the conversations of the shared inbox, most recent first
+// @Summary List inbox conversations
+// @Description List the conversations of the shared inbox, e.g. assignee=me&status=open for your open conversations
+// @Tags inbox
+// @Produce json
+// @Param q query string false "Full-text search across the conversations' messages"
+// @Param config_id query string false "IMAP config ID"
+// @Param status query string false "Status" Enums(open, pending, closed)
+// @Param assignee query string false "me, none or a user ID"
+// @Param snoozed query bool false "Only the snoozed conversations, which are left out otherwise"
+// @Param sort query string false "Order" Enums(newest, oldest)
+// @Param page query int false "Page (default 1)"
+// @Param limit query int false "Page size (default 25, max 100)"
+// @Success 200 {array} models.InboxConversation
+// @Failure 400 {object} map[string]string "Invalid filter or pagination"
+// @Router /api/v1/inbox/conversations [get]
+func (h *InboxHandler) ListConversations(c echo.Context) error {
+	teamID := c.Get("teamID").(string)
+
+	filter := models.InboxConversationFilter{
+		Search:       c.QueryParam("q"),
+		IMAPConfigID: c.QueryParam("config_id"),
+		Status:       models.InboxConversationStatus(c.QueryParam("status")),
+	}
+	switch filter.Status {
+	case "", models.InboxConversationStatusOpen, models.InboxConversationStatusPending, models.InboxConversationStatusClosed:
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, "status must be open, pending or closed")
+	}
+	switch assignee := c.QueryParam("assignee"); assignee {
+	case "":
+	case "none":
+		filter.Unassigned = true
+	case "me":
+		userID, _ := c.Get("userID").(string)
+		if userID == "" {
+			return echo.NewHTTPError(http.StatusBadRequest, "assignee=me needs a signed in user")
+		}
+		filter.AssigneeID = userID
+	default:
+		if _, err := uuid.Parse(assignee); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "assignee must be me, none or a user ID")
+		}
+		filter.AssigneeID = assignee
+	}
+	if filter.IMAPConfigID != "" {
+		if _, err := uuid.Parse(filter.IMAPConfigID); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid config_id")
+		}
+	}
+
+	snoozed := c.QueryParam("snoozed") == "true"
+	filter.Snoozed = &snoozed
+
+	order := models.InboxConversationOrder
+	switch c.QueryParam("sort") {
+	case "", string(models.InboxSortNewest):
+	case string(models.InboxSortOldest):
+		order = "GREATEST(last_message_at, resurfaced_at) ASC, id ASC"
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, "sort must be newest or oldest")
+	}
+
+	page, limit := 1, 25
+	if value := c.QueryParam("page"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid page")
+		}
+		page = parsed
+	}
+	if value := c.QueryParam("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > 100 {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid limit")
+		}
+		limit = parsed
+	}
+
+	var total int64
+	if err := models.InboxConversationQuery(teamID, filter, h.db).Count(&total).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to count conversations")
+	}
+
+	conversations := []models.InboxConversation{}
+	if err := models.InboxConversationQuery(teamID, filter, h.db).
+		Preload("Assignee").
+		Order(order).
+		Offset((page - 1) * limit).
+		Limit(limit).
+		Find(&conversations).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get conversations")
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":  conversations,
+		"total": total,
+		"page":  page,
+		"limit": limit,
+	})
+}
+
+// GetConversation returns a conversation with its messages, oldest first
+// @Summary Get inbox conversation
+// @Tags inbox
+// @Produce json
+// @Param id path string true "Conversation ID"
+// @Success 200 {object} models.InboxConversation
+// @Failure 404 {object} map[string]string "Conversation not found"
+// @Router /api/v1/inbox/conversations/{id} [get]
+func (h *InboxHandler) GetConversation(c echo.Context) error {
+	conversation, err := h.getConversation(c)
+	if err != nil {
+		return err
+	}
+
+	if err := h.db.Preload("Assignee").First(conversation, "id = ?", conversation.ID).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get conversation")
+	}
+	filter := models.InboxFilter{ConversationID: conversation.ID}
+	if err := models.InboxQuery(conversation.TeamID, filter, h.db).Omit("search_vector").
+		Order("date ASC, id ASC").
+		Find(&conversation.Messages).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get messages")
+	}
+
+	return c.JSON(http.StatusOK, conversation)
+}
+
+// AssignConversation assigns a conversation to a teammate
+// @Summary Assign inbox conversation
+// @Tags inbox
+// @Accept json
+// @Produce json
+// @Param id path string true "Conversation ID"
+// @Param request body InboxAssigneeRequest true "Teammate to assign, empty to unassign"
+// @Success 200 {object} models.InboxConversation
+// @Failure 400 {object} map[string]string "The assignee isn't a member of the team"
+// @Failure 404 {object} map[string]string "Conversation not found"
+// @Router /api/v1/inbox/conversations/{id}/assignee [put]
+func (h *InboxHandler) AssignConversation(c echo.Context) error {
+	conversation, err := h.getConversation(c)
+	if err != nil {
+		return err
+	}
+
+	var req InboxAssigneeRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request body")
+	}
+	if err := c.Validate(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if err := models.AssignInboxConversation(conversation, req.AssigneeID, h.db); err != nil {
+		if errors.Is(err, models.ErrInvalidAssignee) {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to assign conversation")
+	}
+
+	return c.JSON(http.StatusOK, conversation)
+}
+
+// SetConversationStatus opens, closes or marks a conversation as waiting on the sender
+// @Summary Set inbox conversation status
+// @Tags inbox
+// @Accept json
+// @Produce json
+// @Param id path string true "Conversation ID"
+// @Param request body InboxStatusRequest true "New status"
+// @Success 200 {object} models.InboxConversation
+// @Failure 400 {object} map[string]string "Invalid status"
+// @Failure 404 {object} map[string]string "Conversation not found"
+// @Router /api/v1/inbox/conversations/{id}/status [put]
+func (h *InboxHandler) SetConversationStatus(c echo.Context) error {
+	conversation, err := h.getConversation(c)
+	if err != nil {
+		return err
+	}
+
+	var req InboxStatusRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request body")
+	}
+	if err := c.Validate(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if err := models.SetInboxConversationStatus(conversation, req.Status, h.db); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to update conversation")
+	}
+
+	return c.JSON(http.StatusOK, conversation)
+}
+
+// InboxSnoozeRequest hides a conversation until a time
+type InboxSnoozeRequest struct {
+	Until time.Time `json:"until" validate:"required"`
+}
+
+// InboxFollowUpRequest resurfaces a conversation at a time unless the sender replies first
+type InboxFollowUpRequest struct {
+	At           time.Time `json:"at" validate:"required"`
+	TemplateID   string    `json:"templateId" validate:"omitempty,uuid"`   // bump email sent to the sender when it's due
+	SMTPConfigID string    `json:"smtpConfigId" validate:"omitempty,uuid"` // sends the bump, the team's default when empty
+}
+
+// SnoozeConversation leaves a conversation out of the inbox until a time, bringing it back open
+// then. A new message from the sender ends the snooze early.
+// @Summary Snooze inbox conversation
+// @Tags inbox
+// @Accept json
+// @Produce json
+// @Param id path string true "Conversation ID"
+// @Param request body InboxSnoozeRequest true "When to bring the conversation back"
+// @Success 200 {object} models.InboxConversation
+// @Failure 400 {object} map[string]string "The time has passed"
+// @Failure 404 {object} map[string]string "Conversation not found"
+// @Router /api/v1/inbox/conversations/{id}/snooze [put]
+func (h *InboxHandler) SnoozeConversation(c echo.Context) error {
+	conversation, err := h.getConversation(c)
+	if err != nil {
+		return err
+	}
+
+	var req InboxSnoozeRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request body")
+	}
+	if err := c.Validate(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if !req.Until.After(time.Now()) {
+		return echo.NewHTTPError(http.StatusBadRequest, "until must be in the future")
+	}
+
+	if err := models.SnoozeInboxConversation(conversation, &req.Until, h.db); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to snooze conversation")
+	}
+
+	return c.JSON(http.StatusOK, conversation)
+}
+
+// UnsnoozeConversation brings a snoozed conversation back now
+// @Summary Unsnooze inbox conversation
+// @Tags inbox
+// @Produce json
+// @Param id path string true "Conversation ID"
+// @Success 200 {object} models.InboxConversation
+// @Failure 404 {object} map[string]string "Conversation not found"
+// @Router /api/v1/inbox/conversations/{id}/snooze [delete]
+func (h *InboxHandler) UnsnoozeConversation(c echo.Context) error {
+	conversation, err := h.getConversation(c)
+	if err != nil {
+		return err
+	}
+
+	if err := models.SnoozeInboxConversation(conversation, nil, h.db); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to unsnooze conversation")
+	}
+
+	return c.JSON(http.StatusOK, conversation)
+}
+
+// SetConversationFollowUp reminds the team of a conversation the sender hasn't answered, like
+// "remind me if no reply in 3 days". When it's due the conversation is reopened and brought back
+// to the top of the inbox, and the sender is sent the template as a reply in the thread if one
+// is given. A reply from the sender cancels the follow-up.
+// @Summary Set inbox conversation follow-up
+// @Tags inbox
+// @Accept json
+// @Produce json
+// @Param id path string true "Conversation ID"
+// @Param request body InboxFollowUpRequest true "When to follow up, and the bump email"
+// @Success 200 {object} models.InboxConversation
+// @Failure 400 {object} map[string]string "Invalid time, template or smtp config"
+// @Failure 404 {object} map[string]string "Conversation not found"
+// @Router /api/v1/inbox/conversations/{id}/follow-up [put]
+func (h *InboxHandler) SetConversationFollowUp(c echo.Context) error {
+	conversation, err := h.getConversation(c)
+	if err != nil {
+		return err
+	}
+
+	var req InboxFollowUpRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request body")
+	}
+	if err := c.Validate(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if !req.At.After(time.Now()) {
+		return echo.NewHTTPError(http.StatusBadRequest, "at must be in the future")
+	}
+
+	if err := models.SetInboxFollowUp(conversation, &req.At, req.TemplateID, req.SMTPConfigID, h.db); err != nil {
+		if errors.Is(err, models.ErrInvalidFollowUpTemplate) || errors.Is(err, models.ErrInvalidFollowUpSMTPConfig) {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to set follow-up")
+	}
+
+	return c.JSON(http.StatusOK, conversation)
+}
+
+// CancelConversationFollowUp cancels a conversation's follow-up
+// @Summary Cancel inbox conversation follow-up
+// @Tags inbox
+// @Produce json
+// @Param id path string true "Conversation ID"
+// @Success 200 {object} models.InboxConversation
+// @Failure 404 {object} map[string]string "Conversation not found"
+// @Router /api/v1/inbox/conversations/{id}/follow-up [delete]
+func (h *InboxHandler) CancelConversationFollowUp(c echo.Context) error {
+	conversation, err := h.getConversation(c)
+	if err != nil {
+		return err
+	}
+
+	if err := models.SetInboxFollowUp(conversation, nil, "", "", h.db); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to cancel follow-up")
+	}
+
+	return c.JSON(http.StatusOK, conversation)
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"kori/internal/models"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// IndexAdvisorHandler shows platform operators the indexes slow statements are missing
+type IndexAdvisorHandler struct {
+	db *gorm.DB
+}
+
+func NewIndexAdvisorHandler(db *gorm.DB) *IndexAdvisorHandler {
+	return &IndexAdvisorHandler{db: db}
+}
+
+// IndexAdvisorResponse lists the recommended indexes
+type IndexAdvisorResponse struct {
+	Available       bool                         `json:"available"`
+	Recommendations []models.IndexRecommendation `json:"recommendations"`
+}
+
+// GetIndexRecommendations returns the recommended indexes
+// @Summary Get index recommendations
+// @Description Indexes that would serve the slowest statements sampled from pg_stat_statements, the most total execution time first. Statements served by the same index are merged. Recommendations are refreshed every 6 hours and dropped once the index exists. Available is false when pg_stat_statements isn't installed. Super admins only.
+// @Tags admin
+// @Produce json
+// @Param limit query int false "How many recommendations to return (default 50, at most 500)"
+// @Success 200 {object} IndexAdvisorResponse
+// @Failure 400 {object} map[string]string "Invalid limit"
+// @Router /api/v1/admin/index-advisor [get]
+func (h *IndexAdvisorHandler) GetIndexRecommendations(c echo.Context) error {
+	limit := 50
+	if raw := c.QueryParam("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 || parsed > 500 {
+			return echo.NewHTTPError(http.StatusBadRequest, "limit must be between 1 and 500")
+		}
+		limit = parsed
+	}
+
+	db := h.db.WithContext(c.Request().Context())
+	available, err := models.IndexAdvisorAvailable(db)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to check pg_stat_statements")
+	}
+	recommendations, err := models.GetIndexRecommendations(limit, db)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get index recommendations")
+	}
+
+	return c.JSON(http.StatusOK, IndexAdvisorResponse{Available: available, Recommendations: recommendations})
+}
@@ -12,6 +12,7 @@ import (
 type StorageHandler interface {
 	UploadFile(ctx context.Context, file []byte, filename string, acl types.ObjectCannedACL, contentType string) (string, error)
 	GetSignedURL(ctx context.Context, path string, duration time.Duration) (string, error)
+	DeleteFile(ctx context.Context, path string) error
 }
 
 var (
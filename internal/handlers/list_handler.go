@@ -1,14 +1,34 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
 	"kori/internal/config"
 	"kori/internal/models"
 	"net/http"
+	"net/url"
 
 	"github.com/golang-jwt/jwt"
 	"github.com/labstack/echo/v4"
 )
 
+// unsubscribedPage is shown once a contact has been unsubscribed
+const unsubscribedPage = "<h1>Successfully Unsubscribed</h1><p>You have been removed from our mailing list.</p>"
+
+// unsubscribeConfirmPage asks the recipient to confirm, so link scanners that follow GET links don't unsubscribe anyone
+const unsubscribeConfirmPage = `<h1>Unsubscribe</h1><p>Do you want to stop receiving these emails?</p>
+<form method="POST" action="/unsubscribe?token=%s"><button type="submit">Unsubscribe</button></form>`
+
+// sequenceOptedOutPage is shown once a contact has left an automation
+const sequenceOptedOutPage = "<h1>You're Out of This Series</h1><p>You won't get any more emails from this series. Your other subscriptions are unchanged.</p>"
+
+// sequenceOptOutConfirmPage asks the recipient to confirm leaving an automation, for the same reason as unsubscribing
+const sequenceOptOutConfirmPage = `<h1>Stop This Series</h1><p>Do you want to stop receiving the emails of this series? You stay subscribed to everything else.</p>
+<form method="POST" action="/sequence-opt-out?token=%s"><button type="submit">Stop this series</button></form>`
+
+// confirmedPage is shown once a contact has confirmed their subscription
+const confirmedPage = "<h1>Subscription Confirmed</h1><p>Thanks, you're on the list.</p>"
+
 // HandleEmailUnsubscribe handles unsubscribe requests from email links
 // @Summary Unsubscribe from email list
 // @Description Unsubscribe from an email list
@@ -21,26 +41,63 @@ import (
 // @Router /t/unsubscribe [get]
 
 func (h *TrackingHandler) HandleEmailUnsubscribe(c echo.Context) error {
-	// Extract token from query params
+	if err := h.unsubscribe(c, c.QueryParam("token")); err != nil {
+		return err
+	}
+
+	// Return success page
+	return c.HTML(http.StatusOK, unsubscribedPage)
+}
+
+// HandleUnsubscribePage shows the unsubscribe confirmation page
+// @Summary Unsubscribe confirmation page
+// @Description Show a page asking the recipient to confirm unsubscribing
+// @Produce html
+// @Param token query string true "Unsubscribe token"
+// @Success 200 {string} string "Confirmation page"
+// @Failure 400 {object} map[string]string "Missing token"
+// @Failure 401 {object} map[string]string "Invalid token"
+// @Router /unsubscribe [get]
+func (h *TrackingHandler) HandleUnsubscribePage(c echo.Context) error {
 	token := c.QueryParam("token")
 	if token == "" {
 		return c.String(http.StatusBadRequest, "Missing token")
 	}
+	if _, err := parseMailToken(token); err != nil {
+		return c.String(http.StatusUnauthorized, "Invalid token")
+	}
 
-	// Parse JWT token
-	claims := jwt.MapClaims{}
-	_, err := jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
-		return []byte(config.GetConfig().JWT.Secret), nil
-	})
+	return c.HTML(http.StatusOK, fmt.Sprintf(unsubscribeConfirmPage, url.QueryEscape(token)))
+}
 
-	if err != nil {
-		return c.String(http.StatusUnauthorized, "Invalid token")
+// HandleUnsubscribe unsubscribes the recipient of an email. It serves both the
+// confirmation form and RFC 8058 one-click requests from List-Unsubscribe-Post.
+// @Summary Unsubscribe
+// @Description Unsubscribe the recipient of an email, including one-click List-Unsubscribe requests
+// @Accept x-www-form-urlencoded
+// @Produce html
+// @Param token query string true "Unsubscribe token"
+// @Success 200 {string} string "Unsubscribed successfully"
+// @Failure 400 {object} map[string]string "Missing token"
+// @Failure 401 {object} map[string]string "Invalid token"
+// @Router /unsubscribe [post]
+func (h *TrackingHandler) HandleUnsubscribe(c echo.Context) error {
+	if err := h.unsubscribe(c, c.QueryParam("token")); err != nil {
+		return err
 	}
 
-	// Extract email ID and recipient email from claims
-	emailID, ok := claims["mailId"].(string)
-	if !ok {
-		return c.String(http.StatusBadRequest, "Invalid token claims - missing email ID")
+	return c.HTML(http.StatusOK, unsubscribedPage)
+}
+
+// unsubscribe flips the contact behind a mail token to UNSUBSCRIBED and records the event once
+func (h *TrackingHandler) unsubscribe(c echo.Context, token string) error {
+	if token == "" {
+		return c.String(http.StatusBadRequest, "Missing token")
+	}
+
+	emailID, err := parseMailToken(token)
+	if err != nil {
+		return c.String(http.StatusUnauthorized, "Invalid token")
 	}
 
 	// Get the email
@@ -48,21 +105,155 @@ func (h *TrackingHandler) HandleEmailUnsubscribe(c echo.Context) error {
 	if err != nil {
 		return c.String(http.StatusInternalServerError, "Failed to get email")
 	}
+	if email.ContactID == "" {
+		return c.String(http.StatusBadRequest, "Email has no contact to unsubscribe")
+	}
+
+	contact := &models.Contact{}
+	if err := h.db.Where("id = ?", email.ContactID).First(contact).Error; err != nil {
+		return c.String(http.StatusInternalServerError, "Failed to get contact")
+	}
+
+	// Repeat requests (e.g. mail clients retrying one-click) are a no-op
+	if contact.Status == models.SubscriberStatusUnsubscribed {
+		return nil
+	}
 
 	// update the contact status
-	contact := email.Contact
-	contact.Status = models.SubscriberStatusUnsubscribed
-	if err := h.db.Save(contact).Error; err != nil {
+	if err := h.db.Model(contact).Update("status", models.SubscriberStatusUnsubscribed).Error; err != nil {
 		return c.String(http.StatusInternalServerError, "Failed to update contact status")
 	}
 
 	// Create tracking entry for the unsubscribe event
-	_, err = h.createTrackingEntry(c, emailID, models.EmailTrackingEventUnsubscribe, "")
+	_, err = h.createTrackingEntry(c, emailID, models.EmailTrackingEventUnsubscribe, "", "")
 	if err != nil {
 		// Log error but don't fail the request
 		trackingLog.Error("Failed to create unsubscribe tracking entry", err)
 	}
 
-	// Return success page
-	return c.HTML(http.StatusOK, "<h1>Successfully Unsubscribed</h1><p>You have been removed from our mailing list.</p>")
+	return nil
+}
+
+// HandleSequenceOptOutPage shows the page confirming an opt-out from an automation
+// @Summary Automation opt-out confirmation page
+// @Description Show a page asking the recipient to confirm leaving the automation an email was sent by
+// @Produce html
+// @Param token query string true "Mail token"
+// @Success 200 {string} string "Confirmation page"
+// @Failure 400 {object} map[string]string "Missing token"
+// @Failure 401 {object} map[string]string "Invalid token"
+// @Router /sequence-opt-out [get]
+func (h *TrackingHandler) HandleSequenceOptOutPage(c echo.Context) error {
+	token := c.QueryParam("token")
+	if token == "" {
+		return c.String(http.StatusBadRequest, "Missing token")
+	}
+	if _, err := parseMailToken(token); err != nil {
+		return c.String(http.StatusUnauthorized, "Invalid token")
+	}
+
+	return c.HTML(http.StatusOK, fmt.Sprintf(sequenceOptOutConfirmPage, url.QueryEscape(token)))
+}
+
+// HandleSequenceOptOut takes the recipient of an automation email out of that automation
+// without unsubscribing them
+// @Summary Opt out of an automation
+// @Description Stop the automation an email was sent by for its recipient, who stays subscribed otherwise
+// @Accept x-www-form-urlencoded
+// @Produce html
+// @Param token query string true "Mail token"
+// @Success 200 {string} string "Opted out"
+// @Failure 400 {object} map[string]string "Missing token or not an automation email"
+// @Failure 401 {object} map[string]string "Invalid token"
+// @Router /sequence-opt-out [post]
+func (h *TrackingHandler) HandleSequenceOptOut(c echo.Context) error {
+	token := c.QueryParam("token")
+	if token == "" {
+		return c.String(http.StatusBadRequest, "Missing token")
+	}
+
+	emailID, err := parseMailToken(token)
+	if err != nil {
+		return c.String(http.StatusUnauthorized, "Invalid token")
+	}
+
+	email, err := models.GetEmailByID(emailID, h.db)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, "Failed to get email")
+	}
+	if email.AutomationID == "" || email.ContactID == "" {
+		return c.String(http.StatusBadRequest, "Email wasn't sent by an automation")
+	}
+
+	if err := models.OptOutOfAutomation(email, h.db); err != nil {
+		return c.String(http.StatusInternalServerError, "Failed to opt out")
+	}
+
+	return c.HTML(http.StatusOK, sequenceOptedOutPage)
+}
+
+// HandleConfirm confirms the subscription of a contact to a list that requires it
+// @Summary Confirm subscription
+// @Description Confirm the subscription of a contact to a double opt-in list, making them ACTIVE
+// @Produce html
+// @Param token query string true "Confirmation token"
+// @Success 200 {string} string "Subscription confirmed"
+// @Failure 400 {object} map[string]string "Missing token"
+// @Failure 401 {object} map[string]string "Invalid token"
+// @Failure 404 {object} map[string]string "Contact not found"
+// @Router /confirm [get]
+func (h *TrackingHandler) HandleConfirm(c echo.Context) error {
+	token := c.QueryParam("token")
+	if token == "" {
+		return c.String(http.StatusBadRequest, "Missing token")
+	}
+
+	contactID, err := parseConfirmationToken(token)
+	if err != nil {
+		return c.String(http.StatusUnauthorized, "Invalid token")
+	}
+
+	contact := &models.Contact{}
+	if err := h.db.Where("id = ? AND is_deleted = false", contactID).First(contact).Error; err != nil {
+		return c.String(http.StatusNotFound, "Contact not found")
+	}
+
+	// Following the link again after confirming, or after unsubscribing, changes nothing
+	if _, err := models.ConfirmContact(contact, h.db); err != nil {
+		return c.String(http.StatusInternalServerError, "Failed to confirm subscription")
+	}
+
+	return c.HTML(http.StatusOK, confirmedPage)
+}
+
+// parseMailToken validates a tracking/unsubscribe token and returns its email ID
+func parseMailToken(token string) (string, error) {
+	claims := jwt.MapClaims{}
+	if _, err := jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(config.GetConfig().JWT.Secret), nil
+	}); err != nil {
+		return "", err
+	}
+
+	emailID, ok := claims["mailId"].(string)
+	if !ok {
+		return "", errors.New("invalid token claims - missing email ID")
+	}
+	return emailID, nil
+}
+
+// parseConfirmationToken validates a confirmation token and returns its contact ID
+func parseConfirmationToken(token string) (string, error) {
+	claims := jwt.MapClaims{}
+	if _, err := jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(config.GetConfig().JWT.Secret), nil
+	}); err != nil {
+		return "", err
+	}
+
+	contactID, ok := claims["contactId"].(string)
+	if !ok {
+		return "", errors.New("invalid token claims - missing contact ID")
+	}
+	return contactID, nil
 }
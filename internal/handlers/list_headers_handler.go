@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"kori/internal/models"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// listIDDomainRe matches a domain name List-Id values can be under
+var listIDDomainRe = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]*[a-z0-9])?\.)+[a-z]{2,}$`)
+
+type ListHeadersHandler struct {
+	db *gorm.DB
+}
+
+// ListHeaderSettings is how a team's campaign and marketing mail is labelled for mailbox providers
+type ListHeaderSettings struct {
+	Enabled          bool   `json:"enabled"`                    // add List-Id, Precedence: bulk and Feedback-ID
+	ListIDDomain     string `json:"listIdDomain"`               // the From address's domain when empty
+	FeedbackIDSender string `json:"feedbackIdSender,omitempty"` // posthoot when empty
+}
+
+func NewListHeadersHandler(db *gorm.DB) *ListHeadersHandler {
+	return &ListHeadersHandler{db: db}
+}
+
+// GetListHeaderSettings returns the team's list header settings
+// @Summary Get list header settings
+// @Description Get whether campaign mail and mail of marketing categories is sent with List-Id, Precedence: bulk and Feedback-ID headers, and the values they use
+// @Tags list-headers
+// @Produce json
+// @Success 200 {object} ListHeaderSettings
+// @Failure 404 {object} map[string]string "Team settings not found"
+// @Router /api/v1/list-headers [get]
+func (h *ListHeadersHandler) GetListHeaderSettings(c echo.Context) error {
+	teamID := c.Get("teamID").(string)
+
+	settings := &models.TeamSettings{}
+	if err := h.db.Where("team_id = ? AND is_deleted = false", teamID).First(settings).Error; err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "team settings not found")
+	}
+
+	return c.JSON(http.StatusOK, ListHeaderSettings{
+		Enabled:          settings.ListHeaders,
+		ListIDDomain:     settings.ListIDDomain,
+		FeedbackIDSender: settings.FeedbackIDSender,
+	})
+}
+
+// UpdateListHeaderSettings sets the team's list header settings
+// @Summary Update list header settings
+// @Description Turn list headers on or off and choose the domain List-Id values are under and the sender Feedback-ID reports are grouped by in Google Postmaster Tools
+// @Tags list-headers
+// @Accept json
+// @Produce json
+// @Param request body ListHeaderSettings true "List header settings"
+// @Success 200 {object} ListHeaderSettings
+// @Failure 400 {object} map[string]string "Invalid domain or sender"
+// @Failure 404 {object} map[string]string "Team settings not found"
+// @Router /api/v1/list-headers [put]
+func (h *ListHeadersHandler) UpdateListHeaderSettings(c echo.Context) error {
+	teamID := c.Get("teamID").(string)
+
+	var req ListHeaderSettings
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request body")
+	}
+
+	req.ListIDDomain = strings.ToLower(strings.TrimSpace(req.ListIDDomain))
+	if req.ListIDDomain != "" && !listIDDomainRe.MatchString(req.ListIDDomain) {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid list id domain: "+req.ListIDDomain)
+	}
+	req.FeedbackIDSender = strings.TrimSpace(req.FeedbackIDSender)
+	if strings.Contains(req.FeedbackIDSender, ":") || len(req.FeedbackIDSender) > 64 {
+		return echo.NewHTTPError(http.StatusBadRequest, "feedback id sender can't contain ':' or be longer than 64 characters")
+	}
+
+	settings := &models.TeamSettings{}
+	if err := h.db.Where("team_id = ? AND is_deleted = false", teamID).First(settings).Error; err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "team settings not found")
+	}
+
+	before := ListHeaderSettings{
+		Enabled:          settings.ListHeaders,
+		ListIDDomain:     settings.ListIDDomain,
+		FeedbackIDSender: settings.FeedbackIDSender,
+	}
+	if err := h.db.Model(settings).Updates(map[string]interface{}{
+		"list_headers":       req.Enabled,
+		"list_id_domain":     req.ListIDDomain,
+		"feedback_id_sender": req.FeedbackIDSender,
+	}).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to update list header settings")
+	}
+	models.RecordAuditChange(c.Request().Context(), models.AuditActionUpdate, "team_settings", settings.ID, before, req)
+
+	return c.JSON(http.StatusOK, req)
+}
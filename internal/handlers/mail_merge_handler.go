@@ -0,0 +1,285 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"kori/internal/db"
+	"kori/internal/events"
+	"kori/internal/models"
+	"kori/internal/utils"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// MaxMailMergeRecipients caps how many recipients one mail merge can send to
+const MaxMailMergeRecipients = 500
+
+// Where each mail merge recipient stands after the request
+const (
+	MailMergeStatusQueued     = "queued"
+	MailMergeStatusReplayed   = "replayed" // queued by an earlier request with the same Idempotency-Key
+	MailMergeStatusSuppressed = "suppressed"
+	MailMergeStatusDuplicate  = "duplicate"
+	MailMergeStatusInvalid    = "invalid"
+	MailMergeStatusOverQuota  = "over_quota" // the team's monthly email quota ran out before this recipient
+)
+
+// MailMergeRequest sends one email per recipient, from a template or raw HTML, each rendered
+// with the shared variables overlaid by the recipient's own
+type MailMergeRequest struct {
+	TemplateID  string                 `json:"templateId" validate:"required_without=HTML,omitempty,uuid"`
+	HTML        string                 `json:"html" validate:"required_without=TemplateID"`
+	Text        string                 `json:"text"`    // plain text alternative, generated from the html when blank
+	Subject     string                 `json:"subject"` // may use variables, e.g. "Quick question, {{firstName}}"; the template's when blank
+	Variables   map[string]interface{} `json:"variables"`
+	Recipients  []MailMergeRecipient   `json:"recipients" validate:"required,min=1,max=500,dive"`
+	Provider    string                 `json:"provider" validate:"omitempty,oneof=CUSTOM GMAIL OUTLOOK AMAZON SENDGRID MAILGUN POSTMARK"`
+	CategoryID  string                 `json:"categoryId" validate:"omitempty,uuid"` // Transactional when blank
+	ReplyTo     string                 `json:"replyTo" validate:"omitempty,email"`
+	SendAt      time.Time              `json:"scheduleAt"`
+	SignatureID string                 `json:"signatureId" validate:"omitempty,uuid"`
+}
+
+// MailMergeRecipient is a row of the spreadsheet: an address and the variables to fill in for it
+type MailMergeRecipient struct {
+	To        string                 `json:"to" validate:"required"`
+	Variables map[string]interface{} `json:"variables"`
+}
+
+// MailMergeResult is what happened to one recipient
+type MailMergeResult struct {
+	To      string `json:"to"`
+	EmailID string `json:"emailId,omitempty"` // for /api/v1/emails/status and the email's tracking
+	Status  string `json:"status"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// MailMergeResponse counts the recipients by status and lists each one in request order
+type MailMergeResponse struct {
+	Queued     int               `json:"queued"`
+	Skipped    int               `json:"skipped"`
+	Recipients []MailMergeResult `json:"recipients"`
+}
+
+// SendMailMerge queues an email to each of up to 500 inline recipients without needing a list.
+// Emails go through the normal send pipeline, so they're tracked and their recipients added to
+// All Users like any transactional send.
+// @Summary Send a mail merge
+// @Description Send a template or raw HTML email to up to 500 recipients, each with their own variables, e.g. rows pasted from a spreadsheet. Contacts that unsubscribed, bounced or complained are skipped. Returns the status of every recipient and the IDs of the queued emails, which /api/v1/emails/status reports on. Each queued email takes a credit of the team's monthly quota; once it runs out the remaining recipients are skipped. Retries with the same Idempotency-Key return the emails already queued.
+// @Tags Email
+// @Accept json
+// @Produce json
+// @Param Idempotency-Key header string false "Unique key for this mail merge, honoured for 24 hours"
+// @Param request body MailMergeRequest true "Mail merge"
+// @Security BearerAuth
+// @Success 202 {object} MailMergeResponse
+// @Failure 400 {object} map[string]string "Validation error"
+// @Failure 422 {object} map[string]string "Idempotency key reused with a different request"
+// @Router /api/v1/mail-merge [post]
+func SendMailMerge(c echo.Context) error {
+	var req MailMergeRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+	if err := c.Validate(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if req.TemplateID == "" && req.Subject == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "subject is required without a template")
+	}
+
+	key := strings.TrimSpace(c.Request().Header.Get(IdempotencyKeyHeader))
+	if len(key) > 255 {
+		return echo.NewHTTPError(http.StatusBadRequest, "Idempotency-Key must be at most 255 characters")
+	}
+
+	teamID := c.Get("teamID").(string)
+	database := db.GetDB()
+
+	smtpConfig, err := models.GetSMTPConfig(teamID, "", req.Provider, database)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "No SMTP config found for this team")
+	}
+
+	if req.TemplateID != "" {
+		var count int64
+		if err := database.Model(&models.Template{}).Where("id = ? AND team_id = ? AND is_deleted = false", req.TemplateID, teamID).Count(&count).Error; err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get template")
+		}
+		if count == 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "Template not found")
+		}
+	}
+	if req.CategoryID != "" {
+		var count int64
+		if err := database.Model(&models.EmailCategory{}).Where("id = ? AND team_id = ?", req.CategoryID, teamID).Count(&count).Error; err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get category")
+		}
+		if count == 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "Category not found")
+		}
+	}
+
+	signature := ""
+	if req.SignatureID != "" {
+		userID, _ := c.Get("userID").(string)
+		found, err := models.GetSignature(teamID, userID, req.SignatureID, database)
+		if err != nil {
+			if errors.Is(err, models.ErrSignatureNotFound) {
+				return echo.NewHTTPError(http.StatusBadRequest, "Signature not found")
+			}
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get signature")
+		}
+		signatureVariables, err := models.GetSignatureVariables(found, userID, database)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get signature variables")
+		}
+		signature = utils.RenderSignature(found.HTML, signatureVariables)
+	}
+
+	addresses := make([]string, len(req.Recipients))
+	for i, recipient := range req.Recipients {
+		addresses[i] = strings.TrimSpace(recipient.To)
+	}
+	suppressed, err := models.SuppressedAddresses(teamID, addresses, database)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to check suppressed contacts")
+	}
+
+	requestHash := ""
+	if key != "" {
+		body, err := json.Marshal(req)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to hash request")
+		}
+		hash := sha256.Sum256(body)
+		requestHash = hex.EncodeToString(hash[:])
+	}
+
+	response := MailMergeResponse{Recipients: make([]MailMergeResult, 0, len(req.Recipients))}
+	seen := make(map[string]bool, len(req.Recipients))
+	for i, recipient := range req.Recipients {
+		result := MailMergeResult{To: addresses[i]}
+		address := strings.ToLower(addresses[i])
+		switch {
+		case !validMailMergeAddress(addresses[i]):
+			result.Status, result.Reason = MailMergeStatusInvalid, "not a valid email address"
+		case seen[address]:
+			result.Status, result.Reason = MailMergeStatusDuplicate, "the address is listed more than once"
+		case suppressed[address]:
+			result.Status, result.Reason = MailMergeStatusSuppressed, "the contact unsubscribed, bounced or complained"
+		}
+		seen[address] = true
+		if result.Status != "" {
+			response.Recipients = append(response.Recipients, result)
+			continue
+		}
+
+		email, err := newMailMergeEmail(&req, addresses[i], recipient.Variables, teamID, smtpConfig.ID, signature)
+		if err != nil {
+			result.Status, result.Reason = MailMergeStatusInvalid, err.Error()
+			response.Recipients = append(response.Recipients, result)
+			continue
+		}
+		result.EmailID = email.ID
+
+		if key != "" {
+			// Each recipient holds its own key, so a retry sends to those the first attempt missed
+			email.IdempotencyKey = key + ":" + address
+			existing, claimed, err := models.ClaimIdempotencyKey(teamID, email.IdempotencyKey, requestHash, email.ID, database)
+			if err != nil {
+				return echo.NewHTTPError(http.StatusInternalServerError, "Failed to check idempotency key")
+			}
+			if !claimed {
+				if existing.RequestHash != requestHash {
+					return echo.NewHTTPError(http.StatusUnprocessableEntity, "Idempotency-Key was already used for a different request")
+				}
+				result.EmailID, result.Status = existing.EmailID, MailMergeStatusReplayed
+				response.Recipients = append(response.Recipients, result)
+				continue
+			}
+		}
+
+		if err := models.ConsumeQuota(teamID, models.QuotaResourceEmails, 1, database); err != nil {
+			if email.IdempotencyKey != "" {
+				models.ReleaseIdempotencyKey(teamID, email.IdempotencyKey, email.ID, database)
+			}
+			var exceeded *models.QuotaExceededError
+			if !errors.As(err, &exceeded) {
+				return echo.NewHTTPError(http.StatusInternalServerError, "Failed to check sending quota")
+			}
+			result.EmailID, result.Status, result.Reason = "", MailMergeStatusOverQuota, exceeded.Error()
+			response.Recipients = append(response.Recipients, result)
+			continue
+		}
+
+		events.Emit("email.send", email)
+		result.Status = MailMergeStatusQueued
+		response.Recipients = append(response.Recipients, result)
+	}
+
+	for _, result := range response.Recipients {
+		if result.Status == MailMergeStatusQueued || result.Status == MailMergeStatusReplayed {
+			response.Queued++
+		} else {
+			response.Skipped++
+		}
+	}
+
+	return c.JSON(http.StatusAccepted, response)
+}
+
+// newMailMergeEmail builds a recipient's email with the shared variables overlaid by theirs
+func newMailMergeEmail(req *MailMergeRequest, to string, recipientVariables map[string]interface{}, teamID, smtpConfigID, signature string) (*models.Email, error) {
+	merged := make(map[string]interface{}, len(req.Variables)+len(recipientVariables))
+	for name, value := range req.Variables {
+		merged[name] = value
+	}
+	for name, value := range recipientVariables {
+		merged[name] = value
+	}
+	variables, err := json.Marshal(merged)
+	if err != nil {
+		return nil, errors.New("invalid variables")
+	}
+
+	subject := req.Subject
+	if strings.Contains(subject, "{{") {
+		values, err := utils.JSONToVariables(variables)
+		if err != nil {
+			return nil, errors.New("invalid variables")
+		}
+		if rendered, err := utils.RenderTemplate(subject, values); err == nil {
+			subject = rendered
+		}
+	}
+
+	email := &models.Email{
+		TeamID:       teamID,
+		TemplateID:   req.TemplateID,
+		To:           to,
+		SMTPConfigID: smtpConfigID,
+		CategoryID:   req.CategoryID,
+		Subject:      subject,
+		Data:         variables,
+		Body:         req.HTML,
+		PlainText:    req.Text,
+		ReplyTo:      req.ReplyTo,
+		SendAt:       req.SendAt,
+		Signature:    signature,
+	}
+	email.ID = uuid.New().String()
+	return email, nil
+}
+
+// validMailMergeAddress reports whether a recipient is a single bare email address
+func validMailMergeAddress(address string) bool {
+	addresses, err := models.ParseRecipientList(address)
+	return err == nil && len(addresses) == 1
+}
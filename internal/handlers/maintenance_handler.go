@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"kori/internal/config"
+	"kori/internal/utils"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/redis/go-redis/v9"
+)
+
+// MaintenanceHandler lets platform operators put the platform in maintenance mode
+type MaintenanceHandler struct {
+	redis *redis.Client
+}
+
+func NewMaintenanceHandler(cfg config.RedisConfig) *MaintenanceHandler {
+	if cfg.UsesEmbeddedQueue() {
+		// Kept in this process, the only one there is without Redis
+		return &MaintenanceHandler{}
+	}
+	return &MaintenanceHandler{redis: redis.NewClient(&redis.Options{
+		Addr:     cfg.Addr,
+		Username: cfg.Username,
+		Password: cfg.Password,
+		DB:       cfg.DB,
+	})}
+}
+
+// MaintenanceRequest turns maintenance mode on or off
+type MaintenanceRequest struct {
+	Enabled    bool   `json:"enabled"`
+	Message    string `json:"message" validate:"omitempty,max=500"`            // shown to API clients, a generic notice when empty
+	RetryAfter int    `json:"retryAfter" validate:"omitempty,min=1,max=86400"` // seconds, 5 minutes when empty
+}
+
+// GetMaintenanceMode returns whether the platform is in maintenance mode
+// @Summary Get maintenance mode
+// @Description Whether the API is read-only and background tasks are held for maintenance. Super admins only.
+// @Tags admin
+// @Produce json
+// @Success 200 {object} utils.MaintenanceMode
+// @Failure 403 {object} map[string]string "Not a super admin"
+// @Router /api/v1/admin/maintenance [get]
+func (h *MaintenanceHandler) GetMaintenanceMode(c echo.Context) error {
+	mode, err := utils.GetMaintenanceMode(c.Request().Context(), h.redis)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get maintenance mode")
+	}
+	return c.JSON(http.StatusOK, mode)
+}
+
+// SetMaintenanceMode turns maintenance mode on or off
+// @Summary Set maintenance mode
+// @Description While on, API writes get a 503 with Retry-After and task servers hold tasks as they pick them up, so sends pause between batches. Reads, tracking, unsubscribes and provider events keep working. Every server follows within a few seconds. Super admins only.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param request body MaintenanceRequest true "Maintenance mode"
+// @Success 200 {object} utils.MaintenanceMode
+// @Failure 400 {object} map[string]string "Invalid request"
+// @Failure 403 {object} map[string]string "Not a super admin"
+// @Router /api/v1/admin/maintenance [put]
+func (h *MaintenanceHandler) SetMaintenanceMode(c echo.Context) error {
+	req := new(MaintenanceRequest)
+	if err := c.Bind(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request body")
+	}
+	if err := c.Validate(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	ctx := c.Request().Context()
+	mode := utils.MaintenanceMode{Enabled: req.Enabled, Message: req.Message, RetryAfter: req.RetryAfter}
+	if req.Enabled {
+		// Changing the message of a maintenance window already in progress keeps when it started
+		current, err := utils.GetMaintenanceMode(ctx, h.redis)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to get maintenance mode")
+		}
+		if current.Enabled {
+			mode.StartedAt, mode.StartedBy = current.StartedAt, current.StartedBy
+		} else {
+			now := time.Now()
+			mode.StartedAt = &now
+			mode.StartedBy, _ = c.Get("userID").(string)
+		}
+	}
+
+	if err := utils.SetMaintenanceMode(ctx, h.redis, mode); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to set maintenance mode")
+	}
+	return c.JSON(http.StatusOK, mode)
+}
@@ -0,0 +1,327 @@
+package handlers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"kori/internal/config"
+	"kori/internal/models"
+	"kori/internal/utils"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxTLSReportSize bounds the size of an uploaded TLS report after decompression
+const maxTLSReportSize = 5 << 20
+
+type MTASTSHandler struct {
+	db *gorm.DB
+}
+
+// DNSRecordGuidance is a DNS record a domain owner has to publish
+type DNSRecordGuidance struct {
+	Type    string `json:"type"`
+	Host    string `json:"host"`
+	Value   string `json:"value"`
+	Purpose string `json:"purpose"`
+}
+
+// MTASTSSetupResponse is the MTA-STS policy and the DNS records needed to publish it
+type MTASTSSetupResponse struct {
+	Domain    string              `json:"domain"`
+	Verified  bool                `json:"verified"`
+	Mode      models.MTASTSMode   `json:"mode"`
+	PolicyURL string              `json:"policyUrl"`
+	PolicyID  string              `json:"policyId"`
+	Policy    string              `json:"policy"`
+	MX        []string            `json:"mx"`
+	Records   []DNSRecordGuidance `json:"records"`
+	Warnings  []string            `json:"warnings"`
+}
+
+// TLSFailureSummary aggregates TLS reports for one receiving domain
+type TLSFailureSummary struct {
+	PolicyDomain string           `json:"policyDomain"`
+	Reports      int              `json:"reports"`
+	SuccessCount int64            `json:"successCount"`
+	FailureCount int64            `json:"failureCount"`
+	FailureRate  float64          `json:"failureRate"`
+	ResultTypes  map[string]int64 `json:"resultTypes"`
+	MXHosts      map[string]int64 `json:"mxHosts"`
+	LastReportAt time.Time        `json:"lastReportAt"`
+}
+
+func NewMTASTSHandler(db *gorm.DB) *MTASTSHandler {
+	return &MTASTSHandler{db: db}
+}
+
+// ServePolicy serves the MTA-STS policy for the domain in the request host
+// @Summary Serve MTA-STS policy
+// @Description Serve the MTA-STS policy file for a verified domain, requested as https://mta-sts.<domain>/.well-known/mta-sts.txt
+// @Tags domains
+// @Produce plain
+// @Success 200 {string} string "MTA-STS policy"
+// @Failure 404 {string} string "No policy for this host"
+// @Router /.well-known/mta-sts.txt [get]
+func (h *MTASTSHandler) ServePolicy(c echo.Context) error {
+	host := strings.ToLower(c.Request().Host)
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+	if !strings.HasPrefix(host, "mta-sts.") {
+		return c.String(http.StatusNotFound, "not found")
+	}
+
+	domain := &models.Domain{}
+	if err := h.db.Where("domain = ? AND is_verified = true AND is_deleted = false", strings.TrimPrefix(host, "mta-sts.")).First(domain).Error; err != nil {
+		return c.String(http.StatusNotFound, "not found")
+	}
+
+	mx, err := h.policyMX(c, domain)
+	if err != nil || len(mx) == 0 {
+		return c.String(http.StatusNotFound, "not found")
+	}
+
+	c.Response().Header().Set("Cache-Control", "max-age=3600")
+	return c.String(http.StatusOK, domain.MTASTSPolicy(mx))
+}
+
+// GetMTASTSSetup returns the MTA-STS policy and TLS-RPT DNS guidance for a domain
+// @Summary Get MTA-STS setup
+// @Description Get the MTA-STS policy and the MTA-STS / TLS-RPT DNS records to publish for a domain
+// @Tags domains
+// @Produce json
+// @Param id path string true "Domain ID"
+// @Success 200 {object} MTASTSSetupResponse
+// @Failure 404 {object} map[string]string "Domain not found"
+// @Router /api/v1/domains/{id}/mta-sts [get]
+func (h *MTASTSHandler) GetMTASTSSetup(c echo.Context) error {
+	teamID := c.Get("teamID").(string)
+
+	domain := &models.Domain{}
+	if err := h.db.Where("id = ? AND team_id = ? AND is_deleted = false", c.Param("id"), teamID).First(domain).Error; err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "domain not found")
+	}
+
+	warnings := []string{}
+	if !domain.IsVerified {
+		warnings = append(warnings, "the policy is only served once the domain is verified")
+	}
+
+	mx, err := h.policyMX(c, domain)
+	if err != nil {
+		warnings = append(warnings, err.Error())
+	}
+	if len(mx) == 0 {
+		warnings = append(warnings, "no MX hosts found; set mtaStsMx or publish MX records")
+	}
+
+	policy := domain.MTASTSPolicy(mx)
+	policyID := models.MTASTSPolicyID(policy)
+
+	publicURL := config.GetConfig().Server.PublicURL
+	publicHost := publicURL
+	if parsed, err := url.Parse(publicURL); err == nil && parsed.Hostname() != "" {
+		publicHost = parsed.Hostname()
+	}
+
+	return c.JSON(http.StatusOK, MTASTSSetupResponse{
+		Domain:    domain.Domain,
+		Verified:  domain.IsVerified,
+		Mode:      domain.MTASTSMode,
+		PolicyURL: "https://" + domain.MTASTSHost() + "/.well-known/mta-sts.txt",
+		PolicyID:  policyID,
+		Policy:    policy,
+		MX:        mx,
+		Records: []DNSRecordGuidance{
+			{
+				Type:    "TXT",
+				Host:    "_mta-sts." + domain.Domain,
+				Value:   "v=STSv1; id=" + policyID,
+				Purpose: "Announces the MTA-STS policy; the id changes whenever the policy does",
+			},
+			{
+				Type:    "CNAME",
+				Host:    domain.MTASTSHost(),
+				Value:   publicHost,
+				Purpose: "Points the policy host at the policy endpoint (requires a TLS certificate for this host)",
+			},
+			{
+				Type:    "TXT",
+				Host:    "_smtp._tls." + domain.Domain,
+				Value:   "v=TLSRPTv1; rua=" + strings.TrimSuffix(publicURL, "/") + "/tlsrpt",
+				Purpose: "Asks sending servers to report TLS delivery failures",
+			},
+		},
+		Warnings: warnings,
+	})
+}
+
+// IngestTLSReport accepts an SMTP TLS report (RFC 8460) posted by a sending mail server
+// @Summary Ingest TLS report
+// @Description Accept a JSON or gzip-compressed SMTP TLS report for a verified domain
+// @Tags domains
+// @Accept json
+// @Produce json
+// @Success 201 {object} map[string]int "Number of policy results stored"
+// @Failure 400 {object} map[string]string "Invalid report"
+// @Router /tlsrpt [post]
+func (h *MTASTSHandler) IngestTLSReport(c echo.Context) error {
+	body, err := io.ReadAll(io.LimitReader(c.Request().Body, maxTLSReportSize+1))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "failed to read report")
+	}
+
+	// Reports are usually gzip compressed (application/tlsrpt+gzip)
+	if bytes.HasPrefix(body, []byte{0x1f, 0x8b}) {
+		reader, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid gzip report")
+		}
+		body, err = io.ReadAll(io.LimitReader(reader, maxTLSReportSize+1))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid gzip report")
+		}
+	}
+	if len(body) > maxTLSReportSize {
+		return echo.NewHTTPError(http.StatusRequestEntityTooLarge, "report too large")
+	}
+
+	var report models.TLSRPTReport
+	if err := json.Unmarshal(body, &report); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid report: "+err.Error())
+	}
+	if report.ReportID == "" || len(report.Policies) == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "report-id and policies are required")
+	}
+
+	stored := 0
+	for _, result := range report.Policies {
+		domain := &models.Domain{}
+		policyDomain := strings.ToLower(strings.TrimSuffix(result.Policy.PolicyDomain, "."))
+		if err := h.db.Where("domain = ? AND is_verified = true AND is_deleted = false", policyDomain).First(domain).Error; err != nil {
+			// Only keep reports for domains we manage
+			continue
+		}
+
+		details, err := json.Marshal(result.FailureDetails)
+		if err != nil {
+			continue
+		}
+
+		row := &models.TLSReport{
+			ReportID:         report.ReportID,
+			OrganizationName: report.OrganizationName,
+			ContactInfo:      report.ContactInfo,
+			StartDate:        report.DateRange.StartDatetime,
+			EndDate:          report.DateRange.EndDatetime,
+			PolicyType:       result.Policy.PolicyType,
+			PolicyDomain:     policyDomain,
+			MXHost:           result.Policy.MXHost,
+			SuccessCount:     result.Summary.TotalSuccessfulSessionCount,
+			FailureCount:     result.Summary.TotalFailureSessionCount,
+			FailureDetails:   details,
+			DomainID:         domain.ID,
+			TeamID:           domain.TeamID,
+		}
+		// Senders may retry a report, so duplicates are ignored
+		if err := h.db.Clauses(clause.OnConflict{DoNothing: true}).Create(row).Error; err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to store report")
+		}
+		stored++
+	}
+
+	return c.JSON(http.StatusCreated, map[string]int{"stored": stored})
+}
+
+// GetTLSFailures summarizes TLS delivery failures per receiving domain
+// @Summary Get TLS delivery failures
+// @Description Summarize SMTP TLS reports per receiving domain for the deliverability dashboard
+// @Tags deliverability
+// @Produce json
+// @Param days query int false "Number of days to include (default 30)"
+// @Success 200 {array} TLSFailureSummary
+// @Router /api/v1/deliverability/tls [get]
+func (h *MTASTSHandler) GetTLSFailures(c echo.Context) error {
+	teamID := c.Get("teamID").(string)
+
+	days := 30
+	if value := c.QueryParam("days"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid days")
+		}
+		days = parsed
+	}
+
+	var reports []models.TLSReport
+	if err := h.db.Where("team_id = ? AND start_date >= ? AND is_deleted = false", teamID, time.Now().AddDate(0, 0, -days)).
+		Find(&reports).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get TLS reports")
+	}
+
+	summaries := make(map[string]*TLSFailureSummary)
+	for _, report := range reports {
+		summary, ok := summaries[report.PolicyDomain]
+		if !ok {
+			summary = &TLSFailureSummary{
+				PolicyDomain: report.PolicyDomain,
+				ResultTypes:  map[string]int64{},
+				MXHosts:      map[string]int64{},
+			}
+			summaries[report.PolicyDomain] = summary
+		}
+
+		summary.Reports++
+		summary.SuccessCount += report.SuccessCount
+		summary.FailureCount += report.FailureCount
+		if report.EndDate.After(summary.LastReportAt) {
+			summary.LastReportAt = report.EndDate
+		}
+
+		var details []models.TLSRPTFailureDetail
+		if err := json.Unmarshal(report.FailureDetails, &details); err != nil {
+			continue
+		}
+		for _, detail := range details {
+			summary.ResultTypes[detail.ResultType] += detail.FailedSessionCount
+			if detail.ReceivingMXHostname != "" {
+				summary.MXHosts[detail.ReceivingMXHostname] += detail.FailedSessionCount
+			}
+		}
+	}
+
+	result := make([]TLSFailureSummary, 0, len(summaries))
+	for _, summary := range summaries {
+		if total := summary.SuccessCount + summary.FailureCount; total > 0 {
+			summary.FailureRate = float64(summary.FailureCount) / float64(total) * 100
+		}
+		result = append(result, *summary)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].FailureCount > result[j].FailureCount })
+
+	return c.JSON(http.StatusOK, result)
+}
+
+// policyMX returns the MX patterns for a domain's policy: the configured list, or its live MX records
+func (h *MTASTSHandler) policyMX(c echo.Context, domain *models.Domain) ([]string, error) {
+	if len(domain.MTASTSMX) > 0 {
+		return domain.MTASTSMX, nil
+	}
+	mx, err := utils.LookupMXHosts(c.Request().Context(), domain.Domain)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up MX records: %w", err)
+	}
+	return mx, nil
+}
@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"kori/internal/config"
+	"kori/internal/models"
+	"kori/internal/utils"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// oauthConnectedPage is shown once a mailbox has been connected
+const oauthConnectedPage = "<h1>Mailbox Connected</h1><p>Your mailbox is connected. You can close this window.</p>"
+
+// oauthFailedPage is shown when connecting a mailbox didn't work
+const oauthFailedPage = "<h1>Connection Failed</h1><p>Your mailbox couldn't be connected: %s</p>"
+
+// OAuthHandler connects Gmail and Outlook mailboxes to SMTP and IMAP configs with OAuth2
+type OAuthHandler struct {
+	db *gorm.DB
+}
+
+func NewOAuthHandler(db *gorm.DB) *OAuthHandler {
+	return &OAuthHandler{db: db}
+}
+
+// OAuthAuthorizeRequest picks the provider a mailbox is connected through
+type OAuthAuthorizeRequest struct {
+	Provider string `json:"provider" validate:"required,oneof=GOOGLE MICROSOFT"`
+}
+
+// AuthorizeSMTPConfig starts connecting an SMTP config with OAuth2
+// @Summary Connect SMTP config with OAuth2
+// @Description Get the Google or Microsoft consent page for the config's mailbox. Once the user consents the config sends with XOAUTH2 instead of its password.
+// @Tags oauth
+// @Accept json
+// @Produce json
+// @Param id path string true "SMTP config ID"
+// @Param request body OAuthAuthorizeRequest true "Provider"
+// @Success 200 {object} map[string]string "authorizeUrl"
+// @Failure 400 {object} map[string]string "Invalid request or provider not configured"
+// @Failure 404 {object} map[string]string "Config not found"
+// @Router /api/v1/oauth/smtp-configs/{id}/authorize [post]
+func (h *OAuthHandler) AuthorizeSMTPConfig(c echo.Context) error {
+	teamID := c.Get("teamID").(string)
+	var count int64
+	if err := h.db.Model(&models.SMTPConfig{}).Where("id = ? AND team_id = ? AND is_deleted = false", c.Param("id"), teamID).Count(&count).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get smtp config")
+	}
+	if count == 0 {
+		return echo.NewHTTPError(http.StatusNotFound, "smtp config not found")
+	}
+	return h.authorize(c, utils.OAuthState{TeamID: teamID, SMTPConfigID: c.Param("id")})
+}
+
+// AuthorizeIMAPConfig starts connecting an IMAP config with OAuth2
+// @Summary Connect IMAP config with OAuth2
+// @Description Get the Google or Microsoft consent page for the config's mailbox. Once the user consents the config signs in with XOAUTH2 instead of its password.
+// @Tags oauth
+// @Accept json
+// @Produce json
+// @Param id path string true "IMAP config ID"
+// @Param request body OAuthAuthorizeRequest true "Provider"
+// @Success 200 {object} map[string]string "authorizeUrl"
+// @Failure 400 {object} map[string]string "Invalid request or provider not configured"
+// @Failure 404 {object} map[string]string "Config not found"
+// @Router /api/v1/oauth/imap-configs/{id}/authorize [post]
+func (h *OAuthHandler) AuthorizeIMAPConfig(c echo.Context) error {
+	teamID := c.Get("teamID").(string)
+	var count int64
+	if err := h.db.Model(&models.IMAPConfig{}).Where("id = ? AND team_id = ? AND is_deleted = false", c.Param("id"), teamID).Count(&count).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get imap config")
+	}
+	if count == 0 {
+		return echo.NewHTTPError(http.StatusNotFound, "imap config not found")
+	}
+	return h.authorize(c, utils.OAuthState{TeamID: teamID, IMAPConfigID: c.Param("id")})
+}
+
+// AuthorizeReputationConnector starts connecting a Google Postmaster Tools connector
+// @Summary Connect reputation connector with Google
+// @Description Get the Google consent page giving the connector read access to the account's Postmaster Tools data
+// @Tags oauth
+// @Produce json
+// @Param id path string true "Reputation connector ID"
+// @Success 200 {object} map[string]string "authorizeUrl"
+// @Failure 400 {object} map[string]string "Not a Postmaster Tools connector or Google not configured"
+// @Failure 404 {object} map[string]string "Connector not found"
+// @Router /api/v1/oauth/reputation-connectors/{id}/authorize [post]
+func (h *OAuthHandler) AuthorizeReputationConnector(c echo.Context) error {
+	teamID := c.Get("teamID").(string)
+	connector := &models.ReputationConnector{}
+	if err := h.db.Select("id", "provider").Where("id = ? AND team_id = ? AND is_deleted = false", c.Param("id"), teamID).
+		First(connector).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "reputation connector not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get reputation connector")
+	}
+	if connector.Provider != models.ReputationProviderGooglePostmaster {
+		return echo.NewHTTPError(http.StatusBadRequest, "only postmaster tools connectors are connected with google")
+	}
+
+	authorizeURL, err := utils.OAuthAuthorizeURL(utils.OAuthState{
+		TeamID:                teamID,
+		Provider:              models.OAuthProviderGoogle,
+		ReputationConnectorID: connector.ID,
+	}, config.GetConfig())
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return c.JSON(http.StatusOK, map[string]string{"authorizeUrl": authorizeURL})
+}
+
+func (h *OAuthHandler) authorize(c echo.Context, state utils.OAuthState) error {
+	request := OAuthAuthorizeRequest{}
+	if err := c.Bind(&request); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request body")
+	}
+	if err := c.Validate(&request); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	state.Provider = models.OAuthProvider(request.Provider)
+
+	authorizeURL, err := utils.OAuthAuthorizeURL(state, config.GetConfig())
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return c.JSON(http.StatusOK, map[string]string{"authorizeUrl": authorizeURL})
+}
+
+// HandleOAuthCallback finishes connecting a mailbox
+// @Summary OAuth2 callback
+// @Description Where Google and Microsoft send the user back to after consenting. The authorization code is exchanged for tokens, which are stored encrypted on the config.
+// @Tags oauth
+// @Produce html
+// @Param code query string false "Authorization code"
+// @Param state query string true "State from the authorize URL"
+// @Param error query string false "Error from the provider"
+// @Success 200 {string} string "Connected page"
+// @Failure 400 {string} string "Connection failed page"
+// @Router /oauth/callback [get]
+func (h *OAuthHandler) HandleOAuthCallback(c echo.Context) error {
+	failed := func(reason string) error {
+		return c.HTML(http.StatusBadRequest, fmt.Sprintf(oauthFailedPage, html.EscapeString(reason)))
+	}
+
+	cfg := config.GetConfig()
+	state, err := utils.ParseOAuthState(c.QueryParam("state"), cfg)
+	if err != nil {
+		return failed("the link has expired, please try again")
+	}
+	if providerErr := c.QueryParam("error"); providerErr != "" {
+		return failed(providerErr)
+	}
+	code := c.QueryParam("code")
+	if code == "" {
+		return failed("no authorization code was returned")
+	}
+
+	token, err := utils.ExchangeOAuthCode(state.Provider, code, cfg)
+	if err != nil {
+		log.Warn("Failed to exchange oauth code for team %s: %v", state.TeamID, err)
+		return failed(err.Error())
+	}
+
+	now := time.Now()
+	credentials := token.Credentials(state.Provider)
+	credentials.AuthType = models.AuthTypeOAuth2
+	credentials.OAuthConnectedAt = &now
+
+	var model interface{} = &models.SMTPConfig{}
+	id := state.SMTPConfigID
+	if state.IMAPConfigID != "" {
+		model, id = &models.IMAPConfig{}, state.IMAPConfigID
+	}
+	if state.ReputationConnectorID != "" {
+		model, id = &models.ReputationConnector{}, state.ReputationConnectorID
+	}
+	var count int64
+	if err := h.db.Model(model).Where("id = ? AND team_id = ? AND is_deleted = false", id, state.TeamID).Count(&count).Error; err != nil || count == 0 {
+		return failed("the config no longer exists")
+	}
+	if err := models.SaveOAuthTokens(model, id, credentials, h.db); err != nil {
+		log.Error("Failed to store oauth tokens", err)
+		return failed("the tokens couldn't be stored")
+	}
+
+	return c.HTML(http.StatusOK, oauthConnectedPage)
+}
@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"errors"
+	"kori/internal/models"
+	"kori/internal/utils/logger"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+var onboardingLog = logger.New("ONBOARDING_HANDLER")
+
+type OnboardingHandler struct {
+	db *gorm.DB
+}
+
+func NewOnboardingHandler(db *gorm.DB) *OnboardingHandler {
+	return &OnboardingHandler{db: db}
+}
+
+// GetOnboarding returns the team's onboarding checklist
+// @Summary Get onboarding checklist
+// @Description Whether the team has done each setup step (SMTP verified, domain verified, list imported, first campaign sent), worked out from its data, plus steps marked complete by hand
+// @Tags onboarding
+// @Produce json
+// @Success 200 {object} models.Onboarding
+// @Router /api/v1/onboarding [get]
+func (h *OnboardingHandler) GetOnboarding(c echo.Context) error {
+	teamID := c.Get("teamID").(string)
+
+	onboarding, err := models.GetOnboarding(teamID, h.db)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get onboarding")
+	}
+
+	return c.JSON(http.StatusOK, onboarding)
+}
+
+// CompleteOnboardingStep marks a step done for teams that did it outside Posthoot
+// @Summary Complete onboarding step
+// @Description Mark a setup step complete by hand, e.g. for a domain verified with another provider
+// @Tags onboarding
+// @Produce json
+// @Param step path string true "Step" Enums(smtp_verified, domain_verified, list_imported, first_campaign_sent)
+// @Success 200 {object} models.Onboarding
+// @Failure 404 {object} map[string]string "Step not found"
+// @Router /api/v1/onboarding/steps/{step}/complete [post]
+func (h *OnboardingHandler) CompleteOnboardingStep(c echo.Context) error {
+	teamID := c.Get("teamID").(string)
+
+	step := c.Param("step")
+	if !models.IsOnboardingStep(step) {
+		return echo.NewHTTPError(http.StatusNotFound, "onboarding step not found")
+	}
+
+	if err := models.CompleteOnboardingStep(teamID, step, h.db); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to complete onboarding step")
+	}
+
+	return h.GetOnboarding(c)
+}
+
+// DismissOnboarding hides the team's checklist
+// @Summary Dismiss onboarding checklist
+// @Description Hide the checklist from the dashboard whether or not every step is done
+// @Tags onboarding
+// @Produce json
+// @Success 200 {object} models.Onboarding
+// @Router /api/v1/onboarding/dismiss [post]
+func (h *OnboardingHandler) DismissOnboarding(c echo.Context) error {
+	return h.setDismissed(c, true)
+}
+
+// RestoreOnboarding shows a dismissed checklist again
+// @Summary Show onboarding checklist again
+// @Description Undo dismissing the checklist
+// @Tags onboarding
+// @Produce json
+// @Success 200 {object} models.Onboarding
+// @Router /api/v1/onboarding/dismiss [delete]
+func (h *OnboardingHandler) RestoreOnboarding(c echo.Context) error {
+	return h.setDismissed(c, false)
+}
+
+func (h *OnboardingHandler) setDismissed(c echo.Context, dismissed bool) error {
+	teamID := c.Get("teamID").(string)
+
+	if err := models.DismissOnboarding(teamID, dismissed, h.db); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to update onboarding")
+	}
+
+	return h.GetOnboarding(c)
+}
+
+// PopulateSampleData fills the team with demo data to explore the dashboard with
+// @Summary Populate sample data
+// @Description Create a demo mailing list of fake @example.com contacts, a couple of templates and a completed campaign with synthetic opens, clicks and bounces, so analytics have something to show. Every row is flagged isSample and nothing is sent. Remove it all with DELETE /api/v1/onboarding/sample-data.
+// @Tags onboarding
+// @Produce json
+// @Success 201 {object} models.SampleData
+// @Failure 409 {object} map[string]string "Team already has sample data"
+// @Router /api/v1/onboarding/sample-data [post]
+func (h *OnboardingHandler) PopulateSampleData(c echo.Context) error {
+	teamID := c.Get("teamID").(string)
+
+	exists, err := models.HasSampleData(teamID, h.db)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to check sample data")
+	}
+	if exists {
+		return echo.NewHTTPError(http.StatusConflict, models.ErrSampleDataExists.Error())
+	}
+
+	// Templates are still created without html when storage isn't configured
+	htmlFiles := make([]*models.File, len(models.SampleTemplates))
+	if storage := GetStorageHandler(); storage != nil {
+		for i, sample := range models.SampleTemplates {
+			url, err := storage.UploadFile(c.Request().Context(), []byte(sample.HTML), "sample-template.html", types.ObjectCannedACLPrivate, "text/html")
+			if err != nil {
+				onboardingLog.Warn("Failed to upload sample template html of team %s: %v", teamID, err)
+				continue
+			}
+			htmlFiles[i] = &models.File{
+				TeamID: teamID,
+				Path:   url[strings.LastIndex(url, "/")+1:],
+				Name:   "sample-template.html",
+				Size:   int64(len(sample.HTML)),
+				Type:   "text/html",
+			}
+		}
+	}
+
+	data, err := models.CreateSampleData(teamID, htmlFiles, h.db)
+	if err != nil {
+		if errors.Is(err, models.ErrSampleDataExists) {
+			return echo.NewHTTPError(http.StatusConflict, err.Error())
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to create sample data")
+	}
+
+	return c.JSON(http.StatusCreated, data)
+}
+
+// DeleteSampleData removes the team's sample data
+// @Summary Delete sample data
+// @Description Remove every row created by populating sample data: the demo list and contacts, the sample templates, the sample campaign and its emails and tracking events
+// @Tags onboarding
+// @Produce json
+// @Success 204
+// @Router /api/v1/onboarding/sample-data [delete]
+func (h *OnboardingHandler) DeleteSampleData(c echo.Context) error {
+	teamID := c.Get("teamID").(string)
+
+	paths, err := models.DeleteSampleData(teamID, h.db)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to delete sample data")
+	}
+
+	if storage := GetStorageHandler(); storage != nil {
+		for _, path := range paths {
+			if err := storage.DeleteFile(c.Request().Context(), path); err != nil {
+				onboardingLog.Warn("Failed to delete sample template html %s: %v", path, err)
+			}
+		}
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
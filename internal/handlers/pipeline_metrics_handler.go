@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"kori/internal/models"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// maxPipelineWindow caps how far back the pipeline metrics look so the percentiles stay cheap
+const maxPipelineWindow = 7 * 24 * time.Hour
+
+// PipelineMetricsHandler exposes the email pipeline's latencies to platform operators
+type PipelineMetricsHandler struct {
+	db     *gorm.DB
+	sla    models.PipelineSLA
+	window time.Duration
+}
+
+func NewPipelineMetricsHandler(db *gorm.DB, sla models.PipelineSLA, window time.Duration) *PipelineMetricsHandler {
+	return &PipelineMetricsHandler{db: db, sla: sla, window: window}
+}
+
+// GetEmailPipelineMetrics returns the email pipeline's latency percentiles
+// @Summary Get email pipeline metrics
+// @Description Time-in-queue and delivery latency percentiles (p50, p95, p99 and max, in seconds) of the emails sent within the window, per queue and per SMTP config and queue. Time in queue runs from an attempt being due to a worker picking it up; delivery runs from the email being due to it being sent, retries included. Groups whose p95 delivery is over their queue's SLA are listed as breaches. Super admins only.
+// @Tags admin
+// @Produce json
+// @Param window query string false "How far back to look, e.g. 15m or 24h (defaults to the SLA window, at most 168h)"
+// @Success 200 {object} models.EmailPipelineMetrics
+// @Failure 400 {object} map[string]string "Invalid window"
+// @Router /api/v1/admin/metrics/email-pipeline [get]
+func (h *PipelineMetricsHandler) GetEmailPipelineMetrics(c echo.Context) error {
+	window := h.window
+	if raw := c.QueryParam("window"); raw != "" {
+		parsed, err := time.ParseDuration(raw)
+		if err != nil || parsed <= 0 || parsed > maxPipelineWindow {
+			return echo.NewHTTPError(http.StatusBadRequest, "window must be a duration between 1s and 168h")
+		}
+		window = parsed
+	}
+
+	metrics, err := models.GetEmailPipelineMetrics(time.Now().Add(-window), h.sla, h.db.WithContext(c.Request().Context()))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get email pipeline metrics")
+	}
+
+	return c.JSON(http.StatusOK, metrics)
+}
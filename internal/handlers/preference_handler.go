@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"bytes"
+	"html/template"
+	"kori/internal/models"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// preferencesPage is the preference center of an email's recipient. Unchecked boxes aren't
+// posted, so every list and category shown is saved as the form leaves it.
+var preferencesPage = template.Must(template.New("preferences").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1"><meta name="robots" content="noindex"><title>Email preferences</title></head>
+<body>
+<h1>Email Preferences</h1>
+<p>Choose what {{.Center.Email}} gets from us.</p>
+{{if .Saved}}<p role="status"><strong>Your preferences were saved.</strong></p>{{end}}
+<form method="POST" action="/preferences?token={{.Token}}">
+<fieldset><legend>Your name</legend>
+<label>First name <input type="text" name="first_name" value="{{.Center.FirstName}}"></label>
+<label>Last name <input type="text" name="last_name" value="{{.Center.LastName}}"></label>
+</fieldset>
+{{if .Center.Lists}}<fieldset><legend>Lists</legend>
+{{range .Center.Lists}}<label><input type="checkbox" name="list_{{.ID}}"{{if .Subscribed}} checked{{end}}> {{.Name}}{{if .Pending}} (waiting for you to confirm){{end}}</label><br>
+{{end}}</fieldset>{{end}}
+{{if .Center.Categories}}<fieldset><legend>Emails about</legend>
+{{range .Center.Categories}}<label><input type="checkbox" name="category_{{.ID}}"{{if .Subscribed}} checked{{end}}> {{.Name}}{{if .Description}} <small>{{.Description}}</small>{{end}}</label><br>
+{{end}}</fieldset>{{end}}
+<p><label><input type="checkbox" name="unsubscribe_all"> Unsubscribe me from everything</label></p>
+<button type="submit">Save preferences</button>
+</form>
+</body></html>
+`))
+
+// preferencesView is what the preference center page is rendered with
+type preferencesView struct {
+	Center *models.PreferenceCenter
+	Token  string
+	Saved  bool
+}
+
+// preferenceContact returns the email behind a preference center token and the contact it was
+// sent to. When either can't be had it answers the request itself, returning no contact.
+func (h *TrackingHandler) preferenceContact(c echo.Context, token string) (*models.Email, *models.Contact, error) {
+	if token == "" {
+		return nil, nil, c.String(http.StatusBadRequest, "Missing token")
+	}
+
+	emailID, err := parseMailToken(token)
+	if err != nil {
+		return nil, nil, c.String(http.StatusUnauthorized, "Invalid token")
+	}
+
+	email, err := models.GetEmailByID(emailID, h.db)
+	if err != nil {
+		return nil, nil, c.String(http.StatusInternalServerError, "Failed to get email")
+	}
+	if email.ContactID == "" {
+		return nil, nil, c.String(http.StatusBadRequest, "Email has no contact with preferences")
+	}
+
+	contact := &models.Contact{}
+	if err := h.db.Where("id = ? AND team_id = ? AND is_deleted = false", email.ContactID, email.TeamID).First(contact).Error; err != nil {
+		return nil, nil, c.String(http.StatusNotFound, "Contact not found")
+	}
+	return email, contact, nil
+}
+
+// renderPreferences renders the preference center of the contact
+func (h *TrackingHandler) renderPreferences(c echo.Context, contact *models.Contact, token string, saved bool) error {
+	center, err := models.GetPreferenceCenter(contact, h.db)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, "Failed to get preferences")
+	}
+
+	var page bytes.Buffer
+	if err := preferencesPage.Execute(&page, preferencesView{Center: center, Token: token, Saved: saved}); err != nil {
+		return c.String(http.StatusInternalServerError, "Failed to render preferences")
+	}
+
+	// The page carries the recipient's details, so it's never cached along the way
+	c.Response().Header().Set("Cache-Control", "no-store")
+	return c.HTML(http.StatusOK, page.String())
+}
+
+// HandlePreferencesPage shows the preference center of an email's recipient
+// @Summary Preference center
+// @Description Page where the recipient of an email chooses the lists and marketing categories they get, changes their name or unsubscribes from everything
+// @Produce html
+// @Param token query string true "Mail token"
+// @Success 200 {string} string "Preference center"
+// @Failure 400 {object} map[string]string "Missing token"
+// @Failure 401 {object} map[string]string "Invalid token"
+// @Failure 404 {object} map[string]string "Contact not found"
+// @Router /preferences [get]
+func (h *TrackingHandler) HandlePreferencesPage(c echo.Context) error {
+	token := c.QueryParam("token")
+	_, contact, err := h.preferenceContact(c, token)
+	if contact == nil {
+		return err
+	}
+
+	return h.renderPreferences(c, contact, token, false)
+}
+
+// HandleUpdatePreferences saves the preference center of an email's recipient
+// @Summary Save preferences
+// @Description Save the lists and marketing categories the recipient of an email chose, and their name
+// @Accept x-www-form-urlencoded
+// @Produce html
+// @Param token query string true "Mail token"
+// @Success 200 {string} string "Preference center with the saved preferences"
+// @Failure 400 {object} map[string]string "Missing token"
+// @Failure 401 {object} map[string]string "Invalid token"
+// @Failure 404 {object} map[string]string "Contact not found"
+// @Router /preferences [post]
+func (h *TrackingHandler) HandleUpdatePreferences(c echo.Context) error {
+	token := c.QueryParam("token")
+	email, contact, err := h.preferenceContact(c, token)
+	if contact == nil {
+		return err
+	}
+
+	// Only what the page showed is saved
+	center, err := models.GetPreferenceCenter(contact, h.db)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, "Failed to get preferences")
+	}
+	update := models.PreferenceUpdate{
+		FirstName:      c.FormValue("first_name"),
+		LastName:       c.FormValue("last_name"),
+		Lists:          map[string]bool{},
+		Categories:     map[string]bool{},
+		UnsubscribeAll: c.FormValue("unsubscribe_all") != "",
+	}
+	for _, list := range center.Lists {
+		update.Lists[list.ID] = c.FormValue("list_"+list.ID) != ""
+	}
+	for _, category := range center.Categories {
+		update.Categories[category.ID] = c.FormValue("category_"+category.ID) != ""
+	}
+
+	unsubscribed, err := models.UpdatePreferences(contact, update, h.db)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, "Failed to save preferences")
+	}
+
+	// Unsubscribing here shows in the email's analytics like the unsubscribe link does
+	if len(unsubscribed) > 0 {
+		if _, err := h.createTrackingEntry(c, email.ID, models.EmailTrackingEventUnsubscribe, "", ""); err != nil {
+			trackingLog.Error("Failed to create unsubscribe tracking entry", err)
+		}
+	}
+
+	if err := h.db.Where("id = ?", contact.ID).First(contact).Error; err != nil {
+		return c.String(http.StatusInternalServerError, "Failed to get contact")
+	}
+	return h.renderPreferences(c, contact, token, true)
+}
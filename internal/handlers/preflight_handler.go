@@ -0,0 +1,403 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"kori/internal/config"
+	"kori/internal/models"
+	"kori/internal/utils"
+	"kori/internal/utils/base64"
+	"maps"
+	"net/http"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Preflight issue severities
+const (
+	PreflightSeverityError   = "error"
+	PreflightSeverityWarning = "warning"
+)
+
+const (
+	// maxConcurrentLinkChecks bounds how many links are checked in parallel
+	maxConcurrentLinkChecks = 8
+
+	// GmailClipThreshold is the html size above which Gmail clips a message (~102KB)
+	GmailClipThreshold = 102 * 1024
+	// gmailClipWarningSize is where we start warning that a message is close to being clipped
+	gmailClipWarningSize = GmailClipThreshold * 9 / 10
+	// sizeSampleRecipients is how many recipients are rendered to measure personalization
+	sizeSampleRecipients = 200
+	// maxReportedRecipients caps the per-recipient entries returned in a size report
+	maxReportedRecipients = 10
+)
+
+var (
+	inlineImageRe = regexp.MustCompile(`(?i)src\s*=\s*["']data:image/`)
+	styleBlockRe  = regexp.MustCompile(`(?is)<style[^>]*>.*?</style>`)
+	htmlCommentRe = regexp.MustCompile(`(?s)<!--.*?-->`)
+	whitespaceRe  = regexp.MustCompile(`\s{2,}`)
+)
+
+type PreflightHandler struct {
+	db *gorm.DB
+}
+
+// PreflightIssue describes a single problem found before sending
+type PreflightIssue struct {
+	Type     string `json:"type"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+	URL      string `json:"url,omitempty"`
+}
+
+// PreflightReport is the result of all preflight checks for a campaign
+type PreflightReport struct {
+	CampaignID string                  `json:"campaignId"`
+	Passed     bool                    `json:"passed"`
+	Errors     int                     `json:"errors"`
+	Warnings   int                     `json:"warnings"`
+	Issues     []PreflightIssue        `json:"issues"`
+	Links      []utils.LinkCheckResult `json:"links"`
+	Size       *SizeReport             `json:"size"`
+	CheckedAt  time.Time               `json:"checkedAt"`
+}
+
+// SizeReport describes the rendered message size of a campaign across a sample of recipients
+type SizeReport struct {
+	BaseSize          int             `json:"baseSize"`
+	MaxSize           int             `json:"maxSize"`
+	AverageSize       int             `json:"averageSize"`
+	Threshold         int             `json:"threshold"`
+	SampledRecipients int             `json:"sampledRecipients"`
+	LargestRecipients []RecipientSize `json:"largestRecipients"`
+	Suggestions       []string        `json:"suggestions"`
+}
+
+// RecipientSize is the rendered size of a campaign for a single recipient
+type RecipientSize struct {
+	ContactID string `json:"contactId"`
+	Email     string `json:"email"`
+	Size      int    `json:"size"`
+}
+
+func NewPreflightHandler(db *gorm.DB) *PreflightHandler {
+	return &PreflightHandler{db: db}
+}
+
+// RunCampaignPreflight checks a campaign's rendered template before it is sent
+// @Summary Run campaign preflight
+// @Description Check every link in the campaign template (status code, redirect chain, HTTPS), the rendered size against Gmail clipping and the sender authentication before sending
+// @Tags campaigns
+// @Produce json
+// @Param id path string true "Campaign ID"
+// @Param refresh query bool false "Ignore cached link check results"
+// @Success 200 {object} PreflightReport
+// @Failure 404 {object} map[string]string "Campaign not found"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /api/v1/campaigns/{id}/preflight [post]
+func (h *PreflightHandler) RunCampaignPreflight(c echo.Context) error {
+	teamID := c.Get("teamID").(string)
+
+	campaign := &models.Campaign{}
+	if err := h.db.Where("id = ? AND team_id = ? AND is_deleted = false", c.Param("id"), teamID).
+		Preload("Template.HtmlFile").First(campaign).Error; err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "campaign not found")
+	}
+
+	if campaign.Template == nil || campaign.Template.HtmlFile == nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "campaign template has no html")
+	}
+
+	html, err := utils.GetHTMLFromURL(campaign.Template.HtmlFile.SignedURL)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get template html")
+	}
+
+	rendered, err := models.RenderSnippets(teamID, []string{html}, h.db)
+	if errors.Is(err, models.ErrSnippetsTooLarge) {
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, err.Error())
+	}
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to render snippets")
+	}
+
+	report := h.buildReport(c.Request().Context(), campaign, rendered[0], c.QueryParam("refresh") == "true")
+
+	return c.JSON(http.StatusOK, report)
+}
+
+// buildReport runs every preflight check against the rendered html
+func (h *PreflightHandler) buildReport(ctx context.Context, campaign *models.Campaign, html string, refresh bool) *PreflightReport {
+	report := &PreflightReport{
+		CampaignID: campaign.ID,
+		Issues:     []PreflightIssue{},
+		CheckedAt:  time.Now(),
+	}
+
+	for i, content := range []string{campaign.Template.Subject, html} {
+		if err := utils.ValidateTemplate(content); err != nil {
+			part := [...]string{"subject", "html"}[i]
+			report.Issues = append(report.Issues, PreflightIssue{
+				Type:     "template_syntax",
+				Severity: PreflightSeverityError,
+				Message:  fmt.Sprintf("The %s can't be rendered, so only its plain variables would be replaced: %v", part, err),
+			})
+		}
+	}
+
+	report.Size = h.checkSize(campaign, html)
+	switch {
+	case report.Size.MaxSize >= GmailClipThreshold:
+		report.Issues = append(report.Issues, PreflightIssue{
+			Type:     "size_clipped",
+			Severity: PreflightSeverityError,
+			Message:  fmt.Sprintf("Rendered email is %.1fKB and will be clipped by Gmail (limit %dKB), hiding the unsubscribe link and open tracking", float64(report.Size.MaxSize)/1024, GmailClipThreshold/1024),
+		})
+	case report.Size.MaxSize >= gmailClipWarningSize:
+		report.Issues = append(report.Issues, PreflightIssue{
+			Type:     "size_near_clipping",
+			Severity: PreflightSeverityWarning,
+			Message:  fmt.Sprintf("Rendered email is %.1fKB, close to Gmail's %dKB clipping limit", float64(report.Size.MaxSize)/1024, GmailClipThreshold/1024),
+		})
+	}
+
+	report.Links = h.checkLinks(ctx, utils.ExtractLinks(html), refresh)
+	for _, link := range report.Links {
+		for _, issue := range link.Issues {
+			severity := PreflightSeverityWarning
+			if utils.IsLinkIssueError(issue) {
+				severity = PreflightSeverityError
+			}
+			report.Issues = append(report.Issues, PreflightIssue{
+				Type:     issue,
+				Severity: severity,
+				Message:  linkIssueMessage(issue, link),
+				URL:      link.URL,
+			})
+		}
+	}
+
+	// Sender misalignments; a missing SMTP config is left for the send to report
+	if auth, err := models.GetSenderAuthentication(campaign, config.GetConfig().Server.PublicURL, h.db); err == nil {
+		for _, issue := range auth.Issues {
+			report.Issues = append(report.Issues, PreflightIssue{
+				Type:     issue.Type,
+				Severity: issue.Severity,
+				Message:  issue.Message,
+			})
+		}
+	}
+
+	for _, issue := range report.Issues {
+		if issue.Severity == PreflightSeverityError {
+			report.Errors++
+		} else {
+			report.Warnings++
+		}
+	}
+	report.Passed = report.Errors == 0
+
+	return report
+}
+
+// checkLinks checks links in parallel, reusing cached results that are still fresh
+func (h *PreflightHandler) checkLinks(ctx context.Context, links []string, refresh bool) []utils.LinkCheckResult {
+	results := make([]utils.LinkCheckResult, len(links))
+
+	cached := make(map[string]models.LinkCheck)
+	if !refresh && len(links) > 0 {
+		var checks []models.LinkCheck
+		if err := h.db.Where("url IN ?", links).Find(&checks).Error; err == nil {
+			for _, check := range checks {
+				if check.IsFresh(time.Now()) {
+					cached[check.URL] = check
+				}
+			}
+		}
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, maxConcurrentLinkChecks)
+	for i, link := range links {
+		if check, ok := cached[link]; ok {
+			results[i] = utils.LinkCheckResult{
+				URL:           check.URL,
+				FinalURL:      check.FinalURL,
+				StatusCode:    check.StatusCode,
+				RedirectChain: check.RedirectChain,
+				IsHTTPS:       check.IsHTTPS,
+				Error:         check.Error,
+				Issues:        check.Issues,
+				CheckedAt:     check.CheckedAt,
+			}
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, link string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			results[i] = utils.CheckLink(ctx, link)
+		}(i, link)
+	}
+	wg.Wait()
+
+	for _, result := range results {
+		if _, ok := cached[result.URL]; ok {
+			continue
+		}
+		check := &models.LinkCheck{
+			URL:           result.URL,
+			FinalURL:      result.FinalURL,
+			StatusCode:    result.StatusCode,
+			RedirectChain: result.RedirectChain,
+			IsHTTPS:       result.IsHTTPS,
+			Error:         result.Error,
+			Issues:        result.Issues,
+			CheckedAt:     result.CheckedAt,
+		}
+		if err := h.db.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "url"}},
+			DoUpdates: clause.AssignmentColumns([]string{"final_url", "status_code", "redirect_chain", "is_https", "error", "issues", "checked_at", "updated_at"}),
+		}).Create(check).Error; err != nil {
+			log.Warn("⚠️ Failed to cache link check for %s: %v", result.URL, err)
+		}
+	}
+
+	return results
+}
+
+// checkSize renders the campaign for a sample of recipients and measures the html size
+func (h *PreflightHandler) checkSize(campaign *models.Campaign, html string) *SizeReport {
+	cfg := config.GetConfig()
+	report := &SizeReport{
+		Threshold:         GmailClipThreshold,
+		LargestRecipients: []RecipientSize{},
+		Suggestions:       []string{},
+	}
+
+	base := renderedSize(html, map[string]string{}, cfg)
+	report.BaseSize = base
+	report.MaxSize = base
+	report.AverageSize = base
+
+	var contacts []models.Contact
+	if audience, err := campaign.AudienceQuery(h.db); err == nil {
+		if exclusions, err := models.GetCampaignExclusions(campaign.ID, h.db); err == nil {
+			if excluded, err := campaign.ApplyExclusions(audience, exclusions, h.db); err == nil {
+				audience = excluded
+			}
+		}
+		audience.Where("contacts.status = ?", models.SubscriberStatusActive).
+			Limit(sizeSampleRecipients).
+			Find(&contacts)
+	}
+
+	contactIDs := make([]string, len(contacts))
+	for i, contact := range contacts {
+		contactIDs[i] = contact.ID
+	}
+	computed, _ := models.ComputeContactFields(campaign.TeamID, contactIDs, h.db)
+
+	var sizes []RecipientSize
+	total := 0
+	for _, contact := range contacts {
+		variables := contact.TemplateVariables()
+		maps.Copy(variables, computed[contact.ID])
+		size := renderedSize(html, variables, cfg)
+		total += size
+		if size > report.MaxSize {
+			report.MaxSize = size
+		}
+		sizes = append(sizes, RecipientSize{ContactID: contact.ID, Email: contact.Email, Size: size})
+	}
+
+	if len(sizes) > 0 {
+		report.SampledRecipients = len(sizes)
+		report.AverageSize = total / len(sizes)
+
+		// Only report recipients that personalization pushes close to the limit
+		sort.Slice(sizes, func(i, j int) bool { return sizes[i].Size > sizes[j].Size })
+		for _, size := range sizes {
+			if size.Size < gmailClipWarningSize || len(report.LargestRecipients) >= maxReportedRecipients {
+				break
+			}
+			report.LargestRecipients = append(report.LargestRecipients, size)
+		}
+	}
+
+	if report.MaxSize >= gmailClipWarningSize {
+		report.Suggestions = sizeSuggestions(html, report)
+	}
+
+	return report
+}
+
+// renderedSize returns the size in bytes of the html after personalization and link tracking
+func renderedSize(html string, variables map[string]string, cfg *config.Config) int {
+	rendered, err := base64.DecodeFromBase64(utils.ReplaceVariables(html, variables, uuid.Nil.String(), cfg, true))
+	if err != nil {
+		return len(html)
+	}
+	return len(rendered)
+}
+
+// sizeSuggestions returns hints for shrinking an html body that is close to being clipped
+func sizeSuggestions(html string, report *SizeReport) []string {
+	var suggestions []string
+	if inlineImageRe.MatchString(html) {
+		suggestions = append(suggestions, "Move inline base64 images to hosted image URLs")
+	}
+	styleBytes := 0
+	for _, block := range styleBlockRe.FindAllString(html, -1) {
+		styleBytes += len(block)
+	}
+	if styleBytes > 10*1024 {
+		suggestions = append(suggestions, fmt.Sprintf("Trim unused CSS (%.1fKB of <style> blocks)", float64(styleBytes)/1024))
+	}
+	if htmlCommentRe.MatchString(html) {
+		suggestions = append(suggestions, "Remove HTML comments")
+	}
+	whitespace := 0
+	for _, run := range whitespaceRe.FindAllString(html, -1) {
+		whitespace += len(run)
+	}
+	if len(html) > 0 && whitespace*10 > len(html) {
+		suggestions = append(suggestions, "Minify the HTML to remove redundant whitespace")
+	}
+	if inflation := report.MaxSize - report.BaseSize; inflation > 5*1024 {
+		suggestions = append(suggestions, fmt.Sprintf("Personalization adds up to %.1fKB for some recipients; check for long merge fields", float64(inflation)/1024))
+	}
+	suggestions = append(suggestions, "Shorten the content or link to a hosted version of the email")
+	return suggestions
+}
+
+func linkIssueMessage(issue string, link utils.LinkCheckResult) string {
+	switch issue {
+	case utils.LinkIssueBroken:
+		return fmt.Sprintf("Link returned HTTP %d", link.StatusCode)
+	case utils.LinkIssueUnreachable:
+		return fmt.Sprintf("Link could not be reached: %s", link.Error)
+	case utils.LinkIssueNotHTTPS:
+		return "Link does not use HTTPS"
+	case utils.LinkIssueInsecureRedirect:
+		return "Link redirects from HTTPS to HTTP"
+	case utils.LinkIssueCrossDomainRedirect:
+		return fmt.Sprintf("Link redirects to a different domain (%s)", link.FinalURL)
+	case utils.LinkIssueLongRedirectChain:
+		return fmt.Sprintf("Link goes through %d redirects", len(link.RedirectChain))
+	default:
+		return issue
+	}
+}
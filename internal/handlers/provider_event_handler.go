@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"kori/internal/events"
+	"kori/internal/models"
+	"kori/internal/utils"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// maxProviderEventsBody caps the size of an event webhook request; SendGrid batches events
+const maxProviderEventsBody = 5 << 20
+
+// ProviderEventHandler takes in the delivery events API providers post for mail sent through them
+type ProviderEventHandler struct {
+	db *gorm.DB
+}
+
+func NewProviderEventHandler(db *gorm.DB) *ProviderEventHandler {
+	return &ProviderEventHandler{db: db}
+}
+
+// HandleProviderEvents records the opens, clicks, bounces and complaints a provider reports
+// @Summary Receive API provider events
+// @Description Event webhook for SMTP configs that send through SendGrid, Mailgun or Postmark. The token is the config's eventWebhookToken. Opens, clicks, bounces and spam complaints are recorded as tracking events; other events are acknowledged and ignored.
+// @Tags tracking
+// @Accept json
+// @Produce json
+// @Param token path string true "Event webhook token of the SMTP config"
+// @Success 200 {object} map[string]int
+// @Failure 400 {string} string "Unreadable events"
+// @Failure 404 {string} string "Unknown token"
+// @Router /webhooks/providers/{token} [post]
+func (h *ProviderEventHandler) HandleProviderEvents(c echo.Context) error {
+	token := c.Param("token")
+	if token == "" {
+		return c.String(http.StatusNotFound, "not found")
+	}
+
+	var config models.SMTPConfig
+	if err := h.db.Where("event_webhook_token = ? AND is_deleted = false", token).First(&config).Error; err != nil {
+		return c.String(http.StatusNotFound, "not found")
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request().Body, maxProviderEventsBody))
+	if err != nil {
+		return c.String(http.StatusBadRequest, "unreadable events")
+	}
+	providerEvents, err := utils.ParseProviderEvents(config.Provider, body)
+	if err != nil {
+		trackingLog.Warn("Unreadable %s events for smtp config %s: %v", config.Provider, config.ID, err)
+		return c.String(http.StatusBadRequest, "unreadable events")
+	}
+
+	// Events that can't be matched are still acknowledged, or the provider keeps retrying them
+	recorded := 0
+	for i := range providerEvents {
+		if h.recordProviderEvent(&config, &providerEvents[i]) {
+			recorded++
+		}
+	}
+
+	return c.JSON(http.StatusOK, map[string]int{"received": len(providerEvents), "recorded": recorded})
+}
+
+// recordProviderEvent stores one provider event against the email it is about
+func (h *ProviderEventHandler) recordProviderEvent(config *models.SMTPConfig, event *utils.ProviderEvent) bool {
+	email := h.findProviderEmail(config.TeamID, event)
+	if email == nil {
+		return false
+	}
+
+	recipient := strings.ToLower(strings.TrimSpace(event.Recipient))
+	if recipient == "" {
+		recipient = strings.ToLower(email.To)
+	}
+
+	metadata, _ := json.Marshal(map[string]interface{}{
+		"source":     strings.ToLower(config.Provider),
+		"bounceType": event.BounceType,
+		"reason":     event.Reason,
+	})
+	tracking := &models.EmailTracking{
+		EmailID:    email.ID,
+		CampaignID: email.CampaignID,
+		ContactID:  email.ContactID,
+		Event:      event.Event,
+		Timestamp:  event.Timestamp,
+		IPAddress:  event.IPAddress,
+		UserAgent:  event.UserAgent,
+		URL:        event.URL,
+		Metadata:   metadata,
+	}
+	// A CC or BCC address bouncing or complaining says nothing about the To contact
+	copied := email.IsCopyRecipient(recipient)
+	if copied {
+		tracking.Recipient = recipient
+		tracking.ContactID = ""
+	}
+	if event.Event == models.EmailTrackingEventOpen || event.Event == models.EmailTrackingEventClick {
+		if source := models.DetectBot(tracking.UserAgent, tracking.IPAddress); source != "" {
+			if err := models.MarkBot(tracking, source); err != nil {
+				trackingLog.Error("Failed to flag provider event as bot", err)
+			}
+		}
+	}
+	if err := h.db.Create(tracking).Error; err != nil {
+		trackingLog.Error("Failed to record provider event", err, email.ID)
+		return false
+	}
+	if _, err := models.FlagAutomatedEngagement(tracking, h.db); err != nil {
+		trackingLog.Error("Failed to check engagement for automation", err)
+	}
+	events.Emit("email_tracking.created", tracking)
+
+	// The address is the same problem on every list it's on
+	contacts := h.db.Model(&models.Contact{}).Where("team_id = ? AND LOWER(email) = ? AND is_deleted = false", config.TeamID, recipient)
+	switch {
+	case event.Event == models.EmailTrackingEventComplaint:
+		contacts.Where("status <> ?", models.SubscriberStatusComplained).Update("status", models.SubscriberStatusComplained)
+	case event.Event == models.EmailTrackingEventBounce && event.BounceType == utils.BounceTypeHard:
+		if !copied {
+			h.db.Model(&models.Email{}).Where("id = ?", email.ID).Update("status", models.EmailStatusBounced)
+			events.Emit("email.hard_bounced", email)
+		}
+		contacts.Where("status = ?", models.SubscriberStatusActive).Update("status", models.SubscriberStatusBounced)
+	}
+	return true
+}
+
+// findProviderEmail matches an event to the email it's about, by the ID we sent along or else
+// by the recipient's latest email
+func (h *ProviderEventHandler) findProviderEmail(teamID string, event *utils.ProviderEvent) *models.Email {
+	email := &models.Email{}
+	if _, err := uuid.Parse(event.EmailID); err == nil {
+		if err := h.db.Where("id = ? AND team_id = ?", event.EmailID, teamID).First(email).Error; err == nil {
+			return email
+		}
+	}
+	if event.Recipient != "" {
+		recipient := strings.ToLower(event.Recipient)
+		if err := h.db.Where("team_id = ? AND (LOWER(\"to\") = ? OR "+models.CopyRecipientSQL+") AND status <> ?", teamID, recipient, recipient, recipient, models.EmailStatusPending).
+			Order("sent_at DESC").First(email).Error; err == nil {
+			return email
+		}
+	}
+	return nil
+}
@@ -0,0 +1,328 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"kori/internal/config"
+	"kori/internal/tasks/embedded"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"github.com/labstack/echo/v4"
+)
+
+// QueueHandler exposes the asynq queues to platform operators
+type QueueHandler struct {
+	inspector queueInspector
+}
+
+// queueInspector is asynq's inspector, or the embedded queue's when Redis isn't configured
+type queueInspector interface {
+	Queues() ([]string, error)
+	GetQueueInfo(queue string) (*asynq.QueueInfo, error)
+	ListPendingTasks(queue string, opts ...asynq.ListOption) ([]*asynq.TaskInfo, error)
+	ListActiveTasks(queue string, opts ...asynq.ListOption) ([]*asynq.TaskInfo, error)
+	ListScheduledTasks(queue string, opts ...asynq.ListOption) ([]*asynq.TaskInfo, error)
+	ListRetryTasks(queue string, opts ...asynq.ListOption) ([]*asynq.TaskInfo, error)
+	ListArchivedTasks(queue string, opts ...asynq.ListOption) ([]*asynq.TaskInfo, error)
+	GetTaskInfo(queue, id string) (*asynq.TaskInfo, error)
+	RunTask(queue, id string) error
+	DeleteTask(queue, id string) error
+	PauseQueue(queue string) error
+	UnpauseQueue(queue string) error
+}
+
+func NewQueueHandler(redis config.RedisConfig) *QueueHandler {
+	if redis.UsesEmbeddedQueue() {
+		return &QueueHandler{inspector: embedded.Default()}
+	}
+	return &QueueHandler{inspector: asynq.NewInspector(asynq.RedisClientOpt{
+		Addr:     redis.Addr,
+		Username: redis.Username,
+		Password: redis.Password,
+		DB:       redis.DB,
+	})}
+}
+
+// QueueSummary is the state of one queue
+type QueueSummary struct {
+	Queue     string    `json:"queue"`
+	Paused    bool      `json:"paused"`
+	Size      int       `json:"size"`
+	Pending   int       `json:"pending"`
+	Active    int       `json:"active"`
+	Scheduled int       `json:"scheduled"`
+	Retry     int       `json:"retry"`
+	Dead      int       `json:"dead"`
+	Processed int       `json:"processed"` // today
+	Failed    int       `json:"failed"`    // today
+	Latency   string    `json:"latency"`   // how long the oldest pending task has waited
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// QueuedTask is a task as stored in a queue
+type QueuedTask struct {
+	ID            string          `json:"id"`
+	Queue         string          `json:"queue"`
+	Type          string          `json:"type"`
+	State         string          `json:"state"`
+	Payload       json.RawMessage `json:"payload"`
+	MaxRetry      int             `json:"maxRetry"`
+	Retried       int             `json:"retried"`
+	LastError     string          `json:"lastError,omitempty"`
+	LastFailedAt  *time.Time      `json:"lastFailedAt,omitempty"`
+	NextProcessAt *time.Time      `json:"nextProcessAt,omitempty"`
+	IsOrphaned    bool            `json:"isOrphaned,omitempty"`
+}
+
+// queueTaskStates maps the states tasks can be listed by; dead tasks are asynq's archived ones
+var queueTaskStates = map[string]func(queueInspector, string, ...asynq.ListOption) ([]*asynq.TaskInfo, error){
+	"pending":   queueInspector.ListPendingTasks,
+	"active":    queueInspector.ListActiveTasks,
+	"scheduled": queueInspector.ListScheduledTasks,
+	"retry":     queueInspector.ListRetryTasks,
+	"dead":      queueInspector.ListArchivedTasks,
+}
+
+// ListQueues lists every task queue with its task counts
+// @Summary List task queues
+// @Description Task counts of every asynq queue. Super admins only.
+// @Tags admin
+// @Produce json
+// @Success 200 {array} QueueSummary
+// @Failure 403 {object} map[string]string "Not a super admin"
+// @Router /api/v1/admin/queues [get]
+func (h *QueueHandler) ListQueues(c echo.Context) error {
+	queues, err := h.inspector.Queues()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to list queues")
+	}
+
+	summaries := make([]QueueSummary, 0, len(queues))
+	for _, queue := range queues {
+		info, err := h.inspector.GetQueueInfo(queue)
+		if err != nil {
+			if errors.Is(err, asynq.ErrQueueNotFound) {
+				continue
+			}
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to get queue info")
+		}
+		summaries = append(summaries, QueueSummary{
+			Queue:     info.Queue,
+			Paused:    info.Paused,
+			Size:      info.Size,
+			Pending:   info.Pending,
+			Active:    info.Active,
+			Scheduled: info.Scheduled,
+			Retry:     info.Retry,
+			Dead:      info.Archived,
+			Processed: info.Processed,
+			Failed:    info.Failed,
+			Latency:   info.Latency.String(),
+			Timestamp: info.Timestamp,
+		})
+	}
+
+	return c.JSON(http.StatusOK, summaries)
+}
+
+// ListQueueTasks lists the tasks of a queue in one state
+// @Summary List queued tasks
+// @Description Tasks of a queue that are pending, active, scheduled, waiting to retry or dead. Super admins only.
+// @Tags admin
+// @Produce json
+// @Param queue path string true "Queue name"
+// @Param state query string false "Task state (default pending)" Enums(pending, active, scheduled, retry, dead)
+// @Param page query int false "Page (default 1)"
+// @Param limit query int false "Page size (default 50, max 500)"
+// @Success 200 {array} QueuedTask
+// @Failure 400 {object} map[string]string "Invalid state or pagination"
+// @Failure 403 {object} map[string]string "Not a super admin"
+// @Failure 404 {object} map[string]string "Queue not found"
+// @Router /api/v1/admin/queues/{queue}/tasks [get]
+func (h *QueueHandler) ListQueueTasks(c echo.Context) error {
+	queue := c.Param("queue")
+
+	state := c.QueryParam("state")
+	if state == "" {
+		state = "pending"
+	}
+	list, ok := queueTaskStates[state]
+	if !ok {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid state")
+	}
+
+	page, limit := 1, 50
+	if value := c.QueryParam("page"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid page")
+		}
+		page = parsed
+	}
+	if value := c.QueryParam("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > 500 {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid limit")
+		}
+		limit = parsed
+	}
+
+	info, err := h.inspector.GetQueueInfo(queue)
+	if err != nil {
+		return queueError(err)
+	}
+
+	infos, err := list(h.inspector, queue, asynq.Page(page), asynq.PageSize(limit))
+	if err != nil {
+		return queueError(err)
+	}
+
+	tasks := make([]QueuedTask, len(infos))
+	for i, task := range infos {
+		tasks[i] = toQueuedTask(task)
+	}
+
+	total := map[string]int{
+		"pending":   info.Pending,
+		"active":    info.Active,
+		"scheduled": info.Scheduled,
+		"retry":     info.Retry,
+		"dead":      info.Archived,
+	}[state]
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":  tasks,
+		"total": total,
+		"page":  page,
+		"limit": limit,
+	})
+}
+
+// RetryQueueTask runs a dead, retrying or scheduled task now
+// @Summary Retry a task
+// @Description Move a dead, retrying or scheduled task to pending so it runs right away. Super admins only.
+// @Tags admin
+// @Produce json
+// @Param queue path string true "Queue name"
+// @Param taskId path string true "Task ID"
+// @Success 200 {object} QueuedTask
+// @Failure 403 {object} map[string]string "Not a super admin"
+// @Failure 404 {object} map[string]string "Task not found"
+// @Failure 409 {object} map[string]string "Task is already pending or running"
+// @Router /api/v1/admin/queues/{queue}/tasks/{taskId}/retry [post]
+func (h *QueueHandler) RetryQueueTask(c echo.Context) error {
+	queue, taskID := c.Param("queue"), c.Param("taskId")
+
+	if err := h.inspector.RunTask(queue, taskID); err != nil {
+		return queueError(err)
+	}
+
+	task, err := h.inspector.GetTaskInfo(queue, taskID)
+	if err != nil {
+		return queueError(err)
+	}
+	return c.JSON(http.StatusOK, toQueuedTask(task))
+}
+
+// DeleteQueueTask removes a task that isn't running
+// @Summary Delete a task
+// @Description Delete a pending, scheduled, retrying or dead task. Running tasks can't be deleted. Super admins only.
+// @Tags admin
+// @Param queue path string true "Queue name"
+// @Param taskId path string true "Task ID"
+// @Success 204
+// @Failure 403 {object} map[string]string "Not a super admin"
+// @Failure 404 {object} map[string]string "Task not found"
+// @Failure 409 {object} map[string]string "Task is running"
+// @Router /api/v1/admin/queues/{queue}/tasks/{taskId} [delete]
+func (h *QueueHandler) DeleteQueueTask(c echo.Context) error {
+	if err := h.inspector.DeleteTask(c.Param("queue"), c.Param("taskId")); err != nil {
+		return queueError(err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// PauseQueue stops workers from taking tasks off a queue
+// @Summary Pause a queue
+// @Description Workers stop processing the queue; tasks keep being enqueued. Super admins only.
+// @Tags admin
+// @Produce json
+// @Param queue path string true "Queue name"
+// @Success 200 {object} map[string]interface{}
+// @Failure 403 {object} map[string]string "Not a super admin"
+// @Failure 404 {object} map[string]string "Queue not found"
+// @Router /api/v1/admin/queues/{queue}/pause [post]
+func (h *QueueHandler) PauseQueue(c echo.Context) error {
+	queue := c.Param("queue")
+	if _, err := h.inspector.GetQueueInfo(queue); err != nil {
+		return queueError(err)
+	}
+	if err := h.inspector.PauseQueue(queue); err != nil {
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{"queue": queue, "paused": true})
+}
+
+// UnpauseQueue lets workers process a paused queue again
+// @Summary Resume a queue
+// @Description Workers start processing a paused queue again. Super admins only.
+// @Tags admin
+// @Produce json
+// @Param queue path string true "Queue name"
+// @Success 200 {object} map[string]interface{}
+// @Failure 403 {object} map[string]string "Not a super admin"
+// @Failure 404 {object} map[string]string "Queue not found"
+// @Router /api/v1/admin/queues/{queue}/unpause [post]
+func (h *QueueHandler) UnpauseQueue(c echo.Context) error {
+	queue := c.Param("queue")
+	if _, err := h.inspector.GetQueueInfo(queue); err != nil {
+		return queueError(err)
+	}
+	if err := h.inspector.UnpauseQueue(queue); err != nil {
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{"queue": queue, "paused": false})
+}
+
+func toQueuedTask(task *asynq.TaskInfo) QueuedTask {
+	queued := QueuedTask{
+		ID:         task.ID,
+		Queue:      task.Queue,
+		Type:       task.Type,
+		State:      task.State.String(),
+		MaxRetry:   task.MaxRetry,
+		Retried:    task.Retried,
+		LastError:  task.LastErr,
+		IsOrphaned: task.IsOrphaned,
+	}
+	if task.State == asynq.TaskStateArchived {
+		queued.State = "dead"
+	}
+	if json.Valid(task.Payload) {
+		queued.Payload = task.Payload
+	} else {
+		queued.Payload, _ = json.Marshal(string(task.Payload))
+	}
+	if !task.LastFailedAt.IsZero() {
+		queued.LastFailedAt = &task.LastFailedAt
+	}
+	if !task.NextProcessAt.IsZero() {
+		queued.NextProcessAt = &task.NextProcessAt
+	}
+	return queued
+}
+
+// queueError maps inspector errors to responses
+func queueError(err error) error {
+	switch {
+	case errors.Is(err, asynq.ErrQueueNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, "queue not found")
+	case errors.Is(err, asynq.ErrTaskNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, "task not found")
+	}
+	// The inspector refuses to run or delete tasks that are pending or active
+	return echo.NewHTTPError(http.StatusConflict, err.Error())
+}
@@ -0,0 +1,279 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"html/template"
+	"kori/internal/models"
+	"kori/internal/utils"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// reportShareTokenLength is the length of the random token in share links
+const reportShareTokenLength = 40
+
+type ReportShareHandler struct {
+	db *gorm.DB
+}
+
+func NewReportShareHandler(db *gorm.DB) *ReportShareHandler {
+	return &ReportShareHandler{db: db}
+}
+
+// CreateReportShareRequest is the campaign a share link is for and how long it works
+type CreateReportShareRequest struct {
+	CampaignID    string `json:"campaignId" validate:"required,uuid"`
+	ExpiresInDays int    `json:"expiresInDays" validate:"omitempty,min=1,max=365"` // defaults to 30 days
+	ExcludeBots   bool   `json:"excludeBots"`
+}
+
+// ReportShareResponse is a new share link. The token is only ever returned here.
+type ReportShareResponse struct {
+	models.ReportShare
+	Token string `json:"token"`
+	Path  string `json:"path"` // where the report is read, without signing in
+}
+
+// SharedReport is the summary of a campaign's results shown through a share link. It only
+// carries aggregates, never anything about single recipients.
+type SharedReport struct {
+	CampaignName string                `json:"campaignName"`
+	Status       models.CampaignStatus `json:"status"`
+	ScheduledFor time.Time             `json:"scheduledFor"`
+	Recipients   int                   `json:"recipients"`
+	Opens        int                   `json:"opens"`
+	UniqueOpens  int                   `json:"uniqueOpens"`
+	OpenRate     float64               `json:"openRate"`
+	Clicks       int                   `json:"clicks"`
+	UniqueClicks int                   `json:"uniqueClicks"`
+	ClickRate    float64               `json:"clickRate"`
+	Bounces      int                   `json:"bounces"`
+	Complaints   int                   `json:"complaints"`
+	Devices      map[string]int        `json:"devices"`
+	Countries    map[string]int        `json:"countries"`
+	Links        []SharedReportLink    `json:"links"`
+	ExcludesBots bool                  `json:"excludesBots"`
+	GeneratedAt  time.Time             `json:"generatedAt"`
+	ExpiresAt    time.Time             `json:"expiresAt"`
+}
+
+// SharedReportLink is the clicks of one link in a shared report
+type SharedReportLink struct {
+	Label        string `json:"label,omitempty"`
+	URL          string `json:"url"`
+	Clicks       int    `json:"clicks"`
+	UniqueClicks int    `json:"uniqueClicks"`
+}
+
+// sharedReportPage renders a shared report for browsers
+var sharedReportPage = template.Must(template.New("shared-report").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><meta name="robots" content="noindex"><title>{{.CampaignName}}</title></head>
+<body>
+<h1>{{.CampaignName}}</h1>
+<table>
+<tr><th>Recipients</th><td>{{.Recipients}}</td></tr>
+<tr><th>Opens</th><td>{{.Opens}} ({{.UniqueOpens}} unique, {{printf "%.1f" .OpenRate}}%)</td></tr>
+<tr><th>Clicks</th><td>{{.Clicks}} ({{.UniqueClicks}} unique, {{printf "%.1f" .ClickRate}}%)</td></tr>
+<tr><th>Bounces</th><td>{{.Bounces}}</td></tr>
+<tr><th>Complaints</th><td>{{.Complaints}}</td></tr>
+</table>
+{{if .Links}}<h2>Links</h2>
+<table>
+<tr><th>Link</th><th>Clicks</th><th>Unique clicks</th></tr>
+{{range .Links}}<tr><td>{{if .Label}}{{.Label}}<br>{{end}}{{.URL}}</td><td>{{.Clicks}}</td><td>{{.UniqueClicks}}</td></tr>
+{{end}}</table>{{end}}
+<p>{{if .ExcludesBots}}Opens and clicks by privacy proxies and scanners are left out. {{end}}Generated {{.GeneratedAt.Format "2006-01-02 15:04 MST"}}; this link works until {{.ExpiresAt.Format "2006-01-02"}}.</p>
+</body></html>
+`))
+
+// CreateReportShare creates a read-only link to a campaign's report
+// @Summary Create report share link
+// @Description Create a link to a campaign's report that people without an account can read until it expires or is revoked. Links last 30 days by default and at most a year.
+// @Tags report-shares
+// @Accept json
+// @Produce json
+// @Param request body CreateReportShareRequest true "Campaign, lifetime and bot filtering"
+// @Success 201 {object} ReportShareResponse
+// @Failure 400 {object} map[string]string "Invalid lifetime or campaign"
+// @Router /api/v1/report-shares [post]
+func (h *ReportShareHandler) CreateReportShare(c echo.Context) error {
+	teamID := c.Get("teamID").(string)
+
+	req := new(CreateReportShareRequest)
+	if err := c.Bind(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request body")
+	}
+	if err := c.Validate(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if err := h.db.Where("id = ? AND team_id = ? AND is_deleted = false", req.CampaignID, teamID).
+		First(&models.Campaign{}).Error; err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "campaign not found")
+	}
+
+	ttl := models.DefaultReportShareTTL
+	if req.ExpiresInDays > 0 {
+		ttl = time.Duration(req.ExpiresInDays) * 24 * time.Hour
+	}
+
+	token, err := utils.GenerateRandomString(reportShareTokenLength)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to generate share token")
+	}
+
+	share := &models.ReportShare{
+		TeamID:      teamID,
+		CampaignID:  req.CampaignID,
+		TokenHash:   models.HashReportShareToken(token),
+		ExcludeBots: req.ExcludeBots,
+		ExpiresAt:   time.Now().Add(min(ttl, models.MaxReportShareTTL)),
+	}
+	if userID, ok := c.Get("userID").(string); ok {
+		share.CreatedByUserID = userID
+	}
+	if err := h.db.Create(share).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to create share link")
+	}
+
+	return c.JSON(http.StatusCreated, &ReportShareResponse{ReportShare: *share, Token: token, Path: "/share/reports/" + token})
+}
+
+// ListReportShares lists the team's share links that still work
+// @Summary List report share links
+// @Description List the share links of the team that are neither revoked nor expired, optionally of one campaign
+// @Tags report-shares
+// @Produce json
+// @Param campaignId query string false "Campaign ID"
+// @Success 200 {array} models.ReportShare
+// @Router /api/v1/report-shares [get]
+func (h *ReportShareHandler) ListReportShares(c echo.Context) error {
+	teamID := c.Get("teamID").(string)
+
+	query := h.db.Where("team_id = ? AND is_deleted = false AND expires_at > ?", teamID, time.Now())
+	if campaignID := c.QueryParam("campaignId"); campaignID != "" {
+		query = query.Where("campaign_id = ?", campaignID)
+	}
+
+	var shares []models.ReportShare
+	if err := query.Order("created_at DESC").Find(&shares).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to list share links")
+	}
+
+	return c.JSON(http.StatusOK, shares)
+}
+
+// RevokeReportShare stops a share link from working
+// @Summary Revoke report share link
+// @Description Stop a share link from working straight away
+// @Tags report-shares
+// @Param id path string true "Report share ID"
+// @Success 204
+// @Failure 404 {object} map[string]string "Share link not found"
+// @Router /api/v1/report-shares/{id} [delete]
+func (h *ReportShareHandler) RevokeReportShare(c echo.Context) error {
+	teamID := c.Get("teamID").(string)
+
+	result := h.db.Model(&models.ReportShare{}).
+		Where("id = ? AND team_id = ? AND is_deleted = false", c.Param("id"), teamID).
+		Update("is_deleted", true)
+	if result.Error != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to revoke share link")
+	}
+	if result.RowsAffected == 0 {
+		return echo.NewHTTPError(http.StatusNotFound, "share link not found")
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// GetSharedReport returns the report behind a share link, without authentication
+// @Summary Read shared report
+// @Description Read the summary of a campaign's results through a share link. Browsers asking for HTML, or format=html, get a rendered page.
+// @Tags report-shares
+// @Produce json,html
+// @Param token path string true "Share token"
+// @Param format query string false "json or html"
+// @Success 200 {object} SharedReport
+// @Failure 404 {object} map[string]string "Share link not found, revoked or expired"
+// @Router /share/reports/{token} [get]
+func (h *ReportShareHandler) GetSharedReport(c echo.Context) error {
+	share, err := models.GetActiveReportShare(c.Param("token"), h.db)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "share link not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to read share link")
+	}
+
+	var campaign models.Campaign
+	if err := h.db.Where("id = ? AND team_id = ? AND is_deleted = false", share.CampaignID, share.TeamID).
+		First(&campaign).Error; err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "share link not found")
+	}
+
+	analytics, err := campaignAnalytics(h.db, campaign.ID, humanEvents(campaignEvents(campaign.ID, time.Time{}), share.ExcludeBots))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fetch analytics")
+	}
+
+	report := SharedReport{
+		CampaignName: campaign.Name,
+		Status:       campaign.Status,
+		ScheduledFor: campaign.ScheduledFor,
+		Recipients:   analytics.Recipients,
+		Opens:        analytics.OpenCount,
+		UniqueOpens:  analytics.UniqueOpens,
+		OpenRate:     analytics.OpenRate,
+		Clicks:       analytics.ClickCount,
+		UniqueClicks: analytics.UniqueClicks,
+		ClickRate:    analytics.ClickRate,
+		Bounces:      analytics.BounceCount,
+		Complaints:   analytics.ComplaintCount,
+		Devices:      analytics.DeviceBreakdown,
+		Countries:    analytics.GeoBreakdown,
+		Links:        []SharedReportLink{},
+		ExcludesBots: share.ExcludeBots,
+		GeneratedAt:  time.Now().UTC(),
+		ExpiresAt:    share.ExpiresAt.UTC(),
+	}
+	for _, link := range analytics.ClickedLinks {
+		report.Links = append(report.Links, SharedReportLink{
+			Label:        link.Label,
+			URL:          link.URL,
+			Clicks:       link.ClickCount,
+			UniqueClicks: link.UniqueClicks,
+		})
+	}
+
+	// Views are only counted for the team, so a failure doesn't keep the report from clients
+	if err := models.RecordReportShareView(share.ID, h.db); err != nil {
+		trackingLog.Error("Failed to record shared report view", err, share.ID)
+	}
+
+	// Shared reports are read by anyone holding the link, so they're never cached along the way
+	c.Response().Header().Set("Cache-Control", "no-store")
+	c.Response().Header().Set("Referrer-Policy", "no-referrer")
+
+	if wantsHTML(c) {
+		var page bytes.Buffer
+		if err := sharedReportPage.Execute(&page, report); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to render report")
+		}
+		return c.HTMLBlob(http.StatusOK, page.Bytes())
+	}
+	return c.JSON(http.StatusOK, report)
+}
+
+// wantsHTML reports whether a shared report should be rendered as a page rather than JSON
+func wantsHTML(c echo.Context) bool {
+	if format := c.QueryParam("format"); format != "" {
+		return format == "html"
+	}
+	return strings.Contains(c.Request().Header.Get(echo.HeaderAccept), echo.MIMETextHTML)
+}
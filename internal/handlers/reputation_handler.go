@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"kori/internal/models"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// ReputationHandler serves the reputation data pulled from Google Postmaster Tools and Microsoft SNDS
+type ReputationHandler struct {
+	db *gorm.DB
+}
+
+func NewReputationHandler(db *gorm.DB) *ReputationHandler {
+	return &ReputationHandler{db: db}
+}
+
+// GetReputation returns the daily reputation of the team's domains at Gmail and IPs at Outlook
+// @Summary Get sender reputation
+// @Description Daily domain reputation, spam rate and delivery errors from Postmaster Tools and SNDS, per domain or IP, with the trend over the period
+// @Tags deliverability
+// @Produce json
+// @Param days query int false "Number of days to include (default 30)"
+// @Success 200 {array} models.ReputationSeries
+// @Failure 400 {object} map[string]string "Invalid days"
+// @Router /api/v1/deliverability/reputation [get]
+func (h *ReputationHandler) GetReputation(c echo.Context) error {
+	teamID := c.Get("teamID").(string)
+
+	days := 30
+	if value := c.QueryParam("days"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 || parsed > 365 {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid days")
+		}
+		days = parsed
+	}
+
+	series, err := models.GetReputationSeries(teamID, days, h.db)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get reputation")
+	}
+	if series == nil {
+		series = []models.ReputationSeries{}
+	}
+	return c.JSON(http.StatusOK, series)
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"fmt"
+	"kori/internal/models"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+type RetentionHandler struct {
+	db *gorm.DB
+}
+
+// RetentionSettings is how long a team keeps its raw tracking events
+type RetentionSettings struct {
+	TrackingRetentionDays int        `json:"trackingRetentionDays"`          // 0 keeps them forever
+	TrackingPrunedBefore  *time.Time `json:"trackingPrunedBefore,omitempty"` // only the rollups have events before this
+}
+
+func NewRetentionHandler(db *gorm.DB) *RetentionHandler {
+	return &RetentionHandler{db: db}
+}
+
+// GetRetentionSettings returns the team's retention settings
+// @Summary Get retention settings
+// @Description Get how many days raw opens, clicks and other tracking events are kept, and the time before which they were pruned. Analytics keep counting pruned events through the hourly rollups.
+// @Tags retention
+// @Produce json
+// @Success 200 {object} RetentionSettings
+// @Failure 404 {object} map[string]string "Team settings not found"
+// @Router /api/v1/retention [get]
+func (h *RetentionHandler) GetRetentionSettings(c echo.Context) error {
+	teamID := c.Get("teamID").(string)
+
+	settings := &models.TeamSettings{}
+	if err := h.db.Where("team_id = ? AND is_deleted = false", teamID).First(settings).Error; err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "team settings not found")
+	}
+
+	return c.JSON(http.StatusOK, RetentionSettings{
+		TrackingRetentionDays: settings.TrackingRetentionDays,
+		TrackingPrunedBefore:  settings.TrackingPrunedBefore,
+	})
+}
+
+// UpdateRetentionSettings sets how long the team keeps its raw tracking events
+// @Summary Update retention settings
+// @Description Set how many days raw tracking events are kept. Older events are deleted daily once the rollups have aggregated them; 0 keeps them forever.
+// @Tags retention
+// @Accept json
+// @Produce json
+// @Param request body RetentionSettings true "Retention settings"
+// @Success 200 {object} RetentionSettings
+// @Failure 400 {object} map[string]string "Invalid retention"
+// @Failure 404 {object} map[string]string "Team settings not found"
+// @Router /api/v1/retention [put]
+func (h *RetentionHandler) UpdateRetentionSettings(c echo.Context) error {
+	teamID := c.Get("teamID").(string)
+
+	var req RetentionSettings
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request body")
+	}
+	if req.TrackingRetentionDays != 0 &&
+		(req.TrackingRetentionDays < models.MinTrackingRetentionDays || req.TrackingRetentionDays > models.MaxTrackingRetentionDays) {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("tracking retention must be 0 or between %d and %d days",
+			models.MinTrackingRetentionDays, models.MaxTrackingRetentionDays))
+	}
+
+	settings := &models.TeamSettings{}
+	if err := h.db.Where("team_id = ? AND is_deleted = false", teamID).First(settings).Error; err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "team settings not found")
+	}
+
+	before := map[string]int{"trackingRetentionDays": settings.TrackingRetentionDays}
+	if err := h.db.Model(settings).Update("tracking_retention_days", req.TrackingRetentionDays).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to update retention settings")
+	}
+	models.RecordAuditChange(c.Request().Context(), models.AuditActionUpdate, "team_settings", settings.ID,
+		before, map[string]int{"trackingRetentionDays": req.TrackingRetentionDays})
+
+	return c.JSON(http.StatusOK, RetentionSettings{
+		TrackingRetentionDays: req.TrackingRetentionDays,
+		TrackingPrunedBefore:  settings.TrackingPrunedBefore,
+	})
+}
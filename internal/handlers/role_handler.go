@@ -0,0 +1,289 @@
+package handlers
+
+import (
+	"errors"
+	"kori/internal/models"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// RoleHandler manages a team's custom roles and who has them
+type RoleHandler struct {
+	db *gorm.DB
+}
+
+func NewRoleHandler(db *gorm.DB) *RoleHandler {
+	return &RoleHandler{db: db}
+}
+
+// RoleRequest is a custom role to save. Permissions are resource:action, e.g. campaigns:write
+// or analytics:read, where either side can be *.
+type RoleRequest struct {
+	Name        string   `json:"name" validate:"required,min=2,max=100"`
+	Description string   `json:"description" validate:"max=500"`
+	Permissions []string `json:"permissions" validate:"required,min=1"`
+}
+
+// RolePermissionsResponse lists what roles can be granted
+type RolePermissionsResponse struct {
+	Resources    map[string][]string `json:"resources"`    // each resource with its actions
+	BuiltInRoles map[string][]string `json:"builtInRoles"` // the permissions of the built-in roles
+}
+
+// ListRoles lists the team's custom roles
+// @Summary List roles
+// @Tags roles
+// @Produce json
+// @Success 200 {array} models.Role
+// @Router /api/v1/roles [get]
+func (h *RoleHandler) ListRoles(c echo.Context) error {
+	roles := []models.Role{}
+	if err := h.db.Where("team_id = ? AND is_deleted = false", c.Get("teamID").(string)).
+		Order("name").Find(&roles).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get roles")
+	}
+	return c.JSON(http.StatusOK, roles)
+}
+
+// ListRolePermissions lists the permissions a role can be given
+// @Summary List role permissions
+// @Description List the resources and actions roles can grant, and the permissions of the built-in roles to start from
+// @Tags roles
+// @Produce json
+// @Success 200 {object} RolePermissionsResponse
+// @Router /api/v1/roles/permissions [get]
+func (h *RoleHandler) ListRolePermissions(c echo.Context) error {
+	return c.JSON(http.StatusOK, RolePermissionsResponse{
+		Resources: models.PermissionResources(),
+		BuiltInRoles: map[string][]string{
+			string(models.UserRoleAdmin):  {"*:*"},
+			string(models.UserRoleMember): models.BuiltInRolePermissions(models.UserRoleMember),
+		},
+	})
+}
+
+// GetRole returns one of the team's roles with its members
+// @Summary Get role
+// @Tags roles
+// @Produce json
+// @Param id path string true "Role ID"
+// @Success 200 {object} models.Role
+// @Failure 404 {object} map[string]string "Role not found"
+// @Router /api/v1/roles/{id} [get]
+func (h *RoleHandler) GetRole(c echo.Context) error {
+	role, err := h.getRole(c, c.Param("id"))
+	if err != nil {
+		return err
+	}
+	if err := h.db.Select("id", "email", "first_name", "last_name", "role", "role_id").
+		Where("role_id = ? AND is_deleted = false", role.ID).Find(&role.Users).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get role members")
+	}
+	return c.JSON(http.StatusOK, role)
+}
+
+// CreateRole adds a custom role
+// @Summary Create role
+// @Description Add a role with its own set of permissions, e.g. a "Campaign Manager" with campaigns:*, templates:* and lists:read
+// @Tags roles
+// @Accept json
+// @Produce json
+// @Param request body RoleRequest true "Role"
+// @Success 201 {object} models.Role
+// @Failure 400 {object} map[string]string "Invalid role"
+// @Failure 409 {object} map[string]string "Role name taken"
+// @Router /api/v1/roles [post]
+func (h *RoleHandler) CreateRole(c echo.Context) error {
+	req, err := bindRole(c)
+	if err != nil {
+		return err
+	}
+
+	role := &models.Role{TeamID: c.Get("teamID").(string)}
+	req.apply(role)
+	if err := models.SaveRole(role, h.db); err != nil {
+		return roleError(err, "failed to create role")
+	}
+	models.RecordAuditChange(c.Request().Context(), models.AuditActionCreate, "roles", role.ID, nil, role)
+
+	return c.JSON(http.StatusCreated, role)
+}
+
+// UpdateRole changes a role; its members have the new permissions from their next request
+// @Summary Update role
+// @Tags roles
+// @Accept json
+// @Produce json
+// @Param id path string true "Role ID"
+// @Param request body RoleRequest true "Role"
+// @Success 200 {object} models.Role
+// @Failure 400 {object} map[string]string "Invalid role"
+// @Failure 404 {object} map[string]string "Role not found"
+// @Failure 409 {object} map[string]string "Role name taken"
+// @Router /api/v1/roles/{id} [put]
+func (h *RoleHandler) UpdateRole(c echo.Context) error {
+	req, err := bindRole(c)
+	if err != nil {
+		return err
+	}
+
+	role, err := h.getRole(c, c.Param("id"))
+	if err != nil {
+		return err
+	}
+
+	before := *role
+	req.apply(role)
+	if err := models.SaveRole(role, h.db); err != nil {
+		return roleError(err, "failed to update role")
+	}
+	models.RecordAuditChange(c.Request().Context(), models.AuditActionUpdate, "roles", role.ID, &before, role)
+
+	return c.JSON(http.StatusOK, role)
+}
+
+// DeleteRole removes a role
+// @Summary Delete role
+// @Description Remove a role. Its members go back to the permissions of their built-in role.
+// @Tags roles
+// @Param id path string true "Role ID"
+// @Success 204
+// @Failure 404 {object} map[string]string "Role not found"
+// @Router /api/v1/roles/{id} [delete]
+func (h *RoleHandler) DeleteRole(c echo.Context) error {
+	role, err := h.getRole(c, c.Param("id"))
+	if err != nil {
+		return err
+	}
+
+	if err := models.DeleteRole(role, h.db); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to delete role")
+	}
+	models.RecordAuditChange(c.Request().Context(), models.AuditActionDelete, "roles", role.ID, nil, nil)
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// AssignRole gives a member of the team a role, replacing the permissions of their built-in role
+// @Summary Assign role
+// @Tags roles
+// @Param id path string true "Role ID"
+// @Param userId path string true "User ID"
+// @Success 204
+// @Failure 400 {object} map[string]string "Admins already have every permission"
+// @Failure 404 {object} map[string]string "Role or user not found"
+// @Router /api/v1/roles/{id}/users/{userId} [put]
+func (h *RoleHandler) AssignRole(c echo.Context) error {
+	role, err := h.getRole(c, c.Param("id"))
+	if err != nil {
+		return err
+	}
+	user, err := h.getMember(c)
+	if err != nil {
+		return err
+	}
+	if user.Role == models.UserRoleAdmin || user.Role == models.UserRoleSuperAdmin {
+		return echo.NewHTTPError(http.StatusBadRequest, "admins already have every permission")
+	}
+
+	if err := h.db.Model(user).UpdateColumn("role_id", role.ID).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to assign role")
+	}
+	models.RecordAuditChange(c.Request().Context(), models.AuditActionUpdate, "users", user.ID,
+		map[string]interface{}{"roleId": user.RoleID}, map[string]interface{}{"roleId": role.ID})
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// UnassignRole takes a role from a member, who goes back to the permissions of their built-in role
+// @Summary Unassign role
+// @Tags roles
+// @Param id path string true "Role ID"
+// @Param userId path string true "User ID"
+// @Success 204
+// @Failure 404 {object} map[string]string "Role or user not found"
+// @Router /api/v1/roles/{id}/users/{userId} [delete]
+func (h *RoleHandler) UnassignRole(c echo.Context) error {
+	role, err := h.getRole(c, c.Param("id"))
+	if err != nil {
+		return err
+	}
+	user, err := h.getMember(c)
+	if err != nil {
+		return err
+	}
+	if user.RoleID != role.ID {
+		return echo.NewHTTPError(http.StatusNotFound, "the user doesn't have this role")
+	}
+
+	if err := h.db.Model(user).UpdateColumn("role_id", nil).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to unassign role")
+	}
+	models.RecordAuditChange(c.Request().Context(), models.AuditActionUpdate, "users", user.ID,
+		map[string]interface{}{"roleId": role.ID}, map[string]interface{}{"roleId": nil})
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (h *RoleHandler) getRole(c echo.Context, id string) (*models.Role, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, echo.NewHTTPError(http.StatusNotFound, models.ErrRoleNotFound.Error())
+	}
+	role, err := models.GetRole(c.Get("teamID").(string), id, h.db)
+	if err != nil {
+		if errors.Is(err, models.ErrRoleNotFound) {
+			return nil, echo.NewHTTPError(http.StatusNotFound, err.Error())
+		}
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, "failed to get role")
+	}
+	return role, nil
+}
+
+// getMember returns the user of the path when they're in the caller's team
+func (h *RoleHandler) getMember(c echo.Context) (*models.User, error) {
+	if _, err := uuid.Parse(c.Param("userId")); err != nil {
+		return nil, echo.NewHTTPError(http.StatusNotFound, "user not found")
+	}
+	user := &models.User{}
+	if err := h.db.Where("id = ? AND team_id = ? AND is_deleted = false", c.Param("userId"), c.Get("teamID").(string)).
+		First(user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, echo.NewHTTPError(http.StatusNotFound, "user not found")
+		}
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, "failed to get user")
+	}
+	return user, nil
+}
+
+func bindRole(c echo.Context) (*RoleRequest, error) {
+	var req RoleRequest
+	if err := c.Bind(&req); err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "invalid request body")
+	}
+	if err := c.Validate(&req); err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	permissions, err := models.NormalizeRolePermissions(req.Permissions)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	req.Permissions = permissions
+	return &req, nil
+}
+
+func (req *RoleRequest) apply(role *models.Role) {
+	role.Name = strings.TrimSpace(req.Name)
+	role.Description = strings.TrimSpace(req.Description)
+	role.Permissions = req.Permissions
+}
+
+func roleError(err error, message string) error {
+	if errors.Is(err, models.ErrRoleNameTaken) {
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	}
+	return echo.NewHTTPError(http.StatusInternalServerError, message)
+}
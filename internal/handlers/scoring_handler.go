@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"kori/internal/models"
+	"kori/internal/utils"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// scoringTestContacts is how many contacts are sent when testing a scoring endpoint
+const scoringTestContacts = 5
+
+type ScoringHandler struct {
+	db *gorm.DB
+}
+
+// ScoringTestResponse is what a scoring endpoint returned for a sample of contacts
+type ScoringTestResponse struct {
+	Contacts []models.ContactFeatures `json:"contacts"`
+	Scores   []models.ContactScore    `json:"scores"`
+	Duration string                   `json:"duration"`
+	Error    string                   `json:"error,omitempty"`
+}
+
+func NewScoringHandler(db *gorm.DB) *ScoringHandler {
+	return &ScoringHandler{db: db}
+}
+
+// TestScoringEndpoint sends a few of the team's contacts to a scoring endpoint and returns its answer
+// @Summary Test scoring endpoint
+// @Description Post a sample of contacts to the scoring endpoint and show the scores it returns
+// @Tags scoring-endpoints
+// @Produce json
+// @Param id path string true "Scoring endpoint ID"
+// @Success 200 {object} ScoringTestResponse
+// @Failure 404 {object} map[string]string "Scoring endpoint not found"
+// @Router /api/v1/scoring-endpoints/{id}/test [post]
+func (h *ScoringHandler) TestScoringEndpoint(c echo.Context) error {
+	teamID := c.Get("teamID").(string)
+
+	endpoint := &models.ScoringEndpoint{}
+	if err := h.db.Where("id = ? AND team_id = ? AND is_deleted = false", c.Param("id"), teamID).First(endpoint).Error; err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "scoring endpoint not found")
+	}
+
+	var contacts []models.Contact
+	if err := h.db.Where("team_id = ? AND status = ? AND is_deleted = false", teamID, models.SubscriberStatusActive).
+		Order("created_at DESC").Limit(scoringTestContacts).Find(&contacts).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get contacts")
+	}
+
+	features, err := models.GetContactFeatures(contacts, h.db)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to build contact features")
+	}
+
+	response := ScoringTestResponse{Contacts: features, Scores: []models.ContactScore{}}
+
+	start := time.Now()
+	scores, err := utils.ScoreContacts(c.Request().Context(), endpoint, nil, features)
+	response.Duration = time.Since(start).String()
+	if err != nil {
+		response.Error = err.Error()
+		return c.JSON(http.StatusOK, response)
+	}
+	for _, feature := range features {
+		if score, ok := scores[feature.ID]; ok {
+			response.Scores = append(response.Scores, score)
+		}
+	}
+
+	return c.JSON(http.StatusOK, response)
+}
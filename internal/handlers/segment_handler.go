@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"kori/internal/models"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// segmentPreviewSize is the number of sample contacts returned by a segment preview
+const segmentPreviewSize = 20
+
+type SegmentHandler struct {
+	db *gorm.DB
+}
+
+// SegmentPreviewResponse is the size of a segment plus a sample of matching contacts
+type SegmentPreviewResponse struct {
+	Count    int64            `json:"count"`
+	Contacts []models.Contact `json:"contacts"`
+}
+
+func NewSegmentHandler(db *gorm.DB) *SegmentHandler {
+	return &SegmentHandler{db: db}
+}
+
+// PreviewSegment evaluates a segment against the current contacts
+// @Summary Preview segment
+// @Description Evaluate a segment and return the number of matching contacts with a sample
+// @Tags segments
+// @Produce json
+// @Param id path string true "Segment ID"
+// @Success 200 {object} SegmentPreviewResponse
+// @Failure 400 {object} map[string]string "Invalid segment conditions"
+// @Failure 404 {object} map[string]string "Segment not found"
+// @Router /api/v1/segments/{id}/preview [get]
+func (h *SegmentHandler) PreviewSegment(c echo.Context) error {
+	teamID := c.Get("teamID").(string)
+
+	segment := &models.Segment{}
+	if err := h.db.Where("id = ? AND team_id = ? AND is_deleted = false", c.Param("id"), teamID).First(segment).Error; err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "segment not found")
+	}
+
+	query, err := segment.Apply(h.db.Model(&models.Contact{}).Where("contacts.is_deleted = false"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	var count int64
+	if err := query.Session(&gorm.Session{}).Count(&count).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to evaluate segment")
+	}
+
+	contacts := []models.Contact{}
+	if err := query.Order("contacts.created_at DESC").Limit(segmentPreviewSize).Find(&contacts).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to evaluate segment")
+	}
+
+	return c.JSON(http.StatusOK, SegmentPreviewResponse{Count: count, Contacts: contacts})
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"kori/internal/models"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// maxPersonaAnalyticsDays is how far back sender persona analytics look at most
+const maxPersonaAnalyticsDays = 365
+
+// SenderPersonaHandler reports on the personas a team sends as
+type SenderPersonaHandler struct {
+	db *gorm.DB
+}
+
+func NewSenderPersonaHandler(db *gorm.DB) *SenderPersonaHandler {
+	return &SenderPersonaHandler{db: db}
+}
+
+// GetSenderPersonaAnalytics compares how the team's sender personas do
+// @Summary Get sender persona analytics
+// @Description Emails sent, opened, clicked, replied to, bounced, complained about and unsubscribed from per sender persona, counting each email once per event, with rates as percentages of the emails sent. Automated engagement and CC or BCC recipients aren't counted.
+// @Tags sender-personas
+// @Produce json
+// @Param days query int false "Days to cover, 30 by default and at most 365"
+// @Success 200 {array} models.SenderPersonaStats
+// @Failure 400 {object} map[string]string "Invalid days"
+// @Router /api/v1/sender-personas/analytics [get]
+func (h *SenderPersonaHandler) GetSenderPersonaAnalytics(c echo.Context) error {
+	teamID := c.Get("teamID").(string)
+
+	days := 30
+	if param := c.QueryParam("days"); param != "" {
+		var err error
+		days, err = strconv.Atoi(param)
+		if err != nil || days < 1 || days > maxPersonaAnalyticsDays {
+			return echo.NewHTTPError(http.StatusBadRequest, "days must be between 1 and 365")
+		}
+	}
+
+	stats, err := models.GetSenderPersonaStats(teamID, time.Now().AddDate(0, 0, -days), h.db.WithContext(c.Request().Context()))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get sender persona analytics")
+	}
+
+	return c.JSON(http.StatusOK, stats)
+}
@@ -0,0 +1,272 @@
+package handlers
+
+import (
+	"errors"
+	"kori/internal/models"
+	"kori/internal/utils"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// maxSignatureSize caps a signature's html, which is added to every email it signs
+const maxSignatureSize = 16 << 10
+
+// SignatureHandler manages the signatures of a team and of its members
+type SignatureHandler struct {
+	db *gorm.DB
+}
+
+func NewSignatureHandler(db *gorm.DB) *SignatureHandler {
+	return &SignatureHandler{db: db}
+}
+
+// SignatureRequest is a signature to save. Its html can use {{name}}, {{firstName}},
+// {{lastName}}, {{email}}, {{title}}, {{team}}, {{brandName}} and {{logoUrl}}.
+type SignatureRequest struct {
+	Name      string `json:"name" validate:"required,max=255"`
+	Title     string `json:"title" validate:"max=255"`
+	HTML      string `json:"html" validate:"required"`
+	IsDefault bool   `json:"isDefault"`
+	Team      bool   `json:"team"` // a signature of the team rather than of the caller; admins only
+}
+
+// SignaturePreview is a signature rendered for its signer
+type SignaturePreview struct {
+	HTML string `json:"html"`
+	Text string `json:"text"`
+}
+
+// ListSignatures lists the team's signatures and the caller's own
+// @Summary List signatures
+// @Tags signatures
+// @Produce json
+// @Param scope query string false "Only the team's or only the caller's signatures" Enums(team, mine)
+// @Success 200 {array} models.Signature
+// @Failure 400 {object} map[string]string "Invalid scope"
+// @Router /api/v1/signatures [get]
+func (h *SignatureHandler) ListSignatures(c echo.Context) error {
+	teamID := c.Get("teamID").(string)
+	userID, _ := c.Get("userID").(string)
+
+	query := h.db.Where("team_id = ? AND is_deleted = false", teamID)
+	switch c.QueryParam("scope") {
+	case "":
+		if userID == "" {
+			query = query.Where("user_id IS NULL")
+		} else {
+			query = query.Where("user_id IS NULL OR user_id = ?", userID)
+		}
+	case "team":
+		query = query.Where("user_id IS NULL")
+	case "mine":
+		if userID == "" {
+			return c.JSON(http.StatusOK, []models.Signature{})
+		}
+		query = query.Where("user_id = ?", userID)
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, "scope must be team or mine")
+	}
+
+	signatures := []models.Signature{}
+	if err := query.Order("user_id IS NULL, name").Find(&signatures).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get signatures")
+	}
+
+	return c.JSON(http.StatusOK, signatures)
+}
+
+// GetSignature returns one of the team's signatures or of the caller's
+// @Summary Get signature
+// @Tags signatures
+// @Produce json
+// @Param id path string true "Signature ID"
+// @Success 200 {object} models.Signature
+// @Failure 404 {object} map[string]string "Signature not found"
+// @Router /api/v1/signatures/{id} [get]
+func (h *SignatureHandler) GetSignature(c echo.Context) error {
+	signature, err := h.getSignature(c)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, signature)
+}
+
+// CreateSignature adds a signature for the caller or, for admins, for the team
+// @Summary Create signature
+// @Description Add a signature. Its html is sanitized, keeping formatting, links and images but not scripts, style sheets or forms. The default signature of a member signs the inbox follow-ups of conversations assigned to them, and the team's default the others.
+// @Tags signatures
+// @Accept json
+// @Produce json
+// @Param request body SignatureRequest true "Signature"
+// @Success 201 {object} models.Signature
+// @Failure 400 {object} map[string]string "Invalid signature"
+// @Failure 403 {object} map[string]string "Only admins manage the team's signatures"
+// @Router /api/v1/signatures [post]
+func (h *SignatureHandler) CreateSignature(c echo.Context) error {
+	req, err := bindSignature(c)
+	if err != nil {
+		return err
+	}
+
+	signature := &models.Signature{TeamID: c.Get("teamID").(string)}
+	if !req.Team {
+		signature.UserID, _ = c.Get("userID").(string)
+		if signature.UserID == "" {
+			return echo.NewHTTPError(http.StatusBadRequest, "API keys can only create team signatures")
+		}
+	}
+	if signature.UserID == "" && !canManageTeamSignatures(c) {
+		return echo.NewHTTPError(http.StatusForbidden, "only admins can manage the team's signatures")
+	}
+
+	req.apply(signature)
+	if err := models.SaveSignature(signature, h.db); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to create signature")
+	}
+	models.RecordAuditChange(c.Request().Context(), models.AuditActionCreate, "signatures", signature.ID, nil, signature)
+
+	return c.JSON(http.StatusCreated, signature)
+}
+
+// UpdateSignature changes a signature
+// @Summary Update signature
+// @Description Change a signature's name, title, html or whether it's the default. Whose signature it is doesn't change.
+// @Tags signatures
+// @Accept json
+// @Produce json
+// @Param id path string true "Signature ID"
+// @Param request body SignatureRequest true "Signature"
+// @Success 200 {object} models.Signature
+// @Failure 400 {object} map[string]string "Invalid signature"
+// @Failure 403 {object} map[string]string "Only admins manage the team's signatures"
+// @Failure 404 {object} map[string]string "Signature not found"
+// @Router /api/v1/signatures/{id} [put]
+func (h *SignatureHandler) UpdateSignature(c echo.Context) error {
+	req, err := bindSignature(c)
+	if err != nil {
+		return err
+	}
+
+	signature, err := h.getSignature(c)
+	if err != nil {
+		return err
+	}
+	if signature.UserID == "" && !canManageTeamSignatures(c) {
+		return echo.NewHTTPError(http.StatusForbidden, "only admins can manage the team's signatures")
+	}
+
+	before := *signature
+	req.apply(signature)
+	if err := models.SaveSignature(signature, h.db); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to update signature")
+	}
+	models.RecordAuditChange(c.Request().Context(), models.AuditActionUpdate, "signatures", signature.ID, &before, signature)
+
+	return c.JSON(http.StatusOK, signature)
+}
+
+// DeleteSignature removes a signature
+// @Summary Delete signature
+// @Tags signatures
+// @Param id path string true "Signature ID"
+// @Success 204
+// @Failure 403 {object} map[string]string "Only admins manage the team's signatures"
+// @Failure 404 {object} map[string]string "Signature not found"
+// @Router /api/v1/signatures/{id} [delete]
+func (h *SignatureHandler) DeleteSignature(c echo.Context) error {
+	signature, err := h.getSignature(c)
+	if err != nil {
+		return err
+	}
+	if signature.UserID == "" && !canManageTeamSignatures(c) {
+		return echo.NewHTTPError(http.StatusForbidden, "only admins can manage the team's signatures")
+	}
+
+	if err := h.db.Model(signature).
+		UpdateColumns(map[string]interface{}{"is_deleted": true, "deleted_at": time.Now(), "is_default": false}).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to delete signature")
+	}
+	models.RecordAuditChange(c.Request().Context(), models.AuditActionDelete, "signatures", signature.ID, nil, nil)
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// PreviewSignature renders a signature the way it's appended to emails
+// @Summary Preview signature
+// @Description Render a signature with its signer's name, email and title and the team's branding, as html and as the text added to plain text emails
+// @Tags signatures
+// @Produce json
+// @Param id path string true "Signature ID"
+// @Success 200 {object} SignaturePreview
+// @Failure 404 {object} map[string]string "Signature not found"
+// @Router /api/v1/signatures/{id}/preview [get]
+func (h *SignatureHandler) PreviewSignature(c echo.Context) error {
+	signature, err := h.getSignature(c)
+	if err != nil {
+		return err
+	}
+
+	userID, _ := c.Get("userID").(string)
+	variables, err := models.GetSignatureVariables(signature, userID, h.db)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get signature variables")
+	}
+	rendered := utils.RenderSignature(signature.HTML, variables)
+
+	return c.JSON(http.StatusOK, SignaturePreview{HTML: rendered, Text: utils.HTMLToText(rendered)})
+}
+
+func (h *SignatureHandler) getSignature(c echo.Context) (*models.Signature, error) {
+	if _, err := uuid.Parse(c.Param("id")); err != nil {
+		return nil, echo.NewHTTPError(http.StatusNotFound, models.ErrSignatureNotFound.Error())
+	}
+	userID, _ := c.Get("userID").(string)
+	signature, err := models.GetSignature(c.Get("teamID").(string), userID, c.Param("id"), h.db)
+	if err != nil {
+		if errors.Is(err, models.ErrSignatureNotFound) {
+			return nil, echo.NewHTTPError(http.StatusNotFound, err.Error())
+		}
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, "failed to get signature")
+	}
+	return signature, nil
+}
+
+func bindSignature(c echo.Context) (*SignatureRequest, error) {
+	var req SignatureRequest
+	if err := c.Bind(&req); err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "invalid request body")
+	}
+	if err := c.Validate(&req); err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	req.HTML = utils.SanitizeHTML(req.HTML)
+	if strings.TrimSpace(utils.HTMLToText(req.HTML)) == "" && !strings.Contains(req.HTML, "<img") {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "signature is empty once sanitized")
+	}
+	if len(req.HTML) > maxSignatureSize {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "signature html must be at most 16KB")
+	}
+	return &req, nil
+}
+
+func (req *SignatureRequest) apply(signature *models.Signature) {
+	signature.Name = strings.TrimSpace(req.Name)
+	signature.Title = strings.TrimSpace(req.Title)
+	signature.HTML = req.HTML
+	signature.IsDefault = req.IsDefault
+}
+
+// canManageTeamSignatures reports whether the caller can change the team's signatures: admins,
+// and API keys, whose permissions were checked already
+func canManageTeamSignatures(c echo.Context) bool {
+	if isAPIKey, _ := c.Get("isAPIKey").(bool); isAPIKey {
+		return true
+	}
+	role, _ := c.Get("role").(string)
+	return role == string(models.UserRoleAdmin) || role == string(models.UserRoleSuperAdmin)
+}
@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"kori/internal/events"
+	"kori/internal/models"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// SMTPSendingHandler lets platform operators pause sending through SMTP configs, e.g. while a
+// provider has an incident
+type SMTPSendingHandler struct {
+	db *gorm.DB
+}
+
+func NewSMTPSendingHandler(db *gorm.DB) *SMTPSendingHandler {
+	return &SMTPSendingHandler{db: db}
+}
+
+// SMTPSendingRequest selects the SMTP configs to pause or resume: one config, or every config
+// of a provider, optionally narrowed to a host
+type SMTPSendingRequest struct {
+	SMTPConfigID string `json:"smtpConfigId" validate:"omitempty,uuid"`
+	Provider     string `json:"provider" validate:"omitempty,oneof=CUSTOM GMAIL OUTLOOK AMAZON SENDGRID MAILGUN POSTMARK"`
+	Host         string `json:"host" validate:"omitempty,hostname"`
+	Reason       string `json:"reason" validate:"omitempty,max=500"`
+}
+
+// PausedSMTPConfig is an SMTP config whose sending is paused, with the emails waiting on it
+type PausedSMTPConfig struct {
+	ID           string     `json:"id"`
+	TeamID       string     `json:"teamId"`
+	Provider     string     `json:"provider"`
+	Host         string     `json:"host"`
+	PausedAt     *time.Time `json:"pausedAt,omitempty"`
+	Reason       string     `json:"reason,omitempty"`
+	ParkedEmails int64      `json:"parkedEmails"`
+}
+
+// ListPausedSMTPConfigs lists the SMTP configs whose sending is paused
+// @Summary List paused SMTP configs
+// @Description SMTP configs whose sending an operator paused, with how many emails are parked on each. Super admins only.
+// @Tags admin
+// @Produce json
+// @Success 200 {array} PausedSMTPConfig
+// @Failure 403 {object} map[string]string "Not a super admin"
+// @Router /api/v1/admin/smtp-sending [get]
+func (h *SMTPSendingHandler) ListPausedSMTPConfigs(c echo.Context) error {
+	var configs []models.SMTPConfig
+	if err := h.db.Where("sending_paused = true AND is_deleted = false").Order("sending_paused_at ASC").Find(&configs).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to list smtp configs")
+	}
+
+	paused, err := h.pausedConfigs(configs)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to count parked emails")
+	}
+	return c.JSON(http.StatusOK, paused)
+}
+
+// PauseSMTPSending stops sending through SMTP configs
+// @Summary Pause SMTP sending
+// @Description Stop sending through one SMTP config or every config of a provider. Emails queued for those configs are parked instead of attempted, and are sent once sending is resumed. Super admins only.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param request body SMTPSendingRequest true "Configs to pause"
+// @Success 200 {array} PausedSMTPConfig
+// @Failure 400 {object} map[string]string "No config or provider given"
+// @Failure 403 {object} map[string]string "Not a super admin"
+// @Router /api/v1/admin/smtp-sending/pause [post]
+func (h *SMTPSendingHandler) PauseSMTPSending(c echo.Context) error {
+	req, err := h.bindRequest(c)
+	if err != nil {
+		return err
+	}
+
+	configs, err := models.SetSMTPSendingPaused(req.scope(), true, req.Reason, h.db)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to pause sending")
+	}
+	for _, config := range configs {
+		events.Emit("smtp_config.sending_paused", map[string]interface{}{
+			"smtpConfigId": config.ID,
+			"teamId":       config.TeamID,
+			"host":         config.Host,
+			"reason":       req.Reason,
+		})
+	}
+
+	// Report every paused config of the scope, including those paused before
+	if configs, err = models.GetSMTPConfigsInScope(req.scope(), h.db); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to list smtp configs")
+	}
+	paused, err := h.pausedConfigs(configs)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to count parked emails")
+	}
+	return c.JSON(http.StatusOK, paused)
+}
+
+// ResumeSMTPSending lets sending through paused SMTP configs go on
+// @Summary Resume SMTP sending
+// @Description Resume sending through SMTP configs that were paused. Their parked emails are re-enqueued by the next retry sweep. Super admins only.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param request body SMTPSendingRequest true "Configs to resume"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string "No config or provider given"
+// @Failure 403 {object} map[string]string "Not a super admin"
+// @Router /api/v1/admin/smtp-sending/resume [post]
+func (h *SMTPSendingHandler) ResumeSMTPSending(c echo.Context) error {
+	req, err := h.bindRequest(c)
+	if err != nil {
+		return err
+	}
+
+	configs, err := models.SetSMTPSendingPaused(req.scope(), false, "", h.db)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to resume sending")
+	}
+
+	ids := make([]string, len(configs))
+	for i, config := range configs {
+		ids[i] = config.ID
+		events.Emit("smtp_config.sending_resumed", map[string]interface{}{
+			"smtpConfigId": config.ID,
+			"teamId":       config.TeamID,
+			"host":         config.Host,
+		})
+	}
+
+	var parked int64
+	if len(ids) > 0 {
+		counts, err := models.CountParkedEmails(ids, h.db)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to count parked emails")
+		}
+		for _, count := range counts {
+			parked += count
+		}
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"smtpConfigIds": ids,
+		"parkedEmails":  parked, // re-enqueued over the next retry sweeps
+	})
+}
+
+// bindRequest reads a pause or resume request, which has to select at least a config or provider
+func (h *SMTPSendingHandler) bindRequest(c echo.Context) (*SMTPSendingRequest, error) {
+	req := new(SMTPSendingRequest)
+	if err := c.Bind(req); err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "invalid request body")
+	}
+	if err := c.Validate(req); err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if req.SMTPConfigID == "" && req.Provider == "" {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "smtpConfigId or provider is required")
+	}
+	return req, nil
+}
+
+func (r *SMTPSendingRequest) scope() models.SMTPSendingScope {
+	return models.SMTPSendingScope{SMTPConfigID: r.SMTPConfigID, Provider: r.Provider, Host: r.Host}
+}
+
+// pausedConfigs adds the parked email counts to SMTP configs
+func (h *SMTPSendingHandler) pausedConfigs(configs []models.SMTPConfig) ([]PausedSMTPConfig, error) {
+	paused := make([]PausedSMTPConfig, 0, len(configs))
+	if len(configs) == 0 {
+		return paused, nil
+	}
+
+	ids := make([]string, len(configs))
+	for i := range configs {
+		ids[i] = configs[i].ID
+	}
+	counts, err := models.CountParkedEmails(ids, h.db)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, config := range configs {
+		entry := PausedSMTPConfig{
+			ID:           config.ID,
+			TeamID:       config.TeamID,
+			Provider:     config.Provider,
+			Host:         config.Host,
+			PausedAt:     config.SendingPausedAt,
+			Reason:       config.SendingPauseReason,
+			ParkedEmails: counts[config.ID],
+		}
+		paused = append(paused, entry)
+	}
+	return paused, nil
+}
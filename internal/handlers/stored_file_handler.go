@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"kori/internal/config"
+	"kori/internal/utils"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ServeStoredFile serves a file kept on the filesystem through its signed link, as a download
+// @Summary Download a stored file
+// @Description Serve a file kept on the server's filesystem, when it stores files without S3. Links are signed and expire; they are the signedUrl of the file.
+// @Tags Files
+// @Produce octet-stream
+// @Param name path string true "File name"
+// @Param expires query int true "Unix time the link expires at"
+// @Param sig query string true "Link signature"
+// @Success 200 {file} binary
+// @Failure 403 {object} map[string]string "Invalid or expired link"
+// @Failure 404 {object} map[string]string "File not found"
+// @Router /files/{name} [get]
+func ServeStoredFile(c echo.Context) error {
+	cfg := config.GetConfig()
+	if !cfg.Storage.UsesFilesystem() {
+		return echo.NewHTTPError(http.StatusNotFound, "file not found")
+	}
+
+	name := c.Param("name")
+	if name == "" || strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+		return echo.NewHTTPError(http.StatusNotFound, "file not found")
+	}
+	expires, err := strconv.ParseInt(c.QueryParam("expires"), 10, 64)
+	if err != nil || time.Now().Unix() > expires ||
+		!hmac.Equal([]byte(c.QueryParam("sig")), []byte(utils.FileSignature(name, expires, cfg))) {
+		return echo.NewHTTPError(http.StatusForbidden, "invalid or expired link")
+	}
+
+	// Uploads are whatever teams sent, so they're downloaded rather than rendered on our origin
+	c.Response().Header().Set("X-Content-Type-Options", "nosniff")
+	return c.Attachment(filepath.Join(cfg.Storage.BasePath, name), name)
+}
@@ -0,0 +1,369 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"kori/internal/config"
+	"kori/internal/models"
+	"kori/internal/utils"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+type SubscribeFormHandler struct {
+	db *gorm.DB
+}
+
+func NewSubscribeFormHandler(db *gorm.DB) *SubscribeFormHandler {
+	return &SubscribeFormHandler{db: db}
+}
+
+// publicSubscribeForm is what the embed script is given to render a form, leaving out
+// everything only the team should see
+type publicSubscribeForm struct {
+	ID             string                      `json:"id"`
+	Title          string                      `json:"title,omitempty"`
+	Description    string                      `json:"description,omitempty"`
+	ButtonText     string                      `json:"buttonText"`
+	Fields         []models.SubscribeFormField `json:"fields"`
+	SubmitURL      string                      `json:"submitUrl"`
+	Honeypot       string                      `json:"honeypot"`
+	Captcha        *publicFormCaptcha          `json:"captcha,omitempty"`
+	SuccessMessage string                      `json:"successMessage"`
+}
+
+type publicFormCaptcha struct {
+	SiteKey     string `json:"siteKey"`
+	ScriptURL   string `json:"scriptUrl"`
+	WidgetClass string `json:"widgetClass"`
+}
+
+// subscribeFormPage hosts a form on a page of its own, rendered by the embed script
+var subscribeFormPage = template.Must(template.New("subscribe-form").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1"><title>{{if .Title}}{{.Title}}{{else}}{{.Name}}{{end}}</title></head>
+<body>
+<script src="/api/v1/forms/{{.ID}}/embed.js"></script>
+</body></html>
+`))
+
+// subscribedPage is shown after submitting a form without the embed script, when the form
+// doesn't redirect anywhere
+var subscribedPage = template.Must(template.New("subscribed").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Subscribed</title></head>
+<body><p>{{.}}</p></body></html>
+`))
+
+// subscribeFormScript renders the form given as JSON where the script tag is, or in the element
+// the tag's data-target selects, and submits it without leaving the page
+const subscribeFormScript = `(function () {
+  var form = %s;
+  var script = document.currentScript;
+  var selector = script && script.getAttribute("data-target");
+  var target = selector ? document.querySelector(selector) : null;
+  var failed = "Something went wrong, please try again.";
+
+  var el = document.createElement("form");
+  el.className = "posthoot-form";
+  el.action = form.submitUrl;
+  el.method = "POST";
+
+  if (form.title) {
+    var title = document.createElement("h2");
+    title.textContent = form.title;
+    el.appendChild(title);
+  }
+  if (form.description) {
+    var description = document.createElement("p");
+    description.textContent = form.description;
+    el.appendChild(description);
+  }
+
+  form.fields.forEach(function (field) {
+    var input;
+    if (field.type === "textarea") {
+      input = document.createElement("textarea");
+    } else {
+      input = document.createElement("input");
+      input.type = field.type || "text";
+    }
+    input.name = field.name;
+    if (field.type === "hidden") {
+      input.value = field.value || "";
+      el.appendChild(input);
+      return;
+    }
+    if (field.type === "checkbox") input.value = "yes";
+    if (field.placeholder) input.placeholder = field.placeholder;
+    if (field.required) input.required = true;
+
+    var label = document.createElement("label");
+    var text = document.createElement("span");
+    text.textContent = field.label || field.name;
+    label.appendChild(text);
+    label.appendChild(input);
+    el.appendChild(label);
+  });
+
+  var trap = document.createElement("input");
+  trap.name = form.honeypot;
+  trap.tabIndex = -1;
+  trap.autocomplete = "off";
+  trap.setAttribute("aria-hidden", "true");
+  trap.style.cssText = "position:absolute;left:-10000px;width:1px;height:1px;overflow:hidden";
+  el.appendChild(trap);
+
+  if (form.captcha) {
+    var widget = document.createElement("div");
+    widget.className = form.captcha.widgetClass;
+    widget.setAttribute("data-sitekey", form.captcha.siteKey);
+    el.appendChild(widget);
+    if (!document.querySelector('script[src="' + form.captcha.scriptUrl + '"]')) {
+      var captcha = document.createElement("script");
+      captcha.src = form.captcha.scriptUrl;
+      captcha.async = true;
+      captcha.defer = true;
+      document.head.appendChild(captcha);
+    }
+  }
+
+  var button = document.createElement("button");
+  button.type = "submit";
+  button.textContent = form.buttonText;
+  el.appendChild(button);
+
+  var message = document.createElement("p");
+  message.className = "posthoot-form-message";
+  message.setAttribute("role", "status");
+  el.appendChild(message);
+
+  el.addEventListener("submit", function (event) {
+    event.preventDefault();
+    button.disabled = true;
+    var values = {};
+    new FormData(el).forEach(function (value, key) { values[key] = value; });
+    fetch(form.submitUrl, {
+      method: "POST",
+      headers: { "Content-Type": "application/json", "Accept": "application/json" },
+      body: JSON.stringify(values)
+    }).then(function (response) {
+      return response.json().then(function (body) { return { ok: response.ok, body: body }; });
+    }).then(function (result) {
+      if (result.ok && result.body.redirectUrl) {
+        window.location.href = result.body.redirectUrl;
+        return;
+      }
+      if (result.ok) {
+        message.textContent = result.body.message || form.successMessage;
+        el.reset();
+        return;
+      }
+      var error = result.body.error;
+      message.textContent = typeof error === "string" ? error : (error && error.message) || failed;
+    }).catch(function () {
+      message.textContent = failed;
+    }).then(function () {
+      button.disabled = false;
+    });
+  });
+
+  if (target) {
+    target.appendChild(el);
+  } else if (script) {
+    script.parentNode.insertBefore(el, script.nextSibling);
+  }
+})();
+`
+
+// getActiveForm returns the form in the path, answering 404 for forms that don't take submissions
+func (h *SubscribeFormHandler) getActiveForm(c echo.Context) (*models.SubscribeForm, error) {
+	form, err := models.GetActiveSubscribeForm(c.Param("id"), h.db)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, echo.NewHTTPError(http.StatusNotFound, "form not found")
+		}
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, "failed to get form")
+	}
+	return form, nil
+}
+
+// GetFormPage hosts a form on a page of its own
+// @Summary Hosted subscribe form
+// @Description A page with nothing but the form, for linking to without a website
+// @Tags subscribe-forms
+// @Produce html
+// @Param id path string true "Subscribe form ID"
+// @Success 200 {string} string "Form page"
+// @Failure 404 {object} map[string]string "Form not found or inactive"
+// @Router /forms/{id} [get]
+func (h *SubscribeFormHandler) GetFormPage(c echo.Context) error {
+	form, err := h.getActiveForm(c)
+	if err != nil {
+		return err
+	}
+
+	var page strings.Builder
+	if err := subscribeFormPage.Execute(&page, form); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to render form")
+	}
+	return c.HTML(http.StatusOK, page.String())
+}
+
+// GetEmbedScript returns the script rendering a form in any page
+// @Summary Subscribe form embed script
+// @Description Script that renders the form where its tag is, or in the element its data-target attribute selects, e.g. <script src="/api/v1/forms/{id}/embed.js" data-target="#signup"></script>
+// @Tags subscribe-forms
+// @Produce application/javascript
+// @Param id path string true "Subscribe form ID"
+// @Success 200 {string} string "Embed script"
+// @Failure 404 {object} map[string]string "Form not found or inactive"
+// @Router /api/v1/forms/{id}/embed.js [get]
+func (h *SubscribeFormHandler) GetEmbedScript(c echo.Context) error {
+	form, err := h.getActiveForm(c)
+	if err != nil {
+		return err
+	}
+
+	fields, err := form.FormFields()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to read form fields")
+	}
+
+	public := publicSubscribeForm{
+		ID:             form.ID,
+		Title:          form.Title,
+		Description:    form.Description,
+		ButtonText:     form.ButtonText,
+		Fields:         fields,
+		SubmitURL:      strings.TrimSuffix(config.GetConfig().Server.PublicURL, "/") + "/api/v1/forms/" + form.ID + "/submit",
+		Honeypot:       models.SubscribeFormHoneypot,
+		SuccessMessage: form.SuccessMessage,
+	}
+	if service, ok := utils.CaptchaServices[string(form.CaptchaProvider)]; ok {
+		public.Captcha = &publicFormCaptcha{
+			SiteKey:     form.CaptchaSiteKey,
+			ScriptURL:   service.ScriptURL,
+			WidgetClass: service.WidgetClass,
+		}
+	}
+
+	// Marshalling escapes <, > and &, so the JSON can't close the script it's written into
+	data, err := json.Marshal(public)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to render form")
+	}
+
+	// Edits to the form show up on the pages embedding it within minutes
+	c.Response().Header().Set("Cache-Control", "public, max-age=300")
+	return c.Blob(http.StatusOK, "application/javascript; charset=utf-8", []byte(fmt.Sprintf(subscribeFormScript, data)))
+}
+
+// SubmitForm adds whoever submitted a form to its list
+// @Summary Submit subscribe form
+// @Description Subscribe someone through a form, without authentication. Takes JSON or form encoded inputs by their field names; submissions are rate limited per IP and checked with the form's captcha. Plain HTML form posts are redirected to the form's redirect URL or shown its success message.
+// @Tags subscribe-forms
+// @Accept json,x-www-form-urlencoded
+// @Produce json,html
+// @Param id path string true "Subscribe form ID"
+// @Success 200 {object} map[string]string "Success message and redirect URL"
+// @Failure 404 {object} map[string]string "Form not found or inactive"
+// @Failure 422 {object} models.SubscribeFormError "Missing or invalid fields, or failed captcha"
+// @Failure 429 {object} map[string]string "Too many submissions"
+// @Router /api/v1/forms/{id}/submit [post]
+func (h *SubscribeFormHandler) SubmitForm(c echo.Context) error {
+	form, err := h.getActiveForm(c)
+	if err != nil {
+		return err
+	}
+
+	values, err := submittedValues(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid form submission")
+	}
+
+	// Bots that fill in the hidden input are told they subscribed, so they don't try another way
+	if values[models.SubscribeFormHoneypot] != "" {
+		trackingLog.Info("🍯 Dropped a bot submission of form %s", form.ID)
+		return h.submitted(c, form)
+	}
+
+	if service, ok := utils.CaptchaServices[string(form.CaptchaProvider)]; ok {
+		passed, err := utils.VerifyCaptcha(c.Request().Context(), string(form.CaptchaProvider), form.CaptchaSecret,
+			values[service.ResponseField], c.RealIP())
+		if err != nil {
+			trackingLog.Error("Failed to verify form captcha", err, form.ID)
+			return echo.NewHTTPError(http.StatusBadGateway, "couldn't verify the captcha, please try again")
+		}
+		if !passed {
+			return echo.NewHTTPError(http.StatusUnprocessableEntity, "captcha verification failed")
+		}
+	}
+
+	if _, err := models.SubmitSubscribeForm(form, values, h.db); err != nil {
+		var formErr *models.SubscribeFormError
+		if errors.As(err, &formErr) {
+			return echo.NewHTTPError(formErr.StatusCode(), formErr)
+		}
+		trackingLog.Error("Failed to subscribe through form", err, form.ID)
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to subscribe")
+	}
+
+	return h.submitted(c, form)
+}
+
+// submitted answers a successful submission the way it was made: scripts get JSON, browsers
+// posting the form themselves get the redirect or the success message
+func (h *SubscribeFormHandler) submitted(c echo.Context, form *models.SubscribeForm) error {
+	if strings.Contains(c.Request().Header.Get(echo.HeaderAccept), echo.MIMEApplicationJSON) ||
+		strings.HasPrefix(c.Request().Header.Get(echo.HeaderContentType), echo.MIMEApplicationJSON) {
+		return c.JSON(http.StatusOK, map[string]string{
+			"message":     form.SuccessMessage,
+			"redirectUrl": form.RedirectURL,
+		})
+	}
+
+	if form.RedirectURL != "" {
+		return c.Redirect(http.StatusSeeOther, form.RedirectURL)
+	}
+
+	var page strings.Builder
+	if err := subscribedPage.Execute(&page, form.SuccessMessage); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to render page")
+	}
+	return c.HTML(http.StatusOK, page.String())
+}
+
+// submittedValues reads a submission's inputs by name, from a JSON object or form encoded body
+func submittedValues(c echo.Context) (map[string]string, error) {
+	values := map[string]string{}
+
+	if strings.HasPrefix(c.Request().Header.Get(echo.HeaderContentType), echo.MIMEApplicationJSON) {
+		var body map[string]interface{}
+		if err := json.NewDecoder(c.Request().Body).Decode(&body); err != nil {
+			return nil, err
+		}
+		for name, value := range body {
+			switch v := value.(type) {
+			case nil:
+			case string:
+				values[name] = v
+			default:
+				values[name] = fmt.Sprint(v)
+			}
+		}
+		return values, nil
+	}
+
+	params, err := c.FormParams()
+	if err != nil {
+		return nil, err
+	}
+	for name := range params {
+		values[name] = params.Get(name)
+	}
+	return values, nil
+}
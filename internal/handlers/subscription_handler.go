@@ -291,15 +291,43 @@ func (h *SubscriptionHandler) GetFeatures(c echo.Context) error {
 	})
 }
 
+// GetUsageResponse is a team's plan and how much of each of its quotas the team used this period
+type GetUsageResponse struct {
+	Plan   string              `json:"plan"`
+	Period string              `json:"period"` // e.g. 2024-05
+	Usage  []models.QuotaUsage `json:"usage"`
+}
+
+// GetUsage returns the current team's consumption against its plan
+// @Summary Get plan usage
+// @Description Get how many emails and campaigns the team sent this month, and how many contacts it has, against the limits of its plan. Sends over the email or campaign limit are refused until the next month or an upgrade.
+// @Tags subscriptions
+// @Produce json
+// @Success 200 {object} GetUsageResponse "Usage"
+// @Router /api/v1/usage [get]
+func (h *SubscriptionHandler) GetUsage(c echo.Context) error {
+	teamID := c.Get("teamID").(string)
+
+	plan, _ := models.GetTeamQuotaLimits(teamID, h.db)
+	usage, err := models.GetTeamQuotaUsage(teamID, h.db)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to get usage"})
+	}
+
+	return c.JSON(http.StatusOK, GetUsageResponse{
+		Plan:   plan,
+		Period: models.GetQuotaPeriodKey(time.Now().UTC()),
+		Usage:  usage,
+	})
+}
+
 func getFreeTierFeatures() map[string]interface{} {
-	return map[string]interface{}{
-		string(models.FeatureEmailCampaigns): map[string]interface{}{
-			"enabled": true,
-			"limit":   100, // Free tier limit
-		},
-		string(models.FeatureTemplateLibrary): map[string]interface{}{
+	features := make(map[string]interface{})
+	for feature, limit := range models.FreeTierFeatures {
+		features[string(feature)] = map[string]interface{}{
 			"enabled": true,
-			"limit":   5, // Free tier limit
-		},
+			"limit":   limit,
+		}
 	}
+	return features
 }
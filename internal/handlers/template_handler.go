@@ -0,0 +1,454 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"kori/internal/config"
+	"kori/internal/events"
+	"kori/internal/models"
+	"kori/internal/utils"
+	"kori/internal/utils/base64"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+type TemplateHandler struct {
+	db *gorm.DB
+}
+
+func NewTemplateHandler(db *gorm.DB) *TemplateHandler {
+	return &TemplateHandler{db: db}
+}
+
+// GetTemplateUsage lists what references a template
+// @Summary Get template usage
+// @Description List the campaigns, campaign variants, automations and team settings (invite/welcome) using a template
+// @Tags templates
+// @Produce json
+// @Param id path string true "Template ID"
+// @Success 200 {object} models.TemplateUsage
+// @Failure 404 {object} map[string]string "Template not found"
+// @Router /api/v1/templates/{id}/usage [get]
+func (h *TemplateHandler) GetTemplateUsage(c echo.Context) error {
+	teamID := c.Get("teamID").(string)
+
+	template := &models.Template{}
+	if err := h.db.Where("id = ? AND team_id = ? AND is_deleted = false", c.Param("id"), teamID).First(template).Error; err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "template not found")
+	}
+
+	usage, err := models.GetTemplateUsage(teamID, template.ID, h.db)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get template usage")
+	}
+
+	return c.JSON(http.StatusOK, usage)
+}
+
+// DeleteTemplate deletes a template unless something still sends with it
+// @Summary Delete template
+// @Description Delete a template. Templates used by unfinished or recurring campaigns, active automations or team settings are only deleted with force=true, which also clears the team settings using it.
+// @Tags templates
+// @Produce json
+// @Param id path string true "Template ID"
+// @Param force query bool false "Delete even if the template is in use"
+// @Success 204
+// @Failure 404 {object} map[string]string "Template not found"
+// @Failure 409 {object} models.TemplateUsage "Template is in use"
+// @Router /api/v1/templates/{id} [delete]
+func (h *TemplateHandler) DeleteTemplate(c echo.Context) error {
+	teamID := c.Get("teamID").(string)
+
+	template := &models.Template{}
+	if err := h.db.Where("id = ? AND team_id = ? AND is_deleted = false", c.Param("id"), teamID).First(template).Error; err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "template not found")
+	}
+
+	usage, err := models.GetTemplateUsage(teamID, template.ID, h.db)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get template usage")
+	}
+
+	if usage.InUse && c.QueryParam("force") != "true" {
+		return c.JSON(http.StatusConflict, map[string]interface{}{
+			"message": (&models.TemplateInUseError{Usage: usage}).Error(),
+			"usage":   usage,
+		})
+	}
+
+	if err := h.db.Transaction(func(tx *gorm.DB) error {
+		// Invites and welcome emails fall back to the defaults rather than a deleted template
+		if err := tx.Model(&models.TeamSettings{}).Where("team_id = ? AND invite_template_id = ?", teamID, template.ID).
+			Update("invite_template_id", "").Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.TeamSettings{}).Where("team_id = ? AND welcome_template_id = ?", teamID, template.ID).
+			Update("welcome_template_id", "").Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.Template{}).Where("id = ?", template.ID).
+			Updates(map[string]interface{}{"is_deleted": true, "deleted_at": time.Now()}).Error
+	}); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to delete template")
+	}
+
+	events.Emit("templates.deleted", template.ID)
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// TemplatePreviewRequest holds the variables a template is rendered with
+type TemplatePreviewRequest struct {
+	Variables map[string]interface{} `json:"variables"`
+}
+
+// TemplatePreview is a template as it would be sent
+type TemplatePreview struct {
+	Subject    string   `json:"subject"`
+	HTML       string   `json:"html"`
+	Text       string   `json:"text"`       // the plain text alternative
+	Unresolved []string `json:"unresolved"` // variables left in the output because no value was given
+}
+
+// TemplateTestSendRequest is a test send of a template
+type TemplateTestSendRequest struct {
+	To        string                 `json:"to" validate:"omitempty,email"` // defaults to the signed in user
+	Variables map[string]interface{} `json:"variables"`
+	Provider  string                 `json:"provider" validate:"omitempty,oneof=CUSTOM GMAIL OUTLOOK AMAZON SENDGRID MAILGUN POSTMARK"`
+}
+
+// PreviewTemplate renders a template with the given variables
+// @Summary Preview template
+// @Description Render the template's subject, html and plain text alternative with the given variables the way they are rendered at send time: snippets, content blocks (untargeted variants only), preheader, variables, conditionals, loops and filters, and click tracking links
+// @Tags templates
+// @Accept json
+// @Produce json
+// @Param id path string true "Template ID"
+// @Param request body TemplatePreviewRequest true "Variables to render with"
+// @Success 200 {object} TemplatePreview
+// @Failure 400 {object} map[string]string "Invalid request body"
+// @Failure 404 {object} map[string]string "Template not found"
+// @Failure 422 {object} map[string]string "Template has no html or can't be rendered"
+// @Router /api/v1/templates/{id}/preview [post]
+func (h *TemplateHandler) PreviewTemplate(c echo.Context) error {
+	teamID := c.Get("teamID").(string)
+
+	req := new(TemplatePreviewRequest)
+	if err := c.Bind(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request body")
+	}
+
+	template := &models.Template{}
+	if err := h.db.Where("id = ? AND team_id = ? AND is_deleted = false", c.Param("id"), teamID).
+		Preload("HtmlFile").First(template).Error; err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "template not found")
+	}
+	if template.HtmlFile == nil {
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, "template has no html file")
+	}
+
+	html, err := utils.GetHTMLFromURL(template.HtmlFile.SignedURL)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get template html")
+	}
+
+	rendered, err := models.RenderSnippets(teamID, []string{html}, h.db)
+	if errors.Is(err, models.ErrSnippetsTooLarge) {
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, err.Error())
+	}
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to render snippets")
+	}
+	html = rendered[0]
+
+	// No contact is sent to, so only untargeted content block variants apply
+	blocks, err := models.NewContentBlockRenderer(teamID, []string{html}, nil, h.db)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to load content blocks")
+	}
+	html, _ = blocks.Render(html, nil)
+
+	for _, part := range []string{template.Subject, html, template.Preheader, template.PlainText} {
+		if err := utils.ValidateTemplate(part); err != nil {
+			return echo.NewHTTPError(http.StatusUnprocessableEntity, err.Error())
+		}
+	}
+
+	cfg := config.GetConfig()
+	preview := &TemplatePreview{}
+	withPreheader, variables := utils.WithPreheader(html, template.Preheader, utils.StringifyVariables(req.Variables))
+	preview.HTML, err = base64.DecodeFromBase64(utils.ReplaceVariables(withPreheader, variables, uuid.Nil.String(), cfg, true))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to render template html")
+	}
+	preview.Text, err = base64.DecodeFromBase64(utils.PlainTextBody(template.PlainText, html, variables))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to render template text")
+	}
+	preview.Subject, err = base64.DecodeFromBase64(utils.ReplaceVariables(template.Subject, variables, uuid.Nil.String(), cfg, false))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to render template subject")
+	}
+
+	preview.Unresolved = []string{}
+	for _, rendered := range []string{preview.Subject, preview.HTML, preview.Text} {
+		variables, _ := utils.ParseVariables(rendered)
+		for variable := range variables {
+			preview.Unresolved = append(preview.Unresolved, variable)
+		}
+	}
+	slices.Sort(preview.Unresolved)
+	preview.Unresolved = slices.Compact(preview.Unresolved)
+
+	return c.JSON(http.StatusOK, preview)
+}
+
+// TestSendTemplate sends a template to a member of the team as a test email
+// @Summary Send test email
+// @Description Send the template, rendered with the given variables, to the email address of a member of the team. The email is flagged as a test, so no contact is created for the recipient.
+// @Tags templates
+// @Accept json
+// @Produce json
+// @Param id path string true "Template ID"
+// @Param request body TemplateTestSendRequest true "Recipient and variables"
+// @Success 202 {object} map[string]string "Test email queued"
+// @Failure 400 {object} map[string]string "Invalid request body or no SMTP config"
+// @Failure 403 {object} map[string]string "Recipient isn't a member of the team"
+// @Failure 404 {object} map[string]string "Template not found"
+// @Router /api/v1/templates/{id}/test-send [post]
+func (h *TemplateHandler) TestSendTemplate(c echo.Context) error {
+	teamID := c.Get("teamID").(string)
+
+	req := new(TemplateTestSendRequest)
+	if err := c.Bind(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request body")
+	}
+	if err := c.Validate(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if req.To == "" {
+		req.To, _ = c.Get("email").(string)
+	}
+	if req.To == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "to is required")
+	}
+
+	template := &models.Template{}
+	if err := h.db.Where("id = ? AND team_id = ? AND is_deleted = false", c.Param("id"), teamID).First(template).Error; err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "template not found")
+	}
+
+	// Tests only go to verified team members so the endpoint can't be used to mail anyone
+	var members int64
+	if err := h.db.Model(&models.User{}).
+		Where("team_id = ? AND LOWER(email) = ? AND is_deleted = false", teamID, strings.ToLower(req.To)).
+		Count(&members).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to check recipient")
+	}
+	if members == 0 {
+		return echo.NewHTTPError(http.StatusForbidden, "test emails can only be sent to members of the team")
+	}
+
+	smtpConfig, err := models.GetSMTPConfig(teamID, "", req.Provider, h.db)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "no SMTP config found for this team")
+	}
+
+	variables, err := json.Marshal(req.Variables)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid variables")
+	}
+
+	email := &models.Email{
+		TeamID:       teamID,
+		TemplateID:   template.ID,
+		To:           req.To,
+		SMTPConfigID: smtpConfig.ID,
+		Data:         variables,
+		Test:         true,
+	}
+	email.ID = uuid.New().String()
+
+	events.Emit("email.send", email)
+
+	return c.JSON(http.StatusAccepted, map[string]string{
+		"id":     email.ID,
+		"status": "Test email queued",
+	})
+}
+
+// ListTemplateVersions lists the recorded versions of a template
+// @Summary List template versions
+// @Description List the versions recorded each time the template's subject, html file or variables changed, newest first
+// @Tags templates
+// @Produce json
+// @Param id path string true "Template ID"
+// @Success 200 {array} models.TemplateVersion
+// @Failure 404 {object} map[string]string "Template not found"
+// @Router /api/v1/templates/{id}/versions [get]
+func (h *TemplateHandler) ListTemplateVersions(c echo.Context) error {
+	teamID := c.Get("teamID").(string)
+
+	template := &models.Template{}
+	if err := h.db.Where("id = ? AND team_id = ? AND is_deleted = false", c.Param("id"), teamID).First(template).Error; err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "template not found")
+	}
+
+	versions, err := models.GetTemplateVersions(template.ID, h.db)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get template versions")
+	}
+
+	return c.JSON(http.StatusOK, versions)
+}
+
+// TextDiff is the diff of one text between two template versions
+type TextDiff struct {
+	Changed    bool              `json:"changed"`
+	Insertions int               `json:"insertions"` // inserted lines for the body, words for the subject
+	Deletions  int               `json:"deletions"`
+	Chunks     []utils.DiffChunk `json:"chunks"`
+	HTML       string            `json:"html"`
+}
+
+// VariablesDiff is how the variables of a template changed between two versions
+type VariablesDiff struct {
+	Changed   bool     `json:"changed"`
+	Added     []string `json:"added"`
+	Removed   []string `json:"removed"`
+	Unchanged []string `json:"unchanged"`
+}
+
+// TemplateDiff is what changed in a template going from one version to another
+type TemplateDiff struct {
+	TemplateID string        `json:"templateId"`
+	From       int           `json:"from"`
+	To         int           `json:"to"`
+	Subject    TextDiff      `json:"subject"`
+	Variables  VariablesDiff `json:"variables"`
+	Body       TextDiff      `json:"body"`
+	HTML       string        `json:"html"` // the whole diff rendered for review
+}
+
+// newTextDiff counts the changed tokens of a diff and renders it
+func newTextDiff(chunks []utils.DiffChunk, count func(string) int) TextDiff {
+	diff := TextDiff{Changed: utils.DiffChanged(chunks), Chunks: chunks, HTML: utils.RenderDiffHTML(chunks)}
+	for _, chunk := range chunks {
+		switch chunk.Op {
+		case utils.DiffInsert:
+			diff.Insertions += count(chunk.Text)
+		case utils.DiffDelete:
+			diff.Deletions += count(chunk.Text)
+		}
+	}
+	return diff
+}
+
+// countLines counts the lines of a chunk, including an unterminated last one
+func countLines(text string) int {
+	return strings.Count(strings.TrimSuffix(text, "\n"), "\n") + 1
+}
+
+// countWords counts the words of a chunk, which also holds the whitespace between them
+func countWords(text string) int {
+	return len(strings.Fields(text))
+}
+
+// templateVersionHTML returns the html of a template version, empty if it has no html file
+func templateVersionHTML(v *models.TemplateVersion) (string, error) {
+	if v.HtmlFile == nil {
+		return "", nil
+	}
+	return utils.GetHTMLFromURL(v.HtmlFile.SignedURL)
+}
+
+// DiffTemplateVersions diffs two versions of a template
+// @Summary Diff template versions
+// @Description Diff the subject (word by word), variables and html body (line by line) of two template versions, as chunks and rendered as escaped html with insertions in <ins> and deletions in <del>
+// @Tags templates
+// @Produce json
+// @Param id path string true "Template ID"
+// @Param a path int true "Version to diff from"
+// @Param b path int true "Version to diff to"
+// @Success 200 {object} TemplateDiff
+// @Failure 400 {object} map[string]string "Invalid version"
+// @Failure 404 {object} map[string]string "Template or version not found"
+// @Router /api/v1/templates/{id}/versions/{a}/diff/{b} [get]
+func (h *TemplateHandler) DiffTemplateVersions(c echo.Context) error {
+	teamID := c.Get("teamID").(string)
+
+	template := &models.Template{}
+	if err := h.db.Where("id = ? AND team_id = ? AND is_deleted = false", c.Param("id"), teamID).First(template).Error; err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "template not found")
+	}
+
+	versions := make([]*models.TemplateVersion, 2)
+	for i, param := range []string{"a", "b"} {
+		number, err := strconv.Atoi(c.Param(param))
+		if err != nil || number < 1 {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid version "+c.Param(param))
+		}
+		versions[i], err = models.GetTemplateVersion(template.ID, number, h.db)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusNotFound, "template version "+c.Param(param)+" not found")
+		}
+	}
+	from, to := versions[0], versions[1]
+
+	fromHTML, err := templateVersionHTML(from)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get template html")
+	}
+	toHTML, err := templateVersionHTML(to)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get template html")
+	}
+
+	diff := &TemplateDiff{
+		TemplateID: template.ID,
+		From:       from.Version,
+		To:         to.Version,
+		Subject:    newTextDiff(utils.DiffWords(from.Subject, to.Subject), countWords),
+		Body:       newTextDiff(utils.DiffLines(fromHTML, toHTML), countLines),
+		Variables:  VariablesDiff{Added: []string{}, Removed: []string{}, Unchanged: []string{}},
+	}
+	// Variables are a set, rendered as one chunk per variable
+	variables := []utils.DiffChunk{}
+	for _, variable := range from.Variables {
+		if slices.Contains(to.Variables, variable) {
+			diff.Variables.Unchanged = append(diff.Variables.Unchanged, variable)
+			variables = append(variables, utils.DiffChunk{Op: utils.DiffEqual, Text: variable})
+		} else {
+			diff.Variables.Removed = append(diff.Variables.Removed, variable)
+			variables = append(variables, utils.DiffChunk{Op: utils.DiffDelete, Text: variable})
+		}
+	}
+	for _, variable := range to.Variables {
+		if !slices.Contains(from.Variables, variable) {
+			diff.Variables.Added = append(diff.Variables.Added, variable)
+			variables = append(variables, utils.DiffChunk{Op: utils.DiffInsert, Text: variable})
+		}
+	}
+	diff.Variables.Changed = len(diff.Variables.Added) > 0 || len(diff.Variables.Removed) > 0
+
+	var variablesHTML []string
+	for _, chunk := range variables {
+		variablesHTML = append(variablesHTML, utils.RenderDiffHTML([]utils.DiffChunk{chunk}))
+	}
+	diff.HTML = fmt.Sprintf(`<h3>Subject</h3>
+<p>%s</p>
+<h3>Variables</h3>
+<p>%s</p>
+<h3>Body</h3>
+<pre>%s</pre>`, diff.Subject.HTML, strings.Join(variablesHTML, ", "), diff.Body.HTML)
+
+	return c.JSON(http.StatusOK, diff)
+}
@@ -0,0 +1,359 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"kori/internal/models"
+	"kori/internal/utils"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// MaxTranslationFileSize caps the size of an imported translation file
+const MaxTranslationFileSize = 5 << 20
+
+// translationLanguage is a language templates are translated between
+type translationLanguage struct {
+	Language string `validate:"required,bcp47_language_tag"`
+}
+
+// TemplateTranslationImportResult is the translation an import saved and what of the file was used
+type TemplateTranslationImportResult struct {
+	Translation *models.TemplateTranslationStatus `json:"translation"`
+	Imported    int                               `json:"imported"` // strings the file translated
+	Stale       []string                          `json:"stale"`    // IDs whose source was edited after the file was exported
+	Unknown     []string                          `json:"unknown"`  // IDs the template doesn't have
+}
+
+// ListTemplateTranslations lists a template's translations and how each compares to it now
+// @Summary List template translations
+// @Description List the language variants imported for a template, each with the source version it was built from and the strings of the source added or edited since, which a new export with untranslated=true hands to the translator
+// @Tags templates
+// @Produce json
+// @Param id path string true "Template ID"
+// @Success 200 {array} models.TemplateTranslationStatus
+// @Failure 400 {object} map[string]string "Template is itself a translation"
+// @Failure 404 {object} map[string]string "Template not found"
+// @Router /api/v1/templates/{id}/translations [get]
+func (h *TemplateHandler) ListTemplateTranslations(c echo.Context) error {
+	template, _, sources, err := h.getTranslationSource(c)
+	if err != nil {
+		return err
+	}
+
+	translations, err := models.GetTemplateTranslations(template.ID, h.db)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get template translations")
+	}
+	version, err := models.GetTemplateCurrentVersion(template.ID, h.db)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get template version")
+	}
+
+	statuses := make([]*models.TemplateTranslationStatus, 0, len(translations))
+	for i := range translations {
+		status, err := models.NewTemplateTranslationStatus(&translations[i], sources, version)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to compare template translation")
+		}
+		statuses = append(statuses, status)
+	}
+
+	return c.JSON(http.StatusOK, statuses)
+}
+
+// ExportTemplateTranslation downloads a template's strings for a translator
+// @Summary Export template strings
+// @Description Download the subject, preheader, plain text and html text of a template as XLIFF 1.2 or CSV for a translation vendor. With a language, strings the template's translation into it already has come filled in, or are left out with untranslated=true.
+// @Tags templates
+// @Produce application/x-xliff+xml,text/csv
+// @Param id path string true "Template ID"
+// @Param format query string false "xliff (default) or csv"
+// @Param language query string false "Language to translate into, e.g. de or pt-BR"
+// @Param sourceLanguage query string false "Language of the template, en by default"
+// @Param untranslated query bool false "Only export strings the translation doesn't have yet"
+// @Success 200 {file} file
+// @Failure 400 {object} map[string]string "Invalid format or language, or template is itself a translation"
+// @Failure 404 {object} map[string]string "Template not found"
+// @Router /api/v1/templates/{id}/translations/export [get]
+func (h *TemplateHandler) ExportTemplateTranslation(c echo.Context) error {
+	format := strings.ToLower(c.QueryParam("format"))
+	if format == "" {
+		format = "xliff"
+	}
+	if format != "xliff" && format != "csv" {
+		return echo.NewHTTPError(http.StatusBadRequest, "format must be xliff or csv")
+	}
+	sourceLanguage := models.NormalizeLanguage(c.QueryParam("sourceLanguage"))
+	if sourceLanguage == "" {
+		sourceLanguage = "en"
+	}
+	language := models.NormalizeLanguage(c.QueryParam("language"))
+	for _, tag := range []string{sourceLanguage, language} {
+		if tag == "" {
+			continue
+		}
+		if err := c.Validate(&translationLanguage{Language: tag}); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid language %q", tag))
+		}
+	}
+
+	template, _, sources, err := h.getTranslationSource(c)
+	if err != nil {
+		return err
+	}
+
+	memory := map[string]string{}
+	if language != "" {
+		translation, err := models.GetTemplateTranslation(template.ID, language, h.db)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to get template translation")
+		}
+		if translation != nil {
+			if memory, err = translation.GetTranslationMemory(); err != nil {
+				return echo.NewHTTPError(http.StatusInternalServerError, "failed to read template translation")
+			}
+		}
+	}
+
+	file := &utils.TranslationFile{Original: template.ID, SourceLanguage: sourceLanguage, TargetLanguage: language}
+	for _, source := range sources {
+		if c.QueryParam("untranslated") == "true" && memory[source.Text] != "" {
+			continue
+		}
+		file.Units = append(file.Units, utils.TranslationUnit{
+			ID:     source.ID,
+			Source: source.Text,
+			Target: memory[source.Text],
+			Note:   translationNote(source),
+		})
+	}
+
+	name := "template_" + template.ID
+	if language != "" {
+		name += "_" + language
+	}
+	var out bytes.Buffer
+	contentType := "application/x-xliff+xml"
+	if format == "csv" {
+		contentType = "text/csv"
+		name += ".csv"
+		err = utils.EncodeTranslationCSV(&out, file)
+	} else {
+		name += ".xlf"
+		err = utils.EncodeXLIFF(&out, file)
+	}
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to export template strings")
+	}
+
+	c.Response().Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", name))
+	return c.Blob(http.StatusOK, contentType, out.Bytes())
+}
+
+// ImportTemplateTranslation builds a language variant of a template from a translated file
+// @Summary Import template translation
+// @Description Upload an XLIFF or CSV file exported for the template and translated, to create its variant in the file's target language, or the given language, linked to the template. Importing again updates the variant and rebuilds it from the template as it is now; a partial file only replaces the strings it has. Strings whose source was edited after the export are reported stale and not used.
+// @Tags templates
+// @Accept multipart/form-data
+// @Produce json
+// @Param id path string true "Template ID"
+// @Param file formData file true "XLIFF 1.2 or CSV with id and target columns"
+// @Param language formData string false "Language of the translation, when the file doesn't say"
+// @Success 201 {object} TemplateTranslationImportResult "Translation created"
+// @Success 200 {object} TemplateTranslationImportResult "Translation updated"
+// @Failure 400 {object} map[string]string "Invalid file or language, or template is itself a translation"
+// @Failure 404 {object} map[string]string "Template not found"
+// @Router /api/v1/templates/{id}/translations/import [post]
+func (h *TemplateHandler) ImportTemplateTranslation(c echo.Context) error {
+	upload, err := c.FormFile("file")
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "file is required")
+	}
+	if upload.Size > MaxTranslationFileSize {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("translation files can be at most %d bytes", MaxTranslationFileSize))
+	}
+	src, err := upload.Open()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to open file")
+	}
+	defer src.Close()
+	data, err := io.ReadAll(io.LimitReader(src, MaxTranslationFileSize))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to read file")
+	}
+
+	var file *utils.TranslationFile
+	if strings.EqualFold(filepath.Ext(upload.Filename), ".csv") || !bytes.HasPrefix(bytes.TrimSpace(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))), []byte("<")) {
+		file, err = utils.DecodeTranslationCSV(data)
+	} else {
+		file, err = utils.DecodeXLIFF(data)
+	}
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	language := models.NormalizeLanguage(c.FormValue("language"))
+	if language == "" {
+		language = models.NormalizeLanguage(file.TargetLanguage)
+	}
+	if err := c.Validate(&translationLanguage{Language: language}); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "language is required, as a form field or the file's target language")
+	}
+
+	template, html, sources, err := h.getTranslationSource(c)
+	if err != nil {
+		return err
+	}
+	if file.Original != "" && file.Original != template.ID {
+		return echo.NewHTTPError(http.StatusBadRequest, "the file was exported for another template")
+	}
+
+	result := &TemplateTranslationImportResult{Stale: []string{}, Unknown: []string{}}
+	byID := make(map[string]string, len(sources))
+	for _, source := range sources {
+		byID[source.ID] = source.Text
+	}
+	imported := map[string]string{}
+	for _, unit := range file.Units {
+		target := strings.TrimSpace(unit.Target)
+		if target == "" {
+			continue
+		}
+		text, ok := byID[unit.ID]
+		switch {
+		case !ok:
+			result.Unknown = append(result.Unknown, unit.ID)
+		case unit.Source != "" && strings.TrimSpace(unit.Source) != text:
+			result.Stale = append(result.Stale, unit.ID)
+		default:
+			imported[text] = target
+			result.Imported++
+		}
+	}
+	if result.Imported == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "the file has no translations of the template's current strings")
+	}
+
+	translation, err := models.GetTemplateTranslation(template.ID, language, h.db)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get template translation")
+	}
+	created := translation == nil
+	if created {
+		translation = &models.Template{TeamID: template.TeamID, SourceTemplateID: template.ID, Language: language}
+	}
+	before := *translation
+
+	memory, err := translation.GetTranslationMemory()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to read template translation")
+	}
+	memory = models.PruneTranslationMemory(models.MergeTranslationMemory(memory, imported), sources)
+	if err := translation.SetTranslationMemory(memory); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to store translations")
+	}
+	version, err := models.GetTemplateCurrentVersion(template.ID, h.db)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get template version")
+	}
+
+	translation.Name = fmt.Sprintf("%s (%s)", template.Name, language)
+	translation.Subject = models.TranslationFor(memory, strings.TrimSpace(template.Subject))
+	translation.Preheader = models.TranslationFor(memory, strings.TrimSpace(template.Preheader))
+	translation.PlainText = models.TranslationFor(memory, strings.TrimSpace(template.PlainText))
+	translation.Variables = template.Variables
+	translation.CategoryID = template.CategoryID
+	translation.SourceVersion = version
+
+	translated := utils.TranslateHTML(html, func(text string) string {
+		return models.TranslationFor(memory, text)
+	})
+	store := &templateHTMLStore{ctx: c.Request().Context()}
+	htmlFile, err := store.StoreHTML(template.TeamID, translation.Name, translated)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to store translated html")
+	}
+
+	if err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(htmlFile).Error; err != nil {
+			return err
+		}
+		translation.HtmlFileID = htmlFile.ID
+		return tx.Omit(clause.Associations).Save(translation).Error
+	}); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to save template translation")
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+		models.RecordAuditChange(c.Request().Context(), models.AuditActionCreate, "templates", translation.ID, nil, translation)
+	} else {
+		models.RecordAuditChange(c.Request().Context(), models.AuditActionUpdate, "templates", translation.ID, &before, translation)
+	}
+
+	if result.Translation, err = models.NewTemplateTranslationStatus(translation, sources, version); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to compare template translation")
+	}
+	return c.JSON(status, result)
+}
+
+// getTranslationSource returns the template of the path with its html and the strings a
+// translator translates. Translations are only made from source templates.
+func (h *TemplateHandler) getTranslationSource(c echo.Context) (*models.Template, string, []models.TranslationString, error) {
+	template := &models.Template{}
+	if err := h.db.Where("id = ? AND team_id = ? AND is_deleted = false", c.Param("id"), c.Get("teamID").(string)).
+		Preload("HtmlFile").First(template).Error; err != nil {
+		return nil, "", nil, echo.NewHTTPError(http.StatusNotFound, "template not found")
+	}
+	if template.SourceTemplateID != "" {
+		return nil, "", nil, echo.NewHTTPError(http.StatusBadRequest, "the template is a translation, translate its source template instead")
+	}
+
+	html := ""
+	if template.HtmlFile != nil {
+		var err error
+		if html, err = utils.GetHTMLFromURL(template.HtmlFile.SignedURL); err != nil {
+			return nil, "", nil, echo.NewHTTPError(http.StatusInternalServerError, "failed to get template html")
+		}
+	}
+
+	var sources []models.TranslationString
+	for _, field := range []models.TranslationString{
+		{ID: models.TranslationUnitSubject, Text: template.Subject},
+		{ID: models.TranslationUnitPreheader, Text: template.Preheader},
+		{ID: models.TranslationUnitPlainText, Text: template.PlainText},
+	} {
+		if field.Text = strings.TrimSpace(field.Text); field.Text != "" {
+			sources = append(sources, field)
+		}
+	}
+	for i, text := range utils.TranslatableText(html) {
+		sources = append(sources, models.TranslationString{ID: fmt.Sprintf("html.%d", i+1), Text: text})
+	}
+	return template, html, sources, nil
+}
+
+// translationNote tells the translator where a string appears and what to leave as is
+func translationNote(source models.TranslationString) string {
+	var notes []string
+	switch source.ID {
+	case models.TranslationUnitSubject:
+		notes = append(notes, "Subject line")
+	case models.TranslationUnitPreheader:
+		notes = append(notes, "Inbox preview text, shown after the subject")
+	case models.TranslationUnitPlainText:
+		notes = append(notes, "Plain text version of the email")
+	}
+	if strings.Contains(source.Text, "{{") {
+		notes = append(notes, "Keep the {{ }} tags as they are; they're filled in when the email is sent")
+	}
+	return strings.Join(notes, ". ")
+}
@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"kori/internal/config"
+	"kori/internal/models"
+	"kori/internal/utils"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+type TrackingDomainHandler struct {
+	db *gorm.DB
+}
+
+func NewTrackingDomainHandler(db *gorm.DB) *TrackingDomainHandler {
+	return &TrackingDomainHandler{db: db}
+}
+
+// SetTrackingDomainRequest is the hostname a team wants its tracking links on
+type SetTrackingDomainRequest struct {
+	Domain string `json:"domain" validate:"required,fqdn"`
+}
+
+// TrackingDomainResponse is a team's tracking domain with the CNAME it must publish
+type TrackingDomainResponse struct {
+	*models.TrackingDomain
+	Record DNSRecordGuidance `json:"record"`
+}
+
+// GetTrackingDomain returns the team's tracking domain
+// @Summary Get tracking domain
+// @Description Get the team's custom tracking domain and the CNAME record to publish for it
+// @Tags domains
+// @Produce json
+// @Success 200 {object} TrackingDomainResponse
+// @Failure 404 {object} map[string]string "No tracking domain"
+// @Router /api/v1/tracking-domain [get]
+func (h *TrackingDomainHandler) GetTrackingDomain(c echo.Context) error {
+	teamID := c.Get("teamID").(string)
+
+	domain, err := models.GetTeamTrackingDomain(teamID, h.db)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get tracking domain")
+	}
+	if domain == nil {
+		return echo.NewHTTPError(http.StatusNotFound, "no tracking domain")
+	}
+
+	return c.JSON(http.StatusOK, trackingDomainResponse(domain))
+}
+
+// SetTrackingDomain registers the team's tracking domain, replacing the one it had
+// @Summary Set tracking domain
+// @Description Register the hostname the team's open and click links should use. Links keep using the public URL until the domain's CNAME is verified.
+// @Tags domains
+// @Accept json
+// @Produce json
+// @Param request body SetTrackingDomainRequest true "Tracking hostname"
+// @Success 200 {object} TrackingDomainResponse
+// @Failure 400 {object} map[string]string "Invalid domain"
+// @Failure 409 {object} map[string]string "Domain is used by another team"
+// @Router /api/v1/tracking-domain [put]
+func (h *TrackingDomainHandler) SetTrackingDomain(c echo.Context) error {
+	teamID := c.Get("teamID").(string)
+
+	req := new(SetTrackingDomainRequest)
+	if err := c.Bind(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request body")
+	}
+	req.Domain = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(req.Domain), "."))
+	if err := c.Validate(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if req.Domain == utils.TrackingCNAMETarget(config.GetConfig()) {
+		return echo.NewHTTPError(http.StatusBadRequest, "the tracking domain must be the team's own hostname")
+	}
+
+	taken, err := models.GetTrackingDomainByHost(req.Domain, h.db)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to check tracking domain")
+	}
+	if taken != nil && taken.TeamID != teamID {
+		return echo.NewHTTPError(http.StatusConflict, "domain is used by another team")
+	}
+
+	domain, err := models.GetTeamTrackingDomain(teamID, h.db)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get tracking domain")
+	}
+	if domain == nil {
+		domain = &models.TrackingDomain{TeamID: teamID}
+	}
+	if domain.Domain != req.Domain {
+		// A new hostname has to be verified again before links move to it
+		domain.Domain = req.Domain
+		domain.Status = models.DomainRecordStatusPending
+		domain.Check = nil
+		domain.VerifiedAt = nil
+	}
+	if err := h.db.Save(domain).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to save tracking domain")
+	}
+
+	return c.JSON(http.StatusOK, trackingDomainResponse(domain))
+}
+
+// VerifyTrackingDomain checks the CNAME of the team's tracking domain
+// @Summary Verify tracking domain
+// @Description Check that the tracking domain's CNAME points at the tracking host; links move to the domain once it does
+// @Tags domains
+// @Produce json
+// @Success 200 {object} TrackingDomainResponse
+// @Failure 404 {object} map[string]string "No tracking domain"
+// @Router /api/v1/tracking-domain/verify [post]
+func (h *TrackingDomainHandler) VerifyTrackingDomain(c echo.Context) error {
+	teamID := c.Get("teamID").(string)
+
+	domain, err := models.GetTeamTrackingDomain(teamID, h.db)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get tracking domain")
+	}
+	if domain == nil {
+		return echo.NewHTTPError(http.StatusNotFound, "no tracking domain")
+	}
+
+	if err := utils.RunTrackingDomainVerification(c.Request().Context(), h.db, domain, config.GetConfig()); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to verify tracking domain")
+	}
+
+	return c.JSON(http.StatusOK, trackingDomainResponse(domain))
+}
+
+// DeleteTrackingDomain removes the team's tracking domain, moving its links back to the public URL
+// @Summary Delete tracking domain
+// @Description Remove the team's tracking domain. Emails already sent keep working as long as the CNAME stays in place.
+// @Tags domains
+// @Success 204
+// @Failure 404 {object} map[string]string "No tracking domain"
+// @Router /api/v1/tracking-domain [delete]
+func (h *TrackingDomainHandler) DeleteTrackingDomain(c echo.Context) error {
+	teamID := c.Get("teamID").(string)
+
+	result := h.db.Where("team_id = ?", teamID).Delete(&models.TrackingDomain{})
+	if result.Error != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to delete tracking domain")
+	}
+	if result.RowsAffected == 0 {
+		return echo.NewHTTPError(http.StatusNotFound, "no tracking domain")
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// trackingDomainResponse adds the CNAME to publish to a tracking domain
+func trackingDomainResponse(domain *models.TrackingDomain) *TrackingDomainResponse {
+	return &TrackingDomainResponse{
+		TrackingDomain: domain,
+		Record: DNSRecordGuidance{
+			Type:    "CNAME",
+			Host:    domain.Domain,
+			Value:   utils.TrackingCNAMETarget(config.GetConfig()),
+			Purpose: "Points the team's tracking links at the tracking endpoints (requires a TLS certificate for this host)",
+		},
+	}
+}
@@ -2,16 +2,23 @@ package handlers
 
 import (
 	"bytes"
+	"crypto/hmac"
 	"encoding/base64"
 	"encoding/csv"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"kori/internal/config"
+	"kori/internal/events"
 	"kori/internal/models"
 	"kori/internal/utils"
 	"kori/internal/utils/logger"
 	"math"
+	"net"
 	"net/http"
+	"net/url"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -46,7 +53,7 @@ func NewTrackingHandler(db *gorm.DB) *TrackingHandler {
 // @Failure 400 {object} map[string]string "Validation error or email not found"
 // @Failure 500 {object} map[string]string "Internal server error"
 // @Router /api/v1/t [post]
-func (h *TrackingHandler) createTrackingEntry(c echo.Context, emailID string, event models.EmailTrackingEvent, url string) (*models.EmailTracking, error) {
+func (h *TrackingHandler) createTrackingEntry(c echo.Context, emailID string, event models.EmailTrackingEvent, url string, linkID string) (*models.EmailTracking, error) {
 	// Get email details
 	var email models.Email
 	if err := h.db.Preload("Campaign").First(&email, "id = ?", emailID).Error; err != nil {
@@ -79,6 +86,17 @@ func (h *TrackingHandler) createTrackingEntry(c echo.Context, emailID string, ev
 		Browser:    browser + " " + version,
 		OS:         ua.OS(),
 		URL:        url,
+		LinkID:     linkID,
+	}
+
+	// Proxies and scanners fetching on the recipient's behalf are flagged, not dropped, so
+	// analytics can leave them out on request
+	if event == models.EmailTrackingEventOpen || event == models.EmailTrackingEventClick {
+		if source := models.DetectBot(tracking.UserAgent, tracking.IPAddress); source != "" {
+			if err := models.MarkBot(tracking, source); err != nil {
+				return nil, err
+			}
+		}
 	}
 
 	// Get geolocation data
@@ -94,15 +112,25 @@ func (h *TrackingHandler) createTrackingEntry(c echo.Context, emailID string, ev
 		return nil, err
 	}
 
+	// Flag bot-like clicks so they don't count as engagement
+	if automated, err := models.FlagAutomatedEngagement(tracking, h.db); err != nil {
+		trackingLog.Error("Failed to check engagement for automation", err)
+	} else if automated {
+		trackingLog.Warn("Flagged automated engagement on email %s (%s)", emailID, tracking.AutomatedReason)
+	}
+
+	events.Emit("email_tracking.created", tracking)
+
 	return tracking, nil
 }
 
 // 🖱️ HandleClick handles click tracking
 // @Summary Handle click tracking
-// @Description Handle click tracking
+// @Description Record a click and redirect to the registered link (/t/click/l/{linkId}), or to the destination carried by the link when it's signed for the email (sig) or the email contained it. Only http(s), mailto and tel destinations are redirected to.
 // @Accept json
 // @Produce json
 // @Param token query string true "Token"
+// @Param sig query string false "Signature of the destination carried by the link"
 // @Success 200 {object} models.EmailTracking "Tracking entry created successfully"
 // @Failure 400 {object} map[string]string "Validation error or token missing"
 // @Failure 401 {object} map[string]string "Invalid token"
@@ -131,23 +159,104 @@ func (h *TrackingHandler) HandleEmailClick(c echo.Context) error {
 		return c.String(http.StatusBadRequest, "Invalid token claims")
 	}
 
-	// Get the original URL from the path
-	originalURL := strings.TrimPrefix(c.Request().URL.Path, "/t/click/")
+	var email models.Email
+	if err := h.db.Select("id", "team_id", "campaign_id", "body").First(&email, "id = ?", emailID).Error; err != nil {
+		return c.String(http.StatusNotFound, "Link not found")
+	}
+	if !h.hostServesTeam(c, email.TeamID) {
+		return c.String(http.StatusNotFound, "Link not found")
+	}
 
-	decodedURL, err := base64.StdEncoding.DecodeString(originalURL)
+	destination, linkID, err := h.clickDestination(&email, strings.TrimPrefix(c.Request().URL.Path, "/t/click/"), c.QueryParam("sig"))
 	if err != nil {
+		return c.String(http.StatusNotFound, "Link not found")
+	}
+	if !allowedRedirect(destination) {
 		return c.String(http.StatusBadRequest, "Invalid URL")
 	}
 
 	// Create tracking entry
-	_, err = h.createTrackingEntry(c, emailID, models.EmailTrackingEventClick, string(decodedURL))
+	_, err = h.createTrackingEntry(c, emailID, models.EmailTrackingEventClick, destination, linkID)
 	if err != nil {
 		trackingLog.Error("Failed to create click tracking entry", err)
 		// Still redirect even if tracking fails
 	}
 
 	// Redirect to original URL
-	return c.Redirect(http.StatusFound, string(decodedURL))
+	return c.Redirect(http.StatusFound, destination)
+}
+
+// clickDestination resolves the path of a click tracking link to where it redirects. Registered
+// links must belong to the email's team and campaign. Links that carry the destination are only
+// followed when it's signed for the email or, for emails sent before links were signed, when
+// the email really contained the link.
+func (h *TrackingHandler) clickDestination(email *models.Email, path string, signature string) (string, string, error) {
+	if linkID, ok := strings.CutPrefix(path, "l/"); ok {
+		link, err := models.GetCampaignLink(linkID, h.db)
+		if err != nil {
+			return "", "", err
+		}
+		if link.TeamID != email.TeamID || link.CampaignID != email.CampaignID {
+			return "", "", fmt.Errorf("link %s isn't in email %s", link.ID, email.ID)
+		}
+		return link.URL, link.ID, nil
+	}
+
+	decodedURL, err := base64.StdEncoding.DecodeString(path)
+	if err != nil {
+		return "", "", err
+	}
+	if signature != "" {
+		expected := utils.LinkSignature(email.ID, string(decodedURL), config.GetConfig())
+		if !hmac.Equal([]byte(signature), []byte(expected)) {
+			return "", "", fmt.Errorf("link to %s isn't signed for email %s", decodedURL, email.ID)
+		}
+		return string(decodedURL), "", nil
+	}
+	body, err := base64.StdEncoding.DecodeString(email.Body)
+	if err != nil {
+		return "", "", err
+	}
+	if !strings.Contains(string(body), "/t/click/"+path+"?") {
+		return "", "", fmt.Errorf("email %s has no link to %s", email.ID, decodedURL)
+	}
+	return string(decodedURL), "", nil
+}
+
+// hostServesTeam reports whether the request's host can serve a team's tracking links. A
+// hostname registered as a tracking domain only serves the team that registered it; the public
+// URL and any other host serve every team.
+func (h *TrackingHandler) hostServesTeam(c echo.Context, teamID string) bool {
+	host := strings.ToLower(c.Request().Host)
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+	if host == utils.TrackingCNAMETarget(config.GetConfig()) {
+		return true
+	}
+
+	domain, err := models.GetTrackingDomainByHost(host, h.db)
+	if err != nil {
+		trackingLog.Error("Failed to resolve tracking domain", err, host)
+		return false
+	}
+	return domain == nil || domain.TeamID == teamID
+}
+
+// allowedRedirect reports whether a click can redirect to a destination: absolute web links,
+// and the mail and phone links email clients hand off
+func allowedRedirect(destination string) bool {
+	parsed, err := url.Parse(destination)
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(parsed.Scheme) {
+	case "http", "https":
+		return parsed.Host != ""
+	case "mailto", "tel":
+		return true
+	}
+	return false
 }
 
 // 👁️ HandleOpen handles open tracking
@@ -184,8 +293,16 @@ func (h *TrackingHandler) HandleEmailOpen(c echo.Context) error {
 		return c.String(http.StatusBadRequest, "Invalid token claims")
 	}
 
+	var email models.Email
+	if err := h.db.Select("id", "team_id").First(&email, "id = ?", emailID).Error; err != nil {
+		return c.String(http.StatusNotFound, "Email not found")
+	}
+	if !h.hostServesTeam(c, email.TeamID) {
+		return c.String(http.StatusNotFound, "Email not found")
+	}
+
 	// Create tracking entry
-	_, err = h.createTrackingEntry(c, emailID, models.EmailTrackingEventOpen, "")
+	_, err = h.createTrackingEntry(c, emailID, models.EmailTrackingEventOpen, "", "")
 	if err != nil {
 		trackingLog.Error("Failed to create open tracking entry", err)
 	}
@@ -202,8 +319,10 @@ func (h *TrackingHandler) HandleEmailOpen(c echo.Context) error {
 // @Accept json
 // @Produce json
 // @Param emailId query string true "Email ID"
+// @Param excludeBots query bool false "Leave out opens and clicks fetched by privacy proxies and scanners"
 // @Success 200 {object} EmailAnalytics "Email analytics"
 // @Failure 400 {object} map[string]string "Validation error or email not found"
+// @Failure 404 {object} map[string]string "Email not found"
 // @Failure 500 {object} map[string]string "Internal server error"
 // @Router /api/v1/analytics/email [get]
 func (h *TrackingHandler) GetEmailAnalytics(c echo.Context) error {
@@ -211,47 +330,54 @@ func (h *TrackingHandler) GetEmailAnalytics(c echo.Context) error {
 	if emailID == "" {
 		return c.String(http.StatusBadRequest, "Missing emailId")
 	}
+	if owned, err := h.teamOwns(c, &models.Email{}, emailID); err != nil {
+		return c.String(http.StatusInternalServerError, "Failed to fetch analytics")
+	} else if !owned {
+		return c.String(http.StatusNotFound, "Email not found")
+	}
 
 	// Time-based filtering
 	startTime := c.QueryParam("startTime")
 	endTime := c.QueryParam("endTime")
 	timeZone := c.QueryParam("timezone")
 
-	var tracking []models.EmailTracking
-	query := h.db.Where("email_id = ?", emailID)
-
-	// Apply time filters if provided
+	var start, end time.Time
 	if startTime != "" {
-		start, err := time.Parse(time.RFC3339, startTime)
-		if err == nil {
-			query = query.Where("timestamp >= ?", start)
-		}
+		start, _ = time.Parse(time.RFC3339, startTime)
 	}
 	if endTime != "" {
-		end, err := time.Parse(time.RFC3339, endTime)
-		if err == nil {
-			query = query.Where("timestamp <= ?", end)
-		}
+		end, _ = time.Parse(time.RFC3339, endTime)
 	}
 
-	if err := query.Find(&tracking).Error; err != nil {
+	// Process analytics with timezone, skipping time filters that don't parse
+	analytics, err := aggregateEmailAnalytics(h.db, humanEvents(func(query *gorm.DB) *gorm.DB {
+		query = query.Where("email_trackings.email_id = ? AND email_trackings.automated = false", emailID)
+		if !start.IsZero() {
+			query = query.Where("email_trackings.timestamp >= ?", start)
+		}
+		if !end.IsZero() {
+			query = query.Where("email_trackings.timestamp <= ?", end)
+		}
+		return query
+	}, excludeBots(c)), timeZone)
+	if err != nil {
 		return c.String(http.StatusInternalServerError, "Failed to fetch analytics")
 	}
 
-	// Process analytics with timezone
-	analytics := processEmailAnalytics(tracking, timeZone)
-
 	return c.JSON(http.StatusOK, analytics)
 }
 
 // 📊 GetCampaignAnalytics returns analytics for a campaign
 // @Summary Get campaign analytics
-// @Description Get campaign analytics
+// @Description Get campaign analytics. With asOf, the analytics recorded at the end of the last month that ended by then are returned instead, so reports of a past month don't change as late events arrive.
 // @Accept json
 // @Produce json
 // @Param campaignId query string true "Campaign ID"
+// @Param asOf query string false "RFC 3339 time or date to return the recorded report of"
+// @Param excludeBots query bool false "Leave out opens and clicks fetched by privacy proxies and scanners"
 // @Success 200 {object} EmailAnalytics "Campaign analytics"
 // @Failure 400 {object} map[string]string "Validation error or campaign not found"
+// @Failure 404 {object} map[string]string "Campaign not found or no report recorded by asOf"
 // @Failure 500 {object} map[string]string "Internal server error"
 // @Router /api/v1/analytics/campaign [get]
 func (h *TrackingHandler) GetCampaignAnalytics(c echo.Context) error {
@@ -259,18 +385,96 @@ func (h *TrackingHandler) GetCampaignAnalytics(c echo.Context) error {
 	if campaignID == "" {
 		return c.String(http.StatusBadRequest, "Missing campaignId")
 	}
-
-	var tracking []models.EmailTracking
-	if err := h.db.Where("campaign_id = ?", campaignID).Find(&tracking).Error; err != nil {
+	if owned, err := h.teamOwns(c, &models.Campaign{}, campaignID); err != nil {
 		return c.String(http.StatusInternalServerError, "Failed to fetch analytics")
+	} else if !owned {
+		return c.String(http.StatusNotFound, "Campaign not found")
 	}
 
-	// Process analytics
-	analytics := processCampaignAnalytics(tracking)
+	if c.QueryParam("asOf") != "" {
+		return h.getAnalyticsReport(c, campaignID)
+	}
+
+	analytics, err := campaignAnalytics(h.db, campaignID, humanEvents(campaignEvents(campaignID, time.Time{}), excludeBots(c)))
+	if err != nil {
+		return c.String(http.StatusInternalServerError, "Failed to fetch analytics")
+	}
 
 	return c.JSON(http.StatusOK, analytics)
 }
 
+// CampaignAnalytics computes a campaign's analytics from the events tracked before until, or
+// from all of them when until is zero
+func CampaignAnalytics(db *gorm.DB, campaignID string, until time.Time) (EmailAnalytics, error) {
+	return campaignAnalytics(db, campaignID, campaignEvents(campaignID, until))
+}
+
+// campaignAnalytics computes a campaign's analytics from its events in scope
+func campaignAnalytics(db *gorm.DB, campaignID string, scope analyticsScope) (EmailAnalytics, error) {
+	analytics, err := aggregateEmailAnalytics(db, scope, "UTC")
+	if err != nil {
+		return EmailAnalytics{}, err
+	}
+	if err := applyCampaignRates(db, campaignID, &analytics); err != nil {
+		return EmailAnalytics{}, err
+	}
+	return analytics, nil
+}
+
+// campaignEvents scopes analytics to a campaign's events tracked before until, or to all of
+// them when until is zero
+func campaignEvents(campaignID string, until time.Time) analyticsScope {
+	return func(query *gorm.DB) *gorm.DB {
+		query = query.Where("email_trackings.campaign_id = ? AND email_trackings.automated = false", campaignID)
+		if !until.IsZero() {
+			query = query.Where("email_trackings.timestamp < ?", until)
+		}
+		return query
+	}
+}
+
+// teamOwns reports whether the signed in team has the row of model with the ID, so analytics
+// scoped by an email or campaign ID can't be read across teams
+func (h *TrackingHandler) teamOwns(c echo.Context, model interface{}, id string) (bool, error) {
+	var count int64
+	err := h.db.Model(model).Where("id = ? AND team_id = ? AND is_deleted = false", id, c.Get("teamID").(string)).Count(&count).Error
+	return count > 0, err
+}
+
+// getAnalyticsReport returns the signed in team's report recorded by asOf, of the campaign or of
+// the team when campaignID is empty
+func (h *TrackingHandler) getAnalyticsReport(c echo.Context, campaignID string) error {
+	teamID := c.Get("teamID").(string)
+
+	asOf, err := parseAsOf(c.QueryParam("asOf"))
+	if err != nil {
+		return c.String(http.StatusBadRequest, "asOf must be an RFC 3339 time or a date")
+	}
+
+	report, err := models.GetAnalyticsReport(teamID, campaignID, asOf, h.db)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.String(http.StatusNotFound, "No analytics report recorded by asOf")
+		}
+		return c.String(http.StatusInternalServerError, "Failed to fetch analytics report")
+	}
+
+	c.Response().Header().Set("X-Analytics-Period", report.Period)
+	return c.JSONBlob(http.StatusOK, report.Metrics)
+}
+
+// parseAsOf reads an RFC 3339 time, or a date meaning the end of that day in UTC
+func parseAsOf(value string) (time.Time, error) {
+	if asOf, err := time.Parse(time.RFC3339, value); err == nil {
+		return asOf, nil
+	}
+	day, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return day.AddDate(0, 0, 1), nil
+}
+
 // Analytics response structures
 // 📊 EmailAnalytics represents email analytics data
 // @Description Email analytics data
@@ -284,6 +488,7 @@ type EmailAnalytics struct {
 	OpenRate       float64 `json:"openRate"`
 	BounceCount    int     `json:"bounceCount"`
 	ComplaintCount int     `json:"complaintCount"`
+	Recipients     int     `json:"recipients,omitempty"` // campaigns only: contacts sent to, from the send snapshots
 
 	// 📱 Device & Browser Analytics
 	DeviceBreakdown  map[string]int `json:"deviceBreakdown"`
@@ -318,6 +523,9 @@ type EmailAnalytics struct {
 }
 
 type LinkAnalytics struct {
+	LinkID             string         `json:"linkId,omitempty"`   // registered link, empty for links sent before registration
+	Label              string         `json:"label,omitempty"`    // anchor text of the registered link
+	Position           int            `json:"position,omitempty"` // order of the registered link in the body
 	URL                string         `json:"url"`
 	ClickCount         int            `json:"clickCount"`
 	UniqueClicks       int            `json:"uniqueClicks"`
@@ -338,147 +546,233 @@ type TimelineDataPoint struct {
 	Browser     string    `json:"browser,omitempty"`
 }
 
-// 📊 processEmailAnalytics processes email analytics data
+// analyticsScope narrows the email_trackings query an analytics aggregation runs over. Columns
+// are qualified since some scopes join emails.
+type analyticsScope func(*gorm.DB) *gorm.DB
+
+// humanEvents narrows a scope to the events no bot fetched when exclude is set
+func humanEvents(scope analyticsScope, exclude bool) analyticsScope {
+	if !exclude {
+		return scope
+	}
+	return func(query *gorm.DB) *gorm.DB {
+		return scope(query).Where("NOT " + models.BotEventSQL)
+	}
+}
+
+// excludeBots reads the excludeBots toggle of analytics endpoints. Anything but a true value
+// keeps the events of proxies and scanners, as before they were flagged.
+func excludeBots(c echo.Context) bool {
+	exclude, _ := strconv.ParseBool(c.QueryParam("excludeBots"))
+	return exclude
+}
+
+// trackedEvents starts a query over the tracking events in scope
+func trackedEvents(db *gorm.DB, scope analyticsScope) *gorm.DB {
+	return db.Model(&models.EmailTracking{}).Scopes(scope)
+}
+
+// countBreakdown counts the events in scope by a column, leaving out empty values unless keepEmpty
+func countBreakdown(db *gorm.DB, scope analyticsScope, column string, keepEmpty bool) (map[string]int, error) {
+	var rows []struct {
+		Key   string
+		Count int
+	}
+	query := trackedEvents(db, scope).
+		Select(fmt.Sprintf("COALESCE(%s, '') AS key, COUNT(*) AS count", column)).
+		Group("key")
+	if !keepEmpty {
+		query = query.Where(fmt.Sprintf("COALESCE(%s, '') <> ''", column))
+	}
+	if err := query.Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	breakdown := make(map[string]int, len(rows))
+	for _, row := range rows {
+		breakdown[row.Key] = row.Count
+	}
+	return breakdown, nil
+}
+
+// 📊 aggregateEmailAnalytics computes the analytics of the tracking events in scope with
+// aggregate queries, so campaigns with millions of events never load them into memory.
+// Hourly and daily breakdowns are in the given time zone, UTC when it's unknown.
 // @Description Process email analytics data
-func processEmailAnalytics(tracking []models.EmailTracking, timeZone string) EmailAnalytics {
-	// Parse timezone or default to UTC
+func aggregateEmailAnalytics(db *gorm.DB, scope analyticsScope, timeZone string) (EmailAnalytics, error) {
 	location, err := time.LoadLocation(timeZone)
-	if err != nil {
+	if err != nil || location == time.Local {
 		location = time.UTC
 	}
 
 	analytics := EmailAnalytics{
-		DeviceBreakdown:    make(map[string]int),
-		BrowserBreakdown:   make(map[string]int),
-		OSBreakdown:        make(map[string]int),
-		GeoBreakdown:       make(map[string]int),
-		CityBreakdown:      make(map[string]int),
-		RegionBreakdown:    make(map[string]int),
 		HourlyBreakdown:    make(map[int]int),
 		DayOfWeekBreakdown: make(map[string]int),
 	}
 
-	uniqueOpens := make(map[string]bool)
-	uniqueClicks := make(map[string]bool)
-	clickedLinks := make(map[string]*LinkAnalytics)
-	userOpenTimes := make(map[string][]time.Time)
-	userClickTimes := make(map[string][]time.Time)
-
-	var firstOpenTime time.Time
-	totalReadTime := time.Duration(0)
-	readTimeCount := 0
-
-	for _, t := range tracking {
-		// Convert timestamp to user's timezone
-		localTime := t.Timestamp.In(location)
-
-		// Update hourly and daily breakdowns
-		analytics.HourlyBreakdown[localTime.Hour()]++
-		analytics.DayOfWeekBreakdown[localTime.Weekday().String()]++
-
-		// Device & Browser analytics
-		analytics.DeviceBreakdown[t.DeviceType]++
-		analytics.BrowserBreakdown[t.Browser]++
-		analytics.OSBreakdown[t.OS]++
-
-		// Geographic analytics
-		if t.Country != "" {
-			analytics.GeoBreakdown[t.Country]++
-		}
-		if t.City != "" {
-			analytics.CityBreakdown[t.City]++
-		}
-		if t.Region != "" {
-			analytics.RegionBreakdown[t.Region]++
-		}
-
-		switch t.Event {
+	// 📊 Event counts
+	var events []struct {
+		Event   models.EmailTrackingEvent
+		Count   int
+		Uniques int
+	}
+	if err := trackedEvents(db, scope).
+		Select("email_trackings.event, COUNT(*) AS count, COUNT(DISTINCT email_trackings.contact_id) AS uniques").
+		Group("email_trackings.event").
+		Scan(&events).Error; err != nil {
+		return analytics, fmt.Errorf("failed to count events: %w", err)
+	}
+	for _, e := range events {
+		switch e.Event {
 		case models.EmailTrackingEventOpen:
-			analytics.OpenCount++
-			uniqueOpens[t.ContactID] = true
-			userOpenTimes[t.ContactID] = append(userOpenTimes[t.ContactID], t.Timestamp)
-
-			if firstOpenTime.IsZero() || t.Timestamp.Before(firstOpenTime) {
-				firstOpenTime = t.Timestamp
-			}
-
+			analytics.OpenCount, analytics.UniqueOpens = e.Count, e.Uniques
 		case models.EmailTrackingEventClick:
-			analytics.ClickCount++
-			uniqueClicks[t.ContactID] = true
-			userClickTimes[t.ContactID] = append(userClickTimes[t.ContactID], t.Timestamp)
-
-			// Track link analytics
-			if _, exists := clickedLinks[t.URL]; !exists {
-				clickedLinks[t.URL] = &LinkAnalytics{
-					URL:             t.URL,
-					DeviceBreakdown: make(map[string]int),
-					FirstClickTime:  t.Timestamp.Format(time.RFC3339),
-				}
-			}
-			link := clickedLinks[t.URL]
-			link.ClickCount++
-			link.DeviceBreakdown[t.DeviceType]++
-			link.LastClickTime = t.Timestamp.Format(time.RFC3339)
-
+			analytics.ClickCount, analytics.UniqueClicks = e.Count, e.Uniques
 		case models.EmailTrackingEventBounce:
-			analytics.BounceCount++
-
+			analytics.BounceCount = e.Count
 		case models.EmailTrackingEventComplaint:
-			analytics.ComplaintCount++
+			analytics.ComplaintCount = e.Count
 		}
 	}
-
-	// Calculate engagement metrics
-	analytics.UniqueOpens = len(uniqueOpens)
-	analytics.UniqueClicks = len(uniqueClicks)
 	analytics.RepeatOpens = analytics.OpenCount - analytics.UniqueOpens
 	analytics.RepeatClicks = analytics.ClickCount - analytics.UniqueClicks
-
 	if analytics.UniqueOpens > 0 {
 		analytics.ClickRate = float64(analytics.UniqueClicks) / float64(analytics.UniqueOpens) * 100
 	}
 
-	// Calculate average read time (time between open and click)
-	for userID, openTimes := range userOpenTimes {
-		if clickTimes, hasClicks := userClickTimes[userID]; hasClicks {
-			for _, openTime := range openTimes {
-				for _, clickTime := range clickTimes {
-					if clickTime.After(openTime) {
-						readTime := clickTime.Sub(openTime)
-						if readTime < 30*time.Minute { // Consider only reasonable read times
-							totalReadTime += readTime
-							readTimeCount++
-						}
-						break
-					}
-				}
-			}
+	// 📱 Device & 🌍 geographic breakdowns
+	for _, breakdown := range []struct {
+		target    *map[string]int
+		column    string
+		keepEmpty bool
+	}{
+		{&analytics.DeviceBreakdown, "email_trackings.device_type", true},
+		{&analytics.BrowserBreakdown, "email_trackings.browser", true},
+		{&analytics.OSBreakdown, "email_trackings.os", true},
+		{&analytics.GeoBreakdown, "email_trackings.country", false},
+		{&analytics.CityBreakdown, "email_trackings.city", false},
+		{&analytics.RegionBreakdown, "email_trackings.region", false},
+	} {
+		counts, err := countBreakdown(db, scope, breakdown.column, breakdown.keepEmpty)
+		if err != nil {
+			return analytics, fmt.Errorf("failed to break events down by %s: %w", breakdown.column, err)
+		}
+		*breakdown.target = counts
+	}
+
+	// ⏰ Hourly and daily breakdowns in the reader's time zone
+	var times []struct {
+		Hour  int
+		Day   int
+		Count int
+	}
+	if err := trackedEvents(db, scope).
+		Select(`EXTRACT(HOUR FROM email_trackings.timestamp AT TIME ZONE ?)::int AS hour,
+			EXTRACT(DOW FROM email_trackings.timestamp AT TIME ZONE ?)::int AS day,
+			COUNT(*) AS count`, location.String(), location.String()).
+		Group("hour, day").
+		Scan(&times).Error; err != nil {
+		return analytics, fmt.Errorf("failed to break events down by time: %w", err)
+	}
+	for _, t := range times {
+		analytics.HourlyBreakdown[t.Hour] += t.Count
+		analytics.DayOfWeekBreakdown[time.Weekday(t.Day).String()] += t.Count
+	}
+
+	// 🔗 Clicked links
+	// Registered links are told apart even when several point at the same URL
+	var links []struct {
+		LinkID       string
+		Label        string
+		Position     int
+		URL          string
+		ClickCount   int
+		UniqueClicks int
+		FirstClick   time.Time
+		LastClick    time.Time
+	}
+	if err := trackedEvents(db, scope).
+		Joins("LEFT JOIN campaign_links ON campaign_links.id = email_trackings.link_id").
+		Select(`COALESCE(email_trackings.link_id::text, '') AS link_id, COALESCE(campaign_links.label, '') AS label,
+			COALESCE(campaign_links.position, 0) AS position, email_trackings.url,
+			COUNT(*) AS click_count, COUNT(DISTINCT email_trackings.contact_id) AS unique_clicks,
+			MIN(email_trackings.timestamp) AS first_click, MAX(email_trackings.timestamp) AS last_click`).
+		Where("email_trackings.event = ?", models.EmailTrackingEventClick).
+		Group("email_trackings.link_id, campaign_links.label, campaign_links.position, email_trackings.url").
+		Order("click_count DESC").
+		Scan(&links).Error; err != nil {
+		return analytics, fmt.Errorf("failed to count link clicks: %w", err)
+	}
+	var linkDevices []struct {
+		LinkID     string
+		URL        string
+		DeviceType string
+		Count      int
+	}
+	if len(links) > 0 {
+		if err := trackedEvents(db, scope).
+			Select(`COALESCE(email_trackings.link_id::text, '') AS link_id, email_trackings.url,
+				COALESCE(email_trackings.device_type, '') AS device_type, COUNT(*) AS count`).
+			Where("email_trackings.event = ?", models.EmailTrackingEventClick).
+			Group("email_trackings.link_id, email_trackings.url, COALESCE(email_trackings.device_type, '')").
+			Scan(&linkDevices).Error; err != nil {
+			return analytics, fmt.Errorf("failed to break link clicks down by device: %w", err)
 		}
 	}
-
-	if readTimeCount > 0 {
-		analytics.AverageReadTime = totalReadTime / time.Duration(readTimeCount)
-	}
-
-	// Process clicked links
-	for _, link := range clickedLinks {
-		uniqueClicksCount := 0
-		for userID := range uniqueClicks {
-			if len(userClickTimes[userID]) > 0 {
-				uniqueClicksCount++
-			}
+	type linkKey struct{ id, url string }
+	devices := make(map[linkKey]map[string]int, len(links))
+	for _, d := range linkDevices {
+		key := linkKey{d.LinkID, d.URL}
+		if devices[key] == nil {
+			devices[key] = make(map[string]int)
+		}
+		devices[key][d.DeviceType] = d.Count
+	}
+	for _, l := range links {
+		link := LinkAnalytics{
+			LinkID:          l.LinkID,
+			Label:           l.Label,
+			Position:        l.Position,
+			URL:             l.URL,
+			ClickCount:      l.ClickCount,
+			UniqueClicks:    l.UniqueClicks,
+			FirstClickTime:  l.FirstClick.Format(time.RFC3339),
+			LastClickTime:   l.LastClick.Format(time.RFC3339),
+			DeviceBreakdown: devices[linkKey{l.LinkID, l.URL}],
+		}
+		if link.DeviceBreakdown == nil {
+			link.DeviceBreakdown = make(map[string]int)
 		}
-		link.UniqueClicks = uniqueClicksCount
 		if analytics.UniqueOpens > 0 {
-			link.ClickRate = float64(uniqueClicksCount) / float64(analytics.UniqueOpens) * 100
+			link.ClickRate = float64(l.UniqueClicks) / float64(analytics.UniqueOpens) * 100
+		}
+		analytics.ClickedLinks = append(analytics.ClickedLinks, link)
+	}
+
+	// 🎯 Average read time: from each open to the contact's next click, when within 30 minutes
+	opens := trackedEvents(db, scope).
+		Select("email_trackings.id, email_trackings.contact_id, email_trackings.timestamp").
+		Where("email_trackings.event = ?", models.EmailTrackingEventOpen)
+	clicks := trackedEvents(db, scope).
+		Select("email_trackings.contact_id, email_trackings.timestamp").
+		Where("email_trackings.event = ?", models.EmailTrackingEventClick)
+	var readSeconds *float64
+	if analytics.OpenCount > 0 && analytics.ClickCount > 0 {
+		if err := db.Raw(`SELECT AVG(EXTRACT(EPOCH FROM read_time)) FROM (
+				SELECT MIN(clicks.timestamp) - opens.timestamp AS read_time
+				FROM (?) AS opens
+				JOIN (?) AS clicks ON clicks.contact_id = opens.contact_id AND clicks.timestamp > opens.timestamp
+				GROUP BY opens.id, opens.timestamp
+			) AS reads WHERE read_time < INTERVAL '30 minutes'`, opens, clicks).
+			Scan(&readSeconds).Error; err != nil {
+			return analytics, fmt.Errorf("failed to compute read time: %w", err)
 		}
-		analytics.ClickedLinks = append(analytics.ClickedLinks, *link)
+	}
+	if readSeconds != nil {
+		analytics.AverageReadTime = time.Duration(*readSeconds * float64(time.Second))
 	}
 
-	// Calculate engagement score (example formula)
 	analytics.EngagementScore = calculateEngagementScore(analytics)
-
-	return analytics
+	return analytics, nil
 }
 
 // 🎯 Calculate engagement score based on various metrics
@@ -504,11 +798,19 @@ func calculateEngagementScore(analytics EmailAnalytics) float64 {
 	return math.Min(score, 100.0) // Cap at 100
 }
 
-// 📊 processCampaignAnalytics processes campaign analytics data
-// @Description Process campaign analytics data
-func processCampaignAnalytics(tracking []models.EmailTracking) EmailAnalytics {
-	// Similar to processEmailAnalytics but with campaign-specific metrics
-	return processEmailAnalytics(tracking, "UTC") // For now, reuse email analytics
+// applyCampaignRates computes a campaign's open and click rates over the recipients snapshotted
+// at send time rather than the list as it is now
+func applyCampaignRates(db *gorm.DB, campaignID string, analytics *EmailAnalytics) error {
+	recipients, err := models.GetCampaignRecipientCount(campaignID, db)
+	if err != nil {
+		return err
+	}
+	analytics.Recipients = int(recipients)
+	if recipients > 0 {
+		analytics.OpenRate = float64(analytics.UniqueOpens) / float64(recipients) * 100
+		analytics.ClickRate = float64(analytics.UniqueClicks) / float64(recipients) * 100
+	}
+	return nil
 }
 
 // Advanced Analytics Response Structures
@@ -624,97 +926,326 @@ type PreferenceMetrics struct {
 
 // 📊 GetTeamOverview returns team-wide analytics
 // @Summary Get team overview
-// @Description Get team overview
+// @Description Get team overview. With asOf, the overview of the signed in team recorded at the end of the last month that ended by then is returned instead.
 // @Accept json
 // @Produce json
-// @Param teamId query string true "Team ID"
+// @Param asOf query string false "RFC 3339 time or date to return the recorded report of"
+// @Param excludeBots query bool false "Leave out opens and clicks fetched by privacy proxies and scanners"
 // @Success 200 {object} TeamOverview "Team overview"
 // @Failure 400 {object} map[string]string "Validation error or team not found"
+// @Failure 404 {object} map[string]string "No report recorded by asOf"
 // @Failure 500 {object} map[string]string "Internal server error"
 // @Router /api/v1/analytics/team/overview [get]
 func (h *TrackingHandler) GetTeamOverview(c echo.Context) error {
-	teamID := c.QueryParam("teamId")
-	if teamID == "" {
-		return c.String(http.StatusBadRequest, "Missing teamId")
+	if c.QueryParam("asOf") != "" {
+		return h.getAnalyticsReport(c, "")
 	}
 
-	// Get date range
-	startDate := c.QueryParam("startDate")
-	endDate := c.QueryParam("endDate")
+	teamID := c.Get("teamID").(string)
+	for _, bound := range []string{c.QueryParam("startDate"), c.QueryParam("endDate")} {
+		if _, err := parseAnalyticsBound(bound); err != nil {
+			return c.String(http.StatusBadRequest, "startDate and endDate must be RFC 3339 times or dates")
+		}
+	}
 
-	// Build query with date range if provided
-	query := h.db.Table("email_trackings").
-		Joins("JOIN emails ON email_trackings.email_id = emails.id").
-		Where("emails.team_id = ?", teamID)
+	overview, err := TeamOverviewFor(h.db, teamID, c.QueryParam("startDate"), c.QueryParam("endDate"), excludeBots(c))
+	if err != nil {
+		return c.String(http.StatusInternalServerError, "Failed to fetch tracking data")
+	}
 
+	return c.JSON(http.StatusOK, overview)
+}
+
+// TeamOverviewFor computes a team's overview, of the emails and events between startDate and
+// endDate when given, leaving out bot opens and clicks with excludeBots
+func TeamOverviewFor(db *gorm.DB, teamID, startDate, endDate string, excludeBots bool) (*TeamOverview, error) {
+	start, err := parseAnalyticsBound(startDate)
+	if err != nil {
+		return nil, err
+	}
+	end, err := parseAnalyticsBound(endDate)
+	if err != nil {
+		return nil, err
+	}
+
+	emails := db.Model(&models.Email{}).Where("team_id = ?", teamID)
 	if startDate != "" {
-		query = query.Where("email_trackings.timestamp >= ?", startDate)
+		emails = emails.Where("created_at >= ?", start)
 	}
 	if endDate != "" {
-		query = query.Where("email_trackings.timestamp <= ?", endDate)
+		emails = emails.Where("created_at <= ?", end)
 	}
 
 	// Get overview metrics
-	overview := TeamOverview{
-		DeviceStats: make(map[string]int),
-		GeoStats:    make(map[string]int),
-	}
+	overview := &TeamOverview{}
 
 	// Get total emails
 	var totalEmails int64
-	h.db.Model(&models.Email{}).Where("team_id = ?", teamID).Count(&totalEmails)
+	if err := emails.Count(&totalEmails).Error; err != nil {
+		return nil, err
+	}
 	overview.TotalEmails = int(totalEmails)
 
-	// Get engagement metrics
-	var tracking []models.EmailTracking
-	if err := query.Find(&tracking).Error; err != nil {
-		return c.String(http.StatusInternalServerError, "Failed to fetch tracking data")
+	// Engagement comes from the hourly rollup, with only the hours it doesn't cover read raw
+	rows, err := models.EmailStatsRows(teamID, start, end, excludeBots, db)
+	if err != nil {
+		return nil, err
 	}
+	stats := func() *gorm.DB { return db.Table("(?) AS stats", rows) }
+
+	// Get engagement metrics, counting emails opened or clicked once however often they were
+	var engagement struct {
+		TotalOpens   int
+		TotalClicks  int
+		UniqueOpens  int
+		UniqueClicks int
+	}
+	if err := stats().
+		Select(`COALESCE(SUM(count) FILTER (WHERE event = ?), 0) AS total_opens,
+			COALESCE(SUM(count) FILTER (WHERE event = ?), 0) AS total_clicks,
+			COALESCE(SUM(first_count) FILTER (WHERE event = ?), 0) AS unique_opens,
+			COALESCE(SUM(first_count) FILTER (WHERE event = ?), 0) AS unique_clicks`,
+			models.EmailTrackingEventOpen, models.EmailTrackingEventClick,
+			models.EmailTrackingEventOpen, models.EmailTrackingEventClick).
+		Scan(&engagement).Error; err != nil {
+		return nil, err
+	}
+	overview.TotalOpens, overview.TotalClicks = engagement.TotalOpens, engagement.TotalClicks
 
-	// Process tracking data
-	uniqueOpens := make(map[string]bool)
-	uniqueClicks := make(map[string]bool)
-	for _, t := range tracking {
-		switch t.Event {
-		case models.EmailTrackingEventOpen:
-			overview.TotalOpens++
-			uniqueOpens[t.EmailID] = true
-			overview.DeviceStats[t.DeviceType]++
-			if t.Country != "" {
-				overview.GeoStats[t.Country]++
-			}
-		case models.EmailTrackingEventClick:
-			overview.TotalClicks++
-			uniqueClicks[t.EmailID] = true
-		}
+	// Device and geo stats are of opens
+	if overview.DeviceStats, err = sumStatsBy(stats().Where("event = ?", models.EmailTrackingEventOpen), "device_type"); err != nil {
+		return nil, err
+	}
+	if overview.GeoStats, err = sumStatsBy(stats().Where("event = ? AND country <> ''", models.EmailTrackingEventOpen), "country"); err != nil {
+		return nil, err
 	}
 
 	// Calculate rates
 	if overview.TotalEmails > 0 {
-		overview.AverageOpenRate = float64(len(uniqueOpens)) / float64(overview.TotalEmails) * 100
-		overview.AverageClickRate = float64(len(uniqueClicks)) / float64(overview.TotalEmails) * 100
+		overview.AverageOpenRate = float64(engagement.UniqueOpens) / float64(overview.TotalEmails) * 100
+		overview.AverageClickRate = float64(engagement.UniqueClicks) / float64(overview.TotalEmails) * 100
 	}
 
 	// Get top campaigns
-	var campaigns []models.Campaign
-	h.db.Where("team_id = ?", teamID).
-		Order("created_at DESC").
+	campaigns := db.Where("team_id = ?", teamID)
+	if endDate != "" {
+		campaigns = campaigns.Where("created_at <= ?", end)
+	}
+	var topCampaigns []models.Campaign
+	campaigns.Order("created_at DESC").
 		Limit(5).
-		Find(&campaigns)
+		Find(&topCampaigns)
 
-	for _, campaign := range campaigns {
+	for _, campaign := range topCampaigns {
 		summary := CampaignSummary{
 			CampaignID: campaign.ID,
 			Name:       campaign.Name,
 		}
-		// Calculate campaign metrics
-		var campaignTracking []models.EmailTracking
-		h.db.Where("campaign_id = ?", campaign.ID).Find(&campaignTracking)
-		summary.EngagementScore = calculateEngagementScore(processEmailAnalytics(campaignTracking, "UTC"))
+		// Calculate campaign metrics from the daily rollup
+		counts, err := models.GetCampaignEventCounts(teamID, campaign.ID, end, excludeBots, db)
+		if err != nil {
+			return nil, err
+		}
+		analytics := EmailAnalytics{
+			OpenCount:      int(counts.Opens),
+			ClickCount:     int(counts.Clicks),
+			UniqueOpens:    int(counts.UniqueOpens),
+			UniqueClicks:   int(counts.UniqueClicks),
+			BounceCount:    int(counts.Bounces),
+			ComplaintCount: int(counts.Complaints),
+			RepeatOpens:    int(counts.Opens - counts.UniqueOpens),
+			RepeatClicks:   int(counts.Clicks - counts.UniqueClicks),
+		}
+		if err := applyCampaignRates(db, campaign.ID, &analytics); err == nil {
+			summary.OpenRate = analytics.OpenRate
+			summary.ClickRate = analytics.ClickRate
+		}
+		summary.EngagementScore = calculateEngagementScore(analytics)
 		overview.TopCampaigns = append(overview.TopCampaigns, summary)
 	}
 
-	return c.JSON(http.StatusOK, overview)
+	return overview, nil
+}
+
+// parseAnalyticsBound reads an analytics range bound, an RFC 3339 time or a date meaning its
+// midnight in UTC. An empty bound is the zero time.
+func parseAnalyticsBound(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if bound, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return bound, nil
+	}
+	return time.Parse(time.DateOnly, value)
+}
+
+// sumStatsBy sums rolled up event counts by a column
+func sumStatsBy(query *gorm.DB, column string) (map[string]int, error) {
+	var rows []struct {
+		Key   string
+		Count int
+	}
+	if err := query.Select(column + " AS key, SUM(count) AS count").Group(column).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	sums := make(map[string]int, len(rows))
+	for _, row := range rows {
+		sums[row.Key] = row.Count
+	}
+	return sums, nil
+}
+
+// ListAnalyticsReports lists the team's recorded monthly reports
+// @Summary List analytics reports
+// @Description List the immutable reports recorded at the end of each month for the team and its campaigns, newest first
+// @Produce json
+// @Param campaignId query string false "Only the reports of this campaign"
+// @Param period query string false "Only the reports of this month, e.g. 2026-09"
+// @Success 200 {array} models.AnalyticsReport "Analytics reports"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /api/v1/analytics/reports [get]
+func (h *TrackingHandler) ListAnalyticsReports(c echo.Context) error {
+	teamID := c.Get("teamID").(string)
+
+	query := h.db.Where("team_id = ? AND is_deleted = false", teamID)
+	if campaignID := c.QueryParam("campaignId"); campaignID != "" {
+		query = query.Where("campaign_id = ?", campaignID)
+	}
+	if period := c.QueryParam("period"); period != "" {
+		query = query.Where("period = ?", period)
+	}
+
+	var reports []models.AnalyticsReport
+	if err := query.Order("period_end DESC, campaign_id NULLS FIRST").Find(&reports).Error; err != nil {
+		return c.String(http.StatusInternalServerError, "Failed to fetch analytics reports")
+	}
+
+	return c.JSON(http.StatusOK, reports)
+}
+
+// Page sizes of ListTrackingEvents
+const (
+	defaultEventPageSize = 1000
+	maxEventPageSize     = 5000
+)
+
+// eventPageToken is where a page of tracking events ended. Events are stored as they happen, so
+// new ones only ever land after the last page and a token stays valid however late it's used,
+// e.g. after being rate limited.
+type eventPageToken struct {
+	Timestamp time.Time `json:"t"`
+	ID        string    `json:"id"`
+}
+
+func (t eventPageToken) encode() string {
+	raw, _ := json.Marshal(t)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeEventPageToken(value string) (*eventPageToken, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	token := &eventPageToken{}
+	if err := json.Unmarshal(raw, token); err != nil {
+		return nil, err
+	}
+	if token.ID == "" {
+		return nil, errors.New("missing id")
+	}
+	return token, nil
+}
+
+// ListTrackingEvents pages through the team's raw tracking events
+// @Summary List tracking events
+// @Description Page through the team's tracking events in the order they happened, for exports through the API. Pages continue with pageToken=nextPageToken of the previous one; the token seeks by timestamp and ID rather than an offset, so paging through millions of events stays fast and no event is skipped or repeated. Keep the filters the same across pages of a token.
+// @Produce json
+// @Param campaignId query string false "Only events of this campaign"
+// @Param emailId query string false "Only events of this email"
+// @Param contactId query string false "Only events of this contact"
+// @Param automated query boolean false "Only events flagged as automated, or only the others when false"
+// @Param event query string false "Only events of this type" Enums(open, click, reply, bounce, complaint, unsubscribe)
+// @Param since query string false "RFC 3339 time of the earliest event"
+// @Param until query string false "RFC 3339 time events must be before"
+// @Param limit query int false "Page size, at most 5000"
+// @Param pageToken query string false "nextPageToken of the previous page"
+// @Success 200 {object} map[string]interface{} "Events and the token of the next page"
+// @Failure 400 {object} map[string]string "Invalid filter or page token"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /api/v1/analytics/events [get]
+func (h *TrackingHandler) ListTrackingEvents(c echo.Context) error {
+	teamID := c.Get("teamID").(string)
+
+	limit, _ := strconv.Atoi(c.QueryParam("limit"))
+	if limit < 1 {
+		limit = defaultEventPageSize
+	}
+	if limit > maxEventPageSize {
+		limit = maxEventPageSize
+	}
+
+	query := h.db.Table("email_trackings").
+		Select("email_trackings.*").
+		Joins("JOIN emails ON emails.id = email_trackings.email_id").
+		Where("emails.team_id = ?", teamID)
+
+	for param, column := range map[string]string{
+		"campaignId": "email_trackings.campaign_id",
+		"emailId":    "email_trackings.email_id",
+		"contactId":  "email_trackings.contact_id",
+		"event":      "email_trackings.event",
+	} {
+		if value := c.QueryParam(param); value != "" {
+			query = query.Where(column+" = ?", value)
+		}
+	}
+	if value := c.QueryParam("automated"); value != "" {
+		automated, err := strconv.ParseBool(value)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "automated must be true or false")
+		}
+		query = query.Where("email_trackings.automated = ?", automated)
+	}
+	for param, op := range map[string]string{"since": ">=", "until": "<"} {
+		value := c.QueryParam(param)
+		if value == "" {
+			continue
+		}
+		at, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, param+" must be an RFC 3339 time")
+		}
+		query = query.Where("email_trackings.timestamp "+op+" ?", at)
+	}
+
+	if value := c.QueryParam("pageToken"); value != "" {
+		token, err := decodeEventPageToken(value)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid page token")
+		}
+		query = query.Where("(email_trackings.timestamp, email_trackings.id) > (?, ?)", token.Timestamp, token.ID)
+	}
+
+	// One event more than the page tells whether there is a next one
+	var events []models.EmailTracking
+	if err := query.Order("email_trackings.timestamp, email_trackings.id").Limit(limit + 1).Find(&events).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to list tracking events")
+	}
+
+	var nextPageToken *string
+	if len(events) > limit {
+		events = events[:limit]
+		last := events[limit-1]
+		token := eventPageToken{Timestamp: last.Timestamp, ID: last.ID}.encode()
+		nextPageToken = &token
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":          events,
+		"limit":         limit,
+		"nextPageToken": nextPageToken,
+	})
 }
 
 // 🔄 CompareCampaigns compares multiple campaigns
@@ -723,6 +1254,7 @@ func (h *TrackingHandler) GetTeamOverview(c echo.Context) error {
 // @Accept json
 // @Produce json
 // @Param campaignIds query string true "Campaign IDs"
+// @Param excludeBots query bool false "Leave out opens and clicks fetched by privacy proxies and scanners"
 // @Success 200 {object} map[string]EmailAnalytics "Campaign analytics"
 // @Failure 400 {object} map[string]string "Validation error or campaignIds missing"
 // @Failure 500 {object} map[string]string "Internal server error"
@@ -733,13 +1265,24 @@ func (h *TrackingHandler) CompareCampaigns(c echo.Context) error {
 		return c.String(http.StatusBadRequest, "Missing campaignIds")
 	}
 
+	// Campaigns of other teams are left out like those that fail to aggregate
+	var owned []string
+	if err := h.db.Model(&models.Campaign{}).
+		Where("id IN ? AND team_id = ? AND is_deleted = false", campaignIDs, c.Get("teamID").(string)).
+		Pluck("id", &owned).Error; err != nil {
+		return c.String(http.StatusInternalServerError, "Failed to fetch analytics")
+	}
+
 	results := make(map[string]EmailAnalytics)
-	for _, campaignID := range campaignIDs {
-		var tracking []models.EmailTracking
-		if err := h.db.Where("campaign_id = ?", campaignID).Find(&tracking).Error; err != nil {
+	for _, campaignID := range owned {
+		analytics, err := aggregateEmailAnalytics(h.db, humanEvents(campaignEvents(campaignID, time.Time{}), excludeBots(c)), "UTC")
+		if err != nil {
+			continue
+		}
+		if err := applyCampaignRates(h.db, campaignID, &analytics); err != nil {
 			continue
 		}
-		results[campaignID] = processEmailAnalytics(tracking, "UTC")
+		results[campaignID] = analytics
 	}
 
 	return c.JSON(http.StatusOK, results)
@@ -752,8 +1295,10 @@ func (h *TrackingHandler) CompareCampaigns(c echo.Context) error {
 // @Produce json
 // @Param emailId query string true "Email ID"
 // @Param campaignId query string true "Campaign ID"
+// @Param excludeBots query bool false "Leave out opens and clicks fetched by privacy proxies and scanners"
 // @Success 200 {object} HeatmapData "Click heatmap"
 // @Failure 400 {object} map[string]string "Validation error or emailId missing"
+// @Failure 404 {object} map[string]string "Email or campaign not found"
 // @Failure 500 {object} map[string]string "Internal server error"
 // @Router /api/v1/analytics/heatmap [get]
 func (h *TrackingHandler) GetClickHeatmap(c echo.Context) error {
@@ -763,9 +1308,23 @@ func (h *TrackingHandler) GetClickHeatmap(c echo.Context) error {
 	if emailID == "" && campaignID == "" {
 		return c.String(http.StatusBadRequest, "Missing both emailId and campaignId. At least one is required")
 	}
+	if emailID != "" {
+		if owned, err := h.teamOwns(c, &models.Email{}, emailID); err != nil {
+			return c.String(http.StatusInternalServerError, "Failed to fetch click data")
+		} else if !owned {
+			return c.String(http.StatusNotFound, "Email not found")
+		}
+	} else if owned, err := h.teamOwns(c, &models.Campaign{}, campaignID); err != nil {
+		return c.String(http.StatusInternalServerError, "Failed to fetch click data")
+	} else if !owned {
+		return c.String(http.StatusNotFound, "Campaign not found")
+	}
 
 	var tracking []models.EmailTracking
-	query := h.db.Where("event = ?", models.EmailTrackingEventClick)
+	query := h.db.Where("event = ? AND automated = false", models.EmailTrackingEventClick)
+	if excludeBots(c) {
+		query = query.Where("NOT " + models.BotEventSQL)
+	}
 
 	if emailID != "" {
 		query = query.Where("email_id = ?", emailID)
@@ -811,17 +1370,14 @@ func (h *TrackingHandler) GetClickHeatmap(c echo.Context) error {
 // @Description Get optimal engagement time data
 // @Accept json
 // @Produce json
-// @Param teamId query string true "Team ID"
+// @Param excludeBots query bool false "Leave out opens and clicks fetched by privacy proxies and scanners"
 // @Success 200 {object} EngagementTimeData "Engagement time data"
 // @Failure 400 {object} map[string]string "Validation error or team not found"
 // @Failure 500 {object} map[string]string "Internal server error"
 // @Router /api/v1/analytics/engagement-times [get]
 
 func (h *TrackingHandler) GetEngagementTimes(c echo.Context) error {
-	teamID := c.QueryParam("teamId")
-	if teamID == "" {
-		return c.String(http.StatusBadRequest, "Missing teamId")
-	}
+	teamID := c.Get("teamID").(string)
 
 	timeData := EngagementTimeData{
 		HourlyBreakdown:   make(map[int]EngagementMetrics),
@@ -831,10 +1387,13 @@ func (h *TrackingHandler) GetEngagementTimes(c echo.Context) error {
 
 	// Get all tracking data for the team
 	var tracking []models.EmailTracking
-	if err := h.db.Table("email_trackings").
+	query := h.db.Table("email_trackings").
 		Joins("JOIN emails ON email_trackings.email_id = emails.id").
-		Where("emails.team_id = ?", teamID).
-		Find(&tracking).Error; err != nil {
+		Where("emails.team_id = ? AND email_trackings.automated = false", teamID)
+	if excludeBots(c) {
+		query = query.Where("NOT " + models.BotEventSQL)
+	}
+	if err := query.Find(&tracking).Error; err != nil {
 		return c.String(http.StatusInternalServerError, "Failed to fetch tracking data")
 	}
 
@@ -871,16 +1430,13 @@ func (h *TrackingHandler) GetEngagementTimes(c echo.Context) error {
 // @Description Get audience analysis
 // @Accept json
 // @Produce json
-// @Param teamId query string true "Team ID"
+// @Param excludeBots query bool false "Leave out opens and clicks fetched by privacy proxies and scanners"
 // @Success 200 {object} AudienceInsights "Audience insights"
 // @Failure 400 {object} map[string]string "Validation error or team not found"
 // @Failure 500 {object} map[string]string "Internal server error"
 // @Router /api/v1/analytics/audience [get]
 func (h *TrackingHandler) GetAudienceInsights(c echo.Context) error {
-	teamID := c.QueryParam("teamId")
-	if teamID == "" {
-		return c.String(http.StatusBadRequest, "Missing teamId")
-	}
+	teamID := c.Get("teamID").(string)
 
 	insights := AudienceInsights{
 		Demographics: make(map[string]int),
@@ -895,10 +1451,15 @@ func (h *TrackingHandler) GetAudienceInsights(c echo.Context) error {
 	}
 
 	// Process contact data
+	exclude := excludeBots(c)
 	for _, contact := range contacts {
 		// Get tracking data for contact
 		var tracking []models.EmailTracking
-		h.db.Where("contact_id = ?", contact.ID).Find(&tracking)
+		query := h.db.Where("contact_id = ? AND automated = false", contact.ID)
+		if exclude {
+			query = query.Where("NOT " + models.BotEventSQL)
+		}
+		query.Find(&tracking)
 
 		// Calculate engagement metrics
 		openCount := 0
@@ -928,44 +1489,42 @@ func (h *TrackingHandler) GetAudienceInsights(c echo.Context) error {
 
 // 📈 GetTrendAnalysis returns trend analysis
 // @Summary Get trend analysis
-// @Description Get trend analysis
+// @Description Get the team's opens, clicks, devices and locations per UTC day, ISO week or month, served from the hourly rollup with only the hours it doesn't cover yet read from raw tracking
 // @Accept json
 // @Produce json
-// @Param teamId query string true "Team ID"
+// @Param excludeBots query bool false "Leave out opens and clicks fetched by privacy proxies and scanners"
 // @Success 200 {object} []trendPoint "Trend analysis"
 // @Failure 400 {object} map[string]string "Validation error or team not found"
 // @Failure 500 {object} map[string]string "Internal server error"
 // @Router /api/v1/analytics/trends [get]
 func (h *TrackingHandler) GetTrendAnalysis(c echo.Context) error {
-	teamID := c.QueryParam("teamId")
-	if teamID == "" {
-		return c.String(http.StatusBadRequest, "Missing teamId")
-	}
+	teamID := c.Get("teamID").(string)
 
 	// Get date range for trend analysis
 	startDate := c.QueryParam("startDate")
 	endDate := c.QueryParam("endDate")
 	interval := c.QueryParam("interval") // daily, weekly, monthly
 
-	// Build query with date range
-	query := h.db.Table("email_trackings").
-		Joins("JOIN emails ON email_trackings.email_id = emails.id").
-		Where("emails.team_id = ?", teamID)
-
-	if startDate != "" {
-		query = query.Where("email_trackings.timestamp >= ?", startDate)
+	start, err := parseAnalyticsBound(startDate)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "startDate must be an RFC 3339 time or a date")
 	}
-	if endDate != "" {
-		query = query.Where("email_trackings.timestamp <= ?", endDate)
+	end, err := parseAnalyticsBound(endDate)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "endDate must be an RFC 3339 time or a date")
 	}
 
-	var tracking []models.EmailTracking
-	if err := query.Find(&tracking).Error; err != nil {
+	// Trends come from the hourly rollup, with only the hours it doesn't cover read raw
+	rows, err := models.EmailStatsRows(teamID, start, end, excludeBots(c), h.db)
+	if err != nil {
 		return c.String(http.StatusInternalServerError, "Failed to fetch tracking data")
 	}
 
 	// Process tracking data into trends
-	trends := processTrends(tracking, interval)
+	trends, err := processTrends(h.db, rows, interval)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, "Failed to fetch tracking data")
+	}
 
 	return c.JSON(http.StatusOK, trends)
 }
@@ -978,6 +1537,7 @@ func (h *TrackingHandler) GetTrendAnalysis(c echo.Context) error {
 // @Param emailId query string true "Email ID"
 // @Success 200 {object} []byte "Exported email analytics"
 // @Failure 400 {object} map[string]string "Validation error or emailId missing"
+// @Failure 404 {object} map[string]string "Email not found"
 // @Failure 500 {object} map[string]string "Internal server error"
 // @Router /api/v1/analytics/export/email [get]
 func (h *TrackingHandler) ExportEmailAnalytics(c echo.Context) error {
@@ -985,6 +1545,11 @@ func (h *TrackingHandler) ExportEmailAnalytics(c echo.Context) error {
 	if emailID == "" {
 		return c.String(http.StatusBadRequest, "Missing emailId")
 	}
+	if owned, err := h.teamOwns(c, &models.Email{}, emailID); err != nil {
+		return c.String(http.StatusInternalServerError, "Failed to fetch tracking data")
+	} else if !owned {
+		return c.String(http.StatusNotFound, "Email not found")
+	}
 
 	format := c.QueryParam("format") // csv, xlsx
 	var tracking []models.EmailTracking
@@ -1015,6 +1580,7 @@ func (h *TrackingHandler) ExportEmailAnalytics(c echo.Context) error {
 // @Param campaignId query string true "Campaign ID"
 // @Success 200 {object} []byte "Exported campaign analytics"
 // @Failure 400 {object} map[string]string "Validation error or campaignId missing"
+// @Failure 404 {object} map[string]string "Campaign not found"
 // @Failure 500 {object} map[string]string "Internal server error"
 // @Router /api/v1/analytics/export/campaign [get]
 func (h *TrackingHandler) ExportCampaignAnalytics(c echo.Context) error {
@@ -1022,6 +1588,11 @@ func (h *TrackingHandler) ExportCampaignAnalytics(c echo.Context) error {
 	if campaignID == "" {
 		return c.String(http.StatusBadRequest, "Missing campaignId")
 	}
+	if owned, err := h.teamOwns(c, &models.Campaign{}, campaignID); err != nil {
+		return c.String(http.StatusInternalServerError, "Failed to fetch tracking data")
+	} else if !owned {
+		return c.String(http.StatusNotFound, "Campaign not found")
+	}
 
 	format := c.QueryParam("format") // csv, xlsx
 	var tracking []models.EmailTracking
@@ -1083,20 +1654,11 @@ func calculateOptimalSendTimes(data EngagementTimeData) []OptimalTimeSlot {
 
 // 📈 calculateTimeSlotScore computes engagement score for a time slot
 func calculateTimeSlotScore(hourly, daily EngagementMetrics) float64 {
-	if hourly.OpenCount == 0 && hourly.ClickCount == 0 {
-		return 0
-	}
-
-	// Weight different metrics
-	openWeight := 0.6
-	clickWeight := 0.4
-
-	// Calculate normalized rates
-	hourlyScore := (float64(hourly.OpenCount)*openWeight + float64(hourly.ClickCount)*clickWeight)
-	dailyScore := (float64(daily.OpenCount)*openWeight + float64(daily.ClickCount)*clickWeight)
-
-	// Combine scores with time-based weighting
-	return (hourlyScore*0.7 + dailyScore*0.3) * 100
+	// Scored the same way campaigns pick each contact's send time
+	return models.TimeSlotScore(
+		models.SendTimeEngagement{Opens: hourly.OpenCount, Clicks: hourly.ClickCount},
+		models.SendTimeEngagement{Opens: daily.OpenCount, Clicks: daily.ClickCount},
+	)
 }
 
 // 📊 calculateConfidence determines confidence level based on sample size
@@ -1178,86 +1740,108 @@ func calculateEngagementTrend(tracking []models.EmailTracking) string {
 }
 
 type trendPoint struct {
-	Period         string                 `json:"period"`
-	OpenCount      int                    `json:"openCount"`
-	ClickCount     int                    `json:"clickCount"`
-	EngagementRate float64                `json:"engagementRate"`
-	Devices        map[string]int         `json:"devices"`
-	Locations      map[string]int         `json:"locations"`
-	Growth         float64                `json:"growth"`
-	Events         []models.EmailTracking `json:"events"`
+	Period         string         `json:"period"`
+	OpenCount      int            `json:"openCount"`
+	ClickCount     int            `json:"clickCount"`
+	EngagementRate float64        `json:"engagementRate"`
+	Devices        map[string]int `json:"devices"`
+	Locations      map[string]int `json:"locations"`
+	Growth         float64        `json:"growth"`
+	EventCount     int            `json:"eventCount"`
 }
 
-// 📊 processTrends generates trend analysis data
-func processTrends(tracking []models.EmailTracking, interval string) []trendPoint {
+// trendPeriodFormats are the Postgres formats labelling each trend interval's periods
+var trendPeriodFormats = map[string]string{
+	"daily":   "YYYY-MM-DD",
+	"weekly":  `IYYY-"W"IW`,
+	"monthly": "YYYY-MM",
+}
 
-	trends := make(map[string]*trendPoint)
+// 📊 processTrends generates trend analysis data from rolled up event counts, in UTC periods
+func processTrends(db *gorm.DB, rows *gorm.DB, interval string) ([]trendPoint, error) {
+	format, ok := trendPeriodFormats[interval]
+	if !ok {
+		format = trendPeriodFormats["monthly"] // Default to monthly
+	}
+	period := fmt.Sprintf("to_char(hour AT TIME ZONE 'UTC', '%s')", format)
+	stats := func() *gorm.DB { return db.Table("(?) AS stats", rows) }
+
+	var totals []struct {
+		Period     string
+		OpenCount  int
+		ClickCount int
+		Total      int
+	}
+	if err := stats().
+		Select(period+` AS period,
+			COALESCE(SUM(count) FILTER (WHERE event = ?), 0) AS open_count,
+			COALESCE(SUM(count) FILTER (WHERE event = ?), 0) AS click_count,
+			SUM(count) AS total`, models.EmailTrackingEventOpen, models.EmailTrackingEventClick).
+		Group("period").
+		Order("period").
+		Scan(&totals).Error; err != nil {
+		return nil, err
+	}
 
-	// Group by interval
-	for _, t := range tracking {
-		var period string
-		switch interval {
-		case "daily":
-			period = t.Timestamp.Format("2006-01-02")
-		case "weekly":
-			year, week := t.Timestamp.ISOWeek()
-			period = fmt.Sprintf("%d-W%02d", year, week)
-		case "monthly":
-			period = t.Timestamp.Format("2006-01")
-		default:
-			period = t.Timestamp.Format("2006-01") // Default to monthly
+	trends := make(map[string]*trendPoint, len(totals))
+	result := make([]trendPoint, len(totals))
+	for i, t := range totals {
+		result[i] = trendPoint{
+			Period:     t.Period,
+			OpenCount:  t.OpenCount,
+			ClickCount: t.ClickCount,
+			EventCount: t.Total,
+			Devices:    make(map[string]int),
+			Locations:  make(map[string]int),
 		}
-
-		if trends[period] == nil {
-			trends[period] = &trendPoint{
-				Period:    period,
-				Devices:   make(map[string]int),
-				Locations: make(map[string]int),
-			}
+		trends[t.Period] = &result[i]
+	}
+
+	for _, breakdown := range []struct {
+		column string
+		where  string
+		target func(point *trendPoint) map[string]int
+	}{
+		{"device_type", "", func(point *trendPoint) map[string]int { return point.Devices }},
+		{"country", "country <> ''", func(point *trendPoint) map[string]int { return point.Locations }},
+	} {
+		var counts []struct {
+			Period string
+			Key    string
+			Count  int
 		}
-
-		point := trends[period]
-		point.Events = append(point.Events, t)
-
-		switch t.Event {
-		case models.EmailTrackingEventOpen:
-			point.OpenCount++
-		case models.EmailTrackingEventClick:
-			point.ClickCount++
+		query := stats()
+		if breakdown.where != "" {
+			query = query.Where(breakdown.where)
 		}
-
-		point.Devices[t.DeviceType]++
-		if t.Country != "" {
-			point.Locations[t.Country]++
+		if err := query.
+			Select(period + " AS period, " + breakdown.column + " AS key, SUM(count) AS count").
+			Group("period, key").
+			Scan(&counts).Error; err != nil {
+			return nil, err
+		}
+		for _, count := range counts {
+			if point := trends[count.Period]; point != nil {
+				breakdown.target(point)[count.Key] = count.Count
+			}
 		}
 	}
 
 	// Calculate rates and growth
-	var sortedPeriods []string
-	for period := range trends {
-		sortedPeriods = append(sortedPeriods, period)
-	}
-	sort.Strings(sortedPeriods)
-
-	var result []trendPoint
-	for i, period := range sortedPeriods {
-		point := trends[period]
-		total := len(point.Events)
-		if total > 0 {
-			point.EngagementRate = float64(point.OpenCount+point.ClickCount) / float64(total) * 100
+	for i := range result {
+		point := &result[i]
+		if point.EventCount > 0 {
+			point.EngagementRate = float64(point.OpenCount+point.ClickCount) / float64(point.EventCount) * 100
 		}
-
 		if i > 0 {
-			prevPoint := trends[sortedPeriods[i-1]]
+			prevPoint := result[i-1]
 			if prevPoint.EngagementRate > 0 {
 				point.Growth = ((point.EngagementRate - prevPoint.EngagementRate) / prevPoint.EngagementRate) * 100
 			}
 		}
-
-		result = append(result, *point)
 	}
 
-	return result
+	return result, nil
 }
 
 // 📋 generateExportData creates formatted export data
@@ -0,0 +1,224 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"kori/internal/config"
+	"kori/internal/events"
+	"kori/internal/models"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// streamBuffer is how many events a slow dashboard can fall behind before they're dropped
+	streamBuffer = 64
+	// streamKeepAlive is how often an idle stream is written to so proxies keep it open
+	streamKeepAlive = 15 * time.Second
+)
+
+// trackingStreams fans tracking events out to the dashboards streaming their campaign. Events
+// go through Redis so a dashboard gets those recorded by every replica, not only the one it's
+// connected to; each replica listens on the channels of the campaigns it streams. Without Redis
+// there's one replica, and events go straight to its streams.
+type trackingStreams struct {
+	mu          sync.RWMutex
+	subscribers map[string]map[chan *models.EmailTracking]struct{} // campaign ID -> streams
+
+	once   sync.Once
+	redis  *redis.Client
+	pubsub *redis.PubSub
+}
+
+var liveTracking = &trackingStreams{subscribers: make(map[string]map[chan *models.EmailTracking]struct{})}
+
+func init() {
+	events.On("email_tracking.created", func(data interface{}) {
+		liveTracking.broadcast(data.(*models.EmailTracking))
+	})
+}
+
+// trackingStreamChannel is the Redis channel a campaign's tracking events are published on
+func trackingStreamChannel(campaignID string) string {
+	return "tracking:stream:" + campaignID
+}
+
+// connect opens the Redis connections the first time they're needed and starts handing the
+// events received to the streams of this replica
+func (s *trackingStreams) connect() {
+	s.once.Do(func() {
+		cfg := config.GetConfig().Redis
+		if cfg.UsesEmbeddedQueue() {
+			return
+		}
+		s.redis = redis.NewClient(&redis.Options{
+			Addr:     cfg.Addr,
+			Username: cfg.Username,
+			Password: cfg.Password,
+			DB:       cfg.DB,
+		})
+		s.pubsub = s.redis.Subscribe(context.Background())
+		go func() {
+			// The channel outlives reconnects; go-redis subscribes again to every channel
+			for message := range s.pubsub.Channel() {
+				tracking := &models.EmailTracking{}
+				if err := json.Unmarshal([]byte(message.Payload), tracking); err != nil {
+					trackingLog.Warn("Failed to decode streamed tracking event: %v", err)
+					continue
+				}
+				s.publish(tracking)
+			}
+		}()
+	})
+}
+
+// broadcast publishes an event recorded by this replica to the streams of every replica. When
+// Redis can't be reached it's still handed to the streams here.
+func (s *trackingStreams) broadcast(tracking *models.EmailTracking) {
+	if tracking.CampaignID == "" {
+		return
+	}
+	s.connect()
+	if s.redis == nil {
+		s.publish(tracking)
+		return
+	}
+	payload, err := json.Marshal(tracking)
+	if err == nil {
+		err = s.redis.Publish(context.Background(), trackingStreamChannel(tracking.CampaignID), payload).Err()
+	}
+	if err != nil {
+		trackingLog.Warn("Failed to publish tracking event %s to streams: %v", tracking.ID, err)
+		s.publish(tracking)
+	}
+}
+
+func (s *trackingStreams) subscribe(campaignID string) chan *models.EmailTracking {
+	s.connect()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stream := make(chan *models.EmailTracking, streamBuffer)
+	if s.subscribers[campaignID] == nil {
+		s.subscribers[campaignID] = make(map[chan *models.EmailTracking]struct{})
+		if s.pubsub != nil {
+			if err := s.pubsub.Subscribe(context.Background(), trackingStreamChannel(campaignID)); err != nil {
+				trackingLog.Warn("Failed to subscribe to tracking events of campaign %s: %v", campaignID, err)
+			}
+		}
+	}
+	s.subscribers[campaignID][stream] = struct{}{}
+	return stream
+}
+
+func (s *trackingStreams) unsubscribe(campaignID string, stream chan *models.EmailTracking) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.subscribers[campaignID], stream)
+	if len(s.subscribers[campaignID]) == 0 {
+		delete(s.subscribers, campaignID)
+		if s.pubsub != nil {
+			if err := s.pubsub.Unsubscribe(context.Background(), trackingStreamChannel(campaignID)); err != nil {
+				trackingLog.Warn("Failed to unsubscribe from tracking events of campaign %s: %v", campaignID, err)
+			}
+		}
+	}
+}
+
+// publish hands the event to every stream of its campaign without waiting on any of them
+func (s *trackingStreams) publish(tracking *models.EmailTracking) {
+	if tracking.CampaignID == "" {
+		return
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for stream := range s.subscribers[tracking.CampaignID] {
+		select {
+		case stream <- tracking:
+		default:
+		}
+	}
+}
+
+// writeSSE writes one server-sent event and flushes it to the client
+func writeSSE(c echo.Context, event, id string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	response := c.Response()
+	if id != "" {
+		if _, err := fmt.Fprintf(response, "id: %s\n", id); err != nil {
+			return err
+		}
+	}
+	if _, err := fmt.Fprintf(response, "event: %s\ndata: %s\n\n", event, payload); err != nil {
+		return err
+	}
+	response.Flush()
+	return nil
+}
+
+// StreamCampaignEvents streams a campaign's tracking events as they are recorded
+// @Summary Stream campaign events
+// @Description Server-sent events of a campaign's opens, clicks, bounces and complaints as they are recorded. The stream starts with a snapshot event holding the campaign's analytics, then sends one event named after each tracking event (open, click, bounce, ...) with the tracking entry as data. Events flagged automated are sent with automated set. A dashboard falling far behind misses events; reconnecting starts over from a fresh snapshot.
+// @Produce text/event-stream
+// @Param campaignId query string true "Campaign ID"
+// @Success 200 {object} models.EmailTracking "Stream of tracking events"
+// @Failure 400 {object} map[string]string "Missing campaignId"
+// @Failure 404 {object} map[string]string "Campaign not found"
+// @Router /api/v1/analytics/stream [get]
+func (h *TrackingHandler) StreamCampaignEvents(c echo.Context) error {
+	teamID := c.Get("teamID").(string)
+
+	campaignID := c.QueryParam("campaignId")
+	if campaignID == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "campaignId is required")
+	}
+	campaign := &models.Campaign{}
+	if err := h.db.Where("id = ? AND team_id = ? AND is_deleted = false", campaignID, teamID).First(campaign).Error; err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "campaign not found")
+	}
+
+	// Subscribe before the snapshot so nothing recorded in between is missed
+	stream := liveTracking.subscribe(campaign.ID)
+	defer liveTracking.unsubscribe(campaign.ID, stream)
+
+	snapshot, err := CampaignAnalytics(h.db, campaign.ID, time.Time{})
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get campaign analytics")
+	}
+
+	header := c.Response().Header()
+	header.Set(echo.HeaderContentType, "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	header.Set("X-Accel-Buffering", "no") // stop nginx from buffering the stream
+	c.Response().WriteHeader(http.StatusOK)
+
+	if err := writeSSE(c, "snapshot", "", snapshot); err != nil {
+		return nil
+	}
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-c.Request().Context().Done():
+			return nil
+		case tracking := <-stream:
+			if err := writeSSE(c, string(tracking.Event), tracking.ID, tracking); err != nil {
+				return nil
+			}
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(c.Response(), ": keep-alive\n\n"); err != nil {
+				return nil
+			}
+			c.Response().Flush()
+		}
+	}
+}
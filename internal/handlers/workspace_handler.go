@@ -0,0 +1,232 @@
+package handlers
+
+import (
+	"errors"
+	"kori/internal/events"
+	"kori/internal/models"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+type WorkspaceHandler struct {
+	db *gorm.DB
+}
+
+func NewWorkspaceHandler(db *gorm.DB) *WorkspaceHandler {
+	return &WorkspaceHandler{db: db}
+}
+
+// DeleteWorkspaceRequest confirms a workspace deletion by repeating the team's name
+type DeleteWorkspaceRequest struct {
+	Confirm string `json:"confirm"`
+}
+
+// DeleteWorkspace schedules the team's workspace for deletion
+// @Summary Delete workspace
+// @Description Soft delete the team and schedule every bit of its data for purging once the grace period of 7 days ends: database rows, stored files, Redis keys and queued tasks. Sending campaigns are paused and API keys stop working right away. Admins are emailed a link to a final export of the data before it's purged. Team admins only.
+// @Tags teams
+// @Accept json
+// @Produce json
+// @Param id path string true "Team ID"
+// @Param request body DeleteWorkspaceRequest true "The team's name, to confirm"
+// @Success 202 {object} models.WorkspaceDeletion
+// @Failure 400 {object} map[string]string "Confirmation doesn't match the team name"
+// @Failure 403 {object} map[string]string "Not a team admin"
+// @Failure 404 {object} map[string]string "Team not found"
+// @Failure 409 {object} map[string]string "Workspace is already scheduled for deletion"
+// @Router /api/v1/teams/{id}/workspace [delete]
+func (h *WorkspaceHandler) DeleteWorkspace(c echo.Context) error {
+	team, err := h.getTeam(c)
+	if err != nil {
+		return err
+	}
+	if team.IsDeleted {
+		return echo.NewHTTPError(http.StatusConflict, "workspace is already scheduled for deletion")
+	}
+	if team.Name == os.Getenv("SUPERADMIN_TEAM_NAME") {
+		return echo.NewHTTPError(http.StatusForbidden, "the platform team can't be deleted")
+	}
+
+	req := new(DeleteWorkspaceRequest)
+	if err := c.Bind(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request body")
+	}
+	if req.Confirm != team.Name {
+		return echo.NewHTTPError(http.StatusBadRequest, "confirm must be the name of the team")
+	}
+
+	userID, _ := c.Get("userID").(string)
+	email, _ := c.Get("email").(string)
+
+	deletion := &models.WorkspaceDeletion{
+		TeamID:           team.ID,
+		TeamName:         team.Name,
+		RequestedByID:    userID,
+		RequestedByEmail: email,
+		Status:           models.WorkspaceDeletionStatusScheduled,
+		PurgeAt:          time.Now().Add(models.WorkspaceDeletionGracePeriod),
+	}
+
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		// Nothing goes out while the workspace waits to be purged
+		inFlight := []models.CampaignStatus{models.CampaignStatusSending, models.CampaignStatusScheduled}
+		var campaignIDs []string
+		if err := tx.Model(&models.Campaign{}).
+			Where("team_id = ? AND status IN ? AND is_deleted = false", team.ID, inFlight).
+			Pluck("id", &campaignIDs).Error; err != nil {
+			return err
+		}
+		if len(campaignIDs) > 0 {
+			if err := tx.Model(&models.Campaign{}).
+				Where("id IN ? AND status IN ?", campaignIDs, inFlight).
+				Update("status", models.CampaignStatusPaused).Error; err != nil {
+				return err
+			}
+		}
+		deletion.PausedCampaignIDs = campaignIDs
+
+		result := tx.Model(&models.Team{}).
+			Where("id = ? AND is_deleted = false", team.ID).
+			Updates(map[string]interface{}{"is_deleted": true, "deleted_at": time.Now()})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errWorkspaceAlreadyDeleted
+		}
+
+		return tx.Create(deletion).Error
+	})
+	if err != nil {
+		if errors.Is(err, errWorkspaceAlreadyDeleted) {
+			return echo.NewHTTPError(http.StatusConflict, "workspace is already scheduled for deletion")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to schedule workspace deletion")
+	}
+
+	events.Emit("workspace_deletion.scheduled", deletion)
+
+	return c.JSON(http.StatusAccepted, deletion)
+}
+
+// GetWorkspaceDeletion returns the team's latest workspace deletion
+// @Summary Get workspace deletion
+// @Description The latest deletion request of the team's workspace and when it will be purged. Team admins only.
+// @Tags teams
+// @Produce json
+// @Param id path string true "Team ID"
+// @Success 200 {object} models.WorkspaceDeletion
+// @Failure 403 {object} map[string]string "Not a team admin"
+// @Failure 404 {object} map[string]string "Workspace deletion not found"
+// @Router /api/v1/teams/{id}/workspace/deletion [get]
+func (h *WorkspaceHandler) GetWorkspaceDeletion(c echo.Context) error {
+	team, err := h.getTeam(c)
+	if err != nil {
+		return err
+	}
+
+	deletion := &models.WorkspaceDeletion{}
+	if err := h.db.Where("team_id = ? AND is_deleted = false", team.ID).Order("created_at DESC").First(deletion).Error; err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "workspace deletion not found")
+	}
+
+	return c.JSON(http.StatusOK, deletion)
+}
+
+// RestoreWorkspace cancels a scheduled workspace deletion
+// @Summary Restore workspace
+// @Description Cancel the deletion of the team's workspace during its grace period. The team and its API keys work again and the campaigns paused by the deletion are resumed. Team admins only.
+// @Tags teams
+// @Accept json
+// @Produce json
+// @Param id path string true "Team ID"
+// @Success 200 {object} models.WorkspaceDeletion
+// @Failure 403 {object} map[string]string "Not a team admin"
+// @Failure 404 {object} map[string]string "No deletion is scheduled"
+// @Failure 409 {object} map[string]string "Workspace is already being purged"
+// @Router /api/v1/teams/{id}/workspace/restore [post]
+func (h *WorkspaceHandler) RestoreWorkspace(c echo.Context) error {
+	team, err := h.getTeam(c)
+	if err != nil {
+		return err
+	}
+
+	deletion, err := models.GetPendingWorkspaceDeletion(team.ID, h.db)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "no workspace deletion is scheduled")
+	}
+
+	var resumed []models.Campaign
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		// The status check is part of the update so a purge starting at the same moment wins
+		now := time.Now()
+		result := tx.Model(&models.WorkspaceDeletion{}).
+			Where("id = ? AND status = ?", deletion.ID, models.WorkspaceDeletionStatusScheduled).
+			Updates(map[string]interface{}{"status": models.WorkspaceDeletionStatusCancelled, "cancelled_at": now})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errWorkspacePurging
+		}
+		deletion.Status = models.WorkspaceDeletionStatusCancelled
+		deletion.CancelledAt = &now
+
+		if err := tx.Model(&models.Team{}).Where("id = ?", team.ID).
+			Updates(map[string]interface{}{"is_deleted": false, "deleted_at": gorm.Expr("NULL")}).Error; err != nil {
+			return err
+		}
+
+		// Resume the campaigns the deletion paused that are still paused
+		if len(deletion.PausedCampaignIDs) == 0 {
+			return nil
+		}
+		if err := tx.Where("id IN ? AND status = ? AND is_deleted = false", []string(deletion.PausedCampaignIDs), models.CampaignStatusPaused).
+			Find(&resumed).Error; err != nil {
+			return err
+		}
+		for i := range resumed {
+			resumed[i].Status = models.CampaignStatusSending
+			if err := tx.Model(&resumed[i]).Update("status", models.CampaignStatusSending).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, errWorkspacePurging) {
+			return echo.NewHTTPError(http.StatusConflict, "workspace is already being purged")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to restore workspace")
+	}
+
+	for i := range resumed {
+		events.Emit("campaign.resumed", &resumed[i])
+	}
+	events.Emit("workspace_deletion.cancelled", deletion)
+
+	return c.JSON(http.StatusOK, deletion)
+}
+
+var (
+	errWorkspaceAlreadyDeleted = errors.New("workspace is already scheduled for deletion")
+	errWorkspacePurging        = errors.New("workspace is already being purged")
+)
+
+// getTeam returns the signed in team, which must be the one in the path
+func (h *WorkspaceHandler) getTeam(c echo.Context) (*models.Team, error) {
+	teamID := c.Get("teamID").(string)
+	if c.Param("id") != teamID {
+		return nil, echo.NewHTTPError(http.StatusNotFound, "team not found")
+	}
+
+	team := &models.Team{}
+	if err := h.db.Where("id = ?", teamID).First(team).Error; err != nil {
+		return nil, echo.NewHTTPError(http.StatusNotFound, "team not found")
+	}
+	return team, nil
+}
@@ -0,0 +1,139 @@
+package hooks
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+
+	console "kori/internal/utils/logger"
+)
+
+var log = console.New("HOOKS")
+
+// Point is a moment of the server's lifecycle that extensions can hook into
+type Point string
+
+const (
+	// BeforeEmailSend runs right before an email goes out with an *EmailSend. Hooks may change
+	// its subject, bodies and headers; rejecting it fails the email without retries.
+	BeforeEmailSend Point = "before_email_send"
+	// AfterContactCreate runs once a contact is inserted with the *models.Contact, inside the
+	// transaction creating it. Changes to the contact are saved; rejecting it undoes the create.
+	AfterContactCreate Point = "after_contact_create"
+	// BeforeCampaignSchedule runs before a campaign is created and queued with the
+	// *models.Campaign. Hooks may change it; rejecting it fails the create with a 422.
+	BeforeCampaignSchedule Point = "before_campaign_schedule"
+)
+
+// Points lists every point hooks can be registered for
+var Points = []Point{BeforeEmailSend, AfterContactCreate, BeforeCampaignSchedule}
+
+// EmailSend is the data of BeforeEmailSend hooks, the email as it's about to be sent
+type EmailSend struct {
+	EmailID    string            `json:"emailId"`
+	TeamID     string            `json:"teamId"`
+	CampaignID string            `json:"campaignId,omitempty"`
+	ContactID  string            `json:"contactId,omitempty"`
+	From       string            `json:"from"`
+	FromName   string            `json:"fromName,omitempty"`
+	To         string            `json:"to"`
+	Subject    string            `json:"subject"`
+	HTML       string            `json:"html"`
+	PlainText  string            `json:"plainText,omitempty"`
+	Headers    map[string]string `json:"headers"`
+}
+
+// Hook runs at a point with the point's data, which it may change in place. Returning an error
+// stops the action; a hook rejecting it on purpose returns a *RejectedError saying why.
+type Hook func(ctx context.Context, point Point, data interface{}) error
+
+// RejectedError is returned when a hook rejects the action it was run for
+type RejectedError struct {
+	Point  Point
+	Reason string
+}
+
+func (e *RejectedError) Error() string {
+	return fmt.Sprintf("rejected by %s hook: %s", e.Point, e.Reason)
+}
+
+// StatusCode lets the API surface the rejection as a validation problem rather than a server error
+func (e *RejectedError) StatusCode() int {
+	return http.StatusUnprocessableEntity
+}
+
+// Reject returns the error a hook rejects an action with
+func Reject(point Point, reason string) error {
+	return &RejectedError{Point: point, Reason: reason}
+}
+
+type Registry struct {
+	hooks map[Point][]Hook
+	mu    sync.RWMutex
+}
+
+var defaultRegistry = NewRegistry()
+
+func NewRegistry() *Registry {
+	return &Registry{
+		hooks: make(map[Point][]Hook),
+	}
+}
+
+// Register adds a hook to a point. Hooks of a point run in the order they were registered.
+func (r *Registry) Register(point Point, hook Hook) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.hooks[point] = append(r.hooks[point], hook)
+	log.Info("Registered hook for %s", point)
+}
+
+// Has reports whether any hook is registered for a point, so callers can skip building its data
+func (r *Registry) Has(point Point) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return len(r.hooks[point]) > 0
+}
+
+// Run runs the hooks of a point one after the other, stopping at the first that fails
+func (r *Registry) Run(ctx context.Context, point Point, data interface{}) error {
+	r.mu.RLock()
+	hooks := r.hooks[point]
+	r.mu.RUnlock()
+
+	for _, hook := range hooks {
+		if err := runHook(ctx, hook, point, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runHook runs a hook, turning a panic into an error so a broken extension fails the action
+// rather than the server
+func runHook(ctx context.Context, hook Hook, point Point, data interface{}) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic in %s hook: %v", point, r)
+		}
+	}()
+	return hook(ctx, point, data)
+}
+
+// Register adds a hook to a point of the default registry
+func Register(point Point, hook Hook) {
+	defaultRegistry.Register(point, hook)
+}
+
+// Has reports whether the default registry has hooks for a point
+func Has(point Point) bool {
+	return defaultRegistry.Has(point)
+}
+
+// Run runs the default registry's hooks of a point
+func Run(ctx context.Context, point Point, data interface{}) error {
+	return defaultRegistry.Run(ctx, point, data)
+}
@@ -0,0 +1,117 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"kori/internal/config"
+	"net/http"
+	"time"
+)
+
+// WebhookRequest is the body posted to a hook URL
+type WebhookRequest struct {
+	Point     Point       `json:"point"`
+	Data      interface{} `json:"data"`
+	Timestamp time.Time   `json:"timestamp"`
+}
+
+// WebhookResponse is what a hook URL returns. An empty body lets the action go ahead unchanged;
+// fields set in data replace those of the point's data.
+type WebhookResponse struct {
+	Reject bool            `json:"reject"`
+	Reason string          `json:"reason"`
+	Data   json.RawMessage `json:"data"`
+}
+
+// NewWebhook returns a hook that posts the point's data to url, signed with secret in the
+// X-Posthoot-Signature header the same way webhooks are. When the url can't be reached or
+// answers with an error status the action fails, or goes ahead unchanged with failOpen.
+func NewWebhook(url, secret string, timeout time.Duration, failOpen bool) Hook {
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	client := &http.Client{Timeout: timeout}
+
+	return func(ctx context.Context, point Point, data interface{}) error {
+		response, err := postWebhook(ctx, client, url, secret, point, data)
+		if err != nil {
+			if failOpen {
+				log.Warn("⚠️ %s hook failed, going ahead without it: %v", point, err)
+				return nil
+			}
+			return err
+		}
+
+		if response.Reject {
+			return Reject(point, response.Reason)
+		}
+		if len(response.Data) > 0 && string(response.Data) != "null" {
+			if err := json.Unmarshal(response.Data, data); err != nil {
+				return fmt.Errorf("invalid data from %s hook: %w", point, err)
+			}
+		}
+		return nil
+	}
+}
+
+func postWebhook(ctx context.Context, client *http.Client, url, secret string, point Point, data interface{}) (*WebhookResponse, error) {
+	body, err := json.Marshal(WebhookRequest{Point: point, Data: data, Timestamp: time.Now().UTC()})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal %s hook request: %w", point, err)
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	signature := hex.EncodeToString(mac.Sum(nil))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build %s hook request: %w", point, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Posthoot-Event", string(point))
+	req.Header.Set("X-Posthoot-Signature", signature)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s hook request failed: %w", point, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("%s hook returned status code %d", point, resp.StatusCode)
+	}
+
+	response := &WebhookResponse{}
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, 8<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s hook response: %w", point, err)
+	}
+	if len(bytes.TrimSpace(raw)) == 0 {
+		return response, nil
+	}
+	if err := json.Unmarshal(raw, response); err != nil {
+		return nil, fmt.Errorf("invalid %s hook response: %w", point, err)
+	}
+	return response, nil
+}
+
+// RegisterWebhooks registers a webhook hook for each point the config has a URL for
+func RegisterWebhooks(cfg config.HooksConfig) {
+	urls := map[Point]string{
+		BeforeEmailSend:        cfg.BeforeEmailSendURL,
+		AfterContactCreate:     cfg.AfterContactCreateURL,
+		BeforeCampaignSchedule: cfg.BeforeCampaignScheduleURL,
+	}
+	for _, point := range Points {
+		if url := urls[point]; url != "" {
+			Register(point, NewWebhook(url, cfg.Secret, cfg.Timeout, cfg.FailOpen))
+		}
+	}
+}
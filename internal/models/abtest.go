@@ -0,0 +1,181 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ABTestStatus tracks the phase of a campaign's A/B test
+type ABTestStatus string
+
+const (
+	ABTestStatusNone           ABTestStatus = ""
+	ABTestStatusTesting        ABTestStatus = "TESTING"
+	ABTestStatusWinnerSelected ABTestStatus = "WINNER_SELECTED"
+)
+
+// ABWinnerMetric is the metric used to pick the winning variant
+type ABWinnerMetric string
+
+const (
+	ABWinnerMetricOpenRate  ABWinnerMetric = "open_rate"
+	ABWinnerMetricClickRate ABWinnerMetric = "click_rate"
+)
+
+// CampaignVariant is one arm of a campaign A/B test. Empty fields fall back to the campaign's
+// template and SMTP sender. Percentage is the share of the audience that receives the variant
+// during the test; whatever is left over gets the winner.
+type CampaignVariant struct {
+	Base
+	Name       string    `gorm:"not null" json:"name" validate:"required,min=1"`
+	CampaignID string    `gorm:"type:uuid;not null;index" json:"campaignId" validate:"omitempty,uuid"`
+	Campaign   *Campaign `json:"campaign,omitempty"`
+	Subject    string    `json:"subject"`
+	TemplateID string    `gorm:"type:uuid;default:NULL" json:"templateId" validate:"omitempty,uuid"`
+	Template   *Template `json:"template,omitempty"`
+	FromName   string    `json:"fromName"`
+	Percentage int       `gorm:"not null" json:"percentage" validate:"required,min=1,max=100"`
+	IsWinner   bool      `gorm:"not null;default:false" json:"isWinner"`
+	TeamID     string    `gorm:"type:uuid;not null" json:"teamId" validate:"omitempty,uuid"`
+	Team       *Team     `json:"team,omitempty"`
+}
+
+// VariantStats are a variant's stats alongside the variant itself
+type VariantStats struct {
+	VariantID string         `json:"variantId"`
+	Name      string         `json:"name"`
+	IsWinner  bool           `json:"isWinner"`
+	Stats     *CampaignStats `json:"stats"`
+	OpenRate  float64        `json:"openRate"`
+	ClickRate float64        `json:"clickRate"`
+}
+
+func (v *CampaignVariant) BeforeCreate(tx *gorm.DB) error {
+	if err := v.Base.BeforeCreate(tx); err != nil {
+		return err
+	}
+
+	var campaign Campaign
+	if err := tx.Session(&gorm.Session{NewDB: true}).Select("id", "team_id", "ab_test_status", "schedule").
+		Where("id = ?", v.CampaignID).First(&campaign).Error; err != nil {
+		return &ValidationError{Message: "campaign not found"}
+	}
+	if campaign.ABTestStatus != ABTestStatusNone {
+		return &ValidationError{Message: "variants can't be added once the A/B test has started"}
+	}
+	if campaign.Schedule == CampaignScheduleRecurring {
+		return &ValidationError{Message: "recurring campaigns can't be A/B tested"}
+	}
+	if v.TeamID == "" {
+		v.TeamID = campaign.TeamID
+	}
+
+	var allocated int64
+	if err := tx.Session(&gorm.Session{NewDB: true}).Model(&CampaignVariant{}).
+		Select("COALESCE(SUM(percentage), 0)").
+		Where("campaign_id = ? AND is_deleted = false", v.CampaignID).
+		Scan(&allocated).Error; err != nil {
+		return err
+	}
+	if int(allocated)+v.Percentage > 100 {
+		return &ValidationError{Message: fmt.Sprintf("variant splits add up to more than 100%% (%d%% already allocated)", allocated)}
+	}
+	return nil
+}
+
+// validateVariants checks the splits of variants created together with their campaign
+func (c *Campaign) validateVariants() error {
+	if len(c.Variants) == 0 {
+		return nil
+	}
+	if c.Schedule == CampaignScheduleRecurring {
+		return &ValidationError{Message: "recurring campaigns can't be A/B tested"}
+	}
+	total := 0
+	for i := range c.Variants {
+		total += c.Variants[i].Percentage
+		c.Variants[i].TeamID = c.TeamID
+	}
+	if total > 100 {
+		return &ValidationError{Message: fmt.Sprintf("variant splits add up to %d%%, more than 100%%", total)}
+	}
+	return nil
+}
+
+// GetCampaignVariants returns a campaign's variants in the order they were created
+func GetCampaignVariants(campaignID string, db *gorm.DB) ([]CampaignVariant, error) {
+	var variants []CampaignVariant
+	if err := db.Preload("Template.HtmlFile").
+		Where("campaign_id = ? AND is_deleted = false", campaignID).
+		Order("created_at ASC").
+		Find(&variants).Error; err != nil {
+		return nil, err
+	}
+	return variants, nil
+}
+
+// GetVariantStats computes the stats of each of a campaign's variants
+func GetVariantStats(campaignID string, db *gorm.DB) ([]VariantStats, error) {
+	variants, err := GetCampaignVariants(campaignID, db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get variants: %w", err)
+	}
+
+	results := make([]VariantStats, 0, len(variants))
+	for _, variant := range variants {
+		stats := &CampaignStats{}
+
+		if err := db.Model(&Email{}).
+			Where("campaign_id = ? AND variant_id = ? AND status IN ? AND is_deleted = false", campaignID, variant.ID,
+				[]EmailStatus{EmailStatusSent, EmailStatusOpened, EmailStatusClicked, EmailStatusBounced}).
+			Count(&stats.Sent).Error; err != nil {
+			return nil, fmt.Errorf("failed to count variant emails: %w", err)
+		}
+
+		if err := stats.countEvents(db.Model(&EmailTracking{}).
+			Select("email_trackings.event, COUNT(DISTINCT email_trackings.email_id) AS count").
+			Joins("JOIN emails ON emails.id = email_trackings.email_id").
+			Where("emails.campaign_id = ? AND emails.variant_id = ? AND email_trackings.automated = false AND email_trackings.is_deleted = false", campaignID, variant.ID).
+			Group("email_trackings.event")); err != nil {
+			return nil, fmt.Errorf("failed to count variant events: %w", err)
+		}
+
+		result := VariantStats{
+			VariantID: variant.ID,
+			Name:      variant.Name,
+			IsWinner:  variant.IsWinner,
+			Stats:     stats,
+		}
+		if stats.Sent > 0 {
+			result.OpenRate = float64(stats.Opens) / float64(stats.Sent) * 100
+			result.ClickRate = float64(stats.Clicks) / float64(stats.Sent) * 100
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// PickWinner returns the variant with the best rate for the metric. Ties go to the variant created first.
+func PickWinner(stats []VariantStats, metric ABWinnerMetric) *VariantStats {
+	var winner *VariantStats
+	best := -1.0
+	for i := range stats {
+		rate := stats[i].OpenRate
+		if metric == ABWinnerMetricClickRate {
+			rate = stats[i].ClickRate
+		}
+		if rate > best {
+			best = rate
+			winner = &stats[i]
+		}
+	}
+	return winner
+}
+
+// ABTestDeadline is when the winner of a campaign's A/B test is picked
+func (c *Campaign) ABTestDeadline() time.Time {
+	return c.ABTestStartedAt.Add(time.Duration(c.ABTestHours) * time.Hour)
+}
@@ -0,0 +1,197 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+)
+
+// AlertMetric is a campaign performance metric an alert rule can watch
+type AlertMetric string
+
+const (
+	AlertMetricOpenRate        AlertMetric = "open_rate"
+	AlertMetricClickRate       AlertMetric = "click_rate"
+	AlertMetricBounceRate      AlertMetric = "bounce_rate"
+	AlertMetricComplaintRate   AlertMetric = "complaint_rate"
+	AlertMetricUnsubscribeRate AlertMetric = "unsubscribe_rate"
+	AlertMetricUnsubscribes    AlertMetric = "unsubscribes"
+	AlertMetricBounces         AlertMetric = "bounces"
+)
+
+// Alert actions recorded on an alert event
+const (
+	AlertActionNotify    = "notify"
+	AlertActionWebhook   = "webhook"
+	AlertActionAutoPause = "auto_pause"
+)
+
+// AlertRule is a user-defined threshold on a campaign metric. Rules without a campaign
+// apply to every campaign of the team that sent within the lookback window.
+type AlertRule struct {
+	Base
+	Name          string      `gorm:"not null" json:"name" validate:"required,min=2"`
+	Metric        AlertMetric `gorm:"not null" json:"metric" validate:"required,oneof=open_rate click_rate bounce_rate complaint_rate unsubscribe_rate unsubscribes bounces"`
+	Operator      string      `gorm:"not null;default:'gt'" json:"operator" validate:"required,oneof=lt gt"`
+	Threshold     float64     `gorm:"not null" json:"threshold" validate:"min=0"`
+	MinAgeHours   int         `gorm:"not null;default:0" json:"minAgeHours" validate:"min=0"`
+	MinSent       int         `gorm:"not null;default:100" json:"minSent" validate:"min=0"`
+	LookbackDays  int         `gorm:"not null;default:7" json:"lookbackDays" validate:"min=0"`
+	NotifyEmail   bool        `gorm:"not null;default:true" json:"notifyEmail"`
+	NotifyWebhook bool        `gorm:"not null;default:false" json:"notifyWebhook"`
+	AutoPause     bool        `gorm:"not null;default:false" json:"autoPause"`
+	IsActive      bool        `gorm:"not null;default:true" json:"isActive"`
+	CampaignID    string      `gorm:"type:uuid;default:NULL" json:"campaignId" validate:"omitempty,uuid"`
+	Campaign      *Campaign   `json:"campaign,omitempty"`
+	TeamID        string      `gorm:"type:uuid;not null" json:"teamId" validate:"required,uuid"`
+	Team          *Team       `json:"team,omitempty"`
+}
+
+// AlertEvent records that a rule fired for a campaign; a rule fires at most once per campaign
+type AlertEvent struct {
+	Base
+	RuleID      string         `gorm:"type:uuid;not null;uniqueIndex:idx_alert_event_rule_campaign" json:"ruleId"`
+	Rule        *AlertRule     `json:"rule,omitempty"`
+	CampaignID  string         `gorm:"type:uuid;not null;uniqueIndex:idx_alert_event_rule_campaign" json:"campaignId"`
+	Campaign    *Campaign      `json:"campaign,omitempty"`
+	Metric      AlertMetric    `gorm:"not null" json:"metric"`
+	Value       float64        `gorm:"not null" json:"value"`
+	Threshold   float64        `gorm:"not null" json:"threshold"`
+	Actions     pq.StringArray `gorm:"type:text[]" json:"actions"`
+	TriggeredAt time.Time      `gorm:"not null" json:"triggeredAt"`
+	TeamID      string         `gorm:"type:uuid;not null;index" json:"teamId"`
+}
+
+// CampaignStats are the delivery and engagement counts of a campaign. Engagement counts
+// are unique per email so repeated opens or clicks don't inflate rates.
+type CampaignStats struct {
+	Sent         int64     `json:"sent"`
+	Opens        int64     `json:"opens"`
+	Clicks       int64     `json:"clicks"`
+	Bounces      int64     `json:"bounces"`
+	Complaints   int64     `json:"complaints"`
+	Unsubscribes int64     `json:"unsubscribes"`
+	FirstSentAt  time.Time `json:"firstSentAt"`
+}
+
+// GetCampaignStats computes the current stats of a campaign
+func GetCampaignStats(campaignID string, db *gorm.DB) (*CampaignStats, error) {
+	stats := &CampaignStats{}
+
+	var sent struct {
+		Count       int64
+		FirstSentAt *time.Time
+	}
+	if err := db.Model(&Email{}).
+		Select("COUNT(*) AS count, MIN(sent_at) AS first_sent_at").
+		Where("campaign_id = ? AND status IN ? AND is_deleted = false", campaignID,
+			[]EmailStatus{EmailStatusSent, EmailStatusOpened, EmailStatusClicked, EmailStatusBounced}).
+		Scan(&sent).Error; err != nil {
+		return nil, fmt.Errorf("failed to count sent emails: %w", err)
+	}
+	stats.Sent = sent.Count
+	if sent.FirstSentAt != nil {
+		stats.FirstSentAt = *sent.FirstSentAt
+	}
+
+	if err := stats.countEvents(db.Model(&EmailTracking{}).
+		Select("event, COUNT(DISTINCT email_id) AS count").
+		Where("campaign_id = ? AND automated = false AND is_deleted = false", campaignID).
+		Group("event")); err != nil {
+		return nil, fmt.Errorf("failed to count campaign events: %w", err)
+	}
+
+	return stats, nil
+}
+
+// countEvents fills the engagement counts from a query yielding event and count columns
+func (s *CampaignStats) countEvents(query *gorm.DB) error {
+	var events []struct {
+		Event EmailTrackingEvent
+		Count int64
+	}
+	if err := query.Scan(&events).Error; err != nil {
+		return err
+	}
+	for _, event := range events {
+		switch event.Event {
+		case EmailTrackingEventOpen:
+			s.Opens = event.Count
+		case EmailTrackingEventClick:
+			s.Clicks = event.Count
+		case EmailTrackingEventBounce:
+			s.Bounces = event.Count
+		case EmailTrackingEventComplaint:
+			s.Complaints = event.Count
+		case EmailTrackingEventUnsubscribe:
+			s.Unsubscribes = event.Count
+		}
+	}
+	return nil
+}
+
+// Value returns the metric a rule watches, as a percentage for rates
+func (r *AlertRule) Value(stats *CampaignStats) float64 {
+	rate := func(count int64) float64 {
+		if stats.Sent == 0 {
+			return 0
+		}
+		return float64(count) / float64(stats.Sent) * 100
+	}
+
+	switch r.Metric {
+	case AlertMetricOpenRate:
+		return rate(stats.Opens)
+	case AlertMetricClickRate:
+		return rate(stats.Clicks)
+	case AlertMetricBounceRate:
+		return rate(stats.Bounces)
+	case AlertMetricComplaintRate:
+		return rate(stats.Complaints)
+	case AlertMetricUnsubscribeRate:
+		return rate(stats.Unsubscribes)
+	case AlertMetricUnsubscribes:
+		return float64(stats.Unsubscribes)
+	case AlertMetricBounces:
+		return float64(stats.Bounces)
+	}
+	return 0
+}
+
+// Ready reports whether a campaign has been sending long enough, to enough people, to judge
+func (r *AlertRule) Ready(stats *CampaignStats, now time.Time) bool {
+	if stats.Sent == 0 || stats.Sent < int64(r.MinSent) {
+		return false
+	}
+	return now.Sub(stats.FirstSentAt) >= time.Duration(r.MinAgeHours)*time.Hour
+}
+
+// Triggered reports whether a metric value breaches the rule
+func (r *AlertRule) Triggered(value float64) bool {
+	if r.Operator == "lt" {
+		return value < r.Threshold
+	}
+	return value > r.Threshold
+}
+
+// IsCampaignHalted reports whether a campaign has been paused, e.g. by an alert rule, cancelled or deleted
+func IsCampaignHalted(campaignID string, db *gorm.DB) bool {
+	campaign, ok := campaignState(campaignID, db)
+	return ok && (campaign.IsDeleted || campaign.Status == CampaignStatusPaused || campaign.Status == CampaignStatusCancelled)
+}
+
+// IsCampaignStopped reports whether a campaign has been cancelled or deleted, so nothing more of it is sent
+func IsCampaignStopped(campaignID string, db *gorm.DB) bool {
+	campaign, ok := campaignState(campaignID, db)
+	return ok && (campaign.IsDeleted || campaign.Status == CampaignStatusCancelled)
+}
+
+func campaignState(campaignID string, db *gorm.DB) (*Campaign, bool) {
+	campaign := &Campaign{}
+	if err := db.Model(&Campaign{}).Select("status", "is_deleted").Where("id = ?", campaignID).Take(campaign).Error; err != nil {
+		return nil, false
+	}
+	return campaign, true
+}
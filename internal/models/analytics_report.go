@@ -0,0 +1,70 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// ErrAnalyticsReportImmutable is returned when a recorded report is changed
+var ErrAnalyticsReportImmutable = errors.New("analytics reports can't be changed")
+
+// AnalyticsReportPeriodFormat labels a report's period, which is a calendar month in UTC
+const AnalyticsReportPeriodFormat = "2006-01"
+
+// AnalyticsReport freezes a team's or campaign's analytics at the end of a period so reports
+// of it can be reproduced however many late opens arrive afterwards. Metrics holds the response
+// of the live analytics endpoint as of PeriodEnd.
+type AnalyticsReport struct {
+	Base
+	TeamID      string         `gorm:"type:uuid;not null;index:idx_analytics_report_period" json:"teamId"`
+	CampaignID  string         `gorm:"type:uuid;default:NULL;index" json:"campaignId,omitempty"` // empty for the team report
+	Period      string         `gorm:"not null;index:idx_analytics_report_period" json:"period"`
+	PeriodStart time.Time      `gorm:"not null" json:"periodStart"`
+	PeriodEnd   time.Time      `gorm:"not null" json:"periodEnd"` // exclusive
+	Metrics     datatypes.JSON `gorm:"type:jsonb;not null" json:"metrics"`
+	TakenAt     time.Time      `gorm:"not null" json:"takenAt"`
+}
+
+func (r *AnalyticsReport) BeforeUpdate(tx *gorm.DB) error {
+	return ErrAnalyticsReportImmutable
+}
+
+func (r *AnalyticsReport) BeforeDelete(tx *gorm.DB) error {
+	return ErrAnalyticsReportImmutable
+}
+
+// LastReportPeriod returns the last calendar month that ended before t
+func LastReportPeriod(t time.Time) (start, end time.Time) {
+	t = t.UTC()
+	end = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return end.AddDate(0, -1, 0), end
+}
+
+// reportScope selects the team report when campaignID is empty and the campaign's otherwise
+func reportScope(db *gorm.DB, teamID, campaignID string) *gorm.DB {
+	query := db.Model(&AnalyticsReport{}).Where("team_id = ? AND is_deleted = false", teamID)
+	if campaignID == "" {
+		return query.Where("campaign_id IS NULL")
+	}
+	return query.Where("campaign_id = ?", campaignID)
+}
+
+// HasAnalyticsReport reports whether the period's report was already recorded
+func HasAnalyticsReport(teamID, campaignID, period string, db *gorm.DB) (bool, error) {
+	return hasRows(reportScope(db, teamID, campaignID).Where("period = ?", period))
+}
+
+// GetAnalyticsReport returns the latest report of a period that ended by asOf
+func GetAnalyticsReport(teamID, campaignID string, asOf time.Time, db *gorm.DB) (*AnalyticsReport, error) {
+	report := &AnalyticsReport{}
+	if err := reportScope(db, teamID, campaignID).
+		Where("period_end <= ?", asOf).
+		Order("period_end DESC").
+		First(report).Error; err != nil {
+		return nil, err
+	}
+	return report, nil
+}
@@ -0,0 +1,353 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// analyticsRollupName names the watermark of the hourly and daily rollups. It changes with
+// their columns, so a new watermark rebuilds them from all tracking.
+const analyticsRollupName = "email_stats_v2"
+
+// rollupRestate is how far before the watermark the rollups are rebuilt on each run, so
+// clicks flagged automated shortly after they were recorded don't stay counted
+const rollupRestate = time.Hour
+
+// rollupChunk is how much tracking history one rollup transaction aggregates, which keeps
+// the first backfill of a large install from running as one huge statement
+const rollupChunk = 24 * time.Hour
+
+// EmailStatsHourly counts a team's tracking events per hour, campaign, event, device, country
+// and whether a bot fetched them. FirstCount counts the events that were their email's first of
+// the kind, so summing it gives unique opens and clicks per email; FirstHumanCount does the same
+// among the events no bot fetched. Automated events are left out.
+type EmailStatsHourly struct {
+	Base
+	TeamID          string             `gorm:"type:uuid;not null;index:idx_email_stats_hourly_team_hour" json:"teamId"`
+	CampaignID      string             `gorm:"type:uuid;default:NULL;index" json:"campaignId,omitempty"`
+	Hour            time.Time          `gorm:"not null;index:idx_email_stats_hourly_team_hour" json:"hour"`
+	Event           EmailTrackingEvent `gorm:"not null" json:"event"`
+	DeviceType      string             `gorm:"not null;default:''" json:"deviceType"`
+	Country         string             `gorm:"not null;default:''" json:"country"`
+	Bot             bool               `gorm:"not null;default:false" json:"bot"`
+	Count           int64              `gorm:"not null" json:"count"`
+	FirstCount      int64              `gorm:"not null" json:"firstCount"`
+	FirstHumanCount int64              `gorm:"not null;default:0" json:"firstHumanCount"`
+}
+
+func (EmailStatsHourly) TableName() string {
+	return "email_stats_hourly"
+}
+
+// CampaignStatsDaily sums a campaign's hourly stats per UTC day. The day the watermark falls
+// in only holds the hours before it.
+type CampaignStatsDaily struct {
+	Base
+	TeamID       string    `gorm:"type:uuid;not null;index" json:"teamId"`
+	CampaignID   string    `gorm:"type:uuid;not null;index:idx_campaign_stats_daily_campaign_day" json:"campaignId"`
+	Day          time.Time `gorm:"not null;index:idx_campaign_stats_daily_campaign_day" json:"day"`
+	Opens        int64     `gorm:"not null" json:"opens"`
+	UniqueOpens  int64     `gorm:"not null" json:"uniqueOpens"`
+	Clicks       int64     `gorm:"not null" json:"clicks"`
+	UniqueClicks int64     `gorm:"not null" json:"uniqueClicks"`
+	Bounces      int64     `gorm:"not null" json:"bounces"`
+	Complaints   int64     `gorm:"not null" json:"complaints"`
+	// The part of the engagement no bot fetched
+	HumanOpens        int64 `gorm:"not null;default:0" json:"humanOpens"`
+	UniqueHumanOpens  int64 `gorm:"not null;default:0" json:"uniqueHumanOpens"`
+	HumanClicks       int64 `gorm:"not null;default:0" json:"humanClicks"`
+	UniqueHumanClicks int64 `gorm:"not null;default:0" json:"uniqueHumanClicks"`
+}
+
+func (CampaignStatsDaily) TableName() string {
+	return "campaign_stats_daily"
+}
+
+// AnalyticsRollup records how far a rollup is materialized. Events from Through on are
+// only in the raw tables.
+type AnalyticsRollup struct {
+	Base
+	Name    string    `gorm:"not null;uniqueIndex" json:"name"`
+	Through time.Time `gorm:"not null" json:"through"` // exclusive
+}
+
+// CampaignEventCounts are a campaign's event totals, unique counts being per email
+type CampaignEventCounts struct {
+	Opens        int64
+	UniqueOpens  int64
+	Clicks       int64
+	UniqueClicks int64
+	Bounces      int64
+	Complaints   int64
+}
+
+// GetRollupWatermark returns the time the rollups are materialized up to, zero before the first run
+func GetRollupWatermark(db *gorm.DB) (time.Time, error) {
+	return rollupWatermark(analyticsRollupName, db)
+}
+
+// rollupWatermark returns the watermark of a rollup, zero before its first run
+func rollupWatermark(name string, db *gorm.DB) (time.Time, error) {
+	var rollup AnalyticsRollup
+	err := db.Where("name = ?", name).First(&rollup).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return rollup.Through.UTC(), nil
+}
+
+// rawEmailStats aggregates tracking events into rows shaped like EmailStatsHourly
+func rawEmailStats(db *gorm.DB) *gorm.DB {
+	return db.Table("email_trackings").
+		Select(`emails.team_id,
+			email_trackings.campaign_id,
+			date_trunc('hour', email_trackings.timestamp AT TIME ZONE 'UTC') AT TIME ZONE 'UTC' AS hour,
+			email_trackings.event,
+			COALESCE(email_trackings.device_type, '') AS device_type,
+			COALESCE(email_trackings.country, '') AS country,
+			` + BotEventSQL + ` AS bot,
+			COUNT(*) AS count,
+			COUNT(*) FILTER (WHERE NOT EXISTS (
+				SELECT 1 FROM email_trackings earlier
+				WHERE earlier.email_id = email_trackings.email_id AND earlier.event = email_trackings.event
+					AND earlier.automated = false
+					AND (earlier.timestamp, earlier.id) < (email_trackings.timestamp, email_trackings.id)
+			)) AS first_count,
+			COUNT(*) FILTER (WHERE NOT ` + BotEventSQL + ` AND NOT EXISTS (
+				SELECT 1 FROM email_trackings earlier
+				WHERE earlier.email_id = email_trackings.email_id AND earlier.event = email_trackings.event
+					AND earlier.automated = false AND NOT COALESCE((earlier.metadata->>'bot')::boolean, false)
+					AND (earlier.timestamp, earlier.id) < (email_trackings.timestamp, email_trackings.id)
+			)) AS first_human_count`).
+		Joins("JOIN emails ON emails.id = email_trackings.email_id").
+		Where("email_trackings.automated = false").
+		Group("emails.team_id, email_trackings.campaign_id, hour, email_trackings.event, COALESCE(email_trackings.device_type, ''), COALESCE(email_trackings.country, ''), " + BotEventSQL)
+}
+
+// MaterializeAnalyticsRollups rebuilds the hourly and daily rollups from the last watermark up
+// to the start of the current hour and moves the watermark there. It returns the new watermark.
+func MaterializeAnalyticsRollups(now time.Time, db *gorm.DB) (time.Time, error) {
+	return materializeRollup(analyticsRollupName, now, db.Model(&EmailTracking{}).Select("MIN(timestamp)"), materializeRollupChunk, db)
+}
+
+// materializeRollup rebuilds a rollup chunk by chunk from its watermark, restating the hour
+// before it, up to the start of the current hour, then moves the watermark there. The first
+// run starts at the time selected by first.
+func materializeRollup(name string, now time.Time, first *gorm.DB, chunk func(start, end time.Time, tx *gorm.DB) error, db *gorm.DB) (time.Time, error) {
+	through := now.UTC().Truncate(time.Hour)
+
+	watermark, err := rollupWatermark(name, db)
+	if err != nil {
+		return time.Time{}, err
+	}
+	from := watermark.Add(-rollupRestate)
+	if watermark.IsZero() {
+		var earliest *time.Time
+		if err := first.Scan(&earliest).Error; err != nil {
+			return time.Time{}, err
+		}
+		from = through
+		if earliest != nil {
+			from = earliest.UTC().Truncate(time.Hour)
+		}
+	}
+
+	for start := from; start.Before(through); start = start.Add(rollupChunk) {
+		end := start.Add(rollupChunk)
+		if end.After(through) {
+			end = through
+		}
+		if err := db.Transaction(func(tx *gorm.DB) error {
+			return chunk(start, end, tx)
+		}); err != nil {
+			return time.Time{}, fmt.Errorf("failed to roll up %s to %s: %w", start.Format(time.RFC3339), end.Format(time.RFC3339), err)
+		}
+	}
+
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		var rollup AnalyticsRollup
+		err := tx.Where("name = ?", name).First(&rollup).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return tx.Create(&AnalyticsRollup{Name: name, Through: through}).Error
+		}
+		if err != nil {
+			return err
+		}
+		return tx.Model(&rollup).Update("through", through).Error
+	}); err != nil {
+		return time.Time{}, err
+	}
+	return through, nil
+}
+
+// materializeRollupChunk replaces the hourly rows of [start, end) and the daily rows of the
+// days they fall in
+func materializeRollupChunk(start, end time.Time, tx *gorm.DB) error {
+	var hourly []EmailStatsHourly
+	if err := rawEmailStats(tx).
+		Where("email_trackings.timestamp >= ? AND email_trackings.timestamp < ?", start, end).
+		Scan(&hourly).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("hour >= ? AND hour < ?", start, end).Delete(&EmailStatsHourly{}).Error; err != nil {
+		return err
+	}
+	if len(hourly) > 0 {
+		if err := tx.CreateInBatches(&hourly, 500).Error; err != nil {
+			return err
+		}
+	}
+
+	firstDay, lastDay := start.Truncate(24*time.Hour), end.Add(-time.Nanosecond).Truncate(24*time.Hour)
+	var daily []CampaignStatsDaily
+	if err := tx.Model(&EmailStatsHourly{}).
+		Select(`team_id, campaign_id, date_trunc('day', hour AT TIME ZONE 'UTC') AT TIME ZONE 'UTC' AS day,
+			COALESCE(SUM(count) FILTER (WHERE event = ?), 0) AS opens,
+			COALESCE(SUM(first_count) FILTER (WHERE event = ?), 0) AS unique_opens,
+			COALESCE(SUM(count) FILTER (WHERE event = ?), 0) AS clicks,
+			COALESCE(SUM(first_count) FILTER (WHERE event = ?), 0) AS unique_clicks,
+			COALESCE(SUM(count) FILTER (WHERE event = ?), 0) AS bounces,
+			COALESCE(SUM(count) FILTER (WHERE event = ?), 0) AS complaints,
+			COALESCE(SUM(count) FILTER (WHERE event = ? AND NOT bot), 0) AS human_opens,
+			COALESCE(SUM(first_human_count) FILTER (WHERE event = ?), 0) AS unique_human_opens,
+			COALESCE(SUM(count) FILTER (WHERE event = ? AND NOT bot), 0) AS human_clicks,
+			COALESCE(SUM(first_human_count) FILTER (WHERE event = ?), 0) AS unique_human_clicks`,
+			EmailTrackingEventOpen, EmailTrackingEventOpen, EmailTrackingEventClick, EmailTrackingEventClick,
+			EmailTrackingEventBounce, EmailTrackingEventComplaint,
+			EmailTrackingEventOpen, EmailTrackingEventOpen, EmailTrackingEventClick, EmailTrackingEventClick).
+		Where("campaign_id IS NOT NULL AND hour >= ? AND hour < ?", firstDay, lastDay.Add(24*time.Hour)).
+		Group("team_id, campaign_id, day").
+		Scan(&daily).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("day >= ? AND day <= ?", firstDay, lastDay).Delete(&CampaignStatsDaily{}).Error; err != nil {
+		return err
+	}
+	if len(daily) > 0 {
+		return tx.CreateInBatches(&daily, 500).Error
+	}
+	return nil
+}
+
+// EmailStatsRows returns a subquery of a team's event counts shaped like EmailStatsHourly over
+// the inclusive range [start, end], zero bounds being open. Whole hours before the watermark
+// come from the rollup; the rest, including the current hour, is aggregated from raw tracking.
+// With excludeBots, events bots fetched are left out.
+func EmailStatsRows(teamID string, start, end time.Time, excludeBots bool, db *gorm.DB) (*gorm.DB, error) {
+	watermark, err := GetRollupWatermark(db)
+	if err != nil {
+		return nil, err
+	}
+
+	columns := "campaign_id, hour, event, device_type, country, count, first_count"
+	humans := func(query *gorm.DB) *gorm.DB { return query }
+	if excludeBots {
+		// Without bots, an email's first open or click is the first one no bot fetched
+		columns = "campaign_id, hour, event, device_type, country, count, first_human_count AS first_count"
+		humans = func(query *gorm.DB) *gorm.DB { return query.Where("NOT bot") }
+	}
+	raw := func() *gorm.DB {
+		query := rawEmailStats(db).Where("emails.team_id = ?", teamID)
+		if !end.IsZero() {
+			query = query.Where("email_trackings.timestamp <= ?", end)
+		}
+		return query
+	}
+
+	// The rollup serves the whole hours between the first one starting at start and the watermark
+	rolledStart := start.UTC()
+	if !rolledStart.Truncate(time.Hour).Equal(rolledStart) {
+		rolledStart = rolledStart.Truncate(time.Hour).Add(time.Hour)
+	}
+	rolledEnd := watermark
+	if !end.IsZero() {
+		if last := end.UTC().Add(time.Nanosecond).Truncate(time.Hour); last.Before(rolledEnd) {
+			rolledEnd = last
+		}
+	}
+	if !rolledStart.Before(rolledEnd) {
+		query := raw()
+		if !start.IsZero() {
+			query = query.Where("email_trackings.timestamp >= ?", start)
+		}
+		return db.Table("(?) AS raw", query).Select(columns).Scopes(humans), nil
+	}
+
+	rolled := db.Model(&EmailStatsHourly{}).Select(columns).Scopes(humans).
+		Where("team_id = ? AND hour >= ? AND hour < ? AND is_deleted = false", teamID, rolledStart, rolledEnd)
+
+	// Raw tracking fills in the partial hour before the rollup and everything after it
+	edges := raw().Where("email_trackings.timestamp >= ?", rolledEnd)
+	if start.Before(rolledStart) {
+		edges = raw().Where("(email_trackings.timestamp >= ? AND email_trackings.timestamp < ?) OR email_trackings.timestamp >= ?",
+			start, rolledStart, rolledEnd)
+	}
+
+	return db.Raw("(?) UNION ALL (?)", rolled, db.Table("(?) AS edges", edges).Select(columns).Scopes(humans)), nil
+}
+
+// GetCampaignEventCounts sums a campaign's events tracked up to end, or all of them when end
+// is zero, from the daily rollup for whole days before the watermark and the hourly stats for
+// the rest. With excludeBots, opens and clicks bots fetched are left out.
+func GetCampaignEventCounts(teamID, campaignID string, end time.Time, excludeBots bool, db *gorm.DB) (*CampaignEventCounts, error) {
+	watermark, err := GetRollupWatermark(db)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := &CampaignEventCounts{}
+	dayCut := watermark.Truncate(24 * time.Hour)
+	if !end.IsZero() {
+		if last := end.UTC().Add(time.Nanosecond).Truncate(24 * time.Hour); last.Before(dayCut) {
+			dayCut = last
+		}
+	}
+	if !watermark.IsZero() {
+		engagement := `COALESCE(SUM(opens), 0) AS opens, COALESCE(SUM(unique_opens), 0) AS unique_opens,
+			COALESCE(SUM(clicks), 0) AS clicks, COALESCE(SUM(unique_clicks), 0) AS unique_clicks`
+		if excludeBots {
+			engagement = `COALESCE(SUM(human_opens), 0) AS opens, COALESCE(SUM(unique_human_opens), 0) AS unique_opens,
+				COALESCE(SUM(human_clicks), 0) AS clicks, COALESCE(SUM(unique_human_clicks), 0) AS unique_clicks`
+		}
+		if err := db.Model(&CampaignStatsDaily{}).
+			Select(engagement+`,
+				COALESCE(SUM(bounces), 0) AS bounces, COALESCE(SUM(complaints), 0) AS complaints`).
+			Where("campaign_id = ? AND day < ? AND is_deleted = false", campaignID, dayCut).
+			Scan(counts).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	rows, err := EmailStatsRows(teamID, dayCut, end, excludeBots, db)
+	if err != nil {
+		return nil, err
+	}
+	var rest CampaignEventCounts
+	if err := db.Table("(?) AS stats", rows).
+		Select(`COALESCE(SUM(count) FILTER (WHERE event = ?), 0) AS opens,
+			COALESCE(SUM(first_count) FILTER (WHERE event = ?), 0) AS unique_opens,
+			COALESCE(SUM(count) FILTER (WHERE event = ?), 0) AS clicks,
+			COALESCE(SUM(first_count) FILTER (WHERE event = ?), 0) AS unique_clicks,
+			COALESCE(SUM(count) FILTER (WHERE event = ?), 0) AS bounces,
+			COALESCE(SUM(count) FILTER (WHERE event = ?), 0) AS complaints`,
+			EmailTrackingEventOpen, EmailTrackingEventOpen, EmailTrackingEventClick, EmailTrackingEventClick,
+			EmailTrackingEventBounce, EmailTrackingEventComplaint).
+		Where("campaign_id = ?", campaignID).
+		Scan(&rest).Error; err != nil {
+		return nil, err
+	}
+
+	counts.Opens += rest.Opens
+	counts.UniqueOpens += rest.UniqueOpens
+	counts.Clicks += rest.Clicks
+	counts.UniqueClicks += rest.UniqueClicks
+	counts.Bounces += rest.Bounces
+	counts.Complaints += rest.Complaints
+	return counts, nil
+}
@@ -0,0 +1,160 @@
+package models
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// DefaultAPIKeyLifetime is how long keys are valid when they aren't given an expiry
+	DefaultAPIKeyLifetime = 90 * 24 * time.Hour
+	// DefaultAPIKeyRotationOverlap is how long a rotated key keeps working next to its replacement
+	DefaultAPIKeyRotationOverlap = 24 * time.Hour
+	// MaxAPIKeyRotationOverlap caps how long a rotated key keeps working
+	MaxAPIKeyRotationOverlap = 30 * 24 * time.Hour
+)
+
+// ErrAPIKeyRotated is returned when rotating a key that was replaced already
+var ErrAPIKeyRotated = errors.New("the api key was rotated already")
+
+// Scopes returns the permissions of a key loaded with its resource permissions, e.g.
+// emails:send or campaigns:read
+func (a *APIKey) Scopes() []string {
+	scopes := make([]string, 0, len(a.Permissions))
+	for _, permission := range a.Permissions {
+		if permission.ResourcePermission != nil {
+			scopes = append(scopes, permission.ResourcePermission.Scope)
+		}
+	}
+	return scopes
+}
+
+// GetActiveAPIKey returns the key with a secret, loaded with its permissions, unless it was
+// deleted
+func GetActiveAPIKey(secret string, db *gorm.DB) (*APIKey, error) {
+	apiKey := &APIKey{}
+	if err := db.Where("key_hash = ? AND is_deleted = false", HashAPIKey(secret)).
+		Preload("Permissions.ResourcePermission").
+		First(apiKey).Error; err != nil {
+		return nil, err
+	}
+	return apiKey, nil
+}
+
+// ExpandPermissions turns permissions as roles write them, with * and write, into the
+// resource:action pairs API keys are granted, sorted
+func ExpandPermissions(permissions []string) []string {
+	var expanded []string
+	for resource, actions := range PermissionResources() {
+		for _, action := range actions {
+			if HasPermission(permissions, resource, action) {
+				expanded = append(expanded, resource+":"+action)
+			}
+		}
+	}
+	slices.Sort(expanded)
+	return expanded
+}
+
+// SetAPIKeyPermissions replaces a key's permissions with resource:action pairs
+func SetAPIKeyPermissions(keyID string, scopes []string, db *gorm.DB) error {
+	var permissions []ResourcePermission
+	if len(scopes) > 0 {
+		if err := db.Where("scope IN ?", scopes).Find(&permissions).Error; err != nil {
+			return err
+		}
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("key_id = ?", keyID).Delete(&APIKeyPermission{}).Error; err != nil {
+			return err
+		}
+		if len(permissions) == 0 {
+			return nil
+		}
+		granted := make([]APIKeyPermission, len(permissions))
+		for i, permission := range permissions {
+			granted[i] = APIKeyPermission{KeyID: keyID, ResourcePermissionID: permission.ID}
+		}
+		return tx.Create(&granted).Error
+	})
+}
+
+// RotateAPIKey replaces a key with a new secret that has the same name, permissions and
+// lifetime. The old key keeps working for the overlap, or until it expires if that's sooner,
+// so clients can switch over without downtime. It returns the new key with its secret.
+func RotateAPIKey(old *APIKey, overlap time.Duration, db *gorm.DB) (*APIKey, string, error) {
+	if old.RevokedAt != nil {
+		return nil, "", ErrAPIKeyRevoked
+	}
+	if old.ReplacedByID != "" {
+		return nil, "", ErrAPIKeyRotated
+	}
+	now := time.Now()
+	lifetime := old.ExpiresAt.Sub(old.CreatedAt)
+	if lifetime <= 0 {
+		lifetime = DefaultAPIKeyLifetime
+	}
+
+	next := &APIKey{
+		Name:          old.Name,
+		TeamID:        old.TeamID,
+		ExpiresAt:     now.Add(lifetime),
+		RotatedFromID: old.ID,
+	}
+	secret := next.NewSecret()
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(next).Error; err != nil {
+			return err
+		}
+		var permissions []APIKeyPermission
+		if err := tx.Where("key_id = ?", old.ID).Find(&permissions).Error; err != nil {
+			return err
+		}
+		if len(permissions) > 0 {
+			granted := make([]APIKeyPermission, len(permissions))
+			for i, permission := range permissions {
+				granted[i] = APIKeyPermission{KeyID: next.ID, ResourcePermissionID: permission.ResourcePermissionID}
+			}
+			if err := tx.Create(&granted).Error; err != nil {
+				return err
+			}
+		}
+
+		expiresAt := old.ExpiresAt
+		if until := now.Add(overlap); until.Before(expiresAt) {
+			expiresAt = until
+		}
+		// Of two rotations of a key at once, the second finds it replaced
+		result := tx.Model(&APIKey{}).Where("id = ? AND replaced_by_id IS NULL", old.ID).
+			UpdateColumns(map[string]interface{}{"replaced_by_id": next.ID, "expires_at": expiresAt})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrAPIKeyRotated
+		}
+		old.ExpiresAt = expiresAt
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	old.ReplacedByID = next.ID
+	return next, secret, nil
+}
+
+// PermissionsCover reports whether one set of permissions includes every resource:action pair
+// of the other, so no one hands out more than they hold
+func PermissionsCover(granted, scopes []string) bool {
+	for _, scope := range scopes {
+		resource, action, _ := strings.Cut(scope, ":")
+		if !HasPermission(granted, resource, action) {
+			return false
+		}
+	}
+	return true
+}
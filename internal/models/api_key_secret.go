@@ -0,0 +1,62 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// APIKeyPrefixLength is how much of a secret is kept to tell keys apart
+const APIKeyPrefixLength = 12
+
+// ErrAPIKeyRevoked is returned when revoking or rotating a key that was revoked already
+var ErrAPIKeyRevoked = errors.New("the api key was revoked")
+
+// HashAPIKey hashes an API key's secret the way it is stored
+func HashAPIKey(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewSecret gives the key a new secret and returns it; only its hash and prefix are kept, so
+// it can't be shown again
+func (a *APIKey) NewSecret() string {
+	secret := "kori_" + strings.ReplaceAll(uuid.New().String(), "-", "")
+	a.KeyHash = HashAPIKey(secret)
+	a.Prefix = secret[:APIKeyPrefixLength]
+	return secret
+}
+
+// RevokeAPIKey stops a key working straight away; it's kept, with its usage, for the record
+func RevokeAPIKey(apiKey *APIKey, db *gorm.DB) error {
+	now := time.Now()
+	result := db.Model(&APIKey{}).Where("id = ? AND revoked_at IS NULL", apiKey.ID).UpdateColumn("revoked_at", now)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrAPIKeyRevoked
+	}
+	apiKey.RevokedAt = &now
+	return nil
+}
+
+// MigrateAPIKeySecrets hashes the secrets of keys made when they were stored in plaintext, then
+// drops the plaintext column
+func MigrateAPIKeySecrets(db *gorm.DB) error {
+	if !db.Migrator().HasColumn(&APIKey{}, "key") {
+		return nil
+	}
+	if err := db.Exec(`UPDATE api_keys
+		SET key_hash = encode(sha256(convert_to(key, 'UTF8')), 'hex'), prefix = LEFT(key, ?)
+		WHERE key_hash = '' AND key IS NOT NULL`, APIKeyPrefixLength).Error; err != nil {
+		return fmt.Errorf("failed to hash api keys: %w", err)
+	}
+	return db.Migrator().DropColumn(&APIKey{}, "key")
+}
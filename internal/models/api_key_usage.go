@@ -0,0 +1,289 @@
+package models
+
+import (
+	"math"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// apiKeyUsageRollupName names the watermark of the hourly API key usage rollup
+const apiKeyUsageRollupName = "api_key_usage"
+
+const (
+	// apiKeyAnomalyBaseline is how much history an hour of usage is compared against
+	apiKeyAnomalyBaseline = 7 * 24 * time.Hour
+	// apiKeyAnomalyMinHistory leaves out keys too new to have a usual usage
+	apiKeyAnomalyMinHistory = 24 * time.Hour
+	// An hour is a spike when it's over the baseline mean by this many standard deviations,
+	// this many times the mean, and at least this many requests
+	apiKeyAnomalyDeviations  = 4
+	apiKeyAnomalyMeanFactor  = 3
+	apiKeyAnomalyMinRequests = 100
+)
+
+// apiKeyTopIPs is how many client addresses a usage summary lists
+const apiKeyTopIPs = 10
+
+// APIKeyUsageHourly counts an API key's requests per hour, route, method and client address
+type APIKeyUsageHourly struct {
+	Base
+	APIKeyID  string    `gorm:"type:uuid;not null;index:idx_api_key_usage_hourly_key_hour" json:"apiKeyId"`
+	TeamID    string    `gorm:"type:uuid;not null;index" json:"teamId"`
+	Hour      time.Time `gorm:"not null;index:idx_api_key_usage_hourly_key_hour" json:"hour"`
+	Route     string    `gorm:"not null" json:"route"`
+	Method    string    `gorm:"not null" json:"method"`
+	IPAddress string    `gorm:"not null;default:''" json:"ipAddress"`
+	Requests  int64     `gorm:"not null" json:"requests"`
+	Errors    int64     `gorm:"not null" json:"errors"`
+}
+
+func (APIKeyUsageHourly) TableName() string {
+	return "api_key_usage_hourly"
+}
+
+// APIKeyEndpointUsage is the usage of one endpoint by an API key
+type APIKeyEndpointUsage struct {
+	Route     string  `json:"route"`
+	Method    string  `json:"method"`
+	Requests  int64   `json:"requests"`
+	Errors    int64   `json:"errors"`
+	ErrorRate float64 `json:"errorRate"` // percentage of requests that failed
+}
+
+// APIKeyDailyUsage is the usage of one endpoint by an API key on a UTC day
+type APIKeyDailyUsage struct {
+	Day      time.Time `json:"day"`
+	Route    string    `json:"route"`
+	Method   string    `json:"method"`
+	Requests int64     `json:"requests"`
+	Errors   int64     `json:"errors"`
+}
+
+// APIKeyIPUsage is the usage of an API key from one client address
+type APIKeyIPUsage struct {
+	IPAddress string `json:"ipAddress"`
+	Requests  int64  `json:"requests"`
+	Errors    int64  `json:"errors"`
+}
+
+// APIKeyUsageSummary is what an API key was used for since Start
+type APIKeyUsageSummary struct {
+	APIKeyID  string                `json:"apiKeyId"`
+	Start     time.Time             `json:"start"`
+	Requests  int64                 `json:"requests"`
+	Errors    int64                 `json:"errors"`
+	ErrorRate float64               `json:"errorRate"`
+	Endpoints []APIKeyEndpointUsage `json:"endpoints"` // busiest first
+	Days      []APIKeyDailyUsage    `json:"days"`      // per endpoint, oldest day first
+	TopIPs    []APIKeyIPUsage       `json:"topIps"`
+}
+
+// APIKeyUsageAnomaly is an hour in which an API key was used far more than usual
+type APIKeyUsageAnomaly struct {
+	APIKeyID   string    `json:"apiKeyId"`
+	APIKeyName string    `json:"apiKeyName"`
+	TeamID     string    `json:"teamId"`
+	Hour       time.Time `json:"hour"`
+	Requests   int64     `json:"requests"`
+	Errors     int64     `json:"errors"`
+	Mean       float64   `json:"mean"`   // requests per hour over the baseline
+	StdDev     float64   `json:"stdDev"` // of the requests per hour over the baseline
+	Threshold  float64   `json:"threshold"`
+}
+
+// rawAPIKeyUsage aggregates recorded requests into rows shaped like APIKeyUsageHourly. Requests
+// recorded before routes were kept are grouped by their path.
+func rawAPIKeyUsage(db *gorm.DB) *gorm.DB {
+	return db.Table("api_key_usages").
+		Select(`api_key_usages.api_key_id,
+			api_keys.team_id,
+			date_trunc('hour', api_key_usages.timestamp AT TIME ZONE 'UTC') AT TIME ZONE 'UTC' AS hour,
+			COALESCE(NULLIF(api_key_usages.route, ''), api_key_usages.endpoint) AS route,
+			api_key_usages.method,
+			COALESCE(api_key_usages.ip_address, '') AS ip_address,
+			COUNT(*) AS requests,
+			COUNT(*) FILTER (WHERE NOT api_key_usages.success) AS errors`).
+		Joins("JOIN api_keys ON api_keys.id = api_key_usages.api_key_id").
+		Group(`api_key_usages.api_key_id, api_keys.team_id, hour,
+			COALESCE(NULLIF(api_key_usages.route, ''), api_key_usages.endpoint),
+			api_key_usages.method, COALESCE(api_key_usages.ip_address, '')`)
+}
+
+// MaterializeAPIKeyUsageRollup rebuilds the hourly API key usage from the last watermark up to
+// the start of the current hour and moves the watermark there. It returns the new watermark.
+func MaterializeAPIKeyUsageRollup(now time.Time, db *gorm.DB) (time.Time, error) {
+	return materializeRollup(apiKeyUsageRollupName, now, db.Model(&APIKeyUsage{}).Select("MIN(timestamp)"),
+		func(start, end time.Time, tx *gorm.DB) error {
+			var hourly []APIKeyUsageHourly
+			if err := rawAPIKeyUsage(tx).
+				Where("api_key_usages.timestamp >= ? AND api_key_usages.timestamp < ?", start, end).
+				Scan(&hourly).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("hour >= ? AND hour < ?", start, end).Delete(&APIKeyUsageHourly{}).Error; err != nil {
+				return err
+			}
+			if len(hourly) > 0 {
+				return tx.CreateInBatches(&hourly, 500).Error
+			}
+			return nil
+		}, db)
+}
+
+// apiKeyUsageRows returns a subquery of an API key's usage since start, an hour boundary, shaped
+// like APIKeyUsageHourly. Hours before the watermark come from the rollup and the rest from the
+// recorded requests.
+func apiKeyUsageRows(apiKeyID string, start time.Time, db *gorm.DB) (*gorm.DB, error) {
+	watermark, err := rollupWatermark(apiKeyUsageRollupName, db)
+	if err != nil {
+		return nil, err
+	}
+
+	columns := "hour, route, method, ip_address, requests, errors"
+	raw := rawAPIKeyUsage(db).Where("api_key_usages.api_key_id = ?", apiKeyID)
+	if !start.Before(watermark) {
+		return db.Table("(?) AS raw", raw.Where("api_key_usages.timestamp >= ?", start)).Select(columns), nil
+	}
+
+	rolled := db.Model(&APIKeyUsageHourly{}).Select(columns).
+		Where("api_key_id = ? AND hour >= ? AND hour < ? AND is_deleted = false", apiKeyID, start, watermark)
+	rest := db.Table("(?) AS rest", raw.Where("api_key_usages.timestamp >= ?", watermark)).Select(columns)
+	return db.Raw("(?) UNION ALL (?)", rolled, rest), nil
+}
+
+// GetAPIKeyUsageSummary sums an API key's requests and errors since start, an hour boundary,
+// per endpoint, per endpoint and day, and per client address
+func GetAPIKeyUsageSummary(apiKeyID string, start time.Time, db *gorm.DB) (*APIKeyUsageSummary, error) {
+	rows, err := apiKeyUsageRows(apiKeyID, start, db)
+	if err != nil {
+		return nil, err
+	}
+	usage := func() *gorm.DB {
+		return db.Table("(?) AS usage", rows)
+	}
+
+	summary := &APIKeyUsageSummary{
+		APIKeyID:  apiKeyID,
+		Start:     start,
+		Endpoints: []APIKeyEndpointUsage{},
+		Days:      []APIKeyDailyUsage{},
+		TopIPs:    []APIKeyIPUsage{},
+	}
+	if err := usage().
+		Select("COALESCE(SUM(requests), 0) AS requests, COALESCE(SUM(errors), 0) AS errors").
+		Scan(summary).Error; err != nil {
+		return nil, err
+	}
+	summary.ErrorRate = errorRate(summary.Errors, summary.Requests)
+
+	if err := usage().
+		Select("route, method, SUM(requests) AS requests, SUM(errors) AS errors").
+		Group("route, method").
+		Order("requests DESC, route, method").
+		Scan(&summary.Endpoints).Error; err != nil {
+		return nil, err
+	}
+	for i := range summary.Endpoints {
+		summary.Endpoints[i].ErrorRate = errorRate(summary.Endpoints[i].Errors, summary.Endpoints[i].Requests)
+	}
+
+	if err := usage().
+		Select(`date_trunc('day', hour AT TIME ZONE 'UTC') AT TIME ZONE 'UTC' AS day, route, method,
+			SUM(requests) AS requests, SUM(errors) AS errors`).
+		Group("day, route, method").
+		Order("day, requests DESC, route, method").
+		Scan(&summary.Days).Error; err != nil {
+		return nil, err
+	}
+
+	if err := usage().
+		Select("ip_address, SUM(requests) AS requests, SUM(errors) AS errors").
+		Where("ip_address <> ''").
+		Group("ip_address").
+		Order("requests DESC, ip_address").
+		Limit(apiKeyTopIPs).
+		Scan(&summary.TopIPs).Error; err != nil {
+		return nil, err
+	}
+
+	return summary, nil
+}
+
+// errorRate is the percentage of requests that are errors
+func errorRate(errors, requests int64) float64 {
+	if requests == 0 {
+		return 0
+	}
+	return float64(errors) / float64(requests) * 100
+}
+
+// DetectAPIKeyUsageAnomalies compares each API key's requests in the rolled up hour starting at
+// hour with its hourly requests over the week before, hours without requests counting as zero
+func DetectAPIKeyUsageAnomalies(hour time.Time, db *gorm.DB) ([]APIKeyUsageAnomaly, error) {
+	hour = hour.UTC()
+	from := hour.Add(-apiKeyAnomalyBaseline)
+
+	var keys []struct {
+		APIKeyID         string
+		APIKeyName       string
+		TeamID           string
+		CreatedAt        time.Time
+		Requests         int64
+		Errors           int64
+		BaselineRequests float64
+		BaselineSquares  float64
+	}
+	if err := db.Raw(`SELECT latest.api_key_id, api_keys.name AS api_key_name, latest.team_id, api_keys.created_at,
+			latest.requests, latest.errors,
+			COALESCE(SUM(baseline.requests), 0) AS baseline_requests,
+			COALESCE(SUM(baseline.requests * baseline.requests), 0) AS baseline_squares
+		FROM (
+			SELECT api_key_id, team_id, SUM(requests) AS requests, SUM(errors) AS errors
+			FROM api_key_usage_hourly WHERE hour = @hour GROUP BY api_key_id, team_id
+		) latest
+		JOIN api_keys ON api_keys.id = latest.api_key_id
+		LEFT JOIN (
+			SELECT api_key_id, hour, SUM(requests)::float8 AS requests
+			FROM api_key_usage_hourly WHERE hour >= @from AND hour < @hour GROUP BY api_key_id, hour
+		) baseline ON baseline.api_key_id = latest.api_key_id
+		WHERE latest.requests >= @min
+		GROUP BY latest.api_key_id, api_keys.name, latest.team_id, api_keys.created_at, latest.requests, latest.errors`,
+		map[string]any{"hour": hour, "from": from, "min": apiKeyAnomalyMinRequests}).
+		Scan(&keys).Error; err != nil {
+		return nil, err
+	}
+
+	var anomalies []APIKeyUsageAnomaly
+	for _, key := range keys {
+		// The baseline only covers the hours the key existed for
+		baselineStart := from
+		if created := key.CreatedAt.UTC().Truncate(time.Hour); created.After(baselineStart) {
+			baselineStart = created
+		}
+		history := hour.Sub(baselineStart)
+		if history < apiKeyAnomalyMinHistory {
+			continue
+		}
+
+		hours := history.Hours()
+		mean := key.BaselineRequests / hours
+		stdDev := math.Sqrt(math.Max(0, key.BaselineSquares/hours-mean*mean))
+		threshold := math.Max(math.Max(mean+apiKeyAnomalyDeviations*stdDev, mean*apiKeyAnomalyMeanFactor), apiKeyAnomalyMinRequests)
+		if float64(key.Requests) <= threshold {
+			continue
+		}
+		anomalies = append(anomalies, APIKeyUsageAnomaly{
+			APIKeyID:   key.APIKeyID,
+			APIKeyName: key.APIKeyName,
+			TeamID:     key.TeamID,
+			Hour:       hour,
+			Requests:   key.Requests,
+			Errors:     key.Errors,
+			Mean:       mean,
+			StdDev:     stdDev,
+			Threshold:  threshold,
+		})
+	}
+	return anomalies, nil
+}
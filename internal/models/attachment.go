@@ -0,0 +1,60 @@
+package models
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// MaxAttachmentsPerEmail is how many files can be attached to one email
+	MaxAttachmentsPerEmail = 10
+	// MaxAttachmentsSize is the total size of the files attached to one email. Encoding
+	// grows it by a third, which keeps the message under the common 25MB provider limit.
+	MaxAttachmentsSize int64 = 15 << 20
+)
+
+// EmailAttachment is an uploaded file sent along with an email
+type EmailAttachment struct {
+	Base
+	EmailID string `gorm:"type:uuid;not null;index" json:"emailId" validate:"required,uuid"`
+	FileID  string `gorm:"type:uuid;not null" json:"fileId" validate:"required,uuid"`
+	File    *File  `json:"file,omitempty"`
+	TeamID  string `gorm:"type:uuid;not null" json:"teamId" validate:"required,uuid"`
+}
+
+// GetAttachmentFiles loads the team's files to attach to an email and checks they fit the limits
+func GetAttachmentFiles(teamID string, fileIDs []string, db *gorm.DB) ([]File, error) {
+	if len(fileIDs) == 0 {
+		return nil, nil
+	}
+	if len(fileIDs) > MaxAttachmentsPerEmail {
+		return nil, &ValidationError{Message: fmt.Sprintf("at most %d attachments can be sent with an email", MaxAttachmentsPerEmail)}
+	}
+
+	var files []File
+	if err := db.Where("id IN ? AND team_id = ? AND is_deleted = false", fileIDs, teamID).Find(&files).Error; err != nil {
+		return nil, err
+	}
+
+	byID := make(map[string]File, len(files))
+	for _, file := range files {
+		byID[file.ID] = file
+	}
+
+	var total int64
+	ordered := make([]File, 0, len(fileIDs))
+	for _, id := range fileIDs {
+		file, ok := byID[id]
+		if !ok {
+			return nil, &ValidationError{Message: fmt.Sprintf("attachment %s not found", id)}
+		}
+		total += file.Size
+		ordered = append(ordered, file)
+	}
+	if total > MaxAttachmentsSize {
+		return nil, &ValidationError{Message: fmt.Sprintf("attachments are %d bytes, the limit is %d", total, MaxAttachmentsSize)}
+	}
+
+	return ordered, nil
+}
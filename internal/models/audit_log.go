@@ -0,0 +1,230 @@
+package models
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"gorm.io/datatypes"
+)
+
+type AuditAction string
+
+const (
+	AuditActionCreate AuditAction = "create"
+	AuditActionUpdate AuditAction = "update"
+	AuditActionDelete AuditAction = "delete"
+)
+
+// maxAuditValueSize caps a value kept in a diff; bigger ones, e.g. html bodies, keep their size
+const maxAuditValueSize = 1024
+
+var (
+	// auditIgnoredFields change on every write and say nothing about it
+	auditIgnoredFields = map[string]bool{"createdAt": true, "updatedAt": true}
+	auditEmptyValues   = map[string]bool{`""`: true, "false": true, "0": true, "null": true, "[]": true, "{}": true, `"0001-01-01T00:00:00Z"`: true}
+)
+
+// AuditLog records a mutating API call: who made it, with which user or API key and from where,
+// and what it changed
+type AuditLog struct {
+	Base
+	TeamID     string         `gorm:"type:uuid;not null;index" json:"teamId"`
+	UserID     string         `gorm:"type:uuid;default:NULL;index" json:"userId,omitempty"`
+	APIKeyID   string         `gorm:"type:uuid;default:NULL;index" json:"apiKeyId,omitempty"`
+	ActorEmail string         `json:"actorEmail,omitempty"`
+	Action     AuditAction    `gorm:"not null;index" json:"action"`
+	Method     string         `gorm:"not null" json:"method"`
+	Route      string         `json:"route"` // the route pattern, e.g. /api/v1/campaigns/:id
+	Path       string         `json:"path"`
+	Resource   string         `gorm:"index" json:"resource"` // table of the first change, or the route's resource
+	ResourceID string         `gorm:"index" json:"resourceId,omitempty"`
+	Changes    datatypes.JSON `gorm:"type:jsonb" json:"changes,omitempty"` // []AuditChange
+	Status     int            `json:"status"`
+	IP         string         `json:"ip"`
+	UserAgent  string         `json:"userAgent"`
+	RequestID  string         `json:"requestId,omitempty"`
+}
+
+// AuditChange is what a request changed of one row
+type AuditChange struct {
+	Resource   string                      `json:"resource"`
+	ResourceID string                      `json:"resourceId"`
+	Action     AuditAction                 `json:"action"`
+	Fields     map[string]AuditFieldChange `json:"fields,omitempty"`
+}
+
+// AuditFieldChange is a field's value before and after a change, as JSON
+type AuditFieldChange struct {
+	Old json.RawMessage `json:"old,omitempty"`
+	New json.RawMessage `json:"new,omitempty"`
+}
+
+// AuditTrail collects the changes made while handling a request
+type AuditTrail struct {
+	mu      sync.Mutex
+	changes []AuditChange
+}
+
+type auditTrailKey struct{}
+
+// WithAuditTrail starts collecting the changes made under ctx
+func WithAuditTrail(ctx context.Context) (context.Context, *AuditTrail) {
+	trail := &AuditTrail{}
+	return context.WithValue(ctx, auditTrailKey{}, trail), trail
+}
+
+// IsAudited reports whether changes made under ctx are recorded, so callers only load the rows
+// they diff when they are
+func IsAudited(ctx context.Context) bool {
+	_, ok := ctx.Value(auditTrailKey{}).(*AuditTrail)
+	return ok
+}
+
+// Changes returns the changes recorded so far
+func (t *AuditTrail) Changes() []AuditChange {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]AuditChange(nil), t.changes...)
+}
+
+// RecordAuditChange adds a change to the audit trail of ctx, diffing the JSON of the row before
+// and after it. before is nil for creates, after for deletes. Outside of an audited request, as in
+// background tasks, nothing is recorded.
+func RecordAuditChange(ctx context.Context, action AuditAction, resource, resourceID string, before, after interface{}) {
+	trail, ok := ctx.Value(auditTrailKey{}).(*AuditTrail)
+	if !ok {
+		return
+	}
+	change := AuditChange{Resource: resource, ResourceID: resourceID, Action: action, Fields: diffAuditFields(before, after)}
+
+	trail.mu.Lock()
+	defer trail.mu.Unlock()
+	trail.changes = append(trail.changes, change)
+}
+
+// diffAuditFields compares the JSON fields of two values. Fields named like credentials or tagged
+// audit:"redact", such as those stored encrypted, keep only whether they changed.
+func diffAuditFields(before, after interface{}) map[string]AuditFieldChange {
+	previous, next := auditFields(before), auditFields(after)
+	redacted := map[string]bool{}
+	for _, value := range []interface{}{before, after} {
+		for name := range redactedAuditFields(value) {
+			redacted[name] = true
+		}
+	}
+	fields := map[string]AuditFieldChange{}
+	for name, value := range next {
+		if auditIgnoredFields[name] || bytes.Equal(previous[name], value) {
+			continue
+		}
+		// A create lists the fields it set, not every empty one
+		if previous == nil && auditEmptyValues[string(value)] {
+			continue
+		}
+		fields[name] = auditFieldChange(name, redacted[name], previous[name], value)
+	}
+	// Fields an update emptied, which omitempty leaves out; a delete's aren't listed
+	for name, value := range previous {
+		if _, ok := next[name]; ok || auditIgnoredFields[name] || next == nil {
+			continue
+		}
+		fields[name] = auditFieldChange(name, redacted[name], value, nil)
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+	return fields
+}
+
+func auditFields(value interface{}) map[string]json.RawMessage {
+	if value == nil {
+		return nil
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(encoded, &fields); err != nil {
+		return nil
+	}
+	return fields
+}
+
+// redactedAuditTypes caches the JSON names of the fields tagged audit:"redact" by type
+var redactedAuditTypes sync.Map
+
+// redactedAuditFields returns the JSON names of the fields of value tagged audit:"redact",
+// including those of embedded structs
+func redactedAuditFields(value interface{}) map[string]bool {
+	t := reflect.TypeOf(value)
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil
+	}
+	if names, ok := redactedAuditTypes.Load(t); ok {
+		return names.(map[string]bool)
+	}
+
+	names := map[string]bool{}
+	var collect func(t reflect.Type)
+	collect = func(t reflect.Type) {
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "-" {
+				continue
+			}
+			if field.Anonymous && name == "" {
+				embedded := field.Type
+				if embedded.Kind() == reflect.Pointer {
+					embedded = embedded.Elem()
+				}
+				if embedded.Kind() == reflect.Struct {
+					collect(embedded)
+					continue
+				}
+			}
+			if field.Tag.Get("audit") != "redact" {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			names[name] = true
+		}
+	}
+	collect(t)
+	redactedAuditTypes.Store(t, names)
+	return names
+}
+
+func auditFieldChange(name string, redact bool, previous, next json.RawMessage) AuditFieldChange {
+	lower := strings.ToLower(name)
+	if redact || strings.Contains(lower, "password") || strings.Contains(lower, "secret") || strings.Contains(lower, "token") || lower == "key" {
+		redacted := json.RawMessage(`"[redacted]"`)
+		change := AuditFieldChange{}
+		if previous != nil {
+			change.Old = redacted
+		}
+		if next != nil {
+			change.New = redacted
+		}
+		return change
+	}
+	return AuditFieldChange{Old: truncateAuditValue(previous), New: truncateAuditValue(next)}
+}
+
+func truncateAuditValue(value json.RawMessage) json.RawMessage {
+	if len(value) <= maxAuditValueSize {
+		return value
+	}
+	return json.RawMessage(fmt.Sprintf(`"[%d bytes]"`, len(value)))
+}
@@ -13,6 +13,8 @@ type User struct {
 	FirstName        string           `json:"firstName"`
 	LastName         string           `json:"lastName"`
 	Role             UserRole         `gorm:"not null;default:'member'" json:"role"`
+	RoleID           string           `gorm:"type:uuid;default:NULL;index" json:"roleId,omitempty"` // a custom role replacing the permissions of Role
+	CustomRole       *Role            `gorm:"foreignKey:RoleID" json:"customRole,omitempty"`
 	TeamID           string           `gorm:"type:uuid;not null" json:"teamId"`
 	Team             *Team            `json:"team,omitempty"`
 	Permissions      []UserPermission `gorm:"foreignKey:UserID" json:"permissions,omitempty"`
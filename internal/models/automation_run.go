@@ -0,0 +1,342 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// AutomationRunStatus is where a contact is in an automation
+type AutomationRunStatus string
+
+const (
+	AutomationRunStatusActive    AutomationRunStatus = "ACTIVE"    // a step is queued
+	AutomationRunStatusWaiting   AutomationRunStatus = "WAITING"   // held by a WAIT node until NextRunAt
+	AutomationRunStatusCompleted AutomationRunStatus = "COMPLETED" // walked off the end of the graph or hit EXIT
+	AutomationRunStatusExited    AutomationRunStatus = "EXITED"    // the automation was turned off or the contact left
+	AutomationRunStatusFailed    AutomationRunStatus = "FAILED"
+	AutomationRunStatusOptedOut  AutomationRunStatus = "OPTED_OUT" // the contact opted out of this automation only
+)
+
+// MaxAutomationSteps stops runs caught in a loop of nodes that never wait
+const MaxAutomationSteps = 500
+
+// AutomationRun is one contact's way through an automation's node graph
+type AutomationRun struct {
+	Base
+	AutomationID  string              `gorm:"type:uuid;not null;uniqueIndex:idx_automation_runs_contact" json:"automationId"`
+	Automation    *Automation         `json:"automation,omitempty"`
+	ContactID     string              `gorm:"type:uuid;not null;uniqueIndex:idx_automation_runs_contact" json:"contactId"`
+	Contact       *Contact            `json:"contact,omitempty"`
+	TeamID        string              `gorm:"type:uuid;not null;index" json:"teamId"`
+	Status        AutomationRunStatus `gorm:"not null;default:'ACTIVE'" json:"status"`
+	CurrentNodeID string              `gorm:"type:uuid;default:NULL" json:"currentNodeId"`
+	NextRunAt     *time.Time          `json:"nextRunAt,omitempty"`
+	Steps         int                 `gorm:"not null;default:0" json:"steps"`
+	CompletedAt   time.Time           `gorm:"default:NULL" json:"completedAt"`
+	Error         string              `json:"error,omitempty"`
+	OptedOutAt    *time.Time          `json:"optedOutAt,omitempty"`
+	OptOutEmailID string              `gorm:"type:uuid;default:NULL" json:"optOutEmailId,omitempty"` // the email whose opt-out link was followed
+	PausedUntil   *time.Time          `json:"pausedUntil,omitempty"`                                 // steps are put off until then, e.g. while the contact is out of office
+}
+
+// AutomationRunStep records a node executed for a run
+type AutomationRunStep struct {
+	Base
+	RunID    string   `gorm:"type:uuid;not null;index" json:"runId"`
+	NodeID   string   `gorm:"type:uuid;not null" json:"nodeId"`
+	NodeType NodeType `gorm:"not null" json:"nodeType"`
+	Result   string   `json:"result"` // e.g. the branch a condition took or the email queued
+	Error    string   `json:"error,omitempty"`
+}
+
+// StartNodeData configures how contacts enter an automation
+type StartNodeData struct {
+	ListID string `json:"listId"` // contacts added to this list are enrolled automatically
+}
+
+// EmailNodeData is the email an EMAIL node sends
+type EmailNodeData struct {
+	TemplateID       string   `json:"templateId"`
+	Subject          string   `json:"subject"` // overrides the template's subject
+	FromName         string   `json:"fromName"`
+	SMTPConfigID     string   `json:"smtpConfigId"`     // defaults to the team's default config
+	SenderPersonaIDs []string `json:"senderPersonaIds"` // sent from, rotated by contact when there are several
+}
+
+// WaitNodeData is how long a WAIT node holds the contact
+type WaitNodeData struct {
+	Minutes int `json:"minutes"`
+	Hours   int `json:"hours"`
+	Days    int `json:"days"`
+}
+
+// Duration is the total wait
+func (d WaitNodeData) Duration() time.Duration {
+	return time.Duration(d.Minutes)*time.Minute + time.Duration(d.Hours)*time.Hour + time.Duration(d.Days)*24*time.Hour
+}
+
+// ConditionNodeData is what a CONDITION node checks: a saved segment or an inline condition tree.
+// The contact follows the edge labelled "yes" when it matches and "no" otherwise.
+type ConditionNodeData struct {
+	SegmentID  string            `json:"segmentId"`
+	Conditions *SegmentCondition `json:"conditions"`
+}
+
+// ListNodeData is the list an ADD_TO_LIST node copies the contact into
+type ListNodeData struct {
+	ListID string `json:"listId"`
+}
+
+// TagNodeData is the tag a TAG node adds or removes
+type TagNodeData struct {
+	Tag    string `json:"tag"`
+	Remove bool   `json:"remove"`
+}
+
+// ParseData decodes the node's data into v
+func (n *AutomationNode) ParseData(v interface{}) error {
+	if len(n.Data) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(n.Data, v); err != nil {
+		return fmt.Errorf("invalid %s node data: %w", n.Type, err)
+	}
+	return nil
+}
+
+// AutomationGraph indexes an automation's nodes and edges for walking
+type AutomationGraph struct {
+	nodes map[string]*AutomationNode
+	edges map[string][]AutomationNodeEdge
+	start *AutomationNode
+}
+
+// NewAutomationGraph builds the graph of an automation loaded with its nodes and edges
+func NewAutomationGraph(automation *Automation) (*AutomationGraph, error) {
+	graph := &AutomationGraph{
+		nodes: make(map[string]*AutomationNode, len(automation.Nodes)),
+		edges: make(map[string][]AutomationNodeEdge),
+	}
+	for i := range automation.Nodes {
+		node := &automation.Nodes[i]
+		graph.nodes[node.ID] = node
+		if node.Type == NodeTypeStart {
+			if graph.start != nil {
+				return nil, errors.New("automation has more than one START node")
+			}
+			graph.start = node
+		}
+	}
+	for _, edge := range automation.Edges {
+		graph.edges[edge.SourceID] = append(graph.edges[edge.SourceID], edge)
+	}
+	if graph.start == nil {
+		return nil, errors.New("automation has no START node")
+	}
+	return graph, nil
+}
+
+// Start is the node runs begin at
+func (g *AutomationGraph) Start() *AutomationNode {
+	return g.start
+}
+
+// Node returns a node by ID
+func (g *AutomationGraph) Node(id string) *AutomationNode {
+	return g.nodes[id]
+}
+
+// Next follows the node's outgoing edge. With a label only the edge carrying it is followed;
+// without one the first edge is. It returns nil at the end of the graph.
+func (g *AutomationGraph) Next(nodeID, label string) *AutomationNode {
+	for _, edge := range g.edges[nodeID] {
+		if label == "" || strings.EqualFold(edge.Label, label) {
+			return g.nodes[edge.TargetID]
+		}
+	}
+	return nil
+}
+
+// GetAutomationWithGraph loads an automation with its nodes and edges
+func GetAutomationWithGraph(id string, db *gorm.DB) (*Automation, error) {
+	automation := &Automation{}
+	if err := db.Where("id = ? AND is_deleted = false", id).
+		Preload("Nodes", "is_deleted = false").
+		Preload("Edges", "is_deleted = false").
+		First(automation).Error; err != nil {
+		return nil, err
+	}
+	return automation, nil
+}
+
+// EnrollContact starts a run of the automation for the contact. It returns nil when the
+// contact is already enrolled.
+func EnrollContact(automation *Automation, contact *Contact, db *gorm.DB) (*AutomationRun, error) {
+	graph, err := NewAutomationGraph(automation)
+	if err != nil {
+		return nil, err
+	}
+
+	run := &AutomationRun{
+		AutomationID:  automation.ID,
+		ContactID:     contact.ID,
+		TeamID:        automation.TeamID,
+		Status:        AutomationRunStatusActive,
+		CurrentNodeID: graph.Start().ID,
+	}
+	result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(run)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil
+	}
+	return run, nil
+}
+
+// GetTriggeredAutomations returns the team's active automations whose START node enrolls contacts added to the list
+func GetTriggeredAutomations(teamID, listID string, db *gorm.DB) ([]Automation, error) {
+	var ids []string
+	if err := db.Model(&AutomationNode{}).
+		Joins("JOIN automations ON automations.id = automation_nodes.automation_id").
+		Where("automations.team_id = ? AND automations.is_active = true AND automations.is_deleted = false", teamID).
+		Where("automation_nodes.type = ? AND automation_nodes.is_deleted = false AND automation_nodes.data ->> 'listId' = ?", NodeTypeStart, listID).
+		Distinct().
+		Pluck("automation_nodes.automation_id", &ids).Error; err != nil {
+		return nil, err
+	}
+
+	automations := make([]Automation, 0, len(ids))
+	for _, id := range ids {
+		automation, err := GetAutomationWithGraph(id, db)
+		if err != nil {
+			return nil, err
+		}
+		automations = append(automations, *automation)
+	}
+	return automations, nil
+}
+
+// ContactMatches reports whether the contact matches a CONDITION node
+func (d *ConditionNodeData) ContactMatches(contact *Contact, db *gorm.DB) (bool, error) {
+	query := db.Model(&Contact{}).Where("contacts.id = ?", contact.ID)
+
+	switch {
+	case d.SegmentID != "":
+		segment, err := GetSegmentByID(d.SegmentID, db)
+		if err != nil {
+			return false, fmt.Errorf("failed to get segment: %w", err)
+		}
+		if query, err = segment.Apply(query); err != nil {
+			return false, err
+		}
+	case d.Conditions != nil:
+		if err := d.Conditions.ResolveComputedFields(contact.TeamID, db); err != nil {
+			return false, err
+		}
+		sql, args, err := d.Conditions.Build()
+		if err != nil {
+			return false, err
+		}
+		if sql != "" {
+			query = query.Where(sql, args...)
+		}
+	default:
+		return false, errors.New("condition node needs a segmentId or conditions")
+	}
+
+	var count int64
+	if err := query.Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// OptOutOfAutomation stops the run of an automation email's contact and keeps the contact from
+// being enrolled in the automation again, leaving the contact subscribed to everything else
+func OptOutOfAutomation(email *Email, db *gorm.DB) error {
+	if email.AutomationID == "" || email.ContactID == "" {
+		return errors.New("email wasn't sent to a contact by an automation")
+	}
+
+	now := time.Now()
+	run := &AutomationRun{
+		AutomationID:  email.AutomationID,
+		ContactID:     email.ContactID,
+		TeamID:        email.TeamID,
+		Status:        AutomationRunStatusOptedOut,
+		CompletedAt:   now,
+		OptedOutAt:    &now,
+		OptOutEmailID: email.ID,
+	}
+	// The run stays as the record of the opt-out, which is what keeps EnrollContact from starting
+	// the contact again. Repeat opt-outs keep the first one.
+	return db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "automation_id"}, {Name: "contact_id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"status":           AutomationRunStatusOptedOut,
+			"next_run_at":      nil,
+			"completed_at":     gorm.Expr("CASE WHEN automation_runs.status = ? THEN automation_runs.completed_at ELSE ? END", AutomationRunStatusOptedOut, now),
+			"opted_out_at":     gorm.Expr("COALESCE(automation_runs.opted_out_at, ?)", now),
+			"opt_out_email_id": gorm.Expr("COALESCE(automation_runs.opt_out_email_id, ?)", email.ID),
+		}),
+	}).Create(run).Error
+}
+
+// HasOptedOutOfAutomation reports whether a run's contact has opted out of the automation
+func HasOptedOutOfAutomation(runID string, db *gorm.DB) (bool, error) {
+	var count int64
+	if err := db.Model(&AutomationRun{}).Where("id = ? AND status = ?", runID, AutomationRunStatusOptedOut).Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// AutomationOptOutRate is how many of the contacts an automation reached opted out of it
+type AutomationOptOutRate struct {
+	AutomationID   string  `json:"automationId"`
+	AutomationName string  `json:"automationName"`
+	Enrolled       int64   `json:"enrolled"`   // contacts enrolled at any time
+	Emailed        int64   `json:"emailed"`    // contacts sent at least one of its emails
+	EmailsSent     int64   `json:"emailsSent"` // emails the automation sent
+	OptedOut       int64   `json:"optedOut"`
+	OptOutRate     float64 `json:"optOutRate"` // percent of the contacts emailed
+}
+
+// GetAutomationOptOutRates returns the opt-out rates of a team's automations, or of one when
+// automationID is set
+func GetAutomationOptOutRates(teamID, automationID string, db *gorm.DB) ([]AutomationOptOutRate, error) {
+	query := db.Model(&Automation{}).
+		Select(`automations.id AS automation_id, automations.name AS automation_name,
+			COALESCE(runs.enrolled, 0) AS enrolled, COALESCE(runs.opted_out, 0) AS opted_out,
+			COALESCE(sent.emailed, 0) AS emailed, COALESCE(sent.emails_sent, 0) AS emails_sent`).
+		Joins(`LEFT JOIN (
+			SELECT automation_id, COUNT(*) AS enrolled, COUNT(*) FILTER (WHERE status = ?) AS opted_out
+			FROM automation_runs WHERE team_id = ? AND is_deleted = false GROUP BY automation_id
+		) runs ON runs.automation_id = automations.id`, AutomationRunStatusOptedOut, teamID).
+		Joins(`LEFT JOIN (
+			SELECT automation_id, COUNT(DISTINCT contact_id) AS emailed, COUNT(*) AS emails_sent
+			FROM emails WHERE team_id = ? AND automation_id IS NOT NULL AND is_deleted = false GROUP BY automation_id
+		) sent ON sent.automation_id = automations.id`, teamID).
+		Where("automations.team_id = ? AND automations.is_deleted = false", teamID)
+	if automationID != "" {
+		query = query.Where("automations.id = ?", automationID)
+	}
+
+	var rates []AutomationOptOutRate
+	if err := query.Order("automations.name").Scan(&rates).Error; err != nil {
+		return nil, err
+	}
+	for i := range rates {
+		if rates[i].Emailed > 0 {
+			rates[i].OptOutRate = float64(rates[i].OptedOut) / float64(rates[i].Emailed) * 100
+		}
+	}
+	return rates, nil
+}
@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 	"gorm.io/gorm"
 )
 
@@ -43,6 +44,7 @@ const (
 	CampaignStatusCompleted CampaignStatus = "COMPLETED"
 	CampaignStatusFailed    CampaignStatus = "FAILED"
 	CampaignStatusPaused    CampaignStatus = "PAUSED"
+	CampaignStatusCancelled CampaignStatus = "CANCELLED"
 )
 
 // Campaign schedule constants
@@ -61,12 +63,14 @@ const (
 
 // Email status constants
 const (
-	EmailStatusPending EmailStatus = "PENDING"
-	EmailStatusSent    EmailStatus = "SENT"
-	EmailStatusFailed  EmailStatus = "FAILED"
-	EmailStatusBounced EmailStatus = "BOUNCED"
-	EmailStatusOpened  EmailStatus = "OPENED"
-	EmailStatusClicked EmailStatus = "CLICKED"
+	EmailStatusPending   EmailStatus = "PENDING"
+	EmailStatusSent      EmailStatus = "SENT"
+	EmailStatusFailed    EmailStatus = "FAILED"
+	EmailStatusBounced   EmailStatus = "BOUNCED"
+	EmailStatusOpened    EmailStatus = "OPENED"
+	EmailStatusClicked   EmailStatus = "CLICKED"
+	EmailStatusCancelled EmailStatus = "CANCELLED" // the campaign was cancelled or deleted before the email went out
+	EmailStatusSkipped   EmailStatus = "SKIPPED"   // left out by a frequency cap, see SkipReason
 )
 
 // Job status constants
@@ -84,6 +88,7 @@ const (
 	SubscriberStatusUnsubscribed SubscriberStatus = "UNSUBSCRIBED"
 	SubscriberStatusBounced      SubscriberStatus = "BOUNCED"
 	SubscriberStatusComplained   SubscriberStatus = "COMPLAINED"
+	SubscriberStatusPending      SubscriberStatus = "PENDING" // waiting to confirm a list that requires it
 )
 
 // Tracking type constants
@@ -100,8 +105,18 @@ const (
 	SMTPProviderGmail   SMTPProvider = "GMAIL"
 	SMTPProviderOutlook SMTPProvider = "OUTLOOK"
 	SMTPProviderAmazon  SMTPProvider = "AMAZON"
+	// Providers sent through over their HTTP APIs rather than SMTP
+	SMTPProviderSendGrid SMTPProvider = "SENDGRID"
+	SMTPProviderMailgun  SMTPProvider = "MAILGUN"
+	SMTPProviderPostmark SMTPProvider = "POSTMARK"
 )
 
+// IsAPI reports whether mail goes through the provider's HTTP API. The config's Host is then
+// the API host, Password the API key and, for Mailgun, Username the sending domain.
+func (p SMTPProvider) IsAPI() bool {
+	return p == SMTPProviderSendGrid || p == SMTPProviderMailgun || p == SMTPProviderPostmark
+}
+
 // Node type constants
 const (
 	NodeTypeStart            NodeType = "START"
@@ -143,6 +158,13 @@ type TeamSettings struct {
 	BrandingSettingsID string            `gorm:"type:uuid;not null" json:"brandingSettingsId"`
 	BrandingSettings   *BrandingSettings `gorm:"constraint:OnDelete:CASCADE" json:"branding,omitempty"`
 	TeamID             string            `gorm:"type:uuid;uniqueIndex;not null" json:"teamId"`
+	HolidayCountries   pq.StringArray    `gorm:"type:text[]" json:"holidayCountries"`
+	ListHeaders        bool              `gorm:"not null;default:true" json:"listHeaders"` // add List-Id, Precedence and Feedback-ID to campaign and marketing mail
+	ListIDDomain       string            `json:"listIdDomain"`                             // List-Id values are under, the From address's domain when empty
+	FeedbackIDSender   string            `json:"feedbackIdSender"`                         // the Feedback-ID's sender, posthoot when empty
+	// Raw tracking events older than this many days are deleted once rolled up, 0 keeping them
+	TrackingRetentionDays int        `gorm:"not null;default:0" json:"trackingRetentionDays"`
+	TrackingPrunedBefore  *time.Time `json:"trackingPrunedBefore,omitempty"` // raw events before this are gone, only rollups have them
 }
 
 type BrandingSettings struct {
@@ -155,9 +177,11 @@ type BrandingSettings struct {
 type ContactImportStatus string
 
 const (
-	ContactImportStatusPending   ContactImportStatus = "PENDING"
-	ContactImportStatusCompleted ContactImportStatus = "COMPLETED"
-	ContactImportStatusFailed    ContactImportStatus = "FAILED"
+	ContactImportStatusPending    ContactImportStatus = "PENDING"
+	ContactImportStatusProcessing ContactImportStatus = "PROCESSING"
+	ContactImportStatusValidated  ContactImportStatus = "VALIDATED" // a dry run finished, waiting to be confirmed
+	ContactImportStatusCompleted  ContactImportStatus = "COMPLETED"
+	ContactImportStatusFailed     ContactImportStatus = "FAILED"
 )
 
 type EmailTrackingEvent string
@@ -0,0 +1,150 @@
+package models
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// BlackoutPolicy controls what a recurring campaign does when a run falls on a blackout date
+type BlackoutPolicy string
+
+const (
+	BlackoutPolicySkip  BlackoutPolicy = "SKIP"
+	BlackoutPolicyShift BlackoutPolicy = "SHIFT"
+)
+
+// maxBlackoutShiftDays bounds how far a shifted send can move forward
+const maxBlackoutShiftDays = 31
+
+// BlackoutDate is a team-managed date (or range) on which campaigns should not be sent
+type BlackoutDate struct {
+	Base
+	Name            string    `gorm:"not null" json:"name" validate:"required,min=2"`
+	StartDate       time.Time `gorm:"type:date;not null" json:"startDate" validate:"required"`
+	EndDate         time.Time `gorm:"type:date" json:"endDate" validate:"omitempty"`
+	RecurringYearly bool      `gorm:"not null;default:false" json:"recurringYearly"`
+	TeamID          string    `gorm:"type:uuid;not null" json:"teamId" validate:"required,uuid"`
+	Team            *Team     `json:"team,omitempty"`
+}
+
+// Blackout describes why a date is blocked
+type Blackout struct {
+	Name    string    `json:"name"`
+	Date    time.Time `json:"date"`
+	Source  string    `json:"source"` // team or holiday
+	Country string    `json:"country,omitempty"`
+}
+
+// ValidationError is returned when what was asked for can't be done as given, e.g. a campaign
+// scheduled on a blackout date without an override
+type ValidationError struct {
+	Message string `json:"message"`
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message
+}
+
+// StatusCode lets the API surface the error as a validation problem rather than a server error
+func (e *ValidationError) StatusCode() int {
+	return http.StatusUnprocessableEntity
+}
+
+// Matches reports whether the blackout covers the given calendar day
+func (b *BlackoutDate) Matches(day time.Time) bool {
+	start := dateOnly(b.StartDate)
+	end := start
+	if !b.EndDate.IsZero() && b.EndDate.After(b.StartDate) {
+		end = dateOnly(b.EndDate)
+	}
+	day = dateOnly(day)
+
+	if b.RecurringYearly {
+		// Move the range into the year being checked
+		offset := day.Year() - start.Year()
+		start = start.AddDate(offset, 0, 0)
+		end = end.AddDate(offset, 0, 0)
+		if end.Before(start) {
+			end = end.AddDate(1, 0, 0)
+		}
+	}
+
+	return !day.Before(start) && !day.After(end)
+}
+
+// FindBlackout returns the blackout covering the given day for a team, if any.
+// The day is interpreted as a calendar date; callers convert to the campaign timezone first.
+func FindBlackout(teamID string, day time.Time, db *gorm.DB) (*Blackout, error) {
+	var dates []BlackoutDate
+	if err := db.Where("team_id = ? AND is_deleted = false", teamID).Find(&dates).Error; err != nil {
+		return nil, err
+	}
+	for _, date := range dates {
+		if date.Matches(day) {
+			return &Blackout{Name: date.Name, Date: dateOnly(day), Source: "team"}, nil
+		}
+	}
+
+	settings := &TeamSettings{}
+	if err := db.Where("team_id = ? AND is_deleted = false", teamID).First(settings).Error; err != nil {
+		return nil, nil
+	}
+	for _, country := range settings.HolidayCountries {
+		for _, holiday := range HolidaysForCountry(country, day.Year()) {
+			if holiday.Date.Equal(dateOnly(day)) {
+				return &Blackout{Name: holiday.Name, Date: holiday.Date, Source: "holiday", Country: strings.ToUpper(country)}, nil
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+// NextAllowedSendTime moves t forward one day at a time until it no longer falls on a blackout date
+func NextAllowedSendTime(teamID string, t time.Time, db *gorm.DB) (time.Time, error) {
+	for i := 0; i < maxBlackoutShiftDays; i++ {
+		blackout, err := FindBlackout(teamID, t, db)
+		if err != nil {
+			return t, err
+		}
+		if blackout == nil {
+			return t, nil
+		}
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, fmt.Errorf("no send date available within %d days", maxBlackoutShiftDays)
+}
+
+// CampaignLocation returns the campaign's timezone, falling back to UTC
+func (c *Campaign) CampaignLocation() *time.Location {
+	if c.Timezone != "" {
+		if loc, err := time.LoadLocation(c.Timezone); err == nil {
+			return loc
+		}
+	}
+	return time.UTC
+}
+
+// checkBlackout rejects campaigns scheduled on a blackout date unless explicitly overridden
+func (c *Campaign) checkBlackout(tx *gorm.DB) error {
+	if c.BlackoutOverride || c.TeamID == "" || c.ScheduledFor.IsZero() || c.Schedule == CampaignScheduleRecurring {
+		return nil
+	}
+	blackout, err := FindBlackout(c.TeamID, c.ScheduledFor.In(c.CampaignLocation()), tx)
+	if err != nil {
+		return err
+	}
+	if blackout != nil {
+		return &ValidationError{Message: fmt.Sprintf("campaign is scheduled on a blackout date (%s on %s); set blackoutOverride to schedule anyway",
+			blackout.Name, blackout.Date.Format("2006-01-02"))}
+	}
+	return nil
+}
+
+func dateOnly(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
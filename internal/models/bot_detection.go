@@ -0,0 +1,109 @@
+package models
+
+import (
+	"encoding/json"
+	"net/netip"
+	"strings"
+
+	"gorm.io/datatypes"
+)
+
+// Sources of opens and clicks that were fetched by a machine on the recipient's behalf, kept
+// in the event's metadata as botSource
+const (
+	BotSourceApplePrivacy = "apple_privacy" // Apple Mail Privacy Protection prefetching images
+	BotSourceGmailProxy   = "gmail_proxy"   // Gmail's image proxy
+	BotSourceYahooProxy   = "yahoo_proxy"   // Yahoo Mail's image proxy
+	BotSourceScanner      = "scanner"       // security gateways, link scanners and crawlers
+)
+
+// BotEventSQL is true for events flagged as fetched by a bot, for queries on email_trackings
+const BotEventSQL = "COALESCE((email_trackings.metadata->>'bot')::boolean, false)"
+
+// botUserAgents are user agent fragments, matched case-insensitively, of known proxies and scanners
+var botUserAgents = []struct {
+	fragment string
+	source   string
+}{
+	{"googleimageproxy", BotSourceGmailProxy},
+	{"ggpht.com", BotSourceGmailProxy},
+	{"yahoomailproxy", BotSourceYahooProxy},
+	{"barracuda", BotSourceScanner},
+	{"mimecast", BotSourceScanner},
+	{"proofpoint", BotSourceScanner},
+	{"messagelabs", BotSourceScanner},
+	{"symantec", BotSourceScanner},
+	{"forcepoint", BotSourceScanner},
+	{"trendmicro", BotSourceScanner},
+	{"bitdefender", BotSourceScanner},
+	{"safelinks", BotSourceScanner},
+	{"headlesschrome", BotSourceScanner},
+	{"phantomjs", BotSourceScanner},
+	{"python-requests", BotSourceScanner},
+	{"go-http-client", BotSourceScanner},
+	{"curl/", BotSourceScanner},
+	{"wget/", BotSourceScanner},
+	{"bot", BotSourceScanner},
+	{"crawler", BotSourceScanner},
+	{"spider", BotSourceScanner},
+}
+
+// botIPRanges are networks proxies and scanners fetch from
+var botIPRanges = []struct {
+	prefix netip.Prefix
+	source string
+}{
+	{netip.MustParsePrefix("17.0.0.0/8"), BotSourceApplePrivacy},
+	{netip.MustParsePrefix("66.102.0.0/20"), BotSourceGmailProxy},
+	{netip.MustParsePrefix("66.249.80.0/20"), BotSourceGmailProxy},
+	// Exchange Online Protection, which Safe Links scans from
+	{netip.MustParsePrefix("40.92.0.0/15"), BotSourceScanner},
+	{netip.MustParsePrefix("40.107.0.0/16"), BotSourceScanner},
+	{netip.MustParsePrefix("52.100.0.0/14"), BotSourceScanner},
+	{netip.MustParsePrefix("104.47.0.0/17"), BotSourceScanner},
+}
+
+// DetectBot returns the kind of bot an open or click came from, empty when it looks like the
+// recipient's own mail client or browser
+func DetectBot(userAgent, ipAddress string) string {
+	// Apple's proxy fetches with a bare user agent from networks that aren't all Apple's
+	if strings.TrimSpace(userAgent) == "Mozilla/5.0" {
+		return BotSourceApplePrivacy
+	}
+
+	agent := strings.ToLower(userAgent)
+	for _, bot := range botUserAgents {
+		if strings.Contains(agent, bot.fragment) {
+			return bot.source
+		}
+	}
+
+	if ip, err := netip.ParseAddr(ipAddress); err == nil {
+		ip = ip.Unmap()
+		for _, bot := range botIPRanges {
+			if bot.prefix.Contains(ip) {
+				return bot.source
+			}
+		}
+	}
+	return ""
+}
+
+// MarkBot flags an event as fetched by a bot in its metadata
+func MarkBot(tracking *EmailTracking, source string) error {
+	metadata := map[string]interface{}{}
+	if len(tracking.Metadata) > 0 {
+		if err := json.Unmarshal(tracking.Metadata, &metadata); err != nil {
+			return err
+		}
+	}
+	metadata["bot"] = true
+	metadata["botSource"] = source
+
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+	tracking.Metadata = datatypes.JSON(data)
+	return nil
+}
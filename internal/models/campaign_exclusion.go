@@ -0,0 +1,148 @@
+package models
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// CampaignExclusionType is what a campaign exclusion leaves out of the send
+type CampaignExclusionType string
+
+const (
+	CampaignExclusionList     CampaignExclusionType = "LIST"     // addresses on a list
+	CampaignExclusionSegment  CampaignExclusionType = "SEGMENT"  // addresses matching a segment at send time
+	CampaignExclusionCampaign CampaignExclusionType = "CAMPAIGN" // addresses another campaign was sent to
+)
+
+// CampaignExclusion leaves the recipients of a list, segment or earlier campaign out of a
+// campaign's send. Contacts are copied per list, so recipients are matched by address.
+type CampaignExclusion struct {
+	Base
+	CampaignID string                `gorm:"type:uuid;not null;index" json:"campaignId" validate:"required,uuid"`
+	Campaign   *Campaign             `json:"campaign,omitempty"`
+	Type       CampaignExclusionType `gorm:"not null" json:"type" validate:"required,oneof=LIST SEGMENT CAMPAIGN"`
+	TargetID   string                `gorm:"type:uuid;not null" json:"targetId" validate:"required,uuid"` // the list, segment or campaign
+	TeamID     string                `gorm:"type:uuid;not null" json:"teamId" validate:"omitempty,uuid"`
+	Team       *Team                 `json:"team,omitempty"`
+}
+
+// CampaignExclusionCount is how many of a campaign's audience an exclusion leaves out. An
+// address can be matched by several exclusions.
+type CampaignExclusionCount struct {
+	CampaignExclusion
+	Excluded int64 `json:"excluded"`
+}
+
+func (e *CampaignExclusion) BeforeCreate(tx *gorm.DB) error {
+	if err := e.Base.BeforeCreate(tx); err != nil {
+		return err
+	}
+	db := tx.Session(&gorm.Session{NewDB: true})
+
+	var campaign Campaign
+	if err := db.Select("id", "team_id").Where("id = ? AND is_deleted = false", e.CampaignID).First(&campaign).Error; err != nil {
+		return &ValidationError{Message: "campaign not found"}
+	}
+	if e.TeamID == "" {
+		e.TeamID = campaign.TeamID
+	}
+
+	var target interface{}
+	switch e.Type {
+	case CampaignExclusionList:
+		target = &MailingList{}
+	case CampaignExclusionSegment:
+		target = &Segment{}
+	case CampaignExclusionCampaign:
+		if e.TargetID == e.CampaignID {
+			return &ValidationError{Message: "a campaign can't exclude itself"}
+		}
+		target = &Campaign{}
+	default:
+		return &ValidationError{Message: fmt.Sprintf("unknown exclusion type %s", e.Type)}
+	}
+	var found int64
+	if err := db.Model(target).Where("id = ? AND team_id = ? AND is_deleted = false", e.TargetID, e.TeamID).Count(&found).Error; err != nil {
+		return err
+	}
+	if found == 0 {
+		return &ValidationError{Message: fmt.Sprintf("%s %s not found", e.Type, e.TargetID)}
+	}
+
+	var existing int64
+	if err := db.Model(&CampaignExclusion{}).
+		Where("campaign_id = ? AND type = ? AND target_id = ? AND is_deleted = false", e.CampaignID, e.Type, e.TargetID).
+		Count(&existing).Error; err != nil {
+		return err
+	}
+	if existing > 0 {
+		return &ValidationError{Message: "campaign already has this exclusion"}
+	}
+	return nil
+}
+
+// GetCampaignExclusions returns a campaign's exclusions
+func GetCampaignExclusions(campaignID string, db *gorm.DB) ([]CampaignExclusion, error) {
+	var exclusions []CampaignExclusion
+	if err := db.Where("campaign_id = ? AND is_deleted = false", campaignID).
+		Order("created_at ASC").
+		Find(&exclusions).Error; err != nil {
+		return nil, err
+	}
+	return exclusions, nil
+}
+
+// addresses selects the lowercased addresses an exclusion leaves out
+func (e *CampaignExclusion) addresses(db *gorm.DB) (*gorm.DB, error) {
+	switch e.Type {
+	case CampaignExclusionList:
+		return db.Table("contacts").Select("LOWER(contacts.email)").
+			Where("contacts.list_id = ? AND contacts.team_id = ? AND contacts.is_deleted = false", e.TargetID, e.TeamID), nil
+	case CampaignExclusionSegment:
+		segment, err := GetSegmentByID(e.TargetID, db)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get segment: %w", err)
+		}
+		query, err := segment.Apply(db.Table("contacts").Where("contacts.team_id = ? AND contacts.is_deleted = false", e.TeamID))
+		if err != nil {
+			return nil, fmt.Errorf("failed to apply segment: %w", err)
+		}
+		return query.Select("LOWER(contacts.email)"), nil
+	case CampaignExclusionCampaign:
+		// Everyone the campaign emailed or is emailing, not the sends that failed, were cancelled or skipped
+		return db.Table("emails").Select(`LOWER(emails."to")`).
+			Where("emails.campaign_id = ? AND emails.team_id = ? AND emails.is_deleted = false AND emails.status NOT IN ?",
+				e.TargetID, e.TeamID, []EmailStatus{EmailStatusFailed, EmailStatusCancelled, EmailStatusSkipped}), nil
+	}
+	return nil, fmt.Errorf("unknown exclusion type %s", e.Type)
+}
+
+// ApplyExclusions leaves the addresses of the campaign's exclusions out of its audience
+func (c *Campaign) ApplyExclusions(audience *gorm.DB, exclusions []CampaignExclusion, db *gorm.DB) (*gorm.DB, error) {
+	for i := range exclusions {
+		addresses, err := exclusions[i].addresses(db)
+		if err != nil {
+			return nil, err
+		}
+		audience = audience.Where("LOWER(contacts.email) NOT IN (?)", addresses)
+	}
+	return audience, nil
+}
+
+// CountExclusions counts the contacts of the audience each exclusion leaves out
+func (c *Campaign) CountExclusions(audience *gorm.DB, exclusions []CampaignExclusion, db *gorm.DB) ([]CampaignExclusionCount, error) {
+	counts := make([]CampaignExclusionCount, 0, len(exclusions))
+	for i := range exclusions {
+		addresses, err := exclusions[i].addresses(db)
+		if err != nil {
+			return nil, err
+		}
+		count := CampaignExclusionCount{CampaignExclusion: exclusions[i]}
+		if err := audience.Session(&gorm.Session{}).Where("LOWER(contacts.email) IN (?)", addresses).Count(&count.Excluded).Error; err != nil {
+			return nil, err
+		}
+		counts = append(counts, count)
+	}
+	return counts, nil
+}
@@ -0,0 +1,110 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"net/url"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxLinkLabelLength caps the anchor text kept as a link's label
+const maxLinkLabelLength = 200
+
+// CampaignLink is a tracked link registered when an email is rendered. Click tracking links
+// point at the record instead of carrying the destination, so they can only redirect to URLs
+// that were really sent. Emails outside campaigns register links with no campaign.
+type CampaignLink struct {
+	Base
+	TeamID     string    `gorm:"type:uuid;not null;index" json:"teamId"`
+	CampaignID string    `gorm:"type:uuid;default:NULL;index" json:"campaignId"`
+	Campaign   *Campaign `json:"campaign,omitempty"`
+	URL        string    `gorm:"not null" json:"url"`           // canonical destination
+	Label      string    `json:"label"`                         // anchor text of the link
+	Position   int       `gorm:"not null" json:"position"`      // 1-based order of the link in the body
+	Hash       string    `gorm:"not null;uniqueIndex" json:"-"` // team, campaign, position and url
+}
+
+// CanonicalLinkURL normalizes an href as written in html: entities are decoded, and the scheme
+// and host are lowercased
+func CanonicalLinkURL(href string) string {
+	href = strings.TrimSpace(html.UnescapeString(href))
+	parsed, err := url.Parse(href)
+	if err != nil || parsed.Scheme == "" {
+		return href
+	}
+	parsed.Scheme = strings.ToLower(parsed.Scheme)
+	parsed.Host = strings.ToLower(parsed.Host)
+	return parsed.String()
+}
+
+// LinkRegistry registers the links of the emails rendered for a campaign, or for emails outside
+// campaigns when campaignID is empty. Links already registered are reused.
+type LinkRegistry struct {
+	teamID       string
+	campaignID   string
+	db           *gorm.DB
+	links        map[string]*CampaignLink
+	trackingHost *string
+}
+
+func NewLinkRegistry(teamID, campaignID string, db *gorm.DB) *LinkRegistry {
+	return &LinkRegistry{teamID: teamID, campaignID: campaignID, db: db, links: make(map[string]*CampaignLink)}
+}
+
+// Register returns the link record for an href at a position in the body, creating it if needed
+func (r *LinkRegistry) Register(href, label string, position int) (*CampaignLink, error) {
+	canonical := CanonicalLinkURL(href)
+	sum := sha256.Sum256(fmt.Appendf(nil, "%s|%s|%d|%s", r.teamID, r.campaignID, position, canonical))
+	hash := hex.EncodeToString(sum[:])
+	if link, ok := r.links[hash]; ok {
+		return link, nil
+	}
+
+	if runes := []rune(label); len(runes) > maxLinkLabelLength {
+		label = string(runes[:maxLinkLabelLength])
+	}
+	link := &CampaignLink{
+		TeamID:     r.teamID,
+		CampaignID: r.campaignID,
+		URL:        canonical,
+		Label:      label,
+		Position:   position,
+		Hash:       hash,
+	}
+	// Emails of a campaign render concurrently, so whoever registers a link first wins
+	if err := r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(link).Error; err != nil {
+		return nil, err
+	}
+	registered := &CampaignLink{}
+	if err := r.db.Where("hash = ?", hash).First(registered).Error; err != nil {
+		return nil, err
+	}
+	r.links[hash] = registered
+	return registered, nil
+}
+
+// TrackingHost returns the team's verified tracking domain, empty when its links use the public URL
+func (r *LinkRegistry) TrackingHost() string {
+	if r.trackingHost == nil {
+		host := ""
+		if domain, err := GetTeamTrackingDomain(r.teamID, r.db); err == nil && domain != nil && domain.IsVerified() {
+			host = domain.Domain
+		}
+		r.trackingHost = &host
+	}
+	return *r.trackingHost
+}
+
+// GetCampaignLink returns a registered link
+func GetCampaignLink(id string, db *gorm.DB) (*CampaignLink, error) {
+	var link CampaignLink
+	if err := db.Where("id = ? AND is_deleted = false", id).First(&link).Error; err != nil {
+		return nil, err
+	}
+	return &link, nil
+}
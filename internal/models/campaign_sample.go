@@ -0,0 +1,88 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// SampleStatus tracks the phase of a campaign's soft launch to a sample of its audience
+type SampleStatus string
+
+const (
+	SampleStatusNone      SampleStatus = ""
+	SampleStatusObserving SampleStatus = "OBSERVING"
+	SampleStatusPassed    SampleStatus = "PASSED"
+	SampleStatusFailed    SampleStatus = "FAILED"
+)
+
+// SamplesFirst reports whether the campaign still has to be sent to its sample before the rest
+// of its audience
+func (c *Campaign) SamplesFirst() bool {
+	return c.SamplePercent > 0 && c.SampleStatus == SampleStatusNone
+}
+
+// SampleDeadline is when the sample's bounces and complaints are checked
+func (c *Campaign) SampleDeadline() time.Time {
+	return c.SampleStartedAt.Add(time.Duration(c.SampleHours) * time.Hour)
+}
+
+func (c *Campaign) validateSample() error {
+	if c.SamplePercent == 0 {
+		return nil
+	}
+	if c.Schedule == CampaignScheduleRecurring {
+		return &ValidationError{Message: "recurring campaigns can't be sent to a sample first"}
+	}
+	if len(c.Variants) > 0 {
+		return &ValidationError{Message: "a campaign can't be both A/B tested and sent to a sample first"}
+	}
+	if c.SendsPerRecipient() {
+		return &ValidationError{Message: "a campaign sent to a sample first can't use smart send or a local send time"}
+	}
+	return nil
+}
+
+// SampleResult is how the sample of a campaign did over its observation window
+type SampleResult struct {
+	CampaignID       string         `json:"campaignId"`
+	CampaignName     string         `json:"campaignName"`
+	TeamID           string         `json:"teamId"`
+	Stats            *CampaignStats `json:"stats"`
+	BounceRate       float64        `json:"bounceRate"`    // percentage of the sample's sent emails
+	ComplaintRate    float64        `json:"complaintRate"` // percentage of the sample's sent emails
+	MaxBounceRate    float64        `json:"maxBounceRate"`
+	MaxComplaintRate float64        `json:"maxComplaintRate"`
+	Reasons          []string       `json:"reasons,omitempty"` // the thresholds the sample went over
+}
+
+// Healthy reports whether the sample stayed within its bounce and complaint thresholds
+func (r *SampleResult) Healthy() bool {
+	return len(r.Reasons) == 0
+}
+
+// EvaluateSample compares the stats of the campaign's sample to its thresholds
+func (c *Campaign) EvaluateSample(stats *CampaignStats) *SampleResult {
+	result := &SampleResult{
+		CampaignID:       c.ID,
+		CampaignName:     c.Name,
+		TeamID:           c.TeamID,
+		Stats:            stats,
+		MaxBounceRate:    c.SampleMaxBounceRate,
+		MaxComplaintRate: c.SampleMaxComplaintRate,
+	}
+	if stats.Sent == 0 {
+		return result
+	}
+
+	result.BounceRate = float64(stats.Bounces) / float64(stats.Sent) * 100
+	result.ComplaintRate = float64(stats.Complaints) / float64(stats.Sent) * 100
+	if result.BounceRate > c.SampleMaxBounceRate {
+		result.Reasons = append(result.Reasons,
+			fmt.Sprintf("bounce rate %.2f%% is over %.2f%%", result.BounceRate, c.SampleMaxBounceRate))
+	}
+	if result.ComplaintRate > c.SampleMaxComplaintRate {
+		result.Reasons = append(result.Reasons,
+			fmt.Sprintf("complaint rate %.2f%% is over %.2f%%", result.ComplaintRate, c.SampleMaxComplaintRate))
+	}
+	return result
+}
@@ -0,0 +1,97 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+)
+
+// ErrCampaignSnapshotImmutable is returned when a recorded snapshot is changed
+var ErrCampaignSnapshotImmutable = errors.New("campaign snapshots can't be changed")
+
+// CampaignSnapshot records who a campaign run was sent to, as the list stood at send time. Rates
+// are computed against RecipientCount so contacts joining or leaving the list afterwards don't
+// move them.
+type CampaignSnapshot struct {
+	Base
+	CampaignID     string         `gorm:"type:uuid;not null;index" json:"campaignId"`
+	TeamID         string         `gorm:"type:uuid;not null" json:"teamId"`
+	ListID         string         `gorm:"type:uuid;default:NULL" json:"listId"`
+	SegmentID      string         `gorm:"type:uuid;default:NULL" json:"segmentId"`
+	Remainder      bool           `gorm:"not null;default:false" json:"remainder"` // the A/B test winner sent to the rest of the audience
+	AudienceCount  int            `gorm:"not null" json:"audienceCount"`           // contacts in the list or segment when the run started
+	ExcludedCount  int            `gorm:"not null;default:0" json:"excludedCount"` // audience contacts left out by the campaign's exclusions
+	RecipientCount int            `gorm:"not null" json:"recipientCount"`          // contacts emailed by the run
+	MembershipHash string         `gorm:"not null" json:"membershipHash"`          // sha256 of the sorted recipient contact IDs
+	Members        pq.StringArray `gorm:"type:text[]" json:"members,omitempty"`    // recipient contact IDs, kept when the campaign asks for it
+	TakenAt        time.Time      `gorm:"not null" json:"takenAt"`
+}
+
+func (s *CampaignSnapshot) BeforeUpdate(tx *gorm.DB) error {
+	return ErrCampaignSnapshotImmutable
+}
+
+func (s *CampaignSnapshot) BeforeDelete(tx *gorm.DB) error {
+	return ErrCampaignSnapshotImmutable
+}
+
+// MembershipHash fingerprints a set of contacts independently of their order
+func MembershipHash(contactIDs []string) string {
+	sorted := slices.Clone(contactIDs)
+	slices.Sort(sorted)
+
+	hash := sha256.New()
+	for _, id := range sorted {
+		hash.Write([]byte(id))
+		hash.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// RecordCampaignSnapshot stores the recipients of a campaign run
+func RecordCampaignSnapshot(campaign *Campaign, audienceCount, excludedCount int, contactIDs []string, remainder bool, db *gorm.DB) (*CampaignSnapshot, error) {
+	snapshot := &CampaignSnapshot{
+		CampaignID:     campaign.ID,
+		TeamID:         campaign.TeamID,
+		ListID:         campaign.ListID,
+		SegmentID:      campaign.SegmentID,
+		Remainder:      remainder,
+		AudienceCount:  audienceCount,
+		ExcludedCount:  excludedCount,
+		RecipientCount: len(contactIDs),
+		MembershipHash: MembershipHash(contactIDs),
+		TakenAt:        time.Now(),
+	}
+	if campaign.SnapshotMembers {
+		snapshot.Members = pq.StringArray(slices.Clone(contactIDs))
+	}
+	if err := db.Create(snapshot).Error; err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// GetCampaignRecipientCount is how many contacts the campaign was sent to according to its
+// snapshots. Campaigns sent before snapshots were recorded fall back to their email count.
+func GetCampaignRecipientCount(campaignID string, db *gorm.DB) (int64, error) {
+	var snapshots int64
+	if err := db.Model(&CampaignSnapshot{}).Where("campaign_id = ? AND is_deleted = false", campaignID).Count(&snapshots).Error; err != nil {
+		return 0, err
+	}
+
+	var count int64
+	if snapshots > 0 {
+		err := db.Model(&CampaignSnapshot{}).
+			Select("COALESCE(SUM(recipient_count), 0)").
+			Where("campaign_id = ? AND is_deleted = false", campaignID).
+			Scan(&count).Error
+		return count, err
+	}
+	err := db.Model(&Email{}).Where("campaign_id = ? AND is_deleted = false", campaignID).Count(&count).Error
+	return count, err
+}
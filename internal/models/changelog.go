@@ -0,0 +1,129 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ChangelogCategory is the kind of change a changelog entry announces
+type ChangelogCategory string
+
+const (
+	ChangelogCategoryNew      ChangelogCategory = "NEW"
+	ChangelogCategoryImproved ChangelogCategory = "IMPROVED"
+	ChangelogCategoryFixed    ChangelogCategory = "FIXED"
+)
+
+// ChangelogEntry is an announcement of a backend change shown to every team. Entries about a
+// plan-gated feature name it, so each team is told whether its plan includes it.
+type ChangelogEntry struct {
+	Base
+	Title       string            `gorm:"not null" json:"title" validate:"required,min=2"`
+	Body        string            `json:"body" validate:"omitempty"`
+	Category    ChangelogCategory `gorm:"not null;default:'NEW'" json:"category" validate:"omitempty,oneof=NEW IMPROVED FIXED"`
+	Feature     ProductFeature    `gorm:"default:NULL;index" json:"feature,omitempty" validate:"omitempty,max=64"` // e.g. ab_testing, available to every plan when empty
+	Link        string            `json:"link,omitempty" validate:"omitempty,url"`                                 // docs or announcement to read more
+	PublishedAt *time.Time        `gorm:"index" json:"publishedAt,omitempty"`                                      // a draft until set, hidden until then when in the future
+}
+
+// GetTeamFeatures returns the features a team's plan enables, falling back to the free tier
+// when it has no active subscription
+func GetTeamFeatures(teamID string, db *gorm.DB) (map[ProductFeature]bool, error) {
+	features := map[ProductFeature]bool{}
+
+	subscription := &Subscription{}
+	err := db.Where("team_id = ? AND status = ? AND is_deleted = false", teamID, SubscriptionStatusActive).
+		Preload("Product.Features").First(subscription).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		for feature := range FreeTierFeatures {
+			features[feature] = true
+		}
+		return features, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if subscription.Product != nil {
+		for _, feature := range subscription.Product.Features {
+			if feature.Enabled {
+				features[feature.Feature] = true
+			}
+		}
+	}
+	return features, nil
+}
+
+// ChangelogItem is a published entry as a team reads it
+type ChangelogItem struct {
+	ChangelogEntry
+	Available bool     `json:"available"`       // whether the team's plan includes the entry's feature
+	Plans     []string `json:"plans,omitempty"` // names of the plans that include it
+}
+
+// GetChangelog returns the entries published since the given time, newest first, marked with
+// whether the team's plan includes what they announce
+func GetChangelog(teamID string, since time.Time, limit int, db *gorm.DB) ([]ChangelogItem, error) {
+	query := db.Where("is_deleted = false AND published_at IS NOT NULL AND published_at <= ?", time.Now())
+	if !since.IsZero() {
+		query = query.Where("published_at > ?", since)
+	}
+
+	var entries []ChangelogEntry
+	if err := query.Order("published_at DESC").Limit(limit).Find(&entries).Error; err != nil {
+		return nil, err
+	}
+
+	features, err := GetTeamFeatures(teamID, db)
+	if err != nil {
+		return nil, err
+	}
+
+	gated := []ProductFeature{}
+	for _, entry := range entries {
+		if entry.Feature != "" {
+			gated = append(gated, entry.Feature)
+		}
+	}
+	plans, err := getFeaturePlans(gated, db)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]ChangelogItem, len(entries))
+	for i, entry := range entries {
+		items[i] = ChangelogItem{ChangelogEntry: entry, Available: true}
+		if entry.Feature != "" {
+			items[i].Available = features[entry.Feature]
+			items[i].Plans = plans[entry.Feature]
+		}
+	}
+	return items, nil
+}
+
+// getFeaturePlans returns the names of the products enabling each of the features
+func getFeaturePlans(features []ProductFeature, db *gorm.DB) (map[ProductFeature][]string, error) {
+	plans := map[ProductFeature][]string{}
+	if len(features) == 0 {
+		return plans, nil
+	}
+
+	var rows []struct {
+		Feature ProductFeature
+		Name    string
+	}
+	if err := db.Model(&ProductFeatureConfig{}).
+		Select("product_feature_configs.feature, products.name").
+		Joins("JOIN products ON products.id = product_feature_configs.product_id AND products.is_deleted = false").
+		Where("product_feature_configs.feature IN ? AND product_feature_configs.enabled = true AND product_feature_configs.is_deleted = false", features).
+		Order("products.price").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		plans[row.Feature] = append(plans[row.Feature], row.Name)
+	}
+	return plans, nil
+}
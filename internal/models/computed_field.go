@@ -0,0 +1,486 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"gorm.io/gorm"
+)
+
+// ComputedField is a contact field a team derives from other fields and engagement with an
+// expression, like trim(first_name || ' ' || last_name) or days_since_last_open. Its value is
+// worked out when an email is rendered, as the {{name}} variable, and when a segment condition
+// of type computed is evaluated, so it's never stale and never has to be imported.
+//
+// Expressions combine contact fields (first_name, created_at, ...), metadata.<key>, the
+// engagement values days_since_last_open, days_since_last_click and days_since_last_email,
+// 'text' and number literals with || + - * / and the functions concat, default, lower, upper,
+// trim, initcap, round, number, days_since, opens and clicks.
+type ComputedField struct {
+	Base
+	Name        string `gorm:"not null;uniqueIndex:idx_computed_field_name" json:"name" validate:"required,min=2,max=64"`
+	Description string `json:"description" validate:"omitempty"`
+	Expression  string `gorm:"not null" json:"expression" validate:"required"`
+	TeamID      string `gorm:"type:uuid;not null;uniqueIndex:idx_computed_field_name" json:"teamId" validate:"required,uuid"`
+	Team        *Team  `json:"team,omitempty"`
+}
+
+var (
+	computedFieldNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+	// computedNumberPattern is what number() accepts as a number, other text giving no value
+	computedNumberPattern = `^\s*-?[0-9]+(\.[0-9]+)?\s*$`
+)
+
+func (f *ComputedField) BeforeSave(tx *gorm.DB) error {
+	if !computedFieldNamePattern.MatchString(f.Name) {
+		return &ValidationError{Message: "computed field names are lowercase letters, digits and underscores, starting with a letter"}
+	}
+	if _, reserved := (&Contact{}).TemplateVariables()[f.Name]; reserved || f.Name == "contact" {
+		return &ValidationError{Message: fmt.Sprintf("%s is already a contact variable", f.Name)}
+	}
+
+	sql, args, err := CompileComputedExpression(f.Expression)
+	if err != nil {
+		return &ValidationError{Message: fmt.Sprintf("invalid expression: %v", err)}
+	}
+	// Postgres checks the types of the expression without reading a row
+	rows, err := tx.Session(&gorm.Session{NewDB: true}).
+		Raw("SELECT ("+sql+")::text FROM contacts LIMIT 0", args...).Rows()
+	if err != nil {
+		return &ValidationError{Message: fmt.Sprintf("invalid expression: %v", err)}
+	}
+	return rows.Close()
+}
+
+// GetComputedFields returns the team's computed fields by name
+func GetComputedFields(teamID string, db *gorm.DB) ([]ComputedField, error) {
+	var fields []ComputedField
+	if err := db.Where("team_id = ? AND is_deleted = false", teamID).Order("name ASC").Find(&fields).Error; err != nil {
+		return nil, fmt.Errorf("failed to get computed fields: %w", err)
+	}
+	return fields, nil
+}
+
+// ComputeContactFields works out the team's computed fields for the given contacts, by contact
+// ID and field name. Fields without a value for a contact are empty.
+func ComputeContactFields(teamID string, contactIDs []string, db *gorm.DB) (map[string]map[string]string, error) {
+	values := make(map[string]map[string]string, len(contactIDs))
+	if len(contactIDs) == 0 {
+		return values, nil
+	}
+
+	fields, err := GetComputedFields(teamID, db)
+	if err != nil || len(fields) == 0 {
+		return values, err
+	}
+
+	selects := []string{"contacts.id"}
+	var args []interface{}
+	for i := range fields {
+		sql, fieldArgs, err := CompileComputedExpression(fields[i].Expression)
+		if err != nil {
+			return nil, fmt.Errorf("invalid expression of computed field %s: %w", fields[i].Name, err)
+		}
+		selects = append(selects, "COALESCE(("+sql+")::text, '')")
+		args = append(args, fieldArgs...)
+	}
+
+	for start := 0; start < len(contactIDs); start += sendTimeChunk {
+		chunk := contactIDs[start:min(start+sendTimeChunk, len(contactIDs))]
+
+		rows, err := db.Table("contacts").Select(strings.Join(selects, ", "), args...).
+			Where("contacts.id IN ?", chunk).Rows()
+		if err != nil {
+			return nil, fmt.Errorf("failed to compute contact fields: %w", err)
+		}
+
+		row := make([]string, len(selects))
+		dest := make([]interface{}, len(selects))
+		for i := range row {
+			dest[i] = &row[i]
+		}
+		for rows.Next() {
+			if err := rows.Scan(dest...); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("failed to read computed contact fields: %w", err)
+			}
+			contact := make(map[string]string, len(fields))
+			for i := range fields {
+				contact[fields[i].Name] = row[i+1]
+			}
+			values[row[0]] = contact
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to compute contact fields: %w", err)
+		}
+	}
+
+	return values, nil
+}
+
+// computedEngagement are the engagement values expressions can use, as SQL over the contacts table
+var computedEngagement = map[string]struct {
+	sql  string
+	args []interface{}
+}{
+	"days_since_last_open": {
+		sql: "(SELECT EXTRACT(DAY FROM NOW() - MAX(et.timestamp))::int FROM email_trackings et " +
+			"WHERE et.contact_id = contacts.id AND et.event = ? AND et.automated = false AND et.is_deleted = false)",
+		args: []interface{}{EmailTrackingEventOpen},
+	},
+	"days_since_last_click": {
+		sql: "(SELECT EXTRACT(DAY FROM NOW() - MAX(et.timestamp))::int FROM email_trackings et " +
+			"WHERE et.contact_id = contacts.id AND et.event = ? AND et.automated = false AND et.is_deleted = false)",
+		args: []interface{}{EmailTrackingEventClick},
+	},
+	"days_since_last_email": {
+		sql: "(SELECT EXTRACT(DAY FROM NOW() - MAX(GREATEST(e.created_at, e.send_at)))::int FROM emails e " +
+			"WHERE e.contact_id = contacts.id AND e.status IN ? AND e.test = false AND e.is_deleted = false)",
+		args: []interface{}{[]EmailStatus{EmailStatusSent, EmailStatusOpened, EmailStatusClicked, EmailStatusBounced}},
+	},
+}
+
+// CompileComputedExpression turns a computed field expression into a SQL expression over the
+// contacts table. Only whitelisted fields and functions make it into the SQL; text literals are
+// passed as arguments.
+func CompileComputedExpression(expression string) (string, []interface{}, error) {
+	tokens, err := tokenizeComputed(expression)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(tokens) == 0 {
+		return "", nil, fmt.Errorf("expression is empty")
+	}
+
+	p := &computedParser{tokens: tokens}
+	compiled, err := p.concat()
+	if err != nil {
+		return "", nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return "", nil, fmt.Errorf("unexpected %q", p.tokens[p.pos].text)
+	}
+	return compiled.sql, compiled.args, nil
+}
+
+type computedTokenKind int
+
+const (
+	computedIdent computedTokenKind = iota
+	computedNumber
+	computedString
+	computedSymbol
+)
+
+type computedToken struct {
+	kind computedTokenKind
+	text string
+}
+
+func tokenizeComputed(expression string) ([]computedToken, error) {
+	var tokens []computedToken
+	runes := []rune(expression)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '\'':
+			var text strings.Builder
+			i++
+			for {
+				if i >= len(runes) {
+					return nil, fmt.Errorf("unterminated text")
+				}
+				if runes[i] == '\'' {
+					// '' is a quote within the text
+					if i+1 < len(runes) && runes[i+1] == '\'' {
+						text.WriteRune('\'')
+						i += 2
+						continue
+					}
+					i++
+					break
+				}
+				text.WriteRune(runes[i])
+				i++
+			}
+			tokens = append(tokens, computedToken{kind: computedString, text: text.String()})
+		case unicode.IsDigit(r):
+			start := i
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, computedToken{kind: computedNumber, text: string(runes[start:i])})
+		case unicode.IsLetter(r) || r == '_':
+			start := i
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_' || runes[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, computedToken{kind: computedIdent, text: string(runes[start:i])})
+		case r == '|' && i+1 < len(runes) && runes[i+1] == '|':
+			tokens = append(tokens, computedToken{kind: computedSymbol, text: "||"})
+			i += 2
+		case strings.ContainsRune("+-*/(),", r):
+			tokens = append(tokens, computedToken{kind: computedSymbol, text: string(r)})
+			i++
+		default:
+			return nil, fmt.Errorf("unexpected %q", string(r))
+		}
+	}
+	return tokens, nil
+}
+
+type computedParser struct {
+	tokens []computedToken
+	pos    int
+}
+
+// computedSQL is a compiled part of an expression with the arguments of its placeholders
+type computedSQL struct {
+	sql  string
+	args []interface{}
+}
+
+// sqlOf builds SQL from a format whose %s verbs are compiled parts, keeping their arguments in
+// the order the parts appear. Arguments of placeholders in the format itself come first.
+func sqlOf(format string, leading []interface{}, parts ...computedSQL) computedSQL {
+	texts := make([]interface{}, len(parts))
+	args := append([]interface{}{}, leading...)
+	for i, part := range parts {
+		texts[i] = part.sql
+		args = append(args, part.args...)
+	}
+	return computedSQL{sql: fmt.Sprintf(format, texts...), args: args}
+}
+
+func (p *computedParser) peek(symbol string) bool {
+	return p.pos < len(p.tokens) && p.tokens[p.pos].kind == computedSymbol && p.tokens[p.pos].text == symbol
+}
+
+func (p *computedParser) expect(symbol string) error {
+	if !p.peek(symbol) {
+		if p.pos < len(p.tokens) {
+			return fmt.Errorf("expected %q, got %q", symbol, p.tokens[p.pos].text)
+		}
+		return fmt.Errorf("expected %q at the end", symbol)
+	}
+	p.pos++
+	return nil
+}
+
+// concat parses text joined with ||, which binds loosest
+func (p *computedParser) concat() (computedSQL, error) {
+	left, err := p.additive()
+	if err != nil {
+		return computedSQL{}, err
+	}
+	parts := []computedSQL{left}
+	for p.peek("||") {
+		p.pos++
+		right, err := p.additive()
+		if err != nil {
+			return computedSQL{}, err
+		}
+		parts = append(parts, right)
+	}
+	if len(parts) == 1 {
+		return left, nil
+	}
+	return joinComputed("CONCAT(%s)", parts), nil
+}
+
+// joinComputed puts the parts, separated by commas, in the format's single %s
+func joinComputed(format string, parts []computedSQL) computedSQL {
+	texts := make([]string, len(parts))
+	var args []interface{}
+	for i, part := range parts {
+		texts[i] = part.sql
+		args = append(args, part.args...)
+	}
+	return computedSQL{sql: fmt.Sprintf(format, strings.Join(texts, ", ")), args: args}
+}
+
+func (p *computedParser) additive() (computedSQL, error) {
+	left, err := p.term()
+	if err != nil {
+		return computedSQL{}, err
+	}
+	for p.peek("+") || p.peek("-") {
+		op := p.tokens[p.pos].text
+		p.pos++
+		right, err := p.term()
+		if err != nil {
+			return computedSQL{}, err
+		}
+		left = sqlOf("(%s "+op+" %s)", nil, left, right)
+	}
+	return left, nil
+}
+
+func (p *computedParser) term() (computedSQL, error) {
+	left, err := p.unary()
+	if err != nil {
+		return computedSQL{}, err
+	}
+	for p.peek("*") || p.peek("/") {
+		op := p.tokens[p.pos].text
+		p.pos++
+		right, err := p.unary()
+		if err != nil {
+			return computedSQL{}, err
+		}
+		if op == "/" {
+			// Dividing by zero gives no value rather than failing the query
+			left = sqlOf("(%s / NULLIF(%s, 0))", nil, left, right)
+			continue
+		}
+		left = sqlOf("(%s * %s)", nil, left, right)
+	}
+	return left, nil
+}
+
+func (p *computedParser) unary() (computedSQL, error) {
+	if p.peek("-") {
+		p.pos++
+		operand, err := p.unary()
+		if err != nil {
+			return computedSQL{}, err
+		}
+		return sqlOf("(-%s)", nil, operand), nil
+	}
+	return p.primary()
+}
+
+func (p *computedParser) primary() (computedSQL, error) {
+	if p.pos >= len(p.tokens) {
+		return computedSQL{}, fmt.Errorf("unexpected end of expression")
+	}
+	token := p.tokens[p.pos]
+	p.pos++
+
+	switch token.kind {
+	case computedNumber:
+		if _, err := strconv.ParseFloat(token.text, 64); err != nil {
+			return computedSQL{}, fmt.Errorf("invalid number %q", token.text)
+		}
+		return computedSQL{sql: token.text}, nil
+	case computedString:
+		return computedSQL{sql: "?::text", args: []interface{}{token.text}}, nil
+	case computedSymbol:
+		if token.text != "(" {
+			return computedSQL{}, fmt.Errorf("unexpected %q", token.text)
+		}
+		inner, err := p.concat()
+		if err != nil {
+			return computedSQL{}, err
+		}
+		if err := p.expect(")"); err != nil {
+			return computedSQL{}, err
+		}
+		return sqlOf("(%s)", nil, inner), nil
+	}
+
+	if p.peek("(") {
+		return p.call(strings.ToLower(token.text))
+	}
+	return identifierSQL(token.text)
+}
+
+func identifierSQL(name string) (computedSQL, error) {
+	if key, ok := strings.CutPrefix(name, "metadata."); ok && key != "" {
+		return computedSQL{sql: "(contacts.metadata ->> ?)", args: []interface{}{key}}, nil
+	}
+	if column, ok := segmentFieldColumns[name]; ok {
+		return computedSQL{sql: column}, nil
+	}
+	if engagement, ok := computedEngagement[name]; ok {
+		return computedSQL{sql: engagement.sql, args: engagement.args}, nil
+	}
+	return computedSQL{}, fmt.Errorf("unknown field %q", name)
+}
+
+func (p *computedParser) call(name string) (computedSQL, error) {
+	p.pos++ // (
+	var params []computedSQL
+	for !p.peek(")") {
+		if len(params) > 0 {
+			if err := p.expect(","); err != nil {
+				return computedSQL{}, err
+			}
+		}
+		param, err := p.concat()
+		if err != nil {
+			return computedSQL{}, err
+		}
+		params = append(params, param)
+	}
+	p.pos++ // )
+
+	arity := func(counts ...int) error {
+		for _, count := range counts {
+			if len(params) == count {
+				return nil
+			}
+		}
+		return fmt.Errorf("%s() takes %v arguments, got %d", name, counts, len(params))
+	}
+
+	switch name {
+	case "concat":
+		if len(params) == 0 {
+			return computedSQL{}, fmt.Errorf("concat() needs arguments")
+		}
+		return joinComputed("CONCAT(%s)", params), nil
+	case "default":
+		// The fallback is used when the value is missing or empty text
+		if err := arity(2); err != nil {
+			return computedSQL{}, err
+		}
+		return sqlOf("COALESCE(NULLIF((%s)::text, ''), (%s)::text)", nil, params[0], params[1]), nil
+	case "lower", "upper", "trim", "initcap":
+		if err := arity(1); err != nil {
+			return computedSQL{}, err
+		}
+		return sqlOf(strings.ToUpper(name)+"((%s)::text)", nil, params[0]), nil
+	case "round":
+		if err := arity(1, 2); err != nil {
+			return computedSQL{}, err
+		}
+		if len(params) == 2 {
+			return sqlOf("ROUND((%s)::numeric, (%s)::int)", nil, params[0], params[1]), nil
+		}
+		return sqlOf("ROUND((%s)::numeric)", nil, params[0]), nil
+	case "number":
+		// Text that isn't a number gives no value rather than failing the query
+		if err := arity(1); err != nil {
+			return computedSQL{}, err
+		}
+		text := sqlOf("(%s)::text", nil, params[0])
+		pattern := computedSQL{sql: "?", args: []interface{}{computedNumberPattern}}
+		return sqlOf("(CASE WHEN %s ~ %s THEN TRIM(%s)::numeric END)", nil, text, pattern, text), nil
+	case "days_since":
+		if err := arity(1); err != nil {
+			return computedSQL{}, err
+		}
+		return sqlOf("EXTRACT(DAY FROM NOW() - NULLIF((%s)::text, '')::timestamptz)::int", nil, params[0]), nil
+	case "opens", "clicks":
+		// How many times the contact opened or clicked in the last days given
+		if err := arity(1); err != nil {
+			return computedSQL{}, err
+		}
+		event := EmailTrackingEventOpen
+		if name == "clicks" {
+			event = EmailTrackingEventClick
+		}
+		return sqlOf("(SELECT COUNT(*) FROM email_trackings et WHERE et.contact_id = contacts.id AND et.event = ? "+
+			"AND et.timestamp >= NOW() - (%s) * INTERVAL '1 day' AND et.automated = false AND et.is_deleted = false)",
+			[]interface{}{event}, params[0]), nil
+	}
+	return computedSQL{}, fmt.Errorf("unknown function %s()", name)
+}
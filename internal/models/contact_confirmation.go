@@ -0,0 +1,53 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// BeforeCreate holds new contacts of lists that require confirmation as PENDING, whatever status
+// they were given, until they confirm. Contacts that unsubscribed, bounced or complained keep
+// their status.
+func (c *Contact) BeforeCreate(tx *gorm.DB) error {
+	if err := c.Base.BeforeCreate(tx); err != nil {
+		return err
+	}
+	if c.Status != "" && c.Status != SubscriberStatusActive {
+		return nil
+	}
+
+	var requires bool
+	if err := tx.Session(&gorm.Session{NewDB: true}).Model(&MailingList{}).
+		Select("requires_confirmation").
+		Where("id = ?", c.ListID).
+		Scan(&requires).Error; err != nil {
+		return err
+	}
+	if requires {
+		c.Status = SubscriberStatusPending
+	}
+	return nil
+}
+
+// ConfirmContact makes a contact waiting for confirmation ACTIVE. It reports whether the contact
+// was confirmed now, confirming twice being a no-op.
+func ConfirmContact(contact *Contact, db *gorm.DB) (bool, error) {
+	if contact.Status != SubscriberStatusPending {
+		return false, nil
+	}
+
+	now := time.Now()
+	result := db.Model(&Contact{}).
+		Where("id = ? AND status = ?", contact.ID, SubscriberStatusPending).
+		Updates(map[string]interface{}{"status": SubscriberStatusActive, "confirmed_at": now})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+	contact.Status = SubscriberStatusActive
+	contact.ConfirmedAt = &now
+	return true, nil
+}
@@ -0,0 +1,69 @@
+package models
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// ContactImportSource is where an import reads its rows from
+type ContactImportSource string
+
+const (
+	ContactImportSourceFile         ContactImportSource = "FILE"          // an uploaded CSV or XLSX file
+	ContactImportSourceGoogleSheets ContactImportSource = "GOOGLE_SHEETS" // a Google Sheet shared by link
+)
+
+// MaxContactImportErrors caps the rows kept in an import's error report. Rows failing past it
+// are still counted.
+const MaxContactImportErrors = 10000
+
+// ErrContactImportNotValidated is returned when confirming an import that isn't a finished dry run
+var ErrContactImportNotValidated = errors.New("only validated dry runs can be confirmed")
+
+// ContactImportError is a row an import couldn't turn into a contact
+type ContactImportError struct {
+	Base
+	ImportID string `gorm:"type:uuid;not null;index" json:"importId"`
+	TeamID   string `gorm:"type:uuid;not null" json:"teamId"`
+	Row      int    `gorm:"not null" json:"row"` // as the spreadsheet numbers it, the header being row 1
+	Email    string `json:"email,omitempty"`
+	Message  string `gorm:"not null" json:"message"`
+}
+
+// GetContactImportErrors returns the error report of an import, in row order
+func GetContactImportErrors(importID string, db *gorm.DB) ([]ContactImportError, error) {
+	var rows []ContactImportError
+	err := db.Where("import_id = ? AND is_deleted = false", importID).Order("row").Find(&rows).Error
+	return rows, err
+}
+
+// ConfirmContactImport turns a validated dry run into an import of its rows. The counts and
+// error report of the dry run are cleared for the import's own; rows are read again, so a
+// Google Sheet edited since the dry run is imported as it is now.
+func ConfirmContactImport(contactImport *ContactImport, db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&ContactImport{}).
+			Where("id = ? AND status = ? AND dry_run = true", contactImport.ID, ContactImportStatusValidated).
+			UpdateColumns(map[string]interface{}{
+				"status":        ContactImportStatusPending,
+				"dry_run":       false,
+				"total_rows":    0,
+				"imported_rows": 0,
+				"updated_rows":  0,
+				"skipped_rows":  0,
+				"failed_rows":   0,
+				"error":         "",
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrContactImportNotValidated
+		}
+		if err := tx.Where("import_id = ?", contactImport.ID).Delete(&ContactImportError{}).Error; err != nil {
+			return err
+		}
+		return tx.First(contactImport, "id = ?", contactImport.ID).Error
+	})
+}
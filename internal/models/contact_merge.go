@@ -0,0 +1,210 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// ErrMergeSameContact is returned when a contact is merged into itself
+var ErrMergeSameContact = errors.New("can't merge a contact into itself")
+
+// ContactDuplicates are the team's contacts sharing an email address, oldest first
+type ContactDuplicates struct {
+	Email    string    `json:"email"`
+	Contacts []Contact `json:"contacts"`
+}
+
+// FindDuplicateContacts groups the team's contacts that share an email address, ignoring case,
+// whichever lists they're in
+func FindDuplicateContacts(teamID string, db *gorm.DB) ([]ContactDuplicates, error) {
+	var emails []string
+	if err := db.Model(&Contact{}).
+		Where("team_id = ? AND is_deleted = false", teamID).
+		Group("LOWER(email)").
+		Having("COUNT(*) > 1").
+		Order("LOWER(email)").
+		Pluck("LOWER(email)", &emails).Error; err != nil {
+		return nil, err
+	}
+	if len(emails) == 0 {
+		return []ContactDuplicates{}, nil
+	}
+
+	var contacts []Contact
+	if err := db.Where("team_id = ? AND LOWER(email) IN ? AND is_deleted = false", teamID, emails).
+		Order("created_at, id").
+		Find(&contacts).Error; err != nil {
+		return nil, err
+	}
+
+	groups := make(map[string]*ContactDuplicates, len(emails))
+	duplicates := make([]ContactDuplicates, len(emails))
+	for i, email := range emails {
+		duplicates[i].Email = email
+		groups[email] = &duplicates[i]
+	}
+	for _, contact := range contacts {
+		group := groups[strings.ToLower(contact.Email)]
+		group.Contacts = append(group.Contacts, contact)
+	}
+	return duplicates, nil
+}
+
+// MergeContacts folds the source contact into the target and deletes the source. The source's
+// emails, tracking history, tags and automation runs move to the target, its metadata keys the
+// target lacks are added and its blank profile fields are filled in. The target keeps its list.
+// A source that unsubscribed, bounced or complained passes that status on so it stays suppressed.
+func MergeContacts(teamID, targetID, sourceID string, db *gorm.DB) (*Contact, error) {
+	if targetID == sourceID {
+		return nil, ErrMergeSameContact
+	}
+
+	target := &Contact{}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		source := &Contact{}
+		if err := tx.Where("id = ? AND team_id = ? AND is_deleted = false", targetID, teamID).First(target).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("id = ? AND team_id = ? AND is_deleted = false", sourceID, teamID).First(source).Error; err != nil {
+			return err
+		}
+
+		updates := map[string]interface{}{}
+		for column, field := range map[string]struct {
+			target *string
+			source string
+		}{
+			"first_name": {&target.FirstName, source.FirstName},
+			"last_name":  {&target.LastName, source.LastName},
+			"linked_in":  {&target.LinkedIn, source.LinkedIn},
+			"twitter":    {&target.Twitter, source.Twitter},
+			"facebook":   {&target.Facebook, source.Facebook},
+			"instagram":  {&target.Instagram, source.Instagram},
+			"country":    {&target.Country, source.Country},
+			"phone":      {&target.Phone, source.Phone},
+			"city":       {&target.City, source.City},
+			"state":      {&target.State, source.State},
+			"zip":        {&target.Zip, source.Zip},
+			"address":    {&target.Address, source.Address},
+			"company":    {&target.Company, source.Company},
+			"locale":     {&target.Locale, source.Locale},
+			"timezone":   {&target.Timezone, source.Timezone},
+		} {
+			if *field.target == "" && field.source != "" {
+				*field.target = field.source
+				updates[column] = field.source
+			}
+		}
+		if target.Status == SubscriberStatusActive && source.Status != SubscriberStatusActive {
+			target.Status = source.Status
+			updates["status"] = source.Status
+		}
+		metadata, err := mergeContactMetadata(target.Metadata, source.Metadata)
+		if err != nil {
+			return err
+		}
+		target.Metadata = metadata
+		updates["metadata"] = metadata
+		if err := tx.Model(target).Updates(updates).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Exec(`INSERT INTO contact_tags (contact_id, tag_id)
+			SELECT ?, tag_id FROM contact_tags WHERE contact_id = ?
+			ON CONFLICT DO NOTHING`, target.ID, source.ID).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec("DELETE FROM contact_tags WHERE contact_id = ?", source.ID).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&Email{}).Where("contact_id = ?", source.ID).Update("contact_id", target.ID).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&EmailTracking{}).Where("contact_id = ?", source.ID).Update("contact_id", target.ID).Error; err != nil {
+			return err
+		}
+
+		// A contact runs through an automation once, so the source's runs of automations the
+		// target is already in are stopped rather than moved
+		if err := tx.Model(&AutomationRun{}).
+			Where("contact_id = ? AND automation_id NOT IN (?)", source.ID,
+				tx.Model(&AutomationRun{}).Select("automation_id").Where("contact_id = ?", target.ID)).
+			Update("contact_id", target.ID).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&AutomationRun{}).
+			Where("contact_id = ? AND status IN ?", source.ID, []AutomationRunStatus{AutomationRunStatusActive, AutomationRunStatusWaiting}).
+			Updates(map[string]interface{}{"status": AutomationRunStatusExited, "next_run_at": nil}).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(source).Updates(map[string]interface{}{"is_deleted": true, "deleted_at": time.Now()}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return target, nil
+}
+
+// mergeContactMetadata adds the source's metadata keys the target doesn't have
+func mergeContactMetadata(target, source datatypes.JSON) (datatypes.JSON, error) {
+	merged := map[string]interface{}{}
+	for _, raw := range []datatypes.JSON{source, target} {
+		if len(raw) == 0 {
+			continue
+		}
+		values := map[string]interface{}{}
+		if err := json.Unmarshal(raw, &values); err != nil {
+			return nil, err
+		}
+		for key, value := range values {
+			merged[key] = value
+		}
+	}
+	return json.Marshal(merged)
+}
+
+// DedupeContacts merges contacts repeated within the same list into the oldest of them, which
+// imports used to create. Contacts sharing an email across lists are left for the team to merge.
+// It returns how many contacts were merged away.
+func DedupeContacts(teamID string, db *gorm.DB) (int, error) {
+	var duplicates []struct {
+		ListID string
+		Email  string
+	}
+	if err := db.Model(&Contact{}).
+		Select("list_id, LOWER(email) AS email").
+		Where("team_id = ? AND is_deleted = false", teamID).
+		Group("list_id, LOWER(email)").
+		Having("COUNT(*) > 1").
+		Scan(&duplicates).Error; err != nil {
+		return 0, err
+	}
+
+	merged := 0
+	for _, duplicate := range duplicates {
+		var ids []string
+		if err := db.Model(&Contact{}).
+			Where("team_id = ? AND list_id = ? AND LOWER(email) = ? AND is_deleted = false", teamID, duplicate.ListID, duplicate.Email).
+			Order("created_at, id").
+			Pluck("id", &ids).Error; err != nil {
+			return merged, err
+		}
+		if len(ids) < 2 {
+			continue
+		}
+		for _, id := range ids[1:] {
+			if _, err := MergeContacts(teamID, ids[0], id, db); err != nil {
+				return merged, err
+			}
+			merged++
+		}
+	}
+	return merged, nil
+}
@@ -0,0 +1,223 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ContactPreference is whether an address of a team wants the emails of one of its marketing
+// categories. Preferences are kept per address, so they hold whichever of the team's lists it's on.
+type ContactPreference struct {
+	Base
+	TeamID     string         `gorm:"type:uuid;not null;uniqueIndex:idx_contact_preference" json:"teamId"`
+	Email      string         `gorm:"not null;uniqueIndex:idx_contact_preference" json:"email"` // lowercase
+	CategoryID string         `gorm:"type:uuid;not null;uniqueIndex:idx_contact_preference" json:"categoryId"`
+	Category   *EmailCategory `json:"category,omitempty"`
+	Subscribed bool           `gorm:"not null" json:"subscribed"`
+}
+
+// PreferenceList is one of the team's lists an address is on, as the preference center shows it
+type PreferenceList struct {
+	ID         string
+	Name       string
+	Subscribed bool
+	Pending    bool // waiting for the address to confirm
+}
+
+// PreferenceCategory is one of the team's marketing categories, as the preference center shows it
+type PreferenceCategory struct {
+	ID          string
+	Name        string
+	Description string
+	Subscribed  bool
+}
+
+// PreferenceCenter is what a recipient can change about what they're sent
+type PreferenceCenter struct {
+	Email      string
+	FirstName  string
+	LastName   string
+	Lists      []PreferenceList
+	Categories []PreferenceCategory
+}
+
+// PreferenceUpdate is what a recipient chose in the preference center
+type PreferenceUpdate struct {
+	FirstName      string
+	LastName       string
+	Lists          map[string]bool // list ID -> subscribed
+	Categories     map[string]bool // category ID -> subscribed
+	UnsubscribeAll bool
+}
+
+// addressContacts returns the contacts of the address on the team's lists
+func addressContacts(contact *Contact, db *gorm.DB) ([]Contact, error) {
+	var contacts []Contact
+	err := db.Preload("List").
+		Where("team_id = ? AND LOWER(email) = ? AND is_deleted = false", contact.TeamID, strings.ToLower(contact.Email)).
+		Order("created_at").
+		Find(&contacts).Error
+	return contacts, err
+}
+
+// GetPreferenceCenter returns the lists the contact's address is on and the team's marketing
+// categories, with what the address is subscribed to. Lists it bounced or complained on aren't
+// offered, as they can't be subscribed to again from here.
+func GetPreferenceCenter(contact *Contact, db *gorm.DB) (*PreferenceCenter, error) {
+	contacts, err := addressContacts(contact, db)
+	if err != nil {
+		return nil, err
+	}
+
+	center := &PreferenceCenter{
+		Email:      contact.Email,
+		FirstName:  contact.FirstName,
+		LastName:   contact.LastName,
+		Lists:      []PreferenceList{},
+		Categories: []PreferenceCategory{},
+	}
+	for _, c := range contacts {
+		if c.List == nil || c.List.IsDeleted {
+			continue
+		}
+		switch c.Status {
+		case SubscriberStatusActive, SubscriberStatusPending, SubscriberStatusUnsubscribed:
+			center.Lists = append(center.Lists, PreferenceList{
+				ID:         c.ListID,
+				Name:       c.List.Name,
+				Subscribed: c.Status != SubscriberStatusUnsubscribed,
+				Pending:    c.Status == SubscriberStatusPending,
+			})
+		}
+	}
+
+	var categories []EmailCategory
+	if err := db.Where("team_id = ? AND marketing = true AND is_deleted = false", contact.TeamID).
+		Order("name").Find(&categories).Error; err != nil {
+		return nil, err
+	}
+	optedOut, err := optedOutCategories(contact.TeamID, contact.Email, db)
+	if err != nil {
+		return nil, err
+	}
+	for _, category := range categories {
+		center.Categories = append(center.Categories, PreferenceCategory{
+			ID:          category.ID,
+			Name:        category.Name,
+			Description: category.Description,
+			Subscribed:  !optedOut[category.ID],
+		})
+	}
+
+	return center, nil
+}
+
+// optedOutCategories returns the categories the address doesn't want
+func optedOutCategories(teamID, email string, db *gorm.DB) (map[string]bool, error) {
+	var ids []string
+	if err := db.Model(&ContactPreference{}).
+		Where("team_id = ? AND email = ? AND subscribed = false AND is_deleted = false", teamID, strings.ToLower(email)).
+		Pluck("category_id", &ids).Error; err != nil {
+		return nil, err
+	}
+	optedOut := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		optedOut[id] = true
+	}
+	return optedOut, nil
+}
+
+// UpdatePreferences saves what a recipient chose in the preference center. Their name is changed
+// on every list they're on. It returns the IDs of the contacts unsubscribed by the update.
+func UpdatePreferences(contact *Contact, update PreferenceUpdate, db *gorm.DB) ([]string, error) {
+	center, err := GetPreferenceCenter(contact, db)
+	if err != nil {
+		return nil, err
+	}
+	contacts, err := addressContacts(contact, db)
+	if err != nil {
+		return nil, err
+	}
+
+	var unsubscribed []string
+	err = db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		for _, c := range contacts {
+			updates := map[string]interface{}{
+				"first_name":             strings.TrimSpace(update.FirstName),
+				"last_name":              strings.TrimSpace(update.LastName),
+				"preferences_updated_at": now,
+			}
+
+			subscribed, listed := update.Lists[c.ListID]
+			switch {
+			case c.Status != SubscriberStatusActive && c.Status != SubscriberStatusPending && c.Status != SubscriberStatusUnsubscribed:
+				// Bounced and complained addresses stay as they are
+			case update.UnsubscribeAll || (listed && !subscribed):
+				if c.Status != SubscriberStatusUnsubscribed {
+					updates["status"] = SubscriberStatusUnsubscribed
+					unsubscribed = append(unsubscribed, c.ID)
+				}
+			case listed && subscribed && c.Status == SubscriberStatusUnsubscribed:
+				// Following a link sent to the address is as good as confirming it
+				updates["status"] = SubscriberStatusActive
+				updates["confirmed_at"] = now
+			}
+
+			if err := tx.Model(&Contact{}).Where("id = ?", c.ID).Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+
+		// Only the team's marketing categories can be opted out of
+		email := strings.ToLower(contact.Email)
+		for _, category := range center.Categories {
+			subscribed, chosen := update.Categories[category.ID]
+			if !chosen {
+				continue
+			}
+			preference := &ContactPreference{TeamID: contact.TeamID, Email: email, CategoryID: category.ID, Subscribed: subscribed}
+			if err := tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "team_id"}, {Name: "email"}, {Name: "category_id"}},
+				DoUpdates: clause.Assignments(map[string]interface{}{"subscribed": subscribed, "updated_at": now}),
+			}).Create(preference).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return unsubscribed, nil
+}
+
+// CategoryOptOuts returns which of the addresses opted out of the category, by lowercase address
+func CategoryOptOuts(teamID, categoryID string, addresses []string, db *gorm.DB) (map[string]bool, error) {
+	optedOut := map[string]bool{}
+	if categoryID == "" || len(addresses) == 0 {
+		return optedOut, nil
+	}
+
+	lowered := make([]string, len(addresses))
+	for i, address := range addresses {
+		lowered[i] = strings.ToLower(address)
+	}
+
+	for start := 0; start < len(lowered); start += sendTimeChunk {
+		var emails []string
+		if err := db.Model(&ContactPreference{}).
+			Where("team_id = ? AND category_id = ? AND subscribed = false AND is_deleted = false AND email IN ?",
+				teamID, categoryID, lowered[start:min(start+sendTimeChunk, len(lowered))]).
+			Pluck("email", &emails).Error; err != nil {
+			return nil, err
+		}
+		for _, email := range emails {
+			optedOut[email] = true
+		}
+	}
+	return optedOut, nil
+}
@@ -0,0 +1,102 @@
+package models
+
+import (
+	"fmt"
+	"kori/internal/utils/crypto"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// ContactSyncFormat represents the format of a remote contact feed
+type ContactSyncFormat string
+
+const (
+	ContactSyncFormatCSV  ContactSyncFormat = "CSV"
+	ContactSyncFormatJSON ContactSyncFormat = "JSON"
+)
+
+// ContactSyncStatus represents the outcome of the last sync run
+type ContactSyncStatus string
+
+const (
+	ContactSyncStatusPending ContactSyncStatus = "PENDING"
+	ContactSyncStatusSuccess ContactSyncStatus = "SUCCESS"
+	ContactSyncStatusFailed  ContactSyncStatus = "FAILED"
+)
+
+// ContactSyncSource is a remote CSV/JSON feed that is periodically mirrored into a mailing list
+type ContactSyncSource struct {
+	Base
+	Name            string            `gorm:"not null" json:"name" validate:"required,min=2"`
+	URL             string            `gorm:"not null" json:"url" validate:"required,url"`
+	Format          ContactSyncFormat `gorm:"not null;default:'CSV'" json:"format" validate:"required,oneof=CSV JSON"`
+	AuthHeader      string            `json:"authHeader" validate:"omitempty" audit:"redact"`
+	AuthValue       string            `json:"authValue" validate:"omitempty" audit:"redact"`
+	FieldsMap       datatypes.JSON    `gorm:"type:jsonb;default:'{}'" json:"fieldsMap" validate:"required,json"`
+	IntervalMinutes int               `gorm:"not null;default:60" json:"intervalMinutes" validate:"omitempty,min=15"`
+	RemoveMissing   bool              `gorm:"not null;default:false" json:"removeMissing"`
+	IsActive        bool              `gorm:"not null;default:true" json:"isActive"`
+	LastSyncedAt    *time.Time        `json:"lastSyncedAt,omitempty"`
+	LastStatus      ContactSyncStatus `gorm:"not null;default:'PENDING'" json:"lastStatus"`
+	LastError       string            `json:"lastError"`
+	LastCreated     int               `gorm:"not null;default:0" json:"lastCreated"`
+	LastUpdated     int               `gorm:"not null;default:0" json:"lastUpdated"`
+	LastRemoved     int               `gorm:"not null;default:0" json:"lastRemoved"`
+	ListID          string            `gorm:"type:uuid;not null" json:"listId" validate:"required,uuid"`
+	List            *MailingList      `json:"list,omitempty"`
+	TeamID          string            `gorm:"type:uuid;not null" json:"teamId" validate:"required,uuid"`
+	Team            *Team             `json:"team,omitempty"`
+}
+
+// IsDue reports whether the source should be synced at the given time
+func (s *ContactSyncSource) IsDue(now time.Time) bool {
+	if !s.IsActive {
+		return false
+	}
+	if s.LastSyncedAt == nil {
+		return true
+	}
+	return !s.LastSyncedAt.Add(time.Duration(s.IntervalMinutes) * time.Minute).After(now)
+}
+
+func (s *ContactSyncSource) BeforeCreate(tx *gorm.DB) error {
+	if s.ID == "" {
+		s.ID = uuid.New().String()
+	}
+	value, err := crypto.Encrypt(s.AuthValue)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt auth value: %w", err)
+	}
+	s.AuthValue = value
+	return nil
+}
+
+func (s *ContactSyncSource) BeforeUpdate(tx *gorm.DB) error {
+	value, err := crypto.Encrypt(s.AuthValue)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt auth value: %w", err)
+	}
+	s.AuthValue = value
+	return nil
+}
+
+func (s *ContactSyncSource) AfterFind(tx *gorm.DB) error {
+	value, err := crypto.Decrypt(s.AuthValue)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt auth value: %w", err)
+	}
+	s.AuthValue = value
+	return nil
+}
+
+// GetContactSyncSourceByID retrieves a contact sync source by its ID
+func GetContactSyncSourceByID(id string, db *gorm.DB) (*ContactSyncSource, error) {
+	source := &ContactSyncSource{}
+	if err := db.Where("id = ? AND is_deleted = false", id).First(source).Error; err != nil {
+		return nil, err
+	}
+	return source, nil
+}
@@ -0,0 +1,208 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// MaxContactTimelineEntries caps the entries of a timeline export; the export says when it was cut short
+const MaxContactTimelineEntries = 50000
+
+type ContactTimelineExportFormat string
+
+const (
+	ContactTimelineExportPDF ContactTimelineExportFormat = "PDF"
+	ContactTimelineExportCSV ContactTimelineExportFormat = "CSV"
+)
+
+type ContactTimelineExportStatus string
+
+const (
+	ContactTimelineExportStatusPending    ContactTimelineExportStatus = "PENDING"
+	ContactTimelineExportStatusProcessing ContactTimelineExportStatus = "PROCESSING"
+	ContactTimelineExportStatusCompleted  ContactTimelineExportStatus = "COMPLETED"
+	ContactTimelineExportStatusFailed     ContactTimelineExportStatus = "FAILED"
+)
+
+// ContactTimelineExport is a request for every communication and consent event with a contact's
+// address, e.g. for legal discovery. The file is signed with the server key so it can be shown
+// not to have been changed after it was produced.
+type ContactTimelineExport struct {
+	Base
+	ContactID     string                      `gorm:"type:uuid;not null;index" json:"contactId"`
+	Email         string                      `gorm:"not null" json:"email"` // the address the timeline covers, on every list
+	TeamID        string                      `gorm:"type:uuid;not null;index" json:"teamId"`
+	RequestedByID string                      `gorm:"type:uuid;default:NULL" json:"requestedById,omitempty"`
+	Format        ContactTimelineExportFormat `gorm:"not null" json:"format"`
+	Reason        string                      `json:"reason,omitempty"` // e.g. the case or ticket reference
+	Status        ContactTimelineExportStatus `gorm:"not null;default:'PENDING'" json:"status"`
+	Path          string                      `json:"-"`                  // storage key of the export file
+	Checksum      string                      `json:"checksum,omitempty"` // SHA-256 of the file, hex encoded
+	Signature     string                      `json:"signature,omitempty"`
+	Entries       int                         `gorm:"not null;default:0" json:"entries"`
+	Truncated     bool                        `gorm:"not null;default:false" json:"truncated"`
+	Error         string                      `json:"error,omitempty"`
+	CompletedAt   *time.Time                  `json:"completedAt,omitempty"`
+}
+
+// ContactTimelineEntry is one thing that happened between the team and a contact's address
+type ContactTimelineEntry struct {
+	At          time.Time `json:"at"`
+	Category    string    `json:"category"` // list, email, engagement, consent, sms or automation
+	Event       string    `json:"event"`
+	Description string    `json:"description"`
+	Reference   string    `json:"reference,omitempty"` // ID of the contact, email, text message or run the entry comes from
+}
+
+// GetContactTimeline collects the timeline of an address across the team's lists, oldest first
+func GetContactTimeline(teamID, address string, db *gorm.DB) ([]ContactTimelineEntry, bool, error) {
+	address = strings.ToLower(strings.TrimSpace(address))
+	var entries []ContactTimelineEntry
+
+	var contacts []Contact
+	if err := db.Preload("List").
+		Where("team_id = ? AND LOWER(email) = ?", teamID, address).
+		Order("created_at ASC").
+		Find(&contacts).Error; err != nil {
+		return nil, false, fmt.Errorf("failed to get contacts: %w", err)
+	}
+	contactIDs := make([]string, len(contacts))
+	for i, contact := range contacts {
+		contactIDs[i] = contact.ID
+		list := contact.ListID
+		if contact.List != nil {
+			list = contact.List.Name
+		}
+		event, description := "added", fmt.Sprintf("Added to list %s", list)
+		if contact.ImportID != "" {
+			event, description = "imported", fmt.Sprintf("Imported to list %s (import %s)", list, contact.ImportID)
+		}
+		entries = append(entries, ContactTimelineEntry{At: contact.CreatedAt, Category: "list", Event: event, Description: description, Reference: contact.ID})
+		if contact.Status != SubscriberStatusActive {
+			// Only the current status is kept, so this is as of the contact's last change
+			entries = append(entries, ContactTimelineEntry{
+				At:          contact.UpdatedAt,
+				Category:    "consent",
+				Event:       "status." + strings.ToLower(string(contact.Status)),
+				Description: fmt.Sprintf("Marked %s on list %s", strings.ToLower(string(contact.Status)), list),
+				Reference:   contact.ID,
+			})
+		}
+		if contact.IsDeleted {
+			entries = append(entries, ContactTimelineEntry{At: contact.UpdatedAt, Category: "list", Event: "deleted", Description: fmt.Sprintf("Deleted from list %s", list), Reference: contact.ID})
+		}
+	}
+
+	var emails []Email
+	if err := db.Select("id", "subject", "status", "campaign_id", "automation_id", "sent_at", "created_at", "test").
+		Where(`team_id = ? AND LOWER("to") = ?`, teamID, address).
+		Order("created_at ASC").
+		Limit(MaxContactTimelineEntries).
+		Find(&emails).Error; err != nil {
+		return nil, false, fmt.Errorf("failed to get emails: %w", err)
+	}
+	emailIDs := make([]string, len(emails))
+	subjects := make(map[string]string, len(emails))
+	for i, email := range emails {
+		emailIDs[i] = email.ID
+		subjects[email.ID] = email.Subject
+		at := email.CreatedAt
+		if !email.SentAt.IsZero() {
+			at = email.SentAt
+		}
+		description := fmt.Sprintf("%q", email.Subject)
+		switch {
+		case email.CampaignID != "":
+			description += " from campaign " + email.CampaignID
+		case email.AutomationID != "":
+			description += " from automation " + email.AutomationID
+		case email.Test:
+			description += " (test send)"
+		}
+		entries = append(entries, ContactTimelineEntry{
+			At:          at,
+			Category:    "email",
+			Event:       "email." + strings.ToLower(string(email.Status)),
+			Description: description,
+			Reference:   email.ID,
+		})
+	}
+
+	if len(emailIDs) > 0 {
+		var trackings []EmailTracking
+		if err := db.Select("email_id", "event", "timestamp", "url", "automated").
+			Where("email_id IN ?", emailIDs).
+			Order("timestamp ASC").
+			Limit(MaxContactTimelineEntries).
+			Find(&trackings).Error; err != nil {
+			return nil, false, fmt.Errorf("failed to get tracking events: %w", err)
+		}
+		for _, tracking := range trackings {
+			category := "engagement"
+			if tracking.Event == EmailTrackingEventUnsubscribe || tracking.Event == EmailTrackingEventComplaint {
+				category = "consent"
+			}
+			description := fmt.Sprintf("%s on %q", tracking.Event, subjects[tracking.EmailID])
+			if tracking.URL != "" {
+				description += " to " + tracking.URL
+			}
+			if tracking.Automated {
+				description += " (automated)"
+			}
+			entries = append(entries, ContactTimelineEntry{At: tracking.Timestamp, Category: category, Event: string(tracking.Event), Description: description, Reference: tracking.EmailID})
+		}
+
+		var texts []SMSMessage
+		if err := db.Select("id", "email_id", "to", "status", "error", "sent_at", "created_at").
+			Where("email_id IN ?", emailIDs).
+			Order("created_at ASC").
+			Find(&texts).Error; err != nil {
+			return nil, false, fmt.Errorf("failed to get sms messages: %w", err)
+		}
+		for _, text := range texts {
+			at := text.CreatedAt
+			if text.SentAt != nil {
+				at = *text.SentAt
+			}
+			description := fmt.Sprintf("Fallback text to %s for %q", text.To, subjects[text.EmailID])
+			if text.Status == SMSMessageStatusFailed && text.Error != "" {
+				description += ": " + text.Error
+			}
+			entries = append(entries, ContactTimelineEntry{
+				At:          at,
+				Category:    "sms",
+				Event:       "sms." + strings.ToLower(string(text.Status)),
+				Description: description,
+				Reference:   text.ID,
+			})
+		}
+	}
+
+	if len(contactIDs) > 0 {
+		var runs []AutomationRun
+		if err := db.Preload("Automation").Where("contact_id IN ?", contactIDs).Order("created_at ASC").Find(&runs).Error; err != nil {
+			return nil, false, fmt.Errorf("failed to get automation runs: %w", err)
+		}
+		for _, run := range runs {
+			name := run.AutomationID
+			if run.Automation != nil {
+				name = run.Automation.Name
+			}
+			entries = append(entries, ContactTimelineEntry{At: run.CreatedAt, Category: "automation", Event: "enrolled", Description: "Enrolled in automation " + name, Reference: run.ID})
+			if run.OptedOutAt != nil {
+				entries = append(entries, ContactTimelineEntry{At: *run.OptedOutAt, Category: "consent", Event: "automation.opt_out", Description: "Opted out of automation " + name, Reference: run.ID})
+			}
+		}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].At.Before(entries[j].At) })
+	truncated := len(entries) > MaxContactTimelineEntries || len(emails) == MaxContactTimelineEntries
+	if truncated {
+		entries = entries[:MaxContactTimelineEntries]
+	}
+	return entries, truncated, nil
+}
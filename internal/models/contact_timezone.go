@@ -0,0 +1,146 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// countryTimezones maps ISO 3166 country codes to the timezone most of the country's people
+// live in. Countries spanning several timezones are better served by an explicit timezone.
+var countryTimezones = map[string]string{
+	"AE": "Asia/Dubai", "AR": "America/Argentina/Buenos_Aires", "AT": "Europe/Vienna",
+	"AU": "Australia/Sydney", "BD": "Asia/Dhaka", "BE": "Europe/Brussels", "BG": "Europe/Sofia",
+	"BR": "America/Sao_Paulo", "CA": "America/Toronto", "CH": "Europe/Zurich", "CL": "America/Santiago",
+	"CN": "Asia/Shanghai", "CO": "America/Bogota", "CZ": "Europe/Prague", "DE": "Europe/Berlin",
+	"DK": "Europe/Copenhagen", "EG": "Africa/Cairo", "ES": "Europe/Madrid", "FI": "Europe/Helsinki",
+	"FR": "Europe/Paris", "GB": "Europe/London", "GR": "Europe/Athens", "HK": "Asia/Hong_Kong",
+	"HU": "Europe/Budapest", "ID": "Asia/Jakarta", "IE": "Europe/Dublin", "IL": "Asia/Jerusalem",
+	"IN": "Asia/Kolkata", "IT": "Europe/Rome", "JP": "Asia/Tokyo", "KE": "Africa/Nairobi",
+	"KR": "Asia/Seoul", "MX": "America/Mexico_City", "MY": "Asia/Kuala_Lumpur", "NG": "Africa/Lagos",
+	"NL": "Europe/Amsterdam", "NO": "Europe/Oslo", "NZ": "Pacific/Auckland", "PE": "America/Lima",
+	"PH": "Asia/Manila", "PK": "Asia/Karachi", "PL": "Europe/Warsaw", "PT": "Europe/Lisbon",
+	"RO": "Europe/Bucharest", "RU": "Europe/Moscow", "SA": "Asia/Riyadh", "SE": "Europe/Stockholm",
+	"SG": "Asia/Singapore", "TH": "Asia/Bangkok", "TR": "Europe/Istanbul", "TW": "Asia/Taipei",
+	"UA": "Europe/Kyiv", "US": "America/New_York", "VN": "Asia/Ho_Chi_Minh", "ZA": "Africa/Johannesburg",
+}
+
+// countryNames maps the English names contacts and geolocation lookups use to country codes
+var countryNames = map[string]string{
+	"argentina": "AR", "australia": "AU", "austria": "AT", "bangladesh": "BD", "belgium": "BE",
+	"brazil": "BR", "bulgaria": "BG", "canada": "CA", "chile": "CL", "china": "CN", "colombia": "CO",
+	"czechia": "CZ", "czech republic": "CZ", "denmark": "DK", "egypt": "EG", "finland": "FI",
+	"france": "FR", "germany": "DE", "greece": "GR", "hong kong": "HK", "hungary": "HU", "india": "IN",
+	"indonesia": "ID", "ireland": "IE", "israel": "IL", "italy": "IT", "japan": "JP", "kenya": "KE",
+	"south korea": "KR", "korea": "KR", "malaysia": "MY", "mexico": "MX", "netherlands": "NL",
+	"new zealand": "NZ", "nigeria": "NG", "norway": "NO", "pakistan": "PK", "peru": "PE",
+	"philippines": "PH", "poland": "PL", "portugal": "PT", "romania": "RO", "russia": "RU",
+	"saudi arabia": "SA", "singapore": "SG", "south africa": "ZA", "spain": "ES", "sweden": "SE",
+	"switzerland": "CH", "taiwan": "TW", "thailand": "TH", "turkey": "TR", "ukraine": "UA",
+	"united arab emirates": "AE", "united kingdom": "GB", "uk": "GB", "united states": "US",
+	"united states of america": "US", "usa": "US", "vietnam": "VN",
+}
+
+// CountryTimezone returns the timezone of a country given by code or English name, or "" when
+// it isn't known
+func CountryTimezone(country string) string {
+	country = strings.TrimSpace(country)
+	if code, ok := countryNames[strings.ToLower(country)]; ok {
+		country = code
+	}
+	return countryTimezones[strings.ToUpper(country)]
+}
+
+// ContactTimezone returns the contact's own timezone, or that of their country, or "" when neither is known
+func (c *Contact) ContactTimezone() string {
+	if c.Timezone != "" {
+		if _, err := time.LoadLocation(c.Timezone); err == nil {
+			return c.Timezone
+		}
+	}
+	return CountryTimezone(c.Country)
+}
+
+// GetContactLocations returns the timezone each contact is in: their own, their country's, or the
+// one of the country they open and click email from most. Contacts whose timezone can't be told
+// get the fallback.
+func GetContactLocations(contacts []Contact, fallback *time.Location, db *gorm.DB) (map[string]*time.Location, error) {
+	locations := make(map[string]*time.Location, len(contacts))
+	loaded := make(map[string]*time.Location)
+	load := func(name string) *time.Location {
+		if loc, ok := loaded[name]; ok {
+			return loc
+		}
+		loc, err := time.LoadLocation(name)
+		if err != nil {
+			loc = nil
+		}
+		loaded[name] = loc
+		return loc
+	}
+
+	var unknown []string
+	for _, contact := range contacts {
+		if name := contact.ContactTimezone(); name != "" {
+			if loc := load(name); loc != nil {
+				locations[contact.ID] = loc
+				continue
+			}
+		}
+		unknown = append(unknown, contact.ID)
+	}
+
+	// Detect the rest from where their engagement comes from
+	for start := 0; start < len(unknown); start += sendTimeChunk {
+		chunk := unknown[start:min(start+sendTimeChunk, len(unknown))]
+
+		var rows []struct {
+			ContactID string
+			Country   string
+			Count     int
+		}
+		if err := db.Model(&EmailTracking{}).
+			Select("contact_id, country, COUNT(*) AS count").
+			Where("contact_id IN ? AND event IN ? AND automated = false AND is_deleted = false", chunk,
+				[]EmailTrackingEvent{EmailTrackingEventOpen, EmailTrackingEventClick}).
+			Where("country <> '' AND country <> 'Unknown'").
+			Group("contact_id, country").
+			Order("count DESC").
+			Scan(&rows).Error; err != nil {
+			return nil, fmt.Errorf("failed to get contact engagement countries: %w", err)
+		}
+		for _, row := range rows {
+			if _, ok := locations[row.ContactID]; ok {
+				continue
+			}
+			if name := CountryTimezone(row.Country); name != "" {
+				if loc := load(name); loc != nil {
+					locations[row.ContactID] = loc
+				}
+			}
+		}
+	}
+
+	for _, id := range unknown {
+		if _, ok := locations[id]; !ok {
+			locations[id] = fallback
+		}
+	}
+	return locations, nil
+}
+
+// NextLocalTime returns the first time at or after from that the clock reads clock ("15:04") in loc
+func NextLocalTime(from time.Time, clock string, loc *time.Location) (time.Time, error) {
+	at, err := time.Parse("15:04", clock)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid local send time %q, expected HH:MM", clock)
+	}
+	local := from.In(loc)
+	next := time.Date(local.Year(), local.Month(), local.Day(), at.Hour(), at.Minute(), 0, 0, loc)
+	if next.Before(from) {
+		next = time.Date(local.Year(), local.Month(), local.Day()+1, at.Hour(), at.Minute(), 0, 0, loc)
+	}
+	return next, nil
+}
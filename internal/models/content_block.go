@@ -0,0 +1,395 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"regexp"
+	"strings"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// ContentBlockRuleType is what a content block targeting rule matches on
+type ContentBlockRuleType string
+
+const (
+	ContentBlockRuleSegment  ContentBlockRuleType = "segment"
+	ContentBlockRuleCountry  ContentBlockRuleType = "country"
+	ContentBlockRuleField    ContentBlockRuleType = "field"
+	ContentBlockRuleMetadata ContentBlockRuleType = "metadata"
+)
+
+var (
+	// contentBlockRe matches block placeholders such as {{ block:hero }}
+	contentBlockRe    = regexp.MustCompile(`{{\s*block:([A-Za-z0-9_\-]+)\s*}}`)
+	contentBlockKeyRe = regexp.MustCompile(`^[A-Za-z0-9_\-]+$`)
+)
+
+// ContentBlock is a named, reusable section of a template with several variants. Templates
+// reference it as {{ block:key }} and each contact gets one variant when the email is rendered.
+type ContentBlock struct {
+	Base
+	Name     string                `gorm:"not null" json:"name" validate:"required,min=2"`
+	Key      string                `gorm:"not null;uniqueIndex:idx_content_block_team_key" json:"key" validate:"required,min=1,max=64"`
+	TeamID   string                `gorm:"type:uuid;not null;uniqueIndex:idx_content_block_team_key" json:"teamId" validate:"required,uuid"`
+	Team     *Team                 `json:"team,omitempty"`
+	Variants []ContentBlockVariant `gorm:"foreignKey:BlockID" json:"variants,omitempty"`
+}
+
+// ContentBlockVariant is one version of a content block. Variants with rules go to the contacts
+// matching all of them, first match by position wins; everyone else gets a random pick among
+// the variants without rules, weighted by Weight.
+type ContentBlockVariant struct {
+	Base
+	Name     string         `gorm:"not null" json:"name" validate:"required,min=1"`
+	BlockID  string         `gorm:"type:uuid;not null;index" json:"blockId" validate:"omitempty,uuid"`
+	Block    *ContentBlock  `json:"block,omitempty"`
+	Content  string         `gorm:"not null;default:''" json:"content"`
+	Rules    datatypes.JSON `gorm:"type:jsonb;not null;default:'[]'" json:"rules" validate:"omitempty,json"`
+	Weight   int            `gorm:"not null;default:1" json:"weight" validate:"min=0"`
+	Position int            `gorm:"not null;default:0" json:"position"`
+	TeamID   string         `gorm:"type:uuid;not null" json:"teamId" validate:"omitempty,uuid"`
+	Team     *Team          `json:"team,omitempty"`
+}
+
+// ContentBlockRule targets a variant at contacts: a segment (Value is the segment ID), a country,
+// a contact field or a metadata key
+type ContentBlockRule struct {
+	Type  ContentBlockRuleType `json:"type"`
+	Field string               `json:"field,omitempty"`
+	Op    string               `json:"op,omitempty"` // eq (default), neq, in, contains
+	Value interface{}          `json:"value"`
+}
+
+// ContentVariantStats is the engagement of one content block variant
+type ContentVariantStats struct {
+	VariantID string         `json:"variantId"`
+	Name      string         `json:"name"`
+	Stats     *CampaignStats `json:"stats"`
+	OpenRate  float64        `json:"openRate"`
+	ClickRate float64        `json:"clickRate"`
+}
+
+func (v *ContentBlockVariant) BeforeSave(tx *gorm.DB) error {
+	rules, err := v.ParseRules()
+	if err != nil {
+		return err
+	}
+	for _, rule := range rules {
+		switch rule.Type {
+		case ContentBlockRuleSegment, ContentBlockRuleCountry, ContentBlockRuleMetadata:
+		case ContentBlockRuleField:
+			if _, ok := segmentFieldColumns[rule.Field]; !ok {
+				return fmt.Errorf("unknown contact field %q", rule.Field)
+			}
+		default:
+			return fmt.Errorf("unknown content block rule type %q", rule.Type)
+		}
+		if rule.Type == ContentBlockRuleMetadata && rule.Field == "" {
+			return fmt.Errorf("metadata rules need a field")
+		}
+	}
+	return nil
+}
+
+func (v *ContentBlockVariant) BeforeCreate(tx *gorm.DB) error {
+	if err := v.Base.BeforeCreate(tx); err != nil {
+		return err
+	}
+	if v.TeamID == "" {
+		var block ContentBlock
+		if err := tx.Session(&gorm.Session{NewDB: true}).Select("id", "team_id").Where("id = ?", v.BlockID).First(&block).Error; err != nil {
+			return fmt.Errorf("content block not found")
+		}
+		v.TeamID = block.TeamID
+	}
+	return nil
+}
+
+func (b *ContentBlock) BeforeSave(tx *gorm.DB) error {
+	if !contentBlockKeyRe.MatchString(b.Key) {
+		return fmt.Errorf("content block key may only contain letters, digits, '-' and '_'")
+	}
+	return nil
+}
+
+func (b *ContentBlock) BeforeCreate(tx *gorm.DB) error {
+	if err := b.Base.BeforeCreate(tx); err != nil {
+		return err
+	}
+	for i := range b.Variants {
+		b.Variants[i].TeamID = b.TeamID
+	}
+	return nil
+}
+
+// ParseRules decodes the variant's targeting rules
+func (v *ContentBlockVariant) ParseRules() ([]ContentBlockRule, error) {
+	var rules []ContentBlockRule
+	if len(v.Rules) == 0 {
+		return rules, nil
+	}
+	if err := json.Unmarshal(v.Rules, &rules); err != nil {
+		return nil, fmt.Errorf("failed to parse content block rules: %w", err)
+	}
+	return rules, nil
+}
+
+// ContentBlockKeys returns the block keys referenced in the given html
+func ContentBlockKeys(html ...string) []string {
+	seen := make(map[string]bool)
+	var keys []string
+	for _, h := range html {
+		for _, match := range contentBlockRe.FindAllStringSubmatch(h, -1) {
+			if !seen[match[1]] {
+				seen[match[1]] = true
+				keys = append(keys, match[1])
+			}
+		}
+	}
+	return keys
+}
+
+// ContentBlockRenderer picks a variant of every content block for each contact
+type ContentBlockRenderer struct {
+	blocks   map[string]*ContentBlock
+	rules    map[string][]ContentBlockRule
+	segments map[string]map[string]bool // segment ID -> member contact IDs
+}
+
+// NewContentBlockRenderer loads the team's blocks used in the html and the segment
+// membership of the contacts about to be rendered
+func NewContentBlockRenderer(teamID string, html []string, contactIDs []string, db *gorm.DB) (*ContentBlockRenderer, error) {
+	r := &ContentBlockRenderer{
+		blocks:   make(map[string]*ContentBlock),
+		rules:    make(map[string][]ContentBlockRule),
+		segments: make(map[string]map[string]bool),
+	}
+
+	keys := ContentBlockKeys(html...)
+	if len(keys) == 0 {
+		return r, nil
+	}
+
+	var blocks []ContentBlock
+	if err := db.Preload("Variants", func(tx *gorm.DB) *gorm.DB {
+		return tx.Where("is_deleted = false").Order("position ASC, created_at ASC")
+	}).Where("team_id = ? AND key IN ? AND is_deleted = false", teamID, keys).Find(&blocks).Error; err != nil {
+		return nil, fmt.Errorf("failed to get content blocks: %w", err)
+	}
+
+	segmentIDs := make(map[string]bool)
+	for i := range blocks {
+		r.blocks[blocks[i].Key] = &blocks[i]
+		for _, variant := range blocks[i].Variants {
+			rules, err := variant.ParseRules()
+			if err != nil {
+				return nil, err
+			}
+			r.rules[variant.ID] = rules
+			for _, rule := range rules {
+				if rule.Type == ContentBlockRuleSegment {
+					segmentIDs[fmt.Sprint(rule.Value)] = true
+				}
+			}
+		}
+	}
+
+	for segmentID := range segmentIDs {
+		members := make(map[string]bool)
+		r.segments[segmentID] = members
+		if len(contactIDs) == 0 {
+			continue
+		}
+
+		segment, err := GetSegmentByID(segmentID, db)
+		if err != nil {
+			// A deleted segment simply matches nobody
+			continue
+		}
+		query, err := segment.Apply(db.Table("contacts").Where("contacts.id IN ? AND contacts.is_deleted = false", contactIDs))
+		if err != nil {
+			return nil, fmt.Errorf("failed to apply segment %s: %w", segmentID, err)
+		}
+		var ids []string
+		if err := query.Pluck("contacts.id", &ids).Error; err != nil {
+			return nil, fmt.Errorf("failed to get segment members: %w", err)
+		}
+		for _, id := range ids {
+			members[id] = true
+		}
+	}
+
+	return r, nil
+}
+
+// Render replaces every block placeholder with the contact's variant and returns which
+// variant was picked for each block. A nil contact only gets untargeted variants.
+func (r *ContentBlockRenderer) Render(html string, contact *Contact) (string, map[string]string) {
+	picked := make(map[string]string)
+	rendered := contentBlockRe.ReplaceAllStringFunc(html, func(match string) string {
+		key := contentBlockRe.FindStringSubmatch(match)[1]
+		block, ok := r.blocks[key]
+		if !ok {
+			return ""
+		}
+
+		// The same block used twice in an email shows the same variant
+		if id, ok := picked[key]; ok {
+			for _, variant := range block.Variants {
+				if variant.ID == id {
+					return variant.Content
+				}
+			}
+		}
+
+		variant := r.choose(block, contact)
+		if variant == nil {
+			return ""
+		}
+		picked[key] = variant.ID
+		return variant.Content
+	})
+	return rendered, picked
+}
+
+func (r *ContentBlockRenderer) choose(block *ContentBlock, contact *Contact) *ContentBlockVariant {
+	var fallback []*ContentBlockVariant
+	totalWeight := 0
+	for i := range block.Variants {
+		variant := &block.Variants[i]
+		rules := r.rules[variant.ID]
+		if len(rules) == 0 {
+			if variant.Weight > 0 {
+				fallback = append(fallback, variant)
+				totalWeight += variant.Weight
+			}
+			continue
+		}
+		if contact != nil && r.matches(rules, contact) {
+			return variant
+		}
+	}
+
+	if totalWeight == 0 {
+		return nil
+	}
+	pick := rand.Intn(totalWeight)
+	for _, variant := range fallback {
+		if pick < variant.Weight {
+			return variant
+		}
+		pick -= variant.Weight
+	}
+	return nil
+}
+
+func (r *ContentBlockRenderer) matches(rules []ContentBlockRule, contact *Contact) bool {
+	for _, rule := range rules {
+		switch rule.Type {
+		case ContentBlockRuleSegment:
+			if !r.segments[fmt.Sprint(rule.Value)][contact.ID] {
+				return false
+			}
+		case ContentBlockRuleCountry:
+			if !rule.compare(contact.Country) {
+				return false
+			}
+		case ContentBlockRuleField:
+			if !rule.compare(contact.TemplateVariables()[rule.Field]) {
+				return false
+			}
+		case ContentBlockRuleMetadata:
+			var metadata map[string]interface{}
+			_ = json.Unmarshal(contact.Metadata, &metadata)
+			value, ok := metadata[rule.Field]
+			if !ok {
+				value = ""
+			}
+			if !rule.compare(fmt.Sprint(value)) {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// compare matches a contact value against the rule, case-insensitively
+func (rule ContentBlockRule) compare(actual string) bool {
+	actual = strings.ToLower(strings.TrimSpace(actual))
+
+	var values []string
+	switch value := rule.Value.(type) {
+	case []interface{}:
+		for _, v := range value {
+			values = append(values, strings.ToLower(fmt.Sprint(v)))
+		}
+	default:
+		values = []string{strings.ToLower(fmt.Sprint(value))}
+	}
+	if len(values) == 0 {
+		return false
+	}
+
+	switch rule.Op {
+	case "neq":
+		return actual != values[0]
+	case "contains":
+		return strings.Contains(actual, values[0])
+	case "in":
+		for _, v := range values {
+			if actual == v {
+				return true
+			}
+		}
+		return false
+	default:
+		return actual == values[0]
+	}
+}
+
+// GetContentBlockStats computes the engagement of each variant of a block, attributed
+// through the variant recorded on every email
+func GetContentBlockStats(block *ContentBlock, db *gorm.DB) ([]ContentVariantStats, error) {
+	var variants []ContentBlockVariant
+	if err := db.Where("block_id = ? AND is_deleted = false", block.ID).Order("position ASC, created_at ASC").Find(&variants).Error; err != nil {
+		return nil, fmt.Errorf("failed to get content block variants: %w", err)
+	}
+
+	results := make([]ContentVariantStats, 0, len(variants))
+	for _, variant := range variants {
+		stats := &CampaignStats{}
+
+		if err := db.Model(&Email{}).
+			Where("team_id = ? AND content_variants ->> ? = ? AND status IN ? AND is_deleted = false", block.TeamID, block.Key, variant.ID,
+				[]EmailStatus{EmailStatusSent, EmailStatusOpened, EmailStatusClicked, EmailStatusBounced}).
+			Count(&stats.Sent).Error; err != nil {
+			return nil, fmt.Errorf("failed to count variant emails: %w", err)
+		}
+
+		if err := stats.countEvents(db.Model(&EmailTracking{}).
+			Select("email_trackings.event, COUNT(DISTINCT email_trackings.email_id) AS count").
+			Joins("JOIN emails ON emails.id = email_trackings.email_id").
+			Where("emails.team_id = ? AND emails.content_variants ->> ? = ? AND email_trackings.automated = false AND email_trackings.is_deleted = false", block.TeamID, block.Key, variant.ID).
+			Group("email_trackings.event")); err != nil {
+			return nil, fmt.Errorf("failed to count variant events: %w", err)
+		}
+
+		result := ContentVariantStats{
+			VariantID: variant.ID,
+			Name:      variant.Name,
+			Stats:     stats,
+		}
+		if stats.Sent > 0 {
+			result.OpenRate = float64(stats.Opens) / float64(stats.Sent) * 100
+			result.ClickRate = float64(stats.Clicks) / float64(stats.Sent) * 100
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
+}
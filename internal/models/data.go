@@ -76,8 +76,9 @@ func loadCategories(db *gorm.DB, teamId string) error {
 
 	for _, category := range categories.Categories {
 		if err := db.Create(&EmailCategory{
-			Name:   category,
-			TeamID: teamId,
+			Name:      category,
+			TeamID:    teamId,
+			Marketing: category == "Marketing",
 		}).Error; err != nil {
 			return log.Error("Failed to create category", err)
 		}
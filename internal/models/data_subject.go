@@ -0,0 +1,344 @@
+package models
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type DataSubjectRequestType string
+
+const (
+	DataSubjectRequestExport  DataSubjectRequestType = "EXPORT"
+	DataSubjectRequestErasure DataSubjectRequestType = "ERASURE"
+)
+
+type DataSubjectRequestStatus string
+
+const (
+	DataSubjectRequestStatusPending   DataSubjectRequestStatus = "PENDING" // erasure waiting to be executed
+	DataSubjectRequestStatusCompleted DataSubjectRequestStatus = "COMPLETED"
+)
+
+type DataSubjectExportFormat string
+
+const (
+	DataSubjectExportJSON DataSubjectExportFormat = "json"
+	DataSubjectExportCSV  DataSubjectExportFormat = "csv" // a zip archive with one CSV file per table
+)
+
+// ErasedEmailAddress replaces the recipient of emails whose address was erased
+const ErasedEmailAddress = "erased@erased.invalid"
+
+var (
+	// ErrDataSubjectMismatch is returned when executing an erasure with another address than it was requested for
+	ErrDataSubjectMismatch = errors.New("the email address doesn't match the erasure request")
+	// ErrDataSubjectRequestCompleted is returned when executing an erasure twice
+	ErrDataSubjectRequestCompleted = errors.New("the erasure has already been executed")
+)
+
+// DataSubjectRequest records an export or erasure of the data held about an email address,
+// whichever teams hold it. Only a hash of the address is kept, so the record outlives an erasure
+// without holding on to the address it erased.
+type DataSubjectRequest struct {
+	Base
+	Type           DataSubjectRequestType   `gorm:"not null" json:"type"`
+	EmailHash      string                   `gorm:"not null;index" json:"emailHash"` // SHA-256 of the lowercase address, hex encoded
+	RequestedByID  string                   `gorm:"type:uuid;default:NULL" json:"requestedById,omitempty"`
+	ExecutedByID   string                   `gorm:"type:uuid;default:NULL" json:"executedById,omitempty"`
+	Reference      string                   `json:"reference,omitempty"`    // e.g. the ticket the subject asked in
+	Verification   string                   `json:"verification,omitempty"` // how the subject proved the address is theirs
+	Status         DataSubjectRequestStatus `gorm:"not null;default:'PENDING'" json:"status"`
+	Teams          int64                    `gorm:"not null;default:0" json:"teams"`
+	Contacts       int64                    `gorm:"not null;default:0" json:"contacts"`
+	Emails         int64                    `gorm:"not null;default:0" json:"emails"`
+	TrackingEvents int64                    `gorm:"not null;default:0" json:"trackingEvents"`
+	CompletedAt    *time.Time               `json:"completedAt,omitempty"`
+}
+
+// DataSubjectSummary is how much data is held about an address
+type DataSubjectSummary struct {
+	Teams          int64 `json:"teams"`
+	Contacts       int64 `json:"contacts"`
+	Emails         int64 `json:"emails"`
+	TrackingEvents int64 `json:"trackingEvents"`
+}
+
+// HashDataSubjectEmail returns the hash a data subject request keeps of an address
+func HashDataSubjectEmail(address string) string {
+	digest := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(address))))
+	return hex.EncodeToString(digest[:])
+}
+
+// dataSubjectTable is a table holding data about an address and the condition selecting it
+type dataSubjectTable struct {
+	name  string
+	where string // uses @address for the lowercase address
+}
+
+const (
+	dataSubjectContacts = "SELECT id FROM contacts WHERE LOWER(email) = @address"
+	dataSubjectEmails   = `SELECT id FROM emails WHERE LOWER("to") = @address OR contact_id IN (` + dataSubjectContacts + ")"
+	// Synced messages list their recipients as "Name" <address>, so the brackets match the
+	// address exactly
+	dataSubjectInboxTo = `POSITION('<' || @address || '>' IN LOWER("to")) > 0`
+	dataSubjectInboxCc = "POSITION('<' || @address || '>' IN LOWER(cc)) > 0"
+)
+
+// dataSubjectTables lists the data an export holds, on every team
+var dataSubjectTables = []dataSubjectTable{
+	{name: "contacts", where: "LOWER(email) = @address"},
+	{name: "contact_preferences", where: "LOWER(email) = @address"},
+	{name: "automation_runs", where: "contact_id IN (" + dataSubjectContacts + ")"},
+	{name: "emails", where: `LOWER("to") = @address OR contact_id IN (` + dataSubjectContacts + ")"},
+	{name: "email_trackings", where: "email_id IN (" + dataSubjectEmails + ") OR contact_id IN (" + dataSubjectContacts + ") OR LOWER(recipient) = @address"},
+	{name: "sms_messages", where: "contact_id IN (" + dataSubjectContacts + ") OR email_id IN (" + dataSubjectEmails + ")"},
+	{name: "inbox_messages", where: "LOWER(from_address) = @address OR " + dataSubjectInboxTo + " OR " + dataSubjectInboxCc},
+}
+
+func dataSubjectTableWhere(name string) string {
+	for _, table := range dataSubjectTables {
+		if table.name == name {
+			return table.where
+		}
+	}
+	panic("unknown data subject table " + name)
+}
+
+// GetDataSubjectSummary counts the data held about an address across teams
+func GetDataSubjectSummary(address string, db *gorm.DB) (*DataSubjectSummary, error) {
+	address = strings.ToLower(strings.TrimSpace(address))
+	named := sql.Named("address", address)
+	summary := &DataSubjectSummary{}
+
+	if err := db.Raw("SELECT COUNT(DISTINCT team_id) FROM (SELECT team_id FROM contacts WHERE "+dataSubjectTableWhere("contacts")+
+		" UNION SELECT team_id FROM emails WHERE "+dataSubjectTableWhere("emails")+") AS teams", named).
+		Scan(&summary.Teams).Error; err != nil {
+		return nil, fmt.Errorf("failed to count teams: %w", err)
+	}
+	for _, count := range []struct {
+		table string
+		value *int64
+	}{
+		{"contacts", &summary.Contacts},
+		{"emails", &summary.Emails},
+		{"email_trackings", &summary.TrackingEvents},
+	} {
+		if err := db.Table(count.table).Where(dataSubjectTableWhere(count.table), named).Count(count.value).Error; err != nil {
+			return nil, fmt.Errorf("failed to count %s: %w", count.table, err)
+		}
+	}
+	return summary, nil
+}
+
+// ExportDataSubject writes everything held about an address, on every team. JSON is one document
+// with an array per table, CSV a zip archive with a file per table.
+func ExportDataSubject(address string, format DataSubjectExportFormat, db *gorm.DB, w io.Writer) error {
+	address = strings.ToLower(strings.TrimSpace(address))
+	switch format {
+	case DataSubjectExportJSON:
+		return exportDataSubjectJSON(address, db, w)
+	case DataSubjectExportCSV:
+		archive := zip.NewWriter(w)
+		for _, table := range dataSubjectTables {
+			file, err := archive.Create(table.name + ".csv")
+			if err != nil {
+				return err
+			}
+			if err := exportDataSubjectCSV(file, table, address, db); err != nil {
+				return fmt.Errorf("failed to export %s: %w", table.name, err)
+			}
+		}
+		return archive.Close()
+	}
+	return fmt.Errorf("unknown export format %q", format)
+}
+
+func exportDataSubjectJSON(address string, db *gorm.DB, w io.Writer) error {
+	header, err := json.Marshal(map[string]interface{}{"email": address, "exportedAt": time.Now()})
+	if err != nil {
+		return err
+	}
+	// Streamed table by table, so the header's closing brace is left open
+	if _, err := w.Write(header[:len(header)-1]); err != nil {
+		return err
+	}
+
+	for _, table := range dataSubjectTables {
+		if _, err := fmt.Fprintf(w, ",%q:[", table.name); err != nil {
+			return err
+		}
+		rows, err := db.Table(table.name).Where(table.where, sql.Named("address", address)).Order("created_at").Rows()
+		if err != nil {
+			return fmt.Errorf("failed to export %s: %w", table.name, err)
+		}
+		first := true
+		for rows.Next() {
+			row := map[string]interface{}{}
+			if err := db.ScanRows(rows, &row); err != nil {
+				rows.Close()
+				return err
+			}
+			encoded, err := json.Marshal(row)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			if !first {
+				encoded = append([]byte{','}, encoded...)
+			}
+			first = false
+			if _, err := w.Write(encoded); err != nil {
+				rows.Close()
+				return err
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("failed to export %s: %w", table.name, err)
+		}
+		if _, err := w.Write([]byte{']'}); err != nil {
+			return err
+		}
+	}
+
+	_, err = w.Write([]byte("}\n"))
+	return err
+}
+
+func exportDataSubjectCSV(w io.Writer, table dataSubjectTable, address string, db *gorm.DB) error {
+	rows, err := db.Table(table.name).Where(table.where, sql.Named("address", address)).Order("created_at").Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	writer := csv.NewWriter(w)
+	if err := writer.Write(columns); err != nil {
+		return err
+	}
+	record := make([]string, len(columns))
+	for rows.Next() {
+		row := map[string]interface{}{}
+		if err := db.ScanRows(rows, &row); err != nil {
+			return err
+		}
+		for i, column := range columns {
+			record[i] = csvValue(row[column])
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func csvValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case time.Time:
+		return v.Format(time.RFC3339)
+	case []byte:
+		return string(v)
+	}
+	return fmt.Sprint(value)
+}
+
+// EraseDataSubject executes an erasure request for the address it was made for. Tracking events
+// are kept for the teams' statistics without the IP address, device, location and contact that
+// identify the subject; emails keep their subject and status but lose the address, content and
+// personalization, and those not yet sent are cancelled. Text messages sent in place of the emails
+// lose the number and content, and those not yet sent fail. Synced inbox messages the address sent
+// or received keep their subject but lose their content and the address. Contacts are hard
+// deleted on every team together with their tags, preferences, automation runs, import errors and
+// timeline exports.
+func EraseDataSubject(request *DataSubjectRequest, address, executedByID string, db *gorm.DB) error {
+	if request.Status == DataSubjectRequestStatusCompleted {
+		return ErrDataSubjectRequestCompleted
+	}
+	if HashDataSubjectEmail(address) != request.EmailHash {
+		return ErrDataSubjectMismatch
+	}
+	address = strings.ToLower(strings.TrimSpace(address))
+	named := sql.Named("address", address)
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		summary, err := GetDataSubjectSummary(address, tx)
+		if err != nil {
+			return err
+		}
+
+		for _, statement := range []struct {
+			description string
+			sql         string
+		}{
+			{"anonymize tracking events", `UPDATE email_trackings SET ip_address = '', user_agent = '', city = '', region = '',
+				metadata = '{}', contact_id = NULL, recipient = '' WHERE ` + dataSubjectTableWhere("email_trackings")},
+			{"anonymize sms messages", `UPDATE sms_messages SET "to" = '', body = '', contact_id = NULL,
+				status = CASE WHEN status = '` + string(SMSMessageStatusSent) + `' THEN status ELSE '` + string(SMSMessageStatusFailed) + `' END,
+				error = CASE WHEN status = '` + string(SMSMessageStatusSent) + `' THEN error ELSE 'erased on request' END
+				WHERE ` + dataSubjectTableWhere("sms_messages")},
+			{"anonymize emails", `UPDATE emails SET "to" = '` + ErasedEmailAddress + `', body = '', plain_text = '', data = '{}',
+				contact_id = NULL, status = CASE WHEN status = '` + string(EmailStatusPending) + `' THEN '` + string(EmailStatusCancelled) + `' ELSE status END
+				WHERE ` + dataSubjectTableWhere("emails")},
+			{"anonymize inbox messages", `UPDATE inbox_messages SET snippet = '', body_text = '', body_html = '',
+				from_name = CASE WHEN LOWER(from_address) = @address THEN '' ELSE from_name END,
+				from_address = CASE WHEN LOWER(from_address) = @address THEN '` + ErasedEmailAddress + `' ELSE from_address END,
+				"to" = CASE WHEN ` + dataSubjectInboxTo + ` THEN '` + ErasedEmailAddress + `' ELSE "to" END,
+				cc = CASE WHEN ` + dataSubjectInboxCc + ` THEN '` + ErasedEmailAddress + `' ELSE cc END
+				WHERE ` + dataSubjectTableWhere("inbox_messages")},
+			{"delete automation run steps", "DELETE FROM automation_run_steps WHERE run_id IN (SELECT id FROM automation_runs WHERE " + dataSubjectTableWhere("automation_runs") + ")"},
+			{"delete automation runs", "DELETE FROM automation_runs WHERE " + dataSubjectTableWhere("automation_runs")},
+			{"delete contact tags", "DELETE FROM contact_tags WHERE contact_id IN (" + dataSubjectContacts + ")"},
+			{"delete timeline exports", "DELETE FROM contact_timeline_exports WHERE LOWER(email) = @address OR contact_id IN (" + dataSubjectContacts + ")"},
+			{"delete import errors", "DELETE FROM contact_import_errors WHERE LOWER(email) = @address"},
+			{"delete preferences", "DELETE FROM contact_preferences WHERE " + dataSubjectTableWhere("contact_preferences")},
+			{"delete contacts", "DELETE FROM contacts WHERE " + dataSubjectTableWhere("contacts")},
+		} {
+			if err := tx.Exec(statement.sql, named).Error; err != nil {
+				return fmt.Errorf("failed to %s: %w", statement.description, err)
+			}
+		}
+
+		var executedBy interface{}
+		if executedByID != "" {
+			executedBy = executedByID
+		}
+		now := time.Now()
+		request.Status = DataSubjectRequestStatusCompleted
+		request.ExecutedByID = executedByID
+		request.Teams = summary.Teams
+		request.Contacts = summary.Contacts
+		request.Emails = summary.Emails
+		request.TrackingEvents = summary.TrackingEvents
+		request.CompletedAt = &now
+		return tx.Model(&DataSubjectRequest{}).Where("id = ?", request.ID).Updates(map[string]interface{}{
+			"status":          request.Status,
+			"executed_by_id":  executedBy,
+			"teams":           request.Teams,
+			"contacts":        request.Contacts,
+			"emails":          request.Emails,
+			"tracking_events": request.TrackingEvents,
+			"completed_at":    now,
+		}).Error
+	})
+}
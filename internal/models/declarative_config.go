@@ -0,0 +1,674 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DeclarativeConfig is the desired state of a team's templates, webhooks, SMTP configs and
+// domains, e.g. kept in a repository and applied from CI. Resources are matched to what the team
+// has by a natural key: templates and webhooks by name, SMTP configs by provider and from
+// address and domains by name. Kinds left out aren't touched.
+type DeclarativeConfig struct {
+	Templates   []TemplateSpec   `json:"templates" validate:"omitempty,dive"`
+	Webhooks    []WebhookSpec    `json:"webhooks" validate:"omitempty,dive"`
+	SMTPConfigs []SMTPConfigSpec `json:"smtpConfigs" validate:"omitempty,dive"`
+	Domains     []DomainSpec     `json:"domains" validate:"omitempty,dive"`
+	// Delete the resources of the kinds given that the config doesn't list; an empty list deletes them all
+	Prune bool `json:"prune"`
+}
+
+// TemplateSpec is a template as declared. The category is created when the team has none by that name.
+type TemplateSpec struct {
+	Name      string   `json:"name" validate:"required,min=2"`
+	Subject   string   `json:"subject" validate:"required"`
+	HTML      string   `json:"html" validate:"required"`
+	Preheader string   `json:"preheader" validate:"omitempty,max=255"`
+	PlainText string   `json:"plainText"`
+	Category  string   `json:"category" validate:"required,min=2"`
+	Variables []string `json:"variables" validate:"omitempty,dive,min=1"` // left as they are when not given
+}
+
+// WebhookSpec is a webhook as declared
+type WebhookSpec struct {
+	Name     string   `json:"name" validate:"required,min=2"`
+	URL      string   `json:"url" validate:"required,url"`
+	Events   []string `json:"events" validate:"required,min=1,dive,oneof=click open reply bounce complaint quota.warning campaign.alert email.status"`
+	Secret   string   `json:"secret" validate:"required,min=16"`
+	IsActive *bool    `json:"isActive"` // defaults to true
+}
+
+// SMTPConfigSpec is an SMTP config as declared. The password is needed to create one; when it's
+// left out of an existing config the stored one is kept.
+type SMTPConfigSpec struct {
+	Provider     string `json:"provider" validate:"required,oneof=CUSTOM GMAIL OUTLOOK AMAZON SENDGRID MAILGUN POSTMARK"`
+	Host         string `json:"host" validate:"required,hostname"`
+	Port         int    `json:"port" validate:"required,min=1,max=65535"`
+	Username     string `json:"username" validate:"required"`
+	Password     string `json:"password" validate:"omitempty,min=8"`
+	FromEmail    string `json:"fromEmail" validate:"required,email"`
+	IsDefault    bool   `json:"isDefault"`
+	IsActive     *bool  `json:"isActive"`     // defaults to true
+	SupportsTLS  *bool  `json:"supportsTls"`  // defaults to true
+	RequiresAuth *bool  `json:"requiresAuth"` // defaults to true
+	MaxSendRate  int    `json:"maxSendRate" validate:"omitempty,min=1"`
+}
+
+// DomainSpec is a sending domain as declared. Verification is left to the domain endpoints.
+type DomainSpec struct {
+	Domain       string   `json:"domain" validate:"required,fqdn"`
+	DKIMSelector string   `json:"dkimSelector" validate:"omitempty,hostname"`
+	MTASTSMode   string   `json:"mtaStsMode" validate:"omitempty,oneof=none testing enforce"`
+	MTASTSMaxAge int      `json:"mtaStsMaxAge" validate:"omitempty,min=86400,max=31557600"`
+	MTASTSMX     []string `json:"mtaStsMx"`
+}
+
+// ConfigAction is what applying a config does to a resource
+type ConfigAction string
+
+const (
+	ConfigActionCreate ConfigAction = "create"
+	ConfigActionUpdate ConfigAction = "update"
+	ConfigActionDelete ConfigAction = "delete"
+	ConfigActionNone   ConfigAction = "none"
+)
+
+// Kinds of resource a declarative config manages
+const (
+	ConfigKindTemplate   = "template"
+	ConfigKindWebhook    = "webhook"
+	ConfigKindSMTPConfig = "smtp_config"
+	ConfigKindDomain     = "domain"
+)
+
+// configSensitive stands in for secrets in plans
+const configSensitive = "(sensitive)"
+
+// ConfigFieldChange is a field's value before and after applying
+type ConfigFieldChange struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// ConfigChange is what applying a config does to one resource. A change with an error can't be
+// applied and keeps the whole config from being applied.
+type ConfigChange struct {
+	Kind   string                       `json:"kind"`
+	Key    string                       `json:"key"`
+	Action ConfigAction                 `json:"action"`
+	ID     string                       `json:"id,omitempty"` // empty for resources yet to be created by a plan
+	Fields map[string]ConfigFieldChange `json:"fields,omitempty"`
+	Error  string                       `json:"error,omitempty"`
+
+	apply func(tx *gorm.DB) error
+}
+
+// ConfigPlan is what applying a config does, or did
+type ConfigPlan struct {
+	Changes []*ConfigChange      `json:"changes"`
+	Summary map[ConfigAction]int `json:"summary"`
+	Errors  int                  `json:"errors"`
+	Applied bool                 `json:"applied"`
+}
+
+// TemplateHTMLStore reads and uploads the html files of templates, which live in storage
+type TemplateHTMLStore interface {
+	// ReadHTML returns the html of a template, its HtmlFile preloaded
+	ReadHTML(template *Template) (string, error)
+	// StoreHTML uploads html and returns the file to record it as, not yet saved
+	StoreHTML(teamID string, name string, html string) (*File, error)
+}
+
+// ErrConfigNotApplicable is returned when applying a config whose plan has errors
+var ErrConfigNotApplicable = fmt.Errorf("the config has changes that can't be applied")
+
+// PlanConfig returns what applying the config would change, without changing anything
+func PlanConfig(teamID string, config *DeclarativeConfig, store TemplateHTMLStore, db *gorm.DB) (*ConfigPlan, error) {
+	return reconcileConfig(teamID, config, store, db)
+}
+
+// ApplyConfig brings the team's resources to the state the config declares, all in one
+// transaction. Applying a config that's already in place changes nothing. When any change has
+// an error nothing is applied and ErrConfigNotApplicable is returned with the plan.
+func ApplyConfig(teamID string, config *DeclarativeConfig, store TemplateHTMLStore, db *gorm.DB) (*ConfigPlan, error) {
+	plan, err := reconcileConfig(teamID, config, store, db)
+	if err != nil {
+		return nil, err
+	}
+	if plan.Errors > 0 {
+		return plan, ErrConfigNotApplicable
+	}
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		for _, change := range plan.Changes {
+			if change.apply == nil {
+				continue
+			}
+			if err := change.apply(tx); err != nil {
+				return fmt.Errorf("%s %s: %w", change.Kind, change.Key, err)
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	plan.Applied = true
+	return plan, nil
+}
+
+func reconcileConfig(teamID string, config *DeclarativeConfig, store TemplateHTMLStore, db *gorm.DB) (*ConfigPlan, error) {
+	plan := &ConfigPlan{Changes: []*ConfigChange{}, Summary: map[ConfigAction]int{}}
+	steps := []func(string, *DeclarativeConfig, TemplateHTMLStore, *gorm.DB) ([]*ConfigChange, error){
+		planTemplates, planWebhooks, planSMTPConfigs, planDomains,
+	}
+	for _, step := range steps {
+		changes, err := step(teamID, config, store, db)
+		if err != nil {
+			return nil, err
+		}
+		plan.Changes = append(plan.Changes, changes...)
+	}
+	for _, change := range plan.Changes {
+		plan.Summary[change.Action]++
+		if change.Error != "" {
+			plan.Errors++
+		}
+	}
+	return plan, nil
+}
+
+// newConfigChange returns the change for a declared resource matched to the existing one, if any
+func newConfigChange(kind string, key string, id string) *ConfigChange {
+	change := &ConfigChange{Kind: kind, Key: key, ID: id, Action: ConfigActionCreate, Fields: map[string]ConfigFieldChange{}}
+	if id != "" {
+		change.Action = ConfigActionUpdate
+	}
+	return change
+}
+
+// diff records a field whose value changes
+func (c *ConfigChange) diff(field string, before interface{}, after interface{}) {
+	if c.Action == ConfigActionCreate {
+		before = nil
+	} else if reflect.DeepEqual(before, after) {
+		return
+	}
+	c.Fields[field] = ConfigFieldChange{Before: before, After: after}
+}
+
+// diffSensitive records a change of a secret without its value
+func (c *ConfigChange) diffSensitive(field string, before string, after string) {
+	if c.Action == ConfigActionCreate || before != after {
+		c.Fields[field] = ConfigFieldChange{Before: configSensitive, After: configSensitive}
+	}
+}
+
+// settle marks an update that changes nothing, which then isn't applied
+func (c *ConfigChange) settle() {
+	if c.Action == ConfigActionUpdate && len(c.Fields) == 0 {
+		c.Action, c.Fields, c.apply = ConfigActionNone, nil, nil
+	}
+	if c.Error != "" {
+		c.apply = nil
+	}
+}
+
+// duplicateConfigKey returns the first key given twice, compared case insensitively
+func duplicateConfigKey(keys []string) string {
+	seen := map[string]bool{}
+	for _, key := range keys {
+		if seen[strings.ToLower(key)] {
+			return key
+		}
+		seen[strings.ToLower(key)] = true
+	}
+	return ""
+}
+
+// configDeletion is the change deleting an existing resource the config leaves out
+func configDeletion(kind string, key string, id string, model interface{}) *ConfigChange {
+	return &ConfigChange{
+		Kind: kind, Key: key, ID: id, Action: ConfigActionDelete,
+		apply: func(tx *gorm.DB) error {
+			return tx.Model(model).Where("id = ?", id).
+				Updates(map[string]interface{}{"is_deleted": true, "deleted_at": time.Now()}).Error
+		},
+	}
+}
+
+// htmlDigest describes html in a plan by its size and hash rather than its content
+func htmlDigest(html string) string {
+	sum := sha256.Sum256([]byte(html))
+	return fmt.Sprintf("%d bytes, sha256 %s", len(html), hex.EncodeToString(sum[:])[:16])
+}
+
+func planTemplates(teamID string, config *DeclarativeConfig, store TemplateHTMLStore, db *gorm.DB) ([]*ConfigChange, error) {
+	if config.Templates == nil {
+		return nil, nil
+	}
+	names := make([]string, len(config.Templates))
+	for i, spec := range config.Templates {
+		names[i] = spec.Name
+	}
+	if name := duplicateConfigKey(names); name != "" {
+		return []*ConfigChange{{Kind: ConfigKindTemplate, Key: name, Action: ConfigActionNone, Error: "template is declared more than once"}}, nil
+	}
+
+	var existing []Template
+	if err := db.Where("team_id = ? AND is_deleted = false", teamID).Preload("HtmlFile").Preload("Category").
+		Order("created_at").Find(&existing).Error; err != nil {
+		return nil, err
+	}
+	byName := map[string]*Template{}
+	for i := range existing {
+		if key := strings.ToLower(existing[i].Name); byName[key] == nil {
+			byName[key] = &existing[i]
+		}
+	}
+	var categories []EmailCategory
+	if err := db.Where("team_id = ? AND is_deleted = false", teamID).Order("created_at").Find(&categories).Error; err != nil {
+		return nil, err
+	}
+	categoryIDs := map[string]string{}
+	for _, category := range categories {
+		if key := strings.ToLower(category.Name); categoryIDs[key] == "" {
+			categoryIDs[key] = category.ID
+		}
+	}
+	// Categories the config introduces are created once, by the first template needing them
+	created := map[string]*EmailCategory{}
+	matched := map[string]bool{}
+
+	changes := make([]*ConfigChange, 0, len(config.Templates))
+	for _, spec := range config.Templates {
+		spec := spec
+		template := byName[strings.ToLower(spec.Name)]
+
+		change := newConfigChange(ConfigKindTemplate, spec.Name, "")
+		currentHTML, currentCategory := "", ""
+		if template != nil {
+			matched[template.ID] = true
+			change = newConfigChange(ConfigKindTemplate, spec.Name, template.ID)
+			if template.Category != nil {
+				currentCategory = template.Category.Name
+			}
+			if template.HtmlFile != nil {
+				html, err := store.ReadHTML(template)
+				if err != nil {
+					change.Error = "the template's current html can't be read: " + err.Error()
+				}
+				currentHTML = html
+			}
+		} else {
+			template = &Template{TeamID: teamID}
+		}
+
+		change.diff("subject", template.Subject, spec.Subject)
+		change.diff("preheader", template.Preheader, spec.Preheader)
+		change.diff("plainText", template.PlainText, spec.PlainText)
+		htmlChanged := change.Action == ConfigActionCreate || currentHTML != spec.HTML
+		if htmlChanged {
+			before := ""
+			if change.Action != ConfigActionCreate {
+				before = htmlDigest(currentHTML)
+			}
+			change.Fields["html"] = ConfigFieldChange{Before: before, After: htmlDigest(spec.HTML)}
+		}
+		if !strings.EqualFold(currentCategory, spec.Category) {
+			change.diff("category", currentCategory, spec.Category)
+		}
+		if spec.Variables != nil {
+			change.diff("variables", []string(template.Variables), spec.Variables)
+		}
+
+		categoryKey := strings.ToLower(spec.Category)
+		categoryID := categoryIDs[categoryKey]
+		if categoryID == "" && created[categoryKey] == nil {
+			created[categoryKey] = &EmailCategory{Name: spec.Category, TeamID: teamID}
+		}
+		change.apply = func(tx *gorm.DB) error {
+			if categoryID == "" {
+				category := created[categoryKey]
+				if category.ID == "" {
+					if err := tx.Create(category).Error; err != nil {
+						return err
+					}
+				}
+				categoryID = category.ID
+			}
+			if htmlChanged {
+				file, err := store.StoreHTML(teamID, spec.Name, spec.HTML)
+				if err != nil {
+					return err
+				}
+				if err := tx.Create(file).Error; err != nil {
+					return err
+				}
+				template.HtmlFileID = file.ID
+			}
+			template.Name = spec.Name
+			template.Subject = spec.Subject
+			template.Preheader = spec.Preheader
+			template.PlainText = spec.PlainText
+			template.CategoryID = categoryID
+			if spec.Variables != nil {
+				template.Variables = spec.Variables
+			}
+			if err := tx.Omit(clause.Associations).Save(template).Error; err != nil {
+				return err
+			}
+			change.ID = template.ID
+			return nil
+		}
+		change.settle()
+		changes = append(changes, change)
+	}
+
+	if config.Prune {
+		for _, template := range existing {
+			if !matched[template.ID] {
+				changes = append(changes, pruneTemplate(teamID, template, db))
+			}
+		}
+	}
+	return changes, nil
+}
+
+// pruneTemplate is the deletion of a template the config leaves out, which can't go while in use
+func pruneTemplate(teamID string, template Template, db *gorm.DB) *ConfigChange {
+	change := configDeletion(ConfigKindTemplate, template.Name, template.ID, &Template{})
+	usage, err := GetTemplateUsage(teamID, template.ID, db)
+	switch {
+	case err != nil:
+		change.Error = "the template's usage can't be checked: " + err.Error()
+	case usage.InUse:
+		change.Error = (&TemplateInUseError{Usage: usage}).Error()
+	}
+	change.settle()
+	return change
+}
+
+func planWebhooks(teamID string, config *DeclarativeConfig, _ TemplateHTMLStore, db *gorm.DB) ([]*ConfigChange, error) {
+	if config.Webhooks == nil {
+		return nil, nil
+	}
+	names := make([]string, len(config.Webhooks))
+	for i, spec := range config.Webhooks {
+		names[i] = spec.Name
+	}
+	if name := duplicateConfigKey(names); name != "" {
+		return []*ConfigChange{{Kind: ConfigKindWebhook, Key: name, Action: ConfigActionNone, Error: "webhook is declared more than once"}}, nil
+	}
+
+	var existing []Webhook
+	if err := db.Where("team_id = ? AND is_deleted = false", teamID).Order("created_at").Find(&existing).Error; err != nil {
+		return nil, err
+	}
+	byName := map[string]*Webhook{}
+	for i := range existing {
+		if key := strings.ToLower(existing[i].Name); byName[key] == nil {
+			byName[key] = &existing[i]
+		}
+	}
+	matched := map[string]bool{}
+
+	changes := make([]*ConfigChange, 0, len(config.Webhooks))
+	for _, spec := range config.Webhooks {
+		spec := spec
+		webhook := byName[strings.ToLower(spec.Name)]
+		change := newConfigChange(ConfigKindWebhook, spec.Name, "")
+		if webhook != nil {
+			matched[webhook.ID] = true
+			change = newConfigChange(ConfigKindWebhook, spec.Name, webhook.ID)
+		} else {
+			webhook = &Webhook{TeamID: teamID, IsActive: true}
+		}
+		isActive := spec.IsActive == nil || *spec.IsActive
+		events := slices.Clone(spec.Events)
+		slices.Sort(events)
+		current := slices.Clone([]string(webhook.Events))
+		slices.Sort(current)
+
+		change.diff("url", webhook.URL, spec.URL)
+		change.diff("events", current, events)
+		change.diff("isActive", webhook.IsActive, isActive)
+		change.diffSensitive("secret", webhook.Secret, spec.Secret)
+		change.apply = func(tx *gorm.DB) error {
+			webhook.Name = spec.Name
+			webhook.URL = spec.URL
+			webhook.Events = events
+			webhook.IsActive = isActive
+			webhook.Secret = spec.Secret
+			if err := tx.Omit(clause.Associations).Save(webhook).Error; err != nil {
+				return err
+			}
+			change.ID = webhook.ID
+			return nil
+		}
+		change.settle()
+		changes = append(changes, change)
+	}
+
+	if config.Prune {
+		for _, webhook := range existing {
+			if !matched[webhook.ID] {
+				changes = append(changes, configDeletion(ConfigKindWebhook, webhook.Name, webhook.ID, &Webhook{}))
+			}
+		}
+	}
+	return changes, nil
+}
+
+// smtpConfigKey identifies an SMTP config in a declarative config
+func smtpConfigKey(provider string, fromEmail string) string {
+	return fmt.Sprintf("%s %s", provider, strings.ToLower(fromEmail))
+}
+
+func planSMTPConfigs(teamID string, config *DeclarativeConfig, _ TemplateHTMLStore, db *gorm.DB) ([]*ConfigChange, error) {
+	if config.SMTPConfigs == nil {
+		return nil, nil
+	}
+	keys := make([]string, len(config.SMTPConfigs))
+	for i, spec := range config.SMTPConfigs {
+		keys[i] = smtpConfigKey(spec.Provider, spec.FromEmail)
+	}
+	if key := duplicateConfigKey(keys); key != "" {
+		return []*ConfigChange{{Kind: ConfigKindSMTPConfig, Key: key, Action: ConfigActionNone, Error: "SMTP config is declared more than once"}}, nil
+	}
+
+	var existing []SMTPConfig
+	if err := db.Where("team_id = ? AND is_deleted = false", teamID).Order("created_at").Find(&existing).Error; err != nil {
+		return nil, err
+	}
+	byKey := map[string]*SMTPConfig{}
+	for i := range existing {
+		if key := smtpConfigKey(existing[i].Provider, existing[i].FromEmail); byKey[key] == nil {
+			byKey[key] = &existing[i]
+		}
+	}
+	matched := map[string]bool{}
+
+	changes := make([]*ConfigChange, 0, len(config.SMTPConfigs))
+	for i, spec := range config.SMTPConfigs {
+		spec := spec
+		key := keys[i]
+		smtpConfig := byKey[key]
+		change := newConfigChange(ConfigKindSMTPConfig, key, "")
+		if smtpConfig != nil {
+			matched[smtpConfig.ID] = true
+			change = newConfigChange(ConfigKindSMTPConfig, key, smtpConfig.ID)
+		} else {
+			smtpConfig = &SMTPConfig{TeamID: teamID, IsActive: true, SupportsTLS: true, RequiresAuth: true, MaxSendRate: 10}
+		}
+		orDefault := func(value *bool, current bool) bool {
+			if value == nil {
+				if change.Action == ConfigActionCreate {
+					return true
+				}
+				return current
+			}
+			return *value
+		}
+		isActive := orDefault(spec.IsActive, smtpConfig.IsActive)
+		supportsTLS := orDefault(spec.SupportsTLS, smtpConfig.SupportsTLS)
+		requiresAuth := orDefault(spec.RequiresAuth, smtpConfig.RequiresAuth)
+		maxSendRate := spec.MaxSendRate
+		if maxSendRate == 0 {
+			maxSendRate = smtpConfig.MaxSendRate
+		}
+		password := spec.Password
+		if password == "" {
+			password = smtpConfig.Password
+		}
+		if password == "" && !smtpConfig.UsesOAuth() {
+			change.Error = "a password is needed to create the SMTP config"
+		}
+
+		change.diff("host", smtpConfig.Host, spec.Host)
+		change.diff("port", smtpConfig.Port, spec.Port)
+		change.diff("username", smtpConfig.Username, spec.Username)
+		change.diff("fromEmail", smtpConfig.FromEmail, spec.FromEmail)
+		change.diff("isDefault", smtpConfig.IsDefault, spec.IsDefault)
+		change.diff("isActive", smtpConfig.IsActive, isActive)
+		change.diff("supportsTls", smtpConfig.SupportsTLS, supportsTLS)
+		change.diff("requiresAuth", smtpConfig.RequiresAuth, requiresAuth)
+		change.diff("maxSendRate", smtpConfig.MaxSendRate, maxSendRate)
+		change.diffSensitive("password", smtpConfig.Password, password)
+		change.apply = func(tx *gorm.DB) error {
+			smtpConfig.Provider = spec.Provider
+			smtpConfig.Host = spec.Host
+			smtpConfig.Port = spec.Port
+			smtpConfig.Username = spec.Username
+			smtpConfig.FromEmail = spec.FromEmail
+			smtpConfig.Password = password
+			smtpConfig.IsDefault = spec.IsDefault
+			smtpConfig.IsActive = isActive
+			smtpConfig.SupportsTLS = supportsTLS
+			smtpConfig.RequiresAuth = requiresAuth
+			smtpConfig.MaxSendRate = maxSendRate
+			if err := tx.Omit(clause.Associations).Save(smtpConfig).Error; err != nil {
+				return err
+			}
+			change.ID = smtpConfig.ID
+			return nil
+		}
+		change.settle()
+		changes = append(changes, change)
+	}
+
+	if config.Prune {
+		for _, smtpConfig := range existing {
+			if !matched[smtpConfig.ID] {
+				key := smtpConfigKey(smtpConfig.Provider, smtpConfig.FromEmail)
+				changes = append(changes, configDeletion(ConfigKindSMTPConfig, key, smtpConfig.ID, &SMTPConfig{}))
+			}
+		}
+	}
+	return changes, nil
+}
+
+func planDomains(teamID string, config *DeclarativeConfig, _ TemplateHTMLStore, db *gorm.DB) ([]*ConfigChange, error) {
+	if config.Domains == nil {
+		return nil, nil
+	}
+	names := make([]string, len(config.Domains))
+	for i, spec := range config.Domains {
+		names[i] = strings.ToLower(spec.Domain)
+	}
+	if name := duplicateConfigKey(names); name != "" {
+		return []*ConfigChange{{Kind: ConfigKindDomain, Key: name, Action: ConfigActionNone, Error: "domain is declared more than once"}}, nil
+	}
+
+	// Domains are unique across teams, deleted ones included, so those are looked up too
+	var existing []Domain
+	if err := db.Where("team_id = ? OR domain IN ?", teamID, names).Find(&existing).Error; err != nil {
+		return nil, err
+	}
+	byName := map[string]*Domain{}
+	for i := range existing {
+		byName[strings.ToLower(existing[i].Domain)] = &existing[i]
+	}
+
+	changes := make([]*ConfigChange, 0, len(config.Domains))
+	for i, spec := range config.Domains {
+		spec := spec
+		name := names[i]
+		domain := byName[name]
+		change := newConfigChange(ConfigKindDomain, name, "")
+		switch {
+		case domain != nil && domain.TeamID != teamID:
+			change.Error = "the domain is registered by another team"
+		case domain != nil && !domain.IsDeleted:
+			change = newConfigChange(ConfigKindDomain, name, domain.ID)
+		case domain != nil:
+			// Re-adding a deleted domain restores it, verification starting over
+			restored := &Domain{Base: Base{ID: domain.ID, CreatedAt: domain.CreatedAt}, Domain: domain.Domain, TeamID: teamID,
+				VerificationToken: domain.VerificationToken, DKIMSelector: domain.DKIMSelector, MTASTSMode: domain.MTASTSMode,
+				MTASTSMaxAge: domain.MTASTSMaxAge, MTASTSMX: domain.MTASTSMX, Checks: datatypes.JSON("[]"),
+				OwnershipStatus: DomainRecordStatusPending, SPFStatus: DomainRecordStatusPending,
+				DKIMStatus: DomainRecordStatusPending, DMARCStatus: DomainRecordStatusPending}
+			domain = restored
+		default:
+			domain = &Domain{Domain: name, TeamID: teamID, DKIMSelector: "posthoot", MTASTSMode: MTASTSModeTesting, MTASTSMaxAge: 604800}
+		}
+
+		selector := spec.DKIMSelector
+		if selector == "" {
+			selector = domain.DKIMSelector
+		}
+		mode := MTASTSMode(spec.MTASTSMode)
+		if mode == "" {
+			mode = domain.MTASTSMode
+		}
+		maxAge := spec.MTASTSMaxAge
+		if maxAge == 0 {
+			maxAge = domain.MTASTSMaxAge
+		}
+		mx := []string(domain.MTASTSMX)
+		if spec.MTASTSMX != nil {
+			mx = spec.MTASTSMX
+		}
+
+		change.diff("dkimSelector", domain.DKIMSelector, selector)
+		change.diff("mtaStsMode", string(domain.MTASTSMode), string(mode))
+		change.diff("mtaStsMaxAge", domain.MTASTSMaxAge, maxAge)
+		change.diff("mtaStsMx", []string(domain.MTASTSMX), mx)
+		change.apply = func(tx *gorm.DB) error {
+			domain.DKIMSelector = selector
+			domain.MTASTSMode = mode
+			domain.MTASTSMaxAge = maxAge
+			domain.MTASTSMX = mx
+			if err := domain.EnsureVerificationToken(); err != nil {
+				return err
+			}
+			if err := tx.Omit(clause.Associations).Save(domain).Error; err != nil {
+				return err
+			}
+			change.ID = domain.ID
+			return nil
+		}
+		change.settle()
+		changes = append(changes, change)
+	}
+
+	if config.Prune {
+		declared := map[string]bool{}
+		for _, name := range names {
+			declared[name] = true
+		}
+		for _, domain := range existing {
+			if domain.TeamID == teamID && !domain.IsDeleted && !declared[strings.ToLower(domain.Domain)] {
+				changes = append(changes, configDeletion(ConfigKindDomain, domain.Domain, domain.ID, &Domain{}))
+			}
+		}
+	}
+	return changes, nil
+}
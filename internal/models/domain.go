@@ -0,0 +1,110 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DomainRecordStatus is the verification state of a single DNS record
+type DomainRecordStatus string
+
+const (
+	DomainRecordStatusPending  DomainRecordStatus = "PENDING"
+	DomainRecordStatusVerified DomainRecordStatus = "VERIFIED"
+	DomainRecordStatusFailed   DomainRecordStatus = "FAILED"
+)
+
+// DNS record kinds checked during domain verification
+const (
+	DomainRecordOwnership = "ownership"
+	DomainRecordSPF       = "spf"
+	DomainRecordDKIM      = "dkim"
+	DomainRecordDMARC     = "dmarc"
+	DomainRecordTracking  = "tracking" // CNAME of a custom tracking domain
+)
+
+// DomainVerificationPrefix prefixes the TXT value that proves domain ownership
+const DomainVerificationPrefix = "posthoot-verification="
+
+// DomainRecordCheck is the outcome of checking one DNS record for a domain
+type DomainRecordCheck struct {
+	Record   string             `json:"record"`
+	Host     string             `json:"host"`
+	Type     string             `json:"type"`
+	Expected string             `json:"expected"`
+	Found    []string           `json:"found"`
+	Status   DomainRecordStatus `json:"status"`
+	Message  string             `json:"message,omitempty"`
+}
+
+func (d *Domain) BeforeCreate(tx *gorm.DB) error {
+	if err := d.Base.BeforeCreate(tx); err != nil {
+		return err
+	}
+	return d.EnsureVerificationToken()
+}
+
+// EnsureVerificationToken generates the domain's ownership token if it doesn't have one yet
+func (d *Domain) EnsureVerificationToken() error {
+	if d.VerificationToken == "" {
+		token := make([]byte, 16)
+		if _, err := rand.Read(token); err != nil {
+			return fmt.Errorf("failed to generate verification token: %w", err)
+		}
+		d.VerificationToken = hex.EncodeToString(token)
+	}
+	d.DNSRecord = DomainVerificationPrefix + d.VerificationToken
+	return nil
+}
+
+// VerificationHost is the name the ownership TXT record must be published under
+func (d *Domain) VerificationHost() string {
+	return "_posthoot." + d.Domain
+}
+
+// DKIMHost is the name the DKIM key must be published under
+func (d *Domain) DKIMHost() string {
+	return d.DKIMSelector + "._domainkey." + d.Domain
+}
+
+// ApplyChecks stores the outcome of a verification run on the domain. A domain counts as
+// verified once ownership, SPF and DKIM pass; DMARC is reported but not required.
+func (d *Domain) ApplyChecks(checks []DomainRecordCheck, checkedAt time.Time) error {
+	for _, check := range checks {
+		switch check.Record {
+		case DomainRecordOwnership:
+			d.OwnershipStatus = check.Status
+		case DomainRecordSPF:
+			d.SPFStatus = check.Status
+		case DomainRecordDKIM:
+			d.DKIMStatus = check.Status
+		case DomainRecordDMARC:
+			d.DMARCStatus = check.Status
+		}
+	}
+
+	data, err := json.Marshal(checks)
+	if err != nil {
+		return fmt.Errorf("failed to marshal domain checks: %w", err)
+	}
+	d.Checks = data
+	d.LastCheckedAt = checkedAt
+	d.IsVerified = d.OwnershipStatus == DomainRecordStatusVerified &&
+		d.SPFStatus == DomainRecordStatusVerified &&
+		d.DKIMStatus == DomainRecordStatusVerified
+	return nil
+}
+
+// GetDomainByID retrieves a domain by its ID
+func GetDomainByID(id string, db *gorm.DB) (*Domain, error) {
+	domain := &Domain{}
+	if err := db.Where("id = ? AND is_deleted = false", id).First(domain).Error; err != nil {
+		return nil, err
+	}
+	return domain, nil
+}
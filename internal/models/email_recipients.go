@@ -0,0 +1,150 @@
+package models
+
+import (
+	"fmt"
+	"net/mail"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// MaxRecipientsPerEmail caps the addresses an email is sent to, To, CC and BCC together
+const MaxRecipientsPerEmail = 50
+
+// ParseRecipientList splits a comma separated CC or BCC list into its addresses. Blank entries
+// and repeats are dropped; an address that isn't valid is an error.
+func ParseRecipientList(list string) ([]string, error) {
+	var addresses []string
+	seen := map[string]bool{}
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		address, err := mail.ParseAddress(entry)
+		if err != nil || address.Name != "" || address.Address != entry {
+			return nil, fmt.Errorf("%q is not a valid email address", entry)
+		}
+		if key := strings.ToLower(address.Address); !seen[key] {
+			seen[key] = true
+			addresses = append(addresses, address.Address)
+		}
+	}
+	return addresses, nil
+}
+
+// NormalizeRecipients validates an email's CC and BCC lists and rewrites them without blanks
+// and repeats. Addresses already on the To line, or on CC for BCC, are dropped, and the
+// recipients together may not go over MaxRecipientsPerEmail.
+func (e *Email) NormalizeRecipients() error {
+	cc, err := ParseRecipientList(e.CC)
+	if err != nil {
+		return fmt.Errorf("cc: %w", err)
+	}
+	bcc, err := ParseRecipientList(e.BCC)
+	if err != nil {
+		return fmt.Errorf("bcc: %w", err)
+	}
+
+	seen := map[string]bool{strings.ToLower(e.To): true}
+	keep := func(addresses []string) []string {
+		var kept []string
+		for _, address := range addresses {
+			if key := strings.ToLower(address); !seen[key] {
+				seen[key] = true
+				kept = append(kept, address)
+			}
+		}
+		return kept
+	}
+	cc, bcc = keep(cc), keep(bcc)
+
+	if recipients := 1 + len(cc) + len(bcc); recipients > MaxRecipientsPerEmail {
+		return fmt.Errorf("an email can be sent to at most %d recipients, this one has %d", MaxRecipientsPerEmail, recipients)
+	}
+	e.CC = strings.Join(cc, ",")
+	e.BCC = strings.Join(bcc, ",")
+	return nil
+}
+
+// CopyRecipients returns the email's CC and BCC addresses
+func (e *Email) CopyRecipients() []string {
+	var addresses []string
+	for _, list := range []string{e.CC, e.BCC} {
+		for _, address := range strings.Split(list, ",") {
+			if address = strings.TrimSpace(address); address != "" {
+				addresses = append(addresses, address)
+			}
+		}
+	}
+	return addresses
+}
+
+// IsCopyRecipient reports whether the address is on the email's CC or BCC rather than its To line
+func (e *Email) IsCopyRecipient(address string) bool {
+	if strings.EqualFold(address, e.To) {
+		return false
+	}
+	for _, copied := range e.CopyRecipients() {
+		if strings.EqualFold(copied, address) {
+			return true
+		}
+	}
+	return false
+}
+
+// SuppressCopyRecipients drops the CC and BCC addresses the team may no longer mail: contacts
+// that unsubscribed, bounced or complained on any of its lists. It returns the addresses dropped.
+func (e *Email) SuppressCopyRecipients(db *gorm.DB) ([]string, error) {
+	addresses := e.CopyRecipients()
+	if len(addresses) == 0 {
+		return nil, nil
+	}
+	blocked, err := SuppressedAddresses(e.TeamID, addresses, db)
+	if err != nil || len(blocked) == 0 {
+		return nil, err
+	}
+	suppressed := make([]string, 0, len(blocked))
+	for address := range blocked {
+		suppressed = append(suppressed, address)
+	}
+	filter := func(list string) string {
+		var kept []string
+		for _, address := range strings.Split(list, ",") {
+			if address = strings.TrimSpace(address); address != "" && !blocked[strings.ToLower(address)] {
+				kept = append(kept, address)
+			}
+		}
+		return strings.Join(kept, ",")
+	}
+	e.CC, e.BCC = filter(e.CC), filter(e.BCC)
+	return suppressed, nil
+}
+
+// SuppressedAddresses returns, lowercased, the addresses the team may no longer mail: contacts
+// that unsubscribed, bounced or complained on any of its lists
+func SuppressedAddresses(teamID string, addresses []string, db *gorm.DB) (map[string]bool, error) {
+	if len(addresses) == 0 {
+		return nil, nil
+	}
+	lowered := make([]string, len(addresses))
+	for i, address := range addresses {
+		lowered[i] = strings.ToLower(address)
+	}
+
+	var suppressed []string
+	if err := db.Model(&Contact{}).
+		Where("team_id = ? AND LOWER(email) IN ? AND status IN ? AND is_deleted = false", teamID, lowered,
+			[]SubscriberStatus{SubscriberStatusUnsubscribed, SubscriberStatusBounced, SubscriberStatusComplained}).
+		Distinct().Pluck("LOWER(email)", &suppressed).Error; err != nil {
+		return nil, err
+	}
+	blocked := make(map[string]bool, len(suppressed))
+	for _, address := range suppressed {
+		blocked[address] = true
+	}
+	return blocked, nil
+}
+
+// CopyRecipientSQL matches emails carrying an address on their CC or BCC line
+const CopyRecipientSQL = `(? = ANY(string_to_array(LOWER(REPLACE(cc, ' ', '')), ',')) OR ? = ANY(string_to_array(LOWER(REPLACE(bcc, ' ', '')), ',')))`
@@ -0,0 +1,54 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// MaxEmailStatusIDs caps how many emails one status lookup can ask for
+const MaxEmailStatusIDs = 500
+
+// EmailStatusEntry is where a single email stands, for senders reconciling delivery in bulk
+type EmailStatusEntry struct {
+	ID             string      `json:"id"`
+	Status         EmailStatus `json:"status"`
+	Error          string      `json:"error,omitempty"`
+	ErrorClass     string      `json:"errorClass,omitempty"`
+	Attempts       int         `json:"attempts"`
+	SentAt         *time.Time  `json:"sentAt,omitempty"`
+	NextRetryAt    *time.Time  `json:"nextRetryAt,omitempty"`
+	IdempotencyKey string      `json:"idempotencyKey,omitempty"`
+	UpdatedAt      time.Time   `json:"updatedAt"`
+}
+
+// emailStatusColumns are the email columns an EmailStatusEntry is read from. Emails that
+// weren't sent yet have no sent_at.
+var emailStatusColumns = []string{
+	"id", "status", "error", "error_class", "attempts", "next_retry_at", "idempotency_key", "updated_at",
+	"CASE WHEN sent_at > '0001-01-01' THEN sent_at END AS sent_at",
+}
+
+// GetEmailStatuses returns the statuses of the team's emails with the given IDs. IDs that
+// aren't the team's emails are left out.
+func GetEmailStatuses(teamID string, ids []string, db *gorm.DB) ([]EmailStatusEntry, error) {
+	entries := []EmailStatusEntry{}
+	if err := db.Model(&Email{}).
+		Select(emailStatusColumns).
+		Where("team_id = ? AND id IN ? AND is_deleted = false", teamID, ids).
+		Scan(&entries).Error; err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// EmailStatusChangesQuery selects the statuses of the team's transactional and automation
+// emails that changed in (from, to]. Campaign sends are left out, their results are reported
+// through analytics.
+func EmailStatusChangesQuery(teamID string, from, to time.Time, db *gorm.DB) *gorm.DB {
+	return db.Model(&Email{}).
+		Select(emailStatusColumns).
+		Where("team_id = ? AND campaign_id IS NULL AND is_deleted = false", teamID).
+		Where("updated_at > ? AND updated_at <= ?", from, to).
+		Order("updated_at ASC, id ASC")
+}
@@ -0,0 +1,72 @@
+package models
+
+import (
+	"time"
+
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+)
+
+const (
+	DefaultEmbedTokenTTL = 15 * time.Minute
+	MaxEmbedTokenTTL     = time.Hour
+)
+
+// EmbedTokenScopes are the permissions an embed token can be given, each with the routes it can
+// reach. Embed tokens end up in browsers, so they only ever read, and only routes whose handlers
+// limit what they return to the token's team are listed.
+var EmbedTokenScopes = map[string]map[string]bool{
+	"analytics:read": {
+		"/api/v1/analytics/email":            true,
+		"/api/v1/analytics/campaign":         true,
+		"/api/v1/analytics/team/overview":    true,
+		"/api/v1/analytics/campaign/compare": true,
+		"/api/v1/analytics/heatmap":          true,
+		"/api/v1/analytics/engagement-times": true,
+		"/api/v1/analytics/audience":         true,
+		"/api/v1/analytics/trends":           true,
+		"/api/v1/analytics/reports":          true,
+		"/api/v1/analytics/events":           true,
+		"/api/v1/analytics/stream":           true,
+		"/api/v1/analytics/export/email":     true,
+		"/api/v1/analytics/export/campaign":  true,
+	},
+}
+
+// EmbedCampaignRoutes are the routes an embed token for a campaign can reach: those reading one
+// campaign, named by its campaignId. Team-wide analytics stay out of reach.
+var EmbedCampaignRoutes = map[string]bool{
+	"/api/v1/analytics/campaign":        true,
+	"/api/v1/analytics/heatmap":         true,
+	"/api/v1/analytics/reports":         true,
+	"/api/v1/analytics/events":          true,
+	"/api/v1/analytics/stream":          true,
+	"/api/v1/analytics/export/campaign": true,
+}
+
+// EmbedToken is a short-lived token a team mints for a widget embedded in its own dashboards,
+// so the browser never sees an API key. The signed token only carries the record's ID; what it
+// grants is kept here so it can be revoked before it expires.
+type EmbedToken struct {
+	Base
+	TeamID            string         `gorm:"type:uuid;not null;index" json:"teamId"`
+	CampaignID        string         `gorm:"type:uuid;default:NULL" json:"campaignId,omitempty"` // when set, only this campaign can be read
+	Scopes            pq.StringArray `gorm:"type:text[];not null" json:"scopes"`
+	ExpiresAt         time.Time      `gorm:"not null;index" json:"expiresAt"`
+	CreatedByUserID   string         `gorm:"type:uuid;default:NULL" json:"createdByUserId,omitempty"`
+	CreatedByAPIKeyID string         `gorm:"type:uuid;default:NULL" json:"createdByApiKeyId,omitempty"`
+}
+
+// GetActiveEmbedToken returns an embed token that is neither revoked nor expired
+func GetActiveEmbedToken(id string, db *gorm.DB) (*EmbedToken, error) {
+	var token EmbedToken
+	if err := db.Where("id = ? AND is_deleted = false AND expires_at > ?", id, time.Now()).First(&token).Error; err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// PruneEmbedTokens deletes a team's embed tokens that expired more than a day ago
+func PruneEmbedTokens(teamID string, db *gorm.DB) error {
+	return db.Where("team_id = ? AND expires_at < ?", teamID, time.Now().Add(-24*time.Hour)).Delete(&EmbedToken{}).Error
+}
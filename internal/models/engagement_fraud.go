@@ -0,0 +1,89 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Reasons an event was flagged as automated
+const (
+	AutomatedReasonClickVolume = "click_volume" // implausibly many clicks on one email
+	AutomatedReasonLinkBurst   = "link_burst"   // several links clicked within a second
+	AutomatedReasonIPVolume    = "ip_volume"    // one IP clicking across many emails at once
+	AutomatedReasonAutoReply   = "auto_reply"   // a reply the recipient's mail server sent on its own
+	AutomatedReasonOutOfOffice = "out_of_office"
+)
+
+// Thresholds past which clicks can't have come from a person reading the email. Link scanners
+// of mail gateways follow every link of an email the moment it arrives.
+const (
+	automatedClicksPerEmail  = 100
+	automatedBurstWindow     = time.Second
+	automatedBurstLinks      = 3
+	automatedIPWindow        = time.Minute
+	automatedIPEmailsClicked = 20
+)
+
+// FlagAutomatedEngagement checks a new click for bot-like engagement. When it finds some, the
+// event and the engagement it's part of are flagged automated so scores, segments, automations
+// and analytics leave them out. It reports whether the event was flagged.
+func FlagAutomatedEngagement(tracking *EmailTracking, db *gorm.DB) (bool, error) {
+	if tracking.Event != EmailTrackingEventClick || tracking.Automated {
+		return false, nil
+	}
+
+	emailEvents := func() *gorm.DB {
+		return db.Model(&EmailTracking{}).Where("email_id = ? AND is_deleted = false", tracking.EmailID)
+	}
+	burstStart := tracking.Timestamp.Add(-automatedBurstWindow)
+
+	var clicks int64
+	if err := emailEvents().Where("event = ?", EmailTrackingEventClick).Count(&clicks).Error; err != nil {
+		return false, err
+	}
+	if clicks >= automatedClicksPerEmail {
+		return true, flagAutomated(tracking, AutomatedReasonClickVolume,
+			emailEvents().Where("event IN ?", []EmailTrackingEvent{EmailTrackingEventClick, EmailTrackingEventOpen}))
+	}
+
+	var links int64
+	if err := emailEvents().
+		Where("event = ? AND timestamp >= ?", EmailTrackingEventClick, burstStart).
+		Distinct("url").Count(&links).Error; err != nil {
+		return false, err
+	}
+	if links >= automatedBurstLinks {
+		// The scanner fetching the pixel records an open alongside its clicks
+		return true, flagAutomated(tracking, AutomatedReasonLinkBurst,
+			emailEvents().Where("event IN ? AND timestamp >= ?",
+				[]EmailTrackingEvent{EmailTrackingEventClick, EmailTrackingEventOpen}, burstStart))
+	}
+
+	if tracking.IPAddress == "" {
+		return false, nil
+	}
+	ipStart := tracking.Timestamp.Add(-automatedIPWindow)
+	ipEvents := func() *gorm.DB {
+		return db.Model(&EmailTracking{}).Where("ip_address = ? AND timestamp >= ? AND is_deleted = false", tracking.IPAddress, ipStart)
+	}
+	var emails int64
+	if err := ipEvents().Where("event = ?", EmailTrackingEventClick).Distinct("email_id").Count(&emails).Error; err != nil {
+		return false, err
+	}
+	if emails >= automatedIPEmailsClicked {
+		return true, flagAutomated(tracking, AutomatedReasonIPVolume,
+			ipEvents().Where("event IN ?", []EmailTrackingEvent{EmailTrackingEventClick, EmailTrackingEventOpen}))
+	}
+
+	return false, nil
+}
+
+// flagAutomated flags the events the query selects, the new one among them, as automated
+func flagAutomated(tracking *EmailTracking, reason string, events *gorm.DB) error {
+	tracking.Automated, tracking.AutomatedReason = true, reason
+	return events.Where("automated = false").Updates(map[string]interface{}{
+		"automated":        true,
+		"automated_reason": reason,
+	}).Error
+}
@@ -0,0 +1,97 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"slices"
+
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+)
+
+// FeatureFlag gates a risky backend feature so it's rolled out to teams gradually. Flags are
+// shared by every team: teams on the allowlist always get an enabled flag, and the others get it
+// when their rollout bucket falls under the rollout percentage.
+type FeatureFlag struct {
+	Base
+	Key            string         `gorm:"not null;index" json:"key" validate:"required,min=2,max=64"` // e.g. automation_executor_v2
+	Description    string         `json:"description"`
+	Enabled        bool           `gorm:"not null" json:"enabled"`                                         // off for every team when false
+	RolloutPercent int            `gorm:"not null" json:"rolloutPercent" validate:"min=0,max=100"`         // share of teams, besides the allowlist
+	TeamAllowlist  pq.StringArray `gorm:"type:text[]" json:"teamAllowlist" validate:"omitempty,dive,uuid"` // team IDs that get the flag regardless of rollout
+}
+
+// ErrFeatureFlagKeyTaken is returned when another flag already has the key
+var ErrFeatureFlagKeyTaken = errors.New("a feature flag with this key already exists")
+
+// rolloutBucket places a team in one of 100 buckets for the flag. Hashing the key with the team
+// keeps a team's bucket stable as the percentage grows, while each flag reaches different teams first.
+func rolloutBucket(key, teamID string) int {
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%s:%s", key, teamID)
+	return int(h.Sum32() % 100)
+}
+
+// EnabledFor tells whether the flag is on for the team
+func (f *FeatureFlag) EnabledFor(teamID string) bool {
+	if !f.Enabled {
+		return false
+	}
+	if slices.Contains(f.TeamAllowlist, teamID) {
+		return true
+	}
+	return rolloutBucket(f.Key, teamID) < f.RolloutPercent
+}
+
+// IsFeatureEnabled tells whether the flag with the key is on for the team. Unknown flags are off.
+func IsFeatureEnabled(key, teamID string, db *gorm.DB) (bool, error) {
+	flag := &FeatureFlag{}
+	err := db.Where("key = ? AND is_deleted = false", key).First(flag).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return flag.EnabledFor(teamID), nil
+}
+
+// EvaluateFeatureFlags returns whether each flag is on for the team, by key
+func EvaluateFeatureFlags(teamID string, db *gorm.DB) (map[string]bool, error) {
+	var flags []FeatureFlag
+	if err := db.Where("is_deleted = false").Find(&flags).Error; err != nil {
+		return nil, err
+	}
+
+	evaluated := make(map[string]bool, len(flags))
+	for _, flag := range flags {
+		evaluated[flag.Key] = flag.EnabledFor(teamID)
+	}
+	return evaluated, nil
+}
+
+// featureFlagKeyTaken tells whether a flag other than the given one has the key
+func featureFlagKeyTaken(tx *gorm.DB, key, id string) (bool, error) {
+	var count int64
+	query := tx.Model(&FeatureFlag{}).Where("key = ? AND is_deleted = false", key)
+	if id != "" {
+		query = query.Where("id <> ?", id)
+	}
+	if err := query.Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// BeforeSave keeps keys unique among the flags that aren't deleted, so a deleted flag's key can be reused
+func (f *FeatureFlag) BeforeSave(tx *gorm.DB) error {
+	taken, err := featureFlagKeyTaken(tx, f.Key, f.ID)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return ErrFeatureFlagKeyTaken
+	}
+	return nil
+}
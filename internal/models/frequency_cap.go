@@ -0,0 +1,138 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// FrequencyCapScope is which of a contact's emails count towards a frequency cap
+type FrequencyCapScope string
+
+const (
+	// FrequencyCapScopeMarketing counts campaign emails and emails of marketing categories
+	FrequencyCapScopeMarketing FrequencyCapScope = "MARKETING"
+	// FrequencyCapScopeAll counts every email sent to the contact
+	FrequencyCapScopeAll FrequencyCapScope = "ALL"
+)
+
+// FrequencyCapAction is what happens to an email that would take a contact over a cap
+type FrequencyCapAction string
+
+const (
+	// FrequencyCapActionSkip leaves the contact out, recording the cap as the reason
+	FrequencyCapActionSkip FrequencyCapAction = "SKIP"
+	// FrequencyCapActionDefer holds the email until the cap lets it through
+	FrequencyCapActionDefer FrequencyCapAction = "DEFER"
+)
+
+// FrequencyCap is a team rule limiting how many emails a contact gets in a period, like at most
+// 3 marketing emails a week
+type FrequencyCap struct {
+	Base
+	Name       string             `gorm:"not null" json:"name" validate:"required,min=2"`
+	MaxEmails  int                `gorm:"not null" json:"maxEmails" validate:"required,min=1"`
+	PeriodDays int                `gorm:"not null" json:"periodDays" validate:"required,min=1,max=365"`
+	Scope      FrequencyCapScope  `gorm:"not null;default:'MARKETING'" json:"scope" validate:"omitempty,oneof=MARKETING ALL"`
+	Action     FrequencyCapAction `gorm:"not null;default:'SKIP'" json:"action" validate:"omitempty,oneof=SKIP DEFER"`
+	IsActive   bool               `gorm:"not null;default:true" json:"isActive"`
+	TeamID     string             `gorm:"type:uuid;not null;index" json:"teamId" validate:"required,uuid"`
+	Team       *Team              `json:"team,omitempty"`
+}
+
+// sentTime is when an email counts against caps: when it was created, or when it's scheduled to
+// go out if that's later
+const sentTime = "GREATEST(emails.created_at, emails.send_at)"
+
+func (f *FrequencyCap) period() time.Duration {
+	return time.Duration(f.PeriodDays) * 24 * time.Hour
+}
+
+// CappedRecipient is a recipient over one of the team's frequency caps
+type CappedRecipient struct {
+	Cap     *FrequencyCap
+	Reason  string
+	RetryAt time.Time // when the cap lets another email through
+}
+
+// Deferred reports whether the email should wait for RetryAt rather than be skipped
+func (r *CappedRecipient) Deferred() bool {
+	return r.Cap.Action == FrequencyCapActionDefer
+}
+
+// CheckFrequencyCaps returns the addresses, lowercased, that already got as many emails as one
+// of the team's active caps allows. Marketing emails count against every cap, others only
+// against caps of scope ALL. A recipient over a skipping cap is skipped even when another
+// would defer them.
+func CheckFrequencyCaps(teamID string, addresses []string, marketing bool, now time.Time, db *gorm.DB) (map[string]*CappedRecipient, error) {
+	capped := make(map[string]*CappedRecipient)
+	if len(addresses) == 0 {
+		return capped, nil
+	}
+
+	var caps []FrequencyCap
+	query := db.Where("team_id = ? AND is_active = true AND is_deleted = false", teamID)
+	if !marketing {
+		query = query.Where("scope = ?", FrequencyCapScopeAll)
+	}
+	if err := query.Order("created_at ASC").Find(&caps).Error; err != nil {
+		return nil, fmt.Errorf("failed to get frequency caps: %w", err)
+	}
+	if len(caps) == 0 {
+		return capped, nil
+	}
+
+	lowered := make([]string, len(addresses))
+	for i, address := range addresses {
+		lowered[i] = strings.ToLower(address)
+	}
+
+	for i := range caps {
+		rule := &caps[i]
+		since := now.Add(-rule.period())
+
+		for start := 0; start < len(lowered); start += sendTimeChunk {
+			chunk := lowered[start:min(start+sendTimeChunk, len(lowered))]
+
+			var rows []struct {
+				Address string
+				Count   int
+				Oldest  time.Time
+			}
+			counted := db.Table("emails").
+				Select(`LOWER(emails."to") AS address, COUNT(*) AS count, MIN(`+sentTime+`) AS oldest`).
+				Where(`emails.team_id = ? AND LOWER(emails."to") IN ?`, teamID, chunk).
+				Where(sentTime+" >= ? AND emails.is_deleted = false AND emails.test = false", since).
+				Where("emails.status NOT IN ?", []EmailStatus{EmailStatusCancelled, EmailStatusSkipped})
+			if rule.Scope != FrequencyCapScopeAll {
+				counted = counted.
+					Joins("LEFT JOIN email_categories ON email_categories.id = emails.category_id").
+					Where("(emails.campaign_id IS NOT NULL OR email_categories.marketing = true)")
+			}
+			if err := counted.Group(`LOWER(emails."to")`).
+				Having("COUNT(*) >= ?", rule.MaxEmails).
+				Scan(&rows).Error; err != nil {
+				return nil, fmt.Errorf("failed to count emails for frequency cap %s: %w", rule.Name, err)
+			}
+
+			for _, row := range rows {
+				recipient := &CappedRecipient{
+					Cap:     rule,
+					Reason:  fmt.Sprintf("frequency cap %q: %d emails in %d days", rule.Name, row.Count, rule.PeriodDays),
+					RetryAt: row.Oldest.Add(rule.period()),
+				}
+				// Skipping wins over deferring, and of two deferrals the later one holds
+				if existing, ok := capped[row.Address]; ok {
+					if !existing.Deferred() || (recipient.Deferred() && !recipient.RetryAt.After(existing.RetryAt)) {
+						continue
+					}
+				}
+				capped[row.Address] = recipient
+			}
+		}
+	}
+
+	return capped, nil
+}
@@ -82,6 +82,19 @@ func GetCampaignByID(id string, db *gorm.DB) (*Campaign, error) {
 	return campaign, nil
 }
 
+// CancelCampaignEmails marks the campaign's emails that haven't gone out, including those
+// waiting for a retry, as cancelled
+func CancelCampaignEmails(campaignID string, db *gorm.DB) (int64, error) {
+	result := db.Model(&Email{}).
+		Where("campaign_id = ? AND is_deleted = false", campaignID).
+		Where("status = ? OR (status = ? AND next_retry_at IS NOT NULL)", EmailStatusPending, EmailStatusFailed).
+		Updates(map[string]interface{}{
+			"status":        EmailStatusCancelled,
+			"next_retry_at": nil,
+		})
+	return result.RowsAffected, result.Error
+}
+
 func GetEmailListByID(id string, db *gorm.DB) (*MailingList, int, error) {
 	emailList := &MailingList{}
 	if err := db.Where("id = ? AND is_deleted = false", id).First(emailList).Error; err != nil {
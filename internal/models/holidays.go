@@ -0,0 +1,162 @@
+package models
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// Holiday is a public holiday on a specific date
+type Holiday struct {
+	Name string    `json:"name"`
+	Date time.Time `json:"date"`
+}
+
+// holidayRule describes how to compute a holiday for a given year. Exactly one of
+// Day (fixed date), Weekday+Week (nth weekday of the month, -1 for last) or
+// EasterOffset (days relative to Easter Sunday) is used.
+type holidayRule struct {
+	Name         string
+	Month        time.Month
+	Day          int
+	Weekday      time.Weekday
+	Week         int
+	EasterOffset *int
+}
+
+func easter(offset int) *int { return &offset }
+
+// builtInHolidays are the public holiday sets teams can opt into
+var builtInHolidays = map[string][]holidayRule{
+	"US": {
+		{Name: "New Year's Day", Month: time.January, Day: 1},
+		{Name: "Martin Luther King Jr. Day", Month: time.January, Weekday: time.Monday, Week: 3},
+		{Name: "Presidents' Day", Month: time.February, Weekday: time.Monday, Week: 3},
+		{Name: "Memorial Day", Month: time.May, Weekday: time.Monday, Week: -1},
+		{Name: "Juneteenth", Month: time.June, Day: 19},
+		{Name: "Independence Day", Month: time.July, Day: 4},
+		{Name: "Labor Day", Month: time.September, Weekday: time.Monday, Week: 1},
+		{Name: "Thanksgiving Day", Month: time.November, Weekday: time.Thursday, Week: 4},
+		{Name: "Christmas Day", Month: time.December, Day: 25},
+	},
+	"GB": {
+		{Name: "New Year's Day", Month: time.January, Day: 1},
+		{Name: "Good Friday", EasterOffset: easter(-2)},
+		{Name: "Easter Monday", EasterOffset: easter(1)},
+		{Name: "Early May Bank Holiday", Month: time.May, Weekday: time.Monday, Week: 1},
+		{Name: "Spring Bank Holiday", Month: time.May, Weekday: time.Monday, Week: -1},
+		{Name: "Summer Bank Holiday", Month: time.August, Weekday: time.Monday, Week: -1},
+		{Name: "Christmas Day", Month: time.December, Day: 25},
+		{Name: "Boxing Day", Month: time.December, Day: 26},
+	},
+	"CA": {
+		{Name: "New Year's Day", Month: time.January, Day: 1},
+		{Name: "Good Friday", EasterOffset: easter(-2)},
+		{Name: "Canada Day", Month: time.July, Day: 1},
+		{Name: "Labour Day", Month: time.September, Weekday: time.Monday, Week: 1},
+		{Name: "Thanksgiving", Month: time.October, Weekday: time.Monday, Week: 2},
+		{Name: "Christmas Day", Month: time.December, Day: 25},
+	},
+	"AU": {
+		{Name: "New Year's Day", Month: time.January, Day: 1},
+		{Name: "Australia Day", Month: time.January, Day: 26},
+		{Name: "Good Friday", EasterOffset: easter(-2)},
+		{Name: "Easter Monday", EasterOffset: easter(1)},
+		{Name: "Anzac Day", Month: time.April, Day: 25},
+		{Name: "Christmas Day", Month: time.December, Day: 25},
+		{Name: "Boxing Day", Month: time.December, Day: 26},
+	},
+	"DE": {
+		{Name: "Neujahr", Month: time.January, Day: 1},
+		{Name: "Karfreitag", EasterOffset: easter(-2)},
+		{Name: "Ostermontag", EasterOffset: easter(1)},
+		{Name: "Tag der Arbeit", Month: time.May, Day: 1},
+		{Name: "Christi Himmelfahrt", EasterOffset: easter(39)},
+		{Name: "Pfingstmontag", EasterOffset: easter(50)},
+		{Name: "Tag der Deutschen Einheit", Month: time.October, Day: 3},
+		{Name: "Erster Weihnachtstag", Month: time.December, Day: 25},
+		{Name: "Zweiter Weihnachtstag", Month: time.December, Day: 26},
+	},
+	"FR": {
+		{Name: "Jour de l'an", Month: time.January, Day: 1},
+		{Name: "Lundi de Pâques", EasterOffset: easter(1)},
+		{Name: "Fête du Travail", Month: time.May, Day: 1},
+		{Name: "Victoire 1945", Month: time.May, Day: 8},
+		{Name: "Ascension", EasterOffset: easter(39)},
+		{Name: "Lundi de Pentecôte", EasterOffset: easter(50)},
+		{Name: "Fête nationale", Month: time.July, Day: 14},
+		{Name: "Assomption", Month: time.August, Day: 15},
+		{Name: "Toussaint", Month: time.November, Day: 1},
+		{Name: "Armistice 1918", Month: time.November, Day: 11},
+		{Name: "Noël", Month: time.December, Day: 25},
+	},
+	"IN": {
+		{Name: "Republic Day", Month: time.January, Day: 26},
+		{Name: "Independence Day", Month: time.August, Day: 15},
+		{Name: "Gandhi Jayanti", Month: time.October, Day: 2},
+		{Name: "Christmas Day", Month: time.December, Day: 25},
+	},
+}
+
+// HolidayCountries returns the country codes that have a built-in holiday set
+func HolidayCountries() []string {
+	countries := make([]string, 0, len(builtInHolidays))
+	for country := range builtInHolidays {
+		countries = append(countries, country)
+	}
+	sort.Strings(countries)
+	return countries
+}
+
+// IsSupportedHolidayCountry reports whether a built-in holiday set exists for the country
+func IsSupportedHolidayCountry(country string) bool {
+	_, ok := builtInHolidays[strings.ToUpper(country)]
+	return ok
+}
+
+// HolidaysForCountry returns the built-in public holidays of a country for a year, sorted by date
+func HolidaysForCountry(country string, year int) []Holiday {
+	rules := builtInHolidays[strings.ToUpper(country)]
+	holidays := make([]Holiday, 0, len(rules))
+	for _, rule := range rules {
+		holidays = append(holidays, Holiday{Name: rule.Name, Date: rule.date(year)})
+	}
+	sort.Slice(holidays, func(i, j int) bool { return holidays[i].Date.Before(holidays[j].Date) })
+	return holidays
+}
+
+func (r holidayRule) date(year int) time.Time {
+	switch {
+	case r.EasterOffset != nil:
+		return easterSunday(year).AddDate(0, 0, *r.EasterOffset)
+	case r.Week > 0:
+		first := time.Date(year, r.Month, 1, 0, 0, 0, 0, time.UTC)
+		shift := (int(r.Weekday) - int(first.Weekday()) + 7) % 7
+		return first.AddDate(0, 0, shift+(r.Week-1)*7)
+	case r.Week < 0:
+		last := time.Date(year, r.Month+1, 0, 0, 0, 0, 0, time.UTC)
+		shift := (int(last.Weekday()) - int(r.Weekday) + 7) % 7
+		return last.AddDate(0, 0, -shift)
+	default:
+		return time.Date(year, r.Month, r.Day, 0, 0, 0, 0, time.UTC)
+	}
+}
+
+// easterSunday computes Western Easter using the anonymous Gregorian algorithm
+func easterSunday(year int) time.Time {
+	a := year % 19
+	b := year / 100
+	c := year % 100
+	d := b / 4
+	e := b % 4
+	f := (b + 8) / 25
+	g := (b - f + 1) / 3
+	h := (19*a + b - d - g + 15) % 30
+	i := c / 4
+	k := c % 4
+	l := (32 + 2*e + 2*i - h - k) % 7
+	m := (a + 11*h + 22*l) / 451
+	month := (h + l - 7*m + 114) / 31
+	day := (h+l-7*m+114)%31 + 1
+	return time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+}
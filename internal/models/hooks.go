@@ -1,9 +1,13 @@
 package models
 
 import (
+	"bytes"
+	"encoding/json"
 	"kori/internal/events"
+	"kori/internal/hooks"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 func (a *APIKey) AfterCreate(tx *gorm.DB) error {
@@ -57,8 +61,93 @@ func (c *ContactImport) AfterCreate(tx *gorm.DB) error {
 	return nil
 }
 
+func (c *Campaign) BeforeCreate(tx *gorm.DB) error {
+	if err := c.Base.BeforeCreate(tx); err != nil {
+		return err
+	}
+	if err := c.validateVariants(); err != nil {
+		return err
+	}
+	if err := c.validateSendTime(); err != nil {
+		return err
+	}
+	if err := c.validateSample(); err != nil {
+		return err
+	}
+	if err := c.checkBlackout(tx); err != nil {
+		return err
+	}
+	return c.runScheduleHooks(tx)
+}
+
+// runScheduleHooks lets extensions change or reject a campaign before it's queued. The team
+// and ID can't be changed by them.
+func (c *Campaign) runScheduleHooks(tx *gorm.DB) error {
+	if !hooks.Has(hooks.BeforeCampaignSchedule) {
+		return nil
+	}
+	id, teamID := c.ID, c.TeamID
+	err := hooks.Run(tx.Statement.Context, hooks.BeforeCampaignSchedule, c)
+	c.ID, c.TeamID = id, teamID
+	return err
+}
+
+func (c *Campaign) BeforeUpdate(tx *gorm.DB) error {
+	// Only re-check while the campaign is still being planned; the send pipeline saves it too
+	if c.Status != CampaignStatusDraft && c.Status != CampaignStatusScheduled && c.Status != "" {
+		return nil
+	}
+	if err := c.validateSendTime(); err != nil {
+		return err
+	}
+	if err := c.validateSample(); err != nil {
+		return err
+	}
+	return c.checkBlackout(tx)
+}
+
 func (c *Campaign) AfterCreate(tx *gorm.DB) error {
 	log.Info("Campaign created %v", c)
 	events.Emit("campaign.created", c)
 	return nil
 }
+
+// AfterCreate lets extensions enrich or reject a new contact. Their changes are saved with it;
+// an error undoes the create. Contacts waiting for confirmation are then mailed the link.
+func (c *Contact) AfterCreate(tx *gorm.DB) error {
+	if err := c.runCreateHooks(tx); err != nil {
+		return err
+	}
+	if c.Status == SubscriberStatusPending {
+		events.Emit("contact.confirmation_requested", c)
+	}
+	return nil
+}
+
+func (c *Contact) runCreateHooks(tx *gorm.DB) error {
+	if !hooks.Has(hooks.AfterContactCreate) {
+		return nil
+	}
+
+	before, _ := json.Marshal(c)
+	id, teamID := c.ID, c.TeamID
+	if err := hooks.Run(tx.Statement.Context, hooks.AfterContactCreate, c); err != nil {
+		return err
+	}
+	c.ID, c.TeamID = id, teamID
+
+	if after, _ := json.Marshal(c); bytes.Equal(before, after) {
+		return nil
+	}
+	return tx.Session(&gorm.Session{SkipHooks: true}).Omit(clause.Associations).Save(c).Error
+}
+
+func (j *LLMEmailWriterJob) AfterCreate(tx *gorm.DB) error {
+	events.Emit("llm_email_writer_job.created", j)
+	return nil
+}
+
+func (e *ContactTimelineExport) AfterCreate(tx *gorm.DB) error {
+	events.Emit("contact_timeline_export.created", e)
+	return nil
+}
@@ -0,0 +1,71 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// IdempotencyKeyTTL is how long a key keeps returning the email it first queued
+const IdempotencyKeyTTL = 24 * time.Hour
+
+// IdempotencyKey remembers the email queued for an Idempotency-Key header so that clients
+// retrying a timed out request get the original email back instead of a second send
+type IdempotencyKey struct {
+	Base
+	Key         string    `gorm:"not null;uniqueIndex:idx_idempotency_keys_team_key" json:"key"`
+	TeamID      string    `gorm:"type:uuid;not null;uniqueIndex:idx_idempotency_keys_team_key" json:"teamId"`
+	Team        *Team     `json:"team,omitempty"`
+	RequestHash string    `gorm:"not null" json:"-"` // sha256 of the request, to catch a key reused for a different email
+	EmailID     string    `gorm:"type:uuid;not null" json:"emailId"`
+	ExpiresAt   time.Time `gorm:"not null;index" json:"expiresAt"`
+}
+
+// ClaimIdempotencyKey reserves the key for emailID. When the key is already held by an
+// unexpired request the existing key is returned and claimed is false.
+func ClaimIdempotencyKey(teamID, key, requestHash, emailID string, db *gorm.DB) (existing *IdempotencyKey, claimed bool, err error) {
+	now := time.Now()
+
+	idempotencyKey := &IdempotencyKey{
+		Key:         key,
+		TeamID:      teamID,
+		RequestHash: requestHash,
+		EmailID:     emailID,
+		ExpiresAt:   now.Add(IdempotencyKeyTTL),
+	}
+	result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(idempotencyKey)
+	if result.Error != nil {
+		return nil, false, result.Error
+	}
+	if result.RowsAffected == 1 {
+		return nil, true, nil
+	}
+
+	// The key exists; take it over when it has expired
+	result = db.Model(&IdempotencyKey{}).
+		Where("team_id = ? AND key = ? AND expires_at <= ?", teamID, key, now).
+		Updates(map[string]interface{}{
+			"request_hash": requestHash,
+			"email_id":     emailID,
+			"expires_at":   now.Add(IdempotencyKeyTTL),
+			"updated_at":   now,
+		})
+	if result.Error != nil {
+		return nil, false, result.Error
+	}
+	if result.RowsAffected == 1 {
+		return nil, true, nil
+	}
+
+	existing = &IdempotencyKey{}
+	if err := db.Where("team_id = ? AND key = ?", teamID, key).First(existing).Error; err != nil {
+		return nil, false, err
+	}
+	return existing, false, nil
+}
+
+// ReleaseIdempotencyKey frees a key whose email could not be queued so the client can retry with it
+func ReleaseIdempotencyKey(teamID, key, emailID string, db *gorm.DB) error {
+	return db.Where("team_id = ? AND key = ? AND email_id = ?", teamID, key, emailID).Delete(&IdempotencyKey{}).Error
+}
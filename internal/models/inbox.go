@@ -0,0 +1,157 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+)
+
+// InboxMessage is a message of an IMAP mailbox synced to the database, for the inbox to
+// search and filter without asking the IMAP server
+type InboxMessage struct {
+	Base
+	TeamID         string         `gorm:"type:uuid;not null;index:idx_inbox_messages_team_date" json:"teamId"`
+	IMAPConfigID   string         `gorm:"type:uuid;not null;uniqueIndex:idx_inbox_messages_uid" json:"imapConfigId"`
+	Folder         string         `gorm:"not null;uniqueIndex:idx_inbox_messages_uid" json:"folder"`
+	UIDValidity    uint32         `gorm:"not null;uniqueIndex:idx_inbox_messages_uid" json:"-"`
+	UID            uint32         `gorm:"not null;uniqueIndex:idx_inbox_messages_uid" json:"uid"`
+	MessageID      string         `gorm:"index" json:"messageId"`
+	InReplyTo      string         `json:"inReplyTo,omitempty"`
+	References     string         `gorm:"column:message_references;type:text" json:"-"` // references is reserved in SQL
+	ConversationID string         `gorm:"type:uuid;default:NULL;index" json:"conversationId,omitempty"`
+	Subject        string         `json:"subject"`
+	FromName       string         `json:"fromName"`
+	FromAddress    string         `gorm:"index" json:"fromAddress"`
+	To             string         `json:"to"`
+	Cc             string         `json:"cc"`
+	Date           time.Time      `gorm:"index:idx_inbox_messages_team_date" json:"date"`
+	Snippet        string         `json:"snippet"`
+	BodyText       string         `gorm:"type:text" json:"bodyText,omitempty"`
+	BodyHTML       string         `gorm:"type:text" json:"bodyHtml,omitempty"`
+	Flags          pq.StringArray `gorm:"type:text[]" json:"flags"`
+	Labels         pq.StringArray `gorm:"type:text[];index:,type:gin" json:"labels"` // the keywords set on the message, e.g. $Important
+	IsRead         bool           `gorm:"not null;default:false" json:"isRead"`
+	HasAttachments bool           `gorm:"not null;default:false" json:"hasAttachments"`
+	AutoReply      string         `gorm:"not null;default:''" json:"autoReply,omitempty"` // auto_reply or out_of_office for messages sent automatically
+	ReturnsAt      *time.Time     `json:"returnsAt,omitempty"`                            // the return an out of office notice stated
+	// what the full-text search matches, subjects weighing most. The simple configuration
+	// doesn't stem, so mail in any language is found by its words.
+	SearchVector string `gorm:"type:tsvector GENERATED ALWAYS AS (setweight(to_tsvector('simple', coalesce(subject, '')), 'A') || setweight(to_tsvector('simple', coalesce(from_name, '') || ' ' || coalesce(from_address, '')), 'B') || setweight(to_tsvector('simple', coalesce(body_text, '')), 'C')) STORED;->:false;<-:false;index:,type:gin" json:"-"`
+}
+
+// InboxFolder is how far a folder of a mailbox has been synced
+type InboxFolder struct {
+	Base
+	TeamID       string    `gorm:"type:uuid;not null" json:"teamId"`
+	IMAPConfigID string    `gorm:"type:uuid;not null;uniqueIndex:idx_inbox_folders_config_folder" json:"imapConfigId"`
+	Folder       string    `gorm:"not null;uniqueIndex:idx_inbox_folders_config_folder" json:"folder"`
+	UIDValidity  uint32    `gorm:"not null;default:0" json:"-"`
+	LastUID      uint32    `gorm:"not null;default:0" json:"-"`
+	SyncedAt     time.Time `gorm:"default:NULL" json:"syncedAt"`
+}
+
+// InboxSort is an order of the inbox
+type InboxSort string
+
+const (
+	InboxSortNewest    InboxSort = "newest"
+	InboxSortOldest    InboxSort = "oldest"
+	InboxSortSender    InboxSort = "sender"
+	InboxSortRelevance InboxSort = "relevance" // best matches of the search first, newest without one
+)
+
+// ErrInvalidInboxSort is returned for sorts the inbox doesn't know
+var ErrInvalidInboxSort = errors.New("sort must be newest, oldest, sender or relevance")
+
+// InboxFilter selects the synced messages of a team's inbox
+type InboxFilter struct {
+	Search         string // full-text search across subject, sender and body, in web search syntax
+	IMAPConfigID   string
+	ConversationID string
+	Folder         string
+	Label          string
+	From           string // part of the sender's address or name
+	Unread         *bool
+	Since          time.Time
+	Before         time.Time
+}
+
+// inboxMessages are the team's synced messages, of mailboxes it still has
+func inboxMessages(teamID string, db *gorm.DB) *gorm.DB {
+	return db.Model(&InboxMessage{}).
+		Where("team_id = ? AND is_deleted = false AND imap_config_id IN (SELECT id FROM imap_configs WHERE team_id = ? AND is_deleted = false)", teamID, teamID)
+}
+
+// InboxQuery returns the team's synced messages matching the filter
+func InboxQuery(teamID string, filter InboxFilter, db *gorm.DB) *gorm.DB {
+	query := inboxMessages(teamID, db)
+	if filter.Search != "" {
+		query = query.Where("search_vector @@ websearch_to_tsquery('simple', ?)", filter.Search)
+	}
+	if filter.IMAPConfigID != "" {
+		query = query.Where("imap_config_id = ?", filter.IMAPConfigID)
+	}
+	if filter.ConversationID != "" {
+		query = query.Where("conversation_id = ?", filter.ConversationID)
+	}
+	if filter.Folder != "" {
+		query = query.Where("folder = ?", filter.Folder)
+	}
+	if filter.Label != "" {
+		query = query.Where("labels @> ?", pq.StringArray{filter.Label})
+	}
+	if filter.From != "" {
+		pattern := "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(strings.ToLower(filter.From)) + "%"
+		query = query.Where("(LOWER(from_address) LIKE ? OR LOWER(from_name) LIKE ?)", pattern, pattern)
+	}
+	if filter.Unread != nil {
+		query = query.Where("is_read = ?", !*filter.Unread)
+	}
+	if !filter.Since.IsZero() {
+		query = query.Where("date >= ?", filter.Since)
+	}
+	if !filter.Before.IsZero() {
+		query = query.Where("date < ?", filter.Before)
+	}
+	return query
+}
+
+// OrderInbox sorts an inbox query. Relevance needs the search the query was filtered with.
+func OrderInbox(query *gorm.DB, sort InboxSort, search string) (*gorm.DB, error) {
+	switch sort {
+	case "", InboxSortNewest:
+		return query.Order("date DESC, id DESC"), nil
+	case InboxSortOldest:
+		return query.Order("date ASC, id ASC"), nil
+	case InboxSortSender:
+		return query.Order("LOWER(from_address) ASC, date DESC, id DESC"), nil
+	case InboxSortRelevance:
+		if search == "" {
+			return query.Order("date DESC, id DESC"), nil
+		}
+		return query.Order(gorm.Expr("ts_rank(search_vector, websearch_to_tsquery('simple', ?)) DESC, date DESC, id DESC", search)), nil
+	}
+	return nil, ErrInvalidInboxSort
+}
+
+// InboxFolderCount is how many synced messages a folder has, and how many of them are unread
+type InboxFolderCount struct {
+	IMAPConfigID string `json:"imapConfigId"`
+	Folder       string `json:"folder"`
+	Messages     int64  `json:"messages"`
+	Unread       int64  `json:"unread"`
+}
+
+// GetInboxFolderCounts returns the synced folders of the team's mailboxes with their counts
+func GetInboxFolderCounts(teamID string, db *gorm.DB) ([]InboxFolderCount, error) {
+	var counts []InboxFolderCount
+	err := inboxMessages(teamID, db).
+		Select("imap_config_id, folder, COUNT(*) AS messages, COUNT(*) FILTER (WHERE is_read = false) AS unread").
+		Group("imap_config_id, folder").
+		Order("imap_config_id, folder").
+		Scan(&counts).Error
+	return counts, err
+}
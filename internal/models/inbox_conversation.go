@@ -0,0 +1,294 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// InboxConversationStatus is where a conversation of the shared inbox stands
+type InboxConversationStatus string
+
+const (
+	InboxConversationStatusOpen    InboxConversationStatus = "open"    // waiting on the team
+	InboxConversationStatusPending InboxConversationStatus = "pending" // waiting on the sender
+	InboxConversationStatusClosed  InboxConversationStatus = "closed"
+)
+
+var (
+	// ErrInvalidAssignee is returned when assigning a conversation to someone outside the team
+	ErrInvalidAssignee = errors.New("the assignee must be a member of the team")
+	// ErrInvalidFollowUpTemplate is returned for bump templates the team doesn't have
+	ErrInvalidFollowUpTemplate = errors.New("the follow-up template must be a template of the team")
+	// ErrInvalidFollowUpSMTPConfig is returned for bump SMTP configs the team doesn't have
+	ErrInvalidFollowUpSMTPConfig = errors.New("the follow-up smtp config must be an smtp config of the team")
+)
+
+// InboxConversation is a thread of synced messages the team works on together, assigned to a
+// teammate and open until they close it. A new message from the sender reopens it, ends its
+// snooze and cancels its follow-up; auto-replies like out of office notices don't.
+type InboxConversation struct {
+	Base
+	TeamID               string                  `gorm:"type:uuid;not null;index:idx_inbox_conversations_team_status" json:"teamId"`
+	IMAPConfigID         string                  `gorm:"type:uuid;not null" json:"imapConfigId"`
+	Subject              string                  `json:"subject"`
+	Status               InboxConversationStatus `gorm:"not null;default:'open';index:idx_inbox_conversations_team_status" json:"status" validate:"required,oneof=open pending closed"`
+	AssigneeID           string                  `gorm:"type:uuid;default:NULL;index" json:"assigneeId,omitempty"`
+	Assignee             *User                   `json:"assignee,omitempty"`
+	MessageCount         int                     `gorm:"not null;default:0" json:"messageCount"`
+	LastMessageAt        time.Time               `gorm:"index" json:"lastMessageAt"`
+	ClosedAt             *time.Time              `json:"closedAt,omitempty"`
+	SnoozedUntil         *time.Time              `gorm:"index" json:"snoozedUntil,omitempty"`                        // left out of the inbox until then
+	FollowUpAt           *time.Time              `gorm:"index" json:"followUpAt,omitempty"`                          // resurfaced then unless the sender replied
+	FollowUpTemplateID   string                  `gorm:"type:uuid;default:NULL" json:"followUpTemplateId,omitempty"` // bump email sent to the sender then
+	FollowUpSMTPConfigID string                  `gorm:"type:uuid;default:NULL" json:"followUpSmtpConfigId,omitempty"`
+	ResurfacedAt         *time.Time              `json:"resurfacedAt,omitempty"` // when a snooze or follow-up last brought it back
+	Messages             []InboxMessage          `gorm:"foreignKey:ConversationID" json:"messages,omitempty"`
+}
+
+// InboxConversationOrder puts the most recently active conversations first, those resurfaced
+// by a snooze or follow-up counting as active then
+const InboxConversationOrder = "GREATEST(last_message_at, resurfaced_at) DESC, id DESC"
+
+// threadMessageIDs returns the Message-IDs a message replies to, the closest first
+func threadMessageIDs(message *InboxMessage) []string {
+	ids := strings.Fields(message.References)
+	for i, j := 0, len(ids)-1; i < j; i, j = i+1, j-1 {
+		ids[i], ids[j] = ids[j], ids[i]
+	}
+	if message.InReplyTo != "" {
+		ids = append([]string{strings.TrimSpace(message.InReplyTo)}, ids...)
+	}
+	return ids
+}
+
+// SaveInboxMessage stores a synced message in the conversation of the messages it replies to,
+// or a new one. It reports false for messages already stored.
+func SaveInboxMessage(message *InboxMessage, mailboxAddress string, db *gorm.DB) (bool, error) {
+	saved := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(message)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		saved = true
+		return ThreadInboxMessage(message, mailboxAddress, tx)
+	})
+	return saved, err
+}
+
+// ThreadInboxMessage adds a stored message to its conversation. Messages from anyone but the
+// mailbox itself reopen the conversation, unless they were auto-replies.
+func ThreadInboxMessage(message *InboxMessage, mailboxAddress string, db *gorm.DB) error {
+	conversation := InboxConversation{}
+	if ids := threadMessageIDs(message); len(ids) > 0 {
+		var parent InboxMessage
+		err := db.Select("conversation_id").
+			Where("imap_config_id = ? AND message_id IN ? AND conversation_id IS NOT NULL AND is_deleted = false", message.IMAPConfigID, ids).
+			Order("date DESC").
+			First(&parent).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if parent.ConversationID != "" {
+			if err := db.First(&conversation, "id = ?", parent.ConversationID).Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+				return err
+			}
+		}
+	}
+
+	if conversation.ID == "" {
+		conversation = InboxConversation{
+			TeamID:        message.TeamID,
+			IMAPConfigID:  message.IMAPConfigID,
+			Subject:       message.Subject,
+			Status:        InboxConversationStatusOpen,
+			LastMessageAt: message.Date,
+		}
+		if err := db.Create(&conversation).Error; err != nil {
+			return err
+		}
+	}
+
+	updates := map[string]interface{}{
+		"message_count":   gorm.Expr("message_count + 1"),
+		"last_message_at": gorm.Expr("GREATEST(last_message_at, ?)", message.Date),
+	}
+	if !strings.EqualFold(message.FromAddress, mailboxAddress) && message.AutoReply == "" {
+		updates["status"] = InboxConversationStatusOpen
+		updates["closed_at"] = nil
+		updates["snoozed_until"] = nil
+		for column, value := range inboxFollowUpCleared {
+			updates[column] = value
+		}
+	}
+	if err := db.Model(&InboxConversation{}).Where("id = ?", conversation.ID).UpdateColumns(updates).Error; err != nil {
+		return err
+	}
+
+	message.ConversationID = conversation.ID
+	return db.Model(&InboxMessage{}).Where("id = ?", message.ID).UpdateColumn("conversation_id", conversation.ID).Error
+}
+
+// InboxConversationFilter selects the conversations of a team's shared inbox
+type InboxConversationFilter struct {
+	Search       string // full-text search across the conversations' messages
+	IMAPConfigID string
+	Status       InboxConversationStatus
+	AssigneeID   string
+	Unassigned   bool
+	Snoozed      *bool // only the snoozed conversations, or only the others
+}
+
+// InboxConversationQuery returns the team's conversations matching the filter
+func InboxConversationQuery(teamID string, filter InboxConversationFilter, db *gorm.DB) *gorm.DB {
+	query := db.Model(&InboxConversation{}).
+		Where("team_id = ? AND is_deleted = false AND imap_config_id IN (SELECT id FROM imap_configs WHERE team_id = ? AND is_deleted = false)", teamID, teamID)
+	if filter.IMAPConfigID != "" {
+		query = query.Where("imap_config_id = ?", filter.IMAPConfigID)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.AssigneeID != "" {
+		query = query.Where("assignee_id = ?", filter.AssigneeID)
+	}
+	if filter.Unassigned {
+		query = query.Where("assignee_id IS NULL")
+	}
+	if filter.Snoozed != nil {
+		snoozed := "snoozed_until > ?"
+		if !*filter.Snoozed {
+			snoozed = "(snoozed_until IS NULL OR snoozed_until <= ?)"
+		}
+		query = query.Where(snoozed, time.Now())
+	}
+	if filter.Search != "" {
+		query = query.Where("id IN (?)", inboxMessages(teamID, db).Select("conversation_id").
+			Where("search_vector @@ websearch_to_tsquery('simple', ?)", filter.Search))
+	}
+	return query
+}
+
+// AssignInboxConversation assigns a conversation to a teammate, or nobody when assigneeID is empty
+func AssignInboxConversation(conversation *InboxConversation, assigneeID string, db *gorm.DB) error {
+	if assigneeID == "" {
+		conversation.AssigneeID = ""
+		return db.Model(&InboxConversation{}).Where("id = ?", conversation.ID).UpdateColumn("assignee_id", nil).Error
+	}
+
+	var members int64
+	if err := db.Model(&User{}).Where("id = ? AND team_id = ? AND is_deleted = false", assigneeID, conversation.TeamID).
+		Count(&members).Error; err != nil {
+		return err
+	}
+	if members == 0 {
+		return ErrInvalidAssignee
+	}
+	conversation.AssigneeID = assigneeID
+	return db.Model(&InboxConversation{}).Where("id = ?", conversation.ID).UpdateColumn("assignee_id", assigneeID).Error
+}
+
+// SetInboxConversationStatus moves a conversation to a status, noting when it was closed
+func SetInboxConversationStatus(conversation *InboxConversation, status InboxConversationStatus, db *gorm.DB) error {
+	conversation.Status = status
+	conversation.ClosedAt = nil
+	if status == InboxConversationStatusClosed {
+		now := time.Now()
+		conversation.ClosedAt = &now
+	}
+	return db.Model(&InboxConversation{}).Where("id = ?", conversation.ID).UpdateColumns(map[string]interface{}{
+		"status":    conversation.Status,
+		"closed_at": conversation.ClosedAt,
+	}).Error
+}
+
+// SnoozeInboxConversation hides a conversation until a time, or ends its snooze when until is nil
+func SnoozeInboxConversation(conversation *InboxConversation, until *time.Time, db *gorm.DB) error {
+	conversation.SnoozedUntil = until
+	return db.Model(&InboxConversation{}).Where("id = ?", conversation.ID).UpdateColumn("snoozed_until", until).Error
+}
+
+// inboxFollowUpCleared are the columns of a conversation without a follow-up
+var inboxFollowUpCleared = map[string]interface{}{
+	"follow_up_at":             nil,
+	"follow_up_template_id":    nil,
+	"follow_up_smtp_config_id": nil,
+}
+
+// SetInboxFollowUp resurfaces a conversation at a time unless the sender replies first, mailing
+// them the template then if one is given. A nil at cancels the follow-up.
+func SetInboxFollowUp(conversation *InboxConversation, at *time.Time, templateID, smtpConfigID string, db *gorm.DB) error {
+	if at == nil {
+		conversation.FollowUpAt, conversation.FollowUpTemplateID, conversation.FollowUpSMTPConfigID = nil, "", ""
+		return db.Model(&InboxConversation{}).Where("id = ?", conversation.ID).UpdateColumns(inboxFollowUpCleared).Error
+	}
+
+	updates := map[string]interface{}{"follow_up_at": at, "follow_up_template_id": nil, "follow_up_smtp_config_id": nil}
+	if templateID != "" {
+		var templates int64
+		if err := db.Model(&Template{}).Where("id = ? AND team_id = ? AND is_deleted = false", templateID, conversation.TeamID).
+			Count(&templates).Error; err != nil {
+			return err
+		}
+		if templates == 0 {
+			return ErrInvalidFollowUpTemplate
+		}
+		updates["follow_up_template_id"] = templateID
+	}
+	if smtpConfigID != "" {
+		if _, err := GetSMTPConfig(conversation.TeamID, smtpConfigID, "", db); err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvalidFollowUpSMTPConfig
+			}
+			return err
+		}
+		updates["follow_up_smtp_config_id"] = smtpConfigID
+	}
+
+	conversation.FollowUpAt, conversation.FollowUpTemplateID, conversation.FollowUpSMTPConfigID = at, templateID, smtpConfigID
+	return db.Model(&InboxConversation{}).Where("id = ?", conversation.ID).UpdateColumns(updates).Error
+}
+
+// inboxResurfaced are the columns of a conversation brought back to the inbox
+func inboxResurfaced(now time.Time) map[string]interface{} {
+	return map[string]interface{}{
+		"status":        InboxConversationStatusOpen,
+		"closed_at":     nil,
+		"snoozed_until": nil,
+		"resurfaced_at": now,
+	}
+}
+
+// WakeInboxConversations resurfaces the conversations whose snooze is over
+func WakeInboxConversations(now time.Time, db *gorm.DB) (int64, error) {
+	result := db.Model(&InboxConversation{}).
+		Where("snoozed_until <= ? AND is_deleted = false", now).
+		UpdateColumns(inboxResurfaced(now))
+	return result.RowsAffected, result.Error
+}
+
+// DueInboxFollowUps returns the conversations whose follow-up is due, the oldest first
+func DueInboxFollowUps(now time.Time, limit int, db *gorm.DB) ([]InboxConversation, error) {
+	var conversations []InboxConversation
+	err := db.Where("follow_up_at <= ? AND is_deleted = false", now).
+		Order("follow_up_at ASC").Limit(limit).
+		Find(&conversations).Error
+	return conversations, err
+}
+
+// ClaimInboxFollowUp resurfaces a conversation whose follow-up is due and clears the follow-up.
+// It reports false when a reply or another worker got to it first, so the bump is sent once.
+func ClaimInboxFollowUp(conversation *InboxConversation, now time.Time, db *gorm.DB) (bool, error) {
+	updates := inboxResurfaced(now)
+	for column, value := range inboxFollowUpCleared {
+		updates[column] = value
+	}
+	result := db.Model(&InboxConversation{}).
+		Where("id = ? AND follow_up_at <= ?", conversation.ID, now).
+		UpdateColumns(updates)
+	return result.RowsAffected > 0, result.Error
+}
@@ -0,0 +1,95 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// inboxReplyWindow is how long after an email a message from its recipient counts as a reply
+	inboxReplyWindow = 30 * 24 * time.Hour
+	// OutOfOfficePause holds the automations of contacts away who didn't say when they're back
+	OutOfOfficePause = 3 * 24 * time.Hour
+)
+
+// inboxReplyMetadata is kept on reply events recorded from synced messages
+type inboxReplyMetadata struct {
+	InboxMessageID string     `json:"inboxMessageId"`
+	MessageID      string     `json:"messageId,omitempty"`
+	Subject        string     `json:"subject,omitempty"`
+	AutoReply      string     `json:"autoReply,omitempty"`
+	ReturnsAt      *time.Time `json:"returnsAt,omitempty"`
+}
+
+// RecordInboxReply records a synced message from someone the team emailed as a reply to the
+// latest email sent to them in the 30 days before it. Auto-replies are recorded automated, so
+// analytics, scores and segments don't count them as replies. It returns nil when the message
+// isn't a reply to the team's emails or was recorded already.
+func RecordInboxReply(message *InboxMessage, mailboxAddress string, db *gorm.DB) (*EmailTracking, error) {
+	sender := strings.ToLower(message.FromAddress)
+	if sender == "" || strings.EqualFold(sender, mailboxAddress) {
+		return nil, nil
+	}
+
+	email := &Email{}
+	if err := db.Select("id", "campaign_id", "contact_id").
+		Where("team_id = ? AND LOWER(\"to\") = ? AND status NOT IN ? AND is_deleted = false", message.TeamID, sender,
+			[]EmailStatus{EmailStatusPending, EmailStatusCancelled, EmailStatusSkipped, EmailStatusFailed}).
+		Where("sent_at BETWEEN ? AND ?", message.Date.Add(-inboxReplyWindow), message.Date).
+		Order("sent_at DESC").First(email).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	// A mailbox synced again from scratch stores its messages anew
+	duplicate := db.Model(&EmailTracking{}).Where("email_id = ? AND event = ?", email.ID, EmailTrackingEventReply)
+	if message.MessageID != "" {
+		duplicate = duplicate.Where("metadata->>'messageId' = ?", message.MessageID)
+	} else {
+		duplicate = duplicate.Where("metadata->>'inboxMessageId' = ?", message.ID)
+	}
+	var count int64
+	if err := duplicate.Count(&count).Error; err != nil || count > 0 {
+		return nil, err
+	}
+
+	metadata, _ := json.Marshal(inboxReplyMetadata{
+		InboxMessageID: message.ID,
+		MessageID:      message.MessageID,
+		Subject:        message.Subject,
+		AutoReply:      message.AutoReply,
+		ReturnsAt:      message.ReturnsAt,
+	})
+	tracking := &EmailTracking{
+		EmailID:         email.ID,
+		CampaignID:      email.CampaignID,
+		ContactID:       email.ContactID,
+		Event:           EmailTrackingEventReply,
+		Timestamp:       message.Date,
+		Metadata:        metadata,
+		Automated:       message.AutoReply != "",
+		AutomatedReason: message.AutoReply,
+	}
+	if err := db.Create(tracking).Error; err != nil {
+		return nil, err
+	}
+	return tracking, nil
+}
+
+// PauseContactAutomations holds the automation runs in progress of the team's contacts with an
+// address until a time, so an out of office contact gets the rest of their sequence once back.
+// Runs held longer already keep their pause. It returns how many runs were paused.
+func PauseContactAutomations(teamID, address string, until time.Time, db *gorm.DB) (int64, error) {
+	result := db.Model(&AutomationRun{}).
+		Where("team_id = ? AND status IN ? AND is_deleted = false", teamID, []AutomationRunStatus{AutomationRunStatusActive, AutomationRunStatusWaiting}).
+		Where("contact_id IN (SELECT id FROM contacts WHERE team_id = ? AND LOWER(email) = ? AND is_deleted = false)", teamID, strings.ToLower(address)).
+		Where("paused_until IS NULL OR paused_until < ?", until).
+		UpdateColumn("paused_until", until)
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,383 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Index advisor sampling limits
+const (
+	IndexAdvisorSampleSize = 100 // statements sampled per run, by total execution time
+	IndexAdvisorMinCalls   = 20  // statements called less often aren't worth an index
+	IndexAdvisorMinMeanMs  = 5.0 // statements faster than this on average are left alone
+	indexAdvisorMaxColumns = 3
+)
+
+// ErrIndexAdvisorUnavailable is returned when pg_stat_statements isn't installed in the database
+var ErrIndexAdvisorUnavailable = errors.New("pg_stat_statements extension is not installed")
+
+// IndexRecommendation is an index that would serve slow statements seen in pg_stat_statements.
+// Statements the index would serve are merged, so Calls and TotalTimeMs are the sums over them
+// and Query is the slowest one.
+type IndexRecommendation struct {
+	Base
+	Table       string         `gorm:"column:table_name;not null;index" json:"table"`
+	Columns     pq.StringArray `gorm:"type:text[]" json:"columns"`
+	Statement   string         `gorm:"not null;uniqueIndex" json:"statement"`
+	Query       string         `gorm:"type:text" json:"query"`
+	Queries     int            `json:"queries"`
+	Calls       int64          `json:"calls"`
+	Rows        int64          `json:"rows"`
+	TotalTimeMs float64        `json:"totalTimeMs"`
+	MeanTimeMs  float64        `json:"meanTimeMs"`
+	FirstSeenAt time.Time      `json:"firstSeenAt"`
+	LastSeenAt  time.Time      `gorm:"index" json:"lastSeenAt"`
+}
+
+// QueryStat is a statement sampled from pg_stat_statements
+type QueryStat struct {
+	Query       string
+	Calls       int64
+	Rows        int64
+	TotalTimeMs float64
+	MeanTimeMs  float64
+}
+
+// IndexAdvisorAvailable reports whether pg_stat_statements is installed
+func IndexAdvisorAvailable(db *gorm.DB) (bool, error) {
+	var count int64
+	if err := db.Raw("SELECT COUNT(*) FROM pg_extension WHERE extname = 'pg_stat_statements'").Scan(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// SampleSlowQueries returns this database's statements that took the most time in total
+func SampleSlowQueries(db *gorm.DB) ([]QueryStat, error) {
+	available, err := IndexAdvisorAvailable(db)
+	if err != nil {
+		return nil, err
+	}
+	if !available {
+		return nil, ErrIndexAdvisorUnavailable
+	}
+
+	var stats []QueryStat
+	if err := db.Raw(`
+		SELECT query, calls, rows, total_exec_time AS total_time_ms, mean_exec_time AS mean_time_ms
+		FROM pg_stat_statements
+		WHERE dbid = (SELECT oid FROM pg_database WHERE datname = current_database())
+			AND calls >= ? AND mean_exec_time >= ?
+			AND query !~* 'pg_stat_statements|pg_catalog|information_schema'
+		ORDER BY total_exec_time DESC
+		LIMIT ?`, IndexAdvisorMinCalls, IndexAdvisorMinMeanMs, IndexAdvisorSampleSize).
+		Scan(&stats).Error; err != nil {
+		return nil, fmt.Errorf("failed to sample pg_stat_statements: %w", err)
+	}
+	return stats, nil
+}
+
+// RefreshIndexRecommendations samples the slow statements, works out the indexes that would
+// serve them and stores the ones that don't exist yet. Recommendations whose index has since
+// been created are removed.
+func RefreshIndexRecommendations(db *gorm.DB) ([]IndexRecommendation, error) {
+	stats, err := SampleSlowQueries(db)
+	if err != nil {
+		return nil, err
+	}
+	indexes, err := existingIndexes(db)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	byStatement := map[string]*IndexRecommendation{}
+	var order []string
+	for _, stat := range stats {
+		shape, ok := parseQueryShape(stat.Query)
+		if !ok {
+			continue
+		}
+		tableIndexes, exists := indexes[shape.table]
+		if !exists || shape.coveredBy(tableIndexes) {
+			continue
+		}
+
+		statement := shape.statement()
+		recommendation, seen := byStatement[statement]
+		if !seen {
+			recommendation = &IndexRecommendation{
+				Table:       shape.table,
+				Columns:     pq.StringArray(shape.columns),
+				Statement:   statement,
+				FirstSeenAt: now,
+				LastSeenAt:  now,
+			}
+			byStatement[statement] = recommendation
+			order = append(order, statement)
+		}
+		if stat.MeanTimeMs > recommendation.MeanTimeMs || recommendation.Query == "" {
+			recommendation.Query = stat.Query
+		}
+		recommendation.Queries++
+		recommendation.Calls += stat.Calls
+		recommendation.Rows += stat.Rows
+		recommendation.TotalTimeMs += stat.TotalTimeMs
+	}
+
+	recommendations := make([]IndexRecommendation, 0, len(order))
+	for _, statement := range order {
+		recommendation := byStatement[statement]
+		recommendation.MeanTimeMs = recommendation.TotalTimeMs / float64(recommendation.Calls)
+		recommendations = append(recommendations, *recommendation)
+	}
+
+	if len(recommendations) > 0 {
+		if err := db.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "statement"}},
+			DoUpdates: clause.AssignmentColumns([]string{"query", "queries", "calls", "rows", "total_time_ms", "mean_time_ms", "last_seen_at", "updated_at"}),
+		}).Create(&recommendations).Error; err != nil {
+			return nil, fmt.Errorf("failed to save index recommendations: %w", err)
+		}
+	}
+
+	// Drop recommendations that a migration has since taken care of
+	var stored []IndexRecommendation
+	if err := db.Find(&stored).Error; err != nil {
+		return nil, err
+	}
+	var resolved []string
+	for _, recommendation := range stored {
+		if _, current := byStatement[recommendation.Statement]; current {
+			continue
+		}
+		// The split between equality and sort columns isn't stored, so any order counts here
+		shape := queryShape{table: recommendation.Table, columns: recommendation.Columns, equalities: len(recommendation.Columns)}
+		if shape.coveredBy(indexes[recommendation.Table]) {
+			resolved = append(resolved, recommendation.ID)
+		}
+	}
+	if len(resolved) > 0 {
+		if err := db.Where("id IN ?", resolved).Delete(&IndexRecommendation{}).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	return recommendations, nil
+}
+
+// GetIndexRecommendations returns the stored recommendations, the most expensive first
+func GetIndexRecommendations(limit int, db *gorm.DB) ([]IndexRecommendation, error) {
+	var recommendations []IndexRecommendation
+	err := db.Order("total_time_ms DESC").Limit(limit).Find(&recommendations).Error
+	return recommendations, err
+}
+
+var indexColumnsPattern = regexp.MustCompile(`(?i)USING \w+ \(([^)]*)\)`)
+
+// existingIndexes returns the leading columns of every index, by table, for the tables of the
+// current schema. Tables without indexes are listed with none so unknown names can be told apart.
+func existingIndexes(db *gorm.DB) (map[string][][]string, error) {
+	var tables []string
+	if err := db.Raw("SELECT tablename FROM pg_tables WHERE schemaname = current_schema()").Scan(&tables).Error; err != nil {
+		return nil, fmt.Errorf("failed to list tables: %w", err)
+	}
+	indexes := make(map[string][][]string, len(tables))
+	for _, table := range tables {
+		indexes[table] = nil
+	}
+
+	var rows []struct {
+		Tablename string
+		Indexdef  string
+	}
+	if err := db.Raw("SELECT tablename, indexdef FROM pg_indexes WHERE schemaname = current_schema()").Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to list indexes: %w", err)
+	}
+	for _, row := range rows {
+		match := indexColumnsPattern.FindStringSubmatch(row.Indexdef)
+		if match == nil {
+			continue
+		}
+		var columns []string
+		for _, column := range strings.Split(match[1], ",") {
+			// Drop sort options such as DESC; expression columns never match a plain one
+			fields := strings.Fields(column)
+			if len(fields) == 0 {
+				break
+			}
+			columns = append(columns, strings.ToLower(strings.Trim(fields[0], `"`)))
+		}
+		indexes[row.Tablename] = append(indexes[row.Tablename], columns)
+	}
+	return indexes, nil
+}
+
+// queryShape is what an index for a statement has to cover: the columns compared for equality,
+// followed by at most one range or sort column
+type queryShape struct {
+	table      string
+	columns    []string
+	equalities int
+}
+
+// lowSelectivityColumns are filtered on by nearly every statement but don't narrow it down
+var lowSelectivityColumns = map[string]bool{"is_deleted": true, "deleted_at": true}
+
+var (
+	joinPattern      = regexp.MustCompile(`(?i)\bjoin\b`)
+	tablePattern     = regexp.MustCompile(`(?i)^\s*(?:select\b.*?\bfrom|update|delete\s+from)\s+"?([a-z_][a-z0-9_]*)"?`)
+	wherePattern     = regexp.MustCompile(`(?is)\bwhere\b(.*?)(?:\border\s+by\b|\bgroup\s+by\b|\blimit\b|\boffset\b|\breturning\b|\bfor\s+update\b|$)`)
+	orderPattern     = regexp.MustCompile(`(?i)\border\s+by\s+(?:"?([a-z_][a-z0-9_]*)"?\.)?"?([a-z_][a-z0-9_]*)"?`)
+	predicatePattern = regexp.MustCompile(`(?i)(?:"?([a-z_][a-z0-9_]*)"?\.)?"?([a-z_][a-z0-9_]*)"?\s*(<=|>=|<>|!=|=|<|>|\bin\b|\bis\s+null\b|\bbetween\b)`)
+)
+
+// parseQueryShape works out the index a statement would use from its WHERE and ORDER BY
+// clauses. It handles the statements GORM builds: a single table, optionally qualified
+// columns, and comparisons against parameters.
+func parseQueryShape(query string) (queryShape, bool) {
+	match := tablePattern.FindStringSubmatch(query)
+	if match == nil {
+		return queryShape{}, false
+	}
+	shape := queryShape{table: strings.ToLower(match[1])}
+	joined := joinPattern.MatchString(query)
+
+	// Columns of other tables, or unqualified ones in a join, can't go in this table's index
+	ownColumn := func(qualifier, column string) (string, bool) {
+		qualifier, column = strings.ToLower(qualifier), strings.ToLower(column)
+		if qualifier != "" && qualifier != shape.table {
+			return "", false
+		}
+		if qualifier == "" && joined {
+			return "", false
+		}
+		switch column {
+		case "and", "or", "not", "null", "true", "false":
+			return "", false
+		}
+		return column, true
+	}
+
+	body := stripSubqueries(query[len(match[0]):])
+	where := wherePattern.FindStringSubmatch(body)
+	if where == nil {
+		return queryShape{}, false
+	}
+
+	var equalities []string
+	var ranged string
+	seen := map[string]bool{}
+	for _, predicate := range predicatePattern.FindAllStringSubmatch(where[1], -1) {
+		column, ok := ownColumn(predicate[1], predicate[2])
+		if !ok || seen[column] || lowSelectivityColumns[column] {
+			continue
+		}
+		switch operator := strings.ToLower(strings.Join(strings.Fields(predicate[3]), " ")); operator {
+		case "=", "in", "is null":
+			seen[column] = true
+			equalities = append(equalities, column)
+		case "<", ">", "<=", ">=", "between":
+			if ranged == "" {
+				ranged = column
+			}
+		}
+	}
+
+	if ranged == "" {
+		if order := orderPattern.FindStringSubmatch(body); order != nil {
+			if column, ok := ownColumn(order[1], order[2]); ok {
+				ranged = column
+			}
+		}
+	}
+
+	// Lead with the tenant so one index serves every team, then keep the rest stable
+	sort.SliceStable(equalities, func(i, j int) bool {
+		if (equalities[i] == "team_id") != (equalities[j] == "team_id") {
+			return equalities[i] == "team_id"
+		}
+		return equalities[i] < equalities[j]
+	})
+	if len(equalities) > indexAdvisorMaxColumns {
+		equalities = equalities[:indexAdvisorMaxColumns]
+	}
+	shape.columns = equalities
+	shape.equalities = len(equalities)
+	if ranged != "" && !seen[ranged] && len(shape.columns) < indexAdvisorMaxColumns {
+		shape.columns = append(shape.columns, ranged)
+	}
+
+	// Lookups by primary key are already indexed
+	if len(shape.columns) == 0 || (len(shape.columns) == 1 && shape.columns[0] == "id") || seen["id"] {
+		return queryShape{}, false
+	}
+	return shape, true
+}
+
+// coveredBy reports whether one of the indexes already serves the shape: its leading columns
+// are the shape's equality columns in any order, followed by its range or sort column
+func (s queryShape) coveredBy(indexes [][]string) bool {
+	for _, index := range indexes {
+		if len(index) < len(s.columns) {
+			continue
+		}
+		leading := map[string]bool{}
+		for _, column := range index[:s.equalities] {
+			leading[column] = true
+		}
+		covered := true
+		for i, column := range s.columns {
+			if (i < s.equalities && !leading[column]) || (i >= s.equalities && index[i] != column) {
+				covered = false
+				break
+			}
+		}
+		if covered {
+			return true
+		}
+	}
+	return false
+}
+
+// statement is the migration that creates the index
+func (s queryShape) statement() string {
+	name := "idx_" + s.table + "_" + strings.Join(s.columns, "_")
+	if len(name) > 63 {
+		name = name[:63]
+	}
+	return fmt.Sprintf(`CREATE INDEX CONCURRENTLY IF NOT EXISTS %s ON "%s" (%s)`, name, s.table, strings.Join(s.columns, ", "))
+}
+
+// stripSubqueries removes parenthesised subqueries so only the statement's own clauses are parsed
+func stripSubqueries(query string) string {
+	var out strings.Builder
+	lower := strings.ToLower(query)
+	for i := 0; i < len(query); i++ {
+		if query[i] == '(' && strings.HasPrefix(strings.TrimLeft(lower[i+1:], " \n\t"), "select") {
+			depth := 0
+			for ; i < len(query); i++ {
+				if query[i] == '(' {
+					depth++
+				} else if query[i] == ')' {
+					depth--
+					if depth == 0 {
+						break
+					}
+				}
+			}
+			out.WriteString("()")
+			continue
+		}
+		out.WriteByte(query[i])
+	}
+	return out.String()
+}
@@ -0,0 +1,147 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// CampaignLanguage is a translation of a campaign sent to contacts whose locale matches Language.
+// Contacts without a matching language get the campaign's own template.
+type CampaignLanguage struct {
+	Base
+	CampaignID string    `gorm:"type:uuid;not null;index" json:"campaignId" validate:"omitempty,uuid"`
+	Campaign   *Campaign `json:"campaign,omitempty"`
+	Language   string    `gorm:"not null" json:"language" validate:"required,bcp47_language_tag"` // e.g. de or pt-BR
+	TemplateID string    `gorm:"type:uuid;not null" json:"templateId" validate:"required,uuid"`
+	Template   *Template `json:"template,omitempty"`
+	Subject    string    `json:"subject"`  // the template's subject when empty
+	FromName   string    `json:"fromName"` // the variant's or sender's name when empty
+	TeamID     string    `gorm:"type:uuid;not null" json:"teamId" validate:"omitempty,uuid"`
+	Team       *Team     `json:"team,omitempty"`
+}
+
+// LanguageStats are the stats of the emails a campaign sent in one language
+type LanguageStats struct {
+	Language  string         `json:"language"` // empty for the campaign's own template
+	Stats     *CampaignStats `json:"stats"`
+	OpenRate  float64        `json:"openRate"`
+	ClickRate float64        `json:"clickRate"`
+}
+
+// NormalizeLanguage lowercases a language tag and uses hyphens, so en_US matches en-US
+func NormalizeLanguage(tag string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(tag), "_", "-"))
+}
+
+func (l *CampaignLanguage) BeforeCreate(tx *gorm.DB) error {
+	if err := l.Base.BeforeCreate(tx); err != nil {
+		return err
+	}
+	l.Language = NormalizeLanguage(l.Language)
+
+	var campaign Campaign
+	if err := tx.Session(&gorm.Session{NewDB: true}).Select("id", "team_id").
+		Where("id = ?", l.CampaignID).First(&campaign).Error; err != nil {
+		return &ValidationError{Message: "campaign not found"}
+	}
+	if l.TeamID == "" {
+		l.TeamID = campaign.TeamID
+	}
+
+	var existing int64
+	if err := tx.Session(&gorm.Session{NewDB: true}).Model(&CampaignLanguage{}).
+		Where("campaign_id = ? AND language = ? AND is_deleted = false", l.CampaignID, l.Language).
+		Count(&existing).Error; err != nil {
+		return err
+	}
+	if existing > 0 {
+		return &ValidationError{Message: fmt.Sprintf("campaign already has a %s variant", l.Language)}
+	}
+	return nil
+}
+
+func (l *CampaignLanguage) BeforeUpdate(tx *gorm.DB) error {
+	l.Language = NormalizeLanguage(l.Language)
+	return nil
+}
+
+// GetCampaignLanguages returns a campaign's language variants with their templates
+func GetCampaignLanguages(campaignID string, db *gorm.DB) ([]CampaignLanguage, error) {
+	var languages []CampaignLanguage
+	if err := db.Preload("Template.HtmlFile").
+		Where("campaign_id = ? AND is_deleted = false", campaignID).
+		Order("created_at ASC").
+		Find(&languages).Error; err != nil {
+		return nil, err
+	}
+	return languages, nil
+}
+
+// PickCampaignLanguage returns the language variant for a contact's locale: the exact tag, else
+// the bare language (de for de-AT), else another region of it (pt-BR for pt-PT). It returns nil
+// when none fits and the campaign's own template is sent.
+func PickCampaignLanguage(languages []CampaignLanguage, locale string) *CampaignLanguage {
+	locale = NormalizeLanguage(locale)
+	if locale == "" {
+		return nil
+	}
+	base, _, _ := strings.Cut(locale, "-")
+
+	var bare, regional *CampaignLanguage
+	for i := range languages {
+		language := NormalizeLanguage(languages[i].Language)
+		primary, _, _ := strings.Cut(language, "-")
+		switch {
+		case language == locale:
+			return &languages[i]
+		case language == base && bare == nil:
+			bare = &languages[i]
+		case primary == base && regional == nil:
+			regional = &languages[i]
+		}
+	}
+	if bare != nil {
+		return bare
+	}
+	return regional
+}
+
+// GetLanguageStats computes the stats of a campaign's emails per language they were sent in
+func GetLanguageStats(campaignID string, db *gorm.DB) ([]LanguageStats, error) {
+	delivered := []EmailStatus{EmailStatusSent, EmailStatusOpened, EmailStatusClicked, EmailStatusBounced}
+
+	var sent []struct {
+		Language string
+		Count    int64
+	}
+	if err := db.Model(&Email{}).
+		Select("language, COUNT(*) AS count").
+		Where("campaign_id = ? AND status IN ? AND is_deleted = false", campaignID, delivered).
+		Group("language").
+		Order("language").
+		Scan(&sent).Error; err != nil {
+		return nil, fmt.Errorf("failed to count emails per language: %w", err)
+	}
+
+	results := make([]LanguageStats, 0, len(sent))
+	for _, row := range sent {
+		stats := &CampaignStats{Sent: row.Count}
+		if err := stats.countEvents(db.Model(&EmailTracking{}).
+			Select("email_trackings.event, COUNT(DISTINCT email_trackings.email_id) AS count").
+			Joins("JOIN emails ON emails.id = email_trackings.email_id").
+			Where("emails.campaign_id = ? AND emails.language = ? AND email_trackings.automated = false AND email_trackings.is_deleted = false", campaignID, row.Language).
+			Group("email_trackings.event")); err != nil {
+			return nil, fmt.Errorf("failed to count language events: %w", err)
+		}
+
+		result := LanguageStats{Language: row.Language, Stats: stats}
+		if stats.Sent > 0 {
+			result.OpenRate = float64(stats.Opens) / float64(stats.Sent) * 100
+			result.ClickRate = float64(stats.Clicks) / float64(stats.Sent) * 100
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
@@ -0,0 +1,71 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// leadScoreWindow is how far back engagement counts towards lead scores
+const leadScoreWindow = 365 * 24 * time.Hour
+
+// LeadScoringRule gives contacts points for an engagement event. Each email counts once per
+// rule however often it's opened or clicked, and with a half-life the points of an event halve
+// that many days after it, so contacts that stop engaging cool down.
+type LeadScoringRule struct {
+	Base
+	Name         string             `gorm:"not null" json:"name" validate:"required,min=2"`
+	Event        EmailTrackingEvent `gorm:"not null" json:"event" validate:"required,oneof=open click reply unsubscribe"`
+	URLContains  string             `json:"urlContains" validate:"omitempty,max=512"`                        // click rules only count links whose URL contains it, e.g. /pricing
+	Points       int                `gorm:"not null" json:"points" validate:"required,min=-1000,max=1000"`   // negative to take points away
+	HalfLifeDays int                `gorm:"not null;default:0" json:"halfLifeDays" validate:"min=0,max=365"` // no decay when 0
+	IsActive     bool               `gorm:"not null;default:true" json:"isActive"`
+	TeamID       string             `gorm:"type:uuid;not null;index" json:"teamId" validate:"required,uuid"`
+	Team         *Team              `json:"team,omitempty"`
+}
+
+func (r *LeadScoringRule) BeforeSave(tx *gorm.DB) error {
+	if r.URLContains != "" && r.Event != EmailTrackingEventClick {
+		return errors.New("only click rules can match a URL")
+	}
+	return nil
+}
+
+// RecomputeLeadScores sets the score of every contact of the team from its active lead scoring
+// rules, and returns how many contacts' scores changed. Contacts without matching engagement go
+// back to 0, so it also clears the scores of teams that removed their rules.
+func RecomputeLeadScores(teamID string, db *gorm.DB) (int64, error) {
+	result := db.Exec(`WITH engagement AS (
+		SELECT et.contact_id, r.points, r.half_life_days, MAX(et.timestamp) AS last
+		FROM lead_scoring_rules r
+		JOIN email_trackings et ON et.event = r.event
+			AND (r.url_contains = '' OR POSITION(LOWER(r.url_contains) IN LOWER(et.url)) > 0)
+		JOIN contacts c ON c.id = et.contact_id
+		WHERE r.team_id = ? AND r.is_active = true AND r.is_deleted = false
+			AND c.team_id = ? AND et.automated = false AND et.is_deleted = false AND et.timestamp >= ?
+		GROUP BY et.contact_id, r.id, r.points, r.half_life_days, et.email_id
+	), scores AS (
+		SELECT contact_id, ROUND(SUM(points * CASE WHEN half_life_days > 0
+			THEN POWER(0.5, EXTRACT(EPOCH FROM (NOW() - last)) / 86400.0 / half_life_days) ELSE 1 END))::int AS score
+		FROM engagement
+		GROUP BY contact_id
+	)
+	UPDATE contacts SET score = COALESCE(scores.score, 0)
+	FROM contacts target LEFT JOIN scores ON scores.contact_id = target.id
+	WHERE contacts.id = target.id AND contacts.team_id = ? AND contacts.is_deleted = false
+		AND contacts.score <> COALESCE(scores.score, 0)`,
+		teamID, teamID, time.Now().Add(-leadScoreWindow), teamID)
+	return result.RowsAffected, result.Error
+}
+
+// GetLeadScoredTeams returns the teams whose lead scores need recomputing: those with active
+// rules and those with scores left from rules since removed
+func GetLeadScoredTeams(db *gorm.DB) ([]string, error) {
+	var teamIDs []string
+	err := db.Raw(`SELECT id FROM teams WHERE is_deleted = false AND id IN (
+		SELECT team_id FROM lead_scoring_rules WHERE is_active = true AND is_deleted = false
+		UNION SELECT team_id FROM contacts WHERE score <> 0 AND is_deleted = false)`).
+		Scan(&teamIDs).Error
+	return teamIDs, err
+}
@@ -0,0 +1,92 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// defaultFeedbackIDSender is the Feedback-ID sender of teams that haven't set their own
+const defaultFeedbackIDSender = "posthoot"
+
+// feedbackIDPartRe matches what may not appear in a Feedback-ID field
+var feedbackIDPartRe = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// ListHeaders returns the list management headers of an email: X-PH-Campaign for campaign
+// mail, and List-Id, Precedence and Feedback-ID, for Google Postmaster Tools, for campaign mail
+// and mail of marketing categories. Teams that turned list headers off get none of the latter.
+func ListHeaders(email *Email, db *gorm.DB) (map[string]string, error) {
+	headers := make(map[string]string)
+	if email.CampaignID != "" {
+		headers["X-PH-Campaign"] = email.CampaignID
+	}
+
+	var row struct {
+		ListHeaders      *bool
+		ListIDDomain     string
+		FeedbackIDSender string
+		CategoryName     string
+		Marketing        bool
+		ListID           string
+	}
+	if err := db.Table("emails").
+		Select("team_settings.list_headers, team_settings.list_id_domain, team_settings.feedback_id_sender, "+
+			"email_categories.name AS category_name, email_categories.marketing, campaigns.list_id").
+		Joins("LEFT JOIN team_settings ON team_settings.team_id = emails.team_id AND team_settings.is_deleted = false").
+		Joins("LEFT JOIN email_categories ON email_categories.id = emails.category_id").
+		Joins("LEFT JOIN campaigns ON campaigns.id = emails.campaign_id").
+		Where("emails.id = ?", email.ID).
+		Take(&row).Error; err != nil {
+		return headers, fmt.Errorf("failed to get list header settings: %w", err)
+	}
+
+	if row.ListHeaders != nil && !*row.ListHeaders {
+		return headers, nil
+	}
+	if email.CampaignID == "" && !row.Marketing {
+		return headers, nil
+	}
+
+	domain := strings.ToLower(strings.TrimSpace(row.ListIDDomain))
+	if domain == "" {
+		domain = emailDomain(email.From)
+	}
+
+	// Campaigns are listed by their mailing list, so every send to a list shares its List-Id
+	key := row.ListID
+	if key == "" {
+		key = email.CampaignID
+	}
+	if key == "" {
+		key = email.CategoryID
+	}
+	if key != "" && domain != "" {
+		headers["List-Id"] = fmt.Sprintf("<%s.%s>", key, domain)
+	}
+
+	headers["Precedence"] = "bulk"
+
+	// Gmail's CampaignId:CustomerId:MailType:SenderId
+	sender := row.FeedbackIDSender
+	if sender == "" {
+		sender = defaultFeedbackIDSender
+	}
+	campaign := email.CampaignID
+	if campaign == "" {
+		campaign = feedbackIDPart(row.CategoryName)
+	}
+	mailType := "campaign"
+	if email.CampaignID == "" {
+		mailType = "marketing"
+	}
+	headers["Feedback-ID"] = strings.Join([]string{campaign, email.TeamID, mailType, feedbackIDPart(sender)}, ":")
+
+	return headers, nil
+}
+
+// feedbackIDPart makes a value safe to use as a field of a Feedback-ID
+func feedbackIDPart(value string) string {
+	return strings.Trim(feedbackIDPartRe.ReplaceAllString(strings.ToLower(value), "-"), "-")
+}
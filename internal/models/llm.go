@@ -0,0 +1,47 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// LLM email writer job statuses
+const (
+	LLMJobStatusPending   = "PENDING"
+	LLMJobStatusRunning   = "RUNNING"
+	LLMJobStatusCompleted = "COMPLETED"
+	LLMJobStatusFailed    = "FAILED"
+)
+
+// promptVariablePattern matches {{ name }} placeholders in a job prompt
+var promptVariablePattern = regexp.MustCompile(`{{\s*([\w.]+)\s*}}`)
+
+// RenderPrompt fills the job's prompt with its input and the task parameters. {{ input }} is
+// replaced by the job input; without that placeholder the input is appended to the prompt.
+// Unknown placeholders are left as they are.
+func (j *LLMEmailWriterJob) RenderPrompt(parameters map[string]interface{}) string {
+	values := make(map[string]string, len(parameters)+1)
+	for key, value := range parameters {
+		values[key] = fmt.Sprint(value)
+	}
+	values["input"] = j.Input
+
+	prompt := j.Prompt
+	usesInput := false
+	prompt = promptVariablePattern.ReplaceAllStringFunc(prompt, func(match string) string {
+		key := promptVariablePattern.FindStringSubmatch(match)[1]
+		if key == "input" {
+			usesInput = true
+		}
+		if value, ok := values[key]; ok {
+			return value
+		}
+		return match
+	})
+
+	if !usesInput && strings.TrimSpace(j.Input) != "" {
+		prompt = strings.TrimSpace(prompt) + "\n\n" + j.Input
+	}
+	return prompt
+}
@@ -1,10 +1,12 @@
 package models
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"kori/internal/events"
 	"kori/internal/utils/crypto"
-	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -86,41 +88,97 @@ type TeamInvite struct {
 
 type Contact struct {
 	Base
-	Email     string           `gorm:"not null" json:"email" validate:"required,email"`
-	FirstName string           `json:"firstName" validate:"omitempty,min=2"`
-	LastName  string           `json:"lastName" validate:"omitempty,min=2"`
-	Metadata  datatypes.JSON   `gorm:"type:jsonb;default:'{}'" json:"metadata" validate:"omitempty,json"`
-	LinkedIn  string           `json:"linkedin" validate:"omitempty,url"`
-	Twitter   string           `json:"twitter" validate:"omitempty,url"`
-	Facebook  string           `json:"facebook" validate:"omitempty,url"`
-	Instagram string           `json:"instagram" validate:"omitempty,url"`
-	Tags      []Tag            `gorm:"many2many:contact_tags;" json:"tags"`
-	Country   string           `json:"country" validate:"omitempty"`
-	Phone     string           `json:"phone" validate:"omitempty"`
-	City      string           `json:"city" validate:"omitempty"`
-	State     string           `json:"state" validate:"omitempty"`
-	Zip       string           `json:"zip" validate:"omitempty"`
-	Address   string           `json:"address" validate:"omitempty"`
-	Company   string           `json:"company" validate:"omitempty"`
-	ListID    string           `gorm:"type:uuid;not null" json:"listId" validate:"required,uuid"`
-	TeamID    string           `gorm:"type:uuid;not null" json:"teamId" validate:"required,uuid"`
-	List      *MailingList     `json:"list,omitempty"`
-	ImportID  string           `gorm:"type:uuid;default:NULL;" json:"importId" validate:"omitempty,uuid"`
-	Import    *ContactImport   `json:"import,omitempty"`
-	Status    SubscriberStatus `gorm:"not null;default:'ACTIVE'" json:"status" validate:"required,oneof=ACTIVE UNSUBSCRIBED BOUNCED COMPLAINED"`
+	Email                string           `gorm:"not null" json:"email" validate:"required,email"`
+	FirstName            string           `json:"firstName" validate:"omitempty,min=2"`
+	LastName             string           `json:"lastName" validate:"omitempty,min=2"`
+	Metadata             datatypes.JSON   `gorm:"type:jsonb;default:'{}'" json:"metadata" validate:"omitempty,json"`
+	LinkedIn             string           `json:"linkedin" validate:"omitempty,url"`
+	Twitter              string           `json:"twitter" validate:"omitempty,url"`
+	Facebook             string           `json:"facebook" validate:"omitempty,url"`
+	Instagram            string           `json:"instagram" validate:"omitempty,url"`
+	Tags                 []Tag            `gorm:"many2many:contact_tags;" json:"tags"`
+	Country              string           `json:"country" validate:"omitempty"`
+	Phone                string           `json:"phone" validate:"omitempty"`
+	City                 string           `json:"city" validate:"omitempty"`
+	State                string           `json:"state" validate:"omitempty"`
+	Zip                  string           `json:"zip" validate:"omitempty"`
+	Address              string           `json:"address" validate:"omitempty"`
+	Company              string           `json:"company" validate:"omitempty"`
+	Locale               string           `json:"locale" validate:"omitempty,bcp47_language_tag"` // picks the campaign language variant, e.g. de or pt-BR
+	Timezone             string           `json:"timezone" validate:"omitempty,timezone"`         // e.g. Europe/Berlin, detected from their country or engagement when empty
+	ListID               string           `gorm:"type:uuid;not null" json:"listId" validate:"required,uuid"`
+	TeamID               string           `gorm:"type:uuid;not null" json:"teamId" validate:"required,uuid"`
+	List                 *MailingList     `json:"list,omitempty"`
+	ImportID             string           `gorm:"type:uuid;default:NULL;" json:"importId" validate:"omitempty,uuid"`
+	Import               *ContactImport   `json:"import,omitempty"`
+	Status               SubscriberStatus `gorm:"not null;default:'ACTIVE'" json:"status" validate:"required,oneof=ACTIVE UNSUBSCRIBED BOUNCED COMPLAINED PENDING"`
+	ConfirmedAt          *time.Time       `gorm:"default:NULL" json:"confirmedAt,omitempty"`          // when they confirmed a list that requires it
+	PreferencesUpdatedAt *time.Time       `gorm:"default:NULL" json:"preferencesUpdatedAt,omitempty"` // when they last saved the preference center
+	Score                int              `gorm:"not null;default:0;index" json:"score"`              // lead score kept up to date from the team's lead scoring rules
+	IsSample             bool             `gorm:"not null;default:false" json:"isSample"`             // created by populating sample data
+}
+
+// TemplateVariables returns the default personalization variables for a contact. The contact
+// variable holds them together with the contact's metadata, e.g. custom columns of an import,
+// for templates to use as {{contact.metadata.plan}}.
+func (c *Contact) TemplateVariables() map[string]string {
+	variables := map[string]string{
+		"email":      c.Email,
+		"first_name": c.FirstName,
+		"last_name":  c.LastName,
+		"company":    c.Company,
+		"country":    c.Country,
+		"city":       c.City,
+		"state":      c.State,
+		"zip":        c.Zip,
+		"address":    c.Address,
+		"phone":      c.Phone,
+		"linkedin":   c.LinkedIn,
+		"twitter":    c.Twitter,
+		"facebook":   c.Facebook,
+		"instagram":  c.Instagram,
+	}
+
+	contact := make(map[string]interface{}, len(variables)+1)
+	for name, value := range variables {
+		contact[name] = value
+	}
+	metadata := map[string]interface{}{}
+	if len(c.Metadata) > 0 {
+		// Metadata that isn't an object is left out rather than failing the send
+		if err := json.Unmarshal(c.Metadata, &metadata); err != nil || metadata == nil {
+			metadata = map[string]interface{}{}
+		}
+	}
+	contact["metadata"] = metadata
+	if encoded, err := json.Marshal(contact); err == nil {
+		variables["contact"] = string(encoded)
+	}
+	return variables
 }
 
 type ContactImport struct {
 	Base
-	Status    ContactImportStatus `gorm:"not null;default:'PENDING'" json:"status" validate:"required,oneof=PENDING PROCESSING COMPLETED FAILED"`
-	TeamID    string              `gorm:"type:uuid;not null" json:"teamId" validate:"required,uuid"`
-	Team      *Team               `json:"team,omitempty"`
-	FileID    string              `gorm:"default:NULL;type:uuid;" json:"fileId" validate:"omitempty,uuid"`
-	File      *File               `json:"file,omitempty"`
-	ListID    string              `gorm:"type:uuid;not null" json:"listId" validate:"required,uuid"`
-	List      *MailingList        `json:"list,omitempty"`
-	FieldsMap datatypes.JSON      `gorm:"type:jsonb;default:'{}'" json:"fieldsMap" validate:"required,json"`
-	Contacts  []Contact           `gorm:"foreignKey:ImportID" json:"contacts,omitempty"`
+	Status         ContactImportStatus `gorm:"not null;default:'PENDING'" json:"status" validate:"required,oneof=PENDING PROCESSING VALIDATED COMPLETED FAILED"`
+	TeamID         string              `gorm:"type:uuid;not null" json:"teamId" validate:"required,uuid"`
+	Team           *Team               `json:"team,omitempty"`
+	Source         ContactImportSource `gorm:"not null;default:'FILE'" json:"source" validate:"omitempty,oneof=FILE GOOGLE_SHEETS"`
+	FileID         string              `gorm:"default:NULL;type:uuid;" json:"fileId" validate:"omitempty,uuid"`
+	File           *File               `json:"file,omitempty"`
+	SheetURL       string              `json:"sheetUrl,omitempty" validate:"omitempty,url"` // Google Sheet shared with anyone with the link
+	ListID         string              `gorm:"type:uuid;not null" json:"listId" validate:"required,uuid"`
+	List           *MailingList        `json:"list,omitempty"`
+	FieldsMap      datatypes.JSON      `gorm:"type:jsonb;default:'{}'" json:"fieldsMap" validate:"required,json"`
+	DryRun         bool                `gorm:"not null;default:false" json:"dryRun"`         // only validates and counts the rows until confirmed
+	UpdateExisting bool                `gorm:"not null;default:false" json:"updateExisting"` // rows for contacts already on the list update them instead of being skipped
+	TotalRows      int                 `gorm:"not null;default:0" json:"totalRows"`
+	ImportedRows   int                 `gorm:"not null;default:0" json:"importedRows"` // created, or that a dry run would create
+	UpdatedRows    int                 `gorm:"not null;default:0" json:"updatedRows"`  // already on the list, with updateExisting
+	SkippedRows    int                 `gorm:"not null;default:0" json:"skippedRows"`  // already on the list or repeated in the file
+	FailedRows     int                 `gorm:"not null;default:0" json:"failedRows"`   // listed in the error report
+	Error          string              `json:"error,omitempty"`                        // why the whole import failed
+	CompletedAt    *time.Time          `json:"completedAt,omitempty"`
+	Contacts       []Contact           `gorm:"foreignKey:ImportID" json:"contacts,omitempty"`
 }
 
 type File struct {
@@ -173,22 +231,40 @@ type MailingList struct {
 	Team           *Team           `json:"team,omitempty"`
 	ContactImports []ContactImport `gorm:"foreignKey:ListID" json:"contactImports,omitempty"`
 	Contacts       []Contact       `gorm:"foreignKey:ListID" json:"contacts,omitempty"`
+	// New contacts stay PENDING until they confirm through the link they're mailed
+	RequiresConfirmation   bool      `gorm:"not null;default:false" json:"requiresConfirmation"`
+	ConfirmationTemplateID string    `gorm:"type:uuid;default:NULL" json:"confirmationTemplateId" validate:"omitempty,uuid"` // the built in confirmation email is sent when empty
+	ConfirmationTemplate   *Template `json:"confirmationTemplate,omitempty"`
+	IsSample               bool      `gorm:"not null;default:false" json:"isSample"` // created by populating sample data
 }
 
 type SMTPConfig struct {
 	Base
-	Provider     string `gorm:"not null" json:"provider" validate:"required,oneof=CUSTOM GMAIL OUTLOOK AMAZON"`
+	Provider     string `gorm:"not null" json:"provider" validate:"required,oneof=CUSTOM GMAIL OUTLOOK AMAZON SENDGRID MAILGUN POSTMARK"`
 	Host         string `gorm:"not null" json:"host" validate:"required,hostname"`
 	Port         int    `gorm:"not null" json:"port" validate:"required,min=1,max=65535"`
 	Username     string `json:"username" validate:"required"`
 	FromEmail    string `json:"fromEmail" validate:"required"`
-	Password     string `json:"password" validate:"required,min=8"`
+	Password     string `json:"password" validate:"required_unless=AuthType OAUTH2,omitempty,min=8" audit:"redact"`
 	IsDefault    bool   `gorm:"not null;default:false" json:"isDefault"`
 	IsActive     bool   `gorm:"not null;default:true" json:"isActive"`
 	SupportsTLS  bool   `gorm:"not null;default:true" json:"supportsTls"`
 	RequiresAuth bool   `gorm:"not null;default:true" json:"requiresAuth"`
 	MaxSendRate  int    `gorm:"not null;default:10" json:"maxSendRate" validate:"required,min=1"`
 	TeamID       string `gorm:"type:uuid;not null" json:"teamId" validate:"required,uuid"`
+	// Health checks
+	IsHealthy           bool      `gorm:"not null;default:true" json:"isHealthy"`
+	HealthCheckFailures int       `gorm:"not null;default:0" json:"healthCheckFailures"`
+	LastHealthCheckAt   time.Time `gorm:"default:NULL" json:"lastHealthCheckAt"`
+	LastHealthError     string    `json:"lastHealthError,omitempty"`
+	// Sending paused by a platform operator, e.g. during a provider incident
+	SendingPaused      bool       `gorm:"not null;default:false" json:"sendingPaused"`
+	SendingPausedAt    *time.Time `gorm:"default:NULL" json:"sendingPausedAt,omitempty"`
+	SendingPauseReason string     `json:"sendingPauseReason,omitempty"`
+	// Secret path of the endpoint an API provider posts its delivery events to
+	EventWebhookToken string `gorm:"default:NULL;uniqueIndex" json:"eventWebhookToken,omitempty"`
+	// Signing in with OAuth2 instead of the password
+	OAuthCredentials
 }
 
 type IMAPConfig struct {
@@ -196,10 +272,33 @@ type IMAPConfig struct {
 	Host     string `gorm:"not null" json:"host" validate:"required,hostname"`
 	Port     int    `gorm:"not null" json:"port" validate:"required,min=1,max=65535"`
 	Username string `json:"username" validate:"required"`
-	Password string `json:"password" validate:"required,min=8"`
+	Password string `json:"password" validate:"required_unless=AuthType OAUTH2,omitempty,min=8" audit:"redact"`
 	IsActive bool   `gorm:"not null;default:true" json:"isActive"`
 	TeamID   string `gorm:"type:uuid;not null" json:"teamId" validate:"required,uuid"`
 	Team     *Team  `json:"team,omitempty"`
+	// Signing in with OAuth2 instead of the password
+	OAuthCredentials
+	// Bounce mailbox polling
+	BounceProcessing   bool      `gorm:"not null;default:false" json:"bounceProcessing"`
+	BounceFolder       string    `gorm:"not null;default:'INBOX'" json:"bounceFolder"`
+	BounceUIDValidity  uint32    `gorm:"not null;default:0" json:"-"`
+	BounceLastUID      uint32    `gorm:"not null;default:0" json:"-"`
+	BounceLastPolledAt time.Time `gorm:"default:NULL" json:"bounceLastPolledAt"`
+	// Syncing the mailbox to the database, for the inbox API to search
+	InboxSync    bool           `gorm:"not null;default:false" json:"inboxSync"`
+	InboxFolders pq.StringArray `gorm:"type:text[];default:'{INBOX}'" json:"inboxFolders"`
+}
+
+func (s *SMTPConfig) BeforeSave(tx *gorm.DB) error {
+	// API providers need somewhere to post delivery events to
+	if SMTPProvider(s.Provider).IsAPI() && s.EventWebhookToken == "" {
+		token := make([]byte, 24)
+		if _, err := rand.Read(token); err != nil {
+			return fmt.Errorf("failed to generate event webhook token: %w", err)
+		}
+		s.EventWebhookToken = hex.EncodeToString(token)
+	}
+	return nil
 }
 
 func (s *SMTPConfig) BeforeCreate(tx *gorm.DB) error {
@@ -211,7 +310,7 @@ func (s *SMTPConfig) BeforeCreate(tx *gorm.DB) error {
 		return fmt.Errorf("failed to encrypt password: %w", err)
 	}
 	s.Password = password
-	return nil
+	return s.OAuthCredentials.encrypt()
 }
 
 func (s *IMAPConfig) BeforeCreate(tx *gorm.DB) error {
@@ -224,7 +323,7 @@ func (s *IMAPConfig) BeforeCreate(tx *gorm.DB) error {
 		return fmt.Errorf("failed to encrypt password: %w", err)
 	}
 	s.Password = password
-	return nil
+	return s.OAuthCredentials.encrypt()
 }
 
 func (s *SMTPConfig) BeforeUpdate(tx *gorm.DB) error {
@@ -233,7 +332,7 @@ func (s *SMTPConfig) BeforeUpdate(tx *gorm.DB) error {
 		return fmt.Errorf("failed to encrypt password: %w", err)
 	}
 	s.Password = password
-	return nil
+	return s.OAuthCredentials.encrypt()
 }
 
 func (s *IMAPConfig) BeforeUpdate(tx *gorm.DB) error {
@@ -242,7 +341,7 @@ func (s *IMAPConfig) BeforeUpdate(tx *gorm.DB) error {
 		return fmt.Errorf("failed to encrypt password: %w", err)
 	}
 	s.Password = password
-	return nil
+	return s.OAuthCredentials.encrypt()
 }
 
 func (s *SMTPConfig) AfterFind(tx *gorm.DB) error {
@@ -251,7 +350,7 @@ func (s *SMTPConfig) AfterFind(tx *gorm.DB) error {
 		return fmt.Errorf("failed to decrypt password: %w", err)
 	}
 	s.Password = password
-	return nil
+	return s.OAuthCredentials.decrypt()
 }
 
 func (s *IMAPConfig) AfterFind(tx *gorm.DB) error {
@@ -260,32 +359,46 @@ func (s *IMAPConfig) AfterFind(tx *gorm.DB) error {
 		return fmt.Errorf("failed to decrypt password: %w", err)
 	}
 	s.Password = password
-	return nil
+	return s.OAuthCredentials.decrypt()
 }
 
 type Domain struct {
 	Base
-	Domain     string `gorm:"uniqueIndex;not null" json:"domain" validate:"required,fqdn"`
-	IsVerified bool   `gorm:"not null;default:false" json:"isVerified"`
-	DNSRecord  string `json:"dnsRecord" validate:"omitempty"`
-	TeamID     string `gorm:"type:uuid;not null" json:"teamId" validate:"required,uuid"`
+	Domain            string             `gorm:"uniqueIndex;not null" json:"domain" validate:"required,fqdn"`
+	IsVerified        bool               `gorm:"not null;default:false" json:"isVerified"`
+	DNSRecord         string             `json:"dnsRecord" validate:"omitempty"` // TXT value proving ownership
+	VerificationToken string             `gorm:"not null;default:''" json:"-"`
+	DKIMSelector      string             `gorm:"not null;default:'posthoot'" json:"dkimSelector" validate:"omitempty,hostname"`
+	OwnershipStatus   DomainRecordStatus `gorm:"not null;default:'PENDING'" json:"ownershipStatus"`
+	SPFStatus         DomainRecordStatus `gorm:"not null;default:'PENDING'" json:"spfStatus"`
+	DKIMStatus        DomainRecordStatus `gorm:"not null;default:'PENDING'" json:"dkimStatus"`
+	DMARCStatus       DomainRecordStatus `gorm:"not null;default:'PENDING'" json:"dmarcStatus"`
+	DMARCPolicy       string             `json:"dmarcPolicy"`
+	Checks            datatypes.JSON     `gorm:"type:jsonb;default:'[]'" json:"checks"`
+	LastCheckedAt     time.Time          `gorm:"default:NULL" json:"lastCheckedAt"`
+	MTASTSMode        MTASTSMode         `gorm:"not null;default:'testing'" json:"mtaStsMode" validate:"omitempty,oneof=none testing enforce"`
+	MTASTSMaxAge      int                `gorm:"not null;default:604800" json:"mtaStsMaxAge" validate:"omitempty,min=86400,max=31557600"`
+	MTASTSMX          pq.StringArray     `gorm:"type:text[]" json:"mtaStsMx" validate:"omitempty"`
+	TeamID            string             `gorm:"type:uuid;not null" json:"teamId" validate:"required,uuid"`
 }
 
 type Webhook struct {
 	Base
 	Name       string         `gorm:"not null" json:"name" validate:"required,min=2"`
 	URL        string         `gorm:"not null" json:"url" validate:"required,url"`
-	Events     pq.StringArray `gorm:"type:text[]" json:"events" validate:"required,min=1,dive,oneof=click open reply bounce complaint"`
+	Events     pq.StringArray `gorm:"type:text[]" json:"events" validate:"required,min=1,dive,oneof=click open reply bounce complaint quota.warning campaign.alert email.status"`
 	IsActive   bool           `gorm:"not null;default:true" json:"isActive"`
 	Secret     string         `json:"secret" validate:"required,min=16"`
 	TeamID     string         `gorm:"type:uuid;not null" json:"teamId" validate:"required,uuid"`
 	Deliveries []Delivery     `gorm:"foreignKey:WebhookID" json:"deliveries,omitempty"`
+	// End of the window the last email.status digest covered
+	StatusDigestAt *time.Time `gorm:"default:NULL" json:"statusDigestAt,omitempty"`
 }
 
 type Delivery struct {
 	Base
 	WebhookID    string         `gorm:"type:uuid;not null" json:"webhookId" validate:"required,uuid"`
-	Event        string         `gorm:"not null" json:"event" validate:"required,oneof=click open reply bounce complaint"`
+	Event        string         `gorm:"not null" json:"event" validate:"required,oneof=click open reply bounce complaint quota.warning"`
 	Payload      datatypes.JSON `gorm:"type:jsonb;not null" json:"payload" validate:"required,json"`
 	ResponseCode int            `json:"responseCode" validate:"omitempty,min=100,max=599"`
 	ResponseBody string         `json:"responseBody" validate:"omitempty"`
@@ -301,6 +414,8 @@ type EmailCategory struct {
 	Templates   []Template `gorm:"foreignKey:CategoryID" json:"templates,omitempty"`
 	TeamID      string     `gorm:"type:uuid;not null" json:"teamId" validate:"required,uuid"`
 	Team        *Team      `json:"team,omitempty"`
+	Marketing   bool       `gorm:"not null;default:false" json:"marketing"` // sent as bulk mail with list headers, like campaigns
+	IsSample    bool       `gorm:"not null;default:false" json:"isSample"`  // created by populating sample data
 }
 
 type Template struct {
@@ -310,41 +425,70 @@ type Template struct {
 	HtmlFileID string         `gorm:"type:uuid" json:"htmlFileId" validate:"omitempty,uuid"`
 	HtmlFile   *File          `json:"htmlFile,omitempty"`
 	DesignJSON string         `gorm:"not null;default:''" json:"designJson" validate:"omitempty"`
+	Preheader  string         `json:"preheader" validate:"omitempty,max=255"`          // inbox preview text, may use variables
+	PlainText  string         `gorm:"type:text" json:"plainText" validate:"omitempty"` // text alternative with variables, generated from the html when blank
 	TeamID     string         `gorm:"type:uuid;not null" json:"teamId" validate:"required,uuid"`
 	Team       *Team          `json:"team,omitempty"`
 	Emails     []Email        `gorm:"foreignKey:TemplateID" json:"emails,omitempty"`
 	Variables  pq.StringArray `gorm:"type:text[]" json:"variables" validate:"omitempty,dive,min=1"`
 	CategoryID string         `gorm:"type:uuid;not null" json:"categoryId" validate:"required,uuid"`
 	Category   *EmailCategory `json:"category,omitempty"`
+	IsSample   bool           `gorm:"not null;default:false" json:"isSample"` // created by populating sample data
+	// A translation of another template, made by importing a translator's file for it
+	SourceTemplateID string         `gorm:"type:uuid;default:NULL;index" json:"sourceTemplateId,omitempty" validate:"omitempty,uuid"`
+	Language         string         `gorm:"not null;default:''" json:"language,omitempty"`     // e.g. de or pt-BR
+	SourceVersion    int            `gorm:"not null;default:0" json:"sourceVersion,omitempty"` // the source's version last imported
+	Translations     datatypes.JSON `gorm:"type:jsonb;default:'{}'" json:"-"`                  // each source string with its translation
 }
 
 type Email struct {
 	Base
-	From         string         `gorm:"not null" json:"from" validate:"required,email"`
-	To           string         `gorm:"not null" json:"to" validate:"required,email"`
-	Subject      string         `gorm:"not null" json:"subject" validate:"required"`
-	Body         string         `gorm:"not null" json:"body" validate:"required"`
-	Status       EmailStatus    `gorm:"not null" json:"status" validate:"required,oneof=DRAFT QUEUED SENDING SENT FAILED"`
-	Error        string         `json:"error" validate:"omitempty"`
-	Data         datatypes.JSON `gorm:"type:jsonb;default:'{}'" json:"data" validate:"omitempty,json"`
-	TemplateID   string         `gorm:"type:uuid;default:NULL" json:"templateId" validate:"omitempty,uuid"`
-	Template     *Template      `json:"template,omitempty"`
-	TeamID       string         `gorm:"type:uuid;not null" json:"teamId" validate:"required,uuid"`
-	Team         *Team          `json:"team,omitempty"`
-	ContactID    string         `gorm:"type:uuid;default:NULL" json:"contactId" validate:"omitempty,uuid"`
-	Contact      *Contact       `json:"contact,omitempty"`
-	SMTPConfigID string         `gorm:"type:uuid;not null" json:"smtpConfigId" validate:"required,uuid"`
-	SMTPConfig   *SMTPConfig    `json:"smtpConfig,omitempty"`
-	SentAt       time.Time      `json:"sentAt" validate:"omitempty"`
-	SendAt       time.Time      `json:"sendAt" validate:"omitempty"`
-	CategoryID   string         `gorm:"type:uuid;not null" json:"categoryId" validate:"required,uuid"`
-	Category     *EmailCategory `json:"category,omitempty"`
-	CampaignID   string         `gorm:"type:uuid;default:NULL" json:"campaignId" validate:"omitempty,uuid"`
-	Campaign     *Campaign      `json:"campaign,omitempty"`
-	CC           string         `json:"cc" validate:"omitempty,email"`
-	BCC          string         `json:"bcc" validate:"omitempty,email"`
-	ReplyTo      string         `json:"replyTo" validate:"omitempty,email"`
-	Test         bool           `gorm:"not null;default:false" json:"test"`
+	From            string            `gorm:"not null" json:"from" validate:"required,email"`
+	To              string            `gorm:"not null" json:"to" validate:"required,email"`
+	Subject         string            `gorm:"not null" json:"subject" validate:"required"`
+	Body            string            `gorm:"not null" json:"body" validate:"required"`
+	PlainText       string            `gorm:"type:text" json:"plainText"` // text alternative, base64 encoded like Body
+	Status          EmailStatus       `gorm:"not null" json:"status" validate:"required,oneof=DRAFT QUEUED SENDING SENT FAILED CANCELLED"`
+	Error           string            `json:"error" validate:"omitempty"`
+	SkipReason      string            `json:"skipReason,omitempty"` // why the email was skipped rather than sent
+	Data            datatypes.JSON    `gorm:"type:jsonb;default:'{}'" json:"data" validate:"omitempty,json"`
+	TemplateID      string            `gorm:"type:uuid;default:NULL" json:"templateId" validate:"omitempty,uuid"`
+	Template        *Template         `json:"template,omitempty"`
+	TeamID          string            `gorm:"type:uuid;not null" json:"teamId" validate:"required,uuid"`
+	Team            *Team             `json:"team,omitempty"`
+	ContactID       string            `gorm:"type:uuid;default:NULL" json:"contactId" validate:"omitempty,uuid"`
+	Contact         *Contact          `json:"contact,omitempty"`
+	SMTPConfigID    string            `gorm:"type:uuid;not null" json:"smtpConfigId" validate:"required,uuid"`
+	SMTPConfig      *SMTPConfig       `json:"smtpConfig,omitempty"`
+	SentAt          time.Time         `json:"sentAt" validate:"omitempty"`
+	SendAt          time.Time         `json:"sendAt" validate:"omitempty"`
+	CategoryID      string            `gorm:"type:uuid;not null" json:"categoryId" validate:"required,uuid"`
+	Category        *EmailCategory    `json:"category,omitempty"`
+	CampaignID      string            `gorm:"type:uuid;default:NULL" json:"campaignId" validate:"omitempty,uuid"`
+	Campaign        *Campaign         `json:"campaign,omitempty"`
+	AutomationID    string            `gorm:"type:uuid;default:NULL;index" json:"automationId,omitempty"`
+	CC              string            `json:"cc" validate:"omitempty,email_list"`  // comma separated
+	BCC             string            `json:"bcc" validate:"omitempty,email_list"` // comma separated
+	ReplyTo         string            `json:"replyTo" validate:"omitempty,email"`
+	Test            bool              `gorm:"not null;default:false" json:"test"`
+	FromName        string            `json:"fromName"`
+	SenderPersonaID string            `gorm:"type:uuid;default:NULL;index" json:"senderPersonaId,omitempty"`
+	VariantID       string            `gorm:"type:uuid;default:NULL;index" json:"variantId" validate:"omitempty,uuid"`
+	ContentVariants datatypes.JSON    `gorm:"type:jsonb;default:'{}'" json:"contentVariants"` // content block key -> variant ID
+	Language        string            `gorm:"not null;default:''" json:"language"`            // the campaign language variant sent, empty for the campaign's template
+	Attempts        int               `gorm:"not null;default:0" json:"attempts"`
+	LastAttemptAt   time.Time         `gorm:"default:NULL" json:"lastAttemptAt"`
+	Queue           string            `json:"queue,omitempty"`                          // the queue of the last attempt
+	QueuedAt        *time.Time        `gorm:"default:NULL" json:"queuedAt,omitempty"`   // when the last attempt was enqueued
+	DequeuedAt      *time.Time        `gorm:"default:NULL" json:"dequeuedAt,omitempty"` // when a worker picked the last attempt up
+	NextRetryAt     *time.Time        `gorm:"index" json:"nextRetryAt,omitempty"`
+	ErrorClass      string            `json:"errorClass,omitempty"`
+	ParkedAt        *time.Time        `gorm:"index" json:"parkedAt,omitempty"` // held while sending through its smtp config is paused
+	IdempotencyKey  string            `json:"idempotencyKey,omitempty"`
+	InReplyTo       string            `json:"inReplyTo,omitempty"` // Message-ID the email answers, threading it under that message
+	Attachments     []EmailAttachment `gorm:"foreignKey:EmailID" json:"attachments,omitempty"`
+	IsSample        bool              `gorm:"not null;default:false" json:"isSample"` // synthetic email of the sample campaign
+	Signature       string            `gorm:"-" json:"-"`                             // rendered signature a transactional send appends to its body
 }
 
 func (e *Email) BeforeUpdate(tx *gorm.DB) error {
@@ -362,6 +506,10 @@ func (e *Email) AfterCreate(tx *gorm.DB) error {
 		// If the email is part of a campaign, we don't need to send it immediately this is handled in the campaign handler
 		return nil
 	}
+	if e.Status == EmailStatusSkipped {
+		// Kept from going out by a frequency cap, only recorded for reporting
+		return nil
+	}
 	smtp, err := GetSMTPConfig(e.TeamID, e.SMTPConfigID, "", tx)
 	if err != nil {
 		return err
@@ -378,14 +526,14 @@ func (e *Email) AfterDelete(tx *gorm.DB) error {
 
 type EmailTracking struct {
 	Base
-	EmailID    string             `gorm:"type:uuid;not null" json:"emailId" validate:"required,uuid"`
+	EmailID    string             `gorm:"type:uuid;not null;index:idx_email_tracking_email_event" json:"emailId" validate:"required,uuid"`
 	Email      *Email             `json:"email,omitempty"`
 	CampaignID string             `gorm:"type:uuid;default:NULL" json:"campaignId" validate:"omitempty,uuid"`
 	Campaign   *Campaign          `json:"campaign,omitempty"`
 	ContactID  string             `gorm:"type:uuid;default:NULL" json:"contactId" validate:"omitempty,uuid"`
 	Contact    *Contact           `json:"contact,omitempty"`
-	Event      EmailTrackingEvent `gorm:"not null" json:"event" validate:"required,oneof=click open reply bounce complaint"`
-	Timestamp  time.Time          `json:"timestamp" validate:"required"`
+	Event      EmailTrackingEvent `gorm:"not null;index:idx_email_tracking_email_event" json:"event" validate:"required,oneof=click open reply bounce complaint"`
+	Timestamp  time.Time          `gorm:"index" json:"timestamp" validate:"required"`
 	// 🌍 Geographic Data
 	IPAddress string `json:"ipAddress" validate:"omitempty,ip"`
 	Country   string `json:"country" validate:"omitempty"`
@@ -397,30 +545,42 @@ type EmailTracking struct {
 	Browser    string `json:"browser" validate:"omitempty"`
 	OS         string `json:"os" validate:"omitempty"`
 	// 🔗 Click Specific Data (for click events)
-	URL string `json:"url" validate:"omitempty,url"`
+	URL    string `json:"url" validate:"omitempty,url"`
+	LinkID string `gorm:"type:uuid;default:NULL;index" json:"linkId,omitempty"` // registered link clicked, empty for links sent before registration
 	// 📊 Additional Metadata
 	Metadata datatypes.JSON `gorm:"type:jsonb;default:'{}'" json:"metadata" validate:"omitempty,json"`
+	// 📬 Set when the event is about a CC or BCC address rather than the email's To
+	Recipient string `gorm:"not null;default:''" json:"recipient,omitempty"`
+	// 🤖 Set on bot-like engagement, which scores, segments and analytics leave out
+	Automated       bool   `gorm:"not null;default:false;index" json:"automated"`
+	AutomatedReason string `json:"automatedReason,omitempty"`
 }
 
+// APIKey is a secret, with its own permissions, for calling the API on a team's behalf. Only
+// the hash of the secret is kept; its prefix tells keys apart.
 type APIKey struct {
 	Base
 	Name        string             `gorm:"not null" json:"name"`
-	Key         string             `gorm:"not null" json:"key"`
+	KeyHash     string             `gorm:"not null;default:'';index" json:"-"`
+	Prefix      string             `gorm:"not null;default:''" json:"prefix"` // the start of the secret, e.g. kori_1a2b3c4
 	TeamID      string             `gorm:"type:uuid;not null" json:"teamId" validate:"required,uuid"`
 	Team        *Team              `json:"team,omitempty"`
 	CreatedAt   time.Time          `json:"createdAt"`
 	LastUsedAt  time.Time          `json:"lastUsedAt"`
 	ExpiresAt   time.Time          `json:"expiresAt"`
 	Permissions []APIKeyPermission `gorm:"foreignKey:KeyID" json:"permissions,omitempty"`
+	// Set on rotation: the key this one replaced, and the key replacing this one
+	RotatedFromID string     `gorm:"type:uuid;default:NULL" json:"rotatedFromId,omitempty"`
+	ReplacedByID  string     `gorm:"type:uuid;default:NULL" json:"replacedById,omitempty"`
+	RevokedAt     *time.Time `json:"revokedAt,omitempty"`
 }
 
 func (a *APIKey) BeforeCreate(tx *gorm.DB) error {
 	if a.ID == "" {
 		a.ID = uuid.New().String()
 	}
-	if a.Key == "" {
-		keyWithoutDashes := strings.ReplaceAll(uuid.New().String(), "-", "")
-		a.Key = "kori_" + keyWithoutDashes
+	if a.KeyHash == "" {
+		a.NewSecret()
 	}
 	if a.ExpiresAt.IsZero() {
 		a.ExpiresAt = time.Now().Add(24 * 90 * time.Hour)
@@ -430,40 +590,66 @@ func (a *APIKey) BeforeCreate(tx *gorm.DB) error {
 
 type APIKeyUsage struct {
 	Base
-	APIKeyID  string    `gorm:"type:uuid;not null" json:"apiKeyId" validate:"required,uuid"`
-	APIKey    *APIKey   `json:"apiKey,omitempty" validate:"required"`
-	Endpoint  string    `gorm:"not null" json:"endpoint" validate:"required"`
-	Method    string    `gorm:"not null" json:"method" validate:"required,oneof=GET POST PUT DELETE"`
-	Timestamp time.Time `json:"timestamp" validate:"required"`
-	Success   bool      `gorm:"not null;default:true" json:"success" validate:"required"`
-	Error     string    `json:"error" validate:"omitempty"`
-	IPAddress string    `json:"ipAddress" validate:"omitempty"`
-	UserAgent string    `json:"userAgent" validate:"omitempty"`
+	APIKeyID   string    `gorm:"type:uuid;not null;index:idx_api_key_usage_key_time" json:"apiKeyId" validate:"required,uuid"`
+	APIKey     *APIKey   `json:"apiKey,omitempty" validate:"required"`
+	Endpoint   string    `gorm:"not null" json:"endpoint" validate:"required"`
+	Route      string    `json:"route" validate:"omitempty"` // route pattern of the endpoint, e.g. /api/v1/campaigns/:id
+	Method     string    `gorm:"not null" json:"method" validate:"required,oneof=GET POST PUT DELETE"`
+	Timestamp  time.Time `gorm:"index:idx_api_key_usage_key_time" json:"timestamp" validate:"required"`
+	StatusCode int       `json:"statusCode" validate:"omitempty"`
+	Success    bool      `gorm:"not null;default:true" json:"success" validate:"required"`
+	Error      string    `json:"error" validate:"omitempty"`
+	IPAddress  string    `json:"ipAddress" validate:"omitempty"`
+	UserAgent  string    `json:"userAgent" validate:"omitempty"`
 }
 
 type Campaign struct {
 	Base
-	Name              string                    `gorm:"not null" json:"name"`
-	Description       string                    `json:"description"`
-	TemplateID        string                    `gorm:"type:uuid;not null" json:"templateId"`
-	Template          *Template                 `json:"template,omitempty"`
-	TeamID            string                    `gorm:"type:uuid;not null" json:"teamId"`
-	Team              *Team                     `json:"team,omitempty"`
-	Status            CampaignStatus            `gorm:"not null;default:'DRAFT'" json:"status"`
-	ScheduledFor      time.Time                 `json:"scheduledFor"`
-	Schedule          CampaignSchedule          `json:"schedule"`
-	ListID            string                    `gorm:"type:uuid;not null" json:"listId"`
-	List              *MailingList              `json:"list,omitempty"`
-	RecurringSchedule CampaignRecurringSchedule `json:"recurringSchedule"`
-	CronExpression    string                    `json:"cronExpression"`
-	SentEmails        []Email                   `gorm:"foreignKey:CampaignID" json:"sentEmails,omitempty"`
-	Analytics         []EmailTracking           `gorm:"foreignKey:CampaignID" json:"analytics,omitempty"`
-	SMTPConfigID      string                    `gorm:"type:uuid;not null" json:"smtpConfigId"`
-	SMTPConfig        *SMTPConfig               `json:"smtpConfig,omitempty"`
-	BatchSize         int                       `gorm:"not null;default:100" json:"batchSize"`
-	Processed         int                       `gorm:"not null;default:0" json:"processed"`
-	BatchDelay        time.Duration             `gorm:"not null;default:3600" json:"batchDelay"` // 1 hour delay between batches
-	Timezone          string                    `gorm:"not null;default:'America/New_York'" json:"timezone"`
+	Name                   string                    `gorm:"not null" json:"name"`
+	Description            string                    `json:"description"`
+	TemplateID             string                    `gorm:"type:uuid;not null" json:"templateId"`
+	Template               *Template                 `json:"template,omitempty"`
+	TeamID                 string                    `gorm:"type:uuid;not null" json:"teamId"`
+	Team                   *Team                     `json:"team,omitempty"`
+	Status                 CampaignStatus            `gorm:"not null;default:'DRAFT'" json:"status"`
+	PauseReason            string                    `gorm:"not null;default:''" json:"pauseReason,omitempty"` // why sending paused on its own, e.g. the team's quota ran out
+	ScheduledFor           time.Time                 `json:"scheduledFor"`
+	Schedule               CampaignSchedule          `json:"schedule"`
+	ListID                 string                    `gorm:"type:uuid;default:NULL" json:"listId"`
+	List                   *MailingList              `json:"list,omitempty"`
+	SegmentID              string                    `gorm:"type:uuid;default:NULL" json:"segmentId"`
+	Segment                *Segment                  `json:"segment,omitempty"`
+	RecurringSchedule      CampaignRecurringSchedule `json:"recurringSchedule"`
+	CronExpression         string                    `json:"cronExpression"`
+	SentEmails             []Email                   `gorm:"foreignKey:CampaignID" json:"sentEmails,omitempty"`
+	Analytics              []EmailTracking           `gorm:"foreignKey:CampaignID" json:"analytics,omitempty"`
+	SMTPConfigID           string                    `gorm:"type:uuid;not null" json:"smtpConfigId"`
+	SMTPConfig             *SMTPConfig               `json:"smtpConfig,omitempty"`
+	SenderPersonaIDs       pq.StringArray            `gorm:"type:text[]" json:"senderPersonaIds" validate:"omitempty,dive,uuid"` // sent from, rotated by recipient when there are several
+	BatchSize              int                       `gorm:"not null;default:100" json:"batchSize"`
+	Processed              int                       `gorm:"not null;default:0" json:"processed"`
+	BatchDelay             time.Duration             `gorm:"not null;default:3600" json:"batchDelay"` // 1 hour delay between batches
+	Timezone               string                    `gorm:"not null;default:'America/New_York'" json:"timezone"`
+	BlackoutOverride       bool                      `gorm:"not null;default:false" json:"blackoutOverride"`
+	BlackoutPolicy         BlackoutPolicy            `gorm:"not null;default:'SKIP'" json:"blackoutPolicy" validate:"omitempty,oneof=SKIP SHIFT"`
+	Variants               []CampaignVariant         `gorm:"foreignKey:CampaignID" json:"variants,omitempty"`
+	Languages              []CampaignLanguage        `gorm:"foreignKey:CampaignID" json:"languages,omitempty"`
+	ABWinnerMetric         ABWinnerMetric            `gorm:"not null;default:'open_rate'" json:"abWinnerMetric" validate:"omitempty,oneof=open_rate click_rate"`
+	ABTestHours            int                       `gorm:"not null;default:4" json:"abTestHours" validate:"omitempty,min=1,max=168"`
+	ABTestStatus           ABTestStatus              `gorm:"not null;default:''" json:"abTestStatus"`
+	ABTestStartedAt        time.Time                 `gorm:"default:NULL" json:"abTestStartedAt"`
+	ABWinnerVariantID      string                    `gorm:"type:uuid;default:NULL" json:"abWinnerVariantId"`
+	SkipScoring            bool                      `gorm:"not null;default:false" json:"skipScoring"`
+	SamplePercent          int                       `gorm:"not null;default:0" json:"samplePercent" validate:"omitempty,min=1,max=99"` // send to this share of the audience first and observe it before the rest
+	SampleHours            int                       `gorm:"not null;default:4" json:"sampleHours" validate:"omitempty,min=1,max=168"`
+	SampleMaxBounceRate    float64                   `gorm:"not null;default:5" json:"sampleMaxBounceRate" validate:"omitempty,min=0,max=100"`      // percentage
+	SampleMaxComplaintRate float64                   `gorm:"not null;default:0.3" json:"sampleMaxComplaintRate" validate:"omitempty,min=0,max=100"` // percentage
+	SampleStatus           SampleStatus              `gorm:"not null;default:''" json:"sampleStatus"`
+	SampleStartedAt        time.Time                 `gorm:"default:NULL" json:"sampleStartedAt"`
+	SmartSend              bool                      `gorm:"not null;default:false" json:"smartSend"`                                      // mail each contact at the hour of the next day they've engaged with email the most
+	LocalSendTime          string                    `gorm:"not null;default:''" json:"localSendTime" validate:"omitempty,datetime=15:04"` // mail each contact at this time, e.g. 09:00, in their own timezone
+	SnapshotMembers        bool                      `gorm:"not null;default:false" json:"snapshotMembers"`                                // keep every recipient's contact ID in the send snapshots, not just the count and hash
+	IsSample               bool                      `gorm:"not null;default:false" json:"isSample"`                                       // created by populating sample data
 }
 type RateLimit struct {
 	Base
@@ -496,28 +682,33 @@ type Model struct {
 
 type LLMEmailWriterJob struct {
 	Base
-	AutomationID string      `gorm:"type:uuid;not null" json:"automationId"`
-	Automation   *Automation `json:"automation,omitempty"`
-	EmailID      string      `gorm:"type:uuid;not null" json:"emailId"`
-	Email        *Email      `json:"email,omitempty"`
-	Status       string      `gorm:"not null" json:"status"`
-	CreatedAt    time.Time   `json:"createdAt"`
-	StartedAt    time.Time   `json:"startedAt"`
-	CompletedAt  time.Time   `json:"completedAt"`
-	UpdatedAt    time.Time   `json:"updatedAt"`
-	Error        string      `json:"error"`
-	Output       string      `json:"output"`
-	Input        string      `json:"input"`
-	Prompt       string      `json:"prompt"`
-	Model        *Model      `json:"model,omitempty"`
-	ModelID      string      `gorm:"type:uuid;not null" json:"modelId" validate:"required,uuid"`
+	AutomationID     string      `gorm:"type:uuid;default:NULL" json:"automationId"`
+	Automation       *Automation `json:"automation,omitempty"`
+	EmailID          string      `gorm:"type:uuid;default:NULL" json:"emailId"`
+	Email            *Email      `json:"email,omitempty"`
+	TemplateID       string      `gorm:"type:uuid;default:NULL" json:"templateId"`
+	Template         *Template   `json:"template,omitempty"`
+	TeamID           string      `gorm:"type:uuid;default:NULL;index" json:"teamId"`
+	PromptTokens     int         `gorm:"not null;default:0" json:"promptTokens"`
+	CompletionTokens int         `gorm:"not null;default:0" json:"completionTokens"`
+	Status           string      `gorm:"not null" json:"status"`
+	CreatedAt        time.Time   `json:"createdAt"`
+	StartedAt        time.Time   `json:"startedAt"`
+	CompletedAt      time.Time   `json:"completedAt"`
+	UpdatedAt        time.Time   `json:"updatedAt"`
+	Error            string      `json:"error"`
+	Output           string      `json:"output"`
+	Input            string      `json:"input"`
+	Prompt           string      `json:"prompt"`
+	Model            *Model      `json:"model,omitempty"`
+	ModelID          string      `gorm:"type:uuid;not null" json:"modelId" validate:"required,uuid"`
 }
 
 type AutomationNode struct {
 	Base
 	AutomationID string               `gorm:"type:uuid;not null" json:"automationId"`
 	Automation   *Automation          `json:"automation,omitempty"`
-	Type         NodeType             `gorm:"not null" json:"type" validate:"required,oneof=EMAIL_WRITER"`
+	Type         NodeType             `gorm:"not null" json:"type" validate:"required,oneof=EMAIL_WRITER START EMAIL WAIT CONDITION WEBHOOK ADD_TO_LIST REMOVE_FROM_LIST UPDATE_SUBSCRIBER CHECK_ENGAGEMENT SEGMENT TAG UNSUBSCRIBE CUSTOM_CODE EXIT"`
 	Data         datatypes.JSON       `gorm:"type:jsonb" json:"data" validate:"required,json"`
 	EdgesFrom    []AutomationNodeEdge `gorm:"foreignKey:SourceID" json:"edgesFrom,omitempty"`
 	EdgesTo      []AutomationNodeEdge `gorm:"foreignKey:TargetID" json:"edgesTo,omitempty"`
@@ -547,7 +738,7 @@ func IsValidUserRole(role UserRole) bool {
 
 func GetEmailByID(id string, db *gorm.DB) (*Email, error) {
 	var email Email
-	if err := db.Where("id = ?", id).Preload("SMTPConfig").First(&email).Error; err != nil {
+	if err := db.Where("id = ?", id).Preload("SMTPConfig").Preload("Attachments.File").First(&email).Error; err != nil {
 		return nil, err
 	}
 	return &email, nil
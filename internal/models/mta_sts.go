@@ -0,0 +1,106 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// MTASTSMode is the enforcement mode published in a domain's MTA-STS policy
+type MTASTSMode string
+
+const (
+	MTASTSModeNone    MTASTSMode = "none"
+	MTASTSModeTesting MTASTSMode = "testing"
+	MTASTSModeEnforce MTASTSMode = "enforce"
+)
+
+// TLSReport is one policy entry of an SMTP TLS report (RFC 8460) received for a team's domain
+type TLSReport struct {
+	Base
+	ReportID         string         `gorm:"not null;uniqueIndex:idx_tls_report_policy" json:"reportId"`
+	OrganizationName string         `json:"organizationName"`
+	ContactInfo      string         `json:"contactInfo"`
+	StartDate        time.Time      `gorm:"index" json:"startDate"`
+	EndDate          time.Time      `json:"endDate"`
+	PolicyType       string         `gorm:"not null;uniqueIndex:idx_tls_report_policy" json:"policyType"`
+	PolicyDomain     string         `gorm:"not null;index;uniqueIndex:idx_tls_report_policy" json:"policyDomain"`
+	MXHost           string         `gorm:"uniqueIndex:idx_tls_report_policy" json:"mxHost"`
+	SuccessCount     int64          `gorm:"not null;default:0" json:"successCount"`
+	FailureCount     int64          `gorm:"not null;default:0" json:"failureCount"`
+	FailureDetails   datatypes.JSON `gorm:"type:jsonb;default:'[]'" json:"failureDetails"`
+	DomainID         string         `gorm:"type:uuid;not null" json:"domainId"`
+	Domain           *Domain        `json:"domain,omitempty"`
+	TeamID           string         `gorm:"type:uuid;not null;index" json:"teamId"`
+}
+
+// TLSRPTReport is the JSON document defined by RFC 8460
+type TLSRPTReport struct {
+	OrganizationName string `json:"organization-name"`
+	DateRange        struct {
+		StartDatetime time.Time `json:"start-datetime"`
+		EndDatetime   time.Time `json:"end-datetime"`
+	} `json:"date-range"`
+	ContactInfo string               `json:"contact-info"`
+	ReportID    string               `json:"report-id"`
+	Policies    []TLSRPTPolicyResult `json:"policies"`
+}
+
+// TLSRPTPolicyResult is the result for one policy within a TLS report
+type TLSRPTPolicyResult struct {
+	Policy struct {
+		PolicyType   string   `json:"policy-type"`
+		PolicyString []string `json:"policy-string"`
+		PolicyDomain string   `json:"policy-domain"`
+		MXHost       string   `json:"mx-host"`
+	} `json:"policy"`
+	Summary struct {
+		TotalSuccessfulSessionCount int64 `json:"total-successful-session-count"`
+		TotalFailureSessionCount    int64 `json:"total-failure-session-count"`
+	} `json:"summary"`
+	FailureDetails []TLSRPTFailureDetail `json:"failure-details"`
+}
+
+// TLSRPTFailureDetail describes a class of failed TLS sessions
+type TLSRPTFailureDetail struct {
+	ResultType            string `json:"result-type"`
+	SendingMTAIP          string `json:"sending-mta-ip,omitempty"`
+	ReceivingMXHostname   string `json:"receiving-mx-hostname,omitempty"`
+	ReceivingMXHelo       string `json:"receiving-mx-helo,omitempty"`
+	ReceivingIP           string `json:"receiving-ip,omitempty"`
+	FailedSessionCount    int64  `json:"failed-session-count"`
+	AdditionalInformation string `json:"additional-information,omitempty"`
+	FailureReasonCode     string `json:"failure-reason-code,omitempty"`
+}
+
+// MTASTSHost is the host the MTA-STS policy must be served from
+func (d *Domain) MTASTSHost() string {
+	return "mta-sts." + d.Domain
+}
+
+// MTASTSPolicy renders the policy file served at /.well-known/mta-sts.txt
+func (d *Domain) MTASTSPolicy(mx []string) string {
+	mode := d.MTASTSMode
+	if mode == "" {
+		mode = MTASTSModeTesting
+	}
+
+	var b strings.Builder
+	b.WriteString("version: STSv1\r\n")
+	fmt.Fprintf(&b, "mode: %s\r\n", mode)
+	for _, host := range mx {
+		fmt.Fprintf(&b, "mx: %s\r\n", strings.TrimSuffix(strings.ToLower(host), "."))
+	}
+	fmt.Fprintf(&b, "max_age: %d\r\n", d.MTASTSMaxAge)
+	return b.String()
+}
+
+// MTASTSPolicyID derives the policy id from its content, so it changes whenever the policy does
+func MTASTSPolicyID(policy string) string {
+	sum := sha256.Sum256([]byte(policy))
+	return hex.EncodeToString(sum[:])[:20]
+}
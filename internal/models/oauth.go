@@ -0,0 +1,92 @@
+package models
+
+import (
+	"fmt"
+	"kori/internal/utils/crypto"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// AuthType is how an SMTP or IMAP config signs in to its server
+type AuthType string
+
+const (
+	AuthTypePassword AuthType = "PASSWORD"
+	AuthTypeOAuth2   AuthType = "OAUTH2" // XOAUTH2 with an access token from the mailbox provider
+)
+
+// OAuthProvider is the identity provider an OAuth2 mailbox was connected through
+type OAuthProvider string
+
+const (
+	OAuthProviderGoogle    OAuthProvider = "GOOGLE"
+	OAuthProviderMicrosoft OAuthProvider = "MICROSOFT"
+)
+
+// OAuthCredentials are the tokens of a mailbox connected with OAuth2. They're embedded in SMTP
+// and IMAP configs and stored encrypted.
+type OAuthCredentials struct {
+	AuthType            AuthType      `gorm:"not null;default:'PASSWORD'" json:"authType" validate:"omitempty,oneof=PASSWORD OAUTH2"`
+	OAuthProvider       OAuthProvider `gorm:"column:oauth_provider;default:NULL" json:"oauthProvider,omitempty" validate:"omitempty,oneof=GOOGLE MICROSOFT"`
+	OAuthAccessToken    string        `gorm:"column:oauth_access_token" json:"-"`
+	OAuthRefreshToken   string        `gorm:"column:oauth_refresh_token" json:"-"`
+	OAuthTokenExpiresAt *time.Time    `gorm:"column:oauth_token_expires_at;default:NULL" json:"oauthTokenExpiresAt,omitempty"`
+	OAuthConnectedAt    *time.Time    `gorm:"column:oauth_connected_at;default:NULL" json:"oauthConnectedAt,omitempty"`
+}
+
+// UsesOAuth reports whether the config signs in with XOAUTH2
+func (o *OAuthCredentials) UsesOAuth() bool {
+	return o.AuthType == AuthTypeOAuth2
+}
+
+func (o *OAuthCredentials) encrypt() error {
+	for _, token := range []*string{&o.OAuthAccessToken, &o.OAuthRefreshToken} {
+		if *token == "" {
+			continue
+		}
+		encrypted, err := crypto.EncryptLong(*token)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt oauth token: %w", err)
+		}
+		*token = encrypted
+	}
+	return nil
+}
+
+func (o *OAuthCredentials) decrypt() error {
+	for _, token := range []*string{&o.OAuthAccessToken, &o.OAuthRefreshToken} {
+		if *token == "" {
+			continue
+		}
+		decrypted, err := crypto.DecryptLong(*token)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt oauth token: %w", err)
+		}
+		*token = decrypted
+	}
+	return nil
+}
+
+// SaveOAuthTokens stores new tokens on an SMTP or IMAP config, e.g. after a refresh. The
+// refresh token is only replaced when the provider issued a new one.
+func SaveOAuthTokens(model interface{}, id string, credentials OAuthCredentials, db *gorm.DB) error {
+	if err := credentials.encrypt(); err != nil {
+		return err
+	}
+	updates := map[string]interface{}{
+		"oauth_access_token":     credentials.OAuthAccessToken,
+		"oauth_token_expires_at": credentials.OAuthTokenExpiresAt,
+	}
+	if credentials.OAuthRefreshToken != "" {
+		updates["oauth_refresh_token"] = credentials.OAuthRefreshToken
+	}
+	if credentials.AuthType != "" {
+		updates["auth_type"] = credentials.AuthType
+		updates["oauth_provider"] = credentials.OAuthProvider
+	}
+	if credentials.OAuthConnectedAt != nil {
+		updates["oauth_connected_at"] = credentials.OAuthConnectedAt
+	}
+	return db.Model(model).Where("id = ?", id).UpdateColumns(updates).Error
+}
@@ -0,0 +1,188 @@
+package models
+
+import (
+	"slices"
+	"time"
+
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Onboarding steps, in the order the dashboard shows them
+const (
+	OnboardingStepSMTPVerified      = "smtp_verified"
+	OnboardingStepDomainVerified    = "domain_verified"
+	OnboardingStepListImported      = "list_imported"
+	OnboardingStepFirstCampaignSent = "first_campaign_sent"
+)
+
+// OnboardingSteps are the setup steps of a new team with their titles
+var OnboardingSteps = []struct {
+	Key   string
+	Title string
+}{
+	{OnboardingStepSMTPVerified, "Connect and verify an SMTP server"},
+	{OnboardingStepDomainVerified, "Verify a sending domain"},
+	{OnboardingStepListImported, "Import a list of contacts"},
+	{OnboardingStepFirstCampaignSent, "Send your first campaign"},
+}
+
+// IsOnboardingStep reports whether key names an onboarding step
+func IsOnboardingStep(key string) bool {
+	for _, step := range OnboardingSteps {
+		if step.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// OnboardingState is what a team did with its checklist by hand. Whether a step is done is
+// otherwise worked out from the team's data.
+type OnboardingState struct {
+	Base
+	TeamID         string         `gorm:"type:uuid;uniqueIndex;not null" json:"teamId"`
+	CompletedSteps pq.StringArray `gorm:"type:text[]" json:"completedSteps"` // steps marked complete by hand
+	DismissedAt    *time.Time     `json:"dismissedAt,omitempty"`
+}
+
+// OnboardingStepStatus is whether a team has done one setup step
+type OnboardingStepStatus struct {
+	Key       string `json:"key"`
+	Title     string `json:"title"`
+	Completed bool   `json:"completed"`
+	Source    string `json:"source,omitempty"` // data when the team's data shows it's done, manual when marked complete
+}
+
+// Onboarding is a team's checklist
+type Onboarding struct {
+	Steps          []OnboardingStepStatus `json:"steps"`
+	CompletedCount int                    `json:"completedCount"`
+	Total          int                    `json:"total"`
+	Completed      bool                   `json:"completed"`
+	Dismissed      bool                   `json:"dismissed"`
+	DismissedAt    *time.Time             `json:"dismissedAt,omitempty"`
+}
+
+// onboardingChecks tell from a team's data whether each step is done
+var onboardingChecks = map[string]func(teamID string, db *gorm.DB) (bool, error){
+	OnboardingStepSMTPVerified: func(teamID string, db *gorm.DB) (bool, error) {
+		// A config passed a health check or has delivered mail
+		return hasRows(db.Model(&SMTPConfig{}).
+			Where("team_id = ? AND is_active = true AND is_deleted = false", teamID).
+			Where("(is_healthy = true AND last_health_check_at IS NOT NULL) OR id IN (?)",
+				db.Model(&Email{}).Select("smtp_config_id").Where("team_id = ? AND is_sample = false AND status IN ?", teamID, deliveredEmailStatuses)))
+	},
+	OnboardingStepDomainVerified: func(teamID string, db *gorm.DB) (bool, error) {
+		return hasRows(db.Model(&Domain{}).Where("team_id = ? AND is_verified = true AND is_deleted = false", teamID))
+	},
+	OnboardingStepListImported: func(teamID string, db *gorm.DB) (bool, error) {
+		// Transactional sends record contacts through file-less imports, which don't count
+		imported, err := hasRows(db.Model(&ContactImport{}).
+			Where("team_id = ? AND status = ? AND file_id IS NOT NULL AND is_deleted = false", teamID, ContactImportStatusCompleted))
+		if err != nil || imported {
+			return imported, err
+		}
+		return hasRows(db.Model(&ContactSyncSource{}).
+			Where("team_id = ? AND last_status = ? AND is_deleted = false", teamID, ContactSyncStatusSuccess))
+	},
+	OnboardingStepFirstCampaignSent: func(teamID string, db *gorm.DB) (bool, error) {
+		return hasRows(db.Model(&Email{}).
+			Where("team_id = ? AND campaign_id IS NOT NULL AND test = false AND is_sample = false AND status IN ?", teamID, deliveredEmailStatuses))
+	},
+}
+
+// deliveredEmailStatuses are the statuses of emails that left the SMTP server
+var deliveredEmailStatuses = []EmailStatus{EmailStatusSent, EmailStatusOpened, EmailStatusClicked, EmailStatusBounced}
+
+func hasRows(query *gorm.DB) (bool, error) {
+	var found int64
+	err := query.Count(&found).Error
+	return found > 0, err
+}
+
+// GetOnboardingState returns the team's checklist state, which is empty until the team acts on it
+func GetOnboardingState(teamID string, db *gorm.DB) (*OnboardingState, error) {
+	state := &OnboardingState{TeamID: teamID}
+	if err := db.Where("team_id = ? AND is_deleted = false", teamID).Limit(1).Find(state).Error; err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// GetOnboarding works out the team's checklist from its data and what it marked by hand
+func GetOnboarding(teamID string, db *gorm.DB) (*Onboarding, error) {
+	state, err := GetOnboardingState(teamID, db)
+	if err != nil {
+		return nil, err
+	}
+
+	onboarding := &Onboarding{
+		Steps:       make([]OnboardingStepStatus, 0, len(OnboardingSteps)),
+		Total:       len(OnboardingSteps),
+		Dismissed:   state.DismissedAt != nil,
+		DismissedAt: state.DismissedAt,
+	}
+	for _, step := range OnboardingSteps {
+		status := OnboardingStepStatus{Key: step.Key, Title: step.Title}
+
+		done, err := onboardingChecks[step.Key](teamID, db)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case done:
+			status.Completed, status.Source = true, "data"
+		case slices.Contains(state.CompletedSteps, step.Key):
+			status.Completed, status.Source = true, "manual"
+		}
+
+		if status.Completed {
+			onboarding.CompletedCount++
+		}
+		onboarding.Steps = append(onboarding.Steps, status)
+	}
+	onboarding.Completed = onboarding.CompletedCount == onboarding.Total
+
+	return onboarding, nil
+}
+
+// saveOnboardingState creates the team's state or updates the given columns of it
+func saveOnboardingState(state *OnboardingState, columns []string, db *gorm.DB) error {
+	if state.ID != "" {
+		return db.Model(state).Select(columns).Updates(state).Error
+	}
+	// Two requests creating the state at once end up updating the same row
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "team_id"}},
+		DoUpdates: clause.AssignmentColumns(append(columns, "updated_at")),
+	}).Create(state).Error
+}
+
+// CompleteOnboardingStep marks a step complete by hand
+func CompleteOnboardingStep(teamID, step string, db *gorm.DB) error {
+	state, err := GetOnboardingState(teamID, db)
+	if err != nil {
+		return err
+	}
+	if slices.Contains(state.CompletedSteps, step) {
+		return nil
+	}
+	state.CompletedSteps = append(state.CompletedSteps, step)
+	return saveOnboardingState(state, []string{"completed_steps"}, db)
+}
+
+// DismissOnboarding hides the team's checklist, or shows it again when dismissed is false
+func DismissOnboarding(teamID string, dismissed bool, db *gorm.DB) error {
+	state, err := GetOnboardingState(teamID, db)
+	if err != nil {
+		return err
+	}
+	state.DismissedAt = nil
+	if dismissed {
+		now := time.Now()
+		state.DismissedAt = &now
+	}
+	return saveOnboardingState(state, []string{"dismissed_at"}, db)
+}
@@ -0,0 +1,152 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// LatencyPercentiles are latency percentiles in seconds
+type LatencyPercentiles struct {
+	P50 float64 `json:"p50"`
+	P95 float64 `json:"p95"`
+	P99 float64 `json:"p99"`
+	Max float64 `json:"max"`
+}
+
+// PipelineLatency is how long the emails delivered through a queue, or through one SMTP config
+// on a queue, took. Time in queue runs from the last attempt being due to a worker picking it
+// up; delivery runs from the email being due (created, or its scheduled send time) to it being
+// sent, so retries count against it.
+type PipelineLatency struct {
+	Queue        string             `json:"queue"`
+	SMTPConfigID string             `json:"smtpConfigId,omitempty"`
+	SMTPHost     string             `json:"smtpHost,omitempty"`
+	TeamID       string             `json:"teamId,omitempty"`
+	Emails       int64              `json:"emails"`
+	TimeInQueue  LatencyPercentiles `json:"timeInQueue"`
+	Delivery     LatencyPercentiles `json:"delivery"`
+	SLASeconds   float64            `json:"slaSeconds,omitempty"` // the queue's p95 delivery target
+	Breached     bool               `json:"breached"`             // p95 delivery is over the target
+}
+
+// PipelineSLA are the p95 delivery targets per queue. Groups with fewer than MinEmails
+// deliveries are reported but never breach.
+type PipelineSLA struct {
+	Targets   map[string]time.Duration
+	MinEmails int
+}
+
+// EmailPipelineMetrics are the email pipeline's latencies over a window
+type EmailPipelineMetrics struct {
+	Since       time.Time         `json:"since"`
+	Until       time.Time         `json:"until"`
+	Queues      []PipelineLatency `json:"queues"`
+	SMTPConfigs []PipelineLatency `json:"smtpConfigs"`
+	Breaches    []PipelineLatency `json:"breaches"`
+}
+
+const (
+	// pipelineQueueSeconds is how long the last attempt waited for a worker
+	pipelineQueueSeconds = "EXTRACT(EPOCH FROM emails.dequeued_at - GREATEST(emails.queued_at, emails.send_at))"
+	// pipelineDeliverySeconds is how long the email took from being due to being sent
+	pipelineDeliverySeconds = "EXTRACT(EPOCH FROM emails.sent_at - GREATEST(emails.created_at, emails.send_at))"
+)
+
+type pipelineLatencyRow struct {
+	Queue        string
+	SMTPConfigID string
+	SMTPHost     string
+	TeamID       string
+	Emails       int64
+	QueueP50     float64
+	QueueP95     float64
+	QueueP99     float64
+	QueueMax     float64
+	DeliveryP50  float64
+	DeliveryP95  float64
+	DeliveryP99  float64
+	DeliveryMax  float64
+}
+
+// percentileColumns selects the p50, p95, p99 and max of a latency as <name>_p50 and so on
+func percentileColumns(name, expr string) string {
+	return fmt.Sprintf(`percentile_cont(0.5) WITHIN GROUP (ORDER BY %[2]s) AS %[1]s_p50,
+		percentile_cont(0.95) WITHIN GROUP (ORDER BY %[2]s) AS %[1]s_p95,
+		percentile_cont(0.99) WITHIN GROUP (ORDER BY %[2]s) AS %[1]s_p99,
+		MAX(%[2]s) AS %[1]s_max`, name, expr)
+}
+
+// GetEmailPipelineMetrics computes the latencies of the emails sent since the given time, per
+// queue and per SMTP config and queue, and checks them against the SLA. Test sends and emails
+// sent before their queue timestamps were recorded are left out.
+func GetEmailPipelineMetrics(since time.Time, sla PipelineSLA, db *gorm.DB) (*EmailPipelineMetrics, error) {
+	metrics := &EmailPipelineMetrics{
+		Since:       since,
+		Until:       time.Now(),
+		Queues:      []PipelineLatency{},
+		SMTPConfigs: []PipelineLatency{},
+		Breaches:    []PipelineLatency{},
+	}
+
+	delivered := func() *gorm.DB {
+		return db.Model(&Email{}).
+			Where("emails.sent_at >= ? AND emails.status IN ?", since,
+				[]EmailStatus{EmailStatusSent, EmailStatusOpened, EmailStatusClicked, EmailStatusBounced}).
+			Where("emails.queued_at IS NOT NULL AND emails.dequeued_at IS NOT NULL AND emails.test = false AND emails.is_deleted = false")
+	}
+	latencies := percentileColumns("queue", pipelineQueueSeconds) + ", " + percentileColumns("delivery", pipelineDeliverySeconds)
+
+	var queues []pipelineLatencyRow
+	if err := delivered().
+		Select("emails.queue, COUNT(*) AS emails, " + latencies).
+		Group("emails.queue").
+		Order("emails.queue").
+		Scan(&queues).Error; err != nil {
+		return nil, fmt.Errorf("failed to compute queue latencies: %w", err)
+	}
+
+	var configs []pipelineLatencyRow
+	if err := delivered().
+		Select("emails.queue, emails.smtp_config_id, smtp_configs.host AS smtp_host, smtp_configs.team_id, COUNT(*) AS emails, " + latencies).
+		Joins("JOIN smtp_configs ON smtp_configs.id = emails.smtp_config_id").
+		Group("emails.queue, emails.smtp_config_id, smtp_configs.host, smtp_configs.team_id").
+		Order("emails.queue, smtp_configs.host").
+		Scan(&configs).Error; err != nil {
+		return nil, fmt.Errorf("failed to compute smtp config latencies: %w", err)
+	}
+
+	for _, row := range queues {
+		latency := row.latency(sla)
+		metrics.Queues = append(metrics.Queues, latency)
+		if latency.Breached {
+			metrics.Breaches = append(metrics.Breaches, latency)
+		}
+	}
+	for _, row := range configs {
+		latency := row.latency(sla)
+		metrics.SMTPConfigs = append(metrics.SMTPConfigs, latency)
+		if latency.Breached {
+			metrics.Breaches = append(metrics.Breaches, latency)
+		}
+	}
+	return metrics, nil
+}
+
+func (r pipelineLatencyRow) latency(sla PipelineSLA) PipelineLatency {
+	latency := PipelineLatency{
+		Queue:        r.Queue,
+		SMTPConfigID: r.SMTPConfigID,
+		SMTPHost:     r.SMTPHost,
+		TeamID:       r.TeamID,
+		Emails:       r.Emails,
+		TimeInQueue:  LatencyPercentiles{P50: r.QueueP50, P95: r.QueueP95, P99: r.QueueP99, Max: r.QueueMax},
+		Delivery:     LatencyPercentiles{P50: r.DeliveryP50, P95: r.DeliveryP95, P99: r.DeliveryP99, Max: r.DeliveryMax},
+	}
+	if target, ok := sla.Targets[r.Queue]; ok && target > 0 {
+		latency.SLASeconds = target.Seconds()
+		latency.Breached = r.Emails >= int64(sla.MinEmails) && r.DeliveryP95 > latency.SLASeconds
+	}
+	return latency
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// LinkCheckCacheTTL is how long a link check result is reused before the link is checked again
+const LinkCheckCacheTTL = 6 * time.Hour
+
+// LinkCheck caches the result of checking a link so repeated preflights don't hammer remote hosts
+type LinkCheck struct {
+	Base
+	URL           string         `gorm:"not null;uniqueIndex" json:"url"`
+	FinalURL      string         `json:"finalUrl"`
+	StatusCode    int            `json:"statusCode"`
+	RedirectChain pq.StringArray `gorm:"type:text[]" json:"redirectChain"`
+	IsHTTPS       bool           `gorm:"not null;default:false" json:"isHttps"`
+	Error         string         `json:"error"`
+	Issues        pq.StringArray `gorm:"type:text[]" json:"issues"`
+	CheckedAt     time.Time      `gorm:"not null" json:"checkedAt"`
+}
+
+// IsFresh reports whether the cached result can still be used
+func (l *LinkCheck) IsFresh(now time.Time) bool {
+	return now.Sub(l.CheckedAt) < LinkCheckCacheTTL
+}
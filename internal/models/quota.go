@@ -0,0 +1,226 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// QuotaResource represents a metered resource that counts against a plan limit
+type QuotaResource string
+
+const (
+	QuotaResourceEmails    QuotaResource = "emails"    // emails sent each month, test emails aside
+	QuotaResourceCampaigns QuotaResource = "campaigns" // campaigns started each month
+	QuotaResourceContacts  QuotaResource = "contacts"
+)
+
+// Default limits applied to teams without an active subscription
+const (
+	DefaultMonthlyEmailQuota = 1000
+	DefaultContactQuota      = 500
+)
+
+// FreePlanName is the plan of teams without an active subscription
+const FreePlanName = "Free"
+
+// QuotaWarningThresholds are the usage percentages at which teams are warned; at 100 sends are blocked
+var QuotaWarningThresholds = []int{80, 95, 100}
+
+// quotaFeatures are the plan features holding the limit of each resource
+var quotaFeatures = map[QuotaResource]ProductFeature{
+	QuotaResourceEmails:    FeatureMonthlyEmails,
+	QuotaResourceCampaigns: FeatureEmailCampaigns,
+	QuotaResourceContacts:  FeatureContacts,
+}
+
+// QuotaUsage is a snapshot of how much of a quota a team has consumed
+type QuotaUsage struct {
+	Resource    QuotaResource `json:"resource"`
+	Used        int64         `json:"used"`
+	Limit       int64         `json:"limit"`
+	Remaining   int64         `json:"remaining"`
+	Percent     float64       `json:"percent"`
+	PeriodStart time.Time     `json:"periodStart"`
+	PeriodEnd   time.Time     `json:"periodEnd"`
+}
+
+// QuotaNotification records a threshold crossing so each warning is only sent once per period
+type QuotaNotification struct {
+	Base
+	TeamID    string        `gorm:"type:uuid;not null;uniqueIndex:idx_quota_notification" json:"teamId" validate:"required,uuid"`
+	Team      *Team         `json:"team,omitempty"`
+	Resource  QuotaResource `gorm:"not null;uniqueIndex:idx_quota_notification" json:"resource" validate:"required,oneof=emails campaigns contacts"`
+	Period    string        `gorm:"not null;uniqueIndex:idx_quota_notification" json:"period" validate:"required"`
+	Threshold int           `gorm:"not null;uniqueIndex:idx_quota_notification" json:"threshold" validate:"required"`
+	Used      int64         `gorm:"not null" json:"used"`
+	Limit     int64         `gorm:"not null" json:"limit"`
+}
+
+// QuotaCounter is how much of a monthly quota a team consumed in a period. Sends take their
+// credits from it when they're queued, so the count holds however many are sent at once.
+type QuotaCounter struct {
+	Base
+	TeamID   string        `gorm:"type:uuid;not null;uniqueIndex:idx_quota_counter" json:"teamId"`
+	Resource QuotaResource `gorm:"not null;uniqueIndex:idx_quota_counter" json:"resource"`
+	Period   string        `gorm:"not null;uniqueIndex:idx_quota_counter" json:"period"`
+	Used     int64         `gorm:"not null;default:0" json:"used"`
+}
+
+// QuotaExceededError is returned when a send would take a team over its plan's quota
+type QuotaExceededError struct {
+	Resource  QuotaResource
+	Used      int64
+	Limit     int64
+	PeriodEnd time.Time
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("the team has used %d of the %d %s its plan allows this month; upgrade the plan or wait until %s",
+		e.Used, e.Limit, e.Resource, e.PeriodEnd.Format("2006-01-02"))
+}
+
+// GetQuotaPeriod returns the start and end of the monthly quota period containing t
+func GetQuotaPeriod(t time.Time) (time.Time, time.Time) {
+	start := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return start, start.AddDate(0, 1, 0)
+}
+
+// GetQuotaPeriodKey returns the key used to identify a monthly quota period (e.g. 2024-05)
+func GetQuotaPeriodKey(t time.Time) string {
+	start, _ := GetQuotaPeriod(t)
+	return start.Format("2006-01")
+}
+
+// GetTeamQuotaLimits returns the name of a team's plan and the limit of every metered resource.
+// Teams without an active subscription, and plans leaving a limit unset, get the free tier's.
+func GetTeamQuotaLimits(teamID string, db *gorm.DB) (string, map[QuotaResource]int64) {
+	limits := make(map[QuotaResource]int64, len(quotaFeatures))
+	for resource, feature := range quotaFeatures {
+		limits[resource] = int64(FreeTierFeatures[feature])
+	}
+
+	subscription := &Subscription{}
+	if err := db.Where("team_id = ? AND status = ? AND is_deleted = false", teamID, SubscriptionStatusActive).
+		Preload("Product.Features").First(subscription).Error; err != nil || subscription.Product == nil {
+		return FreePlanName, limits
+	}
+
+	for resource, feature := range quotaFeatures {
+		if limit := subscription.GetFeatureLimit(feature); limit > 0 {
+			limits[resource] = int64(limit)
+		}
+	}
+
+	return subscription.Product.Name, limits
+}
+
+// GetQuotaUsed returns how much of a monthly quota a team consumed in the period
+func GetQuotaUsed(teamID string, resource QuotaResource, period string, db *gorm.DB) (int64, error) {
+	var used int64
+	if err := db.Model(&QuotaCounter{}).
+		Where("team_id = ? AND resource = ? AND period = ?", teamID, resource, period).
+		Select("COALESCE(SUM(used), 0)").Scan(&used).Error; err != nil {
+		return 0, err
+	}
+	return used, nil
+}
+
+// ConsumeQuota takes n credits of a monthly quota for a team's sends, or returns a
+// *QuotaExceededError and takes none when the team has fewer left. The check and the count are
+// one statement, so concurrent sends can't both take the last credits.
+func ConsumeQuota(teamID string, resource QuotaResource, n int64, db *gorm.DB) error {
+	if n <= 0 {
+		return nil
+	}
+	now := time.Now().UTC()
+	period := GetQuotaPeriodKey(now)
+	_, end := GetQuotaPeriod(now)
+	_, limits := GetTeamQuotaLimits(teamID, db)
+	limit := limits[resource]
+
+	if n <= limit {
+		counter := &QuotaCounter{TeamID: teamID, Resource: resource, Period: period, Used: n}
+		result := db.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "team_id"}, {Name: "resource"}, {Name: "period"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"used":       gorm.Expr("quota_counters.used + ?", n),
+				"updated_at": now,
+			}),
+			Where: clause.Where{Exprs: []clause.Expression{gorm.Expr("quota_counters.used + ? <= ?", n, limit)}},
+		}).Create(counter)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 1 {
+			return nil
+		}
+	}
+
+	used, err := GetQuotaUsed(teamID, resource, period, db)
+	if err != nil {
+		return err
+	}
+	return &QuotaExceededError{Resource: resource, Used: used, Limit: limit, PeriodEnd: end}
+}
+
+// RefundQuota gives back credits taken for sends that were never queued
+func RefundQuota(teamID string, resource QuotaResource, n int64, db *gorm.DB) error {
+	if n <= 0 {
+		return nil
+	}
+	return db.Model(&QuotaCounter{}).
+		Where("team_id = ? AND resource = ? AND period = ?", teamID, resource, GetQuotaPeriodKey(time.Now().UTC())).
+		Updates(map[string]interface{}{
+			"used":       gorm.Expr("GREATEST(used - ?, 0)", n),
+			"updated_at": time.Now(),
+		}).Error
+}
+
+// GetTeamQuotaUsage returns the current usage of every metered resource for a team
+func GetTeamQuotaUsage(teamID string, db *gorm.DB) ([]QuotaUsage, error) {
+	now := time.Now().UTC()
+	start, end := GetQuotaPeriod(now)
+	period := GetQuotaPeriodKey(now)
+	_, limits := GetTeamQuotaLimits(teamID, db)
+
+	emailCount, err := GetQuotaUsed(teamID, QuotaResourceEmails, period, db)
+	if err != nil {
+		return nil, err
+	}
+	campaignCount, err := GetQuotaUsed(teamID, QuotaResourceCampaigns, period, db)
+	if err != nil {
+		return nil, err
+	}
+
+	var contactCount int64
+	if err := db.Model(&Contact{}).
+		Where("team_id = ? AND is_deleted = false", teamID).
+		Count(&contactCount).Error; err != nil {
+		return nil, err
+	}
+
+	return []QuotaUsage{
+		newQuotaUsage(QuotaResourceEmails, emailCount, limits[QuotaResourceEmails], start, end),
+		newQuotaUsage(QuotaResourceCampaigns, campaignCount, limits[QuotaResourceCampaigns], start, end),
+		newQuotaUsage(QuotaResourceContacts, contactCount, limits[QuotaResourceContacts], start, end),
+	}, nil
+}
+
+func newQuotaUsage(resource QuotaResource, used, limit int64, start, end time.Time) QuotaUsage {
+	percent := 0.0
+	if limit > 0 {
+		percent = float64(used) / float64(limit) * 100
+	}
+	return QuotaUsage{
+		Resource:    resource,
+		Used:        used,
+		Limit:       limit,
+		Remaining:   max(limit-used, 0),
+		Percent:     percent,
+		PeriodStart: start,
+		PeriodEnd:   end,
+	}
+}
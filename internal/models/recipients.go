@@ -0,0 +1,96 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RecipientStatus is the furthest a campaign email got with its contact
+type RecipientStatus string
+
+const (
+	RecipientStatusQueued       RecipientStatus = "queued"
+	RecipientStatusSent         RecipientStatus = "sent"
+	RecipientStatusFailed       RecipientStatus = "failed"
+	RecipientStatusOpened       RecipientStatus = "opened"
+	RecipientStatusClicked      RecipientStatus = "clicked"
+	RecipientStatusBounced      RecipientStatus = "bounced"
+	RecipientStatusUnsubscribed RecipientStatus = "unsubscribed"
+	RecipientStatusCancelled    RecipientStatus = "cancelled"
+)
+
+// RecipientStatuses are the statuses recipients can be filtered by
+var RecipientStatuses = []RecipientStatus{
+	RecipientStatusQueued,
+	RecipientStatusSent,
+	RecipientStatusFailed,
+	RecipientStatusOpened,
+	RecipientStatusClicked,
+	RecipientStatusBounced,
+	RecipientStatusUnsubscribed,
+	RecipientStatusCancelled,
+}
+
+// recipientStatusSQL ranks what happened to an email, so a contact that clicked and then
+// unsubscribed is reported as unsubscribed
+const recipientStatusSQL = `CASE
+	WHEN BOOL_OR(t.event = 'unsubscribe') THEN 'unsubscribed'
+	WHEN BOOL_OR(t.event = 'bounce') OR emails.status = 'BOUNCED' THEN 'bounced'
+	WHEN BOOL_OR(t.event = 'click') OR emails.status = 'CLICKED' THEN 'clicked'
+	WHEN BOOL_OR(t.event = 'open') OR emails.status = 'OPENED' THEN 'opened'
+	WHEN emails.status = 'FAILED' THEN 'failed'
+	WHEN emails.status = 'CANCELLED' THEN 'cancelled'
+	WHEN emails.status = 'SENT' THEN 'sent'
+	ELSE 'queued'
+END`
+
+// CampaignRecipient is the delivery report of one campaign email
+type CampaignRecipient struct {
+	EmailID        string          `json:"emailId"`
+	ContactID      string          `json:"contactId"`
+	Email          string          `json:"email"`
+	FirstName      string          `json:"firstName"`
+	LastName       string          `json:"lastName"`
+	VariantID      string          `json:"variantId,omitempty"`
+	Status         RecipientStatus `json:"status"`
+	Error          string          `json:"error,omitempty"`
+	SentAt         *time.Time      `json:"sentAt,omitempty"`
+	Opens          int64           `json:"opens"`
+	Clicks         int64           `json:"clicks"`
+	OpenedAt       *time.Time      `json:"openedAt,omitempty"`
+	ClickedAt      *time.Time      `json:"clickedAt,omitempty"`
+	BouncedAt      *time.Time      `json:"bouncedAt,omitempty"`
+	UnsubscribedAt *time.Time      `json:"unsubscribedAt,omitempty"`
+}
+
+// CampaignRecipientsQuery selects the delivery report of every email of a campaign, one row
+// per email, optionally narrowed to a status
+func CampaignRecipientsQuery(campaignID string, status RecipientStatus, db *gorm.DB) *gorm.DB {
+	recipients := db.Table("emails").
+		Select(`emails.id AS email_id,
+			COALESCE(emails.contact_id::text, '') AS contact_id,
+			emails."to" AS email,
+			COALESCE(contacts.first_name, '') AS first_name,
+			COALESCE(contacts.last_name, '') AS last_name,
+			COALESCE(emails.variant_id::text, '') AS variant_id,
+			`+recipientStatusSQL+` AS status,
+			COALESCE(emails.error, '') AS error,
+			CASE WHEN emails.sent_at > '0001-01-02' THEN emails.sent_at END AS sent_at,
+			COUNT(t.id) FILTER (WHERE t.event = 'open') AS opens,
+			COUNT(t.id) FILTER (WHERE t.event = 'click') AS clicks,
+			MIN(t.timestamp) FILTER (WHERE t.event = 'open') AS opened_at,
+			MIN(t.timestamp) FILTER (WHERE t.event = 'click') AS clicked_at,
+			MIN(t.timestamp) FILTER (WHERE t.event = 'bounce') AS bounced_at,
+			MIN(t.timestamp) FILTER (WHERE t.event = 'unsubscribe') AS unsubscribed_at`).
+		Joins("LEFT JOIN contacts ON contacts.id = emails.contact_id").
+		Joins("LEFT JOIN email_trackings t ON t.email_id = emails.id AND t.automated = false AND t.recipient = '' AND t.is_deleted = false").
+		Where("emails.campaign_id = ? AND emails.is_deleted = false", campaignID).
+		Group("emails.id, contacts.first_name, contacts.last_name")
+
+	query := db.Table("(?) AS recipients", recipients)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	return query
+}
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	DefaultReportShareTTL = 30 * 24 * time.Hour
+	MaxReportShareTTL     = 365 * 24 * time.Hour
+)
+
+// ReportShare is a read-only link to a campaign's report for people without an account. Only
+// the hash of the link's token is kept, so the link can't be rebuilt from the database.
+type ReportShare struct {
+	Base
+	TeamID          string     `gorm:"type:uuid;not null;index" json:"teamId"`
+	CampaignID      string     `gorm:"type:uuid;not null;index" json:"campaignId"`
+	TokenHash       string     `gorm:"not null;uniqueIndex" json:"-"`
+	ExcludeBots     bool       `gorm:"not null;default:false" json:"excludeBots"` // leave out opens and clicks bots fetched
+	ExpiresAt       time.Time  `gorm:"not null;index" json:"expiresAt"`
+	CreatedByUserID string     `gorm:"type:uuid;default:NULL" json:"createdByUserId,omitempty"`
+	ViewCount       int64      `gorm:"not null;default:0" json:"viewCount"`
+	LastViewedAt    *time.Time `json:"lastViewedAt,omitempty"`
+}
+
+// HashReportShareToken hashes a share link's token the way it is stored
+func HashReportShareToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// GetActiveReportShare returns the share behind a link's token, unless it was revoked or expired
+func GetActiveReportShare(token string, db *gorm.DB) (*ReportShare, error) {
+	var share ReportShare
+	if err := db.Where("token_hash = ? AND is_deleted = false AND expires_at > ?", HashReportShareToken(token), time.Now()).
+		First(&share).Error; err != nil {
+		return nil, err
+	}
+	return &share, nil
+}
+
+// RecordReportShareView counts a view of a shared report
+func RecordReportShareView(id string, db *gorm.DB) error {
+	return db.Model(&ReportShare{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"view_count":     gorm.Expr("view_count + 1"),
+		"last_viewed_at": time.Now(),
+	}).Error
+}
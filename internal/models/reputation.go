@@ -0,0 +1,237 @@
+package models
+
+import (
+	"fmt"
+	"kori/internal/utils/crypto"
+	"sort"
+	"time"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ReputationProvider is the mailbox provider a reputation connector pulls data from
+type ReputationProvider string
+
+const (
+	// ReputationProviderGooglePostmaster reads Google Postmaster Tools, connected with OAuth2
+	ReputationProviderGooglePostmaster ReputationProvider = "GOOGLE_POSTMASTER"
+	// ReputationProviderMicrosoftSNDS reads Microsoft SNDS with the team's data access key
+	ReputationProviderMicrosoftSNDS ReputationProvider = "MICROSOFT_SNDS"
+)
+
+// ReputationSpamRateThreshold is the user reported spam rate Gmail starts filtering senders at
+const ReputationSpamRateThreshold = 0.003
+
+// reputationRanks orders Postmaster domain reputations and SNDS filter results from worst to best
+var reputationRanks = map[string]int{
+	"BAD": 1, "LOW": 2, "MEDIUM": 3, "HIGH": 4,
+	"RED": 1, "YELLOW": 2, "GREEN": 4,
+}
+
+// ReputationConnector pulls a team's sender reputation from Google Postmaster Tools or
+// Microsoft SNDS on a schedule
+type ReputationConnector struct {
+	Base
+	Name          string             `gorm:"not null" json:"name" validate:"required,min=2"`
+	Provider      ReputationProvider `gorm:"not null" json:"provider" validate:"required,oneof=GOOGLE_POSTMASTER MICROSOFT_SNDS"`
+	SNDSKey       string             `json:"sndsKey,omitempty" validate:"required_if=Provider MICROSOFT_SNDS" audit:"redact"` // SNDS automated data access key
+	IsActive      bool               `gorm:"not null;default:true" json:"isActive"`
+	LastSyncedAt  time.Time          `gorm:"default:NULL" json:"lastSyncedAt"`
+	LastSyncError string             `json:"lastSyncError,omitempty"`
+	TeamID        string             `gorm:"type:uuid;not null;index" json:"teamId" validate:"required,uuid"`
+	Team          *Team              `json:"team,omitempty"`
+	// Postmaster Tools access, connected with OAuth2
+	OAuthCredentials
+}
+
+func (r *ReputationConnector) BeforeCreate(tx *gorm.DB) error {
+	if err := r.Base.BeforeCreate(tx); err != nil {
+		return err
+	}
+	return r.encrypt()
+}
+
+func (r *ReputationConnector) BeforeUpdate(tx *gorm.DB) error {
+	return r.encrypt()
+}
+
+func (r *ReputationConnector) AfterFind(tx *gorm.DB) error {
+	if r.SNDSKey != "" {
+		key, err := crypto.Decrypt(r.SNDSKey)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt snds key: %w", err)
+		}
+		r.SNDSKey = key
+	}
+	return r.OAuthCredentials.decrypt()
+}
+
+func (r *ReputationConnector) encrypt() error {
+	if r.SNDSKey != "" {
+		key, err := crypto.Encrypt(r.SNDSKey)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt snds key: %w", err)
+		}
+		r.SNDSKey = key
+	}
+	return r.OAuthCredentials.encrypt()
+}
+
+// ReputationMetric is a day of a domain's reputation at Gmail or of a sending IP's at Outlook
+type ReputationMetric struct {
+	Base
+	ConnectorID       string               `gorm:"type:uuid;not null;uniqueIndex:idx_reputation_metric_day" json:"connectorId"`
+	Connector         *ReputationConnector `json:"connector,omitempty"`
+	Provider          ReputationProvider   `gorm:"not null" json:"provider"`
+	Date              time.Time            `gorm:"type:date;not null;uniqueIndex:idx_reputation_metric_day" json:"date"`
+	Domain            string               `gorm:"not null;default:'';uniqueIndex:idx_reputation_metric_day" json:"domain,omitempty"`
+	IP                string               `gorm:"not null;default:'';uniqueIndex:idx_reputation_metric_day" json:"ip,omitempty"`
+	Reputation        string               `json:"reputation"` // HIGH, MEDIUM, LOW or BAD at Gmail; GREEN, YELLOW or RED at Outlook
+	SpamRate          float64              `gorm:"not null;default:0" json:"spamRate"`
+	DeliveryErrorRate float64              `gorm:"not null;default:0" json:"deliveryErrorRate"`
+	DeliveryErrors    datatypes.JSON       `gorm:"type:jsonb;default:'[]'" json:"deliveryErrors"`
+	SPFSuccessRate    float64              `gorm:"not null;default:0" json:"spfSuccessRate"`
+	DKIMSuccessRate   float64              `gorm:"not null;default:0" json:"dkimSuccessRate"`
+	DMARCSuccessRate  float64              `gorm:"not null;default:0" json:"dmarcSuccessRate"`
+	Messages          int                  `gorm:"not null;default:0" json:"messages"`
+	TrapHits          int                  `gorm:"not null;default:0" json:"trapHits"`
+	AlertedAt         *time.Time           `gorm:"default:NULL" json:"alertedAt,omitempty"` // when this day's drop was announced
+	TeamID            string               `gorm:"type:uuid;not null;index" json:"teamId"`
+}
+
+// Source is the domain or IP the metric is about
+func (m *ReputationMetric) Source() string {
+	if m.Domain != "" {
+		return m.Domain
+	}
+	return m.IP
+}
+
+// ReputationDeliveryError is a class of delivery errors Gmail reported for a day
+type ReputationDeliveryError struct {
+	Class string  `json:"class"`
+	Type  string  `json:"type"`
+	Rate  float64 `json:"rate"`
+}
+
+// SaveReputationMetrics stores a connector's metrics, replacing the days already stored, as
+// providers revise their figures for a few days. Days already alerted on keep that mark.
+func SaveReputationMetrics(metrics []ReputationMetric, db *gorm.DB) error {
+	if len(metrics) == 0 {
+		return nil
+	}
+	return db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "connector_id"}, {Name: "date"}, {Name: "domain"}, {Name: "ip"}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"reputation", "spam_rate", "delivery_error_rate", "delivery_errors", "spf_success_rate",
+			"dkim_success_rate", "dmarc_success_rate", "messages", "trap_hits", "updated_at",
+		}),
+	}).CreateInBatches(metrics, 500).Error
+}
+
+// ReputationTrend is how a domain's or IP's reputation moved over the days looked at
+type ReputationTrend string
+
+const (
+	ReputationTrendImproving ReputationTrend = "improving"
+	ReputationTrendDeclining ReputationTrend = "declining"
+	ReputationTrendSteady    ReputationTrend = "steady"
+)
+
+// ReputationSeries is the daily reputation of one domain or IP at one provider
+type ReputationSeries struct {
+	Provider ReputationProvider `json:"provider"`
+	Source   string             `json:"source"`
+	Latest   *ReputationMetric  `json:"latest"`
+	Trend    ReputationTrend    `json:"trend"`
+	Days     []ReputationMetric `json:"days"`
+}
+
+// GetReputationSeries returns the team's reputation metrics of the last days, one series per
+// provider and domain or IP, oldest day first
+func GetReputationSeries(teamID string, days int, db *gorm.DB) ([]ReputationSeries, error) {
+	var metrics []ReputationMetric
+	if err := db.Where("team_id = ? AND date >= ? AND is_deleted = false", teamID, time.Now().AddDate(0, 0, -days)).
+		Order("date ASC").Find(&metrics).Error; err != nil {
+		return nil, fmt.Errorf("failed to get reputation metrics: %w", err)
+	}
+
+	index := make(map[string]int)
+	var series []ReputationSeries
+	for _, metric := range metrics {
+		key := string(metric.Provider) + "|" + metric.Source()
+		i, ok := index[key]
+		if !ok {
+			i = len(series)
+			index[key] = i
+			series = append(series, ReputationSeries{Provider: metric.Provider, Source: metric.Source()})
+		}
+		series[i].Days = append(series[i].Days, metric)
+	}
+
+	for i := range series {
+		s := &series[i]
+		s.Latest = &s.Days[len(s.Days)-1]
+		s.Trend = reputationTrend(&s.Days[0], s.Latest)
+	}
+	sort.Slice(series, func(i, j int) bool {
+		if series[i].Provider != series[j].Provider {
+			return series[i].Provider < series[j].Provider
+		}
+		return series[i].Source < series[j].Source
+	})
+	return series, nil
+}
+
+// reputationTrend compares the latest day to the first: by reputation when it changed, by spam
+// rate otherwise
+func reputationTrend(first, latest *ReputationMetric) ReputationTrend {
+	from, to := reputationRanks[first.Reputation], reputationRanks[latest.Reputation]
+	switch {
+	case from > 0 && to > 0 && to < from:
+		return ReputationTrendDeclining
+	case from > 0 && to > 0 && to > from:
+		return ReputationTrendImproving
+	case latest.SpamRate > first.SpamRate*1.5 && latest.SpamRate >= ReputationSpamRateThreshold/3:
+		return ReputationTrendDeclining
+	case latest.SpamRate < first.SpamRate/1.5:
+		return ReputationTrendImproving
+	}
+	return ReputationTrendSteady
+}
+
+// ReputationDrop reports why a day's metric is worth alerting on compared to the day before
+// it, or "" when it isn't: a worse reputation, a spam rate crossing Gmail's threshold, or an
+// IP Outlook filters
+func ReputationDrop(previous, metric *ReputationMetric) string {
+	rank := reputationRanks[metric.Reputation]
+	if previous != nil {
+		if before := reputationRanks[previous.Reputation]; before > 0 && rank > 0 && rank < before {
+			return fmt.Sprintf("reputation dropped from %s to %s", previous.Reputation, metric.Reputation)
+		}
+		if metric.SpamRate >= ReputationSpamRateThreshold && previous.SpamRate < ReputationSpamRateThreshold {
+			return fmt.Sprintf("spam rate rose to %.2f%%", metric.SpamRate*100)
+		}
+		return ""
+	}
+	switch {
+	case rank == 1:
+		return fmt.Sprintf("reputation is %s", metric.Reputation)
+	case metric.SpamRate >= ReputationSpamRateThreshold:
+		return fmt.Sprintf("spam rate is %.2f%%", metric.SpamRate*100)
+	}
+	return ""
+}
+
+// ReputationAlert announces a drop in a domain's or IP's reputation to the team's admins
+type ReputationAlert struct {
+	TeamID    string             `json:"teamId"`
+	Connector string             `json:"connector"`
+	Provider  ReputationProvider `json:"provider"`
+	Source    string             `json:"source"`
+	Date      time.Time          `json:"date"`
+	Reason    string             `json:"reason"`
+	Metric    *ReputationMetric  `json:"metric"`
+}
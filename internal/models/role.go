@@ -0,0 +1,165 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+)
+
+// Actions a permission grants on a resource. Write stands for create, update and delete.
+const (
+	PermissionActionCreate = "create"
+	PermissionActionRead   = "read"
+	PermissionActionUpdate = "update"
+	PermissionActionDelete = "delete"
+	PermissionActionWrite  = "write"
+	PermissionWildcard     = "*"
+)
+
+var (
+	// ErrRoleNotFound is returned for roles the team doesn't have
+	ErrRoleNotFound = errors.New("role not found")
+	// ErrRoleNameTaken is returned for role names the team already uses
+	ErrRoleNameTaken = errors.New("the team already has a role with this name")
+)
+
+// Role is a set of permissions a team defines, like "Campaign Manager" or "Analyst", and
+// assigns to its members in place of the permissions of their built-in role. Each permission
+// is resource:action, where either side can be * and write covers create, update and delete.
+type Role struct {
+	Base
+	Name        string         `gorm:"not null" json:"name"`
+	Description string         `json:"description,omitempty"`
+	Permissions pq.StringArray `gorm:"type:text[];not null" json:"permissions"`
+	TeamID      string         `gorm:"type:uuid;not null;index" json:"teamId"`
+	Team        *Team          `json:"team,omitempty"`
+	Users       []User         `gorm:"foreignKey:RoleID" json:"users,omitempty"`
+}
+
+// PermissionResources returns the resources permissions can be granted on, each with its
+// actions
+func PermissionResources() map[string][]string {
+	resources := map[string][]string{}
+	for _, resource := range defaultResources {
+		resources[resource.Name] = append(resources[resource.Name], resource.Action)
+	}
+	return resources
+}
+
+// BuiltInRolePermissions returns the default permissions of a built-in role, a starting point
+// for custom roles
+func BuiltInRolePermissions(role UserRole) []string {
+	return slices.Clone(rolePermissions[role])
+}
+
+// NormalizeRolePermissions checks a role's permissions name known resources and actions, and
+// returns them lowercased, sorted and without duplicates
+func NormalizeRolePermissions(permissions []string) ([]string, error) {
+	resources := PermissionResources()
+	normalized := make([]string, 0, len(permissions))
+	for _, permission := range permissions {
+		permission = strings.ToLower(strings.TrimSpace(permission))
+		resource, action, ok := strings.Cut(permission, ":")
+		if !ok {
+			return nil, fmt.Errorf("permission %q must be resource:action", permission)
+		}
+		actions, known := resources[resource]
+		if resource != PermissionWildcard && !known {
+			return nil, fmt.Errorf("unknown resource %q", resource)
+		}
+		switch {
+		case action == PermissionWildcard, action == PermissionActionWrite:
+		case resource == PermissionWildcard && slices.Contains([]string{PermissionActionCreate, PermissionActionRead, PermissionActionUpdate, PermissionActionDelete}, action):
+		case slices.Contains(actions, action):
+		default:
+			return nil, fmt.Errorf("unknown action %q for %s", action, resource)
+		}
+		normalized = append(normalized, permission)
+	}
+	slices.Sort(normalized)
+	return slices.Compact(normalized), nil
+}
+
+// HasPermission reports whether a set of permissions grants an action on a resource. Write
+// grants create, update and delete, and * any resource or action.
+func HasPermission(granted []string, resource, action string) bool {
+	for _, permission := range granted {
+		grantedResource, grantedAction, ok := strings.Cut(permission, ":")
+		if !ok || (grantedResource != PermissionWildcard && grantedResource != resource) {
+			continue
+		}
+		switch {
+		case grantedAction == PermissionWildcard, grantedAction == action:
+			return true
+		case grantedAction == PermissionActionWrite:
+			if action == PermissionActionCreate || action == PermissionActionUpdate || action == PermissionActionDelete {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// GetUserPermissions returns what a user is allowed: everything for admins, their custom role's
+// permissions when they have one, else the defaults of their built-in role
+func GetUserPermissions(user *User, db *gorm.DB) ([]string, error) {
+	if user.Role == UserRoleAdmin || user.Role == UserRoleSuperAdmin {
+		return []string{"*:*"}, nil
+	}
+	if user.RoleID != "" {
+		role, err := GetRole(user.TeamID, user.RoleID, db)
+		if err == nil {
+			return role.Permissions, nil
+		}
+		if !errors.Is(err, ErrRoleNotFound) {
+			return nil, err
+		}
+	}
+	return rolePermissions[user.Role], nil
+}
+
+// GetRole returns one of the team's roles
+func GetRole(teamID, id string, db *gorm.DB) (*Role, error) {
+	role := &Role{}
+	if err := db.Where("id = ? AND team_id = ? AND is_deleted = false", id, teamID).First(role).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrRoleNotFound
+		}
+		return nil, err
+	}
+	return role, nil
+}
+
+// SaveRole creates or updates a role, keeping its name unique within the team
+func SaveRole(role *Role, db *gorm.DB) error {
+	query := db.Model(&Role{}).Where("team_id = ? AND LOWER(name) = ? AND is_deleted = false", role.TeamID, strings.ToLower(role.Name))
+	if role.ID != "" {
+		query = query.Where("id <> ?", role.ID)
+	}
+	var count int64
+	if err := query.Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrRoleNameTaken
+	}
+	if role.ID == "" {
+		return db.Create(role).Error
+	}
+	return db.Model(role).Select("name", "description", "permissions").Updates(role).Error
+}
+
+// DeleteRole removes a role; its members go back to the permissions of their built-in role
+func DeleteRole(role *Role, db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&User{}).Where("role_id = ?", role.ID).UpdateColumn("role_id", nil).Error; err != nil {
+			return err
+		}
+		return tx.Model(role).UpdateColumns(map[string]interface{}{"is_deleted": true, "deleted_at": time.Now()}).Error
+	})
+}
@@ -0,0 +1,300 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ErrSampleDataExists is returned when a team populates sample data it already has
+var ErrSampleDataExists = errors.New("team already has sample data")
+
+// sampleContactCount is how many fake contacts the sample mailing list gets
+const sampleContactCount = 50
+
+// SampleTemplate is a template created for sample data
+type SampleTemplate struct {
+	Name    string
+	Subject string
+	HTML    string
+}
+
+// SampleTemplates are the templates sample data comes with. The first one is sent by the
+// sample campaign.
+var SampleTemplates = []SampleTemplate{
+	{
+		Name:    "Sample: Monthly newsletter",
+		Subject: "What's new this month, {{ first_name }}",
+		HTML: `<html><body>
+<h1>Hey {{ first_name }} 👋🏻</h1>
+<p>Here's what we shipped this month.</p>
+<p><a href="https://example.com/changelog">Read the changelog</a> or <a href="https://example.com/blog">catch up on the blog</a>.</p>
+</body></html>`,
+	},
+	{
+		Name:    "Sample: Welcome",
+		Subject: "Welcome aboard, {{ first_name }}!",
+		HTML: `<html><body>
+<h1>Welcome, {{ first_name }}!</h1>
+<p>Thanks for signing up. <a href="https://example.com/getting-started">Get started here</a>.</p>
+</body></html>`,
+	},
+}
+
+var (
+	sampleFirstNames = []string{"Ada", "Grace", "Alan", "Linus", "Margaret", "Dennis", "Barbara", "Ken", "Frances", "Tim"}
+	sampleLastNames  = []string{"Lovelace", "Hopper", "Turing", "Torvalds", "Hamilton", "Ritchie", "Liskov", "Thompson", "Allen", "Berners-Lee"}
+	sampleCountries  = []struct{ Country, City string }{
+		{"United States", "New York"}, {"United Kingdom", "London"}, {"Germany", "Berlin"},
+		{"India", "Bengaluru"}, {"Brazil", "São Paulo"}, {"Japan", "Tokyo"},
+	}
+	sampleDevices = []struct{ DeviceType, Browser, OS string }{
+		{"desktop", "Chrome", "macOS"}, {"desktop", "Firefox", "Windows"}, {"mobile", "Safari", "iOS"},
+		{"mobile", "Chrome", "Android"}, {"tablet", "Safari", "iPadOS"},
+	}
+	sampleLinks = []string{"https://example.com/changelog", "https://example.com/blog"}
+)
+
+// SampleData is what populating a team with sample data created
+type SampleData struct {
+	ListID      string   `json:"listId"`
+	TemplateIDs []string `json:"templateIds"`
+	CampaignID  string   `json:"campaignId"`
+	Contacts    int      `json:"contacts"`
+	Emails      int      `json:"emails"`
+	Events      int      `json:"events"`
+}
+
+// HasSampleData reports whether the team has populated sample data it hasn't removed
+func HasSampleData(teamID string, db *gorm.DB) (bool, error) {
+	return hasRows(db.Model(&MailingList{}).Where("team_id = ? AND is_sample = true AND is_deleted = false", teamID))
+}
+
+// CreateSampleData creates a demo mailing list of fake contacts, the sample templates and a
+// completed campaign sent to the list with synthetic opens and clicks. htmlFiles holds the
+// uploaded html of each sample template, nil where it couldn't be stored. Every row is flagged
+// IsSample so DeleteSampleData can remove them. Hooks are skipped so nothing is sent or scheduled.
+func CreateSampleData(teamID string, htmlFiles []*File, db *gorm.DB) (*SampleData, error) {
+	exists, err := HasSampleData(teamID, db)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, ErrSampleDataExists
+	}
+
+	// Sample emails name the team's default SMTP config, if it has one, so the analytics join up
+	smtpConfigID, from := uuid.Nil.String(), "demo@example.com"
+	if smtpConfig, err := GetSMTPConfig(teamID, "", "", db); err == nil {
+		smtpConfigID, from = smtpConfig.ID, smtpConfig.FromEmail
+	}
+
+	data := &SampleData{}
+	random := rand.New(rand.NewSource(time.Now().UnixNano()))
+	sentAt := time.Now().Add(-72 * time.Hour)
+
+	err = db.Session(&gorm.Session{SkipHooks: true}).Transaction(func(tx *gorm.DB) error {
+		category := &EmailCategory{Name: "Sample data", TeamID: teamID, IsSample: true}
+		category.ID = uuid.New().String()
+		if err := tx.Create(category).Error; err != nil {
+			return err
+		}
+
+		list := &MailingList{
+			Name:        "Sample: Demo subscribers",
+			Description: "Fake contacts to explore Posthoot with. Remove them with the sample data endpoint.",
+			TeamID:      teamID,
+			IsSample:    true,
+		}
+		list.ID = uuid.New().String()
+		if err := tx.Create(list).Error; err != nil {
+			return err
+		}
+		data.ListID = list.ID
+
+		templates := make([]*Template, len(SampleTemplates))
+		for i, sample := range SampleTemplates {
+			templates[i] = &Template{
+				Name:       sample.Name,
+				Subject:    sample.Subject,
+				TeamID:     teamID,
+				CategoryID: category.ID,
+				Variables:  []string{"first_name"},
+				IsSample:   true,
+			}
+			templates[i].ID = uuid.New().String()
+			create := tx
+			if i < len(htmlFiles) && htmlFiles[i] != nil {
+				htmlFiles[i].ID = uuid.New().String()
+				if err := tx.Create(htmlFiles[i]).Error; err != nil {
+					return err
+				}
+				templates[i].HtmlFileID = htmlFiles[i].ID
+			} else {
+				create = tx.Omit("HtmlFileID")
+			}
+			if err := create.Create(templates[i]).Error; err != nil {
+				return err
+			}
+			data.TemplateIDs = append(data.TemplateIDs, templates[i].ID)
+		}
+
+		contacts := make([]Contact, sampleContactCount)
+		for i := range contacts {
+			first := sampleFirstNames[random.Intn(len(sampleFirstNames))]
+			last := sampleLastNames[random.Intn(len(sampleLastNames))]
+			location := sampleCountries[random.Intn(len(sampleCountries))]
+			contacts[i] = Contact{
+				// example.com is reserved, so these addresses can never receive mail
+				Email:     fmt.Sprintf("%s.%s.%d@example.com", first, last, i+1),
+				FirstName: first,
+				LastName:  last,
+				Country:   location.Country,
+				City:      location.City,
+				ListID:    list.ID,
+				TeamID:    teamID,
+				Status:    SubscriberStatusActive,
+				IsSample:  true,
+			}
+			contacts[i].ID = uuid.New().String()
+		}
+
+		campaign := &Campaign{
+			Name:         "Sample: Monthly newsletter",
+			Description:  "A campaign sent to the demo subscribers with made up opens and clicks.",
+			TemplateID:   templates[0].ID,
+			TeamID:       teamID,
+			Status:       CampaignStatusCompleted,
+			Schedule:     CampaignScheduleOneTime,
+			ScheduledFor: sentAt,
+			ListID:       list.ID,
+			SMTPConfigID: smtpConfigID,
+			Processed:    len(contacts),
+			IsSample:     true,
+		}
+		campaign.ID = uuid.New().String()
+		if err := tx.Create(campaign).Error; err != nil {
+			return err
+		}
+		data.CampaignID = campaign.ID
+
+		var emails []Email
+		var events []EmailTracking
+		for i := range contacts {
+			contact := &contacts[i]
+			email := Email{
+				From:         from,
+				To:           contact.Email,
+				Subject:      fmt.Sprintf("What's new this month, %s", contact.FirstName),
+				Body:         "Sample email",
+				Status:       EmailStatusSent,
+				TemplateID:   templates[0].ID,
+				TeamID:       teamID,
+				ContactID:    contact.ID,
+				SMTPConfigID: smtpConfigID,
+				SentAt:       sentAt,
+				SendAt:       sentAt,
+				CategoryID:   category.ID,
+				CampaignID:   campaign.ID,
+				IsSample:     true,
+			}
+			email.ID = uuid.New().String()
+
+			device := sampleDevices[random.Intn(len(sampleDevices))]
+			track := func(event EmailTrackingEvent, at time.Time, url string) {
+				tracking := EmailTracking{
+					EmailID:    email.ID,
+					CampaignID: campaign.ID,
+					ContactID:  contact.ID,
+					Event:      event,
+					Timestamp:  at,
+					Country:    contact.Country,
+					City:       contact.City,
+					DeviceType: device.DeviceType,
+					Browser:    device.Browser,
+					OS:         device.OS,
+					URL:        url,
+				}
+				tracking.ID = uuid.New().String()
+				events = append(events, tracking)
+			}
+
+			// Roughly 4% bounce, 45% open and a quarter of those who open click
+			switch roll := random.Intn(100); {
+			case roll < 4:
+				email.Status = EmailStatusBounced
+				contact.Status = SubscriberStatusBounced
+				track(EmailTrackingEventBounce, sentAt.Add(time.Minute), "")
+			case roll < 49:
+				email.Status = EmailStatusOpened
+				openedAt := sentAt.Add(time.Duration(random.Intn(48*60)) * time.Minute)
+				track(EmailTrackingEventOpen, openedAt, "")
+				if random.Intn(4) == 0 {
+					email.Status = EmailStatusClicked
+					track(EmailTrackingEventClick, openedAt.Add(time.Duration(1+random.Intn(10))*time.Minute), sampleLinks[random.Intn(len(sampleLinks))])
+				}
+			}
+			emails = append(emails, email)
+		}
+
+		if err := tx.CreateInBatches(contacts, 100).Error; err != nil {
+			return err
+		}
+		if err := tx.CreateInBatches(emails, 100).Error; err != nil {
+			return err
+		}
+		if len(events) > 0 {
+			if err := tx.CreateInBatches(events, 100).Error; err != nil {
+				return err
+			}
+		}
+		data.Contacts, data.Emails, data.Events = len(contacts), len(emails), len(events)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// sampleDataTables lists the rows DeleteSampleData removes, children before their parents
+var sampleDataTables = []teamTable{
+	{name: "email_trackings", where: "email_id IN (SELECT id FROM emails WHERE team_id = @team AND is_sample = true)"},
+	{name: "emails", where: "team_id = @team AND is_sample = true"},
+	{name: "analytics_reports", where: "campaign_id IN (SELECT id FROM campaigns WHERE team_id = @team AND is_sample = true)"},
+	{name: "campaigns", where: "team_id = @team AND is_sample = true"},
+	{name: "contacts", where: "team_id = @team AND is_sample = true"},
+	{name: "files", where: "team_id = @team AND id IN (SELECT html_file_id FROM templates WHERE team_id = @team AND is_sample = true)"},
+	{name: "templates", where: "team_id = @team AND is_sample = true"},
+	{name: "email_categories", where: "team_id = @team AND is_sample = true"},
+	{name: "mailing_lists", where: "team_id = @team AND is_sample = true"},
+}
+
+// DeleteSampleData hard deletes the team's sample data and returns the storage paths of the
+// sample template html files, which the caller removes from storage
+func DeleteSampleData(teamID string, db *gorm.DB) ([]string, error) {
+	var paths []string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&File{}).
+			Where("team_id = ? AND id IN (?)", teamID, tx.Model(&Template{}).Select("html_file_id").Where("team_id = ? AND is_sample = true", teamID)).
+			Pluck("path", &paths).Error; err != nil {
+			return err
+		}
+		for _, table := range sampleDataTables {
+			if err := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE %s", table.name, table.where), sql.Named("team", teamID)).Error; err != nil {
+				return fmt.Errorf("failed to delete sample %s: %w", table.name, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return paths, nil
+}
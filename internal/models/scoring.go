@@ -0,0 +1,168 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// scoringFeatureWindow is how far back engagement features are computed
+const scoringFeatureWindow = 90 * 24 * time.Hour
+
+// ScoringEndpoint is a team's own contact scoring service. Before a campaign is sent the
+// audience is posted to it in batches and the scores returned decide who is excluded and
+// who is mailed first.
+type ScoringEndpoint struct {
+	Base
+	Name           string    `gorm:"not null" json:"name" validate:"required,min=2"`
+	URL            string    `gorm:"not null" json:"url" validate:"required,url"`
+	Secret         string    `json:"secret" validate:"required,min=16"`
+	IsActive       bool      `gorm:"not null;default:true" json:"isActive"`
+	TimeoutSeconds int       `gorm:"not null;default:10" json:"timeoutSeconds" validate:"omitempty,min=1,max=60"`
+	BatchSize      int       `gorm:"not null;default:500" json:"batchSize" validate:"omitempty,min=1,max=5000"`
+	FailOpen       bool      `gorm:"not null;default:true" json:"failOpen"` // send to everyone when the endpoint fails
+	LastCalledAt   time.Time `gorm:"default:NULL" json:"lastCalledAt"`
+	LastError      string    `json:"lastError"`
+	TeamID         string    `gorm:"type:uuid;not null;uniqueIndex" json:"teamId" validate:"required,uuid"`
+	Team           *Team     `json:"team,omitempty"`
+}
+
+// ContactFeatures is what the scoring endpoint receives for each contact
+type ContactFeatures struct {
+	ID          string           `json:"id"`
+	Email       string           `json:"email"`
+	FirstName   string           `json:"firstName,omitempty"`
+	LastName    string           `json:"lastName,omitempty"`
+	Company     string           `json:"company,omitempty"`
+	Country     string           `json:"country,omitempty"`
+	City        string           `json:"city,omitempty"`
+	State       string           `json:"state,omitempty"`
+	Status      SubscriberStatus `json:"status"`
+	Tags        []string         `json:"tags"`
+	Metadata    datatypes.JSON   `json:"metadata,omitempty"`
+	CreatedAt   time.Time        `json:"createdAt"`
+	Score       int              `json:"score"` // lead score from the team's own rules
+	Sent90d     int64            `json:"sent90d"`
+	Opens90d    int64            `json:"opens90d"`
+	Clicks90d   int64            `json:"clicks90d"`
+	LastOpenAt  *time.Time       `json:"lastOpenAt,omitempty"`
+	LastClickAt *time.Time       `json:"lastClickAt,omitempty"`
+}
+
+// ContactScore is the endpoint's verdict on a contact. Higher priority contacts are mailed first.
+type ContactScore struct {
+	ID       string  `json:"id"`
+	Exclude  bool    `json:"exclude"`
+	Priority float64 `json:"priority"`
+}
+
+// GetScoringEndpoint returns the team's active scoring endpoint, or nil when there is none
+func GetScoringEndpoint(teamID string, db *gorm.DB) (*ScoringEndpoint, error) {
+	var endpoints []ScoringEndpoint
+	if err := db.Where("team_id = ? AND is_active = true AND is_deleted = false", teamID).Limit(1).Find(&endpoints).Error; err != nil {
+		return nil, err
+	}
+	if len(endpoints) == 0 {
+		return nil, nil
+	}
+	return &endpoints[0], nil
+}
+
+// GetContactFeatures builds the scoring features of contacts, including their recent engagement
+func GetContactFeatures(contacts []Contact, db *gorm.DB) ([]ContactFeatures, error) {
+	features := make([]ContactFeatures, len(contacts))
+	index := make(map[string]*ContactFeatures, len(contacts))
+	ids := make([]string, len(contacts))
+	for i, contact := range contacts {
+		features[i] = ContactFeatures{
+			ID:        contact.ID,
+			Email:     contact.Email,
+			FirstName: contact.FirstName,
+			LastName:  contact.LastName,
+			Company:   contact.Company,
+			Country:   contact.Country,
+			City:      contact.City,
+			State:     contact.State,
+			Status:    contact.Status,
+			Tags:      []string{},
+			Metadata:  contact.Metadata,
+			CreatedAt: contact.CreatedAt,
+			Score:     contact.Score,
+		}
+		index[contact.ID] = &features[i]
+		ids[i] = contact.ID
+	}
+	if len(ids) == 0 {
+		return features, nil
+	}
+
+	since := time.Now().Add(-scoringFeatureWindow)
+
+	var sent []struct {
+		ContactID string
+		Count     int64
+	}
+	if err := db.Model(&Email{}).
+		Select("contact_id, COUNT(*) AS count").
+		Where("contact_id IN ? AND sent_at >= ? AND is_deleted = false", ids, since).
+		Group("contact_id").
+		Scan(&sent).Error; err != nil {
+		return nil, fmt.Errorf("failed to count sent emails: %w", err)
+	}
+	for _, row := range sent {
+		if f, ok := index[row.ContactID]; ok {
+			f.Sent90d = row.Count
+		}
+	}
+
+	var engagement []struct {
+		ContactID string
+		Event     EmailTrackingEvent
+		Count     int64
+		Last      time.Time
+	}
+	if err := db.Model(&EmailTracking{}).
+		Select("contact_id, event, COUNT(DISTINCT email_id) AS count, MAX(timestamp) AS last").
+		Where("contact_id IN ? AND event IN ? AND timestamp >= ? AND automated = false AND is_deleted = false", ids,
+			[]EmailTrackingEvent{EmailTrackingEventOpen, EmailTrackingEventClick}, since).
+		Group("contact_id, event").
+		Scan(&engagement).Error; err != nil {
+		return nil, fmt.Errorf("failed to count engagement: %w", err)
+	}
+	for _, row := range engagement {
+		f, ok := index[row.ContactID]
+		if !ok {
+			continue
+		}
+		last := row.Last
+		switch row.Event {
+		case EmailTrackingEventOpen:
+			f.Opens90d = row.Count
+			f.LastOpenAt = &last
+		case EmailTrackingEventClick:
+			f.Clicks90d = row.Count
+			f.LastClickAt = &last
+		}
+	}
+
+	var tags []struct {
+		ContactID string
+		Name      string
+	}
+	if err := db.Table("contact_tags").
+		Select("contact_tags.contact_id, tags.name").
+		Joins("JOIN tags ON tags.id = contact_tags.tag_id").
+		Where("contact_tags.contact_id IN ?", ids).
+		Scan(&tags).Error; err != nil {
+		return nil, fmt.Errorf("failed to get contact tags: %w", err)
+	}
+	for _, row := range tags {
+		if f, ok := index[row.ContactID]; ok {
+			f.Tags = append(f.Tags, row.Name)
+		}
+	}
+
+	return features, nil
+}
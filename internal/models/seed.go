@@ -41,6 +41,66 @@ var defaultResources = []Resource{
 	{Name: "contacts", Action: "update"},
 	{Name: "contacts", Action: "delete"},
 
+	// Contact sync resources
+	{Name: "contact_syncs", Action: "create"},
+	{Name: "contact_syncs", Action: "read"},
+	{Name: "contact_syncs", Action: "update"},
+	{Name: "contact_syncs", Action: "delete"},
+
+	// Segment resources
+	{Name: "segments", Action: "create"},
+	{Name: "segments", Action: "read"},
+	{Name: "segments", Action: "update"},
+	{Name: "segments", Action: "delete"},
+
+	// Blackout date resources
+	{Name: "blackout_dates", Action: "create"},
+	{Name: "blackout_dates", Action: "read"},
+	{Name: "blackout_dates", Action: "update"},
+	{Name: "blackout_dates", Action: "delete"},
+	{Name: "alert_rules", Action: "create"},
+	{Name: "alert_rules", Action: "read"},
+	{Name: "alert_rules", Action: "update"},
+	{Name: "alert_rules", Action: "delete"},
+	{Name: "content_blocks", Action: "create"},
+	{Name: "content_blocks", Action: "read"},
+	{Name: "content_blocks", Action: "update"},
+	{Name: "content_blocks", Action: "delete"},
+	{Name: "scoring_endpoints", Action: "create"},
+	{Name: "scoring_endpoints", Action: "read"},
+	{Name: "scoring_endpoints", Action: "update"},
+	{Name: "scoring_endpoints", Action: "delete"},
+	{Name: "sender_personas", Action: "create"},
+	{Name: "sender_personas", Action: "read"},
+	{Name: "sender_personas", Action: "update"},
+	{Name: "sender_personas", Action: "delete"},
+	{Name: "frequency_caps", Action: "create"},
+	{Name: "frequency_caps", Action: "read"},
+	{Name: "frequency_caps", Action: "update"},
+	{Name: "frequency_caps", Action: "delete"},
+	{Name: "lead_scoring_rules", Action: "create"},
+	{Name: "lead_scoring_rules", Action: "read"},
+	{Name: "lead_scoring_rules", Action: "update"},
+	{Name: "lead_scoring_rules", Action: "delete"},
+	{Name: "computed_fields", Action: "create"},
+	{Name: "computed_fields", Action: "read"},
+	{Name: "computed_fields", Action: "update"},
+	{Name: "computed_fields", Action: "delete"},
+	{Name: "subscribe_forms", Action: "create"},
+	{Name: "subscribe_forms", Action: "read"},
+	{Name: "subscribe_forms", Action: "update"},
+	{Name: "subscribe_forms", Action: "delete"},
+	{Name: "reputation_connectors", Action: "create"},
+	{Name: "reputation_connectors", Action: "read"},
+	{Name: "reputation_connectors", Action: "update"},
+	{Name: "reputation_connectors", Action: "delete"},
+	{Name: "snippets", Action: "create"},
+	{Name: "snippets", Action: "read"},
+	{Name: "snippets", Action: "update"},
+	{Name: "snippets", Action: "delete"},
+	{Name: "onboarding", Action: "read"},
+	{Name: "onboarding", Action: "update"},
+
 	// Team resources
 	{Name: "teams", Action: "create"},
 	{Name: "teams", Action: "read"},
@@ -113,10 +173,20 @@ var defaultResources = []Resource{
 	// Email resources
 	{Name: "emails", Action: "create"},
 	{Name: "emails", Action: "read"},
+	{Name: "emails", Action: "send"},
 
 	// Analytics resources
 	{Name: "analytics", Action: "read"},
 
+	// Embed token resources
+	{Name: "embed_tokens", Action: "create"},
+	{Name: "embed_tokens", Action: "delete"},
+
+	// Report share resources
+	{Name: "report_shares", Action: "create"},
+	{Name: "report_shares", Action: "read"},
+	{Name: "report_shares", Action: "delete"},
+
 	// Team invite resources
 	{Name: "team_invites", Action: "create"},
 	{Name: "team_invites", Action: "read"},
@@ -141,6 +211,32 @@ var defaultResources = []Resource{
 	{Name: "team_settings", Action: "update"},
 	{Name: "team_settings", Action: "delete"},
 
+	// Signature resources
+	{Name: "signatures", Action: "create"},
+	{Name: "signatures", Action: "read"},
+	{Name: "signatures", Action: "update"},
+	{Name: "signatures", Action: "delete"},
+
+	// Audit log resources
+	{Name: "audit_logs", Action: "read"},
+
+	// SMS resources
+	{Name: "sms_configs", Action: "create"},
+	{Name: "sms_configs", Action: "read"},
+	{Name: "sms_configs", Action: "update"},
+	{Name: "sms_configs", Action: "delete"},
+	{Name: "sms_fallback_rules", Action: "create"},
+	{Name: "sms_fallback_rules", Action: "read"},
+	{Name: "sms_fallback_rules", Action: "update"},
+	{Name: "sms_fallback_rules", Action: "delete"},
+	{Name: "sms_messages", Action: "read"},
+
+	// Role resources
+	{Name: "roles", Action: "create"},
+	{Name: "roles", Action: "read"},
+	{Name: "roles", Action: "update"},
+	{Name: "roles", Action: "delete"},
+
 	// Branding settings resources
 	{Name: "branding_settings", Action: "create"},
 	{Name: "branding_settings", Action: "read"},
@@ -161,13 +257,35 @@ var rolePermissions = map[UserRole][]string{
 		"models:*",
 		"emails:*",
 		"analytics:*",
+		"embed_tokens:*",
+		"report_shares:*",
 		"api_key_usage:*",
 		"team_invites:*",
 		"contact_imports:*",
+		"contact_syncs:*",
+		"segments:*",
+		"blackout_dates:*",
+		"alert_rules:*",
+		"content_blocks:*",
+		"scoring_endpoints:*",
+		"sender_personas:*",
+		"frequency_caps:*",
+		"lead_scoring_rules:*",
+		"computed_fields:*",
+		"subscribe_forms:*",
+		"reputation_connectors:*",
+		"snippets:*",
+		"onboarding:*",
 		"files:*",
 		"team_settings:*",
 		"branding_settings:*",
 		"imap_configs:*",
+		"signatures:*",
+		"audit_logs:*",
+		"sms_configs:*",
+		"sms_fallback_rules:*",
+		"sms_messages:*",
+		"roles:*",
 	},
 	UserRoleMember: {
 		// Member has limited permissions
@@ -185,14 +303,34 @@ var rolePermissions = map[UserRole][]string{
 		"models:read",
 		"emails:read",
 		"emails:create",
+		"emails:send",
 		"analytics:read",
 		"api_key_usage:read",
 		"team_invites:read",
 		"contact_imports:read",
+		"contact_syncs:read",
+		"segments:read",
+		"blackout_dates:read",
+		"alert_rules:read",
+		"content_blocks:read",
+		"scoring_endpoints:read",
+		"sender_personas:read",
+		"frequency_caps:read",
+		"lead_scoring_rules:read",
+		"computed_fields:read",
+		"subscribe_forms:read",
+		"reputation_connectors:read",
+		"snippets:read",
+		"onboarding:read",
 		"files:read",
 		"team_settings:read",
 		"branding_settings:read",
 		"imap_configs:read",
+		// Members manage their own signatures; the team's are for admins
+		"signatures:*",
+		"sms_fallback_rules:read",
+		"sms_messages:read",
+		"roles:read",
 	},
 	UserRoleSuperAdmin: {
 		// SuperAdmin has all permissions
@@ -210,6 +348,10 @@ func SeedPermissions(db *gorm.DB) error {
 		}).Error; err != nil {
 			return fmt.Errorf("failed to create resource %s:%s: %v", resource.Name, resource.Action, err)
 		}
+		// Every permission can be granted to API keys, including those no role has by default
+		if err := createResourcePermission(db, resource); err != nil {
+			return err
+		}
 	}
 
 	// Create resource permissions for each role
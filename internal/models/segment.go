@@ -0,0 +1,371 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// SegmentConditionType represents what a segment condition matches on
+type SegmentConditionType string
+
+const (
+	SegmentConditionField      SegmentConditionType = "field"
+	SegmentConditionTag        SegmentConditionType = "tag"
+	SegmentConditionMetadata   SegmentConditionType = "metadata"
+	SegmentConditionEngagement SegmentConditionType = "engagement"
+	SegmentConditionComputed   SegmentConditionType = "computed"
+)
+
+// Segment is a dynamic set of contacts defined by a condition tree and evaluated at send time
+type Segment struct {
+	Base
+	Name        string         `gorm:"not null" json:"name" validate:"required,min=2"`
+	Description string         `json:"description" validate:"omitempty"`
+	Conditions  datatypes.JSON `gorm:"type:jsonb;not null;default:'{}'" json:"conditions" validate:"required,json"`
+	ListID      string         `gorm:"type:uuid;default:NULL" json:"listId" validate:"omitempty,uuid"`
+	List        *MailingList   `json:"list,omitempty"`
+	TeamID      string         `gorm:"type:uuid;not null" json:"teamId" validate:"required,uuid"`
+	Team        *Team          `json:"team,omitempty"`
+}
+
+// SegmentCondition is a node in a segment condition tree. A node is either a group
+// (Operator + Conditions) or a leaf that matches a field, tag, metadata key, engagement event
+// or computed field. Computed fields are team specific, so trees using them are resolved
+// against the team before they're built.
+type SegmentCondition struct {
+	Operator   string               `json:"operator,omitempty"` // AND, OR
+	Conditions []SegmentCondition   `json:"conditions,omitempty"`
+	Type       SegmentConditionType `json:"type,omitempty"`
+	Field      string               `json:"field,omitempty"`
+	Op         string               `json:"op,omitempty"`
+	Value      interface{}          `json:"value,omitempty"`
+	Event      EmailTrackingEvent   `json:"event,omitempty"`
+	Days       int                  `json:"days,omitempty"`
+
+	computed *computedSQL // the expression of the computed field, once resolved
+}
+
+// segmentFieldColumns whitelists the contact columns segments may filter on
+var segmentFieldColumns = map[string]string{
+	"email":      "contacts.email",
+	"first_name": "contacts.first_name",
+	"last_name":  "contacts.last_name",
+	"company":    "contacts.company",
+	"country":    "contacts.country",
+	"city":       "contacts.city",
+	"state":      "contacts.state",
+	"zip":        "contacts.zip",
+	"address":    "contacts.address",
+	"phone":      "contacts.phone",
+	"status":     "contacts.status",
+	"list_id":    "contacts.list_id",
+	"created_at": "contacts.created_at",
+	"score":      "contacts.score",
+}
+
+func (s *Segment) BeforeSave(tx *gorm.DB) error {
+	root, err := s.ParseConditions()
+	if err != nil {
+		return err
+	}
+	if err := root.ResolveComputedFields(s.TeamID, tx.Session(&gorm.Session{NewDB: true})); err != nil {
+		return fmt.Errorf("invalid segment conditions: %w", err)
+	}
+	if _, _, err := root.Build(); err != nil {
+		return fmt.Errorf("invalid segment conditions: %w", err)
+	}
+	return nil
+}
+
+// ParseConditions decodes the stored condition tree
+func (s *Segment) ParseConditions() (*SegmentCondition, error) {
+	root := &SegmentCondition{}
+	if len(s.Conditions) == 0 {
+		return root, nil
+	}
+	if err := json.Unmarshal(s.Conditions, root); err != nil {
+		return nil, fmt.Errorf("failed to parse segment conditions: %w", err)
+	}
+	return root, nil
+}
+
+// Apply restricts a contacts query to the contacts matching the segment
+func (s *Segment) Apply(query *gorm.DB) (*gorm.DB, error) {
+	root, err := s.ParseConditions()
+	if err != nil {
+		return nil, err
+	}
+
+	query = query.Where("contacts.team_id = ?", s.TeamID)
+	if s.ListID != "" {
+		query = query.Where("contacts.list_id = ?", s.ListID)
+	}
+
+	if err := root.ResolveComputedFields(s.TeamID, query.Session(&gorm.Session{NewDB: true})); err != nil {
+		return nil, err
+	}
+	sql, args, err := root.Build()
+	if err != nil {
+		return nil, err
+	}
+	if sql != "" {
+		query = query.Where(sql, args...)
+	}
+	return query, nil
+}
+
+// Build converts the condition tree into a SQL expression over the contacts table
+func (c *SegmentCondition) Build() (string, []interface{}, error) {
+	if c.Type == "" {
+		return c.buildGroup()
+	}
+
+	switch c.Type {
+	case SegmentConditionField:
+		column, ok := segmentFieldColumns[c.Field]
+		if !ok {
+			return "", nil, fmt.Errorf("unsupported segment field: %s", c.Field)
+		}
+		return buildComparison(column, c.Op, c.Value)
+
+	case SegmentConditionMetadata:
+		if c.Field == "" {
+			return "", nil, errors.New("metadata condition requires a field")
+		}
+		sql, args, err := buildComparison("contacts.metadata ->> ?", c.Op, c.Value)
+		if err != nil {
+			return "", nil, err
+		}
+		return sql, append([]interface{}{c.Field}, args...), nil
+
+	case SegmentConditionTag:
+		exists := "EXISTS (SELECT 1 FROM contact_tags ct JOIN tags t ON t.id = ct.tag_id WHERE ct.contact_id = contacts.id AND t.name = ?)"
+		switch c.Op {
+		case "", "has":
+			return exists, []interface{}{c.Value}, nil
+		case "has_not":
+			return "NOT " + exists, []interface{}{c.Value}, nil
+		default:
+			return "", nil, fmt.Errorf("unsupported tag operator: %s", c.Op)
+		}
+
+	case SegmentConditionEngagement:
+		if c.Event == "" {
+			return "", nil, errors.New("engagement condition requires an event")
+		}
+		if c.Days <= 0 {
+			return "", nil, errors.New("engagement condition requires days")
+		}
+		since := time.Now().AddDate(0, 0, -c.Days)
+		exists := "EXISTS (SELECT 1 FROM email_trackings et WHERE et.contact_id = contacts.id AND et.event = ? AND et.timestamp >= ? AND et.automated = false AND et.is_deleted = false)"
+		switch c.Op {
+		case "", "has":
+			return exists, []interface{}{c.Event, since}, nil
+		case "has_not":
+			return "NOT " + exists, []interface{}{c.Event, since}, nil
+		default:
+			return "", nil, fmt.Errorf("unsupported engagement operator: %s", c.Op)
+		}
+
+	case SegmentConditionComputed:
+		if c.computed == nil {
+			return "", nil, fmt.Errorf("computed field %s isn't resolved", c.Field)
+		}
+		// Values are compared as text, ordered comparisons as numbers since computed fields mostly
+		// count days and events
+		column, value := "("+c.computed.sql+")::text", computedComparisonValue(c.Value)
+		switch c.Op {
+		case "gt", "gte", "lt", "lte":
+			column, value = "("+c.computed.sql+")::numeric", c.Value
+		}
+		sql, args, err := buildComparison(column, c.Op, value)
+		if err != nil {
+			return "", nil, err
+		}
+		return sql, append(append([]interface{}{}, c.computed.args...), args...), nil
+	}
+
+	return "", nil, fmt.Errorf("unsupported segment condition type: %s", c.Type)
+}
+
+// computedComparisonValue turns the numbers of a condition's value into the text computed
+// fields are compared as
+func computedComparisonValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case []interface{}:
+		values := make([]interface{}, len(v))
+		for i := range v {
+			values[i] = computedComparisonValue(v[i])
+		}
+		return values
+	}
+	return value
+}
+
+// ResolveComputedFields looks up the expressions of the team's computed fields the tree's
+// conditions use, which Build needs
+func (c *SegmentCondition) ResolveComputedFields(teamID string, db *gorm.DB) error {
+	if !c.usesComputedFields() {
+		return nil
+	}
+
+	fields, err := GetComputedFields(teamID, db)
+	if err != nil {
+		return err
+	}
+	expressions := make(map[string]string, len(fields))
+	for _, field := range fields {
+		expressions[field.Name] = field.Expression
+	}
+	return c.resolveComputed(expressions)
+}
+
+func (c *SegmentCondition) usesComputedFields() bool {
+	if c.Type == SegmentConditionComputed {
+		return true
+	}
+	for i := range c.Conditions {
+		if c.Conditions[i].usesComputedFields() {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *SegmentCondition) resolveComputed(expressions map[string]string) error {
+	if c.Type == SegmentConditionComputed {
+		expression, ok := expressions[c.Field]
+		if !ok {
+			return fmt.Errorf("unknown computed field: %s", c.Field)
+		}
+		sql, args, err := CompileComputedExpression(expression)
+		if err != nil {
+			return fmt.Errorf("invalid expression of computed field %s: %w", c.Field, err)
+		}
+		c.computed = &computedSQL{sql: sql, args: args}
+	}
+	for i := range c.Conditions {
+		if err := c.Conditions[i].resolveComputed(expressions); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *SegmentCondition) buildGroup() (string, []interface{}, error) {
+	joiner := " AND "
+	switch strings.ToUpper(c.Operator) {
+	case "", "AND":
+	case "OR":
+		joiner = " OR "
+	default:
+		return "", nil, fmt.Errorf("unsupported segment operator: %s", c.Operator)
+	}
+
+	var parts []string
+	var args []interface{}
+	for i := range c.Conditions {
+		sql, childArgs, err := c.Conditions[i].Build()
+		if err != nil {
+			return "", nil, err
+		}
+		if sql == "" {
+			continue
+		}
+		parts = append(parts, "("+sql+")")
+		args = append(args, childArgs...)
+	}
+
+	if len(parts) == 0 {
+		return "", nil, nil
+	}
+	return strings.Join(parts, joiner), args, nil
+}
+
+func buildComparison(column, op string, value interface{}) (string, []interface{}, error) {
+	switch op {
+	case "eq":
+		return column + " = ?", []interface{}{value}, nil
+	case "neq":
+		return column + " <> ?", []interface{}{value}, nil
+	case "contains":
+		return column + " ILIKE ?", []interface{}{fmt.Sprintf("%%%v%%", value)}, nil
+	case "not_contains":
+		return column + " NOT ILIKE ?", []interface{}{fmt.Sprintf("%%%v%%", value)}, nil
+	case "starts_with":
+		return column + " ILIKE ?", []interface{}{fmt.Sprintf("%v%%", value)}, nil
+	case "ends_with":
+		return column + " ILIKE ?", []interface{}{fmt.Sprintf("%%%v", value)}, nil
+	case "gt":
+		return column + " > ?", []interface{}{value}, nil
+	case "gte":
+		return column + " >= ?", []interface{}{value}, nil
+	case "lt":
+		return column + " < ?", []interface{}{value}, nil
+	case "lte":
+		return column + " <= ?", []interface{}{value}, nil
+	case "in", "not_in":
+		values, ok := value.([]interface{})
+		if !ok || len(values) == 0 {
+			return "", nil, fmt.Errorf("operator %s requires a non-empty list", op)
+		}
+		if op == "in" {
+			return column + " IN ?", []interface{}{values}, nil
+		}
+		return column + " NOT IN ?", []interface{}{values}, nil
+	case "is_empty":
+		return "COALESCE(" + column + ", '') = ''", nil, nil
+	case "is_not_empty":
+		return "COALESCE(" + column + ", '') <> ''", nil, nil
+	}
+	return "", nil, fmt.Errorf("unsupported segment operator: %s", op)
+}
+
+// GetSegmentByID retrieves a segment by its ID
+func GetSegmentByID(id string, db *gorm.DB) (*Segment, error) {
+	segment := &Segment{}
+	if err := db.Where("id = ? AND is_deleted = false", id).First(segment).Error; err != nil {
+		return nil, err
+	}
+	return segment, nil
+}
+
+// AudienceQuery returns a contacts query for everyone the campaign targets: its list,
+// narrowed (or replaced when no list is set) by its segment
+func (c *Campaign) AudienceQuery(db *gorm.DB) (*gorm.DB, error) {
+	if c.ListID == "" && c.SegmentID == "" {
+		return nil, fmt.Errorf("campaign %s has neither a list nor a segment", c.ID)
+	}
+
+	audience := db.Table("contacts").Where("contacts.team_id = ? AND contacts.is_deleted = false", c.TeamID)
+
+	if c.ListID != "" {
+		emailList, _, err := GetEmailListByID(c.ListID, db)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get email list: %w", err)
+		}
+		audience = audience.Where("contacts.list_id = ?", emailList.ID)
+	}
+
+	if c.SegmentID != "" {
+		// Segments are evaluated at send time so they always reflect the latest data
+		segment, err := GetSegmentByID(c.SegmentID, db)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get segment: %w", err)
+		}
+		if audience, err = segment.Apply(audience); err != nil {
+			return nil, fmt.Errorf("failed to apply segment: %w", err)
+		}
+	}
+
+	return audience, nil
+}
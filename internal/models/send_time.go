@@ -0,0 +1,189 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// sendTimeHistory is how far back opens and clicks are looked at to find when to send
+	sendTimeHistory = 180 * 24 * time.Hour
+	// minSendTimeEvents is how many opens and clicks a contact needs before their own history
+	// is used over the team's
+	minSendTimeEvents = 3
+	// sendTimeChunk is how many contacts' history is read at a time
+	sendTimeChunk = 1000
+)
+
+// SendTimeEngagement counts the opens and clicks that happened in an hour of the day or a day of the week
+type SendTimeEngagement struct {
+	Opens  int `json:"opens"`
+	Clicks int `json:"clicks"`
+}
+
+// SendTimeProfile is when a contact, or a team's contacts as a whole, open and click email, by
+// hour of the day and day of the week in UTC
+type SendTimeProfile struct {
+	Hourly [24]SendTimeEngagement `json:"hourly"`
+	Daily  [7]SendTimeEngagement  `json:"daily"`
+	Events int                    `json:"events"`
+}
+
+func (p *SendTimeProfile) add(event EmailTrackingEvent, weekday, hour, count int) {
+	if weekday < 0 || weekday > 6 || hour < 0 || hour > 23 {
+		return
+	}
+	switch event {
+	case EmailTrackingEventOpen:
+		p.Hourly[hour].Opens += count
+		p.Daily[weekday].Opens += count
+	case EmailTrackingEventClick:
+		p.Hourly[hour].Clicks += count
+		p.Daily[weekday].Clicks += count
+	default:
+		return
+	}
+	p.Events += count
+}
+
+// TimeSlotScore scores a time slot by the engagement of its hour and of its day, opens
+// weighing more than clicks and the hour more than the day
+func TimeSlotScore(hourly, daily SendTimeEngagement) float64 {
+	if hourly.Opens == 0 && hourly.Clicks == 0 {
+		return 0
+	}
+
+	// Weight different metrics
+	openWeight := 0.6
+	clickWeight := 0.4
+
+	hourlyScore := float64(hourly.Opens)*openWeight + float64(hourly.Clicks)*clickWeight
+	dailyScore := float64(daily.Opens)*openWeight + float64(daily.Clicks)*clickWeight
+
+	// Combine scores with time-based weighting
+	return (hourlyScore*0.7 + dailyScore*0.3) * 100
+}
+
+// NextSendTime returns the best time to send within a day of from: the start of the hour, of
+// the next 24, that scores highest, or from itself when the current hour does or the profile
+// has no engagement
+func (p *SendTimeProfile) NextSendTime(from time.Time) time.Time {
+	start := from.UTC().Truncate(time.Hour)
+
+	best, bestScore := 0, 0.0
+	for i := 0; i < 24; i++ {
+		slot := start.Add(time.Duration(i) * time.Hour)
+		if score := TimeSlotScore(p.Hourly[slot.Hour()], p.Daily[slot.Weekday()]); score > bestScore {
+			best, bestScore = i, score
+		}
+	}
+
+	if best == 0 {
+		return from
+	}
+	return start.Add(time.Duration(best) * time.Hour)
+}
+
+// GetSendTimeProfiles returns the send time profiles of the given contacts and of the team as a
+// whole, from their opens and clicks of the last 180 days. Contacts with too little history of
+// their own are left out, the team's profile being used for them.
+func GetSendTimeProfiles(teamID string, contactIDs []string, db *gorm.DB) (map[string]*SendTimeProfile, *SendTimeProfile, error) {
+	since := time.Now().Add(-sendTimeHistory)
+
+	var rows []struct {
+		ContactID string
+		Event     EmailTrackingEvent
+		Weekday   int
+		Hour      int
+		Count     int
+	}
+
+	query := func() *gorm.DB {
+		return db.Model(&EmailTracking{}).
+			Joins("JOIN emails ON emails.id = email_trackings.email_id").
+			Where("emails.team_id = ?", teamID).
+			Where("email_trackings.event IN ? AND email_trackings.automated = false AND email_trackings.is_deleted = false",
+				[]EmailTrackingEvent{EmailTrackingEventOpen, EmailTrackingEventClick}).
+			Where("email_trackings.timestamp >= ?", since)
+	}
+
+	team := &SendTimeProfile{}
+	if err := query().
+		Select("email_trackings.event, EXTRACT(DOW FROM email_trackings.timestamp AT TIME ZONE 'UTC')::int AS weekday, " +
+			"EXTRACT(HOUR FROM email_trackings.timestamp AT TIME ZONE 'UTC')::int AS hour, COUNT(*) AS count").
+		Group("1, 2, 3").
+		Scan(&rows).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to get team engagement times: %w", err)
+	}
+	for _, row := range rows {
+		team.add(row.Event, row.Weekday, row.Hour, row.Count)
+	}
+
+	profiles := make(map[string]*SendTimeProfile)
+	for start := 0; start < len(contactIDs); start += sendTimeChunk {
+		chunk := contactIDs[start:min(start+sendTimeChunk, len(contactIDs))]
+
+		rows = rows[:0]
+		if err := query().
+			Select("email_trackings.contact_id, email_trackings.event, "+
+				"EXTRACT(DOW FROM email_trackings.timestamp AT TIME ZONE 'UTC')::int AS weekday, "+
+				"EXTRACT(HOUR FROM email_trackings.timestamp AT TIME ZONE 'UTC')::int AS hour, COUNT(*) AS count").
+			Where("email_trackings.contact_id IN ?", chunk).
+			Group("1, 2, 3, 4").
+			Scan(&rows).Error; err != nil {
+			return nil, nil, fmt.Errorf("failed to get contact engagement times: %w", err)
+		}
+		for _, row := range rows {
+			profile, ok := profiles[row.ContactID]
+			if !ok {
+				profile = &SendTimeProfile{}
+				profiles[row.ContactID] = profile
+			}
+			profile.add(row.Event, row.Weekday, row.Hour, row.Count)
+		}
+	}
+
+	for id, profile := range profiles {
+		if profile.Events < minSendTimeEvents {
+			delete(profiles, id)
+		}
+	}
+
+	return profiles, team, nil
+}
+
+// SendsPerRecipient reports whether the campaign's emails are each sent at their own time, by
+// smart send or at a local time, rather than in batches right away
+func (c *Campaign) SendsPerRecipient() bool {
+	return c.SmartSend || c.LocalSendTime != ""
+}
+
+func (c *Campaign) validateSendTime() error {
+	if c.SmartSend && c.LocalSendTime != "" {
+		return &ValidationError{Message: "a campaign can't use both smart send and a local send time"}
+	}
+	if c.LocalSendTime != "" {
+		if _, err := time.Parse("15:04", c.LocalSendTime); err != nil {
+			return &ValidationError{Message: fmt.Sprintf("invalid local send time %q, expected HH:MM", c.LocalSendTime)}
+		}
+	}
+	return nil
+}
+
+// CompleteScheduledCampaign marks a sending campaign whose emails each have their own send
+// time, or some of which a frequency cap deferred, completed once none of them are waiting for
+// it any more
+func CompleteScheduledCampaign(campaignID string, db *gorm.DB) error {
+	deferred := db.Model(&Email{}).Select("1").
+		Where("emails.campaign_id = ? AND emails.skip_reason <> '' AND emails.status <> ? AND emails.is_deleted = false",
+			campaignID, EmailStatusSkipped)
+	return db.Model(&Campaign{}).
+		Where("id = ? AND status = ? AND ab_test_status <> ? AND sample_status <> ?",
+			campaignID, CampaignStatusSending, ABTestStatusTesting, SampleStatusObserving).
+		Where("(smart_send = true OR local_send_time <> '' OR EXISTS (?))", deferred).
+		Where("NOT EXISTS (?)", db.Model(&Email{}).Select("1").
+			Where("emails.campaign_id = ? AND emails.status = ? AND emails.is_deleted = false", campaignID, EmailStatusPending)).
+		Update("status", CampaignStatusCompleted).Error
+}
@@ -0,0 +1,145 @@
+package models
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Sender authentication issue severities, matching the preflight ones
+const (
+	SenderAuthSeverityError   = "error"
+	SenderAuthSeverityWarning = "warning"
+)
+
+// SenderAuthIssue is a misalignment that hurts a campaign's deliverability
+type SenderAuthIssue struct {
+	Type     string `json:"type"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+// SenderAuthentication is how a campaign's mail will authenticate given its SMTP config: the
+// From domain, the verified domain covering it and the DKIM selector, SPF record and tracking
+// domain receivers will see
+type SenderAuthentication struct {
+	CampaignID      string             `json:"campaignId"`
+	SMTPConfigID    string             `json:"smtpConfigId"`
+	SMTPHost        string             `json:"smtpHost"`
+	From            string             `json:"from"`
+	FromDomain      string             `json:"fromDomain"`
+	DomainID        string             `json:"domainId,omitempty"` // the team's domain covering FromDomain
+	Domain          string             `json:"domain,omitempty"`
+	DomainVerified  bool               `json:"domainVerified"`
+	DKIMSelector    string             `json:"dkimSelector,omitempty"`
+	DKIMHost        string             `json:"dkimHost,omitempty"`
+	DKIMStatus      DomainRecordStatus `json:"dkimStatus,omitempty"`
+	EnvelopeFrom    string             `json:"envelopeFrom"` // the MAIL FROM address SPF is checked against
+	SPFStatus       DomainRecordStatus `json:"spfStatus,omitempty"`
+	SPFAligned      bool               `json:"spfAligned"`
+	DMARCStatus     DomainRecordStatus `json:"dmarcStatus,omitempty"`
+	DMARCPolicy     string             `json:"dmarcPolicy,omitempty"`
+	TrackingDomain  string             `json:"trackingDomain"`
+	TrackingAligned bool               `json:"trackingAligned"`
+	Aligned         bool               `json:"aligned"` // no errors among the issues
+	Issues          []SenderAuthIssue  `json:"issues"`
+}
+
+// emailDomain returns the lowercased domain of an address
+func emailDomain(address string) string {
+	if at := strings.LastIndex(address, "@"); at >= 0 {
+		address = address[at+1:]
+	}
+	return strings.ToLower(strings.TrimSuffix(strings.TrimSpace(address), ">"))
+}
+
+// domainCovers reports whether name is the domain or one of its subdomains, which DMARC's
+// relaxed alignment accepts
+func domainCovers(domain, name string) bool {
+	return name == domain || strings.HasSuffix(name, "."+domain)
+}
+
+// GetSenderAuthentication works out how the campaign's mail will authenticate. Links and the
+// open pixel are served from trackingURL.
+func GetSenderAuthentication(campaign *Campaign, trackingURL string, db *gorm.DB) (*SenderAuthentication, error) {
+	smtpConfig, err := GetSMTPConfig(campaign.TeamID, campaign.SMTPConfigID, "", db)
+	if err != nil {
+		return nil, err
+	}
+
+	auth := &SenderAuthentication{
+		CampaignID:   campaign.ID,
+		SMTPConfigID: smtpConfig.ID,
+		SMTPHost:     smtpConfig.Host,
+		From:         smtpConfig.FromEmail,
+		FromDomain:   emailDomain(smtpConfig.FromEmail),
+		// Messages don't set a Sender, so the From address is also the envelope sender
+		EnvelopeFrom: smtpConfig.FromEmail,
+		Issues:       []SenderAuthIssue{},
+	}
+	issue := func(kind, severity, format string, args ...interface{}) {
+		auth.Issues = append(auth.Issues, SenderAuthIssue{Type: kind, Severity: severity, Message: fmt.Sprintf(format, args...)})
+	}
+
+	var domains []Domain
+	if err := db.Where("team_id = ? AND is_deleted = false", campaign.TeamID).Find(&domains).Error; err != nil {
+		return nil, err
+	}
+	// The most specific of the team's domains covering the From domain signs for it
+	var domain *Domain
+	for i := range domains {
+		name := strings.ToLower(domains[i].Domain)
+		if domainCovers(name, auth.FromDomain) && (domain == nil || len(name) > len(domain.Domain)) {
+			domain = &domains[i]
+		}
+	}
+
+	switch {
+	case auth.FromDomain == "":
+		issue("from_missing", SenderAuthSeverityError, "SMTP config %s has no From address", smtpConfig.ID)
+	case domain == nil:
+		issue("from_domain_unknown", SenderAuthSeverityError,
+			"From domain %s isn't one of the team's domains, so DKIM and SPF can't align with it and DMARC fails", auth.FromDomain)
+	default:
+		auth.DomainID, auth.Domain, auth.DomainVerified = domain.ID, domain.Domain, domain.IsVerified
+		auth.DKIMSelector, auth.DKIMHost, auth.DKIMStatus = domain.DKIMSelector, domain.DKIMHost(), domain.DKIMStatus
+		auth.SPFStatus, auth.DMARCStatus, auth.DMARCPolicy = domain.SPFStatus, domain.DMARCStatus, domain.DMARCPolicy
+
+		if !domain.IsVerified {
+			issue("domain_unverified", SenderAuthSeverityError, "Domain %s covering the From address isn't verified", domain.Domain)
+		}
+		if domain.DKIMStatus != DomainRecordStatusVerified {
+			issue("dkim_unverified", SenderAuthSeverityError, "No DKIM key was found at %s", domain.DKIMHost())
+		}
+		if domain.DMARCStatus != DomainRecordStatusVerified {
+			issue("dmarc_missing", SenderAuthSeverityWarning, "Domain %s has no DMARC record", domain.Domain)
+		}
+	}
+
+	envelopeDomain := emailDomain(auth.EnvelopeFrom)
+	auth.SPFAligned = domain != nil && domainCovers(strings.ToLower(domain.Domain), envelopeDomain) &&
+		domain.SPFStatus == DomainRecordStatusVerified
+	if domain != nil && !auth.SPFAligned {
+		issue("spf_unaligned", SenderAuthSeverityError, "SPF of %s doesn't authorize the envelope sender %s", domain.Domain, auth.EnvelopeFrom)
+	}
+
+	if tracking, err := url.Parse(trackingURL); err == nil {
+		auth.TrackingDomain = strings.ToLower(tracking.Hostname())
+	}
+	// Links on a domain unrelated to the sender look like phishing to some filters
+	auth.TrackingAligned = domain != nil && domainCovers(strings.ToLower(domain.Domain), auth.TrackingDomain)
+	if !auth.TrackingAligned && auth.FromDomain != "" {
+		issue("tracking_domain_unaligned", SenderAuthSeverityWarning,
+			"Tracked links point to %s, which isn't under the From domain %s", auth.TrackingDomain, auth.FromDomain)
+	}
+
+	auth.Aligned = true
+	for _, i := range auth.Issues {
+		if i.Severity == SenderAuthSeverityError {
+			auth.Aligned = false
+		}
+	}
+	return auth, nil
+}
@@ -0,0 +1,126 @@
+package models
+
+import (
+	"hash/fnv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SenderPersona is who an email appears to come from: a display name, from address and
+// reply-to, independent of the SMTP config it's sent through. Campaigns and automation email
+// nodes use one persona or rotate across several.
+type SenderPersona struct {
+	Base
+	Name      string `gorm:"not null" json:"name" validate:"required,min=2"`
+	FromName  string `json:"fromName"`
+	FromEmail string `gorm:"not null" json:"fromEmail" validate:"required,email"`
+	ReplyTo   string `json:"replyTo" validate:"omitempty,email"`
+	IsActive  bool   `gorm:"not null;default:true" json:"isActive"`
+	TeamID    string `gorm:"type:uuid;not null;index" json:"teamId" validate:"required,uuid"`
+	Team      *Team  `json:"team,omitempty"`
+}
+
+// GetSenderPersonas returns the team's active personas among the IDs, in the order given.
+// IDs of other teams' or inactive personas are left out.
+func GetSenderPersonas(teamID string, ids []string, db *gorm.DB) ([]SenderPersona, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	var found []SenderPersona
+	if err := db.Where("id IN ? AND team_id = ? AND is_active = true AND is_deleted = false", ids, teamID).
+		Find(&found).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[string]SenderPersona, len(found))
+	for _, persona := range found {
+		byID[persona.ID] = persona
+	}
+	personas := make([]SenderPersona, 0, len(found))
+	for _, id := range ids {
+		if persona, ok := byID[id]; ok {
+			personas = append(personas, persona)
+			delete(byID, id)
+		}
+	}
+	return personas, nil
+}
+
+// PickSenderPersona rotates across personas by recipient. An address keeps getting the same
+// persona, so a contact hears from one sender across a campaign's runs and a sequence's steps.
+func PickSenderPersona(personas []SenderPersona, recipient string) *SenderPersona {
+	if len(personas) == 0 {
+		return nil
+	}
+	hash := fnv.New32a()
+	hash.Write([]byte(strings.ToLower(recipient)))
+	return &personas[hash.Sum32()%uint32(len(personas))]
+}
+
+// ApplyTo makes the email come from the persona. A from name already chosen, e.g. by an A/B
+// variant, is kept.
+func (p *SenderPersona) ApplyTo(email *Email) {
+	email.SenderPersonaID = p.ID
+	email.From = p.FromEmail
+	if email.FromName == "" {
+		email.FromName = p.FromName
+	}
+	if p.ReplyTo != "" {
+		email.ReplyTo = p.ReplyTo
+	}
+}
+
+// SenderPersonaStats is how a persona's emails did
+type SenderPersonaStats struct {
+	SenderPersonaID string  `json:"senderPersonaId"`
+	Name            string  `json:"name"`
+	FromEmail       string  `json:"fromEmail"`
+	Sent            int64   `json:"sent"`
+	Opens           int64   `json:"opens"` // emails opened at least once
+	Clicks          int64   `json:"clicks"`
+	Replies         int64   `json:"replies"`
+	Bounces         int64   `json:"bounces"`
+	Complaints      int64   `json:"complaints"`
+	Unsubscribes    int64   `json:"unsubscribes"`
+	OpenRate        float64 `json:"openRate"` // percentages of the emails sent
+	ClickRate       float64 `json:"clickRate"`
+	ReplyRate       float64 `json:"replyRate"`
+	BounceRate      float64 `json:"bounceRate"`
+}
+
+// GetSenderPersonaStats returns the engagement of each of the team's personas with the emails
+// created since the given time. Automated engagement and that of CC or BCC recipients isn't
+// counted.
+func GetSenderPersonaStats(teamID string, since time.Time, db *gorm.DB) ([]SenderPersonaStats, error) {
+	var stats []SenderPersonaStats
+	if err := db.Table("sender_personas AS p").
+		Select(`p.id AS sender_persona_id, p.name, p.from_email,
+			COUNT(DISTINCT e.id) FILTER (WHERE e.sent_at > '0001-01-02') AS sent,
+			COUNT(DISTINCT t.email_id) FILTER (WHERE t.event = ?) AS opens,
+			COUNT(DISTINCT t.email_id) FILTER (WHERE t.event = ?) AS clicks,
+			COUNT(DISTINCT t.email_id) FILTER (WHERE t.event = ?) AS replies,
+			COUNT(DISTINCT e.id) FILTER (WHERE t.event = ? OR e.status = ?) AS bounces,
+			COUNT(DISTINCT t.email_id) FILTER (WHERE t.event = ?) AS complaints,
+			COUNT(DISTINCT t.email_id) FILTER (WHERE t.event = ?) AS unsubscribes`,
+			EmailTrackingEventOpen, EmailTrackingEventClick, EmailTrackingEventReply,
+			EmailTrackingEventBounce, EmailStatusBounced, EmailTrackingEventComplaint, EmailTrackingEventUnsubscribe).
+		Joins("LEFT JOIN emails e ON e.sender_persona_id = p.id AND e.created_at >= ? AND e.is_deleted = false", since).
+		Joins("LEFT JOIN email_trackings t ON t.email_id = e.id AND t.automated = false AND t.recipient = '' AND t.is_deleted = false").
+		Where("p.team_id = ? AND p.is_deleted = false", teamID).
+		Group("p.id, p.name, p.from_email").
+		Order("sent DESC, p.name").
+		Scan(&stats).Error; err != nil {
+		return nil, err
+	}
+
+	for i := range stats {
+		if sent := float64(stats[i].Sent); sent > 0 {
+			stats[i].OpenRate = float64(stats[i].Opens) / sent * 100
+			stats[i].ClickRate = float64(stats[i].Clicks) / sent * 100
+			stats[i].ReplyRate = float64(stats[i].Replies) / sent * 100
+			stats[i].BounceRate = float64(stats[i].Bounces) / sent * 100
+		}
+	}
+	return stats, nil
+}
@@ -0,0 +1,131 @@
+package models
+
+import (
+	"errors"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// ErrSignatureNotFound is returned when a signature isn't one the sender can use
+var ErrSignatureNotFound = errors.New("signature not found")
+
+// Signature is a sign-off appended to inbox follow-ups and, when a send asks for it, to
+// transactional emails. Signatures with a user are that user's; the others are the team's.
+type Signature struct {
+	Base
+	TeamID    string `gorm:"type:uuid;not null;index" json:"teamId"`
+	UserID    string `gorm:"type:uuid;default:NULL;index" json:"userId,omitempty"` // the team's signature when empty
+	Name      string `gorm:"not null" json:"name"`
+	Title     string `json:"title"`                          // the signer's job title, {{title}}
+	HTML      string `gorm:"type:text;not null" json:"html"` // sanitized when saved
+	IsDefault bool   `gorm:"not null;default:false" json:"isDefault"`
+}
+
+// SaveSignature creates or updates a signature. A default signature takes over from the
+// previous default of its user, or of the team for team signatures.
+func SaveSignature(signature *Signature, db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if signature.IsDefault {
+			query := tx.Model(&Signature{}).Where("team_id = ? AND is_default = true AND is_deleted = false", signature.TeamID)
+			if signature.UserID == "" {
+				query = query.Where("user_id IS NULL")
+			} else {
+				query = query.Where("user_id = ?", signature.UserID)
+			}
+			if signature.ID != "" {
+				query = query.Where("id <> ?", signature.ID)
+			}
+			if err := query.Update("is_default", false).Error; err != nil {
+				return err
+			}
+		}
+		if signature.ID == "" {
+			return tx.Create(signature).Error
+		}
+		// The signer never changes, and an empty user can't be written to the uuid column
+		return tx.Model(signature).Select("name", "title", "html", "is_default").Updates(signature).Error
+	})
+}
+
+// GetSignature returns a signature the user can send with: one of theirs or one of the team's.
+// Without a user, as with API keys, only the team's signatures can be used.
+func GetSignature(teamID, userID, signatureID string, db *gorm.DB) (*Signature, error) {
+	query := db.Where("id = ? AND team_id = ? AND is_deleted = false", signatureID, teamID)
+	if userID == "" {
+		query = query.Where("user_id IS NULL")
+	} else {
+		query = query.Where("user_id IS NULL OR user_id = ?", userID)
+	}
+	signature := &Signature{}
+	if err := query.First(signature).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrSignatureNotFound
+		}
+		return nil, err
+	}
+	return signature, nil
+}
+
+// GetDefaultSignature returns the user's default signature, or the team's default when the user
+// has none. It returns nil when neither has set one.
+func GetDefaultSignature(teamID, userID string, db *gorm.DB) (*Signature, error) {
+	query := db.Where("team_id = ? AND is_default = true AND is_deleted = false", teamID)
+	if userID == "" {
+		query = query.Where("user_id IS NULL")
+	} else {
+		query = query.Where("user_id IS NULL OR user_id = ?", userID)
+	}
+	var signatures []Signature
+	if err := query.Order("user_id IS NULL").Limit(1).Find(&signatures).Error; err != nil {
+		return nil, err
+	}
+	if len(signatures) == 0 {
+		return nil, nil
+	}
+	return &signatures[0], nil
+}
+
+// GetSignatureVariables returns the values a signature is rendered with. The signer is the
+// signature's user, or the given user for team signatures; without either only the team's
+// values are filled in.
+func GetSignatureVariables(signature *Signature, userID string, db *gorm.DB) (map[string]string, error) {
+	variables := map[string]string{"title": signature.Title}
+
+	if signature.UserID != "" {
+		userID = signature.UserID
+	}
+	if userID != "" {
+		user := &User{}
+		err := db.Where("id = ? AND team_id = ?", userID, signature.TeamID).First(user).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		if err == nil {
+			variables["firstName"] = user.FirstName
+			variables["lastName"] = user.LastName
+			variables["name"] = strings.TrimSpace(user.FirstName + " " + user.LastName)
+			variables["email"] = user.Email
+		}
+	}
+
+	team := &Team{}
+	if err := db.Select("name").Where("id = ?", signature.TeamID).First(team).Error; err != nil {
+		return nil, err
+	}
+	variables["team"] = team.Name
+
+	settings := &TeamSettings{}
+	err := db.Preload("BrandingSettings").Where("team_id = ? AND is_deleted = false", signature.TeamID).First(settings).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	variables["brandName"] = team.Name
+	if settings.BrandingSettings != nil {
+		if settings.BrandingSettings.DashboardName != "" {
+			variables["brandName"] = settings.BrandingSettings.DashboardName
+		}
+		variables["logoUrl"] = settings.BrandingSettings.LogoURL
+	}
+	return variables, nil
+}
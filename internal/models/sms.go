@@ -0,0 +1,217 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"kori/internal/utils/crypto"
+	"regexp"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SMSProvider is the service an SMS channel sends through
+type SMSProvider string
+
+const (
+	SMSProviderTwilio  SMSProvider = "TWILIO"
+	SMSProviderWebhook SMSProvider = "WEBHOOK" // posts the message as JSON to the team's own gateway
+)
+
+// SMSMessageStatus is where a text message stands
+type SMSMessageStatus string
+
+const (
+	SMSMessageStatusQueued SMSMessageStatus = "QUEUED"
+	SMSMessageStatusSent   SMSMessageStatus = "SENT" // accepted by the provider
+	SMSMessageStatusFailed SMSMessageStatus = "FAILED"
+)
+
+// MaxSMSLength caps a text message, ten concatenated segments
+const MaxSMSLength = 1600
+
+var (
+	// phoneSeparatorRe are the characters people write phone numbers with
+	phoneSeparatorRe = regexp.MustCompile(`[\s().\-/]`)
+	// e164Re is an international number, country code first
+	e164Re = regexp.MustCompile(`^\+[1-9]\d{6,14}$`)
+
+	// ErrInvalidSMSFallbackCategory is returned for fallback rules on categories the team doesn't have
+	ErrInvalidSMSFallbackCategory = errors.New("the category must be an email category of the team")
+	// ErrInvalidSMSFallbackConfig is returned for fallback rules on SMS configs the team doesn't have
+	ErrInvalidSMSFallbackConfig = errors.New("the sms config must be an sms config of the team")
+)
+
+// SMSConfig is a team's SMS channel. Its auth token is stored encrypted.
+type SMSConfig struct {
+	Base
+	Name       string      `gorm:"not null" json:"name" validate:"required,min=2"`
+	Provider   SMSProvider `gorm:"not null" json:"provider" validate:"required,oneof=TWILIO WEBHOOK"`
+	AccountSID string      `json:"accountSid,omitempty" validate:"required_if=Provider TWILIO"`               // Twilio account
+	AuthToken  string      `json:"authToken,omitempty" validate:"required_if=Provider TWILIO" audit:"redact"` // Twilio auth token, or the bearer token sent to the webhook
+	WebhookURL string      `json:"webhookUrl,omitempty" validate:"required_if=Provider WEBHOOK,omitempty,url"`
+	FromNumber string      `gorm:"not null" json:"fromNumber" validate:"required"` // the sender number or, where providers allow them, an alphanumeric ID
+	IsDefault  bool        `gorm:"not null;default:false" json:"isDefault"`
+	IsActive   bool        `gorm:"not null;default:true" json:"isActive"`
+	TeamID     string      `gorm:"type:uuid;not null;index" json:"teamId" validate:"required,uuid"`
+	Team       *Team       `json:"team,omitempty"`
+}
+
+func (s *SMSConfig) BeforeCreate(tx *gorm.DB) error {
+	if err := s.Base.BeforeCreate(tx); err != nil {
+		return err
+	}
+	return s.encrypt()
+}
+
+func (s *SMSConfig) BeforeUpdate(tx *gorm.DB) error {
+	return s.encrypt()
+}
+
+func (s *SMSConfig) AfterFind(tx *gorm.DB) error {
+	if s.AuthToken != "" {
+		token, err := crypto.Decrypt(s.AuthToken)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt sms auth token: %w", err)
+		}
+		s.AuthToken = token
+	}
+	return nil
+}
+
+func (s *SMSConfig) encrypt() error {
+	if s.AuthToken != "" {
+		token, err := crypto.Encrypt(s.AuthToken)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt sms auth token: %w", err)
+		}
+		s.AuthToken = token
+	}
+	return nil
+}
+
+// SMSFallbackRule texts contacts the transactional emails of a category when they hard bounce,
+// for messages that must reach them, like sign-in codes or payment failures. Campaign and
+// automation emails never fall back.
+type SMSFallbackRule struct {
+	Base
+	CategoryID  string         `gorm:"type:uuid;not null;uniqueIndex:idx_sms_fallback_rule_category" json:"categoryId" validate:"required,uuid"`
+	Category    *EmailCategory `json:"category,omitempty"`
+	SMSConfigID string         `gorm:"type:uuid;default:NULL" json:"smsConfigId,omitempty" validate:"omitempty,uuid"` // defaults to the team's default sms config
+	// the text sent, with the email's subject as {{subject}} and the contact's and email's variables
+	Message  string `gorm:"type:text;not null" json:"message" validate:"required,max=1600"`
+	IsActive bool   `gorm:"not null;default:true" json:"isActive"`
+	TeamID   string `gorm:"type:uuid;not null;uniqueIndex:idx_sms_fallback_rule_category" json:"teamId" validate:"required,uuid"`
+	Team     *Team  `json:"team,omitempty"`
+}
+
+func (r *SMSFallbackRule) BeforeSave(tx *gorm.DB) error {
+	var count int64
+	if err := tx.Session(&gorm.Session{NewDB: true}).Model(&EmailCategory{}).
+		Where("id = ? AND team_id = ? AND is_deleted = false", r.CategoryID, r.TeamID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrInvalidSMSFallbackCategory
+	}
+	if r.SMSConfigID != "" {
+		if err := tx.Session(&gorm.Session{NewDB: true}).Model(&SMSConfig{}).
+			Where("id = ? AND team_id = ? AND is_deleted = false", r.SMSConfigID, r.TeamID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return ErrInvalidSMSFallbackConfig
+		}
+	}
+	return nil
+}
+
+// SMSMessage is a text message sent in place of an email that hard bounced
+type SMSMessage struct {
+	Base
+	TeamID            string           `gorm:"type:uuid;not null;index" json:"teamId"`
+	EmailID           string           `gorm:"type:uuid;not null;uniqueIndex" json:"emailId"` // the email it stands in for
+	ContactID         string           `gorm:"type:uuid;default:NULL;index" json:"contactId,omitempty"`
+	RuleID            string           `gorm:"type:uuid;default:NULL" json:"ruleId,omitempty"`
+	SMSConfigID       string           `gorm:"type:uuid;not null" json:"smsConfigId"`
+	To                string           `gorm:"not null" json:"to"`
+	Body              string           `gorm:"type:text;not null" json:"body"`
+	Status            SMSMessageStatus `gorm:"not null;default:'QUEUED'" json:"status"`
+	ProviderMessageID string           `json:"providerMessageId,omitempty"`
+	Error             string           `json:"error,omitempty"`
+	Attempts          int              `gorm:"not null;default:0" json:"attempts"`
+	SentAt            *time.Time       `json:"sentAt,omitempty"`
+}
+
+// NormalizePhone turns a phone number as people write it into E.164, e.g. +4930123456. Numbers
+// without a country code can't be dialed abroad and report false.
+func NormalizePhone(phone string) (string, bool) {
+	phone = phoneSeparatorRe.ReplaceAllString(strings.TrimSpace(phone), "")
+	if strings.HasPrefix(phone, "00") {
+		phone = "+" + phone[2:]
+	}
+	return phone, e164Re.MatchString(phone)
+}
+
+// GetSMSFallbackRule returns the active fallback rule of an email category, nil when it has none
+func GetSMSFallbackRule(teamID, categoryID string, db *gorm.DB) (*SMSFallbackRule, error) {
+	rule := &SMSFallbackRule{}
+	if err := db.Where("team_id = ? AND category_id = ? AND is_active = true AND is_deleted = false", teamID, categoryID).
+		First(rule).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return rule, nil
+}
+
+// GetSMSConfig returns the active SMS config a rule sends through: its own, else the team's
+// default. It returns nil when the team has neither.
+func GetSMSConfig(teamID, configID string, db *gorm.DB) (*SMSConfig, error) {
+	query := db.Where("team_id = ? AND is_active = true AND is_deleted = false", teamID)
+	if configID != "" {
+		query = query.Where("id = ?", configID)
+	} else {
+		query = query.Order("is_default DESC, created_at ASC")
+	}
+	config := &SMSConfig{}
+	if err := query.First(config).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return config, nil
+}
+
+// GetFallbackPhone returns the number a hard bounced email's contact can be texted at: the
+// contact's, else that of the team's other contacts with the address. Contacts who complained
+// aren't texted.
+func GetFallbackPhone(email *Email, db *gorm.DB) (string, string, error) {
+	var contacts []Contact
+	query := db.Select("id", "phone", "status").
+		Where("team_id = ? AND is_deleted = false AND phone <> ''", email.TeamID)
+	if email.ContactID != "" {
+		query = query.Where("(id = ? OR LOWER(email) = ?)", email.ContactID, strings.ToLower(email.To)).
+			Order(clause.OrderBy{Expression: clause.Expr{SQL: "id = ? DESC", Vars: []interface{}{email.ContactID}, WithoutParentheses: true}})
+	} else {
+		query = query.Where("LOWER(email) = ?", strings.ToLower(email.To))
+	}
+	if err := query.Order("updated_at DESC").Find(&contacts).Error; err != nil {
+		return "", "", err
+	}
+	for _, contact := range contacts {
+		if contact.Status == SubscriberStatusComplained {
+			return "", "", nil
+		}
+	}
+	for _, contact := range contacts {
+		if phone, ok := NormalizePhone(contact.Phone); ok {
+			return contact.ID, phone, nil
+		}
+	}
+	return "", "", nil
+}
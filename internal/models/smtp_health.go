@@ -0,0 +1,138 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SMTPHealthFailureThreshold is how many health checks in a row have to fail before an SMTP config is marked unhealthy
+const SMTPHealthFailureThreshold = 3
+
+// PauseCampaignsUsingSMTPConfig pauses the campaigns that are sending or scheduled through an SMTP config
+// and returns them
+func PauseCampaignsUsingSMTPConfig(smtpConfigID string, db *gorm.DB) ([]Campaign, error) {
+	var campaigns []Campaign
+	if err := db.Where("smtp_config_id = ? AND status IN ? AND is_deleted = false", smtpConfigID,
+		[]CampaignStatus{CampaignStatusSending, CampaignStatusScheduled}).
+		Find(&campaigns).Error; err != nil {
+		return nil, err
+	}
+	if len(campaigns) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]string, len(campaigns))
+	for i := range campaigns {
+		ids[i] = campaigns[i].ID
+		campaigns[i].Status = CampaignStatusPaused
+	}
+	if err := db.Model(&Campaign{}).Where("id IN ?", ids).Update("status", CampaignStatusPaused).Error; err != nil {
+		return nil, err
+	}
+	return campaigns, nil
+}
+
+// SMTPSendingScope selects the SMTP configs an operator pauses or resumes: one config, or
+// every config of a provider, optionally narrowed to a host
+type SMTPSendingScope struct {
+	SMTPConfigID string
+	Provider     string
+	Host         string
+}
+
+// query restricts an SMTP config query to the scope
+func (s SMTPSendingScope) query(db *gorm.DB) *gorm.DB {
+	query := db.Model(&SMTPConfig{}).Where("is_deleted = false")
+	if s.SMTPConfigID != "" {
+		query = query.Where("id = ?", s.SMTPConfigID)
+	}
+	if s.Provider != "" {
+		query = query.Where("provider = ?", s.Provider)
+	}
+	if s.Host != "" {
+		query = query.Where("LOWER(host) = LOWER(?)", s.Host)
+	}
+	return query
+}
+
+// SetSMTPSendingPaused pauses or resumes sending through the SMTP configs of a scope and
+// returns the configs that changed
+func SetSMTPSendingPaused(scope SMTPSendingScope, paused bool, reason string, db *gorm.DB) ([]SMTPConfig, error) {
+	var configs []SMTPConfig
+	if err := scope.query(db).Where("sending_paused = ?", !paused).Find(&configs).Error; err != nil {
+		return nil, err
+	}
+	if len(configs) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]string, len(configs))
+	for i := range configs {
+		ids[i] = configs[i].ID
+	}
+	updates := map[string]interface{}{
+		"sending_paused":       paused,
+		"sending_paused_at":    nil,
+		"sending_pause_reason": "",
+	}
+	if paused {
+		updates["sending_paused_at"] = time.Now()
+		updates["sending_pause_reason"] = reason
+	}
+	if err := db.Model(&SMTPConfig{}).Where("id IN ?", ids).Updates(updates).Error; err != nil {
+		return nil, err
+	}
+	return configs, nil
+}
+
+// GetSMTPConfigsInScope returns the SMTP configs of a scope
+func GetSMTPConfigsInScope(scope SMTPSendingScope, db *gorm.DB) ([]SMTPConfig, error) {
+	var configs []SMTPConfig
+	if err := scope.query(db).Order("created_at ASC").Find(&configs).Error; err != nil {
+		return nil, err
+	}
+	return configs, nil
+}
+
+// IsSMTPSendingPaused reports whether an operator paused sending through an SMTP config
+func IsSMTPSendingPaused(smtpConfigID string, db *gorm.DB) bool {
+	var paused bool
+	db.Model(&SMTPConfig{}).Select("sending_paused").Where("id = ?", smtpConfigID).Scan(&paused)
+	return paused
+}
+
+// ParkEmails holds unsent emails until sending through their SMTP config is resumed. Parked
+// emails are pending again and keep their attempts, so the pause doesn't count against them.
+func ParkEmails(ids []string, db *gorm.DB) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return db.Model(&Email{}).
+		Where("id IN ? AND status IN ?", ids, []EmailStatus{EmailStatusPending, EmailStatusFailed}).
+		Updates(map[string]interface{}{
+			"status":        EmailStatusPending,
+			"parked_at":     time.Now(),
+			"next_retry_at": nil,
+		}).Error
+}
+
+// CountParkedEmails counts the emails parked on each of the SMTP configs
+func CountParkedEmails(smtpConfigIDs []string, db *gorm.DB) (map[string]int64, error) {
+	var rows []struct {
+		SMTPConfigID string
+		Count        int64
+	}
+	if err := db.Model(&Email{}).
+		Select("smtp_config_id, COUNT(*) AS count").
+		Where("smtp_config_id IN ? AND parked_at IS NOT NULL AND status = ? AND is_deleted = false", smtpConfigIDs, EmailStatusPending).
+		Group("smtp_config_id").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		counts[row.SMTPConfigID] = row.Count
+	}
+	return counts, nil
+}
@@ -0,0 +1,135 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// maxSnippetDepth is how deep snippets may include other snippets
+const maxSnippetDepth = 5
+
+// MaxRenderedSize is the most bytes an email's html may take once its snippets are expanded or
+// its template is rendered
+const MaxRenderedSize = 5 << 20
+
+// ErrSnippetsTooLarge is returned when expanding snippets would pass MaxRenderedSize, e.g. with
+// snippets including each other many times over
+var ErrSnippetsTooLarge = fmt.Errorf("snippets expand to more than %d bytes", MaxRenderedSize)
+
+var (
+	// snippetRe matches snippet includes such as {{> footer }}
+	snippetRe     = regexp.MustCompile(`{{>\s*([A-Za-z0-9_\-]+)\s*}}`)
+	snippetNameRe = regexp.MustCompile(`^[A-Za-z0-9_\-]+$`)
+)
+
+// Snippet is a piece of html shared by a team's templates, e.g. a header, a legal footer or a
+// signature. Templates include it as {{> name }} and it's resolved every time an email is
+// rendered, so changing it changes every template using it.
+type Snippet struct {
+	Base
+	Name        string `gorm:"not null;uniqueIndex:idx_snippet_team_name" json:"name" validate:"required,min=1,max=64"`
+	Description string `json:"description"`
+	Content     string `gorm:"type:text;not null;default:''" json:"content"` // may include other snippets, content blocks and variables
+	TeamID      string `gorm:"type:uuid;not null;uniqueIndex:idx_snippet_team_name" json:"teamId" validate:"required,uuid"`
+	Team        *Team  `json:"team,omitempty"`
+}
+
+func (s *Snippet) BeforeSave(tx *gorm.DB) error {
+	if !snippetNameRe.MatchString(s.Name) {
+		return fmt.Errorf("snippet name may only contain letters, digits, '-' and '_'")
+	}
+	return nil
+}
+
+// SnippetNames returns the snippet names included in the given html
+func SnippetNames(html ...string) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, h := range html {
+		for _, match := range snippetRe.FindAllStringSubmatch(h, -1) {
+			if !seen[match[1]] {
+				seen[match[1]] = true
+				names = append(names, match[1])
+			}
+		}
+	}
+	return names
+}
+
+// RenderSnippets replaces the snippet includes of each html with the team's snippets, those
+// included by snippets too. Includes of snippets the team doesn't have render empty, as do
+// includes nested deeper than maxSnippetDepth, which also stops snippets including each other.
+// An html that would expand past MaxRenderedSize fails with ErrSnippetsTooLarge.
+func RenderSnippets(teamID string, html []string, db *gorm.DB) ([]string, error) {
+	rendered := make([]string, len(html))
+	copy(rendered, html)
+
+	contents := make(map[string]string)
+	for depth := 0; ; depth++ {
+		names := SnippetNames(rendered...)
+		if len(names) == 0 {
+			return rendered, nil
+		}
+		if depth == maxSnippetDepth {
+			for i := range rendered {
+				rendered[i] = snippetRe.ReplaceAllString(rendered[i], "")
+			}
+			return rendered, nil
+		}
+
+		var missing []string
+		for _, name := range names {
+			if _, ok := contents[name]; !ok {
+				missing = append(missing, name)
+			}
+		}
+		if len(missing) > 0 {
+			var snippets []Snippet
+			if err := db.Select("name", "content").
+				Where("team_id = ? AND name IN ? AND is_deleted = false", teamID, missing).Find(&snippets).Error; err != nil {
+				return nil, fmt.Errorf("failed to get snippets: %w", err)
+			}
+			for _, name := range missing {
+				contents[name] = ""
+			}
+			for _, snippet := range snippets {
+				contents[snippet.Name] = snippet.Content
+			}
+		}
+
+		for i := range rendered {
+			expanded, err := expandSnippets(rendered[i], contents)
+			if err != nil {
+				return nil, err
+			}
+			rendered[i] = expanded
+		}
+	}
+}
+
+// expandSnippets replaces the snippet includes of html with their contents, checking the size
+// of the result before building it so includes can't multiply past MaxRenderedSize
+func expandSnippets(html string, contents map[string]string) (string, error) {
+	matches := snippetRe.FindAllStringSubmatchIndex(html, -1)
+	size := len(html)
+	for _, match := range matches {
+		size += len(contents[html[match[2]:match[3]]]) - (match[1] - match[0])
+	}
+	if size > MaxRenderedSize {
+		return "", ErrSnippetsTooLarge
+	}
+
+	var expanded strings.Builder
+	expanded.Grow(size)
+	last := 0
+	for _, match := range matches {
+		expanded.WriteString(html[last:match[0]])
+		expanded.WriteString(contents[html[match[2]:match[3]]])
+		last = match[1]
+	}
+	expanded.WriteString(html[last:])
+	return expanded.String(), nil
+}
@@ -0,0 +1,296 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"kori/internal/utils/crypto"
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// SubscribeFormCaptcha is the captcha service a subscribe form checks submissions with
+type SubscribeFormCaptcha string
+
+const (
+	SubscribeFormCaptchaNone      SubscribeFormCaptcha = ""
+	SubscribeFormCaptchaTurnstile SubscribeFormCaptcha = "TURNSTILE"
+	SubscribeFormCaptchaHCaptcha  SubscribeFormCaptcha = "HCAPTCHA"
+	SubscribeFormCaptchaRecaptcha SubscribeFormCaptcha = "RECAPTCHA"
+)
+
+// SubscribeFormHoneypot is the hidden input of every form. People never see it, so a submission
+// that fills it in was made by a bot.
+const SubscribeFormHoneypot = "subscribe_website"
+
+// SubscribeForm is a public signup form adding the people who submit it to a mailing list, hosted
+// at /forms/:id or embedded in any page with a script tag
+type SubscribeForm struct {
+	Base
+	Name            string               `gorm:"not null" json:"name" validate:"required,min=2"`
+	Title           string               `json:"title" validate:"omitempty"` // heading of the form, none when empty
+	Description     string               `json:"description" validate:"omitempty"`
+	ButtonText      string               `gorm:"not null;default:'Subscribe'" json:"buttonText" validate:"omitempty"`
+	Fields          datatypes.JSON       `gorm:"type:jsonb;not null;default:'[]'" json:"fields" validate:"omitempty,json"` // a single email field when empty
+	SuccessMessage  string               `gorm:"not null;default:'Thanks for subscribing!'" json:"successMessage" validate:"omitempty"`
+	RedirectURL     string               `json:"redirectUrl" validate:"omitempty,url"` // where people go once they've submitted, instead of the success message
+	CaptchaProvider SubscribeFormCaptcha `json:"captchaProvider" validate:"omitempty,oneof=TURNSTILE HCAPTCHA RECAPTCHA"`
+	CaptchaSiteKey  string               `json:"captchaSiteKey" validate:"omitempty"`
+	CaptchaSecret   string               `json:"captchaSecret" validate:"omitempty" audit:"redact"`
+	IsActive        bool                 `gorm:"not null;default:true" json:"isActive"`
+	Submissions     int64                `gorm:"not null;default:0" json:"submissions"`
+	LastSubmittedAt *time.Time           `json:"lastSubmittedAt,omitempty"`
+	ListID          string               `gorm:"type:uuid;not null" json:"listId" validate:"required,uuid"`
+	List            *MailingList         `json:"list,omitempty"`
+	TeamID          string               `gorm:"type:uuid;not null;index" json:"teamId" validate:"required,uuid"`
+	Team            *Team                `json:"team,omitempty"`
+}
+
+// SubscribeFormField is one input of a subscribe form and the contact field it fills in
+type SubscribeFormField struct {
+	Name        string `json:"name"` // of the input, what submissions send the value as
+	Label       string `json:"label"`
+	Type        string `json:"type"` // text, email, tel, number, textarea, checkbox or hidden
+	Placeholder string `json:"placeholder,omitempty"`
+	Required    bool   `json:"required"`
+	MapsTo      string `json:"mapsTo"`          // a contact field like first_name, or metadata.<key>
+	Value       string `json:"value,omitempty"` // what hidden inputs always send
+}
+
+// SubscribeFormError is returned when a submission can't be accepted, with what's wrong with each field
+type SubscribeFormError struct {
+	ValidationError
+	Fields map[string]string `json:"fields,omitempty"` // input name -> what's wrong with it
+}
+
+var (
+	subscribeFormFieldPattern = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_-]*$`)
+	subscribeFormFieldTypes   = map[string]bool{
+		"text": true, "email": true, "tel": true, "number": true, "textarea": true, "checkbox": true, "hidden": true,
+	}
+)
+
+// subscribeFormContactFields are the contact fields form inputs may fill in
+var subscribeFormContactFields = map[string]func(*Contact, string){
+	"email":      func(c *Contact, v string) { c.Email = v },
+	"first_name": func(c *Contact, v string) { c.FirstName = v },
+	"last_name":  func(c *Contact, v string) { c.LastName = v },
+	"company":    func(c *Contact, v string) { c.Company = v },
+	"phone":      func(c *Contact, v string) { c.Phone = v },
+	"country":    func(c *Contact, v string) { c.Country = v },
+	"city":       func(c *Contact, v string) { c.City = v },
+	"state":      func(c *Contact, v string) { c.State = v },
+	"zip":        func(c *Contact, v string) { c.Zip = v },
+	"address":    func(c *Contact, v string) { c.Address = v },
+	"locale":     func(c *Contact, v string) { c.Locale = v },
+	"timezone": func(c *Contact, v string) {
+		// Browsers send what they detect, which is only kept when it's a real zone
+		if _, err := time.LoadLocation(v); err == nil {
+			c.Timezone = v
+		}
+	},
+}
+
+// defaultSubscribeFormFields is what forms without fields of their own ask for
+var defaultSubscribeFormFields = []SubscribeFormField{
+	{Name: "email", Label: "Email", Type: "email", Placeholder: "you@example.com", Required: true, MapsTo: "email"},
+}
+
+// FormFields decodes the form's inputs
+func (f *SubscribeForm) FormFields() ([]SubscribeFormField, error) {
+	if len(f.Fields) == 0 || string(f.Fields) == "null" {
+		return defaultSubscribeFormFields, nil
+	}
+	var fields []SubscribeFormField
+	if err := json.Unmarshal(f.Fields, &fields); err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return defaultSubscribeFormFields, nil
+	}
+	return fields, nil
+}
+
+func (f *SubscribeForm) validate(tx *gorm.DB) error {
+	fields, err := f.FormFields()
+	if err != nil {
+		return &ValidationError{Message: fmt.Sprintf("invalid fields: %v", err)}
+	}
+
+	names := map[string]bool{SubscribeFormHoneypot: true}
+	mapsEmail := false
+	for i, field := range fields {
+		if !subscribeFormFieldPattern.MatchString(field.Name) {
+			return &ValidationError{Message: fmt.Sprintf("field %d needs a name of letters, digits, dashes and underscores", i+1)}
+		}
+		if names[field.Name] {
+			return &ValidationError{Message: fmt.Sprintf("field name %s is used twice or reserved", field.Name)}
+		}
+		names[field.Name] = true
+
+		if field.Type != "" && !subscribeFormFieldTypes[field.Type] {
+			return &ValidationError{Message: fmt.Sprintf("field %s has an unknown type %s", field.Name, field.Type)}
+		}
+		key, isMetadata := strings.CutPrefix(field.MapsTo, "metadata.")
+		if isMetadata && key == "" {
+			return &ValidationError{Message: fmt.Sprintf("field %s maps to metadata without a key", field.Name)}
+		}
+		if _, known := subscribeFormContactFields[field.MapsTo]; !known && !isMetadata {
+			return &ValidationError{Message: fmt.Sprintf("field %s maps to unknown contact field %q", field.Name, field.MapsTo)}
+		}
+		if field.MapsTo == "email" {
+			if !field.Required || field.Type == "hidden" {
+				return &ValidationError{Message: "the email field must be required and visible"}
+			}
+			mapsEmail = true
+		}
+	}
+	if !mapsEmail {
+		return &ValidationError{Message: "forms need a field mapped to email"}
+	}
+
+	if f.CaptchaProvider != SubscribeFormCaptchaNone && (f.CaptchaSiteKey == "" || f.CaptchaSecret == "") {
+		return &ValidationError{Message: "a captcha needs its site key and secret"}
+	}
+
+	// The list must be the team's own
+	var count int64
+	if err := tx.Session(&gorm.Session{NewDB: true}).Model(&MailingList{}).
+		Where("id = ? AND team_id = ? AND is_deleted = false", f.ListID, f.TeamID).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return &ValidationError{Message: "list not found"}
+	}
+	return nil
+}
+
+func (f *SubscribeForm) BeforeCreate(tx *gorm.DB) error {
+	if err := f.Base.BeforeCreate(tx); err != nil {
+		return err
+	}
+	if err := f.validate(tx); err != nil {
+		return err
+	}
+	secret, err := crypto.Encrypt(f.CaptchaSecret)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt captcha secret: %w", err)
+	}
+	f.CaptchaSecret = secret
+	return nil
+}
+
+func (f *SubscribeForm) BeforeUpdate(tx *gorm.DB) error {
+	if err := f.validate(tx); err != nil {
+		return err
+	}
+	secret, err := crypto.Encrypt(f.CaptchaSecret)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt captcha secret: %w", err)
+	}
+	f.CaptchaSecret = secret
+	return nil
+}
+
+func (f *SubscribeForm) AfterFind(tx *gorm.DB) error {
+	secret, err := crypto.Decrypt(f.CaptchaSecret)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt captcha secret: %w", err)
+	}
+	f.CaptchaSecret = secret
+	return nil
+}
+
+// GetActiveSubscribeForm returns a form that accepts submissions
+func GetActiveSubscribeForm(id string, db *gorm.DB) (*SubscribeForm, error) {
+	form := &SubscribeForm{}
+	if err := db.Where("id = ? AND is_active = true AND is_deleted = false", id).First(form).Error; err != nil {
+		return nil, err
+	}
+	return form, nil
+}
+
+// SubmitSubscribeForm adds whoever submitted the form to its list, with the values of its inputs.
+// Addresses already on the list are left as they are, and the form answers the same either way so
+// it can't be used to find out who's subscribed. Lists that require confirmation hold the new
+// contact as PENDING until they confirm.
+func SubmitSubscribeForm(form *SubscribeForm, values map[string]string, db *gorm.DB) (*Contact, error) {
+	fields, err := form.FormFields()
+	if err != nil {
+		return nil, err
+	}
+
+	contact := &Contact{
+		ListID: form.ListID,
+		TeamID: form.TeamID,
+		Status: SubscriberStatusActive,
+	}
+	metadata := map[string]string{}
+	problems := map[string]string{}
+	for _, field := range fields {
+		value := strings.TrimSpace(values[field.Name])
+		if field.Type == "hidden" {
+			value = field.Value
+		}
+		if value == "" {
+			if field.Required {
+				problems[field.Name] = "required"
+			}
+			continue
+		}
+
+		if field.MapsTo == "email" {
+			address, err := mail.ParseAddress(value)
+			if err != nil {
+				problems[field.Name] = "not a valid email address"
+				continue
+			}
+			value = strings.ToLower(address.Address)
+		}
+
+		if key, isMetadata := strings.CutPrefix(field.MapsTo, "metadata."); isMetadata {
+			metadata[key] = value
+		} else {
+			subscribeFormContactFields[field.MapsTo](contact, value)
+		}
+	}
+	if len(problems) > 0 {
+		return nil, &SubscribeFormError{ValidationError: ValidationError{Message: "some fields are missing or invalid"}, Fields: problems}
+	}
+
+	metadataJSON, err := json.Marshal(metadata)
+	if err != nil {
+		return nil, err
+	}
+	contact.Metadata = metadataJSON
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		existing := &Contact{}
+		err := tx.Where("list_id = ? AND LOWER(email) = ? AND is_deleted = false", form.ListID, contact.Email).First(existing).Error
+		switch {
+		case err == nil:
+			contact = existing
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			if err := tx.Create(contact).Error; err != nil {
+				return err
+			}
+		default:
+			return err
+		}
+
+		return tx.Model(&SubscribeForm{}).Where("id = ?", form.ID).UpdateColumns(map[string]interface{}{
+			"submissions":       gorm.Expr("submissions + 1"),
+			"last_submitted_at": time.Now(),
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return contact, nil
+}
@@ -29,8 +29,18 @@ const (
 	FeatureTeamCollaboration ProductFeature = "team_collaboration"
 	FeatureAutomation        ProductFeature = "automation"
 	FeatureSegmentation      ProductFeature = "segmentation"
+	FeatureMonthlyEmails     ProductFeature = "monthly_emails"
+	FeatureContacts          ProductFeature = "contacts"
 )
 
+// FreeTierFeatures are the features teams without an active subscription get, with their limits
+var FreeTierFeatures = map[ProductFeature]int{
+	FeatureEmailCampaigns:  100,
+	FeatureTemplateLibrary: 5,
+	FeatureMonthlyEmails:   DefaultMonthlyEmailQuota,
+	FeatureContacts:        DefaultContactQuota,
+}
+
 // Product represents a subscription product
 type Product struct {
 	Base
@@ -0,0 +1,161 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+
+	"gorm.io/gorm"
+)
+
+// Translation unit IDs of a template's strings other than the text of its html
+const (
+	TranslationUnitSubject   = "subject"
+	TranslationUnitPreheader = "preheader"
+	TranslationUnitPlainText = "plainText"
+)
+
+// TranslationString is a string of a template a translator translates, with the ID it has in
+// exported files: subject, preheader, plainText, or html.N for the Nth text of the html
+type TranslationString struct {
+	ID   string `json:"id"`
+	Text string `json:"text"`
+}
+
+// TemplateTranslationStatus is how a translation compares to its source template as it is now
+type TemplateTranslationStatus struct {
+	Template       *Template           `json:"template"`
+	SourceVersion  int                 `json:"sourceVersion"`  // the source's version last imported
+	CurrentVersion int                 `json:"currentVersion"` // the source's version now
+	Translated     int                 `json:"translated"`
+	Total          int                 `json:"total"`
+	Outdated       bool                `json:"outdated"`     // the source changed since, or has strings the translation lacks
+	Untranslated   []TranslationString `json:"untranslated"` // strings added or edited in the source since
+}
+
+// GetTranslationMemory returns a translation's source strings, each with its translation
+func (t *Template) GetTranslationMemory() (map[string]string, error) {
+	memory := map[string]string{}
+	if len(t.Translations) == 0 {
+		return memory, nil
+	}
+	if err := json.Unmarshal(t.Translations, &memory); err != nil {
+		return nil, fmt.Errorf("failed to read translations of template %s: %w", t.ID, err)
+	}
+	return memory, nil
+}
+
+// SetTranslationMemory stores a translation's source strings with their translations
+func (t *Template) SetTranslationMemory(memory map[string]string) error {
+	translations, err := json.Marshal(memory)
+	if err != nil {
+		return err
+	}
+	t.Translations = translations
+	return nil
+}
+
+// TranslationFor returns the translation of a source string, or the string itself when it has none
+func TranslationFor(memory map[string]string, text string) string {
+	if translated := memory[text]; translated != "" {
+		return translated
+	}
+	return text
+}
+
+// GetTemplateTranslations returns the translations of a template, by language
+func GetTemplateTranslations(templateID string, db *gorm.DB) ([]Template, error) {
+	var translations []Template
+	if err := db.Where("source_template_id = ? AND is_deleted = false", templateID).
+		Order("language").
+		Find(&translations).Error; err != nil {
+		return nil, err
+	}
+	return translations, nil
+}
+
+// GetTemplateTranslation returns the translation of a template into a language, nil if it has none
+func GetTemplateTranslation(templateID, language string, db *gorm.DB) (*Template, error) {
+	translation := &Template{}
+	if err := db.Where("source_template_id = ? AND language = ? AND is_deleted = false", templateID, NormalizeLanguage(language)).
+		First(translation).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return translation, nil
+}
+
+// GetTemplateCurrentVersion returns the version a template's content is at, 0 before any is recorded
+func GetTemplateCurrentVersion(templateID string, db *gorm.DB) (int, error) {
+	var version int
+	if err := db.Model(&TemplateVersion{}).Where("template_id = ?", templateID).
+		Select("COALESCE(MAX(version), 0)").Scan(&version).Error; err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+// NewTemplateTranslationStatus compares a translation with the strings of its source as they
+// are now
+func NewTemplateTranslationStatus(translation *Template, sources []TranslationString, currentVersion int) (*TemplateTranslationStatus, error) {
+	memory, err := translation.GetTranslationMemory()
+	if err != nil {
+		return nil, err
+	}
+	status := &TemplateTranslationStatus{
+		Template:       translation,
+		SourceVersion:  translation.SourceVersion,
+		CurrentVersion: currentVersion,
+		Untranslated:   []TranslationString{},
+	}
+	seen := map[string]bool{}
+	for _, source := range sources {
+		if seen[source.Text] {
+			continue
+		}
+		seen[source.Text] = true
+		status.Total++
+		if memory[source.Text] != "" {
+			status.Translated++
+		} else {
+			status.Untranslated = append(status.Untranslated, source)
+		}
+	}
+	// A translation is built from its source's html when imported, so any change to the source,
+	// even one with nothing to translate, takes another import to show
+	status.Outdated = len(status.Untranslated) > 0 || currentVersion > translation.SourceVersion
+	return status, nil
+}
+
+// MergeTranslationMemory adds imported translations to a translation's memory, keeping the
+// ones of strings the import leaves out so a partial file only updates what it has
+func MergeTranslationMemory(memory map[string]string, imported map[string]string) map[string]string {
+	merged := make(map[string]string, len(memory)+len(imported))
+	for source, target := range memory {
+		merged[source] = target
+	}
+	for source, target := range imported {
+		if target != "" {
+			merged[source] = target
+		}
+	}
+	return merged
+}
+
+// PruneTranslationMemory drops the translations of strings the source no longer has
+func PruneTranslationMemory(memory map[string]string, sources []TranslationString) map[string]string {
+	texts := make([]string, len(sources))
+	for i, source := range sources {
+		texts[i] = source.Text
+	}
+	pruned := map[string]string{}
+	for source, target := range memory {
+		if slices.Contains(texts, source) {
+			pruned[source] = target
+		}
+	}
+	return pruned
+}
@@ -0,0 +1,143 @@
+package models
+
+import (
+	"fmt"
+	"net/http"
+
+	"gorm.io/gorm"
+)
+
+// TemplateReference is something that sends with a template
+type TemplateReference struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Status string `json:"status,omitempty"`
+	// Blocking references break when the template goes away: campaigns that still have sends
+	// ahead of them, active automations and team settings
+	Blocking bool `json:"blocking"`
+}
+
+// TemplateUsage lists everything referencing a template
+type TemplateUsage struct {
+	TemplateID       string              `json:"templateId"`
+	Campaigns        []TemplateReference `json:"campaigns"`
+	CampaignVariants []TemplateReference `json:"campaignVariants"`
+	Automations      []TemplateReference `json:"automations"`
+	TeamSettings     []string            `json:"teamSettings"` // "invite" and/or "welcome"
+	InUse            bool                `json:"inUse"`
+}
+
+// TemplateInUseError is returned when deleting a template that is still referenced
+type TemplateInUseError struct {
+	Usage *TemplateUsage
+}
+
+func (e *TemplateInUseError) Error() string {
+	return fmt.Sprintf("template is used by %d campaigns, %d campaign variants, %d automations and %d team settings",
+		len(e.Usage.Campaigns), len(e.Usage.CampaignVariants), len(e.Usage.Automations), len(e.Usage.TeamSettings))
+}
+
+func (e *TemplateInUseError) StatusCode() int {
+	return http.StatusConflict
+}
+
+// campaignStillSends reports whether a campaign will send again: it hasn't finished, or it recurs
+func campaignStillSends(status CampaignStatus, cronExpression string) bool {
+	switch status {
+	case CampaignStatusFailed, CampaignStatusCancelled:
+		return false
+	case CampaignStatusCompleted:
+		return cronExpression != ""
+	}
+	return true
+}
+
+// GetTemplateUsage finds the campaigns, campaign variants, automations and team settings of a team using a template
+func GetTemplateUsage(teamID, templateID string, db *gorm.DB) (*TemplateUsage, error) {
+	usage := &TemplateUsage{
+		TemplateID:       templateID,
+		Campaigns:        []TemplateReference{},
+		CampaignVariants: []TemplateReference{},
+		Automations:      []TemplateReference{},
+		TeamSettings:     []string{},
+	}
+
+	var campaigns []Campaign
+	if err := db.Select("id", "name", "status", "cron_expression").
+		Where("team_id = ? AND template_id = ? AND is_deleted = false", teamID, templateID).
+		Order("created_at DESC").
+		Find(&campaigns).Error; err != nil {
+		return nil, fmt.Errorf("failed to get campaigns: %w", err)
+	}
+	for _, campaign := range campaigns {
+		usage.Campaigns = append(usage.Campaigns, TemplateReference{
+			ID:       campaign.ID,
+			Name:     campaign.Name,
+			Status:   string(campaign.Status),
+			Blocking: campaignStillSends(campaign.Status, campaign.CronExpression),
+		})
+	}
+
+	var variants []struct {
+		ID             string
+		Name           string
+		CampaignName   string
+		Status         CampaignStatus
+		CronExpression string
+	}
+	if err := db.Table("campaign_variants").
+		Select("campaign_variants.id, campaign_variants.name, campaigns.name AS campaign_name, campaigns.status, campaigns.cron_expression").
+		Joins("JOIN campaigns ON campaigns.id = campaign_variants.campaign_id AND campaigns.is_deleted = false").
+		Where("campaign_variants.team_id = ? AND campaign_variants.template_id = ? AND campaign_variants.is_deleted = false", teamID, templateID).
+		Scan(&variants).Error; err != nil {
+		return nil, fmt.Errorf("failed to get campaign variants: %w", err)
+	}
+	for _, variant := range variants {
+		usage.CampaignVariants = append(usage.CampaignVariants, TemplateReference{
+			ID:       variant.ID,
+			Name:     fmt.Sprintf("%s / %s", variant.CampaignName, variant.Name),
+			Status:   string(variant.Status),
+			Blocking: campaignStillSends(variant.Status, variant.CronExpression),
+		})
+	}
+
+	var automations []Automation
+	if err := db.Distinct("automations.id", "automations.name", "automations.is_active").
+		Joins("JOIN automation_nodes ON automation_nodes.automation_id = automations.id AND automation_nodes.is_deleted = false").
+		Where("automations.team_id = ? AND automations.is_deleted = false AND automation_nodes.data ->> 'templateId' = ?", teamID, templateID).
+		Find(&automations).Error; err != nil {
+		return nil, fmt.Errorf("failed to get automations: %w", err)
+	}
+	for _, automation := range automations {
+		status := "inactive"
+		if automation.IsActive {
+			status = "active"
+		}
+		usage.Automations = append(usage.Automations, TemplateReference{
+			ID:       automation.ID,
+			Name:     automation.Name,
+			Status:   status,
+			Blocking: automation.IsActive,
+		})
+	}
+
+	var settings TeamSettings
+	if err := db.Where("team_id = ?", teamID).Limit(1).Find(&settings).Error; err != nil {
+		return nil, fmt.Errorf("failed to get team settings: %w", err)
+	}
+	if settings.InviteTemplateID == templateID {
+		usage.TeamSettings = append(usage.TeamSettings, "invite")
+	}
+	if settings.WelcomeTemplateID == templateID {
+		usage.TeamSettings = append(usage.TeamSettings, "welcome")
+	}
+
+	usage.InUse = len(usage.TeamSettings) > 0
+	for _, refs := range [][]TemplateReference{usage.Campaigns, usage.CampaignVariants, usage.Automations} {
+		for _, ref := range refs {
+			usage.InUse = usage.InUse || ref.Blocking
+		}
+	}
+
+	return usage, nil
+}
@@ -0,0 +1,102 @@
+package models
+
+import (
+	"errors"
+	"slices"
+
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+)
+
+// ErrTemplateVersionImmutable is returned when a recorded template version is changed
+var ErrTemplateVersionImmutable = errors.New("template versions can't be changed")
+
+// TemplateVersion is the content of a template after one of its changes. A version is recorded
+// when a template is created and whenever its subject, html file or variables change.
+type TemplateVersion struct {
+	Base
+	TemplateID string         `gorm:"type:uuid;not null;uniqueIndex:idx_template_version" json:"templateId"`
+	Version    int            `gorm:"not null;uniqueIndex:idx_template_version" json:"version"`
+	Name       string         `gorm:"not null" json:"name"`
+	Subject    string         `gorm:"not null" json:"subject"`
+	HtmlFileID string         `gorm:"type:uuid;default:NULL" json:"htmlFileId"`
+	HtmlFile   *File          `json:"htmlFile,omitempty"`
+	Variables  pq.StringArray `gorm:"type:text[]" json:"variables"`
+	TeamID     string         `gorm:"type:uuid;not null" json:"teamId"`
+}
+
+func (v *TemplateVersion) BeforeUpdate(tx *gorm.DB) error {
+	return ErrTemplateVersionImmutable
+}
+
+func (v *TemplateVersion) BeforeDelete(tx *gorm.DB) error {
+	return ErrTemplateVersionImmutable
+}
+
+func (t *Template) AfterCreate(tx *gorm.DB) error {
+	_, err := RecordTemplateVersion(t.ID, tx.Session(&gorm.Session{NewDB: true}))
+	return err
+}
+
+func (t *Template) AfterUpdate(tx *gorm.DB) error {
+	_, err := RecordTemplateVersion(t.ID, tx.Session(&gorm.Session{NewDB: true}))
+	return err
+}
+
+// RecordTemplateVersion records the template's current content as its next version, unless it
+// matches the latest version already. It returns the version the content is at.
+func RecordTemplateVersion(templateID string, db *gorm.DB) (*TemplateVersion, error) {
+	if templateID == "" {
+		return nil, nil
+	}
+	var template Template
+	if err := db.Where("id = ?", templateID).First(&template).Error; err != nil {
+		return nil, err
+	}
+
+	var latest TemplateVersion
+	err := db.Where("template_id = ?", templateID).Order("version DESC").First(&latest).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	if err == nil && latest.Subject == template.Subject && latest.HtmlFileID == template.HtmlFileID &&
+		slices.Equal(latest.Variables, template.Variables) {
+		return &latest, nil
+	}
+
+	version := &TemplateVersion{
+		TemplateID: template.ID,
+		Version:    latest.Version + 1,
+		Name:       template.Name,
+		Subject:    template.Subject,
+		HtmlFileID: template.HtmlFileID,
+		Variables:  template.Variables,
+		TeamID:     template.TeamID,
+	}
+	if err := db.Create(version).Error; err != nil {
+		return nil, err
+	}
+	return version, nil
+}
+
+// GetTemplateVersions returns a template's versions, newest first
+func GetTemplateVersions(templateID string, db *gorm.DB) ([]TemplateVersion, error) {
+	var versions []TemplateVersion
+	if err := db.Where("template_id = ? AND is_deleted = false", templateID).
+		Order("version DESC").
+		Find(&versions).Error; err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
+
+// GetTemplateVersion returns one version of a template with its html file
+func GetTemplateVersion(templateID string, version int, db *gorm.DB) (*TemplateVersion, error) {
+	var v TemplateVersion
+	if err := db.Preload("HtmlFile").
+		Where("template_id = ? AND version = ? AND is_deleted = false", templateID, version).
+		First(&v).Error; err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
@@ -0,0 +1,71 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// TrackingDomain is a team's own hostname for tracking links, such as track.customer.com, so
+// the links in its emails don't all point at the shared public URL. It is in use once its
+// CNAME points at the public host.
+type TrackingDomain struct {
+	Base
+	TeamID        string             `gorm:"type:uuid;not null;uniqueIndex" json:"teamId"`
+	Domain        string             `gorm:"not null;uniqueIndex" json:"domain"`
+	Status        DomainRecordStatus `gorm:"not null;default:'PENDING'" json:"status"`
+	Check         datatypes.JSON     `gorm:"type:jsonb;default:'{}'" json:"check"`
+	VerifiedAt    *time.Time         `json:"verifiedAt,omitempty"`
+	LastCheckedAt time.Time          `gorm:"default:NULL" json:"lastCheckedAt"`
+}
+
+// IsVerified reports whether tracking links can use the domain
+func (d *TrackingDomain) IsVerified() bool {
+	return d.Status == DomainRecordStatusVerified
+}
+
+// ApplyCheck stores the outcome of checking the domain's CNAME
+func (d *TrackingDomain) ApplyCheck(check DomainRecordCheck, checkedAt time.Time) error {
+	data, err := json.Marshal(check)
+	if err != nil {
+		return fmt.Errorf("failed to marshal tracking domain check: %w", err)
+	}
+	d.Check = data
+	d.Status = check.Status
+	d.LastCheckedAt = checkedAt
+	if check.Status != DomainRecordStatusVerified {
+		d.VerifiedAt = nil
+	} else if d.VerifiedAt == nil {
+		d.VerifiedAt = &checkedAt
+	}
+	return nil
+}
+
+// GetTeamTrackingDomain returns a team's tracking domain, nil when it has none
+func GetTeamTrackingDomain(teamID string, db *gorm.DB) (*TrackingDomain, error) {
+	domain := &TrackingDomain{}
+	if err := db.Where("team_id = ?", teamID).First(domain).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return domain, nil
+}
+
+// GetTrackingDomainByHost returns the tracking domain registered for a hostname, nil when no
+// team registered it
+func GetTrackingDomainByHost(host string, db *gorm.DB) (*TrackingDomain, error) {
+	domain := &TrackingDomain{}
+	if err := db.Where("domain = ?", host).First(domain).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return domain, nil
+}
@@ -0,0 +1,53 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// MinTrackingRetentionDays keeps the raw events segments, lead scores and send time
+	// optimization look back over
+	MinTrackingRetentionDays = 30
+	// MaxTrackingRetentionDays is the longest retention a team can set short of keeping everything
+	MaxTrackingRetentionDays = 3650
+	// trackingPruneBatch is how many events one pruning statement deletes
+	trackingPruneBatch = 10000
+)
+
+// TrackingPruneCutoff returns the time before which a team's raw tracking events can go: the
+// start of its retention, but never past the events the rollups have aggregated. The hour the
+// rollups restate is kept too.
+func TrackingPruneCutoff(retentionDays int, watermark, now time.Time) time.Time {
+	cutoff := now.AddDate(0, 0, -retentionDays)
+	if rolled := watermark.Add(-rollupRestate); rolled.Before(cutoff) {
+		cutoff = rolled
+	}
+	return cutoff
+}
+
+// PruneTrackingEvents deletes the raw tracking events of a team's emails from before a time, a
+// batch at a time so each statement stays short, and records the cutoff on its settings. It
+// returns how many events were deleted.
+func PruneTrackingEvents(teamID string, before time.Time, db *gorm.DB) (int64, error) {
+	var pruned int64
+	for {
+		result := db.Exec(`DELETE FROM email_trackings WHERE id IN (
+			SELECT email_trackings.id FROM email_trackings JOIN emails ON emails.id = email_trackings.email_id
+			WHERE emails.team_id = ? AND email_trackings.timestamp < ?
+			LIMIT ?)`, teamID, before, trackingPruneBatch)
+		if result.Error != nil {
+			return pruned, result.Error
+		}
+		pruned += result.RowsAffected
+		if result.RowsAffected < trackingPruneBatch {
+			break
+		}
+	}
+
+	err := db.Model(&TeamSettings{}).
+		Where("team_id = ? AND (tracking_pruned_before IS NULL OR tracking_pruned_before < ?)", teamID, before).
+		UpdateColumn("tracking_pruned_before", before).Error
+	return pruned, err
+}
@@ -0,0 +1,218 @@
+package models
+
+import (
+	"archive/zip"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+)
+
+// WorkspaceDeletionGracePeriod is how long a team can restore its workspace after asking for
+// it to be deleted
+const WorkspaceDeletionGracePeriod = 7 * 24 * time.Hour
+
+type WorkspaceDeletionStatus string
+
+const (
+	WorkspaceDeletionStatusScheduled WorkspaceDeletionStatus = "SCHEDULED"
+	WorkspaceDeletionStatusCancelled WorkspaceDeletionStatus = "CANCELLED"
+	WorkspaceDeletionStatusPurging   WorkspaceDeletionStatus = "PURGING"
+	WorkspaceDeletionStatusPurged    WorkspaceDeletionStatus = "PURGED"
+	WorkspaceDeletionStatusFailed    WorkspaceDeletionStatus = "FAILED"
+)
+
+// WorkspaceDeletion is a team's request to have all of its data removed. The team is soft
+// deleted straight away and purged once PurgeAt passes. The record outlives the team so the
+// deletion can be accounted for.
+type WorkspaceDeletion struct {
+	Base
+	TeamID            string                  `gorm:"type:uuid;not null;index" json:"teamId"`
+	TeamName          string                  `gorm:"not null" json:"teamName"`
+	RequestedByID     string                  `gorm:"type:uuid;not null" json:"requestedById"`
+	RequestedByEmail  string                  `gorm:"not null" json:"requestedByEmail"`
+	Status            WorkspaceDeletionStatus `gorm:"not null;default:'SCHEDULED'" json:"status"`
+	PurgeAt           time.Time               `gorm:"not null" json:"purgeAt"`
+	PausedCampaignIDs pq.StringArray          `gorm:"type:text[]" json:"pausedCampaignIds"` // resumed when the workspace is restored
+	Attempts          int                     `gorm:"not null;default:0" json:"attempts"`
+	ExportPath        string                  `json:"exportPath,omitempty"`      // storage key of the final export archive
+	ExportExpiresAt   *time.Time              `json:"exportExpiresAt,omitempty"` // when its link expires and the archive is deleted
+	Error             string                  `json:"error,omitempty"`
+	CancelledAt       *time.Time              `json:"cancelledAt,omitempty"`
+	PurgedAt          *time.Time              `json:"purgedAt,omitempty"`
+}
+
+// GetPendingWorkspaceDeletion returns the team's deletion that hasn't been cancelled or purged yet
+func GetPendingWorkspaceDeletion(teamID string, db *gorm.DB) (*WorkspaceDeletion, error) {
+	deletion := &WorkspaceDeletion{}
+	if err := db.Where("team_id = ? AND status IN ? AND is_deleted = false", teamID, []WorkspaceDeletionStatus{
+		WorkspaceDeletionStatusScheduled,
+		WorkspaceDeletionStatusPurging,
+	}).Order("created_at DESC").First(deletion).Error; err != nil {
+		return nil, err
+	}
+	return deletion, nil
+}
+
+// IsTeamDeleted reports whether a team has been soft deleted, e.g. while its workspace waits to be purged
+func IsTeamDeleted(teamID string, db *gorm.DB) bool {
+	var count int64
+	db.Model(&Team{}).Where("id = ? AND is_deleted = true", teamID).Count(&count)
+	return count > 0
+}
+
+// teamTable is a table holding team data and the condition selecting a team's rows in it
+type teamTable struct {
+	name    string
+	where   string   // uses @team for the team ID
+	secrets []string // columns left out of the export
+	private bool     // not exported at all
+}
+
+// teamTables lists every table with team data. Rows that belong to a team through a parent
+// come before the parent so they can still be found while the purge runs.
+var teamTables = []teamTable{
+	{name: "automation_run_steps", where: "run_id IN (SELECT id FROM automation_runs WHERE team_id = @team)"},
+	{name: "automation_runs", where: "team_id = @team"},
+	{name: "automation_node_edges", where: "automation_id IN (SELECT id FROM automations WHERE team_id = @team)"},
+	{name: "automation_nodes", where: "automation_id IN (SELECT id FROM automations WHERE team_id = @team)"},
+	{name: "llm_email_writer_jobs", where: "team_id = @team OR automation_id IN (SELECT id FROM automations WHERE team_id = @team)"},
+	{name: "automations", where: "team_id = @team"},
+	{name: "sms_messages", where: "team_id = @team"},
+	{name: "sms_fallback_rules", where: "team_id = @team"},
+	{name: "sms_configs", where: "team_id = @team", secrets: []string{"auth_token"}},
+	{name: "email_trackings", where: "email_id IN (SELECT id FROM emails WHERE team_id = @team)"},
+	{name: "email_attachments", where: "team_id = @team"},
+	{name: "idempotency_keys", where: "team_id = @team", private: true},
+	{name: "emails", where: "team_id = @team"},
+	{name: "campaign_links", where: "team_id = @team"},
+	{name: "campaign_snapshots", where: "team_id = @team"},
+	{name: "analytics_reports", where: "team_id = @team"},
+	{name: "email_stats_hourly", where: "team_id = @team", private: true},
+	{name: "campaign_stats_daily", where: "team_id = @team", private: true},
+	{name: "alert_events", where: "team_id = @team"},
+	{name: "alert_rules", where: "team_id = @team"},
+	{name: "campaign_variants", where: "team_id = @team"},
+	{name: "campaign_languages", where: "team_id = @team"},
+	{name: "campaign_exclusions", where: "team_id = @team"},
+	{name: "campaigns", where: "team_id = @team"},
+	{name: "content_block_variants", where: "team_id = @team"},
+	{name: "content_blocks", where: "team_id = @team"},
+	{name: "snippets", where: "team_id = @team"},
+	{name: "contact_tags", where: "contact_id IN (SELECT id FROM contacts WHERE team_id = @team)"},
+	{name: "contacts", where: "team_id = @team"},
+	{name: "contact_preferences", where: "team_id = @team"},
+	{name: "contact_import_errors", where: "team_id = @team"},
+	{name: "contact_imports", where: "team_id = @team"},
+	{name: "contact_timeline_exports", where: "team_id = @team"},
+	{name: "contact_sync_sources", where: "team_id = @team", secrets: []string{"auth_header"}},
+	{name: "segments", where: "team_id = @team"},
+	{name: "subscribe_forms", where: "team_id = @team", secrets: []string{"captcha_secret"}},
+	{name: "mailing_lists", where: "team_id = @team"},
+	{name: "template_versions", where: "team_id = @team"},
+	{name: "templates", where: "team_id = @team"},
+	{name: "email_categories", where: "team_id = @team"},
+	{name: "files", where: "team_id = @team"},
+	{name: "tls_reports", where: "team_id = @team"},
+	{name: "domains", where: "team_id = @team"},
+	{name: "tracking_domains", where: "team_id = @team"},
+	{name: "deliveries", where: "webhook_id IN (SELECT id FROM webhooks WHERE team_id = @team)"},
+	{name: "webhooks", where: "team_id = @team", secrets: []string{"secret"}},
+	{name: "inbox_messages", where: "team_id = @team", secrets: []string{"search_vector"}},
+	{name: "inbox_conversations", where: "team_id = @team"},
+	{name: "inbox_folders", where: "team_id = @team"},
+	{name: "imap_configs", where: "team_id = @team", secrets: []string{"password", "oauth_access_token", "oauth_refresh_token"}},
+	{name: "smtp_configs", where: "team_id = @team", secrets: []string{"password", "oauth_access_token", "oauth_refresh_token"}},
+	{name: "scoring_endpoints", where: "team_id = @team", secrets: []string{"secret"}},
+	{name: "sender_personas", where: "team_id = @team"},
+	{name: "signatures", where: "team_id = @team"},
+	{name: "frequency_caps", where: "team_id = @team"},
+	{name: "lead_scoring_rules", where: "team_id = @team"},
+	{name: "computed_fields", where: "team_id = @team"},
+	{name: "reputation_metrics", where: "team_id = @team"},
+	{name: "reputation_connectors", where: "team_id = @team", secrets: []string{"snds_key", "oauth_access_token", "oauth_refresh_token"}},
+	{name: "blackout_dates", where: "team_id = @team"},
+	{name: "models", where: "team_id = @team"},
+	{name: "embed_tokens", where: "team_id = @team", private: true},
+	{name: "report_shares", where: "team_id = @team", private: true},
+	{name: "api_key_usage_hourly", where: "team_id = @team", private: true},
+	{name: "api_key_usages", where: "api_key_id IN (SELECT id FROM api_keys WHERE team_id = @team)"},
+	{name: "api_key_permissions", where: "key_id IN (SELECT id FROM api_keys WHERE team_id = @team)"},
+	{name: "rate_limits", where: "api_key_id IN (SELECT id FROM api_keys WHERE team_id = @team)", private: true},
+	{name: "api_keys", where: "team_id = @team", secrets: []string{"key_hash"}},
+	{name: "team_invites", where: "team_id = @team"},
+	{name: "audit_logs", where: "team_id = @team"},
+	{name: "quota_notifications", where: "team_id = @team"},
+	{name: "quota_counters", where: "team_id = @team", private: true},
+	{name: "onboarding_states", where: "team_id = @team"},
+	{name: "subscriptions", where: "team_id = @team"},
+	{name: "user_permissions", where: "user_id IN (SELECT id FROM users WHERE team_id = @team)"},
+	{name: "password_resets", where: "user_id IN (SELECT id FROM users WHERE team_id = @team)", private: true},
+	{name: "auth_transactions", where: "team_id = @team", private: true},
+	{name: "users", where: "team_id = @team", secrets: []string{"password"}},
+	{name: "roles", where: "team_id = @team"},
+	{name: "branding_settings", where: "id IN (SELECT branding_settings_id FROM team_settings WHERE team_id = @team)"},
+	{name: "team_settings", where: "team_id = @team"},
+	{name: "teams", where: "id = @team"},
+}
+
+// ExportTeamData writes a zip archive with one JSON lines file per table of the team's data.
+// Credentials and session tokens are left out.
+func ExportTeamData(teamID string, db *gorm.DB, w io.Writer) error {
+	archive := zip.NewWriter(w)
+
+	for _, table := range teamTables {
+		if table.private {
+			continue
+		}
+		if err := exportTeamTable(archive, table, teamID, db); err != nil {
+			return fmt.Errorf("failed to export %s: %w", table.name, err)
+		}
+	}
+
+	return archive.Close()
+}
+
+func exportTeamTable(archive *zip.Writer, table teamTable, teamID string, db *gorm.DB) error {
+	file, err := archive.Create(table.name + ".jsonl")
+	if err != nil {
+		return err
+	}
+
+	rows, err := db.Table(table.name).Where(table.where, sql.Named("team", teamID)).Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	encoder := json.NewEncoder(file)
+	for rows.Next() {
+		row := map[string]interface{}{}
+		if err := db.ScanRows(rows, &row); err != nil {
+			return err
+		}
+		for _, column := range table.secrets {
+			delete(row, column)
+		}
+		if err := encoder.Encode(row); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// PurgeTeamData hard deletes every row of the team's data, the team included
+func PurgeTeamData(teamID string, db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, table := range teamTables {
+			if err := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE %s", table.name, table.where), sql.Named("team", teamID)).Error; err != nil {
+				return fmt.Errorf("failed to purge %s: %w", table.name, err)
+			}
+		}
+		return nil
+	})
+}
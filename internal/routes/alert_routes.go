@@ -0,0 +1,26 @@
+package routes
+
+import (
+	"kori/internal/api/middleware"
+	"kori/internal/config"
+	"kori/internal/handlers"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+func SetupAlertRoutes(e *echo.Echo, config *config.Config, db *gorm.DB) {
+	alertHandler := handlers.NewAlertHandler(db)
+
+	// Create alert event routes group
+	alerts := e.Group("/api/v1/alert-events")
+
+	// Add authentication middleware
+	auth := middleware.NewAuthMiddleware(config.JWT.Secret)
+	alerts.Use(auth.Middleware())
+
+	alerts.Use(middleware.RequirePermissions(db, "alert_rules:read"))
+
+	// Alerts fired by campaign alert rules
+	alerts.GET("", alertHandler.ListAlertEvents)
+}
@@ -0,0 +1,33 @@
+package routes
+
+import (
+	"kori/internal/api/middleware"
+	"kori/internal/config"
+	"kori/internal/handlers"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+func SetupAPIKeyRoutes(e *echo.Echo, config *config.Config, db *gorm.DB) {
+	apiKeyHandler := handlers.NewAPIKeyHandler(db)
+
+	// Create api key routes group
+	apiKeys := e.Group("/api/v1/api-keys")
+
+	// Add authentication middleware
+	auth := middleware.NewAuthMiddleware(config.JWT.Secret)
+	apiKeys.Use(auth.Middleware())
+
+	// Keys are only listed by their prefix; the secret is returned once, on create and rotate
+	apiKeys.GET("", apiKeyHandler.ListAPIKeys, middleware.RequirePermissions(db, "api_keys:read"))
+	apiKeys.GET("/:id", apiKeyHandler.GetAPIKey, middleware.RequirePermissions(db, "api_keys:read"))
+	apiKeys.POST("", apiKeyHandler.CreateAPIKey, middleware.RequirePermissions(db, "api_keys:create"))
+	apiKeys.PUT("/:id", apiKeyHandler.UpdateAPIKey, middleware.RequirePermissions(db, "api_keys:update"))
+	apiKeys.POST("/:id/rotate", apiKeyHandler.RotateAPIKey, middleware.RequirePermissions(db, "api_keys:create"))
+	apiKeys.POST("/:id/revoke", apiKeyHandler.RevokeAPIKey, middleware.RequirePermissions(db, "api_keys:delete"))
+	apiKeys.DELETE("/:id", apiKeyHandler.DeleteAPIKey, middleware.RequirePermissions(db, "api_keys:delete"))
+
+	// What a key is used for, from the hourly usage rollup
+	apiKeys.GET("/:id/usage-summary", apiKeyHandler.GetUsageSummary, middleware.RequirePermissions(db, "api_key_usage:read"))
+}
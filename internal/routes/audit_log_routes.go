@@ -0,0 +1,27 @@
+package routes
+
+import (
+	"kori/internal/api/middleware"
+	"kori/internal/config"
+	"kori/internal/handlers"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+func SetupAuditLogRoutes(e *echo.Echo, config *config.Config, db *gorm.DB) {
+	auditLogHandler := handlers.NewAuditLogHandler(db)
+
+	// Create audit log routes group
+	auditLogs := e.Group("/api/v1/audit-logs")
+
+	// Add authentication middleware
+	auth := middleware.NewAuthMiddleware(config.JWT.Secret)
+	auditLogs.Use(auth.Middleware())
+
+	// Team admins only, members aren't given the permission
+	auditLogs.Use(middleware.RequirePermissions(db, "audit_logs:read"))
+
+	auditLogs.GET("", auditLogHandler.ListAuditLogs)
+	auditLogs.GET("/:id", auditLogHandler.GetAuditLog)
+}
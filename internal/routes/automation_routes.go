@@ -0,0 +1,28 @@
+package routes
+
+import (
+	"kori/internal/api/middleware"
+	"kori/internal/config"
+	"kori/internal/handlers"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+func SetupAutomationRoutes(e *echo.Echo, config *config.Config, db *gorm.DB) {
+	automationHandler := handlers.NewAutomationHandler(db)
+
+	// Create automation routes group
+	automations := e.Group("/api/v1/automations")
+
+	// Add authentication middleware
+	auth := middleware.NewAuthMiddleware(config.JWT.Secret)
+	automations.Use(auth.Middleware())
+
+	automations.Use(middleware.RequirePermissions(db, "automations:read"))
+
+	// Starting contacts on an automation and following their runs
+	automations.POST("/:id/enroll", automationHandler.EnrollContacts, middleware.RequirePermissions(db, "automations:write"))
+	automations.GET("/:id/runs", automationHandler.GetAutomationRuns)
+	automations.GET("/opt-out-rates", automationHandler.GetOptOutRates)
+}
@@ -0,0 +1,31 @@
+package routes
+
+import (
+	"kori/internal/api/middleware"
+	"kori/internal/config"
+	"kori/internal/handlers"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+func SetupBlackoutRoutes(e *echo.Echo, config *config.Config, db *gorm.DB) {
+	blackoutHandler := handlers.NewBlackoutHandler(db)
+
+	// Create blackout routes group
+	blackout := e.Group("/api/v1/blackout-dates")
+
+	// Add authentication middleware
+	auth := middleware.NewAuthMiddleware(config.JWT.Secret)
+	blackout.Use(auth.Middleware())
+
+	blackout.Use(middleware.RequirePermissions(db, "blackout_dates:read"))
+
+	// Check a date and browse the built-in holiday sets
+	blackout.GET("/check", blackoutHandler.CheckDate)
+	blackout.GET("/holidays", blackoutHandler.ListHolidays)
+	blackout.GET("/holiday-countries", blackoutHandler.GetHolidayCountries)
+
+	// Choose which holiday sets the team observes
+	blackout.PUT("/holiday-countries", blackoutHandler.UpdateHolidayCountries, middleware.RequirePermissions(db, "blackout_dates:write"))
+}
@@ -0,0 +1,51 @@
+package routes
+
+import (
+	"kori/internal/api/middleware"
+	"kori/internal/config"
+	"kori/internal/handlers"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+func SetupCampaignRoutes(e *echo.Echo, config *config.Config, db *gorm.DB) {
+	preflightHandler := handlers.NewPreflightHandler(db)
+	alertHandler := handlers.NewAlertHandler(db)
+	abTestHandler := handlers.NewABTestHandler(db)
+	campaignHandler := handlers.NewCampaignHandler(db)
+
+	// Create campaign routes group
+	campaign := e.Group("/api/v1/campaigns")
+
+	// Add authentication middleware
+	auth := middleware.NewAuthMiddleware(config.JWT.Secret)
+	campaign.Use(auth.Middleware())
+
+	campaign.Use(middleware.RequirePermissions(db, "campaigns:read"))
+
+	// Preflight checks before sending
+	campaign.POST("/:id/preflight", preflightHandler.RunCampaignPreflight)
+	campaign.GET("/:id/authentication", campaignHandler.GetCampaignAuthentication)
+
+	// Per-variant results of a campaign A/B test
+	campaign.GET("/:id/ab-test", abTestHandler.GetABTestResults)
+
+	// Per-language results of a campaign sent in several languages
+	campaign.GET("/:id/languages", campaignHandler.GetCampaignLanguageStats)
+
+	// Per-contact delivery report and the recipients recorded at each send
+	campaign.GET("/:id/recipients", campaignHandler.GetCampaignRecipients)
+	campaign.GET("/:id/snapshots", campaignHandler.GetCampaignSnapshots)
+
+	// How many contacts the campaign's exclusions leave out of its audience
+	campaign.GET("/:id/exclusions", campaignHandler.GetCampaignExclusions)
+
+	// Alert status of a campaign
+	campaign.GET("/:id/alerts", alertHandler.GetCampaignAlertStatus, middleware.RequirePermissions(db, "alert_rules:read"))
+
+	// Pausing, resuming and cancelling campaigns
+	campaign.POST("/:id/pause", campaignHandler.PauseCampaign, middleware.RequirePermissions(db, "campaigns:write"))
+	campaign.POST("/:id/resume", campaignHandler.ResumeCampaign, middleware.RequirePermissions(db, "campaigns:write"))
+	campaign.POST("/:id/cancel", campaignHandler.CancelCampaign, middleware.RequirePermissions(db, "campaigns:write"))
+}
@@ -0,0 +1,30 @@
+package routes
+
+import (
+	"kori/internal/api/middleware"
+	"kori/internal/config"
+	"kori/internal/handlers"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+func SetupChangelogRoutes(e *echo.Echo, config *config.Config, db *gorm.DB) {
+	changelogHandler := handlers.NewChangelogHandler(db)
+	auth := middleware.NewAuthMiddleware(config.JWT.Secret)
+
+	// Every team reads the changelog, marked for its own plan
+	changelog := e.Group("/api/v1/changelog")
+	changelog.Use(auth.Middleware())
+	changelog.GET("", changelogHandler.GetChangelog)
+
+	// The changelog is shared by every team, so only platform operators publish to it
+	admin := e.Group("/api/v1/admin/changelog")
+	admin.Use(auth.Middleware())
+	admin.Use(middleware.RequireSuperAdmin())
+
+	admin.GET("", changelogHandler.ListChangelogEntries)
+	admin.POST("", changelogHandler.CreateChangelogEntry)
+	admin.PUT("/:id", changelogHandler.UpdateChangelogEntry)
+	admin.DELETE("/:id", changelogHandler.DeleteChangelogEntry)
+}
@@ -0,0 +1,27 @@
+package routes
+
+import (
+	"kori/internal/api/middleware"
+	"kori/internal/config"
+	"kori/internal/handlers"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+func SetupConfigRoutes(e *echo.Echo, config *config.Config, db *gorm.DB) {
+	configHandler := handlers.NewConfigHandler(db)
+
+	// Create declarative config routes group
+	configs := e.Group("/api/v1/config")
+
+	// Add authentication middleware
+	auth := middleware.NewAuthMiddleware(config.JWT.Secret)
+	configs.Use(auth.Middleware())
+
+	// A config spans every kind of resource it manages, so it needs the permissions of each
+	configs.POST("/plan", configHandler.PlanConfig,
+		middleware.RequirePermissions(db, "templates:read", "webhooks:read", "smtp_configs:read", "domains:read"))
+	configs.POST("/apply", configHandler.ApplyConfig,
+		middleware.RequirePermissions(db, "templates:write", "webhooks:write", "smtp_configs:write", "domains:write"))
+}
@@ -3,7 +3,9 @@ package routes
 import (
 	"kori/internal/api/middleware"
 	"kori/internal/config"
+	"kori/internal/handlers"
 	"kori/internal/models"
+	"kori/internal/utils"
 	"net/http"
 
 	"github.com/labstack/echo/v4"
@@ -14,8 +16,12 @@ import (
 
 type ContactImportRequest struct {
 	FileID   string         `json:"fileId"`
+	SheetURL string         `json:"sheetUrl"` // a Google Sheet shared with anyone with the link, instead of a file
 	ListID   string         `json:"listId"`
 	Mappings datatypes.JSON `json:"mappings" validate:"required,json"`
+	// DryRun only validates the rows and counts what the import would do, until it's confirmed
+	DryRun         bool `json:"dryRun"`
+	UpdateExisting bool `json:"updateExisting"` // update contacts already on the list instead of skipping them
 }
 
 func SetupImportRoutes(e *echo.Echo, db *gorm.DB, cfg *config.Config) {
@@ -23,12 +29,20 @@ func SetupImportRoutes(e *echo.Echo, db *gorm.DB, cfg *config.Config) {
 	auth := middleware.NewAuthMiddleware(cfg.JWT.Secret)
 	importGroup.Use(auth.Middleware())
 
+	importHandler := handlers.NewContactImportHandler(db)
+	importGroup.GET("/:id", importHandler.GetContactImport, middleware.RequirePermissions(db, "contact_imports:read"))
+	importGroup.GET("/:id/errors", importHandler.GetContactImportErrors, middleware.RequirePermissions(db, "contact_imports:read"))
+	importGroup.POST("/:id/confirm", importHandler.ConfirmContactImport, middleware.RequirePermissions(db, "contact_imports:create"))
+
 	// Handle contact import
 	// @Summary Import contacts from a file
-	// @Description Import contacts from a file
+	// @Description Import contacts from an uploaded CSV or XLSX file, or from a Google Sheet shared with anyone with the link
 	// @Accept json
 	// @Produce json
-	// @Param fileId path string true "File ID"
+	// @Param fileId path string false "File ID"
+	// @Param sheetUrl path string false "Google Sheet URL, instead of a file"
+	// @Param dryRun path bool false "Only validate the rows and count what would be imported, until confirmed"
+	// @Param updateExisting path bool false "Update contacts already on the list instead of skipping them"
 	// @Param listId path string true "List ID"
 	// @Success 200 {object} map[string]string "Contact import queued successfully"
 	// @Failure 400 {object} map[string]string "Validation error or file not found"
@@ -47,10 +61,10 @@ func SetupImportRoutes(e *echo.Echo, db *gorm.DB, cfg *config.Config) {
 		}
 
 		log.Info("🚀 Starting contact import")
-		// we need get the fileId from the request
+		// we need get the fileId or the sheetUrl from the request
 		fileId := req.FileID
-		if fileId == "" {
-			return c.String(http.StatusBadRequest, "fileId is required")
+		if (fileId == "") == (req.SheetURL == "") {
+			return c.String(http.StatusBadRequest, "either fileId or sheetUrl is required")
 		}
 
 		// listId is required
@@ -59,10 +73,18 @@ func SetupImportRoutes(e *echo.Echo, db *gorm.DB, cfg *config.Config) {
 			return c.String(http.StatusBadRequest, "listId is required")
 		}
 
-		// we need to get the file from the database
-		var file models.File
-		if err := db.Where("id = ?", fileId).First(&file).Error; err != nil {
-			return c.String(http.StatusNotFound, "file not found")
+		source := models.ContactImportSourceFile
+		if req.SheetURL != "" {
+			if _, err := utils.GoogleSheetCSVURL(req.SheetURL); err != nil {
+				return c.String(http.StatusBadRequest, err.Error())
+			}
+			source = models.ContactImportSourceGoogleSheets
+		} else {
+			// we need to get the file from the database
+			var file models.File
+			if err := db.Where("id = ?", fileId).First(&file).Error; err != nil {
+				return c.String(http.StatusNotFound, "file not found")
+			}
 		}
 
 		// mappings is a json object
@@ -73,18 +95,55 @@ func SetupImportRoutes(e *echo.Echo, db *gorm.DB, cfg *config.Config) {
 		}
 
 		contact_import := models.ContactImport{
-			FileID:    fileId,
-			TeamID:    c.Get("teamID").(string),
-			ListID:    listId,
-			Status:    models.ContactImportStatusPending,
-			FieldsMap: mappings,
+			Source:         source,
+			FileID:         fileId,
+			SheetURL:       req.SheetURL,
+			TeamID:         c.Get("teamID").(string),
+			ListID:         listId,
+			Status:         models.ContactImportStatusPending,
+			FieldsMap:      mappings,
+			DryRun:         req.DryRun,
+			UpdateExisting: req.UpdateExisting,
 		}
 
 		if err := db.Create(&contact_import).Error; err != nil {
 			return c.String(http.StatusInternalServerError, "failed to create contact import")
 		}
 
-		return c.JSON(http.StatusOK, map[string]string{"message": "Contact import queued successfully"})
-	})
+		message := "Contact import queued successfully"
+		if contact_import.DryRun {
+			message = "Contact import dry run queued successfully"
+		}
+		return c.JSON(http.StatusOK, map[string]string{"message": message, "id": contact_import.ID})
+	}, middleware.RequirePermissions(db, "contact_imports:create"))
+
+}
+
+func SetupContactRoutes(e *echo.Echo, cfg *config.Config, db *gorm.DB) {
+	contactHandler := handlers.NewContactHandler(db)
+
+	contactGroup := e.Group("/api/v1/contacts")
+	auth := middleware.NewAuthMiddleware(cfg.JWT.Secret)
+	contactGroup.Use(auth.Middleware())
+	contactGroup.Use(middleware.RequirePermissions(db, "contacts:read"))
+
+	// Find and merge contacts sharing an email address
+	contactGroup.GET("/duplicates", contactHandler.ListDuplicates)
+	contactGroup.POST("/merge", contactHandler.MergeContacts, middleware.RequirePermissions(db, "contacts:write"))
+
+	// Signed exports of everything that happened with a contact's address
+	contactGroup.POST("/:id/timeline-export", contactHandler.CreateTimelineExport)
+	contactGroup.GET("/:id/timeline-export/:exportId", contactHandler.GetTimelineExport)
+}
+
+func SetupContactSyncRoutes(e *echo.Echo, cfg *config.Config, db *gorm.DB) {
+	contactSyncHandler := handlers.NewContactSyncHandler(db)
+
+	syncGroup := e.Group("/api/v1/contact-syncs")
+	auth := middleware.NewAuthMiddleware(cfg.JWT.Secret)
+	syncGroup.Use(auth.Middleware())
+	syncGroup.Use(middleware.RequirePermissions(db, "contact_syncs:write"))
 
+	// Trigger an immediate sync
+	syncGroup.POST("/:id/run", contactSyncHandler.RunSync)
 }
@@ -0,0 +1,27 @@
+package routes
+
+import (
+	"kori/internal/api/middleware"
+	"kori/internal/config"
+	"kori/internal/handlers"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+func SetupContentBlockRoutes(e *echo.Echo, config *config.Config, db *gorm.DB) {
+	contentBlockHandler := handlers.NewContentBlockHandler(db)
+
+	// Create content block routes group
+	blocks := e.Group("/api/v1/content-blocks")
+
+	// Add authentication middleware
+	auth := middleware.NewAuthMiddleware(config.JWT.Secret)
+	blocks.Use(auth.Middleware())
+
+	blocks.Use(middleware.RequirePermissions(db, "content_blocks:read"))
+
+	// Per-variant analytics and rendering previews
+	blocks.GET("/:id/stats", contentBlockHandler.GetContentBlockStats)
+	blocks.POST("/preview", contentBlockHandler.PreviewContentBlocks)
+}
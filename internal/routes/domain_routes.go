@@ -0,0 +1,57 @@
+package routes
+
+import (
+	"kori/internal/api/middleware"
+	"kori/internal/config"
+	"kori/internal/handlers"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+func SetupDomainRoutes(e *echo.Echo, config *config.Config, db *gorm.DB) {
+	domainHandler := handlers.NewDomainHandler(db)
+	trackingDomainHandler := handlers.NewTrackingDomainHandler(db)
+	mtaSTSHandler := handlers.NewMTASTSHandler(db)
+	reputationHandler := handlers.NewReputationHandler(db)
+
+	// Public MTA-STS policy and TLS report endpoints (no auth required)
+	e.GET("/.well-known/mta-sts.txt", mtaSTSHandler.ServePolicy)
+	e.POST("/tlsrpt", mtaSTSHandler.IngestTLSReport)
+
+	// Create domain routes group
+	domain := e.Group("/api/v1/domains")
+
+	// Add authentication middleware
+	auth := middleware.NewAuthMiddleware(config.JWT.Secret)
+	domain.Use(auth.Middleware())
+
+	domain.Use(middleware.RequirePermissions(db, "domains:read"))
+
+	// MTA-STS policy and TLS-RPT DNS guidance
+	domain.GET("/:id/mta-sts", mtaSTSHandler.GetMTASTSSetup)
+
+	// Check DNS records and update verification status
+	domain.POST("/:id/verify", domainHandler.VerifyDomain, middleware.RequirePermissions(db, "domains:write"))
+
+	// Custom tracking domain, one per team
+	trackingDomain := e.Group("/api/v1/tracking-domain")
+	trackingDomain.Use(auth.Middleware())
+	trackingDomain.Use(middleware.RequirePermissions(db, "domains:read"))
+
+	trackingDomain.GET("", trackingDomainHandler.GetTrackingDomain)
+	trackingDomain.PUT("", trackingDomainHandler.SetTrackingDomain, middleware.RequirePermissions(db, "domains:write"))
+	trackingDomain.POST("/verify", trackingDomainHandler.VerifyTrackingDomain, middleware.RequirePermissions(db, "domains:write"))
+	trackingDomain.DELETE("", trackingDomainHandler.DeleteTrackingDomain, middleware.RequirePermissions(db, "domains:write"))
+
+	// Deliverability dashboard
+	deliverability := e.Group("/api/v1/deliverability")
+	deliverability.Use(auth.Middleware())
+	deliverability.Use(middleware.RequirePermissions(db, "analytics:read"))
+
+	// TLS delivery failures per receiving domain
+	deliverability.GET("/tls", mtaSTSHandler.GetTLSFailures)
+
+	// Domain and IP reputation from Postmaster Tools and SNDS
+	deliverability.GET("/reputation", reputationHandler.GetReputation)
+}
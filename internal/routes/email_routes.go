@@ -17,7 +17,22 @@ func SetupEMAILRoutes(e *echo.Echo, config *config.Config, db *gorm.DB) {
 	auth := middleware.NewAuthMiddleware(config.JWT.Secret)
 	email.Use(auth.Middleware())
 
-	email.Use(middleware.RequirePermissions(db, "emails:create"))
+	// Status lookups only need to read emails, so they get their own group
+	status := e.Group("/api/v1/emails/status")
+	status.Use(auth.Middleware())
+	status.Use(middleware.RequirePermissions(db, "emails:read"))
+
+	// @Summary Get email statuses
+	// @Description Look up the delivery status of many emails at once
+	// @Produce json
+	// @Param ids query string true "Comma-separated email IDs"
+	// @Success 200 {object} handlers.EmailStatusesResponse
+	// @Failure 400 {object} map[string]string "No IDs, too many IDs or an invalid ID"
+	// @Router /api/v1/emails/status [get]
+	status.GET("", handlers.GetEmailStatuses)
+
+	// Sending has its own permission, so a key can be limited to sending
+	email.Use(middleware.RequirePermissions(db, "emails:send"))
 
 	// @Summary Send an email
 	// @Description Send an email to a list of contacts
@@ -29,4 +44,16 @@ func SetupEMAILRoutes(e *echo.Echo, config *config.Config, db *gorm.DB) {
 	// @Failure 500 {object} map[string]string "Internal server error"
 	// @Router /api/v1/emails [post]
 	email.POST("", handlers.SendEmail)
+
+	// @Summary Send a transactional email
+	// @Description Send a template or raw HTML email, deduplicated by the Idempotency-Key header for 24 hours
+	// @Accept json
+	// @Produce json
+	// @Param Idempotency-Key header string false "Unique key for this send"
+	// @Param email body handlers.SendTransactionalEmailRequest true "Email details"
+	// @Success 202 {object} map[string]string "Email queued"
+	// @Failure 400 {object} map[string]string "Validation error"
+	// @Failure 422 {object} map[string]string "Idempotency key reused with a different request"
+	// @Router /api/v1/emails/send [post]
+	email.POST("/send", handlers.SendTransactionalEmail)
 }
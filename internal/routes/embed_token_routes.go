@@ -0,0 +1,28 @@
+package routes
+
+import (
+	"kori/internal/api/middleware"
+	"kori/internal/config"
+	"kori/internal/handlers"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+func SetupEmbedTokenRoutes(e *echo.Echo, config *config.Config, db *gorm.DB) {
+	embedTokenHandler := handlers.NewEmbedTokenHandler(db)
+
+	// Create embed token routes group
+	embedTokens := e.Group("/api/v1/embed-tokens")
+
+	// Add authentication middleware
+	auth := middleware.NewAuthMiddleware(config.JWT.Secret)
+	embedTokens.Use(auth.Middleware())
+
+	// Only what the team can read itself can be embedded
+	embedTokens.Use(middleware.RequirePermissions(db, "analytics:read"))
+
+	// Minting tokens for embedded widgets, and revoking them before they expire
+	embedTokens.POST("", embedTokenHandler.CreateEmbedToken, middleware.RequirePermissions(db, "embed_tokens:write"))
+	embedTokens.DELETE("/:id", embedTokenHandler.RevokeEmbedToken, middleware.RequirePermissions(db, "embed_tokens:write"))
+}
@@ -0,0 +1,30 @@
+package routes
+
+import (
+	"kori/internal/api/middleware"
+	"kori/internal/config"
+	"kori/internal/handlers"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+func SetupFeatureFlagRoutes(e *echo.Echo, config *config.Config, db *gorm.DB) {
+	featureFlagHandler := handlers.NewFeatureFlagHandler(db)
+	auth := middleware.NewAuthMiddleware(config.JWT.Secret)
+
+	// The frontend asks which flags are on for the signed in team
+	flags := e.Group("/api/v1/feature-flags")
+	flags.Use(auth.Middleware())
+	flags.GET("", featureFlagHandler.GetFeatureFlags)
+
+	// Flags are shared by every team, so only platform operators roll them out
+	admin := e.Group("/api/v1/admin/feature-flags")
+	admin.Use(auth.Middleware())
+	admin.Use(middleware.RequireSuperAdmin())
+
+	admin.GET("", featureFlagHandler.ListFeatureFlags)
+	admin.POST("", featureFlagHandler.CreateFeatureFlag)
+	admin.PUT("/:id", featureFlagHandler.UpdateFeatureFlag)
+	admin.DELETE("/:id", featureFlagHandler.DeleteFeatureFlag)
+}
@@ -29,3 +29,26 @@ func SetupIMAPRoutes(e *echo.Echo, config *config.Config, db *gorm.DB) {
 	// test imap connection
 	imap.POST("/test", imapHandler.TestConnection)
 }
+
+// SetupInboxRoutes serves the messages synced from mailboxes with inbox sync on, and the
+// conversations the team shares them in
+func SetupInboxRoutes(e *echo.Echo, config *config.Config, db *gorm.DB) {
+	inbox := e.Group("/api/v1/inbox")
+	inboxHandler := handlers.NewInboxHandler(db)
+
+	auth := middleware.NewAuthMiddleware(config.JWT.Secret)
+	inbox.Use(auth.Middleware())
+	inbox.Use(middleware.RequirePermissions(db, "imap:read"))
+
+	inbox.GET("", inboxHandler.ListMessages)
+	inbox.GET("/folders", inboxHandler.ListFolders)
+	inbox.GET("/conversations", inboxHandler.ListConversations)
+	inbox.GET("/conversations/:id", inboxHandler.GetConversation)
+	inbox.PUT("/conversations/:id/assignee", inboxHandler.AssignConversation, middleware.RequirePermissions(db, "imap:update"))
+	inbox.PUT("/conversations/:id/status", inboxHandler.SetConversationStatus, middleware.RequirePermissions(db, "imap:update"))
+	inbox.PUT("/conversations/:id/snooze", inboxHandler.SnoozeConversation, middleware.RequirePermissions(db, "imap:update"))
+	inbox.DELETE("/conversations/:id/snooze", inboxHandler.UnsnoozeConversation, middleware.RequirePermissions(db, "imap:update"))
+	inbox.PUT("/conversations/:id/follow-up", inboxHandler.SetConversationFollowUp, middleware.RequirePermissions(db, "imap:update"))
+	inbox.DELETE("/conversations/:id/follow-up", inboxHandler.CancelConversationFollowUp, middleware.RequirePermissions(db, "imap:update"))
+	inbox.GET("/:id", inboxHandler.GetMessage)
+}
@@ -0,0 +1,24 @@
+package routes
+
+import (
+	"kori/internal/api/middleware"
+	"kori/internal/config"
+	"kori/internal/handlers"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+func SetupListHeadersRoutes(e *echo.Echo, config *config.Config, db *gorm.DB) {
+	listHeadersHandler := handlers.NewListHeadersHandler(db)
+
+	// Create list header routes group
+	listHeaders := e.Group("/api/v1/list-headers")
+
+	// Add authentication middleware
+	auth := middleware.NewAuthMiddleware(config.JWT.Secret)
+	listHeaders.Use(auth.Middleware())
+
+	listHeaders.GET("", listHeadersHandler.GetListHeaderSettings, middleware.RequirePermissions(db, "smtp_configs:read"))
+	listHeaders.PUT("", listHeadersHandler.UpdateListHeaderSettings, middleware.RequirePermissions(db, "smtp_configs:write"))
+}
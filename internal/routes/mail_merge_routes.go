@@ -0,0 +1,32 @@
+package routes
+
+import (
+	"kori/internal/api/middleware"
+	"kori/internal/config"
+	"kori/internal/handlers"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+func SetupMailMergeRoutes(e *echo.Echo, config *config.Config, db *gorm.DB) {
+	mailMerge := e.Group("/api/v1/mail-merge")
+
+	auth := middleware.NewAuthMiddleware(config.JWT.Secret)
+	mailMerge.Use(auth.Middleware())
+
+	// A mail merge is a batch of sends, so it needs the same permission as one
+	mailMerge.Use(middleware.RequirePermissions(db, "emails:send"))
+
+	// @Summary Send a mail merge
+	// @Description Send an email to up to 500 inline recipients, each with their own variables
+	// @Accept json
+	// @Produce json
+	// @Param Idempotency-Key header string false "Unique key for this mail merge"
+	// @Param request body handlers.MailMergeRequest true "Mail merge"
+	// @Success 202 {object} handlers.MailMergeResponse
+	// @Failure 400 {object} map[string]string "Validation error"
+	// @Failure 422 {object} map[string]string "Idempotency key reused with a different request"
+	// @Router /api/v1/mail-merge [post]
+	mailMerge.POST("", handlers.SendMailMerge)
+}
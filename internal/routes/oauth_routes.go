@@ -0,0 +1,26 @@
+package routes
+
+import (
+	"kori/internal/api/middleware"
+	"kori/internal/config"
+	"kori/internal/handlers"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+func SetupOAuthRoutes(e *echo.Echo, config *config.Config, db *gorm.DB) {
+	oauthHandler := handlers.NewOAuthHandler(db)
+
+	// Connecting Gmail and Outlook mailboxes with OAuth2
+	oauth := e.Group("/api/v1/oauth")
+	auth := middleware.NewAuthMiddleware(config.JWT.Secret)
+	oauth.Use(auth.Middleware())
+
+	oauth.POST("/smtp-configs/:id/authorize", oauthHandler.AuthorizeSMTPConfig, middleware.RequirePermissions(db, "smtp_configs:write"))
+	oauth.POST("/imap-configs/:id/authorize", oauthHandler.AuthorizeIMAPConfig, middleware.RequirePermissions(db, "imap_configs:write"))
+	oauth.POST("/reputation-connectors/:id/authorize", oauthHandler.AuthorizeReputationConnector, middleware.RequirePermissions(db, "reputation_connectors:write"))
+
+	// Where the providers send the user back to, authenticated by the signed state
+	e.GET("/oauth/callback", oauthHandler.HandleOAuthCallback)
+}
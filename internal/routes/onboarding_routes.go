@@ -0,0 +1,30 @@
+package routes
+
+import (
+	"kori/internal/api/middleware"
+	"kori/internal/config"
+	"kori/internal/handlers"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+func SetupOnboardingRoutes(e *echo.Echo, config *config.Config, db *gorm.DB) {
+	onboardingHandler := handlers.NewOnboardingHandler(db)
+
+	// Create onboarding routes group
+	onboarding := e.Group("/api/v1/onboarding")
+
+	// Add authentication middleware
+	auth := middleware.NewAuthMiddleware(config.JWT.Secret)
+	onboarding.Use(auth.Middleware())
+
+	onboarding.Use(middleware.RequirePermissions(db, "onboarding:read"))
+
+	onboarding.GET("", onboardingHandler.GetOnboarding)
+	onboarding.POST("/steps/:step/complete", onboardingHandler.CompleteOnboardingStep, middleware.RequirePermissions(db, "onboarding:write"))
+	onboarding.POST("/dismiss", onboardingHandler.DismissOnboarding, middleware.RequirePermissions(db, "onboarding:write"))
+	onboarding.DELETE("/dismiss", onboardingHandler.RestoreOnboarding, middleware.RequirePermissions(db, "onboarding:write"))
+	onboarding.POST("/sample-data", onboardingHandler.PopulateSampleData, middleware.RequirePermissions(db, "onboarding:write"))
+	onboarding.DELETE("/sample-data", onboardingHandler.DeleteSampleData, middleware.RequirePermissions(db, "onboarding:write"))
+}
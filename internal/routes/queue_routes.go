@@ -0,0 +1,70 @@
+package routes
+
+import (
+	"kori/internal/api/middleware"
+	"kori/internal/config"
+	"kori/internal/handlers"
+	"kori/internal/tasks"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+func SetupQueueRoutes(e *echo.Echo, config *config.Config, db *gorm.DB) {
+	queueHandler := handlers.NewQueueHandler(config.Redis)
+
+	// Create queue admin routes group
+	queues := e.Group("/api/v1/admin/queues")
+
+	// Add authentication middleware
+	auth := middleware.NewAuthMiddleware(config.JWT.Secret)
+	queues.Use(auth.Middleware())
+
+	// Queues are shared by every team, so only platform operators see them
+	queues.Use(middleware.RequireSuperAdmin())
+
+	queues.GET("", queueHandler.ListQueues)
+	queues.GET("/:queue/tasks", queueHandler.ListQueueTasks)
+	queues.POST("/:queue/tasks/:taskId/retry", queueHandler.RetryQueueTask)
+	queues.DELETE("/:queue/tasks/:taskId", queueHandler.DeleteQueueTask)
+	queues.POST("/:queue/pause", queueHandler.PauseQueue)
+	queues.POST("/:queue/unpause", queueHandler.UnpauseQueue)
+
+	maintenanceHandler := handlers.NewMaintenanceHandler(config.Redis)
+
+	// Maintenance mode is exempt from itself, so it can be turned off again
+	maintenance := e.Group("/api/v1/admin/maintenance")
+	maintenance.Use(auth.Middleware())
+	maintenance.Use(middleware.RequireSuperAdmin())
+
+	maintenance.GET("", maintenanceHandler.GetMaintenanceMode)
+	maintenance.PUT("", maintenanceHandler.SetMaintenanceMode)
+
+	metricsHandler := handlers.NewPipelineMetricsHandler(db, tasks.PipelineSLA(config.SLA), config.SLA.Window)
+
+	metrics := e.Group("/api/v1/admin/metrics")
+	metrics.Use(auth.Middleware())
+	metrics.Use(middleware.RequireSuperAdmin())
+
+	metrics.GET("/email-pipeline", metricsHandler.GetEmailPipelineMetrics)
+
+	indexAdvisorHandler := handlers.NewIndexAdvisorHandler(db)
+
+	indexAdvisor := e.Group("/api/v1/admin/index-advisor")
+	indexAdvisor.Use(auth.Middleware())
+	indexAdvisor.Use(middleware.RequireSuperAdmin())
+
+	indexAdvisor.GET("", indexAdvisorHandler.GetIndexRecommendations)
+
+	dataSubjectHandler := handlers.NewDataSubjectHandler(db)
+
+	// Access and erasure requests cover an address on every team
+	privacy := e.Group("/api/v1/admin/privacy")
+	privacy.Use(auth.Middleware())
+	privacy.Use(middleware.RequireSuperAdmin())
+
+	privacy.GET("/requests", dataSubjectHandler.ListDataSubjectRequests)
+	privacy.POST("/exports", dataSubjectHandler.ExportDataSubject)
+	privacy.POST("/erasures", dataSubjectHandler.CreateErasure)
+	privacy.POST("/erasures/:id/execute", dataSubjectHandler.ExecuteErasure)
+}
@@ -0,0 +1,32 @@
+package routes
+
+import (
+	"kori/internal/api/middleware"
+	"kori/internal/config"
+	"kori/internal/handlers"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+func SetupReportShareRoutes(e *echo.Echo, config *config.Config, db *gorm.DB) {
+	reportShareHandler := handlers.NewReportShareHandler(db)
+
+	// Public shared reports (no auth required), the token in the path being the credential
+	e.GET("/share/reports/:token", reportShareHandler.GetSharedReport)
+
+	// Create report share routes group
+	reportShares := e.Group("/api/v1/report-shares")
+
+	// Add authentication middleware
+	auth := middleware.NewAuthMiddleware(config.JWT.Secret)
+	reportShares.Use(auth.Middleware())
+
+	// Only what the team can read itself can be shared
+	reportShares.Use(middleware.RequirePermissions(db, "analytics:read"))
+
+	// Managing share links
+	reportShares.POST("", reportShareHandler.CreateReportShare, middleware.RequirePermissions(db, "report_shares:write"))
+	reportShares.GET("", reportShareHandler.ListReportShares, middleware.RequirePermissions(db, "report_shares:read"))
+	reportShares.DELETE("/:id", reportShareHandler.RevokeReportShare, middleware.RequirePermissions(db, "report_shares:write"))
+}
@@ -0,0 +1,24 @@
+package routes
+
+import (
+	"kori/internal/api/middleware"
+	"kori/internal/config"
+	"kori/internal/handlers"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+func SetupRetentionRoutes(e *echo.Echo, config *config.Config, db *gorm.DB) {
+	retentionHandler := handlers.NewRetentionHandler(db)
+
+	// Create retention routes group
+	retention := e.Group("/api/v1/retention")
+
+	// Add authentication middleware
+	auth := middleware.NewAuthMiddleware(config.JWT.Secret)
+	retention.Use(auth.Middleware())
+
+	retention.GET("", retentionHandler.GetRetentionSettings, middleware.RequirePermissions(db, "team_settings:read"))
+	retention.PUT("", retentionHandler.UpdateRetentionSettings, middleware.RequirePermissions(db, "team_settings:update"))
+}
@@ -0,0 +1,32 @@
+package routes
+
+import (
+	"kori/internal/api/middleware"
+	"kori/internal/config"
+	"kori/internal/handlers"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+func SetupRoleRoutes(e *echo.Echo, config *config.Config, db *gorm.DB) {
+	roleHandler := handlers.NewRoleHandler(db)
+
+	// Create role routes group
+	roles := e.Group("/api/v1/roles")
+
+	// Add authentication middleware
+	auth := middleware.NewAuthMiddleware(config.JWT.Secret)
+	roles.Use(auth.Middleware())
+
+	roles.GET("", roleHandler.ListRoles, middleware.RequirePermissions(db, "roles:read"))
+	roles.GET("/permissions", roleHandler.ListRolePermissions, middleware.RequirePermissions(db, "roles:read"))
+	roles.GET("/:id", roleHandler.GetRole, middleware.RequirePermissions(db, "roles:read"))
+
+	// Only team admins change roles, so no role can grant itself more
+	roles.POST("", roleHandler.CreateRole, middleware.RequireTeamAdmin())
+	roles.PUT("/:id", roleHandler.UpdateRole, middleware.RequireTeamAdmin())
+	roles.DELETE("/:id", roleHandler.DeleteRole, middleware.RequireTeamAdmin())
+	roles.PUT("/:id/users/:userId", roleHandler.AssignRole, middleware.RequireTeamAdmin())
+	roles.DELETE("/:id/users/:userId", roleHandler.UnassignRole, middleware.RequireTeamAdmin())
+}
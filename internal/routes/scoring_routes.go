@@ -0,0 +1,26 @@
+package routes
+
+import (
+	"kori/internal/api/middleware"
+	"kori/internal/config"
+	"kori/internal/handlers"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+func SetupScoringRoutes(e *echo.Echo, config *config.Config, db *gorm.DB) {
+	scoringHandler := handlers.NewScoringHandler(db)
+
+	// Create scoring endpoint routes group
+	scoring := e.Group("/api/v1/scoring-endpoints")
+
+	// Add authentication middleware
+	auth := middleware.NewAuthMiddleware(config.JWT.Secret)
+	scoring.Use(auth.Middleware())
+
+	scoring.Use(middleware.RequirePermissions(db, "scoring_endpoints:read"))
+
+	// Try an endpoint against a sample of contacts
+	scoring.POST("/:id/test", scoringHandler.TestScoringEndpoint, middleware.RequirePermissions(db, "scoring_endpoints:write"))
+}
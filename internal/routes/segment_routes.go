@@ -0,0 +1,26 @@
+package routes
+
+import (
+	"kori/internal/api/middleware"
+	"kori/internal/config"
+	"kori/internal/handlers"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+func SetupSegmentRoutes(e *echo.Echo, config *config.Config, db *gorm.DB) {
+	segmentHandler := handlers.NewSegmentHandler(db)
+
+	// Create segment routes group
+	segment := e.Group("/api/v1/segments")
+
+	// Add authentication middleware
+	auth := middleware.NewAuthMiddleware(config.JWT.Secret)
+	segment.Use(auth.Middleware())
+
+	segment.Use(middleware.RequirePermissions(db, "segments:read"))
+
+	// Evaluate a segment against current contacts
+	segment.GET("/:id/preview", segmentHandler.PreviewSegment)
+}
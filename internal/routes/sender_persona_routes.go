@@ -0,0 +1,26 @@
+package routes
+
+import (
+	"kori/internal/api/middleware"
+	"kori/internal/config"
+	"kori/internal/handlers"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+func SetupSenderPersonaRoutes(e *echo.Echo, config *config.Config, db *gorm.DB) {
+	senderPersonaHandler := handlers.NewSenderPersonaHandler(db)
+
+	// Create sender persona routes group
+	personas := e.Group("/api/v1/sender-personas")
+
+	// Add authentication middleware
+	auth := middleware.NewAuthMiddleware(config.JWT.Secret)
+	personas.Use(auth.Middleware())
+
+	personas.Use(middleware.RequirePermissions(db, "sender_personas:read"))
+
+	// Compare how each persona's emails do
+	personas.GET("/analytics", senderPersonaHandler.GetSenderPersonaAnalytics)
+}
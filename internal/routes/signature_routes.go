@@ -0,0 +1,28 @@
+package routes
+
+import (
+	"kori/internal/api/middleware"
+	"kori/internal/config"
+	"kori/internal/handlers"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+func SetupSignatureRoutes(e *echo.Echo, config *config.Config, db *gorm.DB) {
+	signatureHandler := handlers.NewSignatureHandler(db)
+
+	// Create signature routes group
+	signatures := e.Group("/api/v1/signatures")
+
+	// Add authentication middleware
+	auth := middleware.NewAuthMiddleware(config.JWT.Secret)
+	signatures.Use(auth.Middleware())
+
+	signatures.GET("", signatureHandler.ListSignatures, middleware.RequirePermissions(db, "signatures:read"))
+	signatures.POST("", signatureHandler.CreateSignature, middleware.RequirePermissions(db, "signatures:create"))
+	signatures.GET("/:id", signatureHandler.GetSignature, middleware.RequirePermissions(db, "signatures:read"))
+	signatures.GET("/:id/preview", signatureHandler.PreviewSignature, middleware.RequirePermissions(db, "signatures:read"))
+	signatures.PUT("/:id", signatureHandler.UpdateSignature, middleware.RequirePermissions(db, "signatures:update"))
+	signatures.DELETE("/:id", signatureHandler.DeleteSignature, middleware.RequirePermissions(db, "signatures:delete"))
+}
@@ -1,6 +1,7 @@
 package routes
 
 import (
+	"kori/internal/api/middleware"
 	"kori/internal/config"
 	"kori/internal/handlers"
 
@@ -24,5 +25,21 @@ func SetupSMTPRoutes(e *echo.Echo, config *config.Config, db *gorm.DB) {
 	// @Failure 400 {object} map[string]string "Validation error or SMTP configuration not found"
 	// @Failure 500 {object} map[string]string "Internal server error"
 	// @Router /api/v1/smtp/test [post]
-	smtp.POST("/test", smtpHandler.TestSMTPConnection)
+	smtp.POST("/test", smtpHandler.TestSMTPConnection, middleware.RequirePermissions(db, "smtp_configs:read"))
+
+	sendingHandler := handlers.NewSMTPSendingHandler(db)
+
+	// Pausing sending through SMTP configs across teams, e.g. during a provider outage
+	sending := e.Group("/api/v1/admin/smtp-sending")
+	auth := middleware.NewAuthMiddleware(config.JWT.Secret)
+	sending.Use(auth.Middleware())
+	sending.Use(middleware.RequireSuperAdmin())
+
+	sending.GET("", sendingHandler.ListPausedSMTPConfigs)
+	sending.POST("/pause", sendingHandler.PauseSMTPSending)
+	sending.POST("/resume", sendingHandler.ResumeSMTPSending)
+
+	// Delivery events posted by API providers, authenticated by the config's webhook token
+	providerEventHandler := handlers.NewProviderEventHandler(db)
+	e.POST("/webhooks/providers/:token", providerEventHandler.HandleProviderEvents)
 }
@@ -0,0 +1,20 @@
+package routes
+
+import (
+	"kori/internal/config"
+	"kori/internal/handlers"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// SetupSubscribeFormRoutes registers the public endpoints of subscribe forms. Forms themselves are
+// managed through /api/v1/subscribe-forms.
+func SetupSubscribeFormRoutes(e *echo.Echo, config *config.Config, db *gorm.DB) {
+	subscribeFormHandler := handlers.NewSubscribeFormHandler(db)
+
+	// Public form endpoints (no auth required), submissions being rate limited per IP
+	e.GET("/forms/:id", subscribeFormHandler.GetFormPage)
+	e.GET("/api/v1/forms/:id/embed.js", subscribeFormHandler.GetEmbedScript)
+	e.POST("/api/v1/forms/:id/submit", subscribeFormHandler.SubmitForm)
+}
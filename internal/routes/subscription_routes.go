@@ -4,6 +4,7 @@ import (
 	"os"
 
 	"kori/internal/api/middleware"
+	"kori/internal/config"
 	"kori/internal/handlers"
 
 	"github.com/labstack/echo/v4"
@@ -32,3 +33,12 @@ func SetupSubscriptionRoutes(e *echo.Echo, db *gorm.DB) {
 	protected.GET("/portal", subscriptionHandler.GetManagementPortal)
 	protected.GET("/features", subscriptionHandler.GetFeatures)
 }
+
+// SetupUsageRoutes serves the team's consumption against its plan's quotas. The quotas apply
+// whether billing is set up or not, so it's registered apart from the subscription routes.
+func SetupUsageRoutes(e *echo.Echo, config *config.Config, db *gorm.DB) {
+	subscriptionHandler := handlers.NewSubscriptionHandler(db)
+	auth := middleware.NewAuthMiddleware(config.JWT.Secret)
+
+	e.GET("/api/v1/usage", subscriptionHandler.GetUsage, auth.Middleware(), middleware.RequirePermissions(db, "teams:read"))
+}
@@ -0,0 +1,40 @@
+package routes
+
+import (
+	"kori/internal/api/middleware"
+	"kori/internal/config"
+	"kori/internal/handlers"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+func SetupTemplateRoutes(e *echo.Echo, config *config.Config, db *gorm.DB) {
+	templateHandler := handlers.NewTemplateHandler(db)
+
+	// Create template routes group
+	templates := e.Group("/api/v1/templates")
+
+	// Add authentication middleware
+	auth := middleware.NewAuthMiddleware(config.JWT.Secret)
+	templates.Use(auth.Middleware())
+
+	templates.Use(middleware.RequirePermissions(db, "templates:read"))
+
+	// Rendering a template the way it's sent, and sending it to a team member as a test
+	templates.POST("/:id/preview", templateHandler.PreviewTemplate)
+	templates.POST("/:id/test-send", templateHandler.TestSendTemplate, middleware.RequirePermissions(db, "templates:write"))
+
+	// What uses a template, and deleting only templates nothing depends on
+	templates.GET("/:id/usage", templateHandler.GetTemplateUsage)
+	templates.DELETE("/:id", templateHandler.DeleteTemplate, middleware.RequirePermissions(db, "templates:write"))
+
+	// The versions recorded as a template changes, and what changed between two of them
+	templates.GET("/:id/versions", templateHandler.ListTemplateVersions)
+	templates.GET("/:id/versions/:a/diff/:b", templateHandler.DiffTemplateVersions)
+
+	// Language variants made by translators from exported strings, and what changed in the source since
+	templates.GET("/:id/translations", templateHandler.ListTemplateTranslations)
+	templates.GET("/:id/translations/export", templateHandler.ExportTemplateTranslation)
+	templates.POST("/:id/translations/import", templateHandler.ImportTemplateTranslation, middleware.RequirePermissions(db, "templates:write"))
+}
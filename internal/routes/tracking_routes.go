@@ -17,6 +17,21 @@ func RegisterTrackingRoutes(e *echo.Echo, h *handlers.TrackingHandler, cfg *conf
 	trackGroup.GET("/open", h.HandleEmailOpen)
 	trackGroup.GET("/unsubscribe", h.HandleEmailUnsubscribe)
 
+	// Unsubscribe confirmation page and one-click List-Unsubscribe endpoint
+	e.GET("/unsubscribe", h.HandleUnsubscribePage)
+	e.POST("/unsubscribe", h.HandleUnsubscribe)
+
+	// Leaving a single automation while staying subscribed
+	e.GET("/sequence-opt-out", h.HandleSequenceOptOutPage)
+	e.POST("/sequence-opt-out", h.HandleSequenceOptOut)
+
+	// Double opt-in confirmation links
+	e.GET("/confirm", h.HandleConfirm)
+
+	// Preference center linked from emails as preferences_url
+	e.GET("/preferences", h.HandlePreferencesPage)
+	e.POST("/preferences", h.HandleUpdatePreferences)
+
 	// Analytics endpoints (require auth)
 	analyticsGroup := e.Group("/api/v1/analytics")
 	// Add authentication middleware
@@ -57,6 +72,18 @@ func RegisterTrackingRoutes(e *echo.Echo, h *handlers.TrackingHandler, cfg *conf
 	// @Description Get trend analysis
 	analyticsGroup.GET("/trends", h.GetTrendAnalysis) // Trend analysis
 
+	// @Summary List analytics reports
+	// @Description Monthly reports recorded at the end of each period
+	analyticsGroup.GET("/reports", h.ListAnalyticsReports) // Immutable monthly reports
+
+	// @Summary List tracking events
+	// @Description Keyset paginated raw events for exports through the API
+	analyticsGroup.GET("/events", h.ListTrackingEvents) // Raw tracking events
+
+	// @Summary Stream campaign events
+	// @Description Server-sent events of a campaign's tracking events as they are recorded
+	analyticsGroup.GET("/stream", h.StreamCampaignEvents) // Live campaign events
+
 	// Export endpoints
 	// @Summary Export email analytics
 	analyticsGroup.GET("/export/email", h.ExportEmailAnalytics) // Export email analytics
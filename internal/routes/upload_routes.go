@@ -1,15 +1,17 @@
 package routes
 
 import (
+	"kori/internal/api/middleware"
 	"kori/internal/config"
 	"kori/internal/handlers"
 	"kori/internal/utils/logger"
 
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
 )
 
-func SetupUploadRoutes(api *echo.Group, cfg *config.Config) {
+func SetupUploadRoutes(api *echo.Group, cfg *config.Config, db *gorm.DB) {
 	log := logger.New("upload_routes")
 
 	// Initialize upload handler
@@ -19,7 +21,13 @@ func SetupUploadRoutes(api *echo.Group, cfg *config.Config) {
 
 	fileGroup := api.Group("/files")
 
-	fileGroup.POST("/upload", uploadHandler.UploadFile)
+	fileGroup.POST("/upload", uploadHandler.UploadFile, middleware.RequirePermissions(db, "files:create"))
 
 	log.Success("Upload routes initialized successfully")
 }
+
+// SetupStoredFileRoutes serves the files kept on the filesystem when there's no S3. Links are
+// signed rather than authenticated, so emails and the task workers can fetch them.
+func SetupStoredFileRoutes(e *echo.Echo) {
+	e.GET("/files/:name", handlers.ServeStoredFile)
+}
@@ -0,0 +1,28 @@
+package routes
+
+import (
+	"kori/internal/api/middleware"
+	"kori/internal/config"
+	"kori/internal/handlers"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+func SetupWorkspaceRoutes(e *echo.Echo, config *config.Config, db *gorm.DB) {
+	workspaceHandler := handlers.NewWorkspaceHandler(db)
+
+	// Create workspace routes group
+	workspace := e.Group("/api/v1/teams/:id/workspace")
+
+	// Add authentication middleware
+	auth := middleware.NewAuthMiddleware(config.JWT.Secret)
+	workspace.Use(auth.Middleware())
+
+	// Deleting a workspace takes everything with it, so only the team's admins can ask for it
+	workspace.Use(middleware.RequireTeamAdmin())
+
+	workspace.DELETE("", workspaceHandler.DeleteWorkspace)
+	workspace.GET("/deletion", workspaceHandler.GetWorkspaceDeletion)
+	workspace.POST("/restore", workspaceHandler.RestoreWorkspace)
+}
@@ -0,0 +1,270 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"kori/internal/db"
+	"kori/internal/events"
+	"kori/internal/models"
+	"kori/internal/tasks"
+	"kori/internal/utils/logger"
+	"os"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var alertLog = logger.New("ALERTS")
+
+// AlertService evaluates campaign alert rules and runs their actions
+type AlertService struct {
+	db *gorm.DB
+}
+
+// NewAlertService creates a new alert service
+func NewAlertService(db *gorm.DB) *AlertService {
+	return &AlertService{db: db}
+}
+
+func init() {
+	events.On("campaign_alerts.evaluate", func(data interface{}) {
+		if err := NewAlertService(db.DB).Evaluate(context.Background()); err != nil {
+			alertLog.Error("Failed to evaluate campaign alerts", err)
+		}
+	})
+
+	events.On("campaign.resumed", func(data interface{}) {
+		campaign := data.(*models.Campaign)
+		alertLog.Info("▶️ Resuming campaign %s", campaign.ID)
+		if err := taskClient.EnqueueCampaignTask(context.Background(), tasks.CampaignTask{
+			CampaignID: campaign.ID,
+			BatchSize:  campaign.BatchSize,
+			Offset:     0,
+		}, 0); err != nil {
+			alertLog.Error("Failed to enqueue resumed campaign", err)
+		}
+	})
+}
+
+// Evaluate checks every active rule against the campaigns it covers
+func (s *AlertService) Evaluate(ctx context.Context) error {
+	var rules []models.AlertRule
+	if err := s.db.WithContext(ctx).Where("is_active = true AND is_deleted = false").Find(&rules).Error; err != nil {
+		return alertLog.Error("failed to get alert rules", err)
+	}
+
+	now := time.Now()
+	for i := range rules {
+		rule := &rules[i]
+
+		campaigns, err := s.ruleCampaigns(ctx, rule, now)
+		if err != nil {
+			alertLog.Warn("⚠️ Failed to get campaigns for alert rule %s: %v", rule.ID, err)
+			continue
+		}
+
+		for j := range campaigns {
+			if err := s.evaluateCampaign(ctx, rule, &campaigns[j], now); err != nil {
+				alertLog.Warn("⚠️ Failed to evaluate alert rule %s for campaign %s: %v", rule.ID, campaigns[j].ID, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// ruleCampaigns returns the campaigns a rule applies to which haven't triggered it yet
+func (s *AlertService) ruleCampaigns(ctx context.Context, rule *models.AlertRule, now time.Time) ([]models.Campaign, error) {
+	query := s.db.WithContext(ctx).
+		Where("team_id = ? AND is_deleted = false", rule.TeamID).
+		Where("status IN ?", []models.CampaignStatus{models.CampaignStatusSending, models.CampaignStatusCompleted}).
+		Where("NOT EXISTS (SELECT 1 FROM alert_events ae WHERE ae.rule_id = ? AND ae.campaign_id = campaigns.id)", rule.ID)
+
+	if rule.CampaignID != "" {
+		query = query.Where("id = ?", rule.CampaignID)
+	} else {
+		lookback := now.AddDate(0, 0, -rule.LookbackDays)
+		query = query.Where("EXISTS (SELECT 1 FROM emails e WHERE e.campaign_id = campaigns.id AND e.sent_at >= ?)", lookback)
+	}
+
+	var campaigns []models.Campaign
+	if err := query.Find(&campaigns).Error; err != nil {
+		return nil, err
+	}
+	return campaigns, nil
+}
+
+func (s *AlertService) evaluateCampaign(ctx context.Context, rule *models.AlertRule, campaign *models.Campaign, now time.Time) error {
+	stats, err := models.GetCampaignStats(campaign.ID, s.db.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	if !rule.Ready(stats, now) {
+		return nil
+	}
+
+	value := rule.Value(stats)
+	if !rule.Triggered(value) {
+		return nil
+	}
+
+	var actions []string
+	if rule.NotifyEmail {
+		actions = append(actions, models.AlertActionNotify)
+	}
+	if rule.NotifyWebhook {
+		actions = append(actions, models.AlertActionWebhook)
+	}
+	if rule.AutoPause {
+		actions = append(actions, models.AlertActionAutoPause)
+	}
+
+	event := &models.AlertEvent{
+		RuleID:      rule.ID,
+		CampaignID:  campaign.ID,
+		Metric:      rule.Metric,
+		Value:       value,
+		Threshold:   rule.Threshold,
+		Actions:     actions,
+		TriggeredAt: now,
+		TeamID:      rule.TeamID,
+	}
+	result := s.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(event)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		// Already fired for this campaign
+		return nil
+	}
+
+	alertLog.Warn("🚨 Alert %q fired for campaign %s: %s is %.2f (threshold %s %.2f)",
+		rule.Name, campaign.Name, rule.Metric, value, rule.Operator, rule.Threshold)
+
+	if rule.AutoPause {
+		s.pauseCampaign(ctx, campaign)
+	}
+	events.Emit("campaign.alert", event)
+	if rule.NotifyWebhook {
+		s.deliverWebhooks(ctx, rule, campaign, event)
+	}
+	if rule.NotifyEmail {
+		s.notifyAdmins(ctx, rule, campaign, event)
+	}
+
+	return nil
+}
+
+// pauseCampaign stops a campaign that is still sending
+func (s *AlertService) pauseCampaign(ctx context.Context, campaign *models.Campaign) {
+	result := s.db.WithContext(ctx).Model(&models.Campaign{}).
+		Where("id = ? AND status IN ?", campaign.ID, []models.CampaignStatus{models.CampaignStatusSending, models.CampaignStatusScheduled}).
+		Update("status", models.CampaignStatusPaused)
+	if result.Error != nil {
+		alertLog.Error("failed to pause campaign", result.Error)
+		return
+	}
+	if result.RowsAffected > 0 {
+		campaign.Status = models.CampaignStatusPaused
+		alertLog.Warn("⏸️ Paused campaign %s", campaign.ID)
+	}
+}
+
+// deliverWebhooks sends the alert to team webhooks subscribed to campaign.alert
+func (s *AlertService) deliverWebhooks(ctx context.Context, rule *models.AlertRule, campaign *models.Campaign, event *models.AlertEvent) {
+	var webhooks []models.Webhook
+	if err := s.db.WithContext(ctx).
+		Where("team_id = ? AND is_active = true AND is_deleted = false AND ? = ANY(events)", rule.TeamID, "campaign.alert").
+		Find(&webhooks).Error; err != nil {
+		alertLog.Error("failed to get alert webhooks", err)
+		return
+	}
+
+	for _, webhook := range webhooks {
+		task := tasks.WebhookDeliveryTask{
+			WebhookID: webhook.ID,
+			Event:     "campaign.alert",
+			Payload: map[string]interface{}{
+				"ruleId":       rule.ID,
+				"ruleName":     rule.Name,
+				"campaignId":   campaign.ID,
+				"campaignName": campaign.Name,
+				"metric":       event.Metric,
+				"operator":     rule.Operator,
+				"value":        event.Value,
+				"threshold":    event.Threshold,
+				"paused":       campaign.Status == models.CampaignStatusPaused,
+				"triggeredAt":  event.TriggeredAt,
+			},
+			AttemptNum: 1,
+		}
+		if err := taskClient.EnqueueWebhookDeliveryTask(ctx, task); err != nil {
+			alertLog.Error("failed to enqueue alert webhook", err)
+		}
+	}
+}
+
+// notifyAdmins emails the team's admins about the alert
+func (s *AlertService) notifyAdmins(ctx context.Context, rule *models.AlertRule, campaign *models.Campaign, event *models.AlertEvent) {
+	subject := fmt.Sprintf("Alert: %s on %s", rule.Name, campaign.Name)
+	if err := notifyTeamAdmins(s.db.WithContext(ctx), rule.TeamID, subject, buildAlertBody(rule, campaign, event)); err != nil {
+		alertLog.Error("failed to notify team admins", err)
+	}
+}
+
+// notifyTeamAdmins emails a team's admins from the platform team's default SMTP config
+func notifyTeamAdmins(tx *gorm.DB, teamID, subject, body string) error {
+	platformTeam, err := models.GetTeamByName(os.Getenv("SUPERADMIN_TEAM_NAME"), tx)
+	if err != nil {
+		return fmt.Errorf("failed to get superadmin team: %w", err)
+	}
+
+	smtpConfig, err := models.GetSMTPConfig(platformTeam.ID, "", "", tx)
+	if err != nil {
+		return fmt.Errorf("failed to get default smtp config: %w", err)
+	}
+
+	var admins []models.User
+	if err := tx.
+		Where("team_id = ? AND role IN ? AND is_deleted = false", teamID, []models.UserRole{models.UserRoleAdmin, models.UserRoleSuperAdmin}).
+		Find(&admins).Error; err != nil {
+		return fmt.Errorf("failed to get team admins: %w", err)
+	}
+
+	for _, admin := range admins {
+		handler := &sendEmailHandlerBody{
+			teamId:       platformTeam.ID,
+			to:           admin.Email,
+			SMTPProvider: smtpConfig.ID,
+			variables:    map[string]string{"name": admin.FirstName},
+			subject:      subject,
+			body:         body,
+			testMail:     true,
+		}
+		if err := sendEmail(handler); err != nil {
+			alertLog.Warn("⚠️ Failed to send notification to %s: %v", admin.Email, err)
+		}
+	}
+	return nil
+}
+
+func buildAlertBody(rule *models.AlertRule, campaign *models.Campaign, event *models.AlertEvent) string {
+	comparison := "above"
+	if rule.Operator == "lt" {
+		comparison = "below"
+	}
+
+	paused := ""
+	if campaign.Status == models.CampaignStatusPaused {
+		paused = "<p>The campaign has been <strong>paused</strong>. Resume it once you've looked into the problem.</p>"
+	}
+
+	return fmt.Sprintf(`<html><body>
+<p>Hey {{ name }} 👋🏻,</p>
+<p>Your alert <strong>%s</strong> fired for the campaign <strong>%s</strong>.</p>
+<p>%s is %.2f, %s the threshold of %.2f.</p>
+%s
+</body></html>`, html.EscapeString(rule.Name), html.EscapeString(campaign.Name), event.Metric, event.Value, comparison, event.Threshold, paused)
+}
@@ -0,0 +1,110 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"kori/internal/db"
+	"kori/internal/events"
+	"kori/internal/handlers"
+	"kori/internal/models"
+	"kori/internal/utils/logger"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var reportLog = logger.New("ANALYTICS_REPORTS")
+
+func init() {
+	events.On("analytics_reports.record", func(data interface{}) {
+		if err := recordAnalyticsReports(db.DB, data.(time.Time)); err != nil {
+			reportLog.Warn("Failed to record some analytics reports: %v", err)
+		}
+	})
+}
+
+// recordAnalyticsReports records the team and campaign reports of the last month that ended
+// before now. Reports already recorded are kept, so a retried run only fills in the gaps.
+func recordAnalyticsReports(database *gorm.DB, now time.Time) error {
+	start, end := models.LastReportPeriod(now)
+	period := start.Format(models.AnalyticsReportPeriodFormat)
+
+	var teamIDs []string
+	if err := database.Model(&models.Team{}).Where("is_deleted = false AND created_at < ?", end).Pluck("id", &teamIDs).Error; err != nil {
+		return err
+	}
+
+	var errs []error
+	recorded := 0
+	for _, teamID := range teamIDs {
+		count, err := recordTeamReports(database, teamID, period, start, end)
+		recorded += count
+		if err != nil {
+			errs = append(errs, fmt.Errorf("team %s: %w", teamID, err))
+		}
+	}
+
+	reportLog.Success("Recorded %d analytics reports for %s", recorded, period)
+	return errors.Join(errs...)
+}
+
+// recordTeamReports records the team's overview of the period and the analytics of every
+// campaign that had sent email by its end
+func recordTeamReports(database *gorm.DB, teamID, period string, start, end time.Time) (int, error) {
+	recorded := 0
+
+	record := func(campaignID string, compute func() (interface{}, error)) error {
+		exists, err := models.HasAnalyticsReport(teamID, campaignID, period, database)
+		if err != nil || exists {
+			return err
+		}
+		metrics, err := compute()
+		if err != nil {
+			return err
+		}
+		raw, err := json.Marshal(metrics)
+		if err != nil {
+			return err
+		}
+		if err := database.Create(&models.AnalyticsReport{
+			TeamID:      teamID,
+			CampaignID:  campaignID,
+			Period:      period,
+			PeriodStart: start,
+			PeriodEnd:   end,
+			Metrics:     raw,
+			TakenAt:     time.Now(),
+		}).Error; err != nil {
+			return err
+		}
+		recorded++
+		return nil
+	}
+
+	// The overview's range is inclusive, so it stops just short of the next period
+	last := end.Add(-time.Nanosecond).Format(time.RFC3339Nano)
+	if err := record("", func() (interface{}, error) {
+		return handlers.TeamOverviewFor(database, teamID, start.Format(time.RFC3339Nano), last, false)
+	}); err != nil {
+		return recorded, err
+	}
+
+	var campaignIDs []string
+	if err := database.Model(&models.Campaign{}).
+		Where("team_id = ? AND is_deleted = false AND id IN (?)", teamID, database.Model(&models.Email{}).
+			Select("campaign_id").
+			Where("team_id = ? AND campaign_id IS NOT NULL AND created_at < ?", teamID, end)).
+		Pluck("id", &campaignIDs).Error; err != nil {
+		return recorded, err
+	}
+
+	for _, campaignID := range campaignIDs {
+		if err := record(campaignID, func() (interface{}, error) {
+			return handlers.CampaignAnalytics(database, campaignID, end)
+		}); err != nil {
+			return recorded, fmt.Errorf("campaign %s: %w", campaignID, err)
+		}
+	}
+	return recorded, nil
+}
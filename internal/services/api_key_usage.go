@@ -0,0 +1,34 @@
+package services
+
+import (
+	"fmt"
+	"html"
+	"kori/internal/db"
+	"kori/internal/events"
+	"kori/internal/models"
+	"kori/internal/utils/logger"
+)
+
+var apiKeyUsageLog = logger.New("API_KEY_USAGE")
+
+func init() {
+	events.On("api_key.usage_anomaly", func(data interface{}) {
+		anomaly := data.(models.APIKeyUsageAnomaly)
+
+		body := fmt.Sprintf(`<html><body>
+<p>Hey {{ name }} 👋🏻,</p>
+<p>The API key <strong>%s</strong> made <strong>%d requests</strong> in the hour from %s UTC, far more than usual.</p>
+<ul>
+<li>Usually: %.0f requests an hour (standard deviation %.0f)</li>
+<li>Errors in the hour: %d</li>
+</ul>
+<p>If this isn't expected, check the key's usage summary for the endpoints and addresses it was used from, and revoke it if it has leaked.</p>
+</body></html>`, html.EscapeString(anomaly.APIKeyName), anomaly.Requests, anomaly.Hour.Format("2006-01-02 15:04"),
+			anomaly.Mean, anomaly.StdDev, anomaly.Errors)
+
+		subject := fmt.Sprintf("Unusual usage of API key %s", anomaly.APIKeyName)
+		if err := notifyTeamAdmins(db.DB, anomaly.TeamID, subject, body); err != nil {
+			apiKeyUsageLog.Error("Failed to notify admins of api key usage anomaly", err)
+		}
+	})
+}
@@ -0,0 +1,47 @@
+package services
+
+import (
+	"context"
+	"kori/internal/db"
+	"kori/internal/events"
+	"kori/internal/models"
+	"kori/internal/tasks"
+	"kori/internal/utils/logger"
+	"time"
+)
+
+var automationLog = logger.New("AUTOMATION")
+
+func init() {
+	events.On("automation_run.created", func(data interface{}) {
+		run := data.(*models.AutomationRun)
+		startAutomationRun(run)
+	})
+
+	// Contacts added to a list enter the automations that start from it
+	events.On("contacts.created", func(data interface{}) {
+		contact := data.(*models.Contact)
+		automations, err := models.GetTriggeredAutomations(contact.TeamID, contact.ListID, db.DB)
+		if err != nil {
+			automationLog.Warn("Failed to get automations triggered by list %s: %v", contact.ListID, err)
+			return
+		}
+		for i := range automations {
+			run, err := models.EnrollContact(&automations[i], contact, db.DB)
+			if err != nil {
+				automationLog.Warn("Failed to enroll contact %s in automation %s: %v", contact.ID, automations[i].ID, err)
+				continue
+			}
+			if run != nil {
+				startAutomationRun(run)
+			}
+		}
+	})
+}
+
+// startAutomationRun queues the first step of a new run
+func startAutomationRun(run *models.AutomationRun) {
+	if err := taskClient.EnqueueAutomationStepTask(context.Background(), tasks.AutomationStepTask{RunID: run.ID}, time.Now()); err != nil {
+		automationLog.Error("Failed to enqueue automation step task: %v", err)
+	}
+}
@@ -4,25 +4,68 @@ import (
 	"context"
 	"fmt"
 	"kori/internal/events"
+	"kori/internal/models"
 	"reflect"
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // BaseService interface defines common CRUD operations
 type BaseService[T any] interface {
 	Create(ctx context.Context, entity *T, includes ...string) error
 	Get(ctx context.Context, id string, includes ...string) (*T, error)
-	List(ctx context.Context, page, limit int, filters map[string]interface{}, excludeFields map[string]bool, sortFields []string, order string, includes ...string) ([]T, int64, error)
+	List(ctx context.Context, query ListQuery) ([]T, int64, error)
 	Update(ctx context.Context, id string, entity *T, includes ...string) error
 	Delete(ctx context.Context, id string) error
 }
 
+// ListQuery selects a page of rows for List
+type ListQuery struct {
+	Offset   int // offset pagination, ignored when After is set
+	Limit    int
+	Filters  map[string]interface{} // column -> value the rows must have
+	Excludes map[string]bool
+	Sort     string // column, created_at by default
+	Desc     bool
+	Nullable bool    // the sort column can be NULL; NULLs sort last either way
+	After    *Cursor // start after this row
+	Includes []string
+}
+
+// Cursor is where a page ended: the sort column value, nil for NULL, and ID of its last row
+type Cursor struct {
+	Value interface{}
+	ID    string
+}
+
 // BaseServiceImpl implements BaseService
 type BaseServiceImpl[T any] struct {
-	db        *gorm.DB
-	modelType T
+	db            *gorm.DB
+	modelType     T
+	teamCondition string // selects the rows of the team given as its one argument, empty for models without a team
+}
+
+// TeamScope is the team the rows of a request are limited to. Unscoped lifts the limit, for
+// super admins working across teams.
+type TeamScope struct {
+	TeamID   string
+	Unscoped bool
+}
+
+type teamScopeKey struct{}
+
+// WithTeamScope limits the base service calls made with ctx to the rows of scope's team
+func WithTeamScope(ctx context.Context, scope TeamScope) context.Context {
+	return context.WithValue(ctx, teamScopeKey{}, scope)
+}
+
+// TeamScopeFrom returns the team scope of ctx, if any
+func TeamScopeFrom(ctx context.Context) (TeamScope, bool) {
+	scope, ok := ctx.Value(teamScopeKey{}).(TeamScope)
+	return scope, ok
 }
 
 func GormTableName(db *gorm.DB, v any) string {
@@ -33,14 +76,83 @@ func GormTableName(db *gorm.DB, v any) string {
 // NewBaseService creates a new base service
 func NewBaseService[T any](db *gorm.DB, modelType T) BaseService[T] {
 	return &BaseServiceImpl[T]{
-		db:        db,
-		modelType: modelType,
+		db:            db,
+		modelType:     modelType,
+		teamCondition: teamCondition(db, reflect.TypeOf(modelType)),
+	}
+}
+
+// teamCondition returns the condition selecting a team's rows of a model: by its own team
+// column, or for models without one, like API key usage, by the team of the parent row they
+// belong to
+func teamCondition(db *gorm.DB, modelType reflect.Type) string {
+	if modelType == reflect.TypeOf(models.Team{}) {
+		return "id = ?"
+	}
+	if _, found := modelType.FieldByName("TeamID"); found {
+		return "team_id = ?"
+	}
+	for _, field := range reflect.VisibleFields(modelType) {
+		parentType := field.Type
+		if parentType.Kind() == reflect.Ptr {
+			parentType = parentType.Elem()
+		}
+		if parentType.Kind() != reflect.Struct || field.Anonymous {
+			continue
+		}
+		if _, found := parentType.FieldByName("TeamID"); !found {
+			continue
+		}
+		if _, found := modelType.FieldByName(field.Name + "ID"); !found {
+			continue
+		}
+		return fmt.Sprintf("%s IN (SELECT id FROM %s WHERE team_id = ?)",
+			db.NamingStrategy.ColumnName("", field.Name+"ID"), db.NamingStrategy.TableName(parentType.Name()))
+	}
+	return ""
+}
+
+// AssignTeam sets the TeamID of entity to the team in ctx, so rows can't be created in another
+// team. Unscoped callers keep the team they gave.
+func AssignTeam(ctx context.Context, entity any) {
+	scope, ok := TeamScopeFrom(ctx)
+	if !ok {
+		return
+	}
+	field := reflect.ValueOf(entity).Elem().FieldByName("TeamID")
+	if !field.IsValid() || field.Kind() != reflect.String || !field.CanSet() {
+		return
 	}
+	if scope.Unscoped && field.String() != "" {
+		return
+	}
+	field.SetString(scope.TeamID)
+}
+
+// applyTeamScope limits the query to the rows of the team in ctx. Calls without a scope, like
+// ones made outside of a request, aren't limited; scoped calls to models without a way to tell
+// their team get no rows at all.
+func (s *BaseServiceImpl[T]) applyTeamScope(ctx context.Context, query *gorm.DB) *gorm.DB {
+	scope, ok := TeamScopeFrom(ctx)
+	if !ok || scope.Unscoped {
+		return query
+	}
+	if s.teamCondition == "" {
+		return query.Where("1 = 0")
+	}
+	return query.Where(s.teamCondition, scope.TeamID)
 }
 
-// applyIncludes adds preload statements to the query for each include
-func (s *BaseServiceImpl[T]) applyIncludes(query *gorm.DB, includes ...string) *gorm.DB {
+// applyIncludes adds preload statements to the query for each include. Related rows with a team
+// of their own are limited to the team in ctx too, so a foreign key pointing into another team
+// doesn't load its row.
+func (s *BaseServiceImpl[T]) applyIncludes(ctx context.Context, query *gorm.DB, includes ...string) *gorm.DB {
+	scope, scoped := TeamScopeFrom(ctx)
 	for _, include := range includes {
+		if scoped && !scope.Unscoped && s.includeHasTeam(include) {
+			query = query.Preload(include, "team_id = ?", scope.TeamID)
+			continue
+		}
 		query = query.Preload(include)
 		// Handle nested includes with field selection
 		//parts := strings.Split(include, ".")
@@ -59,6 +171,23 @@ func (s *BaseServiceImpl[T]) applyIncludes(query *gorm.DB, includes ...string) *
 	return query
 }
 
+// includeHasTeam reports whether the rows an include loads have a team column
+func (s *BaseServiceImpl[T]) includeHasTeam(include string) bool {
+	relatedType := reflect.TypeOf(s.modelType)
+	for _, name := range strings.Split(include, ".") {
+		field, found := relatedType.FieldByName(name)
+		if !found {
+			return false
+		}
+		relatedType = field.Type
+		for relatedType.Kind() == reflect.Ptr || relatedType.Kind() == reflect.Slice {
+			relatedType = relatedType.Elem()
+		}
+	}
+	_, found := relatedType.FieldByName("TeamID")
+	return found
+}
+
 func (s *BaseServiceImpl[T]) applyExcludes(query *gorm.DB, excludes map[string]bool) *gorm.DB {
 	for field := range excludes {
 		query = query.Omit(field)
@@ -67,19 +196,23 @@ func (s *BaseServiceImpl[T]) applyExcludes(query *gorm.DB, excludes map[string]b
 }
 
 func (s *BaseServiceImpl[T]) Create(ctx context.Context, entity *T, includes ...string) error {
+	AssignTeam(ctx, entity)
 	if err := s.db.WithContext(ctx).Create(entity).Error; err != nil {
 		return err
 	}
 
 	// Reload the entity with includes if any are specified
 	if len(includes) > 0 {
-		if err := s.applyIncludes(s.db.WithContext(ctx), includes...).First(entity, "id = ?", reflect.ValueOf(*entity).FieldByName("ID").String()).Error; err != nil {
+		if err := s.applyIncludes(ctx, s.db.WithContext(ctx), includes...).First(entity, "id = ?", reflect.ValueOf(*entity).FieldByName("ID").String()).Error; err != nil {
 			return err
 		}
 	}
 
+	table := GormTableName(s.db, s.modelType)
+	models.RecordAuditChange(ctx, models.AuditActionCreate, table, reflect.ValueOf(*entity).FieldByName("ID").String(), nil, entity)
+
 	// Get the table name of the gorm model
-	events.Emit(fmt.Sprintf("%s.created", GormTableName(s.db, s.modelType)), entity)
+	events.Emit(fmt.Sprintf("%s.created", table), entity)
 
 	return nil
 }
@@ -87,10 +220,11 @@ func (s *BaseServiceImpl[T]) Create(ctx context.Context, entity *T, includes ...
 func (s *BaseServiceImpl[T]) Get(ctx context.Context, id string, includes ...string) (*T, error) {
 	var entity T
 	query := s.db.WithContext(ctx)
-	query = s.applyIncludes(query, includes...)
+	query = s.applyIncludes(ctx, query, includes...)
 
 	// filter deleted entities
 	query = query.Where("is_deleted = ?", false)
+	query = s.applyTeamScope(ctx, query)
 
 	if err := query.First(&entity, "id = ?", id).Error; err != nil {
 		return nil, err
@@ -98,42 +232,76 @@ func (s *BaseServiceImpl[T]) Get(ctx context.Context, id string, includes ...str
 	return &entity, nil
 }
 
-func (s *BaseServiceImpl[T]) List(ctx context.Context, page, limit int, filters map[string]interface{}, excludes map[string]bool, sortFields []string, order string, includes ...string) ([]T, int64, error) {
+func (s *BaseServiceImpl[T]) List(ctx context.Context, q ListQuery) ([]T, int64, error) {
 	var entities []T
 	var total int64
 
 	query := s.db.WithContext(ctx).Model(s.modelType)
 
 	// Apply filters
-	for key, value := range filters {
-		query = query.Where(key+" = ?", value)
-	}
-
-	// Apply includes
-	query = s.applyIncludes(query, includes...)
-
-	// Apply pagination
-	if page > 0 && limit > 0 {
-		offset := (page - 1) * limit
-		query = query.Offset(offset).Limit(limit)
-	}
-
-	// Apply excludes
-	query = s.applyExcludes(query, excludes)
-
-	// Apply sort
-	if len(sortFields) > 0 {
-		query = query.Order(fmt.Sprintf("%s %s", sortFields[0], order))
+	for column, value := range q.Filters {
+		query = query.Where(clause.Eq{Column: clause.Column{Name: column}, Value: value})
 	}
 
 	// filter deleted entities
 	query = query.Where("is_deleted = ?", false)
+	query = s.applyTeamScope(ctx, query).Session(&gorm.Session{})
 
-	// Get total count
+	// Get total count, of every page
 	if err := query.Count(&total).Error; err != nil {
 		return nil, 0, err
 	}
 
+	// Apply sort, with the ID breaking ties so pages don't overlap
+	sort := q.Sort
+	if sort == "" {
+		sort = "created_at"
+	}
+	dir, op := "ASC", ">"
+	if q.Desc {
+		dir, op = "DESC", "<"
+	}
+	column, id := clause.Column{Name: sort}, clause.Column{Name: "id"}
+	if q.Nullable {
+		// Postgres sorts NULLs first when descending, so they're put last to keep one order
+		// the cursor predicate below can follow
+		query = query.Order(clause.OrderBy{Expression: clause.Expr{SQL: "? " + dir + " NULLS LAST, ? " + dir, Vars: []interface{}{column, id}}})
+	} else {
+		query = query.Order(clause.OrderBy{Columns: []clause.OrderByColumn{
+			{Column: column, Desc: q.Desc},
+			{Column: id, Desc: q.Desc},
+		}})
+	}
+
+	// Apply pagination, continuing after the cursor when there is one. Comparing with NULL is
+	// never true, so past a non NULL value the NULLs still to come are added, and past a NULL
+	// only the following NULLs are left.
+	if q.After != nil {
+		switch {
+		case q.After.Value == nil:
+			query = query.Where(clause.Expr{SQL: "? IS NULL AND ? " + op + " ?", Vars: []interface{}{column, id, q.After.ID}})
+		case q.Nullable:
+			query = query.Where(clause.Expr{
+				SQL:  "((?, ?) " + op + " (?, ?) OR ? IS NULL)",
+				Vars: []interface{}{column, id, q.After.Value, q.After.ID, column},
+			})
+		default:
+			query = query.Where(clause.Expr{
+				SQL:  "(?, ?) " + op + " (?, ?)",
+				Vars: []interface{}{column, id, q.After.Value, q.After.ID},
+			})
+		}
+	} else if q.Offset > 0 {
+		query = query.Offset(q.Offset)
+	}
+	if q.Limit > 0 {
+		query = query.Limit(q.Limit)
+	}
+
+	// Apply includes and excludes
+	query = s.applyIncludes(ctx, query, q.Includes...)
+	query = s.applyExcludes(query, q.Excludes)
+
 	// Execute query
 	if err := query.Find(&entities).Error; err != nil {
 		return nil, 0, err
@@ -143,28 +311,60 @@ func (s *BaseServiceImpl[T]) List(ctx context.Context, page, limit int, filters
 }
 
 func (s *BaseServiceImpl[T]) Update(ctx context.Context, id string, entity *T, includes ...string) error {
-	if err := s.db.WithContext(ctx).Model(entity).Where("id = ? AND is_deleted = ?", id, false).Omit("id").Omit("teamId").Updates(entity).Error; err != nil {
-		return err
+	// The row as it was, for the audit log's diff
+	var before *T
+	if models.IsAudited(ctx) {
+		before = new(T)
+		if err := s.applyTeamScope(ctx, s.db.WithContext(ctx)).Where("is_deleted = ?", false).First(before, "id = ?", id).Error; err != nil {
+			return err
+		}
+	}
+
+	// Rows can't be moved to another team
+	query := s.applyTeamScope(ctx, s.db.WithContext(ctx).Model(entity).Where("id = ? AND is_deleted = ?", id, false))
+	result := query.Omit("id", "team_id").Updates(entity)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
 	}
 
 	// Reload the entity with includes if any are specified
 	if len(includes) > 0 {
-		if err := s.applyIncludes(s.db.WithContext(ctx), includes...).First(entity, "id = ?", id).Error; err != nil {
+		if err := s.applyIncludes(ctx, s.db.WithContext(ctx), includes...).First(entity, "id = ?", id).Error; err != nil {
 			return err
 		}
 	}
 
-	events.Emit(fmt.Sprintf("%s.updated", GormTableName(s.db, s.modelType)), entity)
+	table := GormTableName(s.db, s.modelType)
+	if before != nil {
+		// Updates skips the zero fields of entity, so the diff is against the row as saved
+		after := new(T)
+		if err := s.db.WithContext(ctx).First(after, "id = ?", id).Error; err == nil {
+			models.RecordAuditChange(ctx, models.AuditActionUpdate, table, id, before, after)
+		}
+	}
+
+	events.Emit(fmt.Sprintf("%s.updated", table), entity)
 
 	return nil
 }
 
 func (s *BaseServiceImpl[T]) Delete(ctx context.Context, id string) error {
-	if err := s.db.WithContext(ctx).Model(s.modelType).Where("id = ? AND is_deleted = ?", id, false).Update("deleted_at", time.Now()).Update("is_deleted", true).Error; err != nil {
-		return err
+	query := s.applyTeamScope(ctx, s.db.WithContext(ctx).Model(s.modelType).Where("id = ? AND is_deleted = ?", id, false))
+	result := query.Updates(map[string]interface{}{"deleted_at": time.Now(), "is_deleted": true})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
 	}
 
-	events.Emit(fmt.Sprintf("%s.deleted", GormTableName(s.db, s.modelType)), id)
+	table := GormTableName(s.db, s.modelType)
+	models.RecordAuditChange(ctx, models.AuditActionDelete, table, id, nil, nil)
+
+	events.Emit(fmt.Sprintf("%s.deleted", table), id)
 
 	return nil
 }
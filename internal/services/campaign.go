@@ -0,0 +1,38 @@
+package services
+
+import (
+	"context"
+	"kori/internal/db"
+	"kori/internal/events"
+	"kori/internal/models"
+	"kori/internal/utils/logger"
+)
+
+var campaignLog = logger.New("CAMPAIGN")
+
+func init() {
+	// Nothing queued for a cancelled or deleted campaign may fire later
+	events.On("campaign.cancelled", func(data interface{}) {
+		campaign := data.(*models.Campaign)
+		cancelCampaignQueue(campaign.ID)
+	})
+
+	events.On("campaigns.deleted", func(data interface{}) {
+		campaignID := data.(string)
+		cancelCampaignQueue(campaignID)
+	})
+}
+
+// cancelCampaignQueue removes the campaign's waiting tasks and cancels its unsent emails
+func cancelCampaignQueue(campaignID string) {
+	if _, err := taskClient.CancelCampaignTasks(context.Background(), campaignID); err != nil {
+		campaignLog.Warn("Failed to delete queued tasks of campaign %s: %v", campaignID, err)
+	}
+
+	cancelled, err := models.CancelCampaignEmails(campaignID, db.DB)
+	if err != nil {
+		campaignLog.Warn("Failed to cancel queued emails of campaign %s: %v", campaignID, err)
+		return
+	}
+	campaignLog.Info("Cancelled %d queued emails of campaign %s", cancelled, campaignID)
+}
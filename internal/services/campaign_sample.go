@@ -0,0 +1,74 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"kori/internal/db"
+	"kori/internal/events"
+	"kori/internal/models"
+	"kori/internal/tasks"
+	"strings"
+	"time"
+)
+
+func init() {
+	events.On("campaign.sample_failed", func(data interface{}) {
+		result := data.(*models.SampleResult)
+		alertLog.Warn("⏸️ Sample of campaign %s failed: %s", result.CampaignID, strings.Join(result.Reasons, ", "))
+
+		deliverSampleWebhooks(context.Background(), result)
+
+		reasons := make([]string, len(result.Reasons))
+		for i, reason := range result.Reasons {
+			reasons[i] = "<li>" + html.EscapeString(reason) + "</li>"
+		}
+		body := fmt.Sprintf(`<html><body>
+<p>Hey {{ name }} 👋🏻,</p>
+<p>The campaign <strong>%s</strong> was sent to a sample of %d contacts first, and the sample didn't look healthy:</p>
+<ul>
+%s
+</ul>
+<p>The campaign has been <strong>paused</strong> before reaching the rest of its audience. Clean up the list, then resume it to send to everyone else.</p>
+</body></html>`, html.EscapeString(result.CampaignName), result.Stats.Sent, strings.Join(reasons, "\n"))
+
+		subject := fmt.Sprintf("Paused %s after its sample", result.CampaignName)
+		if err := notifyTeamAdmins(db.DB, result.TeamID, subject, body); err != nil {
+			alertLog.Error("Failed to notify admins of failed sample", err)
+		}
+	})
+}
+
+// deliverSampleWebhooks sends a failed sample to the team's campaign alert webhooks
+func deliverSampleWebhooks(ctx context.Context, result *models.SampleResult) {
+	var webhooks []models.Webhook
+	if err := db.DB.WithContext(ctx).
+		Where("team_id = ? AND is_active = true AND is_deleted = false AND ? = ANY(events)", result.TeamID, "campaign.alert").
+		Find(&webhooks).Error; err != nil {
+		alertLog.Error("failed to get alert webhooks", err)
+		return
+	}
+
+	for _, webhook := range webhooks {
+		task := tasks.WebhookDeliveryTask{
+			WebhookID: webhook.ID,
+			Event:     "campaign.alert",
+			Payload: map[string]interface{}{
+				"campaignId":       result.CampaignID,
+				"campaignName":     result.CampaignName,
+				"sample":           true,
+				"bounceRate":       result.BounceRate,
+				"complaintRate":    result.ComplaintRate,
+				"maxBounceRate":    result.MaxBounceRate,
+				"maxComplaintRate": result.MaxComplaintRate,
+				"reasons":          result.Reasons,
+				"paused":           true,
+				"triggeredAt":      time.Now().UTC(),
+			},
+			AttemptNum: 1,
+		}
+		if err := taskClient.EnqueueWebhookDeliveryTask(ctx, task); err != nil {
+			alertLog.Error("failed to enqueue alert webhook", err)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"kori/internal/db"
+	"kori/internal/events"
+	"kori/internal/handlers"
+	"kori/internal/models"
+	"kori/internal/tasks"
+	"kori/internal/utils"
+	"kori/internal/utils/crypto"
+	"kori/internal/utils/logger"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+var timelineLog = logger.New("CONTACT_TIMELINE")
+
+func init() {
+	events.On("contact_timeline_export.created", func(data interface{}) {
+		export := data.(*models.ContactTimelineExport)
+		if export.Status != models.ContactTimelineExportStatusPending {
+			return
+		}
+		if err := taskClient.EnqueueContactTimelineExportTask(context.Background(), tasks.ContactTimelineExportTask{
+			ExportID: export.ID,
+		}); err != nil {
+			timelineLog.Error("Failed to enqueue contact timeline export task", err)
+		}
+	})
+
+	events.On("contact_timeline_export.generate", func(data interface{}) {
+		export := data.(*models.ContactTimelineExport)
+		if err := generateContactTimelineExport(context.Background(), export); err != nil {
+			timelineLog.Warn("Failed to generate contact timeline export %s: %v", export.ID, err)
+			if err := db.DB.Model(&models.ContactTimelineExport{}).Where("id = ?", export.ID).Updates(map[string]interface{}{
+				"status": models.ContactTimelineExportStatusFailed,
+				"error":  err.Error(),
+			}).Error; err != nil {
+				timelineLog.Error("Failed to record failed contact timeline export", err)
+			}
+		}
+	})
+}
+
+// generateContactTimelineExport builds the export's file, signs it and stores it privately
+func generateContactTimelineExport(ctx context.Context, export *models.ContactTimelineExport) error {
+	entries, truncated, err := models.GetContactTimeline(export.TeamID, export.Email, db.DB)
+	if err != nil {
+		return err
+	}
+	export.Truncated = truncated
+
+	content, contentType, ext, err := utils.RenderContactTimeline(export, entries)
+	if err != nil {
+		return err
+	}
+
+	digest := sha256.Sum256(content)
+	signature, err := crypto.SignDocument(content)
+	if err != nil {
+		return fmt.Errorf("failed to sign export: %w", err)
+	}
+
+	storage := handlers.GetStorageHandler()
+	if storage == nil {
+		return fmt.Errorf("storage handler not configured")
+	}
+	url, err := storage.UploadFile(ctx, content, "contact-timeline"+ext, types.ObjectCannedACLPrivate, contentType)
+	if err != nil {
+		return fmt.Errorf("failed to upload export: %w", err)
+	}
+
+	now := time.Now()
+	export.Path = url[strings.LastIndex(url, "/")+1:]
+	export.Checksum = hex.EncodeToString(digest[:])
+	export.Signature = signature
+	export.Entries = len(entries)
+	export.Status = models.ContactTimelineExportStatusCompleted
+	export.CompletedAt = &now
+	if err := db.DB.Model(&models.ContactTimelineExport{}).Where("id = ?", export.ID).Updates(map[string]interface{}{
+		"path":         export.Path,
+		"checksum":     export.Checksum,
+		"signature":    export.Signature,
+		"entries":      export.Entries,
+		"truncated":    export.Truncated,
+		"status":       export.Status,
+		"error":        "",
+		"completed_at": now,
+	}).Error; err != nil {
+		return fmt.Errorf("failed to record export: %w", err)
+	}
+
+	timelineLog.Success("Exported %d timeline entries of %s for team %s", len(entries), export.Email, export.TeamID)
+	events.Emit("contact_timeline_export.completed", export)
+	return nil
+}
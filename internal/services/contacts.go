@@ -2,6 +2,7 @@ package services
 
 import (
 	"context"
+	"kori/internal/db"
 	"kori/internal/events"
 	"kori/internal/models"
 	"kori/internal/tasks"
@@ -20,4 +21,43 @@ func init() {
 			}
 		}
 	})
+
+	events.On("contact_import.confirmed", func(data interface{}) {
+		contact_import := data.(*models.ContactImport)
+		if err := taskClient.EnqueueContactImportTask(context.Background(), tasks.ContactImportTask{ImportID: contact_import.ID}); err != nil {
+			log.Error("Failed to enqueue contact import task: %v", err)
+		}
+	})
+
+	events.On("contact_sync.requested", func(data interface{}) {
+		source := data.(*models.ContactSyncSource)
+		log.Info("Contact sync requested for source %s", source.ID)
+		if err := taskClient.EnqueueContactSyncTask(context.Background(), tasks.ContactSyncTask{SourceID: source.ID}); err != nil {
+			log.Error("Failed to enqueue contact sync task: %v", err)
+		}
+	})
+
+	events.On("contact.confirmation_requested", func(data interface{}) {
+		contact := data.(*models.Contact)
+		if err := taskClient.EnqueueContactConfirmationTask(context.Background(), tasks.ContactConfirmationTask{ContactID: contact.ID}); err != nil {
+			log.Error("Failed to enqueue contact confirmation task: %v", err)
+		}
+	})
+
+	events.On("contacts.dedupe", func(data interface{}) {
+		var teamIDs []string
+		if err := db.DB.Model(&models.Team{}).Where("is_deleted = false").Pluck("id", &teamIDs).Error; err != nil {
+			log.Error("Failed to get teams to dedupe contacts of", err)
+			return
+		}
+		merged := 0
+		for _, teamID := range teamIDs {
+			count, err := models.DedupeContacts(teamID, db.DB)
+			merged += count
+			if err != nil {
+				log.Warn("Failed to dedupe contacts of team %s: %v", teamID, err)
+			}
+		}
+		log.Success("Merged %d duplicate contacts", merged)
+	})
 }
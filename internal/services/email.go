@@ -2,6 +2,7 @@ package services
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"kori/internal/config"
@@ -25,21 +26,26 @@ var (
 )
 
 type sendEmailHandlerBody struct {
-	teamId       string
-	templateId   string
-	to           string
-	SMTPProvider string
-	categoryId   string
-	variables    map[string]string
-	subject      string
-	listId       string
-	campaignId   string
-	body         string
-	cc           string
-	bcc          string
-	replyTo      string
-	testMail     bool
-	sendAt       time.Time
+	teamId         string
+	templateId     string
+	to             string
+	SMTPProvider   string
+	categoryId     string
+	variables      map[string]string
+	subject        string
+	listId         string
+	campaignId     string
+	body           string
+	plainText      string
+	cc             string
+	bcc            string
+	replyTo        string
+	testMail       bool
+	sendAt         time.Time
+	emailId        string // set when the caller already handed out the email's ID
+	idempotencyKey string
+	attachmentIds  []string
+	signature      string // rendered signature appended to the body
 }
 
 func init() {
@@ -153,7 +159,7 @@ func init() {
 		var emailData map[string]string
 		var err error
 		if email.Data != nil {
-			emailData, err = utils.JSONToMap(email.Data)
+			emailData, err = utils.JSONToVariables(email.Data)
 			if err != nil {
 				log.Error("Failed to convert data to map: %v", err)
 				return
@@ -161,27 +167,43 @@ func init() {
 		}
 
 		handler := &sendEmailHandlerBody{
-			teamId:       email.TeamID,
-			templateId:   email.TemplateID,
-			to:           email.To,
-			SMTPProvider: email.SMTPConfigID,
-			categoryId:   email.CategoryID,
-			variables:    emailData,
-			subject:      email.Subject,
-			listId:       "",
-			campaignId:   email.CampaignID,
-			body:         email.Body,
-			cc:           email.CC,
-			bcc:          email.BCC,
-			replyTo:      email.ReplyTo,
-			testMail:     email.Test,
-			sendAt:       email.SendAt,
+			teamId:         email.TeamID,
+			templateId:     email.TemplateID,
+			to:             email.To,
+			SMTPProvider:   email.SMTPConfigID,
+			categoryId:     email.CategoryID,
+			variables:      emailData,
+			subject:        email.Subject,
+			listId:         "",
+			campaignId:     email.CampaignID,
+			body:           email.Body,
+			plainText:      email.PlainText,
+			cc:             email.CC,
+			bcc:            email.BCC,
+			replyTo:        email.ReplyTo,
+			testMail:       email.Test,
+			sendAt:         email.SendAt,
+			emailId:        email.ID,
+			idempotencyKey: email.IdempotencyKey,
+			signature:      email.Signature,
+		}
+		for _, attachment := range email.Attachments {
+			handler.attachmentIds = append(handler.attachmentIds, attachment.FileID)
 		}
 
 		if err := sendEmail(handler); err != nil {
-			err := log.Error("Failed to send email: %v", err)
-			if err != nil {
-				return
+			log.Error("Failed to send email: %v", err)
+			if !email.Test {
+				// The handler took a credit for the email, which was never queued
+				if err := models.RefundQuota(email.TeamID, models.QuotaResourceEmails, 1, db.DB); err != nil {
+					log.Error("Failed to refund email quota: %v", err)
+				}
+			}
+			if email.IdempotencyKey != "" {
+				// Nothing was queued, so let the client retry with the same key
+				if err := models.ReleaseIdempotencyKey(email.TeamID, email.IdempotencyKey, email.ID, db.DB); err != nil {
+					log.Error("Failed to release idempotency key: %v", err)
+				}
 			}
 		}
 	})
@@ -390,6 +412,11 @@ func sendEmail(
 	}
 
 	definedID := uuid.New()
+	if handler.emailId != "" {
+		if parsed, err := uuid.Parse(handler.emailId); err == nil {
+			definedID = parsed
+		}
+	}
 
 	// Get SMTP config
 	smtpConfig, err := models.GetSMTPConfig(handler.teamId, handler.SMTPProvider, "", tx)
@@ -473,7 +500,71 @@ func sendEmail(
 		return log.Error("failed to get html from template ❌", errors.New("body is empty"))
 	}
 
-	parsedBody := utils.ReplaceVariables(htmlFromTemplate, handler.variables, definedID.String(), cfg, true)
+	// Shared snippets first, as they may hold content blocks
+	rendered, err := models.RenderSnippets(handler.teamId, []string{htmlFromTemplate}, tx)
+	if err != nil {
+		tx.Rollback()
+		return log.Error("failed to render snippets ❌", err)
+	}
+	htmlFromTemplate = rendered[0]
+
+	// Dynamic content blocks; test mails have no contact so only untargeted variants apply
+	var blockContact *models.Contact
+	var blockContactIDs []string
+	if contact.ID != "" {
+		blockContact = contact
+		blockContactIDs = []string{contact.ID}
+	}
+	blocks, err := models.NewContentBlockRenderer(handler.teamId, []string{htmlFromTemplate}, blockContactIDs, tx)
+	if err != nil {
+		tx.Rollback()
+		return log.Error("failed to load content blocks ❌", err)
+	}
+	htmlFromTemplate, picked := blocks.Render(htmlFromTemplate, blockContact)
+	contentVariants, err := json.Marshal(picked)
+	if err != nil {
+		tx.Rollback()
+		return log.Error("failed to encode content variants ❌", err)
+	}
+
+	// The template's preheader and text alternative apply when its html is sent
+	text := handler.plainText
+	preheader := ""
+	if handler.body == "" {
+		preheader = template.Preheader
+		if text == "" {
+			text = template.PlainText
+		}
+	}
+	htmlFromTemplate, text = utils.AppendSignature(htmlFromTemplate, text, handler.signature)
+	// The recipient's contact, metadata included, is there for templates unless the sender gave one
+	if _, given := handler.variables["contact"]; contact.ID != "" && !given {
+		if handler.variables == nil {
+			handler.variables = map[string]string{}
+		}
+		handler.variables["contact"] = contact.TemplateVariables()["contact"]
+	}
+	// So are the team's computed fields
+	if contact.ID != "" {
+		computed, err := models.ComputeContactFields(handler.teamId, []string{contact.ID}, tx)
+		if err != nil {
+			tx.Rollback()
+			return log.Error("failed to compute contact fields ❌", err)
+		}
+		if handler.variables == nil {
+			handler.variables = map[string]string{}
+		}
+		for name, value := range computed[contact.ID] {
+			if _, given := handler.variables[name]; !given {
+				handler.variables[name] = value
+			}
+		}
+	}
+	html := htmlFromTemplate
+	htmlFromTemplate, handler.variables = utils.WithPreheader(htmlFromTemplate, preheader, handler.variables)
+	parsedText := utils.PlainTextBody(text, html, handler.variables)
+
+	parsedBody := utils.ReplaceVariablesWithLinks(htmlFromTemplate, handler.variables, definedID.String(), cfg, models.NewLinkRegistry(handler.teamId, "", tx))
 	parsedSubject := handler.subject
 	if handler.subject == "" {
 		parsedSubject = utils.ReplaceVariables(template.Subject, handler.variables, definedID.String(), cfg, false)
@@ -491,27 +582,56 @@ func sendEmail(
 		return log.Error("failed to convert variables to json ❌", err)
 	}
 
+	files, err := models.GetAttachmentFiles(handler.teamId, handler.attachmentIds, tx)
+	if err != nil {
+		tx.Rollback()
+		return log.Error("failed to get attachments ❌", err)
+	}
+	attachments := make([]models.EmailAttachment, len(files))
+	for i, file := range files {
+		attachments[i] = models.EmailAttachment{FileID: file.ID, TeamID: handler.teamId}
+	}
+
 	// Create email
 	email := &models.Email{
-		From:         smtpConfig.FromEmail,
-		TeamID:       handler.teamId,
-		TemplateID:   handler.templateId,
-		To:           handler.to,
-		Subject:      parsedSubject,
-		Body:         parsedBody,
-		Status:       models.EmailStatusPending,
-		Data:         jsonData,
-		ContactID:    contact.ID,
-		CategoryID:   category.ID,
-		SMTPConfigID: smtpConfig.ID,
-		CampaignID:   handler.campaignId,
-		CC:           handler.cc,
-		BCC:          handler.bcc,
-		ReplyTo:      handler.replyTo,
-		SendAt:       handler.sendAt,
+		From:            smtpConfig.FromEmail,
+		TeamID:          handler.teamId,
+		TemplateID:      handler.templateId,
+		To:              handler.to,
+		Subject:         parsedSubject,
+		Body:            parsedBody,
+		PlainText:       parsedText,
+		Status:          models.EmailStatusPending,
+		Data:            jsonData,
+		ContactID:       contact.ID,
+		CategoryID:      category.ID,
+		SMTPConfigID:    smtpConfig.ID,
+		CampaignID:      handler.campaignId,
+		CC:              handler.cc,
+		BCC:             handler.bcc,
+		ReplyTo:         handler.replyTo,
+		SendAt:          handler.sendAt,
+		ContentVariants: contentVariants,
+		IdempotencyKey:  handler.idempotencyKey,
+		Attachments:     attachments,
 	}
 
 	email.ID = definedID.String()
+
+	// Copies go to valid addresses only, and never to ones the team may no longer mail
+	if err := email.NormalizeRecipients(); err != nil {
+		tx.Rollback()
+		return log.Error("invalid recipients ❌", err)
+	}
+	suppressed, err := email.SuppressCopyRecipients(tx)
+	if err != nil {
+		tx.Rollback()
+		return log.Error("failed to check suppressed recipients ❌", err)
+	}
+	if len(suppressed) > 0 {
+		log.Info("Dropped %d suppressed cc/bcc recipients from email %s", len(suppressed), email.ID)
+	}
+
 	if err := tx.Create(email).Error; err != nil {
 		tx.Rollback()
 		return log.Error("failed to create email ❌", err)
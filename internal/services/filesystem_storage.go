@@ -0,0 +1,77 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/google/uuid"
+
+	"kori/internal/config"
+	"kori/internal/models"
+	"kori/internal/utils"
+	"kori/internal/utils/logger"
+)
+
+// Ensure FilesystemStorage implements FileURLGenerator
+var _ models.FileURLGenerator = (*FilesystemStorage)(nil)
+
+// FilesystemStorage keeps files in a directory, for self-hosted deployments without S3. The API
+// serves them at /files/{name} behind signed, expiring links.
+type FilesystemStorage struct {
+	basePath string
+	cfg      *config.Config
+	logger   *logger.Logger
+}
+
+func NewFilesystemStorage(cfg *config.Config) (*FilesystemStorage, error) {
+	log := logger.New("filesystem_storage")
+
+	basePath, err := filepath.Abs(cfg.Storage.BasePath)
+	if err != nil {
+		return nil, log.Error("Invalid storage base path ❌", err)
+	}
+	if err := os.MkdirAll(basePath, 0o750); err != nil {
+		return nil, log.Error("Failed to create storage directory ❌", err)
+	}
+
+	log.Success("Filesystem storage initialized at %s ✅", basePath)
+
+	return &FilesystemStorage{basePath: basePath, cfg: cfg, logger: log}, nil
+}
+
+// UploadFile writes a file under a unique name and returns its URL. ACLs don't apply: every
+// file is only reachable through a signed link.
+func (s *FilesystemStorage) UploadFile(ctx context.Context, file []byte, filename string, acl types.ObjectCannedACL, contentType string) (string, error) {
+	name := uuid.New().String() + filepath.Ext(filename)
+	if err := os.WriteFile(filepath.Join(s.basePath, name), file, 0o640); err != nil {
+		return "", s.logger.Error("Failed to write file to storage ❌", err)
+	}
+
+	url := fmt.Sprintf("%s/files/%s", s.cfg.Server.PublicURL, name)
+	s.logger.Success("✅ File stored successfully: %s", name)
+	return url, nil
+}
+
+// GetSignedURL implements FileURLGenerator interface
+func (s *FilesystemStorage) GetSignedURL(ctx context.Context, path string, duration time.Duration) (string, error) {
+	expires := time.Now().Add(duration).Unix()
+	return fmt.Sprintf("%s/files/%s?expires=%d&sig=%s", s.cfg.Server.PublicURL, url.PathEscape(path),
+		expires, utils.FileSignature(path, expires, s.cfg)), nil
+}
+
+// DeleteFile removes a file from storage. Deleting a file that doesn't exist succeeds.
+func (s *FilesystemStorage) DeleteFile(ctx context.Context, path string) error {
+	if strings.ContainsAny(path, `/\`) {
+		return fmt.Errorf("invalid file name %q", path)
+	}
+	if err := os.Remove(filepath.Join(s.basePath, path)); err != nil && !os.IsNotExist(err) {
+		return s.logger.Error("Failed to delete file from storage ❌", err)
+	}
+	return nil
+}
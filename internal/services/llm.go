@@ -0,0 +1,98 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"kori/internal/db"
+	"kori/internal/events"
+	"kori/internal/handlers"
+	"kori/internal/models"
+	"kori/internal/tasks"
+	"kori/internal/utils/logger"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/google/uuid"
+)
+
+var llmLog = logger.New("LLM")
+
+func init() {
+	events.On("llm_email_writer_job.created", func(data interface{}) {
+		job := data.(*models.LLMEmailWriterJob)
+		if job.Status != "" && job.Status != models.LLMJobStatusPending {
+			return
+		}
+		if err := taskClient.EnqueueLLMEmailWriterTask(context.Background(), tasks.LLMEmailWriterTask{
+			JobID:      job.ID,
+			EmailID:    job.EmailID,
+			TemplateID: job.TemplateID,
+			TeamID:     job.TeamID,
+			ModelID:    job.ModelID,
+		}); err != nil {
+			llmLog.Error("Failed to enqueue LLM email writer task", err)
+		}
+	})
+
+	// The generated body replaces the body of the job's email and the html of its template
+	events.On("llm_email_writer.completed", func(data interface{}) {
+		job := data.(*models.LLMEmailWriterJob)
+		if job.EmailID != "" {
+			if err := attachOutputToEmail(job); err != nil {
+				llmLog.Warn("Failed to attach LLM output of job %s to email %s: %v", job.ID, job.EmailID, err)
+			}
+		}
+		if job.TemplateID != "" {
+			if err := attachOutputToTemplate(job); err != nil {
+				llmLog.Warn("Failed to attach LLM output of job %s to template %s: %v", job.ID, job.TemplateID, err)
+			}
+		}
+	})
+}
+
+// attachOutputToEmail sets the body of the job's email unless it has already gone out
+func attachOutputToEmail(job *models.LLMEmailWriterJob) error {
+	result := db.DB.Model(&models.Email{}).
+		Where("id = ? AND status IN ? AND is_deleted = false", job.EmailID, []models.EmailStatus{models.EmailStatusPending, models.EmailStatusFailed}).
+		Update("body", job.Output)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("email is not waiting to be sent")
+	}
+	return nil
+}
+
+// attachOutputToTemplate uploads the output as the template's html file
+func attachOutputToTemplate(job *models.LLMEmailWriterJob) error {
+	template := &models.Template{}
+	if err := db.DB.Where("id = ? AND is_deleted = false", job.TemplateID).First(template).Error; err != nil {
+		return err
+	}
+
+	storage := handlers.GetStorageHandler()
+	if storage == nil {
+		return fmt.Errorf("storage handler not configured")
+	}
+
+	content := []byte(job.Output)
+	fileName := fmt.Sprintf("tmp/%s.html", uuid.New().String())
+	url, err := storage.UploadFile(context.Background(), content, fileName, types.ObjectCannedACLAuthenticatedRead, "text/html")
+	if err != nil {
+		return fmt.Errorf("failed to upload html: %w", err)
+	}
+
+	file := &models.File{
+		TeamID: template.TeamID,
+		Path:   url[strings.LastIndex(url, "/")+1:],
+		Name:   fileName,
+		Size:   int64(len(content)),
+		Type:   "text/html",
+	}
+	if err := db.DB.Create(file).Error; err != nil {
+		return fmt.Errorf("failed to create file record: %w", err)
+	}
+
+	return db.DB.Model(template).Update("html_file_id", file.ID).Error
+}
@@ -0,0 +1,52 @@
+package services
+
+import (
+	"fmt"
+	"html"
+	"kori/internal/db"
+	"kori/internal/events"
+	"kori/internal/models"
+	"kori/internal/utils/logger"
+	"os"
+)
+
+var pipelineSLALog = logger.New("PIPELINE_SLA")
+
+func init() {
+	// The pipeline is shared by every team, so breaches go to the platform team's admins
+	events.On("email_pipeline.sla_breached", func(data interface{}) {
+		breach := data.(models.PipelineLatency)
+
+		platformTeam, err := models.GetTeamByName(os.Getenv("SUPERADMIN_TEAM_NAME"), db.DB)
+		if err != nil {
+			pipelineSLALog.Error("Failed to get superadmin team", err)
+			return
+		}
+
+		through := ""
+		if breach.SMTPConfigID != "" {
+			through = fmt.Sprintf(" through SMTP server <strong>%s</strong> (config %s, team %s)",
+				html.EscapeString(breach.SMTPHost), breach.SMTPConfigID, breach.TeamID)
+		}
+		body := fmt.Sprintf(`<html><body>
+<p>Hey {{ name }} 👋🏻,</p>
+<p>Emails on the <strong>%s</strong> queue%s are taking longer than their SLA to be delivered.</p>
+<ul>
+<li>Delivered: %d emails</li>
+<li>Enqueue to delivered: p50 %.1fs, p95 <strong>%.1fs</strong>, p99 %.1fs (SLA p95 %.0fs)</li>
+<li>Time in queue: p50 %.1fs, p95 %.1fs, p99 %.1fs</li>
+</ul>
+<p>A long time in queue points at too few workers or a backlog; a long delivery with a short time in queue points at the SMTP server or retries.</p>
+</body></html>`, html.EscapeString(breach.Queue), through, breach.Emails,
+			breach.Delivery.P50, breach.Delivery.P95, breach.Delivery.P99, breach.SLASeconds,
+			breach.TimeInQueue.P50, breach.TimeInQueue.P95, breach.TimeInQueue.P99)
+
+		subject := fmt.Sprintf("Email pipeline SLA breached on the %s queue", breach.Queue)
+		if breach.SMTPHost != "" {
+			subject += " via " + breach.SMTPHost
+		}
+		if err := notifyTeamAdmins(db.DB, platformTeam.ID, subject, body); err != nil {
+			pipelineSLALog.Error("Failed to notify admins of pipeline sla breach", err)
+		}
+	})
+}
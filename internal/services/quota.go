@@ -0,0 +1,225 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"kori/internal/db"
+	"kori/internal/events"
+	"kori/internal/models"
+	"kori/internal/tasks"
+	"kori/internal/utils/logger"
+	"os"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var quotaLog = logger.New("QUOTA")
+
+// QuotaService tracks team usage against plan limits and raises soft warnings
+type QuotaService struct {
+	db *gorm.DB
+}
+
+// NewQuotaService creates a new quota service
+func NewQuotaService(db *gorm.DB) *QuotaService {
+	return &QuotaService{db: db}
+}
+
+func init() {
+	events.On("email.created", func(data interface{}) {
+		email := data.(*models.Email)
+		if err := NewQuotaService(db.DB).CheckThresholds(context.Background(), email.TeamID); err != nil {
+			quotaLog.Error("Failed to check email quota thresholds: %v", err)
+		}
+	})
+
+	events.On("contacts.created", func(data interface{}) {
+		contact := data.(*models.Contact)
+		if err := NewQuotaService(db.DB).CheckThresholds(context.Background(), contact.TeamID); err != nil {
+			quotaLog.Error("Failed to check contact quota thresholds: %v", err)
+		}
+	})
+
+	events.On("quota.digest", func(data interface{}) {
+		if err := NewQuotaService(db.DB).SendDailyDigest(context.Background()); err != nil {
+			quotaLog.Error("Failed to send quota digest: %v", err)
+		}
+	})
+}
+
+// GetUsage returns the current quota usage for a team
+func (s *QuotaService) GetUsage(ctx context.Context, teamID string) ([]models.QuotaUsage, error) {
+	return models.GetTeamQuotaUsage(teamID, s.db.WithContext(ctx))
+}
+
+// CheckThresholds records every warning threshold the team has crossed this period and
+// notifies once per crossing. When several thresholds are crossed at once only the highest is announced.
+func (s *QuotaService) CheckThresholds(ctx context.Context, teamID string) error {
+	if teamID == "" {
+		return nil
+	}
+
+	usages, err := s.GetUsage(ctx, teamID)
+	if err != nil {
+		return quotaLog.Error("failed to get quota usage", err)
+	}
+
+	period := models.GetQuotaPeriodKey(time.Now().UTC())
+
+	for _, usage := range usages {
+		var crossed *models.QuotaNotification
+		for _, threshold := range models.QuotaWarningThresholds {
+			if usage.Percent < float64(threshold) {
+				continue
+			}
+
+			notification := &models.QuotaNotification{
+				TeamID:    teamID,
+				Resource:  usage.Resource,
+				Period:    period,
+				Threshold: threshold,
+				Used:      usage.Used,
+				Limit:     usage.Limit,
+			}
+			result := s.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(notification)
+			if result.Error != nil {
+				return quotaLog.Error("failed to record quota notification", result.Error)
+			}
+			if result.RowsAffected == 1 {
+				crossed = notification
+			}
+		}
+
+		if crossed != nil {
+			s.notify(ctx, crossed)
+		}
+	}
+
+	return nil
+}
+
+// notify announces a quota warning to the event bus and to the team's webhooks
+func (s *QuotaService) notify(ctx context.Context, notification *models.QuotaNotification) {
+	quotaLog.Warn("⚠️ Team %s reached %d%% of its %s quota (%d/%d)",
+		notification.TeamID, notification.Threshold, notification.Resource, notification.Used, notification.Limit)
+
+	events.Emit("quota.warning", notification)
+
+	var webhooks []models.Webhook
+	if err := s.db.WithContext(ctx).
+		Where("team_id = ? AND is_active = true AND is_deleted = false AND ? = ANY(events)", notification.TeamID, "quota.warning").
+		Find(&webhooks).Error; err != nil {
+		quotaLog.Error("failed to get quota webhooks", err)
+		return
+	}
+
+	for _, webhook := range webhooks {
+		task := tasks.WebhookDeliveryTask{
+			WebhookID: webhook.ID,
+			Event:     "quota.warning",
+			Payload: map[string]interface{}{
+				"teamId":    notification.TeamID,
+				"resource":  notification.Resource,
+				"period":    notification.Period,
+				"threshold": notification.Threshold,
+				"used":      notification.Used,
+				"limit":     notification.Limit,
+			},
+			AttemptNum: 1,
+		}
+		if err := taskClient.EnqueueWebhookDeliveryTask(ctx, task); err != nil {
+			quotaLog.Error("failed to enqueue quota webhook", err)
+		}
+	}
+}
+
+// SendDailyDigest re-evaluates every team and emails admins of teams above a warning threshold
+func (s *QuotaService) SendDailyDigest(ctx context.Context) error {
+	var teams []models.Team
+	if err := s.db.WithContext(ctx).Where("is_deleted = false").Find(&teams).Error; err != nil {
+		return quotaLog.Error("failed to get teams", err)
+	}
+
+	platformTeam, err := models.GetTeamByName(os.Getenv("SUPERADMIN_TEAM_NAME"), s.db)
+	if err != nil {
+		return quotaLog.Error("failed to get superadmin team", err)
+	}
+
+	smtpConfig, err := models.GetSMTPConfig(platformTeam.ID, "", "", s.db)
+	if err != nil {
+		return quotaLog.Error("failed to get default smtp config", err)
+	}
+
+	for _, team := range teams {
+		// Campaign emails and imports don't go through the event listeners, so catch up here
+		if err := s.CheckThresholds(ctx, team.ID); err != nil {
+			quotaLog.Warn("⚠️ Failed to check quota thresholds for team %s: %v", team.ID, err)
+			continue
+		}
+
+		usages, err := s.GetUsage(ctx, team.ID)
+		if err != nil {
+			quotaLog.Warn("⚠️ Failed to get quota usage for team %s: %v", team.ID, err)
+			continue
+		}
+
+		var warnings []models.QuotaUsage
+		for _, usage := range usages {
+			if usage.Percent >= float64(models.QuotaWarningThresholds[0]) {
+				warnings = append(warnings, usage)
+			}
+		}
+		if len(warnings) == 0 {
+			continue
+		}
+
+		var admins []models.User
+		if err := s.db.WithContext(ctx).
+			Where("team_id = ? AND role IN ? AND is_deleted = false", team.ID, []models.UserRole{models.UserRoleAdmin, models.UserRoleSuperAdmin}).
+			Find(&admins).Error; err != nil {
+			quotaLog.Warn("⚠️ Failed to get admins for team %s: %v", team.ID, err)
+			continue
+		}
+
+		body := buildQuotaDigestBody(team.Name, warnings)
+		for _, admin := range admins {
+			handler := &sendEmailHandlerBody{
+				teamId:       platformTeam.ID,
+				to:           admin.Email,
+				SMTPProvider: smtpConfig.ID,
+				variables:    map[string]string{"name": admin.FirstName},
+				subject:      fmt.Sprintf("Your %s workspace is approaching its plan limits", team.Name),
+				body:         body,
+				testMail:     true,
+			}
+			if err := sendEmail(handler); err != nil {
+				quotaLog.Warn("⚠️ Failed to send quota digest to %s: %v", admin.Email, err)
+			}
+		}
+	}
+
+	quotaLog.Success("✅ Quota digest sent")
+	return nil
+}
+
+func buildQuotaDigestBody(teamName string, usages []models.QuotaUsage) string {
+	var rows strings.Builder
+	for _, usage := range usages {
+		rows.WriteString(fmt.Sprintf("<tr><td>%s</td><td>%d</td><td>%d</td><td>%.1f%%</td></tr>",
+			usage.Resource, usage.Used, usage.Limit, usage.Percent))
+	}
+
+	return fmt.Sprintf(`<html><body>
+<p>Hey {{ name }} 👋🏻,</p>
+<p>Your workspace <strong>%s</strong> is close to its plan limits for this billing period.</p>
+<table border="1" cellpadding="6" cellspacing="0">
+<tr><th>Resource</th><th>Used</th><th>Limit</th><th>Usage</th></tr>
+%s
+</table>
+<p>Upgrade your plan to avoid interruptions once the limits are reached.</p>
+</body></html>`, html.EscapeString(teamName), rows.String())
+}
@@ -0,0 +1,40 @@
+package services
+
+import (
+	"fmt"
+	"html"
+	"kori/internal/db"
+	"kori/internal/events"
+	"kori/internal/models"
+	"kori/internal/utils/logger"
+)
+
+var reputationLog = logger.New("REPUTATION")
+
+func init() {
+	events.On("reputation.alert", func(data interface{}) {
+		alert := data.(models.ReputationAlert)
+
+		provider := "Gmail (Postmaster Tools)"
+		if alert.Provider == models.ReputationProviderMicrosoftSNDS {
+			provider = "Outlook (SNDS)"
+		}
+
+		body := fmt.Sprintf(`<html><body>
+<p>Hey {{ name }} 👋🏻,</p>
+<p>The reputation of <strong>%s</strong> at %s got worse on %s: %s.</p>
+<ul>
+<li>Reputation: %s</li>
+<li>Spam rate: %.2f%%</li>
+<li>Delivery errors: %.2f%%</li>
+</ul>
+<p>Check the deliverability dashboard for the trend, and slow down sending to recipients who don't engage until it recovers.</p>
+</body></html>`, html.EscapeString(alert.Source), provider, alert.Date.Format("2006-01-02"), html.EscapeString(alert.Reason),
+			html.EscapeString(alert.Metric.Reputation), alert.Metric.SpamRate*100, alert.Metric.DeliveryErrorRate*100)
+
+		subject := fmt.Sprintf("Reputation of %s dropped at %s", alert.Source, provider)
+		if err := notifyTeamAdmins(db.DB, alert.TeamID, subject, body); err != nil {
+			reputationLog.Error("Failed to notify admins of reputation drop", err)
+		}
+	})
+}
@@ -96,7 +96,8 @@ func (s *S3Service) UploadFile(ctx context.Context, file []byte, filename string
 	is_r2 := os.Getenv("STORAGE_PROVIDER") == "r2"
 
 	ACL := acl
-	if is_r2 {
+	// Private objects, e.g. exports, stay private on R2 and are only reached through presigned links
+	if is_r2 && acl != types.ObjectCannedACLPrivate {
 		ACL = types.ObjectCannedACLPublicRead
 	}
 
@@ -144,3 +145,18 @@ func (s *S3Service) GetSignedURL(ctx context.Context, path string, duration time
 	s.logger.Success("✅ Generated pre-signed URL successfully")
 	return presignedURL.URL, nil
 }
+
+// DeleteFile removes a file from storage. Deleting a file that doesn't exist succeeds.
+func (s *S3Service) DeleteFile(ctx context.Context, path string) error {
+	s.logger.Info("🗑️ Deleting file: %s", path)
+
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(path),
+	})
+	if err != nil {
+		return s.logger.Error("Failed to delete file from storage ❌", err)
+	}
+
+	return nil
+}
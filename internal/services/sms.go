@@ -0,0 +1,24 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"kori/internal/events"
+	"kori/internal/models"
+	"kori/internal/tasks"
+
+	"github.com/hibiken/asynq"
+)
+
+func init() {
+	// The task checks the email's category for a fallback rule, so every hard bounce is handed over
+	events.On("email.hard_bounced", func(data interface{}) {
+		email := data.(*models.Email)
+		if email.CampaignID != "" || email.AutomationID != "" {
+			return
+		}
+		if err := taskClient.EnqueueSMSFallbackTask(context.Background(), tasks.SMSFallbackTask{EmailID: email.ID}); err != nil && !errors.Is(err, asynq.ErrTaskIDConflict) {
+			log.Error("Failed to enqueue sms fallback task: %v", err)
+		}
+	})
+}
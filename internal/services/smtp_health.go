@@ -0,0 +1,51 @@
+package services
+
+import (
+	"fmt"
+	"html"
+	"kori/internal/db"
+	"kori/internal/events"
+	"kori/internal/utils/logger"
+)
+
+var smtpHealthLog = logger.New("SMTP_HEALTH")
+
+func init() {
+	events.On("smtp_config.unhealthy", func(data interface{}) {
+		payload := data.(map[string]interface{})
+		teamID, _ := payload["teamId"].(string)
+		host, _ := payload["host"].(string)
+		reason, _ := payload["error"].(string)
+		campaignIDs, _ := payload["campaignIds"].([]string)
+
+		paused := ""
+		if len(campaignIDs) > 0 {
+			paused = fmt.Sprintf("<p>%d campaigns sending through it have been <strong>paused</strong>. Resume them once the SMTP config works again.</p>", len(campaignIDs))
+		}
+		body := fmt.Sprintf(`<html><body>
+<p>Hey {{ name }} 👋🏻,</p>
+<p>We couldn't connect to your SMTP server <strong>%s</strong> after %v attempts, so it has been marked unhealthy and no more emails are sent through it.</p>
+<p>The last error was: <code>%s</code></p>
+%s
+</body></html>`, html.EscapeString(host), payload["failures"], html.EscapeString(reason), paused)
+
+		if err := notifyTeamAdmins(db.DB, teamID, fmt.Sprintf("SMTP server %s is failing", host), body); err != nil {
+			smtpHealthLog.Error("Failed to notify admins of unhealthy smtp config", err)
+		}
+	})
+
+	events.On("smtp_config.recovered", func(data interface{}) {
+		payload := data.(map[string]interface{})
+		teamID, _ := payload["teamId"].(string)
+		host, _ := payload["host"].(string)
+
+		body := fmt.Sprintf(`<html><body>
+<p>Hey {{ name }} 👋🏻,</p>
+<p>Your SMTP server <strong>%s</strong> is reachable again and emails are being sent through it. Paused campaigns stay paused until you resume them.</p>
+</body></html>`, html.EscapeString(host))
+
+		if err := notifyTeamAdmins(db.DB, teamID, fmt.Sprintf("SMTP server %s has recovered", host), body); err != nil {
+			smtpHealthLog.Error("Failed to notify admins of recovered smtp config", err)
+		}
+	})
+}
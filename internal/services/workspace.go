@@ -0,0 +1,290 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"kori/internal/db"
+	"kori/internal/events"
+	"kori/internal/handlers"
+	"kori/internal/models"
+	"kori/internal/tasks"
+	"kori/internal/utils/logger"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/hibiken/asynq"
+)
+
+var workspaceLog = logger.New("WORKSPACE")
+
+// A purge that fails is tried again an hour later, up to maxWorkspacePurgeAttempts times
+const (
+	maxWorkspacePurgeAttempts = 5
+	workspacePurgeRetryDelay  = time.Hour
+)
+
+// workspaceExportLinkExpiry is how long the link to the final export works. Presigned links
+// can't last longer than a week.
+const workspaceExportLinkExpiry = 7 * 24 * time.Hour
+
+func init() {
+	events.On("workspace_deletion.scheduled", func(data interface{}) {
+		deletion := data.(*models.WorkspaceDeletion)
+		if err := taskClient.EnqueueWorkspacePurgeTask(context.Background(), tasks.WorkspacePurgeTask{
+			DeletionID: deletion.ID,
+		}, deletion.PurgeAt); err != nil {
+			workspaceLog.Error("Failed to schedule workspace purge", err)
+		}
+	})
+
+	events.On("workspace_deletion.cancelled", func(data interface{}) {
+		deletion := data.(*models.WorkspaceDeletion)
+		if err := resumeAutomationRuns(deletion.TeamID); err != nil {
+			workspaceLog.Warn("Failed to resume automation runs of team %s: %v", deletion.TeamID, err)
+		}
+	})
+
+	events.On("workspace.exports_expired", func(data interface{}) {
+		if err := deleteExpiredWorkspaceExports(context.Background()); err != nil {
+			workspaceLog.Warn("Failed to delete expired workspace exports: %v", err)
+		}
+	})
+
+	events.On("workspace.purge", func(data interface{}) {
+		deletion := data.(*models.WorkspaceDeletion)
+		if err := deleteExpiredWorkspaceExports(context.Background()); err != nil {
+			workspaceLog.Warn("Failed to delete expired workspace exports: %v", err)
+		}
+		if err := purgeWorkspace(context.Background(), deletion); err != nil {
+			workspaceLog.Warn("Failed to purge workspace of team %s: %v", deletion.TeamID, err)
+			retryWorkspacePurge(deletion, err)
+		}
+	})
+}
+
+// resumeAutomationRuns schedules again the runs held while the team's workspace waited to be purged
+func resumeAutomationRuns(teamID string) error {
+	var runs []models.AutomationRun
+	if err := db.DB.Where("team_id = ? AND status IN ? AND is_deleted = false", teamID, []models.AutomationRunStatus{
+		models.AutomationRunStatusActive,
+		models.AutomationRunStatusWaiting,
+	}).Find(&runs).Error; err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, run := range runs {
+		processAt := now
+		if run.NextRunAt != nil && run.NextRunAt.After(now) {
+			processAt = *run.NextRunAt
+		}
+		// Runs whose step is still queued keep it
+		if err := taskClient.EnqueueAutomationStepTask(context.Background(), tasks.AutomationStepTask{
+			RunID: run.ID,
+			Step:  run.Steps,
+		}, processAt); err != nil && !errors.Is(err, asynq.ErrTaskIDConflict) {
+			return err
+		}
+	}
+	return nil
+}
+
+// purgeWorkspace removes everything the team has: its queued tasks first so nothing runs
+// against data being deleted, then a final export for the admins, the stored files, the
+// database rows and the Redis keys
+func purgeWorkspace(ctx context.Context, deletion *models.WorkspaceDeletion) error {
+	teamID := deletion.TeamID
+
+	ids, err := teamTaskIDs(teamID)
+	if err != nil {
+		return fmt.Errorf("failed to collect ids of queued tasks: %w", err)
+	}
+	if _, err := taskClient.CancelTeamTasks(ctx, teamID, ids); err != nil {
+		return fmt.Errorf("failed to delete queued tasks: %w", err)
+	}
+
+	storage := handlers.GetStorageHandler()
+	if storage == nil {
+		return fmt.Errorf("storage handler not configured")
+	}
+
+	// A retried purge already has its export and has already told the admins
+	if deletion.ExportPath == "" {
+		if err := exportWorkspace(ctx, deletion, storage); err != nil {
+			return err
+		}
+	}
+
+	var paths []string
+	if err := db.DB.Model(&models.File{}).Where("team_id = ?", teamID).Pluck("path", &paths).Error; err != nil {
+		return fmt.Errorf("failed to get files: %w", err)
+	}
+	for _, path := range paths {
+		if err := storage.DeleteFile(ctx, path); err != nil {
+			return fmt.Errorf("failed to delete file %s: %w", path, err)
+		}
+	}
+
+	var smtpConfigIDs []string
+	if err := db.DB.Model(&models.SMTPConfig{}).Where("team_id = ?", teamID).Pluck("id", &smtpConfigIDs).Error; err != nil {
+		return fmt.Errorf("failed to get smtp configs: %w", err)
+	}
+
+	if err := models.PurgeTeamData(teamID, db.DB); err != nil {
+		return err
+	}
+
+	if err := taskClient.PurgeTeamKeys(ctx, teamID, smtpConfigIDs); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if err := db.DB.Model(&models.WorkspaceDeletion{}).Where("id = ?", deletion.ID).Updates(map[string]interface{}{
+		"status":    models.WorkspaceDeletionStatusPurged,
+		"purged_at": now,
+		"error":     "",
+	}).Error; err != nil {
+		return fmt.Errorf("failed to mark workspace purged: %w", err)
+	}
+	deletion.Status = models.WorkspaceDeletionStatusPurged
+	deletion.PurgedAt = &now
+
+	workspaceLog.Success("Purged workspace of team %s (%d files)", teamID, len(paths))
+	events.Emit("workspace.purged", deletion)
+	return nil
+}
+
+// teamTaskIDs collects the IDs queued tasks of the team can refer to
+func teamTaskIDs(teamID string) (map[string]bool, error) {
+	queries := []struct {
+		model interface{}
+		where string
+	}{
+		{&models.Campaign{}, "team_id = ?"},
+		{&models.Email{}, "team_id = ? AND status IN ('PENDING', 'FAILED')"},
+		{&models.AutomationRun{}, "team_id = ?"},
+		{&models.LLMEmailWriterJob{}, "team_id = ?"},
+		{&models.Webhook{}, "team_id = ?"},
+		{&models.Domain{}, "team_id = ?"},
+		{&models.ContactImport{}, "team_id = ?"},
+		{&models.ContactSyncSource{}, "team_id = ?"},
+		{&models.SMTPConfig{}, "team_id = ?"},
+		{&models.IMAPConfig{}, "team_id = ?"},
+	}
+
+	ids := map[string]bool{}
+	for _, query := range queries {
+		var found []string
+		if err := db.DB.Model(query.model).Where(query.where, teamID).Pluck("id", &found).Error; err != nil {
+			return nil, err
+		}
+		for _, id := range found {
+			ids[id] = true
+		}
+	}
+	return ids, nil
+}
+
+// exportWorkspace uploads the final export of the team's data and emails the admins a link to it
+func exportWorkspace(ctx context.Context, deletion *models.WorkspaceDeletion, storage handlers.StorageHandler) error {
+	var archive bytes.Buffer
+	if err := models.ExportTeamData(deletion.TeamID, db.DB, &archive); err != nil {
+		return err
+	}
+
+	url, err := storage.UploadFile(ctx, archive.Bytes(), "workspace-export.zip", types.ObjectCannedACLPrivate, "application/zip")
+	if err != nil {
+		return fmt.Errorf("failed to upload export: %w", err)
+	}
+	// The export is private: the url is never handed out, only the presigned link to it
+	deletion.ExportPath = url[strings.LastIndex(url, "/")+1:]
+	expiresAt := time.Now().Add(workspaceExportLinkExpiry)
+	deletion.ExportExpiresAt = &expiresAt
+
+	if err := db.DB.Model(&models.WorkspaceDeletion{}).Where("id = ?", deletion.ID).Updates(map[string]interface{}{
+		"export_path":       deletion.ExportPath,
+		"export_expires_at": expiresAt,
+	}).Error; err != nil {
+		return fmt.Errorf("failed to record export: %w", err)
+	}
+
+	link, err := storage.GetSignedURL(ctx, deletion.ExportPath, workspaceExportLinkExpiry)
+	if err != nil {
+		return fmt.Errorf("failed to sign export link: %w", err)
+	}
+
+	subject := fmt.Sprintf("🗑️ Your workspace %s is being deleted", deletion.TeamName)
+	body := fmt.Sprintf(`<html><body>
+<p>Hey {{ name }} 👋🏻,</p>
+<p>The grace period for deleting the workspace <strong>%s</strong> has ended and all of its data is being removed.</p>
+<p>A final export of your data is available for the next 7 days: <a href="%s">download the export</a>.</p>
+</body></html>`, html.EscapeString(deletion.TeamName), html.EscapeString(link))
+
+	if err := notifyTeamAdmins(db.DB, deletion.TeamID, subject, body); err != nil {
+		// The export is kept either way, so a missed email doesn't hold the purge up
+		workspaceLog.Warn("Failed to email workspace export of team %s: %v", deletion.TeamID, err)
+	}
+	return nil
+}
+
+// deleteExpiredWorkspaceExports deletes the final exports whose links have expired, so they
+// don't outlive the only way to download them
+func deleteExpiredWorkspaceExports(ctx context.Context) error {
+	var deletions []models.WorkspaceDeletion
+	if err := db.DB.Where("export_path <> '' AND export_expires_at < ?", time.Now()).Find(&deletions).Error; err != nil {
+		return err
+	}
+	if len(deletions) == 0 {
+		return nil
+	}
+
+	storage := handlers.GetStorageHandler()
+	if storage == nil {
+		return fmt.Errorf("storage handler not configured")
+	}
+	for _, deletion := range deletions {
+		if err := storage.DeleteFile(ctx, deletion.ExportPath); err != nil {
+			return fmt.Errorf("failed to delete export of team %s: %w", deletion.TeamID, err)
+		}
+		if err := db.DB.Model(&models.WorkspaceDeletion{}).Where("id = ?", deletion.ID).Update("export_path", "").Error; err != nil {
+			return fmt.Errorf("failed to record deleted export: %w", err)
+		}
+		workspaceLog.Info("Deleted expired workspace export of team %s", deletion.TeamID)
+	}
+	return nil
+}
+
+// retryWorkspacePurge schedules a failed purge again, giving up after maxWorkspacePurgeAttempts
+func retryWorkspacePurge(deletion *models.WorkspaceDeletion, purgeErr error) {
+	attempt := deletion.Attempts + 1
+	purgeAt := time.Now().Add(workspacePurgeRetryDelay)
+
+	updates := map[string]interface{}{
+		"status":   models.WorkspaceDeletionStatusScheduled,
+		"attempts": attempt,
+		"purge_at": purgeAt,
+		"error":    purgeErr.Error(),
+	}
+	if attempt >= maxWorkspacePurgeAttempts {
+		updates["status"] = models.WorkspaceDeletionStatusFailed
+	}
+	if err := db.DB.Model(&models.WorkspaceDeletion{}).Where("id = ?", deletion.ID).Updates(updates).Error; err != nil {
+		workspaceLog.Error("Failed to record failed workspace purge", err)
+		return
+	}
+	if attempt >= maxWorkspacePurgeAttempts {
+		workspaceLog.Warn("Giving up purging workspace of team %s after %d attempts", deletion.TeamID, attempt)
+		return
+	}
+
+	if err := taskClient.EnqueueWorkspacePurgeTask(context.Background(), tasks.WorkspacePurgeTask{
+		DeletionID: deletion.ID,
+		Attempt:    attempt,
+	}, purgeAt); err != nil {
+		workspaceLog.Error("Failed to reschedule workspace purge", err)
+	}
+}
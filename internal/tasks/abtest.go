@@ -0,0 +1,207 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"kori/internal/events"
+	"kori/internal/models"
+	"kori/internal/utils"
+	"math/rand"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"gorm.io/gorm"
+)
+
+// campaignContent is what campaign emails are built from: the campaign's template or a variant's overrides
+type campaignContent struct {
+	variantID  string
+	language   string
+	templateID string
+	categoryID string
+	subject    string
+	html       string
+	plainText  string
+	preheader  string
+	fromName   string
+}
+
+// campaignContentKey is the A/B variant and language variant a contact is sent, nil for the campaign's
+type campaignContentKey struct {
+	variant  *models.CampaignVariant
+	language *models.CampaignLanguage
+}
+
+// loadCampaignContent fetches the html for the campaign, or for a variant falling back to the
+// campaign. A language variant's template and subject are translations, so they replace the
+// A/B variant's while the contact still counts towards the A/B variant.
+func loadCampaignContent(campaign *models.Campaign, variant *models.CampaignVariant, language *models.CampaignLanguage) (*campaignContent, error) {
+	template := campaign.Template
+	content := &campaignContent{}
+	if variant != nil {
+		if variant.Template != nil {
+			template = variant.Template
+		}
+		content.variantID = variant.ID
+		content.fromName = variant.FromName
+	}
+	if language != nil {
+		if language.Template != nil {
+			template = language.Template
+		}
+		content.language = language.Language
+		if language.FromName != "" {
+			content.fromName = language.FromName
+		}
+	}
+	if template == nil || template.HtmlFile == nil {
+		return nil, fmt.Errorf("template has no html file")
+	}
+
+	html, err := utils.GetHTMLFromURL(template.HtmlFile.SignedURL)
+	if err != nil {
+		return nil, err
+	}
+
+	content.html = html
+	content.plainText = template.PlainText
+	content.preheader = template.Preheader
+	content.templateID = template.ID
+	content.categoryID = template.CategoryID
+	content.subject = template.Subject
+	if variant != nil && variant.Subject != "" {
+		content.subject = variant.Subject
+	}
+	if language != nil {
+		content.subject = template.Subject
+		if language.Subject != "" {
+			content.subject = language.Subject
+		}
+	}
+	return content, nil
+}
+
+// assignVariants picks the variant each contact receives. While the test hasn't started each
+// variant gets its percentage of the audience, chosen at random, and the rest is held back for
+// the winner. Once the winner is known every remaining contact gets it. It reports whether this
+// run starts the test.
+func assignVariants(campaign *models.Campaign, variants []models.CampaignVariant, contacts []models.Contact) ([]models.Contact, []*models.CampaignVariant, bool) {
+	if len(variants) == 0 {
+		return contacts, nil, false
+	}
+
+	if campaign.ABTestStatus == models.ABTestStatusWinnerSelected {
+		for i := range variants {
+			if variants[i].ID == campaign.ABWinnerVariantID {
+				assigned := make([]*models.CampaignVariant, len(contacts))
+				for j := range assigned {
+					assigned[j] = &variants[i]
+				}
+				return contacts, assigned, false
+			}
+		}
+		return contacts, nil, false
+	}
+
+	rand.Shuffle(len(contacts), func(i, j int) { contacts[i], contacts[j] = contacts[j], contacts[i] })
+
+	total := len(contacts)
+	var assigned []*models.CampaignVariant
+	for i := range variants {
+		count := total * variants[i].Percentage / 100
+		if count == 0 {
+			// Small audiences still get every variant
+			count = 1
+		}
+		for j := 0; j < count && len(assigned) < total; j++ {
+			assigned = append(assigned, &variants[i])
+		}
+	}
+
+	return contacts[:len(assigned)], assigned, true
+}
+
+// startABTest records that the test portion was sent and schedules picking the winner
+func (h *TaskHandler) startABTest(ctx context.Context, campaign *models.Campaign, sent int) error {
+	campaign.Processed += sent
+	campaign.ABTestStatus = models.ABTestStatusTesting
+	campaign.ABTestStartedAt = time.Now()
+	if err := h.db.Save(campaign).Error; err != nil {
+		return h.logger.Error("❌ failed to start A/B test: %w", err)
+	}
+
+	if err := h.taskClient.EnqueueABWinnerTask(ctx, ABWinnerTask{CampaignID: campaign.ID}, campaign.ABTestDeadline()); err != nil {
+		return h.logger.Error("❌ failed to schedule A/B winner: %w", err)
+	}
+
+	h.logger.Success("🧪 Sent A/B test for campaign %s to %d contacts, picking a winner at %s",
+		campaign.ID, sent, campaign.ABTestDeadline().Format(time.RFC3339))
+	return nil
+}
+
+// HandleABWinner picks the winning variant of a campaign's A/B test and sends it to the rest of the audience
+func (h *TaskHandler) HandleABWinner(ctx context.Context, t *asynq.Task) error {
+	var task ABWinnerTask
+	if err := decodeTask(t, &task); err != nil {
+		return fmt.Errorf("failed to unmarshal A/B winner task: %w", asynq.SkipRetry)
+	}
+
+	campaign, err := models.GetCampaignByID(task.CampaignID, h.db)
+	if err != nil {
+		return h.logger.Error("❌ failed to get campaign: %w", err)
+	}
+
+	if campaign.Status == models.CampaignStatusCancelled {
+		h.logger.Info("🛑 Campaign %s was cancelled before its A/B test finished", campaign.ID)
+		return nil
+	}
+
+	if campaign.ABTestStatus != models.ABTestStatusTesting {
+		h.logger.Info("✅ Campaign %s has no A/B test waiting for a winner", campaign.ID)
+		return nil
+	}
+
+	stats, err := models.GetVariantStats(campaign.ID, h.db)
+	if err != nil {
+		return h.logger.Error("❌ failed to get variant stats: %w", err)
+	}
+
+	winner := models.PickWinner(stats, campaign.ABWinnerMetric)
+
+	if err := h.db.Transaction(func(tx *gorm.DB) error {
+		updates := map[string]interface{}{"ab_test_status": models.ABTestStatusWinnerSelected}
+		if winner != nil {
+			if err := tx.Model(&models.CampaignVariant{}).Where("id = ?", winner.VariantID).Update("is_winner", true).Error; err != nil {
+				return err
+			}
+			updates["ab_winner_variant_id"] = winner.VariantID
+		}
+		return tx.Model(&models.Campaign{}).Where("id = ?", campaign.ID).Updates(updates).Error
+	}); err != nil {
+		return h.logger.Error("❌ failed to save A/B winner: %w", err)
+	}
+
+	if winner != nil {
+		winner.IsWinner = true
+		h.logger.Success("🏆 Variant %s won the A/B test for campaign %s (open rate %.2f%%, click rate %.2f%%)",
+			winner.Name, campaign.ID, winner.OpenRate, winner.ClickRate)
+	}
+	events.Emit("campaign.ab_winner", map[string]interface{}{
+		"campaignId": campaign.ID,
+		"teamId":     campaign.TeamID,
+		"metric":     campaign.ABWinnerMetric,
+		"winner":     winner,
+		"variants":   stats,
+	})
+
+	// Send the winner to everyone who wasn't in the test
+	if err := h.taskClient.EnqueueCampaignTask(ctx, CampaignTask{
+		CampaignID: campaign.ID,
+		BatchSize:  campaign.BatchSize,
+		Remainder:  true,
+	}, 0); err != nil {
+		return h.logger.Error("❌ failed to enqueue A/B remainder: %w", err)
+	}
+
+	return nil
+}
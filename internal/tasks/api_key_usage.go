@@ -0,0 +1,45 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"kori/internal/events"
+	"kori/internal/models"
+	"time"
+
+	"github.com/hibiken/asynq"
+)
+
+// HandleAPIKeyUsage rolls API key usage up to the current hour and raises an alert for each key
+// used far more than usual in the hour just rolled up. A spike is alerted once however many
+// times the hour is checked.
+func (h *TaskHandler) HandleAPIKeyUsage(ctx context.Context, t *asynq.Task) error {
+	through, err := models.MaterializeAPIKeyUsageRollup(time.Now(), h.db.WithContext(ctx))
+	if err != nil {
+		return h.logger.Error("❌ failed to materialize api key usage rollup: %w", err)
+	}
+
+	hour := through.Add(-time.Hour)
+	anomalies, err := models.DetectAPIKeyUsageAnomalies(hour, h.db.WithContext(ctx))
+	if err != nil {
+		return h.logger.Error("❌ failed to detect api key usage anomalies: %w", err)
+	}
+
+	for _, anomaly := range anomalies {
+		h.logger.Warn("🔑 API key %s made %d requests in the hour from %s, usually %.0f±%.0f",
+			anomaly.APIKeyID, anomaly.Requests, hour.Format(time.RFC3339), anomaly.Mean, anomaly.StdDev)
+
+		key := fmt.Sprintf("api_key_usage:alerted:%s:%d", anomaly.APIKeyID, hour.Unix())
+		first, err := h.taskClient.markOnce(ctx, key, 2*time.Hour)
+		if err != nil {
+			h.logger.Warn("⚠️ Failed to check if the usage spike of api key %s was alerted: %v", anomaly.APIKeyID, err)
+		}
+		if err == nil && !first {
+			continue
+		}
+		events.Emit("api_key.usage_anomaly", anomaly)
+	}
+
+	h.logger.Info("🔑 Rolled up api key usage through %s, %d spikes", through.Format(time.RFC3339), len(anomalies))
+	return nil
+}
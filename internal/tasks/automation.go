@@ -0,0 +1,496 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"kori/internal/events"
+	"kori/internal/models"
+	"kori/internal/utils"
+	"kori/internal/utils/base64"
+	"maps"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hibiken/asynq"
+	"gorm.io/gorm"
+)
+
+// nodeOutcome is what executing a node decided
+type nodeOutcome struct {
+	next   *models.AutomationNode
+	result string
+	wait   time.Duration
+	exit   bool
+}
+
+// HandleAutomationStep walks a contact's automation run from its current node until it reaches
+// a WAIT node, which schedules the next step, or the end of the graph
+func (h *TaskHandler) HandleAutomationStep(ctx context.Context, t *asynq.Task) error {
+	var task AutomationStepTask
+	if err := decodeTask(t, &task); err != nil {
+		return fmt.Errorf("failed to unmarshal automation step task: %w", asynq.SkipRetry)
+	}
+
+	run := &models.AutomationRun{}
+	if err := h.db.Where("id = ? AND is_deleted = false", task.RunID).First(run).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return h.logger.Error("❌ failed to get automation run: %w", err)
+	}
+
+	// A step already taken, or a run that was stopped meanwhile
+	if run.Steps != task.Step || (run.Status != models.AutomationRunStatusActive && run.Status != models.AutomationRunStatusWaiting) {
+		h.logger.Info("⏭️ Skipping stale step %d of automation run %s", task.Step, run.ID)
+		return nil
+	}
+
+	// Workspaces waiting to be purged don't run; their runs are scheduled again if the team is restored
+	if models.IsTeamDeleted(run.TeamID, h.db) {
+		h.logger.Info("⏭️ Holding automation run %s of deleted team %s", run.ID, run.TeamID)
+		return nil
+	}
+
+	// Contacts away, as their auto-reply said, get the rest of the run once they're back
+	if run.PausedUntil != nil && run.PausedUntil.After(time.Now()) {
+		return h.pauseRun(ctx, run, *run.PausedUntil)
+	}
+
+	automation, err := models.GetAutomationWithGraph(run.AutomationID, h.db)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return h.logger.Error("❌ failed to get automation: %w", err)
+	}
+	if automation == nil || !automation.IsActive {
+		return h.finishRun(run, models.AutomationRunStatusExited, "automation is no longer active")
+	}
+
+	graph, err := models.NewAutomationGraph(automation)
+	if err != nil {
+		return h.finishRun(run, models.AutomationRunStatusFailed, err.Error())
+	}
+
+	contact := &models.Contact{}
+	if err := h.db.Where("id = ? AND is_deleted = false", run.ContactID).First(contact).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return h.finishRun(run, models.AutomationRunStatusExited, "contact was deleted")
+		}
+		return h.logger.Error("❌ failed to get contact: %w", err)
+	}
+
+	node := graph.Node(run.CurrentNodeID)
+	for node != nil {
+		if run.Steps >= models.MaxAutomationSteps {
+			return h.finishRun(run, models.AutomationRunStatusFailed, fmt.Sprintf("run exceeded %d steps", models.MaxAutomationSteps))
+		}
+
+		// Contacts can opt out while the run is walking, so nothing more is sent once they have
+		if node.Type == models.NodeTypeEmail {
+			optedOut, err := models.HasOptedOutOfAutomation(run.ID, h.db)
+			if err != nil {
+				return h.logger.Error("❌ failed to check automation opt-out: %w", err)
+			}
+			if optedOut {
+				h.logger.Info("⏭️ Contact of automation run %s opted out", run.ID)
+				return nil
+			}
+		}
+
+		outcome, nodeErr := h.executeNode(ctx, automation, graph, node, contact)
+
+		step := &models.AutomationRunStep{RunID: run.ID, NodeID: node.ID, NodeType: node.Type}
+		if nodeErr != nil {
+			step.Error = nodeErr.Error()
+		} else {
+			step.Result = outcome.result
+		}
+		if err := h.db.Create(step).Error; err != nil {
+			return h.logger.Error("❌ failed to record automation step: %w", err)
+		}
+		run.Steps++
+
+		if nodeErr != nil {
+			h.logger.Warn("⚠️ %s node %s failed for automation run %s: %v", node.Type, node.ID, run.ID, nodeErr)
+			run.CurrentNodeID = node.ID
+			return h.finishRun(run, models.AutomationRunStatusFailed, nodeErr.Error())
+		}
+		if outcome.exit || outcome.next == nil {
+			run.CurrentNodeID = node.ID
+			return h.finishRun(run, models.AutomationRunStatusCompleted, "")
+		}
+
+		run.CurrentNodeID = outcome.next.ID
+		if outcome.wait > 0 {
+			return h.waitRun(ctx, run, time.Now().Add(outcome.wait))
+		}
+		node = outcome.next
+	}
+
+	return h.finishRun(run, models.AutomationRunStatusCompleted, "")
+}
+
+// executeNode runs a single node for the contact
+func (h *TaskHandler) executeNode(ctx context.Context, automation *models.Automation, graph *models.AutomationGraph, node *models.AutomationNode, contact *models.Contact) (*nodeOutcome, error) {
+	switch node.Type {
+	case models.NodeTypeStart:
+		return &nodeOutcome{next: graph.Next(node.ID, "")}, nil
+
+	case models.NodeTypeExit:
+		return &nodeOutcome{exit: true}, nil
+
+	case models.NodeTypeWait:
+		var data models.WaitNodeData
+		if err := node.ParseData(&data); err != nil {
+			return nil, err
+		}
+		wait := data.Duration()
+		if wait <= 0 {
+			return nil, errors.New("wait node needs a positive duration")
+		}
+		return &nodeOutcome{next: graph.Next(node.ID, ""), wait: wait, result: wait.String()}, nil
+
+	case models.NodeTypeCondition:
+		var data models.ConditionNodeData
+		if err := node.ParseData(&data); err != nil {
+			return nil, err
+		}
+		matches, err := data.ContactMatches(contact, h.db.WithContext(ctx))
+		if err != nil {
+			return nil, err
+		}
+		label := "no"
+		if matches {
+			label = "yes"
+		}
+		return &nodeOutcome{next: graph.Next(node.ID, label), result: label}, nil
+
+	case models.NodeTypeEmail:
+		var data models.EmailNodeData
+		if err := node.ParseData(&data); err != nil {
+			return nil, err
+		}
+		result, retryAt, err := h.sendAutomationEmail(automation, &data, contact)
+		if err != nil {
+			return nil, err
+		}
+		// A deferred email is tried again from the same node once the frequency cap lets it through
+		if !retryAt.IsZero() {
+			return &nodeOutcome{next: node, wait: max(time.Until(retryAt), time.Minute), result: result}, nil
+		}
+		return &nodeOutcome{next: graph.Next(node.ID, ""), result: result}, nil
+
+	case models.NodeTypeAddToList:
+		var data models.ListNodeData
+		if err := node.ParseData(&data); err != nil {
+			return nil, err
+		}
+		result, err := h.addContactToList(contact, data.ListID)
+		if err != nil {
+			return nil, err
+		}
+		return &nodeOutcome{next: graph.Next(node.ID, ""), result: result}, nil
+
+	case models.NodeTypeTag:
+		var data models.TagNodeData
+		if err := node.ParseData(&data); err != nil {
+			return nil, err
+		}
+		result, err := h.tagContact(contact, &data)
+		if err != nil {
+			return nil, err
+		}
+		return &nodeOutcome{next: graph.Next(node.ID, ""), result: result}, nil
+
+	case models.NodeTypeUnsubscribe:
+		if err := h.db.Model(&models.Contact{}).Where("id = ?", contact.ID).Update("status", models.SubscriberStatusUnsubscribed).Error; err != nil {
+			return nil, err
+		}
+		contact.Status = models.SubscriberStatusUnsubscribed
+		return &nodeOutcome{next: graph.Next(node.ID, ""), result: string(models.SubscriberStatusUnsubscribed)}, nil
+	}
+
+	return nil, fmt.Errorf("%s nodes are not supported", node.Type)
+}
+
+// automationQuotaRetry is how long an automation email waits for the team's quota, so an
+// upgrade is picked up without waiting for the next month
+const automationQuotaRetry = time.Hour
+
+// sendAutomationEmail queues the node's email for the contact. Contacts that are no longer
+// subscribed, opted out of the email's category or are over a skipping frequency cap are
+// passed over without failing the run; those over a deferring cap,
+// or of a team out of send credits, get the time to try again at.
+func (h *TaskHandler) sendAutomationEmail(automation *models.Automation, data *models.EmailNodeData, contact *models.Contact) (string, time.Time, error) {
+	if contact.Status != models.SubscriberStatusActive {
+		return fmt.Sprintf("skipped, contact is %s", contact.Status), time.Time{}, nil
+	}
+	if data.TemplateID == "" {
+		return "", time.Time{}, errors.New("email node needs a templateId")
+	}
+
+	template := &models.Template{}
+	if err := h.db.Where("id = ? AND team_id = ? AND is_deleted = false", data.TemplateID, automation.TeamID).
+		Preload("HtmlFile").First(template).Error; err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to get template: %w", err)
+	}
+	if template.HtmlFile == nil {
+		return "", time.Time{}, errors.New("template has no html file")
+	}
+
+	optedOut, err := h.optedOutOfCategory(automation.TeamID, template.CategoryID, contact)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to check category preferences: %w", err)
+	}
+	if optedOut {
+		return "skipped, contact " + preferenceSkipReason, time.Time{}, nil
+	}
+
+	capped, err := h.checkAutomationFrequencyCaps(automation.TeamID, template.CategoryID, contact)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to check frequency caps: %w", err)
+	}
+	if capped != nil && capped.Deferred() {
+		return "deferred, " + capped.Reason, capped.RetryAt, nil
+	}
+
+	smtpConfig, err := models.GetSMTPConfig(automation.TeamID, data.SMTPConfigID, "", h.db)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to get smtp config: %w", err)
+	}
+	if smtpConfig == nil {
+		return "", time.Time{}, errors.New("smtp config is nil")
+	}
+
+	html, err := utils.GetHTMLFromURL(template.HtmlFile.SignedURL)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to get html from template: %w", err)
+	}
+	rendered, err := models.RenderSnippets(automation.TeamID, []string{html}, h.db)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	html = rendered[0]
+
+	subject := template.Subject
+	if data.Subject != "" {
+		subject = data.Subject
+	}
+
+	computed, err := models.ComputeContactFields(automation.TeamID, []string{contact.ID}, h.db)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to compute contact fields: %w", err)
+	}
+	variables := contact.TemplateVariables()
+	maps.Copy(variables, computed[contact.ID])
+	emailID := uuid.New().String()
+	optOutURL, err := utils.SequenceOptOutURL(emailID, cfg)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to build opt-out url: %w", err)
+	}
+	variables["sequence_opt_out_url"] = optOutURL
+	preferencesURL, err := utils.PreferencesURL(emailID, cfg)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to build preferences url: %w", err)
+	}
+	variables["preferences_url"] = preferencesURL
+
+	withPreheader, variables := utils.WithPreheader(html, template.Preheader, variables)
+	parsedText := utils.PlainTextBody(template.PlainText, html, variables)
+	parsedBody := utils.ReplaceVariablesWithLinks(withPreheader, variables, emailID, cfg, models.NewLinkRegistry(automation.TeamID, "", h.db))
+	parsedSubject, err := base64.DecodeFromBase64(utils.ReplaceVariables(subject, variables, automation.ID, cfg, false))
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to decode subject: %w", err)
+	}
+
+	jsonData, err := utils.MapToJSON(variables)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to convert variables to json: %w", err)
+	}
+
+	email := &models.Email{
+		From:         smtpConfig.FromEmail,
+		FromName:     data.FromName,
+		To:           contact.Email,
+		Subject:      parsedSubject,
+		Body:         parsedBody,
+		PlainText:    parsedText,
+		Data:         jsonData,
+		Status:       models.EmailStatusPending,
+		TeamID:       automation.TeamID,
+		TemplateID:   template.ID,
+		ContactID:    contact.ID,
+		SMTPConfigID: smtpConfig.ID,
+		CategoryID:   template.CategoryID,
+		AutomationID: automation.ID,
+	}
+	email.ID = emailID
+	if capped != nil {
+		// Recorded rather than sent, so reports show who the cap kept the email from
+		email.Status = models.EmailStatusSkipped
+		email.SkipReason = capped.Reason
+	}
+
+	personas, err := models.GetSenderPersonas(automation.TeamID, data.SenderPersonaIDs, h.db)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to get sender personas: %w", err)
+	}
+	if persona := models.PickSenderPersona(personas, contact.Email); persona != nil {
+		persona.ApplyTo(email)
+	}
+
+	// Sent emails come out of the team's monthly quota; once it's used up the step waits for it
+	if capped == nil {
+		if err := models.ConsumeQuota(automation.TeamID, models.QuotaResourceEmails, 1, h.db); err != nil {
+			var exceeded *models.QuotaExceededError
+			if errors.As(err, &exceeded) {
+				return "deferred, " + exceeded.Error(), time.Now().Add(automationQuotaRetry), nil
+			}
+			return "", time.Time{}, fmt.Errorf("failed to check sending quota: %w", err)
+		}
+	}
+
+	// Creating the email queues it for sending
+	if err := h.db.Create(email).Error; err != nil {
+		if capped == nil {
+			models.RefundQuota(automation.TeamID, models.QuotaResourceEmails, 1, h.db)
+		}
+		return "", time.Time{}, fmt.Errorf("failed to create email: %w", err)
+	}
+	if capped != nil {
+		return "skipped, " + capped.Reason, time.Time{}, nil
+	}
+	return email.ID, time.Time{}, nil
+}
+
+// addContactToList copies the contact into another of the team's lists, reusing the copy
+// when the address is already there
+func (h *TaskHandler) addContactToList(contact *models.Contact, listID string) (string, error) {
+	if listID == "" {
+		return "", errors.New("add to list node needs a listId")
+	}
+
+	list := &models.MailingList{}
+	if err := h.db.Where("id = ? AND team_id = ? AND is_deleted = false", listID, contact.TeamID).First(list).Error; err != nil {
+		return "", fmt.Errorf("failed to get list: %w", err)
+	}
+
+	existing := &models.Contact{}
+	err := h.db.Where("email = ? AND team_id = ? AND list_id = ? AND is_deleted = false", contact.Email, contact.TeamID, list.ID).First(existing).Error
+	if err == nil {
+		return existing.ID, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", err
+	}
+
+	copied := &models.Contact{
+		Email:     contact.Email,
+		FirstName: contact.FirstName,
+		LastName:  contact.LastName,
+		Metadata:  contact.Metadata,
+		LinkedIn:  contact.LinkedIn,
+		Twitter:   contact.Twitter,
+		Facebook:  contact.Facebook,
+		Instagram: contact.Instagram,
+		Country:   contact.Country,
+		Phone:     contact.Phone,
+		City:      contact.City,
+		State:     contact.State,
+		Zip:       contact.Zip,
+		Address:   contact.Address,
+		Company:   contact.Company,
+		ListID:    list.ID,
+		TeamID:    contact.TeamID,
+		Status:    contact.Status,
+	}
+	if err := h.db.Create(copied).Error; err != nil {
+		return "", fmt.Errorf("failed to create contact: %w", err)
+	}
+
+	// Lets automations triggered by the list pick the contact up
+	events.Emit("contacts.created", copied)
+	return copied.ID, nil
+}
+
+// tagContact adds or removes a tag on the contact
+func (h *TaskHandler) tagContact(contact *models.Contact, data *models.TagNodeData) (string, error) {
+	if data.Tag == "" {
+		return "", errors.New("tag node needs a tag")
+	}
+
+	tag := &models.Tag{}
+	if err := h.db.Where("name = ? AND is_deleted = false", data.Tag).FirstOrCreate(tag, models.Tag{Name: data.Tag}).Error; err != nil {
+		return "", fmt.Errorf("failed to get tag: %w", err)
+	}
+
+	association := h.db.Model(contact).Association("Tags")
+	if data.Remove {
+		if err := association.Delete(tag); err != nil {
+			return "", err
+		}
+		return "removed " + tag.Name, nil
+	}
+	if err := association.Append(tag); err != nil {
+		return "", err
+	}
+	return "added " + tag.Name, nil
+}
+
+// waitRun parks the run until processAt. The delayed step is enqueued before the run is saved
+// so a failed save retries into the same task ID rather than losing the wake up.
+func (h *TaskHandler) waitRun(ctx context.Context, run *models.AutomationRun, processAt time.Time) error {
+	if err := h.taskClient.EnqueueAutomationStepTask(ctx, AutomationStepTask{RunID: run.ID, Step: run.Steps}, processAt); err != nil && !errors.Is(err, asynq.ErrTaskIDConflict) {
+		return h.logger.Error("❌ failed to schedule automation step: %w", err)
+	}
+
+	if err := h.db.Model(&models.AutomationRun{}).Where("id = ? AND status <> ?", run.ID, models.AutomationRunStatusOptedOut).Updates(map[string]interface{}{
+		"status":          models.AutomationRunStatusWaiting,
+		"current_node_id": run.CurrentNodeID,
+		"steps":           run.Steps,
+		"next_run_at":     processAt,
+	}).Error; err != nil {
+		return h.logger.Error("❌ failed to update automation run: %w", err)
+	}
+
+	h.logger.Info("⏳ Automation run %s waits until %s", run.ID, processAt.Format(time.RFC3339))
+	return nil
+}
+
+// pauseRun puts the run's next step off until its pause is over. The step is scheduled under a
+// task ID of its own, as the task being handled still holds the step's.
+func (h *TaskHandler) pauseRun(ctx context.Context, run *models.AutomationRun, until time.Time) error {
+	task := AutomationStepTask{RunID: run.ID, Step: run.Steps, ResumeAt: until.Unix()}
+	if err := h.taskClient.EnqueueAutomationStepTask(ctx, task, until); err != nil && !errors.Is(err, asynq.ErrTaskIDConflict) {
+		return h.logger.Error("❌ failed to schedule paused automation step: %w", err)
+	}
+
+	if err := h.db.Model(&models.AutomationRun{}).Where("id = ? AND status IN ?", run.ID, []models.AutomationRunStatus{
+		models.AutomationRunStatusActive,
+		models.AutomationRunStatusWaiting,
+	}).Updates(map[string]interface{}{
+		"status":      models.AutomationRunStatusWaiting,
+		"next_run_at": until,
+	}).Error; err != nil {
+		return h.logger.Error("❌ failed to update automation run: %w", err)
+	}
+
+	h.logger.Info("⏸️ Automation run %s is paused until %s", run.ID, until.Format(time.RFC3339))
+	return nil
+}
+
+// finishRun ends the run with status, unless the contact opted out meanwhile
+func (h *TaskHandler) finishRun(run *models.AutomationRun, status models.AutomationRunStatus, reason string) error {
+	if err := h.db.Model(&models.AutomationRun{}).Where("id = ? AND status <> ?", run.ID, models.AutomationRunStatusOptedOut).Updates(map[string]interface{}{
+		"status":          status,
+		"current_node_id": run.CurrentNodeID,
+		"steps":           run.Steps,
+		"next_run_at":     nil,
+		"completed_at":    time.Now(),
+		"error":           reason,
+	}).Error; err != nil {
+		return h.logger.Error("❌ failed to update automation run: %w", err)
+	}
+
+	h.logger.Info("🏁 Automation run %s finished as %s", run.ID, status)
+	return nil
+}
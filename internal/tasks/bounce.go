@@ -0,0 +1,246 @@
+package tasks
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"kori/internal/events"
+	"kori/internal/models"
+	"kori/internal/utils"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+	"github.com/google/uuid"
+	"github.com/hibiken/asynq"
+)
+
+const (
+	// maxBouncesPerPoll caps how many messages are read from a mailbox per run
+	maxBouncesPerPoll = 200
+	// softBounceLimit is how many soft bounces within softBounceWindow mark a contact as bounced
+	softBounceLimit  = 3
+	softBounceWindow = 30 * 24 * time.Hour
+)
+
+// HandleBouncePoll reads new messages from every bounce mailbox and applies the bounces and complaints found
+func (h *TaskHandler) HandleBouncePoll(ctx context.Context, t *asynq.Task) error {
+	var configs []models.IMAPConfig
+	if err := h.db.Where("bounce_processing = true AND is_active = true AND is_deleted = false").Find(&configs).Error; err != nil {
+		return h.logger.Error("❌ failed to get bounce mailboxes: %w", err)
+	}
+
+	for i := range configs {
+		processed, err := h.pollBounceMailbox(ctx, &configs[i])
+		if err != nil {
+			h.logger.Error("❌ failed to poll bounce mailbox: %w", err)
+			continue
+		}
+		if processed > 0 {
+			h.logger.Info("📭 Processed %d bounce messages for mailbox %s", processed, configs[i].Username)
+		}
+	}
+
+	return nil
+}
+
+// dialIMAP connects and signs in to a mailbox, with its password or an OAuth2 access token
+func dialIMAP(config *models.IMAPConfig) (*client.Client, error) {
+	im, err := client.DialTLS(fmt.Sprintf("%s:%d", config.Host, config.Port), &tls.Config{
+		InsecureSkipVerify: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", config.Host, err)
+	}
+
+	auth, err := utils.IMAPAuthClient(config)
+	if err != nil {
+		im.Logout()
+		return nil, fmt.Errorf("failed to get oauth token for %s: %w", config.Username, err)
+	}
+	if err := im.Authenticate(auth); err != nil {
+		im.Logout()
+		return nil, fmt.Errorf("failed to authenticate %s: %w", config.Username, err)
+	}
+	return im, nil
+}
+
+// pollBounceMailbox fetches messages newer than the last seen UID and processes them
+func (h *TaskHandler) pollBounceMailbox(ctx context.Context, config *models.IMAPConfig) (int, error) {
+	im, err := dialIMAP(config)
+	if err != nil {
+		return 0, err
+	}
+	defer im.Logout()
+
+	folder := config.BounceFolder
+	if folder == "" {
+		folder = "INBOX"
+	}
+	mailbox, err := im.Select(folder, false)
+	if err != nil {
+		return 0, fmt.Errorf("failed to select %s: %w", folder, err)
+	}
+
+	// A new UIDVALIDITY means the mailbox was recreated and old UIDs are meaningless
+	lastUID := config.BounceLastUID
+	if mailbox.UidValidity != config.BounceUIDValidity {
+		lastUID = 0
+	}
+
+	criteria := imap.NewSearchCriteria()
+	criteria.Uid = new(imap.SeqSet)
+	criteria.Uid.AddRange(lastUID+1, 0)
+	uids, err := im.UidSearch(criteria)
+	if err != nil {
+		return 0, fmt.Errorf("failed to search %s: %w", folder, err)
+	}
+
+	// "n:*" always matches the newest message, even when it is older than n
+	newUIDs := uids[:0]
+	for _, uid := range uids {
+		if uid > lastUID {
+			newUIDs = append(newUIDs, uid)
+		}
+	}
+	sort.Slice(newUIDs, func(i, j int) bool { return newUIDs[i] < newUIDs[j] })
+	if len(newUIDs) > maxBouncesPerPoll {
+		newUIDs = newUIDs[:maxBouncesPerPoll]
+	}
+
+	processed := 0
+	if len(newUIDs) > 0 {
+		seqset := new(imap.SeqSet)
+		seqset.AddNum(newUIDs...)
+
+		section := &imap.BodySectionName{}
+		messages := make(chan *imap.Message, 10)
+		done := make(chan error, 1)
+		go func() {
+			done <- im.UidFetch(seqset, []imap.FetchItem{imap.FetchUid, section.FetchItem()}, messages)
+		}()
+
+		for msg := range messages {
+			body := msg.GetBody(section)
+			if body != nil {
+				raw, err := io.ReadAll(body)
+				if err == nil {
+					h.processBounceMessage(config, raw)
+				}
+			}
+			if msg.Uid > lastUID {
+				lastUID = msg.Uid
+			}
+			processed++
+		}
+		if err := <-done; err != nil {
+			return processed, fmt.Errorf("failed to fetch messages: %w", err)
+		}
+	}
+
+	if err := h.db.Model(&models.IMAPConfig{}).Where("id = ?", config.ID).Updates(map[string]interface{}{
+		"bounce_uid_validity":   mailbox.UidValidity,
+		"bounce_last_uid":       lastUID,
+		"bounce_last_polled_at": time.Now(),
+	}).Error; err != nil {
+		return processed, fmt.Errorf("failed to save mailbox position: %w", err)
+	}
+
+	return processed, nil
+}
+
+// processBounceMessage parses a single message and applies it to the matching email and contacts
+func (h *TaskHandler) processBounceMessage(config *models.IMAPConfig, raw []byte) {
+	report, err := utils.ParseBounce(raw)
+	if err != nil || report == nil {
+		return
+	}
+
+	email := h.findBouncedEmail(config.TeamID, report)
+	recipient := strings.ToLower(strings.TrimSpace(report.Recipient))
+	if recipient == "" && email != nil {
+		recipient = strings.ToLower(email.To)
+	}
+	if recipient == "" {
+		return
+	}
+
+	h.logger.Info("📭 %s bounce for %s (status %s)", report.Type, recipient, report.Status)
+
+	if email != nil {
+		event := models.EmailTrackingEventBounce
+		if report.Type == utils.BounceTypeComplaint {
+			event = models.EmailTrackingEventComplaint
+		}
+		metadata, _ := json.Marshal(report)
+		tracking := &models.EmailTracking{
+			EmailID:    email.ID,
+			CampaignID: email.CampaignID,
+			ContactID:  email.ContactID,
+			Event:      event,
+			Timestamp:  time.Now(),
+			Metadata:   metadata,
+		}
+		// A CC or BCC address bouncing says nothing about the To contact
+		copied := email.IsCopyRecipient(recipient)
+		if copied {
+			tracking.Recipient = recipient
+			tracking.ContactID = ""
+		}
+		if err := h.db.Create(tracking).Error; err != nil {
+			h.logger.Error("❌ failed to create bounce tracking entry: %w", err)
+		} else {
+			events.Emit("email_tracking.created", tracking)
+		}
+		if report.Type == utils.BounceTypeHard && !copied {
+			h.db.Model(&models.Email{}).Where("id = ?", email.ID).Update("status", models.EmailStatusBounced)
+			events.Emit("email.hard_bounced", email)
+		}
+	}
+
+	// The address is the same problem on every list it's on
+	contacts := h.db.Model(&models.Contact{}).Where("team_id = ? AND LOWER(email) = ? AND is_deleted = false", config.TeamID, recipient)
+	switch report.Type {
+	case utils.BounceTypeComplaint:
+		contacts.Where("status <> ?", models.SubscriberStatusComplained).Update("status", models.SubscriberStatusComplained)
+	case utils.BounceTypeHard:
+		contacts.Where("status = ?", models.SubscriberStatusActive).Update("status", models.SubscriberStatusBounced)
+	case utils.BounceTypeSoft:
+		if h.softBounceLimitReached(config.TeamID, recipient) {
+			contacts.Where("status = ?", models.SubscriberStatusActive).Update("status", models.SubscriberStatusBounced)
+		}
+	}
+}
+
+// findBouncedEmail matches a bounce to the email it's about, by our header or else by recipient
+func (h *TaskHandler) findBouncedEmail(teamID string, report *utils.BounceReport) *models.Email {
+	email := &models.Email{}
+	if _, err := uuid.Parse(report.EmailID); err == nil {
+		if err := h.db.Where("id = ? AND team_id = ?", report.EmailID, teamID).First(email).Error; err == nil {
+			return email
+		}
+	}
+	if report.Recipient != "" {
+		recipient := strings.ToLower(report.Recipient)
+		if err := h.db.Where("team_id = ? AND (LOWER(\"to\") = ? OR "+models.CopyRecipientSQL+") AND status <> ?", teamID, recipient, recipient, recipient, models.EmailStatusPending).
+			Order("sent_at DESC").First(email).Error; err == nil {
+			return email
+		}
+	}
+	return nil
+}
+
+// softBounceLimitReached reports whether an address has soft bounced repeatedly
+func (h *TaskHandler) softBounceLimitReached(teamID, recipient string) bool {
+	var count int64
+	h.db.Model(&models.EmailTracking{}).
+		Joins("JOIN emails ON emails.id = email_trackings.email_id").
+		Where("emails.team_id = ? AND LOWER(emails.\"to\") = ?", teamID, recipient).
+		Where("email_trackings.event = ? AND email_trackings.timestamp >= ?", models.EmailTrackingEventBounce, time.Now().Add(-softBounceWindow)).
+		Count(&count)
+	return count >= softBounceLimit
+}
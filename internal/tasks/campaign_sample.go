@@ -0,0 +1,109 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"kori/internal/events"
+	"kori/internal/models"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/hibiken/asynq"
+)
+
+// pickSample picks the contacts, at random, a campaign sent to a sample first is mailed before
+// the rest of its audience
+func pickSample(campaign *models.Campaign, contacts []models.Contact) []models.Contact {
+	rand.Shuffle(len(contacts), func(i, j int) { contacts[i], contacts[j] = contacts[j], contacts[i] })
+
+	count := len(contacts) * campaign.SamplePercent / 100
+	if count == 0 {
+		// Small audiences still get a sample
+		count = 1
+	}
+	return contacts[:count]
+}
+
+// startSample records that the sample was sent and schedules checking how it did
+func (h *TaskHandler) startSample(ctx context.Context, campaign *models.Campaign, sent int) error {
+	campaign.Processed += sent
+	campaign.SampleStatus = models.SampleStatusObserving
+	campaign.SampleStartedAt = time.Now()
+	if err := h.db.Save(campaign).Error; err != nil {
+		return h.logger.Error("❌ failed to start sample: %w", err)
+	}
+
+	if err := h.taskClient.EnqueueSampleCheckTask(ctx, SampleCheckTask{CampaignID: campaign.ID}, campaign.SampleDeadline()); err != nil {
+		return h.logger.Error("❌ failed to schedule sample check: %w", err)
+	}
+
+	h.logger.Success("🔬 Sent campaign %s to a sample of %d contacts, checking it at %s",
+		campaign.ID, sent, campaign.SampleDeadline().Format(time.RFC3339))
+	return nil
+}
+
+// HandleSampleCheck checks the bounces and complaints of a campaign's sample once its observation
+// window is over. A healthy sample sends the campaign to the rest of the audience; otherwise
+// the campaign is paused and the team alerted.
+func (h *TaskHandler) HandleSampleCheck(ctx context.Context, t *asynq.Task) error {
+	var task SampleCheckTask
+	if err := decodeTask(t, &task); err != nil {
+		return fmt.Errorf("failed to unmarshal sample check task: %w", asynq.SkipRetry)
+	}
+
+	campaign, err := models.GetCampaignByID(task.CampaignID, h.db)
+	if err != nil {
+		return h.logger.Error("❌ failed to get campaign: %w", err)
+	}
+
+	if campaign.Status == models.CampaignStatusCancelled {
+		h.logger.Info("🛑 Campaign %s was cancelled before its sample was checked", campaign.ID)
+		return nil
+	}
+
+	if campaign.SampleStatus != models.SampleStatusObserving {
+		h.logger.Info("✅ Campaign %s has no sample being observed", campaign.ID)
+		return nil
+	}
+
+	stats, err := models.GetCampaignStats(campaign.ID, h.db)
+	if err != nil {
+		return h.logger.Error("❌ failed to get sample stats: %w", err)
+	}
+	result := campaign.EvaluateSample(stats)
+
+	if !result.Healthy() {
+		if err := h.db.Model(&models.Campaign{}).Where("id = ?", campaign.ID).Updates(map[string]interface{}{
+			"sample_status": models.SampleStatusFailed,
+			"status":        models.CampaignStatusPaused,
+		}).Error; err != nil {
+			return h.logger.Error("❌ failed to pause campaign: %w", err)
+		}
+		h.logger.Warn("⏸️ Paused campaign %s after its sample: %s", campaign.ID, strings.Join(result.Reasons, ", "))
+		events.Emit("campaign.sample_failed", result)
+		return nil
+	}
+
+	if err := h.db.Model(&models.Campaign{}).Where("id = ?", campaign.ID).
+		Update("sample_status", models.SampleStatusPassed).Error; err != nil {
+		return h.logger.Error("❌ failed to save sample result: %w", err)
+	}
+	h.logger.Success("🔬 Sample of campaign %s is healthy (bounce rate %.2f%%, complaint rate %.2f%%)",
+		campaign.ID, result.BounceRate, result.ComplaintRate)
+
+	// Resuming a campaign paused while its sample was observed sends it to the rest
+	if campaign.Status == models.CampaignStatusPaused {
+		return nil
+	}
+
+	if err := h.taskClient.EnqueueCampaignTask(ctx, CampaignTask{
+		CampaignID: campaign.ID,
+		BatchSize:  campaign.BatchSize,
+		Remainder:  true,
+	}, 0); err != nil {
+		return h.logger.Error("❌ failed to enqueue sample remainder: %w", err)
+	}
+
+	return nil
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"kori/internal/utils/logger"
@@ -12,14 +13,18 @@ import (
 	"github.com/hibiken/asynq"
 	"github.com/redis/go-redis/v9"
 
+	"kori/internal/tasks/embedded"
 	limiter "kori/internal/tasks/rate"
 )
 
+// ErrRateLimited is returned when an email can't be enqueued because its SMTP config is at its send rate
+var ErrRateLimited = errors.New("rate limit exceeded")
+
 // TaskClient handles task enqueuing with improved error handling and context support
 type TaskClient struct {
-	client       *asynq.Client
+	client       Enqueuer
 	logger       *logger.Logger
-	redisOptions *redis.Options
+	redisOptions *redis.Options // nil, as is redisClient, when tasks are queued in Postgres
 	redisClient  *redis.Client
 }
 
@@ -29,12 +34,20 @@ type RateLimiter struct {
 	Period time.Duration
 }
 
-func (c *TaskClient) GetClient() *asynq.Client {
+func (c *TaskClient) GetClient() Enqueuer {
 	return c.client
 }
 
-// NewTaskClient creates a new TaskClient with the given Redis configuration
+// NewTaskClient creates a new TaskClient with the given Redis configuration, enqueueing to the
+// embedded queue when redisAddr is empty
 func NewTaskClient(redisAddr, username, password string, db int) *TaskClient {
+	if redisAddr == "" {
+		return &TaskClient{
+			client: embedded.Default(),
+			logger: logger.New("TASKS"),
+		}
+	}
+
 	redisOpt := asynq.RedisClientOpt{
 		Addr:     redisAddr,
 		Username: username,
@@ -64,6 +77,173 @@ func NewTaskClient(redisAddr, username, password string, db int) *TaskClient {
 	}
 }
 
+// newInspector returns an inspector of the queue tasks are enqueued to
+func (c *TaskClient) newInspector() queueInspector {
+	if c.redisOptions == nil {
+		return embedded.Default()
+	}
+	return asynq.NewInspector(asynq.RedisClientOpt{
+		Addr:     c.redisOptions.Addr,
+		Username: c.redisOptions.Username,
+		Password: c.redisOptions.Password,
+		DB:       c.redisOptions.DB,
+	})
+}
+
+// QueueBacklog returns how many tasks in a queue are waiting to run
+func (c *TaskClient) QueueBacklog(queue string) (int, error) {
+	inspector := c.newInspector()
+	defer inspector.Close()
+
+	info, err := inspector.GetQueueInfo(queue)
+	if err != nil {
+		if errors.Is(err, asynq.ErrQueueNotFound) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to get queue info: %w", err)
+	}
+	return info.Pending + info.Scheduled + info.Retry + info.Active, nil
+}
+
+// queuedTaskPageSize is how many tasks are inspected at a time when deleting queued tasks
+const queuedTaskPageSize = 500
+
+// CancelCampaignTasks deletes the campaign's tasks that haven't started yet: scheduled and
+// pending batches, recurring runs, the A/B winner pick and retries of its emails. Tasks
+// already running see the campaign halted between batches. It returns how many were deleted.
+func (c *TaskClient) CancelCampaignTasks(ctx context.Context, campaignID string) (int, error) {
+	deleted, err := c.deleteQueuedTasks(ctx, []string{QueueDefault, QueueCritical}, false, func(info *asynq.TaskInfo) bool {
+		return taskCampaignID(info.Type, info.Payload) == campaignID
+	})
+	if err != nil {
+		return deleted, err
+	}
+
+	c.logger.Info("Deleted %d queued tasks of campaign %s", deleted, campaignID)
+	return deleted, nil
+}
+
+// CancelTeamTasks deletes every queued task, dead ones included, whose payload refers to one
+// of the given IDs or to the team itself. It returns how many were deleted.
+func (c *TaskClient) CancelTeamTasks(ctx context.Context, teamID string, ids map[string]bool) (int, error) {
+	deleted, err := c.deleteQueuedTasks(ctx, []string{QueueCritical, QueueDefault, QueueLow}, true, func(info *asynq.TaskInfo) bool {
+		var payload map[string]interface{}
+		if err := json.Unmarshal(info.Payload, &payload); err != nil {
+			return false
+		}
+		for key, value := range payload {
+			id, ok := value.(string)
+			if !ok || !strings.HasSuffix(key, "_id") {
+				continue
+			}
+			if id == teamID || ids[id] {
+				return true
+			}
+		}
+		return false
+	})
+	if err != nil {
+		return deleted, err
+	}
+
+	c.logger.Info("Deleted %d queued tasks of team %s", deleted, teamID)
+	return deleted, nil
+}
+
+// deleteQueuedTasks deletes the scheduled, pending and retrying tasks of the queues that match,
+// and the dead ones too when asked
+func (c *TaskClient) deleteQueuedTasks(ctx context.Context, queues []string, dead bool, match func(*asynq.TaskInfo) bool) (int, error) {
+	inspector := c.newInspector()
+	defer inspector.Close()
+
+	listers := []func(queue string, opts ...asynq.ListOption) ([]*asynq.TaskInfo, error){
+		inspector.ListScheduledTasks,
+		inspector.ListPendingTasks,
+		inspector.ListRetryTasks,
+	}
+	if dead {
+		listers = append(listers, inspector.ListArchivedTasks)
+	}
+
+	deleted := 0
+	for _, queue := range queues {
+		for _, list := range listers {
+			var ids []string
+			for page := 1; ; page++ {
+				if err := ctx.Err(); err != nil {
+					return deleted, err
+				}
+				infos, err := list(queue, asynq.PageSize(queuedTaskPageSize), asynq.Page(page))
+				if err != nil {
+					if errors.Is(err, asynq.ErrQueueNotFound) {
+						break
+					}
+					return deleted, fmt.Errorf("failed to list tasks in queue %s: %w", queue, err)
+				}
+				for _, info := range infos {
+					if match(info) {
+						ids = append(ids, info.ID)
+					}
+				}
+				if len(infos) < queuedTaskPageSize {
+					break
+				}
+			}
+
+			// Delete after listing so removals don't shift the pages being read
+			for _, id := range ids {
+				if err := inspector.DeleteTask(queue, id); err != nil {
+					if errors.Is(err, asynq.ErrTaskNotFound) {
+						continue
+					}
+					return deleted, fmt.Errorf("failed to delete task %s: %w", id, err)
+				}
+				deleted++
+			}
+		}
+	}
+
+	return deleted, nil
+}
+
+// PurgeTeamKeys deletes the Redis keys kept for a team: its in-flight slots and the send rate
+// windows of its SMTP configs. Without Redis they're kept in memory and dropped from there.
+func (c *TaskClient) PurgeTeamKeys(ctx context.Context, teamID string, smtpConfigIDs []string) error {
+	keys := []string{
+		fmt.Sprintf("semaphore:team:%s:%s", FairnessEmail, teamID),
+		fmt.Sprintf("semaphore:team:%s:%s", FairnessCampaign, teamID),
+	}
+	for _, id := range smtpConfigIDs {
+		queue := GetEmailQueueName(id)
+		keys = append(keys, fmt.Sprintf("queue_rate_limit:%s:%s", queue, queue))
+	}
+
+	if c.redisClient == nil {
+		limiter.Forget(keys...)
+		return nil
+	}
+	if err := c.redisClient.Del(ctx, keys...).Err(); err != nil {
+		return fmt.Errorf("failed to delete redis keys of team %s: %w", teamID, err)
+	}
+	return nil
+}
+
+// taskCampaignID returns the campaign a queued task belongs to, if any
+func taskCampaignID(taskType string, payload []byte) string {
+	switch taskType {
+	case TaskTypeCampaignProcess, TaskTypeCampaignSchedule, TaskTypeCampaignABWinner, TaskTypeEmailSend:
+	default:
+		return ""
+	}
+	var task struct {
+		CampaignID string `json:"campaign_id"`
+	}
+	if err := json.Unmarshal(payload, &task); err != nil {
+		return ""
+	}
+	return task.CampaignID
+}
+
 // Close closes the underlying asynq client
 func (c *TaskClient) Close() error {
 	return c.client.Close()
@@ -75,43 +255,59 @@ func GetEmailQueueName(smtpSettingsID string) string {
 
 // EnqueueEmailTask enqueues an email sending task
 func (c *TaskClient) EnqueueEmailTask(ctx context.Context, task EmailTask) error {
-	payload, err := json.Marshal(task)
+	task.EnqueuedAt = time.Now()
+	payload, err := marshalTask(&task)
 	if err != nil {
 		return fmt.Errorf("failed to marshal email task: %w", err)
 	}
 
-	redisClient := c.redisClient
-
-	limiterKey := GetEmailQueueName(task.SMTPConfigID)
+	// The send rate bounds what is enqueued to go out now; scheduled emails are spread out by
+	// their send times, so a campaign can schedule all of them at once
+	if !task.SendAt.After(task.EnqueuedAt) {
+		redisClient := c.redisClient
+
+		limiterKey := GetEmailQueueName(task.SMTPConfigID)
+
+		// Use sliding window rate limiter with Redis
+		rateLimiter := limiter.NewQueueRateLimiter(redisClient, limiter.QueueConfig{
+			Name: limiterKey,
+			RateLimit: limiter.RateLimit{
+				Window:  time.Second,
+				MaxJobs: task.MaxSendRate,
+			},
+		})
+
+		// Use provider as identifier for rate limiting
+		allowed, err := rateLimiter.Allow(ctx, limiterKey)
+		if err != nil {
+			return fmt.Errorf("rate limiter error: %w", err)
+		}
 
-	// Use sliding window rate limiter with Redis
-	rateLimiter := limiter.NewQueueRateLimiter(redisClient, limiter.QueueConfig{
-		Name: limiterKey,
-		RateLimit: limiter.RateLimit{
-			Window:  time.Second,
-			MaxJobs: task.MaxSendRate,
-		},
-	})
+		if !allowed {
+			err := fmt.Errorf("%w for provider %s", ErrRateLimited, limiterKey)
+			// Return error to trigger asynq retry with configured backoff
+			return c.logger.Error("❌ Rate limit exceeded %s", err)
+		}
+	}
 
-	// Use provider as identifier for rate limiting
-	allowed, err := rateLimiter.Allow(ctx, limiterKey)
-	if err != nil {
-		return fmt.Errorf("rate limiter error: %w", err)
+	// Retries get their own task ID; the failed attempt's task is kept in the archive
+	taskID := task.EmailID
+	if task.AttemptNum > 1 {
+		taskID = fmt.Sprintf("%s:attempt:%d", task.EmailID, task.AttemptNum)
 	}
 
-	if !allowed {
-		err := fmt.Errorf("rate limit exceeded for provider %s", limiterKey)
-		// Return error to trigger asynq retry with configured backoff
-		return c.logger.Error("❌ Rate limit exceeded %s", err)
+	queue := QueueCritical
+	if task.CampaignID != "" {
+		queue = QueueDefault
 	}
 
 	info, err := c.client.EnqueueContext(ctx,
 		asynq.NewTask(TaskTypeEmailSend, payload),
-		asynq.Queue(QueueCritical),
+		asynq.Queue(queue),
 		asynq.Timeout(TimeoutMedium),
 		asynq.MaxRetry(RetryDefault),
 		asynq.Unique(24*time.Hour),
-		asynq.TaskID(task.EmailID),
+		asynq.TaskID(taskID),
 		asynq.ProcessAt(task.SendAt),
 	)
 	if err != nil {
@@ -125,7 +321,7 @@ func (c *TaskClient) EnqueueEmailTask(ctx context.Context, task EmailTask) error
 
 // EnqueueCampaignTask enqueues a campaign task with support for cron scheduling
 func (c *TaskClient) EnqueueCampaignTask(ctx context.Context, task CampaignTask, processIn time.Duration) error {
-	payload, err := json.Marshal(task)
+	payload, err := marshalTask(&task)
 	if err != nil {
 		return fmt.Errorf("failed to marshal campaign task: %w", err)
 	}
@@ -133,6 +329,15 @@ func (c *TaskClient) EnqueueCampaignTask(ctx context.Context, task CampaignTask,
 	// Base task with type and payload
 	t := asynq.NewTask(TaskTypeCampaignProcess, payload)
 
+	// Shifted runs get their own ID so they don't collide with the recurring task
+	taskID := task.CampaignID
+	if task.ShiftedFrom != "" {
+		taskID = fmt.Sprintf("%s:shifted:%s", task.CampaignID, task.ShiftedFrom)
+	}
+	if task.Remainder {
+		taskID = fmt.Sprintf("%s:remainder", task.CampaignID)
+	}
+
 	// Configure task options based on scheduling type
 	var opts []asynq.Option
 
@@ -140,7 +345,7 @@ func (c *TaskClient) EnqueueCampaignTask(ctx context.Context, task CampaignTask,
 		asynq.Queue(QueueDefault),
 		asynq.Timeout(TimeoutLong),
 		asynq.MaxRetry(RetryMax),
-		asynq.TaskID(task.CampaignID),
+		asynq.TaskID(taskID),
 	)
 
 	switch {
@@ -156,7 +361,7 @@ func (c *TaskClient) EnqueueCampaignTask(ctx context.Context, task CampaignTask,
 		opts = append(opts, AfterFunc(func(ctx context.Context, t *asynq.Task) error {
 			// Decode the task payload
 			var taskData CampaignTask
-			if err := json.Unmarshal(t.Payload(), &taskData); err != nil {
+			if err := decodeTask(t, &taskData); err != nil {
 				return fmt.Errorf("failed to unmarshal task payload: %w", err)
 			}
 
@@ -217,7 +422,7 @@ func (c *TaskClient) EnqueueCampaignTask(ctx context.Context, task CampaignTask,
 
 // EnqueueWebhookDeliveryTask enqueues a webhook delivery task
 func (c *TaskClient) EnqueueWebhookDeliveryTask(ctx context.Context, task WebhookDeliveryTask) error {
-	payload, err := json.Marshal(task)
+	payload, err := marshalTask(&task)
 	if err != nil {
 		return fmt.Errorf("failed to marshal webhook task: %w", err)
 	}
@@ -236,9 +441,127 @@ func (c *TaskClient) EnqueueWebhookDeliveryTask(ctx context.Context, task Webhoo
 	return nil
 }
 
+// EnqueueABWinnerTask schedules picking the winner of a campaign A/B test
+func (c *TaskClient) EnqueueABWinnerTask(ctx context.Context, task ABWinnerTask, processAt time.Time) error {
+	payload, err := marshalTask(&task)
+	if err != nil {
+		return fmt.Errorf("failed to marshal A/B winner task: %w", err)
+	}
+
+	info, err := c.client.EnqueueContext(ctx,
+		asynq.NewTask(TaskTypeCampaignABWinner, payload),
+		asynq.Queue(QueueDefault),
+		asynq.MaxRetry(RetryDefault),
+		asynq.TaskID(fmt.Sprintf("%s:ab_winner", task.CampaignID)),
+		asynq.ProcessAt(processAt),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to enqueue A/B winner task: %w", err)
+	}
+
+	c.logger.Info("Enqueued A/B winner task [%s] in queue %s for campaign %s at %s",
+		info.ID, info.Queue, task.CampaignID, processAt.Format(time.RFC3339))
+	return nil
+}
+
+// EnqueueSampleCheckTask schedules checking how the sample of a campaign sent to a sample first did
+func (c *TaskClient) EnqueueSampleCheckTask(ctx context.Context, task SampleCheckTask, processAt time.Time) error {
+	payload, err := marshalTask(&task)
+	if err != nil {
+		return fmt.Errorf("failed to marshal sample check task: %w", err)
+	}
+
+	info, err := c.client.EnqueueContext(ctx,
+		asynq.NewTask(TaskTypeCampaignSampleCheck, payload),
+		asynq.Queue(QueueDefault),
+		asynq.MaxRetry(RetryDefault),
+		asynq.TaskID(fmt.Sprintf("%s:sample_check", task.CampaignID)),
+		asynq.ProcessAt(processAt),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to enqueue sample check task: %w", err)
+	}
+
+	c.logger.Info("Enqueued sample check task [%s] in queue %s for campaign %s at %s",
+		info.ID, info.Queue, task.CampaignID, processAt.Format(time.RFC3339))
+	return nil
+}
+
+// EnqueueAutomationStepTask schedules the next step of a contact's automation run
+func (c *TaskClient) EnqueueAutomationStepTask(ctx context.Context, task AutomationStepTask, processAt time.Time) error {
+	payload, err := marshalTask(&task)
+	if err != nil {
+		return fmt.Errorf("failed to marshal automation step task: %w", err)
+	}
+
+	taskID := fmt.Sprintf("%s:step:%d", task.RunID, task.Step)
+	if task.ResumeAt != 0 {
+		taskID += fmt.Sprintf(":resume:%d", task.ResumeAt)
+	}
+	info, err := c.client.EnqueueContext(ctx,
+		asynq.NewTask(TaskTypeAutomationStep, payload),
+		asynq.Queue(QueueDefault),
+		asynq.MaxRetry(RetryDefault),
+		asynq.TaskID(taskID),
+		asynq.ProcessAt(processAt),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to enqueue automation step task: %w", err)
+	}
+
+	c.logger.Info("Enqueued automation step task [%s] in queue %s for run %s at %s",
+		info.ID, info.Queue, task.RunID, processAt.Format(time.RFC3339))
+	return nil
+}
+
+// EnqueueSMSFallbackTask enqueues texting the contact of an email that hard bounced, once per email
+func (c *TaskClient) EnqueueSMSFallbackTask(ctx context.Context, task SMSFallbackTask) error {
+	payload, err := marshalTask(&task)
+	if err != nil {
+		return fmt.Errorf("failed to marshal sms fallback task: %w", err)
+	}
+
+	info, err := c.client.EnqueueContext(ctx,
+		asynq.NewTask(TaskTypeSMSFallback, payload),
+		asynq.Queue(QueueCritical),
+		asynq.MaxRetry(RetryDefault),
+		asynq.TaskID(fmt.Sprintf("%s:sms_fallback", task.EmailID)),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to enqueue sms fallback task: %w", err)
+	}
+
+	c.logger.Info("Enqueued sms fallback task [%s] in queue %s for email %s",
+		info.ID, info.Queue, task.EmailID)
+	return nil
+}
+
+// EnqueueWorkspacePurgeTask schedules the purge of a team's workspace for when its grace period ends
+func (c *TaskClient) EnqueueWorkspacePurgeTask(ctx context.Context, task WorkspacePurgeTask, processAt time.Time) error {
+	payload, err := marshalTask(&task)
+	if err != nil {
+		return fmt.Errorf("failed to marshal workspace purge task: %w", err)
+	}
+
+	info, err := c.client.EnqueueContext(ctx,
+		asynq.NewTask(TaskTypeWorkspacePurge, payload),
+		asynq.Queue(QueueLow),
+		asynq.MaxRetry(RetryDefault),
+		asynq.TaskID(fmt.Sprintf("%s:purge:%d", task.DeletionID, task.Attempt)),
+		asynq.ProcessAt(processAt),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to enqueue workspace purge task: %w", err)
+	}
+
+	c.logger.Info("Enqueued workspace purge task [%s] in queue %s for deletion %s at %s",
+		info.ID, info.Queue, task.DeletionID, processAt.Format(time.RFC3339))
+	return nil
+}
+
 // EnqueueDomainVerificationTask enqueues a domain verification task
 func (c *TaskClient) EnqueueDomainVerificationTask(ctx context.Context, task DomainVerificationTask) error {
-	payload, err := json.Marshal(task)
+	payload, err := marshalTask(&task)
 	if err != nil {
 		return fmt.Errorf("failed to marshal domain verification task: %w", err)
 	}
@@ -259,7 +582,7 @@ func (c *TaskClient) EnqueueDomainVerificationTask(ctx context.Context, task Dom
 
 // EnqueueContactImportTask enqueues a contact import task
 func (c *TaskClient) EnqueueContactImportTask(ctx context.Context, task ContactImportTask) error {
-	payload, err := json.Marshal(task)
+	payload, err := marshalTask(&task)
 	if err != nil {
 		return fmt.Errorf("failed to marshal contact import task: %w", err)
 	}
@@ -278,9 +601,78 @@ func (c *TaskClient) EnqueueContactImportTask(ctx context.Context, task ContactI
 	return nil
 }
 
+// EnqueueContactSyncTask enqueues a contact sync task for a single source
+func (c *TaskClient) EnqueueContactSyncTask(ctx context.Context, task ContactSyncTask) error {
+	payload, err := marshalTask(&task)
+	if err != nil {
+		return fmt.Errorf("failed to marshal contact sync task: %w", err)
+	}
+
+	info, err := c.client.EnqueueContext(ctx,
+		asynq.NewTask(TaskTypeContactSync, payload),
+		asynq.Queue(QueueDefault),
+		asynq.Timeout(TimeoutLong),
+		asynq.MaxRetry(RetryDefault),
+		// Avoid overlapping runs of the same source
+		asynq.Unique(10*time.Minute),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to enqueue contact sync task: %w", err)
+	}
+
+	c.logger.Info("Enqueued contact sync task [%s] in queue %s for source %s",
+		info.ID, info.Queue, task.SourceID)
+	return nil
+}
+
+// EnqueueContactTimelineExportTask enqueues the generation of a contact timeline export
+func (c *TaskClient) EnqueueContactTimelineExportTask(ctx context.Context, task ContactTimelineExportTask) error {
+	payload, err := marshalTask(&task)
+	if err != nil {
+		return fmt.Errorf("failed to marshal contact timeline export task: %w", err)
+	}
+
+	info, err := c.client.EnqueueContext(ctx,
+		asynq.NewTask(TaskTypeContactTimeline, payload),
+		asynq.Queue(QueueLow),
+		asynq.Timeout(TimeoutLong),
+		asynq.MaxRetry(RetryDefault),
+		asynq.TaskID(task.ExportID),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to enqueue contact timeline export task: %w", err)
+	}
+
+	c.logger.Info("Enqueued contact timeline export task [%s] in queue %s for export %s",
+		info.ID, info.Queue, task.ExportID)
+	return nil
+}
+
+// EnqueueContactConfirmationTask enqueues mailing a new contact the link confirming their subscription
+func (c *TaskClient) EnqueueContactConfirmationTask(ctx context.Context, task ContactConfirmationTask) error {
+	payload, err := marshalTask(&task)
+	if err != nil {
+		return fmt.Errorf("failed to marshal contact confirmation task: %w", err)
+	}
+
+	info, err := c.client.EnqueueContext(ctx,
+		asynq.NewTask(TaskTypeContactConfirm, payload),
+		asynq.Queue(QueueDefault),
+		asynq.MaxRetry(RetryDefault),
+		asynq.TaskID(fmt.Sprintf("%s:confirmation", task.ContactID)),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to enqueue contact confirmation task: %w", err)
+	}
+
+	c.logger.Info("Enqueued contact confirmation task [%s] in queue %s for contact %s",
+		info.ID, info.Queue, task.ContactID)
+	return nil
+}
+
 // EnqueueLLMEmailWriterTask enqueues an LLM email writer task
 func (c *TaskClient) EnqueueLLMEmailWriterTask(ctx context.Context, task LLMEmailWriterTask) error {
-	payload, err := json.Marshal(task)
+	payload, err := marshalTask(&task)
 	if err != nil {
 		return fmt.Errorf("failed to marshal LLM email writer task: %w", err)
 	}
@@ -295,7 +687,7 @@ func (c *TaskClient) EnqueueLLMEmailWriterTask(ctx context.Context, task LLMEmai
 		return fmt.Errorf("failed to enqueue LLM email writer task: %w", err)
 	}
 
-	c.logger.Info("Enqueued LLM email writer task [%s] in queue %s for email %s, template %s and model %s",
-		info.ID, info.Queue, task.EmailID, task.TemplateID, task.ModelID)
+	c.logger.Info("Enqueued LLM email writer task [%s] in queue %s for job %s, email %s, template %s and model %s",
+		info.ID, info.Queue, task.JobID, task.EmailID, task.TemplateID, task.ModelID)
 	return nil
 }
@@ -0,0 +1,125 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"kori/internal/models"
+	"kori/internal/utils"
+	"kori/internal/utils/base64"
+
+	"github.com/google/uuid"
+	"github.com/hibiken/asynq"
+)
+
+const (
+	// confirmationSubject and confirmationBody make the confirmation email of lists without a
+	// template of their own
+	confirmationSubject = "Please confirm your subscription to {{ list_name }}"
+	confirmationBody    = `<html><body>
+<p>Hi there,</p>
+<p>Please confirm that you'd like to get emails from <strong>{{ list_name }}</strong>.</p>
+<p><a href="{{ confirm_url }}">Confirm my subscription</a></p>
+<p>If you didn't sign up, ignore this email and you won't hear from us again.</p>
+</body></html>`
+)
+
+// HandleContactConfirmation mails a contact of a list that requires confirmation the link that
+// confirms their subscription. The list's confirmation template is given the link as the
+// confirm_url variable.
+func (h *TaskHandler) HandleContactConfirmation(ctx context.Context, t *asynq.Task) error {
+	var task ContactConfirmationTask
+	if err := decodeTask(t, &task); err != nil {
+		return fmt.Errorf("failed to unmarshal contact confirmation task: %w", asynq.SkipRetry)
+	}
+
+	// The contact is created in a transaction that may not have committed yet; retries wait for it
+	contact := &models.Contact{}
+	if err := h.db.Preload("List.ConfirmationTemplate.HtmlFile").
+		Where("id = ? AND is_deleted = false", task.ContactID).First(contact).Error; err != nil {
+		return h.logger.Error("❌ failed to get contact: %w", err)
+	}
+
+	if contact.Status != models.SubscriberStatusPending || contact.List == nil {
+		h.logger.Info("✅ Contact %s isn't waiting for confirmation", contact.ID)
+		return nil
+	}
+
+	email, err := h.buildConfirmationEmail(contact)
+	if err != nil {
+		return h.logger.Error("❌ failed to build confirmation email: %w", err)
+	}
+
+	// Creating the email queues it for sending
+	if err := h.db.Create(email).Error; err != nil {
+		return h.logger.Error("❌ failed to create confirmation email: %w", err)
+	}
+
+	h.logger.Success("📬 Sent contact %s the confirmation of list %s", contact.ID, contact.ListID)
+	return nil
+}
+
+// buildConfirmationEmail builds the confirmation email of the contact's list, sent through the
+// team's default SMTP config as a transactional email
+func (h *TaskHandler) buildConfirmationEmail(contact *models.Contact) (*models.Email, error) {
+	smtpConfig, err := models.GetSMTPConfig(contact.TeamID, "", "", h.db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get smtp config: %w", err)
+	}
+	if smtpConfig == nil {
+		return nil, errors.New("smtp config is nil")
+	}
+
+	category := &models.EmailCategory{}
+	if err := h.db.Where("name = ? AND team_id = ?", "Transactional", contact.TeamID).First(category).Error; err != nil {
+		return nil, fmt.Errorf("failed to get category: %w", err)
+	}
+
+	subject, html, text, templateID := confirmationSubject, confirmationBody, "", ""
+	if template := contact.List.ConfirmationTemplate; template != nil && template.HtmlFile != nil {
+		html, err = utils.GetHTMLFromURL(template.HtmlFile.SignedURL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get html from template: %w", err)
+		}
+		subject, text, templateID = template.Subject, template.PlainText, template.ID
+	}
+
+	confirmURL, err := utils.ConfirmationURL(contact.ID, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build confirmation url: %w", err)
+	}
+	variables := contact.TemplateVariables()
+	variables["confirm_url"] = confirmURL
+	variables["list_name"] = contact.List.Name
+
+	emailID := uuid.New().String()
+	// The link isn't tracked, so it keeps working without the tracking domain
+	parsedBody := utils.ReplaceVariables(html, variables, emailID, cfg, false)
+	parsedText := utils.PlainTextBody(text, html, variables)
+	parsedSubject, err := base64.DecodeFromBase64(utils.ReplaceVariables(subject, variables, emailID, cfg, false))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode subject: %w", err)
+	}
+
+	jsonData, err := utils.MapToJSON(variables)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert variables to json: %w", err)
+	}
+
+	email := &models.Email{
+		From:         smtpConfig.FromEmail,
+		To:           contact.Email,
+		Subject:      parsedSubject,
+		Body:         parsedBody,
+		PlainText:    parsedText,
+		Data:         jsonData,
+		Status:       models.EmailStatusPending,
+		TeamID:       contact.TeamID,
+		TemplateID:   templateID,
+		ContactID:    contact.ID,
+		SMTPConfigID: smtpConfig.ID,
+		CategoryID:   category.ID,
+	}
+	email.ID = emailID
+	return email, nil
+}
@@ -0,0 +1,462 @@
+package tasks
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"kori/internal/models"
+	"kori/internal/utils"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/hibiken/asynq"
+	"github.com/xuri/excelize/v2"
+	"gorm.io/gorm"
+)
+
+const (
+	// maxContactImportSize caps the size of an imported file or sheet (50MB)
+	maxContactImportSize = 50 << 20
+	// contactImportChunk is how many rows are checked against the list and saved at a time
+	contactImportChunk = 500
+	// xlsxMimeType is the content type of XLSX uploads
+	xlsxMimeType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+)
+
+// importValidator checks imported rows against the rules of the contact fields
+var importValidator = validator.New()
+
+// importRows reads the rows of an import one at a time, the header being the first. Rows are
+// numbered as the file's own viewer numbers them, for the error report.
+type importRows interface {
+	Next() (row int, record []string, err error) // io.EOF after the last row
+	Close() error
+}
+
+// csvImportRows reads a CSV file as it downloads
+type csvImportRows struct {
+	reader *csv.Reader
+	body   io.Closer
+}
+
+func newCSVImportRows(body io.ReadCloser) *csvImportRows {
+	reader := csv.NewReader(body)
+	reader.LazyQuotes = true
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1 // short and long rows are reported per row, not for the file
+	return &csvImportRows{reader: reader, body: body}
+}
+
+func (r *csvImportRows) Next() (int, []string, error) {
+	record, err := r.reader.Read()
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return parseErr.StartLine, nil, err
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	line, _ := r.reader.FieldPos(0)
+	return line, record, nil
+}
+
+func (r *csvImportRows) Close() error { return r.body.Close() }
+
+// xlsxImportRows reads the first sheet of an XLSX workbook. The workbook is unzipped in memory,
+// but its rows are read as they're needed.
+type xlsxImportRows struct {
+	file *excelize.File
+	rows *excelize.Rows
+	row  int
+}
+
+func newXLSXImportRows(body io.ReadCloser) (*xlsxImportRows, error) {
+	defer body.Close()
+
+	file, err := excelize.OpenReader(body, excelize.Options{UnzipSizeLimit: 1 << 30})
+	if err != nil {
+		return nil, fmt.Errorf("not a valid XLSX file: %w", err)
+	}
+	sheets := file.GetSheetList()
+	if len(sheets) == 0 {
+		file.Close()
+		return nil, errors.New("the workbook has no sheets")
+	}
+	rows, err := file.Rows(sheets[0])
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to read sheet %s: %w", sheets[0], err)
+	}
+	return &xlsxImportRows{file: file, rows: rows}, nil
+}
+
+func (r *xlsxImportRows) Next() (int, []string, error) {
+	if !r.rows.Next() {
+		if err := r.rows.Error(); err != nil {
+			return 0, nil, err
+		}
+		return 0, nil, io.EOF
+	}
+	r.row++
+	record, err := r.rows.Columns()
+	return r.row, record, err
+}
+
+func (r *xlsxImportRows) Close() error {
+	r.rows.Close()
+	return r.file.Close()
+}
+
+// importProgress counts an import's rows as they're read and keeps its error report
+type importProgress struct {
+	total, imported, updated, skipped, failed int
+	stored                                    int // rows of the error report already saved
+	errors                                    []models.ContactImportError
+}
+
+// columns are the import's counters as saved on it
+func (p *importProgress) columns() map[string]interface{} {
+	return map[string]interface{}{
+		"total_rows":    p.total,
+		"imported_rows": p.imported,
+		"updated_rows":  p.updated,
+		"skipped_rows":  p.skipped,
+		"failed_rows":   p.failed,
+	}
+}
+
+func (p *importProgress) rowFailed(contactImport *models.ContactImport, row int, email, message string) {
+	p.failed++
+	if p.stored+len(p.errors) >= models.MaxContactImportErrors {
+		return
+	}
+	p.errors = append(p.errors, models.ContactImportError{
+		ImportID: contactImport.ID,
+		TeamID:   contactImport.TeamID,
+		Row:      row,
+		Email:    email,
+		Message:  message,
+	})
+}
+
+// HandleContactImport imports the rows of an uploaded CSV or XLSX file, or of a Google Sheet,
+// into the import's list. Rows are streamed and saved in chunks; the ones that can't be
+// imported, including addresses of disposable domains or domains without mail servers, are
+// listed in the import's error report rather than failing the import. A dry run only counts
+// what the import would do and leaves it VALIDATED, for the user to confirm.
+func (h *TaskHandler) HandleContactImport(ctx context.Context, t *asynq.Task) error {
+	var task ContactImportTask
+	if err := decodeTask(t, &task); err != nil {
+		return h.logger.Error("❌ failed to unmarshal contact import task: %w", asynq.SkipRetry)
+	}
+
+	contactImport, err := models.GetContactImportByID(task.ImportID, h.db)
+	if err != nil {
+		return h.logger.Error("❌ failed to get contact import: %w", err)
+	}
+	if contactImport.Status != models.ContactImportStatusPending && contactImport.Status != models.ContactImportStatusProcessing {
+		h.logger.Info("⏭️ Skipping contact import %s in status %s", contactImport.ID, contactImport.Status)
+		return nil
+	}
+
+	h.logger.Info("📥 Importing contacts of import %s from %s (dry run: %v)", contactImport.ID, contactImport.Source, contactImport.DryRun)
+	if err := h.db.Model(&models.ContactImport{}).Where("id = ?", contactImport.ID).
+		UpdateColumn("status", models.ContactImportStatusProcessing).Error; err != nil {
+		return h.logger.Error("❌ failed to update contact import status: %w", err)
+	}
+
+	rows, err := h.openImportRows(contactImport)
+	if err != nil {
+		return h.failContactImport(contactImport, &importProgress{}, err)
+	}
+	defer rows.Close()
+
+	progress := &importProgress{}
+	if err := h.importContactRows(ctx, contactImport, rows, progress); err != nil {
+		return h.failContactImport(contactImport, progress, err)
+	}
+
+	columns := progress.columns()
+	if contactImport.DryRun {
+		columns["status"] = models.ContactImportStatusValidated
+	} else {
+		columns["status"] = models.ContactImportStatusCompleted
+		columns["completed_at"] = time.Now()
+	}
+	if err := h.db.Model(&models.ContactImport{}).Where("id = ?", contactImport.ID).UpdateColumns(columns).Error; err != nil {
+		return h.logger.Error("❌ failed to update contact import status: %w", err)
+	}
+
+	h.logger.Success("✅ Contact import %s %s: %d imported, %d updated, %d skipped, %d failed of %d rows",
+		contactImport.ID, strings.ToLower(string(columns["status"].(models.ContactImportStatus))),
+		progress.imported, progress.updated, progress.skipped, progress.failed, progress.total)
+	return nil
+}
+
+// failContactImport records why an import stopped, keeping what it imported until then
+func (h *TaskHandler) failContactImport(contactImport *models.ContactImport, progress *importProgress, cause error) error {
+	columns := progress.columns()
+	columns["status"] = models.ContactImportStatusFailed
+	columns["error"] = cause.Error()
+	columns["completed_at"] = time.Now()
+	if err := h.db.Model(&models.ContactImport{}).Where("id = ?", contactImport.ID).UpdateColumns(columns).Error; err != nil {
+		return h.logger.Error("❌ failed to update contact import status: %w", err)
+	}
+	return h.logger.Error("❌ contact import failed: %w", fmt.Errorf("%v: %w", cause, asynq.SkipRetry))
+}
+
+// openImportRows starts downloading what the import reads
+func (h *TaskHandler) openImportRows(contactImport *models.ContactImport) (importRows, error) {
+	if contactImport.Source == models.ContactImportSourceGoogleSheets {
+		exportURL, err := utils.GoogleSheetCSVURL(contactImport.SheetURL)
+		if err != nil {
+			return nil, err
+		}
+		body, err := utils.OpenURL(exportURL, maxContactImportSize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to download the sheet, is it shared with anyone with the link? %w", err)
+		}
+		return newCSVImportRows(body), nil
+	}
+
+	file, err := models.GetFileByID(contactImport.FileID, h.db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file: %w", err)
+	}
+	body, err := utils.OpenStoredFile(file.SignedURL, maxContactImportSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download file: %w", err)
+	}
+	if file.Type == xlsxMimeType || strings.HasSuffix(strings.ToLower(file.Name), ".xlsx") {
+		return newXLSXImportRows(body)
+	}
+	return newCSVImportRows(body), nil
+}
+
+// importContactRows reads the rows after the header, validates each and saves them in chunks
+func (h *TaskHandler) importContactRows(ctx context.Context, contactImport *models.ContactImport, rows importRows, progress *importProgress) error {
+	_, headers, err := rows.Next()
+	if errors.Is(err, io.EOF) {
+		return errors.New("the file is empty")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read the header row: %w", err)
+	}
+	for i := range headers {
+		headers[i] = strings.TrimSpace(headers[i])
+	}
+	if len(headers) > 0 {
+		headers[0] = strings.TrimPrefix(headers[0], "\ufeff")
+		// Sheets not shared by link answer with Google's sign in page
+		if contactImport.Source == models.ContactImportSourceGoogleSheets && strings.HasPrefix(headers[0], "<") {
+			return errors.New("the sheet isn't shared with anyone with the link")
+		}
+	}
+
+	fieldsMap, err := utils.JSONToMap(contactImport.FieldsMap)
+	if err != nil {
+		return fmt.Errorf("failed to parse fields map: %w", err)
+	}
+	reverseMap := make(map[string]string, len(fieldsMap))
+	for k, v := range fieldsMap {
+		reverseMap[v] = k
+	}
+
+	domains := utils.NewEmailDomainChecker()
+	seen := map[string]bool{}
+	chunk := make([]models.Contact, 0, contactImportChunk)
+	for {
+		row, record, err := rows.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			progress.total++
+			progress.rowFailed(contactImport, row, "", fmt.Sprintf("the row can't be read: %v", parseErr.Err))
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read the file: %w", err)
+		}
+		if isBlankRow(record) {
+			continue
+		}
+		progress.total++
+
+		recordMap := make(map[string]string, len(headers))
+		for i, value := range record {
+			if i < len(headers) && headers[i] != "" {
+				recordMap[headers[i]] = strings.TrimSpace(value)
+			}
+		}
+
+		contact := models.Contact{
+			TeamID:   contactImport.TeamID,
+			ListID:   contactImport.ListID,
+			ImportID: contactImport.ID,
+		}
+		applyContactFields(&contact, func(dbField string) string {
+			if field, exists := reverseMap[dbField]; exists {
+				return recordMap[field]
+			}
+			return ""
+		})
+
+		if message := validateImportedContact(&contact); message != "" {
+			progress.rowFailed(contactImport, row, contact.Email, message)
+			continue
+		}
+		if err := domains.Check(ctx, contact.Email); err != nil {
+			progress.rowFailed(contactImport, row, contact.Email, emailDomainMessage(err))
+			continue
+		}
+
+		key := strings.ToLower(contact.Email)
+		if seen[key] {
+			progress.skipped++
+			continue
+		}
+		seen[key] = true
+
+		if contact.Metadata, err = utils.MapToJSON(recordMap); err != nil {
+			return fmt.Errorf("failed to convert row %d to json: %w", row, err)
+		}
+
+		chunk = append(chunk, contact)
+		if len(chunk) == contactImportChunk {
+			if err := h.saveImportChunk(ctx, contactImport, chunk, progress); err != nil {
+				return err
+			}
+			chunk = chunk[:0]
+		}
+	}
+
+	if err := h.saveImportChunk(ctx, contactImport, chunk, progress); err != nil {
+		return err
+	}
+	if progress.total == 0 {
+		return errors.New("the file has no data rows")
+	}
+	return nil
+}
+
+// saveImportChunk creates the chunk's contacts the list doesn't have yet, updates the ones it
+// has when the import updates existing contacts, and saves the import's progress and error
+// report so far. Dry runs only count them.
+func (h *TaskHandler) saveImportChunk(ctx context.Context, contactImport *models.ContactImport, chunk []models.Contact, progress *importProgress) error {
+	db := h.db.WithContext(ctx)
+
+	if len(chunk) > 0 {
+		emails := make([]string, len(chunk))
+		for i := range chunk {
+			emails[i] = strings.ToLower(chunk[i].Email)
+		}
+		var existing []string
+		if err := db.Model(&models.Contact{}).
+			Where("list_id = ? AND is_deleted = false AND LOWER(email) IN ?", contactImport.ListID, emails).
+			Pluck("LOWER(email)", &existing).Error; err != nil {
+			return fmt.Errorf("failed to get the list's contacts: %w", err)
+		}
+		onList := make(map[string]bool, len(existing))
+		for _, email := range existing {
+			onList[email] = true
+		}
+
+		contacts := make([]models.Contact, 0, len(chunk))
+		updates := make([]models.Contact, 0)
+		for _, contact := range chunk {
+			switch {
+			case !onList[strings.ToLower(contact.Email)]:
+				contacts = append(contacts, contact)
+			case contactImport.UpdateExisting:
+				updates = append(updates, contact)
+			default:
+				progress.skipped++
+			}
+		}
+		if !contactImport.DryRun {
+			if len(contacts) > 0 {
+				if err := db.CreateInBatches(&contacts, 100).Error; err != nil {
+					return fmt.Errorf("failed to create contacts: %w", err)
+				}
+			}
+			if len(updates) > 0 {
+				if err := updateImportedContacts(db, contactImport, updates); err != nil {
+					return fmt.Errorf("failed to update contacts: %w", err)
+				}
+			}
+		}
+		progress.imported += len(contacts)
+		progress.updated += len(updates)
+	}
+
+	if len(progress.errors) > 0 {
+		if err := db.CreateInBatches(&progress.errors, 100).Error; err != nil {
+			return fmt.Errorf("failed to save the error report: %w", err)
+		}
+		progress.stored += len(progress.errors)
+		progress.errors = progress.errors[:0]
+	}
+
+	return db.Model(&models.ContactImport{}).Where("id = ?", contactImport.ID).UpdateColumns(progress.columns()).Error
+}
+
+// updateImportedContacts sets the fields the rows fill in on the list's contacts they're for,
+// keeping the others. The rows' columns are added to the contacts' metadata.
+func updateImportedContacts(db *gorm.DB, contactImport *models.ContactImport, rows []models.Contact) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, row := range rows {
+			contact := tx.Model(&models.Contact{}).
+				Where("list_id = ? AND is_deleted = false AND LOWER(email) = ?", contactImport.ListID, strings.ToLower(row.Email)).
+				Session(&gorm.Session{})
+			if err := contact.Omit("email", "team_id", "list_id", "import_id", "metadata").Updates(&row).Error; err != nil {
+				return err
+			}
+			if err := contact.UpdateColumn("metadata", gorm.Expr("COALESCE(metadata, '{}'::jsonb) || ?::jsonb", string(row.Metadata))).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// emailDomainMessage explains why an address's domain was turned down
+func emailDomainMessage(err error) string {
+	switch {
+	case errors.Is(err, utils.ErrDisposableDomain):
+		return "the address is from a disposable email domain"
+	case errors.Is(err, utils.ErrNoMailServer):
+		return "the address's domain doesn't accept mail"
+	}
+	return err.Error()
+}
+
+// validateImportedContact checks a row's contact against the rules of the contact fields,
+// returning what's wrong with it
+func validateImportedContact(contact *models.Contact) string {
+	switch {
+	case contact.Email == "":
+		return "email is missing"
+	case importValidator.Var(contact.Email, "email") != nil:
+		return fmt.Sprintf("%q is not a valid email address", contact.Email)
+	case contact.Locale != "" && importValidator.Var(contact.Locale, "bcp47_language_tag") != nil:
+		return fmt.Sprintf("%q is not a valid locale", contact.Locale)
+	case contact.Timezone != "" && importValidator.Var(contact.Timezone, "timezone") != nil:
+		return fmt.Sprintf("%q is not a valid time zone", contact.Timezone)
+	}
+	return ""
+}
+
+// isBlankRow reports whether every cell of the row is empty
+func isBlankRow(record []string) bool {
+	for _, value := range record {
+		if strings.TrimSpace(value) != "" {
+			return false
+		}
+	}
+	return true
+}
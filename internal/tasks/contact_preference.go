@@ -0,0 +1,51 @@
+package tasks
+
+import (
+	"kori/internal/models"
+	"strings"
+)
+
+// preferenceSkipReason is recorded on the emails of recipients who opted out of their category
+const preferenceSkipReason = "opted out of the category in the preference center"
+
+// applyCategoryPreferences skips the campaign's emails to recipients who opted out of the
+// email's category in the preference center
+func (h *TaskHandler) applyCategoryPreferences(campaign *models.Campaign, emails []*models.Email) error {
+	byCategory := map[string][]*models.Email{}
+	for _, email := range emails {
+		byCategory[email.CategoryID] = append(byCategory[email.CategoryID], email)
+	}
+
+	skipped := 0
+	for categoryID, categoryEmails := range byCategory {
+		addresses := make([]string, len(categoryEmails))
+		for i, email := range categoryEmails {
+			addresses[i] = email.To
+		}
+		optedOut, err := models.CategoryOptOuts(campaign.TeamID, categoryID, addresses, h.db)
+		if err != nil {
+			return h.logger.Error("❌ failed to check category preferences: %w", err)
+		}
+		for _, email := range categoryEmails {
+			if optedOut[strings.ToLower(email.To)] {
+				email.Status = models.EmailStatusSkipped
+				email.SkipReason = preferenceSkipReason
+				skipped++
+			}
+		}
+	}
+
+	if skipped > 0 {
+		h.logger.Info("🎛️ Skipped %d emails of campaign %s opted out of in the preference center", skipped, campaign.ID)
+	}
+	return nil
+}
+
+// optedOutOfCategory reports whether the contact opted out of the category in the preference center
+func (h *TaskHandler) optedOutOfCategory(teamID, categoryID string, contact *models.Contact) (bool, error) {
+	optedOut, err := models.CategoryOptOuts(teamID, categoryID, []string{contact.Email}, h.db)
+	if err != nil {
+		return false, err
+	}
+	return optedOut[strings.ToLower(contact.Email)], nil
+}
@@ -0,0 +1,305 @@
+package tasks
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"kori/internal/models"
+	"kori/internal/utils"
+	"maps"
+	"strings"
+	"time"
+
+	"github.com/hibiken/asynq"
+)
+
+// maxContactSyncFeedSize caps the size of a remote contact feed (20MB)
+const maxContactSyncFeedSize = 20 << 20
+
+// HandleContactSync syncs a remote contact feed into its mailing list.
+// When triggered by the scheduler without a payload it enqueues a sync for every due source.
+func (h *TaskHandler) HandleContactSync(ctx context.Context, t *asynq.Task) error {
+	if len(t.Payload()) == 0 {
+		return h.dispatchContactSyncs(ctx)
+	}
+
+	var task ContactSyncTask
+	if err := decodeTask(t, &task); err != nil {
+		return fmt.Errorf("failed to unmarshal contact sync task: %w", asynq.SkipRetry)
+	}
+
+	source, err := models.GetContactSyncSourceByID(task.SourceID, h.db)
+	if err != nil {
+		return h.logger.Error("❌ failed to get contact sync source: %w", err)
+	}
+
+	h.logger.Info("🔄 Syncing contacts for source %s from %s", source.ID, source.URL)
+
+	created, updated, removed, syncErr := h.syncContactSource(ctx, source)
+
+	now := time.Now()
+	source.LastSyncedAt = &now
+	if syncErr != nil {
+		source.LastStatus = models.ContactSyncStatusFailed
+		source.LastError = syncErr.Error()
+	} else {
+		source.LastStatus = models.ContactSyncStatusSuccess
+		source.LastError = ""
+		source.LastCreated = created
+		source.LastUpdated = updated
+		source.LastRemoved = removed
+	}
+	if err := h.db.Save(source).Error; err != nil {
+		return h.logger.Error("❌ failed to update contact sync source: %w", err)
+	}
+
+	if syncErr != nil {
+		return h.logger.Error("❌ failed to sync contacts: %w", syncErr)
+	}
+
+	h.logger.Success("✅ Contact sync %s completed: %d created, %d updated, %d removed", source.ID, created, updated, removed)
+	return nil
+}
+
+// dispatchContactSyncs enqueues a sync task for every active source whose interval has elapsed
+func (h *TaskHandler) dispatchContactSyncs(ctx context.Context) error {
+	var sources []models.ContactSyncSource
+	if err := h.db.Where("is_active = true AND is_deleted = false").Find(&sources).Error; err != nil {
+		return h.logger.Error("❌ failed to get contact sync sources: %w", err)
+	}
+
+	now := time.Now()
+	for _, source := range sources {
+		if !source.IsDue(now) {
+			continue
+		}
+		if err := h.taskClient.EnqueueContactSyncTask(ctx, ContactSyncTask{SourceID: source.ID}); err != nil {
+			h.logger.Warn("⚠️ failed to enqueue contact sync for source %s: %v", source.ID, err)
+		}
+	}
+	return nil
+}
+
+// syncContactSource fetches the feed, diffs it against the list and applies upserts and removals
+func (h *TaskHandler) syncContactSource(ctx context.Context, source *models.ContactSyncSource) (int, int, int, error) {
+	headers := map[string]string{}
+	if source.AuthHeader != "" {
+		headers[source.AuthHeader] = source.AuthValue
+	}
+
+	body, err := utils.FetchURL(source.URL, headers, maxContactSyncFeedSize)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("failed to fetch feed: %w", err)
+	}
+
+	records, err := parseContactFeed(source.Format, body)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("failed to parse feed: %w", err)
+	}
+
+	fieldsMap := map[string]string{}
+	if len(source.FieldsMap) > 0 {
+		if fieldsMap, err = utils.JSONToMap(source.FieldsMap); err != nil {
+			return 0, 0, 0, fmt.Errorf("failed to parse fields map: %w", err)
+		}
+	}
+	reverseMap := make(map[string]string)
+	for k, v := range fieldsMap {
+		reverseMap[v] = k
+	}
+
+	var existing []models.Contact
+	if err := h.db.WithContext(ctx).
+		Where("team_id = ? AND list_id = ? AND is_deleted = false", source.TeamID, source.ListID).
+		Find(&existing).Error; err != nil {
+		return 0, 0, 0, fmt.Errorf("failed to get existing contacts: %w", err)
+	}
+	byEmail := make(map[string]*models.Contact, len(existing))
+	for i := range existing {
+		byEmail[strings.ToLower(strings.TrimSpace(existing[i].Email))] = &existing[i]
+	}
+
+	var toCreate []models.Contact
+	seen := make(map[string]bool)
+	updated := 0
+
+	for _, record := range records {
+		getFieldValue := func(dbField string) string {
+			if feedField, exists := reverseMap[dbField]; exists {
+				return strings.TrimSpace(record[feedField])
+			}
+			// Fall back to feed fields named after the contact columns
+			return strings.TrimSpace(record[dbField])
+		}
+
+		incoming := models.Contact{
+			TeamID: source.TeamID,
+			ListID: source.ListID,
+		}
+		applyContactFields(&incoming, getFieldValue)
+
+		key := strings.ToLower(incoming.Email)
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		if incoming.Metadata, err = utils.MapToJSON(record); err != nil {
+			return 0, 0, 0, fmt.Errorf("failed to convert record to json: %w", err)
+		}
+
+		current, exists := byEmail[key]
+		if !exists {
+			toCreate = append(toCreate, incoming)
+			continue
+		}
+
+		if !contactChanged(current, &incoming) {
+			continue
+		}
+
+		// Status is left alone so unsubscribes and bounces survive a re-sync
+		if err := h.db.WithContext(ctx).Model(&models.Contact{}).Where("id = ?", current.ID).Updates(map[string]interface{}{
+			"first_name": incoming.FirstName,
+			"last_name":  incoming.LastName,
+			"linked_in":  incoming.LinkedIn,
+			"twitter":    incoming.Twitter,
+			"facebook":   incoming.Facebook,
+			"instagram":  incoming.Instagram,
+			"country":    incoming.Country,
+			"phone":      incoming.Phone,
+			"city":       incoming.City,
+			"state":      incoming.State,
+			"zip":        incoming.Zip,
+			"address":    incoming.Address,
+			"company":    incoming.Company,
+			"locale":     incoming.Locale,
+			"timezone":   incoming.Timezone,
+			"metadata":   incoming.Metadata,
+			"updated_at": time.Now(),
+		}).Error; err != nil {
+			return 0, 0, 0, fmt.Errorf("failed to update contact %s: %w", current.ID, err)
+		}
+		updated++
+	}
+
+	if len(toCreate) > 0 {
+		contactImport := &models.ContactImport{
+			TeamID:    source.TeamID,
+			ListID:    source.ListID,
+			Status:    models.ContactImportStatusCompleted,
+			FieldsMap: source.FieldsMap,
+		}
+		if err := h.db.WithContext(ctx).Create(contactImport).Error; err != nil {
+			return 0, 0, 0, fmt.Errorf("failed to create contact import: %w", err)
+		}
+		for i := range toCreate {
+			toCreate[i].ImportID = contactImport.ID
+		}
+		if err := h.db.WithContext(ctx).CreateInBatches(&toCreate, 100).Error; err != nil {
+			return 0, 0, 0, fmt.Errorf("failed to create contacts: %w", err)
+		}
+	}
+
+	removed := 0
+	if source.RemoveMissing {
+		var ids []string
+		for key, contact := range byEmail {
+			if !seen[key] {
+				ids = append(ids, contact.ID)
+			}
+		}
+		if len(ids) > 0 {
+			if err := h.db.WithContext(ctx).Model(&models.Contact{}).Where("id IN ?", ids).Updates(map[string]interface{}{
+				"deleted_at": time.Now(),
+				"is_deleted": true,
+			}).Error; err != nil {
+				return 0, 0, 0, fmt.Errorf("failed to remove contacts: %w", err)
+			}
+			removed = len(ids)
+		}
+	}
+
+	return len(toCreate), updated, removed, nil
+}
+
+// parseContactFeed converts a CSV (with header row) or JSON array feed into records
+func parseContactFeed(format models.ContactSyncFormat, body []byte) ([]map[string]string, error) {
+	switch format {
+	case models.ContactSyncFormatJSON:
+		var rows []map[string]interface{}
+		if err := json.Unmarshal(body, &rows); err != nil {
+			// Also accept feeds wrapped in a {"data": [...]} envelope
+			var envelope struct {
+				Data []map[string]interface{} `json:"data"`
+			}
+			if envErr := json.Unmarshal(body, &envelope); envErr != nil {
+				return nil, err
+			}
+			rows = envelope.Data
+		}
+
+		records := make([]map[string]string, 0, len(rows))
+		for _, row := range rows {
+			record := make(map[string]string, len(row))
+			for k, v := range row {
+				if v != nil {
+					record[k] = fmt.Sprint(v)
+				}
+			}
+			records = append(records, record)
+		}
+		return records, nil
+
+	default:
+		reader := csv.NewReader(bytes.NewReader(body))
+		reader.LazyQuotes = true
+		reader.TrimLeadingSpace = true
+
+		rows, err := reader.ReadAll()
+		if err != nil {
+			return nil, err
+		}
+		if len(rows) == 0 {
+			return nil, nil
+		}
+
+		headers := rows[0]
+		records := make([]map[string]string, 0, len(rows)-1)
+		for _, row := range rows[1:] {
+			record := make(map[string]string, len(headers))
+			for j, value := range row {
+				if j < len(headers) {
+					record[headers[j]] = value
+				}
+			}
+			records = append(records, record)
+		}
+		return records, nil
+	}
+}
+
+// contactChanged reports whether the incoming feed row differs from the stored contact
+func contactChanged(current, incoming *models.Contact) bool {
+	if current.FirstName != incoming.FirstName || current.LastName != incoming.LastName ||
+		current.LinkedIn != incoming.LinkedIn || current.Twitter != incoming.Twitter ||
+		current.Facebook != incoming.Facebook || current.Instagram != incoming.Instagram ||
+		current.Country != incoming.Country || current.Phone != incoming.Phone ||
+		current.City != incoming.City || current.State != incoming.State ||
+		current.Zip != incoming.Zip || current.Address != incoming.Address ||
+		current.Company != incoming.Company {
+		return true
+	}
+
+	currentMeta, err := utils.JSONToMap(current.Metadata)
+	if err != nil {
+		return true
+	}
+	incomingMeta, err := utils.JSONToMap(incoming.Metadata)
+	if err != nil {
+		return true
+	}
+	return !maps.Equal(currentMeta, incomingMeta)
+}
@@ -0,0 +1,44 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"kori/internal/events"
+	"kori/internal/models"
+
+	"github.com/hibiken/asynq"
+	"gorm.io/gorm"
+)
+
+// HandleContactTimelineExport claims a pending timeline export and hands it to the service
+// that builds, signs and stores the file
+func (h *TaskHandler) HandleContactTimelineExport(ctx context.Context, t *asynq.Task) error {
+	var task ContactTimelineExportTask
+	if err := decodeTask(t, &task); err != nil {
+		return fmt.Errorf("failed to unmarshal contact timeline export task: %w", asynq.SkipRetry)
+	}
+
+	export := &models.ContactTimelineExport{}
+	if err := h.db.Where("id = ? AND is_deleted = false", task.ExportID).First(export).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return h.logger.Error("❌ failed to get contact timeline export: %w", err)
+	}
+
+	result := h.db.Model(&models.ContactTimelineExport{}).
+		Where("id = ? AND status = ?", export.ID, models.ContactTimelineExportStatusPending).
+		Update("status", models.ContactTimelineExportStatusProcessing)
+	if result.Error != nil {
+		return h.logger.Error("❌ failed to claim contact timeline export: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		h.logger.Info("⏭️ Skipping contact timeline export %s in status %s", export.ID, export.Status)
+		return nil
+	}
+	export.Status = models.ContactTimelineExportStatusProcessing
+
+	events.Emit("contact_timeline_export.generate", export)
+	return nil
+}
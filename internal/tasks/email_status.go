@@ -0,0 +1,107 @@
+package tasks
+
+import (
+	"context"
+	"kori/internal/models"
+	"time"
+
+	"github.com/hibiken/asynq"
+)
+
+const (
+	// emailStatusDigestEvent is the webhook event status digests are delivered as
+	emailStatusDigestEvent = "email.status"
+	// emailStatusDigestBatch caps how many statuses one delivery carries
+	emailStatusDigestBatch = 1000
+	// emailStatusDigestMaxWindow is how far back a webhook's first or overdue digest reaches
+	emailStatusDigestMaxWindow = time.Hour
+)
+
+// HandleEmailStatusDigest delivers the status changes of transactional and automation emails
+// of the last minute to webhooks subscribed to email.status. Each webhook keeps the end of the
+// window it was last sent, so a digest that is late covers everything since.
+func (h *TaskHandler) HandleEmailStatusDigest(ctx context.Context, t *asynq.Task) error {
+	var webhooks []models.Webhook
+	if err := h.db.WithContext(ctx).
+		Where("is_active = true AND is_deleted = false AND ? = ANY(events)", emailStatusDigestEvent).
+		Find(&webhooks).Error; err != nil {
+		return h.logger.Error("❌ failed to get status webhooks: %w", err)
+	}
+
+	// Leave a little slack for updates still being committed
+	to := time.Now().Add(-5 * time.Second).Truncate(time.Second)
+	delivered := 0
+	for i := range webhooks {
+		count, err := h.deliverEmailStatusDigest(ctx, &webhooks[i], to)
+		if err != nil {
+			h.logger.Warn("⚠️ Failed to deliver status digest to webhook %s: %v", webhooks[i].ID, err)
+			continue
+		}
+		delivered += count
+	}
+
+	if delivered > 0 {
+		h.logger.Info("📬 Delivered %d email status changes to %d webhooks", delivered, len(webhooks))
+	}
+	return nil
+}
+
+// deliverEmailStatusDigest enqueues the webhook's status changes up to to, in batches, and
+// moves its window forward
+func (h *TaskHandler) deliverEmailStatusDigest(ctx context.Context, webhook *models.Webhook, to time.Time) (int, error) {
+	from := to.Add(-time.Minute)
+	if webhook.StatusDigestAt != nil {
+		from = *webhook.StatusDigestAt
+	}
+	if oldest := to.Add(-emailStatusDigestMaxWindow); from.Before(oldest) {
+		from = oldest
+	}
+	if !from.Before(to) {
+		return 0, nil
+	}
+
+	// Page by (updated_at, id) so emails updated again while the digest runs aren't skipped;
+	// they're picked up by the next window instead
+	count := 0
+	var last *models.EmailStatusEntry
+	for batch := 1; ; batch++ {
+		query := models.EmailStatusChangesQuery(webhook.TeamID, from, to, h.db.WithContext(ctx))
+		if last != nil {
+			query = query.Where("(updated_at, id) > (?, ?)", last.UpdatedAt, last.ID)
+		}
+		var entries []models.EmailStatusEntry
+		if err := query.Limit(emailStatusDigestBatch).Scan(&entries).Error; err != nil {
+			return count, err
+		}
+		if len(entries) == 0 {
+			break
+		}
+
+		if err := h.taskClient.EnqueueWebhookDeliveryTask(ctx, WebhookDeliveryTask{
+			WebhookID: webhook.ID,
+			Event:     emailStatusDigestEvent,
+			Payload: map[string]interface{}{
+				"teamId": webhook.TeamID,
+				"from":   from,
+				"to":     to,
+				"batch":  batch,
+				"emails": entries,
+			},
+			AttemptNum: 1,
+		}); err != nil {
+			return count, err
+		}
+		count += len(entries)
+
+		if len(entries) < emailStatusDigestBatch {
+			break
+		}
+		last = &entries[len(entries)-1]
+	}
+
+	if err := h.db.WithContext(ctx).Model(&models.Webhook{}).Where("id = ?", webhook.ID).
+		Update("status_digest_at", to).Error; err != nil {
+		return count, err
+	}
+	return count, nil
+}
@@ -0,0 +1,298 @@
+package embedded
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"gorm.io/gorm"
+)
+
+// Page sizes as asynq's inspector uses them
+const (
+	defaultPageSize = 30
+	defaultPageNum  = 1
+)
+
+// listPage reads asynq.Page and asynq.PageSize. Their types aren't exported, so they're told
+// apart by name.
+func listPage(opts []asynq.ListOption) (size, num int) {
+	size, num = defaultPageSize, defaultPageNum
+	for _, opt := range opts {
+		value := reflect.ValueOf(opt)
+		if value.Kind() != reflect.Int {
+			continue
+		}
+		switch value.Type().Name() {
+		case "pageSizeOpt":
+			size = int(value.Int())
+		case "pageNumOpt":
+			num = int(value.Int())
+		}
+	}
+	return size, max(num, 1)
+}
+
+// Queues returns the queues tasks were enqueued to
+func (q *Queue) Queues() ([]string, error) {
+	db, err := q.conn(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	var stored []string
+	if err := db.Model(&task{}).Distinct("queue").Pluck("queue", &stored).Error; err != nil {
+		return nil, err
+	}
+
+	q.mu.RLock()
+	known := make(map[string]bool, len(q.queues))
+	for queue := range q.queues {
+		known[queue] = true
+	}
+	q.mu.RUnlock()
+	for _, queue := range stored {
+		known[queue] = true
+	}
+
+	queues := make([]string, 0, len(known))
+	for queue := range known {
+		queues = append(queues, queue)
+	}
+	sort.Strings(queues)
+	return queues, nil
+}
+
+func (q *Queue) known(db *gorm.DB, queue string) (bool, error) {
+	q.mu.RLock()
+	known := q.queues[queue]
+	q.mu.RUnlock()
+	if known {
+		return true, nil
+	}
+	var count int64
+	err := db.Model(&task{}).Where("queue = ?", queue).Limit(1).Count(&count).Error
+	return count > 0, err
+}
+
+// GetQueueInfo returns the task counts of a queue
+func (q *Queue) GetQueueInfo(queue string) (*asynq.QueueInfo, error) {
+	db, err := q.conn(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	if known, err := q.known(db, queue); err != nil {
+		return nil, err
+	} else if !known {
+		return nil, fmt.Errorf("%w", asynq.ErrQueueNotFound)
+	}
+
+	now := time.Now()
+	var counts []struct {
+		State string
+		Later bool
+		Count int
+	}
+	if err := db.Model(&task{}).Select("state, process_at > ? AS later, COUNT(*) AS count", now).
+		Where("queue = ?", queue).Group("state, later").Scan(&counts).Error; err != nil {
+		return nil, err
+	}
+
+	info := &asynq.QueueInfo{Queue: queue, Timestamp: now}
+	for _, count := range counts {
+		switch {
+		case count.State == stateActive:
+			info.Active += count.Count
+		case count.State == stateRetry:
+			info.Retry += count.Count
+		case count.State == stateArchived:
+			info.Archived += count.Count
+		case count.Later:
+			info.Scheduled += count.Count
+		default:
+			info.Pending += count.Count
+		}
+		info.Size += count.Count
+	}
+
+	var oldest sql.NullTime
+	if err := db.Model(&task{}).Select("MIN(process_at)").
+		Where("queue = ? AND state = ? AND process_at <= ?", queue, statePending, now).Row().Scan(&oldest); err != nil {
+		return nil, err
+	}
+	if oldest.Valid {
+		info.Latency = now.Sub(oldest.Time)
+	}
+
+	q.mu.RLock()
+	info.Paused = q.paused[queue]
+	q.mu.RUnlock()
+	q.statsMu.Lock()
+	if q.statsDay == now.Format("2006-01-02") {
+		info.Processed, info.Failed = q.processed[queue], q.failed[queue]
+	}
+	q.statsMu.Unlock()
+	return info, nil
+}
+
+// list returns a page of a queue's tasks in one state, the longest waiting first
+func (q *Queue) list(queue string, opts []asynq.ListOption, where string, args ...interface{}) ([]*asynq.TaskInfo, error) {
+	db, err := q.conn(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	if known, err := q.known(db, queue); err != nil {
+		return nil, err
+	} else if !known {
+		return nil, fmt.Errorf("%w", asynq.ErrQueueNotFound)
+	}
+
+	size, num := listPage(opts)
+	var rows []task
+	if err := db.Where("queue = ?", queue).Where(where, args...).Order("process_at, id").
+		Offset((num - 1) * size).Limit(size).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	infos := make([]*asynq.TaskInfo, len(rows))
+	for i := range rows {
+		infos[i] = rows[i].info(now)
+	}
+	return infos, nil
+}
+
+// ListPendingTasks lists the tasks of a queue that are due
+func (q *Queue) ListPendingTasks(queue string, opts ...asynq.ListOption) ([]*asynq.TaskInfo, error) {
+	return q.list(queue, opts, "state = ? AND process_at <= ?", statePending, time.Now())
+}
+
+// ListActiveTasks lists the tasks of a queue that are running
+func (q *Queue) ListActiveTasks(queue string, opts ...asynq.ListOption) ([]*asynq.TaskInfo, error) {
+	return q.list(queue, opts, "state = ?", stateActive)
+}
+
+// ListScheduledTasks lists the tasks of a queue due later
+func (q *Queue) ListScheduledTasks(queue string, opts ...asynq.ListOption) ([]*asynq.TaskInfo, error) {
+	return q.list(queue, opts, "state = ? AND process_at > ?", statePending, time.Now())
+}
+
+// ListRetryTasks lists the tasks of a queue waiting to be retried
+func (q *Queue) ListRetryTasks(queue string, opts ...asynq.ListOption) ([]*asynq.TaskInfo, error) {
+	return q.list(queue, opts, "state = ?", stateRetry)
+}
+
+// ListArchivedTasks lists the tasks of a queue that ran out of retries or were skipped
+func (q *Queue) ListArchivedTasks(queue string, opts ...asynq.ListOption) ([]*asynq.TaskInfo, error) {
+	return q.list(queue, opts, "state = ?", stateArchived)
+}
+
+func (q *Queue) get(db *gorm.DB, queue, id string) (*task, error) {
+	if known, err := q.known(db, queue); err != nil {
+		return nil, err
+	} else if !known {
+		return nil, fmt.Errorf("%w", asynq.ErrQueueNotFound)
+	}
+	row := &task{}
+	if err := db.Where("id = ? AND queue = ?", id, queue).First(row).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w", asynq.ErrTaskNotFound)
+		}
+		return nil, err
+	}
+	return row, nil
+}
+
+// GetTaskInfo returns a task of a queue
+func (q *Queue) GetTaskInfo(queue, id string) (*asynq.TaskInfo, error) {
+	db, err := q.conn(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	row, err := q.get(db, queue, id)
+	if err != nil {
+		return nil, err
+	}
+	return row.info(time.Now()), nil
+}
+
+// RunTask makes a scheduled, retrying or archived task due now
+func (q *Queue) RunTask(queue, id string) error {
+	db, err := q.conn(context.Background())
+	if err != nil {
+		return err
+	}
+	row, err := q.get(db, queue, id)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	switch {
+	case row.State == stateActive:
+		return errors.New("task is already running")
+	case row.State == statePending && !row.ProcessAt.After(now):
+		return errors.New("task is already in pending state")
+	}
+
+	result := db.Model(&task{}).Where("id = ? AND state = ?", row.ID, row.State).
+		Updates(map[string]interface{}{"state": statePending, "process_at": now})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("task changed state, try again")
+	}
+	q.notify()
+	return nil
+}
+
+// DeleteTask deletes a task that isn't running
+func (q *Queue) DeleteTask(queue, id string) error {
+	db, err := q.conn(context.Background())
+	if err != nil {
+		return err
+	}
+	row, err := q.get(db, queue, id)
+	if err != nil {
+		return err
+	}
+	if row.State == stateActive {
+		return errors.New("cannot delete task in active state. use CancelProcessing instead.")
+	}
+
+	result := db.Where("id = ? AND state <> ?", row.ID, stateActive).Delete(&task{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("task started running")
+	}
+	return nil
+}
+
+// PauseQueue stops workers from taking the queue's tasks until it's unpaused
+func (q *Queue) PauseQueue(queue string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.paused[queue] {
+		return fmt.Errorf("queue %q is already paused", queue)
+	}
+	q.paused[queue] = true
+	return nil
+}
+
+// UnpauseQueue lets workers take the queue's tasks again
+func (q *Queue) UnpauseQueue(queue string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if !q.paused[queue] {
+		return fmt.Errorf("queue %q is not paused", queue)
+	}
+	delete(q.paused, queue)
+	q.notify()
+	return nil
+}
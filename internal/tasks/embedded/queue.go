@@ -0,0 +1,282 @@
+package embedded
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hibiken/asynq"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrNotOpen is returned using the queue before the server opened it on its database
+var ErrNotOpen = errors.New("embedded task queue is not open")
+
+// Task states as stored. Pending tasks due later are the scheduled ones.
+const (
+	statePending  = "pending"
+	stateActive   = "active"
+	stateRetry    = "retry"
+	stateArchived = "archived"
+)
+
+// Defaults matching asynq's, for tasks enqueued without the option
+const (
+	defaultQueue    = "default"
+	defaultMaxRetry = 25
+	defaultTimeout  = 30 * time.Minute
+)
+
+// task is a queued task as stored
+type task struct {
+	ID           string        `gorm:"primaryKey"`
+	Queue        string        `gorm:"not null;index:idx_embedded_tasks_due,priority:1"`
+	Type         string        `gorm:"not null"`
+	Payload      []byte        `gorm:"type:bytea"`
+	State        string        `gorm:"not null;index:idx_embedded_tasks_due,priority:2"`
+	ProcessAt    time.Time     `gorm:"not null;index:idx_embedded_tasks_due,priority:3"`
+	MaxRetry     int           `gorm:"not null"`
+	Retried      int           `gorm:"not null;default:0"`
+	Timeout      time.Duration `gorm:"not null;default:0"`
+	UniqueKey    string        `gorm:"index"` // held until UniqueUntil or until the task succeeds
+	UniqueUntil  *time.Time
+	LastErr      string
+	LastFailedAt *time.Time
+	LeaseUntil   *time.Time // when an active task whose worker stopped is taken back
+	CreatedAt    time.Time
+}
+
+func (task) TableName() string {
+	return "embedded_tasks"
+}
+
+// Queue keeps tasks in a table of the database and runs them in this process, standing in for
+// asynq and Redis on a server without Redis. Its methods match those of asynq's client and
+// inspector, and tasks are held to the same task ID, uniqueness and retry rules.
+type Queue struct {
+	mu     sync.RWMutex
+	db     *gorm.DB
+	queues map[string]bool // known queues, as asynq registers them
+	paused map[string]bool
+
+	// wake tells an idle worker a task is due now
+	wake chan struct{}
+
+	statsMu   sync.Mutex
+	statsDay  string
+	processed map[string]int // today, by queue
+	failed    map[string]int
+}
+
+var defaultQueueInstance = newQueue()
+
+func newQueue() *Queue {
+	return &Queue{
+		queues:    make(map[string]bool),
+		paused:    make(map[string]bool),
+		wake:      make(chan struct{}, 1),
+		processed: make(map[string]int),
+		failed:    make(map[string]int),
+	}
+}
+
+// Default returns the queue of this process. Clients can be made from it before it's open; they
+// fail to enqueue until it is.
+func Default() *Queue {
+	return defaultQueueInstance
+}
+
+// Open stores the queue's tasks in db, creating its table if needed
+func (q *Queue) Open(db *gorm.DB) error {
+	if err := db.AutoMigrate(&task{}); err != nil {
+		return fmt.Errorf("failed to migrate embedded task queue: %w", err)
+	}
+	q.mu.Lock()
+	q.db = db
+	q.mu.Unlock()
+	return nil
+}
+
+func (q *Queue) conn(ctx context.Context) (*gorm.DB, error) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.db == nil {
+		return nil, ErrNotOpen
+	}
+	return q.db.WithContext(ctx), nil
+}
+
+func (q *Queue) register(queue string) {
+	q.mu.Lock()
+	q.queues[queue] = true
+	q.mu.Unlock()
+}
+
+// notify wakes an idle worker, if one waits
+func (q *Queue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// uniqueKey identifies the tasks asynq.Unique considers the same: of one type and queue with
+// the same payload
+func uniqueKey(queue, taskType string, payload []byte) string {
+	sum := sha256.Sum256(payload)
+	return fmt.Sprintf("%s:%s:%s", queue, taskType, hex.EncodeToString(sum[:]))
+}
+
+// EnqueueContext stores a task to run at its process time. Options are read as asynq reads
+// them; those asynq doesn't know are ignored, as it ignores them.
+func (q *Queue) EnqueueContext(ctx context.Context, t *asynq.Task, opts ...asynq.Option) (*asynq.TaskInfo, error) {
+	db, err := q.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	row := &task{
+		ID:        uuid.NewString(),
+		Queue:     defaultQueue,
+		Type:      t.Type(),
+		Payload:   t.Payload(),
+		State:     statePending,
+		ProcessAt: now,
+		MaxRetry:  defaultMaxRetry,
+	}
+	var uniqueTTL time.Duration
+	for _, opt := range opts {
+		switch opt.Type() {
+		case asynq.MaxRetryOpt:
+			if value, ok := opt.Value().(int); ok {
+				row.MaxRetry = value
+			}
+		case asynq.QueueOpt:
+			if value, ok := opt.Value().(string); ok && value != "" {
+				row.Queue = value
+			}
+		case asynq.TaskIDOpt:
+			if value, ok := opt.Value().(string); ok && value != "" {
+				row.ID = value
+			}
+		case asynq.TimeoutOpt:
+			if value, ok := opt.Value().(time.Duration); ok {
+				row.Timeout = value
+			}
+		case asynq.UniqueOpt:
+			if value, ok := opt.Value().(time.Duration); ok {
+				uniqueTTL = value
+			}
+		case asynq.ProcessAtOpt:
+			if value, ok := opt.Value().(time.Time); ok {
+				row.ProcessAt = value
+			}
+		case asynq.ProcessInOpt:
+			if value, ok := opt.Value().(time.Duration); ok {
+				row.ProcessAt = now.Add(value)
+			}
+		}
+	}
+	if uniqueTTL > 0 && uniqueTTL < time.Second {
+		return nil, errors.New("unique TTL can't be under a second")
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if uniqueTTL > 0 {
+			row.UniqueKey = uniqueKey(row.Queue, row.Type, row.Payload)
+			until := now.Add(uniqueTTL)
+			row.UniqueUntil = &until
+
+			// Held until the transaction ends, so two enqueues can't both find no duplicate
+			if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", row.UniqueKey).Error; err != nil {
+				return err
+			}
+			var duplicates int64
+			if err := tx.Model(&task{}).Where("unique_key = ? AND unique_until > ?", row.UniqueKey, now).Count(&duplicates).Error; err != nil {
+				return err
+			}
+			if duplicates > 0 {
+				return fmt.Errorf("%w", asynq.ErrDuplicateTask)
+			}
+		}
+
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(row)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("%w", asynq.ErrTaskIDConflict)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	q.register(row.Queue)
+	if !row.ProcessAt.After(now) {
+		q.notify()
+	}
+	return row.info(now), nil
+}
+
+// Close is a no-op; the database is closed by its owner
+func (q *Queue) Close() error {
+	return nil
+}
+
+// info describes the task as asynq does
+func (t *task) info(now time.Time) *asynq.TaskInfo {
+	info := &asynq.TaskInfo{
+		ID:            t.ID,
+		Queue:         t.Queue,
+		Type:          t.Type,
+		Payload:       t.Payload,
+		MaxRetry:      t.MaxRetry,
+		Retried:       t.Retried,
+		LastErr:       t.LastErr,
+		Timeout:       t.Timeout,
+		NextProcessAt: t.ProcessAt,
+	}
+	switch {
+	case t.State == stateActive:
+		info.State = asynq.TaskStateActive
+		info.NextProcessAt = time.Time{}
+		info.IsOrphaned = t.LeaseUntil != nil && t.LeaseUntil.Before(now)
+	case t.State == stateRetry:
+		info.State = asynq.TaskStateRetry
+	case t.State == stateArchived:
+		info.State = asynq.TaskStateArchived
+		info.NextProcessAt = time.Time{}
+	case t.ProcessAt.After(now):
+		info.State = asynq.TaskStateScheduled
+	default:
+		info.State = asynq.TaskStatePending
+	}
+	if t.LastFailedAt != nil {
+		info.LastFailedAt = *t.LastFailedAt
+	}
+	return info
+}
+
+// count records a processed or failed task in today's stats
+func (q *Queue) count(queue string, failed bool) {
+	q.statsMu.Lock()
+	defer q.statsMu.Unlock()
+	if day := time.Now().Format("2006-01-02"); day != q.statsDay {
+		q.statsDay = day
+		q.processed = make(map[string]int)
+		q.failed = make(map[string]int)
+	}
+	q.processed[queue]++
+	if failed {
+		q.failed[queue]++
+	}
+}
@@ -0,0 +1,60 @@
+package embedded
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"kori/internal/utils/logger"
+
+	"github.com/google/uuid"
+	"github.com/hibiken/asynq"
+	"github.com/robfig/cron/v3"
+)
+
+// Scheduler enqueues periodic tasks to a queue, as asynq's scheduler does
+type Scheduler struct {
+	queue  *Queue
+	cron   *cron.Cron
+	logger *logger.Logger
+
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewScheduler returns a scheduler enqueueing to the queue
+func NewScheduler(queue *Queue) *Scheduler {
+	return &Scheduler{
+		queue:  queue,
+		cron:   cron.New(),
+		logger: logger.New("EMBEDDED_QUEUE"),
+		done:   make(chan struct{}),
+	}
+}
+
+// Register enqueues the task with the options on the cron spec and returns the entry's ID
+func (s *Scheduler) Register(spec string, task *asynq.Task, opts ...asynq.Option) (string, error) {
+	if _, err := s.cron.AddFunc(spec, func() {
+		if _, err := s.queue.EnqueueContext(context.Background(), task, opts...); err != nil {
+			s.logger.Warn("⚠️ Failed to enqueue periodic %s task: %v", task.Type(), err)
+		}
+	}); err != nil {
+		return "", fmt.Errorf("invalid cron spec %q: %w", spec, err)
+	}
+	return uuid.NewString(), nil
+}
+
+// Run runs the scheduler until Shutdown
+func (s *Scheduler) Run() error {
+	s.cron.Start()
+	<-s.done
+	return nil
+}
+
+// Shutdown stops the scheduler, letting enqueues under way finish
+func (s *Scheduler) Shutdown() {
+	s.stopOnce.Do(func() {
+		<-s.cron.Stop().Done()
+		close(s.done)
+	})
+}
@@ -0,0 +1,386 @@
+package embedded
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	"kori/internal/utils/logger"
+
+	"github.com/hibiken/asynq"
+	"gorm.io/gorm"
+)
+
+const (
+	// pollInterval is how often idle workers look for tasks that came due
+	pollInterval = time.Second
+	// leaseMargin is how long past its timeout an active task is left to its worker before the
+	// recoverer takes it back
+	leaseMargin = time.Minute
+	// recoverInterval is how often orphaned tasks are taken back and old archived ones trimmed
+	recoverInterval = time.Minute
+	// archiveRetention is how long archived tasks are kept, as asynq keeps them
+	archiveRetention = 90 * 24 * time.Hour
+	// shutdownTimeout is how long running tasks get to finish on shutdown before they go back to
+	// the queue, as asynq gives them
+	shutdownTimeout = 8 * time.Second
+)
+
+// Config is the subset of asynq.Config the embedded server runs by
+type Config struct {
+	Concurrency    int
+	Queues         []string // processed in strict priority, the first one first
+	IsFailure      func(error) bool
+	RetryDelayFunc asynq.RetryDelayFunc
+}
+
+// Server runs the tasks of a queue on workers in this process
+type Server struct {
+	queue  *Queue
+	config Config
+	logger *logger.Logger
+
+	stopping chan struct{} // closed to stop taking tasks
+	abort    chan struct{} // closed to hand running tasks back to the queue
+	stopOnce sync.Once
+	workers  sync.WaitGroup
+}
+
+// NewServer returns a server running the queue's tasks
+func NewServer(queue *Queue, config Config) *Server {
+	if config.Concurrency <= 0 {
+		config.Concurrency = 1
+	}
+	if config.IsFailure == nil {
+		config.IsFailure = func(err error) bool { return err != nil }
+	}
+	if config.RetryDelayFunc == nil {
+		config.RetryDelayFunc = asynq.DefaultRetryDelayFunc
+	}
+	for _, name := range config.Queues {
+		queue.register(name)
+	}
+	return &Server{
+		queue:    queue,
+		config:   config,
+		logger:   logger.New("EMBEDDED_QUEUE"),
+		stopping: make(chan struct{}),
+		abort:    make(chan struct{}),
+	}
+}
+
+// Start runs the workers and returns; Shutdown stops them
+func (s *Server) Start(handler asynq.Handler) error {
+	if _, err := s.queue.conn(context.Background()); err != nil {
+		return err
+	}
+
+	s.workers.Add(s.config.Concurrency + 1)
+	for i := 0; i < s.config.Concurrency; i++ {
+		go s.work(handler)
+	}
+	go s.recoverTasks()
+	return nil
+}
+
+// Stop stops taking tasks. Running ones finish.
+func (s *Server) Stop() {
+	s.stopOnce.Do(func() { close(s.stopping) })
+}
+
+// Shutdown stops taking tasks and waits for running ones, handing those that don't finish in
+// time back to the queue
+func (s *Server) Shutdown() {
+	s.Stop()
+
+	done := make(chan struct{})
+	go func() {
+		s.workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(shutdownTimeout):
+		close(s.abort)
+		<-done
+	}
+}
+
+func (s *Server) work(handler asynq.Handler) {
+	defer s.workers.Done()
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stopping:
+			return
+		default:
+		}
+
+		row, err := s.dequeue()
+		if err != nil {
+			s.logger.Warn("⚠️ Failed to take a task: %v", err)
+		}
+		if row == nil {
+			select {
+			case <-s.stopping:
+				return
+			case <-s.queue.wake:
+			case <-ticker.C:
+			}
+			continue
+		}
+
+		s.process(handler, row)
+		// Another task may be due too; let the next idle worker look
+		s.queue.notify()
+	}
+}
+
+// dequeue takes the due task of the highest priority queue that isn't paused, leasing it until
+// its timeout runs out
+func (s *Server) dequeue() (*task, error) {
+	db, err := s.queue.conn(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	s.queue.mu.RLock()
+	var queues []string
+	for _, name := range s.config.Queues {
+		if !s.queue.paused[name] {
+			queues = append(queues, name)
+		}
+	}
+	s.queue.mu.RUnlock()
+	if len(queues) == 0 {
+		return nil, nil
+	}
+
+	priority := make([]string, len(queues))
+	args := make([]interface{}, 0, len(queues)+6)
+	for i, name := range queues {
+		priority[i] = fmt.Sprintf("WHEN ? THEN %d", i)
+		args = append(args, name)
+	}
+
+	now := time.Now()
+	query := fmt.Sprintf(`UPDATE embedded_tasks SET state = ?,
+		lease_until = CAST(? AS timestamptz) + (CASE WHEN timeout > 0 THEN timeout ELSE CAST(? AS bigint) END / 1000) * INTERVAL '1 microsecond'
+		WHERE id = (
+			SELECT id FROM embedded_tasks
+			WHERE state IN (?, ?) AND process_at <= ? AND queue IN ?
+			ORDER BY CASE queue %s END, process_at
+			LIMIT 1 FOR UPDATE SKIP LOCKED
+		) RETURNING *`, strings.Join(priority, " "))
+	args = append([]interface{}{stateActive, now.Add(leaseMargin), int64(defaultTimeout), statePending, stateRetry, now, queues}, args...)
+
+	var rows []task
+	if err := db.Raw(query, args...).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	return &rows[0], nil
+}
+
+// process runs the task and records how it went, as asynq's processor does
+func (s *Server) process(handler asynq.Handler, row *task) {
+	timeout := row.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	ctx = context.WithValue(ctx, metadataKey{}, metadata{
+		id:       row.ID,
+		queue:    row.Queue,
+		retried:  row.Retried,
+		maxRetry: row.MaxRetry,
+	})
+
+	t := asynq.NewTask(row.Type, row.Payload)
+	result := make(chan error, 1)
+	go func() {
+		result <- perform(ctx, handler, t)
+	}()
+
+	var err error
+	select {
+	case <-s.abort:
+		s.logger.Warn("⚠️ Quitting worker, task %s goes back to the queue", row.ID)
+		s.update(row, map[string]interface{}{"state": statePending, "lease_until": nil})
+		return
+	case <-ctx.Done():
+		err = ctx.Err()
+	case err = <-result:
+	}
+
+	if err == nil {
+		s.delete(row)
+		s.queue.count(row.Queue, false)
+		return
+	}
+
+	now := time.Now()
+	switch {
+	case errors.Is(err, asynq.RevokeTask):
+		s.logger.Warn("⚠️ Revoked task %s", row.ID)
+		s.delete(row)
+		s.queue.count(row.Queue, false)
+	case row.Retried >= row.MaxRetry || errors.Is(err, asynq.SkipRetry):
+		s.logger.Warn("⚠️ Retry exhausted for task %s", row.ID)
+		s.update(row, map[string]interface{}{
+			"state":          stateArchived,
+			"lease_until":    nil,
+			"last_err":       err.Error(),
+			"last_failed_at": now,
+		})
+		s.queue.count(row.Queue, true)
+	default:
+		failure := s.config.IsFailure(err)
+		updates := map[string]interface{}{
+			"state":       stateRetry,
+			"lease_until": nil,
+			"process_at":  now.Add(s.config.RetryDelayFunc(row.Retried, err, t)),
+			"last_err":    err.Error(),
+		}
+		if failure {
+			updates["retried"] = gorm.Expr("retried + 1")
+			updates["last_failed_at"] = now
+		}
+		s.update(row, updates)
+		s.queue.count(row.Queue, failure)
+	}
+}
+
+// perform runs the handler, turning a panic into an error
+func perform(ctx context.Context, handler asynq.Handler, t *asynq.Task) (err error) {
+	defer func() {
+		if x := recover(); x != nil {
+			err = fmt.Errorf("panic: %v\n%s", x, debug.Stack())
+		}
+	}()
+	return handler.ProcessTask(ctx, t)
+}
+
+// update changes the task if it's still the worker's; a task the recoverer took back isn't
+func (s *Server) update(row *task, updates map[string]interface{}) {
+	db, err := s.queue.conn(context.Background())
+	if err != nil {
+		s.logger.Warn("⚠️ Failed to update task %s: %v", row.ID, err)
+		return
+	}
+	if err := db.Model(&task{}).Where("id = ? AND state = ?", row.ID, stateActive).Updates(updates).Error; err != nil {
+		s.logger.Warn("⚠️ Failed to update task %s: %v", row.ID, err)
+	}
+}
+
+// delete removes a task that's done, releasing its unique lock with it
+func (s *Server) delete(row *task) {
+	db, err := s.queue.conn(context.Background())
+	if err != nil {
+		s.logger.Warn("⚠️ Failed to delete task %s: %v", row.ID, err)
+		return
+	}
+	if err := db.Where("id = ? AND state = ?", row.ID, stateActive).Delete(&task{}).Error; err != nil {
+		s.logger.Warn("⚠️ Failed to delete task %s: %v", row.ID, err)
+	}
+}
+
+// recoverTasks takes back the active tasks whose lease ran out, because the process running them
+// stopped, and trims archived tasks past their retention
+func (s *Server) recoverTasks() {
+	defer s.workers.Done()
+
+	ticker := time.NewTicker(recoverInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stopping:
+			return
+		case <-ticker.C:
+		}
+
+		db, err := s.queue.conn(context.Background())
+		if err != nil {
+			continue
+		}
+		now := time.Now()
+
+		var orphans []task
+		if err := db.Where("state = ? AND lease_until < ?", stateActive, now).Find(&orphans).Error; err != nil {
+			s.logger.Warn("⚠️ Failed to find orphaned tasks: %v", err)
+			continue
+		}
+		for i := range orphans {
+			row := &orphans[i]
+			updates := map[string]interface{}{
+				"lease_until":    nil,
+				"last_err":       "asynq: task lease expired",
+				"last_failed_at": now,
+			}
+			if row.Retried >= row.MaxRetry {
+				updates["state"] = stateArchived
+			} else {
+				updates["state"] = stateRetry
+				updates["retried"] = row.Retried + 1
+				updates["process_at"] = now.Add(s.config.RetryDelayFunc(row.Retried, asynq.ErrLeaseExpired, asynq.NewTask(row.Type, row.Payload)))
+			}
+			if err := db.Model(&task{}).Where("id = ? AND state = ? AND lease_until < ?", row.ID, stateActive, now).
+				Updates(updates).Error; err != nil {
+				s.logger.Warn("⚠️ Failed to recover task %s: %v", row.ID, err)
+			}
+		}
+
+		if err := db.Where("state = ? AND last_failed_at < ?", stateArchived, now.Add(-archiveRetention)).
+			Delete(&task{}).Error; err != nil {
+			s.logger.Warn("⚠️ Failed to trim archived tasks: %v", err)
+		}
+	}
+}
+
+type metadataKey struct{}
+
+// metadata is what asynq keeps in a running task's context
+type metadata struct {
+	id       string
+	queue    string
+	retried  int
+	maxRetry int
+}
+
+func getMetadata(ctx context.Context) (metadata, bool) {
+	md, ok := ctx.Value(metadataKey{}).(metadata)
+	return md, ok
+}
+
+// GetTaskID returns the ID of the task running on the context, as asynq.GetTaskID does
+func GetTaskID(ctx context.Context) (string, bool) {
+	md, ok := getMetadata(ctx)
+	return md.id, ok
+}
+
+// GetRetryCount returns how many times the running task was retried, as asynq.GetRetryCount does
+func GetRetryCount(ctx context.Context) (int, bool) {
+	md, ok := getMetadata(ctx)
+	return md.retried, ok
+}
+
+// GetMaxRetry returns how many times the running task may be retried, as asynq.GetMaxRetry does
+func GetMaxRetry(ctx context.Context) (int, bool) {
+	md, ok := getMetadata(ctx)
+	return md.maxRetry, ok
+}
+
+// GetQueueName returns the queue of the running task, as asynq.GetQueueName does
+func GetQueueName(ctx context.Context) (string, bool) {
+	md, ok := getMetadata(ctx)
+	return md.queue, ok
+}
@@ -0,0 +1,87 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+
+	"github.com/hibiken/asynq"
+
+	limiter "kori/internal/tasks/rate"
+)
+
+// ErrTeamBusy is returned by a task whose team already has as many tasks of its kind running
+// as it is allowed. The task goes back to the queue without counting as a failed attempt.
+var ErrTeamBusy = errors.New("team is at its in-flight limit")
+
+// Kinds of work capped per team
+const (
+	FairnessEmail    = "email"
+	FairnessCampaign = "campaign"
+)
+
+// How long tasks deferred for their team wait before they are tried again. Campaign runs take
+// minutes, so checking back on them every few seconds would only churn the queue.
+const (
+	teamBusyDelay         = 2 * time.Second
+	teamBusyCampaignDelay = 30 * time.Second
+	maintenanceDelay      = time.Minute // tasks held for maintenance
+)
+
+// acquireTeamSlot takes one of the team's in-flight slots for the running task. A team that
+// has them all gets ErrTeamBusy so its tasks can't hold every worker while other teams wait.
+func (h *TaskHandler) acquireTeamSlot(ctx context.Context, kind, teamID string) (func(), error) {
+	limit, lease := cfg.Worker.TeamEmailLimit, TimeoutMedium
+	if kind == FairnessCampaign {
+		limit, lease = cfg.Worker.TeamCampaignLimit, TimeoutLong
+	}
+
+	holder, ok := taskID(ctx)
+	if !ok || teamID == "" {
+		return func() {}, nil
+	}
+
+	semaphore := limiter.NewSemaphore(h.taskClient.redisClient, "team:"+kind, limit, lease)
+	acquired, err := semaphore.Acquire(ctx, teamID, holder)
+	if err != nil {
+		// Fairness is best effort; don't stop sending because Redis hiccuped
+		h.logger.Warn("⚠️ Failed to check in-flight limit of team %s: %v", teamID, err)
+		return func() {}, nil
+	}
+	if !acquired {
+		return nil, ErrTeamBusy
+	}
+
+	return func() {
+		if err := semaphore.Release(context.Background(), teamID, holder); err != nil {
+			h.logger.Warn("⚠️ Failed to release in-flight slot of team %s: %v", teamID, err)
+		}
+	}, nil
+}
+
+// isTaskFailure keeps tasks deferred for fairness, held for maintenance or handed back for a
+// newer worker from using up their retries
+func isTaskFailure(err error) bool {
+	return !errors.Is(err, ErrTeamBusy) && !errors.Is(err, ErrMaintenance) && !errors.Is(err, ErrNewerPayload)
+}
+
+// taskRetryDelay retries deferred tasks quickly, with jitter so a team's tasks don't come back
+// all at once, checks back on held tasks every minute or so, and retries everything else with
+// asynq's default backoff
+func taskRetryDelay(n int, err error, t *asynq.Task) time.Duration {
+	if errors.Is(err, ErrTeamBusy) {
+		delay := teamBusyDelay
+		if t.Type() == TaskTypeCampaignProcess {
+			delay = teamBusyCampaignDelay
+		}
+		return delay + time.Duration(rand.Int63n(int64(delay)))
+	}
+	if errors.Is(err, ErrMaintenance) {
+		return maintenanceDelay + time.Duration(rand.Int63n(int64(maintenanceDelay)))
+	}
+	if errors.Is(err, ErrNewerPayload) {
+		return newerPayloadRetryDelay()
+	}
+	return asynq.DefaultRetryDelayFunc(n, err, t)
+}
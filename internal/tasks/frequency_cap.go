@@ -0,0 +1,65 @@
+package tasks
+
+import (
+	"kori/internal/models"
+	"strings"
+	"time"
+)
+
+// applyFrequencyCaps holds back the campaign's emails to contacts over one of the team's
+// frequency caps. Skipped emails are kept, never sent, as the record of why their contact
+// wasn't mailed; deferred ones wait until the cap lets them through. It returns how many
+// emails were deferred.
+func (h *TaskHandler) applyFrequencyCaps(campaign *models.Campaign, emails []*models.Email) (int, error) {
+	// Emails already skipped, e.g. for the recipient's preferences, don't count
+	addresses := make([]string, 0, len(emails))
+	for _, email := range emails {
+		if email.Status != models.EmailStatusSkipped {
+			addresses = append(addresses, email.To)
+		}
+	}
+
+	capped, err := models.CheckFrequencyCaps(campaign.TeamID, addresses, true, time.Now(), h.db)
+	if err != nil {
+		return 0, h.logger.Error("❌ failed to check frequency caps: %w", err)
+	}
+	if len(capped) == 0 {
+		return 0, nil
+	}
+
+	skipped, deferred := 0, 0
+	for _, email := range emails {
+		recipient, ok := capped[strings.ToLower(email.To)]
+		if !ok || email.Status == models.EmailStatusSkipped {
+			continue
+		}
+		email.SkipReason = recipient.Reason
+		if !recipient.Deferred() {
+			email.Status = models.EmailStatusSkipped
+			skipped++
+			continue
+		}
+		if recipient.RetryAt.After(email.SendAt) {
+			email.SendAt = recipient.RetryAt
+		}
+		deferred++
+	}
+
+	h.logger.Info("🧢 Frequency caps skipped %d and deferred %d emails of campaign %s", skipped, deferred, campaign.ID)
+	return deferred, nil
+}
+
+// checkAutomationFrequencyCaps returns the cap the contact is over for an automation email of
+// the category, or nil when they may be mailed
+func (h *TaskHandler) checkAutomationFrequencyCaps(teamID, categoryID string, contact *models.Contact) (*models.CappedRecipient, error) {
+	category := &models.EmailCategory{}
+	if err := h.db.Select("marketing").Where("id = ?", categoryID).First(category).Error; err != nil {
+		return nil, err
+	}
+
+	capped, err := models.CheckFrequencyCaps(teamID, []string{contact.Email}, category.Marketing, time.Now(), h.db)
+	if err != nil {
+		return nil, err
+	}
+	return capped[strings.ToLower(contact.Email)], nil
+}
@@ -3,19 +3,28 @@ package tasks
 import (
 	"bytes"
 	"context"
-	"encoding/csv"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"kori/internal/config"
+	"kori/internal/events"
 	"kori/internal/models"
 	"kori/internal/utils"
 	"kori/internal/utils/base64"
 	"kori/internal/utils/logger"
+	"net/http"
+	"strings"
+	"time"
 
 	"gorm.io/gorm"
 
 	"maps"
 
+	"github.com/google/uuid"
 	"github.com/hibiken/asynq"
 )
 
@@ -46,7 +55,7 @@ func NewTaskHandler(db *gorm.DB) *TaskHandler {
 // HandleEmailSend processes an email sending task
 func (h *TaskHandler) HandleEmailSend(ctx context.Context, t *asynq.Task) error {
 	var task EmailTask
-	if err := json.Unmarshal(t.Payload(), &task); err != nil {
+	if err := decodeTask(t, &task); err != nil {
 		return fmt.Errorf("failed to unmarshal email task: %w", asynq.SkipRetry)
 	}
 
@@ -56,13 +65,91 @@ func (h *TaskHandler) HandleEmailSend(ctx context.Context, t *asynq.Task) error
 		return h.logger.Error("❌ failed to get email: %w", err)
 	}
 
+	if email.IsDeleted || email.Status == models.EmailStatusCancelled {
+		h.logger.Info("🛑 Email %s was cancelled", email.ID)
+		return nil
+	}
+
+	if email.Status == models.EmailStatusSkipped {
+		h.logger.Info("⏭️ Email %s was skipped: %s", email.ID, email.SkipReason)
+		return nil
+	}
+
+	// A campaign email waiting for its send time is released when the campaign is paused, so
+	// resuming the campaign schedules it again
+	if email.CampaignID != "" && email.Status == models.EmailStatusPending && models.IsCampaignHalted(email.CampaignID, h.db) {
+		if err := h.db.Model(&models.Email{}).Where("id = ?", email.ID).
+			Updates(map[string]interface{}{"is_deleted": true, "deleted_at": time.Now()}).Error; err != nil {
+			return h.logger.Error("❌ failed to release email: %w", err)
+		}
+		h.logger.Info("⏸️ Released email %s, campaign %s is halted", email.ID, email.CampaignID)
+		return nil
+	}
+
+	release, err := h.acquireTeamSlot(ctx, FairnessEmail, email.TeamID)
+	if err != nil {
+		h.logger.Info("⏳ Deferring email %s, team %s is at its in-flight limit", email.ID, email.TeamID)
+		return err
+	}
+	defer release()
+
 	h.logger.Info("📧 Processing email task ID: %s (Attempt: %d)", task.EmailID, task.AttemptNum)
 
+	// Record the attempt's time in queue for the pipeline SLA metrics. Set on the email too so
+	// saving it after the send doesn't write the old values back.
+	dequeuedAt := time.Now()
+	email.Queue, _ = queueName(ctx)
+	email.DequeuedAt = &dequeuedAt
+	email.QueuedAt = nil
+	if !task.EnqueuedAt.IsZero() {
+		email.QueuedAt = &task.EnqueuedAt
+	}
+	if err := h.db.Model(&models.Email{}).Where("id = ?", email.ID).Updates(map[string]interface{}{
+		"queue":       email.Queue,
+		"queued_at":   email.QueuedAt,
+		"dequeued_at": email.DequeuedAt,
+	}).Error; err != nil {
+		h.logger.Warn("⚠️ Failed to record queue time of email %s: %v", email.ID, err)
+	}
+
+	// Park the email while an operator has paused sending through its config; the retry
+	// sweep re-enqueues it once sending is resumed
+	if email.SMTPConfig != nil && email.SMTPConfig.SendingPaused {
+		if err := models.ParkEmails([]string{email.ID}, h.db); err != nil {
+			return h.logger.Error("❌ failed to park email: %w", err)
+		}
+		h.logger.Warn("🅿️ Parked email %s, sending through smtp config %s is paused", email.ID, email.SMTPConfigID)
+		return nil
+	}
+
+	// Don't spend an attempt on a server that is failing health checks; the retry sweep
+	// picks the email up once the config is healthy again
+	if email.SMTPConfig != nil && !email.SMTPConfig.IsHealthy {
+		next := time.Now()
+		if err := h.db.Model(&models.Email{}).Where("id = ?", email.ID).Updates(map[string]interface{}{
+			"status":        models.EmailStatusFailed,
+			"error":         "smtp config is unhealthy",
+			"error_class":   string(utils.SendErrorTransient),
+			"next_retry_at": &next,
+		}).Error; err != nil {
+			return h.logger.Error("❌ failed to hold email: %w", err)
+		}
+		h.logger.Warn("⏸️ Holding email %s until smtp config %s is healthy", email.ID, email.SMTPConfigID)
+		return nil
+	}
+
 	// Send email using SMTP handler
-	if err := h.mailHandler.SendEmail(email); err != nil {
+	err = h.mailHandler.SendEmail(email)
+	if email.CampaignID != "" {
+		if err := models.CompleteScheduledCampaign(email.CampaignID, h.db); err != nil {
+			h.logger.Warn("⚠️ Failed to complete campaign %s: %v", email.CampaignID, err)
+		}
+	}
+	if err != nil {
 		task.Error = err.Error()
 		task.AttemptNum++
-		return h.logger.Error("❌ failed to send email: %w", err)
+		// Failed sends are retried by the retry sweep according to their error class
+		return h.logger.Error("❌ failed to send email: %w", fmt.Errorf("%v: %w", err, asynq.SkipRetry))
 	}
 
 	h.logger.Success("✅ Email sent successfully")
@@ -80,10 +167,47 @@ func (h *TaskHandler) HandleEmailSend(ctx context.Context, t *asynq.Task) error
 	return nil
 }
 
+// handleCampaignBlackout applies the campaign's blackout policy to a recurring run.
+// It reports true when the run should not send now.
+func (h *TaskHandler) handleCampaignBlackout(ctx context.Context, campaign *models.Campaign, task CampaignTask) (bool, error) {
+	now := time.Now().In(campaign.CampaignLocation())
+	blackout, err := models.FindBlackout(campaign.TeamID, now, h.db)
+	if err != nil {
+		return false, h.logger.Error("❌ failed to check blackout dates: %w", err)
+	}
+	if blackout == nil {
+		return false, nil
+	}
+
+	if campaign.BlackoutPolicy != models.BlackoutPolicyShift {
+		h.logger.Info("⏭️ Skipping campaign %s run on blackout date %s (%s)",
+			campaign.ID, now.Format("2006-01-02"), blackout.Name)
+		return true, nil
+	}
+
+	next, err := models.NextAllowedSendTime(campaign.TeamID, now, h.db)
+	if err != nil {
+		return false, h.logger.Error("❌ failed to find next send date: %w", err)
+	}
+
+	if err := h.taskClient.EnqueueCampaignTask(ctx, CampaignTask{
+		CampaignID:  campaign.ID,
+		BatchSize:   task.BatchSize,
+		ScheduledAt: next,
+		ShiftedFrom: now.Format("2006-01-02"),
+	}, 0); err != nil {
+		return false, h.logger.Error("❌ failed to shift campaign run: %w", err)
+	}
+
+	h.logger.Info("📅 Shifted campaign %s run from blackout date %s (%s) to %s",
+		campaign.ID, now.Format("2006-01-02"), blackout.Name, next.Format(time.RFC3339))
+	return true, nil
+}
+
 // HandleCampaignProcess processes a campaign task
 func (h *TaskHandler) HandleCampaignProcess(ctx context.Context, t *asynq.Task) error {
 	var task CampaignTask
-	if err := json.Unmarshal(t.Payload(), &task); err != nil {
+	if err := decodeTask(t, &task); err != nil {
 		return fmt.Errorf("failed to unmarshal campaign task: %w", asynq.SkipRetry)
 	}
 
@@ -93,6 +217,10 @@ func (h *TaskHandler) HandleCampaignProcess(ctx context.Context, t *asynq.Task)
 	// Get campaign details
 	campaign, err := models.GetCampaignByID(task.CampaignID, h.db)
 	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			h.logger.Info("🗑️ Campaign %s was deleted", task.CampaignID)
+			return nil
+		}
 		return h.logger.Error("❌ failed to get campaign: %w", err)
 	}
 
@@ -101,6 +229,44 @@ func (h *TaskHandler) HandleCampaignProcess(ctx context.Context, t *asynq.Task)
 		return nil
 	}
 
+	if campaign.Status == models.CampaignStatusPaused {
+		h.logger.Info("⏸️ Campaign %s is paused", task.CampaignID)
+		return nil
+	}
+
+	if campaign.Status == models.CampaignStatusCancelled {
+		h.logger.Info("🛑 Campaign %s was cancelled", task.CampaignID)
+		return nil
+	}
+
+	if campaign.ABTestStatus == models.ABTestStatusTesting {
+		h.logger.Info("🧪 Campaign %s is waiting for its A/B test winner", task.CampaignID)
+		return nil
+	}
+
+	if campaign.SampleStatus == models.SampleStatusObserving {
+		h.logger.Info("🔬 Campaign %s is waiting for its sample to be checked", task.CampaignID)
+		return nil
+	}
+
+	release, err := h.acquireTeamSlot(ctx, FairnessCampaign, campaign.TeamID)
+	if err != nil {
+		h.logger.Info("⏳ Deferring campaign %s, team %s is at its in-flight limit", campaign.ID, campaign.TeamID)
+		return err
+	}
+	defer release()
+
+	// Recurring runs that land on a blackout date are skipped or moved to the next open day
+	if task.CronExpression != "" {
+		handled, err := h.handleCampaignBlackout(ctx, campaign, task)
+		if err != nil {
+			return err
+		}
+		if handled {
+			return nil
+		}
+	}
+
 	// update campaign status to sending
 	campaign.Status = models.CampaignStatusSending
 	if err := h.db.Save(campaign).Error; err != nil {
@@ -117,10 +283,18 @@ func (h *TaskHandler) HandleCampaignProcess(ctx context.Context, t *asynq.Task)
 		return h.logger.Error("❌ failed to get smtp config: %w", fmt.Errorf("smtp config is nil"))
 	}
 
-	// Get the campaign's email list
-	emailList, contactCount, err := models.GetEmailListByID(campaign.ListID, h.db)
+	if !smtpConfig.IsHealthy {
+		if err := h.db.Model(&models.Campaign{}).Where("id = ?", campaign.ID).Update("status", models.CampaignStatusPaused).Error; err != nil {
+			return h.logger.Error("❌ failed to pause campaign: %w", err)
+		}
+		h.logger.Warn("⏸️ Paused campaign %s, its smtp config %s is unhealthy", campaign.ID, smtpConfig.ID)
+		return nil
+	}
+
+	// Audience is the campaign's list, narrowed or replaced by its segment
+	audience, err := campaign.AudienceQuery(h.db)
 	if err != nil {
-		return h.logger.Error("❌ failed to get email list: %w", err)
+		return h.logger.Error("❌ failed to resolve campaign audience: %w", err)
 	}
 
 	// already processed contacts
@@ -135,11 +309,35 @@ func (h *TaskHandler) HandleCampaignProcess(ctx context.Context, t *asynq.Task)
 	}
 
 	// Get contacts for this batch, ordered by last email sent date
+	var contactCount int64
+	if err := audience.Session(&gorm.Session{}).Count(&contactCount).Error; err != nil {
+		return h.logger.Error("❌ failed to count audience: %w", err)
+	}
+
+	// Recipients of the campaign's exclusion lists, segments and campaigns are left out
+	exclusions, err := models.GetCampaignExclusions(campaign.ID, h.db)
+	if err != nil {
+		return h.logger.Error("❌ failed to get campaign exclusions: %w", err)
+	}
+	var excludedCount int64
+	if len(exclusions) > 0 {
+		if audience, err = campaign.ApplyExclusions(audience, exclusions, h.db); err != nil {
+			return h.logger.Error("❌ failed to apply campaign exclusions: %w", err)
+		}
+		var remaining int64
+		if err := audience.Session(&gorm.Session{}).Count(&remaining).Error; err != nil {
+			return h.logger.Error("❌ failed to count audience: %w", err)
+		}
+		excludedCount = contactCount - remaining
+		h.logger.Info("🚫 Excluded %d of %d contacts from campaign %s", excludedCount, contactCount, campaign.ID)
+	}
+
+	// Only ACTIVE contacts are mailed, which leaves out those yet to confirm a double opt-in list
 	var contacts []models.Contact
-	query := h.db.Table("contacts").
+	query := audience.
 		Select("contacts.*").
 		Joins("LEFT JOIN emails ON emails.contact_id = contacts.id AND emails.campaign_id = ?", campaign.ID).
-		Where("contacts.list_id = ? AND contacts.status = ?", emailList.ID, models.SubscriberStatusActive).
+		Where("contacts.status = ?", models.SubscriberStatusActive).
 		Where("contacts.status != ?", models.SubscriberStatusUnsubscribed)
 
 	if len(alreadyProcessedContacts) > 0 {
@@ -148,12 +346,30 @@ func (h *TaskHandler) HandleCampaignProcess(ctx context.Context, t *asynq.Task)
 
 	if err := query.Group("contacts.id").
 		Order("MAX(emails.sent_at) ASC NULLS FIRST"). // Contacts with no emails come first
-		Offset(campaign.Processed).
-		Limit(contactCount).
+		Limit(int(contactCount)).
 		Find(&contacts).Error; err != nil {
 		return h.logger.Error("❌ failed to get contacts: %w", err)
 	}
 
+	// A segment can span lists, so make sure an address is only mailed once
+	seenEmails := make(map[string]bool, len(contacts))
+	uniqueContacts := contacts[:0]
+	for _, contact := range contacts {
+		key := strings.ToLower(contact.Email)
+		if seenEmails[key] {
+			continue
+		}
+		seenEmails[key] = true
+		uniqueContacts = append(uniqueContacts, contact)
+	}
+	contacts = uniqueContacts
+
+	// Let the team's own model exclude and prioritise contacts
+	contacts, err = h.scoreContacts(ctx, campaign, contacts)
+	if err != nil {
+		return err
+	}
+
 	// If no contacts in this batch, we're done
 	if len(contacts) == 0 {
 		h.logger.Info("✅ No more contacts to process for campaign %s", campaign.ID)
@@ -164,37 +380,110 @@ func (h *TaskHandler) HandleCampaignProcess(ctx context.Context, t *asynq.Task)
 		return nil
 	}
 
+	variants, err := models.GetCampaignVariants(campaign.ID, h.db)
+	if err != nil {
+		return h.logger.Error("❌ failed to get campaign variants: %w", err)
+	}
+
+	// With variants, only the test portion is mailed now and the rest waits for the winner
+	contacts, assigned, testing := assignVariants(campaign, variants, contacts)
+
+	// Sent to a sample first, only the sample is mailed now and the rest waits until it's checked
+	sampling := campaign.SamplesFirst()
+	if sampling {
+		contacts = pickSample(campaign, contacts)
+	}
+
+	languages, err := models.GetCampaignLanguages(campaign.ID, h.db)
+	if err != nil {
+		return h.logger.Error("❌ failed to get campaign languages: %w", err)
+	}
+
 	// Get HTML content outside transaction since it's an external operation
-	htmlFromTemplate, err := utils.GetHTMLFromURL(campaign.Template.HtmlFile.SignedURL)
+	keys := make([]campaignContentKey, len(contacts))
+	contents := make(map[campaignContentKey]*campaignContent)
+	for i, contact := range contacts {
+		if len(assigned) > 0 {
+			keys[i].variant = assigned[i]
+		}
+		keys[i].language = models.PickCampaignLanguage(languages, contact.Locale)
+		if _, ok := contents[keys[i]]; ok {
+			continue
+		}
+		content, err := loadCampaignContent(campaign, keys[i].variant, keys[i].language)
+		if err != nil {
+			return h.logger.Error("❌ failed to get html from template: %w", err)
+		}
+		contents[keys[i]] = content
+	}
+
+	// Shared snippets are included first, as they may hold content blocks
+	for _, content := range contents {
+		rendered, err := models.RenderSnippets(campaign.TeamID, []string{content.html}, h.db)
+		if err != nil {
+			return h.logger.Error("❌ failed to render snippets: %w", err)
+		}
+		content.html = rendered[0]
+	}
+
+	// Dynamic content blocks are chosen per contact
+	htmls := make([]string, 0, len(contents))
+	for _, content := range contents {
+		htmls = append(htmls, content.html)
+	}
+	contactIDs := make([]string, len(contacts))
+	for i, contact := range contacts {
+		contactIDs[i] = contact.ID
+	}
+	blocks, err := models.NewContentBlockRenderer(campaign.TeamID, htmls, contactIDs, h.db)
 	if err != nil {
-		return h.logger.Error("❌ failed to get html from template: %w", err)
+		return h.logger.Error("❌ failed to load content blocks: %w", err)
+	}
+
+	// Computed fields are worked out for everyone at once, as of this run
+	computed, err := models.ComputeContactFields(campaign.TeamID, contactIDs, h.db)
+	if err != nil {
+		return h.logger.Error("❌ failed to compute contact fields: %w", err)
+	}
+
+	// Links are registered once per campaign and reused by every email linking to them
+	links := models.NewLinkRegistry(campaign.TeamID, campaign.ID, h.db)
+
+	personas, err := models.GetSenderPersonas(campaign.TeamID, campaign.SenderPersonaIDs, h.db)
+	if err != nil {
+		return h.logger.Error("❌ failed to get sender personas: %w", err)
 	}
 
 	// Create emails for each contact
 	emails := make([]*models.Email, len(contacts))
 	for i, contact := range contacts {
+		content := contents[keys[i]]
+
 		// default variables
-		defaultVariables := make(map[string]string)
-		defaultVariables["email"] = contact.Email
-		defaultVariables["first_name"] = contact.FirstName
-		defaultVariables["last_name"] = contact.LastName
-		defaultVariables["company"] = contact.Company
-		defaultVariables["country"] = contact.Country
-		defaultVariables["city"] = contact.City
-		defaultVariables["state"] = contact.State
-		defaultVariables["zip"] = contact.Zip
-		defaultVariables["address"] = contact.Address
-		defaultVariables["phone"] = contact.Phone
-		defaultVariables["linkedin"] = contact.LinkedIn
-		defaultVariables["twitter"] = contact.Twitter
-		defaultVariables["facebook"] = contact.Facebook
-		defaultVariables["instagram"] = contact.Instagram
+		defaultVariables := contact.TemplateVariables()
 
 		variables := make(map[string]string)
 		maps.Copy(variables, defaultVariables)
+		maps.Copy(variables, computed[contact.ID])
 
-		parsedBody := utils.ReplaceVariables(htmlFromTemplate, variables, campaign.ID, cfg, true)
-		parsedSubject := utils.ReplaceVariables(campaign.Template.Subject, variables, campaign.ID, cfg, false)
+		// Pre-assign the email ID so tracking links resolve to this email and contact
+		emailID := uuid.New().String()
+		preferencesURL, err := utils.PreferencesURL(emailID, cfg)
+		if err != nil {
+			return h.logger.Error("❌ failed to build preferences url: %w", err)
+		}
+		variables["preferences_url"] = preferencesURL
+
+		html, picked := blocks.Render(content.html, &contact)
+		contentVariants, err := json.Marshal(picked)
+		if err != nil {
+			return h.logger.Error("❌ failed to encode content variants: %w", err)
+		}
+
+		withPreheader, variables := utils.WithPreheader(html, content.preheader, variables)
+		parsedText := utils.PlainTextBody(content.plainText, html, variables)
+		parsedBody := utils.ReplaceVariablesWithLinks(withPreheader, variables, emailID, cfg, links)
+		parsedSubject := utils.ReplaceVariables(content.subject, variables, campaign.ID, cfg, false)
 
 		parsedSubject, err = base64.DecodeFromBase64(parsedSubject)
 		if err != nil {
@@ -208,37 +497,138 @@ func (h *TaskHandler) HandleCampaignProcess(ctx context.Context, t *asynq.Task)
 		}
 
 		email := &models.Email{
-			From:         smtpConfig.FromEmail,
-			To:           contact.Email,
-			Subject:      parsedSubject,
-			Body:         parsedBody,
-			Data:         jsonData,
-			Status:       models.EmailStatusPending,
-			TeamID:       campaign.TeamID,
-			TemplateID:   campaign.TemplateID,
-			ContactID:    contact.ID,
-			SMTPConfigID: smtpConfig.ID,
-			CategoryID:   campaign.Template.CategoryID,
-			CampaignID:   campaign.ID,
+			From:            smtpConfig.FromEmail,
+			FromName:        content.fromName,
+			To:              contact.Email,
+			Subject:         parsedSubject,
+			Body:            parsedBody,
+			PlainText:       parsedText,
+			Data:            jsonData,
+			Status:          models.EmailStatusPending,
+			TeamID:          campaign.TeamID,
+			TemplateID:      content.templateID,
+			ContactID:       contact.ID,
+			SMTPConfigID:    smtpConfig.ID,
+			CategoryID:      content.categoryID,
+			CampaignID:      campaign.ID,
+			VariantID:       content.variantID,
+			ContentVariants: contentVariants,
+			Language:        content.language,
+		}
+		email.ID = emailID
+		if persona := models.PickSenderPersona(personas, contact.Email); persona != nil {
+			persona.ApplyTo(email)
 		}
 		emails[i] = email
 	}
 
-	// Save all emails in a transaction
+	// Smart send and local send times mail each contact at their own time instead of in one run
+	if campaign.SendsPerRecipient() {
+		if err := h.scheduleSendTimes(campaign, contacts, emails); err != nil {
+			return err
+		}
+	}
+
+	// Recipients who opted out of the email's category in the preference center are skipped
+	if err := h.applyCategoryPreferences(campaign, emails); err != nil {
+		return err
+	}
+
+	// Contacts over one of the team's frequency caps are skipped, or mailed once the cap lets them through
+	deferred, err := h.applyFrequencyCaps(campaign, emails)
+	if err != nil {
+		return err
+	}
+
+	// The run's sends come out of the team's monthly quota, and the campaign pauses when it can't take them
+	refund, charged, err := h.chargeCampaignQuota(campaign, len(alreadyProcessedEmails) == 0 && !task.Remainder, emails)
+	if err != nil || !charged {
+		return err
+	}
+
+	// Save all emails in a transaction, along with the snapshot of who this run is sent to
 	if err := h.db.Transaction(func(tx *gorm.DB) error {
 		for _, email := range emails {
 			if err := tx.Create(email).Error; err != nil {
 				return err
 			}
 		}
-		return nil
+		_, err := models.RecordCampaignSnapshot(campaign, int(contactCount), int(excludedCount), contactIDs, task.Remainder, tx)
+		return err
 	}); err != nil {
+		refund()
 		return h.logger.Error("❌ failed to create emails: %w", err)
 	}
 
-	h.mailHandler.SendCampaignEmails(emails, task.BatchSize, campaign.BatchDelay, smtpConfig)
+	// Emails with a send time of their own are enqueued for it, the rest sent in batches now
+	var scheduled, batch []*models.Email
+	for _, email := range emails {
+		switch {
+		case email.Status == models.EmailStatusSkipped:
+		case campaign.SendsPerRecipient() || email.SkipReason != "":
+			scheduled = append(scheduled, email)
+		default:
+			batch = append(batch, email)
+		}
+	}
+
+	// While an operator has paused sending through the config the run's emails are parked
+	// rather than sent; the retry sweep sends them once sending is resumed
+	if smtpConfig.SendingPaused {
+		emailIDs := make([]string, 0, len(scheduled)+len(batch))
+		for _, email := range append(scheduled, batch...) {
+			emailIDs = append(emailIDs, email.ID)
+		}
+		if err := models.ParkEmails(emailIDs, h.db); err != nil {
+			return h.logger.Error("❌ failed to park emails: %w", err)
+		}
+		h.logger.Warn("🅿️ Parked %d emails of campaign %s, sending through smtp config %s is paused", len(emailIDs), campaign.ID, smtpConfig.ID)
+	} else {
+		h.enqueueScheduledEmails(ctx, scheduled, smtpConfig)
+		if len(batch) > 0 {
+			h.mailHandler.SendCampaignEmails(batch, task.BatchSize, campaign.BatchDelay, smtpConfig)
+		}
+	}
+
+	// A paused or cancelled campaign keeps its status; unsent emails are released so resuming picks those contacts up again
+	if models.IsCampaignHalted(campaign.ID, h.db) {
+		if models.IsCampaignStopped(campaign.ID, h.db) {
+			cancelled, err := models.CancelCampaignEmails(campaign.ID, h.db)
+			if err != nil {
+				return h.logger.Error("❌ failed to cancel unsent emails: %w", err)
+			}
+			h.logger.Warn("🛑 Campaign %s stopped with %d emails cancelled", campaign.ID, cancelled)
+			return nil
+		}
+		released := h.db.Model(&models.Email{}).
+			Where("campaign_id = ? AND status = ? AND is_deleted = false", campaign.ID, models.EmailStatusPending).
+			Updates(map[string]interface{}{"is_deleted": true, "deleted_at": time.Now()})
+		if released.Error != nil {
+			return h.logger.Error("❌ failed to release unsent emails: %w", released.Error)
+		}
+		h.logger.Warn("⏸️ Campaign %s halted with %d emails unsent", campaign.ID, released.RowsAffected)
+		return nil
+	}
+
+	if testing {
+		return h.startABTest(ctx, campaign, len(contacts))
+	}
+
+	if sampling {
+		return h.startSample(ctx, campaign, len(contacts))
+	}
 
-	campaign.Processed += contactCount
+	if campaign.SendsPerRecipient() || deferred > 0 {
+		// The campaign stays sending until the last of its scheduled emails has gone out
+		if err := h.db.Model(&models.Campaign{}).Where("id = ?", campaign.ID).
+			Update("processed", gorm.Expr("processed + ?", len(contacts))).Error; err != nil {
+			return h.logger.Error("❌ failed to update campaign processed: %w", err)
+		}
+		h.logger.Success("✅ Scheduled %d emails of campaign %s", len(emails), campaign.ID)
+		return nil
+	}
+
+	campaign.Processed += len(contacts)
 	campaign.Status = models.CampaignStatusCompleted
 	if err := h.db.Save(campaign).Error; err != nil {
 		return h.logger.Error("❌ failed to update campaign processed: %w", err)
@@ -262,197 +652,220 @@ func (h *TaskHandler) HandleCampaignProcess(ctx context.Context, t *asynq.Task)
 // HandleWebhookDelivery processes a webhook delivery task
 func (h *TaskHandler) HandleWebhookDelivery(ctx context.Context, t *asynq.Task) error {
 	var task WebhookDeliveryTask
-	if err := json.Unmarshal(t.Payload(), &task); err != nil {
+	if err := decodeTask(t, &task); err != nil {
 		return fmt.Errorf("failed to unmarshal webhook task: %w", asynq.SkipRetry)
 	}
 
 	h.logger.Info("processing webhook task %s with event %s and attempt %d", task.WebhookID, task.Event, task.AttemptNum)
 
-	// TODO: Implement webhook delivery logic
-	return nil
-}
-
-// HandleDomainVerification processes a domain verification task
-func (h *TaskHandler) HandleDomainVerification(ctx context.Context, t *asynq.Task) error {
-	var task DomainVerificationTask
-	if err := json.Unmarshal(t.Payload(), &task); err != nil {
-		return fmt.Errorf("failed to unmarshal domain verification task: %w", asynq.SkipRetry)
+	webhook := &models.Webhook{}
+	if err := h.db.Where("id = ? AND is_deleted = false", task.WebhookID).First(webhook).Error; err != nil {
+		return h.logger.Error("❌ failed to get webhook: %w", err)
 	}
 
-	h.logger.Info("processing domain verification task %s", task.DomainID)
-
-	// TODO: Implement domain verification logic
-	return nil
-}
+	if !webhook.IsActive {
+		h.logger.Warn("⚠️ Webhook %s is inactive, skipping delivery", webhook.ID)
+		return nil
+	}
 
-// HandleContactImport processes a contact import task
-func (h *TaskHandler) HandleContactImport(ctx context.Context, t *asynq.Task) error {
-	h.logger.Info("🚀 Starting contact import task")
+	body, err := json.Marshal(map[string]interface{}{
+		"event":     task.Event,
+		"payload":   task.Payload,
+		"timestamp": time.Now().UTC(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal webhook body: %w", asynq.SkipRetry)
+	}
 
-	var task ContactImportTask
-	if err := json.Unmarshal(t.Payload(), &task); err != nil {
-		return h.logger.Error("❌ failed to unmarshal contact import task: %w", asynq.SkipRetry)
+	delivery := &models.Delivery{
+		WebhookID: webhook.ID,
+		Event:     task.Event,
+		Payload:   body,
+		Status:    "PENDING",
 	}
 
-	h.logger.Info("📥 Processing contact import task %s", task.ImportID)
+	// Sign the body so receivers can verify it came from us
+	mac := hmac.New(sha256.New, []byte(webhook.Secret))
+	mac.Write(body)
+	signature := hex.EncodeToString(mac.Sum(nil))
 
-	// get the contact import from the database
-	contact_import, err := models.GetContactImportByID(task.ImportID, h.db)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
 	if err != nil {
-		return h.logger.Error("❌ failed to get contact import: %w", err)
+		return fmt.Errorf("failed to build webhook request: %w", asynq.SkipRetry)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Posthoot-Event", task.Event)
+	req.Header.Set("X-Posthoot-Signature", signature)
+
+	// Webhook URLs are the team's, so they're only delivered to public addresses
+	client := utils.NewSafeHTTPClient(10 * time.Second)
+	resp, deliveryErr := client.Do(req)
+	if deliveryErr == nil {
+		defer resp.Body.Close()
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		delivery.ResponseCode = resp.StatusCode
+		delivery.ResponseBody = string(respBody)
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			deliveryErr = fmt.Errorf("webhook returned status code %d", resp.StatusCode)
+		}
 	}
-	h.logger.Info("📋 Found contact import record: %v", contact_import)
 
-	// get the file from the database
-	file, err := models.GetFileByID(contact_import.FileID, h.db)
-	if err != nil {
-		return h.logger.Error("❌ failed to get file: %w", err)
+	if deliveryErr != nil {
+		delivery.Status = "FAILED"
+		delivery.Error = deliveryErr.Error()
+	} else {
+		delivery.Status = "SUCCESS"
 	}
-	h.logger.Info("📁 Found file record: %v", file)
 
-	// we need to download the file from the storage provider
-	h.logger.Info("⬇️ Downloading file from: %s", file.SignedURL)
-	fileContent, err := h.storageHandler.DownloadFile(file.SignedURL)
-	if err != nil {
-		contact_import.Status = models.ContactImportStatusFailed
-		if err := h.db.Save(contact_import).Error; err != nil {
-			return h.logger.Error("❌ failed to update contact import status: %w", err)
-		}
-		return h.logger.Error("❌ failed to download file: %w", err)
+	if err := h.db.Create(delivery).Error; err != nil {
+		h.logger.Warn("⚠️ failed to record webhook delivery: %v", err)
 	}
-	h.logger.Info("✅ File downloaded successfully")
 
-	// now we need to get the file content
-	fileData := bytes.NewReader(fileContent)
+	if deliveryErr != nil {
+		return h.logger.Error("❌ failed to deliver webhook: %w", deliveryErr)
+	}
 
-	// we need to parse the file content
-	reader := csv.NewReader(fileData)
-	reader.Comma = ','
-	reader.LazyQuotes = true
-	reader.TrimLeadingSpace = true
+	h.logger.Success("✅ Webhook %s delivered for event %s", webhook.ID, task.Event)
+	return nil
+}
 
-	// now we need to parse the file content
-	records, err := reader.ReadAll()
-	if err != nil {
-		contact_import.Status = models.ContactImportStatusFailed
-		if err := h.db.Save(contact_import).Error; err != nil {
-			return h.logger.Error("❌ failed to update contact import status: %w", err)
-		}
-		return h.logger.Error("❌ failed to read file: %w", err)
+// HandleDomainVerification processes a domain verification task
+func (h *TaskHandler) HandleDomainVerification(ctx context.Context, t *asynq.Task) error {
+	var task DomainVerificationTask
+	if err := decodeTask(t, &task); err != nil {
+		return fmt.Errorf("failed to unmarshal domain verification task: %w", asynq.SkipRetry)
 	}
 
-	// Skip header row
-	if len(records) <= 1 {
-		contact_import.Status = models.ContactImportStatusFailed
-		if err := h.db.Save(contact_import).Error; err != nil {
-			return h.logger.Error("❌ failed to update contact import status: %w", err)
+	// The scheduled check has no domain and re-verifies every domain
+	if task.DomainID == "" {
+		var domains []models.Domain
+		if err := h.db.Where("is_deleted = false").Find(&domains).Error; err != nil {
+			return h.logger.Error("❌ failed to get domains: %w", err)
+		}
+		h.logger.Info("🌐 Re-verifying %d domains", len(domains))
+		for i := range domains {
+			h.verifyDomain(ctx, &domains[i])
 		}
-		return h.logger.Error("❌ file has no data rows", fmt.Errorf("no data rows in file"))
+		return nil
 	}
 
-	h.logger.Info("📋 Records: %v", records)
+	h.logger.Info("processing domain verification task %s", task.DomainID)
 
-	fieldsMap, err := utils.JSONToMap(contact_import.FieldsMap)
+	domain, err := models.GetDomainByID(task.DomainID, h.db)
 	if err != nil {
-		contact_import.Status = models.ContactImportStatusFailed
-		if err := h.db.Save(contact_import).Error; err != nil {
-			return h.logger.Error("❌ failed to update contact import status: %w", err)
-		}
-		return h.logger.Error("❌ failed to parse fields map from json: %w", err)
+		return h.logger.Error("❌ failed to get domain: %w", err)
 	}
+	h.verifyDomain(ctx, domain)
+	return nil
+}
 
-	h.logger.Info("📋 Fields map: %v", fieldsMap)
-
-	// contacts to create
-	var contacts []models.Contact
-
-	// Process each record (skipping header)
-	for _, record := range records[1:] {
-		// Create a map of field values from the record
-		recordMap := make(map[string]string)
-		headers := records[0]
+// verifyDomain checks a domain's DNS records and logs the outcome
+func (h *TaskHandler) verifyDomain(ctx context.Context, domain *models.Domain) {
+	wasVerified := domain.IsVerified
+	if err := utils.RunDomainVerification(ctx, h.db, domain, cfg.Domain.SPFInclude); err != nil {
+		h.logger.Error("❌ failed to verify domain: %w", err)
+		return
+	}
 
-		for j, value := range record {
-			if j < len(headers) {
-				recordMap[headers[j]] = value
-			}
-		}
+	switch {
+	case domain.IsVerified:
+		h.logger.Success("✅ Domain %s verified", domain.Domain)
+	case wasVerified:
+		h.logger.Warn("⚠️ Domain %s lost verification (ownership %s, spf %s, dkim %s)",
+			domain.Domain, domain.OwnershipStatus, domain.SPFStatus, domain.DKIMStatus)
+	default:
+		h.logger.Info("🌐 Domain %s not verified yet (ownership %s, spf %s, dkim %s)",
+			domain.Domain, domain.OwnershipStatus, domain.SPFStatus, domain.DKIMStatus)
+	}
+}
 
-		// Map fields according to the fieldsMap
-		contact := models.Contact{
-			TeamID:   contact_import.TeamID,
-			ListID:   contact_import.ListID,
-			ImportID: contact_import.ID,
-		}
+// applyContactFields maps the known contact columns using the given lookup
+func applyContactFields(contact *models.Contact, getFieldValue func(string) string) {
+	contact.Email = getFieldValue("email")
+	contact.FirstName = getFieldValue("first_name")
+	contact.LastName = getFieldValue("last_name")
+	contact.LinkedIn = getFieldValue("linkedin")
+	contact.Twitter = getFieldValue("twitter")
+	contact.Facebook = getFieldValue("facebook")
+	contact.Instagram = getFieldValue("instagram")
+	contact.Country = getFieldValue("country")
+	contact.Phone = getFieldValue("phone")
+	contact.City = getFieldValue("city")
+	contact.State = getFieldValue("state")
+	contact.Zip = getFieldValue("zip")
+	contact.Address = getFieldValue("address")
+	contact.Company = getFieldValue("company")
+	contact.Locale = getFieldValue("locale")
+	contact.Timezone = getFieldValue("timezone")
+}
 
-		// Create reverse mapping (database fields to CSV fields)
-		var reverseMap = make(map[string]string)
-		for k, v := range fieldsMap {
-			reverseMap[v] = k
-		}
+// HandleContactDedupe triggers merging the contacts repeated within a list
+func (h *TaskHandler) HandleContactDedupe(ctx context.Context, t *asynq.Task) error {
+	h.logger.Info("🧹 Deduplicating contacts")
+	events.Emit("contacts.dedupe", time.Now().UTC())
+	return nil
+}
 
-		// Helper function to get the CSV field name from database field
-		getFieldValue := func(dbField string) string {
-			// Check if the database field exists in reverse mapping
-			if csvField, exists := reverseMap[dbField]; exists {
-				return recordMap[csvField]
-			}
-			return ""
-		}
-
-		// Map all fields using the helper function
-		contact.Email = getFieldValue("email")
-		contact.FirstName = getFieldValue("first_name")
-		contact.LastName = getFieldValue("last_name")
-		contact.LinkedIn = getFieldValue("linkedin")
-		contact.Twitter = getFieldValue("twitter")
-		contact.Facebook = getFieldValue("facebook")
-		contact.Instagram = getFieldValue("instagram")
-		contact.Country = getFieldValue("country")
-		contact.Phone = getFieldValue("phone")
-		contact.City = getFieldValue("city")
-		contact.State = getFieldValue("state")
-		contact.Zip = getFieldValue("zip")
-		contact.Address = getFieldValue("address")
-		contact.Company = getFieldValue("company")
-
-		// Store all fields in metadata
-		contact.Metadata, err = utils.MapToJSON(recordMap)
-		if err != nil {
-			return h.logger.Error("❌ failed to convert record map to json: %w", err)
-		}
+// HandleQuotaDigest triggers the daily quota digest for team admins
+func (h *TaskHandler) HandleQuotaDigest(ctx context.Context, t *asynq.Task) error {
+	h.logger.Info("📊 Running daily quota digest")
+	events.Emit("quota.digest", time.Now().UTC())
+	return nil
+}
 
-		contacts = append(contacts, contact)
+// HandleAnalyticsReports triggers recording the reports of the month that just ended
+func (h *TaskHandler) HandleAnalyticsReports(ctx context.Context, t *asynq.Task) error {
+	h.logger.Info("📈 Recording monthly analytics reports")
+	events.Emit("analytics_reports.record", time.Now().UTC())
+	return nil
+}
 
-		h.logger.Info("processing record %v", contact)
+// HandleAnalyticsRollup materializes the hourly and daily analytics rollups up to the current hour
+func (h *TaskHandler) HandleAnalyticsRollup(ctx context.Context, t *asynq.Task) error {
+	through, err := models.MaterializeAnalyticsRollups(time.Now(), h.db.WithContext(ctx))
+	if err != nil {
+		return h.logger.Error("❌ failed to materialize analytics rollups: %w", err)
 	}
+	h.logger.Info("📈 Rolled up analytics through %s", through.Format(time.RFC3339))
+	return nil
+}
 
-	// save the contacts
-	if err := h.db.CreateInBatches(&contacts, 100).Error; err != nil {
-		contact_import.Status = models.ContactImportStatusFailed
-		if err := h.db.Save(contact_import).Error; err != nil {
-			return h.logger.Error("❌ failed to update contact import status: %w", err)
-		}
-		return h.logger.Error("❌ failed to create contacts: %w", err)
+// HandleTrackingRetention prunes the raw tracking events older than each team's retention,
+// keeping those the rollups haven't aggregated yet
+func (h *TaskHandler) HandleTrackingRetention(ctx context.Context, t *asynq.Task) error {
+	db := h.db.WithContext(ctx)
+	watermark, err := models.GetRollupWatermark(db)
+	if err != nil {
+		return h.logger.Error("❌ failed to get rollup watermark: %w", err)
+	}
+	if watermark.IsZero() {
+		h.logger.Info("📈 Analytics haven't been rolled up yet, so no tracking is pruned")
+		return nil
 	}
 
-	contact_import.Status = models.ContactImportStatusCompleted
-	if err := h.db.Save(contact_import).Error; err != nil {
-		return h.logger.Error("❌ failed to update contact import status: %w", err)
+	var settings []models.TeamSettings
+	if err := db.Where("tracking_retention_days > 0 AND is_deleted = false").Find(&settings).Error; err != nil {
+		return h.logger.Error("❌ failed to get retention settings: %w", err)
 	}
 
+	now := time.Now()
+	for _, team := range settings {
+		cutoff := models.TrackingPruneCutoff(team.TrackingRetentionDays, watermark, now)
+		pruned, err := models.PruneTrackingEvents(team.TeamID, cutoff, db)
+		if err != nil {
+			h.logger.Error("❌ failed to prune tracking events: %w", err)
+			continue
+		}
+		if pruned > 0 {
+			h.logger.Info("🧹 Pruned %d tracking events before %s of team %s", pruned, cutoff.Format(time.RFC3339), team.TeamID)
+		}
+	}
 	return nil
 }
 
-// HandleLLMEmailWriter processes an LLM email writer task
-func (h *TaskHandler) HandleLLMEmailWriter(ctx context.Context, t *asynq.Task) error {
-	var task LLMEmailWriterTask
-	if err := json.Unmarshal(t.Payload(), &task); err != nil {
-		return fmt.Errorf("failed to unmarshal LLM email writer task: %w", asynq.SkipRetry)
-	}
-
-	h.logger.Info("processing LLM email writer task %s with template %s and model %s and attempt %d", task.EmailID, task.TemplateID, task.ModelID, task.AttemptNum)
-
-	// TODO: Implement LLM email generation logic
+// HandleCampaignAlerts triggers evaluation of campaign alert rules
+func (h *TaskHandler) HandleCampaignAlerts(ctx context.Context, t *asynq.Task) error {
+	h.logger.Debug("🚨 Evaluating campaign alert rules")
+	events.Emit("campaign_alerts.evaluate", time.Now().UTC())
 	return nil
 }
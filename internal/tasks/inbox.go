@@ -0,0 +1,344 @@
+package tasks
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"kori/internal/events"
+	"kori/internal/models"
+	"kori/internal/utils"
+	"net/mail"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+	"github.com/hibiken/asynq"
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// maxInboxMessagesPerSync caps how many new messages are synced from a folder per run
+	maxInboxMessagesPerSync = 500
+	// inboxBackfill is how many of a folder's newest messages its first sync starts from
+	inboxBackfill = 1000
+	// maxInboxBodySize caps the text and HTML kept of a message body
+	maxInboxBodySize = 64 << 10
+	// inboxSnippetLength is how much of the body is shown in message lists
+	inboxSnippetLength = 200
+)
+
+// HandleInboxSync syncs the new messages and read state of the mailboxes with inbox sync on
+func (h *TaskHandler) HandleInboxSync(ctx context.Context, t *asynq.Task) error {
+	var configs []models.IMAPConfig
+	if err := h.db.Where("inbox_sync = true AND is_active = true AND is_deleted = false").Find(&configs).Error; err != nil {
+		return h.logger.Error("❌ failed to get inbox mailboxes: %w", err)
+	}
+
+	for i := range configs {
+		synced, err := h.syncInbox(ctx, &configs[i])
+		if err != nil {
+			h.logger.Error("❌ failed to sync inbox: %w", err)
+			continue
+		}
+		if synced > 0 {
+			h.logger.Info("📥 Synced %d inbox messages for mailbox %s", synced, configs[i].Username)
+		}
+	}
+
+	return nil
+}
+
+// syncInbox syncs each of a mailbox's inbox folders
+func (h *TaskHandler) syncInbox(ctx context.Context, config *models.IMAPConfig) (int, error) {
+	im, err := dialIMAP(config)
+	if err != nil {
+		return 0, err
+	}
+	defer im.Logout()
+
+	folders := config.InboxFolders
+	if len(folders) == 0 {
+		folders = []string{"INBOX"}
+	}
+
+	synced := 0
+	for _, folder := range folders {
+		count, err := h.syncInboxFolder(ctx, im, config, folder)
+		synced += count
+		if err != nil {
+			return synced, fmt.Errorf("failed to sync %s of %s: %w", folder, config.Username, err)
+		}
+	}
+	return synced, h.threadInboxMessages(ctx, config)
+}
+
+// threadInboxMessages adds the mailbox's messages synced before conversations to theirs
+func (h *TaskHandler) threadInboxMessages(ctx context.Context, config *models.IMAPConfig) error {
+	var messages []models.InboxMessage
+	if err := h.db.WithContext(ctx).Omit("body_text", "body_html", "search_vector").
+		Where("imap_config_id = ? AND conversation_id IS NULL AND is_deleted = false", config.ID).
+		Order("date ASC").Limit(maxInboxMessagesPerSync).
+		Find(&messages).Error; err != nil {
+		return fmt.Errorf("failed to get messages without conversation: %w", err)
+	}
+	for i := range messages {
+		if err := h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			return models.ThreadInboxMessage(&messages[i], config.Username, tx)
+		}); err != nil {
+			return fmt.Errorf("failed to thread message %s: %w", messages[i].ID, err)
+		}
+	}
+	return nil
+}
+
+// syncInboxFolder stores the folder's messages newer than the last synced UID in their
+// conversations, drops the ones expunged since and refreshes which are read
+func (h *TaskHandler) syncInboxFolder(ctx context.Context, im *client.Client, config *models.IMAPConfig, folder string) (int, error) {
+	db := h.db.WithContext(ctx)
+
+	state := models.InboxFolder{}
+	if err := db.Where(models.InboxFolder{IMAPConfigID: config.ID, Folder: folder}).
+		Attrs(models.InboxFolder{TeamID: config.TeamID}).
+		FirstOrCreate(&state).Error; err != nil {
+		return 0, fmt.Errorf("failed to get folder position: %w", err)
+	}
+
+	// Read-only, so fetching messages doesn't mark them read
+	mailbox, err := im.Select(folder, true)
+	if err != nil {
+		return 0, fmt.Errorf("failed to select %s: %w", folder, err)
+	}
+
+	// A new UIDVALIDITY means the mailbox was recreated and old UIDs are meaningless
+	lastUID := state.LastUID
+	if mailbox.UidValidity != state.UIDValidity {
+		lastUID = 0
+		if err := db.Where("imap_config_id = ? AND folder = ? AND uid_validity <> ?", config.ID, folder, mailbox.UidValidity).
+			Delete(&models.InboxMessage{}).Error; err != nil {
+			return 0, fmt.Errorf("failed to drop messages of the old mailbox: %w", err)
+		}
+	}
+
+	all, err := im.UidSearch(imap.NewSearchCriteria())
+	if err != nil {
+		return 0, fmt.Errorf("failed to search %s: %w", folder, err)
+	}
+	unseenCriteria := imap.NewSearchCriteria()
+	unseenCriteria.WithoutFlags = []string{imap.SeenFlag}
+	unseen, err := im.UidSearch(unseenCriteria)
+	if err != nil {
+		return 0, fmt.Errorf("failed to search unread messages of %s: %w", folder, err)
+	}
+
+	newUIDs := make([]uint32, 0)
+	for _, uid := range all {
+		if uid > lastUID {
+			newUIDs = append(newUIDs, uid)
+		}
+	}
+	sort.Slice(newUIDs, func(i, j int) bool { return newUIDs[i] < newUIDs[j] })
+	if lastUID == 0 && len(newUIDs) > inboxBackfill {
+		newUIDs = newUIDs[len(newUIDs)-inboxBackfill:]
+	}
+	if len(newUIDs) > maxInboxMessagesPerSync {
+		newUIDs = newUIDs[:maxInboxMessagesPerSync]
+	}
+
+	synced := 0
+	if len(newUIDs) > 0 {
+		seqset := new(imap.SeqSet)
+		seqset.AddNum(newUIDs...)
+
+		section := &imap.BodySectionName{Peek: true}
+		messages := make(chan *imap.Message, 10)
+		done := make(chan error, 1)
+		go func() {
+			done <- im.UidFetch(seqset, []imap.FetchItem{imap.FetchUid, imap.FetchFlags, imap.FetchInternalDate, section.FetchItem()}, messages)
+		}()
+
+		var saveErr error
+		for msg := range messages {
+			if msg.Uid > lastUID {
+				lastUID = msg.Uid
+			}
+			if saveErr != nil {
+				continue // drain the fetch
+			}
+			body := msg.GetBody(section)
+			if body == nil {
+				continue
+			}
+			raw, err := io.ReadAll(body)
+			if err != nil {
+				continue
+			}
+			message, err := inboxMessage(config, folder, mailbox.UidValidity, msg, raw)
+			if err != nil {
+				h.logger.Warn("⚠️ Skipping unreadable message %d of %s: %v", msg.Uid, folder, err)
+				continue
+			}
+			saved, err := models.SaveInboxMessage(message, config.Username, db)
+			if err != nil {
+				saveErr = err
+				continue
+			}
+			if saved {
+				synced++
+				h.recordInboxReply(db, config, message)
+			}
+		}
+		if err := <-done; err != nil {
+			return synced, fmt.Errorf("failed to fetch messages: %w", err)
+		}
+		if saveErr != nil {
+			return synced, fmt.Errorf("failed to save messages: %w", saveErr)
+		}
+	}
+
+	// Messages expunged from the folder, and read or marked unread in other mail clients
+	if err := db.Where("imap_config_id = ? AND folder = ? AND NOT (uid = ANY(?))", config.ID, folder, uidArray(all)).
+		Delete(&models.InboxMessage{}).Error; err != nil {
+		return synced, fmt.Errorf("failed to drop expunged messages: %w", err)
+	}
+	if err := db.Model(&models.InboxMessage{}).
+		Where("imap_config_id = ? AND folder = ? AND is_read = (uid = ANY(?))", config.ID, folder, uidArray(unseen)).
+		UpdateColumn("is_read", clause.Expr{SQL: "NOT (uid = ANY(?))", Vars: []interface{}{uidArray(unseen)}}).Error; err != nil {
+		return synced, fmt.Errorf("failed to update read messages: %w", err)
+	}
+
+	if err := db.Model(&models.InboxFolder{}).Where("id = ?", state.ID).Updates(map[string]interface{}{
+		"uid_validity": mailbox.UidValidity,
+		"last_uid":     lastUID,
+		"synced_at":    time.Now(),
+	}).Error; err != nil {
+		return synced, fmt.Errorf("failed to save folder position: %w", err)
+	}
+
+	return synced, nil
+}
+
+// recordInboxReply counts a newly synced message as a reply to the team's email it answers, and
+// pauses the automations of contacts whose out of office notice says they're away. Replies and
+// pauses that fail are logged rather than failing the sync, which doesn't see the message again.
+func (h *TaskHandler) recordInboxReply(db *gorm.DB, config *models.IMAPConfig, message *models.InboxMessage) {
+	tracking, err := models.RecordInboxReply(message, config.Username, db)
+	if err != nil {
+		h.logger.Warn("⚠️ Failed to record reply %s: %v", message.ID, err)
+	} else if tracking != nil {
+		events.Emit("email_tracking.created", tracking)
+	}
+
+	if message.AutoReply != string(utils.AutoReplyKindOutOfOffice) || strings.EqualFold(message.FromAddress, config.Username) {
+		return
+	}
+	until := message.Date.Add(models.OutOfOfficePause)
+	if message.ReturnsAt != nil {
+		until = *message.ReturnsAt
+	}
+	// Notices of absences over by now, e.g. of a mailbox's first sync, hold nothing
+	if !until.After(time.Now()) {
+		return
+	}
+	paused, err := models.PauseContactAutomations(config.TeamID, message.FromAddress, until, db)
+	if err != nil {
+		h.logger.Warn("⚠️ Failed to pause automations of %s: %v", message.FromAddress, err)
+		return
+	}
+	if paused > 0 {
+		h.logger.Info("⏸️ Paused %d automation runs of %s until %s", paused, message.FromAddress, until.Format(time.RFC3339))
+	}
+}
+
+// inboxMessage parses a fetched message into its inbox row
+func inboxMessage(config *models.IMAPConfig, folder string, uidValidity uint32, msg *imap.Message, raw []byte) (*models.InboxMessage, error) {
+	parsed, err := utils.ParseEmail(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+
+	text := parsed.BodyText
+	if text == "" && parsed.BodyHTML != "" {
+		text = utils.HTMLToText(parsed.BodyHTML)
+	}
+
+	message := &models.InboxMessage{
+		TeamID:         config.TeamID,
+		IMAPConfigID:   config.ID,
+		Folder:         folder,
+		UIDValidity:    uidValidity,
+		UID:            msg.Uid,
+		MessageID:      parsed.MessageID,
+		InReplyTo:      strings.TrimSpace(parsed.InReplyTo),
+		References:     sanitizeInboxText(parsed.References, maxInboxBodySize),
+		Subject:        sanitizeInboxText(parsed.Subject, 1000),
+		To:             joinAddresses(parsed.To),
+		Cc:             joinAddresses(parsed.Cc),
+		Date:           parsed.Date,
+		Snippet:        sanitizeInboxText(strings.Join(strings.Fields(text), " "), inboxSnippetLength),
+		BodyText:       sanitizeInboxText(text, maxInboxBodySize),
+		BodyHTML:       sanitizeInboxText(parsed.BodyHTML, maxInboxBodySize),
+		Flags:          pq.StringArray(msg.Flags),
+		Labels:         pq.StringArray{},
+		HasAttachments: len(parsed.Attachments) > 0,
+	}
+	if message.Date.IsZero() {
+		message.Date = msg.InternalDate
+	}
+	if len(parsed.From) > 0 {
+		message.FromName = parsed.From[0].Name
+		message.FromAddress = strings.ToLower(parsed.From[0].Address)
+	}
+	if message.Flags == nil {
+		message.Flags = pq.StringArray{}
+	}
+	if reply := utils.DetectAutoReply(parsed.Header, parsed.Subject, text, message.Date); reply != nil {
+		message.AutoReply = string(reply.Kind)
+		if !reply.ReturnsAt.IsZero() {
+			message.ReturnsAt = &reply.ReturnsAt
+		}
+	}
+	for _, flag := range msg.Flags {
+		switch {
+		case flag == imap.SeenFlag:
+			message.IsRead = true
+		case !strings.HasPrefix(flag, `\`):
+			message.Labels = append(message.Labels, flag) // keywords, as opposed to system flags
+		}
+	}
+	return message, nil
+}
+
+// sanitizeInboxText cuts s to at most n bytes of valid UTF-8 without NUL bytes, which Postgres
+// text can't hold
+func sanitizeInboxText(s string, n int) string {
+	s = strings.ToValidUTF8(strings.ReplaceAll(s, "\x00", ""), "")
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+func joinAddresses(addresses []*mail.Address) string {
+	out := make([]string, 0, len(addresses))
+	for _, address := range addresses {
+		out = append(out, address.String())
+	}
+	return strings.Join(out, ", ")
+}
+
+func uidArray(uids []uint32) pq.Int64Array {
+	array := make(pq.Int64Array, len(uids))
+	for i, uid := range uids {
+		array[i] = int64(uid)
+	}
+	return array
+}
@@ -0,0 +1,179 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"kori/internal/models"
+	"kori/internal/utils"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hibiken/asynq"
+)
+
+// maxInboxFollowUpsPerRun caps the follow-ups handled a minute; the rest wait for the next run
+const maxInboxFollowUpsPerRun = 200
+
+// HandleInboxReminders brings back the conversations whose snooze is over and those whose
+// follow-up is due, mailing the sender the follow-up's bump template
+func (h *TaskHandler) HandleInboxReminders(ctx context.Context, t *asynq.Task) error {
+	db := h.db.WithContext(ctx)
+	now := time.Now()
+
+	woken, err := models.WakeInboxConversations(now, db)
+	if err != nil {
+		return h.logger.Error("❌ failed to wake snoozed conversations: %w", err)
+	}
+	if woken > 0 {
+		h.logger.Info("⏰ Brought back %d snoozed conversations", woken)
+	}
+
+	conversations, err := models.DueInboxFollowUps(now, maxInboxFollowUpsPerRun, db)
+	if err != nil {
+		return h.logger.Error("❌ failed to get due follow-ups: %w", err)
+	}
+	for i := range conversations {
+		conversation := &conversations[i]
+		claimed, err := models.ClaimInboxFollowUp(conversation, now, db)
+		if err != nil {
+			h.logger.Error("❌ failed to claim follow-up: %w", err)
+			continue
+		}
+		if !claimed || conversation.FollowUpTemplateID == "" {
+			continue
+		}
+		// The conversation is back in the inbox either way, so a bump that can't be sent is only logged
+		if err := h.sendInboxBump(conversation); err != nil {
+			h.logger.Warn("⚠️ Failed to send the follow-up of conversation %s: %v", conversation.ID, err)
+			continue
+		}
+		h.logger.Success("📨 Followed up on conversation %s", conversation.ID)
+	}
+
+	return nil
+}
+
+// sendInboxBump mails the follow-up template to the other side of a conversation, as a reply to
+// its latest message so it lands in the same thread. Replies go to the synced mailbox.
+func (h *TaskHandler) sendInboxBump(conversation *models.InboxConversation) error {
+	config := &models.IMAPConfig{}
+	if err := h.db.Where("id = ? AND is_deleted = false", conversation.IMAPConfigID).First(config).Error; err != nil {
+		return fmt.Errorf("failed to get mailbox: %w", err)
+	}
+
+	var messages []models.InboxMessage
+	if err := h.db.Select("message_id", "from_name", "from_address", "to").
+		Where("conversation_id = ? AND is_deleted = false", conversation.ID).
+		Order("date DESC").
+		Find(&messages).Error; err != nil {
+		return fmt.Errorf("failed to get messages: %w", err)
+	}
+	if len(messages) == 0 {
+		return errors.New("the conversation has no messages left")
+	}
+	name, address := inboxCorrespondent(messages, config.Username)
+	if address == "" {
+		return errors.New("the conversation has no one to follow up with")
+	}
+
+	template := &models.Template{}
+	if err := h.db.Where("id = ? AND team_id = ? AND is_deleted = false", conversation.FollowUpTemplateID, conversation.TeamID).
+		Preload("HtmlFile").First(template).Error; err != nil {
+		return fmt.Errorf("failed to get template: %w", err)
+	}
+	if template.HtmlFile == nil {
+		return errors.New("template has no html file")
+	}
+	html, err := utils.GetHTMLFromURL(template.HtmlFile.SignedURL)
+	if err != nil {
+		return fmt.Errorf("failed to get html from template: %w", err)
+	}
+
+	smtpConfig, err := models.GetSMTPConfig(conversation.TeamID, conversation.FollowUpSMTPConfigID, "", h.db)
+	if err != nil {
+		return fmt.Errorf("failed to get smtp config: %w", err)
+	}
+	category := &models.EmailCategory{}
+	if err := h.db.Where("name = ? AND team_id = ?", "Transactional", conversation.TeamID).First(category).Error; err != nil {
+		return fmt.Errorf("failed to get category: %w", err)
+	}
+
+	// Signed by the assignee, or for the team when they have no signature of their own
+	text := template.PlainText
+	signature, err := models.GetDefaultSignature(conversation.TeamID, conversation.AssigneeID, h.db)
+	if err != nil {
+		return fmt.Errorf("failed to get signature: %w", err)
+	}
+	if signature != nil {
+		signatureVariables, err := models.GetSignatureVariables(signature, conversation.AssigneeID, h.db)
+		if err != nil {
+			return fmt.Errorf("failed to get signature variables: %w", err)
+		}
+		html, text = utils.AppendSignature(html, text, utils.RenderSignature(signature.HTML, signatureVariables))
+	}
+
+	variables := map[string]string{"name": name, "email": address, "subject": conversation.Subject}
+	emailID := uuid.New().String()
+	parsedBody := utils.ReplaceVariables(html, variables, emailID, cfg, false)
+	parsedText := utils.PlainTextBody(text, html, variables)
+	jsonData, err := utils.MapToJSON(variables)
+	if err != nil {
+		return fmt.Errorf("failed to convert variables to json: %w", err)
+	}
+
+	// The conversation's subject rather than the template's, so mail clients thread the reply
+	subject := conversation.Subject
+	if !strings.HasPrefix(strings.ToLower(subject), "re:") {
+		subject = "Re: " + subject
+	}
+
+	email := &models.Email{
+		From:         smtpConfig.FromEmail,
+		To:           address,
+		Subject:      subject,
+		Body:         parsedBody,
+		PlainText:    parsedText,
+		Data:         jsonData,
+		Status:       models.EmailStatusPending,
+		TeamID:       conversation.TeamID,
+		TemplateID:   template.ID,
+		SMTPConfigID: smtpConfig.ID,
+		CategoryID:   category.ID,
+		InReplyTo:    messages[0].MessageID,
+	}
+	if _, err := mail.ParseAddress(config.Username); err == nil {
+		email.ReplyTo = config.Username
+	}
+	email.ID = emailID
+
+	// Creating the email queues it for sending
+	if err := h.db.Create(email).Error; err != nil {
+		return fmt.Errorf("failed to create email: %w", err)
+	}
+	return nil
+}
+
+// inboxCorrespondent returns who the mailbox is talking to in a conversation: the latest sender
+// other than the mailbox, or whom the mailbox last wrote to when only it has written
+func inboxCorrespondent(messages []models.InboxMessage, mailboxAddress string) (string, string) {
+	for _, message := range messages {
+		if message.FromAddress != "" && !strings.EqualFold(message.FromAddress, mailboxAddress) {
+			return message.FromName, message.FromAddress
+		}
+	}
+	for _, message := range messages {
+		addresses, err := mail.ParseAddressList(message.To)
+		if err != nil {
+			continue
+		}
+		for _, address := range addresses {
+			if !strings.EqualFold(address.Address, mailboxAddress) {
+				return address.Name, address.Address
+			}
+		}
+	}
+	return "", ""
+}
@@ -0,0 +1,29 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"kori/internal/models"
+
+	"github.com/hibiken/asynq"
+)
+
+// HandleIndexAdvisor samples the slowest statements from pg_stat_statements and stores the
+// indexes that would serve them, for operators to turn into migrations. Databases without the
+// extension are skipped.
+func (h *TaskHandler) HandleIndexAdvisor(ctx context.Context, t *asynq.Task) error {
+	recommendations, err := models.RefreshIndexRecommendations(h.db.WithContext(ctx))
+	if errors.Is(err, models.ErrIndexAdvisorUnavailable) {
+		h.logger.Warn("⚠️ Skipping index advisor: %v", err)
+		return nil
+	}
+	if err != nil {
+		return h.logger.Error("❌ failed to refresh index recommendations: %w", err)
+	}
+
+	for _, recommendation := range recommendations {
+		h.logger.Info("🗂️ %s would serve %d calls averaging %.1fms", recommendation.Statement, recommendation.Calls, recommendation.MeanTimeMs)
+	}
+	h.logger.Info("🗂️ Index advisor found %d missing indexes", len(recommendations))
+	return nil
+}
@@ -0,0 +1,30 @@
+package tasks
+
+import (
+	"context"
+	"kori/internal/models"
+
+	"github.com/hibiken/asynq"
+)
+
+// HandleLeadScores recomputes the lead scores of every team scoring its contacts. Teams that
+// fail don't keep the others from being scored.
+func (h *TaskHandler) HandleLeadScores(ctx context.Context, t *asynq.Task) error {
+	teamIDs, err := models.GetLeadScoredTeams(h.db)
+	if err != nil {
+		return h.logger.Error("❌ failed to get lead scored teams: %w", err)
+	}
+
+	var changed int64
+	for _, teamID := range teamIDs {
+		count, err := models.RecomputeLeadScores(teamID, h.db)
+		if err != nil {
+			h.logger.Warn("⚠️ Failed to recompute lead scores of team %s: %v", teamID, err)
+			continue
+		}
+		changed += count
+	}
+
+	h.logger.Info("🎯 Recomputed lead scores of %d teams, %d contacts changed", len(teamIDs), changed)
+	return nil
+}
@@ -0,0 +1,130 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"kori/internal/events"
+	"kori/internal/models"
+	"kori/internal/utils"
+	"strings"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"gorm.io/gorm"
+)
+
+// llmEmailWriterSystemPrompt keeps generated copy usable as an email body as is
+const llmEmailWriterSystemPrompt = "You write marketing and transactional emails. Reply with the email body as HTML only, " +
+	"without a subject line, markdown code fences or commentary. Keep placeholders like {{ first_name }} exactly as given."
+
+// HandleLLMEmailWriter generates email copy for a writer job with the job model's provider and
+// stores the output and token usage on the job
+func (h *TaskHandler) HandleLLMEmailWriter(ctx context.Context, t *asynq.Task) error {
+	var task LLMEmailWriterTask
+	if err := decodeTask(t, &task); err != nil {
+		return fmt.Errorf("failed to unmarshal LLM email writer task: %w", asynq.SkipRetry)
+	}
+
+	h.logger.Info("processing LLM email writer task %s with template %s and model %s and attempt %d", task.EmailID, task.TemplateID, task.ModelID, task.AttemptNum)
+
+	job := &models.LLMEmailWriterJob{}
+	if err := h.db.Where("id = ? AND is_deleted = false", task.JobID).Preload("Model").First(job).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("LLM email writer job %s not found: %w", task.JobID, asynq.SkipRetry)
+		}
+		return h.logger.Error("❌ failed to get LLM email writer job: %w", err)
+	}
+
+	if job.Status == models.LLMJobStatusCompleted {
+		h.logger.Info("✅ LLM email writer job %s is already completed", job.ID)
+		return nil
+	}
+	if job.Model == nil {
+		return h.failLLMJob(job, errors.New("job has no model"), true)
+	}
+
+	if err := h.db.Model(job).Updates(map[string]interface{}{
+		"status":     models.LLMJobStatusRunning,
+		"started_at": time.Now(),
+		"error":      "",
+	}).Error; err != nil {
+		return h.logger.Error("❌ failed to update LLM email writer job: %w", err)
+	}
+
+	completion, err := utils.GenerateCompletion(ctx, cfg, utils.LLMRequest{
+		Provider: job.Model.Provider,
+		Model:    job.Model.Name,
+		System:   llmEmailWriterSystemPrompt,
+		Prompt:   job.RenderPrompt(task.Parameters),
+	})
+	if err != nil {
+		var llmErr *utils.LLMError
+		permanent := errors.Is(err, utils.ErrLLMNotConfigured) || (errors.As(err, &llmErr) && !llmErr.Retryable())
+		return h.failLLMJob(job, err, permanent || isLastAttempt(ctx))
+	}
+
+	job.Output = stripCodeFence(completion.Text)
+	job.PromptTokens = completion.PromptTokens
+	job.CompletionTokens = completion.CompletionTokens
+	job.Status = models.LLMJobStatusCompleted
+	job.CompletedAt = time.Now()
+	if err := h.db.Model(job).Updates(map[string]interface{}{
+		"output":            job.Output,
+		"prompt_tokens":     job.PromptTokens,
+		"completion_tokens": job.CompletionTokens,
+		"status":            job.Status,
+		"completed_at":      job.CompletedAt,
+	}).Error; err != nil {
+		return h.logger.Error("❌ failed to save LLM email writer output: %w", err)
+	}
+
+	h.logger.Success("✍️ LLM email writer job %s generated %d tokens with %s", job.ID, job.CompletionTokens, job.Model.Name)
+	events.Emit("llm_email_writer.completed", job)
+	return nil
+}
+
+// failLLMJob records the error on the job. Final failures mark the job FAILED and stop retries;
+// others leave it for the next attempt.
+func (h *TaskHandler) failLLMJob(job *models.LLMEmailWriterJob, cause error, final bool) error {
+	updates := map[string]interface{}{"error": cause.Error()}
+	if final {
+		updates["status"] = models.LLMJobStatusFailed
+		updates["completed_at"] = time.Now()
+	}
+	if err := h.db.Model(job).Updates(updates).Error; err != nil {
+		h.logger.Warn("⚠️ Failed to record error of LLM email writer job %s: %v", job.ID, err)
+	}
+
+	if !final {
+		return h.logger.Error("❌ LLM email writer failed: %w", cause)
+	}
+	job.Status = models.LLMJobStatusFailed
+	job.Error = cause.Error()
+	events.Emit("llm_email_writer.failed", job)
+	h.logger.Warn("⚠️ LLM email writer job %s failed: %v", job.ID, cause)
+	return fmt.Errorf("%v: %w", cause, asynq.SkipRetry)
+}
+
+// isLastAttempt reports whether the queue won't retry the running task again
+func isLastAttempt(ctx context.Context) bool {
+	retried, ok := retryCount(ctx)
+	if !ok {
+		return false
+	}
+	limit, ok := maxRetry(ctx)
+	return ok && retried >= limit
+}
+
+// stripCodeFence unwraps output a model fenced in ```html despite being asked not to
+func stripCodeFence(text string) string {
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, "```") {
+		return text
+	}
+	text = strings.TrimPrefix(text, "```")
+	if newline := strings.Index(text, "\n"); newline >= 0 {
+		text = text[newline+1:]
+	}
+	return strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(text), "```"))
+}
@@ -0,0 +1,30 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"kori/internal/utils"
+
+	"github.com/hibiken/asynq"
+)
+
+// ErrMaintenance is returned by tasks picked up while the platform is in maintenance mode. The
+// task goes back to the queue without counting as a failed attempt.
+var ErrMaintenance = errors.New("platform is in maintenance mode")
+
+// holdDuringMaintenance sends tasks back to the queue while maintenance mode is on. Running
+// tasks finish, and campaigns send in batches, so sending pauses between batches and picks up
+// where it was once maintenance ends.
+func (h *TaskHandler) holdDuringMaintenance(next asynq.Handler) asynq.Handler {
+	return asynq.HandlerFunc(func(ctx context.Context, t *asynq.Task) error {
+		mode, err := utils.GetMaintenanceMode(ctx, h.taskClient.redisClient)
+		if err != nil {
+			h.logger.Warn("⚠️ Failed to get maintenance mode: %v", err)
+		}
+		if mode.Enabled {
+			return fmt.Errorf("holding %s task: %w", t.Type(), ErrMaintenance)
+		}
+		return next.ProcessTask(ctx, t)
+	})
+}
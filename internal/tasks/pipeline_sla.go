@@ -0,0 +1,52 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"kori/internal/config"
+	"kori/internal/events"
+	"kori/internal/models"
+	"time"
+
+	"github.com/hibiken/asynq"
+)
+
+// PipelineSLA maps the configured delivery targets onto the queues emails are sent through
+func PipelineSLA(sla config.SLAConfig) models.PipelineSLA {
+	return models.PipelineSLA{
+		Targets: map[string]time.Duration{
+			QueueCritical: sla.CriticalDeliveryP95,
+			QueueDefault:  sla.DefaultDeliveryP95,
+		},
+		MinEmails: sla.MinEmails,
+	}
+}
+
+// HandlePipelineSLA checks the email pipeline's latencies over the SLA window and raises an
+// alert for each queue or SMTP config over its target. A breach is alerted once per window
+// however many checks see it.
+func (h *TaskHandler) HandlePipelineSLA(ctx context.Context, t *asynq.Task) error {
+	metrics, err := models.GetEmailPipelineMetrics(time.Now().Add(-cfg.SLA.Window), PipelineSLA(cfg.SLA), h.db.WithContext(ctx))
+	if err != nil {
+		return h.logger.Error("❌ failed to get email pipeline metrics: %w", err)
+	}
+
+	for _, breach := range metrics.Breaches {
+		h.logger.Warn("⏱️ Queue %s %s delivered %d emails at p95 %.1fs, over its %.0fs SLA",
+			breach.Queue, breach.SMTPHost, breach.Emails, breach.Delivery.P95, breach.SLASeconds)
+
+		key := fmt.Sprintf("pipeline_sla:alerted:%s:%s", breach.Queue, breach.SMTPConfigID)
+		first, err := h.taskClient.markOnce(ctx, key, cfg.SLA.Window)
+		if err != nil {
+			h.logger.Warn("⚠️ Failed to check if the breach of queue %s was alerted: %v", breach.Queue, err)
+		}
+		if err == nil && !first {
+			continue
+		}
+		events.Emit("email_pipeline.sla_breached", breach)
+	}
+
+	h.logger.Info("⏱️ Checked email pipeline SLA: %d queues, %d smtp configs, %d breaches",
+		len(metrics.Queues), len(metrics.SMTPConfigs), len(metrics.Breaches))
+	return nil
+}
@@ -0,0 +1,106 @@
+package tasks
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"gorm.io/gorm"
+
+	"kori/internal/tasks/embedded"
+)
+
+// Enqueuer is what tasks are enqueued through: asynq's client, or the embedded queue when Redis
+// isn't configured
+type Enqueuer interface {
+	EnqueueContext(ctx context.Context, task *asynq.Task, opts ...asynq.Option) (*asynq.TaskInfo, error)
+	Close() error
+}
+
+// queueInspector is the part of asynq's inspector tasks use, which the embedded queue has too
+type queueInspector interface {
+	GetQueueInfo(queue string) (*asynq.QueueInfo, error)
+	ListPendingTasks(queue string, opts ...asynq.ListOption) ([]*asynq.TaskInfo, error)
+	ListScheduledTasks(queue string, opts ...asynq.ListOption) ([]*asynq.TaskInfo, error)
+	ListRetryTasks(queue string, opts ...asynq.ListOption) ([]*asynq.TaskInfo, error)
+	ListArchivedTasks(queue string, opts ...asynq.ListOption) ([]*asynq.TaskInfo, error)
+	DeleteTask(queue, id string) error
+	Close() error
+}
+
+// taskServer and periodicScheduler are asynq's server and scheduler, or the embedded ones
+type taskServer interface {
+	Start(handler asynq.Handler) error
+	Stop()
+	Shutdown()
+}
+
+type periodicScheduler interface {
+	Register(spec string, task *asynq.Task, opts ...asynq.Option) (string, error)
+	Run() error
+	Shutdown()
+}
+
+// OpenEmbeddedQueue keeps the tasks of a server running without Redis in db. Clients made
+// before it's open enqueue once it is.
+func OpenEmbeddedQueue(db *gorm.DB) error {
+	return embedded.Default().Open(db)
+}
+
+// taskID, retryCount, maxRetry and queueName read the running task's metadata from whichever
+// queue runs it
+func taskID(ctx context.Context) (string, bool) {
+	if id, ok := asynq.GetTaskID(ctx); ok {
+		return id, true
+	}
+	return embedded.GetTaskID(ctx)
+}
+
+func retryCount(ctx context.Context) (int, bool) {
+	if n, ok := asynq.GetRetryCount(ctx); ok {
+		return n, true
+	}
+	return embedded.GetRetryCount(ctx)
+}
+
+func maxRetry(ctx context.Context) (int, bool) {
+	if n, ok := asynq.GetMaxRetry(ctx); ok {
+		return n, true
+	}
+	return embedded.GetMaxRetry(ctx)
+}
+
+func queueName(ctx context.Context) (string, bool) {
+	if name, ok := asynq.GetQueueName(ctx); ok {
+		return name, true
+	}
+	return embedded.GetQueueName(ctx)
+}
+
+// marks stands in for the Redis keys set once per alert on a server running without Redis
+var marks = struct {
+	sync.Mutex
+	until map[string]time.Time
+}{until: make(map[string]time.Time)}
+
+// markOnce sets the key for ttl and reports whether it wasn't set already, as SET NX does
+func (c *TaskClient) markOnce(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	if c.redisClient != nil {
+		return c.redisClient.SetNX(ctx, key, time.Now().Unix(), ttl).Result()
+	}
+
+	marks.Lock()
+	defer marks.Unlock()
+	now := time.Now()
+	for other, until := range marks.until {
+		if !until.After(now) {
+			delete(marks.until, other)
+		}
+	}
+	if _, set := marks.until[key]; set {
+		return false, nil
+	}
+	marks.until[key] = now.Add(ttl)
+	return true, nil
+}
@@ -0,0 +1,51 @@
+package tasks
+
+import (
+	"errors"
+	"kori/internal/models"
+)
+
+// chargeCampaignQuota takes a campaign run's credits from the team's monthly quotas: a campaign
+// on its first run and an email for each email the run sends. A run the quotas can't take pauses
+// the campaign with the reason, so it can be resumed once the team upgrades or the next month
+// starts. It returns a func giving the credits back for when the emails can't be saved, and
+// whether the run may go ahead.
+func (h *TaskHandler) chargeCampaignQuota(campaign *models.Campaign, firstRun bool, emails []*models.Email) (func(), bool, error) {
+	var sends int64
+	for _, email := range emails {
+		if email.Status != models.EmailStatusSkipped {
+			sends++
+		}
+	}
+
+	var campaigns int64
+	if firstRun {
+		campaigns = 1
+	}
+	err := models.ConsumeQuota(campaign.TeamID, models.QuotaResourceCampaigns, campaigns, h.db)
+	if err == nil {
+		if err = models.ConsumeQuota(campaign.TeamID, models.QuotaResourceEmails, sends, h.db); err != nil {
+			models.RefundQuota(campaign.TeamID, models.QuotaResourceCampaigns, campaigns, h.db)
+		}
+	}
+	if err != nil {
+		var exceeded *models.QuotaExceededError
+		if !errors.As(err, &exceeded) {
+			return nil, false, h.logger.Error("❌ failed to check sending quota: %w", err)
+		}
+		if err := h.db.Model(&models.Campaign{}).Where("id = ?", campaign.ID).Updates(map[string]interface{}{
+			"status":       models.CampaignStatusPaused,
+			"pause_reason": exceeded.Error(),
+		}).Error; err != nil {
+			return nil, false, h.logger.Error("❌ failed to pause campaign: %w", err)
+		}
+		h.logger.Warn("⏸️ Paused campaign %s, %s", campaign.ID, exceeded.Error())
+		return nil, false, nil
+	}
+
+	refund := func() {
+		models.RefundQuota(campaign.TeamID, models.QuotaResourceCampaigns, campaigns, h.db)
+		models.RefundQuota(campaign.TeamID, models.QuotaResourceEmails, sends, h.db)
+	}
+	return refund, true, nil
+}
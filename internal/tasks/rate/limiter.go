@@ -24,6 +24,7 @@ type QueueRateLimiter struct {
 	config QueueConfig
 }
 
+// NewQueueRateLimiter returns a limiter counting in Redis, or in memory when redis is nil
 func NewQueueRateLimiter(redis *redis.Client, config QueueConfig) *QueueRateLimiter {
 	return &QueueRateLimiter{
 		redis:  redis,
@@ -33,6 +34,9 @@ func NewQueueRateLimiter(redis *redis.Client, config QueueConfig) *QueueRateLimi
 
 func (qrl *QueueRateLimiter) Allow(ctx context.Context, identifier string) (bool, error) {
 	key := fmt.Sprintf("queue_rate_limit:%s:%s", qrl.config.Name, identifier)
+	if qrl.redis == nil {
+		return allowInMemory(key, qrl.config.RateLimit.Window, qrl.config.RateLimit.MaxJobs), nil
+	}
 
 	pipe := qrl.redis.Pipeline()
 	now := time.Now().Unix()
@@ -0,0 +1,71 @@
+package rate
+
+import (
+	"sync"
+	"time"
+)
+
+// memory keeps the rate windows and semaphores of a server running without Redis, under the
+// keys they'd have in Redis
+var memory = struct {
+	sync.Mutex
+	windows map[string][]time.Time          // when each job in the window ran
+	holders map[string]map[string]time.Time // holder to the end of its lease
+}{
+	windows: make(map[string][]time.Time),
+	holders: make(map[string]map[string]time.Time),
+}
+
+// Forget drops what's kept in memory under the keys, as deleting them from Redis would
+func Forget(keys ...string) {
+	memory.Lock()
+	defer memory.Unlock()
+	for _, key := range keys {
+		delete(memory.windows, key)
+		delete(memory.holders, key)
+	}
+}
+
+func allowInMemory(key string, window time.Duration, maxJobs int) bool {
+	memory.Lock()
+	defer memory.Unlock()
+
+	now := time.Now()
+	start := now.Add(-window)
+	kept := memory.windows[key][:0]
+	for _, at := range memory.windows[key] {
+		if at.After(start) {
+			kept = append(kept, at)
+		}
+	}
+	memory.windows[key] = append(kept, now)
+	return len(kept) <= maxJobs
+}
+
+func acquireInMemory(key, holder string, limit int, lease time.Duration) bool {
+	memory.Lock()
+	defer memory.Unlock()
+
+	now := time.Now()
+	holders := memory.holders[key]
+	if holders == nil {
+		holders = make(map[string]time.Time)
+		memory.holders[key] = holders
+	}
+	for other, until := range holders {
+		if !until.After(now) {
+			delete(holders, other)
+		}
+	}
+	if _, held := holders[holder]; !held && len(holders) >= limit {
+		return false
+	}
+	holders[holder] = now.Add(lease)
+	return true
+}
+
+func releaseInMemory(key, holder string) {
+	memory.Lock()
+	defer memory.Unlock()
+	delete(memory.holders[key], holder)
+}
@@ -0,0 +1,83 @@
+package rate
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// acquireScript drops expired holders and adds the new one if there is room
+var acquireScript = redis.NewScript(`
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', ARGV[1])
+if redis.call('ZSCORE', KEYS[1], ARGV[4]) then
+	redis.call('ZADD', KEYS[1], ARGV[2], ARGV[4])
+	return 1
+end
+if redis.call('ZCARD', KEYS[1]) >= tonumber(ARGV[3]) then
+	return 0
+end
+redis.call('ZADD', KEYS[1], ARGV[2], ARGV[4])
+redis.call('PEXPIRE', KEYS[1], ARGV[5])
+return 1
+`)
+
+// Semaphore caps how many holders per identifier run at once. Each holder has a lease, so a
+// worker that dies without releasing frees its slot when the lease runs out. Without a Redis
+// client the slots are kept in memory, for a single server.
+type Semaphore struct {
+	redis *redis.Client
+	name  string
+	limit int
+	lease time.Duration
+}
+
+func NewSemaphore(redis *redis.Client, name string, limit int, lease time.Duration) *Semaphore {
+	return &Semaphore{
+		redis: redis,
+		name:  name,
+		limit: limit,
+		lease: lease,
+	}
+}
+
+func (s *Semaphore) key(identifier string) string {
+	return fmt.Sprintf("semaphore:%s:%s", s.name, identifier)
+}
+
+// Acquire takes a slot for the holder and reports false when all slots are taken
+func (s *Semaphore) Acquire(ctx context.Context, identifier, holder string) (bool, error) {
+	if s.limit <= 0 {
+		return true, nil
+	}
+
+	if s.redis == nil {
+		return acquireInMemory(s.key(identifier), holder, s.limit, s.lease), nil
+	}
+
+	now := time.Now()
+	result, err := acquireScript.Run(ctx, s.redis, []string{s.key(identifier)},
+		now.UnixMilli(),
+		now.Add(s.lease).UnixMilli(),
+		s.limit,
+		holder,
+		s.lease.Milliseconds(),
+	).Int()
+	if err != nil {
+		return false, fmt.Errorf("failed to acquire semaphore: %w", err)
+	}
+	return result == 1, nil
+}
+
+// Release gives the holder's slot back
+func (s *Semaphore) Release(ctx context.Context, identifier, holder string) error {
+	if s.limit <= 0 {
+		return nil
+	}
+	if s.redis == nil {
+		releaseInMemory(s.key(identifier), holder)
+		return nil
+	}
+	return s.redis.ZRem(ctx, s.key(identifier), holder).Err()
+}
@@ -0,0 +1,131 @@
+package tasks
+
+import (
+	"context"
+	"kori/internal/events"
+	"kori/internal/models"
+	"kori/internal/utils"
+	"strings"
+	"time"
+
+	"github.com/hibiken/asynq"
+)
+
+// reputationLookback is how many days each sync reads again, as providers fill in and revise
+// the last few days
+const reputationLookback = 7
+
+// HandleReputationSync pulls the last days of reputation data of every active connector and
+// alerts the team's admins of days a domain or IP got worse
+func (h *TaskHandler) HandleReputationSync(ctx context.Context, t *asynq.Task) error {
+	var connectors []models.ReputationConnector
+	if err := h.db.Where("is_active = true AND is_deleted = false").Find(&connectors).Error; err != nil {
+		return h.logger.Error("❌ failed to get reputation connectors: %w", err)
+	}
+
+	for i := range connectors {
+		h.syncReputationConnector(ctx, &connectors[i])
+	}
+
+	h.logger.Info("📈 Synced %d reputation connectors", len(connectors))
+	return nil
+}
+
+// syncReputationConnector stores a connector's recent metrics and records how the sync went.
+// Domains or days that fail don't keep the others from being stored.
+func (h *TaskHandler) syncReputationConnector(ctx context.Context, connector *models.ReputationConnector) {
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	start := today.AddDate(0, 0, -reputationLookback)
+
+	var metrics []models.ReputationMetric
+	var failures []string
+	switch connector.Provider {
+	case models.ReputationProviderGooglePostmaster:
+		var domains []string
+		if err := h.db.Model(&models.Domain{}).
+			Where("team_id = ? AND is_verified = true AND is_deleted = false", connector.TeamID).
+			Pluck("domain", &domains).Error; err != nil {
+			failures = append(failures, err.Error())
+		}
+		for _, domain := range domains {
+			fetched, err := utils.FetchPostmasterMetrics(connector, domain, start, today)
+			if err != nil {
+				failures = append(failures, err.Error())
+				continue
+			}
+			metrics = append(metrics, fetched...)
+		}
+	case models.ReputationProviderMicrosoftSNDS:
+		for day := start; day.Before(today); day = day.AddDate(0, 0, 1) {
+			fetched, err := utils.FetchSNDSMetrics(connector, day)
+			if err != nil {
+				failures = append(failures, err.Error())
+				break
+			}
+			metrics = append(metrics, fetched...)
+		}
+	}
+
+	if err := models.SaveReputationMetrics(metrics, h.db.WithContext(ctx)); err != nil {
+		failures = append(failures, err.Error())
+	}
+
+	lastError := strings.Join(failures, "; ")
+	if lastError == "" {
+		h.logger.Info("📈 Stored %d reputation metrics of connector %s", len(metrics), connector.ID)
+	} else {
+		h.logger.Warn("⚠️ Reputation connector %s synced with errors: %s", connector.ID, lastError)
+	}
+	if err := h.db.Model(&models.ReputationConnector{}).Where("id = ?", connector.ID).UpdateColumns(map[string]interface{}{
+		"last_synced_at":  time.Now(),
+		"last_sync_error": lastError,
+	}).Error; err != nil {
+		h.logger.Warn("⚠️ Failed to save sync of reputation connector %s: %v", connector.ID, err)
+	}
+
+	if err := h.alertReputationDrops(connector, start); err != nil {
+		h.logger.Warn("⚠️ Failed to check reputation drops of connector %s: %v", connector.ID, err)
+	}
+}
+
+// alertReputationDrops announces the days since start that a domain or IP got worse than the
+// day before. Each day is announced once, however many times it's synced again.
+func (h *TaskHandler) alertReputationDrops(connector *models.ReputationConnector, start time.Time) error {
+	var metrics []models.ReputationMetric
+	if err := h.db.Where("connector_id = ? AND date >= ? AND is_deleted = false", connector.ID, start.AddDate(0, 0, -1)).
+		Order("domain, ip, date").Find(&metrics).Error; err != nil {
+		return err
+	}
+
+	var alerted []string
+	previous := make(map[string]*models.ReputationMetric)
+	for i := range metrics {
+		metric := &metrics[i]
+		before := previous[metric.Source()]
+		previous[metric.Source()] = metric
+		if metric.AlertedAt != nil || metric.Date.Before(start) {
+			continue
+		}
+
+		reason := models.ReputationDrop(before, metric)
+		if reason == "" {
+			continue
+		}
+		h.logger.Warn("📉 %s %s on %s: %s", connector.Provider, metric.Source(), metric.Date.Format("2006-01-02"), reason)
+		events.Emit("reputation.alert", models.ReputationAlert{
+			TeamID:    connector.TeamID,
+			Connector: connector.Name,
+			Provider:  connector.Provider,
+			Source:    metric.Source(),
+			Date:      metric.Date,
+			Reason:    reason,
+			Metric:    metric,
+		})
+		alerted = append(alerted, metric.ID)
+	}
+
+	if len(alerted) == 0 {
+		return nil
+	}
+	return h.db.Model(&models.ReputationMetric{}).Where("id IN ?", alerted).UpdateColumn("alerted_at", time.Now()).Error
+}
@@ -0,0 +1,159 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"kori/internal/models"
+	"kori/internal/utils"
+	"time"
+
+	"github.com/hibiken/asynq"
+)
+
+const (
+	// retryBatchLimit caps how many failed emails are re-enqueued per sweep
+	retryBatchLimit = 500
+	// retryBacklogLimit is the email queue backlog above which retries wait for the next sweep
+	retryBacklogLimit = 5000
+	// retryLease keeps a re-enqueued email out of later sweeps while its task is pending
+	retryLease = 30 * time.Minute
+)
+
+// HandleEmailRetry re-enqueues failed emails that are due for another attempt. It backs off
+// when the email queue is already busy, stops enqueueing for SMTP configs that are at their
+// send rate, and ignores emails whose SMTP config is disabled, unhealthy, paused or deleted.
+// Emails parked while sending through their config was paused are re-enqueued the same way
+// once it is resumed.
+func (h *TaskHandler) HandleEmailRetry(ctx context.Context, t *asynq.Task) error {
+	backlog, err := h.taskClient.QueueBacklog(QueueCritical)
+	if err != nil {
+		h.logger.Warn("⚠️ Failed to inspect the email queue: %v", err)
+	}
+	if backlog >= retryBacklogLimit {
+		h.logger.Info("⏳ Email queue has %d tasks waiting, postponing retries", backlog)
+		return nil
+	}
+
+	now := time.Now()
+	var emails []models.Email
+	if err := h.db.
+		Joins("JOIN smtp_configs ON smtp_configs.id = emails.smtp_config_id AND smtp_configs.is_active = true AND smtp_configs.is_healthy = true AND smtp_configs.sending_paused = false AND smtp_configs.is_deleted = false").
+		Where("emails.status = ? AND emails.is_deleted = false", models.EmailStatusFailed).
+		Where("emails.attempts < ? AND emails.next_retry_at <= ?", utils.MaxEmailAttempts, now).
+		Preload("SMTPConfig").
+		Order("emails.next_retry_at ASC").
+		Limit(min(retryBatchLimit, retryBacklogLimit-backlog)).
+		Find(&emails).Error; err != nil {
+		return h.logger.Error("❌ failed to get emails to retry: %w", err)
+	}
+
+	throttled := make(map[string]bool)
+	enqueued := 0
+	for _, email := range emails {
+		if throttled[email.SMTPConfigID] {
+			continue
+		}
+
+		// Take a lease so the next sweep skips it while the task is queued
+		lease := now.Add(retryLease)
+		if err := h.db.Model(&models.Email{}).Where("id = ?", email.ID).Update("next_retry_at", lease).Error; err != nil {
+			h.logger.Warn("⚠️ Failed to lease email %s for retry: %v", email.ID, err)
+			continue
+		}
+
+		maxSendRate := 0
+		if email.SMTPConfig != nil {
+			maxSendRate = email.SMTPConfig.MaxSendRate
+		}
+		if err := h.taskClient.EnqueueEmailTask(ctx, EmailTask{
+			EmailID:      email.ID,
+			AttemptNum:   email.Attempts + 1,
+			LastAttempt:  email.LastAttemptAt,
+			Error:        email.Error,
+			SMTPConfigID: email.SMTPConfigID,
+			MaxSendRate:  maxSendRate,
+			CampaignID:   email.CampaignID,
+		}); err != nil {
+			// Hand the email back to the next sweep
+			h.db.Model(&models.Email{}).Where("id = ?", email.ID).Update("next_retry_at", email.NextRetryAt)
+			if errors.Is(err, ErrRateLimited) {
+				throttled[email.SMTPConfigID] = true
+				continue
+			}
+			h.logger.Warn("⚠️ Failed to enqueue retry for email %s: %v", email.ID, err)
+			continue
+		}
+		enqueued++
+	}
+
+	if enqueued > 0 || len(throttled) > 0 {
+		h.logger.Info("🔁 Re-enqueued %d failed emails, %d SMTP configs throttled", enqueued, len(throttled))
+	}
+
+	h.resumeParkedEmails(ctx, retryBacklogLimit-backlog-enqueued, throttled)
+	return nil
+}
+
+// resumeParkedEmails re-enqueues up to limit emails parked on SMTP configs whose sending was
+// resumed. Emails of paused or cancelled campaigns stay parked.
+func (h *TaskHandler) resumeParkedEmails(ctx context.Context, limit int, throttled map[string]bool) {
+	if limit <= 0 {
+		return
+	}
+
+	var emails []models.Email
+	if err := h.db.
+		Joins("JOIN smtp_configs ON smtp_configs.id = emails.smtp_config_id AND smtp_configs.is_active = true AND smtp_configs.is_healthy = true AND smtp_configs.sending_paused = false AND smtp_configs.is_deleted = false").
+		Where("emails.status = ? AND emails.parked_at IS NOT NULL AND emails.is_deleted = false", models.EmailStatusPending).
+		Preload("SMTPConfig").
+		Order("emails.parked_at ASC").
+		Limit(min(retryBatchLimit, limit)).
+		Find(&emails).Error; err != nil {
+		h.logger.Warn("⚠️ Failed to get parked emails: %v", err)
+		return
+	}
+
+	resumed := 0
+	for _, email := range emails {
+		if throttled[email.SMTPConfigID] {
+			continue
+		}
+		if email.CampaignID != "" && models.IsCampaignHalted(email.CampaignID, h.db) {
+			continue
+		}
+
+		// Unparking is the lease; only one sweep gets to enqueue the email
+		result := h.db.Model(&models.Email{}).Where("id = ? AND parked_at IS NOT NULL", email.ID).Update("parked_at", nil)
+		if result.Error != nil || result.RowsAffected == 0 {
+			continue
+		}
+
+		maxSendRate := 0
+		if email.SMTPConfig != nil {
+			maxSendRate = email.SMTPConfig.MaxSendRate
+		}
+		if err := h.taskClient.EnqueueEmailTask(ctx, EmailTask{
+			EmailID:      email.ID,
+			AttemptNum:   email.Attempts + 1,
+			LastAttempt:  email.LastAttemptAt,
+			Error:        email.Error,
+			SMTPConfigID: email.SMTPConfigID,
+			MaxSendRate:  maxSendRate,
+			CampaignID:   email.CampaignID,
+		}); err != nil {
+			// Park it again for the next sweep
+			h.db.Model(&models.Email{}).Where("id = ?", email.ID).Update("parked_at", email.ParkedAt)
+			if errors.Is(err, ErrRateLimited) {
+				throttled[email.SMTPConfigID] = true
+				continue
+			}
+			h.logger.Warn("⚠️ Failed to enqueue parked email %s: %v", email.ID, err)
+			continue
+		}
+		resumed++
+	}
+
+	if resumed > 0 {
+		h.logger.Info("▶️ Resumed %d parked emails", resumed)
+	}
+}
@@ -3,6 +3,7 @@ package tasks
 import (
 	"fmt"
 
+	"kori/internal/tasks/embedded"
 	"kori/internal/utils/logger"
 
 	"github.com/hibiken/asynq"
@@ -10,12 +11,20 @@ import (
 
 // Scheduler handles periodic task scheduling
 type Scheduler struct {
-	scheduler *asynq.Scheduler
+	scheduler periodicScheduler
 	logger    *logger.Logger
 }
 
-// NewScheduler creates a new task scheduler
+// NewScheduler creates a new task scheduler, enqueueing to the embedded queue when redisAddr
+// is empty
 func NewScheduler(redisAddr, username, password string, db int, logger *logger.Logger) *Scheduler {
+	if redisAddr == "" {
+		return &Scheduler{
+			scheduler: embedded.NewScheduler(embedded.Default()),
+			logger:    logger,
+		}
+	}
+
 	scheduler := asynq.NewScheduler(
 		asynq.RedisClientOpt{
 			Addr:     redisAddr,
@@ -63,19 +72,6 @@ func (s *Scheduler) registerTasks() error {
 	// }
 	// s.logger.Debug("registered campaign scheduler %s", entryID)
 
-	// // Email retry (every 5 minutes)
-	// entryID, err = s.scheduler.Register("*/5 * * * *", asynq.NewTask(
-	// 	TaskTypeEmailRetry,
-	// 	nil,
-	// 	asynq.Queue(QueueDefault),
-	// 	asynq.MaxRetry(RetryDefault),
-	// 	asynq.Timeout(TimeoutMedium),
-	// ))
-	// if err != nil {
-	// 	return fmt.Errorf("failed to register email retry scheduler: %w", err)
-	// }
-	// s.logger.Debug("registered email retry scheduler %s", entryID)
-
 	// // Webhook retry (every 5 minutes)
 	// entryID, err = s.scheduler.Register("*/5 * * * *", asynq.NewTask(
 	// 	TaskTypeWebhookRetry,
@@ -89,31 +85,225 @@ func (s *Scheduler) registerTasks() error {
 	// }
 	// s.logger.Debug("registered webhook retry scheduler %s", entryID)
 
-	// // Domain verification (daily at midnight)
-	// entryID, err = s.scheduler.Register("0 0 * * *", asynq.NewTask(
-	// 	TaskTypeDomainCheck,
-	// 	nil,
-	// 	asynq.Queue(QueueLow),
-	// 	asynq.MaxRetry(RetryMin),
-	// 	asynq.Timeout(TimeoutLong),
-	// ))
-	// if err != nil {
-	// 	return fmt.Errorf("failed to register domain verification scheduler: %w", err)
-	// }
-	// s.logger.Debug("registered domain verification scheduler %s", entryID)
+	// Domain verification (daily at midnight)
+	entryID, err := s.scheduler.Register("0 0 * * *", asynq.NewTask(TaskTypeDomainCheck, nil),
+		asynq.Queue(QueueLow),
+		asynq.MaxRetry(RetryMin),
+		asynq.Timeout(TimeoutLong),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to register domain verification scheduler: %w", err)
+	}
+	s.logger.Debug("registered domain verification scheduler %s", entryID)
 
-	// // Contact sync (every 15 minutes)
-	// entryID, err = s.scheduler.Register("*/15 * * * *", asynq.NewTask(
-	// 	TaskTypeContactSync,
-	// 	nil,
-	// 	asynq.Queue(QueueDefault),
-	// 	asynq.MaxRetry(RetryDefault),
-	// 	asynq.Timeout(TimeoutMedium),
-	// ))
-	// if err != nil {
-	// 	return fmt.Errorf("failed to register contact sync scheduler: %w", err)
-	// }
-	// s.logger.Debug("registered contact sync scheduler %s", entryID)
+	// Bounce mailbox polling (every 5 minutes)
+	entryID, err = s.scheduler.Register("*/5 * * * *", asynq.NewTask(TaskTypeBouncePoll, nil),
+		asynq.Queue(QueueDefault),
+		asynq.MaxRetry(RetryMin),
+		asynq.Timeout(TimeoutMedium),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to register bounce poll scheduler: %w", err)
+	}
+	s.logger.Debug("registered bounce poll scheduler %s", entryID)
+
+	// Inbox sync (every 5 minutes)
+	entryID, err = s.scheduler.Register("*/5 * * * *", asynq.NewTask(TaskTypeInboxSync, nil),
+		asynq.Queue(QueueLow),
+		asynq.MaxRetry(RetryMin),
+		asynq.Timeout(TimeoutMedium),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to register inbox sync scheduler: %w", err)
+	}
+	s.logger.Debug("registered inbox sync scheduler %s", entryID)
+
+	// Inbox snoozes and follow-ups (every minute)
+	entryID, err = s.scheduler.Register("* * * * *", asynq.NewTask(TaskTypeInboxRemind, nil),
+		asynq.Queue(QueueDefault),
+		asynq.MaxRetry(RetryMin),
+		asynq.Timeout(TimeoutShort),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to register inbox reminders scheduler: %w", err)
+	}
+	s.logger.Debug("registered inbox reminders scheduler %s", entryID)
+
+	// Contact sync (every 15 minutes)
+	entryID, err = s.scheduler.Register("*/15 * * * *", asynq.NewTask(TaskTypeContactSync, nil),
+		asynq.Queue(QueueDefault),
+		asynq.MaxRetry(RetryDefault),
+		asynq.Timeout(TimeoutMedium),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to register contact sync scheduler: %w", err)
+	}
+	s.logger.Debug("registered contact sync scheduler %s", entryID)
+
+	// Contact dedupe (daily at 03:00)
+	entryID, err = s.scheduler.Register("0 3 * * *", asynq.NewTask(TaskTypeContactDedupe, nil),
+		asynq.Queue(QueueLow),
+		asynq.MaxRetry(RetryMin),
+		asynq.Timeout(TimeoutLong),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to register contact dedupe scheduler: %w", err)
+	}
+	s.logger.Debug("registered contact dedupe scheduler %s", entryID)
+
+	// Lead scores (20 minutes past every hour, which also decays them)
+	entryID, err = s.scheduler.Register("20 * * * *", asynq.NewTask(TaskTypeLeadScores, nil),
+		asynq.Queue(QueueLow),
+		asynq.MaxRetry(RetryMin),
+		asynq.Timeout(TimeoutLong),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to register lead scores scheduler: %w", err)
+	}
+	s.logger.Debug("registered lead scores scheduler %s", entryID)
+
+	// Quota digest (daily at 08:00)
+	entryID, err = s.scheduler.Register("0 8 * * *", asynq.NewTask(TaskTypeQuotaDigest, nil),
+		asynq.Queue(QueueLow),
+		asynq.MaxRetry(RetryMin),
+		asynq.Timeout(TimeoutMedium),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to register quota digest scheduler: %w", err)
+	}
+	s.logger.Debug("registered quota digest scheduler %s", entryID)
+
+	// Campaign alert rules (every 15 minutes)
+	entryID, err = s.scheduler.Register("*/15 * * * *", asynq.NewTask(TaskTypeCampaignAlerts, nil),
+		asynq.Queue(QueueDefault),
+		asynq.MaxRetry(RetryMin),
+		asynq.Timeout(TimeoutMedium),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to register campaign alerts scheduler: %w", err)
+	}
+	s.logger.Debug("registered campaign alerts scheduler %s", entryID)
+
+	// Email retry (every 5 minutes)
+	entryID, err = s.scheduler.Register("*/5 * * * *", asynq.NewTask(TaskTypeEmailRetry, nil),
+		asynq.Queue(QueueDefault),
+		asynq.MaxRetry(RetryMin),
+		asynq.Timeout(TimeoutMedium),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to register email retry scheduler: %w", err)
+	}
+	s.logger.Debug("registered email retry scheduler %s", entryID)
+
+	// Email pipeline SLA checks (every 5 minutes)
+	entryID, err = s.scheduler.Register("*/5 * * * *", asynq.NewTask(TaskTypePipelineSLA, nil),
+		asynq.Queue(QueueDefault),
+		asynq.MaxRetry(RetryMin),
+		asynq.Timeout(TimeoutShort),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to register pipeline sla scheduler: %w", err)
+	}
+	s.logger.Debug("registered pipeline sla scheduler %s", entryID)
+
+	// Email status digests for webhooks (every minute)
+	entryID, err = s.scheduler.Register("* * * * *", asynq.NewTask(TaskTypeEmailStatus, nil),
+		asynq.Queue(QueueDefault),
+		asynq.MaxRetry(RetryMin),
+		asynq.Timeout(TimeoutShort),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to register email status digest scheduler: %w", err)
+	}
+	s.logger.Debug("registered email status digest scheduler %s", entryID)
+
+	// SMTP health checks (every 10 minutes)
+	entryID, err = s.scheduler.Register("*/10 * * * *", asynq.NewTask(TaskTypeSMTPHealthCheck, nil),
+		asynq.Queue(QueueDefault),
+		asynq.MaxRetry(RetryMin),
+		asynq.Timeout(TimeoutMedium),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to register smtp health check scheduler: %w", err)
+	}
+	s.logger.Debug("registered smtp health check scheduler %s", entryID)
+
+	// Analytics rollups (5 minutes past every hour, once the last hour is complete)
+	entryID, err = s.scheduler.Register("5 * * * *", asynq.NewTask(TaskTypeAnalyticsRollup, nil),
+		asynq.Queue(QueueLow),
+		asynq.MaxRetry(RetryDefault),
+		asynq.Timeout(TimeoutLong),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to register analytics rollup scheduler: %w", err)
+	}
+	s.logger.Debug("registered analytics rollup scheduler %s", entryID)
+
+	// Tracking retention (daily at 03:30, after that hour's rollup)
+	entryID, err = s.scheduler.Register("30 3 * * *", asynq.NewTask(TaskTypeTrackingPrune, nil),
+		asynq.Queue(QueueLow),
+		asynq.MaxRetry(RetryMin),
+		asynq.Timeout(TimeoutLong),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to register tracking retention scheduler: %w", err)
+	}
+	s.logger.Debug("registered tracking retention scheduler %s", entryID)
+
+	// Expired workspace exports (50 minutes past every hour)
+	entryID, err = s.scheduler.Register("50 * * * *", asynq.NewTask(TaskTypeWorkspaceExportCleanup, nil),
+		asynq.Queue(QueueLow),
+		asynq.MaxRetry(RetryMin),
+		asynq.Timeout(TimeoutMedium),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to register workspace export cleanup scheduler: %w", err)
+	}
+	s.logger.Debug("registered workspace export cleanup scheduler %s", entryID)
+
+	// API key usage rollup and spike alerts (10 minutes past every hour)
+	entryID, err = s.scheduler.Register("10 * * * *", asynq.NewTask(TaskTypeAPIKeyUsage, nil),
+		asynq.Queue(QueueLow),
+		asynq.MaxRetry(RetryDefault),
+		asynq.Timeout(TimeoutLong),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to register api key usage scheduler: %w", err)
+	}
+	s.logger.Debug("registered api key usage scheduler %s", entryID)
+
+	// Index recommendations from pg_stat_statements (every 6 hours, off the top of the hour)
+	entryID, err = s.scheduler.Register("40 */6 * * *", asynq.NewTask(TaskTypeIndexAdvisor, nil),
+		asynq.Queue(QueueLow),
+		asynq.MaxRetry(RetryMin),
+		asynq.Timeout(TimeoutMedium),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to register index advisor scheduler: %w", err)
+	}
+	s.logger.Debug("registered index advisor scheduler %s", entryID)
+
+	// Monthly analytics reports (01:00 on the 1st, once late events of the last day are in)
+	entryID, err = s.scheduler.Register("0 1 1 * *", asynq.NewTask(TaskTypeAnalyticsReports, nil),
+		asynq.Queue(QueueLow),
+		asynq.MaxRetry(RetryDefault),
+		asynq.Timeout(TimeoutLong),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to register analytics reports scheduler: %w", err)
+	}
+	s.logger.Debug("registered analytics reports scheduler %s", entryID)
+
+	// Postmaster Tools and SNDS reputation (daily at 06:00, once the providers have the last day in)
+	entryID, err = s.scheduler.Register("0 6 * * *", asynq.NewTask(TaskTypeReputationSync, nil),
+		asynq.Queue(QueueLow),
+		asynq.MaxRetry(RetryMin),
+		asynq.Timeout(TimeoutLong),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to register reputation sync scheduler: %w", err)
+	}
+	s.logger.Debug("registered reputation sync scheduler %s", entryID)
 
 	s.logger.Info("registered all periodic tasks")
 	return nil
@@ -121,7 +311,7 @@ func (s *Scheduler) registerTasks() error {
 
 // RegisterCustomTask registers a custom periodic task
 func (s *Scheduler) RegisterCustomTask(spec string, taskType string, payload []byte, opts ...asynq.Option) error {
-	entryID, err := s.scheduler.Register(spec, asynq.NewTask(taskType, payload, opts...))
+	entryID, err := s.scheduler.Register(spec, asynq.NewTask(taskType, payload), opts...)
 	if err != nil {
 		return fmt.Errorf("failed to register custom task: %w", err)
 	}
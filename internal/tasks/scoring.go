@@ -0,0 +1,61 @@
+package tasks
+
+import (
+	"context"
+	"kori/internal/models"
+	"kori/internal/utils"
+	"sort"
+	"time"
+)
+
+// scoreContacts runs the audience through the team's scoring endpoint, dropping excluded
+// contacts and ordering the rest by priority. Without an endpoint the contacts are returned as is.
+func (h *TaskHandler) scoreContacts(ctx context.Context, campaign *models.Campaign, contacts []models.Contact) ([]models.Contact, error) {
+	if campaign.SkipScoring || len(contacts) == 0 {
+		return contacts, nil
+	}
+
+	endpoint, err := models.GetScoringEndpoint(campaign.TeamID, h.db)
+	if err != nil {
+		return nil, h.logger.Error("❌ failed to get scoring endpoint: %w", err)
+	}
+	if endpoint == nil {
+		return contacts, nil
+	}
+
+	features, err := models.GetContactFeatures(contacts, h.db)
+	if err != nil {
+		return nil, h.logger.Error("❌ failed to build contact features: %w", err)
+	}
+
+	scores, scoreErr := utils.ScoreContacts(ctx, endpoint, campaign, features)
+
+	status := map[string]interface{}{"last_called_at": time.Now(), "last_error": ""}
+	if scoreErr != nil {
+		status["last_error"] = scoreErr.Error()
+	}
+	h.db.Model(&models.ScoringEndpoint{}).Where("id = ?", endpoint.ID).Updates(status)
+
+	if scoreErr != nil {
+		if endpoint.FailOpen {
+			h.logger.Warn("⚠️ Scoring endpoint failed for campaign %s, sending to the full audience: %v", campaign.ID, scoreErr)
+			return contacts, nil
+		}
+		return nil, h.logger.Error("❌ scoring endpoint failed: %w", scoreErr)
+	}
+
+	scored := contacts[:0]
+	for _, contact := range contacts {
+		if scores[contact.ID].Exclude {
+			continue
+		}
+		scored = append(scored, contact)
+	}
+	sort.SliceStable(scored, func(i, j int) bool {
+		return scores[scored[i].ID].Priority > scores[scored[j].ID].Priority
+	})
+
+	h.logger.Info("🎯 Scoring endpoint excluded %d of %d contacts for campaign %s",
+		len(contacts)-len(scored), len(contacts), campaign.ID)
+	return scored, nil
+}
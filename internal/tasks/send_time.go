@@ -0,0 +1,113 @@
+package tasks
+
+import (
+	"context"
+	"kori/internal/models"
+	"kori/internal/utils"
+	"time"
+)
+
+// localSendSpread is how long after a local send time the emails due at it are spread over
+const localSendSpread = 15 * time.Minute
+
+// scheduleSendTimes sets the send time of each email of a campaign that sends per recipient
+func (h *TaskHandler) scheduleSendTimes(campaign *models.Campaign, contacts []models.Contact, emails []*models.Email) error {
+	if campaign.LocalSendTime != "" {
+		return h.scheduleLocalTime(campaign, contacts, emails)
+	}
+	return h.scheduleSmartSend(campaign, emails)
+}
+
+// scheduleSmartSend sets each email's send time to the hour of the next day its contact is most
+// likely to engage, from their own opens and clicks or the team's when they have too few.
+// Emails sharing an hour are spread over it so they don't all go out at once.
+func (h *TaskHandler) scheduleSmartSend(campaign *models.Campaign, emails []*models.Email) error {
+	contactIDs := make([]string, len(emails))
+	for i, email := range emails {
+		contactIDs[i] = email.ContactID
+	}
+
+	profiles, team, err := models.GetSendTimeProfiles(campaign.TeamID, contactIDs, h.db)
+	if err != nil {
+		return h.logger.Error("❌ failed to get send time profiles: %w", err)
+	}
+
+	now := time.Now()
+	slots := make(map[time.Time][]*models.Email)
+	for _, email := range emails {
+		profile, ok := profiles[email.ContactID]
+		if !ok {
+			profile = team
+		}
+		slot := profile.NextSendTime(now)
+		slots[slot] = append(slots[slot], email)
+	}
+
+	// The current hour only has what's left of it to spread over
+	spreadSlots(slots, func(slot time.Time) time.Duration {
+		return slot.Truncate(time.Hour).Add(time.Hour).Sub(slot)
+	})
+
+	h.logger.Info("🕒 Scheduled %d emails of campaign %s over %d send times", len(emails), campaign.ID, len(slots))
+	return nil
+}
+
+// scheduleLocalTime shards the emails by their contact's timezone and sets each shard's send
+// time to the next time the clock reads the campaign's local send time there. Contacts whose
+// timezone isn't known are sent to at that time in the campaign's timezone.
+func (h *TaskHandler) scheduleLocalTime(campaign *models.Campaign, contacts []models.Contact, emails []*models.Email) error {
+	locations, err := models.GetContactLocations(contacts, campaign.CampaignLocation(), h.db)
+	if err != nil {
+		return h.logger.Error("❌ failed to get contact timezones: %w", err)
+	}
+
+	now := time.Now()
+	slots := make(map[time.Time][]*models.Email)
+	for i, email := range emails {
+		slot, err := models.NextLocalTime(now, campaign.LocalSendTime, locations[contacts[i].ID])
+		if err != nil {
+			return h.logger.Error("❌ failed to schedule email: %w", err)
+		}
+		// Keyed in UTC so timezones sharing an offset share a slot
+		slots[slot.UTC()] = append(slots[slot.UTC()], email)
+	}
+
+	spreadSlots(slots, func(time.Time) time.Duration { return localSendSpread })
+
+	h.logger.Info("🌍 Scheduled %d emails of campaign %s at %s local time over %d send times",
+		len(emails), campaign.ID, campaign.LocalSendTime, len(slots))
+	return nil
+}
+
+// spreadSlots spreads the emails due at each slot evenly over the span following it
+func spreadSlots(slots map[time.Time][]*models.Email, span func(slot time.Time) time.Duration) {
+	for slot, emails := range slots {
+		length := span(slot)
+		for i, email := range emails {
+			email.SendAt = slot.Add(length * time.Duration(i) / time.Duration(len(emails)))
+		}
+	}
+}
+
+// enqueueScheduledEmails enqueues a delayed send task per email, due at the email's send time.
+// Emails that can't be enqueued are handed to the retry sweep for their send time.
+func (h *TaskHandler) enqueueScheduledEmails(ctx context.Context, emails []*models.Email, smtpConfig *models.SMTPConfig) {
+	for _, email := range emails {
+		if err := h.taskClient.EnqueueEmailTask(ctx, EmailTask{
+			EmailID:      email.ID,
+			SMTPConfigID: smtpConfig.ID,
+			MaxSendRate:  smtpConfig.MaxSendRate,
+			CampaignID:   email.CampaignID,
+			SendAt:       email.SendAt,
+		}); err != nil {
+			h.logger.Warn("⚠️ Failed to enqueue email %s, leaving it to the retry sweep: %v", email.ID, err)
+			next := email.SendAt
+			h.db.Model(&models.Email{}).Where("id = ?", email.ID).Updates(map[string]interface{}{
+				"status":        models.EmailStatusFailed,
+				"error":         err.Error(),
+				"error_class":   string(utils.SendErrorTransient),
+				"next_retry_at": &next,
+			})
+		}
+	}
+}
@@ -3,6 +3,7 @@ package tasks
 import (
 	"context"
 	"fmt"
+	"kori/internal/tasks/embedded"
 	"kori/internal/utils/logger"
 
 	"github.com/hibiken/asynq"
@@ -10,20 +11,37 @@ import (
 
 // Server handles task processing
 type Server struct {
-	server  *asynq.Server
-	handler *TaskHandler
-	logger  *logger.Logger
+	server    taskServer
+	inspector queueInspector
+	handler   *TaskHandler
+	logger    *logger.Logger
 }
 
-// NewServer creates a new task processing server
+// NewServer creates a new task processing server, running the embedded queue's tasks when
+// redisAddr is empty
 func NewServer(redisAddr, username, password string, db int, handler *TaskHandler, logger *logger.Logger) *Server {
+	if redisAddr == "" {
+		return &Server{
+			server: embedded.NewServer(embedded.Default(), embedded.Config{
+				Concurrency:    10,
+				Queues:         []string{QueueCritical, QueueDefault, QueueLow},
+				IsFailure:      isTaskFailure,
+				RetryDelayFunc: taskRetryDelay,
+			}),
+			inspector: embedded.Default(),
+			handler:   handler,
+			logger:    logger,
+		}
+	}
+
+	redisOpt := asynq.RedisClientOpt{
+		Addr:     redisAddr,
+		Username: username,
+		Password: password,
+		DB:       db,
+	}
 	server := asynq.NewServer(
-		asynq.RedisClientOpt{
-			Addr:     redisAddr,
-			Username: username,
-			Password: password,
-			DB:       db,
-		},
+		redisOpt,
 		asynq.Config{
 			// Specify how many concurrent workers to use
 			Concurrency: 10,
@@ -35,31 +53,67 @@ func NewServer(redisAddr, username, password string, db int, handler *TaskHandle
 			},
 			// Enable strict priority, meaning higher priority queues are processed first
 			StrictPriority: true,
+			// Tasks deferred because their team is at its in-flight limit neither fail nor wait long
+			IsFailure:      isTaskFailure,
+			RetryDelayFunc: taskRetryDelay,
 		},
 	)
 
 	return &Server{
-		server:  server,
-		handler: handler,
-		logger:  logger,
+		server:    server,
+		inspector: asynq.NewInspector(redisOpt),
+		handler:   handler,
+		logger:    logger,
 	}
 }
 
 // Start starts the task processing server
 func (s *Server) Start(ctx context.Context) error {
+	// Tasks of a deploy this worker can't process would only fail on it
+	if err := checkQueuedPayloads(s.inspector); err != nil {
+		return err
+	}
+
 	mux := asynq.NewServeMux()
+	mux.Use(s.handler.checkPayloadVersion)
+	mux.Use(s.handler.holdDuringMaintenance)
 
 	// Register task handlers
 	mux.HandleFunc(TaskTypeEmailSend, s.handler.HandleEmailSend)
-	mux.HandleFunc(TaskTypeEmailRetry, s.handler.HandleEmailSend)
+	mux.HandleFunc(TaskTypeEmailRetry, s.handler.HandleEmailRetry)
+	mux.HandleFunc(TaskTypeBouncePoll, s.handler.HandleBouncePoll)
+	mux.HandleFunc(TaskTypeInboxSync, s.handler.HandleInboxSync)
+	mux.HandleFunc(TaskTypeInboxRemind, s.handler.HandleInboxReminders)
+	mux.HandleFunc(TaskTypeSMTPHealthCheck, s.handler.HandleSMTPHealthCheck)
+	mux.HandleFunc(TaskTypePipelineSLA, s.handler.HandlePipelineSLA)
+	mux.HandleFunc(TaskTypeEmailStatus, s.handler.HandleEmailStatusDigest)
+	mux.HandleFunc(TaskTypeSMSFallback, s.handler.HandleSMSFallback)
 	mux.HandleFunc(TaskTypeCampaignProcess, s.handler.HandleCampaignProcess)
+	mux.HandleFunc(TaskTypeCampaignABWinner, s.handler.HandleABWinner)
+	mux.HandleFunc(TaskTypeCampaignSampleCheck, s.handler.HandleSampleCheck)
 	// mux.HandleFunc(TaskTypeCampaignSchedule, s.handler.HandleCampaignProcess)
-	// mux.HandleFunc(TaskTypeWebhookDelivery, s.handler.HandleWebhookDelivery)
+	mux.HandleFunc(TaskTypeWebhookDelivery, s.handler.HandleWebhookDelivery)
 	// mux.HandleFunc(TaskTypeWebhookRetry, s.handler.HandleWebhookDelivery)
-	// mux.HandleFunc(TaskTypeDomainVerification, s.handler.HandleDomainVerification)
-	// mux.HandleFunc(TaskTypeDomainCheck, s.handler.HandleDomainVerification)
+	mux.HandleFunc(TaskTypeDomainVerification, s.handler.HandleDomainVerification)
+	mux.HandleFunc(TaskTypeDomainCheck, s.handler.HandleDomainVerification)
 	mux.HandleFunc(TaskTypeContactImport, s.handler.HandleContactImport)
-	// mux.HandleFunc(TaskTypeLLMEmailWriter, s.handler.HandleLLMEmailWriter)
+	mux.HandleFunc(TaskTypeContactSync, s.handler.HandleContactSync)
+	mux.HandleFunc(TaskTypeContactDedupe, s.handler.HandleContactDedupe)
+	mux.HandleFunc(TaskTypeContactTimeline, s.handler.HandleContactTimelineExport)
+	mux.HandleFunc(TaskTypeContactConfirm, s.handler.HandleContactConfirmation)
+	mux.HandleFunc(TaskTypeLeadScores, s.handler.HandleLeadScores)
+	mux.HandleFunc(TaskTypeLLMEmailWriter, s.handler.HandleLLMEmailWriter)
+	mux.HandleFunc(TaskTypeQuotaDigest, s.handler.HandleQuotaDigest)
+	mux.HandleFunc(TaskTypeCampaignAlerts, s.handler.HandleCampaignAlerts)
+	mux.HandleFunc(TaskTypeAnalyticsReports, s.handler.HandleAnalyticsReports)
+	mux.HandleFunc(TaskTypeAnalyticsRollup, s.handler.HandleAnalyticsRollup)
+	mux.HandleFunc(TaskTypeTrackingPrune, s.handler.HandleTrackingRetention)
+	mux.HandleFunc(TaskTypeAPIKeyUsage, s.handler.HandleAPIKeyUsage)
+	mux.HandleFunc(TaskTypeIndexAdvisor, s.handler.HandleIndexAdvisor)
+	mux.HandleFunc(TaskTypeReputationSync, s.handler.HandleReputationSync)
+	mux.HandleFunc(TaskTypeAutomationStep, s.handler.HandleAutomationStep)
+	mux.HandleFunc(TaskTypeWorkspacePurge, s.handler.HandleWorkspacePurge)
+	mux.HandleFunc(TaskTypeWorkspaceExportCleanup, s.handler.HandleWorkspaceExportCleanup)
 
 	s.logger.Info("starting task processing server concurrency %d queues %v", 10, map[string]int{
 		QueueCritical: 6,
@@ -0,0 +1,169 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"kori/internal/models"
+	"kori/internal/utils"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// HandleSMSFallback texts the contact of a transactional email that hard bounced, when the
+// email's category has a fallback rule and the contact a phone number the team can text
+func (h *TaskHandler) HandleSMSFallback(ctx context.Context, t *asynq.Task) error {
+	var task SMSFallbackTask
+	if err := decodeTask(t, &task); err != nil {
+		return fmt.Errorf("failed to unmarshal sms fallback task: %w", asynq.SkipRetry)
+	}
+	db := h.db.WithContext(ctx)
+
+	email := &models.Email{}
+	if err := db.Where("id = ? AND is_deleted = false", task.EmailID).First(email).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return h.logger.Error("❌ failed to get bounced email: %w", err)
+	}
+	// Only transactional emails are critical enough to text
+	if email.CampaignID != "" || email.AutomationID != "" || email.Test || email.Status != models.EmailStatusBounced {
+		return nil
+	}
+
+	rule, err := models.GetSMSFallbackRule(email.TeamID, email.CategoryID, db)
+	if err != nil {
+		return h.logger.Error("❌ failed to get sms fallback rule: %w", err)
+	}
+	if rule == nil {
+		return nil
+	}
+
+	message := &models.SMSMessage{}
+	err = db.Where("email_id = ?", email.ID).First(message).Error
+	switch {
+	case err == nil && message.Status == models.SMSMessageStatusSent:
+		return nil
+	case err == nil && message.To == "":
+		// Erased on the data subject's request
+		return nil
+	case err == nil:
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		if message, err = h.newFallbackSMS(db, email, rule); err != nil || message == nil {
+			return err
+		}
+	default:
+		return h.logger.Error("❌ failed to get fallback sms: %w", err)
+	}
+
+	config, err := models.GetSMSConfig(email.TeamID, message.SMSConfigID, db)
+	if err != nil {
+		return h.logger.Error("❌ failed to get sms config: %w", err)
+	}
+	if config == nil {
+		return h.failFallbackSMS(db, message, "the sms config is no longer active")
+	}
+
+	providerID, sendErr := utils.SendSMS(config, &utils.SMSMessage{
+		ID:      message.ID,
+		EmailID: email.ID,
+		From:    config.FromNumber,
+		To:      message.To,
+		Body:    message.Body,
+	})
+	if sendErr != nil {
+		if err := h.failFallbackSMS(db, message, sendErr.Error()); err != nil {
+			return err
+		}
+		// Retried until the task runs out of attempts, the failure kept on the message meanwhile
+		return h.logger.Error("❌ failed to send fallback sms: %w", sendErr)
+	}
+
+	now := time.Now()
+	if err := db.Model(&models.SMSMessage{}).Where("id = ?", message.ID).Updates(map[string]interface{}{
+		"status":              models.SMSMessageStatusSent,
+		"provider_message_id": providerID,
+		"error":               "",
+		"attempts":            gorm.Expr("attempts + 1"),
+		"sent_at":             now,
+	}).Error; err != nil {
+		return h.logger.Error("❌ failed to update fallback sms: %w", err)
+	}
+
+	h.logger.Success("📱 Texted %s in place of bounced email %s", message.To, email.ID)
+	return nil
+}
+
+// newFallbackSMS stores the text standing in for a bounced email, rendered from the rule with the
+// email's and its contact's variables. It returns nil when the contact has no number to text or
+// the team no SMS channel.
+func (h *TaskHandler) newFallbackSMS(db *gorm.DB, email *models.Email, rule *models.SMSFallbackRule) (*models.SMSMessage, error) {
+	contactID, phone, err := models.GetFallbackPhone(email, db)
+	if err != nil {
+		return nil, h.logger.Error("❌ failed to get fallback phone: %w", err)
+	}
+	if phone == "" {
+		h.logger.Info("⏭️ No phone number to text for bounced email %s", email.ID)
+		return nil, nil
+	}
+	config, err := models.GetSMSConfig(email.TeamID, rule.SMSConfigID, db)
+	if err != nil {
+		return nil, h.logger.Error("❌ failed to get sms config: %w", err)
+	}
+	if config == nil {
+		h.logger.Warn("⚠️ Team %s has a fallback rule but no active sms config", email.TeamID)
+		return nil, nil
+	}
+
+	variables := map[string]string{}
+	if len(email.Data) > 0 {
+		if data, err := utils.JSONToVariables(email.Data); err == nil {
+			variables = data
+		}
+	}
+	if contactID != "" {
+		contact := &models.Contact{}
+		if err := db.Where("id = ?", contactID).First(contact).Error; err == nil {
+			for name, value := range contact.TemplateVariables() {
+				variables[name] = value
+			}
+		}
+	}
+	variables["subject"] = email.Subject
+
+	message := &models.SMSMessage{
+		TeamID:      email.TeamID,
+		EmailID:     email.ID,
+		ContactID:   contactID,
+		RuleID:      rule.ID,
+		SMSConfigID: config.ID,
+		To:          phone,
+		Body:        utils.RenderSMS(rule.Message, variables),
+		Status:      models.SMSMessageStatusQueued,
+	}
+	// A redelivered task finds the message stored by the first
+	result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(message)
+	if result.Error != nil {
+		return nil, h.logger.Error("❌ failed to store fallback sms: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		if err := db.Where("email_id = ?", email.ID).First(message).Error; err != nil {
+			return nil, h.logger.Error("❌ failed to get fallback sms: %w", err)
+		}
+	}
+	return message, nil
+}
+
+func (h *TaskHandler) failFallbackSMS(db *gorm.DB, message *models.SMSMessage, reason string) error {
+	if err := db.Model(&models.SMSMessage{}).Where("id = ?", message.ID).Updates(map[string]interface{}{
+		"status":   models.SMSMessageStatusFailed,
+		"error":    reason,
+		"attempts": gorm.Expr("attempts + 1"),
+	}).Error; err != nil {
+		return h.logger.Error("❌ failed to update fallback sms: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package tasks
+
+import (
+	"context"
+	"kori/internal/events"
+	"kori/internal/models"
+	"kori/internal/utils"
+	"sync"
+	"time"
+
+	"github.com/hibiken/asynq"
+)
+
+// smtpHealthConcurrency is how many SMTP servers are checked at once
+const smtpHealthConcurrency = 10
+
+// HandleSMTPHealthCheck connects and authenticates to every active SMTP config. Configs that
+// fail SMTPHealthFailureThreshold checks in a row are marked unhealthy and the campaigns
+// sending through them are paused; a later successful check marks them healthy again.
+func (h *TaskHandler) HandleSMTPHealthCheck(ctx context.Context, t *asynq.Task) error {
+	var configs []models.SMTPConfig
+	if err := h.db.Where("is_active = true AND is_deleted = false").Find(&configs).Error; err != nil {
+		return h.logger.Error("❌ failed to get smtp configs: %w", err)
+	}
+
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, smtpHealthConcurrency)
+	for i := range configs {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(config *models.SMTPConfig) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			h.checkSMTPConfig(ctx, config)
+		}(&configs[i])
+	}
+	wg.Wait()
+
+	h.logger.Info("🩺 Checked %d SMTP configs", len(configs))
+	return nil
+}
+
+// checkSMTPConfig runs one health check and records the outcome
+func (h *TaskHandler) checkSMTPConfig(ctx context.Context, config *models.SMTPConfig) {
+	now := time.Now()
+	checkErr := utils.CheckSMTPConnection(config)
+
+	if checkErr == nil {
+		if err := h.db.Model(&models.SMTPConfig{}).Where("id = ?", config.ID).Updates(map[string]interface{}{
+			"is_healthy":            true,
+			"health_check_failures": 0,
+			"last_health_check_at":  now,
+			"last_health_error":     "",
+		}).Error; err != nil {
+			h.logger.Warn("⚠️ Failed to save health of smtp config %s: %v", config.ID, err)
+			return
+		}
+		if !config.IsHealthy {
+			h.logger.Success("✅ SMTP config %s (%s) is healthy again", config.ID, config.Host)
+			events.Emit("smtp_config.recovered", map[string]interface{}{
+				"smtpConfigId": config.ID,
+				"teamId":       config.TeamID,
+				"host":         config.Host,
+			})
+		}
+		return
+	}
+
+	failures := config.HealthCheckFailures + 1
+	unhealthy := config.IsHealthy && failures >= models.SMTPHealthFailureThreshold
+	updates := map[string]interface{}{
+		"health_check_failures": failures,
+		"last_health_check_at":  now,
+		"last_health_error":     checkErr.Error(),
+	}
+	if unhealthy {
+		updates["is_healthy"] = false
+	}
+	if err := h.db.Model(&models.SMTPConfig{}).Where("id = ?", config.ID).Updates(updates).Error; err != nil {
+		h.logger.Warn("⚠️ Failed to save health of smtp config %s: %v", config.ID, err)
+		return
+	}
+	h.logger.Warn("⚠️ Health check %d failed for smtp config %s (%s): %v", failures, config.ID, config.Host, checkErr)
+
+	if !unhealthy {
+		return
+	}
+
+	paused, err := models.PauseCampaignsUsingSMTPConfig(config.ID, h.db.WithContext(ctx))
+	if err != nil {
+		h.logger.Warn("⚠️ Failed to pause campaigns of smtp config %s: %v", config.ID, err)
+	}
+	campaignIDs := make([]string, len(paused))
+	for i := range paused {
+		campaignIDs[i] = paused[i].ID
+	}
+
+	h.logger.Warn("⛔ SMTP config %s (%s) marked unhealthy, paused %d campaigns", config.ID, config.Host, len(paused))
+	events.Emit("smtp_config.unhealthy", map[string]interface{}{
+		"smtpConfigId": config.ID,
+		"teamId":       config.TeamID,
+		"host":         config.Host,
+		"failures":     failures,
+		"error":        checkErr.Error(),
+		"campaignIds":  campaignIDs,
+	})
+}
@@ -5,16 +5,29 @@ import "time"
 // Task Types
 const (
 	// Email related tasks
-	TaskTypeEmailSend  = "email:send"
-	TaskTypeEmailRetry = "email:retry"
+	TaskTypeEmailSend   = "email:send"
+	TaskTypeEmailRetry  = "email:retry"
+	TaskTypeBouncePoll  = "email:bounce_poll"
+	TaskTypeInboxSync   = "email:inbox_sync"
+	TaskTypeInboxRemind = "email:inbox_reminders"
+	TaskTypePipelineSLA = "email:pipeline_sla"
+	TaskTypeEmailStatus = "email:status_digest"
+	TaskTypeSMSFallback = "email:sms_fallback"
+
+	// SMTP related tasks
+	TaskTypeSMTPHealthCheck = "smtp:health_check"
 
 	// Campaign related tasks
 	TaskTypeCampaignProcess  = "campaign:process"
 	TaskTypeCampaignSchedule = "campaign:schedule"
 
 	// Contact related tasks
-	TaskTypeContactImport = "contact:import"
-	TaskTypeContactSync   = "contact:sync"
+	TaskTypeContactImport   = "contact:import"
+	TaskTypeContactSync     = "contact:sync"
+	TaskTypeContactDedupe   = "contact:dedupe"
+	TaskTypeContactTimeline = "contact:timeline_export"
+	TaskTypeContactConfirm  = "contact:confirmation"
+	TaskTypeLeadScores      = "contact:lead_scores"
 
 	// Webhook related tasks
 	TaskTypeWebhookDelivery = "webhook:delivery"
@@ -29,6 +42,39 @@ const (
 
 	// Queue related tasks
 	TaskTypeQueueConfig = "queue:config"
+
+	// Quota related tasks
+	TaskTypeQuotaDigest = "quota:digest"
+
+	// Alert related tasks
+	TaskTypeCampaignAlerts = "campaign:alerts"
+
+	// A/B test related tasks
+	TaskTypeCampaignABWinner = "campaign:ab_winner"
+
+	// Sample first related tasks
+	TaskTypeCampaignSampleCheck = "campaign:sample_check"
+
+	// Automation related tasks
+	TaskTypeAutomationStep = "automation:step"
+
+	// Workspace related tasks
+	TaskTypeWorkspacePurge         = "workspace:purge"
+	TaskTypeWorkspaceExportCleanup = "workspace:export_cleanup"
+
+	// Analytics related tasks
+	TaskTypeAnalyticsReports = "analytics:reports"
+	TaskTypeAnalyticsRollup  = "analytics:rollup"
+	TaskTypeTrackingPrune    = "analytics:tracking_retention"
+
+	// API key related tasks
+	TaskTypeAPIKeyUsage = "api_keys:usage"
+
+	// Diagnostics related tasks
+	TaskTypeIndexAdvisor = "diagnostics:index_advisor"
+
+	// Deliverability related tasks
+	TaskTypeReputationSync = "deliverability:reputation_sync"
 )
 
 // Task Queues
@@ -63,25 +109,61 @@ const (
 
 // Task Payloads
 type EmailTask struct {
+	TaskVersion
 	EmailID      string    `json:"email_id"`
 	AttemptNum   int       `json:"attempt_num"`
 	LastAttempt  time.Time `json:"last_attempt,omitempty"`
 	Error        string    `json:"error,omitempty"`
 	SMTPConfigID string    `json:"smtp_config_id"`
+	CampaignID   string    `json:"campaign_id,omitempty"` // campaign emails go through the default queue, behind transactional mail
 	MaxSendRate  int       `json:"max_send_rate"`
 	SendAt       time.Time `json:"send_at,omitempty"`
+	EnqueuedAt   time.Time `json:"enqueued_at,omitempty"` // for the pipeline's time-in-queue metrics
 }
 
 type CampaignTask struct {
+	TaskVersion
 	CampaignID     string                 `json:"campaign_id"`
 	BatchSize      int                    `json:"batch_size"`
 	Offset         int                    `json:"offset"`
 	Parameters     map[string]interface{} `json:"parameters,omitempty"`
 	ScheduledAt    time.Time              `json:"scheduled_at,omitempty"`
 	CronExpression string                 `json:"cron_expression,omitempty"`
+	ShiftedFrom    string                 `json:"shifted_from,omitempty"` // blackout date a recurring run was moved from
+	Remainder      bool                   `json:"remainder,omitempty"`    // sends the A/B test winner, or a healthy sample's campaign, to the rest of the audience
+}
+
+type ABWinnerTask struct {
+	TaskVersion
+	CampaignID string `json:"campaign_id"`
+}
+
+type SMSFallbackTask struct {
+	TaskVersion
+	EmailID string `json:"email_id"` // the email that hard bounced
+}
+
+type SampleCheckTask struct {
+	TaskVersion
+	CampaignID string `json:"campaign_id"`
+}
+
+type AutomationStepTask struct {
+	TaskVersion
+	RunID string `json:"run_id"`
+	Step  int    `json:"step"` // the run's step count when scheduled, so duplicate deliveries are dropped
+	// the end of the pause a step was put off to, in Unix seconds, so its task doesn't clash with the one put off
+	ResumeAt int64 `json:"resume_at,omitempty"`
+}
+
+type WorkspacePurgeTask struct {
+	TaskVersion
+	DeletionID string `json:"deletion_id"`
+	Attempt    int    `json:"attempt"` // purges that failed are scheduled again under a new task ID
 }
 
 type WebhookDeliveryTask struct {
+	TaskVersion
 	WebhookID   string                 `json:"webhook_id"`
 	Event       string                 `json:"event"`
 	Payload     map[string]interface{} `json:"payload"`
@@ -90,16 +172,35 @@ type WebhookDeliveryTask struct {
 }
 
 type DomainVerificationTask struct {
+	TaskVersion
 	DomainID    string    `json:"domain_id"`
 	LastChecked time.Time `json:"last_checked,omitempty"`
 	DNSRecord   string    `json:"dns_record,omitempty"`
 }
 
 type ContactImportTask struct {
+	TaskVersion
 	ImportID string `json:"import_id"`
 }
 
+type ContactSyncTask struct {
+	TaskVersion
+	SourceID string `json:"source_id"`
+}
+
+type ContactTimelineExportTask struct {
+	TaskVersion
+	ExportID string `json:"export_id"`
+}
+
+type ContactConfirmationTask struct {
+	TaskVersion
+	ContactID string `json:"contact_id"`
+}
+
 type LLMEmailWriterTask struct {
+	TaskVersion
+	JobID       string                 `json:"job_id"`
 	EmailID     string                 `json:"email_id"`
 	TemplateID  string                 `json:"template_id"`
 	UserID      string                 `json:"user_id"`
@@ -0,0 +1,163 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/hibiken/asynq"
+)
+
+// Task payload versions. Bump TaskPayloadVersion whenever the format of a payload changes and
+// register an upgrade from the version before in payloadUpgrades, so that during a blue/green
+// deploy old and new workers each process what they can and leave the rest to the other.
+const (
+	TaskPayloadVersion    = 1
+	MinTaskPayloadVersion = TaskPayloadVersion - 1 // payloads enqueued before versioning are version 0
+)
+
+// newerPayloadDelay is how long a task from a newer deployment waits before a worker tries it again
+const newerPayloadDelay = 30 * time.Second
+
+// ErrNewerPayload is returned by tasks enqueued by a newer deployment than the worker's. The
+// task goes back to the queue without counting as a failed attempt, for a newer worker to take.
+var ErrNewerPayload = errors.New("task payload is newer than this worker")
+
+// payloadUpgrades turn a payload of the version before TaskPayloadVersion into the current
+// format, by task type. Task types whose format didn't change need none.
+var payloadUpgrades = map[string]func(payload map[string]interface{}) error{}
+
+// TaskVersion is embedded in every task payload with the payload version it was enqueued with
+type TaskVersion struct {
+	Version int `json:"payload_version,omitempty"`
+}
+
+func (v *TaskVersion) stampVersion() {
+	v.Version = TaskPayloadVersion
+}
+
+// versionedTask is a task payload carrying a TaskVersion
+type versionedTask interface {
+	stampVersion()
+}
+
+// marshalTask encodes a task payload stamped with the current payload version
+func marshalTask(task versionedTask) ([]byte, error) {
+	task.stampVersion()
+	return json.Marshal(task)
+}
+
+// payloadVersion returns the version of a task payload. Tasks without a payload, like the
+// periodic ones, have nothing to be incompatible with and count as current.
+func payloadVersion(payload []byte) (int, error) {
+	if len(payload) == 0 {
+		return TaskPayloadVersion, nil
+	}
+	var version TaskVersion
+	if err := json.Unmarshal(payload, &version); err != nil {
+		return 0, fmt.Errorf("invalid task payload: %w", err)
+	}
+	return version.Version, nil
+}
+
+// decodeTask decodes a task's payload into task, upgrading payloads of the previous version first
+func decodeTask(t *asynq.Task, task interface{}) error {
+	version, err := payloadVersion(t.Payload())
+	if err != nil {
+		return err
+	}
+
+	payload := t.Payload()
+	if upgrade, ok := payloadUpgrades[t.Type()]; ok && version < TaskPayloadVersion {
+		fields := map[string]interface{}{}
+		if err := json.Unmarshal(payload, &fields); err != nil {
+			return fmt.Errorf("invalid task payload: %w", err)
+		}
+		if err := upgrade(fields); err != nil {
+			return fmt.Errorf("failed to upgrade %s payload from version %d: %w", t.Type(), version, err)
+		}
+		if payload, err = json.Marshal(fields); err != nil {
+			return err
+		}
+	}
+
+	return json.Unmarshal(payload, task)
+}
+
+// checkPayloadVersion lets through the tasks whose payload this worker can process. Tasks from
+// a newer deployment are handed back for its workers, and those too old for any are dropped.
+func (h *TaskHandler) checkPayloadVersion(next asynq.Handler) asynq.Handler {
+	return asynq.HandlerFunc(func(ctx context.Context, t *asynq.Task) error {
+		version, err := payloadVersion(t.Payload())
+		if err != nil {
+			return fmt.Errorf("%v: %w", err, asynq.SkipRetry)
+		}
+		switch {
+		case version > TaskPayloadVersion:
+			return fmt.Errorf("%s task has payload version %d, this worker processes up to %d: %w",
+				t.Type(), version, TaskPayloadVersion, ErrNewerPayload)
+		case version < MinTaskPayloadVersion:
+			h.logger.Warn("⚠️ Dropping %s task with payload version %d, older than %d", t.Type(), version, MinTaskPayloadVersion)
+			return fmt.Errorf("payload version %d is no longer supported: %w", version, asynq.SkipRetry)
+		}
+		return next.ProcessTask(ctx, t)
+	})
+}
+
+// newerPayloadRetryDelay spreads out the retries of tasks handed back for a newer worker
+func newerPayloadRetryDelay() time.Duration {
+	return newerPayloadDelay + time.Duration(rand.Int63n(int64(newerPayloadDelay)))
+}
+
+// queuedPayloadStates are the task states checked before a worker starts
+var queuedPayloadStates = map[string]func(queueInspector, string, ...asynq.ListOption) ([]*asynq.TaskInfo, error){
+	"pending":   queueInspector.ListPendingTasks,
+	"scheduled": queueInspector.ListScheduledTasks,
+	"retry":     queueInspector.ListRetryTasks,
+}
+
+// checkQueuedPayloads refuses to start a worker while tasks it can't process are queued, which
+// means a deploy it isn't compatible with is running or was rolled back too far
+func checkQueuedPayloads(inspector queueInspector) error {
+	const pageSize = 500
+
+	incompatible, oldest, newest := 0, 0, 0
+	for _, queue := range []string{QueueCritical, QueueDefault, QueueLow} {
+		for _, list := range queuedPayloadStates {
+			for page := 1; ; page++ {
+				queued, err := list(inspector, queue, asynq.PageSize(pageSize), asynq.Page(page))
+				if errors.Is(err, asynq.ErrQueueNotFound) {
+					break
+				}
+				if err != nil {
+					return fmt.Errorf("failed to list queued tasks of %s: %w", queue, err)
+				}
+				for _, task := range queued {
+					version, err := payloadVersion(task.Payload)
+					if err != nil {
+						continue // dropped when picked up
+					}
+					if version > TaskPayloadVersion || version < MinTaskPayloadVersion {
+						if incompatible == 0 {
+							oldest, newest = version, version
+						}
+						incompatible++
+						oldest, newest = min(oldest, version), max(newest, version)
+					}
+				}
+				if len(queued) < pageSize {
+					break
+				}
+			}
+		}
+	}
+
+	if incompatible > 0 {
+		return fmt.Errorf("refusing to start: %d queued tasks have payload versions %d to %d, this worker processes %d to %d",
+			incompatible, oldest, newest, MinTaskPayloadVersion, TaskPayloadVersion)
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"kori/internal/events"
+	"kori/internal/models"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"gorm.io/gorm"
+)
+
+// HandleWorkspacePurge starts purging a workspace whose grace period has ended. Deletions that
+// were cancelled, or purged by an earlier delivery, are skipped.
+func (h *TaskHandler) HandleWorkspacePurge(ctx context.Context, t *asynq.Task) error {
+	var task WorkspacePurgeTask
+	if err := decodeTask(t, &task); err != nil {
+		return fmt.Errorf("failed to unmarshal workspace purge task: %w", asynq.SkipRetry)
+	}
+
+	deletion := &models.WorkspaceDeletion{}
+	if err := h.db.Where("id = ? AND is_deleted = false", task.DeletionID).First(deletion).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return h.logger.Error("❌ failed to get workspace deletion: %w", err)
+	}
+
+	if deletion.Status != models.WorkspaceDeletionStatusScheduled || deletion.Attempts != task.Attempt || deletion.PurgeAt.After(time.Now()) {
+		h.logger.Info("⏭️ Skipping purge of workspace deletion %s in status %s", deletion.ID, deletion.Status)
+		return nil
+	}
+
+	// Claim the deletion so a restore racing the purge either wins or fails
+	result := h.db.Model(&models.WorkspaceDeletion{}).
+		Where("id = ? AND status = ?", deletion.ID, models.WorkspaceDeletionStatusScheduled).
+		Update("status", models.WorkspaceDeletionStatusPurging)
+	if result.Error != nil {
+		return h.logger.Error("❌ failed to claim workspace deletion: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil
+	}
+	deletion.Status = models.WorkspaceDeletionStatusPurging
+
+	h.logger.Info("🗑️ Purging workspace of team %s", deletion.TeamID)
+	events.Emit("workspace.purge", deletion)
+	return nil
+}
+
+// HandleWorkspaceExportCleanup triggers deleting the final exports whose links have expired
+func (h *TaskHandler) HandleWorkspaceExportCleanup(ctx context.Context, t *asynq.Task) error {
+	h.logger.Info("🧹 Deleting expired workspace exports")
+	events.Emit("workspace.exports_expired", time.Now().UTC())
+	return nil
+}
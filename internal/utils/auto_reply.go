@@ -0,0 +1,269 @@
+package utils
+
+import (
+	"net/mail"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AutoReplyKind classifies a message a mail client or server sent on its own
+type AutoReplyKind string
+
+const (
+	AutoReplyKindAutoReply   AutoReplyKind = "auto_reply"    // acknowledgements, notifications and list robots
+	AutoReplyKindOutOfOffice AutoReplyKind = "out_of_office" // the recipient is away
+)
+
+// AutoReply is what DetectAutoReply found out about a message
+type AutoReply struct {
+	Kind      AutoReplyKind
+	ReturnsAt time.Time // when someone away said they're back, zero when it couldn't be read
+}
+
+const (
+	// autoReplyScanLength is how much of the body is looked at; the notice comes first
+	autoReplyScanLength = 2000
+	// maxAutoReplyReturn caps how far ahead a stated return date is believed
+	maxAutoReplyReturn = 90 * 24 * time.Hour
+	// autoReplyKeywordWindow is how far before a date its keyword, e.g. back on, is looked for
+	autoReplyKeywordWindow = 40
+)
+
+var (
+	// autoReplySubjects start the subjects of auto-replies, e.g. Outlook's "Automatic reply: ..."
+	autoReplySubjects = []string{
+		"automatic reply", "auto reply", "auto-reply", "autoreply", "auto response", "auto-response",
+		"autoresponse", "automated response", "auto:", "automatische antwort", "réponse automatique",
+		"respuesta automática", "risposta automatica", "resposta automática", "automatisch antwoord",
+	}
+	// outOfOfficeSubjects start the subjects of out of office notices
+	outOfOfficeSubjects = []string{
+		"out of office", "out of the office", "out-of-office", "ooo:", "away from the office",
+		"on vacation", "on holiday", "on leave", "abwesenheitsnotiz", "abwesend", "absence du bureau",
+		"absent", "fuera de la oficina", "fuori ufficio", "afwezig",
+	}
+	// autoReplyPhrases open the bodies of auto-replies without their headers
+	autoReplyPhrases = []string{
+		"this is an automatic reply", "this is an automated reply", "this is an automatic response",
+		"this is an automated response", "this is an auto-reply", "this is an auto-generated",
+		"this is an automatically generated", "this mailbox is not monitored",
+	}
+	// outOfOfficePhrases tell an auto-reply's sender is away
+	outOfOfficePhrases = []string{
+		"out of the office", "out of office", "away from the office", "on vacation", "on holiday",
+		"on annual leave", "on parental leave", "on maternity leave", "on paternity leave", "on leave",
+		"limited access to email", "limited access to my email", "nicht im büro", "abwesend",
+		"absent du bureau", "en congé", "de vacaciones", "fuera de la oficina", "in ferie", "afwezig",
+	}
+	// autoReplyUntilWords come before the last day of an absence, autoReplyBackWords before the
+	// first day back
+	autoReplyUntilWords = []string{"until", "till", "til ", "bis ", "jusqu", "hasta"}
+	autoReplyBackWords  = []string{"back", "return", "available", "reachable", "in the office", "zurück", "retour", "de regreso"}
+	autoReplyThruWords  = []string{"through", "thru", "inclusive"}
+
+	autoReplyMonths = map[string]time.Month{
+		"jan": time.January, "feb": time.February, "mar": time.March, "apr": time.April, "may": time.May,
+		"jun": time.June, "jul": time.July, "aug": time.August, "sep": time.September, "oct": time.October,
+		"nov": time.November, "dec": time.December,
+	}
+	autoReplyWeekdays = map[string]time.Weekday{
+		"monday": time.Monday, "tuesday": time.Tuesday, "wednesday": time.Wednesday, "thursday": time.Thursday,
+		"friday": time.Friday, "saturday": time.Saturday, "sunday": time.Sunday,
+	}
+
+	autoReplyMonthPattern = `(jan|feb|mar|apr|may|jun|jul|aug|sept?|oct|nov|dec)[a-z]*\.?`
+	isoDateRe             = regexp.MustCompile(`\b(\d{4})-(\d{1,2})-(\d{1,2})\b`)
+	numericDateRe         = regexp.MustCompile(`\b(\d{1,2})([./])(\d{1,2})(?:[./](\d{4}|\d{2}))?\b`)
+	dayMonthDateRe        = regexp.MustCompile(`\b(\d{1,2})(?:st|nd|rd|th)?\.?\s+(?:of\s+)?` + autoReplyMonthPattern + `(?:,?\s+(\d{4}))?`)
+	monthDayDateRe        = regexp.MustCompile(`\b` + autoReplyMonthPattern + `\s+(\d{1,2})(?:st|nd|rd|th)?\b(?:,?\s+(\d{4}))?`)
+	weekdayRe             = regexp.MustCompile(`\b(monday|tuesday|wednesday|thursday|friday|saturday|sunday)\b`)
+)
+
+// DetectAutoReply tells whether a received message was sent by a mail client or server rather
+// than a person, from its headers (RFC 3834 Auto-Submitted, Precedence and the vendor headers),
+// its subject and the opening of its body. For out of office notices it reads the stated return
+// date, at 9:00 in the sender's time zone, where it's a date in the next 90 days. It returns nil
+// for messages a person wrote.
+func DetectAutoReply(header mail.Header, subject, body string, received time.Time) *AutoReply {
+	subject = strings.ToLower(strings.TrimSpace(subject))
+	text := strings.ToLower(strings.Join(strings.Fields(body), " "))
+	if len(text) > autoReplyScanLength {
+		text = text[:autoReplyScanLength]
+	}
+
+	away := hasAnyPrefix(subject, outOfOfficeSubjects)
+	if !away && !autoReplyHeaders(header) && !hasAnyPrefix(subject, autoReplySubjects) && !containsAny(text, autoReplyPhrases) {
+		return nil
+	}
+	if !away && !containsAny(subject, outOfOfficePhrases) && !containsAny(text, outOfOfficePhrases) {
+		return &AutoReply{Kind: AutoReplyKindAutoReply}
+	}
+
+	reply := &AutoReply{Kind: AutoReplyKindOutOfOffice}
+	if received.IsZero() {
+		received = time.Now()
+	}
+	if date, ok := autoReplyReturnDate(text, received); ok {
+		reply.ReturnsAt = time.Date(date.Year(), date.Month(), date.Day(), 9, 0, 0, 0, received.Location())
+	}
+	return reply
+}
+
+// autoReplyHeaders reports whether the headers mark a message as automatic
+func autoReplyHeaders(header mail.Header) bool {
+	if header == nil {
+		return false
+	}
+	if value := strings.ToLower(strings.TrimSpace(header.Get("Auto-Submitted"))); value != "" && value != "no" {
+		return true
+	}
+	for _, name := range []string{"X-Autoreply", "X-Autorespond", "X-Autoresponder", "X-Auto-Response", "X-FC-MachineGenerated"} {
+		if header.Get(name) != "" {
+			return true
+		}
+	}
+	for _, name := range []string{"Precedence", "X-Precedence"} {
+		switch strings.ToLower(strings.TrimSpace(header.Get(name))) {
+		case "auto_reply", "bulk", "junk":
+			return true
+		}
+	}
+	return strings.Contains(strings.ToLower(header.Get("X-POST-MessageClass")), "autoresponder")
+}
+
+// autoReplyReturnDate finds the first day back in an out of office notice: a date after a word
+// like back or until, or failing that a weekday after one
+func autoReplyReturnDate(text string, received time.Time) (time.Time, bool) {
+	today := time.Date(received.Year(), received.Month(), received.Day(), 0, 0, 0, 0, received.Location())
+
+	type candidate struct {
+		start int
+		date  time.Time
+	}
+	var candidates []candidate
+	for _, match := range isoDateRe.FindAllStringSubmatchIndex(text, -1) {
+		year, month, day := submatchInt(text, match, 1), submatchInt(text, match, 2), submatchInt(text, match, 3)
+		if date, ok := autoReplyDate(year, month, day, today); ok {
+			candidates = append(candidates, candidate{match[0], date})
+		}
+	}
+	for _, match := range numericDateRe.FindAllStringSubmatchIndex(text, -1) {
+		first, second, year := submatchInt(text, match, 1), submatchInt(text, match, 3), submatchInt(text, match, 4)
+		if year > 0 && year < 100 {
+			year += 2000
+		}
+		day, month := first, second
+		// Dotted dates are day first; slashed ones only when that's the only way they read
+		if text[match[4]:match[5]] == "/" {
+			switch {
+			case first > 12:
+			case second > 12:
+				day, month = second, first
+			default:
+				continue
+			}
+		}
+		if date, ok := autoReplyDate(year, month, day, today); ok {
+			candidates = append(candidates, candidate{match[0], date})
+		}
+	}
+	for _, match := range dayMonthDateRe.FindAllStringSubmatchIndex(text, -1) {
+		day, month, year := submatchInt(text, match, 1), autoReplyMonths[text[match[4]:match[4]+3]], submatchInt(text, match, 3)
+		if date, ok := autoReplyDate(year, int(month), day, today); ok {
+			candidates = append(candidates, candidate{match[0], date})
+		}
+	}
+	for _, match := range monthDayDateRe.FindAllStringSubmatchIndex(text, -1) {
+		month, day, year := autoReplyMonths[text[match[2]:match[2]+3]], submatchInt(text, match, 2), submatchInt(text, match, 3)
+		if date, ok := autoReplyDate(year, int(month), day, today); ok {
+			candidates = append(candidates, candidate{match[0], date})
+		}
+	}
+
+	best, found := candidate{start: len(text)}, false
+	for _, c := range candidates {
+		if date, ok := autoReplyDayBack(text, c.start, c.date); ok && c.start < best.start {
+			best, found = candidate{c.start, date}, true
+		}
+	}
+	if found {
+		return best.date, true
+	}
+
+	for _, match := range weekdayRe.FindAllStringSubmatchIndex(text, -1) {
+		weekday := autoReplyWeekdays[text[match[2]:match[3]]]
+		days := (int(weekday) - int(today.Weekday()) + 7) % 7
+		if days == 0 {
+			days = 7
+		}
+		if date, ok := autoReplyDayBack(text, match[0], today.AddDate(0, 0, days)); ok {
+			return date, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// autoReplyDayBack turns a date into the first day back by the word before it: the day after
+// for through, the day itself for back on or until. Dates without such a word, like the day the
+// absence started, aren't return dates.
+func autoReplyDayBack(text string, start int, date time.Time) (time.Time, bool) {
+	before := text[max(0, start-autoReplyKeywordWindow):start]
+	switch {
+	case containsAny(before, autoReplyThruWords):
+		return date.AddDate(0, 0, 1), true
+	case containsAny(before, autoReplyBackWords), containsAny(before, autoReplyUntilWords):
+		return date, true
+	}
+	return time.Time{}, false
+}
+
+// autoReplyDate builds a date on or after today and within maxAutoReplyReturn of it. Dates
+// without a year are the next ones to come.
+func autoReplyDate(year, month, day int, today time.Time) (time.Time, bool) {
+	if month < 1 || month > 12 || day < 1 || day > 31 {
+		return time.Time{}, false
+	}
+	withoutYear := year == 0
+	if withoutYear {
+		year = today.Year()
+	}
+	date := time.Date(year, time.Month(month), day, 0, 0, 0, 0, today.Location())
+	if date.Day() != day {
+		return time.Time{}, false // e.g. February 30
+	}
+	if withoutYear && date.Before(today) {
+		date = date.AddDate(1, 0, 0)
+	}
+	if date.Before(today) || date.Sub(today) > maxAutoReplyReturn {
+		return time.Time{}, false
+	}
+	return date, true
+}
+
+func submatchInt(text string, match []int, group int) int {
+	if match[2*group] < 0 {
+		return 0
+	}
+	value, _ := strconv.Atoi(text[match[2*group]:match[2*group+1]])
+	return value
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAny(s string, substrings []string) bool {
+	for _, substring := range substrings {
+		if strings.Contains(s, substring) {
+			return true
+		}
+	}
+	return false
+}
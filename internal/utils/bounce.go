@@ -0,0 +1,242 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"regexp"
+	"strings"
+)
+
+// EmailIDHeader is set on outgoing mail so bounces and complaints can be matched back to the email
+const EmailIDHeader = "X-Posthoot-Email-ID"
+
+// BounceType classifies a parsed bounce or complaint
+type BounceType string
+
+const (
+	BounceTypeHard      BounceType = "hard"
+	BounceTypeSoft      BounceType = "soft"
+	BounceTypeComplaint BounceType = "complaint"
+)
+
+// BounceReport is the information extracted from a DSN (RFC 3464) or ARF (RFC 5965) message
+type BounceReport struct {
+	Type         BounceType `json:"type"`
+	Recipient    string     `json:"recipient"`
+	Action       string     `json:"action,omitempty"`
+	Status       string     `json:"status,omitempty"`
+	Diagnostic   string     `json:"diagnostic,omitempty"`
+	FeedbackType string     `json:"feedbackType,omitempty"`
+	EmailID      string     `json:"emailId,omitempty"`
+	MessageID    string     `json:"messageId,omitempty"`
+}
+
+var (
+	dsnStatusRe  = regexp.MustCompile(`\b([245])\.(\d{1,3})\.(\d{1,3})\b`)
+	emailAddrRe  = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+	bounceSubjRe = regexp.MustCompile(`(?i)(undeliver|delivery status notification|delivery (has )?failed|failure notice|returned mail|mail delivery failed)`)
+)
+
+// softBounceStatuses are permanent (5.x.x) codes that are in practice temporary
+var softBounceStatuses = map[string]bool{
+	"5.2.2": true, // mailbox full
+	"5.3.4": true, // message too big
+	"5.4.7": true, // delivery time expired
+}
+
+// ParseBounce extracts a bounce or complaint from a raw message. It returns nil when
+// the message is not a bounce or complaint.
+func ParseBounce(raw []byte) (*BounceReport, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+
+	report := &BounceReport{}
+	mediaType, params, _ := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+
+	if mediaType == "multipart/report" && params["boundary"] != "" {
+		if err := parseReportParts(msg.Body, params["boundary"], report); err != nil {
+			return nil, err
+		}
+	} else {
+		if !looksLikeBounce(msg) {
+			return nil, nil
+		}
+		body, _ := io.ReadAll(io.LimitReader(msg.Body, 1<<20))
+		parseBounceHeuristics(msg.Header, string(body), report)
+	}
+
+	if report.Recipient == "" && report.EmailID == "" {
+		return nil, nil
+	}
+	report.classify()
+	return report, nil
+}
+
+func parseReportParts(body io.Reader, boundary string, report *BounceReport) error {
+	reader := multipart.NewReader(body, boundary)
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		content, err := io.ReadAll(io.LimitReader(decodePart(part), 1<<20))
+		if err != nil {
+			return err
+		}
+
+		partType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		switch partType {
+		case "message/delivery-status", "message/global-delivery-status":
+			fields := parseReportFields(string(content))
+			report.Recipient = firstNonEmpty(report.Recipient, addressFromField(fields["final-recipient"]), addressFromField(fields["original-recipient"]))
+			report.Action = strings.ToLower(fields["action"])
+			report.Status = fields["status"]
+			report.Diagnostic = fields["diagnostic-code"]
+		case "message/feedback-report":
+			fields := parseReportFields(string(content))
+			report.FeedbackType = strings.ToLower(firstNonEmpty(fields["feedback-type"], "abuse"))
+			report.Recipient = firstNonEmpty(report.Recipient, addressFromField(fields["original-rcpt-to"]))
+		case "message/rfc822", "text/rfc822-headers", "message/global", "message/global-headers":
+			parseOriginalHeaders(content, report)
+		}
+	}
+}
+
+// parseOriginalHeaders reads the returned copy of the original message
+func parseOriginalHeaders(content []byte, report *BounceReport) {
+	original, err := mail.ReadMessage(bytes.NewReader(append(content, "\r\n\r\n"...)))
+	if err != nil {
+		return
+	}
+	report.EmailID = firstNonEmpty(report.EmailID, strings.TrimSpace(original.Header.Get(EmailIDHeader)))
+	report.MessageID = firstNonEmpty(report.MessageID, strings.TrimSpace(original.Header.Get("Message-ID")))
+	if report.Recipient == "" {
+		if to, err := mail.ParseAddress(original.Header.Get("To")); err == nil {
+			report.Recipient = to.Address
+		}
+	}
+}
+
+// parseReportFields parses the "Name: value" blocks of a delivery-status or feedback-report part,
+// keeping the first value seen for each field
+func parseReportFields(content string) map[string]string {
+	fields := make(map[string]string)
+	var lastKey string
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			lastKey = ""
+			continue
+		}
+		if (line[0] == ' ' || line[0] == '\t') && lastKey != "" {
+			fields[lastKey] += " " + strings.TrimSpace(line)
+			continue
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		if _, exists := fields[key]; exists {
+			lastKey = ""
+			continue
+		}
+		fields[key] = strings.TrimSpace(value)
+		lastKey = key
+	}
+	return fields
+}
+
+// parseBounceHeuristics handles non-standard bounces that aren't multipart/report
+func parseBounceHeuristics(header mail.Header, body string, report *BounceReport) {
+	report.Recipient = strings.TrimSpace(header.Get("X-Failed-Recipients"))
+	if report.Recipient == "" {
+		if match := emailAddrRe.FindString(body); match != "" {
+			report.Recipient = match
+		}
+	}
+	if match := dsnStatusRe.FindString(body); match != "" {
+		report.Status = match
+	}
+	if idx := strings.Index(body, EmailIDHeader+":"); idx >= 0 {
+		line := body[idx+len(EmailIDHeader)+1:]
+		if end := strings.IndexAny(line, "\r\n"); end >= 0 {
+			line = line[:end]
+		}
+		report.EmailID = strings.TrimSpace(line)
+	}
+}
+
+func looksLikeBounce(msg *mail.Message) bool {
+	from := strings.ToLower(msg.Header.Get("From"))
+	if strings.Contains(from, "mailer-daemon") || strings.Contains(from, "postmaster") {
+		return true
+	}
+	return msg.Header.Get("X-Failed-Recipients") != "" || bounceSubjRe.MatchString(msg.Header.Get("Subject"))
+}
+
+// classify decides between hard and soft bounces from the DSN action and status code
+func (r *BounceReport) classify() {
+	if r.FeedbackType != "" {
+		r.Type = BounceTypeComplaint
+		return
+	}
+	if match := dsnStatusRe.FindString(r.Status); match != "" {
+		r.Status = match
+	}
+	switch {
+	case r.Action == "delayed":
+		r.Type = BounceTypeSoft
+	case strings.HasPrefix(r.Status, "4."):
+		r.Type = BounceTypeSoft
+	case strings.HasPrefix(r.Status, "5.") && !softBounceStatuses[r.Status]:
+		r.Type = BounceTypeHard
+	case strings.HasPrefix(r.Status, "5."):
+		r.Type = BounceTypeSoft
+	case r.Action == "failed":
+		r.Type = BounceTypeHard
+	default:
+		// Without a status code we can't tell, so don't suppress the address
+		r.Type = BounceTypeSoft
+	}
+}
+
+func decodePart(part *multipart.Part) io.Reader {
+	switch strings.ToLower(part.Header.Get("Content-Transfer-Encoding")) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, part)
+	case "quoted-printable":
+		return quotedprintable.NewReader(part)
+	}
+	return part
+}
+
+// addressFromField extracts the address from "rfc822; user@example.com"
+func addressFromField(value string) string {
+	if _, address, ok := strings.Cut(value, ";"); ok {
+		value = address
+	}
+	return strings.Trim(strings.TrimSpace(value), "<>")
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
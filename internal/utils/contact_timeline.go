@@ -0,0 +1,68 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"kori/internal/models"
+	"time"
+)
+
+// RenderContactTimeline writes an export's timeline in the export's format and returns the
+// file's content type and extension
+func RenderContactTimeline(export *models.ContactTimelineExport, entries []models.ContactTimelineEntry) ([]byte, string, string, error) {
+	switch export.Format {
+	case models.ContactTimelineExportCSV:
+		content, err := renderContactTimelineCSV(entries)
+		return content, "text/csv", ".csv", err
+	case models.ContactTimelineExportPDF:
+		return renderContactTimelinePDF(export, entries), "application/pdf", ".pdf", nil
+	}
+	return nil, "", "", fmt.Errorf("unknown export format %s", export.Format)
+}
+
+func renderContactTimelineCSV(entries []models.ContactTimelineEntry) ([]byte, error) {
+	var out bytes.Buffer
+	writer := csv.NewWriter(&out)
+	if err := writer.Write([]string{"timestamp", "category", "event", "description", "reference"}); err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if err := writer.Write([]string{
+			entry.At.UTC().Format(time.RFC3339),
+			entry.Category,
+			entry.Event,
+			entry.Description,
+			entry.Reference,
+		}); err != nil {
+			return nil, err
+		}
+	}
+	writer.Flush()
+	return out.Bytes(), writer.Error()
+}
+
+func renderContactTimelinePDF(export *models.ContactTimelineExport, entries []models.ContactTimelineEntry) []byte {
+	doc := &PDFText{}
+	doc.Line("Contact timeline: " + export.Email)
+	doc.Line("Export " + export.ID)
+	doc.Line("Team " + export.TeamID)
+	doc.Line("Generated " + time.Now().UTC().Format(time.RFC3339))
+	if export.Reason != "" {
+		doc.Line("Reason: " + export.Reason)
+	}
+	doc.Line(fmt.Sprintf("Entries: %d", len(entries)))
+	if export.Truncated {
+		doc.Line(fmt.Sprintf("Only the first %d entries are included.", models.MaxContactTimelineEntries))
+	}
+	doc.Line("")
+
+	for _, entry := range entries {
+		line := fmt.Sprintf("%s  %-10s  %-20s  %s", entry.At.UTC().Format("2006-01-02 15:04:05"), entry.Category, entry.Event, entry.Description)
+		if entry.Reference != "" {
+			line += " [" + entry.Reference + "]"
+		}
+		doc.Line(line)
+	}
+	return doc.Bytes()
+}
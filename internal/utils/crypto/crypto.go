@@ -1,16 +1,22 @@
 package crypto
 
 import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
 	"crypto/hmac"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
+	"crypto/x509"
 	"encoding/base64"
 	"encoding/hex"
+	"encoding/pem"
 	"errors"
 	"fmt"
 	base64_ "kori/internal/utils/base64"
 	"kori/internal/utils/logger"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
@@ -113,3 +119,89 @@ func ComputeWebhookSignature(requestBody []byte, secret string) string {
 	h.Write(requestBody)
 	return hex.EncodeToString(h.Sum(nil))
 }
+
+// SignDocument signs the SHA-256 digest of a document with the server key, RSA PKCS #1 v1.5,
+// base64 encoded
+func SignDocument(content []byte) (string, error) {
+	if PrivateKey == nil {
+		return "", errors.New("private key not initialized")
+	}
+	digest := sha256.Sum256(content)
+	signature, err := rsa.SignPKCS1v15(rand.Reader, PrivateKey, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(signature), nil
+}
+
+// PublicKeyPEM returns the server's public key, which verifies signed documents
+func PublicKeyPEM() (string, error) {
+	if PublicKey == nil {
+		return "", errors.New("public key not initialized")
+	}
+	der, err := x509.MarshalPKIXPublicKey(PublicKey)
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})), nil
+}
+
+// EncryptLong encrypts values too long for the RSA key, like OAuth tokens: the value is sealed
+// with a random AES-256-GCM key and the key is encrypted with the public key
+func EncryptLong(plaintext string) (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+
+	encryptedKey, err := Encrypt(string(key))
+	if err != nil {
+		return "", err
+	}
+	return encryptedKey + "." + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// DecryptLong decrypts a value encrypted with EncryptLong
+func DecryptLong(ciphertext string) (string, error) {
+	encryptedKey, sealed, ok := strings.Cut(ciphertext, ".")
+	if !ok {
+		return "", errors.New("invalid ciphertext")
+	}
+	key, err := Decrypt(encryptedKey)
+	if err != nil {
+		return "", err
+	}
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := newGCM([]byte(key))
+	if err != nil {
+		return "", err
+	}
+	if len(data) < gcm.NonceSize() {
+		return "", errors.New("invalid ciphertext")
+	}
+	plaintext, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
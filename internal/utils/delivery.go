@@ -0,0 +1,364 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"kori/internal/models"
+	"mime/multipart"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+// emailIDMetadata is the key our email ID is passed to API providers under, so their delivery
+// events can be matched back to the email
+const emailIDMetadata = "email_id"
+
+// DeliveryMessage is an email as handed to an API provider
+type DeliveryMessage struct {
+	EmailID     string
+	From        string
+	FromName    string
+	To          string
+	Cc          []string
+	Bcc         []string
+	ReplyTo     string
+	Subject     string
+	HTML        string
+	Text        string // plain text alternative, sent alongside the html when set
+	Headers     map[string]string
+	Attachments []DeliveryAttachment
+}
+
+// DeliveryAttachment is a file sent with a DeliveryMessage
+type DeliveryAttachment struct {
+	Name    string
+	Type    string
+	Content []byte
+}
+
+// DeliveryProvider sends mail through an email service's HTTP API
+type DeliveryProvider interface {
+	// Send hands the message to the provider and returns the provider's message ID
+	Send(config *models.SMTPConfig, message *DeliveryMessage) (string, error)
+	// Check makes an authenticated request that sends nothing, for health checks
+	Check(config *models.SMTPConfig) error
+}
+
+// deliveryProviders are the API providers by SMTPConfig.Provider
+var deliveryProviders = map[models.SMTPProvider]DeliveryProvider{
+	models.SMTPProviderSendGrid: sendGridProvider{},
+	models.SMTPProviderMailgun:  mailgunProvider{},
+	models.SMTPProviderPostmark: postmarkProvider{},
+}
+
+// GetDeliveryProvider returns the API provider a config sends through, if it isn't an SMTP server
+func GetDeliveryProvider(provider string) (DeliveryProvider, bool) {
+	p, ok := deliveryProviders[models.SMTPProvider(provider)]
+	return p, ok
+}
+
+// ProviderError is a request an API provider turned down
+type ProviderError struct {
+	Provider   string
+	StatusCode int
+	Message    string
+}
+
+func (e *ProviderError) Error() string {
+	return fmt.Sprintf("%s returned status %d: %s", strings.ToLower(e.Provider), e.StatusCode, e.Message)
+}
+
+// deliveryClient is shared by the API providers
+var deliveryClient = &http.Client{Timeout: 30 * time.Second}
+
+// doDelivery sends a request to an API provider and decodes a successful JSON response into out
+func doDelivery(provider models.SMTPProvider, req *http.Request, out interface{}) (http.Header, error) {
+	resp, err := deliveryClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, &ProviderError{Provider: string(provider), StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(body))}
+	}
+	if out != nil && len(body) > 0 {
+		if err := json.Unmarshal(body, out); err != nil {
+			return nil, fmt.Errorf("failed to decode %s response: %w", strings.ToLower(string(provider)), err)
+		}
+	}
+	return resp.Header, nil
+}
+
+// providerAPIBases are the API bases of each provider, the default region first. Requests only
+// ever go to these, so a config's host can't point the server at another address.
+var providerAPIBases = map[models.SMTPProvider][]string{
+	models.SMTPProviderSendGrid: {"https://api.sendgrid.com", "https://api.eu.sendgrid.com"},
+	models.SMTPProviderMailgun:  {"https://api.mailgun.net", "https://api.eu.mailgun.net"},
+	models.SMTPProviderPostmark: {"https://api.postmarkapp.com"},
+}
+
+// apiURL is the address of a provider endpoint. The config's host only picks the region, e.g.
+// api.eu.mailgun.net; any host that isn't one of the provider's gets its default region.
+func apiURL(config *models.SMTPConfig, path string) string {
+	host := strings.ToLower(strings.TrimSuffix(config.Host, "/"))
+	host = strings.TrimPrefix(strings.TrimPrefix(host, "https://"), "http://")
+
+	bases := providerAPIBases[models.SMTPProvider(config.Provider)]
+	for _, base := range bases {
+		if strings.TrimPrefix(base, "https://") == host {
+			return base + path
+		}
+	}
+	return bases[0] + path
+}
+
+// formatAddress formats an address with an optional display name
+func formatAddress(address, name string) string {
+	if name == "" {
+		return address
+	}
+	return (&mail.Address{Name: name, Address: address}).String()
+}
+
+// sendGridProvider sends through SendGrid's v3 mail API
+type sendGridProvider struct{}
+
+type sendGridAddress struct {
+	Email string `json:"email"`
+	Name  string `json:"name,omitempty"`
+}
+
+func sendGridAddresses(addresses []string) []sendGridAddress {
+	var list []sendGridAddress
+	for _, address := range addresses {
+		list = append(list, sendGridAddress{Email: address})
+	}
+	return list
+}
+
+func (sendGridProvider) Send(config *models.SMTPConfig, message *DeliveryMessage) (string, error) {
+	personalization := map[string]interface{}{
+		"to":          []sendGridAddress{{Email: message.To}},
+		"custom_args": map[string]string{emailIDMetadata: message.EmailID},
+	}
+	if len(message.Cc) > 0 {
+		personalization["cc"] = sendGridAddresses(message.Cc)
+	}
+	if len(message.Bcc) > 0 {
+		personalization["bcc"] = sendGridAddresses(message.Bcc)
+	}
+
+	payload := map[string]interface{}{
+		"personalizations": []interface{}{personalization},
+		"from":             sendGridAddress{Email: message.From, Name: message.FromName},
+		"subject":          message.Subject,
+		"content":          []map[string]string{{"type": "text/html", "value": message.HTML}},
+		"headers":          message.Headers,
+	}
+	if message.Text != "" {
+		// SendGrid wants the text part ahead of the html one
+		payload["content"] = []map[string]string{
+			{"type": "text/plain", "value": message.Text},
+			{"type": "text/html", "value": message.HTML},
+		}
+	}
+	if message.ReplyTo != "" {
+		payload["reply_to"] = sendGridAddress{Email: message.ReplyTo}
+	}
+	if len(message.Attachments) > 0 {
+		var attachments []map[string]string
+		for _, attachment := range message.Attachments {
+			attachments = append(attachments, map[string]string{
+				"filename": attachment.Name,
+				"type":     attachment.Type,
+				"content":  base64.StdEncoding.EncodeToString(attachment.Content),
+			})
+		}
+		payload["attachments"] = attachments
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequest(http.MethodPost, apiURL(config, "/v3/mail/send"), bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+config.Password)
+	req.Header.Set("Content-Type", "application/json")
+
+	header, err := doDelivery(models.SMTPProviderSendGrid, req, nil)
+	if err != nil {
+		return "", err
+	}
+	return header.Get("X-Message-Id"), nil
+}
+
+func (sendGridProvider) Check(config *models.SMTPConfig) error {
+	req, err := http.NewRequest(http.MethodGet, apiURL(config, "/v3/scopes"), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+config.Password)
+	_, err = doDelivery(models.SMTPProviderSendGrid, req, nil)
+	return err
+}
+
+// mailgunProvider sends through Mailgun's messages API on the config's sending domain
+type mailgunProvider struct{}
+
+func (mailgunProvider) Send(config *models.SMTPConfig, message *DeliveryMessage) (string, error) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+
+	fields := [][2]string{
+		{"from", formatAddress(message.From, message.FromName)},
+		{"to", message.To},
+		{"subject", message.Subject},
+		{"html", message.HTML},
+		{"v:" + emailIDMetadata, message.EmailID},
+	}
+	if message.Text != "" {
+		fields = append(fields, [2]string{"text", message.Text})
+	}
+	for _, address := range message.Cc {
+		fields = append(fields, [2]string{"cc", address})
+	}
+	for _, address := range message.Bcc {
+		fields = append(fields, [2]string{"bcc", address})
+	}
+	if message.ReplyTo != "" {
+		fields = append(fields, [2]string{"h:Reply-To", message.ReplyTo})
+	}
+	for name, value := range message.Headers {
+		fields = append(fields, [2]string{"h:" + name, value})
+	}
+	for _, field := range fields {
+		if err := form.WriteField(field[0], field[1]); err != nil {
+			return "", err
+		}
+	}
+	for _, attachment := range message.Attachments {
+		part, err := form.CreateFormFile("attachment", attachment.Name)
+		if err != nil {
+			return "", err
+		}
+		if _, err := part.Write(attachment.Content); err != nil {
+			return "", err
+		}
+	}
+	if err := form.Close(); err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, apiURL(config, "/v3/"+config.Username+"/messages"), &body)
+	if err != nil {
+		return "", err
+	}
+	req.SetBasicAuth("api", config.Password)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+
+	var resp struct {
+		ID string `json:"id"`
+	}
+	if _, err := doDelivery(models.SMTPProviderMailgun, req, &resp); err != nil {
+		return "", err
+	}
+	return strings.Trim(resp.ID, "<>"), nil
+}
+
+func (mailgunProvider) Check(config *models.SMTPConfig) error {
+	req, err := http.NewRequest(http.MethodGet, apiURL(config, "/v3/domains/"+config.Username), nil)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth("api", config.Password)
+	_, err = doDelivery(models.SMTPProviderMailgun, req, nil)
+	return err
+}
+
+// postmarkProvider sends through Postmark's email API with a server token
+type postmarkProvider struct{}
+
+func (postmarkProvider) Send(config *models.SMTPConfig, message *DeliveryMessage) (string, error) {
+	payload := map[string]interface{}{
+		"From":          formatAddress(message.From, message.FromName),
+		"To":            message.To,
+		"Subject":       message.Subject,
+		"HtmlBody":      message.HTML,
+		"Metadata":      map[string]string{emailIDMetadata: message.EmailID},
+		"MessageStream": "outbound",
+	}
+	if message.Text != "" {
+		payload["TextBody"] = message.Text
+	}
+	if len(message.Cc) > 0 {
+		payload["Cc"] = strings.Join(message.Cc, ",")
+	}
+	if len(message.Bcc) > 0 {
+		payload["Bcc"] = strings.Join(message.Bcc, ",")
+	}
+	if message.ReplyTo != "" {
+		payload["ReplyTo"] = message.ReplyTo
+	}
+	if len(message.Headers) > 0 {
+		var headers []map[string]string
+		for name, value := range message.Headers {
+			headers = append(headers, map[string]string{"Name": name, "Value": value})
+		}
+		payload["Headers"] = headers
+	}
+	if len(message.Attachments) > 0 {
+		var attachments []map[string]string
+		for _, attachment := range message.Attachments {
+			attachments = append(attachments, map[string]string{
+				"Name":        attachment.Name,
+				"ContentType": attachment.Type,
+				"Content":     base64.StdEncoding.EncodeToString(attachment.Content),
+			})
+		}
+		payload["Attachments"] = attachments
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequest(http.MethodPost, apiURL(config, "/email"), bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Postmark-Server-Token", config.Password)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	var resp struct {
+		MessageID string `json:"MessageID"`
+	}
+	if _, err := doDelivery(models.SMTPProviderPostmark, req, &resp); err != nil {
+		return "", err
+	}
+	return resp.MessageID, nil
+}
+
+func (postmarkProvider) Check(config *models.SMTPConfig) error {
+	req, err := http.NewRequest(http.MethodGet, apiURL(config, "/server"), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Postmark-Server-Token", config.Password)
+	req.Header.Set("Accept", "application/json")
+	_, err = doDelivery(models.SMTPProviderPostmark, req, nil)
+	return err
+}
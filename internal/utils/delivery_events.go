@@ -0,0 +1,197 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"kori/internal/models"
+	"strings"
+	"time"
+)
+
+// ProviderEvent is a delivery event an API provider posted, mapped onto our tracking events
+type ProviderEvent struct {
+	EmailID    string                    `json:"emailId,omitempty"` // from the metadata we sent with the email
+	Recipient  string                    `json:"recipient"`
+	Event      models.EmailTrackingEvent `json:"event"`
+	BounceType BounceType                `json:"bounceType,omitempty"`
+	Reason     string                    `json:"reason,omitempty"`
+	URL        string                    `json:"url,omitempty"`
+	UserAgent  string                    `json:"userAgent,omitempty"`
+	IPAddress  string                    `json:"ipAddress,omitempty"`
+	Timestamp  time.Time                 `json:"timestamp"`
+}
+
+// ParseProviderEvents maps the body of a provider's event webhook onto tracking events.
+// Events we don't track, like deliveries and deferrals, are left out.
+func ParseProviderEvents(provider string, body []byte) ([]ProviderEvent, error) {
+	switch models.SMTPProvider(provider) {
+	case models.SMTPProviderSendGrid:
+		return parseSendGridEvents(body)
+	case models.SMTPProviderMailgun:
+		return parseMailgunEvents(body)
+	case models.SMTPProviderPostmark:
+		return parsePostmarkEvents(body)
+	}
+	return nil, fmt.Errorf("provider %s doesn't post events", provider)
+}
+
+// parseSendGridEvents reads SendGrid's event webhook, a JSON array of events
+func parseSendGridEvents(body []byte) ([]ProviderEvent, error) {
+	var payload []struct {
+		Email     string `json:"email"`
+		Timestamp int64  `json:"timestamp"`
+		Event     string `json:"event"`
+		Type      string `json:"type"` // bounce or blocked, for bounces
+		Reason    string `json:"reason"`
+		URL       string `json:"url"`
+		UserAgent string `json:"useragent"`
+		IP        string `json:"ip"`
+		EmailID   string `json:"email_id"` // custom args are flattened into the event
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("invalid sendgrid events: %w", err)
+	}
+
+	var events []ProviderEvent
+	for _, item := range payload {
+		event := ProviderEvent{
+			EmailID:   item.EmailID,
+			Recipient: item.Email,
+			Reason:    item.Reason,
+			URL:       item.URL,
+			UserAgent: item.UserAgent,
+			IPAddress: item.IP,
+			Timestamp: time.Unix(item.Timestamp, 0),
+		}
+		switch item.Event {
+		case "open":
+			event.Event = models.EmailTrackingEventOpen
+		case "click":
+			event.Event = models.EmailTrackingEventClick
+		case "bounce":
+			event.Event = models.EmailTrackingEventBounce
+			event.BounceType = BounceTypeHard
+			if item.Type == "blocked" {
+				event.BounceType = BounceTypeSoft
+			}
+		case "dropped":
+			// SendGrid drops mail to addresses it has suppressed after earlier bounces
+			event.Event = models.EmailTrackingEventBounce
+			event.BounceType = BounceTypeHard
+		case "spamreport":
+			event.Event = models.EmailTrackingEventComplaint
+		default:
+			continue
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// parseMailgunEvents reads one of Mailgun's webhook events
+func parseMailgunEvents(body []byte) ([]ProviderEvent, error) {
+	var payload struct {
+		EventData struct {
+			Event         string            `json:"event"`
+			Severity      string            `json:"severity"` // permanent or temporary, for failures
+			Recipient     string            `json:"recipient"`
+			Timestamp     float64           `json:"timestamp"`
+			URL           string            `json:"url"`
+			IP            string            `json:"ip"`
+			Reason        string            `json:"reason"`
+			UserVariables map[string]string `json:"user-variables"`
+			ClientInfo    struct {
+				UserAgent string `json:"user-agent"`
+			} `json:"client-info"`
+			DeliveryStatus struct {
+				Message     string `json:"message"`
+				Description string `json:"description"`
+			} `json:"delivery-status"`
+		} `json:"event-data"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("invalid mailgun event: %w", err)
+	}
+
+	data := payload.EventData
+	event := ProviderEvent{
+		EmailID:   data.UserVariables[emailIDMetadata],
+		Recipient: data.Recipient,
+		Reason:    firstNonEmpty(data.DeliveryStatus.Description, data.DeliveryStatus.Message, data.Reason),
+		URL:       data.URL,
+		UserAgent: data.ClientInfo.UserAgent,
+		IPAddress: data.IP,
+		Timestamp: time.UnixMilli(int64(data.Timestamp * 1000)),
+	}
+	switch data.Event {
+	case "opened":
+		event.Event = models.EmailTrackingEventOpen
+	case "clicked":
+		event.Event = models.EmailTrackingEventClick
+	case "failed":
+		event.Event = models.EmailTrackingEventBounce
+		event.BounceType = BounceTypeSoft
+		if data.Severity == "permanent" {
+			event.BounceType = BounceTypeHard
+		}
+	case "complained":
+		event.Event = models.EmailTrackingEventComplaint
+	default:
+		return nil, nil
+	}
+	return []ProviderEvent{event}, nil
+}
+
+// parsePostmarkEvents reads one of Postmark's webhook events
+func parsePostmarkEvents(body []byte) ([]ProviderEvent, error) {
+	var payload struct {
+		RecordType   string            `json:"RecordType"`
+		Type         string            `json:"Type"` // HardBounce, SoftBounce, ..., for bounces
+		Email        string            `json:"Email"`
+		Recipient    string            `json:"Recipient"`
+		Description  string            `json:"Description"`
+		OriginalLink string            `json:"OriginalLink"`
+		UserAgent    string            `json:"UserAgent"`
+		Metadata     map[string]string `json:"Metadata"`
+		BouncedAt    time.Time         `json:"BouncedAt"`
+		ReceivedAt   time.Time         `json:"ReceivedAt"`
+		Geo          struct {
+			IP string `json:"IP"`
+		} `json:"Geo"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("invalid postmark event: %w", err)
+	}
+
+	event := ProviderEvent{
+		EmailID:   payload.Metadata[emailIDMetadata],
+		Recipient: firstNonEmpty(payload.Recipient, payload.Email),
+		Reason:    payload.Description,
+		URL:       payload.OriginalLink,
+		UserAgent: payload.UserAgent,
+		IPAddress: payload.Geo.IP,
+		Timestamp: payload.ReceivedAt,
+	}
+	switch payload.RecordType {
+	case "Open":
+		event.Event = models.EmailTrackingEventOpen
+	case "Click":
+		event.Event = models.EmailTrackingEventClick
+	case "Bounce":
+		event.Event = models.EmailTrackingEventBounce
+		event.BounceType = BounceTypeSoft
+		if strings.EqualFold(payload.Type, "HardBounce") {
+			event.BounceType = BounceTypeHard
+		}
+		event.Timestamp = payload.BouncedAt
+	case "SpamComplaint":
+		event.Event = models.EmailTrackingEventComplaint
+		event.Timestamp = payload.BouncedAt
+	default:
+		return nil, nil
+	}
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+	return []ProviderEvent{event}, nil
+}
@@ -0,0 +1,128 @@
+package utils
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+// Diff operations
+const (
+	DiffEqual  = "equal"
+	DiffInsert = "insert"
+	DiffDelete = "delete"
+)
+
+// maxDiffCells caps the size of the LCS table; inputs differing over more than this are
+// diffed as one deletion and one insertion of the differing middle
+const maxDiffCells = 4_000_000
+
+// DiffChunk is a run of text kept, inserted or deleted going from the old text to the new one
+type DiffChunk struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+var wordTokenRe = regexp.MustCompile(`\s+|[^\s]+`)
+
+// DiffLines diffs two texts line by line
+func DiffLines(from, to string) []DiffChunk {
+	return diffTokens(strings.SplitAfter(from, "\n"), strings.SplitAfter(to, "\n"))
+}
+
+// DiffWords diffs two texts word by word, keeping the whitespace between words
+func DiffWords(from, to string) []DiffChunk {
+	return diffTokens(wordTokenRe.FindAllString(from, -1), wordTokenRe.FindAllString(to, -1))
+}
+
+// diffTokens computes a shortest edit of from into to from their longest common subsequence
+func diffTokens(from, to []string) []DiffChunk {
+	chunks := []DiffChunk{}
+	add := func(op, text string) {
+		if text == "" {
+			return
+		}
+		if n := len(chunks); n > 0 && chunks[n-1].Op == op {
+			chunks[n-1].Text += text
+			return
+		}
+		chunks = append(chunks, DiffChunk{Op: op, Text: text})
+	}
+
+	// The common prefix and suffix don't need the table
+	prefix := 0
+	for prefix < len(from) && prefix < len(to) && from[prefix] == to[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(from)-prefix && suffix < len(to)-prefix && from[len(from)-1-suffix] == to[len(to)-1-suffix] {
+		suffix++
+	}
+	a, b := from[prefix:len(from)-suffix], to[prefix:len(to)-suffix]
+
+	add(DiffEqual, strings.Join(from[:prefix], ""))
+	if len(a)*len(b) > maxDiffCells {
+		add(DiffDelete, strings.Join(a, ""))
+		add(DiffInsert, strings.Join(b, ""))
+	} else {
+		// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+		lcs := make([][]int, len(a)+1)
+		for i := range lcs {
+			lcs[i] = make([]int, len(b)+1)
+		}
+		for i := len(a) - 1; i >= 0; i-- {
+			for j := len(b) - 1; j >= 0; j-- {
+				if a[i] == b[j] {
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				} else {
+					lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+				}
+			}
+		}
+		i, j := 0, 0
+		for i < len(a) && j < len(b) {
+			switch {
+			case a[i] == b[j]:
+				add(DiffEqual, a[i])
+				i, j = i+1, j+1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				add(DiffDelete, a[i])
+				i++
+			default:
+				add(DiffInsert, b[j])
+				j++
+			}
+		}
+		add(DiffDelete, strings.Join(a[i:], ""))
+		add(DiffInsert, strings.Join(b[j:], ""))
+	}
+	add(DiffEqual, strings.Join(from[len(from)-suffix:], ""))
+	return chunks
+}
+
+// DiffChanged reports whether a diff has any insertion or deletion
+func DiffChanged(chunks []DiffChunk) bool {
+	for _, chunk := range chunks {
+		if chunk.Op != DiffEqual {
+			return true
+		}
+	}
+	return false
+}
+
+// RenderDiffHTML renders a diff as escaped text with insertions in <ins> and deletions in <del>
+func RenderDiffHTML(chunks []DiffChunk) string {
+	var out strings.Builder
+	for _, chunk := range chunks {
+		text := html.EscapeString(chunk.Text)
+		switch chunk.Op {
+		case DiffInsert:
+			out.WriteString("<ins>" + text + "</ins>")
+		case DiffDelete:
+			out.WriteString("<del>" + text + "</del>")
+		default:
+			out.WriteString(text)
+		}
+	}
+	return out.String()
+}
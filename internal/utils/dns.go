@@ -0,0 +1,261 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"kori/internal/config"
+	"kori/internal/models"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DNSResolver is the subset of net.Resolver used for domain verification
+type DNSResolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+	LookupCNAME(ctx context.Context, host string) (string, error)
+}
+
+// VerifyDomain checks the ownership, SPF, DKIM and DMARC records of a domain.
+// spfInclude is the include mechanism the domain's SPF record must reference.
+func VerifyDomain(ctx context.Context, resolver DNSResolver, domain *models.Domain, spfInclude string) []models.DomainRecordCheck {
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+
+	return []models.DomainRecordCheck{
+		checkOwnership(ctx, resolver, domain),
+		checkSPF(ctx, resolver, domain, spfInclude),
+		checkDKIM(ctx, resolver, domain),
+		checkDMARC(ctx, resolver, domain),
+	}
+}
+
+// RunDomainVerification verifies a domain against DNS and persists the per-record results
+func RunDomainVerification(ctx context.Context, db *gorm.DB, domain *models.Domain, spfInclude string) error {
+	if err := domain.EnsureVerificationToken(); err != nil {
+		return err
+	}
+	checks := VerifyDomain(ctx, nil, domain, spfInclude)
+	if err := domain.ApplyChecks(checks, time.Now()); err != nil {
+		return err
+	}
+	return db.Save(domain).Error
+}
+
+// TrackingCNAMETarget is the host custom tracking domains must point their CNAME at
+func TrackingCNAMETarget(cfg *config.Config) string {
+	if cfg.Domain.TrackingCNAME != "" {
+		return strings.ToLower(strings.TrimSuffix(cfg.Domain.TrackingCNAME, "."))
+	}
+	if parsed, err := url.Parse(cfg.Server.PublicURL); err == nil {
+		return strings.ToLower(parsed.Hostname())
+	}
+	return ""
+}
+
+// VerifyTrackingDomain checks that a tracking domain's CNAME leads to target. Both names are
+// followed to their canonical name, so a target that is itself an alias still matches.
+func VerifyTrackingDomain(ctx context.Context, resolver DNSResolver, domain *models.TrackingDomain, target string) models.DomainRecordCheck {
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+
+	check := newRecordCheck(models.DomainRecordTracking, domain.Domain, target)
+	check.Type = "CNAME"
+	if target == "" {
+		return failCheck(check, "no tracking CNAME target is configured")
+	}
+
+	found, err := resolver.LookupCNAME(ctx, domain.Domain)
+	if err != nil {
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			return failCheck(check, "no CNAME record found")
+		}
+		return failCheck(check, fmt.Sprintf("DNS lookup for %s failed: %v", domain.Domain, err))
+	}
+	found = strings.ToLower(strings.TrimSuffix(found, "."))
+	check.Found = []string{found}
+	if found == domain.Domain {
+		return failCheck(check, "no CNAME record found")
+	}
+
+	canonicalTarget := target
+	if resolved, err := resolver.LookupCNAME(ctx, target); err == nil {
+		canonicalTarget = strings.ToLower(strings.TrimSuffix(resolved, "."))
+	}
+	if found != target && found != canonicalTarget {
+		return failCheck(check, fmt.Sprintf("CNAME points at %s instead of %s", found, target))
+	}
+	check.Status = models.DomainRecordStatusVerified
+	return check
+}
+
+// RunTrackingDomainVerification verifies a tracking domain's CNAME and persists the result
+func RunTrackingDomainVerification(ctx context.Context, db *gorm.DB, domain *models.TrackingDomain, cfg *config.Config) error {
+	check := VerifyTrackingDomain(ctx, nil, domain, TrackingCNAMETarget(cfg))
+	if err := domain.ApplyCheck(check, time.Now()); err != nil {
+		return err
+	}
+	return db.Save(domain).Error
+}
+
+func checkOwnership(ctx context.Context, resolver DNSResolver, domain *models.Domain) models.DomainRecordCheck {
+	check := newRecordCheck(models.DomainRecordOwnership, domain.VerificationHost(), domain.DNSRecord)
+	records, err := lookupTXT(ctx, resolver, check.Host)
+	check.Found = records
+	if err != nil {
+		return failCheck(check, err.Error())
+	}
+	for _, record := range records {
+		if strings.TrimSpace(record) == domain.DNSRecord {
+			check.Status = models.DomainRecordStatusVerified
+			return check
+		}
+	}
+	return failCheck(check, "verification TXT record not found")
+}
+
+func checkSPF(ctx context.Context, resolver DNSResolver, domain *models.Domain, spfInclude string) models.DomainRecordCheck {
+	check := newRecordCheck(models.DomainRecordSPF, domain.Domain, "v=spf1 include:"+spfInclude+" ~all")
+	records, err := lookupTXT(ctx, resolver, check.Host)
+	if err != nil {
+		return failCheck(check, err.Error())
+	}
+
+	var spf []string
+	for _, record := range records {
+		if strings.HasPrefix(strings.ToLower(strings.TrimSpace(record)), "v=spf1") {
+			spf = append(spf, record)
+		}
+	}
+	check.Found = spf
+
+	switch {
+	case len(spf) == 0:
+		return failCheck(check, "no SPF record found")
+	case len(spf) > 1:
+		return failCheck(check, "multiple SPF records found; receivers treat this as a permanent error")
+	}
+	for _, mechanism := range strings.Fields(strings.ToLower(spf[0])) {
+		if strings.TrimLeft(mechanism, "+") == "include:"+strings.ToLower(spfInclude) {
+			check.Status = models.DomainRecordStatusVerified
+			return check
+		}
+	}
+	return failCheck(check, fmt.Sprintf("SPF record does not include %s", spfInclude))
+}
+
+func checkDKIM(ctx context.Context, resolver DNSResolver, domain *models.Domain) models.DomainRecordCheck {
+	check := newRecordCheck(models.DomainRecordDKIM, domain.DKIMHost(), "v=DKIM1; k=rsa; p=<public key>")
+	records, err := lookupTXT(ctx, resolver, check.Host)
+	check.Found = records
+	if err != nil {
+		return failCheck(check, err.Error())
+	}
+	for _, record := range records {
+		tags := parseDNSTags(record)
+		if version, ok := tags["v"]; ok && !strings.EqualFold(version, "DKIM1") {
+			continue
+		}
+		if tags["p"] != "" {
+			check.Status = models.DomainRecordStatusVerified
+			return check
+		}
+	}
+	return failCheck(check, fmt.Sprintf("no DKIM public key found for selector %s", domain.DKIMSelector))
+}
+
+func checkDMARC(ctx context.Context, resolver DNSResolver, domain *models.Domain) models.DomainRecordCheck {
+	check := newRecordCheck(models.DomainRecordDMARC, "_dmarc."+domain.Domain, "v=DMARC1; p=quarantine")
+	records, err := lookupTXT(ctx, resolver, check.Host)
+	check.Found = records
+	if err != nil {
+		return failCheck(check, err.Error())
+	}
+	for _, record := range records {
+		tags := parseDNSTags(record)
+		if !strings.EqualFold(tags["v"], "DMARC1") {
+			continue
+		}
+		policy := strings.ToLower(tags["p"])
+		domain.DMARCPolicy = policy
+		switch policy {
+		case "quarantine", "reject":
+			check.Status = models.DomainRecordStatusVerified
+		case "none":
+			check.Status = models.DomainRecordStatusVerified
+			check.Message = "DMARC policy is p=none; consider quarantine or reject once reports look clean"
+		default:
+			return failCheck(check, "DMARC record has no valid policy")
+		}
+		return check
+	}
+	domain.DMARCPolicy = ""
+	return failCheck(check, "no DMARC record found")
+}
+
+func newRecordCheck(record, host, expected string) models.DomainRecordCheck {
+	return models.DomainRecordCheck{
+		Record:   record,
+		Host:     host,
+		Type:     "TXT",
+		Expected: expected,
+		Found:    []string{},
+		Status:   models.DomainRecordStatusPending,
+	}
+}
+
+func failCheck(check models.DomainRecordCheck, message string) models.DomainRecordCheck {
+	check.Status = models.DomainRecordStatusFailed
+	check.Message = message
+	return check
+}
+
+// lookupTXT resolves TXT records, treating a missing name as no records
+func lookupTXT(ctx context.Context, resolver DNSResolver, host string) ([]string, error) {
+	records, err := resolver.LookupTXT(ctx, host)
+	if err != nil {
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			return []string{}, nil
+		}
+		return []string{}, fmt.Errorf("DNS lookup for %s failed: %w", host, err)
+	}
+	return records, nil
+}
+
+// parseDNSTags parses "k=v; k=v" style records such as DKIM and DMARC
+func parseDNSTags(record string) map[string]string {
+	tags := make(map[string]string)
+	for _, part := range strings.Split(record, ";") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		tags[strings.ToLower(strings.TrimSpace(key))] = strings.Join(strings.Fields(value), "")
+	}
+	return tags
+}
+
+// LookupMXHosts returns the MX hostnames of a domain, ordered by preference
+func LookupMXHosts(ctx context.Context, domain string) ([]string, error) {
+	records, err := net.DefaultResolver.LookupMX(ctx, domain)
+	if err != nil {
+		return nil, fmt.Errorf("MX lookup for %s failed: %w", domain, err)
+	}
+	hosts := make([]string, 0, len(records))
+	for _, record := range records {
+		hosts = append(hosts, strings.TrimSuffix(record.Host, "."))
+	}
+	return hosts, nil
+}
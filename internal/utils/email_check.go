@@ -0,0 +1,155 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"time"
+)
+
+// emailDomainTimeout bounds the DNS lookups of a single domain
+const emailDomainTimeout = 5 * time.Second
+
+var (
+	// ErrDisposableDomain is returned for addresses of throwaway mailbox providers
+	ErrDisposableDomain = errors.New("disposable email domain")
+	// ErrNoMailServer is returned for domains that don't exist or don't accept mail
+	ErrNoMailServer = errors.New("domain doesn't accept mail")
+)
+
+// disposableDomains are throwaway mailbox providers. Mail to them is read once if at all, so
+// they only hurt engagement and the sender's reputation.
+var disposableDomains = map[string]bool{
+	"10minutemail.com":       true,
+	"20minutemail.com":       true,
+	"33mail.com":             true,
+	"anonbox.net":            true,
+	"discard.email":          true,
+	"dispostable.com":        true,
+	"dropmail.me":            true,
+	"emailondeck.com":        true,
+	"fakeinbox.com":          true,
+	"fakemail.net":           true,
+	"getairmail.com":         true,
+	"getnada.com":            true,
+	"guerrillamail.biz":      true,
+	"guerrillamail.com":      true,
+	"guerrillamail.de":       true,
+	"guerrillamail.info":     true,
+	"guerrillamail.net":      true,
+	"guerrillamail.org":      true,
+	"guerrillamailblock.com": true,
+	"harakirimail.com":       true,
+	"inboxbear.com":          true,
+	"incognitomail.org":      true,
+	"jetable.org":            true,
+	"mailcatch.com":          true,
+	"maildrop.cc":            true,
+	"mailinator.com":         true,
+	"mailinator.net":         true,
+	"mailnesia.com":          true,
+	"mintemail.com":          true,
+	"mohmal.com":             true,
+	"moakt.com":              true,
+	"mytemp.email":           true,
+	"nada.email":             true,
+	"sharklasers.com":        true,
+	"spam4.me":               true,
+	"spambox.us":             true,
+	"spamgourmet.com":        true,
+	"temp-mail.io":           true,
+	"temp-mail.org":          true,
+	"tempail.com":            true,
+	"tempinbox.com":          true,
+	"tempmail.dev":           true,
+	"tempmail.net":           true,
+	"tempmailo.com":          true,
+	"tempr.email":            true,
+	"throwawaymail.com":      true,
+	"trashmail.com":          true,
+	"trashmail.de":           true,
+	"trashmail.net":          true,
+	"yopmail.com":            true,
+	"yopmail.fr":             true,
+	"yopmail.net":            true,
+}
+
+// IsDisposableDomain reports whether a domain, or a domain it's a subdomain of, is a
+// throwaway mailbox provider
+func IsDisposableDomain(domain string) bool {
+	domain = strings.TrimSuffix(strings.ToLower(domain), ".")
+	for domain != "" {
+		if disposableDomains[domain] {
+			return true
+		}
+		_, parent, ok := strings.Cut(domain, ".")
+		if !ok {
+			return false
+		}
+		domain = parent
+	}
+	return false
+}
+
+// EmailDomainChecker checks the domains of email addresses, remembering each domain's result
+// so a list of addresses costs one lookup per domain. It isn't safe for concurrent use.
+type EmailDomainChecker struct {
+	resolver *net.Resolver
+	checked  map[string]error
+}
+
+// NewEmailDomainChecker returns a checker using the system resolver
+func NewEmailDomainChecker() *EmailDomainChecker {
+	return &EmailDomainChecker{resolver: net.DefaultResolver, checked: map[string]error{}}
+}
+
+// Check returns ErrDisposableDomain or ErrNoMailServer when mail to the address can't be
+// delivered or isn't worth sending. Lookups that fail for any other reason, like a resolver
+// timeout, don't count against the address.
+func (c *EmailDomainChecker) Check(ctx context.Context, email string) error {
+	_, domain, ok := strings.Cut(email, "@")
+	if !ok || domain == "" {
+		return ErrNoMailServer
+	}
+	domain = strings.TrimSuffix(strings.ToLower(domain), ".")
+
+	if err, ok := c.checked[domain]; ok {
+		return err
+	}
+	err := c.checkDomain(ctx, domain)
+	c.checked[domain] = err
+	return err
+}
+
+func (c *EmailDomainChecker) checkDomain(ctx context.Context, domain string) error {
+	if IsDisposableDomain(domain) {
+		return ErrDisposableDomain
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, emailDomainTimeout)
+	defer cancel()
+
+	records, err := c.resolver.LookupMX(ctx, domain)
+	if err == nil && len(records) > 0 {
+		// A single "." MX is a domain saying it accepts no mail (RFC 7505)
+		if len(records) == 1 && (records[0].Host == "." || records[0].Host == "") {
+			return ErrNoMailServer
+		}
+		return nil
+	}
+	if err != nil && !isNotFound(err) {
+		return nil
+	}
+
+	// Without MX records mail goes to the domain's own address
+	if _, err := c.resolver.LookupHost(ctx, domain); isNotFound(err) {
+		return ErrNoMailServer
+	}
+	return nil
+}
+
+func isNotFound(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound
+}
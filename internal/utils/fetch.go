@@ -1,8 +1,11 @@
 package utils
 
 import (
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"time"
 )
 
 func GetHTMLFromURL(url string) (string, error) {
@@ -22,3 +25,89 @@ func GetHTMLFromURL(url string) (string, error) {
 	}
 	return string(body), nil
 }
+
+// FetchURL downloads the resource at a url a team gave with the given headers, reading at most
+// maxBytes. Only public addresses are reached.
+func FetchURL(url string, headers map[string]string, maxBytes int64) ([]byte, error) {
+	return fetchURL(SafeHTTPClient, url, headers, maxBytes)
+}
+
+// FetchStoredFile downloads a file from its signed URL, which may point at the server itself
+// when files are kept on the filesystem, reading at most maxBytes
+func FetchStoredFile(url string, maxBytes int64) ([]byte, error) {
+	return fetchURL(&http.Client{Timeout: 60 * time.Second}, url, nil, maxBytes)
+}
+
+func fetchURL(client *http.Client, url string, headers map[string]string, maxBytes int64) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("unexpected status code %d from %s", resp.StatusCode, url)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > maxBytes {
+		return nil, fmt.Errorf("response from %s exceeds %d bytes", url, maxBytes)
+	}
+	return body, nil
+}
+
+// ErrResponseTooLarge is returned reading past the limit of a response opened with OpenURL
+var ErrResponseTooLarge = errors.New("response exceeds the size limit")
+
+// limitedBody fails reads past its limit rather than cutting the response short
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.remaining <= 0 {
+		return 0, ErrResponseTooLarge
+	}
+	if int64(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+	return n, err
+}
+
+// OpenURL starts downloading the resource at a url a team gave, for reading it as it arrives.
+// Reading more than maxBytes fails with ErrResponseTooLarge. Only public addresses are reached.
+func OpenURL(url string, maxBytes int64) (io.ReadCloser, error) {
+	return openURL(NewSafeHTTPClient(10*time.Minute), url, maxBytes)
+}
+
+// OpenStoredFile starts downloading a file from its signed URL, like OpenURL but for URLs of the
+// server's own storage
+func OpenStoredFile(url string, maxBytes int64) (io.ReadCloser, error) {
+	return openURL(&http.Client{Timeout: 10 * time.Minute}, url, maxBytes)
+}
+
+func openURL(client *http.Client, url string, maxBytes int64) (io.ReadCloser, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status code %d from %s", resp.StatusCode, url)
+	}
+	return &limitedBody{ReadCloser: resp.Body, remaining: maxBytes + 1}, nil
+}
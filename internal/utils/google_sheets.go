@@ -0,0 +1,38 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// googleSheetPath matches the path of a Google Sheet, capturing its ID
+var googleSheetPath = regexp.MustCompile(`^/spreadsheets/d/([a-zA-Z0-9_-]+)`)
+
+// GoogleSheetCSVURL returns where the CSV export of a Google Sheet is downloaded from, given the
+// sheet's address as the browser shows it. The tab in the address is exported, or the first one.
+// Only sheets shared with anyone with the link can be downloaded without signing in.
+func GoogleSheetCSVURL(sheetURL string) (string, error) {
+	parsed, err := url.Parse(strings.TrimSpace(sheetURL))
+	if err != nil || parsed.Host != "docs.google.com" {
+		return "", errors.New("not a Google Sheets address")
+	}
+	match := googleSheetPath.FindStringSubmatch(parsed.Path)
+	if match == nil || match[1] == "e" {
+		return "", errors.New("not the address of a Google Sheet, copy it from the browser's address bar")
+	}
+
+	export := fmt.Sprintf("https://docs.google.com/spreadsheets/d/%s/export?format=csv", match[1])
+
+	// The tab is in the fragment of addresses copied from the browser, and in the query of shared ones
+	gid := parsed.Query().Get("gid")
+	if fragment, err := url.ParseQuery(parsed.Fragment); err == nil && fragment.Get("gid") != "" {
+		gid = fragment.Get("gid")
+	}
+	if gid != "" {
+		export += "&gid=" + url.QueryEscape(gid)
+	}
+	return export, nil
+}
@@ -30,8 +30,11 @@ type ParsedMail struct {
 	Subject       string                   // The subject of the email.
 	Date          time.Time                // The date the email was sent.
 	MessageID     string                   // The unique Message-ID of the email.
+	InReplyTo     string                   // Message-ID of the email this one replies to, if any.
+	References    string                   // Message-IDs of the emails of the thread, oldest first.
 	Attachments   []EmailAttachment        // A slice of attachments found in the email.
 	EmbeddedFiles []parsemail.EmbeddedFile // A slice of embedded images found in the email.
+	Header        mail.Header              // All headers, e.g. to tell auto-replies apart.
 }
 
 // ParseEmail takes an io.Reader containing raw email data and parses it
@@ -45,8 +48,11 @@ func ParseEmail(emailReader io.Reader) (*ParsedMail, error) {
 	}
 
 	// Parse basic headers
+	parsedMail.Header = msg.Header
 	parsedMail.Subject = msg.Header.Get("Subject")
 	parsedMail.MessageID = msg.Header.Get("Message-ID")
+	parsedMail.InReplyTo = msg.Header.Get("In-Reply-To")
+	parsedMail.References = msg.Header.Get("References")
 
 	dateStr := msg.Header.Get("Date")
 	if dateStr != "" {
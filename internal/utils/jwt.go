@@ -90,3 +90,49 @@ func ParseRefreshToken(tokenString string) (*Claims, error) {
 
 	return claims, nil
 }
+
+// embedTokenAudience sets embed tokens apart from session tokens signed with the same secret
+const embedTokenAudience = "embed"
+
+// EmbedClaims are the claims of an embed token; what it grants is kept on its record
+type EmbedClaims struct {
+	TeamID string `json:"team_id"`
+	jwt.RegisteredClaims
+}
+
+// GenerateEmbedToken signs the token handed to an embedded widget for an embed token record
+func GenerateEmbedToken(embed models.EmbedToken) (string, error) {
+	claims := EmbedClaims{
+		TeamID: embed.TeamID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        embed.ID,
+			Audience:  jwt.ClaimStrings{embedTokenAudience},
+			ExpiresAt: jwt.NewNumericDate(embed.ExpiresAt),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+}
+
+// ParseEmbedToken parses and validates an embed token, including its expiry
+func ParseEmbedToken(tokenString string) (*EmbedClaims, error) {
+	claims := &EmbedClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, jwt.ErrSignatureInvalid
+		}
+		return []byte(os.Getenv("JWT_SECRET")), nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !token.Valid || !claims.VerifyAudience(embedTokenAudience, true) || claims.ID == "" {
+		return nil, jwt.ErrSignatureInvalid
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,164 @@
+package utils
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Link issue types reported by the link checker
+const (
+	LinkIssueBroken              = "broken"
+	LinkIssueUnreachable         = "unreachable"
+	LinkIssueNotHTTPS            = "not_https"
+	LinkIssueInsecureRedirect    = "insecure_redirect"
+	LinkIssueCrossDomainRedirect = "cross_domain_redirect"
+	LinkIssueLongRedirectChain   = "long_redirect_chain"
+)
+
+const (
+	maxLinkRedirects       = 10
+	longRedirectChainLimit = 3
+)
+
+// LinkCheckResult is the outcome of checking a single link
+type LinkCheckResult struct {
+	URL           string    `json:"url"`
+	FinalURL      string    `json:"finalUrl"`
+	StatusCode    int       `json:"statusCode"`
+	RedirectChain []string  `json:"redirectChain"`
+	IsHTTPS       bool      `json:"isHttps"`
+	Error         string    `json:"error,omitempty"`
+	Issues        []string  `json:"issues"`
+	CheckedAt     time.Time `json:"checkedAt"`
+}
+
+var anchorHrefRe = regexp.MustCompile(`(?i)<a[^>]+href\s*=\s*["']([^"']+)["']`)
+
+// ExtractLinks returns the unique http(s) links in an HTML document, skipping
+// mailto/tel/anchor links and links that still contain template variables
+func ExtractLinks(html string) []string {
+	seen := make(map[string]bool)
+	var links []string
+	for _, match := range anchorHrefRe.FindAllStringSubmatch(html, -1) {
+		link := strings.TrimSpace(match[1])
+		lower := strings.ToLower(link)
+		if !strings.HasPrefix(lower, "http://") && !strings.HasPrefix(lower, "https://") {
+			continue
+		}
+		if strings.Contains(link, "{{") || seen[link] {
+			continue
+		}
+		seen[link] = true
+		links = append(links, link)
+	}
+	return links
+}
+
+// CheckLink follows the redirect chain of a link and flags broken or suspicious behaviour
+func CheckLink(ctx context.Context, link string) LinkCheckResult {
+	result := LinkCheckResult{
+		URL:           link,
+		RedirectChain: []string{},
+		Issues:        []string{},
+		CheckedAt:     time.Now(),
+	}
+
+	// Links come from the team's templates, so only public addresses are checked
+	client := NewSafeHTTPClient(10 * time.Second)
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	current := link
+	for hop := 0; hop <= maxLinkRedirects; hop++ {
+		resp, err := requestLink(ctx, client, http.MethodHead, current)
+		if err == nil && (resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented) {
+			// Some servers don't support HEAD
+			resp, err = requestLink(ctx, client, http.MethodGet, current)
+		}
+		if err != nil {
+			result.Error = err.Error()
+			result.Issues = append(result.Issues, LinkIssueUnreachable)
+			break
+		}
+
+		result.StatusCode = resp.StatusCode
+		location := resp.Header.Get("Location")
+		if resp.StatusCode < 300 || resp.StatusCode >= 400 || location == "" {
+			break
+		}
+
+		next, err := resolveRedirect(current, location)
+		if err != nil {
+			result.Error = err.Error()
+			result.Issues = append(result.Issues, LinkIssueUnreachable)
+			break
+		}
+		if strings.HasPrefix(current, "https://") && strings.HasPrefix(next, "http://") {
+			result.Issues = append(result.Issues, LinkIssueInsecureRedirect)
+		}
+		result.RedirectChain = append(result.RedirectChain, next)
+		current = next
+	}
+
+	result.FinalURL = current
+	result.IsHTTPS = strings.HasPrefix(strings.ToLower(current), "https://")
+
+	if result.StatusCode >= 400 {
+		result.Issues = append(result.Issues, LinkIssueBroken)
+	}
+	if !strings.HasPrefix(strings.ToLower(link), "https://") {
+		result.Issues = append(result.Issues, LinkIssueNotHTTPS)
+	}
+	if len(result.RedirectChain) > longRedirectChainLimit {
+		result.Issues = append(result.Issues, LinkIssueLongRedirectChain)
+	}
+	if len(result.RedirectChain) > 0 && linkHost(link) != linkHost(result.FinalURL) {
+		result.Issues = append(result.Issues, LinkIssueCrossDomainRedirect)
+	}
+
+	return result
+}
+
+// IsLinkIssueError reports whether an issue should block a send rather than just warn
+func IsLinkIssueError(issue string) bool {
+	return issue == LinkIssueBroken || issue == LinkIssueUnreachable
+}
+
+func requestLink(ctx context.Context, client *http.Client, method, link string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, link, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "Posthoot-LinkChecker/1.0")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	return resp, nil
+}
+
+func resolveRedirect(current, location string) (string, error) {
+	base, err := url.Parse(current)
+	if err != nil {
+		return "", err
+	}
+	next, err := base.Parse(location)
+	if err != nil {
+		return "", err
+	}
+	return next.String(), nil
+}
+
+func linkHost(link string) string {
+	parsed, err := url.Parse(link)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(strings.ToLower(parsed.Hostname()), "www.")
+}
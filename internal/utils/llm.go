@@ -0,0 +1,206 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"kori/internal/config"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// LLM providers a Model can use
+const (
+	LLMProviderOpenAI    = "OPENAI"
+	LLMProviderAnthropic = "ANTHROPIC"
+)
+
+// anthropicVersion is the Messages API version requests are made against
+const anthropicVersion = "2023-06-01"
+
+// ErrLLMNotConfigured is returned when a provider is unknown or has no API key; retrying won't help
+var ErrLLMNotConfigured = errors.New("llm provider is not configured")
+
+// LLMRequest is a single prompt to complete
+type LLMRequest struct {
+	Provider  string
+	Model     string
+	System    string
+	Prompt    string
+	MaxTokens int
+}
+
+// LLMCompletion is the generated text and the tokens it cost
+type LLMCompletion struct {
+	Text             string
+	PromptTokens     int
+	CompletionTokens int
+}
+
+// LLMError is a non-2xx response from a provider
+type LLMError struct {
+	Provider   string
+	StatusCode int
+	Message    string
+}
+
+func (e *LLMError) Error() string {
+	return fmt.Sprintf("%s returned status code %d: %s", strings.ToLower(e.Provider), e.StatusCode, e.Message)
+}
+
+// Retryable reports whether the request may succeed if sent again
+func (e *LLMError) Retryable() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// GenerateCompletion sends the prompt to the request's provider
+func GenerateCompletion(ctx context.Context, cfg *config.Config, request LLMRequest) (*LLMCompletion, error) {
+	if request.MaxTokens <= 0 {
+		request.MaxTokens = cfg.LLM.MaxTokens
+	}
+	client := &http.Client{Timeout: 2 * time.Minute}
+
+	switch strings.ToUpper(request.Provider) {
+	case LLMProviderOpenAI:
+		if cfg.LLM.OpenAIAPIKey == "" {
+			return nil, fmt.Errorf("%w: OPENAI_API_KEY is not set", ErrLLMNotConfigured)
+		}
+		return completeOpenAI(ctx, client, cfg, request)
+	case LLMProviderAnthropic:
+		if cfg.LLM.AnthropicAPIKey == "" {
+			return nil, fmt.Errorf("%w: ANTHROPIC_API_KEY is not set", ErrLLMNotConfigured)
+		}
+		return completeAnthropic(ctx, client, cfg, request)
+	}
+	return nil, fmt.Errorf("%w: unknown provider %q", ErrLLMNotConfigured, request.Provider)
+}
+
+func completeOpenAI(ctx context.Context, client *http.Client, cfg *config.Config, request LLMRequest) (*LLMCompletion, error) {
+	messages := []map[string]string{}
+	if request.System != "" {
+		messages = append(messages, map[string]string{"role": "system", "content": request.System})
+	}
+	messages = append(messages, map[string]string{"role": "user", "content": request.Prompt})
+
+	var response struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+		Usage struct {
+			PromptTokens     int `json:"prompt_tokens"`
+			CompletionTokens int `json:"completion_tokens"`
+		} `json:"usage"`
+	}
+	if err := postLLM(ctx, client, LLMProviderOpenAI, strings.TrimRight(cfg.LLM.OpenAIBaseURL, "/")+"/chat/completions", map[string]string{
+		"Authorization": "Bearer " + cfg.LLM.OpenAIAPIKey,
+	}, map[string]interface{}{
+		"model":      request.Model,
+		"messages":   messages,
+		"max_tokens": request.MaxTokens,
+	}, &response); err != nil {
+		return nil, err
+	}
+
+	if len(response.Choices) == 0 {
+		return nil, errors.New("openai returned no choices")
+	}
+	return &LLMCompletion{
+		Text:             response.Choices[0].Message.Content,
+		PromptTokens:     response.Usage.PromptTokens,
+		CompletionTokens: response.Usage.CompletionTokens,
+	}, nil
+}
+
+func completeAnthropic(ctx context.Context, client *http.Client, cfg *config.Config, request LLMRequest) (*LLMCompletion, error) {
+	body := map[string]interface{}{
+		"model":      request.Model,
+		"max_tokens": request.MaxTokens,
+		"messages":   []map[string]string{{"role": "user", "content": request.Prompt}},
+	}
+	if request.System != "" {
+		body["system"] = request.System
+	}
+
+	var response struct {
+		Content []struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		} `json:"content"`
+		Usage struct {
+			InputTokens  int `json:"input_tokens"`
+			OutputTokens int `json:"output_tokens"`
+		} `json:"usage"`
+	}
+	if err := postLLM(ctx, client, LLMProviderAnthropic, strings.TrimRight(cfg.LLM.AnthropicBaseURL, "/")+"/messages", map[string]string{
+		"x-api-key":         cfg.LLM.AnthropicAPIKey,
+		"anthropic-version": anthropicVersion,
+	}, body, &response); err != nil {
+		return nil, err
+	}
+
+	var text strings.Builder
+	for _, block := range response.Content {
+		if block.Type == "text" {
+			text.WriteString(block.Text)
+		}
+	}
+	if text.Len() == 0 {
+		return nil, errors.New("anthropic returned no text")
+	}
+	return &LLMCompletion{
+		Text:             text.String(),
+		PromptTokens:     response.Usage.InputTokens,
+		CompletionTokens: response.Usage.OutputTokens,
+	}, nil
+}
+
+func postLLM(ctx context.Context, client *http.Client, provider, url string, headers map[string]string, body interface{}, response interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s request: %w", strings.ToLower(provider), err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to build %s request: %w", strings.ToLower(provider), err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s request failed: %w", strings.ToLower(provider), err)
+	}
+	defer resp.Body.Close()
+
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, 8<<20))
+	if err != nil {
+		return fmt.Errorf("failed to read %s response: %w", strings.ToLower(provider), err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		// Both providers wrap failures as {"error": {"message": ...}}
+		var failure struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		message := strings.TrimSpace(string(raw))
+		if json.Unmarshal(raw, &failure) == nil && failure.Error.Message != "" {
+			message = failure.Error.Message
+		}
+		return &LLMError{Provider: provider, StatusCode: resp.StatusCode, Message: message}
+	}
+
+	if err := json.Unmarshal(raw, response); err != nil {
+		return fmt.Errorf("invalid %s response: %w", strings.ToLower(provider), err)
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// maintenanceKey is where the maintenance mode is kept, so every API and task server sees it
+	maintenanceKey = "posthoot:maintenance"
+	// maintenanceCacheTTL is how long a server trusts the mode it last read
+	maintenanceCacheTTL = 5 * time.Second
+	// DefaultMaintenanceRetryAfter is how long clients are told to wait when no duration is set
+	DefaultMaintenanceRetryAfter = 5 * time.Minute
+)
+
+// MaintenanceMode makes the API read-only and holds background tasks, for database maintenance
+type MaintenanceMode struct {
+	Enabled    bool       `json:"enabled"`
+	Message    string     `json:"message,omitempty"`
+	RetryAfter int        `json:"retryAfter,omitempty"` // seconds clients are told to wait before writing again
+	StartedAt  *time.Time `json:"startedAt,omitempty"`
+	StartedBy  string     `json:"startedBy,omitempty"` // user ID of the operator who turned it on
+}
+
+// RetryAfterDuration is how long clients and tasks should wait before trying again
+func (m *MaintenanceMode) RetryAfterDuration() time.Duration {
+	if m.RetryAfter <= 0 {
+		return DefaultMaintenanceRetryAfter
+	}
+	return time.Duration(m.RetryAfter) * time.Second
+}
+
+var (
+	maintenanceMu       sync.Mutex
+	maintenanceCached   MaintenanceMode
+	maintenanceCachedAt time.Time
+)
+
+// GetMaintenanceMode returns the current maintenance mode, read again from Redis every few
+// seconds. Without a Redis client it's the mode last set in this process.
+func GetMaintenanceMode(ctx context.Context, client *redis.Client) (MaintenanceMode, error) {
+	maintenanceMu.Lock()
+	defer maintenanceMu.Unlock()
+
+	if client == nil || time.Since(maintenanceCachedAt) < maintenanceCacheTTL {
+		return maintenanceCached, nil
+	}
+
+	mode := MaintenanceMode{}
+	raw, err := client.Get(ctx, maintenanceKey).Bytes()
+	switch {
+	case errors.Is(err, redis.Nil):
+	case err != nil:
+		return maintenanceCached, fmt.Errorf("failed to get maintenance mode: %w", err)
+	default:
+		if err := json.Unmarshal(raw, &mode); err != nil {
+			return maintenanceCached, fmt.Errorf("invalid maintenance mode: %w", err)
+		}
+	}
+
+	maintenanceCached, maintenanceCachedAt = mode, time.Now()
+	return mode, nil
+}
+
+// SetMaintenanceMode turns maintenance mode on or off for every server. Other servers pick the
+// change up within a few seconds. Without a Redis client it's set for this process only.
+func SetMaintenanceMode(ctx context.Context, client *redis.Client, mode MaintenanceMode) error {
+	if !mode.Enabled {
+		mode = MaintenanceMode{}
+	}
+
+	raw, err := json.Marshal(mode)
+	if err != nil {
+		return fmt.Errorf("failed to marshal maintenance mode: %w", err)
+	}
+	if client != nil {
+		if err := client.Set(ctx, maintenanceKey, raw, 0).Err(); err != nil {
+			return fmt.Errorf("failed to set maintenance mode: %w", err)
+		}
+	}
+
+	maintenanceMu.Lock()
+	maintenanceCached, maintenanceCachedAt = mode, time.Now()
+	maintenanceMu.Unlock()
+	return nil
+}
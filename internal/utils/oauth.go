@@ -0,0 +1,377 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"kori/internal/config"
+	"kori/internal/db"
+	"kori/internal/models"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emersion/go-sasl"
+	"github.com/golang-jwt/jwt"
+	"gopkg.in/gomail.v2"
+)
+
+// oauthStateExpiry is how long the user has to finish consenting on the provider's page
+const oauthStateExpiry = 10 * time.Minute
+
+// oauthRefreshMargin refreshes access tokens this long before they expire, so a send or poll
+// doesn't start with a token that runs out on the way
+const oauthRefreshMargin = 2 * time.Minute
+
+// oauthEndpoint is where a provider's users consent and its tokens are issued
+type oauthEndpoint struct {
+	authorizeURL string
+	tokenURL     string
+	scopes       []string
+	clientID     string
+	clientSecret string
+	extraParams  map[string]string
+}
+
+func getOAuthEndpoint(provider models.OAuthProvider, cfg *config.Config) (*oauthEndpoint, error) {
+	var endpoint *oauthEndpoint
+	switch provider {
+	case models.OAuthProviderGoogle:
+		endpoint = &oauthEndpoint{
+			authorizeURL: "https://accounts.google.com/o/oauth2/v2/auth",
+			tokenURL:     "https://oauth2.googleapis.com/token",
+			scopes:       []string{"https://mail.google.com/", "email"},
+			clientID:     cfg.OAuth.GoogleClientID,
+			clientSecret: cfg.OAuth.GoogleClientSecret,
+			// A refresh token is only issued with offline access, and again only when consent is asked for
+			extraParams: map[string]string{"access_type": "offline", "prompt": "consent"},
+		}
+	case models.OAuthProviderMicrosoft:
+		tenant := cfg.OAuth.MicrosoftTenant
+		if tenant == "" {
+			tenant = "common"
+		}
+		endpoint = &oauthEndpoint{
+			authorizeURL: fmt.Sprintf("https://login.microsoftonline.com/%s/oauth2/v2.0/authorize", tenant),
+			tokenURL:     fmt.Sprintf("https://login.microsoftonline.com/%s/oauth2/v2.0/token", tenant),
+			scopes: []string{
+				"https://outlook.office.com/SMTP.Send",
+				"https://outlook.office.com/IMAP.AccessAsUser.All",
+				"offline_access",
+				"email",
+			},
+			clientID:     cfg.OAuth.MicrosoftClientID,
+			clientSecret: cfg.OAuth.MicrosoftClientSecret,
+			extraParams:  map[string]string{"prompt": "select_account"},
+		}
+	default:
+		return nil, fmt.Errorf("unknown oauth provider %s", provider)
+	}
+	if endpoint.clientID == "" || endpoint.clientSecret == "" {
+		return nil, fmt.Errorf("oauth for %s is not configured", strings.ToLower(string(provider)))
+	}
+	return endpoint, nil
+}
+
+// OAuthRedirectURL is where providers send users back to with the authorization code
+func OAuthRedirectURL(cfg *config.Config) string {
+	return strings.TrimSuffix(cfg.Server.PublicURL, "/") + "/oauth/callback"
+}
+
+// OAuthState is what the connect flow carries through the provider's consent page
+type OAuthState struct {
+	TeamID       string               `json:"teamId"`
+	Provider     models.OAuthProvider `json:"provider"`
+	SMTPConfigID string               `json:"smtpConfigId,omitempty"`
+	IMAPConfigID string               `json:"imapConfigId,omitempty"`
+	// Reputation connectors get read access to Postmaster Tools rather than to a mailbox
+	ReputationConnectorID string `json:"reputationConnectorId,omitempty"`
+}
+
+// OAuthAuthorizeURL returns the provider's consent page for connecting the state's configs
+func OAuthAuthorizeURL(state OAuthState, cfg *config.Config) (string, error) {
+	endpoint, err := getOAuthEndpoint(state.Provider, cfg)
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"teamId":                state.TeamID,
+		"provider":              string(state.Provider),
+		"smtpConfigId":          state.SMTPConfigID,
+		"imapConfigId":          state.IMAPConfigID,
+		"reputationConnectorId": state.ReputationConnectorID,
+		"exp":                   time.Now().Add(oauthStateExpiry).Unix(),
+	})
+	signed, err := token.SignedString([]byte(cfg.JWT.Secret))
+	if err != nil {
+		return "", err
+	}
+
+	scopes := endpoint.scopes
+	if state.ReputationConnectorID != "" {
+		scopes = []string{postmasterScope, "email"}
+	}
+
+	params := url.Values{
+		"client_id":     {endpoint.clientID},
+		"redirect_uri":  {OAuthRedirectURL(cfg)},
+		"response_type": {"code"},
+		"scope":         {strings.Join(scopes, " ")},
+		"state":         {signed},
+	}
+	for key, value := range endpoint.extraParams {
+		params.Set(key, value)
+	}
+	return endpoint.authorizeURL + "?" + params.Encode(), nil
+}
+
+// ParseOAuthState checks the state a provider sent back and returns what it carries
+func ParseOAuthState(signed string, cfg *config.Config) (*OAuthState, error) {
+	claims := jwt.MapClaims{}
+	token, err := jwt.ParseWithClaims(signed, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return []byte(cfg.JWT.Secret), nil
+	})
+	if err != nil || !token.Valid {
+		return nil, errors.New("invalid or expired state")
+	}
+
+	state := &OAuthState{}
+	state.TeamID, _ = claims["teamId"].(string)
+	provider, _ := claims["provider"].(string)
+	state.Provider = models.OAuthProvider(provider)
+	state.SMTPConfigID, _ = claims["smtpConfigId"].(string)
+	state.IMAPConfigID, _ = claims["imapConfigId"].(string)
+	state.ReputationConnectorID, _ = claims["reputationConnectorId"].(string)
+	if state.TeamID == "" || (state.SMTPConfigID == "" && state.IMAPConfigID == "" && state.ReputationConnectorID == "") {
+		return nil, errors.New("invalid state")
+	}
+	return state, nil
+}
+
+// OAuthToken is a provider's token response
+type OAuthToken struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+	Error        string `json:"error"`
+	Description  string `json:"error_description"`
+}
+
+// Credentials turns the token into what's stored on a config
+func (t *OAuthToken) Credentials(provider models.OAuthProvider) models.OAuthCredentials {
+	expiresAt := time.Now().Add(time.Duration(t.ExpiresIn) * time.Second)
+	return models.OAuthCredentials{
+		OAuthProvider:       provider,
+		OAuthAccessToken:    t.AccessToken,
+		OAuthRefreshToken:   t.RefreshToken,
+		OAuthTokenExpiresAt: &expiresAt,
+	}
+}
+
+// ExchangeOAuthCode trades the authorization code from the callback for tokens
+func ExchangeOAuthCode(provider models.OAuthProvider, code string, cfg *config.Config) (*OAuthToken, error) {
+	endpoint, err := getOAuthEndpoint(provider, cfg)
+	if err != nil {
+		return nil, err
+	}
+	token, err := requestOAuthToken(endpoint, url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {code},
+		"redirect_uri": {OAuthRedirectURL(cfg)},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if token.RefreshToken == "" {
+		return nil, errors.New("the provider didn't grant offline access")
+	}
+	return token, nil
+}
+
+// RefreshOAuthToken gets a new access token with a refresh token
+func RefreshOAuthToken(provider models.OAuthProvider, refreshToken string, cfg *config.Config) (*OAuthToken, error) {
+	endpoint, err := getOAuthEndpoint(provider, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return requestOAuthToken(endpoint, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {refreshToken},
+	})
+}
+
+func requestOAuthToken(endpoint *oauthEndpoint, form url.Values) (*OAuthToken, error) {
+	form.Set("client_id", endpoint.clientID)
+	form.Set("client_secret", endpoint.clientSecret)
+
+	resp, err := deliveryClient.PostForm(endpoint.tokenURL, form)
+	if err != nil {
+		return nil, fmt.Errorf("failed to request oauth token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	token := &OAuthToken{}
+	if err := json.Unmarshal(body, token); err != nil {
+		return nil, fmt.Errorf("failed to decode oauth token: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK || token.AccessToken == "" {
+		if token.Error == "" {
+			token.Error = resp.Status
+		}
+		return nil, &OAuthError{Code: token.Error, Description: token.Description}
+	}
+	return token, nil
+}
+
+// OAuthError is a token request the provider turned down, e.g. a revoked refresh token
+type OAuthError struct {
+	Code        string
+	Description string
+}
+
+func (e *OAuthError) Error() string {
+	if e.Description == "" {
+		return "oauth token request failed: " + e.Code
+	}
+	return fmt.Sprintf("oauth token request failed: %s: %s", e.Code, e.Description)
+}
+
+// oauthTokens holds the latest access token per config. Configs are shared between the
+// goroutines of a batch and loaded before a refresh may have happened, so the cache is what
+// keeps every send from refreshing again.
+var oauthTokens = struct {
+	sync.Mutex
+	locks  map[string]*sync.Mutex
+	tokens map[string]models.OAuthCredentials
+}{locks: map[string]*sync.Mutex{}, tokens: map[string]models.OAuthCredentials{}}
+
+// OAuthAccessToken returns a current access token for an SMTP or IMAP config, refreshing and
+// storing a new one when it's about to expire
+func OAuthAccessToken(model interface{}, id string, credentials *models.OAuthCredentials) (string, error) {
+	oauthTokens.Lock()
+	lock, ok := oauthTokens.locks[id]
+	if !ok {
+		lock = &sync.Mutex{}
+		oauthTokens.locks[id] = lock
+	}
+	oauthTokens.Unlock()
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	current := *credentials
+	oauthTokens.Lock()
+	if cached, ok := oauthTokens.tokens[id]; ok && cached.OAuthTokenExpiresAt != nil &&
+		(current.OAuthTokenExpiresAt == nil || cached.OAuthTokenExpiresAt.After(*current.OAuthTokenExpiresAt)) {
+		current = cached
+	}
+	oauthTokens.Unlock()
+
+	if current.OAuthAccessToken != "" && current.OAuthTokenExpiresAt != nil &&
+		time.Until(*current.OAuthTokenExpiresAt) > oauthRefreshMargin {
+		return current.OAuthAccessToken, nil
+	}
+	if current.OAuthRefreshToken == "" {
+		return "", errors.New("oauth mailbox has no refresh token, connect it again")
+	}
+
+	token, err := RefreshOAuthToken(current.OAuthProvider, current.OAuthRefreshToken, config.GetConfig())
+	if err != nil {
+		return "", err
+	}
+	refreshed := token.Credentials(current.OAuthProvider)
+	if err := models.SaveOAuthTokens(model, id, refreshed, db.GetDB()); err != nil {
+		return "", fmt.Errorf("failed to store refreshed oauth token: %w", err)
+	}
+	if refreshed.OAuthRefreshToken == "" {
+		refreshed.OAuthRefreshToken = current.OAuthRefreshToken
+	}
+	refreshed.AuthType = current.AuthType
+
+	oauthTokens.Lock()
+	oauthTokens.tokens[id] = refreshed
+	oauthTokens.Unlock()
+	return refreshed.OAuthAccessToken, nil
+}
+
+// xoauth2Payload is the initial response of the XOAUTH2 SASL mechanism
+func xoauth2Payload(username, accessToken string) []byte {
+	return []byte("user=" + username + "\x01auth=Bearer " + accessToken + "\x01\x01")
+}
+
+// xoauth2Auth signs in to an SMTP server with XOAUTH2
+type xoauth2Auth struct {
+	username    string
+	accessToken string
+}
+
+// XOAuth2SMTPAuth returns the SMTP authentication for a mailbox connected with OAuth2
+func XOAuth2SMTPAuth(username, accessToken string) smtp.Auth {
+	return &xoauth2Auth{username: username, accessToken: accessToken}
+}
+
+func (a *xoauth2Auth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS {
+		return "", nil, errors.New("refusing to send an oauth token over an unencrypted connection")
+	}
+	return "XOAUTH2", xoauth2Payload(a.username, a.accessToken), nil
+}
+
+func (a *xoauth2Auth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if more {
+		// The server sent its error details; an empty response gets the final error
+		return []byte{}, nil
+	}
+	return nil, nil
+}
+
+// xoauth2Client signs in to an IMAP server with XOAUTH2
+type xoauth2Client struct {
+	username    string
+	accessToken string
+}
+
+func (c *xoauth2Client) Start() (string, []byte, error) {
+	return "XOAUTH2", xoauth2Payload(c.username, c.accessToken), nil
+}
+
+func (c *xoauth2Client) Next(challenge []byte) ([]byte, error) {
+	return []byte{}, nil
+}
+
+// IMAPAuthClient returns the SASL client an IMAP config signs in with
+func IMAPAuthClient(config *models.IMAPConfig) (sasl.Client, error) {
+	if !config.UsesOAuth() {
+		return sasl.NewPlainClient("", config.Username, config.Password), nil
+	}
+	accessToken, err := OAuthAccessToken(&models.IMAPConfig{}, config.ID, &config.OAuthCredentials)
+	if err != nil {
+		return nil, err
+	}
+	return &xoauth2Client{username: config.Username, accessToken: accessToken}, nil
+}
+
+// smtpOAuth sets XOAUTH2 as the dialer's authentication when the config is connected with OAuth2
+func smtpOAuth(d *gomail.Dialer, config *models.SMTPConfig) error {
+	if !config.UsesOAuth() {
+		return nil
+	}
+	accessToken, err := OAuthAccessToken(&models.SMTPConfig{}, config.ID, &config.OAuthCredentials)
+	if err != nil {
+		return err
+	}
+	d.Auth = XOAuth2SMTPAuth(config.Username, accessToken)
+	return nil
+}
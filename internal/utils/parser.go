@@ -1,11 +1,16 @@
 package utils
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"kori/internal/config"
+	"kori/internal/models"
 	"kori/internal/utils/base64"
 	"kori/internal/utils/logger"
+	"net/url"
 	"regexp"
 	"strings"
 
@@ -22,10 +27,14 @@ var console = logger.New("console")
 func ParseVariables(html string) (map[string]string, error) {
 	variables := make(map[string]string)
 
-	re := regexp.MustCompile(`{{\s*(\w+(?:\.\w+)*)\s*}}`)
+	// Variables in filtered tags and block conditions count too, e.g. {{name | default "there"}}
+	re := regexp.MustCompile(`{{\s*(?:#(?:if|unless|each)\s+(?:(?:eq|ne)\s+)?)?(\w+(?:\.\w+)*)\s*(?:[|\s][^}]*)?}}`)
 	matches := re.FindAllStringSubmatch(html, -1)
 
 	for _, match := range matches {
+		if match[1] == "else" || match[1] == "this" || strings.HasPrefix(match[1], "this.") {
+			continue
+		}
 		variables[match[1]] = match[1]
 	}
 
@@ -35,15 +44,32 @@ func ParseVariables(html string) (map[string]string, error) {
 // ReplaceVariables input is html text with variables in the form of {{variable}} or {{ variable.subvariable }} or {{ varible }}
 // output is a string with the variables replaced by their values
 func ReplaceVariables(input string, variables map[string]string, mailId string, cfg *config.Config, trackLinks bool) string {
+	if !trackLinks {
+		return base64.EncodeToBase64(replaceVariables(input, variables))
+	}
+	return ReplaceVariablesWithLinks(input, variables, mailId, cfg, nil)
+}
+
+// ReplaceVariablesWithLinks replaces the variables and tracks the links of an email being sent,
+// pointing each link at its record in the registry
+func ReplaceVariablesWithLinks(input string, variables map[string]string, mailId string, cfg *config.Config, links *models.LinkRegistry) string {
+	input = ReplaceLinksWithRedirect(replaceVariables(input, variables), mailId, cfg, links)
+	return base64.EncodeToBase64(input)
+}
+
+// replaceVariables renders the template engine's tags. A template the engine can't render, e.g.
+// one with a block left open, still gets its plain {{variable}}s replaced.
+func replaceVariables(input string, variables map[string]string) string {
+	rendered, err := RenderTemplate(input, variables)
+	if err == nil {
+		return rendered
+	}
+	console.Error("Error rendering template, replacing variables only: %v", err)
 	for variable, value := range variables {
 		re := regexp.MustCompile(`{{\s*` + regexp.QuoteMeta(variable) + `(?:\.\w+)*\s*}}`)
 		input = re.ReplaceAllString(input, value)
 	}
-	if trackLinks {
-		input = ReplaceLinksWithRedirect(input, mailId, cfg)
-	}
-
-	return base64.EncodeToBase64(input)
+	return input
 }
 
 // JSONToMap convert datatypes.JSON to map[string]string
@@ -56,6 +82,43 @@ func JSONToMap(jsonData datatypes.JSON) (map[string]string, error) {
 	return result, nil
 }
 
+// JSONToVariables converts an email's data to its variables. Values that aren't strings, e.g. the
+// arrays templates loop over, are kept as JSON.
+func JSONToVariables(jsonData datatypes.JSON) (map[string]string, error) {
+	var data map[string]json.RawMessage
+	if err := json.Unmarshal(jsonData, &data); err != nil {
+		return nil, err
+	}
+	variables := make(map[string]string, len(data))
+	for name, raw := range data {
+		var value string
+		if err := json.Unmarshal(raw, &value); err == nil {
+			variables[name] = value
+		} else if string(raw) != "null" {
+			variables[name] = string(raw)
+		}
+	}
+	return variables, nil
+}
+
+// StringifyVariables turns variables given as JSON values into the strings templates are
+// rendered with, keeping values that aren't strings as JSON
+func StringifyVariables(data map[string]interface{}) map[string]string {
+	variables := make(map[string]string, len(data))
+	for name, value := range data {
+		switch value := value.(type) {
+		case nil:
+		case string:
+			variables[name] = value
+		default:
+			if encoded, err := json.Marshal(value); err == nil {
+				variables[name] = string(encoded)
+			}
+		}
+	}
+	return variables
+}
+
 // MapToJSON convert map[string]string to datatypes.JSON
 func MapToJSON(data map[string]string) (datatypes.JSON, error) {
 	jsonData, err := json.Marshal(data)
@@ -65,38 +128,157 @@ func MapToJSON(data map[string]string) (datatypes.JSON, error) {
 	return jsonData, nil
 }
 
-// ReplaceLinksWithRedirect usecase is to replace all the links in the html with our redirect url
-// so we can track the number of clicks
-func ReplaceLinksWithRedirect(html string, mailId string, cfg *config.Config) string {
-	// Replace anchor href links with tracking URL to track clicks
-	hrefRe := regexp.MustCompile(`<a[^>]+href="([^"]+)"`)
+var (
+	hrefRe       = regexp.MustCompile(`<a[^>]+href="([^"]+)"`)
+	anchorTextRe = regexp.MustCompile(`(?is)^[^>]*>(.*?)</a>`)
+	tagRe        = regexp.MustCompile(`<[^>]+>`)
+)
 
+// ReplaceLinksWithRedirect usecase is to replace all the links in the html with our redirect url
+// so we can track the number of clicks. With a registry, links point at their registered record;
+// without one (previews) they carry the destination. Links and the open pixel are on the team's
+// tracking domain when it has a verified one.
+func ReplaceLinksWithRedirect(html string, mailId string, cfg *config.Config, links *models.LinkRegistry) string {
 	// hash mailId into jwt
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"mailId": mailId,
-	})
-	tokenString, err := token.SignedString([]byte(cfg.JWT.Secret))
+	tokenString, err := MailToken(mailId, cfg)
 	if err != nil {
 		console.Error("Error signing token: %v", err)
 		return html
 	}
+	trackingURL := trackingBaseURL(cfg, links)
 
-	html = hrefRe.ReplaceAllStringFunc(html, func(match string) string {
-		// Extract the URL from href attribute
-		url := hrefRe.FindStringSubmatch(match)[1]
+	// Replace anchor href links with tracking URL to track clicks
+	var out strings.Builder
+	last := 0
+	for position, match := range hrefRe.FindAllStringSubmatchIndex(html, -1) {
+		url := html[match[2]:match[3]]
+		out.WriteString(html[last:match[0]])
+		last = match[1]
 
-		// Base64 encode the URL with token
-		encodedURL := base64.EncodeToBase64(url)
+		// Opt-out links carry the recipient's own token, so they're neither tracked nor registered
+		if strings.HasPrefix(url, cfg.Server.PublicURL+"/sequence-opt-out?") {
+			out.WriteString(html[match[0]:match[1]])
+			continue
+		}
 
-		// Return the replaced string
-		return fmt.Sprintf(`<a href="%s/t/click/%s?token=%s"`, cfg.Server.PublicURL, encodedURL, tokenString)
-	})
+		if links == nil {
+			// Base64 encode the URL with token, signing it so the link can't be pointed elsewhere
+			fmt.Fprintf(&out, `<a href="%s/t/click/%s?token=%s&sig=%s"`,
+				trackingURL, base64.EncodeToBase64(url), tokenString, LinkSignature(mailId, url, cfg))
+			continue
+		}
+		link, err := links.Register(url, anchorText(html[match[1]:]), position+1)
+		if err != nil {
+			// Leave the link untracked rather than broken
+			console.Error("Error registering link %s: %v", err, url)
+			out.WriteString(html[match[0]:match[1]])
+			continue
+		}
+		fmt.Fprintf(&out, `<a href="%s/t/click/l/%s?token=%s"`, trackingURL, link.ID, tokenString)
+	}
+	out.WriteString(html[last:])
+	html = out.String()
 
 	// Add tracking pixel at bottom of email to track opens
-	html = html + fmt.Sprintf(`<img src="%s/t/open?token=%s" style="display:none" width="1" height="1">`, cfg.Server.PublicURL, tokenString)
+	html = html + fmt.Sprintf(`<img src="%s/t/open?token=%s" style="display:none" width="1" height="1">`, trackingURL, tokenString)
 
 	// add unsubcribe link to the input this needs to go before the closing body tag
-	html = strings.Replace(html, "</body>", fmt.Sprintf(`<table><tr><td><a style="color: #888888; font-size: 14px; text-align: center;" href="%s/t/unsubscribe?token=%s">Unsubscribe from this list</a></td></tr></table></body>`, cfg.Server.PublicURL, tokenString), 1)
+	html = strings.Replace(html, "</body>", fmt.Sprintf(`<table><tr><td><a style="color: #888888; font-size: 14px; text-align: center;" href="%s/unsubscribe?token=%s">Unsubscribe from this list</a></td></tr></table></body>`, cfg.Server.PublicURL, tokenString), 1)
 
 	return html
 }
+
+// trackingBaseURL is where an email's tracking links point: the team's verified tracking domain,
+// on the public URL's scheme, or the public URL itself
+func trackingBaseURL(cfg *config.Config, links *models.LinkRegistry) string {
+	if links == nil {
+		return cfg.Server.PublicURL
+	}
+	host := links.TrackingHost()
+	if host == "" {
+		return cfg.Server.PublicURL
+	}
+	scheme := "https"
+	if parsed, err := url.Parse(cfg.Server.PublicURL); err == nil && parsed.Scheme != "" {
+		scheme = parsed.Scheme
+	}
+	return scheme + "://" + host
+}
+
+// anchorText returns the text of the anchor whose tag continues at the start of html
+func anchorText(html string) string {
+	match := anchorTextRe.FindStringSubmatch(html)
+	if match == nil {
+		return ""
+	}
+	return strings.Join(strings.Fields(tagRe.ReplaceAllString(match[1], " ")), " ")
+}
+
+// LinkSignature signs the destination of a click tracking link that carries it, for one email
+func LinkSignature(mailId string, url string, cfg *config.Config) string {
+	mac := hmac.New(sha256.New, []byte(cfg.JWT.Secret))
+	mac.Write([]byte(mailId + "\n" + url))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// FileSignature signs a link to a file kept on the filesystem, valid until expires (a unix time)
+func FileSignature(name string, expires int64, cfg *config.Config) string {
+	mac := hmac.New(sha256.New, []byte(cfg.JWT.Secret))
+	fmt.Fprintf(mac, "file\n%s\n%d", name, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// MailToken signs the email ID used by tracking and unsubscribe links
+func MailToken(mailId string, cfg *config.Config) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"mailId": mailId,
+	})
+	return token.SignedString([]byte(cfg.JWT.Secret))
+}
+
+// UnsubscribeURL returns the unsubscribe link for an email, used in the body and in List-Unsubscribe
+func UnsubscribeURL(mailId string, cfg *config.Config) (string, error) {
+	token, err := MailToken(mailId, cfg)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s/unsubscribe?token=%s", cfg.Server.PublicURL, token), nil
+}
+
+// SequenceOptOutURL returns the link for opting out of the automation an email was sent by,
+// given to automation emails as the sequence_opt_out_url variable
+func SequenceOptOutURL(mailId string, cfg *config.Config) (string, error) {
+	token, err := MailToken(mailId, cfg)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s/sequence-opt-out?token=%s", cfg.Server.PublicURL, token), nil
+}
+
+// PreferencesURL returns the link to the preference center of an email's recipient, given to
+// campaign and automation emails as the preferences_url variable
+func PreferencesURL(mailId string, cfg *config.Config) (string, error) {
+	token, err := MailToken(mailId, cfg)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s/preferences?token=%s", cfg.Server.PublicURL, token), nil
+}
+
+// ConfirmationToken signs the contact ID a confirmation link confirms. It carries no mail ID, so
+// it can't be used as a mail token nor a mail token as it.
+func ConfirmationToken(contactId string, cfg *config.Config) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"contactId": contactId,
+	})
+	return token.SignedString([]byte(cfg.JWT.Secret))
+}
+
+// ConfirmationURL returns the link a contact of a list that requires confirmation confirms with
+func ConfirmationURL(contactId string, cfg *config.Config) (string, error) {
+	token, err := ConfirmationToken(contactId, cfg)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s/confirm?token=%s", cfg.Server.PublicURL, token), nil
+}
@@ -0,0 +1,111 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// A4 pages of monospaced text, which is all the generated reports need
+const (
+	pdfPageWidth   = 595
+	pdfPageHeight  = 842
+	pdfMargin      = 40
+	pdfFontSize    = 8
+	pdfLineHeight  = 11
+	pdfLineChars   = 120 // Courier at 8pt fits 120 characters between the margins
+	pdfLinesOnPage = (pdfPageHeight - 2*pdfMargin) / pdfLineHeight
+)
+
+// PDFText lays lines of text out on PDF pages, wrapping long lines
+type PDFText struct {
+	lines []string
+}
+
+// Line adds a line, wrapped to the page width
+func (p *PDFText) Line(text string) {
+	text = pdfLatin1(text)
+	for len(text) > pdfLineChars {
+		cut := strings.LastIndex(text[:pdfLineChars], " ")
+		if cut <= 0 {
+			cut = pdfLineChars
+		}
+		p.lines = append(p.lines, text[:cut])
+		text = "    " + strings.TrimLeft(text[cut:], " ")
+	}
+	p.lines = append(p.lines, text)
+}
+
+// Bytes renders the document
+func (p *PDFText) Bytes() []byte {
+	var pages [][]string
+	for start := 0; start < len(p.lines) || start == 0; start += pdfLinesOnPage {
+		end := start + pdfLinesOnPage
+		if end > len(p.lines) {
+			end = len(p.lines)
+		}
+		pages = append(pages, p.lines[start:end])
+	}
+
+	// Objects: 1 catalog, 2 page tree, 3 font, then a page and its content stream per page
+	var out bytes.Buffer
+	offsets := []int{}
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n")
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 4+2*i)
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>")
+
+	for i, lines := range pages {
+		var content strings.Builder
+		fmt.Fprintf(&content, "BT\n/F1 %d Tf\n%d TL\n%d %d Td\n", pdfFontSize, pdfLineHeight, pdfMargin, pdfPageHeight-pdfMargin)
+		for _, line := range lines {
+			fmt.Fprintf(&content, "(%s) '\n", pdfEscape(line))
+		}
+		content.WriteString("ET")
+
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>",
+			pdfPageWidth, pdfPageHeight, 5+2*i))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", content.Len(), content.String()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return out.Bytes()
+}
+
+// pdfLatin1 keeps the characters the standard fonts can show, replacing the rest
+func pdfLatin1(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		switch {
+		case r == '\t':
+			b.WriteByte(' ')
+		case r < 0x20:
+		case r <= 0xff:
+			b.WriteByte(byte(r))
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
+
+// pdfEscape escapes a string for a PDF string literal
+func pdfEscape(text string) string {
+	text = strings.ReplaceAll(text, `\`, `\\`)
+	text = strings.ReplaceAll(text, "(", `\(`)
+	return strings.ReplaceAll(text, ")", `\)`)
+}
@@ -0,0 +1,95 @@
+package utils
+
+import (
+	"html"
+	"kori/internal/utils/base64"
+	"regexp"
+	"strings"
+)
+
+// PreheaderVariable is the variable templates place their preheader with, e.g. {{preheader}}
+const PreheaderVariable = "preheader"
+
+// preheaderSnippet is the hidden block the preheader is injected as when the html doesn't place it
+const preheaderSnippet = `<div style="display:none;font-size:1px;line-height:1px;max-height:0;max-width:0;opacity:0;overflow:hidden;mso-hide:all">{{` + PreheaderVariable + `}}</div>`
+
+var (
+	bodyTagRe      = regexp.MustCompile(`(?i)<body[^>]*>`)
+	preheaderVarRe = regexp.MustCompile(`{{\s*` + PreheaderVariable + `\s*}}`)
+	hiddenTagsRe   = regexp.MustCompile(`(?is)<(head|style|script|title)\b[^>]*>.*?</(head|style|script|title)>|<!--.*?-->`)
+	textAnchorRe   = regexp.MustCompile(`(?is)<a\s[^>]*href="([^"]*)"[^>]*>(.*?)</a>`)
+	lineBreakRe    = regexp.MustCompile(`(?i)<br\s*/?>|</(div|tr|table)>`)
+	paragraphRe    = regexp.MustCompile(`(?i)</(p|h[1-6]|ul|ol|blockquote)>`)
+	listItemRe     = regexp.MustCompile(`(?i)<li\b[^>]*>`)
+	cellRe         = regexp.MustCompile(`(?i)</t[dh]>`)
+	blankLinesRe   = regexp.MustCompile(`\n{3,}`)
+)
+
+// WithPreheader sets up the preheader, the snippet inboxes show after the subject. A preheader
+// given as a variable wins over the template's own. Templates place it with {{preheader}};
+// otherwise it's injected as hidden text at the top of the body. The preheader is rendered with
+// the other variables and returned among them.
+func WithPreheader(input string, preheader string, variables map[string]string) (string, map[string]string) {
+	if variables == nil {
+		variables = map[string]string{}
+	}
+	if given := variables[PreheaderVariable]; given != "" {
+		preheader = given
+	}
+	if preheader == "" {
+		if _, ok := variables[PreheaderVariable]; !ok {
+			// Templates placing the preheader themselves render it empty rather than as {{preheader}}
+			variables[PreheaderVariable] = ""
+		}
+		return input, variables
+	}
+	variables[PreheaderVariable] = replaceVariables(preheader, variables)
+
+	if preheaderVarRe.MatchString(input) {
+		return input, variables
+	}
+	if location := bodyTagRe.FindStringIndex(input); location != nil {
+		return input[:location[1]] + preheaderSnippet + input[location[1]:], variables
+	}
+	return preheaderSnippet + input, variables
+}
+
+// PlainTextBody renders an email's text alternative, base64 encoded like its html body: the
+// given text with the variables replaced or, when it's blank, text generated from the html
+func PlainTextBody(text string, input string, variables map[string]string) string {
+	if strings.TrimSpace(text) == "" {
+		text = HTMLToText(input)
+	}
+	return base64.EncodeToBase64(replaceVariables(text, variables))
+}
+
+// HTMLToText converts an email's html to readable plain text. Links keep their destination in
+// brackets after their text, paragraphs and list items keep their line breaks and images are
+// dropped.
+func HTMLToText(input string) string {
+	text := hiddenTagsRe.ReplaceAllString(input, "")
+	text = textAnchorRe.ReplaceAllStringFunc(text, func(anchor string) string {
+		match := textAnchorRe.FindStringSubmatch(anchor)
+		label := strings.Join(strings.Fields(tagRe.ReplaceAllString(match[2], " ")), " ")
+		destination := strings.TrimPrefix(match[1], "mailto:")
+		if destination == "" || strings.HasPrefix(destination, "#") || destination == label {
+			return label
+		}
+		if label == "" {
+			return destination
+		}
+		return label + " (" + destination + ")"
+	})
+	text = listItemRe.ReplaceAllString(text, "\n- ")
+	text = lineBreakRe.ReplaceAllString(text, "\n")
+	text = paragraphRe.ReplaceAllString(text, "\n\n")
+	text = cellRe.ReplaceAllString(text, " ")
+	text = html.UnescapeString(tagRe.ReplaceAllString(text, ""))
+
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.Join(strings.Fields(line), " ")
+	}
+	text = blankLinesRe.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")
+	return strings.TrimSpace(text)
+}
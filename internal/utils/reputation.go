@@ -0,0 +1,232 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"kori/internal/models"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// postmasterAPI is the Gmail Postmaster Tools API
+	postmasterAPI = "https://gmailpostmastertools.googleapis.com/v1"
+	// postmasterScope is the read-only access reputation connectors ask Google for
+	postmasterScope = "https://www.googleapis.com/auth/postmaster.readonly"
+	// sndsDataURL serves Microsoft SNDS data to holders of an automated access key
+	sndsDataURL = "https://sendersupport.olc.protection.outlook.com/snds/data.aspx"
+)
+
+// postmasterTrafficStats is a day of a domain's traffic stats from Postmaster Tools
+type postmasterTrafficStats struct {
+	Name                  string  `json:"name"` // domains/{domain}/trafficStats/{YYYYMMDD}
+	UserReportedSpamRatio float64 `json:"userReportedSpamRatio"`
+	DomainReputation      string  `json:"domainReputation"`
+	SPFSuccessRatio       float64 `json:"spfSuccessRatio"`
+	DKIMSuccessRatio      float64 `json:"dkimSuccessRatio"`
+	DMARCSuccessRatio     float64 `json:"dmarcSuccessRatio"`
+	DeliveryErrors        []struct {
+		ErrorClass string  `json:"errorClass"`
+		ErrorType  string  `json:"errorType"`
+		ErrorRatio float64 `json:"errorRatio"`
+	} `json:"deliveryErrors"`
+}
+
+// FetchPostmasterMetrics returns the domain's daily reputation at Gmail from start up to, not
+// including, end. Postmaster Tools only has data for domains the connected Google account has
+// verified there.
+func FetchPostmasterMetrics(connector *models.ReputationConnector, domain string, start, end time.Time) ([]models.ReputationMetric, error) {
+	if !connector.UsesOAuth() {
+		return nil, errors.New("connect the Google account with access to Postmaster Tools first")
+	}
+	accessToken, err := OAuthAccessToken(&models.ReputationConnector{}, connector.ID, &connector.OAuthCredentials)
+	if err != nil {
+		return nil, err
+	}
+
+	var metrics []models.ReputationMetric
+	pageToken := ""
+	for {
+		params := url.Values{
+			"startDate.year":  {strconv.Itoa(start.Year())},
+			"startDate.month": {strconv.Itoa(int(start.Month()))},
+			"startDate.day":   {strconv.Itoa(start.Day())},
+			"endDate.year":    {strconv.Itoa(end.Year())},
+			"endDate.month":   {strconv.Itoa(int(end.Month()))},
+			"endDate.day":     {strconv.Itoa(end.Day())},
+			"pageSize":        {"100"},
+		}
+		if pageToken != "" {
+			params.Set("pageToken", pageToken)
+		}
+		req, err := http.NewRequest(http.MethodGet,
+			fmt.Sprintf("%s/domains/%s/trafficStats?%s", postmasterAPI, url.PathEscape(domain), params.Encode()), nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+
+		var page struct {
+			TrafficStats  []postmasterTrafficStats `json:"trafficStats"`
+			NextPageToken string                   `json:"nextPageToken"`
+		}
+		if err := fetchReputationJSON(req, &page); err != nil {
+			return nil, fmt.Errorf("failed to get postmaster stats of %s: %w", domain, err)
+		}
+
+		for _, stats := range page.TrafficStats {
+			metric, err := stats.metric(connector, domain)
+			if err != nil {
+				return nil, err
+			}
+			metrics = append(metrics, *metric)
+		}
+
+		if page.NextPageToken == "" {
+			return metrics, nil
+		}
+		pageToken = page.NextPageToken
+	}
+}
+
+func (s *postmasterTrafficStats) metric(connector *models.ReputationConnector, domain string) (*models.ReputationMetric, error) {
+	date, err := time.Parse("20060102", s.Name[strings.LastIndex(s.Name, "/")+1:])
+	if err != nil {
+		return nil, fmt.Errorf("invalid postmaster stats name %q", s.Name)
+	}
+
+	errorRate := 0.0
+	deliveryErrors := make([]models.ReputationDeliveryError, len(s.DeliveryErrors))
+	for i, deliveryError := range s.DeliveryErrors {
+		deliveryErrors[i] = models.ReputationDeliveryError{
+			Class: deliveryError.ErrorClass,
+			Type:  deliveryError.ErrorType,
+			Rate:  deliveryError.ErrorRatio,
+		}
+		errorRate += deliveryError.ErrorRatio
+	}
+	encoded, err := json.Marshal(deliveryErrors)
+	if err != nil {
+		return nil, err
+	}
+
+	reputation := s.DomainReputation
+	if reputation == "REPUTATION_CATEGORY_UNSPECIFIED" {
+		reputation = ""
+	}
+	return &models.ReputationMetric{
+		ConnectorID:       connector.ID,
+		Provider:          connector.Provider,
+		Date:              date,
+		Domain:            strings.ToLower(domain),
+		Reputation:        reputation,
+		SpamRate:          s.UserReportedSpamRatio,
+		DeliveryErrorRate: errorRate,
+		DeliveryErrors:    encoded,
+		SPFSuccessRate:    s.SPFSuccessRatio,
+		DKIMSuccessRate:   s.DKIMSuccessRatio,
+		DMARCSuccessRate:  s.DMARCSuccessRatio,
+		TeamID:            connector.TeamID,
+	}, nil
+}
+
+// FetchSNDSMetrics returns the reputation at Outlook of the IPs the connector's key covers, for
+// the day given. Days SNDS has no data for yet give no metrics.
+func FetchSNDSMetrics(connector *models.ReputationConnector, date time.Time) ([]models.ReputationMetric, error) {
+	if connector.SNDSKey == "" {
+		return nil, errors.New("snds connector has no data access key")
+	}
+
+	params := url.Values{"key": {connector.SNDSKey}, "date": {date.Format("010206")}}
+	resp, err := deliveryClient.Get(sndsDataURL + "?" + params.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("snds request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 8<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snds data: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("snds returned status code %d", resp.StatusCode)
+	}
+
+	reader := csv.NewReader(bytes.NewReader(body))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("invalid snds data: %w", err)
+	}
+
+	// IP, activity start and end, RCPT and DATA commands, message recipients, filter result,
+	// complaint rate, trap period start and end, trap hits, sample HELO, JMR P1 sender, comments
+	var metrics []models.ReputationMetric
+	for _, record := range records {
+		if len(record) < 11 || net.ParseIP(record[0]) == nil {
+			continue
+		}
+		messages, _ := strconv.Atoi(record[5])
+		trapHits, _ := strconv.Atoi(record[10])
+		metrics = append(metrics, models.ReputationMetric{
+			ConnectorID: connector.ID,
+			Provider:    connector.Provider,
+			Date:        time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC),
+			IP:          record[0],
+			Reputation:  strings.ToUpper(strings.TrimSpace(record[6])),
+			SpamRate:    parseSNDSRate(record[7]),
+			Messages:    messages,
+			TrapHits:    trapHits,
+			TeamID:      connector.TeamID,
+		})
+	}
+	return metrics, nil
+}
+
+// parseSNDSRate turns an SNDS complaint rate like "0.3%" into a ratio. Rates SNDS only gives as
+// "< 0.1%" count as none.
+func parseSNDSRate(value string) float64 {
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(value, "<") {
+		return 0
+	}
+	rate, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(value, "%")), 64)
+	if err != nil {
+		return 0
+	}
+	return rate / 100
+}
+
+func fetchReputationJSON(req *http.Request, out interface{}) error {
+	resp, err := deliveryClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 8<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if json.Unmarshal(body, &apiErr) == nil && apiErr.Error.Message != "" {
+			return fmt.Errorf("status code %d: %s", resp.StatusCode, apiErr.Error.Message)
+		}
+		return fmt.Errorf("status code %d", resp.StatusCode)
+	}
+	return json.Unmarshal(body, out)
+}
@@ -0,0 +1,127 @@
+package utils
+
+import (
+	"errors"
+	"kori/internal/hooks"
+	"net"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// SendErrorClass groups send failures by how they should be retried
+type SendErrorClass string
+
+const (
+	SendErrorTransient   SendErrorClass = "transient"    // 4xx replies, timeouts, connection problems
+	SendErrorRateLimited SendErrorClass = "rate_limited" // the receiver or provider is throttling us
+	SendErrorAuth        SendErrorClass = "auth"         // credentials rejected; needs the SMTP config fixed
+	SendErrorPermanent   SendErrorClass = "permanent"    // 5xx replies that won't change on retry
+)
+
+// MaxEmailAttempts caps how many times an email is tried, whatever the error
+const MaxEmailAttempts = 8
+
+// RetryPolicy is how often and how fast a class of failure is retried. Delays grow
+// exponentially from BaseDelay up to MaxDelay.
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+// RetryPolicies are the retry policies per error class
+var RetryPolicies = map[SendErrorClass]RetryPolicy{
+	SendErrorTransient:   {MaxAttempts: 5, BaseDelay: 5 * time.Minute, MaxDelay: 6 * time.Hour},
+	SendErrorRateLimited: {MaxAttempts: MaxEmailAttempts, BaseDelay: 15 * time.Minute, MaxDelay: 6 * time.Hour},
+	SendErrorAuth:        {MaxAttempts: 2, BaseDelay: time.Hour, MaxDelay: time.Hour},
+	SendErrorPermanent:   {MaxAttempts: 1},
+}
+
+// ClassifySendError decides what kind of failure a send error is
+func ClassifySendError(err error) SendErrorClass {
+	if err == nil {
+		return ""
+	}
+
+	message := strings.ToLower(err.Error())
+	throttled := strings.Contains(message, "rate") || strings.Contains(message, "too many") || strings.Contains(message, "throttl")
+
+	var reply *textproto.Error
+	if errors.As(err, &reply) {
+		switch {
+		case reply.Code == 530 || reply.Code == 534 || reply.Code == 535:
+			return SendErrorAuth
+		case reply.Code >= 400 && reply.Code < 500 && throttled:
+			return SendErrorRateLimited
+		case reply.Code >= 400 && reply.Code < 500:
+			return SendErrorTransient
+		case reply.Code >= 500:
+			return SendErrorPermanent
+		}
+	}
+
+	// An extension rejecting the email won't change its mind
+	var rejected *hooks.RejectedError
+	if errors.As(err, &rejected) {
+		return SendErrorPermanent
+	}
+
+	// A refresh token the mailbox provider no longer accepts needs the mailbox connected again
+	var oauthErr *OAuthError
+	if errors.As(err, &oauthErr) {
+		return SendErrorAuth
+	}
+
+	// API providers answer like any HTTP API
+	var providerErr *ProviderError
+	if errors.As(err, &providerErr) {
+		switch code := providerErr.StatusCode; {
+		case code == 401 || code == 403:
+			return SendErrorAuth
+		case code == 429:
+			return SendErrorRateLimited
+		case code >= 500 || code == 408:
+			return SendErrorTransient
+		default:
+			return SendErrorPermanent
+		}
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return SendErrorTransient
+	}
+
+	switch {
+	case strings.Contains(message, "authentication") || strings.Contains(message, "auth failed") || strings.Contains(message, "username and password"):
+		return SendErrorAuth
+	case throttled:
+		return SendErrorRateLimited
+	case strings.Contains(message, "decode email body") || strings.Contains(message, "attachments exceed"):
+		// A broken body or oversized attachments fail the same way every time
+		return SendErrorPermanent
+	}
+	return SendErrorTransient
+}
+
+// NextRetryAt returns when an email that has failed attempts times with the given class
+// should be tried again, and false when it shouldn't be retried
+func NextRetryAt(class SendErrorClass, attempts int, now time.Time) (time.Time, bool) {
+	policy, ok := RetryPolicies[class]
+	if !ok {
+		policy = RetryPolicies[SendErrorTransient]
+	}
+	if attempts >= policy.MaxAttempts || attempts >= MaxEmailAttempts {
+		return time.Time{}, false
+	}
+
+	delay := policy.BaseDelay
+	for i := 1; i < attempts && delay < policy.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > policy.MaxDelay {
+		delay = policy.MaxDelay
+	}
+	return now.Add(delay), true
+}
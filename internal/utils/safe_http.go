@@ -0,0 +1,81 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+// ErrNonPublicAddress is returned connecting to a URL a team gave that resolves to an address
+// outside the public internet
+var ErrNonPublicAddress = errors.New("address is not publicly routable")
+
+// nonPublicPrefixes are the ranges, on top of loopback, private and link-local addresses, that
+// aren't reachable on the public internet
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),       // this network
+	netip.MustParsePrefix("100.64.0.0/10"),   // carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),    // IETF protocol assignments
+	netip.MustParsePrefix("192.0.2.0/24"),    // documentation
+	netip.MustParsePrefix("198.18.0.0/15"),   // benchmarking
+	netip.MustParsePrefix("198.51.100.0/24"), // documentation
+	netip.MustParsePrefix("203.0.113.0/24"),  // documentation
+	netip.MustParsePrefix("240.0.0.0/4"),     // reserved, and broadcast
+	netip.MustParsePrefix("64:ff9b::/96"),    // NAT64, which can map to private IPv4 addresses
+	netip.MustParsePrefix("2001:db8::/32"),   // documentation
+}
+
+// IsPublicAddress reports whether addr is reachable on the public internet
+func IsPublicAddress(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsValid() || addr.IsLoopback() || addr.IsPrivate() || addr.IsUnspecified() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() || addr.IsMulticast() {
+		return false
+	}
+	for _, prefix := range nonPublicPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// SafeTransport connects only to public addresses, so URLs teams give (feeds, webhooks, scoring
+// endpoints, links) can't reach the services next to the server. The address is checked as it's
+// dialed, after resolution, so every redirect and DNS answer is held to it.
+var SafeTransport = &http.Transport{
+	// A proxy would be dialed instead of the URL's host, so none is used
+	Proxy: nil,
+	DialContext: (&net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return fmt.Errorf("%w: %s", ErrNonPublicAddress, address)
+			}
+			if !IsPublicAddress(addrPort.Addr()) {
+				return fmt.Errorf("%w: %s", ErrNonPublicAddress, addrPort.Addr())
+			}
+			return nil
+		},
+	}).DialContext,
+	ForceAttemptHTTP2:     true,
+	MaxIdleConns:          100,
+	IdleConnTimeout:       90 * time.Second,
+	TLSHandshakeTimeout:   10 * time.Second,
+	ExpectContinueTimeout: time.Second,
+}
+
+// SafeHTTPClient is the client for requests to URLs teams give. Callers needing their own timeout
+// or redirect policy use NewSafeHTTPClient, which shares its transport.
+var SafeHTTPClient = NewSafeHTTPClient(60 * time.Second)
+
+// NewSafeHTTPClient returns a client connecting only to public addresses, timing out after timeout
+func NewSafeHTTPClient(timeout time.Duration) *http.Client {
+	return &http.Client{Transport: SafeTransport, Timeout: timeout}
+}
@@ -0,0 +1,116 @@
+package utils
+
+import (
+	"html"
+	"strings"
+
+	xhtml "golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+var (
+	// sanitizeTags are the elements kept by SanitizeHTML, the ones mail clients render in a
+	// signature or short snippet
+	sanitizeTags = map[string]bool{
+		"a": true, "b": true, "blockquote": true, "br": true, "center": true, "div": true, "em": true,
+		"font": true, "h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true, "hr": true,
+		"i": true, "img": true, "li": true, "ol": true, "p": true, "s": true, "small": true, "span": true,
+		"strong": true, "sub": true, "sup": true, "table": true, "tbody": true, "td": true, "th": true,
+		"thead": true, "tr": true, "u": true, "ul": true,
+	}
+	// sanitizeDroppedTags are the elements dropped along with their content
+	sanitizeDroppedTags = map[string]bool{
+		"script": true, "style": true, "head": true, "title": true, "iframe": true, "object": true,
+		"embed": true, "form": true, "select": true, "textarea": true, "svg": true, "math": true, "noscript": true,
+	}
+	sanitizeAttributes = map[string]bool{
+		"align": true, "alt": true, "bgcolor": true, "border": true, "cellpadding": true, "cellspacing": true,
+		"class": true, "color": true, "colspan": true, "face": true, "height": true, "href": true,
+		"rowspan": true, "size": true, "src": true, "style": true, "target": true, "title": true,
+		"valign": true, "width": true,
+	}
+	// sanitizeURLPrefixes are the links and image sources kept; {{ keeps variables filled in later
+	sanitizeURLPrefixes = []string{"http://", "https://", "mailto:", "tel:", "cid:", "#", "{{"}
+	// sanitizeStyleBlocklist are CSS constructs that can run script or load from elsewhere
+	sanitizeStyleBlocklist = []string{"expression(", "javascript:", "url(", "behavior:", "\\", "@import"}
+	textEscaper            = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+)
+
+// SanitizeHTML keeps the formatting elements and attributes of user supplied html and drops the
+// rest: scripts, styles, forms, event handlers and links that aren't web, mail or phone links.
+// The html is parsed the way browsers do, so the result is balanced and can be appended to an
+// email body safely. Text keeps its quotes so template tags like {{name | default "there"}}
+// still render.
+func SanitizeHTML(input string) string {
+	body := &xhtml.Node{Type: xhtml.ElementNode, Data: "body", DataAtom: atom.Body}
+	nodes, err := xhtml.ParseFragment(strings.NewReader(input), body)
+	if err != nil {
+		return textEscaper.Replace(HTMLToText(input))
+	}
+	var out strings.Builder
+	for _, node := range nodes {
+		sanitizeNode(&out, node)
+	}
+	return out.String()
+}
+
+func sanitizeNode(out *strings.Builder, node *xhtml.Node) {
+	switch node.Type {
+	case xhtml.TextNode:
+		out.WriteString(textEscaper.Replace(node.Data))
+		return
+	case xhtml.ElementNode:
+	default:
+		return // comments and doctypes
+	}
+	if sanitizeDroppedTags[node.Data] {
+		return
+	}
+
+	kept := node.Namespace == "" && sanitizeTags[node.Data]
+	if kept {
+		out.WriteString("<" + node.Data)
+		for _, attribute := range node.Attr {
+			if sanitizeAttribute(attribute) {
+				out.WriteString(" " + attribute.Key + `="` + html.EscapeString(attribute.Val) + `"`)
+			}
+		}
+		out.WriteString(">")
+		if sanitizeVoidTag(node.Data) {
+			return
+		}
+	}
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		sanitizeNode(out, child)
+	}
+	if kept {
+		out.WriteString("</" + node.Data + ">")
+	}
+}
+
+func sanitizeAttribute(attribute xhtml.Attribute) bool {
+	if attribute.Namespace != "" || !sanitizeAttributes[attribute.Key] {
+		return false
+	}
+	value := strings.ToLower(strings.Join(strings.Fields(attribute.Val), ""))
+	switch attribute.Key {
+	case "href", "src":
+		for _, prefix := range sanitizeURLPrefixes {
+			if strings.HasPrefix(value, prefix) {
+				return true
+			}
+		}
+		return false
+	case "style":
+		for _, blocked := range sanitizeStyleBlocklist {
+			if strings.Contains(value, blocked) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func sanitizeVoidTag(tag string) bool {
+	return tag == "br" || tag == "hr" || tag == "img"
+}
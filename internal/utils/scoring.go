@@ -0,0 +1,102 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"kori/internal/models"
+	"net/http"
+	"time"
+)
+
+// ScoringEvent is sent in the X-Posthoot-Event header of scoring requests
+const ScoringEvent = "contacts.score"
+
+// ScoringRequest is the body posted to a scoring endpoint
+type ScoringRequest struct {
+	CampaignID   string                   `json:"campaignId,omitempty"`
+	CampaignName string                   `json:"campaignName,omitempty"`
+	Contacts     []models.ContactFeatures `json:"contacts"`
+	Timestamp    time.Time                `json:"timestamp"`
+}
+
+// ScoringResponse is what a scoring endpoint returns. Contacts missing from it are kept with priority 0.
+type ScoringResponse struct {
+	Scores []models.ContactScore `json:"scores"`
+}
+
+// ScoreContacts posts contact features to the scoring endpoint in batches and returns the scores by contact ID
+func ScoreContacts(ctx context.Context, endpoint *models.ScoringEndpoint, campaign *models.Campaign, features []models.ContactFeatures) (map[string]models.ContactScore, error) {
+	batchSize := endpoint.BatchSize
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+	timeout := time.Duration(endpoint.TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	// The endpoint is the team's, so only public addresses are called
+	client := NewSafeHTTPClient(timeout)
+
+	scores := make(map[string]models.ContactScore, len(features))
+	for start := 0; start < len(features); start += batchSize {
+		end := min(start+batchSize, len(features))
+
+		request := ScoringRequest{Contacts: features[start:end], Timestamp: time.Now().UTC()}
+		if campaign != nil {
+			request.CampaignID = campaign.ID
+			request.CampaignName = campaign.Name
+		}
+
+		response, err := postScoringBatch(ctx, client, endpoint, request)
+		if err != nil {
+			return nil, err
+		}
+		for _, score := range response.Scores {
+			scores[score.ID] = score
+		}
+	}
+
+	return scores, nil
+}
+
+func postScoringBatch(ctx context.Context, client *http.Client, endpoint *models.ScoringEndpoint, request ScoringRequest) (*ScoringResponse, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal scoring request: %w", err)
+	}
+
+	// Sign the body the same way webhooks are signed
+	mac := hmac.New(sha256.New, []byte(endpoint.Secret))
+	mac.Write(body)
+	signature := hex.EncodeToString(mac.Sum(nil))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build scoring request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Posthoot-Event", ScoringEvent)
+	req.Header.Set("X-Posthoot-Signature", signature)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("scoring endpoint request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("scoring endpoint returned status code %d", resp.StatusCode)
+	}
+
+	response := &ScoringResponse{}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 32<<20)).Decode(response); err != nil {
+		return nil, fmt.Errorf("invalid scoring response: %w", err)
+	}
+	return response, nil
+}
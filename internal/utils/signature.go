@@ -0,0 +1,38 @@
+package utils
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+var closingBodyRe = regexp.MustCompile(`(?i)</body\s*>`)
+
+// RenderSignature fills a signature's variables, escaped as they may be names anyone typed in,
+// and sanitizes the result again so variables can't turn into links the saved html didn't have
+func RenderSignature(signature string, variables map[string]string) string {
+	escaped := make(map[string]string, len(variables))
+	for name, value := range variables {
+		escaped[name] = html.EscapeString(value)
+	}
+	return SanitizeHTML(replaceVariables(signature, escaped))
+}
+
+// AppendSignature adds a rendered signature to the end of an email's html, inside its body, and
+// to its text alternative when it has one of its own rather than one generated from the html
+func AppendSignature(body, text, signature string) (string, string) {
+	if strings.TrimSpace(signature) == "" {
+		return body, text
+	}
+	block := `<div class="signature">` + signature + `</div>`
+	if locations := closingBodyRe.FindAllStringIndex(body, -1); len(locations) > 0 {
+		last := locations[len(locations)-1]
+		body = body[:last[0]] + block + body[last[0]:]
+	} else {
+		body += block
+	}
+	if strings.TrimSpace(text) != "" {
+		text = strings.TrimRight(text, "\n") + "\n\n-- \n" + HTMLToText(signature)
+	}
+	return body, text
+}
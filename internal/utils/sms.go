@@ -0,0 +1,139 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"kori/internal/models"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// twilioAPI is the base of Twilio's REST API
+const twilioAPI = "https://api.twilio.com/2010-04-01"
+
+// SMSMessage is a text message as handed to an SMS provider
+type SMSMessage struct {
+	ID      string `json:"id"` // ours, so the provider's callbacks can refer to it
+	EmailID string `json:"emailId,omitempty"`
+	From    string `json:"from"`
+	To      string `json:"to"`
+	Body    string `json:"body"`
+}
+
+// SMSSender sends text messages through an SMS provider's HTTP API
+type SMSSender interface {
+	// Send hands the message to the provider and returns the provider's message ID
+	Send(config *models.SMSConfig, message *SMSMessage) (string, error)
+}
+
+var smsSenders = map[models.SMSProvider]SMSSender{
+	models.SMSProviderTwilio:  twilioSender{},
+	models.SMSProviderWebhook: webhookSMSSender{},
+}
+
+// SendSMS sends a text message through the config's provider
+func SendSMS(config *models.SMSConfig, message *SMSMessage) (string, error) {
+	sender, ok := smsSenders[config.Provider]
+	if !ok {
+		return "", fmt.Errorf("unknown sms provider %s", config.Provider)
+	}
+	return sender.Send(config, message)
+}
+
+// RenderSMS fills a text message's variables and cuts it to the longest message providers take
+func RenderSMS(message string, variables map[string]string) string {
+	text := strings.TrimSpace(replaceVariables(message, variables))
+	if len(text) <= models.MaxSMSLength {
+		return text
+	}
+	n := models.MaxSMSLength
+	for n > 0 && !utf8.RuneStart(text[n]) {
+		n--
+	}
+	return text[:n]
+}
+
+// smsWebhookClient posts to the gateways teams give, so it only reaches public addresses
+var smsWebhookClient = NewSafeHTTPClient(30 * time.Second)
+
+// doSMS sends a request to an SMS provider with client and decodes a successful JSON response into out
+func doSMS(client *http.Client, provider models.SMSProvider, req *http.Request, out interface{}) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return &ProviderError{Provider: string(provider), StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(body))}
+	}
+	// Gateways may answer with plain text, which there's nothing to read from
+	if out != nil && len(bytes.TrimSpace(body)) > 0 && strings.Contains(resp.Header.Get("Content-Type"), "json") {
+		if err := json.Unmarshal(body, out); err != nil {
+			return fmt.Errorf("failed to decode %s response: %w", strings.ToLower(string(provider)), err)
+		}
+	}
+	return nil
+}
+
+// twilioSender sends through Twilio's Messages API
+type twilioSender struct{}
+
+func (twilioSender) Send(config *models.SMSConfig, message *SMSMessage) (string, error) {
+	form := url.Values{}
+	form.Set("From", message.From)
+	form.Set("To", message.To)
+	form.Set("Body", message.Body)
+
+	endpoint := fmt.Sprintf("%s/Accounts/%s/Messages.json", twilioAPI, url.PathEscape(config.AccountSID))
+	req, err := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.SetBasicAuth(config.AccountSID, config.AuthToken)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var response struct {
+		SID string `json:"sid"`
+	}
+	if err := doSMS(deliveryClient, config.Provider, req, &response); err != nil {
+		return "", err
+	}
+	return response.SID, nil
+}
+
+// webhookSMSSender posts the message as JSON to the team's gateway, with the config's token as
+// a bearer token. A JSON response with an id is kept as the provider's message ID.
+type webhookSMSSender struct{}
+
+func (webhookSMSSender) Send(config *models.SMSConfig, message *SMSMessage) (string, error) {
+	body, err := json.Marshal(message)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal sms: %w", err)
+	}
+	req, err := http.NewRequest(http.MethodPost, config.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if config.AuthToken != "" {
+		req.Header.Set("Authorization", "Bearer "+config.AuthToken)
+	}
+
+	var response struct {
+		ID string `json:"id"`
+	}
+	if err := doSMS(smsWebhookClient, config.Provider, req, &response); err != nil {
+		return "", err
+	}
+	return response.ID, nil
+}
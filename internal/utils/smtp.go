@@ -1,11 +1,16 @@
 package utils
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
+	"io"
+	"kori/internal/config"
 	"kori/internal/db"
+	"kori/internal/hooks"
 	"kori/internal/models"
 	"kori/internal/utils/base64"
+	"maps"
 	"strings"
 	"sync"
 	"time"
@@ -48,7 +53,7 @@ func NewEmailHandler(maxSendRate int) *EmailHandler {
 	}
 }
 
-// SendEmail sends a single email using the configured SMTP server
+// SendEmail sends a single email through the configured SMTP server or API provider
 func (h *EmailHandler) SendEmail(email *models.Email) error {
 	if email == nil {
 		return fmt.Errorf("email is nil")
@@ -62,11 +67,109 @@ func (h *EmailHandler) SendEmail(email *models.Email) error {
 		return fmt.Errorf("SMTP config is nil")
 	}
 
-	h.logger.Info("📧 Sending email to: %s using SMTP server: %s", email.To, email.SMTPConfig.Host)
+	h.logger.Info("📧 Sending email to: %s using %s server: %s", email.To, email.SMTPConfig.Provider, email.SMTPConfig.Host)
 
-	// Create new message
+	// Lets bounces and complaints be matched back to this email
+	headers := map[string]string{EmailIDHeader: email.ID}
+
+	// One-click unsubscribe (RFC 8058) for mail sent to a contact
+	if email.ContactID != "" {
+		unsubscribeURL, err := UnsubscribeURL(email.ID, config.GetConfig())
+		if err != nil {
+			return fmt.Errorf("❌ failed to build unsubscribe url: %w", err)
+		}
+		headers["List-Unsubscribe"] = "<" + unsubscribeURL + ">"
+		headers["List-Unsubscribe-Post"] = "List-Unsubscribe=One-Click"
+	}
+
+	// Replies, like inbox follow-ups, are threaded under the message they answer
+	if email.InReplyTo != "" {
+		headers["In-Reply-To"] = email.InReplyTo
+		headers["References"] = email.InReplyTo
+	}
+
+	// List-Id, Precedence and Feedback-ID let mailbox providers report on campaign and marketing mail
+	listHeaders, err := models.ListHeaders(email, db.GetDB())
+	if err != nil {
+		h.logger.Warn("⚠️ Failed to get list headers of email %s: %v", email.ID, err)
+	}
+	maps.Copy(headers, listHeaders)
+
+	// Decode base64 body
+	decodedBody, err := base64.DecodeFromBase64(email.Body)
+	if err != nil {
+		return fmt.Errorf("❌ failed to decode email body: %w", err)
+	}
+	decodedText := ""
+	if email.PlainText != "" {
+		decodedText, err = base64.DecodeFromBase64(email.PlainText)
+		if err != nil {
+			return fmt.Errorf("❌ failed to decode email plain text: %w", err)
+		}
+	}
+
+	// Send email
+	now := time.Now()
+	email.Attempts++
+	email.LastAttemptAt = now
+
+	// Extensions may change the email or reject it before it goes out
+	decodedBody, decodedText, err = runBeforeSendHooks(email, decodedBody, decodedText, headers)
+	if err == nil {
+		if provider, ok := GetDeliveryProvider(email.SMTPConfig.Provider); ok {
+			err = sendWithProvider(provider, email, decodedBody, decodedText, headers)
+		} else {
+			err = sendWithSMTP(email, decodedBody, decodedText, headers)
+		}
+	}
+	if err != nil {
+		class := ClassifySendError(err)
+		email.Error = err.Error()
+		email.Status = models.EmailStatusFailed
+		email.ErrorClass = string(class)
+		email.NextRetryAt = nil
+		if next, ok := NextRetryAt(class, email.Attempts, now); ok {
+			email.NextRetryAt = &next
+		}
+		// Written as a map so clearing the next retry is saved too
+		if dbErr := db.GetDB().Model(email).Updates(map[string]interface{}{
+			"status":          email.Status,
+			"error":           email.Error,
+			"error_class":     email.ErrorClass,
+			"attempts":        email.Attempts,
+			"last_attempt_at": email.LastAttemptAt,
+			"next_retry_at":   email.NextRetryAt,
+		}).Error; dbErr != nil {
+			return h.logger.Error("❌ Failed to update email status", dbErr)
+		}
+		return h.logger.Error("❌ failed to send email: %w", err)
+	}
+
+	email.SentAt = now
+	email.Status = models.EmailStatusSent
+	email.Error = ""
+
+	if err := h.UpdateEmail(email); err != nil {
+		return fmt.Errorf("❌ failed to update email: %w", err)
+	}
+	if email.NextRetryAt != nil || email.ErrorClass != "" {
+		db.GetDB().Model(&models.Email{}).Where("id = ?", email.ID).Updates(map[string]interface{}{"next_retry_at": nil, "error_class": "", "error": ""})
+	}
+
+	h.logger.Success("✅ Email sent successfully to: %s", email.To)
+
+	return nil
+}
+
+// sendWithSMTP sends an email through the config's SMTP server. With a plain text body the
+// message is multipart/alternative, the html part last so clients prefer it.
+func sendWithSMTP(email *models.Email, body string, text string, headers map[string]string) error {
 	m := gomail.NewMessage()
-	m.SetHeader("From", email.From)
+	if email.FromName != "" {
+		m.SetAddressHeader("From", email.From, email.FromName)
+	} else {
+		m.SetHeader("From", email.From)
+	}
 	m.SetHeader("To", email.To)
 	m.SetHeader("Subject", email.Subject)
 
@@ -82,12 +185,15 @@ func (h *EmailHandler) SendEmail(email *models.Email) error {
 		m.SetHeader("Bcc", strings.Split(email.BCC, ",")...)
 	}
 
-	// Decode base64 body
-	decodedBody, err := base64.DecodeFromBase64(email.Body)
-	if err != nil {
-		return fmt.Errorf("❌ failed to decode email body: %w", err)
+	for name, value := range headers {
+		m.SetHeader(name, value)
+	}
+	if text != "" {
+		m.SetBody("text/plain", text)
+		m.AddAlternative("text/html", body)
+	} else {
+		m.SetBody("text/html", body)
 	}
-	m.SetBody("text/html", decodedBody)
 
 	// Create dialer
 	d := gomail.NewDialer(
@@ -100,30 +206,147 @@ func (h *EmailHandler) SendEmail(email *models.Email) error {
 	if email.SMTPConfig.SupportsTLS {
 		d.TLSConfig = &tls.Config{InsecureSkipVerify: true}
 	}
+	if err := smtpOAuth(d, email.SMTPConfig); err != nil {
+		return err
+	}
 
-	// Send email
-	if err := d.DialAndSend(m); err != nil {
-		email.Error = err.Error()
-		email.Status = models.EmailStatusFailed
-		if dbErr := h.UpdateEmail(email); dbErr != nil {
-			return h.logger.Error("❌ Failed to update email status", dbErr)
-		}
-		return h.logger.Error("❌ failed to send email: %w", err)
+	if err := attachFiles(m, email); err != nil {
+		return err
 	}
+	return d.DialAndSend(m)
+}
 
-	email.SentAt = time.Now()
-	email.Status = models.EmailStatusSent
-	email.Error = ""
+// sendWithProvider sends an email through an API provider
+func sendWithProvider(provider DeliveryProvider, email *models.Email, body string, text string, headers map[string]string) error {
+	message := &DeliveryMessage{
+		EmailID:  email.ID,
+		From:     email.From,
+		FromName: email.FromName,
+		To:       email.To,
+		ReplyTo:  email.ReplyTo,
+		Subject:  email.Subject,
+		HTML:     body,
+		Text:     text,
+		Headers:  headers,
+	}
+	if email.CC != "" {
+		message.Cc = strings.Split(email.CC, ",")
+	}
+	if email.BCC != "" {
+		message.Bcc = strings.Split(email.BCC, ",")
+	}
 
-	if err := h.UpdateEmail(email); err != nil {
-		return fmt.Errorf("❌ failed to update email: %w", err)
+	attachments, err := loadAttachments(email)
+	if err != nil {
+		return err
 	}
+	message.Attachments = attachments
 
-	h.logger.Success("✅ Email sent successfully to: %s", email.To)
+	_, err = provider.Send(email.SMTPConfig, message)
+	return err
+}
+
+// CheckSMTPConnection connects and authenticates to an SMTP server without sending anything.
+// API providers are checked with an authenticated request instead.
+func CheckSMTPConnection(config *models.SMTPConfig) error {
+	if provider, ok := GetDeliveryProvider(config.Provider); ok {
+		return provider.Check(config)
+	}
+
+	d := gomail.NewDialer(config.Host, config.Port, config.Username, config.Password)
+	if !config.RequiresAuth {
+		d.Username = ""
+		d.Password = ""
+	}
+	if config.SupportsTLS {
+		d.TLSConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	if err := smtpOAuth(d, config); err != nil {
+		return err
+	}
+
+	closer, err := d.Dial()
+	if err != nil {
+		return err
+	}
+	return closer.Close()
+}
 
+// attachFiles downloads the email's attachments from storage and adds them to the message
+func attachFiles(m *gomail.Message, email *models.Email) error {
+	attachments, err := loadAttachments(email)
+	if err != nil {
+		return err
+	}
+	for _, attachment := range attachments {
+		content := attachment.Content
+		settings := []gomail.FileSetting{gomail.SetCopyFunc(func(w io.Writer) error {
+			_, err := w.Write(content)
+			return err
+		})}
+		if attachment.Type != "" {
+			settings = append(settings, gomail.SetHeader(map[string][]string{"Content-Type": {attachment.Type}}))
+		}
+		m.Attach(attachment.Name, settings...)
+	}
 	return nil
 }
 
+// loadAttachments downloads the email's attachments from storage
+func loadAttachments(email *models.Email) ([]DeliveryAttachment, error) {
+	var attachments []DeliveryAttachment
+	remaining := models.MaxAttachmentsSize
+	for _, attachment := range email.Attachments {
+		file := attachment.File
+		if file == nil || file.SignedURL == "" {
+			return nil, fmt.Errorf("❌ failed to download attachment %s: file is not available", attachment.FileID)
+		}
+
+		content, err := FetchStoredFile(file.SignedURL, remaining)
+		if err != nil {
+			if strings.Contains(err.Error(), "exceeds") {
+				return nil, fmt.Errorf("❌ attachments exceed %d bytes", models.MaxAttachmentsSize)
+			}
+			return nil, fmt.Errorf("❌ failed to download attachment %s: %w", file.Name, err)
+		}
+		remaining -= int64(len(content))
+
+		attachments = append(attachments, DeliveryAttachment{Name: file.Name, Type: file.Type, Content: content})
+	}
+	return attachments, nil
+}
+
+// runBeforeSendHooks runs the before email send hooks, applying the subject, bodies and headers
+// they return. The email ID header is kept so bounces still match the email.
+func runBeforeSendHooks(email *models.Email, body, text string, headers map[string]string) (string, string, error) {
+	if !hooks.Has(hooks.BeforeEmailSend) {
+		return body, text, nil
+	}
+
+	send := &hooks.EmailSend{
+		EmailID:    email.ID,
+		TeamID:     email.TeamID,
+		CampaignID: email.CampaignID,
+		ContactID:  email.ContactID,
+		From:       email.From,
+		FromName:   email.FromName,
+		To:         email.To,
+		Subject:    email.Subject,
+		HTML:       body,
+		PlainText:  text,
+		Headers:    maps.Clone(headers),
+	}
+	if err := hooks.Run(context.Background(), hooks.BeforeEmailSend, send); err != nil {
+		return body, text, err
+	}
+
+	email.Subject = send.Subject
+	clear(headers)
+	maps.Copy(headers, send.Headers)
+	headers[EmailIDHeader] = email.ID
+	return send.HTML, send.PlainText, nil
+}
+
 // SendBatchEmails sends multiple emails in parallel with rate limiting
 func (h *EmailHandler) SendBatchEmails(emails []*models.Email, smtpConfig *models.SMTPConfig) []BatchEmailResult {
 	results := make([]BatchEmailResult, len(emails))
@@ -174,6 +397,25 @@ func (h *EmailHandler) SendCampaignEmails(emails []*models.Email, batchSize int,
 	for i := 0; i < totalEmails; i += batchSize {
 		end := min(i+batchSize, totalEmails)
 
+		// Stop between batches if the campaign was paused or cancelled
+		if i > 0 && models.IsCampaignHalted(emails[i].CampaignID, db.GetDB()) {
+			h.logger.Warn("⏸️ Campaign %s was halted, stopping after %d emails", emails[i].CampaignID, i)
+			break
+		}
+
+		// Park the rest if an operator paused sending through the config mid-run
+		if i > 0 && models.IsSMTPSendingPaused(smtpConfig.ID, db.GetDB()) {
+			ids := make([]string, 0, totalEmails-i)
+			for _, email := range emails[i:] {
+				ids = append(ids, email.ID)
+			}
+			if err := models.ParkEmails(ids, db.GetDB()); err != nil {
+				h.logger.Warn("⚠️ Failed to park emails of smtp config %s: %v", smtpConfig.ID, err)
+			}
+			h.logger.Warn("🅿️ Sending through smtp config %s was paused, parked %d emails", smtpConfig.ID, len(ids))
+			break
+		}
+
 		h.logger.Info("📦 Sending batch from %d to %d", i, end)
 		// Send batch
 		batchResults := h.SendBatchEmails(emails[i:end], smtpConfig)
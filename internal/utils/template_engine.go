@@ -0,0 +1,639 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"kori/internal/models"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Templates are rendered by a small handlebars-style engine. Besides {{variable}} it has
+//
+//	{{#if plan}}…{{else}}…{{/if}}, {{#if eq plan "pro"}}…{{/if}} and {{#unless plan}}…{{/unless}}
+//	{{#each items}}{{@index}}: {{this.name}}{{else}}no items{{/each}}
+//	{{name | default "there" | capitalize}} and {{signed_up_at | date "Jan 2, 2006"}}
+//	{{! comments, left out of the output}}
+//
+// Filters also take Liquid's syntax and names, e.g. {{ first_name | default: "there" | upcase }}
+// and {{ signed_up_at | date: "%b %d, %Y" }}.
+//
+// Variables are strings; those holding a JSON array or object, e.g. structured data sent
+// with a transactional email, can be looped over and have their fields looked up. The engine
+// only looks values up and applies the filters below, so templates can't run code or reach
+// anything but their variables, and their nesting, loops and output are bounded.
+const (
+	maxTemplateDepth      = 10
+	maxTemplateIterations = 10000
+	maxTemplateOutput     = models.MaxRenderedSize
+)
+
+// DefaultDateLayout is how the date filter formats dates when no layout is given
+const DefaultDateLayout = "Jan 2, 2006"
+
+// templateFilters are the filters values can be piped through, with the number of arguments they take
+var templateFilters = map[string]int{
+	"default":    1,
+	"upper":      0,
+	"lower":      0,
+	"capitalize": 0,
+	"trim":       0,
+	"truncate":   1,
+	"date":       -1, // the layout is optional
+}
+
+// templateFilterAliases are Liquid's names for the filters
+var templateFilterAliases = map[string]string{
+	"upcase":   "upper",
+	"downcase": "lower",
+	"strip":    "trim",
+}
+
+// strftimeLayouts translates the strftime directives of Liquid date layouts to Go's
+var strftimeLayouts = strings.NewReplacer(
+	"%Y", "2006", "%y", "06", "%m", "01", "%-m", "1", "%d", "02", "%-d", "2", "%e", "_2",
+	"%B", "January", "%b", "Jan", "%A", "Monday", "%a", "Mon",
+	"%H", "15", "%I", "03", "%-I", "3", "%M", "04", "%S", "05", "%p", "PM", "%Z", "MST", "%z", "-0700", "%%", "%",
+)
+
+// dateInputLayouts are the formats the date filter reads dates in, besides unix timestamps
+var dateInputLayouts = []string{time.RFC3339Nano, "2006-01-02 15:04:05", "2006-01-02T15:04:05", "2006-01-02"}
+
+// TemplateError is a template that can't be rendered, e.g. one with a block left open
+type TemplateError struct {
+	Position int // byte offset of the tag at fault
+	Message  string
+}
+
+func (e *TemplateError) Error() string {
+	return fmt.Sprintf("template error at position %d: %s", e.Position, e.Message)
+}
+
+type templateNode interface{}
+
+type templateText string
+
+// templateOutput outputs a value; raw is the tag as written, kept when the value is missing
+type templateOutput struct {
+	raw     string
+	path    string
+	filters []templateFilter
+}
+
+type templateFilter struct {
+	name string
+	args []templateArg
+}
+
+// templateArg is a literal or the path of a value
+type templateArg struct {
+	literal string
+	path    string
+}
+
+type templateBlock struct {
+	kind     string // if, unless or each
+	operator string // eq or ne for comparisons, if and unless only
+	args     []templateArg
+	body     []templateNode
+	elseBody []templateNode
+}
+
+// ValidateTemplate reports whether the template can be rendered
+func ValidateTemplate(input string) error {
+	_, err := parseTemplate(input)
+	return err
+}
+
+// RenderTemplate renders the template with the variables. Variables the template refers to
+// but that aren't given are left in the output as written.
+func RenderTemplate(input string, variables map[string]string) (string, error) {
+	if !strings.Contains(input, "{{") {
+		return input, nil
+	}
+	nodes, err := parseTemplate(input)
+	if err != nil {
+		return "", err
+	}
+	root := make(map[string]interface{}, len(variables))
+	for name, value := range variables {
+		root[name] = decodeTemplateValue(value)
+	}
+	r := &templateRenderer{scopes: []templateScope{{value: root}}}
+	if err := r.render(nodes); err != nil {
+		return "", err
+	}
+	return r.out.String(), nil
+}
+
+// decodeTemplateValue decodes variables holding a JSON array or object
+func decodeTemplateValue(value string) interface{} {
+	trimmed := strings.TrimSpace(value)
+	if trimmed == "" || (trimmed[0] != '[' && trimmed[0] != '{') {
+		return value
+	}
+	decoder := json.NewDecoder(strings.NewReader(trimmed))
+	decoder.UseNumber()
+	var decoded interface{}
+	if err := decoder.Decode(&decoded); err != nil || decoder.More() {
+		return value
+	}
+	return decoded
+}
+
+func parseTemplate(input string) ([]templateNode, error) {
+	type frame struct {
+		block    *templateBlock
+		position int
+		inElse   bool
+	}
+	root := &templateBlock{}
+	stack := []*frame{{block: root}}
+	add := func(node templateNode) {
+		top := stack[len(stack)-1]
+		if top.inElse {
+			top.block.elseBody = append(top.block.elseBody, node)
+		} else {
+			top.block.body = append(top.block.body, node)
+		}
+	}
+
+	for rest, offset := input, 0; rest != ""; {
+		start := strings.Index(rest, "{{")
+		if start < 0 {
+			add(templateText(rest))
+			break
+		}
+		end := strings.Index(rest[start:], "}}")
+		if end < 0 {
+			add(templateText(rest))
+			break
+		}
+		end += start + 2
+		if start > 0 {
+			add(templateText(rest[:start]))
+		}
+		raw, tag := rest[start:end], strings.TrimSpace(rest[start+2:end-2])
+		position := offset + start
+		rest, offset = rest[end:], offset+end
+
+		switch {
+		case strings.HasPrefix(tag, "!"):
+			// Comments aren't rendered
+		case strings.HasPrefix(tag, "#"):
+			if len(stack) > maxTemplateDepth {
+				return nil, &TemplateError{position, fmt.Sprintf("blocks are nested more than %d deep", maxTemplateDepth)}
+			}
+			block, err := parseTemplateBlock(tag[1:])
+			if err != nil {
+				return nil, &TemplateError{position, err.Error()}
+			}
+			add(block)
+			stack = append(stack, &frame{block: block, position: position})
+		case tag == "else":
+			top := stack[len(stack)-1]
+			if top.block == root || top.inElse {
+				return nil, &TemplateError{position, "{{else}} outside of a block"}
+			}
+			top.inElse = true
+		case strings.HasPrefix(tag, "/"):
+			kind := strings.TrimSpace(tag[1:])
+			top := stack[len(stack)-1]
+			if top.block == root {
+				return nil, &TemplateError{position, fmt.Sprintf("{{/%s}} closes no block", kind)}
+			}
+			if kind != top.block.kind {
+				return nil, &TemplateError{position, fmt.Sprintf("{{/%s}} closes {{#%s}}", kind, top.block.kind)}
+			}
+			stack = stack[:len(stack)-1]
+		default:
+			output, ok, err := parseTemplateOutput(raw, tag)
+			if err != nil {
+				return nil, &TemplateError{position, err.Error()}
+			}
+			if !ok {
+				// Not ours, e.g. a content block placeholder: left for whoever renders it
+				add(templateText(raw))
+				continue
+			}
+			add(output)
+		}
+	}
+
+	if len(stack) > 1 {
+		top := stack[len(stack)-1]
+		return nil, &TemplateError{top.position, fmt.Sprintf("{{#%s}} is never closed", top.block.kind)}
+	}
+	return root.body, nil
+}
+
+func parseTemplateBlock(tag string) (*templateBlock, error) {
+	words, err := splitTemplateWords(tag)
+	if err != nil {
+		return nil, err
+	}
+	if len(words) == 0 {
+		return nil, fmt.Errorf("block without a name")
+	}
+	block := &templateBlock{kind: words[0]}
+	words = words[1:]
+	switch block.kind {
+	case "if", "unless":
+		if len(words) > 0 && (words[0] == "eq" || words[0] == "ne") {
+			block.operator, words = words[0], words[1:]
+			if len(words) != 2 {
+				return nil, fmt.Errorf("{{#%s %s}} compares two values", block.kind, block.operator)
+			}
+		} else if len(words) != 1 {
+			return nil, fmt.Errorf("{{#%s}} takes one value", block.kind)
+		}
+	case "each":
+		if len(words) != 1 {
+			return nil, fmt.Errorf("{{#each}} takes one value")
+		}
+	default:
+		return nil, fmt.Errorf("unknown block {{#%s}}", block.kind)
+	}
+	for _, word := range words {
+		arg, err := parseTemplateArg(word)
+		if err != nil {
+			return nil, err
+		}
+		block.args = append(block.args, arg)
+	}
+	if block.kind == "each" && block.args[0].path == "" {
+		return nil, fmt.Errorf("{{#each}} loops over a variable")
+	}
+	return block, nil
+}
+
+// parseTemplateOutput parses a {{value | filter}} tag; ok is false for tags that aren't one
+func parseTemplateOutput(raw string, tag string) (output *templateOutput, ok bool, err error) {
+	parts := strings.Split(tag, "|")
+	path := strings.TrimSpace(parts[0])
+	if !isTemplatePath(path) {
+		return nil, false, nil
+	}
+	output = &templateOutput{raw: raw, path: path}
+	for _, part := range parts[1:] {
+		if colon := strings.IndexByte(part, ':'); colon >= 0 && !strings.ContainsAny(part[:colon], `"'`) {
+			part = part[:colon+1] + " " + part[colon+1:]
+		}
+		words, err := splitTemplateWords(part)
+		if err != nil {
+			return nil, false, err
+		}
+		if len(words) == 0 {
+			return nil, false, fmt.Errorf("empty filter on %s", path)
+		}
+		// Liquid puts a colon between the filter and its arguments
+		if name, found := strings.CutSuffix(words[0], ":"); found {
+			words[0] = name
+		} else if len(words) > 1 && words[1] == ":" {
+			words = append(words[:1], words[2:]...)
+		}
+		if alias, ok := templateFilterAliases[words[0]]; ok {
+			words[0] = alias
+		}
+		arity, known := templateFilters[words[0]]
+		if !known {
+			return nil, false, fmt.Errorf("unknown filter %q", words[0])
+		}
+		if args := len(words) - 1; (arity >= 0 && args != arity) || (arity < 0 && args > 1) {
+			return nil, false, fmt.Errorf("wrong number of arguments to filter %q", words[0])
+		}
+		filter := templateFilter{name: words[0]}
+		for _, word := range words[1:] {
+			arg, err := parseTemplateArg(word)
+			if err != nil {
+				return nil, false, err
+			}
+			filter.args = append(filter.args, arg)
+		}
+		output.filters = append(output.filters, filter)
+	}
+	return output, true, nil
+}
+
+// splitTemplateWords splits a tag on spaces and commas, keeping strings, in single or double
+// quotes, whole and quoted
+func splitTemplateWords(tag string) ([]string, error) {
+	var words []string
+	separator := func(r rune) bool { return r == ',' || unicode.IsSpace(r) }
+	for tag = strings.TrimLeftFunc(tag, separator); tag != ""; tag = strings.TrimLeftFunc(tag, separator) {
+		if quote := tag[0]; quote == '"' || quote == '\'' {
+			end := strings.IndexByte(tag[1:], quote)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			words, tag = append(words, tag[:end+2]), tag[end+2:]
+			continue
+		}
+		end := strings.IndexFunc(tag, separator)
+		if end < 0 {
+			end = len(tag)
+		}
+		words, tag = append(words, tag[:end]), tag[end:]
+	}
+	return words, nil
+}
+
+func parseTemplateArg(word string) (templateArg, error) {
+	if strings.HasPrefix(word, `"`) || strings.HasPrefix(word, "'") {
+		return templateArg{literal: word[1 : len(word)-1]}, nil
+	}
+	if _, err := strconv.ParseFloat(word, 64); err == nil {
+		return templateArg{literal: word}, nil
+	}
+	if !isTemplatePath(word) {
+		return templateArg{}, fmt.Errorf("%q is neither a variable nor a quoted string", word)
+	}
+	return templateArg{path: word}, nil
+}
+
+// isTemplatePath reports whether s looks up a value: name, name.field, this, this.field or @index
+func isTemplatePath(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, segment := range strings.Split(s, ".") {
+		if segment == "" {
+			return false
+		}
+		if i == 0 && segment[0] == '@' {
+			segment = segment[1:]
+			if segment == "" {
+				return false
+			}
+		}
+		for _, r := range segment {
+			if r != '_' && r != '-' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// templateScope is the value a block is rendered against, the variables or an item of a loop
+type templateScope struct {
+	value interface{}
+	loop  bool
+	index int
+	last  bool
+}
+
+type templateRenderer struct {
+	scopes     []templateScope
+	out        bytes.Buffer
+	iterations int
+}
+
+func (r *templateRenderer) render(nodes []templateNode) error {
+	for _, node := range nodes {
+		switch node := node.(type) {
+		case templateText:
+			r.out.WriteString(string(node))
+		case *templateOutput:
+			value, found := r.lookup(node.path)
+			if !found && !hasDefaultFilter(node.filters) {
+				r.out.WriteString(node.raw)
+				continue
+			}
+			r.out.WriteString(r.applyFilters(templateString(value), node.filters))
+		case *templateBlock:
+			if err := r.renderBlock(node); err != nil {
+				return err
+			}
+		}
+		if r.out.Len() > maxTemplateOutput {
+			return &TemplateError{Message: fmt.Sprintf("output is larger than %d bytes", maxTemplateOutput)}
+		}
+	}
+	return nil
+}
+
+func (r *templateRenderer) renderBlock(block *templateBlock) error {
+	if block.kind != "each" {
+		var truthy bool
+		if block.operator == "" {
+			truthy = templateTruthy(r.arg(block.args[0]))
+			if path := block.args[0].path; path != "" {
+				value, _ := r.lookup(path)
+				truthy = templateTruthy(value)
+			}
+		} else {
+			truthy = r.arg(block.args[0]) == r.arg(block.args[1])
+			if block.operator == "ne" {
+				truthy = !truthy
+			}
+		}
+		if truthy == (block.kind == "if") {
+			return r.render(block.body)
+		}
+		return r.render(block.elseBody)
+	}
+
+	value, _ := r.lookup(block.args[0].path)
+	var items []interface{}
+	switch value := value.(type) {
+	case []interface{}:
+		items = value
+	case map[string]interface{}:
+		// Objects are looped over in key order, so output doesn't change between sends
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			items = append(items, value[key])
+		}
+	}
+	if len(items) == 0 {
+		return r.render(block.elseBody)
+	}
+	for i, item := range items {
+		if r.iterations++; r.iterations > maxTemplateIterations {
+			return &TemplateError{Message: fmt.Sprintf("loops run more than %d times", maxTemplateIterations)}
+		}
+		r.scopes = append(r.scopes, templateScope{value: item, loop: true, index: i, last: i == len(items)-1})
+		err := r.render(block.body)
+		r.scopes = r.scopes[:len(r.scopes)-1]
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lookup finds the value of a path, in the innermost scope that has it
+func (r *templateRenderer) lookup(path string) (interface{}, bool) {
+	segments := strings.Split(path, ".")
+	switch first := segments[0]; {
+	case first == "this":
+		return templateField(r.scopes[len(r.scopes)-1].value, segments[1:])
+	case strings.HasPrefix(first, "@"):
+		for i := len(r.scopes) - 1; i >= 0; i-- {
+			if scope := r.scopes[i]; scope.loop {
+				switch first {
+				case "@index":
+					return json.Number(strconv.Itoa(scope.index)), true
+				case "@first":
+					return scope.index == 0, true
+				case "@last":
+					return scope.last, true
+				}
+			}
+		}
+		return nil, false
+	}
+	for i := len(r.scopes) - 1; i >= 0; i-- {
+		if value, found := templateField(r.scopes[i].value, segments); found {
+			return value, true
+		}
+	}
+	return nil, false
+}
+
+// templateField looks the path up in a value
+func templateField(value interface{}, segments []string) (interface{}, bool) {
+	for _, segment := range segments {
+		switch current := value.(type) {
+		case map[string]interface{}:
+			next, ok := current[segment]
+			if !ok {
+				return nil, false
+			}
+			value = next
+		case []interface{}:
+			index, err := strconv.Atoi(segment)
+			if err != nil || index < 0 || index >= len(current) {
+				return nil, false
+			}
+			value = current[index]
+		case string:
+			// Strings have no fields; {{name.first}} has always rendered name
+			return current, true
+		default:
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// arg returns an argument as a string, a missing variable being empty
+func (r *templateRenderer) arg(arg templateArg) string {
+	if arg.path == "" {
+		return arg.literal
+	}
+	value, _ := r.lookup(arg.path)
+	return templateString(value)
+}
+
+func (r *templateRenderer) applyFilters(value string, filters []templateFilter) string {
+	for _, filter := range filters {
+		switch filter.name {
+		case "default":
+			if strings.TrimSpace(value) == "" {
+				value = r.arg(filter.args[0])
+			}
+		case "upper":
+			value = strings.ToUpper(value)
+		case "lower":
+			value = strings.ToLower(value)
+		case "capitalize":
+			if first, size := utf8.DecodeRuneInString(value); size > 0 {
+				value = string(unicode.ToUpper(first)) + value[size:]
+			}
+		case "trim":
+			value = strings.TrimSpace(value)
+		case "truncate":
+			if limit, err := strconv.Atoi(r.arg(filter.args[0])); err == nil && limit >= 0 && utf8.RuneCountInString(value) > limit {
+				value = string([]rune(value)[:limit]) + "…"
+			}
+		case "date":
+			layout := DefaultDateLayout
+			if len(filter.args) > 0 {
+				layout = r.arg(filter.args[0])
+			}
+			if strings.Contains(layout, "%") {
+				layout = strftimeLayouts.Replace(layout)
+			}
+			if date, ok := parseTemplateDate(value); ok {
+				value = date.Format(layout)
+			}
+		}
+	}
+	return value
+}
+
+func hasDefaultFilter(filters []templateFilter) bool {
+	for _, filter := range filters {
+		if filter.name == "default" {
+			return true
+		}
+	}
+	return false
+}
+
+// parseTemplateDate reads a date given as text or as a unix timestamp in seconds
+func parseTemplateDate(value string) (time.Time, bool) {
+	value = strings.TrimSpace(value)
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0).UTC(), true
+	}
+	for _, layout := range dateInputLayouts {
+		if date, err := time.Parse(layout, value); err == nil {
+			return date, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// templateString is how a value is output: arrays and objects as JSON
+func templateString(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case json.Number:
+		return value.String()
+	case bool:
+		return strconv.FormatBool(value)
+	default:
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return ""
+		}
+		return string(encoded)
+	}
+}
+
+// templateTruthy is whether a value passes {{#if}}: present, not empty and, as variables are
+// strings, not "false" or "0"
+func templateTruthy(value interface{}) bool {
+	switch value := value.(type) {
+	case nil:
+		return false
+	case string:
+		value = strings.TrimSpace(value)
+		return value != "" && value != "false" && value != "0"
+	case json.Number:
+		number, err := value.Float64()
+		return err != nil || number != 0
+	case bool:
+		return value
+	case []interface{}:
+		return len(value) > 0
+	case map[string]interface{}:
+		return len(value) > 0
+	}
+	return true
+}
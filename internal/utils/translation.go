@@ -0,0 +1,275 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"regexp"
+	"strings"
+	"unicode"
+
+	xhtml "golang.org/x/net/html"
+)
+
+var (
+	// translationSkippedTags hold text no reader of the email sees
+	translationSkippedTags = map[string]bool{"head": true, "script": true, "style": true, "noscript": true}
+	// translationAttributes are the attributes whose text is shown, or read out, to readers
+	translationAttributes = map[string]bool{"alt": true, "title": true}
+	templateTagRe         = regexp.MustCompile(`{{[^}]*}}`)
+	// translationCSVHeader is the header row of translation CSV files
+	translationCSVHeader = []string{"id", "source", "target", "note"}
+)
+
+// TranslationUnit is a string of a template sent out for translation: its source text, the
+// translation when there is one, and a note for the translator
+type TranslationUnit struct {
+	ID     string `json:"id"`
+	Source string `json:"source"`
+	Target string `json:"target"`
+	Note   string `json:"note,omitempty"`
+}
+
+// TranslationFile is a template's strings in the languages they're translated between
+type TranslationFile struct {
+	Original       string            `json:"original"` // the template translated
+	SourceLanguage string            `json:"sourceLanguage"`
+	TargetLanguage string            `json:"targetLanguage"`
+	Units          []TranslationUnit `json:"units"`
+}
+
+// TranslatableText returns the text of an html document a translator translates, in document
+// order: text and alt and title attributes, leaving out the head, scripts and styles and text
+// that's only template tags
+func TranslatableText(input string) []string {
+	var texts []string
+	TranslateHTML(input, func(text string) string {
+		texts = append(texts, text)
+		return text
+	})
+	return texts
+}
+
+// TranslateHTML replaces each text TranslatableText returns, in the same order, with what
+// translate returns for it. The markup around the text is copied as is, so template tags,
+// conditional comments and the layout of the email survive.
+func TranslateHTML(input string, translate func(text string) string) string {
+	var out strings.Builder
+	z := xhtml.NewTokenizer(strings.NewReader(input))
+	skipped := 0
+	for {
+		tokenType := z.Next()
+		if tokenType == xhtml.ErrorToken {
+			// The tokenizer stops at the end of the input, or at input it can't read, which is kept
+			out.Write(z.Raw())
+			out.Write(z.Buffered())
+			return out.String()
+		}
+		raw := string(z.Raw())
+
+		switch tokenType {
+		case xhtml.TextToken:
+			text := string(z.Text())
+			core := strings.TrimSpace(text)
+			if skipped > 0 || !translatableText(core) {
+				out.WriteString(raw)
+				continue
+			}
+			translated := translate(core)
+			if translated == core {
+				// Untouched text keeps its entities
+				out.WriteString(raw)
+				continue
+			}
+			start := strings.Index(text, core)
+			out.WriteString(text[:start])
+			out.WriteString(textEscaper.Replace(translated))
+			out.WriteString(text[start+len(core):])
+
+		case xhtml.StartTagToken, xhtml.SelfClosingTagToken:
+			name, hasAttributes := z.TagName()
+			tag := string(name)
+			if tokenType == xhtml.StartTagToken && translationSkippedTags[tag] {
+				skipped++
+			}
+			if skipped > 0 || !hasAttributes {
+				out.WriteString(raw)
+				continue
+			}
+			out.WriteString(translateTag(tag, tokenType == xhtml.SelfClosingTagToken, z, raw, translate))
+
+		case xhtml.EndTagToken:
+			name, _ := z.TagName()
+			if translationSkippedTags[string(name)] && skipped > 0 {
+				skipped--
+			}
+			out.WriteString(raw)
+
+		default:
+			out.WriteString(raw)
+		}
+	}
+}
+
+// translateTag rewrites a tag with its alt and title translated, or returns it as it was when it
+// has neither
+func translateTag(tag string, selfClosing bool, z *xhtml.Tokenizer, raw string, translate func(string) string) string {
+	var rewritten strings.Builder
+	rewritten.WriteString("<" + tag)
+	translated := false
+	for more := true; more; {
+		var key, value []byte
+		key, value, more = z.TagAttr()
+		val := string(value)
+		if translationAttributes[string(key)] && translatableText(strings.TrimSpace(val)) {
+			if text := translate(strings.TrimSpace(val)); text != strings.TrimSpace(val) {
+				val, translated = text, true
+			}
+		}
+		rewritten.WriteString(" " + string(key) + `="` + html.EscapeString(val) + `"`)
+	}
+	if !translated {
+		return raw
+	}
+	if selfClosing {
+		rewritten.WriteString(" /")
+	}
+	rewritten.WriteString(">")
+	return rewritten.String()
+}
+
+// translatableText reports whether text has words to translate once template tags are left out
+func translatableText(text string) bool {
+	for _, r := range templateTagRe.ReplaceAllString(text, "") {
+		if unicode.IsLetter(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// xliffDocument is an XLIFF 1.2 file, the format translation tools and vendors exchange
+type xliffDocument struct {
+	XMLName xml.Name  `xml:"xliff"`
+	Xmlns   string    `xml:"xmlns,attr,omitempty"`
+	Version string    `xml:"version,attr"`
+	File    xliffFile `xml:"file"`
+}
+
+type xliffFile struct {
+	Original       string      `xml:"original,attr"`
+	SourceLanguage string      `xml:"source-language,attr"`
+	TargetLanguage string      `xml:"target-language,attr,omitempty"`
+	Datatype       string      `xml:"datatype,attr"`
+	Units          []xliffUnit `xml:"body>trans-unit"`
+}
+
+type xliffUnit struct {
+	ID     string `xml:"id,attr"`
+	Source string `xml:"source"`
+	Target string `xml:"target"`
+	Note   string `xml:"note,omitempty"`
+}
+
+// EncodeXLIFF writes a translation file as XLIFF 1.2
+func EncodeXLIFF(w io.Writer, file *TranslationFile) error {
+	doc := xliffDocument{Xmlns: "urn:oasis:names:tc:xliff:document:1.2", Version: "1.2", File: xliffFile{
+		Original:       file.Original,
+		SourceLanguage: file.SourceLanguage,
+		TargetLanguage: file.TargetLanguage,
+		Datatype:       "html",
+	}}
+	for _, unit := range file.Units {
+		doc.File.Units = append(doc.File.Units, xliffUnit(unit))
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		return fmt.Errorf("failed to encode xliff: %w", err)
+	}
+	return nil
+}
+
+// DecodeXLIFF reads an XLIFF 1.2 translation file
+func DecodeXLIFF(data []byte) (*TranslationFile, error) {
+	var doc xliffDocument
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid xliff: %w", err)
+	}
+	file := &TranslationFile{
+		Original:       doc.File.Original,
+		SourceLanguage: doc.File.SourceLanguage,
+		TargetLanguage: doc.File.TargetLanguage,
+	}
+	for _, unit := range doc.File.Units {
+		file.Units = append(file.Units, TranslationUnit(unit))
+	}
+	return file, nil
+}
+
+// EncodeTranslationCSV writes a translation file as CSV with id, source, target and note columns,
+// for vendors working in spreadsheets
+func EncodeTranslationCSV(w io.Writer, file *TranslationFile) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(translationCSVHeader); err != nil {
+		return err
+	}
+	for _, unit := range file.Units {
+		if err := writer.Write([]string{unit.ID, unit.Source, unit.Target, unit.Note}); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// DecodeTranslationCSV reads a translation CSV. Its columns are found by the header row, so
+// spreadsheets that reordered them or added their own still import; id and target are required.
+func DecodeTranslationCSV(data []byte) (*TranslationFile, error) {
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))))
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("invalid csv: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, errors.New("the csv is empty")
+	}
+
+	columns := map[string]int{}
+	for i, name := range records[0] {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, required := range []string{"id", "target"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("the csv has no %s column", required)
+		}
+	}
+	cell := func(record []string, column string) string {
+		if i, ok := columns[column]; ok && i < len(record) {
+			return record[i]
+		}
+		return ""
+	}
+
+	file := &TranslationFile{}
+	for _, record := range records[1:] {
+		unit := TranslationUnit{
+			ID:     strings.TrimSpace(cell(record, "id")),
+			Source: cell(record, "source"),
+			Target: cell(record, "target"),
+			Note:   cell(record, "note"),
+		}
+		if unit.ID != "" {
+			file.Units = append(file.Units, unit)
+		}
+	}
+	return file, nil
+}